@@ -0,0 +1,116 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package artifact_store
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// payloads can be gigabytes so only waiting for the server is bounded
+var httpClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: 30 * time.Second,
+	},
+}
+
+type (
+	// Store is where provision uploads the service payload and CloudFormation
+	// templates
+	Store interface {
+		// Exists is true if a non-empty object is stored at key
+		Exists(key string) (bool, error)
+
+		Put(object Object) error
+
+		// Get reads the object at key. The caller closes it
+		Get(key string) (io.ReadCloser, error)
+
+		// URL is where hosts download key from. It's empty when hosts read
+		// the store with their instance profile instead
+		URL(key string) string
+
+		// TemplateURL is where CloudFormation reads a template from. It's
+		// empty if CloudFormation can't read the store
+		TemplateURL(key string) string
+	}
+
+	Object struct {
+		Key             string
+		Body            []byte
+		ContentType     string
+		ContentEncoding string
+
+		// Metadata is stored with the object by stores that support it
+		Metadata map[string]string
+
+		// Infrequent objects use a cheaper storage class where there is one
+		Infrequent bool
+	}
+)
+
+// New is the artifact store of a region. roleSession is only used by the s3
+// store
+func New(config *conf.Config, region *conf.Region, roleSession *session.Session) (Store, error) {
+	storeConfig := config.ArtifactStore
+	if storeConfig == nil || storeConfig.Type == conf.ArtifactStore_S3 {
+		return &S3{
+			Session:     roleSession,
+			Bucket:      region.S3Bucket,
+			SSEKMSKeyId: region.SSEKMSKeyId,
+			BucketKey:   region.BucketKeyEnabled(),
+		}, nil
+	}
+
+	tokenEnv := storeConfig.TokenEnv
+
+	switch storeConfig.Type {
+	case conf.ArtifactStore_GCS:
+		if tokenEnv == "" {
+			tokenEnv = constants.EnvGCSAccessToken
+		}
+
+		token := os.Getenv(tokenEnv)
+		if token == "" {
+			return nil, fmt.Errorf("%s must hold a GCS access token", tokenEnv)
+		}
+
+		return &GCS{
+			Bucket: storeConfig.Bucket,
+			Token:  token,
+		}, nil
+
+	case conf.ArtifactStore_HTTP:
+		var token string
+		if tokenEnv != "" {
+			token = os.Getenv(tokenEnv)
+			if token == "" {
+				return nil, fmt.Errorf("%s is empty", tokenEnv)
+			}
+		}
+
+		return &HTTP{
+			BaseURL: storeConfig.BaseURL,
+			Token:   token,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown artifact store %s", storeConfig.Type)
+}
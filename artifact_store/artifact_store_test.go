@@ -0,0 +1,193 @@
+package artifact_store_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/adobe-platform/porter/artifact_store"
+)
+
+var _ = Describe("Artifact stores", func() {
+
+	Context("HTTP", func() {
+
+		var (
+			server  *httptest.Server
+			lock    sync.Mutex
+			objects map[string][]byte
+			headers map[string]http.Header
+		)
+
+		BeforeEach(func() {
+			objects = make(map[string][]byte)
+			headers = make(map[string]http.Header)
+
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				lock.Lock()
+				defer lock.Unlock()
+
+				if r.Header.Get("Authorization") != "Bearer token" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+
+				switch r.Method {
+				case "PUT":
+					objects[r.URL.Path], _ = ioutil.ReadAll(r.Body)
+					headers[r.URL.Path] = r.Header
+				case "HEAD", "GET":
+					body, exists := objects[r.URL.Path]
+					if !exists {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					w.Write(body)
+				}
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("Puts objects under the base URL", func() {
+			store := &artifact_store.HTTP{BaseURL: server.URL + "/artifacts/", Token: "token"}
+
+			exists, err := store.Exists("svc/payload.tar")
+			Expect(err).To(BeNil())
+			Expect(exists).To(BeFalse())
+
+			err = store.Put(artifact_store.Object{
+				Key:             "svc/payload.tar",
+				Body:            []byte("payload"),
+				ContentType:     "application/x-tar",
+				ContentEncoding: "gzip",
+			})
+			Expect(err).To(BeNil())
+
+			Expect(string(objects["/artifacts/svc/payload.tar"])).To(Equal("payload"))
+			Expect(headers["/artifacts/svc/payload.tar"].Get("Content-Encoding")).To(Equal("gzip"))
+
+			exists, err = store.Exists("svc/payload.tar")
+			Expect(err).To(BeNil())
+			Expect(exists).To(BeTrue())
+
+			reader, err := store.Get("svc/payload.tar")
+			Expect(err).To(BeNil())
+			payload, _ := ioutil.ReadAll(reader)
+			reader.Close()
+			Expect(string(payload)).To(Equal("payload"))
+
+			_, err = store.Get("svc/missing.tar")
+			Expect(err).ToNot(BeNil())
+
+			Expect(store.URL("svc/payload.tar")).To(Equal(server.URL + "/artifacts/svc/payload.tar"))
+			Expect(store.TemplateURL("svc/payload.tar")).To(BeEmpty())
+		})
+
+		It("Fails on errors other than not found", func() {
+			store := &artifact_store.HTTP{BaseURL: server.URL}
+
+			_, err := store.Exists("key")
+			Expect(err).ToNot(BeNil())
+
+			err = store.Put(artifact_store.Object{Key: "key"})
+			Expect(err).ToNot(BeNil())
+		})
+	})
+
+	Context("GCS", func() {
+
+		var (
+			server   *httptest.Server
+			lock     sync.Mutex
+			metadata map[string]interface{}
+			body     string
+		)
+
+		BeforeEach(func() {
+			metadata = nil
+			body = ""
+
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+
+				lock.Lock()
+				defer lock.Unlock()
+
+				Expect(r.Header.Get("Authorization")).To(Equal("Bearer token"))
+
+				switch {
+				case r.Method == "POST" && r.URL.Path == "/upload/storage/v1/b/bucket/o":
+					Expect(r.URL.Query().Get("uploadType")).To(Equal("multipart"))
+
+					mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+					Expect(err).To(BeNil())
+					Expect(mediaType).To(Equal("multipart/related"))
+
+					reader := multipart.NewReader(r.Body, params["boundary"])
+
+					part, err := reader.NextPart()
+					Expect(err).To(BeNil())
+					Expect(json.NewDecoder(part).Decode(&metadata)).To(Succeed())
+
+					part, err = reader.NextPart()
+					Expect(err).To(BeNil())
+					Expect(part.Header.Get("Content-Type")).To(Equal("application/json"))
+					bodyBytes, _ := ioutil.ReadAll(part)
+					body = string(bodyBytes)
+
+				case r.Method == "GET" && strings.HasPrefix(r.URL.EscapedPath(), "/storage/v1/b/bucket/o/"):
+					if body == "" {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					Expect(r.URL.EscapedPath()).To(Equal("/storage/v1/b/bucket/o/templates%2Fabc"))
+					w.Write([]byte(`{"name":"templates/abc","size":"2"}`))
+
+				default:
+					w.WriteHeader(http.StatusBadRequest)
+				}
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("Uploads the object with its metadata", func() {
+			store := &artifact_store.GCS{Bucket: "bucket", Token: "token", Endpoint: server.URL}
+
+			exists, err := store.Exists("templates/abc")
+			Expect(err).To(BeNil())
+			Expect(exists).To(BeFalse())
+
+			err = store.Put(artifact_store.Object{
+				Key:         "templates/abc",
+				Body:        []byte("{}"),
+				ContentType: "application/json",
+				Metadata:    map[string]string{"stack-id": "arn"},
+			})
+			Expect(err).To(BeNil())
+
+			Expect(metadata["name"]).To(Equal("templates/abc"))
+			Expect(metadata["metadata"]).To(Equal(map[string]interface{}{"stack-id": "arn"}))
+			Expect(body).To(Equal("{}"))
+
+			exists, err = store.Exists("templates/abc")
+			Expect(err).To(BeNil())
+			Expect(exists).To(BeTrue())
+
+			Expect(store.URL("templates/abc")).To(Equal(server.URL + "/bucket/templates/abc"))
+		})
+	})
+})
@@ -0,0 +1,190 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package artifact_store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+)
+
+const gcsEndpoint = "https://storage.googleapis.com"
+
+// GCS is a Google Cloud Storage bucket written with the JSON API. Hosts
+// download objects from their public URL so the bucket must be readable from
+// the VPC
+type GCS struct {
+	Bucket string
+
+	// Token is an OAuth 2.0 access token like the one
+	// `gcloud auth print-access-token` prints
+	Token string
+
+	// Endpoint is https://storage.googleapis.com if it's empty
+	Endpoint string
+}
+
+type gcsObject struct {
+	Name            string            `json:"name"`
+	Size            string            `json:"size,omitempty"`
+	ContentType     string            `json:"contentType,omitempty"`
+	ContentEncoding string            `json:"contentEncoding,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+}
+
+func (recv *GCS) Exists(key string) (bool, error) {
+	objectURL := fmt.Sprintf("%s/storage/v1/b/%s/o/%s", recv.endpoint(),
+		url.PathEscape(recv.Bucket), url.PathEscape(key))
+
+	req, err := http.NewRequest("GET", objectURL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+recv.Token)
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return false, nil
+	case res.StatusCode != http.StatusOK:
+		return false, fmt.Errorf("storage.objects.get %s returned %s", key, res.Status)
+	}
+
+	var object gcsObject
+	err = json.NewDecoder(res.Body).Decode(&object)
+	if err != nil {
+		return false, err
+	}
+
+	// the JSON API encodes uint64 as a string
+	size, _ := strconv.ParseUint(object.Size, 10, 64)
+	return size > 0, nil
+}
+
+// Put is a multipart upload so the object's metadata is set with its body
+func (recv *GCS) Put(object Object) error {
+	metadataBytes, err := json.Marshal(gcsObject{
+		Name:            object.Key,
+		ContentType:     object.ContentType,
+		ContentEncoding: object.ContentEncoding,
+		Metadata:        object.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+
+	contentType := object.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	for _, part := range []struct {
+		contentType string
+		body        []byte
+	}{
+		{"application/json; charset=UTF-8", metadataBytes},
+		{contentType, object.Body},
+	} {
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {part.contentType},
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = partWriter.Write(part.body)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	uploadURL := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=multipart",
+		recv.endpoint(), url.PathEscape(recv.Bucket))
+
+	req, err := http.NewRequest("POST", uploadURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+recv.Token)
+	req.Header.Set("Content-Type", "multipart/related; boundary="+writer.Boundary())
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("storage.objects.insert %s returned %s", object.Key, res.Status)
+	}
+
+	return nil
+}
+
+// Get downloads with the JSON API so the bucket doesn't need to be public to
+// the build box
+func (recv *GCS) Get(key string) (io.ReadCloser, error) {
+	objectURL := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", recv.endpoint(),
+		url.PathEscape(recv.Bucket), url.PathEscape(key))
+
+	req, err := http.NewRequest("GET", objectURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+recv.Token)
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("storage.objects.get %s returned %s", key, res.Status)
+	}
+
+	return res.Body, nil
+}
+
+func (recv *GCS) URL(key string) string {
+	return fmt.Sprintf("%s/%s/%s", recv.endpoint(), recv.Bucket, key)
+}
+
+func (recv *GCS) TemplateURL(key string) string {
+	return ""
+}
+
+func (recv *GCS) endpoint() string {
+	if recv.Endpoint == "" {
+		return gcsEndpoint
+	}
+	return recv.Endpoint
+}
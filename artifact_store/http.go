@@ -0,0 +1,115 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package artifact_store
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// HTTP is an artifact server that stores the body of a PUT to BaseURL/<key>
+// and serves it back on GET. Hosts download without credentials so the server
+// must be readable from the VPC
+type HTTP struct {
+	BaseURL string
+
+	// Token is sent as a bearer token with every request if it's set
+	Token string
+}
+
+func (recv *HTTP) Exists(key string) (bool, error) {
+	req, err := http.NewRequest("HEAD", recv.URL(key), nil)
+	if err != nil {
+		return false, err
+	}
+	recv.authorize(req)
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return false, nil
+	case res.StatusCode/100 != 2:
+		return false, fmt.Errorf("HEAD %s returned %s", recv.URL(key), res.Status)
+	}
+
+	return res.ContentLength != 0, nil
+}
+
+func (recv *HTTP) Put(object Object) error {
+	req, err := http.NewRequest("PUT", recv.URL(object.Key), bytes.NewReader(object.Body))
+	if err != nil {
+		return err
+	}
+	recv.authorize(req)
+
+	if object.ContentType != "" {
+		req.Header.Set("Content-Type", object.ContentType)
+	}
+
+	if object.ContentEncoding != "" {
+		req.Header.Set("Content-Encoding", object.ContentEncoding)
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("PUT %s returned %s", recv.URL(object.Key), res.Status)
+	}
+
+	return nil
+}
+
+func (recv *HTTP) Get(key string) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", recv.URL(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	recv.authorize(req)
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode/100 != 2 {
+		res.Body.Close()
+		return nil, fmt.Errorf("GET %s returned %s", recv.URL(key), res.Status)
+	}
+
+	return res.Body, nil
+}
+
+func (recv *HTTP) URL(key string) string {
+	return strings.TrimSuffix(recv.BaseURL, "/") + "/" + key
+}
+
+func (recv *HTTP) TemplateURL(key string) string {
+	return ""
+}
+
+func (recv *HTTP) authorize(req *http.Request) {
+	if recv.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+recv.Token)
+	}
+}
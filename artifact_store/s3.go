@@ -0,0 +1,137 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package artifact_store
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// bucketKeyHeader isn't modeled by the vendored SDK so it's set on the request
+const bucketKeyHeader = "X-Amz-Server-Side-Encryption-Bucket-Key-Enabled"
+
+// S3 is the region's s3_bucket. Hosts download from it with their instance
+// profile
+//
+// Every object is encrypted at rest. SSE-KMS is used with SSEKMSKeyId and
+// SSE-S3 otherwise
+type S3 struct {
+	Session     *session.Session
+	Bucket      string
+	SSEKMSKeyId *string
+
+	// BucketKey reduces KMS requests by having S3 use a bucket-level data key.
+	// It only applies to SSE-KMS
+	BucketKey bool
+}
+
+func (recv *S3) Exists(key string) (bool, error) {
+	headObjectOutput, err := s3.New(recv.Session).HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(recv.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "404") {
+			return false, nil
+		}
+		if strings.Contains(err.Error(), "403") {
+			return false, fmt.Errorf("s3:GetObject and s3:ListBucket are needed to check %s exists: %s", key, err)
+		}
+		return false, err
+	}
+
+	return headObjectOutput.ContentLength != nil && *headObjectOutput.ContentLength > 0, nil
+}
+
+func (recv *S3) Put(object Object) error {
+	uploadInput := &s3manager.UploadInput{
+		Bucket: aws.String(recv.Bucket),
+		Key:    aws.String(object.Key),
+		Body:   bytes.NewReader(object.Body),
+	}
+
+	if object.ContentType != "" {
+		uploadInput.ContentType = aws.String(object.ContentType)
+	}
+
+	if object.ContentEncoding != "" {
+		uploadInput.ContentEncoding = aws.String(object.ContentEncoding)
+	}
+
+	if len(object.Metadata) > 0 {
+		uploadInput.Metadata = make(map[string]*string)
+		for k, v := range object.Metadata {
+			uploadInput.Metadata[k] = aws.String(v)
+		}
+	}
+
+	if object.Infrequent {
+		uploadInput.StorageClass = aws.String("STANDARD_IA")
+	}
+
+	svc := s3.New(recv.Session)
+
+	if recv.SSEKMSKeyId != nil {
+		uploadInput.SSEKMSKeyId = recv.SSEKMSKeyId
+		uploadInput.ServerSideEncryption = aws.String("aws:kms")
+
+		if recv.BucketKey {
+			svc.Handlers.Build.PushBack(setBucketKeyHeader)
+		}
+	} else {
+		uploadInput.ServerSideEncryption = aws.String("AES256")
+	}
+
+	s3Manager := s3manager.NewUploaderWithClient(svc)
+	s3Manager.Concurrency = runtime.GOMAXPROCS(-1) // read, don't set, the value
+
+	_, err := s3Manager.Upload(uploadInput)
+	return err
+}
+
+func (recv *S3) Get(key string) (io.ReadCloser, error) {
+	getObjectOutput, err := s3.New(recv.Session).GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(recv.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return getObjectOutput.Body, nil
+}
+
+func (recv *S3) URL(key string) string {
+	return ""
+}
+
+func (recv *S3) TemplateURL(key string) string {
+	return fmt.Sprintf("https://s3.amazonaws.com/%s/%s", recv.Bucket, key)
+}
+
+// setBucketKeyHeader is a build handler for the requests s3manager uses to
+// create an object
+func setBucketKeyHeader(r *request.Request) {
+	switch r.Operation.Name {
+	case "PutObject", "CreateMultipartUpload":
+		r.HTTPRequest.Header.Set(bucketKeyHeader, "true")
+	}
+}
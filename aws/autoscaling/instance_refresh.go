@@ -0,0 +1,191 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package autoscaling
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	autoscalinglib "github.com/aws/aws-sdk-go/service/autoscaling"
+)
+
+// The vendored SDK predates instance refresh. These shapes are the subset of
+// the API porter uses and go through the SDK's query protocol handlers like
+// any other autoscaling operation
+//
+// http://docs.aws.amazon.com/autoscaling/ec2/APIReference/API_StartInstanceRefresh.html
+
+const (
+	InstanceRefreshPending            = "Pending"
+	InstanceRefreshInProgress         = "InProgress"
+	InstanceRefreshSuccessful         = "Successful"
+	InstanceRefreshFailed             = "Failed"
+	InstanceRefreshCancelling         = "Cancelling"
+	InstanceRefreshCancelled          = "Cancelled"
+	InstanceRefreshRollbackFailed     = "RollbackFailed"
+	InstanceRefreshRollbackSuccessful = "RollbackSuccessful"
+)
+
+type (
+	InstanceRefresh struct {
+		_ struct{} `type:"structure"`
+
+		InstanceRefreshId  *string `type:"string"`
+		Status             *string `type:"string"`
+		StatusReason       *string `type:"string"`
+		PercentageComplete *int64  `type:"integer"`
+		InstancesToUpdate  *int64  `type:"integer"`
+	}
+
+	startInstanceRefreshInput struct {
+		_ struct{} `type:"structure"`
+
+		AutoScalingGroupName *string             `type:"string" required:"true"`
+		Strategy             *string             `type:"string"`
+		Preferences          *refreshPreferences `type:"structure"`
+	}
+
+	refreshPreferences struct {
+		_ struct{} `type:"structure"`
+
+		InstanceWarmup       *int64 `type:"integer"`
+		MinHealthyPercentage *int64 `type:"integer"`
+	}
+
+	startInstanceRefreshOutput struct {
+		_ struct{} `type:"structure"`
+
+		InstanceRefreshId *string `type:"string"`
+	}
+
+	describeInstanceRefreshesInput struct {
+		_ struct{} `type:"structure"`
+
+		AutoScalingGroupName *string   `type:"string" required:"true"`
+		InstanceRefreshIds   []*string `type:"list"`
+	}
+
+	describeInstanceRefreshesOutput struct {
+		_ struct{} `type:"structure"`
+
+		InstanceRefreshes []*InstanceRefresh `type:"list"`
+	}
+
+	cancelInstanceRefreshInput struct {
+		_ struct{} `type:"structure"`
+
+		AutoScalingGroupName *string `type:"string" required:"true"`
+	}
+
+	cancelInstanceRefreshOutput struct {
+		_ struct{} `type:"structure"`
+
+		InstanceRefreshId *string `type:"string"`
+	}
+)
+
+// Don't force clients of this package to import
+// "github.com/aws/aws-sdk-go/service/autoscaling"
+func New(config *session.Session) *autoscalinglib.AutoScaling {
+	return autoscalinglib.New(config)
+}
+
+// StartInstanceRefresh replaces every instance in the group with one of the
+// group's own launch template while keeping minHealthyPercentage of the group
+// InService. The launch template is whatever CloudFormation last set on the
+// group so the group doesn't drift from its stack
+func StartInstanceRefresh(client *autoscalinglib.AutoScaling, asgName string,
+	minHealthyPercentage, instanceWarmup int) (string, error) {
+
+	input := &startInstanceRefreshInput{
+		AutoScalingGroupName: aws.String(asgName),
+		Strategy:             aws.String("Rolling"),
+		Preferences: &refreshPreferences{
+			InstanceWarmup:       aws.Int64(int64(instanceWarmup)),
+			MinHealthyPercentage: aws.Int64(int64(minHealthyPercentage)),
+		},
+	}
+	output := &startInstanceRefreshOutput{}
+
+	err := send(client, "StartInstanceRefresh", input, output)
+	if err != nil {
+		return "", err
+	}
+
+	if output.InstanceRefreshId == nil {
+		return "", errors.New("StartInstanceRefresh didn't return an InstanceRefreshId")
+	}
+
+	return *output.InstanceRefreshId, nil
+}
+
+func DescribeInstanceRefresh(client *autoscalinglib.AutoScaling, asgName, instanceRefreshId string) (*InstanceRefresh, error) {
+	input := &describeInstanceRefreshesInput{
+		AutoScalingGroupName: aws.String(asgName),
+		InstanceRefreshIds:   []*string{aws.String(instanceRefreshId)},
+	}
+	output := &describeInstanceRefreshesOutput{}
+
+	err := send(client, "DescribeInstanceRefreshes", input, output)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(output.InstanceRefreshes) != 1 || output.InstanceRefreshes[0].Status == nil {
+		return nil, errors.New("DescribeInstanceRefreshes didn't return the instance refresh")
+	}
+
+	return output.InstanceRefreshes[0], nil
+}
+
+// ActiveInstanceRefresh returns the group's instance refresh that hasn't
+// finished or nil if there isn't one
+func ActiveInstanceRefresh(client *autoscalinglib.AutoScaling, asgName string) (*InstanceRefresh, error) {
+	input := &describeInstanceRefreshesInput{
+		AutoScalingGroupName: aws.String(asgName),
+	}
+	output := &describeInstanceRefreshesOutput{}
+
+	err := send(client, "DescribeInstanceRefreshes", input, output)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, instanceRefresh := range output.InstanceRefreshes {
+		switch aws.StringValue(instanceRefresh.Status) {
+		case InstanceRefreshPending, InstanceRefreshInProgress, InstanceRefreshCancelling:
+			return instanceRefresh, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func CancelInstanceRefresh(client *autoscalinglib.AutoScaling, asgName string) error {
+	input := &cancelInstanceRefreshInput{
+		AutoScalingGroupName: aws.String(asgName),
+	}
+
+	return send(client, "CancelInstanceRefresh", input, &cancelInstanceRefreshOutput{})
+}
+
+func send(client *autoscalinglib.AutoScaling, operationName string, input, output interface{}) error {
+	op := &request.Operation{
+		Name:       operationName,
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}
+
+	return client.NewRequest(op, input, output).Send()
+}
@@ -0,0 +1,68 @@
+package cloudformation_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+var _ = Describe("CreateStack in audit mode", func() {
+
+	var (
+		server   *httptest.Server
+		requests int
+		client   *cfnlib.CloudFormation
+		planPath string
+	)
+
+	BeforeEach(func() {
+		requests = 0
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+		}))
+
+		client = cfnlib.New(aws_session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		}))
+
+		planFile, err := ioutil.TempFile("", "porter-audit")
+		Expect(err).To(BeNil())
+		planFile.Close()
+		planPath = planFile.Name()
+
+		os.Setenv(constants.EnvAuditPlan, planPath)
+	})
+
+	AfterEach(func() {
+		os.Unsetenv(constants.EnvAuditPlan)
+		os.Remove(planPath)
+		server.Close()
+	})
+
+	It("returns ErrAudited without a stack id", func() {
+		stackId, err := cloudformation.CreateStack(client, "stack", "https://bucket/template.json", "",
+			nil, nil, "")
+		Expect(err).To(Equal(cloudformation.ErrAudited))
+		Expect(stackId).To(BeEmpty())
+
+		stackId, err = cloudformation.CreateStackWithBody(client, "stack", "{}", "")
+		Expect(err).To(Equal(cloudformation.ErrAudited))
+		Expect(stackId).To(BeEmpty())
+
+		Expect(requests).To(Equal(0))
+	})
+})
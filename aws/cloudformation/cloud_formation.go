@@ -15,12 +15,17 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/adobe-platform/porter/aws_session"
 	"github.com/adobe-platform/porter/constants"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
 )
 
+// ErrAudited is returned by CreateStack when audit mode recorded the call
+// without sending it so there's no stack
+var ErrAudited = errors.New("audit mode didn't create the stack")
+
 // Don't force clients of this package to import
 // "github.com/aws/aws-sdk-go/service/cloudformation"
 func New(config *session.Session) *cfnlib.CloudFormation {
@@ -28,45 +33,120 @@ func New(config *session.Session) *cfnlib.CloudFormation {
 }
 
 // CreateStack using AWS http://docs.aws.amazon.com/sdk-for-go/api/service/cloudformation/CloudFormation.html#CreateStack-instance_method
-func CreateStack(client *cfnlib.CloudFormation, stackName string, cfnTemplateUrl string, parameters []*cfnlib.Parameter) (string, error) {
-	input := &cfnlib.CreateStackInput{
+//
+// The template is read from cfnTemplateUrl or, if it's empty, cfnTemplateBody.
+// CloudFormation uses the service role roleARN if it isn't empty
+func CreateStack(client *cfnlib.CloudFormation, stackName string, cfnTemplateUrl, cfnTemplateBody string, parameters []*cfnlib.Parameter, tags []*cfnlib.Tag, roleARN string) (string, error) {
+	input := &createStackInput{
 		StackName: aws.String(stackName),
 		Capabilities: []*string{
 			aws.String("CAPABILITY_IAM"), // Required
 		},
 		OnFailure:        aws.String("ROLLBACK"),
 		Parameters:       parameters,
-		TemplateURL:      aws.String(cfnTemplateUrl),
+		Tags:             tags,
 		TimeoutInMinutes: aws.Int64(int64(constants.StackCreationTimeout().Minutes())),
+		RoleARN:          optionalString(roleARN),
+	}
+
+	if cfnTemplateUrl != "" {
+		input.TemplateURL = aws.String(cfnTemplateUrl)
+	} else {
+		input.TemplateBody = aws.String(cfnTemplateBody)
 	}
 
-	output, err := client.CreateStack(input)
+	return createStack(client, input)
+}
+
+// CreateStackWithBody is CreateStack for templates small enough to inline
+func CreateStackWithBody(client *cfnlib.CloudFormation, stackName string, templateBody string, roleARN string) (string, error) {
+	input := &createStackInput{
+		StackName:        aws.String(stackName),
+		OnFailure:        aws.String("DELETE"),
+		TemplateBody:     aws.String(templateBody),
+		TimeoutInMinutes: aws.Int64(int64(constants.StackCreationTimeout().Minutes())),
+		RoleARN:          optionalString(roleARN),
+	}
+
+	return createStack(client, input)
+}
+
+func createStack(client *cfnlib.CloudFormation, input *createStackInput) (string, error) {
+	output := &cfnlib.CreateStackOutput{}
+	err := send(client, "CreateStack", input, output)
 	if err != nil {
 		return "", err
 	}
 
+	if output.StackId == nil {
+		if aws_session.AuditPath() != "" {
+			return "", ErrAudited
+		}
+		return "", errors.New("CreateStack returned no stack id")
+	}
+
 	return *output.StackId, nil
 }
 
-func DeleteStack(client *cfnlib.CloudFormation, stackName string) error {
-	input := &cfnlib.DeleteStackInput{
-		StackName: aws.String(stackName),
+// DeleteStack uses the service role roleARN if it isn't empty
+func DeleteStack(client *cfnlib.CloudFormation, stackName string, roleARN string) error {
+	return DeleteStackRetaining(client, stackName, nil, roleARN)
+}
+
+// DeleteStackRetaining is DeleteStack for a stack that failed to delete. The
+// resources in retainResources are left behind
+func DeleteStackRetaining(client *cfnlib.CloudFormation, stackName string, retainResources []*string, roleARN string) error {
+	input := &deleteStackInput{
+		StackName:       aws.String(stackName),
+		RetainResources: retainResources,
+		RoleARN:         optionalString(roleARN),
 	}
 
-	_, err := client.DeleteStack(input)
-	return err
+	return send(client, "DeleteStack", input, &cfnlib.DeleteStackOutput{})
 }
 
-func UpdateStack(client *cfnlib.CloudFormation, stackName string, cfnTemplateUrl string, parameters []*cfnlib.Parameter) error {
-	input := &cfnlib.UpdateStackInput{
+// UpdateStack reads the template from cfnTemplateUrl or, if it's empty,
+// cfnTemplateBody. CloudFormation uses the service role roleARN if it isn't
+// empty
+func UpdateStack(client *cfnlib.CloudFormation, stackName string, cfnTemplateUrl, cfnTemplateBody string, parameters []*cfnlib.Parameter, tags []*cfnlib.Tag, roleARN string) error {
+	input := &updateStackInput{
 		StackName:    aws.String(stackName),
-		TemplateURL:  aws.String(cfnTemplateUrl),
 		Capabilities: []*string{aws.String("CAPABILITY_IAM")},
 		Parameters:   parameters,
+		Tags:         tags,
+		RoleARN:      optionalString(roleARN),
+	}
+
+	if cfnTemplateUrl != "" {
+		input.TemplateURL = aws.String(cfnTemplateUrl)
+	} else {
+		input.TemplateBody = aws.String(cfnTemplateBody)
+	}
+
+	return send(client, "UpdateStack", input, &cfnlib.UpdateStackOutput{})
+}
+
+// UpdateStackWithBody is UpdateStack for templates small enough to inline
+func UpdateStackWithBody(client *cfnlib.CloudFormation, stackName string, templateBody string, roleARN string) error {
+	input := &updateStackInput{
+		StackName:    aws.String(stackName),
+		TemplateBody: aws.String(templateBody),
+		RoleARN:      optionalString(roleARN),
+	}
+
+	return send(client, "UpdateStack", input, &cfnlib.UpdateStackOutput{})
+}
+
+// UpdateStackParameters changes the stack's parameters and keeps its template
+func UpdateStackParameters(client *cfnlib.CloudFormation, stackName string, parameters []*cfnlib.Parameter, roleARN string) error {
+	input := &updateStackInput{
+		StackName:           aws.String(stackName),
+		Parameters:          parameters,
+		RoleARN:             optionalString(roleARN),
+		UsePreviousTemplate: aws.Bool(true),
 	}
 
-	_, err := client.UpdateStack(input)
-	return err
+	return send(client, "UpdateStack", input, &cfnlib.UpdateStackOutput{})
 }
 
 // DescribeStackResource using AWS http://docs.aws.amazon.com/sdk-for-go/api/service/cloudformation/CloudFormation.html#DescribeStackResource-instance_method
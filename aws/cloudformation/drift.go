@@ -0,0 +1,145 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package cloudformation
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// The vendored SDK predates drift detection. These shapes go through the
+// SDK's query protocol handlers like hook events do
+//
+// http://docs.aws.amazon.com/AWSCloudFormation/latest/APIReference/API_DescribeStackResourceDrifts.html
+
+// drift of resources that match the template isn't interesting
+const maxDriftPages = 10
+
+const (
+	StackDriftStatusDrifted    = "DRIFTED"
+	StackDriftStatusInSync     = "IN_SYNC"
+	StackDriftStatusNotChecked = "NOT_CHECKED"
+
+	ResourceDriftStatusModified = "MODIFIED"
+	ResourceDriftStatusDeleted  = "DELETED"
+)
+
+type (
+	// StackDriftInformation is the result of the stack's latest drift
+	// detection
+	StackDriftInformation struct {
+		_ struct{} `type:"structure"`
+
+		StackDriftStatus   *string    `type:"string"`
+		LastCheckTimestamp *time.Time `type:"timestamp" timestampFormat:"iso8601"`
+	}
+
+	StackResourceDrift struct {
+		_ struct{} `type:"structure"`
+
+		LogicalResourceId        *string    `type:"string"`
+		PhysicalResourceId       *string    `type:"string"`
+		ResourceType             *string    `type:"string"`
+		StackResourceDriftStatus *string    `type:"string"`
+		Timestamp                *time.Time `type:"timestamp" timestampFormat:"iso8601"`
+	}
+
+	driftStack struct {
+		_ struct{} `type:"structure"`
+
+		DriftInformation *StackDriftInformation `type:"structure"`
+	}
+
+	describeDriftStacksOutput struct {
+		_ struct{} `type:"structure"`
+
+		Stacks []*driftStack `type:"list"`
+	}
+
+	describeStackResourceDriftsInput struct {
+		_ struct{} `type:"structure"`
+
+		StackName                       *string   `type:"string" required:"true"`
+		StackResourceDriftStatusFilters []*string `type:"list"`
+		NextToken                       *string   `type:"string"`
+	}
+
+	describeStackResourceDriftsOutput struct {
+		_ struct{} `type:"structure"`
+
+		NextToken           *string               `type:"string"`
+		StackResourceDrifts []*StackResourceDrift `type:"list"`
+	}
+)
+
+// DescribeStackDrift returns the result of the stack's latest drift detection
+// and the resources it found modified or deleted. Detection isn't started
+// here so the stack's status is NOT_CHECKED until something else starts it
+func DescribeStackDrift(client *cfnlib.CloudFormation, stackId string) (*StackDriftInformation, []*StackResourceDrift, error) {
+	stacksOutput := &describeDriftStacksOutput{}
+
+	err := client.NewRequest(&request.Operation{
+		Name:       "DescribeStacks",
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}, &cfnlib.DescribeStacksInput{
+		StackName: aws.String(stackId),
+	}, stacksOutput).Send()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info := &StackDriftInformation{
+		StackDriftStatus: aws.String(StackDriftStatusNotChecked),
+	}
+	if len(stacksOutput.Stacks) == 1 && stacksOutput.Stacks[0].DriftInformation != nil {
+		info = stacksOutput.Stacks[0].DriftInformation
+	}
+
+	drifts := make([]*StackResourceDrift, 0)
+	if aws.StringValue(info.StackDriftStatus) == StackDriftStatusNotChecked {
+		return info, drifts, nil
+	}
+
+	input := &describeStackResourceDriftsInput{
+		StackName: aws.String(stackId),
+		StackResourceDriftStatusFilters: aws.StringSlice([]string{
+			ResourceDriftStatusModified,
+			ResourceDriftStatusDeleted,
+		}),
+	}
+
+	for page := 0; page < maxDriftPages; page++ {
+		output := &describeStackResourceDriftsOutput{}
+
+		err = client.NewRequest(&request.Operation{
+			Name:       "DescribeStackResourceDrifts",
+			HTTPMethod: "POST",
+			HTTPPath:   "/",
+		}, input, output).Send()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		drifts = append(drifts, output.StackResourceDrifts...)
+
+		if output.NextToken == nil {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+
+	return info, drifts, nil
+}
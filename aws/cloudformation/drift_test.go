@@ -0,0 +1,88 @@
+package cloudformation_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+var _ = Describe("Stack drift", func() {
+
+	var (
+		server    *httptest.Server
+		forms     []url.Values
+		responses map[string]string
+		client    *cfnlib.CloudFormation
+	)
+
+	BeforeEach(func() {
+		forms = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.ParseForm()).To(Succeed())
+			forms = append(forms, r.PostForm)
+
+			w.Write([]byte(responses[r.PostForm.Get("Action")]))
+		}))
+
+		client = cfnlib.New(session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("reads modified and deleted resources of a drifted stack", func() {
+		responses = map[string]string{
+			"DescribeStacks": `<DescribeStacksResponse><DescribeStacksResult><Stacks><member>
+				<DriftInformation><StackDriftStatus>DRIFTED</StackDriftStatus><LastCheckTimestamp>2016-09-01T12:00:00Z</LastCheckTimestamp></DriftInformation>
+				</member></Stacks></DescribeStacksResult></DescribeStacksResponse>`,
+			"DescribeStackResourceDrifts": `<DescribeStackResourceDriftsResponse><DescribeStackResourceDriftsResult><StackResourceDrifts><member>
+				<LogicalResourceId>InetSG</LogicalResourceId>
+				<ResourceType>AWS::EC2::SecurityGroup</ResourceType>
+				<StackResourceDriftStatus>MODIFIED</StackResourceDriftStatus>
+				</member></StackResourceDrifts></DescribeStackResourceDriftsResult></DescribeStackResourceDriftsResponse>`,
+		}
+
+		info, drifts, err := cloudformation.DescribeStackDrift(client, "stack")
+		Expect(err).To(BeNil())
+
+		Expect(aws.StringValue(info.StackDriftStatus)).To(Equal(cloudformation.StackDriftStatusDrifted))
+		Expect(info.LastCheckTimestamp).NotTo(BeNil())
+
+		Expect(drifts).To(HaveLen(1))
+		Expect(aws.StringValue(drifts[0].LogicalResourceId)).To(Equal("InetSG"))
+		Expect(aws.StringValue(drifts[0].StackResourceDriftStatus)).To(Equal(cloudformation.ResourceDriftStatusModified))
+
+		Expect(forms).To(HaveLen(2))
+		Expect(forms[1].Get("StackResourceDriftStatusFilters.member.1")).To(Equal("MODIFIED"))
+		Expect(forms[1].Get("StackResourceDriftStatusFilters.member.2")).To(Equal("DELETED"))
+	})
+
+	It("doesn't read resources of a stack that was never checked", func() {
+		responses = map[string]string{
+			"DescribeStacks": `<DescribeStacksResponse><DescribeStacksResult><Stacks><member>
+				</member></Stacks></DescribeStacksResult></DescribeStacksResponse>`,
+		}
+
+		info, drifts, err := cloudformation.DescribeStackDrift(client, "stack")
+		Expect(err).To(BeNil())
+
+		Expect(aws.StringValue(info.StackDriftStatus)).To(Equal(cloudformation.StackDriftStatusNotChecked))
+		Expect(drifts).To(BeEmpty())
+		Expect(forms).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,131 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package cloudformation
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// The vendored SDK predates CloudFormation hooks so its StackEvent drops the
+// Hook* fields. This shape has them and goes through the SDK's query protocol
+// handlers like any other cloudformation operation
+//
+// http://docs.aws.amazon.com/AWSCloudFormation/latest/APIReference/API_StackEvent.html
+
+// hooks fail during creation or an update so older events aren't read
+const maxHookEventPages = 10
+
+const (
+	HookStatusInProgress     = "HOOK_IN_PROGRESS"
+	HookStatusCompleteFailed = "HOOK_COMPLETE_FAILED"
+	HookStatusFailed         = "HOOK_FAILED"
+)
+
+// Guard hooks list the rules that failed in the status reason in a few ways
+var hookRuleRegexes = []*regexp.Regexp{
+	regexp.MustCompile(`[Rr]ule\(s\) failed: *([^.]+)`),
+	regexp.MustCompile(`[Rr]ule \[([^\]]+)\]`),
+	regexp.MustCompile(`[Rr]ule ([A-Za-z0-9_-]+) (?:failed|was violated)`),
+}
+
+type (
+	HookStackEvent struct {
+		_ struct{} `type:"structure"`
+
+		LogicalResourceId    *string    `type:"string"`
+		ResourceType         *string    `type:"string"`
+		ResourceStatus       *string    `type:"string"`
+		ResourceStatusReason *string    `type:"string"`
+		HookType             *string    `type:"string"`
+		HookStatus           *string    `type:"string"`
+		HookStatusReason     *string    `type:"string"`
+		HookInvocationPoint  *string    `type:"string"`
+		HookFailureMode      *string    `type:"string"`
+		Timestamp            *time.Time `type:"timestamp" timestampFormat:"iso8601"`
+	}
+
+	describeHookStackEventsOutput struct {
+		_ struct{} `type:"structure"`
+
+		NextToken   *string           `type:"string"`
+		StackEvents []*HookStackEvent `type:"list"`
+	}
+)
+
+// DescribeHookFailures returns the events of hooks that failed on the stack,
+// oldest first
+func DescribeHookFailures(client *cfnlib.CloudFormation, stackId string) ([]*HookStackEvent, error) {
+	input := &cfnlib.DescribeStackEventsInput{
+		StackName: aws.String(stackId),
+	}
+
+	failures := make([]*HookStackEvent, 0)
+	for page := 0; page < maxHookEventPages; page++ {
+		output := &describeHookStackEventsOutput{}
+
+		op := &request.Operation{
+			Name:       "DescribeStackEvents",
+			HTTPMethod: "POST",
+			HTTPPath:   "/",
+		}
+
+		err := client.NewRequest(op, input, output).Send()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, event := range output.StackEvents {
+			switch aws.StringValue(event.HookStatus) {
+			case HookStatusCompleteFailed, HookStatusFailed:
+				// events are newest first
+				failures = append([]*HookStackEvent{event}, failures...)
+			}
+		}
+
+		if output.NextToken == nil {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+
+	return failures, nil
+}
+
+// Rules are the names of the rules the hook's status reason says failed
+func (recv *HookStackEvent) Rules() []string {
+	reason := aws.StringValue(recv.HookStatusReason)
+
+	for _, hookRuleRegex := range hookRuleRegexes {
+		matches := hookRuleRegex.FindAllStringSubmatch(reason, -1)
+		if len(matches) == 0 {
+			continue
+		}
+
+		rules := make([]string, 0)
+		for _, match := range matches {
+			for _, rule := range strings.Split(match[1], ",") {
+				if rule = strings.TrimSpace(rule); rule != "" {
+					rules = append(rules, rule)
+				}
+			}
+		}
+		return rules
+	}
+
+	return nil
+}
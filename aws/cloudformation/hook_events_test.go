@@ -0,0 +1,33 @@
+package cloudformation_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+var _ = Describe("Hook stack events", func() {
+
+	rules := func(reason string) []string {
+		event := &cloudformation.HookStackEvent{
+			HookStatusReason: aws.String(reason),
+		}
+		return event.Rules()
+	}
+
+	It("finds the rules a Guard hook says failed", func() {
+		Expect(rules("Template failed validation, the following rule(s) failed: S3_BUCKET_VERSIONING_ENABLED, S3_BUCKET_LOGGING_ENABLED.")).
+			To(Equal([]string{"S3_BUCKET_VERSIONING_ENABLED", "S3_BUCKET_LOGGING_ENABLED"}))
+
+		Expect(rules("Rule [EC2_NO_PUBLIC_IP] failed for resource LaunchTemplate")).
+			To(Equal([]string{"EC2_NO_PUBLIC_IP"}))
+
+		Expect(rules("rule required_tags was violated")).To(Equal([]string{"required_tags"}))
+	})
+
+	It("returns nothing when no rule is named", func() {
+		Expect(rules("Hook timed out")).To(BeEmpty())
+	})
+})
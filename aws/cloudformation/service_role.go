@@ -0,0 +1,77 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package cloudformation
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// The vendored SDK predates service roles. These are its stack operation
+// inputs with RoleARN and go through the SDK's query protocol handlers like
+// drift detection does
+//
+// http://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/using-iam-servicerole.html
+
+type (
+	createStackInput struct {
+		_ struct{} `type:"structure"`
+
+		Capabilities     []*string           `type:"list"`
+		OnFailure        *string             `type:"string"`
+		Parameters       []*cfnlib.Parameter `type:"list"`
+		RoleARN          *string             `type:"string"`
+		StackName        *string             `type:"string" required:"true"`
+		Tags             []*cfnlib.Tag       `type:"list"`
+		TemplateBody     *string             `type:"string"`
+		TemplateURL      *string             `type:"string"`
+		TimeoutInMinutes *int64              `type:"integer"`
+	}
+
+	updateStackInput struct {
+		_ struct{} `type:"structure"`
+
+		Capabilities        []*string           `type:"list"`
+		Parameters          []*cfnlib.Parameter `type:"list"`
+		RoleARN             *string             `type:"string"`
+		StackName           *string             `type:"string" required:"true"`
+		Tags                []*cfnlib.Tag       `type:"list"`
+		TemplateBody        *string             `type:"string"`
+		TemplateURL         *string             `type:"string"`
+		UsePreviousTemplate *bool               `type:"boolean"`
+	}
+
+	deleteStackInput struct {
+		_ struct{} `type:"structure"`
+
+		RetainResources []*string `type:"list"`
+		RoleARN         *string   `type:"string"`
+		StackName       *string   `type:"string" required:"true"`
+	}
+)
+
+func send(client *cfnlib.CloudFormation, operationName string, input, output interface{}) error {
+	return client.NewRequest(&request.Operation{
+		Name:       operationName,
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}, input, output).Send()
+}
+
+// optionalString is nil for "" so the parameter is left out of the request
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return aws.String(value)
+}
@@ -0,0 +1,107 @@
+package cloudformation_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+var _ = Describe("Stack service role", func() {
+
+	var (
+		server *httptest.Server
+		forms  []url.Values
+		client *cfnlib.CloudFormation
+	)
+
+	BeforeEach(func() {
+		forms = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.ParseForm()).To(Succeed())
+			forms = append(forms, r.PostForm)
+
+			switch r.PostForm.Get("Action") {
+			case "CreateStack":
+				w.Write([]byte(`<CreateStackResponse><CreateStackResult><StackId>stack-id</StackId></CreateStackResult></CreateStackResponse>`))
+			case "UpdateStack":
+				w.Write([]byte(`<UpdateStackResponse><UpdateStackResult><StackId>stack-id</StackId></UpdateStackResult></UpdateStackResponse>`))
+			case "DeleteStack":
+				w.Write([]byte(`<DeleteStackResponse></DeleteStackResponse>`))
+			}
+		}))
+
+		client = cfnlib.New(session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("passes the service role to CreateStack", func() {
+		parameters := []*cfnlib.Parameter{
+			{ParameterKey: aws.String("Key"), ParameterValue: aws.String("Value")},
+		}
+
+		stackId, err := cloudformation.CreateStack(client, "stack", "https://bucket/template.json", "",
+			parameters, nil, "arn:aws:iam::123456789012:role/cfn")
+		Expect(err).To(BeNil())
+		Expect(stackId).To(Equal("stack-id"))
+
+		Expect(forms).To(HaveLen(1))
+		Expect(forms[0].Get("RoleARN")).To(Equal("arn:aws:iam::123456789012:role/cfn"))
+		Expect(forms[0].Get("TemplateURL")).To(Equal("https://bucket/template.json"))
+		Expect(forms[0].Get("Parameters.member.1.ParameterKey")).To(Equal("Key"))
+		Expect(forms[0].Get("Capabilities.member.1")).To(Equal("CAPABILITY_IAM"))
+	})
+
+	It("passes the service role to UpdateStack and DeleteStack", func() {
+		Expect(cloudformation.UpdateStackWithBody(client, "stack", "{}", "arn:aws:iam::123456789012:role/cfn")).To(Succeed())
+		Expect(cloudformation.DeleteStackRetaining(client, "stack", aws.StringSlice([]string{"Bucket"}),
+			"arn:aws:iam::123456789012:role/cfn")).To(Succeed())
+
+		Expect(forms).To(HaveLen(2))
+		Expect(forms[0].Get("Action")).To(Equal("UpdateStack"))
+		Expect(forms[0].Get("RoleARN")).To(Equal("arn:aws:iam::123456789012:role/cfn"))
+		Expect(forms[1].Get("Action")).To(Equal("DeleteStack"))
+		Expect(forms[1].Get("RoleARN")).To(Equal("arn:aws:iam::123456789012:role/cfn"))
+		Expect(forms[1].Get("RetainResources.member.1")).To(Equal("Bucket"))
+	})
+
+	It("keeps the template when only parameters change", func() {
+		parameters := []*cfnlib.Parameter{
+			{ParameterKey: aws.String("Key"), ParameterValue: aws.String("Value")},
+		}
+
+		Expect(cloudformation.UpdateStackParameters(client, "stack", parameters,
+			"arn:aws:iam::123456789012:role/cfn")).To(Succeed())
+
+		Expect(forms).To(HaveLen(1))
+		Expect(forms[0].Get("Action")).To(Equal("UpdateStack"))
+		Expect(forms[0].Get("UsePreviousTemplate")).To(Equal("true"))
+		Expect(forms[0]).NotTo(HaveKey("TemplateBody"))
+		Expect(forms[0].Get("Parameters.member.1.ParameterValue")).To(Equal("Value"))
+		Expect(forms[0].Get("RoleARN")).To(Equal("arn:aws:iam::123456789012:role/cfn"))
+	})
+
+	It("leaves the service role out without one", func() {
+		Expect(cloudformation.DeleteStack(client, "stack", "")).To(Succeed())
+
+		Expect(forms).To(HaveLen(1))
+		Expect(forms[0]).NotTo(HaveKey("RoleARN"))
+		Expect(forms[0].Get("StackName")).To(Equal("stack"))
+	})
+})
@@ -0,0 +1,103 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package cloudwatch
+
+import (
+	"github.com/adobe-platform/porter/aws/queryprotocol"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+)
+
+// The vendored SDK has no CloudWatch client. This is the subset of the API
+// porter uses
+//
+// http://docs.aws.amazon.com/AmazonCloudWatch/latest/APIReference/Welcome.html
+
+const (
+	ServiceName = "monitoring"
+
+	ErrCodeResourceNotFound = "ResourceNotFound"
+)
+
+type (
+	CloudWatch struct {
+		*client.Client
+	}
+
+	DeleteAlarmsInput struct {
+		AlarmNames []string
+	}
+
+	DeleteAlarmsOutput struct{}
+
+	PutMetricAlarmInput struct {
+		AlarmName          string
+		AlarmDescription   string
+		Namespace          string
+		MetricName         string
+		Dimensions         []Dimension
+		Statistic          string
+		Period             int
+		EvaluationPeriods  int
+		Threshold          float64
+		ComparisonOperator string
+		TreatMissingData   string
+	}
+
+	PutMetricAlarmOutput struct{}
+
+	PutMetricDataInput struct {
+		Namespace  string
+		MetricData []MetricDatum
+	}
+
+	MetricDatum struct {
+		MetricName string
+		Dimensions []Dimension
+		Value      float64
+		Unit       string
+	}
+
+	Dimension struct {
+		Name  string
+		Value string
+	}
+
+	PutMetricDataOutput struct{}
+)
+
+func New(p client.ConfigProvider, cfgs ...*aws.Config) *CloudWatch {
+	return &CloudWatch{
+		Client: queryprotocol.NewClient(p, ServiceName, ServiceName, "2010-08-01", cfgs...),
+	}
+}
+
+// http://docs.aws.amazon.com/AmazonCloudWatch/latest/APIReference/API_DeleteAlarms.html
+func (recv *CloudWatch) DeleteAlarms(input *DeleteAlarmsInput) (*DeleteAlarmsOutput, error) {
+	output := &DeleteAlarmsOutput{}
+	err := queryprotocol.Send(recv.Client, "DeleteAlarms", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/AmazonCloudWatch/latest/APIReference/API_PutMetricAlarm.html
+func (recv *CloudWatch) PutMetricAlarm(input *PutMetricAlarmInput) (*PutMetricAlarmOutput, error) {
+	output := &PutMetricAlarmOutput{}
+	err := queryprotocol.Send(recv.Client, "PutMetricAlarm", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/AmazonCloudWatch/latest/APIReference/API_PutMetricData.html
+func (recv *CloudWatch) PutMetricData(input *PutMetricDataInput) (*PutMetricDataOutput, error) {
+	output := &PutMetricDataOutput{}
+	err := queryprotocol.Send(recv.Client, "PutMetricData", input, output)
+	return output, err
+}
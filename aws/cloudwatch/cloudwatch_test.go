@@ -0,0 +1,143 @@
+package cloudwatch_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/cloudwatch"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+var _ = Describe("CloudWatch", func() {
+
+	var (
+		server  *httptest.Server
+		form    url.Values
+		handler func(w http.ResponseWriter)
+		client  *cloudwatch.CloudWatch
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("Authorization")).To(ContainSubstring("/monitoring/aws4_request"))
+
+			Expect(r.ParseForm()).To(Succeed())
+			form = r.PostForm
+
+			handler(w)
+		}))
+
+		client = cloudwatch.New(session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("DeleteAlarms encodes the alarm names as a query list", func() {
+		handler = func(w http.ResponseWriter) {
+			w.Write([]byte(`<DeleteAlarmsResponse><ResponseMetadata><RequestId>id</RequestId></ResponseMetadata></DeleteAlarmsResponse>`))
+		}
+
+		_, err := client.DeleteAlarms(&cloudwatch.DeleteAlarmsInput{
+			AlarmNames: []string{"a", "b"},
+		})
+		Expect(err).To(BeNil())
+
+		Expect(form.Get("Action")).To(Equal("DeleteAlarms"))
+		Expect(form.Get("Version")).To(Equal("2010-08-01"))
+		Expect(form.Get("AlarmNames.member.1")).To(Equal("a"))
+		Expect(form.Get("AlarmNames.member.2")).To(Equal("b"))
+	})
+
+	It("PutMetricData encodes the metrics and their dimensions", func() {
+		handler = func(w http.ResponseWriter) {
+			w.Write([]byte(`<PutMetricDataResponse><ResponseMetadata><RequestId>id</RequestId></ResponseMetadata></PutMetricDataResponse>`))
+		}
+
+		_, err := client.PutMetricData(&cloudwatch.PutMetricDataInput{
+			Namespace: "Porter/Deploys",
+			MetricData: []cloudwatch.MetricDatum{
+				{
+					MetricName: "DeployDuration",
+					Dimensions: []cloudwatch.Dimension{
+						{Name: "ServiceName", Value: "svc"},
+						{Name: "Environment", Value: "prod"},
+					},
+					Value: 90.5,
+					Unit:  "Seconds",
+				},
+				{
+					MetricName: "Rollbacks",
+					Value:      0,
+					Unit:       "Count",
+				},
+			},
+		})
+		Expect(err).To(BeNil())
+
+		Expect(form.Get("Action")).To(Equal("PutMetricData"))
+		Expect(form.Get("Namespace")).To(Equal("Porter/Deploys"))
+		Expect(form.Get("MetricData.member.1.MetricName")).To(Equal("DeployDuration"))
+		Expect(form.Get("MetricData.member.1.Dimensions.member.1.Name")).To(Equal("ServiceName"))
+		Expect(form.Get("MetricData.member.1.Dimensions.member.2.Value")).To(Equal("prod"))
+		Expect(form.Get("MetricData.member.1.Value")).To(Equal("90.5"))
+		Expect(form.Get("MetricData.member.1.Unit")).To(Equal("Seconds"))
+		Expect(form.Get("MetricData.member.2.MetricName")).To(Equal("Rollbacks"))
+		Expect(form.Get("MetricData.member.2.Value")).To(Equal("0"))
+	})
+
+	It("PutMetricAlarm encodes the alarm's metric and threshold", func() {
+		handler = func(w http.ResponseWriter) {
+			w.Write([]byte(`<PutMetricAlarmResponse><ResponseMetadata><RequestId>id</RequestId></ResponseMetadata></PutMetricAlarmResponse>`))
+		}
+
+		_, err := client.PutMetricAlarm(&cloudwatch.PutMetricAlarmInput{
+			AlarmName:  "porter-dns-i-1",
+			Namespace:  "Porter/Host",
+			MetricName: "InstanceHealthy",
+			Dimensions: []cloudwatch.Dimension{
+				{Name: "InstanceId", Value: "i-1"},
+			},
+			Statistic:          "Minimum",
+			Period:             60,
+			EvaluationPeriods:  2,
+			Threshold:          1,
+			ComparisonOperator: "LessThanThreshold",
+			TreatMissingData:   "breaching",
+		})
+		Expect(err).To(BeNil())
+
+		Expect(form.Get("Action")).To(Equal("PutMetricAlarm"))
+		Expect(form.Get("AlarmName")).To(Equal("porter-dns-i-1"))
+		Expect(form.Get("Dimensions.member.1.Value")).To(Equal("i-1"))
+		Expect(form.Get("Period")).To(Equal("60"))
+		Expect(form.Get("Threshold")).To(Equal("1"))
+		Expect(form.Get("TreatMissingData")).To(Equal("breaching"))
+	})
+
+	It("returns the error code", func() {
+		handler = func(w http.ResponseWriter) {
+			w.WriteHeader(404)
+			w.Write([]byte(`<ErrorResponse><Error><Type>Sender</Type><Code>ResourceNotFound</Code><Message>missing</Message></Error><RequestId>id</RequestId></ErrorResponse>`))
+		}
+
+		_, err := client.DeleteAlarms(&cloudwatch.DeleteAlarmsInput{
+			AlarmNames: []string{"a"},
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.(awserr.Error).Code()).To(Equal(cloudwatch.ErrCodeResourceNotFound))
+	})
+})
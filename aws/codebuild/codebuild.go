@@ -0,0 +1,236 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package codebuild
+
+import (
+	"errors"
+
+	"github.com/adobe-platform/porter/aws/jsonprotocol"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+)
+
+// The vendored SDK has no CodeBuild client. This is the subset of the API
+// porter uses
+//
+// http://docs.aws.amazon.com/codebuild/latest/APIReference/Welcome.html
+
+const (
+	ServiceName  = "codebuild"
+	targetPrefix = "CodeBuild_20161006"
+
+	ErrCodeResourceAlreadyExists = "ResourceAlreadyExistsException"
+
+	BuildStatusInProgress = "IN_PROGRESS"
+	BuildStatusSucceeded  = "SUCCEEDED"
+
+	SourceTypeNoSource       = "NO_SOURCE"
+	ArtifactsTypeNoArtifacts = "NO_ARTIFACTS"
+	EnvironmentTypeLinux     = "LINUX_CONTAINER"
+	ComputeTypeSmall         = "BUILD_GENERAL1_SMALL"
+
+	ImagePullCredentialsCodeBuild   = "CODEBUILD"
+	ImagePullCredentialsServiceRole = "SERVICE_ROLE"
+
+	EnvironmentVariableTypePlaintext      = "PLAINTEXT"
+	EnvironmentVariableTypeParameterStore = "PARAMETER_STORE"
+	EnvironmentVariableTypeSecretsManager = "SECRETS_MANAGER"
+)
+
+type (
+	CodeBuild struct {
+		*client.Client
+	}
+
+	Project struct {
+		Name        string `json:"name"`
+		Arn         string `json:"arn"`
+		ServiceRole string `json:"serviceRole"`
+	}
+
+	ProjectSource struct {
+		Type      string `json:"type"`
+		Buildspec string `json:"buildspec,omitempty"`
+	}
+
+	ProjectArtifacts struct {
+		Type string `json:"type"`
+	}
+
+	ProjectEnvironment struct {
+		Type                     string `json:"type"`
+		Image                    string `json:"image"`
+		ComputeType              string `json:"computeType"`
+		ImagePullCredentialsType string `json:"imagePullCredentialsType,omitempty"`
+	}
+
+	EnvironmentVariable struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+		Type  string `json:"type"`
+	}
+
+	VpcConfig struct {
+		VpcId            string   `json:"vpcId"`
+		Subnets          []string `json:"subnets"`
+		SecurityGroupIds []string `json:"securityGroupIds"`
+	}
+
+	LogsLocation struct {
+		GroupName  string `json:"groupName"`
+		StreamName string `json:"streamName"`
+	}
+
+	Build struct {
+		Id            string        `json:"id"`
+		BuildStatus   string        `json:"buildStatus"`
+		CurrentPhase  string        `json:"currentPhase"`
+		BuildComplete bool          `json:"buildComplete"`
+		Logs          *LogsLocation `json:"logs"`
+	}
+
+	BatchGetProjectsInput struct {
+		Names []string `json:"names"`
+	}
+
+	BatchGetProjectsOutput struct {
+		Projects         []Project `json:"projects"`
+		ProjectsNotFound []string  `json:"projectsNotFound"`
+	}
+
+	CreateProjectInput struct {
+		Name        string             `json:"name"`
+		Source      ProjectSource      `json:"source"`
+		Artifacts   ProjectArtifacts   `json:"artifacts"`
+		Environment ProjectEnvironment `json:"environment"`
+		ServiceRole string             `json:"serviceRole"`
+	}
+
+	CreateProjectOutput struct {
+		Project Project `json:"project"`
+	}
+
+	// StartBuildInput overrides are what a build changes about its project.
+	// TimeoutInMinutesOverride is 5 to 480 and the project's default if 0
+	StartBuildInput struct {
+		ProjectName                      string                `json:"projectName"`
+		BuildspecOverride                string                `json:"buildspecOverride,omitempty"`
+		ImageOverride                    string                `json:"imageOverride,omitempty"`
+		ImagePullCredentialsTypeOverride string                `json:"imagePullCredentialsTypeOverride,omitempty"`
+		ServiceRoleOverride              string                `json:"serviceRoleOverride,omitempty"`
+		EnvironmentVariablesOverride     []EnvironmentVariable `json:"environmentVariablesOverride,omitempty"`
+		TimeoutInMinutesOverride         int                   `json:"timeoutInMinutesOverride,omitempty"`
+		VpcConfigOverride                *VpcConfig            `json:"vpcConfigOverride,omitempty"`
+	}
+
+	StartBuildOutput struct {
+		Build Build `json:"build"`
+	}
+
+	BatchGetBuildsInput struct {
+		Ids []string `json:"ids"`
+	}
+
+	BatchGetBuildsOutput struct {
+		Builds []Build `json:"builds"`
+	}
+
+	StopBuildInput struct {
+		Id string `json:"id"`
+	}
+
+	StopBuildOutput struct {
+		Build Build `json:"build"`
+	}
+)
+
+func New(p client.ConfigProvider, cfgs ...*aws.Config) *CodeBuild {
+	return &CodeBuild{
+		Client: jsonprotocol.NewClient(p, ServiceName, ServiceName, "2016-10-06", targetPrefix, cfgs...),
+	}
+}
+
+// http://docs.aws.amazon.com/codebuild/latest/APIReference/API_BatchGetProjects.html
+func (recv *CodeBuild) BatchGetProjects(input *BatchGetProjectsInput) (*BatchGetProjectsOutput, error) {
+	output := &BatchGetProjectsOutput{}
+	err := jsonprotocol.Send(recv.Client, "BatchGetProjects", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/codebuild/latest/APIReference/API_CreateProject.html
+func (recv *CodeBuild) CreateProject(input *CreateProjectInput) (*CreateProjectOutput, error) {
+	output := &CreateProjectOutput{}
+	err := jsonprotocol.Send(recv.Client, "CreateProject", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/codebuild/latest/APIReference/API_StartBuild.html
+func (recv *CodeBuild) StartBuild(input *StartBuildInput) (*StartBuildOutput, error) {
+	output := &StartBuildOutput{}
+	err := jsonprotocol.Send(recv.Client, "StartBuild", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/codebuild/latest/APIReference/API_BatchGetBuilds.html
+func (recv *CodeBuild) BatchGetBuilds(input *BatchGetBuildsInput) (*BatchGetBuildsOutput, error) {
+	output := &BatchGetBuildsOutput{}
+	err := jsonprotocol.Send(recv.Client, "BatchGetBuilds", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/codebuild/latest/APIReference/API_StopBuild.html
+func (recv *CodeBuild) StopBuild(input *StopBuildInput) (*StopBuildOutput, error) {
+	output := &StopBuildOutput{}
+	err := jsonprotocol.Send(recv.Client, "StopBuild", input, output)
+	return output, err
+}
+
+// EnsureProject creates the project if it doesn't exist. An existing project
+// isn't changed so it can be configured outside porter
+func (recv *CodeBuild) EnsureProject(input *CreateProjectInput) error {
+	getOutput, err := recv.BatchGetProjects(&BatchGetProjectsInput{
+		Names: []string{input.Name},
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(getOutput.Projects) == 1 {
+		return nil
+	}
+
+	_, err = recv.CreateProject(input)
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == ErrCodeResourceAlreadyExists {
+		// a concurrent hook created it first
+		return nil
+	}
+	return err
+}
+
+// GetBuild returns the build with the id
+func (recv *CodeBuild) GetBuild(id string) (build Build, err error) {
+	output, err := recv.BatchGetBuilds(&BatchGetBuildsInput{
+		Ids: []string{id},
+	})
+	if err != nil {
+		return
+	}
+
+	if len(output.Builds) != 1 {
+		err = errors.New("codebuild:BatchGetBuilds didn't return 1 build")
+		return
+	}
+
+	build = output.Builds[0]
+	return
+}
@@ -0,0 +1,118 @@
+package codebuild_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/codebuild"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+var _ = Describe("CodeBuild", func() {
+
+	var (
+		server     *httptest.Server
+		operations []string
+		handler    func(operation string, input map[string]interface{}, w http.ResponseWriter)
+		client     *codebuild.CodeBuild
+	)
+
+	BeforeEach(func() {
+		operations = nil
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("Authorization")).To(ContainSubstring("/codebuild/aws4_request"))
+
+			target := r.Header.Get("X-Amz-Target")
+			Expect(target).To(HavePrefix("CodeBuild_20161006."))
+			operation := target[len("CodeBuild_20161006."):]
+			operations = append(operations, operation)
+
+			var input map[string]interface{}
+			Expect(json.NewDecoder(r.Body).Decode(&input)).To(Succeed())
+
+			handler(operation, input, w)
+		}))
+
+		client = codebuild.New(session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	project := &codebuild.CreateProjectInput{
+		Name: "porter-hook-svc",
+		Source: codebuild.ProjectSource{
+			Type: codebuild.SourceTypeNoSource,
+		},
+		Artifacts: codebuild.ProjectArtifacts{
+			Type: codebuild.ArtifactsTypeNoArtifacts,
+		},
+	}
+
+	It("EnsureProject leaves an existing project alone", func() {
+		handler = func(operation string, input map[string]interface{}, w http.ResponseWriter) {
+			Expect(input["names"]).To(Equal([]interface{}{"porter-hook-svc"}))
+			w.Write([]byte(`{"projects":[{"name":"porter-hook-svc"}],"projectsNotFound":[]}`))
+		}
+
+		Expect(client.EnsureProject(project)).To(Succeed())
+		Expect(operations).To(Equal([]string{"BatchGetProjects"}))
+	})
+
+	It("EnsureProject creates a missing project", func() {
+		handler = func(operation string, input map[string]interface{}, w http.ResponseWriter) {
+			switch operation {
+			case "BatchGetProjects":
+				w.Write([]byte(`{"projects":[],"projectsNotFound":["porter-hook-svc"]}`))
+			case "CreateProject":
+				Expect(input["name"]).To(Equal("porter-hook-svc"))
+				Expect(input["source"]).To(Equal(map[string]interface{}{"type": "NO_SOURCE"}))
+				w.Write([]byte(`{"project":{"name":"porter-hook-svc"}}`))
+			}
+		}
+
+		Expect(client.EnsureProject(project)).To(Succeed())
+		Expect(operations).To(Equal([]string{"BatchGetProjects", "CreateProject"}))
+	})
+
+	It("EnsureProject tolerates a project created concurrently", func() {
+		handler = func(operation string, input map[string]interface{}, w http.ResponseWriter) {
+			switch operation {
+			case "BatchGetProjects":
+				w.Write([]byte(`{"projects":[],"projectsNotFound":["porter-hook-svc"]}`))
+			case "CreateProject":
+				w.WriteHeader(400)
+				w.Write([]byte(`{"__type":"ResourceAlreadyExistsException","message":"exists"}`))
+			}
+		}
+
+		Expect(client.EnsureProject(project)).To(Succeed())
+	})
+
+	It("GetBuild returns the build's status and logs", func() {
+		handler = func(operation string, input map[string]interface{}, w http.ResponseWriter) {
+			Expect(input["ids"]).To(Equal([]interface{}{"porter-hook-svc:1"}))
+			w.Write([]byte(`{"builds":[{"id":"porter-hook-svc:1","buildStatus":"FAILED","buildComplete":true,
+				"logs":{"groupName":"/aws/codebuild/porter-hook-svc","streamName":"1"}}]}`))
+		}
+
+		build, err := client.GetBuild("porter-hook-svc:1")
+		Expect(err).To(BeNil())
+		Expect(build.BuildComplete).To(BeTrue())
+		Expect(build.BuildStatus).To(Equal("FAILED"))
+		Expect(build.Logs.GroupName).To(Equal("/aws/codebuild/porter-hook-svc"))
+	})
+})
@@ -0,0 +1,166 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package dynamodb
+
+import (
+	"github.com/adobe-platform/porter/aws/jsonprotocol"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+)
+
+// The vendored SDK has no DynamoDB client. This is the subset of the API
+// porter uses. Only string attributes are supported
+//
+// http://docs.aws.amazon.com/amazondynamodb/latest/APIReference/Welcome.html
+
+const (
+	ServiceName  = "dynamodb"
+	targetPrefix = "DynamoDB_20120810"
+
+	// the error code when a ConditionExpression isn't met
+	ErrCodeConditionalCheckFailed = "ConditionalCheckFailedException"
+)
+
+type (
+	DynamoDB struct {
+		*client.Client
+	}
+
+	AttributeValue struct {
+		S *string `json:"S,omitempty"`
+	}
+
+	Item map[string]*AttributeValue
+
+	PutItemInput struct {
+		TableName                 string `json:"TableName"`
+		Item                      Item   `json:"Item"`
+		ConditionExpression       string `json:"ConditionExpression,omitempty"`
+		ExpressionAttributeValues Item   `json:"ExpressionAttributeValues,omitempty"`
+	}
+
+	PutItemOutput struct{}
+
+	DeleteItemInput struct {
+		TableName                 string `json:"TableName"`
+		Key                       Item   `json:"Key"`
+		ConditionExpression       string `json:"ConditionExpression,omitempty"`
+		ExpressionAttributeValues Item   `json:"ExpressionAttributeValues,omitempty"`
+	}
+
+	DeleteItemOutput struct{}
+
+	GetItemInput struct {
+		TableName      string `json:"TableName"`
+		Key            Item   `json:"Key"`
+		ConsistentRead bool   `json:"ConsistentRead,omitempty"`
+	}
+
+	GetItemOutput struct {
+		Item Item `json:"Item"`
+	}
+
+	QueryInput struct {
+		TableName                 string `json:"TableName"`
+		KeyConditionExpression    string `json:"KeyConditionExpression"`
+		ExpressionAttributeValues Item   `json:"ExpressionAttributeValues"`
+		ExclusiveStartKey         Item   `json:"ExclusiveStartKey,omitempty"`
+		ConsistentRead            bool   `json:"ConsistentRead,omitempty"`
+	}
+
+	QueryOutput struct {
+		Items            []Item `json:"Items"`
+		LastEvaluatedKey Item   `json:"LastEvaluatedKey"`
+	}
+)
+
+func New(p client.ConfigProvider, cfgs ...*aws.Config) *DynamoDB {
+	svc := jsonprotocol.NewClient(p, ServiceName, ServiceName, "2012-08-10", targetPrefix, cfgs...)
+
+	// DynamoDB predates JSON protocol 1.1
+	svc.JSONVersion = "1.0"
+
+	return &DynamoDB{
+		Client: svc,
+	}
+}
+
+// String returns the attribute's string value or "" if it's missing
+func (recv Item) String(name string) string {
+	if value, exists := recv[name]; exists && value != nil && value.S != nil {
+		return *value.S
+	}
+	return ""
+}
+
+// SetString sets a string attribute. DynamoDB rejects empty strings in keys
+// so empty values are left out
+func (recv Item) SetString(name, value string) {
+	if value != "" {
+		recv[name] = &AttributeValue{S: aws.String(value)}
+	}
+}
+
+// PutItem creates or replaces an item
+//
+// http://docs.aws.amazon.com/amazondynamodb/latest/APIReference/API_PutItem.html
+func (recv *DynamoDB) PutItem(input *PutItemInput) (*PutItemOutput, error) {
+	output := &PutItemOutput{}
+	err := jsonprotocol.Send(recv.Client, "PutItem", input, output)
+	return output, err
+}
+
+// DeleteItem deletes an item. Deleting an item that doesn't exist succeeds
+// unless ConditionExpression is set
+//
+// http://docs.aws.amazon.com/amazondynamodb/latest/APIReference/API_DeleteItem.html
+func (recv *DynamoDB) DeleteItem(input *DeleteItemInput) (*DeleteItemOutput, error) {
+	output := &DeleteItemOutput{}
+	err := jsonprotocol.Send(recv.Client, "DeleteItem", input, output)
+	return output, err
+}
+
+// GetItem returns the item with the key. Its Item is nil if it doesn't exist
+//
+// http://docs.aws.amazon.com/amazondynamodb/latest/APIReference/API_GetItem.html
+func (recv *DynamoDB) GetItem(input *GetItemInput) (*GetItemOutput, error) {
+	output := &GetItemOutput{}
+	err := jsonprotocol.Send(recv.Client, "GetItem", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/amazondynamodb/latest/APIReference/API_Query.html
+func (recv *DynamoDB) Query(input *QueryInput) (*QueryOutput, error) {
+	output := &QueryOutput{}
+	err := jsonprotocol.Send(recv.Client, "Query", input, output)
+	return output, err
+}
+
+// QueryAll follows LastEvaluatedKey and returns every matching item
+func (recv *DynamoDB) QueryAll(input *QueryInput) ([]Item, error) {
+	items := make([]Item, 0)
+	pageInput := *input
+
+	for {
+		output, err := recv.Query(&pageInput)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, output.Items...)
+
+		if len(output.LastEvaluatedKey) == 0 {
+			return items, nil
+		}
+		pageInput.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+}
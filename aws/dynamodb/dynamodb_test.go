@@ -0,0 +1,117 @@
+package dynamodb_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/dynamodb"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+var _ = Describe("DynamoDB", func() {
+
+	var (
+		server *httptest.Server
+		pages  []string
+		status int
+		inputs []map[string]interface{}
+		client *dynamodb.DynamoDB
+	)
+
+	BeforeEach(func() {
+		inputs = nil
+		status = http.StatusOK
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("X-Amz-Target")).To(HavePrefix("DynamoDB_20120810."))
+			Expect(r.Header.Get("Content-Type")).To(Equal("application/x-amz-json-1.0"))
+
+			var input map[string]interface{}
+			Expect(json.NewDecoder(r.Body).Decode(&input)).To(Succeed())
+			inputs = append(inputs, input)
+
+			w.WriteHeader(status)
+			w.Write([]byte(pages[0]))
+			pages = pages[1:]
+		}))
+
+		client = dynamodb.New(session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("leaves empty strings out of items", func() {
+		pages = []string{`{}`}
+
+		item := dynamodb.Item{}
+		item.SetString("Key", "value")
+		item.SetString("Empty", "")
+
+		_, err := client.PutItem(&dynamodb.PutItemInput{
+			TableName: "table",
+			Item:      item,
+		})
+		Expect(err).To(BeNil())
+
+		Expect(inputs[0]["Item"]).To(Equal(map[string]interface{}{
+			"Key": map[string]interface{}{"S": "value"},
+		}))
+	})
+
+	It("QueryAll follows LastEvaluatedKey", func() {
+		pages = []string{
+			`{"Items":[{"Region":{"S":"us-east-1"}}],"LastEvaluatedKey":{"Region":{"S":"us-east-1"}}}`,
+			`{"Items":[{"Region":{"S":"us-west-2"}}]}`,
+		}
+
+		items, err := client.QueryAll(&dynamodb.QueryInput{
+			TableName:              "table",
+			KeyConditionExpression: "Id = :id",
+		})
+		Expect(err).To(BeNil())
+
+		Expect(items).To(HaveLen(2))
+		Expect(items[0].String("Region")).To(Equal("us-east-1"))
+		Expect(items[1].String("Region")).To(Equal("us-west-2"))
+		Expect(items[1].String("Missing")).To(Equal(""))
+
+		Expect(inputs).To(HaveLen(2))
+		Expect(inputs[0]).NotTo(HaveKey("ExclusiveStartKey"))
+		Expect(inputs[1]["ExclusiveStartKey"]).To(Equal(map[string]interface{}{
+			"Region": map[string]interface{}{"S": "us-east-1"},
+		}))
+	})
+
+	It("returns the error code of a failed condition", func() {
+		status = http.StatusBadRequest
+		pages = []string{`{"__type":"com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException","message":"The conditional request failed"}`}
+
+		key := dynamodb.Item{}
+		key.SetString("Id", "lock")
+
+		_, err := client.DeleteItem(&dynamodb.DeleteItemInput{
+			TableName:           "table",
+			Key:                 key,
+			ConditionExpression: "attribute_exists(Id)",
+		})
+		Expect(err).NotTo(BeNil())
+		Expect(err.(awserr.Error).Code()).To(Equal(dynamodb.ErrCodeConditionalCheckFailed))
+
+		Expect(inputs[0]["ConditionExpression"]).To(Equal("attribute_exists(Id)"))
+		Expect(inputs[0]).NotTo(HaveKey("ExpressionAttributeValues"))
+	})
+})
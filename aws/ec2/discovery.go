@@ -0,0 +1,134 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package ec2
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	ec2lib "github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// NetworkFinder looks up a region's VPC and subnets by their tags
+type NetworkFinder struct {
+	Client *ec2lib.EC2
+}
+
+// FindVpc returns the one VPC with all the tags
+func (recv NetworkFinder) FindVpc(tags map[string]string) (vpcId string, err error) {
+	output, err := recv.Client.DescribeVpcs(&ec2lib.DescribeVpcsInput{
+		Filters: tagFilters(tags),
+	})
+	if err != nil {
+		return
+	}
+
+	switch len(output.Vpcs) {
+	case 0:
+		err = fmt.Errorf("no VPC is tagged %s", formatTags(tags))
+	case 1:
+		vpcId = aws.StringValue(output.Vpcs[0].VpcId)
+	default:
+		var vpcIds []string
+		for _, vpc := range output.Vpcs {
+			vpcIds = append(vpcIds, aws.StringValue(vpc.VpcId))
+		}
+		sort.Strings(vpcIds)
+		err = fmt.Errorf("%d VPCs are tagged %s %v. Add tags that select one", len(vpcIds), formatTags(tags), vpcIds)
+	}
+	return
+}
+
+// FindSubnets returns the subnet of the VPC with all the tags in each
+// availability zone. Only the AZs in azNames are returned unless it's empty
+// and then every AZ with a subnet is. An AZ with more than one subnet is an
+// error because porter wouldn't know which to use
+func (recv NetworkFinder) FindSubnets(vpcId string, tags map[string]string,
+	azNames []string) (subnets map[string]string, err error) {
+
+	filters := append(tagFilters(tags), &ec2lib.Filter{
+		Name:   aws.String("vpc-id"),
+		Values: []*string{aws.String(vpcId)},
+	})
+
+	output, err := recv.Client.DescribeSubnets(&ec2lib.DescribeSubnetsInput{
+		Filters: filters,
+	})
+	if err != nil {
+		return
+	}
+
+	wanted := make(map[string]struct{})
+	for _, azName := range azNames {
+		wanted[azName] = struct{}{}
+	}
+
+	byAZ := make(map[string][]string)
+	for _, subnet := range output.Subnets {
+		azName := aws.StringValue(subnet.AvailabilityZone)
+		if _, exists := wanted[azName]; len(wanted) > 0 && !exists {
+			continue
+		}
+		byAZ[azName] = append(byAZ[azName], aws.StringValue(subnet.SubnetId))
+	}
+
+	subnets = make(map[string]string)
+	for azName, subnetIds := range byAZ {
+		if len(subnetIds) > 1 {
+			sort.Strings(subnetIds)
+			err = fmt.Errorf("%d subnets in %s are tagged %s %v. Add tags that select one",
+				len(subnetIds), azName, formatTags(tags), subnetIds)
+			return
+		}
+		subnets[azName] = subnetIds[0]
+	}
+
+	for _, azName := range azNames {
+		if _, exists := subnets[azName]; !exists {
+			err = fmt.Errorf("no subnet in %s of %s is tagged %s", azName, vpcId, formatTags(tags))
+			return
+		}
+	}
+
+	if len(subnets) == 0 {
+		err = fmt.Errorf("no subnet of %s is tagged %s", vpcId, formatTags(tags))
+	}
+	return
+}
+
+func tagFilters(tags map[string]string) []*ec2lib.Filter {
+	var keys []string
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	filters := make([]*ec2lib.Filter, 0, len(keys))
+	for _, key := range keys {
+		filters = append(filters, &ec2lib.Filter{
+			Name:   aws.String("tag:" + key),
+			Values: []*string{aws.String(tags[key])},
+		})
+	}
+	return filters
+}
+
+func formatTags(tags map[string]string) string {
+	var kvps []string
+	for key, value := range tags {
+		kvps = append(kvps, key+"="+value)
+	}
+	sort.Strings(kvps)
+	return strings.Join(kvps, ",")
+}
@@ -0,0 +1,125 @@
+package ec2_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/ec2"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+const describeSubnetsResponse = `<DescribeSubnetsResponse><subnetSet>
+	<item><subnetId>subnet-aaaaaaaa</subnetId><availabilityZone>us-west-2a</availabilityZone></item>
+	<item><subnetId>subnet-bbbbbbbb</subnetId><availabilityZone>us-west-2b</availabilityZone></item>
+	<item><subnetId>subnet-cccccccc</subnetId><availabilityZone>us-west-2c</availabilityZone></item>
+	<item><subnetId>subnet-dddddddd</subnetId><availabilityZone>us-west-2c</availabilityZone></item>
+</subnetSet></DescribeSubnetsResponse>`
+
+var _ = Describe("Network discovery", func() {
+
+	var (
+		server *httptest.Server
+		forms  []url.Values
+		vpcs   string
+		finder ec2.NetworkFinder
+	)
+
+	BeforeEach(func() {
+		forms = nil
+		vpcs = `<item><vpcId>vpc-12345678</vpcId></item>`
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.ParseForm()).To(Succeed())
+			forms = append(forms, r.PostForm)
+
+			switch r.PostForm.Get("Action") {
+			case "DescribeVpcs":
+				w.Write([]byte(`<DescribeVpcsResponse><vpcSet>` + vpcs + `</vpcSet></DescribeVpcsResponse>`))
+			case "DescribeSubnets":
+				w.Write([]byte(describeSubnetsResponse))
+			}
+		}))
+
+		finder = ec2.NetworkFinder{
+			Client: ec2.New(session.New(&aws.Config{
+				Region:      aws.String("us-west-2"),
+				Endpoint:    aws.String(server.URL),
+				Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+				MaxRetries:  aws.Int(0),
+			})),
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("finds the VPC with the tags", func() {
+		vpcId, err := finder.FindVpc(map[string]string{"Name": "main"})
+		Expect(err).To(BeNil())
+		Expect(vpcId).To(Equal("vpc-12345678"))
+
+		Expect(forms[0].Get("Filter.1.Name")).To(Equal("tag:Name"))
+		Expect(forms[0].Get("Filter.1.Value.1")).To(Equal("main"))
+	})
+
+	It("needs the tags to select one VPC", func() {
+		vpcs = `<item><vpcId>vpc-12345678</vpcId></item><item><vpcId>vpc-87654321</vpcId></item>`
+
+		_, err := finder.FindVpc(map[string]string{"Name": "main"})
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("2 VPCs are tagged Name=main"))
+	})
+
+	It("finds a subnet in each of the AZs", func() {
+		subnets, err := finder.FindSubnets("vpc-12345678", map[string]string{"Tier": "private"},
+			[]string{"us-west-2a", "us-west-2b"})
+		Expect(err).To(BeNil())
+		Expect(subnets).To(Equal(map[string]string{
+			"us-west-2a": "subnet-aaaaaaaa",
+			"us-west-2b": "subnet-bbbbbbbb",
+		}))
+
+		Expect(forms[0].Get("Filter.2.Name")).To(Equal("vpc-id"))
+		Expect(forms[0].Get("Filter.2.Value.1")).To(Equal("vpc-12345678"))
+	})
+
+	It("needs the tags to select one subnet per AZ", func() {
+		_, err := finder.FindSubnets("vpc-12345678", map[string]string{"Tier": "private"}, nil)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("2 subnets in us-west-2c"))
+	})
+
+	It("needs a subnet in every AZ", func() {
+		_, err := finder.FindSubnets("vpc-12345678", map[string]string{"Tier": "private"},
+			[]string{"us-west-2a", "us-west-2d"})
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("no subnet in us-west-2d"))
+	})
+
+	It("sets the region's VPC and AZs", func() {
+		region := conf.Region{
+			Name:       "us-west-2",
+			VpcTags:    map[string]string{"Name": "main"},
+			SubnetTags: map[string]string{"Tier": "private"},
+			AZs: []conf.AvailabilityZone{
+				{Name: "us-west-2b"},
+				{Name: "us-west-2a"},
+			},
+		}
+
+		Expect(region.DiscoverNetwork(finder)).To(Succeed())
+		Expect(region.VpcId).To(Equal("vpc-12345678"))
+		Expect(region.AZs).To(Equal([]conf.AvailabilityZone{
+			{Name: "us-west-2b", SubnetID: "subnet-bbbbbbbb"},
+			{Name: "us-west-2a", SubnetID: "subnet-aaaaaaaa"},
+		}))
+	})
+})
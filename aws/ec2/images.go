@@ -0,0 +1,102 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package ec2
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	ec2lib "github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// Image is the subset of an AMI porter reads. Architecture is EC2's name
+// like x86_64 or arm64
+type Image struct {
+	ImageId      string
+	Name         string
+	Architecture string
+	CreationDate string
+}
+
+// ImageFinder looks up AMIs
+type ImageFinder struct {
+	Client *ec2lib.EC2
+}
+
+// FindLatest returns the most recently created available image of one of the
+// owners whose name matches the pattern and has all the tags. The pattern can
+// use * and ? and matches every name if it's empty
+func (recv ImageFinder) FindLatest(owners []string, namePattern string,
+	tags map[string]string) (image Image, err error) {
+
+	filters := append(tagFilters(tags), &ec2lib.Filter{
+		Name:   aws.String("state"),
+		Values: []*string{aws.String("available")},
+	})
+	if namePattern != "" {
+		filters = append(filters, &ec2lib.Filter{
+			Name:   aws.String("name"),
+			Values: []*string{aws.String(namePattern)},
+		})
+	}
+
+	output, err := recv.Client.DescribeImages(&ec2lib.DescribeImagesInput{
+		Owners:  aws.StringSlice(owners),
+		Filters: filters,
+	})
+	if err != nil {
+		return
+	}
+
+	if len(output.Images) == 0 {
+		err = fmt.Errorf("no image of %v is named %q and tagged %s", owners, namePattern, formatTags(tags))
+		return
+	}
+
+	// creation dates are ISO 8601 so they sort as strings
+	latest := output.Images[0]
+	for _, candidate := range output.Images[1:] {
+		if aws.StringValue(candidate.CreationDate) > aws.StringValue(latest.CreationDate) {
+			latest = candidate
+		}
+	}
+
+	image = newImage(latest)
+	return
+}
+
+// Describe returns the image with the id
+func (recv ImageFinder) Describe(imageId string) (image Image, err error) {
+	output, err := recv.Client.DescribeImages(&ec2lib.DescribeImagesInput{
+		ImageIds: []*string{aws.String(imageId)},
+	})
+	if err != nil {
+		return
+	}
+
+	if len(output.Images) != 1 {
+		err = fmt.Errorf("image %s doesn't exist or isn't shared with this account", imageId)
+		return
+	}
+
+	image = newImage(output.Images[0])
+	return
+}
+
+func newImage(image *ec2lib.Image) Image {
+	return Image{
+		ImageId:      aws.StringValue(image.ImageId),
+		Name:         aws.StringValue(image.Name),
+		Architecture: aws.StringValue(image.Architecture),
+		CreationDate: aws.StringValue(image.CreationDate),
+	}
+}
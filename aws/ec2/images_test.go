@@ -0,0 +1,83 @@
+package ec2_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/ec2"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+var _ = Describe("Image lookup", func() {
+
+	var (
+		server *httptest.Server
+		forms  []url.Values
+		images string
+		finder ec2.ImageFinder
+	)
+
+	BeforeEach(func() {
+		forms = nil
+		images = `
+	<item><imageId>ami-11111111</imageId><name>base-1</name><architecture>x86_64</architecture><creationDate>2026-01-02T00:00:00.000Z</creationDate></item>
+	<item><imageId>ami-33333333</imageId><name>base-3</name><architecture>x86_64</architecture><creationDate>2026-03-04T00:00:00.000Z</creationDate></item>
+	<item><imageId>ami-22222222</imageId><name>base-2</name><architecture>x86_64</architecture><creationDate>2026-02-03T00:00:00.000Z</creationDate></item>`
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.ParseForm()).To(Succeed())
+			forms = append(forms, r.PostForm)
+
+			w.Write([]byte(`<DescribeImagesResponse><imagesSet>` + images + `</imagesSet></DescribeImagesResponse>`))
+		}))
+
+		finder = ec2.ImageFinder{
+			Client: ec2.New(session.New(&aws.Config{
+				Region:      aws.String("us-west-2"),
+				Endpoint:    aws.String(server.URL),
+				Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+				MaxRetries:  aws.Int(0),
+			})),
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("finds the newest image that matches", func() {
+		image, err := finder.FindLatest([]string{"self"}, "base-*", map[string]string{"Role": "porter"})
+		Expect(err).To(BeNil())
+		Expect(image.ImageId).To(Equal("ami-33333333"))
+		Expect(image.Architecture).To(Equal("x86_64"))
+
+		Expect(forms[0].Get("Owner.1")).To(Equal("self"))
+		Expect(forms[0].Get("Filter.1.Name")).To(Equal("tag:Role"))
+		Expect(forms[0].Get("Filter.2.Name")).To(Equal("state"))
+		Expect(forms[0].Get("Filter.3.Name")).To(Equal("name"))
+		Expect(forms[0].Get("Filter.3.Value.1")).To(Equal("base-*"))
+	})
+
+	It("needs an image to match", func() {
+		images = ""
+
+		_, err := finder.FindLatest([]string{"self"}, "base-*", nil)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("no image of [self]"))
+	})
+
+	It("describes an image by id", func() {
+		images = `<item><imageId>ami-44444444</imageId><architecture>arm64</architecture></item>`
+
+		image, err := finder.Describe("ami-44444444")
+		Expect(err).To(BeNil())
+		Expect(image.Architecture).To(Equal("arm64"))
+		Expect(forms[0].Get("ImageId.1")).To(Equal("ami-44444444"))
+	})
+})
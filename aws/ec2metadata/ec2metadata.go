@@ -0,0 +1,126 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package ec2metadata
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adobe-platform/porter/constants"
+	"github.com/aws/aws-sdk-go/aws/client"
+	ec2metadatalib "github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// IMDSv2 session tokens. Instances that require them reject requests without
+// one. Everything in this package falls back to IMDSv1 when a token can't be
+// had so it works whatever the instance's metadata options are
+const (
+	tokenHeader    = "X-aws-ec2-metadata-token"
+	tokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	tokenTTL       = 6 * time.Hour
+)
+
+var (
+	token           string
+	tokenExpiration time.Time
+	tokenLock       sync.Mutex
+
+	httpClient = &http.Client{
+		Timeout: 2 * time.Second,
+	}
+)
+
+// Token returns a cached IMDSv2 session token or an empty string if the
+// metadata service doesn't issue them
+func Token() string {
+	tokenLock.Lock()
+	defer tokenLock.Unlock()
+
+	if token != "" && time.Now().Before(tokenExpiration) {
+		return token
+	}
+
+	token = ""
+
+	req, err := http.NewRequest("PUT", constants.EC2MetadataTokenURL, nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set(tokenTTLHeader, strconv.Itoa(int(tokenTTL.Seconds())))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+
+	tokenBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return ""
+	}
+
+	token = strings.TrimSpace(string(tokenBytes))
+	// renew before the metadata service does
+	tokenExpiration = time.Now().Add(tokenTTL - 1*time.Minute)
+	return token
+}
+
+// Get is http.Get for a path under constants.EC2MetadataURL
+func Get(path string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", constants.EC2MetadataURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if token := Token(); token != "" {
+		req.Header.Set(tokenHeader, token)
+	}
+
+	return http.DefaultClient.Do(req)
+}
+
+// InstanceId is the instance's id like i-0123456789abcdef0
+func InstanceId() (string, error) {
+	resp, err := Get("/instance-id")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	instanceIdBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(instanceIdBytes), nil
+}
+
+// New is ec2metadatalib.New with the IMDSv2 token added to every request. Use
+// it for the EC2 role credentials provider
+func New(p client.ConfigProvider) *ec2metadatalib.EC2Metadata {
+	metadataClient := ec2metadatalib.New(p)
+	metadataClient.Handlers.Build.PushBack(func(r *request.Request) {
+		if token := Token(); token != "" {
+			r.HTTPRequest.Header.Set(tokenHeader, token)
+		}
+	})
+	return metadataClient
+}
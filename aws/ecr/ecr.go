@@ -0,0 +1,184 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package ecr
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/adobe-platform/porter/aws/jsonprotocol"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+)
+
+// The vendored SDK has no ECR client. This is the subset of the API porter
+// uses
+//
+// http://docs.aws.amazon.com/AmazonECR/latest/APIReference/Welcome.html
+
+const (
+	ServiceName  = "ecr"
+	endpointsId  = "api.ecr"
+	targetPrefix = "AmazonEC2ContainerRegistry_V20150921"
+
+	ErrCodeRepositoryNotFound      = "RepositoryNotFoundException"
+	ErrCodeRepositoryAlreadyExists = "RepositoryAlreadyExistsException"
+)
+
+type (
+	ECR struct {
+		*client.Client
+	}
+
+	Repository struct {
+		RepositoryArn  string `json:"repositoryArn"`
+		RegistryId     string `json:"registryId"`
+		RepositoryName string `json:"repositoryName"`
+		RepositoryUri  string `json:"repositoryUri"`
+	}
+
+	DescribeRepositoriesInput struct {
+		RepositoryNames []string `json:"repositoryNames,omitempty"`
+	}
+
+	DescribeRepositoriesOutput struct {
+		Repositories []Repository `json:"repositories"`
+	}
+
+	CreateRepositoryInput struct {
+		RepositoryName string `json:"repositoryName"`
+	}
+
+	CreateRepositoryOutput struct {
+		Repository Repository `json:"repository"`
+	}
+
+	PutLifecyclePolicyInput struct {
+		RepositoryName      string `json:"repositoryName"`
+		LifecyclePolicyText string `json:"lifecyclePolicyText"`
+	}
+
+	PutLifecyclePolicyOutput struct {
+		RepositoryName string `json:"repositoryName"`
+	}
+
+	GetAuthorizationTokenInput struct {
+		RegistryIds []string `json:"registryIds,omitempty"`
+	}
+
+	GetAuthorizationTokenOutput struct {
+		AuthorizationData []AuthorizationData `json:"authorizationData"`
+	}
+
+	AuthorizationData struct {
+		// base64 encoded user:password for docker login
+		AuthorizationToken string `json:"authorizationToken"`
+		ProxyEndpoint      string `json:"proxyEndpoint"`
+	}
+)
+
+func New(p client.ConfigProvider, cfgs ...*aws.Config) *ECR {
+	return &ECR{
+		Client: jsonprotocol.NewClient(p, endpointsId, ServiceName, "2015-09-21", targetPrefix, cfgs...),
+	}
+}
+
+// http://docs.aws.amazon.com/AmazonECR/latest/APIReference/API_DescribeRepositories.html
+func (recv *ECR) DescribeRepositories(input *DescribeRepositoriesInput) (*DescribeRepositoriesOutput, error) {
+	output := &DescribeRepositoriesOutput{}
+	err := jsonprotocol.Send(recv.Client, "DescribeRepositories", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/AmazonECR/latest/APIReference/API_CreateRepository.html
+func (recv *ECR) CreateRepository(input *CreateRepositoryInput) (*CreateRepositoryOutput, error) {
+	output := &CreateRepositoryOutput{}
+	err := jsonprotocol.Send(recv.Client, "CreateRepository", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/AmazonECR/latest/APIReference/API_PutLifecyclePolicy.html
+func (recv *ECR) PutLifecyclePolicy(input *PutLifecyclePolicyInput) (*PutLifecyclePolicyOutput, error) {
+	output := &PutLifecyclePolicyOutput{}
+	err := jsonprotocol.Send(recv.Client, "PutLifecyclePolicy", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/AmazonECR/latest/APIReference/API_GetAuthorizationToken.html
+func (recv *ECR) GetAuthorizationToken(input *GetAuthorizationTokenInput) (*GetAuthorizationTokenOutput, error) {
+	output := &GetAuthorizationTokenOutput{}
+	err := jsonprotocol.Send(recv.Client, "GetAuthorizationToken", input, output)
+	return output, err
+}
+
+// EnsureRepository returns the repository and creates it if it doesn't exist
+func (recv *ECR) EnsureRepository(name string) (repository Repository, err error) {
+	describeOutput, err := recv.DescribeRepositories(&DescribeRepositoriesInput{
+		RepositoryNames: []string{name},
+	})
+	if err == nil {
+		if len(describeOutput.Repositories) != 1 {
+			err = errors.New("ecr:DescribeRepositories didn't return 1 repository")
+			return
+		}
+
+		repository = describeOutput.Repositories[0]
+		return
+	}
+
+	if awsErr, ok := err.(awserr.Error); !ok || awsErr.Code() != ErrCodeRepositoryNotFound {
+		return
+	}
+
+	createOutput, err := recv.CreateRepository(&CreateRepositoryInput{
+		RepositoryName: name,
+	})
+	if err != nil {
+		return
+	}
+
+	repository = createOutput.Repository
+	return
+}
+
+// Login returns the credentials for docker login to the caller's registry
+func (recv *ECR) Login() (username, password, serverAddress string, err error) {
+	output, err := recv.GetAuthorizationToken(&GetAuthorizationTokenInput{})
+	if err != nil {
+		return
+	}
+
+	if len(output.AuthorizationData) != 1 {
+		err = errors.New("ecr:GetAuthorizationToken didn't return 1 token")
+		return
+	}
+
+	data := output.AuthorizationData[0]
+
+	tokenBytes, err := base64.StdEncoding.DecodeString(data.AuthorizationToken)
+	if err != nil {
+		return
+	}
+
+	credentials := strings.SplitN(string(tokenBytes), ":", 2)
+	if len(credentials) != 2 {
+		err = errors.New("ecr:GetAuthorizationToken returned a malformed token")
+		return
+	}
+
+	username = credentials[0]
+	password = credentials[1]
+	serverAddress = data.ProxyEndpoint
+	return
+}
@@ -0,0 +1,108 @@
+package ecr_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/ecr"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+var _ = Describe("ECR", func() {
+
+	var (
+		server     *httptest.Server
+		operations []string
+		handler    func(operation string, input map[string]interface{}, w http.ResponseWriter)
+		client     *ecr.ECR
+	)
+
+	BeforeEach(func() {
+		operations = nil
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("Authorization")).To(ContainSubstring("/ecr/aws4_request"))
+
+			target := r.Header.Get("X-Amz-Target")
+			Expect(target).To(HavePrefix("AmazonEC2ContainerRegistry_V20150921."))
+			operation := target[len("AmazonEC2ContainerRegistry_V20150921."):]
+			operations = append(operations, operation)
+
+			var input map[string]interface{}
+			Expect(json.NewDecoder(r.Body).Decode(&input)).To(Succeed())
+
+			handler(operation, input, w)
+		}))
+
+		client = ecr.New(session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("EnsureRepository returns an existing repository", func() {
+		handler = func(operation string, input map[string]interface{}, w http.ResponseWriter) {
+			Expect(input["repositoryNames"]).To(Equal([]interface{}{"svc"}))
+			w.Write([]byte(`{"repositories":[{"repositoryName":"svc","repositoryUri":"123.dkr.ecr.us-west-2.amazonaws.com/svc"}]}`))
+		}
+
+		repository, err := client.EnsureRepository("svc")
+		Expect(err).To(BeNil())
+		Expect(repository.RepositoryUri).To(Equal("123.dkr.ecr.us-west-2.amazonaws.com/svc"))
+		Expect(operations).To(Equal([]string{"DescribeRepositories"}))
+	})
+
+	It("EnsureRepository creates a missing repository", func() {
+		handler = func(operation string, input map[string]interface{}, w http.ResponseWriter) {
+			switch operation {
+			case "DescribeRepositories":
+				w.WriteHeader(400)
+				w.Write([]byte(`{"__type":"RepositoryNotFoundException","message":"missing"}`))
+			case "CreateRepository":
+				Expect(input["repositoryName"]).To(Equal("svc"))
+				w.Write([]byte(`{"repository":{"repositoryName":"svc","repositoryUri":"123.dkr.ecr.us-west-2.amazonaws.com/svc"}}`))
+			}
+		}
+
+		repository, err := client.EnsureRepository("svc")
+		Expect(err).To(BeNil())
+		Expect(repository.RepositoryUri).To(Equal("123.dkr.ecr.us-west-2.amazonaws.com/svc"))
+		Expect(operations).To(Equal([]string{"DescribeRepositories", "CreateRepository"}))
+	})
+
+	It("EnsureRepository returns other errors", func() {
+		handler = func(operation string, input map[string]interface{}, w http.ResponseWriter) {
+			w.WriteHeader(400)
+			w.Write([]byte(`{"__type":"AccessDeniedException","message":"denied"}`))
+		}
+
+		_, err := client.EnsureRepository("svc")
+		Expect(err).NotTo(BeNil())
+		Expect(operations).To(Equal([]string{"DescribeRepositories"}))
+	})
+
+	It("Login decodes the authorization token", func() {
+		handler = func(operation string, input map[string]interface{}, w http.ResponseWriter) {
+			// base64 of AWS:password
+			w.Write([]byte(`{"authorizationData":[{"authorizationToken":"QVdTOnBhc3N3b3Jk","proxyEndpoint":"https://123.dkr.ecr.us-west-2.amazonaws.com"}]}`))
+		}
+
+		username, password, serverAddress, err := client.Login()
+		Expect(err).To(BeNil())
+		Expect(username).To(Equal("AWS"))
+		Expect(password).To(Equal("password"))
+		Expect(serverAddress).To(Equal("https://123.dkr.ecr.us-west-2.amazonaws.com"))
+	})
+})
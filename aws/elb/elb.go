@@ -152,3 +152,20 @@ func DeregisterInstancesFromLoadBalancer(client *elblib.ELB, instances []*elblib
 	}
 	return client.DeregisterInstancesFromLoadBalancer(params)
 }
+
+// SetConnectionDraining using http://docs.aws.amazon.com/sdk-for-go/api/service/elb/ELB.html#ModifyLoadBalancerAttributes-instance_method
+func SetConnectionDraining(client *elblib.ELB, elbName string, timeout int) error {
+
+	params := &elblib.ModifyLoadBalancerAttributesInput{
+		LoadBalancerName: aws.String(elbName),
+		LoadBalancerAttributes: &elblib.LoadBalancerAttributes{
+			ConnectionDraining: &elblib.ConnectionDraining{
+				Enabled: aws.Bool(true),
+				Timeout: aws.Int64(int64(timeout)),
+			},
+		},
+	}
+
+	_, err := client.ModifyLoadBalancerAttributes(params)
+	return err
+}
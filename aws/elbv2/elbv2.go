@@ -0,0 +1,113 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package elbv2
+
+import (
+	"github.com/adobe-platform/porter/aws/queryprotocol"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+)
+
+// The vendored SDK only has a client for classic load balancers. This is the
+// subset of the Elastic Load Balancing v2 API porter uses
+//
+// http://docs.aws.amazon.com/elasticloadbalancing/latest/APIReference/Welcome.html
+
+const (
+	ServiceName = "elasticloadbalancing"
+
+	ErrCodeLoadBalancerNotFound = "LoadBalancerNotFound"
+	ErrCodeTargetGroupNotFound  = "TargetGroupNotFound"
+)
+
+type (
+	ELBV2 struct {
+		*client.Client
+	}
+
+	DeleteLoadBalancerInput struct {
+		LoadBalancerArn string
+	}
+
+	DeleteLoadBalancerOutput struct{}
+
+	DeleteTargetGroupInput struct {
+		TargetGroupArn string
+	}
+
+	DeleteTargetGroupOutput struct{}
+
+	DeregisterTargetsInput struct {
+		TargetGroupArn string
+		Targets        []*TargetDescription `type:"list"`
+	}
+
+	DeregisterTargetsOutput struct{}
+
+	DescribeTargetHealthInput struct {
+		TargetGroupArn string
+	}
+
+	DescribeTargetHealthOutput struct {
+		TargetHealthDescriptions []*TargetHealthDescription `type:"list"`
+	}
+
+	TargetHealthDescription struct {
+		Target       *TargetDescription `type:"structure"`
+		TargetHealth *TargetHealth      `type:"structure"`
+	}
+
+	TargetDescription struct {
+		Id   *string `type:"string"`
+		Port *int64  `type:"integer"`
+	}
+
+	TargetHealth struct {
+		State       *string `type:"string"`
+		Reason      *string `type:"string"`
+		Description *string `type:"string"`
+	}
+)
+
+func New(p client.ConfigProvider, cfgs ...*aws.Config) *ELBV2 {
+	return &ELBV2{
+		Client: queryprotocol.NewClient(p, ServiceName, ServiceName, "2015-12-01", cfgs...),
+	}
+}
+
+// http://docs.aws.amazon.com/elasticloadbalancing/latest/APIReference/API_DeleteLoadBalancer.html
+func (recv *ELBV2) DeleteLoadBalancer(input *DeleteLoadBalancerInput) (*DeleteLoadBalancerOutput, error) {
+	output := &DeleteLoadBalancerOutput{}
+	err := queryprotocol.Send(recv.Client, "DeleteLoadBalancer", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/elasticloadbalancing/latest/APIReference/API_DeleteTargetGroup.html
+func (recv *ELBV2) DeleteTargetGroup(input *DeleteTargetGroupInput) (*DeleteTargetGroupOutput, error) {
+	output := &DeleteTargetGroupOutput{}
+	err := queryprotocol.Send(recv.Client, "DeleteTargetGroup", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/elasticloadbalancing/latest/APIReference/API_DeregisterTargets.html
+func (recv *ELBV2) DeregisterTargets(input *DeregisterTargetsInput) (*DeregisterTargetsOutput, error) {
+	output := &DeregisterTargetsOutput{}
+	err := queryprotocol.Send(recv.Client, "DeregisterTargets", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/elasticloadbalancing/latest/APIReference/API_DescribeTargetHealth.html
+func (recv *ELBV2) DescribeTargetHealth(input *DescribeTargetHealthInput) (*DescribeTargetHealthOutput, error) {
+	output := &DescribeTargetHealthOutput{}
+	err := queryprotocol.Send(recv.Client, "DescribeTargetHealth", input, output)
+	return output, err
+}
@@ -0,0 +1,88 @@
+package elbv2_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/elbv2"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+var _ = Describe("ELBV2", func() {
+
+	It("DescribeTargetHealth decodes each target's state", func() {
+		var form url.Values
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.ParseForm()).To(Succeed())
+			form = r.PostForm
+
+			w.Write([]byte(`<DescribeTargetHealthResponse><DescribeTargetHealthResult><TargetHealthDescriptions>
+				<member><Target><Id>i-1</Id><Port>8080</Port></Target><TargetHealth><State>healthy</State></TargetHealth></member>
+				<member><Target><Id>i-2</Id><Port>8080</Port></Target><TargetHealth><State>unhealthy</State><Reason>Target.FailedHealthChecks</Reason></TargetHealth></member>
+				</TargetHealthDescriptions></DescribeTargetHealthResult></DescribeTargetHealthResponse>`))
+		}))
+		defer server.Close()
+
+		client := elbv2.New(session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		}))
+
+		output, err := client.DescribeTargetHealth(&elbv2.DescribeTargetHealthInput{
+			TargetGroupArn: "arn",
+		})
+		Expect(err).To(BeNil())
+
+		Expect(form.Get("Action")).To(Equal("DescribeTargetHealth"))
+		Expect(form.Get("TargetGroupArn")).To(Equal("arn"))
+
+		Expect(output.TargetHealthDescriptions).To(HaveLen(2))
+		Expect(aws.StringValue(output.TargetHealthDescriptions[0].Target.Id)).To(Equal("i-1"))
+		Expect(aws.Int64Value(output.TargetHealthDescriptions[0].Target.Port)).To(Equal(int64(8080)))
+		Expect(aws.StringValue(output.TargetHealthDescriptions[0].TargetHealth.State)).To(Equal("healthy"))
+		Expect(aws.StringValue(output.TargetHealthDescriptions[1].TargetHealth.Reason)).To(Equal("Target.FailedHealthChecks"))
+	})
+
+	It("DeregisterTargets encodes each target", func() {
+		var form url.Values
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.ParseForm()).To(Succeed())
+			form = r.PostForm
+
+			w.Write([]byte(`<DeregisterTargetsResponse><DeregisterTargetsResult/></DeregisterTargetsResponse>`))
+		}))
+		defer server.Close()
+
+		client := elbv2.New(session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		}))
+
+		_, err := client.DeregisterTargets(&elbv2.DeregisterTargetsInput{
+			TargetGroupArn: "arn",
+			Targets: []*elbv2.TargetDescription{
+				{Id: aws.String("i-1"), Port: aws.Int64(8080)},
+				{Id: aws.String("i-2"), Port: aws.Int64(8080)},
+			},
+		})
+		Expect(err).To(BeNil())
+
+		Expect(form.Get("Action")).To(Equal("DeregisterTargets"))
+		Expect(form.Get("TargetGroupArn")).To(Equal("arn"))
+		Expect(form.Get("Targets.member.1.Id")).To(Equal("i-1"))
+		Expect(form.Get("Targets.member.2.Id")).To(Equal("i-2"))
+		Expect(form.Get("Targets.member.2.Port")).To(Equal("8080"))
+	})
+})
@@ -0,0 +1,130 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package jsonprotocol
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/private/signer/v4"
+)
+
+// The vendored SDK has no handlers for the JSON protocol that newer services
+// like KMS and ECR speak. Requests are signed and retried by the SDK like any
+// other operation
+//
+// Input and output are plain structs encoded with encoding/json. []byte fields
+// are base64 encoded which is how these services expect blobs
+
+type errorResponse struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+// NewClient creates a client for a JSON protocol service. endpointsId is the
+// prefix of the service's endpoint and signingName is the service name in
+// request signatures
+func NewClient(p client.ConfigProvider, endpointsId, signingName, apiVersion,
+	targetPrefix string, cfgs ...*aws.Config) *client.Client {
+
+	c := p.ClientConfig(endpointsId, cfgs...)
+
+	svc := client.New(
+		*c.Config,
+		metadata.ClientInfo{
+			ServiceName:   signingName,
+			SigningName:   signingName,
+			SigningRegion: c.SigningRegion,
+			Endpoint:      c.Endpoint,
+			APIVersion:    apiVersion,
+			JSONVersion:   "1.1",
+			TargetPrefix:  targetPrefix,
+		},
+		c.Handlers,
+	)
+
+	svc.Handlers.Sign.PushBack(v4.Sign)
+	svc.Handlers.Build.PushBack(build)
+	svc.Handlers.Unmarshal.PushBack(unmarshal)
+	svc.Handlers.UnmarshalError.PushBack(unmarshalError)
+
+	return svc
+}
+
+// Send calls the operation and decodes the response into output
+func Send(svc *client.Client, operationName string, input, output interface{}) error {
+	op := &request.Operation{
+		Name:       operationName,
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}
+
+	return svc.NewRequest(op, input, output).Send()
+}
+
+func build(r *request.Request) {
+	body, err := json.Marshal(r.Params)
+	if err != nil {
+		r.Error = awserr.New("SerializationError", "failed encoding JSON request", err)
+		return
+	}
+
+	r.HTTPRequest.Header.Set("X-Amz-Target", r.ClientInfo.TargetPrefix+"."+r.Operation.Name)
+	r.HTTPRequest.Header.Set("Content-Type", "application/x-amz-json-"+r.ClientInfo.JSONVersion)
+	r.SetBufferBody(body)
+}
+
+func unmarshal(r *request.Request) {
+	defer r.HTTPResponse.Body.Close()
+
+	// operations like DeleteLogGroup respond with an empty body
+	err := json.NewDecoder(r.HTTPResponse.Body).Decode(r.Data)
+	if err != nil && err != io.EOF {
+		r.Error = awserr.New("SerializationError", "failed decoding JSON response", err)
+	}
+}
+
+func unmarshalError(r *request.Request) {
+	defer r.HTTPResponse.Body.Close()
+
+	bodyBytes, err := ioutil.ReadAll(r.HTTPResponse.Body)
+	if err != nil {
+		r.Error = awserr.New("SerializationError", "failed reading JSON error response", err)
+		return
+	}
+
+	resp := errorResponse{}
+	err = json.Unmarshal(bodyBytes, &resp)
+	if err != nil {
+		r.Error = awserr.New("SerializationError", "failed decoding JSON error response", err)
+		return
+	}
+
+	// __type may be namespaced like com.amazonaws.kms#NotFoundException
+	code := resp.Type
+	if i := strings.LastIndex(code, "#"); i >= 0 {
+		code = code[i+1:]
+	}
+
+	r.Error = awserr.NewRequestFailure(
+		awserr.New(code, resp.Message, nil),
+		r.HTTPResponse.StatusCode,
+		r.RequestID,
+	)
+}
@@ -0,0 +1,208 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package kms
+
+import (
+	"github.com/adobe-platform/porter/aws/jsonprotocol"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+)
+
+// The vendored SDK has no KMS client. This is the subset of the API porter
+// uses
+//
+// http://docs.aws.amazon.com/kms/latest/APIReference/Welcome.html
+
+const (
+	ServiceName  = "kms"
+	targetPrefix = "TrentService"
+)
+
+type (
+	KMS struct {
+		*client.Client
+	}
+
+	GenerateDataKeyInput struct {
+		KeyId             string            `json:"KeyId"`
+		KeySpec           string            `json:"KeySpec"`
+		EncryptionContext map[string]string `json:"EncryptionContext,omitempty"`
+	}
+
+	GenerateDataKeyOutput struct {
+		KeyId          string `json:"KeyId"`
+		Plaintext      []byte `json:"Plaintext"`
+		CiphertextBlob []byte `json:"CiphertextBlob"`
+	}
+
+	DecryptInput struct {
+		CiphertextBlob    []byte            `json:"CiphertextBlob"`
+		EncryptionContext map[string]string `json:"EncryptionContext,omitempty"`
+	}
+
+	DecryptOutput struct {
+		KeyId     string `json:"KeyId"`
+		Plaintext []byte `json:"Plaintext"`
+	}
+
+	DescribeKeyInput struct {
+		KeyId string `json:"KeyId"`
+	}
+
+	DescribeKeyOutput struct {
+		KeyMetadata KeyMetadata `json:"KeyMetadata"`
+	}
+
+	KeyMetadata struct {
+		AWSAccountId string `json:"AWSAccountId"`
+		Arn          string `json:"Arn"`
+		KeyId        string `json:"KeyId"`
+		KeyState     string `json:"KeyState"`
+		KeyUsage     string `json:"KeyUsage"`
+		KeySpec      string `json:"KeySpec"`
+	}
+
+	GetKeyPolicyInput struct {
+		KeyId      string `json:"KeyId"`
+		PolicyName string `json:"PolicyName"`
+	}
+
+	GetKeyPolicyOutput struct {
+		Policy string `json:"Policy"`
+	}
+
+	CreateGrantInput struct {
+		KeyId            string            `json:"KeyId"`
+		GranteePrincipal string            `json:"GranteePrincipal"`
+		Operations       []string          `json:"Operations"`
+		Constraints      *GrantConstraints `json:"Constraints,omitempty"`
+		Name             string            `json:"Name,omitempty"`
+	}
+
+	GrantConstraints struct {
+		EncryptionContextSubset map[string]string `json:"EncryptionContextSubset,omitempty"`
+		EncryptionContextEquals map[string]string `json:"EncryptionContextEquals,omitempty"`
+	}
+
+	CreateGrantOutput struct {
+		GrantId    string `json:"GrantId"`
+		GrantToken string `json:"GrantToken"`
+	}
+
+	ListGrantsInput struct {
+		KeyId  string `json:"KeyId"`
+		Marker string `json:"Marker,omitempty"`
+	}
+
+	ListGrantsOutput struct {
+		Grants     []GrantListEntry `json:"Grants"`
+		NextMarker string           `json:"NextMarker"`
+		Truncated  bool             `json:"Truncated"`
+	}
+
+	GrantListEntry struct {
+		GrantId          string   `json:"GrantId"`
+		Name             string   `json:"Name"`
+		GranteePrincipal string   `json:"GranteePrincipal"`
+		Operations       []string `json:"Operations"`
+	}
+
+	RevokeGrantInput struct {
+		KeyId   string `json:"KeyId"`
+		GrantId string `json:"GrantId"`
+	}
+
+	RevokeGrantOutput struct{}
+)
+
+const (
+	KeyState_Enabled         = "Enabled"
+	KeyUsage_EncryptDecrypt  = "ENCRYPT_DECRYPT"
+	KeySpec_SymmetricDefault = "SYMMETRIC_DEFAULT"
+	DefaultKeyPolicyName     = "default"
+
+	GrantOperation_Decrypt = "Decrypt"
+)
+
+func New(p client.ConfigProvider, cfgs ...*aws.Config) *KMS {
+	return &KMS{
+		Client: jsonprotocol.NewClient(p, ServiceName, ServiceName, "2014-11-01", targetPrefix, cfgs...),
+	}
+}
+
+// GenerateDataKey returns a data key in plaintext and encrypted under the
+// customer master key
+//
+// http://docs.aws.amazon.com/kms/latest/APIReference/API_GenerateDataKey.html
+func (recv *KMS) GenerateDataKey(input *GenerateDataKeyInput) (*GenerateDataKeyOutput, error) {
+	output := &GenerateDataKeyOutput{}
+	err := jsonprotocol.Send(recv.Client, "GenerateDataKey", input, output)
+	return output, err
+}
+
+// Decrypt returns the plaintext of a data key from GenerateDataKey. The
+// encryption context must match the one it was generated with
+//
+// http://docs.aws.amazon.com/kms/latest/APIReference/API_Decrypt.html
+func (recv *KMS) Decrypt(input *DecryptInput) (*DecryptOutput, error) {
+	output := &DecryptOutput{}
+	err := jsonprotocol.Send(recv.Client, "Decrypt", input, output)
+	return output, err
+}
+
+// DescribeKey returns the metadata of a key. KeyId may be an alias
+//
+// http://docs.aws.amazon.com/kms/latest/APIReference/API_DescribeKey.html
+func (recv *KMS) DescribeKey(input *DescribeKeyInput) (*DescribeKeyOutput, error) {
+	output := &DescribeKeyOutput{}
+	err := jsonprotocol.Send(recv.Client, "DescribeKey", input, output)
+	return output, err
+}
+
+// GetKeyPolicy returns a key policy as a JSON document. The only policy name
+// KMS supports is DefaultKeyPolicyName
+//
+// http://docs.aws.amazon.com/kms/latest/APIReference/API_GetKeyPolicy.html
+func (recv *KMS) GetKeyPolicy(input *GetKeyPolicyInput) (*GetKeyPolicyOutput, error) {
+	output := &GetKeyPolicyOutput{}
+	err := jsonprotocol.Send(recv.Client, "GetKeyPolicy", input, output)
+	return output, err
+}
+
+// CreateGrant allows the grantee principal to use the key for the operations.
+// Creating a grant with the same properties and name as an existing one
+// returns the existing grant
+//
+// http://docs.aws.amazon.com/kms/latest/APIReference/API_CreateGrant.html
+func (recv *KMS) CreateGrant(input *CreateGrantInput) (*CreateGrantOutput, error) {
+	output := &CreateGrantOutput{}
+	err := jsonprotocol.Send(recv.Client, "CreateGrant", input, output)
+	return output, err
+}
+
+// ListGrants returns a page of the key's grants. KeyId can't be an alias
+//
+// http://docs.aws.amazon.com/kms/latest/APIReference/API_ListGrants.html
+func (recv *KMS) ListGrants(input *ListGrantsInput) (*ListGrantsOutput, error) {
+	output := &ListGrantsOutput{}
+	err := jsonprotocol.Send(recv.Client, "ListGrants", input, output)
+	return output, err
+}
+
+// RevokeGrant deletes a grant. KeyId can't be an alias
+//
+// http://docs.aws.amazon.com/kms/latest/APIReference/API_RevokeGrant.html
+func (recv *KMS) RevokeGrant(input *RevokeGrantInput) (*RevokeGrantOutput, error) {
+	output := &RevokeGrantOutput{}
+	err := jsonprotocol.Send(recv.Client, "RevokeGrant", input, output)
+	return output, err
+}
@@ -0,0 +1,153 @@
+package kms_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/kms"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+var _ = Describe("KMS", func() {
+
+	var (
+		server  *httptest.Server
+		handler http.HandlerFunc
+		client  *kms.KMS
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler(w, r)
+		}))
+
+		client = kms.New(session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("sends JSON protocol requests and decodes blobs", func() {
+		var input map[string]interface{}
+
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("X-Amz-Target")).To(Equal("TrentService.Decrypt"))
+			Expect(r.Header.Get("Content-Type")).To(Equal("application/x-amz-json-1.1"))
+			Expect(r.Header.Get("Authorization")).To(ContainSubstring("/kms/aws4_request"))
+
+			Expect(json.NewDecoder(r.Body).Decode(&input)).To(Succeed())
+
+			w.Write([]byte(`{"KeyId":"key","Plaintext":"cGxhaW50ZXh0"}`))
+		}
+
+		output, err := client.Decrypt(&kms.DecryptInput{
+			CiphertextBlob:    []byte("ciphertext"),
+			EncryptionContext: map[string]string{"k": "v"},
+		})
+		Expect(err).To(BeNil())
+
+		Expect(input["CiphertextBlob"]).To(Equal("Y2lwaGVydGV4dA=="))
+		Expect(input["EncryptionContext"]).To(Equal(map[string]interface{}{"k": "v"}))
+		Expect(output.KeyId).To(Equal("key"))
+		Expect(output.Plaintext).To(Equal([]byte("plaintext")))
+	})
+
+	It("decodes key metadata", func() {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("X-Amz-Target")).To(Equal("TrentService.DescribeKey"))
+
+			w.Write([]byte(`{"KeyMetadata":{"AWSAccountId":"123456789012","KeyId":"key","KeyState":"Enabled","KeyUsage":"ENCRYPT_DECRYPT","KeySpec":"SYMMETRIC_DEFAULT"}}`))
+		}
+
+		output, err := client.DescribeKey(&kms.DescribeKeyInput{KeyId: "alias/key"})
+		Expect(err).To(BeNil())
+
+		Expect(output.KeyMetadata.AWSAccountId).To(Equal("123456789012"))
+		Expect(output.KeyMetadata.KeyState).To(Equal(kms.KeyState_Enabled))
+		Expect(output.KeyMetadata.KeyUsage).To(Equal(kms.KeyUsage_EncryptDecrypt))
+		Expect(output.KeyMetadata.KeySpec).To(Equal(kms.KeySpec_SymmetricDefault))
+	})
+
+	It("sends grant constraints", func() {
+		var input map[string]interface{}
+
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("X-Amz-Target")).To(Equal("TrentService.CreateGrant"))
+
+			Expect(json.NewDecoder(r.Body).Decode(&input)).To(Succeed())
+
+			w.Write([]byte(`{"GrantId":"grant","GrantToken":"token"}`))
+		}
+
+		output, err := client.CreateGrant(&kms.CreateGrantInput{
+			KeyId:            "key",
+			GranteePrincipal: "arn:aws:iam::123456789012:role/role",
+			Operations:       []string{kms.GrantOperation_Decrypt},
+			Constraints: &kms.GrantConstraints{
+				EncryptionContextSubset: map[string]string{"k": "v"},
+			},
+			Name: "stack",
+		})
+		Expect(err).To(BeNil())
+
+		Expect(input["Operations"]).To(Equal([]interface{}{"Decrypt"}))
+		Expect(input["Constraints"]).To(Equal(map[string]interface{}{
+			"EncryptionContextSubset": map[string]interface{}{"k": "v"},
+		}))
+		Expect(input["Name"]).To(Equal("stack"))
+		Expect(output.GrantId).To(Equal("grant"))
+	})
+
+	It("decodes grants and revokes with an empty response", func() {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			switch r.Header.Get("X-Amz-Target") {
+			case "TrentService.ListGrants":
+				w.Write([]byte(`{"Grants":[{"GrantId":"grant","Name":"stack","Operations":["Decrypt"]}],"NextMarker":"next","Truncated":true}`))
+			case "TrentService.RevokeGrant":
+			default:
+				w.WriteHeader(400)
+			}
+		}
+
+		output, err := client.ListGrants(&kms.ListGrantsInput{KeyId: "key"})
+		Expect(err).To(BeNil())
+
+		Expect(output.Grants).To(HaveLen(1))
+		Expect(output.Grants[0].GrantId).To(Equal("grant"))
+		Expect(output.Grants[0].Name).To(Equal("stack"))
+		Expect(output.Truncated).To(BeTrue())
+		Expect(output.NextMarker).To(Equal("next"))
+
+		_, err = client.RevokeGrant(&kms.RevokeGrantInput{KeyId: "key", GrantId: "grant"})
+		Expect(err).To(BeNil())
+	})
+
+	It("returns service errors with their code", func() {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(400)
+			w.Write([]byte(`{"__type":"com.amazonaws.kms#InvalidCiphertextException","message":"bad"}`))
+		}
+
+		_, err := client.Decrypt(&kms.DecryptInput{})
+		Expect(err).NotTo(BeNil())
+
+		awsErr, ok := err.(awserr.RequestFailure)
+		Expect(ok).To(BeTrue())
+		Expect(awsErr.Code()).To(Equal("InvalidCiphertextException"))
+		Expect(awsErr.Message()).To(Equal("bad"))
+		Expect(awsErr.StatusCode()).To(Equal(400))
+	})
+})
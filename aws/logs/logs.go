@@ -0,0 +1,83 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package logs
+
+import (
+	"github.com/adobe-platform/porter/aws/jsonprotocol"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+)
+
+// The vendored SDK has no CloudWatch Logs client. This is the subset of the
+// API porter uses
+//
+// http://docs.aws.amazon.com/AmazonCloudWatchLogs/latest/APIReference/Welcome.html
+
+const (
+	ServiceName  = "logs"
+	targetPrefix = "Logs_20140328"
+
+	ErrCodeResourceNotFound = "ResourceNotFoundException"
+)
+
+type (
+	Logs struct {
+		*client.Client
+	}
+
+	DeleteLogGroupInput struct {
+		LogGroupName string `json:"logGroupName"`
+	}
+
+	DeleteLogGroupOutput struct{}
+
+	// FilterLogEventsInput StartTime is milliseconds since the epoch
+	FilterLogEventsInput struct {
+		LogGroupName        string `json:"logGroupName"`
+		LogStreamNamePrefix string `json:"logStreamNamePrefix,omitempty"`
+		StartTime           int64  `json:"startTime,omitempty"`
+		NextToken           string `json:"nextToken,omitempty"`
+	}
+
+	FilteredLogEvent struct {
+		EventId       string `json:"eventId"`
+		LogStreamName string `json:"logStreamName"`
+		Timestamp     int64  `json:"timestamp"`
+		Message       string `json:"message"`
+	}
+
+	// FilterLogEventsOutput events are sorted by Timestamp across streams
+	FilterLogEventsOutput struct {
+		Events    []FilteredLogEvent `json:"events"`
+		NextToken string             `json:"nextToken"`
+	}
+)
+
+func New(p client.ConfigProvider, cfgs ...*aws.Config) *Logs {
+	return &Logs{
+		Client: jsonprotocol.NewClient(p, ServiceName, ServiceName, "2014-03-28", targetPrefix, cfgs...),
+	}
+}
+
+// http://docs.aws.amazon.com/AmazonCloudWatchLogs/latest/APIReference/API_FilterLogEvents.html
+func (recv *Logs) FilterLogEvents(input *FilterLogEventsInput) (*FilterLogEventsOutput, error) {
+	output := &FilterLogEventsOutput{}
+	err := jsonprotocol.Send(recv.Client, "FilterLogEvents", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/AmazonCloudWatchLogs/latest/APIReference/API_DeleteLogGroup.html
+func (recv *Logs) DeleteLogGroup(input *DeleteLogGroupInput) (*DeleteLogGroupOutput, error) {
+	output := &DeleteLogGroupOutput{}
+	err := jsonprotocol.Send(recv.Client, "DeleteLogGroup", input, output)
+	return output, err
+}
@@ -0,0 +1,75 @@
+package logs_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/logs"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+var _ = Describe("Logs", func() {
+
+	var (
+		server   *httptest.Server
+		input    map[string]interface{}
+		target   string
+		response string
+		client   *logs.Logs
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("Authorization")).To(ContainSubstring("/logs/aws4_request"))
+			target = r.Header.Get("X-Amz-Target")
+
+			Expect(json.NewDecoder(r.Body).Decode(&input)).To(Succeed())
+			w.Write([]byte(response))
+		}))
+		response = ""
+
+		client = logs.New(session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("DeleteLogGroup accepts an empty response", func() {
+		_, err := client.DeleteLogGroup(&logs.DeleteLogGroupInput{
+			LogGroupName: "group",
+		})
+		Expect(err).To(BeNil())
+		Expect(target).To(Equal("Logs_20140328.DeleteLogGroup"))
+		Expect(input["logGroupName"]).To(Equal("group"))
+	})
+
+	It("FilterLogEvents returns events across streams", func() {
+		response = `{"events":[{"eventId":"1","logStreamName":"app/i-1/abc","timestamp":1000,"message":"hello"}],"nextToken":"next"}`
+
+		output, err := client.FilterLogEvents(&logs.FilterLogEventsInput{
+			LogGroupName: "group",
+			StartTime:    500,
+		})
+		Expect(err).To(BeNil())
+		Expect(target).To(Equal("Logs_20140328.FilterLogEvents"))
+		Expect(input["startTime"]).To(Equal(float64(500)))
+		Expect(input).NotTo(HaveKey("nextToken"))
+
+		Expect(output.NextToken).To(Equal("next"))
+		Expect(output.Events).To(Equal([]logs.FilteredLogEvent{
+			{EventId: "1", LogStreamName: "app/i-1/abc", Timestamp: 1000, Message: "hello"},
+		}))
+	})
+})
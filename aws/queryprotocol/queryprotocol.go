@@ -0,0 +1,68 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package queryprotocol
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/private/protocol/query"
+	"github.com/aws/aws-sdk-go/private/signer/v4"
+)
+
+// The vendored SDK has handlers for the query protocol that older services
+// like CloudWatch speak but no client for some of them. Requests are signed
+// and retried by the SDK like any other operation
+//
+// Input structs are encoded by field name so their fields are named after the
+// API's parameters. Lists are encoded as Name.member.N
+
+// NewClient creates a client for a query protocol service. endpointsId is the
+// prefix of the service's endpoint and signingName is the service name in
+// request signatures
+func NewClient(p client.ConfigProvider, endpointsId, signingName, apiVersion string,
+	cfgs ...*aws.Config) *client.Client {
+
+	c := p.ClientConfig(endpointsId, cfgs...)
+
+	svc := client.New(
+		*c.Config,
+		metadata.ClientInfo{
+			ServiceName:   signingName,
+			SigningName:   signingName,
+			SigningRegion: c.SigningRegion,
+			Endpoint:      c.Endpoint,
+			APIVersion:    apiVersion,
+		},
+		c.Handlers,
+	)
+
+	svc.Handlers.Sign.PushBack(v4.Sign)
+	svc.Handlers.Build.PushBack(query.Build)
+	svc.Handlers.Unmarshal.PushBack(query.Unmarshal)
+	svc.Handlers.UnmarshalMeta.PushBack(query.UnmarshalMeta)
+	svc.Handlers.UnmarshalError.PushBack(query.UnmarshalError)
+
+	return svc
+}
+
+// Send calls the operation and decodes the response into output
+func Send(svc *client.Client, operationName string, input, output interface{}) error {
+	op := &request.Operation{
+		Name:       operationName,
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}
+
+	return svc.NewRequest(op, input, output).Send()
+}
@@ -0,0 +1,336 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package rolesanywhere
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// The vendored SDK predates IAM Roles Anywhere. Its CreateSession API isn't
+// signed with access keys but with the private key of an X.509 certificate
+// issued by the trust anchor
+//
+// https://docs.aws.amazon.com/rolesanywhere/latest/userguide/authentication-sign-process.html
+
+const (
+	ServiceName = "rolesanywhere"
+
+	ProviderName = "RolesAnywhereProvider"
+
+	amzDateFormat = "20060102T150405Z"
+	dateFormat    = "20060102"
+)
+
+var (
+	httpClient = &http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	signedHeaders = []string{"content-type", "host", "x-amz-date", "x-amz-x509"}
+)
+
+type (
+	// Provider retrieves temporary credentials for a role with a certificate
+	// the role's trust anchor trusts
+	Provider struct {
+		credentials.Expiry
+
+		Region         string
+		TrustAnchorARN string
+		ProfileARN     string
+		RoleARN        string
+		Duration       time.Duration
+
+		// Endpoint overrides https://rolesanywhere.<region>.amazonaws.com
+		Endpoint string
+
+		// ExpiryWindow retrieves credentials this long before they expire
+		ExpiryWindow time.Duration
+
+		certificate *x509.Certificate
+		signer      crypto.Signer
+	}
+
+	createSessionInput struct {
+		DurationSeconds int64  `json:"durationSeconds,omitempty"`
+		ProfileArn      string `json:"profileArn"`
+		RoleArn         string `json:"roleArn"`
+		TrustAnchorArn  string `json:"trustAnchorArn"`
+	}
+
+	createSessionOutput struct {
+		CredentialSet []struct {
+			Credentials struct {
+				AccessKeyId     string `json:"accessKeyId"`
+				SecretAccessKey string `json:"secretAccessKey"`
+				SessionToken    string `json:"sessionToken"`
+				Expiration      string `json:"expiration"`
+			} `json:"credentials"`
+		} `json:"credentialSet"`
+	}
+)
+
+// NewProvider reads a PEM certificate and its PEM private key. The key can be
+// RSA or EC in PKCS#1, SEC 1, or PKCS#8
+func NewProvider(certificatePath, privateKeyPath string) (*Provider, error) {
+	certificatePEM, err := ioutil.ReadFile(certificatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKeyPEM, err := ioutil.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	certificate, err := ParseCertificate(certificatePEM)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ParsePrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Provider{
+		certificate: certificate,
+		signer:      signer,
+	}, nil
+}
+
+// ParseCertificate parses the first certificate of a PEM file
+func ParseCertificate(certificatePEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certificatePEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM certificate found")
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// ParsePrivateKey parses an RSA or EC private key
+func ParsePrivateKey(privateKeyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, errors.New("no PEM private key found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.New("private key isn't RSA or EC")
+	}
+
+	switch signer := key.(type) {
+	case *rsa.PrivateKey:
+		return signer, nil
+	case *ecdsa.PrivateKey:
+		return signer, nil
+	}
+
+	return nil, errors.New("private key isn't RSA or EC")
+}
+
+// Retrieve calls rolesanywhere:CreateSession
+func (recv *Provider) Retrieve() (credentials.Value, error) {
+	value := credentials.Value{ProviderName: ProviderName}
+
+	input := createSessionInput{
+		DurationSeconds: int64(recv.Duration / time.Second),
+		ProfileArn:      recv.ProfileARN,
+		RoleArn:         recv.RoleARN,
+		TrustAnchorArn:  recv.TrustAnchorARN,
+	}
+
+	body, err := json.Marshal(input)
+	if err != nil {
+		return value, err
+	}
+
+	endpoint := recv.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.%s.amazonaws.com", ServiceName, recv.Region)
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimRight(endpoint, "/")+"/sessions", bytes.NewReader(body))
+	if err != nil {
+		return value, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	err = recv.Sign(req, body, time.Now())
+	if err != nil {
+		return value, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return value, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return value, err
+	}
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return value, fmt.Errorf("rolesanywhere:CreateSession %d %s", resp.StatusCode, string(respBody))
+	}
+
+	output := createSessionOutput{}
+	err = json.Unmarshal(respBody, &output)
+	if err != nil {
+		return value, err
+	}
+
+	if len(output.CredentialSet) == 0 {
+		return value, errors.New("rolesanywhere:CreateSession returned no credentials")
+	}
+
+	creds := output.CredentialSet[0].Credentials
+
+	expiration, err := time.Parse(time.RFC3339, creds.Expiration)
+	if err != nil {
+		return value, err
+	}
+	recv.SetExpiration(expiration, recv.ExpiryWindow)
+
+	value.AccessKeyID = creds.AccessKeyId
+	value.SecretAccessKey = creds.SecretAccessKey
+	value.SessionToken = creds.SessionToken
+	return value, nil
+}
+
+// Sign adds the X.509 signature version 4 headers to the request
+func (recv *Provider) Sign(req *http.Request, body []byte, now time.Time) error {
+	var algorithm string
+	switch recv.signer.(type) {
+	case *rsa.PrivateKey:
+		algorithm = "AWS4-X509-RSA-SHA256"
+	case *ecdsa.PrivateKey:
+		algorithm = "AWS4-X509-ECDSA-SHA256"
+	default:
+		return errors.New("private key isn't RSA or EC")
+	}
+
+	now = now.UTC()
+	amzDate := now.Format(amzDateFormat)
+	scope := strings.Join([]string{now.Format(dateFormat), recv.Region, ServiceName, "aws4_request"}, "/")
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-X509", base64.StdEncoding.EncodeToString(recv.certificate.Raw))
+
+	stringToSign := canonicalStringToSign(req, body, algorithm, amzDate, scope)
+
+	digest := sha256.Sum256([]byte(stringToSign))
+
+	// RSA signs PKCS #1 v1.5 and ECDSA signs ASN.1 DER
+	signature, err := recv.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm,
+		recv.certificate.SerialNumber.String(),
+		scope,
+		strings.Join(signedHeaders, ";"),
+		hex.EncodeToString(signature)))
+
+	return nil
+}
+
+// StringToSign rebuilds what Sign signed from a signed request so the
+// signature can be checked
+func StringToSign(req *http.Request, body []byte) string {
+	authorization := req.Header.Get("Authorization")
+	algorithm := strings.SplitN(authorization, " ", 2)[0]
+
+	var scope string
+	for _, part := range strings.Split(authorization, ", ") {
+		if idx := strings.Index(part, "Credential="); idx >= 0 {
+			credential := part[idx+len("Credential="):]
+			scope = credential[strings.Index(credential, "/")+1:]
+		}
+	}
+
+	return canonicalStringToSign(req, body, algorithm, req.Header.Get("X-Amz-Date"), scope)
+}
+
+func canonicalStringToSign(req *http.Request, body []byte, algorithm, amzDate, scope string) string {
+	canonicalHeaders := ""
+	for _, header := range signedHeaders {
+		value := req.Header.Get(header)
+
+		// servers move Host out of the headers
+		if header == "host" && value == "" {
+			value = req.Host
+		}
+		canonicalHeaders += header + ":" + strings.TrimSpace(value) + "\n"
+	}
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		strings.Join(signedHeaders, ";"),
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	return strings.Join([]string{
+		algorithm,
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+}
+
+func canonicalQuery(query url.Values) string {
+	return strings.Replace(query.Encode(), "+", "%20", -1)
+}
@@ -0,0 +1,144 @@
+package rolesanywhere_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/rolesanywhere"
+)
+
+func writeCertificate(dir string, key crypto.Signer, keyBytes []byte, keyType string) (string, string) {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(4242),
+		Subject:      pkix.Name{CommonName: "ci-runner"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	Expect(err).To(BeNil())
+
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+
+	Expect(ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes}), 0600)).To(BeNil())
+	Expect(ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: keyType, Bytes: keyBytes}), 0600)).To(BeNil())
+
+	return certPath, keyPath
+}
+
+var _ = Describe("Roles Anywhere", func() {
+
+	var (
+		dir         string
+		server      *httptest.Server
+		requestBody map[string]interface{}
+		verified    bool
+		expiration  time.Time
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "rolesanywhere")
+		Expect(err).To(BeNil())
+
+		verified = false
+		expiration = time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(body, &requestBody)
+
+			certBytes, _ := ioutil.ReadFile(filepath.Join(dir, "cert.pem"))
+			cert, _ := rolesanywhere.ParseCertificate(certBytes)
+
+			authorization := r.Header.Get("Authorization")
+			signature, _ := hex.DecodeString(authorization[strings.Index(authorization, "Signature=")+len("Signature="):])
+			digest := sha256.Sum256([]byte(rolesanywhere.StringToSign(r, body)))
+
+			switch publicKey := cert.PublicKey.(type) {
+			case *rsa.PublicKey:
+				verified = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature) == nil
+			case *ecdsa.PublicKey:
+				verified = ecdsa.VerifyASN1(publicKey, digest[:], signature)
+			}
+
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"credentialSet":[{"credentials":{"accessKeyId":"AKIA","secretAccessKey":"secret","sessionToken":"token","expiration":"` +
+				expiration.Format(time.RFC3339) + `"}}]}`))
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+
+	retrieve := func(certPath, keyPath string) {
+		provider, err := rolesanywhere.NewProvider(certPath, keyPath)
+		Expect(err).To(BeNil())
+
+		provider.Region = "us-west-2"
+		provider.TrustAnchorARN = "arn:aws:rolesanywhere:us-west-2:123456789012:trust-anchor/a"
+		provider.ProfileARN = "arn:aws:rolesanywhere:us-west-2:123456789012:profile/p"
+		provider.RoleARN = "arn:aws:iam::123456789012:role/deploy"
+		provider.Duration = 15 * time.Minute
+		provider.Endpoint = server.URL
+
+		Expect(provider.IsExpired()).To(BeTrue())
+
+		value, err := provider.Retrieve()
+		Expect(err).To(BeNil())
+
+		Expect(verified).To(BeTrue())
+		Expect(value.AccessKeyID).To(Equal("AKIA"))
+		Expect(value.SecretAccessKey).To(Equal("secret"))
+		Expect(value.SessionToken).To(Equal("token"))
+		Expect(provider.IsExpired()).To(BeFalse())
+
+		Expect(requestBody["durationSeconds"]).To(BeNumerically("==", 900))
+		Expect(requestBody["roleArn"]).To(Equal("arn:aws:iam::123456789012:role/deploy"))
+	}
+
+	It("signs with an RSA key", func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).To(BeNil())
+
+		retrieve(writeCertificate(dir, key, x509.MarshalPKCS1PrivateKey(key), "RSA PRIVATE KEY"))
+	})
+
+	It("signs with an EC key", func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).To(BeNil())
+
+		keyBytes, err := x509.MarshalECPrivateKey(key)
+		Expect(err).To(BeNil())
+
+		retrieve(writeCertificate(dir, key, keyBytes, "EC PRIVATE KEY"))
+	})
+
+	It("rejects a file without a certificate", func() {
+		_, err := rolesanywhere.ParseCertificate([]byte("not a certificate"))
+		Expect(err).ToNot(BeNil())
+	})
+})
@@ -0,0 +1,248 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package route53
+
+import (
+	"encoding/xml"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/private/protocol/query"
+	"github.com/aws/aws-sdk-go/private/protocol/rest"
+	"github.com/aws/aws-sdk-go/private/signer/v4"
+)
+
+// The vendored SDK has no Route53 client. This is the subset of the API
+// porter uses
+//
+// Route53 validates request bodies against a schema so elements must be in
+// the schema's order. The SDK's XML builder doesn't keep field order so input
+// and output are plain structs encoded with encoding/xml. Fields tagged with
+// location are in the URI or query string instead
+//
+// http://docs.aws.amazon.com/Route53/latest/APIReference/Welcome.html
+
+const (
+	ServiceName = "route53"
+	apiVersion  = "2013-04-01"
+
+	ErrCodeNoSuchHealthCheck  = "NoSuchHealthCheck"
+	ErrCodeInvalidChangeBatch = "InvalidChangeBatch"
+
+	ChangeActionUpsert = "UPSERT"
+	ChangeActionDelete = "DELETE"
+
+	HealthCheckTypeCloudWatchMetric = "CLOUDWATCH_METRIC"
+	InsufficientDataUnhealthy       = "Unhealthy"
+)
+
+type (
+	Route53 struct {
+		*client.Client
+	}
+
+	HostedZone struct {
+		// Id is like /hostedzone/Z123
+		Id   string `xml:"Id"`
+		Name string `xml:"Name"`
+	}
+
+	ListHostedZonesByNameInput struct {
+		DNSName  *string `location:"querystring" locationName:"dnsname" xml:"-"`
+		MaxItems *string `location:"querystring" locationName:"maxitems" xml:"-"`
+	}
+
+	ListHostedZonesByNameOutput struct {
+		HostedZones []HostedZone `xml:"HostedZones>HostedZone"`
+	}
+
+	ResourceRecord struct {
+		Value string `xml:"Value"`
+	}
+
+	ResourceRecordSet struct {
+		Name             string           `xml:"Name"`
+		Type             string           `xml:"Type"`
+		SetIdentifier    string           `xml:"SetIdentifier,omitempty"`
+		MultiValueAnswer bool             `xml:"MultiValueAnswer,omitempty"`
+		TTL              int64            `xml:"TTL,omitempty"`
+		ResourceRecords  []ResourceRecord `xml:"ResourceRecords>ResourceRecord"`
+		HealthCheckId    string           `xml:"HealthCheckId,omitempty"`
+	}
+
+	ListResourceRecordSetsInput struct {
+		HostedZoneId          string  `location:"uri" locationName:"Id" xml:"-"`
+		StartRecordName       *string `location:"querystring" locationName:"name" xml:"-"`
+		StartRecordType       *string `location:"querystring" locationName:"type" xml:"-"`
+		StartRecordIdentifier *string `location:"querystring" locationName:"identifier" xml:"-"`
+		MaxItems              *string `location:"querystring" locationName:"maxitems" xml:"-"`
+	}
+
+	ListResourceRecordSetsOutput struct {
+		ResourceRecordSets   []ResourceRecordSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+		IsTruncated          bool                `xml:"IsTruncated"`
+		NextRecordName       string              `xml:"NextRecordName"`
+		NextRecordType       string              `xml:"NextRecordType"`
+		NextRecordIdentifier string              `xml:"NextRecordIdentifier"`
+	}
+
+	Change struct {
+		Action            string            `xml:"Action"`
+		ResourceRecordSet ResourceRecordSet `xml:"ResourceRecordSet"`
+	}
+
+	ChangeBatch struct {
+		Comment string   `xml:"Comment,omitempty"`
+		Changes []Change `xml:"Changes>Change"`
+	}
+
+	ChangeResourceRecordSetsInput struct {
+		XMLName      xml.Name    `xml:"https://route53.amazonaws.com/doc/2013-04-01/ ChangeResourceRecordSetsRequest"`
+		HostedZoneId string      `location:"uri" locationName:"Id" xml:"-"`
+		ChangeBatch  ChangeBatch `xml:"ChangeBatch"`
+	}
+
+	ChangeResourceRecordSetsOutput struct {
+		ChangeInfo struct {
+			Id     string `xml:"Id"`
+			Status string `xml:"Status"`
+		} `xml:"ChangeInfo"`
+	}
+
+	AlarmIdentifier struct {
+		Region string `xml:"Region"`
+		Name   string `xml:"Name"`
+	}
+
+	HealthCheckConfig struct {
+		Type                         string           `xml:"Type"`
+		AlarmIdentifier              *AlarmIdentifier `xml:"AlarmIdentifier,omitempty"`
+		InsufficientDataHealthStatus string           `xml:"InsufficientDataHealthStatus,omitempty"`
+	}
+
+	CreateHealthCheckInput struct {
+		XMLName           xml.Name          `xml:"https://route53.amazonaws.com/doc/2013-04-01/ CreateHealthCheckRequest"`
+		CallerReference   string            `xml:"CallerReference"`
+		HealthCheckConfig HealthCheckConfig `xml:"HealthCheckConfig"`
+	}
+
+	CreateHealthCheckOutput struct {
+		HealthCheck struct {
+			Id string `xml:"Id"`
+		} `xml:"HealthCheck"`
+	}
+
+	DeleteHealthCheckInput struct {
+		HealthCheckId string `location:"uri" locationName:"HealthCheckId" xml:"-"`
+	}
+
+	DeleteHealthCheckOutput struct{}
+)
+
+func New(p client.ConfigProvider, cfgs ...*aws.Config) *Route53 {
+	c := p.ClientConfig(ServiceName, cfgs...)
+
+	svc := client.New(
+		*c.Config,
+		metadata.ClientInfo{
+			ServiceName:   ServiceName,
+			SigningName:   ServiceName,
+			SigningRegion: c.SigningRegion,
+			Endpoint:      c.Endpoint,
+			APIVersion:    apiVersion,
+		},
+		c.Handlers,
+	)
+
+	svc.Handlers.Sign.PushBack(v4.Sign)
+	svc.Handlers.Build.PushBack(build)
+	svc.Handlers.Unmarshal.PushBack(unmarshal)
+	svc.Handlers.UnmarshalMeta.PushBack(rest.UnmarshalMeta)
+	svc.Handlers.UnmarshalError.PushBack(query.UnmarshalError)
+
+	return &Route53{Client: svc}
+}
+
+// http://docs.aws.amazon.com/Route53/latest/APIReference/API_ListHostedZonesByName.html
+func (recv *Route53) ListHostedZonesByName(input *ListHostedZonesByNameInput) (*ListHostedZonesByNameOutput, error) {
+	output := &ListHostedZonesByNameOutput{}
+	err := recv.send("ListHostedZonesByName", "GET", "/2013-04-01/hostedzonesbyname", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/Route53/latest/APIReference/API_ListResourceRecordSets.html
+func (recv *Route53) ListResourceRecordSets(input *ListResourceRecordSetsInput) (*ListResourceRecordSetsOutput, error) {
+	output := &ListResourceRecordSetsOutput{}
+	err := recv.send("ListResourceRecordSets", "GET", "/2013-04-01/hostedzone/{Id}/rrset", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/Route53/latest/APIReference/API_ChangeResourceRecordSets.html
+func (recv *Route53) ChangeResourceRecordSets(input *ChangeResourceRecordSetsInput) (*ChangeResourceRecordSetsOutput, error) {
+	output := &ChangeResourceRecordSetsOutput{}
+	err := recv.send("ChangeResourceRecordSets", "POST", "/2013-04-01/hostedzone/{Id}/rrset", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/Route53/latest/APIReference/API_CreateHealthCheck.html
+func (recv *Route53) CreateHealthCheck(input *CreateHealthCheckInput) (*CreateHealthCheckOutput, error) {
+	output := &CreateHealthCheckOutput{}
+	err := recv.send("CreateHealthCheck", "POST", "/2013-04-01/healthcheck", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/Route53/latest/APIReference/API_DeleteHealthCheck.html
+func (recv *Route53) DeleteHealthCheck(input *DeleteHealthCheckInput) (*DeleteHealthCheckOutput, error) {
+	output := &DeleteHealthCheckOutput{}
+	err := recv.send("DeleteHealthCheck", "DELETE", "/2013-04-01/healthcheck/{HealthCheckId}", input, output)
+	return output, err
+}
+
+func (recv *Route53) send(operationName, method, path string, input, output interface{}) error {
+	op := &request.Operation{
+		Name:       operationName,
+		HTTPMethod: method,
+		HTTPPath:   path,
+	}
+
+	return recv.NewRequest(op, input, output).Send()
+}
+
+func build(r *request.Request) {
+	rest.Build(r)
+	if r.Error != nil || r.Operation.HTTPMethod != "POST" {
+		return
+	}
+
+	body, err := xml.Marshal(r.Params)
+	if err != nil {
+		r.Error = awserr.New("SerializationError", "failed encoding XML request", err)
+		return
+	}
+
+	r.HTTPRequest.Header.Set("Content-Type", "application/xml")
+	r.SetBufferBody(append([]byte(xml.Header), body...))
+}
+
+func unmarshal(r *request.Request) {
+	defer r.HTTPResponse.Body.Close()
+
+	// the root element's name isn't checked
+	err := xml.NewDecoder(r.HTTPResponse.Body).Decode(r.Data)
+	if err != nil && err != io.EOF {
+		r.Error = awserr.New("SerializationError", "failed decoding XML response", err)
+	}
+}
@@ -0,0 +1,178 @@
+package route53_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/route53"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+var _ = Describe("Route53", func() {
+
+	var (
+		server  *httptest.Server
+		handler http.HandlerFunc
+		client  *route53.Route53
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("Authorization")).To(ContainSubstring("/route53/aws4_request"))
+
+			handler(w, r)
+		}))
+
+		client = route53.New(session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("ChangeResourceRecordSets encodes the record set in schema order", func() {
+		var body string
+
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Method).To(Equal("POST"))
+			Expect(r.URL.Path).To(Equal("/2013-04-01/hostedzone/Z123/rrset"))
+
+			bodyBytes, err := ioutil.ReadAll(r.Body)
+			Expect(err).To(BeNil())
+			body = string(bodyBytes)
+
+			w.Write([]byte(`<ChangeResourceRecordSetsResponse><ChangeInfo><Id>/change/C1</Id><Status>PENDING</Status></ChangeInfo></ChangeResourceRecordSetsResponse>`))
+		}
+
+		output, err := client.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: "Z123",
+			ChangeBatch: route53.ChangeBatch{
+				Changes: []route53.Change{
+					{
+						Action: route53.ChangeActionUpsert,
+						ResourceRecordSet: route53.ResourceRecordSet{
+							Name:             "svc.example.com.",
+							Type:             "A",
+							SetIdentifier:    "us-west-2/i-1",
+							MultiValueAnswer: true,
+							TTL:              60,
+							ResourceRecords:  []route53.ResourceRecord{{Value: "10.0.0.1"}},
+							HealthCheckId:    "hc-1",
+						},
+					},
+				},
+			},
+		})
+		Expect(err).To(BeNil())
+		Expect(output.ChangeInfo.Id).To(Equal("/change/C1"))
+
+		Expect(body).To(ContainSubstring(`<ChangeResourceRecordSetsRequest xmlns="https://route53.amazonaws.com/doc/2013-04-01/">`))
+		Expect(body).To(ContainSubstring(`<ResourceRecordSet><Name>svc.example.com.</Name><Type>A</Type>` +
+			`<SetIdentifier>us-west-2/i-1</SetIdentifier><MultiValueAnswer>true</MultiValueAnswer><TTL>60</TTL>` +
+			`<ResourceRecords><ResourceRecord><Value>10.0.0.1</Value></ResourceRecord></ResourceRecords>` +
+			`<HealthCheckId>hc-1</HealthCheckId></ResourceRecordSet>`))
+	})
+
+	It("ListResourceRecordSets starts at the record and decodes the page", func() {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Method).To(Equal("GET"))
+			Expect(r.URL.Path).To(Equal("/2013-04-01/hostedzone/Z123/rrset"))
+			Expect(r.URL.Query().Get("name")).To(Equal("svc.example.com"))
+			Expect(r.URL.Query().Get("type")).To(Equal("A"))
+			Expect(r.URL.Query()).ToNot(HaveKey("identifier"))
+
+			w.Write([]byte(`<ListResourceRecordSetsResponse><ResourceRecordSets>` +
+				`<ResourceRecordSet><Name>svc.example.com.</Name><Type>A</Type><SetIdentifier>us-west-2/i-1</SetIdentifier>` +
+				`<MultiValueAnswer>true</MultiValueAnswer><TTL>60</TTL>` +
+				`<ResourceRecords><ResourceRecord><Value>10.0.0.1</Value></ResourceRecord></ResourceRecords>` +
+				`<HealthCheckId>hc-1</HealthCheckId></ResourceRecordSet>` +
+				`</ResourceRecordSets><IsTruncated>true</IsTruncated><NextRecordName>svc.example.com.</NextRecordName>` +
+				`<NextRecordType>A</NextRecordType><NextRecordIdentifier>us-west-2/i-2</NextRecordIdentifier>` +
+				`</ListResourceRecordSetsResponse>`))
+		}
+
+		output, err := client.ListResourceRecordSets(&route53.ListResourceRecordSetsInput{
+			HostedZoneId:    "Z123",
+			StartRecordName: aws.String("svc.example.com"),
+			StartRecordType: aws.String("A"),
+		})
+		Expect(err).To(BeNil())
+
+		Expect(output.ResourceRecordSets).To(Equal([]route53.ResourceRecordSet{
+			{
+				Name:             "svc.example.com.",
+				Type:             "A",
+				SetIdentifier:    "us-west-2/i-1",
+				MultiValueAnswer: true,
+				TTL:              60,
+				ResourceRecords:  []route53.ResourceRecord{{Value: "10.0.0.1"}},
+				HealthCheckId:    "hc-1",
+			},
+		}))
+		Expect(output.IsTruncated).To(BeTrue())
+		Expect(output.NextRecordIdentifier).To(Equal("us-west-2/i-2"))
+	})
+
+	It("CreateHealthCheck encodes the alarm the health check follows", func() {
+		var body string
+
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Path).To(Equal("/2013-04-01/healthcheck"))
+
+			bodyBytes, err := ioutil.ReadAll(r.Body)
+			Expect(err).To(BeNil())
+			body = string(bodyBytes)
+
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`<CreateHealthCheckResponse><HealthCheck><Id>hc-1</Id></HealthCheck></CreateHealthCheckResponse>`))
+		}
+
+		output, err := client.CreateHealthCheck(&route53.CreateHealthCheckInput{
+			CallerReference: "i-1",
+			HealthCheckConfig: route53.HealthCheckConfig{
+				Type: route53.HealthCheckTypeCloudWatchMetric,
+				AlarmIdentifier: &route53.AlarmIdentifier{
+					Region: "us-west-2",
+					Name:   "alarm",
+				},
+				InsufficientDataHealthStatus: route53.InsufficientDataUnhealthy,
+			},
+		})
+		Expect(err).To(BeNil())
+		Expect(output.HealthCheck.Id).To(Equal("hc-1"))
+
+		Expect(body).To(ContainSubstring(`<CallerReference>i-1</CallerReference><HealthCheckConfig><Type>CLOUDWATCH_METRIC</Type>` +
+			`<AlarmIdentifier><Region>us-west-2</Region><Name>alarm</Name></AlarmIdentifier>` +
+			`<InsufficientDataHealthStatus>Unhealthy</InsufficientDataHealthStatus></HealthCheckConfig>`))
+	})
+
+	It("decodes errors", func() {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Method).To(Equal("DELETE"))
+			Expect(r.URL.Path).To(Equal("/2013-04-01/healthcheck/hc-1"))
+
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<ErrorResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/"><Error><Type>Sender</Type>` +
+				`<Code>NoSuchHealthCheck</Code><Message>not found</Message></Error><RequestId>id</RequestId></ErrorResponse>`))
+		}
+
+		_, err := client.DeleteHealthCheck(&route53.DeleteHealthCheckInput{HealthCheckId: "hc-1"})
+		Expect(err).ToNot(BeNil())
+
+		awsErr, ok := err.(awserr.Error)
+		Expect(ok).To(BeTrue())
+		Expect(awsErr.Code()).To(Equal(route53.ErrCodeNoSuchHealthCheck))
+	})
+})
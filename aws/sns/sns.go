@@ -0,0 +1,54 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package sns
+
+import (
+	"github.com/adobe-platform/porter/aws/queryprotocol"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+)
+
+// The vendored SDK has no SNS client. This is the subset of the API porter
+// uses
+//
+// http://docs.aws.amazon.com/sns/latest/api/Welcome.html
+
+const ServiceName = "sns"
+
+type (
+	SNS struct {
+		*client.Client
+	}
+
+	PublishInput struct {
+		TopicArn string
+		Subject  string
+		Message  string
+	}
+
+	PublishOutput struct {
+		MessageId *string `type:"string"`
+	}
+)
+
+func New(p client.ConfigProvider, cfgs ...*aws.Config) *SNS {
+	return &SNS{
+		Client: queryprotocol.NewClient(p, ServiceName, ServiceName, "2010-03-31", cfgs...),
+	}
+}
+
+// http://docs.aws.amazon.com/sns/latest/api/API_Publish.html
+func (recv *SNS) Publish(input *PublishInput) (*PublishOutput, error) {
+	output := &PublishOutput{}
+	err := queryprotocol.Send(recv.Client, "Publish", input, output)
+	return output, err
+}
@@ -0,0 +1,62 @@
+package sns_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/sns"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+var _ = Describe("SNS", func() {
+
+	var (
+		server *httptest.Server
+		form   url.Values
+		client *sns.SNS
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("Authorization")).To(ContainSubstring("/sns/aws4_request"))
+
+			Expect(r.ParseForm()).To(Succeed())
+			form = r.PostForm
+
+			w.Write([]byte(`<PublishResponse><PublishResult><MessageId>message-id</MessageId></PublishResult><ResponseMetadata><RequestId>id</RequestId></ResponseMetadata></PublishResponse>`))
+		}))
+
+		client = sns.New(session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("Publish sends the message and returns its id", func() {
+		output, err := client.Publish(&sns.PublishInput{
+			TopicArn: "arn:aws:sns:us-west-2:123456789012:deploys",
+			Subject:  "subject",
+			Message:  `{"event":"promoted"}`,
+		})
+		Expect(err).To(BeNil())
+		Expect(aws.StringValue(output.MessageId)).To(Equal("message-id"))
+
+		Expect(form.Get("Action")).To(Equal("Publish"))
+		Expect(form.Get("Version")).To(Equal("2010-03-31"))
+		Expect(form.Get("TopicArn")).To(Equal("arn:aws:sns:us-west-2:123456789012:deploys"))
+		Expect(form.Get("Subject")).To(Equal("subject"))
+		Expect(form.Get("Message")).To(Equal(`{"event":"promoted"}`))
+	})
+})
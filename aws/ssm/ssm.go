@@ -0,0 +1,163 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package ssm
+
+import (
+	"github.com/adobe-platform/porter/aws/jsonprotocol"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+)
+
+// The vendored SDK has no Systems Manager client. This is the subset of the
+// API porter uses
+//
+// http://docs.aws.amazon.com/systems-manager/latest/APIReference/Welcome.html
+
+const (
+	ServiceName  = "ssm"
+	targetPrefix = "AmazonSSM"
+
+	ErrCodeParameterNotFound = "ParameterNotFound"
+
+	ParameterTypeString = "String"
+)
+
+type (
+	SSM struct {
+		*client.Client
+	}
+
+	Parameter struct {
+		Name    string `json:"Name"`
+		Type    string `json:"Type"`
+		Value   string `json:"Value"`
+		Version int64  `json:"Version"`
+	}
+
+	GetParameterInput struct {
+		Name string `json:"Name"`
+	}
+
+	GetParameterOutput struct {
+		Parameter *Parameter `json:"Parameter"`
+	}
+
+	PutParameterInput struct {
+		Name        string `json:"Name"`
+		Description string `json:"Description,omitempty"`
+		Type        string `json:"Type"`
+		Value       string `json:"Value"`
+		Overwrite   bool   `json:"Overwrite"`
+	}
+
+	PutParameterOutput struct {
+		Version int64 `json:"Version"`
+	}
+
+	// StartSessionInput opens a shell without a DocumentName. A document like
+	// AWS-StartInteractiveCommand runs its Parameters instead
+	StartSessionInput struct {
+		Target       string              `json:"Target"`
+		DocumentName string              `json:"DocumentName,omitempty"`
+		Parameters   map[string][]string `json:"Parameters,omitempty"`
+	}
+
+	// StartSessionOutput is passed as is to the session-manager-plugin which
+	// connects to the stream
+	StartSessionOutput struct {
+		SessionId  string `json:"SessionId"`
+		StreamUrl  string `json:"StreamUrl"`
+		TokenValue string `json:"TokenValue"`
+	}
+
+	// SendCommandInput runs a document like AWS-RunShellScript on instances
+	SendCommandInput struct {
+		InstanceIds  []string            `json:"InstanceIds"`
+		DocumentName string              `json:"DocumentName"`
+		Parameters   map[string][]string `json:"Parameters,omitempty"`
+		Comment      string              `json:"Comment,omitempty"`
+	}
+
+	SendCommandOutput struct {
+		Command struct {
+			CommandId string `json:"CommandId"`
+		} `json:"Command"`
+	}
+
+	GetCommandInvocationInput struct {
+		CommandId  string `json:"CommandId"`
+		InstanceId string `json:"InstanceId"`
+	}
+
+	// GetCommandInvocationOutput output is truncated to 24,000 characters
+	GetCommandInvocationOutput struct {
+		Status                string `json:"Status"`
+		StandardOutputContent string `json:"StandardOutputContent"`
+		StandardErrorContent  string `json:"StandardErrorContent"`
+	}
+
+	TerminateSessionInput struct {
+		SessionId string `json:"SessionId"`
+	}
+
+	TerminateSessionOutput struct {
+		SessionId string `json:"SessionId"`
+	}
+)
+
+func New(p client.ConfigProvider, cfgs ...*aws.Config) *SSM {
+	return &SSM{
+		Client: jsonprotocol.NewClient(p, ServiceName, ServiceName, "2014-11-06", targetPrefix, cfgs...),
+	}
+}
+
+// http://docs.aws.amazon.com/systems-manager/latest/APIReference/API_GetParameter.html
+func (recv *SSM) GetParameter(input *GetParameterInput) (*GetParameterOutput, error) {
+	output := &GetParameterOutput{}
+	err := jsonprotocol.Send(recv.Client, "GetParameter", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/systems-manager/latest/APIReference/API_PutParameter.html
+func (recv *SSM) PutParameter(input *PutParameterInput) (*PutParameterOutput, error) {
+	output := &PutParameterOutput{}
+	err := jsonprotocol.Send(recv.Client, "PutParameter", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/systems-manager/latest/APIReference/API_StartSession.html
+func (recv *SSM) StartSession(input *StartSessionInput) (*StartSessionOutput, error) {
+	output := &StartSessionOutput{}
+	err := jsonprotocol.Send(recv.Client, "StartSession", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/systems-manager/latest/APIReference/API_SendCommand.html
+func (recv *SSM) SendCommand(input *SendCommandInput) (*SendCommandOutput, error) {
+	output := &SendCommandOutput{}
+	err := jsonprotocol.Send(recv.Client, "SendCommand", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/systems-manager/latest/APIReference/API_GetCommandInvocation.html
+func (recv *SSM) GetCommandInvocation(input *GetCommandInvocationInput) (*GetCommandInvocationOutput, error) {
+	output := &GetCommandInvocationOutput{}
+	err := jsonprotocol.Send(recv.Client, "GetCommandInvocation", input, output)
+	return output, err
+}
+
+// http://docs.aws.amazon.com/systems-manager/latest/APIReference/API_TerminateSession.html
+func (recv *SSM) TerminateSession(input *TerminateSessionInput) (*TerminateSessionOutput, error) {
+	output := &TerminateSessionOutput{}
+	err := jsonprotocol.Send(recv.Client, "TerminateSession", input, output)
+	return output, err
+}
@@ -0,0 +1,146 @@
+package ssm_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/ssm"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+var _ = Describe("SSM", func() {
+
+	var (
+		server  *httptest.Server
+		handler http.HandlerFunc
+		client  *ssm.SSM
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler(w, r)
+		}))
+
+		client = ssm.New(session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("GetParameter decodes the parameter", func() {
+		var input map[string]interface{}
+
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("X-Amz-Target")).To(Equal("AmazonSSM.GetParameter"))
+			Expect(r.Header.Get("Authorization")).To(ContainSubstring("/ssm/aws4_request"))
+
+			Expect(json.NewDecoder(r.Body).Decode(&input)).To(Succeed())
+
+			w.Write([]byte(`{"Parameter":{"Name":"/p","Type":"String","Value":"{}","Version":3}}`))
+		}
+
+		output, err := client.GetParameter(&ssm.GetParameterInput{Name: "/p"})
+		Expect(err).To(BeNil())
+
+		Expect(input["Name"]).To(Equal("/p"))
+		Expect(output.Parameter.Value).To(Equal("{}"))
+		Expect(output.Parameter.Version).To(Equal(int64(3)))
+	})
+
+	It("PutParameter overwrites the parameter", func() {
+		var input map[string]interface{}
+
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("X-Amz-Target")).To(Equal("AmazonSSM.PutParameter"))
+
+			Expect(json.NewDecoder(r.Body).Decode(&input)).To(Succeed())
+
+			w.Write([]byte(`{"Version":4}`))
+		}
+
+		output, err := client.PutParameter(&ssm.PutParameterInput{
+			Name:      "/p",
+			Type:      ssm.ParameterTypeString,
+			Value:     "{}",
+			Overwrite: true,
+		})
+		Expect(err).To(BeNil())
+
+		Expect(input["Type"]).To(Equal("String"))
+		Expect(input["Overwrite"]).To(BeTrue())
+		Expect(input).NotTo(HaveKey("Description"))
+		Expect(output.Version).To(Equal(int64(4)))
+	})
+
+	It("StartSession returns the stream to connect to", func() {
+		var input map[string]interface{}
+
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("X-Amz-Target")).To(Equal("AmazonSSM.StartSession"))
+
+			Expect(json.NewDecoder(r.Body).Decode(&input)).To(Succeed())
+
+			w.Write([]byte(`{"SessionId":"s-1","StreamUrl":"wss://stream","TokenValue":"token"}`))
+		}
+
+		output, err := client.StartSession(&ssm.StartSessionInput{Target: "i-1"})
+		Expect(err).To(BeNil())
+
+		Expect(input["Target"]).To(Equal("i-1"))
+		Expect(output.SessionId).To(Equal("s-1"))
+		Expect(output.StreamUrl).To(Equal("wss://stream"))
+		Expect(output.TokenValue).To(Equal("token"))
+	})
+
+	It("StartSession omits the document when it isn't set", func() {
+		var input map[string]interface{}
+
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			Expect(json.NewDecoder(r.Body).Decode(&input)).To(Succeed())
+			w.Write([]byte(`{"SessionId":"s-1"}`))
+		}
+
+		_, err := client.StartSession(&ssm.StartSessionInput{Target: "i-1"})
+		Expect(err).To(BeNil())
+		Expect(input).NotTo(HaveKey("DocumentName"))
+		Expect(input).NotTo(HaveKey("Parameters"))
+
+		_, err = client.StartSession(&ssm.StartSessionInput{
+			Target:       "i-1",
+			DocumentName: "AWS-StartInteractiveCommand",
+			Parameters:   map[string][]string{"command": {"sh"}},
+		})
+		Expect(err).To(BeNil())
+		Expect(input["DocumentName"]).To(Equal("AWS-StartInteractiveCommand"))
+		Expect(input["Parameters"]).To(Equal(map[string]interface{}{
+			"command": []interface{}{"sh"},
+		}))
+	})
+
+	It("returns ParameterNotFound as the error code", func() {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(400)
+			w.Write([]byte(`{"__type":"ParameterNotFound"}`))
+		}
+
+		_, err := client.GetParameter(&ssm.GetParameterInput{Name: "/p"})
+		Expect(err).NotTo(BeNil())
+
+		awsErr, ok := err.(awserr.RequestFailure)
+		Expect(ok).To(BeTrue())
+		Expect(awsErr.Code()).To(Equal(ssm.ErrCodeParameterNotFound))
+	})
+})
@@ -0,0 +1,103 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package tagging
+
+import (
+	"github.com/adobe-platform/porter/aws/jsonprotocol"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+)
+
+// The vendored SDK has no Resource Groups Tagging API client. This is the
+// subset of the API porter uses
+//
+// http://docs.aws.amazon.com/resourcegroupstagging/latest/APIReference/Welcome.html
+
+const (
+	ServiceName  = "tagging"
+	targetPrefix = "ResourceGroupsTaggingAPI_20170126"
+)
+
+type (
+	Tagging struct {
+		*client.Client
+	}
+
+	TagFilter struct {
+		Key    string   `json:"Key"`
+		Values []string `json:"Values,omitempty"`
+	}
+
+	Tag struct {
+		Key   string `json:"Key"`
+		Value string `json:"Value"`
+	}
+
+	ResourceTagMapping struct {
+		ResourceARN string `json:"ResourceARN"`
+		Tags        []Tag  `json:"Tags"`
+	}
+
+	GetResourcesInput struct {
+		PaginationToken     string      `json:"PaginationToken,omitempty"`
+		TagFilters          []TagFilter `json:"TagFilters,omitempty"`
+		ResourceTypeFilters []string    `json:"ResourceTypeFilters,omitempty"`
+	}
+
+	GetResourcesOutput struct {
+		PaginationToken        string               `json:"PaginationToken"`
+		ResourceTagMappingList []ResourceTagMapping `json:"ResourceTagMappingList"`
+	}
+)
+
+func New(p client.ConfigProvider, cfgs ...*aws.Config) *Tagging {
+	return &Tagging{
+		Client: jsonprotocol.NewClient(p, ServiceName, ServiceName, "2017-01-26", targetPrefix, cfgs...),
+	}
+}
+
+// http://docs.aws.amazon.com/resourcegroupstagging/latest/APIReference/API_GetResources.html
+func (recv *Tagging) GetResources(input *GetResourcesInput) (*GetResourcesOutput, error) {
+	output := &GetResourcesOutput{}
+	err := jsonprotocol.Send(recv.Client, "GetResources", input, output)
+	return output, err
+}
+
+// GetAllResources follows PaginationToken and returns every matching resource
+func (recv *Tagging) GetAllResources(input *GetResourcesInput) ([]ResourceTagMapping, error) {
+	resources := make([]ResourceTagMapping, 0)
+	pageInput := *input
+
+	for {
+		output, err := recv.GetResources(&pageInput)
+		if err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, output.ResourceTagMappingList...)
+
+		if output.PaginationToken == "" {
+			return resources, nil
+		}
+		pageInput.PaginationToken = output.PaginationToken
+	}
+}
+
+// Value returns the value of the tag with the key
+func (recv ResourceTagMapping) Value(key string) string {
+	for _, tag := range recv.Tags {
+		if tag.Key == key {
+			return tag.Value
+		}
+	}
+	return ""
+}
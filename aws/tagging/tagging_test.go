@@ -0,0 +1,75 @@
+package tagging_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/tagging"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+var _ = Describe("Tagging", func() {
+
+	var (
+		server *httptest.Server
+		inputs []map[string]interface{}
+		pages  []string
+		client *tagging.Tagging
+	)
+
+	BeforeEach(func() {
+		inputs = nil
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("Authorization")).To(ContainSubstring("/tagging/aws4_request"))
+			Expect(r.Header.Get("X-Amz-Target")).To(Equal("ResourceGroupsTaggingAPI_20170126.GetResources"))
+
+			var input map[string]interface{}
+			Expect(json.NewDecoder(r.Body).Decode(&input)).To(Succeed())
+
+			w.Write([]byte(pages[len(inputs)]))
+			inputs = append(inputs, input)
+		}))
+
+		client = tagging.New(session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("GetAllResources follows the pagination token", func() {
+		pages = []string{
+			`{"PaginationToken":"next","ResourceTagMappingList":[{"ResourceARN":"arn:aws:logs:us-west-2:123:log-group:a","Tags":[{"Key":"k","Value":"a"}]}]}`,
+			`{"PaginationToken":"","ResourceTagMappingList":[{"ResourceARN":"arn:aws:cloudwatch:us-west-2:123:alarm:b"}]}`,
+		}
+
+		resources, err := client.GetAllResources(&tagging.GetResourcesInput{
+			TagFilters:          []tagging.TagFilter{{Key: "k", Values: []string{"a"}}},
+			ResourceTypeFilters: []string{"logs:log-group"},
+		})
+		Expect(err).To(BeNil())
+
+		Expect(resources).To(HaveLen(2))
+		Expect(resources[0].Value("k")).To(Equal("a"))
+		Expect(resources[1].Value("k")).To(Equal(""))
+
+		Expect(inputs).To(HaveLen(2))
+		Expect(inputs[0]).NotTo(HaveKey("PaginationToken"))
+		Expect(inputs[0]["TagFilters"]).To(Equal([]interface{}{
+			map[string]interface{}{"Key": "k", "Values": []interface{}{"a"}},
+		}))
+		Expect(inputs[1]["PaginationToken"]).To(Equal("next"))
+	})
+})
@@ -0,0 +1,193 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package aws_session
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adobe-platform/porter/constants"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+const ErrCodeAudit = "PorterAudit"
+
+type (
+	// AuditCall is an AWS API call porter made or would have made
+	AuditCall struct {
+		Time       time.Time              `json:"time"`
+		Service    string                 `json:"service"`
+		Action     string                 `json:"action"`
+		Region     string                 `json:"region"`
+		Mutating   bool                   `json:"mutating"`
+		Executed   bool                   `json:"executed"`
+		Parameters map[string]interface{} `json:"parameters,omitempty"`
+	}
+
+	// AuditPlan is the document written in audit mode
+	AuditPlan struct {
+		PorterVersion string      `json:"porter_version"`
+		Command       []string    `json:"command"`
+		Calls         []AuditCall `json:"calls"`
+	}
+)
+
+var (
+	auditPath string
+	auditPlan AuditPlan
+	auditLock sync.Mutex
+
+	auditHandler = request.NamedHandler{
+		Name: "porter.Audit",
+		Fn:   auditCall,
+	}
+
+	// input fields left out of the plan because they're too big or could hold
+	// a secret
+	auditOmitted = []string{"Body", "Blob", "Data", "Password", "Plaintext", "Secret", "Token"}
+)
+
+// EnableAudit records every AWS call in a call plan written to path for the
+// rest of the process. Calls that can change something are recorded but not
+// sent. Setting AUDIT_PLAN does the same
+func EnableAudit(path string) {
+	auditLock.Lock()
+	defer auditLock.Unlock()
+
+	auditPath = path
+}
+
+// AuditPath is the call plan being written or "" if audit mode is off
+func AuditPath() string {
+	auditLock.Lock()
+	defer auditLock.Unlock()
+
+	if auditPath != "" {
+		return auditPath
+	}
+	return os.Getenv(constants.EnvAuditPlan)
+}
+
+// auditCall is checked when a request is sent, like rejectMutations. The plan
+// is rewritten after every call so it's complete even if porter exits early
+func auditCall(r *request.Request) {
+	path := AuditPath()
+	if path == "" {
+		return
+	}
+
+	mutating := !IsReadOnlyOperation(r.Operation.Name)
+
+	call := AuditCall{
+		Time:       time.Now().UTC(),
+		Service:    r.ClientInfo.ServiceName,
+		Action:     r.Operation.Name,
+		Region:     aws.StringValue(r.Config.Region),
+		Mutating:   mutating,
+		Executed:   !mutating,
+		Parameters: auditParameters(r.Params),
+	}
+
+	if mutating {
+		skipRequest(r)
+	}
+
+	auditLock.Lock()
+	defer auditLock.Unlock()
+
+	if auditPlan.Command == nil {
+		auditPlan.PorterVersion = constants.Version
+		auditPlan.Command = os.Args[1:]
+	}
+	auditPlan.Calls = append(auditPlan.Calls, call)
+
+	planBytes, err := json.MarshalIndent(auditPlan, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(path, planBytes, 0644)
+	}
+	if err != nil {
+		// an incomplete plan is worse than none
+		r.Error = awserr.New(ErrCodeAudit, "failed to write the audit plan", err)
+	}
+}
+
+// skipRequest makes the request succeed without sending it. Its output is
+// left empty
+func skipRequest(r *request.Request) {
+	r.Handlers.Sign.Clear()
+	r.Handlers.Send.Clear()
+	r.Handlers.UnmarshalMeta.Clear()
+	r.Handlers.ValidateResponse.Clear()
+	r.Handlers.Unmarshal.Clear()
+}
+
+// auditParameters are the input's top-level scalars which name what a call
+// acts on. Lists, maps, blobs, and anything that could hold a secret are
+// left out
+func auditParameters(params interface{}) map[string]interface{} {
+	value := reflect.ValueOf(params)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	parameters := make(map[string]interface{})
+
+fieldLoop:
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		for _, omitted := range auditOmitted {
+			if strings.Contains(field.Name, omitted) {
+				continue fieldLoop
+			}
+		}
+
+		fieldValue := value.Field(i)
+		if fieldValue.Kind() == reflect.Ptr {
+			if fieldValue.IsNil() {
+				continue
+			}
+			fieldValue = fieldValue.Elem()
+		}
+
+		switch fieldValue.Kind() {
+		case reflect.String:
+			if fieldValue.String() != "" {
+				parameters[field.Name] = fieldValue.String()
+			}
+		case reflect.Bool, reflect.Int, reflect.Int32, reflect.Int64:
+			parameters[field.Name] = fieldValue.Interface()
+		}
+	}
+
+	if len(parameters) == 0 {
+		return nil
+	}
+	return parameters
+}
@@ -0,0 +1,94 @@
+package aws_session_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/ecr"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+var _ = Describe("Audit mode", func() {
+
+	var (
+		server   *httptest.Server
+		requests int
+		client   *ecr.ECR
+		planPath string
+	)
+
+	BeforeEach(func() {
+		requests = 0
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Write([]byte(`{"repositories":[{"repositoryName":"svc"}]}`))
+		}))
+
+		client = ecr.New(aws_session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		}))
+
+		planFile, err := ioutil.TempFile("", "porter-audit")
+		Expect(err).To(BeNil())
+		planFile.Close()
+		planPath = planFile.Name()
+
+		os.Setenv(constants.EnvAuditPlan, planPath)
+	})
+
+	AfterEach(func() {
+		os.Unsetenv(constants.EnvAuditPlan)
+		os.Unsetenv(constants.EnvReadOnly)
+		os.Remove(planPath)
+		server.Close()
+	})
+
+	It("sends reads, skips mutations, and records both", func() {
+		os.Setenv(constants.EnvReadOnly, "1")
+
+		describeOutput, err := client.DescribeRepositories(&ecr.DescribeRepositoriesInput{
+			RepositoryNames: []string{"svc"},
+		})
+		Expect(err).To(BeNil())
+		Expect(describeOutput.Repositories).To(HaveLen(1))
+
+		createOutput, err := client.CreateRepository(&ecr.CreateRepositoryInput{RepositoryName: "svc"})
+		Expect(err).To(BeNil())
+		Expect(createOutput.Repository.RepositoryName).To(Equal(""))
+
+		Expect(requests).To(Equal(1))
+
+		planBytes, err := ioutil.ReadFile(planPath)
+		Expect(err).To(BeNil())
+
+		plan := aws_session.AuditPlan{}
+		Expect(json.Unmarshal(planBytes, &plan)).To(Succeed())
+		Expect(plan.PorterVersion).To(Equal(constants.Version))
+
+		calls := plan.Calls[len(plan.Calls)-2:]
+
+		Expect(calls[0].Service).To(Equal("ecr"))
+		Expect(calls[0].Action).To(Equal("DescribeRepositories"))
+		Expect(calls[0].Region).To(Equal("us-west-2"))
+		Expect(calls[0].Mutating).To(BeFalse())
+		Expect(calls[0].Executed).To(BeTrue())
+
+		Expect(calls[1].Action).To(Equal("CreateRepository"))
+		Expect(calls[1].Mutating).To(BeTrue())
+		Expect(calls[1].Executed).To(BeFalse())
+		Expect(calls[1].Parameters).To(Equal(map[string]interface{}{"RepositoryName": "svc"}))
+	})
+})
@@ -16,9 +16,13 @@ import (
 	"sync"
 	"time"
 
+	"github.com/adobe-platform/porter/aws/ec2metadata"
 	"github.com/adobe-platform/porter/constants"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sts"
 )
@@ -26,8 +30,24 @@ import (
 var (
 	regionToSession     map[string]*session.Session
 	regionToSessionLock sync.RWMutex
+
+	// replaces the default credential chain. Every region shares it so
+	// credentials are retrieved once
+	configuredCredentials *credentials.Credentials
 )
 
+// UseCredentials makes every session get its credentials from the provider
+// instead of the default credential chain
+func UseCredentials(provider credentials.Provider) {
+	regionToSessionLock.Lock()
+	defer regionToSessionLock.Unlock()
+
+	configuredCredentials = credentials.NewCredentials(provider)
+
+	// sessions created before this have the old credentials
+	regionToSession = nil
+}
+
 func STS(region, roleARN string, duration time.Duration) *session.Session {
 	// clamp duration to sts:AssumeRole session length bounds
 	if duration < 900*time.Second {
@@ -50,8 +70,7 @@ func STS(region, roleARN string, duration time.Duration) *session.Session {
 		config.WithLogLevel(aws.LogDebug)
 	}
 
-	roleSession := session.New(config)
-	return roleSession
+	return New(config)
 }
 
 func Get(region string) (regionSession *session.Session) {
@@ -101,11 +120,46 @@ func addSession(region string) *session.Session {
 	// must alter sts config as well
 	config := aws.NewConfig()
 	config.WithRegion(region)
+	config.WithCredentials(credentialChain())
 	if os.Getenv(constants.EnvDebugAws) != "" {
 		config.WithLogLevel(aws.LogDebug)
 	}
 
-	regionSession := session.New(config)
+	regionSession := New(config)
 	regionToSession[region] = regionSession
 	return regionSession
 }
+
+// New creates a session that respects read-only and audit mode. Every session
+// porter uses for AWS APIs should come from here
+func New(cfgs ...*aws.Config) *session.Session {
+	cfgs = append(cfgs, request.WithRetryer(aws.NewConfig(), retryer))
+
+	newSession := session.New(cfgs...)
+	newSession.Handlers.Validate.PushFrontNamed(readOnlyHandler)
+	newSession.Handlers.Validate.PushFrontNamed(auditHandler)
+	newSession.Handlers.Send.PushFrontNamed(retryer.sendHandler())
+	newSession.Handlers.ValidateResponse.PushBackNamed(retryer.succeededHandler())
+	newSession.Handlers.Retry.PushBackNamed(retryer.retryHandler())
+	return newSession
+}
+
+// credentialChain is the SDK's default chain except the EC2 role provider
+// speaks IMDSv2 so it works on instances that require session tokens.
+// UseCredentials replaces it
+func credentialChain() *credentials.Credentials {
+	if configuredCredentials != nil {
+		return configuredCredentials
+	}
+
+	return credentials.NewCredentials(&credentials.ChainProvider{
+		Providers: []credentials.Provider{
+			&credentials.EnvProvider{},
+			&credentials.SharedCredentialsProvider{},
+			&ec2rolecreds.EC2RoleProvider{
+				Client:       ec2metadata.New(session.New()),
+				ExpiryWindow: 5 * time.Minute,
+			},
+		},
+	})
+}
@@ -0,0 +1,78 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package aws_session
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// ErrCodeRequestCanceled is the code of calls made after the context of
+// their session is done
+const ErrCodeRequestCanceled = "RequestCanceled"
+
+// WithContext copies the session so its calls stop when the context is done.
+// Calls in flight are canceled, retries stop waiting, and new calls fail
+// without being sent. The vendored SDK predates contexts so this is the only
+// way to cancel its calls
+func WithContext(ctx context.Context, sess *session.Session) *session.Session {
+	if ctx.Done() == nil {
+		return sess
+	}
+
+	contextSession := sess.Copy(&aws.Config{
+		SleepDelay: func(delay time.Duration) {
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+			}
+		},
+	})
+
+	contextSession.Handlers.Validate.PushFrontNamed(request.NamedHandler{
+		Name: "porter.ContextValidateHandler",
+		Fn: func(r *request.Request) {
+			if ctx.Err() != nil {
+				r.Error = canceledError(ctx)
+			}
+		},
+	})
+
+	contextSession.Handlers.Send.PushFrontNamed(request.NamedHandler{
+		Name: "porter.ContextSendHandler",
+		Fn: func(r *request.Request) {
+			r.HTTPRequest = r.HTTPRequest.WithContext(ctx)
+		},
+	})
+
+	// after porter.RetryHandler so a canceled call is never retried
+	contextSession.Handlers.Retry.PushBackNamed(request.NamedHandler{
+		Name: "porter.ContextRetryHandler",
+		Fn: func(r *request.Request) {
+			if ctx.Err() != nil {
+				r.Error = canceledError(ctx)
+				r.Retryable = aws.Bool(false)
+			}
+		},
+	})
+
+	return contextSession
+}
+
+func canceledError(ctx context.Context) error {
+	return awserr.New(ErrCodeRequestCanceled, "request canceled", ctx.Err())
+}
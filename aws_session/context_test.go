@@ -0,0 +1,93 @@
+package aws_session_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/ecr"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+var _ = Describe("WithContext", func() {
+
+	var (
+		server   *httptest.Server
+		requests int32
+		block    chan struct{}
+	)
+
+	BeforeEach(func() {
+		requests = 0
+		block = make(chan struct{})
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			if r.Header.Get("X-Amz-Target") == "AmazonEC2ContainerRegistry_V20150921.CreateRepository" {
+				select {
+				case <-block:
+				case <-r.Context().Done():
+				}
+				return
+			}
+			w.Write([]byte(`{"repositories":[]}`))
+		}))
+	})
+
+	AfterEach(func() {
+		close(block)
+		server.Close()
+	})
+
+	newClient := func(ctx context.Context) *ecr.ECR {
+		return ecr.New(aws_session.WithContext(ctx, aws_session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		})))
+	}
+
+	It("sends calls while the context isn't done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		_, err := newClient(ctx).DescribeRepositories(&ecr.DescribeRepositoriesInput{})
+		Expect(err).To(BeNil())
+		Expect(atomic.LoadInt32(&requests)).To(BeEquivalentTo(1))
+	})
+
+	It("doesn't send calls after the context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := newClient(ctx).DescribeRepositories(&ecr.DescribeRepositoriesInput{})
+		Expect(err).To(HaveOccurred())
+		Expect(err.(awserr.Error).Code()).To(Equal(aws_session.ErrCodeRequestCanceled))
+		Expect(atomic.LoadInt32(&requests)).To(BeEquivalentTo(0))
+	})
+
+	It("cancels calls in flight without retrying them", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		started := time.Now()
+		_, err := newClient(ctx).CreateRepository(&ecr.CreateRepositoryInput{RepositoryName: "svc"})
+		Expect(err).To(HaveOccurred())
+		Expect(err.(awserr.Error).Code()).To(Equal(aws_session.ErrCodeRequestCanceled))
+		Expect(time.Since(started)).To(BeNumerically("<", 5*time.Second))
+		Expect(atomic.LoadInt32(&requests)).To(BeEquivalentTo(1))
+	})
+
+	It("leaves sessions alone for contexts that can't be done", func() {
+		sess := aws_session.New(&aws.Config{Region: aws.String("us-west-2")})
+		Expect(aws_session.WithContext(context.Background(), sess)).To(BeIdenticalTo(sess))
+	})
+})
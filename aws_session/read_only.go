@@ -0,0 +1,83 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package aws_session
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/adobe-platform/porter/constants"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+const ErrCodeReadOnly = "PorterReadOnly"
+
+var (
+	readOnly int32
+
+	readOnlyPrefixes = []string{"Describe", "Get", "List", "Head", "Filter"}
+
+	// operations that don't fit the prefixes but don't change anything
+	readOnlyOperations = map[string]struct{}{
+		"AssumeRole":              {},
+		"Decrypt":                 {},
+		"Query":                   {},
+		"Scan":                    {},
+		"SimulatePrincipalPolicy": {},
+		"ValidateTemplate":        {},
+	}
+
+	readOnlyHandler = request.NamedHandler{
+		Name: "porter.ReadOnly",
+		Fn:   rejectMutations,
+	}
+)
+
+// EnableReadOnly makes every AWS call that can change something a hard error
+// for the rest of the process. Setting READ_ONLY does the same
+func EnableReadOnly() {
+	atomic.StoreInt32(&readOnly, 1)
+}
+
+func IsReadOnly() bool {
+	return atomic.LoadInt32(&readOnly) == 1 || os.Getenv(constants.EnvReadOnly) != ""
+}
+
+func IsReadOnlyOperation(operationName string) bool {
+	if _, exists := readOnlyOperations[operationName]; exists {
+		return true
+	}
+
+	for _, prefix := range readOnlyPrefixes {
+		if strings.HasPrefix(operationName, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rejectMutations is checked when a request is sent rather than when its
+// session is created because sessions are cached. Audit mode already skipped
+// mutations
+func rejectMutations(r *request.Request) {
+	if !IsReadOnly() || IsReadOnlyOperation(r.Operation.Name) || AuditPath() != "" {
+		return
+	}
+
+	r.Error = awserr.New(ErrCodeReadOnly,
+		fmt.Sprintf("%s:%s isn't allowed in read-only mode", r.ClientInfo.ServiceName, r.Operation.Name),
+		nil)
+}
@@ -0,0 +1,108 @@
+package aws_session_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/ecr"
+	"github.com/adobe-platform/porter/aws/logs"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+var _ = Describe("Read-only mode", func() {
+
+	var (
+		server   *httptest.Server
+		requests int
+		client   *ecr.ECR
+	)
+
+	BeforeEach(func() {
+		requests = 0
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Write([]byte(`{"repositories":[],"repository":{"repositoryName":"svc"}}`))
+		}))
+
+		client = ecr.New(aws_session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		}))
+	})
+
+	AfterEach(func() {
+		os.Unsetenv(constants.EnvReadOnly)
+		server.Close()
+	})
+
+	It("allows mutating calls by default", func() {
+		_, err := client.CreateRepository(&ecr.CreateRepositoryInput{RepositoryName: "svc"})
+		Expect(err).To(BeNil())
+		Expect(requests).To(Equal(1))
+	})
+
+	It("rejects mutating calls without sending them", func() {
+		os.Setenv(constants.EnvReadOnly, "1")
+
+		_, err := client.CreateRepository(&ecr.CreateRepositoryInput{RepositoryName: "svc"})
+		Expect(err).To(HaveOccurred())
+		Expect(err.(awserr.Error).Code()).To(Equal(aws_session.ErrCodeReadOnly))
+		Expect(err.Error()).To(ContainSubstring("ecr:CreateRepository"))
+		Expect(requests).To(Equal(0))
+	})
+
+	It("allows read calls", func() {
+		os.Setenv(constants.EnvReadOnly, "1")
+
+		_, err := client.DescribeRepositories(&ecr.DescribeRepositoriesInput{})
+		Expect(err).To(BeNil())
+		Expect(requests).To(Equal(1))
+	})
+
+	It("allows reading logs the way porter logs does", func() {
+		os.Setenv(constants.EnvReadOnly, "1")
+
+		logsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Write([]byte(`{"events":[]}`))
+		}))
+		defer logsServer.Close()
+
+		logsClient := logs.New(aws_session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(logsServer.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		}))
+
+		_, err := logsClient.FilterLogEvents(&logs.FilterLogEventsInput{LogGroupName: "group"})
+		Expect(err).To(BeNil())
+		Expect(requests).To(Equal(1))
+	})
+
+	It("classifies operations by name", func() {
+		for _, operationName := range []string{"DescribeStacks", "GetObject", "ListObjects",
+			"HeadObject", "FilterLogEvents", "AssumeRole", "Decrypt", "Query", "Scan",
+			"SimulatePrincipalPolicy", "ValidateTemplate"} {
+
+			Expect(aws_session.IsReadOnlyOperation(operationName)).To(BeTrue(), operationName)
+		}
+
+		for _, operationName := range []string{"CreateStack", "DeleteStack", "PutObject",
+			"UpdateAutoScalingGroup", "GenerateDataKey", "ReceiveMessage"} {
+
+			Expect(aws_session.IsReadOnlyOperation(operationName)).To(BeFalse(), operationName)
+		}
+	})
+})
@@ -0,0 +1,233 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package aws_session
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/adobe-platform/porter/constants"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+var (
+	retryer = NewRetryer()
+
+	retryRand     = rand.New(rand.NewSource(time.Now().UnixNano()))
+	retryRandLock sync.Mutex
+)
+
+type (
+	// Retryer retries throttled and transient failures of every AWS call
+	// with exponential backoff and full jitter. It replaces the SDK's
+	// DefaultRetryer on every session porter creates
+	Retryer struct {
+		MaxAttempts int
+		BaseDelay   time.Duration
+		MaxDelay    time.Duration
+
+		// OperationMaxAttempts overrides MaxAttempts by operation name like
+		// CreateStack or by service and operation like s3:HeadObject
+		OperationMaxAttempts map[string]int
+
+		// Adaptive slows down every call that shares the retryer after one is
+		// throttled and speeds back up as calls succeed
+		Adaptive bool
+
+		limiter *rateLimiter
+	}
+
+	// rateLimiter is the delay before each call while the account is being
+	// throttled
+	rateLimiter struct {
+		lock  sync.Mutex
+		delay time.Duration
+	}
+)
+
+// NewRetryer has porter's defaults
+func NewRetryer() *Retryer {
+	return &Retryer{
+		MaxAttempts: constants.AWSRetryMaxAttempts,
+		BaseDelay:   constants.AWSRetryBaseDelay,
+		MaxDelay:    constants.AWSRetryMaxDelay,
+		Adaptive:    true,
+		limiter:     &rateLimiter{},
+	}
+}
+
+// UseRetryer makes every session retry with the retryer
+func UseRetryer(newRetryer *Retryer) {
+	regionToSessionLock.Lock()
+	defer regionToSessionLock.Unlock()
+
+	if newRetryer.limiter == nil {
+		newRetryer.limiter = &rateLimiter{}
+	}
+	retryer = newRetryer
+
+	// sessions created before this have the old retryer
+	regionToSession = nil
+}
+
+// MaxRetries is the most retries of any operation. ShouldRetry enforces each
+// operation's attempts
+func (recv *Retryer) MaxRetries() int {
+	maxAttempts := recv.MaxAttempts
+	for _, attempts := range recv.OperationMaxAttempts {
+		if attempts > maxAttempts {
+			maxAttempts = attempts
+		}
+	}
+
+	if maxAttempts < 1 {
+		return 0
+	}
+	return maxAttempts - 1
+}
+
+// ShouldRetry is true for transient errors, throttling, and 5xx responses
+// until the operation runs out of attempts
+func (recv *Retryer) ShouldRetry(r *request.Request) bool {
+	if r.RetryCount+1 >= recv.maxAttempts(r) {
+		return false
+	}
+
+	return aws.BoolValue(r.Retryable) ||
+		r.IsErrorRetryable() ||
+		r.IsErrorExpired() ||
+		statusCode(r) >= 500 ||
+		recv.throttled(r)
+}
+
+// RetryRules is a random delay up to the exponential backoff. Throttling
+// backs off from a longer base delay
+func (recv *Retryer) RetryRules(r *request.Request) time.Duration {
+	baseDelay := recv.BaseDelay
+	if recv.throttled(r) {
+		baseDelay *= 5
+	}
+
+	backoff := recv.MaxDelay
+	if r.RetryCount < 30 {
+		if exponential := baseDelay << uint(r.RetryCount); exponential > 0 && exponential < recv.MaxDelay {
+			backoff = exponential
+		}
+	}
+
+	if backoff <= 0 {
+		return 0
+	}
+
+	retryRandLock.Lock()
+	defer retryRandLock.Unlock()
+
+	return time.Duration(retryRand.Int63n(int64(backoff) + 1))
+}
+
+func (recv *Retryer) maxAttempts(r *request.Request) int {
+	if attempts, exists := recv.OperationMaxAttempts[r.ClientInfo.ServiceName+":"+operationName(r)]; exists {
+		return attempts
+	}
+
+	if attempts, exists := recv.OperationMaxAttempts[operationName(r)]; exists {
+		return attempts
+	}
+
+	return recv.MaxAttempts
+}
+
+func (recv *Retryer) throttled(r *request.Request) bool {
+	switch statusCode(r) {
+	case 429, 502, 503, 504:
+		return true
+	}
+	return r.IsErrorThrottle()
+}
+
+// retryHandler decides whether to retry instead of the SDK which only asks
+// the retryer when no other handler decided first
+func (recv *Retryer) retryHandler() request.NamedHandler {
+	return request.NamedHandler{Name: "porter.RetryHandler", Fn: func(r *request.Request) {
+		if recv.Adaptive && recv.throttled(r) {
+			recv.limiter.throttled(recv.BaseDelay, recv.MaxDelay)
+		}
+
+		r.Retryable = aws.Bool(recv.ShouldRetry(r))
+	}}
+}
+
+func (recv *Retryer) sendHandler() request.NamedHandler {
+	return request.NamedHandler{Name: "porter.AdaptiveRetrySendHandler", Fn: func(r *request.Request) {
+		if !recv.Adaptive {
+			return
+		}
+
+		if delay := recv.limiter.current(); delay > 0 {
+			r.Config.SleepDelay(delay)
+		}
+	}}
+}
+
+func (recv *Retryer) succeededHandler() request.NamedHandler {
+	return request.NamedHandler{Name: "porter.AdaptiveRetrySucceededHandler", Fn: func(r *request.Request) {
+		if recv.Adaptive && r.Error == nil {
+			recv.limiter.succeeded()
+		}
+	}}
+}
+
+func (recv *rateLimiter) current() time.Duration {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	return recv.delay
+}
+
+func (recv *rateLimiter) throttled(baseDelay, maxDelay time.Duration) {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	recv.delay *= 2
+	if recv.delay < baseDelay {
+		recv.delay = baseDelay
+	}
+	if recv.delay > maxDelay {
+		recv.delay = maxDelay
+	}
+}
+
+func (recv *rateLimiter) succeeded() {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	recv.delay /= 2
+	if recv.delay < time.Millisecond {
+		recv.delay = 0
+	}
+}
+
+func statusCode(r *request.Request) int {
+	if r.HTTPResponse == nil {
+		return 0
+	}
+	return r.HTTPResponse.StatusCode
+}
+
+func operationName(r *request.Request) string {
+	if r.Operation == nil {
+		return ""
+	}
+	return r.Operation.Name
+}
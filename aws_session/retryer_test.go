@@ -0,0 +1,155 @@
+package aws_session_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/ecr"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+var _ = Describe("Retryer", func() {
+
+	var (
+		server    *httptest.Server
+		requests  int
+		failures  int
+		errorCode string
+		sleeps    []time.Duration
+		retryer   *aws_session.Retryer
+	)
+
+	newClient := func() *ecr.ECR {
+		aws_session.UseRetryer(retryer)
+
+		return ecr.New(aws_session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			SleepDelay: func(delay time.Duration) {
+				sleeps = append(sleeps, delay)
+			},
+		}))
+	}
+
+	BeforeEach(func() {
+		requests = 0
+		failures = 0
+		errorCode = "ThrottlingException"
+		sleeps = nil
+
+		retryer = aws_session.NewRetryer()
+		retryer.MaxAttempts = 3
+		retryer.BaseDelay = 10 * time.Millisecond
+		retryer.MaxDelay = 100 * time.Millisecond
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests <= failures {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"` + errorCode + `","message":"slow down"}`))
+				return
+			}
+			w.Write([]byte(`{"repositories":[]}`))
+		}))
+	})
+
+	AfterEach(func() {
+		aws_session.UseRetryer(aws_session.NewRetryer())
+		server.Close()
+	})
+
+	It("retries throttling until the call succeeds", func() {
+		failures = 2
+
+		_, err := newClient().DescribeRepositories(&ecr.DescribeRepositoriesInput{})
+		Expect(err).To(BeNil())
+		Expect(requests).To(Equal(3))
+	})
+
+	It("stops after the max attempts", func() {
+		failures = 10
+
+		_, err := newClient().DescribeRepositories(&ecr.DescribeRepositoriesInput{})
+		Expect(err).To(HaveOccurred())
+		Expect(requests).To(Equal(3))
+	})
+
+	It("overrides the max attempts by operation", func() {
+		failures = 10
+		retryer.OperationMaxAttempts = map[string]int{
+			"DescribeRepositories": 5,
+		}
+
+		_, err := newClient().DescribeRepositories(&ecr.DescribeRepositoriesInput{})
+		Expect(err).To(HaveOccurred())
+		Expect(requests).To(Equal(5))
+	})
+
+	It("prefers the service and operation override", func() {
+		failures = 10
+		retryer.OperationMaxAttempts = map[string]int{
+			"DescribeRepositories":     5,
+			"ecr:DescribeRepositories": 1,
+		}
+
+		_, err := newClient().DescribeRepositories(&ecr.DescribeRepositoriesInput{})
+		Expect(err).To(HaveOccurred())
+		Expect(requests).To(Equal(1))
+	})
+
+	It("doesn't retry client errors", func() {
+		failures = 10
+		errorCode = "InvalidParameterException"
+
+		_, err := newClient().DescribeRepositories(&ecr.DescribeRepositoriesInput{})
+		Expect(err).To(HaveOccurred())
+		Expect(requests).To(Equal(1))
+	})
+
+	It("slows down later calls after throttling when adaptive", func() {
+		failures = 1
+		client := newClient()
+
+		_, err := client.DescribeRepositories(&ecr.DescribeRepositoriesInput{})
+		Expect(err).To(BeNil())
+
+		sleeps = nil
+		_, err = client.DescribeRepositories(&ecr.DescribeRepositoriesInput{})
+		Expect(err).To(BeNil())
+		Expect(sleeps).ToNot(BeEmpty())
+		Expect(sleeps[0]).To(BeNumerically(">", 0))
+	})
+
+	It("doesn't slow down later calls when not adaptive", func() {
+		failures = 1
+		retryer.Adaptive = false
+		client := newClient()
+
+		_, err := client.DescribeRepositories(&ecr.DescribeRepositoriesInput{})
+		Expect(err).To(BeNil())
+
+		sleeps = nil
+		_, err = client.DescribeRepositories(&ecr.DescribeRepositoriesInput{})
+		Expect(err).To(BeNil())
+		Expect(sleeps).To(BeEmpty())
+	})
+
+	It("keeps delays under the max delay", func() {
+		r := &request.Request{
+			RetryCount:   20,
+			HTTPResponse: &http.Response{StatusCode: 503},
+		}
+
+		for i := 0; i < 100; i++ {
+			Expect(retryer.RetryRules(r)).To(BeNumerically("<=", retryer.MaxDelay))
+		}
+	})
+})
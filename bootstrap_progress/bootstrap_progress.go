@@ -0,0 +1,218 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+
+// Package bootstrap_progress carries host bootstrap milestones from EC2
+// instances to the deployer over the stack's progress queue so a stuck
+// bootstrap is visible before the WaitCondition times out
+package bootstrap_progress
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adobe-platform/porter/util"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inconshreveable/log15"
+)
+
+// Milestones in the order a host reaches them
+const (
+	PorterInstalled   = "porter-installed"
+	DaemonStarted     = "daemon-started"
+	PayloadDownloaded = "payload-downloaded"
+	ImagesLoaded      = "images-loaded"
+	ContainersHealthy = "containers-healthy"
+	Failed            = "failed"
+
+	// PreflightFailed is sent instead of any milestone after PorterInstalled
+	// when the host isn't fit to run the service. Reason says why
+	PreflightFailed = "preflight-failed"
+
+	// PayloadInvalid is sent instead of PayloadDownloaded when the service
+	// payload never matched the checksum provision uploaded it with
+	PayloadInvalid = "payload-invalid"
+)
+
+type (
+	Message struct {
+		InstanceId string    `json:"instanceId"`
+		Milestone  string    `json:"milestone"`
+		Time       time.Time `json:"time"`
+		Reason     string    `json:"reason,omitempty"`
+	}
+
+	// Watcher logs milestones as they arrive and remembers the last one each
+	// instance reported
+	Watcher struct {
+		log       log15.Logger
+		sqsClient *sqs.SQS
+		queueUrl  string
+
+		lock         sync.Mutex
+		last         map[string]Message
+		firstHealthy time.Time
+
+		done chan struct{}
+	}
+)
+
+func Send(log log15.Logger, sqsClient *sqs.SQS, queueUrl string, message Message) (success bool) {
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		log.Error("json.Marshal", "Error", err)
+		return
+	}
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(queueUrl),
+		MessageBody: aws.String(string(messageBytes)),
+	}
+
+	retryMsg := func(i int) { log.Warn("sqs:SendMessage retrying", "Count", i) }
+	success = util.SuccessRetryer(7, retryMsg, func() bool {
+		_, err := sqsClient.SendMessage(input)
+		if err != nil {
+			log.Error("sqs:SendMessage", "Error", err)
+			return false
+		}
+		return true
+	})
+	return
+}
+
+func NewWatcher(log log15.Logger, sqsClient *sqs.SQS, queueUrl string) *Watcher {
+	return &Watcher{
+		log:       log,
+		sqsClient: sqsClient,
+		queueUrl:  queueUrl,
+
+		last: make(map[string]Message),
+		done: make(chan struct{}),
+	}
+}
+
+// Start receives messages until Stop is called
+func (recv *Watcher) Start() {
+	go func() {
+		for {
+			select {
+			case <-recv.done:
+				return
+			default:
+			}
+
+			recv.receive()
+		}
+	}()
+}
+
+// Stop returns immediately. A receive in flight finishes within its 20 second
+// long poll
+func (recv *Watcher) Stop() {
+	close(recv.done)
+}
+
+func (recv *Watcher) receive() {
+	output, err := recv.sqsClient.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(recv.queueUrl),
+		MaxNumberOfMessages: aws.Int64(10),
+		WaitTimeSeconds:     aws.Int64(20),
+	})
+	if err != nil {
+		recv.log.Warn("sqs:ReceiveMessage", "Error", err)
+		time.Sleep(5 * time.Second)
+		return
+	}
+
+	for _, sqsMessage := range output.Messages {
+
+		var message Message
+		if sqsMessage.Body != nil &&
+			json.Unmarshal([]byte(*sqsMessage.Body), &message) == nil {
+
+			recv.record(message)
+		}
+
+		_, err = recv.sqsClient.DeleteMessage(&sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(recv.queueUrl),
+			ReceiptHandle: sqsMessage.ReceiptHandle,
+		})
+		if err != nil {
+			recv.log.Warn("sqs:DeleteMessage", "Error", err)
+		}
+	}
+}
+
+func (recv *Watcher) record(message Message) {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	// SQS doesn't guarantee order
+	if last, exists := recv.last[message.InstanceId]; exists && last.Time.After(message.Time) {
+		return
+	}
+	recv.last[message.InstanceId] = message
+
+	if message.Milestone == ContainersHealthy &&
+		(recv.firstHealthy.IsZero() || message.Time.Before(recv.firstHealthy)) {
+		recv.firstHealthy = message.Time
+	}
+
+	switch message.Milestone {
+	case Failed:
+		recv.log.Error("Bootstrap failed", "InstanceId", message.InstanceId)
+	case PreflightFailed:
+		recv.log.Error("Bootstrap preflight failed", "InstanceId", message.InstanceId, "Reason", message.Reason)
+	case PayloadInvalid:
+		recv.log.Error("Service payload failed verification", "InstanceId", message.InstanceId, "Reason", message.Reason)
+	default:
+		recv.log.Info("Bootstrap progress", "InstanceId", message.InstanceId, "Milestone", message.Milestone)
+	}
+}
+
+// FirstHealthy is when the first instance reported its containers healthy.
+// It's zero if none has
+func (recv *Watcher) FirstHealthy() time.Time {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	return recv.firstHealthy
+}
+
+// LogSummary logs the last milestone of every instance that reported one
+func (recv *Watcher) LogSummary() {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	if len(recv.last) == 0 {
+		recv.log.Warn("No instance reported bootstrap progress. Instances may have failed before porter was installed")
+		return
+	}
+
+	instanceIds := make([]string, 0, len(recv.last))
+	for instanceId := range recv.last {
+		instanceIds = append(instanceIds, instanceId)
+	}
+	sort.Strings(instanceIds)
+
+	for _, instanceId := range instanceIds {
+		message := recv.last[instanceId]
+		recv.log.Warn("Last bootstrap milestone",
+			"InstanceId", instanceId,
+			"Milestone", message.Milestone,
+			"Reason", message.Reason,
+			"Age", time.Since(message.Time).String())
+	}
+}
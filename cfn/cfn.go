@@ -16,6 +16,7 @@ import "fmt"
 type (
 	Template struct {
 		Description string                    `json:"Description,omitempty"`
+		Metadata    map[string]interface{}    `json:"Metadata,omitempty"`
 		Parameters  map[string]ParameterInput `json:"Parameters,omitempty"`
 		Mappings    map[string]interface{}    `json:"Mappings,omitempty"`
 		Resources   map[string]interface{}    `json:"Resources,omitempty"`
@@ -37,11 +38,13 @@ type (
 		AllowedValues         []string `json:"AllowedValues,omitempty"`
 		Default               string   `json:"Default,omitempty"`
 		ConstraintDescription string   `json:"ConstraintDescription,omitempty"`
+		NoEcho                bool     `json:"NoEcho,omitempty"`
 	}
 )
 
 func NewTemplate() *Template {
 	return &Template{
+		Metadata:   make(map[string]interface{}),
 		Parameters: make(map[string]ParameterInput),
 		Mappings:   make(map[string]interface{}),
 		Resources:  make(map[string]interface{}),
@@ -89,6 +92,25 @@ func (recv *Template) SetResource(logicalName string, resource map[string]interf
 	}
 }
 
+func (recv *Template) RemoveResource(logicalName string) {
+	delete(recv.Resources, logicalName)
+
+	for resourceType, logicalNames := range recv.typeToLogical {
+		for i, existingLogicalName := range logicalNames {
+			if existingLogicalName == logicalName {
+				logicalNames = append(logicalNames[:i], logicalNames[i+1:]...)
+				break
+			}
+		}
+
+		if len(logicalNames) == 0 {
+			delete(recv.typeToLogical, resourceType)
+		} else {
+			recv.typeToLogical[resourceType] = logicalNames
+		}
+	}
+}
+
 func (recv *Template) ResourceExists(resourceType string) bool {
 	_, exists := recv.typeToLogical[resourceType]
 	return exists
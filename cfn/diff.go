@@ -0,0 +1,155 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package cfn
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+const (
+	ChangeAdded   = "+"
+	ChangeRemoved = "-"
+	ChangeChanged = "~"
+)
+
+// Change is a difference between two templates at a path like
+// Resources.AutoScalingGroup.Properties.Tags[2].Value
+type Change struct {
+	Op   string
+	Path string
+	Old  interface{}
+	New  interface{}
+}
+
+func (recv Change) String() string {
+	switch recv.Op {
+	case ChangeAdded:
+		return fmt.Sprintf("%s %s%s", recv.Op, recv.Path, scalarSuffix(recv.New))
+	case ChangeRemoved:
+		return fmt.Sprintf("%s %s%s", recv.Op, recv.Path, scalarSuffix(recv.Old))
+	default:
+		return fmt.Sprintf("%s %s: %s -> %s", recv.Op, recv.Path, compactJSON(recv.Old), compactJSON(recv.New))
+	}
+}
+
+// DiffTemplates compares two JSON templates structurally. Changes are ordered
+// by path. Lists are compared by index so an insertion shows up as changes to
+// every element after it
+func DiffTemplates(oldTemplate, newTemplate []byte) ([]Change, error) {
+	var oldValue, newValue interface{}
+
+	// no live template means everything is added
+	oldValue = map[string]interface{}{}
+	if len(oldTemplate) > 0 {
+		err := json.Unmarshal(oldTemplate, &oldValue)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := json.Unmarshal(newTemplate, &newValue)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]Change, 0)
+	diffValues("", oldValue, newValue, &changes)
+	return changes, nil
+}
+
+func diffValues(path string, oldValue, newValue interface{}, changes *[]Change) {
+
+	if reflect.DeepEqual(oldValue, newValue) {
+		return
+	}
+
+	if oldValue == nil {
+		*changes = append(*changes, Change{Op: ChangeAdded, Path: path, New: newValue})
+		return
+	}
+
+	if newValue == nil {
+		*changes = append(*changes, Change{Op: ChangeRemoved, Path: path, Old: oldValue})
+		return
+	}
+
+	oldMap, oldIsMap := oldValue.(map[string]interface{})
+	newMap, newIsMap := newValue.(map[string]interface{})
+	if oldIsMap && newIsMap {
+
+		keys := make([]string, 0, len(oldMap)+len(newMap))
+		for key := range oldMap {
+			keys = append(keys, key)
+		}
+		for key := range newMap {
+			if _, exists := oldMap[key]; !exists {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+			diffValues(keyPath, oldMap[key], newMap[key], changes)
+		}
+		return
+	}
+
+	oldList, oldIsList := oldValue.([]interface{})
+	newList, newIsList := newValue.([]interface{})
+	if oldIsList && newIsList {
+
+		length := len(oldList)
+		if len(newList) > length {
+			length = len(newList)
+		}
+
+		for i := 0; i < length; i++ {
+			var oldElem, newElem interface{}
+			if i < len(oldList) {
+				oldElem = oldList[i]
+			}
+			if i < len(newList) {
+				newElem = newList[i]
+			}
+			diffValues(fmt.Sprintf("%s[%d]", path, i), oldElem, newElem, changes)
+		}
+		return
+	}
+
+	*changes = append(*changes, Change{Op: ChangeChanged, Path: path, Old: oldValue, New: newValue})
+}
+
+// scalarSuffix shows added and removed values unless they're whole objects or
+// lists which are too big to be useful on one line
+func scalarSuffix(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return ""
+	default:
+		return ": " + compactJSON(value)
+	}
+}
+
+func compactJSON(value interface{}) string {
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(valueBytes)
+}
@@ -0,0 +1,54 @@
+package cfn_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/cfn"
+)
+
+var _ = Describe("DiffTemplates", func() {
+
+	It("finds added, removed, and changed values by path", func() {
+		live := []byte(`{
+			"Resources": {
+				"ASG": {"Type": "AWS::AutoScaling::AutoScalingGroup", "Properties": {"MaxSize": "2", "Tags": [{"Key": "a"}]}},
+				"Old": {"Type": "AWS::SNS::Topic"}
+			}
+		}`)
+		next := []byte(`{
+			"Resources": {
+				"ASG": {"Type": "AWS::AutoScaling::AutoScalingGroup", "Properties": {"MaxSize": "4", "Tags": [{"Key": "a"}, {"Key": "b"}]}},
+				"New": {"Type": "AWS::SQS::Queue"}
+			}
+		}`)
+
+		changes, err := cfn.DiffTemplates(live, next)
+		Expect(err).To(BeNil())
+
+		lines := make([]string, 0)
+		for _, change := range changes {
+			lines = append(lines, change.String())
+		}
+
+		Expect(lines).To(Equal([]string{
+			`~ Resources.ASG.Properties.MaxSize: "2" -> "4"`,
+			`+ Resources.ASG.Properties.Tags[1]`,
+			`+ Resources.New`,
+			`- Resources.Old`,
+		}))
+	})
+
+	It("treats a missing live template as all new", func() {
+		changes, err := cfn.DiffTemplates(nil, []byte(`{"Description": "d"}`))
+		Expect(err).To(BeNil())
+		Expect(changes).To(HaveLen(1))
+		Expect(changes[0].String()).To(Equal(`+ Description: "d"`))
+	})
+
+	It("finds nothing in equal templates", func() {
+		changes, err := cfn.DiffTemplates([]byte(`{"A": [1, 2]}`), []byte(`{"A":[1,2]}`))
+		Expect(err).To(BeNil())
+		Expect(changes).To(BeEmpty())
+	})
+})
@@ -17,6 +17,7 @@ const (
 	AutoScaling_LifecycleHook              = "AWS::AutoScaling::LifecycleHook"
 	AutoScaling_ScalingPolicy              = "AWS::AutoScaling::ScalingPolicy"
 	AutoScaling_ScheduledAction            = "AWS::AutoScaling::ScheduledAction"
+	CertificateManager_Certificate         = "AWS::CertificateManager::Certificate"
 	CloudFormation_Authentication          = "AWS::CloudFormation::Authentication"
 	CloudFormation_CustomResource          = "AWS::CloudFormation::CustomResource"
 	CloudFormation_Init                    = "AWS::CloudFormation::Init"
@@ -27,6 +28,7 @@ const (
 	CloudFront_Distribution                = "AWS::CloudFront::Distribution"
 	CloudTrail_Trail                       = "AWS::CloudTrail::Trail"
 	CloudWatch_Alarm                       = "AWS::CloudWatch::Alarm"
+	CloudWatch_Dashboard                   = "AWS::CloudWatch::Dashboard"
 	CodeDeploy_Application                 = "AWS::CodeDeploy::Application"
 	CodeDeploy_DeploymentConfig            = "AWS::CodeDeploy::DeploymentConfig"
 	CodeDeploy_DeploymentGroup             = "AWS::CodeDeploy::DeploymentGroup"
@@ -44,6 +46,7 @@ const (
 	EC2_EIP                                = "AWS::EC2::EIP"
 	EC2_EIPAssociation                     = "AWS::EC2::EIPAssociation"
 	EC2_Instance                           = "AWS::EC2::Instance"
+	EC2_LaunchTemplate                     = "AWS::EC2::LaunchTemplate"
 	EC2_InternetGateway                    = "AWS::EC2::InternetGateway"
 	EC2_NetworkAcl                         = "AWS::EC2::NetworkAcl"
 	EC2_NetworkAclEntry                    = "AWS::EC2::NetworkAclEntry"
@@ -86,6 +89,10 @@ const (
 	ElasticBeanstalk_ConfigurationTemplate = "AWS::ElasticBeanstalk::ConfigurationTemplate"
 	ElasticBeanstalk_Environment           = "AWS::ElasticBeanstalk::Environment"
 	ElasticLoadBalancing_LoadBalancer      = "AWS::ElasticLoadBalancing::LoadBalancer"
+	ElasticLoadBalancingV2_Listener        = "AWS::ElasticLoadBalancingV2::Listener"
+	ElasticLoadBalancingV2_ListenerRule    = "AWS::ElasticLoadBalancingV2::ListenerRule"
+	ElasticLoadBalancingV2_LoadBalancer    = "AWS::ElasticLoadBalancingV2::LoadBalancer"
+	ElasticLoadBalancingV2_TargetGroup     = "AWS::ElasticLoadBalancingV2::TargetGroup"
 	IAM_AccessKey                          = "AWS::IAM::AccessKey"
 	IAM_Group                              = "AWS::IAM::Group"
 	IAM_InstanceProfile                    = "AWS::IAM::InstanceProfile"
@@ -130,16 +137,20 @@ const (
 	S3_Bucket                              = "AWS::S3::Bucket"
 	S3_BucketPolicy                        = "AWS::S3::BucketPolicy"
 	SDB_Domain                             = "AWS::SDB::Domain"
+	SecretsManager_Secret                  = "AWS::SecretsManager::Secret"
 	SNS_Topic                              = "AWS::SNS::Topic"
 	SNS_TopicPolicy                        = "AWS::SNS::TopicPolicy"
 	SQS_Queue                              = "AWS::SQS::Queue"
 	SQS_QueuePolicy                        = "AWS::SQS::QueuePolicy"
 	SSM_Document                           = "AWS::SSM::Document"
+	SSM_Parameter                          = "AWS::SSM::Parameter"
 	WAF_ByteMatchSet                       = "AWS::WAF::ByteMatchSet"
 	WAF_IPSet                              = "AWS::WAF::IPSet"
 	WAF_Rule                               = "AWS::WAF::Rule"
 	WAF_SqlInjectionMatchSet               = "AWS::WAF::SqlInjectionMatchSet"
 	WAF_WebACL                             = "AWS::WAF::WebACL"
+	WAFv2_WebACL                           = "AWS::WAFv2::WebACL"
+	WAFv2_WebACLAssociation                = "AWS::WAFv2::WebACLAssociation"
 	WorkSpaces_Workspace                   = "AWS::WorkSpaces::Workspace"
 )
 
@@ -157,6 +168,7 @@ func init() {
 	allTypes[AutoScaling_LifecycleHook] = nil
 	allTypes[AutoScaling_ScalingPolicy] = nil
 	allTypes[AutoScaling_ScheduledAction] = nil
+	allTypes[CertificateManager_Certificate] = nil
 	allTypes[CloudFormation_Authentication] = nil
 	allTypes[CloudFormation_CustomResource] = nil
 	allTypes[CloudFormation_Init] = nil
@@ -167,6 +179,7 @@ func init() {
 	allTypes[CloudFront_Distribution] = nil
 	allTypes[CloudTrail_Trail] = nil
 	allTypes[CloudWatch_Alarm] = nil
+	allTypes[CloudWatch_Dashboard] = nil
 	allTypes[CodeDeploy_Application] = nil
 	allTypes[CodeDeploy_DeploymentConfig] = nil
 	allTypes[CodeDeploy_DeploymentGroup] = nil
@@ -184,6 +197,7 @@ func init() {
 	allTypes[EC2_EIP] = nil
 	allTypes[EC2_EIPAssociation] = nil
 	allTypes[EC2_Instance] = nil
+	allTypes[EC2_LaunchTemplate] = nil
 	allTypes[EC2_InternetGateway] = nil
 	allTypes[EC2_NetworkAcl] = nil
 	allTypes[EC2_NetworkAclEntry] = nil
@@ -226,6 +240,10 @@ func init() {
 	allTypes[ElasticBeanstalk_ConfigurationTemplate] = nil
 	allTypes[ElasticBeanstalk_Environment] = nil
 	allTypes[ElasticLoadBalancing_LoadBalancer] = nil
+	allTypes[ElasticLoadBalancingV2_Listener] = nil
+	allTypes[ElasticLoadBalancingV2_ListenerRule] = nil
+	allTypes[ElasticLoadBalancingV2_LoadBalancer] = nil
+	allTypes[ElasticLoadBalancingV2_TargetGroup] = nil
 	allTypes[IAM_AccessKey] = nil
 	allTypes[IAM_Group] = nil
 	allTypes[IAM_InstanceProfile] = nil
@@ -270,15 +288,19 @@ func init() {
 	allTypes[S3_Bucket] = nil
 	allTypes[S3_BucketPolicy] = nil
 	allTypes[SDB_Domain] = nil
+	allTypes[SecretsManager_Secret] = nil
 	allTypes[SNS_Topic] = nil
 	allTypes[SNS_TopicPolicy] = nil
 	allTypes[SQS_Queue] = nil
 	allTypes[SQS_QueuePolicy] = nil
 	allTypes[SSM_Document] = nil
+	allTypes[SSM_Parameter] = nil
 	allTypes[WAF_ByteMatchSet] = nil
 	allTypes[WAF_IPSet] = nil
 	allTypes[WAF_Rule] = nil
 	allTypes[WAF_SqlInjectionMatchSet] = nil
 	allTypes[WAF_WebACL] = nil
+	allTypes[WAFv2_WebACL] = nil
+	allTypes[WAFv2_WebACLAssociation] = nil
 	allTypes[WorkSpaces_Workspace] = nil
 }
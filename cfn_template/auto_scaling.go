@@ -14,6 +14,7 @@ package cfn_template
 import (
 	"bytes"
 	"encoding/json"
+	"sort"
 	"strconv"
 	"strings"
 	"text/template"
@@ -25,6 +26,13 @@ import (
 type (
 	UserDataContext struct {
 		LogicalId string
+
+		// installed along with porter's packages
+		Packages []string
+
+		// AMIs other than porter's Amazon Linux 1 default install the latest
+		// packages of their own repository rather than pinned versions
+		LatestPackages bool
 	}
 
 	AWSCloudFormationInitCtx struct {
@@ -33,15 +41,22 @@ type (
 		Region        string
 		EnvFile       string
 
+		ContainerSecretsPath string
+
 		ServiceName    string
 		ServiceVersion string
 
 		ServicePayloadBucket     string
 		ServicePayloadKey        string
+		ServicePayloadUrl        string
 		ServicePayloadConfigPath string
 		ServicePayloadHostPath   string
 		ServicePayloadChecksum   string
 
+		// hosts check the payload against the stack's deployment manifest
+		DeploymentManifestKey string
+		DeploymentManifestUrl string
+
 		RegistryDeployment bool
 		InsecureRegistry   string
 
@@ -50,6 +65,13 @@ type (
 
 		ImageNames []string
 
+		// What's between an image's name and .docker in the service payload
+		// for the instance's architecture
+		ImageFileSuffix string
+
+		// The instance group whose containers run on the instance
+		InstanceGroup string
+
 		PorterBinaryUrl string
 
 		DevMode  bool
@@ -59,10 +81,67 @@ type (
 
 		Elbs string
 
+		SpotDrainTimeout int
+
+		// porterd publishes the root volume's usage to CloudWatch
+		DiskMetrics bool
+
+		// porterd relieves pressure past these thresholds. See conf.Pressure
+		PressureMemory   float64
+		PressureCPU      float64
+		PressureAction   string
+		PressureCooldown int
+
+		// porterd reclaims disk past these watermarks. See conf.DiskGC
+		DiskGCHigh float64
+		DiskGCLow  float64
+
+		// porterd polls its instance's command queue
+		CommandQueue bool
+
+		// porterd registers the instance in the record set of DNSName when
+		// dns targets instances
+		DNSName        string
+		HostedZoneName string
+
+		// Containers log to the stack's container log group with the awslogs
+		// driver and the awslogs agent ships host files to its host log group
+		ContainerLogs bool
+		HostLogFiles  []string
+
+		Hardening Hardening
+
+		Storage Storage
+
+		// Instances are replaced rather than hot swapped when the stack is
+		// updated
+		InstanceRefresh bool
+
 		ContainerUserUid string
+
+		// The env_var of each dependency output and the parameter whose
+		// value it gets
+		DependencyEnv map[string]string
 	}
 )
 
+// dependencyExports exports every dependency output's env_var in a stable
+// order so the launch configuration only changes when they do
+func dependencyExports(dependencyEnv map[string]string) []interface{} {
+	envVars := make([]string, 0, len(dependencyEnv))
+	for envVar := range dependencyEnv {
+		envVars = append(envVars, envVar)
+	}
+	sort.Strings(envVars)
+
+	exports := make([]interface{}, 0)
+	for _, envVar := range envVars {
+		exports = append(exports,
+			"export "+envVar+"='", map[string]string{"Ref": dependencyEnv[envVar]}, "'\n")
+	}
+	return exports
+}
+
 // ImageIdInMap works with a mapping like the following to select an AMI id for
 // the current region
 //
@@ -97,7 +176,7 @@ func ImageIdInMap(mapId string) map[string]interface{} {
 //
 // http://docs.aws.amazon.com/AWSEC2/latest/UserGuide/user-data.html
 // http://docs.aws.amazon.com/AWSEC2/latest/UserGuide/AmazonLinuxAMIBasics.html
-func UserData(autoScalingLaunchConfigurationLogicalId string) (map[string]interface{}, error) {
+func UserData(autoScalingLaunchConfigurationLogicalId string, hardening Hardening, latestPackages bool) (map[string]interface{}, error) {
 
 	tmpl, err := template.New("").Parse(files.CloudInitJson)
 	if err != nil {
@@ -108,6 +187,9 @@ func UserData(autoScalingLaunchConfigurationLogicalId string) (map[string]interf
 
 	context := UserDataContext{
 		LogicalId: autoScalingLaunchConfigurationLogicalId,
+		Packages:  hardening.Packages(),
+
+		LatestPackages: latestPackages,
 	}
 
 	err = tmpl.Execute(&buf, context)
@@ -230,7 +312,34 @@ func AWSCloudFormationInit(autoScalingLaunchConfigurationLogicalId string, conte
 		return nil, err
 	}
 
-	bootstrapFile := cfnExecutable(buf.String())
+	// the first line is the shebang
+	bootstrapLines := strings.Split(buf.String(), "\n")
+	bootstrapContents := []interface{}{
+		bootstrapLines[0] + "\n",
+		"export PROGRESS_QUEUE_URL='", map[string]string{"Ref": constants.ProgressQueue}, "'\n",
+		"export " + constants.EnvDeploymentId + "=", map[string]string{"Ref": constants.ParameterStackName}, "\n",
+		"export " + constants.EnvStackColor + "=", map[string]string{"Ref": constants.ParameterStackColor}, "\n",
+	}
+	if len(context.HostLogFiles) > 0 {
+		bootstrapContents = append(bootstrapContents,
+			"export "+constants.EnvHostLogGroup+"=", map[string]string{"Ref": constants.HostLogGroup}, "\n")
+	}
+	bootstrapContents = append(bootstrapContents, dependencyExports(context.DependencyEnv)...)
+	for _, line := range bootstrapLines[1:] {
+		bootstrapContents = append(bootstrapContents, line+"\n")
+	}
+
+	bootstrapFile := map[string]interface{}{
+		"content": map[string]interface{}{
+			"Fn::Join": []interface{}{
+				"",
+				bootstrapContents,
+			},
+		},
+		"mode":  "000755",
+		"owner": "root",
+		"group": "root",
+	}
 
 	buf.Reset()
 
@@ -248,7 +357,15 @@ func AWSCloudFormationInit(autoScalingLaunchConfigurationLogicalId string, conte
 		"#!/bin/bash -e\n",
 		"export AWS_STACKID=", map[string]string{"Ref": "AWS::StackId"}, "\n",
 		"export SIGNAL_QUEUE_URL='", map[string]string{"Ref": constants.SignalQueue}, "'\n",
+		"export PROGRESS_QUEUE_URL='", map[string]string{"Ref": constants.ProgressQueue}, "'\n",
+		"export " + constants.EnvDeploymentId + "=", map[string]string{"Ref": constants.ParameterStackName}, "\n",
+		"export " + constants.EnvStackColor + "=", map[string]string{"Ref": constants.ParameterStackColor}, "\n",
+	}
+	if context.ContainerLogs {
+		hotSwapContents = append(hotSwapContents,
+			"export "+constants.EnvContainerLogGroup+"=", map[string]string{"Ref": constants.ContainerLogGroup}, "\n")
 	}
+	hotSwapContents = append(hotSwapContents, dependencyExports(context.DependencyEnv)...)
 	for _, line := range strings.Split(buf.String(), "\n") {
 		hotSwapContents = append(hotSwapContents, line+"\n")
 	}
@@ -297,6 +414,38 @@ func AWSCloudFormationInit(autoScalingLaunchConfigurationLogicalId string, conte
 		"group": "root",
 	}
 
+	buf.Reset()
+
+	tmpl, err = template.New("").Parse(files.PorterRefreshSecrets)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tmpl.Execute(&buf, context)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshSecretsContents := []interface{}{
+		"#!/bin/bash -e\n",
+		"export AWS_STACKID=", map[string]string{"Ref": "AWS::StackId"}, "\n",
+	}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		refreshSecretsContents = append(refreshSecretsContents, line+"\n")
+	}
+
+	refreshSecretsFile := map[string]interface{}{
+		"content": map[string]interface{}{
+			"Fn::Join": []interface{}{
+				"",
+				refreshSecretsContents,
+			},
+		},
+		"mode":  "000755",
+		"owner": "root",
+		"group": "root",
+	}
+
 	awsCloudformationInit := map[string]interface{}{
 		"configSets": map[string]interface{}{
 			"bootstrap": []string{"bootstrapConfig"},
@@ -317,14 +466,15 @@ func AWSCloudFormationInit(autoScalingLaunchConfigurationLogicalId string, conte
 				},
 			},
 			"files": map[string]interface{}{
-				"/etc/cfn/cfn-hup.conf":        cfnHupConf,
-				"/etc/cfn/hooks.conf":          hooksConf,
-				"/usr/bin/porter_bootstrap":    bootstrapFile,
-				"/usr/bin/porter_hotswap":      hotswapFile,
-				"/usr/bin/porter_get_secrets":  getSecretsFile,
-				"/etc/update-motd.d/99-porter": cfnExecutable(files.Motd),
-				"/etc/logrotate.d/porter":      cfnReadOnly(files.LogrotatePorter),
-				"/etc/pam.d/crond":             cfnReadOnly(files.PamdCrond),
+				"/etc/cfn/cfn-hup.conf":           cfnHupConf,
+				"/etc/cfn/hooks.conf":             hooksConf,
+				"/usr/bin/porter_bootstrap":       bootstrapFile,
+				"/usr/bin/porter_hotswap":         hotswapFile,
+				"/usr/bin/porter_get_secrets":     getSecretsFile,
+				"/usr/bin/porter_refresh_secrets": refreshSecretsFile,
+				"/etc/update-motd.d/99-porter":    cfnExecutable(files.Motd),
+				"/etc/logrotate.d/porter":         cfnReadOnly(files.LogrotatePorter),
+				"/etc/pam.d/crond":                cfnReadOnly(files.PamdCrond),
 			},
 		},
 		// Why not just call /usr/bin/porter_hotswap again?
@@ -337,11 +487,30 @@ func AWSCloudFormationInit(autoScalingLaunchConfigurationLogicalId string, conte
 				},
 			},
 			"files": map[string]interface{}{
-				"/usr/bin/porter_hotswap":     hotswapFile,
-				"/usr/bin/porter_get_secrets": getSecretsFile,
+				"/usr/bin/porter_hotswap":         hotswapFile,
+				"/usr/bin/porter_get_secrets":     getSecretsFile,
+				"/usr/bin/porter_refresh_secrets": refreshSecretsFile,
 			},
 		},
 	}
+	bootstrapConfigSet := make([]string, 0)
+	if hardeningConfig := context.Hardening.cfnInitConfig(); hardeningConfig != nil {
+		awsCloudformationInit["hardeningConfig"] = hardeningConfig
+		bootstrapConfigSet = append(bootstrapConfigSet, "hardeningConfig")
+	}
+	if storageConfig := context.Storage.cfnInitConfig(); storageConfig != nil {
+		awsCloudformationInit["storageConfig"] = storageConfig
+		bootstrapConfigSet = append(bootstrapConfigSet, "storageConfig")
+	}
+	awsCloudformationInit["configSets"].(map[string]interface{})["bootstrap"] = append(bootstrapConfigSet, "bootstrapConfig")
+
+	if context.InstanceRefresh {
+		// cfn-hup would hot swap instances that are about to be replaced
+		bootstrapConfig := awsCloudformationInit["bootstrapConfig"].(map[string]interface{})
+		delete(bootstrapConfig["files"].(map[string]interface{}), "/etc/cfn/hooks.conf")
+		delete(bootstrapConfig["services"].(map[string]interface{})["sysvinit"].(map[string]interface{}), "cfn-hup")
+	}
+
 	return awsCloudformationInit, nil
 }
 
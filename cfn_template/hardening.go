@@ -0,0 +1,155 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package cfn_template
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const sysctlConfPath = "/etc/sysctl.d/90-porter-hardening.conf"
+
+// yum-cron applies security updates every day. docker and haproxy are only
+// updated with the AMI because restarting them would take the service down
+const yumCronConf = `[commands]
+update_cmd = security
+update_messages = yes
+download_updates = yes
+apply_updates = yes
+random_sleep = 360
+
+[emitters]
+emit_via = stdio
+
+[base]
+exclude = docker* haproxy*`
+
+// bans hosts after repeated failed ssh logins
+const jailLocal = `[DEFAULT]
+bantime = 3600
+findtime = 600
+maxretry = 5
+
+[sshd]
+enabled = true`
+
+// Hardening is how an instance is locked down before porter bootstraps it
+type Hardening struct {
+	// yum-cron applies security updates daily
+	SecurityUpdates bool
+
+	// sshd is stopped and disabled
+	DisableSSH bool
+
+	// the SSM agent runs so Session Manager can replace ssh
+	SSMAgent bool
+
+	Fail2ban bool
+
+	Sysctl map[string]string
+}
+
+// Packages are installed by cloud-init before cfn-init configures them
+func (recv Hardening) Packages() []string {
+	packages := make([]string, 0)
+
+	if recv.SecurityUpdates {
+		packages = append(packages, "yum-cron")
+	}
+	if recv.SSMAgent {
+		packages = append(packages, "amazon-ssm-agent")
+	}
+	if recv.Fail2ban {
+		packages = append(packages, "fail2ban")
+	}
+
+	return packages
+}
+
+// cfnInitConfig is the hardeningConfig cfn-init runs ahead of
+// bootstrapConfig. It's nil when there's nothing to harden
+func (recv Hardening) cfnInitConfig() map[string]interface{} {
+	files := make(map[string]interface{})
+	services := make(map[string]interface{})
+	commands := make(map[string]interface{})
+
+	// cfn-init runs commands in the alphabetical order of their names
+	if len(recv.Sysctl) > 0 {
+		keys := make([]string, 0, len(recv.Sysctl))
+		for key := range recv.Sysctl {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		lines := make([]string, 0, len(keys))
+		for _, key := range keys {
+			lines = append(lines, fmt.Sprintf("%s = %s", key, recv.Sysctl[key]))
+		}
+
+		files[sysctlConfPath] = cfnReadOnly(strings.Join(lines, "\n"))
+		commands["10_sysctl"] = map[string]interface{}{
+			"command": "sysctl -p " + sysctlConfPath,
+		}
+	}
+
+	if recv.DisableSSH {
+		commands["20_disable_sshd"] = map[string]interface{}{
+			"command": "service sshd stop && chkconfig sshd off",
+		}
+	}
+
+	if recv.SSMAgent {
+		// the agent is an upstart job which cfn-init's sysvinit can't manage.
+		// It's a systemd unit on Amazon Linux 2
+		commands["30_start_ssm_agent"] = map[string]interface{}{
+			"command": "start amazon-ssm-agent || restart amazon-ssm-agent || systemctl restart amazon-ssm-agent",
+		}
+	}
+
+	if recv.SecurityUpdates {
+		files["/etc/yum/yum-cron.conf"] = cfnReadOnly(yumCronConf)
+		services["yum-cron"] = map[string]interface{}{
+			"enabled":       "true",
+			"ensureRunning": "true",
+			"files":         []string{"/etc/yum/yum-cron.conf"},
+		}
+	}
+
+	if recv.Fail2ban {
+		files["/etc/fail2ban/jail.local"] = cfnReadOnly(jailLocal)
+		services["fail2ban"] = map[string]interface{}{
+			"enabled":       "true",
+			"ensureRunning": "true",
+			"files":         []string{"/etc/fail2ban/jail.local"},
+		}
+	}
+
+	if len(files) == 0 && len(services) == 0 && len(commands) == 0 {
+		return nil
+	}
+
+	config := make(map[string]interface{})
+	if len(files) > 0 {
+		config["files"] = files
+	}
+	if len(services) > 0 {
+		config["services"] = map[string]interface{}{
+			"sysvinit": services,
+		}
+	}
+	if len(commands) > 0 {
+		config["commands"] = commands
+	}
+
+	return config
+}
@@ -0,0 +1,104 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package cfn_template
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/files"
+)
+
+const (
+	mountVolumePath = "/usr/bin/porter_mount_volume"
+	mountEFSPath    = "/usr/bin/porter_mount_efs"
+)
+
+// DataVolume is an EBS volume that's formatted and mounted while the instance
+// boots
+type DataVolume struct {
+	Device     string
+	MountPath  string
+	FileSystem string
+}
+
+// Storage is the data volumes and EFS file system of an instance
+type Storage struct {
+	DataVolumes []DataVolume
+
+	// the id of the file system mounted at constants.EFSMountPath. nil if
+	// there's none
+	FileSystemId interface{}
+
+	// the uid that owns the root of the file system so containers can write
+	// to it
+	FileSystemOwner string
+}
+
+// cfnInitConfig is the storageConfig cfn-init runs ahead of bootstrapConfig
+// so pod volumes are on a data volume and the file system is mounted before
+// any container starts. It's nil when there's nothing to mount
+func (recv Storage) cfnInitConfig() map[string]interface{} {
+	if len(recv.DataVolumes) == 0 && recv.FileSystemId == nil {
+		return nil
+	}
+
+	packages := make(map[string]interface{})
+	commands := make(map[string]interface{})
+
+	// cfn-init runs commands in the alphabetical order of their names
+	for i, volume := range recv.DataVolumes {
+		if volume.FileSystem == "xfs" {
+			packages["xfsprogs"] = []interface{}{}
+		}
+
+		deviceParts := strings.Split(volume.Device, "/")
+		commands[fmt.Sprintf("%02d_mount_%s", i+1, deviceParts[len(deviceParts)-1])] = map[string]interface{}{
+			"command": strings.Join([]string{mountVolumePath, volume.Device, volume.MountPath, volume.FileSystem}, " "),
+		}
+	}
+
+	if recv.FileSystemId != nil {
+		packages["nfs-utils"] = []interface{}{}
+
+		// after the data volumes in case one is mounted above it
+		commands["50_mount_efs"] = map[string]interface{}{
+			"command": map[string]interface{}{
+				"Fn::Join": []interface{}{
+					"",
+					[]interface{}{
+						mountEFSPath, " ",
+						recv.FileSystemId, ".efs.", map[string]string{"Ref": "AWS::Region"}, ".amazonaws.com ",
+						constants.EFSMountPath, " ",
+						recv.FileSystemOwner,
+					},
+				},
+			},
+		}
+	}
+
+	config := map[string]interface{}{
+		"files": map[string]interface{}{
+			mountVolumePath: cfnExecutable(files.PorterMountVolume),
+			mountEFSPath:    cfnExecutable(files.PorterMountEfs),
+		},
+		"commands": commands,
+	}
+	if len(packages) > 0 {
+		config["packages"] = map[string]interface{}{
+			"yum": packages,
+		}
+	}
+
+	return config
+}
@@ -0,0 +1,145 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package command_queue
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/adobe-platform/porter/constants"
+)
+
+// Commands are signed with a key derived from the stack's secrets key so only
+// the stack's hosts and whoever can deploy the stack can create them
+var signingKeyLabel = []byte("porter command queue")
+
+// QueueName is the name of the queue porterd creates for its instance. Each
+// instance polls its own queue so it only receives the commands sent to it
+func QueueName(serviceName, environmentName, instanceId string) string {
+	return QueueNamePrefix(serviceName, environmentName) + instanceId
+}
+
+// QueueNamePrefix starts the name of every command queue of an environment
+func QueueNamePrefix(serviceName, environmentName string) string {
+	return serviceName + "-" + environmentName + "-cmd-"
+}
+
+// Command is a message on an instance's command queue
+type Command struct {
+	Id         string            `json:"id"`
+	Name       string            `json:"name"`
+	InstanceId string            `json:"instance_id"`
+	Args       map[string]string `json:"args,omitempty"`
+	IssuedAt   time.Time         `json:"issued_at"`
+	Signature  string            `json:"signature,omitempty"`
+}
+
+// New creates an unsigned command for an instance
+func New(name, instanceId string, args map[string]string) (*Command, error) {
+	idBytes := make([]byte, 16)
+	_, err := rand.Read(idBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Command{
+		Id:         hex.EncodeToString(idBytes),
+		Name:       name,
+		InstanceId: instanceId,
+		Args:       args,
+		IssuedAt:   time.Now().UTC(),
+	}, nil
+}
+
+// SigningKey derives the key commands are signed with from a stack's secrets
+// key
+func SigningKey(secretsKey []byte) []byte {
+	mac := hmac.New(sha256.New, secretsKey)
+	mac.Write(signingKeyLabel)
+	return mac.Sum(nil)
+}
+
+// Sign sets the command's signature
+func (recv *Command) Sign(signingKey []byte) error {
+	signature, err := recv.signature(signingKey)
+	if err != nil {
+		return err
+	}
+
+	recv.Signature = hex.EncodeToString(signature)
+	return nil
+}
+
+// Verify checks the command was signed with the key and hasn't expired
+func (recv *Command) Verify(signingKey []byte, now time.Time) error {
+	actual, err := hex.DecodeString(recv.Signature)
+	if err != nil {
+		return errors.New("malformed signature")
+	}
+
+	expected, err := recv.signature(signingKey)
+	if err != nil {
+		return err
+	}
+
+	if !hmac.Equal(actual, expected) {
+		return errors.New("invalid signature")
+	}
+
+	age := now.Sub(recv.IssuedAt)
+	if age > constants.CommandMaxAge || age < -constants.CommandMaxAge {
+		return fmt.Errorf("issued at %s which is outside the %s a command is valid",
+			recv.IssuedAt.Format(time.RFC3339), constants.CommandMaxAge)
+	}
+
+	return nil
+}
+
+// signature is the HMAC of the command's JSON without its signature
+func (recv *Command) signature(signingKey []byte) ([]byte, error) {
+	unsigned := *recv
+	unsigned.Signature = ""
+
+	unsignedBytes, err := json.Marshal(unsigned)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write(unsignedBytes)
+	return mac.Sum(nil), nil
+}
+
+// Marshal is the body of the command's SQS message
+func (recv *Command) Marshal() (string, error) {
+	commandBytes, err := json.Marshal(recv)
+	if err != nil {
+		return "", err
+	}
+	return string(commandBytes), nil
+}
+
+// Unmarshal parses the body of a command's SQS message
+func Unmarshal(body string) (*Command, error) {
+	command := &Command{}
+	err := json.Unmarshal([]byte(body), command)
+	if err != nil {
+		return nil, err
+	}
+	return command, nil
+}
@@ -0,0 +1,126 @@
+package command_queue_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/command_queue"
+	"github.com/adobe-platform/porter/constants"
+)
+
+var _ = Describe("Command", func() {
+
+	var (
+		signingKey []byte
+		command    *command_queue.Command
+	)
+
+	BeforeEach(func() {
+		signingKey = command_queue.SigningKey([]byte("secrets key"))
+
+		var err error
+		command, err = command_queue.New(constants.CommandLogLevel, "i-12345678",
+			map[string]string{"level": "debug"})
+		Expect(err).To(BeNil())
+		Expect(command.Id).To(HaveLen(32))
+	})
+
+	It("verifies a signed command after a round trip through SQS", func() {
+		Expect(command.Sign(signingKey)).To(Succeed())
+
+		body, err := command.Marshal()
+		Expect(err).To(BeNil())
+
+		received, err := command_queue.Unmarshal(body)
+		Expect(err).To(BeNil())
+		Expect(received.Name).To(Equal(constants.CommandLogLevel))
+		Expect(received.Args).To(Equal(map[string]string{"level": "debug"}))
+		Expect(received.Verify(signingKey, time.Now())).To(Succeed())
+	})
+
+	It("rejects a command signed with another stack's key", func() {
+		Expect(command.Sign(command_queue.SigningKey([]byte("other key")))).To(Succeed())
+		Expect(command.Verify(signingKey, time.Now())).ToNot(Succeed())
+	})
+
+	It("rejects a command that was changed after it was signed", func() {
+		Expect(command.Sign(signingKey)).To(Succeed())
+		command.InstanceId = "i-87654321"
+		Expect(command.Verify(signingKey, time.Now())).ToNot(Succeed())
+	})
+
+	It("rejects an unsigned command", func() {
+		Expect(command.Verify(signingKey, time.Now())).ToNot(Succeed())
+	})
+
+	It("rejects an expired command", func() {
+		Expect(command.Sign(signingKey)).To(Succeed())
+		Expect(command.Verify(signingKey, time.Now().Add(constants.CommandMaxAge+time.Minute))).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("QueueName", func() {
+
+	It("names the queue after the instance within the environment's prefix", func() {
+		queueName := command_queue.QueueName("svc", "prod", "i-0123456789abcdef0")
+		Expect(queueName).To(Equal("svc-prod-cmd-i-0123456789abcdef0"))
+		Expect(queueName).To(HavePrefix(command_queue.QueueNamePrefix("svc", "prod")))
+	})
+})
+
+var _ = Describe("Handled", func() {
+
+	var (
+		dir  string
+		path string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "handled")
+		Expect(err).To(BeNil())
+		path = filepath.Join(dir, "porter", "commands_handled.json")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("starts empty without a file", func() {
+		handled, err := command_queue.LoadHandled(path)
+		Expect(err).To(BeNil())
+		Expect(handled.Contains("abc")).To(BeFalse())
+	})
+
+	It("remembers a command after porterd restarts", func() {
+		handled, err := command_queue.LoadHandled(path)
+		Expect(err).To(BeNil())
+		Expect(handled.Add("abc", time.Now())).To(Succeed())
+
+		reloaded, err := command_queue.LoadHandled(path)
+		Expect(err).To(BeNil())
+		Expect(reloaded.Contains("abc")).To(BeTrue())
+		Expect(reloaded.Contains("def")).To(BeFalse())
+	})
+
+	It("forgets commands that can no longer verify", func() {
+		handled, err := command_queue.LoadHandled(path)
+		Expect(err).To(BeNil())
+
+		now := time.Now()
+		Expect(handled.Add("old", now.Add(-3*constants.CommandMaxAge))).To(Succeed())
+		Expect(handled.Add("recent", now.Add(-constants.CommandMaxAge))).To(Succeed())
+		Expect(handled.Add("new", now)).To(Succeed())
+
+		reloaded, err := command_queue.LoadHandled(path)
+		Expect(err).To(BeNil())
+		Expect(reloaded.Contains("old")).To(BeFalse())
+		Expect(reloaded.Contains("recent")).To(BeTrue())
+		Expect(reloaded.Contains("new")).To(BeTrue())
+	})
+})
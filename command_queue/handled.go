@@ -0,0 +1,89 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package command_queue
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adobe-platform/porter/constants"
+)
+
+// Handled is the commands an instance has run. SQS delivers at least once so
+// it's saved to disk, that way a command delivered again after porterd
+// restarts isn't run twice
+type Handled struct {
+	path string
+	ids  map[string]time.Time
+}
+
+// LoadHandled reads the commands saved at path. A missing file has none
+func LoadHandled(path string) (*Handled, error) {
+	recv := &Handled{
+		path: path,
+		ids:  make(map[string]time.Time),
+	}
+
+	handledBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return recv, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(handledBytes, &recv.ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return recv, nil
+}
+
+// Contains is true if the command was handled
+func (recv *Handled) Contains(id string) bool {
+	_, exists := recv.ids[id]
+	return exists
+}
+
+// Add saves the command as handled. Commands that can no longer verify are
+// forgotten. Verify allows clock skew either way so that's twice CommandMaxAge
+func (recv *Handled) Add(id string, now time.Time) error {
+	for handledId, handledAt := range recv.ids {
+		if now.Sub(handledAt) > 2*constants.CommandMaxAge {
+			delete(recv.ids, handledId)
+		}
+	}
+	recv.ids[id] = now
+
+	handledBytes, err := json.Marshal(recv.ids)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(recv.path), 0700)
+	if err != nil {
+		return err
+	}
+
+	// rename is atomic so a crash doesn't leave half a file
+	tmpPath := recv.path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, handledBytes, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, recv.path)
+}
@@ -17,10 +17,10 @@ import (
 	"os"
 	"strings"
 
+	"github.com/adobe-platform/porter/aws_session"
 	"github.com/adobe-platform/porter/constants"
 	"github.com/adobe-platform/porter/logger"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/elb"
 	"github.com/phylake/go-cli"
@@ -124,7 +124,7 @@ func (recv *ElbCmd) Execute(args []string) bool {
 func bootstrapELB(elbName, region, sslArn string, subnetIds []string, securityGroupId string) (success bool) {
 	log := logger.CLI()
 
-	session := session.New(aws.NewConfig().WithRegion(region))
+	session := aws_session.New(aws.NewConfig().WithRegion(region))
 	ec2Client := ec2.New(session)
 	elbClient := elb.New(session)
 
@@ -20,10 +20,10 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/adobe-platform/porter/aws_session"
 	"github.com/adobe-platform/porter/constants"
 	"github.com/adobe-platform/porter/logger"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/phylake/go-cli"
 )
@@ -134,66 +134,148 @@ const porterDeploymentPolicy = `{
     {
       "Effect": "Allow",
       "Action": [
+        "autoscaling:CancelInstanceRefresh",
         "autoscaling:CreateAutoScalingGroup",
         "autoscaling:CreateLaunchConfiguration",
         "autoscaling:DeleteAutoScalingGroup",
         "autoscaling:DeleteLaunchConfiguration",
+        "autoscaling:DeletePolicy",
+        "autoscaling:DeleteScheduledAction",
         "autoscaling:DescribeAutoScalingGroups",
+        "autoscaling:DescribeInstanceRefreshes",
         "autoscaling:DescribeLaunchConfigurations",
+        "autoscaling:DescribePolicies",
         "autoscaling:DescribeScalingActivities",
+        "autoscaling:DescribeScheduledActions",
+        "autoscaling:PutScalingPolicy",
+        "autoscaling:PutScheduledUpdateGroupAction",
+        "autoscaling:ResumeProcesses",
+        "autoscaling:StartInstanceRefresh",
+        "autoscaling:SuspendProcesses",
         "autoscaling:UpdateAutoScalingGroup",
         "cloudformation:CreateStack",
         "cloudformation:DeleteStack",
         "cloudformation:DescribeStackEvents",
+        "cloudformation:DescribeStackResourceDrifts",
         "cloudformation:DescribeStackResource",
         "cloudformation:DescribeStackResources",
         "cloudformation:DescribeStacks",
+        "cloudformation:GetTemplate",
         "cloudformation:UpdateStack",
+        "cloudformation:ValidateTemplate",
+        "cloudwatch:DeleteAlarms",
+        "cloudwatch:DeleteDashboards",
+        "cloudwatch:DescribeAlarms",
+        "cloudwatch:GetDashboard",
+        "cloudwatch:PutDashboard",
+        "cloudwatch:PutMetricAlarm",
+        "cloudwatch:PutMetricData",
+        "codebuild:BatchGetBuilds",
+        "codebuild:BatchGetProjects",
+        "codebuild:CreateProject",
+        "codebuild:StartBuild",
         "ec2:AuthorizeSecurityGroupEgress",
         "ec2:AuthorizeSecurityGroupIngress",
+        "ec2:CreateLaunchTemplate",
+        "ec2:CreateLaunchTemplateVersion",
         "ec2:CreateSecurityGroup",
+        "ec2:DeleteLaunchTemplate",
         "ec2:DeleteSecurityGroup",
         "ec2:DescribeAccountAttributes",
         "ec2:DescribeAvailabilityZones",
         "ec2:DescribeInstances",
+        "ec2:DescribeLaunchTemplateVersions",
+        "ec2:DescribeLaunchTemplates",
         "ec2:DescribeSecurityGroups",
         "ec2:DescribeSubnets",
+        "ec2:DescribeVpcs",
+        "ec2:GetConsoleOutput",
         "ec2:RevokeSecurityGroupEgress",
+        "ec2:RunInstances",
+        "ecr:BatchCheckLayerAvailability",
+        "ecr:CompleteLayerUpload",
+        "ecr:CreateRepository",
+        "ecr:DescribeRepositories",
+        "ecr:GetAuthorizationToken",
+        "ecr:InitiateLayerUpload",
+        "ecr:PutImage",
+        "ecr:PutLifecyclePolicy",
+        "ecr:UploadLayerPart",
         "elasticloadbalancing:AddTags",
         "elasticloadbalancing:ConfigureHealthCheck",
         "elasticloadbalancing:CreateLoadBalancer",
         "elasticloadbalancing:DeleteLoadBalancer",
+        "elasticloadbalancing:DeleteTargetGroup",
         "elasticloadbalancing:DeregisterInstancesFromLoadBalancer",
         "elasticloadbalancing:DescribeInstanceHealth",
         "elasticloadbalancing:DescribeLoadBalancers",
         "elasticloadbalancing:DescribeTags",
+        "elasticloadbalancing:DescribeTargetHealth",
         "elasticloadbalancing:ModifyLoadBalancerAttributes",
         "elasticloadbalancing:RegisterInstancesWithLoadBalancer",
         "elasticloadbalancing:SetLoadBalancerPoliciesOfListener",
         "iam:AddRoleToInstanceProfile",
+        "iam:AttachRolePolicy",
         "iam:CreateInstanceProfile",
         "iam:CreateRole",
         "iam:DeleteInstanceProfile",
         "iam:DeleteRole",
         "iam:DeleteRolePolicy",
+        "iam:DetachRolePolicy",
+        "iam:GetRole",
         "iam:PassRole",
         "iam:PutRolePolicy",
         "iam:RemoveRoleFromInstanceProfile",
+        "iam:SimulatePrincipalPolicy",
+        "kms:CreateGrant",
         "kms:Decrypt",
+        "kms:DescribeKey",
         "kms:Encrypt",
         "kms:GenerateDataKey",
+        "kms:GetKeyPolicy",
+        "kms:ListGrants",
+        "kms:RevokeGrant",
+        "logs:CreateLogGroup",
+        "logs:CreateLogStream",
+        "logs:DeleteLogGroup",
+        "logs:FilterLogEvents",
+        "logs:PutLogEvents",
+        "logs:PutRetentionPolicy",
         "route53:ChangeResourceRecordSets",
+        "route53:ChangeTagsForResource",
+        "route53:CreateHealthCheck",
+        "route53:DeleteHealthCheck",
         "route53:GetChange",
+        "route53:GetHealthCheck",
         "route53:ListHostedZones",
+        "route53:ListHostedZonesByName",
         "route53:ListResourceRecordSets",
+        "route53:UpdateHealthCheck",
         "s3:GetObject",
         "s3:ListBucket",
         "s3:PutObject",
+        "secretsmanager:GetSecretValue",
+        "sns:CreateTopic",
+        "sns:DeleteTopic",
+        "sns:GetTopicAttributes",
         "sqs:CreateQueue",
+        "sqs:DeleteMessage",
         "sqs:DeleteQueue",
         "sqs:GetQueueAttributes",
         "sqs:GetQueueUrl",
-        "sqs:ReceiveMessage"
+        "sqs:ListQueues",
+        "sqs:ReceiveMessage",
+        "sqs:SendMessage",
+        "ssm:AddTagsToResource",
+        "ssm:DeleteParameter",
+        "ssm:GetCommandInvocation",
+        "ssm:GetParameter",
+        "ssm:GetParameters",
+        "ssm:PutParameter",
+        "ssm:SendCommand",
+        "ssm:StartSession",
+        "ssm:TerminateSession",
+        "tag:GetResources"
       ],
       "Resource": [
         "*"
@@ -212,7 +294,7 @@ func bootstrapIAM(roleName string, assumeRoleARNs []string) (success bool) {
 		AssumeRoleARNs: strings.Join(assumeRoleARNs, ","),
 	}
 
-	client := iam.New(session.New(aws.NewConfig()))
+	client := iam.New(aws_session.New(aws.NewConfig()))
 
 	temp, err := template.New("").Parse(string(trustPolicy))
 	if err != nil {
@@ -323,6 +405,13 @@ const trustPolicy = `{
         "AWS": [{{.AssumeRoleARNs}}]
       },
       "Action": "sts:AssumeRole"
+    },
+    {
+      "Effect": "Allow",
+      "Principal": {
+        "Service": "codebuild.amazonaws.com"
+      },
+      "Action": "sts:AssumeRole"
     }
   ]
 }`
@@ -16,10 +16,10 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/adobe-platform/porter/aws_session"
 	"github.com/adobe-platform/porter/constants"
 	"github.com/adobe-platform/porter/logger"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/phylake/go-cli"
 )
@@ -116,7 +116,7 @@ func bootstrapS3(bucketPrefix string) {
 	log := logger.CLI()
 
 	for region := range constants.AwsRegions {
-		client := s3.New(session.New(aws.NewConfig().WithRegion(region)))
+		client := s3.New(aws_session.New(aws.NewConfig().WithRegion(region)))
 
 		bucketName := strings.TrimSuffix(bucketPrefix, "-") + "-" + region
 
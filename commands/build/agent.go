@@ -0,0 +1,263 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/adobe-platform/porter/aws/ssm"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/phylake/go-cli"
+)
+
+type AgentCmd struct{}
+
+type agentRequest struct {
+	method string
+	path   string
+}
+
+func (recv *AgentCmd) Name() string {
+	return "agent"
+}
+
+func (recv *AgentCmd) ShortHelp() string {
+	return "Call the host agent of a stack's instances"
+}
+
+func (recv *AgentCmd) LongHelp() string {
+	return `NAME
+    agent -- Call the host agent of a stack's instances
+
+SYNOPSIS
+    agent -e <environment> [-r <region>] [--instance <instance id>] health
+    agent -e <environment> [-r <region>] [--instance <instance id>] versions
+    agent -e <environment> [-r <region>] [--instance <instance id>] restart <container>
+    agent -e <environment> [-r <region>] [--instance <instance id>] pull
+
+DESCRIPTION
+    porterd runs a host agent on every instance that only listens on
+    ` + constants.PorterAgentBindAddr + `. agent calls it on the in service instances
+    of the environment's current stack with an SSM Run Command, which needs
+    the SSM agent registered like access ssm does, and prints each instance's
+    response.
+
+    The stack is the latest provisioned or promoted deploy of the region in
+    the state store.
+
+    health
+        The state and HEALTHCHECK status of the service's containers and the
+        outcome of the last pull. agent fails if an instance isn't healthy
+
+    versions
+        The porter and docker versions and the image of each container
+
+    restart <container>
+        Restart the containers with the name in .porter/config
+
+    pull
+        Download the service payload and secrets again. The pull finishes in
+        the background. Check its outcome with health
+
+OPTIONS
+    -e, --environment
+        Environment from .porter/config
+
+    -r, --region
+        The stack's region. Required when the environment has more than one
+        region
+
+    --instance
+        Only call the agent of this instance`
+}
+
+func (recv *AgentCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *AgentCmd) Execute(args []string) bool {
+
+	if len(args) > 0 {
+		var env, region, instanceId string
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&env, "e", "", "")
+		flagSet.StringVar(&env, "environment", "", "")
+		flagSet.StringVar(&region, "r", "", "")
+		flagSet.StringVar(&region, "region", "", "")
+		flagSet.StringVar(&instanceId, "instance", "", "")
+		flagSet.Usage = func() {
+			fmt.Println(recv.LongHelp())
+		}
+		flagSet.Parse(args)
+
+		if env == "" || flagSet.NArg() == 0 {
+			return false
+		}
+
+		var request agentRequest
+
+		switch flagSet.Arg(0) {
+		case "health":
+			request = agentRequest{"GET", constants.PorterAgentHealthPath}
+		case "versions":
+			request = agentRequest{"GET", constants.PorterAgentVersionsPath}
+		case "restart":
+			if flagSet.NArg() != 2 {
+				return false
+			}
+			request = agentRequest{"POST", strings.Replace(constants.PorterAgentRestartPath,
+				":name", url.PathEscape(flagSet.Arg(1)), 1)}
+		case "pull":
+			request = agentRequest{"POST", constants.PorterAgentPayloadPath}
+		default:
+			return false
+		}
+
+		if !callAgent(env, region, instanceId, request) {
+			os.Exit(1)
+		}
+		return true
+	}
+
+	return false
+}
+
+func callAgent(env, region, instanceId string, request agentRequest) (success bool) {
+	log := logger.CLI("cmd", "agent")
+
+	config, getConfigSuccess := conf.GetConfig(log, true)
+	if !getConfigSuccess {
+		return
+	}
+
+	environment, err := config.GetEnvironment(env)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	if environment.Compute == conf.Compute_ECS {
+		log.Error("agent doesn't support ecs")
+		return
+	}
+
+	region, ok := defaultRegion(log, environment, region)
+	if !ok {
+		return
+	}
+	log = log.New("Region", region)
+
+	stackId, ok := currentStackId(log, config, environment, region)
+	if !ok {
+		return
+	}
+	log = log.New("StackId", stackId)
+
+	roleSession, ok := refreshRoleSession(log, environment, region)
+	if !ok {
+		return
+	}
+
+	instanceIds, ok := inServiceInstanceIds(log, roleSession, stackId)
+	if !ok {
+		return
+	}
+
+	if instanceId != "" {
+		found := false
+		for _, id := range instanceIds {
+			if id == instanceId {
+				found = true
+				break
+			}
+		}
+		if !found {
+			log.Error("The instance isn't in service in the stack", "InstanceId", instanceId)
+			return
+		}
+		instanceIds = []string{instanceId}
+	}
+
+	if len(instanceIds) == 0 {
+		log.Error("The stack has no instances in service")
+		return
+	}
+
+	client := ssm.New(roleSession)
+
+	log.Info("ssm:SendCommand", "Method", request.method, "Path", request.path)
+	sendOutput, err := client.SendCommand(&ssm.SendCommandInput{
+		InstanceIds:  instanceIds,
+		DocumentName: "AWS-RunShellScript",
+		Comment:      "porter agent",
+		Parameters: map[string][]string{
+			"commands": {agentScript(request)},
+		},
+	})
+	if err != nil {
+		log.Error("ssm:SendCommand", "Error", err)
+		return
+	}
+	commandId := sendOutput.Command.CommandId
+
+	success = true
+
+	for _, id := range instanceIds {
+		instanceLog := log.New("InstanceId", id)
+
+		output, ok := waitForCommand(instanceLog, client, commandId, id)
+		if !ok {
+			success = false
+			continue
+		}
+
+		status, body := parseAgentResponse(output)
+		fmt.Printf("%s %d\n", id, status)
+		if body != "" {
+			fmt.Println(body)
+		}
+
+		if status < 200 || status > 299 {
+			instanceLog.Error("The agent's response isn't successful", "Status", status)
+			success = false
+		}
+	}
+
+	return
+}
+
+// agentScript prints the agent's response body followed by its status code on
+// the last line
+func agentScript(request agentRequest) string {
+	return fmt.Sprintf(`curl -sS -X %s -w '\n%%{http_code}' %s`, request.method,
+		shellQuote("http://"+constants.PorterAgentBindAddr+request.path))
+}
+
+// parseAgentResponse reads the output of agentScript. The status is 0 if the
+// output doesn't end with one
+func parseAgentResponse(output string) (status int, body string) {
+	output = strings.TrimRight(output, "\n")
+
+	i := strings.LastIndex(output, "\n")
+	status, _ = strconv.Atoi(output[i+1:])
+	if i >= 0 {
+		body = strings.TrimSpace(output[:i])
+	}
+	return
+}
@@ -0,0 +1,192 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/phylake/go-cli"
+)
+
+type (
+	ArtifactBuildCmd  struct{}
+	ArtifactDeployCmd struct{}
+)
+
+func (recv *ArtifactBuildCmd) Name() string {
+	return "build"
+}
+
+func (recv *ArtifactBuildCmd) ShortHelp() string {
+	return "Pack a service payload into an artifact that can be deployed anywhere"
+}
+
+func (recv *ArtifactBuildCmd) LongHelp() string {
+	return `NAME
+    build -- Pack a service payload into an artifact that can be deployed anywhere
+
+SYNOPSIS
+    build -o <artifact directory>
+
+DESCRIPTION
+    Run pack and copy the service payload and the config it was packed with
+    into the artifact directory along with a ` + constants.ArtifactManifestFile + ` describing
+    them.
+
+    The directory can be stored by CI and deployed to any environment, in any
+    account, with porter artifact deploy. Every environment gets the exact
+    payload that was built instead of one packed again from the same commit.
+
+OPTIONS
+    -o
+        The directory to write the artifact to. It's created if it doesn't
+        exist.`
+}
+
+func (recv *ArtifactBuildCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *ArtifactBuildCmd) Execute(args []string) bool {
+
+	if len(args) > 0 {
+		var dir string
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&dir, "o", "", "")
+		flagSet.Usage = func() {
+			fmt.Println(recv.LongHelp())
+		}
+		flagSet.Parse(args)
+
+		if dir == "" {
+			return false
+		}
+
+		log := logger.CLI("cmd", "artifact-build")
+
+		config, success := pack(log)
+		if !success {
+			os.Exit(1)
+		}
+
+		manifestPath, success := provision.WriteArtifact(log, config, dir)
+		if !success {
+			os.Exit(1)
+		}
+
+		log.Info("Built artifact", "Manifest", manifestPath, "ServiceVersion", config.ServiceVersion)
+		return true
+	}
+
+	return false
+}
+
+func (recv *ArtifactDeployCmd) Name() string {
+	return "deploy"
+}
+
+func (recv *ArtifactDeployCmd) ShortHelp() string {
+	return "Deploy an artifact to an environment"
+}
+
+func (recv *ArtifactDeployCmd) LongHelp() string {
+	return `NAME
+    deploy -- Deploy an artifact to an environment
+
+SYNOPSIS
+    deploy --manifest <path to ` + constants.ArtifactManifestFile + `> -e <environment out of the artifact's config> [-keep <stacks to keep>] [--force-unlock] [--timeout <duration>] [--rollback] [--yes]
+
+DESCRIPTION
+    Check the artifact built by porter artifact build matches its manifest
+    then deploy it like porter deploy. Nothing is packed so the checkout
+    doesn't need to be the commit the artifact was built from.
+
+    The environment comes from the config the artifact was packed with, not
+    .porter/config. The artifact must be deployed with the version of porter
+    that built it.
+
+OPTIONS
+    --manifest
+        The manifest of the artifact. Its payload and config are expected next
+        to it.
+
+    -keep
+        The number of stacks prune keeps. See prune --help
+
+    --force-unlock
+        Release the environment's lock before deploying. Use this when the
+        build holding the lock died without releasing it.
+
+    --timeout
+        How long the whole deploy has to finish. See deploy --help
+
+    --rollback
+        Roll back in-progress stack updates and instance refreshes when the
+        deploy stops. See deploy --help
+
+    --yes
+        Skip the environment's confirm prompt. See deploy --help`
+}
+
+func (recv *ArtifactDeployCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *ArtifactDeployCmd) Execute(args []string) bool {
+
+	if len(args) > 0 {
+		var manifestPath, environment string
+		var keepCount int
+		var forceUnlock, rollback, yes bool
+		var timeout time.Duration
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&manifestPath, "manifest", "", "")
+		flagSet.StringVar(&environment, "e", "", "")
+		flagSet.IntVar(&keepCount, "keep", 0, "")
+		flagSet.BoolVar(&forceUnlock, "force-unlock", false, "")
+		flagSet.DurationVar(&timeout, "timeout", 0, "")
+		flagSet.BoolVar(&rollback, "rollback", false, "")
+		flagSet.BoolVar(&yes, "yes", false, "")
+		flagSet.Usage = func() {
+			fmt.Println(recv.LongHelp())
+		}
+		flagSet.Parse(args)
+
+		if manifestPath == "" || keepCount < 0 || timeout < 0 {
+			return false
+		}
+
+		log := logger.CLI("cmd", "artifact-deploy")
+
+		manifest, success := provision.RestoreArtifact(log, manifestPath)
+		if !success {
+			os.Exit(1)
+		}
+
+		log.Info("Deploying artifact",
+			"ServiceVersion", manifest.ServiceVersion,
+			"PayloadChecksum", manifest.PayloadChecksum)
+
+		if !deploy(environment, keepCount, false, forceUnlock, timeout, rollback, yes, false) {
+			os.Exit(1)
+		}
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,343 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/inconshreveable/log15"
+	"github.com/phylake/go-cli"
+)
+
+type (
+	AsgSuspendCmd struct{}
+	AsgResumeCmd  struct{}
+)
+
+var scalingProcesses = map[string]struct{}{
+	"Launch":            {},
+	"Terminate":         {},
+	"HealthCheck":       {},
+	"ReplaceUnhealthy":  {},
+	"AZRebalance":       {},
+	"AlarmNotification": {},
+	"ScheduledActions":  {},
+	"AddToLoadBalancer": {},
+}
+
+func (recv *AsgSuspendCmd) Name() string {
+	return "suspend"
+}
+
+func (recv *AsgSuspendCmd) ShortHelp() string {
+	return "Suspend autoscaling processes of an environment's stacks"
+}
+
+func (recv *AsgSuspendCmd) LongHelp() string {
+	return `NAME
+    suspend -- Suspend autoscaling processes of an environment's stacks
+
+SYNOPSIS
+    suspend -e <environment> [-r <region>] [-p <process>,...] [--yes]
+
+DESCRIPTION
+    Suspend processes of the autoscaling groups of the environment's current
+    stacks until porter asg resume is run. Processes suspended this way stay
+    suspended through hot swaps.
+
+OPTIONS
+    -e
+        Environment from .porter/config
+
+    -r
+        Only suspend processes in this region
+
+    -p
+        Comma separated processes. Defaults to ` + strings.Join(provision.DeployProcesses, ",") + `
+
+    --yes
+        Skip the environment's confirm prompt. See porter build deploy --help`
+}
+
+func (recv *AsgSuspendCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *AsgSuspendCmd) Execute(args []string) bool {
+	return asgProcessesExecute(args, recv.LongHelp(), true)
+}
+
+func (recv *AsgResumeCmd) Name() string {
+	return "resume"
+}
+
+func (recv *AsgResumeCmd) ShortHelp() string {
+	return "Resume autoscaling processes of an environment's stacks"
+}
+
+func (recv *AsgResumeCmd) LongHelp() string {
+	return `NAME
+    resume -- Resume autoscaling processes of an environment's stacks
+
+SYNOPSIS
+    resume -e <environment> [-r <region>] [-p <process>,...] [--yes]
+
+DESCRIPTION
+    Resume processes of the autoscaling groups of the environment's current
+    stacks. Use it after porter asg suspend or if a deploy was killed before
+    it could resume the processes it suspended.
+
+OPTIONS
+    -e
+        Environment from .porter/config
+
+    -r
+        Only resume processes in this region
+
+    -p
+        Comma separated processes. Defaults to ` + strings.Join(provision.DeployProcesses, ",") + `
+
+    --yes
+        Skip the environment's confirm prompt. See porter build deploy --help`
+}
+
+func (recv *AsgResumeCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *AsgResumeCmd) Execute(args []string) bool {
+	return asgProcessesExecute(args, recv.LongHelp(), false)
+}
+
+func asgProcessesExecute(args []string, longHelp string, suspend bool) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	var env, region, processCSV string
+	var yes bool
+	flagSet := flag.NewFlagSet("", flag.ExitOnError)
+	flagSet.StringVar(&env, "e", "", "")
+	flagSet.StringVar(&region, "r", "", "")
+	flagSet.StringVar(&processCSV, "p", strings.Join(provision.DeployProcesses, ","), "")
+	flagSet.BoolVar(&yes, "yes", false, "")
+	flagSet.Usage = func() {
+		fmt.Println(longHelp)
+	}
+	flagSet.Parse(args)
+
+	if env == "" {
+		return false
+	}
+
+	processes := strings.Split(processCSV, ",")
+	for _, process := range processes {
+		if _, exists := scalingProcesses[process]; !exists {
+			fmt.Printf("Invalid process %s\n", process)
+			return false
+		}
+	}
+
+	if !changeAsgProcesses(env, region, processes, suspend, yes) {
+		os.Exit(1)
+	}
+	return true
+}
+
+func changeAsgProcesses(env, region string, processes []string, suspend, yes bool) (success bool) {
+	log := logger.CLI("cmd", "asg")
+
+	config, getConfigSuccess := conf.GetConfig(log, true)
+	if !getConfigSuccess {
+		return
+	}
+
+	environment, err := config.GetEnvironment(env)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	if !confirmEnvironment(log, environment, yes) {
+		return
+	}
+
+	deployments, err := provision.GetStateStore(config).List(config.ServiceName, environment.Name)
+	if err != nil {
+		log.Error("State store List", "Error", err)
+		return
+	}
+
+	changed := 0
+	for _, deployment := range deployments {
+
+		if region != "" && deployment.Region != region {
+			continue
+		}
+
+		regionLog := log.New("Region", deployment.Region, "StackId", deployment.StackId)
+
+		switch deployment.Status {
+		case provision_state.StatusProvisioned, provision_state.StatusPromoted:
+		default:
+			regionLog.Warn("Skipping region whose latest deploy isn't provisioned", "Status", deployment.Status)
+			continue
+		}
+
+		roleSession, ok := refreshRoleSession(regionLog, environment, deployment.Region)
+		if !ok {
+			return
+		}
+
+		var queueUrl string
+		var asgNames []string
+		if !getQueueUrlAndAsgNames(regionLog, roleSession, deployment.StackId, &queueUrl, &asgNames) {
+			return
+		}
+
+		if suspend {
+			if _, ok = provision.SuspendProcesses(regionLog, roleSession, asgNames, processes); !ok {
+				return
+			}
+		} else {
+			groupProcesses := make(map[string][]string)
+			for _, asgName := range asgNames {
+				groupProcesses[asgName] = processes
+			}
+
+			if !provision.ResumeProcesses(regionLog, roleSession, groupProcesses) {
+				return
+			}
+		}
+		changed++
+	}
+
+	if changed == 0 {
+		log.Error("No region was changed")
+		return
+	}
+
+	success = true
+	return
+}
+
+// suspendDeployProcesses suspends provision.DeployProcesses on the stack's
+// autoscaling groups in every region. resume puts back only what was
+// suspended and is safe to call if suspending failed part way
+func suspendDeployProcesses(log log15.Logger, environment *conf.Environment,
+	stack provision_state.Stack) (resume func(), success bool) {
+
+	type regionSuspended struct {
+		log       log15.Logger
+		region    string
+		suspended map[string][]string
+	}
+	all := make([]regionSuspended, 0)
+
+	resume = func() {
+		for _, regionSuspended := range all {
+			roleSession, ok := refreshRoleSession(regionSuspended.log, environment, regionSuspended.region)
+			if !ok {
+				continue
+			}
+
+			if !provision.ResumeProcesses(regionSuspended.log, roleSession, regionSuspended.suspended) {
+				regionSuspended.log.Error("Run porter asg resume to resume the processes")
+			}
+		}
+	}
+
+	for regionName, regionState := range stack.Regions {
+		log := log.New("Region", regionName)
+
+		roleSession, ok := refreshRoleSession(log, environment, regionName)
+		if !ok {
+			return
+		}
+
+		var queueUrl string
+		var asgNames []string
+		if !getQueueUrlAndAsgNames(log, roleSession, regionState.StackId, &queueUrl, &asgNames) {
+			return
+		}
+
+		suspended, ok := provision.SuspendProcesses(log, roleSession, asgNames, provision.DeployProcesses)
+		all = append(all, regionSuspended{log, regionName, suspended})
+		if !ok {
+			return
+		}
+	}
+
+	success = true
+	return
+}
+
+// suspendNewDeployProcesses suspends provision.DeployProcesses on the
+// autoscaling groups CloudFormation has created so far in a stack that's being
+// created. Groups in seen are skipped and what's suspended is added to
+// suspended so it can be called on every poll
+func suspendNewDeployProcesses(log log15.Logger, roleSession *session.Session, stackId string,
+	seen map[string]struct{}, suspended map[string][]string) (success bool) {
+
+	cfnClient := cloudformation.New(roleSession)
+
+	output, err := cfnClient.DescribeStackResources(&cloudformation.DescribeStackResourcesInput{
+		StackName: aws.String(stackId),
+	})
+	if err != nil {
+		log.Error("cloudformation:DescribeStackResources", "Error", err)
+		return
+	}
+
+	asgNames := make([]string, 0)
+	for _, stackResource := range output.StackResources {
+		// a group doesn't have a name until CloudFormation creates it
+		if aws.StringValue(stackResource.ResourceType) != cfn.AutoScaling_AutoScalingGroup ||
+			aws.StringValue(stackResource.PhysicalResourceId) == "" {
+			continue
+		}
+
+		asgName := *stackResource.PhysicalResourceId
+		if _, exists := seen[asgName]; exists {
+			continue
+		}
+		seen[asgName] = struct{}{}
+		asgNames = append(asgNames, asgName)
+	}
+
+	if len(asgNames) == 0 {
+		success = true
+		return
+	}
+
+	groupProcesses, ok := provision.SuspendProcesses(log, roleSession, asgNames, provision.DeployProcesses)
+	for asgName, processes := range groupProcesses {
+		suspended[asgName] = processes
+	}
+	if !ok {
+		return
+	}
+
+	success = true
+	return
+}
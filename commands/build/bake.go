@@ -0,0 +1,118 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/phylake/go-cli"
+)
+
+type BakeCmd struct{}
+
+func (recv *BakeCmd) Name() string {
+	return "bake"
+}
+
+func (recv *BakeCmd) ShortHelp() string {
+	return "Bake an AMI with the packages instances install while they boot"
+}
+
+func (recv *BakeCmd) LongHelp() string {
+	return `NAME
+    bake -- Bake an AMI with the packages instances install while they boot
+
+SYNOPSIS
+    bake --environment <environment out of .porter/config>
+
+DESCRIPTION
+    Launch a builder instance in each region of the environment, install the
+    packages and porter binary instances otherwise install while they boot,
+    and make an AMI of it. The builder instance is terminated when the AMI is
+    available.
+
+    With images: true in the environment's bake block the service's images
+    are loaded from the service payload too and hotswap skips loading images
+    the AMI already has. Run after porter build pack.
+
+    The AMI is tagged with the service and environment. Provision launches
+    the newest one with
+
+        ami:
+          baked: true
+
+OPTIONS
+    -e, --environment
+        Environment from .porter/config`
+}
+
+func (recv *BakeCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *BakeCmd) Execute(args []string) bool {
+
+	if len(args) > 0 {
+		var environment string
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&environment, "e", "", "")
+		flagSet.StringVar(&environment, "environment", "", "")
+		flagSet.Usage = func() {
+			fmt.Println(recv.LongHelp())
+		}
+		flagSet.Parse(args)
+
+		if environment == "" {
+			return false
+		}
+
+		if !bake(environment) {
+			os.Exit(1)
+		}
+		return true
+	}
+
+	return false
+}
+
+func bake(env string) (success bool) {
+	log := logger.CLI("cmd", "bake")
+
+	var (
+		config           *conf.Config
+		getConfigSuccess bool
+	)
+
+	if _, err := os.Stat(constants.AlteredConfigPath); err == nil {
+		config, getConfigSuccess = conf.GetAlteredConfig(log)
+	} else {
+		config, getConfigSuccess = conf.GetConfig(log, true)
+	}
+	if !getConfigSuccess {
+		return
+	}
+
+	environment, err := config.GetEnvironment(env)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	success = provision.Bake(log, config, environment)
+	return
+}
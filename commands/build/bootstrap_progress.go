@@ -0,0 +1,90 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"sync"
+	"time"
+
+	"github.com/adobe-platform/porter/bootstrap_progress"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inconshreveable/log15"
+)
+
+// watchBootstrapProgress logs the bootstrap milestones instances report while
+// a stack is created. The returned func stops watching, records when the
+// region's first instance was healthy for the deploy SLO report and, if the
+// stack failed, logs the last milestone each instance reached
+func watchBootstrapProgress(log log15.Logger, roleSession *session.Session,
+	regionName, stackId string) func(stackFailed bool) {
+
+	var (
+		watcher *bootstrap_progress.Watcher
+		lock    sync.Mutex
+	)
+
+	done := make(chan struct{})
+	cfnClient := cloudformation.New(roleSession)
+
+	// the queue doesn't exist until CloudFormation creates it
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(sleepDuration):
+			}
+
+			output, err := cfnClient.DescribeStackResource(&cloudformation.DescribeStackResourceInput{
+				LogicalResourceId: aws.String(constants.ProgressQueue),
+				StackName:         aws.String(stackId),
+			})
+			if err != nil || output.StackResourceDetail.PhysicalResourceId == nil {
+				log.Debug("Progress queue not created yet", "Error", err)
+				continue
+			}
+
+			lock.Lock()
+			select {
+			case <-done:
+			default:
+				watcher = bootstrap_progress.NewWatcher(log, sqs.New(roleSession),
+					*output.StackResourceDetail.PhysicalResourceId)
+				watcher.Start()
+			}
+			lock.Unlock()
+			return
+		}
+	}()
+
+	return func(stackFailed bool) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		close(done)
+
+		if watcher == nil {
+			return
+		}
+
+		watcher.Stop()
+		recordFirstHealthy(regionName, watcher.FirstHealthy())
+
+		if stackFailed {
+			watcher.LogSummary()
+		}
+	}
+}
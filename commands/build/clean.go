@@ -12,7 +12,7 @@
 package build
 
 import (
-	"os/exec"
+	"os"
 
 	"github.com/adobe-platform/porter/constants"
 	"github.com/phylake/go-cli"
@@ -37,7 +37,7 @@ func (recv *CleanCmd) SubCommands() []cli.Command {
 }
 
 func (recv *CleanCmd) Execute(args []string) bool {
-	err := exec.Command("rm", "-fr", constants.TempDir).Run()
+	err := os.RemoveAll(constants.TempDir)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,224 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/inconshreveable/log15"
+)
+
+const (
+	// a ticket that isn't renewed for this long belongs to a dead deploy
+	deploySlotLease = 2 * time.Minute
+	deploySlotRenew = 30 * time.Second
+	deploySlotPoll  = 15 * time.Second
+
+	defaultDeploySlotMaxWait = 1 * time.Hour
+)
+
+// acquireDeploySlots waits for a slot in the deploy_concurrency semaphore of
+// every account and region the environment deploys to. Slots are acquired in
+// the same order by every deploy so two deploys can't each hold a slot the
+// other is waiting for. release must be called when the deploy is done
+func acquireDeploySlots(log log15.Logger, config *conf.Config, environment *conf.Environment,
+	lock *provision_state.Lock) (release func(), success bool) {
+
+	release = func() {}
+
+	concurrency := config.DeployConcurrency
+	if concurrency == nil {
+		success = true
+		return
+	}
+
+	semaphoreSession := aws_session.Get(concurrency.Region)
+	if concurrency.RoleARN != "" {
+		semaphoreSession = aws_session.STS(concurrency.Region, concurrency.RoleARN, 0)
+	}
+	semaphore := provision_state.NewSemaphore(semaphoreSession, concurrency.DynamoDBTable, concurrency.Limit)
+
+	keySet := make(map[string]bool)
+	for _, region := range environment.Regions {
+		roleARN, err := environment.GetRoleARN(region.Name)
+		if err != nil {
+			log.Error("GetRoleARN", "Error", err)
+			return
+		}
+
+		arnParts := strings.Split(roleARN, ":")
+		if len(arnParts) < 5 {
+			log.Error("Invalid role_arn", "Region", region.Name, "RoleARN", roleARN)
+			return
+		}
+
+		keySet[provision_state.SemaphoreKey(arnParts[4], region.Name)] = true
+	}
+
+	keys := make([]string, 0, len(keySet))
+	for key := range keySet {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	maxWait := defaultDeploySlotMaxWait
+	if concurrency.MaxWait > 0 {
+		maxWait = time.Duration(concurrency.MaxWait) * time.Second
+	}
+	deadline := time.Now().Add(maxWait)
+
+	var (
+		tickets     []*provision_state.Ticket
+		ticketsLock sync.Mutex
+		stopRenew   = make(chan struct{})
+	)
+
+	// tickets are renewed while waiting and while the deploy runs
+	go func() {
+		ticker := time.NewTicker(deploySlotRenew)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopRenew:
+				return
+			case <-ticker.C:
+			}
+
+			ticketsLock.Lock()
+			for _, ticket := range tickets {
+				ticket.ExpiresAt = time.Now().Add(deploySlotLease)
+				if err := semaphore.Put(ticket); err != nil {
+					log.Warn("Failed to renew deploy slot", "Semaphore", ticket.Key, "Error", err)
+				}
+			}
+			ticketsLock.Unlock()
+		}
+	}()
+
+	release = func() {
+		close(stopRenew)
+
+		ticketsLock.Lock()
+		defer ticketsLock.Unlock()
+
+		for _, ticket := range tickets {
+			if err := semaphore.Release(ticket); err != nil {
+				log.Warn("Failed to release deploy slot. It expires on its own",
+					"Semaphore", ticket.Key,
+					"ExpiresAt", ticket.ExpiresAt.Format(time.RFC3339),
+					"Error", err)
+				continue
+			}
+			log.Info("Released deploy slot", "Semaphore", ticket.Key)
+		}
+	}
+
+	host := lock.Host
+	for _, key := range keys {
+		now := time.Now()
+		ticket := &provision_state.Ticket{
+			Id:          lock.Id,
+			Key:         key,
+			ServiceName: lock.ServiceName,
+			Environment: lock.Environment,
+			Host:        host,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(deploySlotLease),
+		}
+
+		ticketsLock.Lock()
+		err := semaphore.Put(ticket)
+		if err == nil {
+			tickets = append(tickets, ticket)
+		}
+		ticketsLock.Unlock()
+		if err != nil {
+			log.Error("Failed to get in line for a deploy slot", "Semaphore", key, "Error", err)
+			release()
+			return
+		}
+
+		if !waitForDeploySlot(log, semaphore, ticket, &ticketsLock, deadline) {
+			release()
+			return
+		}
+	}
+
+	success = true
+	return
+}
+
+// waitForDeploySlot polls the line until the ticket holds a slot, reporting
+// its position as it moves up
+func waitForDeploySlot(log log15.Logger, semaphore *provision_state.Semaphore,
+	ticket *provision_state.Ticket, ticketsLock *sync.Mutex, deadline time.Time) bool {
+
+	log = log.New("Semaphore", ticket.Key, "Limit", semaphore.Limit)
+	lastPosition := -1
+
+	for {
+		line, err := semaphore.List(ticket.Key)
+		if err != nil {
+			log.Error("Failed to list the deploy line", "Error", err)
+			return false
+		}
+
+		position, expired, found := provision_state.Position(line, ticket.Id, semaphore.Limit, time.Now())
+
+		for _, expiredTicket := range expired {
+			log.Warn("Removing an expired deploy slot",
+				"ServiceName", expiredTicket.ServiceName,
+				"Environment", expiredTicket.Environment,
+				"Host", expiredTicket.Host)
+			semaphore.Release(expiredTicket)
+		}
+
+		if !found {
+			// renewing failed long enough for the ticket to expire. Getting
+			// back in line with the same ticket keeps its place
+			ticketsLock.Lock()
+			ticket.ExpiresAt = time.Now().Add(deploySlotLease)
+			err = semaphore.Put(ticket)
+			ticketsLock.Unlock()
+			if err != nil {
+				log.Error("Failed to get back in line for a deploy slot", "Error", err)
+				return false
+			}
+			continue
+		}
+
+		if position == 0 {
+			log.Info("Acquired deploy slot")
+			return true
+		}
+
+		if position != lastPosition {
+			log.Info("Waiting for a deploy slot", "Position", position)
+			lastPosition = position
+		}
+
+		if time.Now().After(deadline) {
+			log.Error("Gave up waiting for a deploy slot. Raise deploy_concurrency max_wait to wait longer",
+				"Position", position)
+			return false
+		}
+
+		time.Sleep(deploySlotPoll)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/phylake/go-cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type ConfigCheckUpgradeCmd struct{}
+
+func (recv *ConfigCheckUpgradeCmd) Name() string {
+	return "check-upgrade"
+}
+
+func (recv *ConfigCheckUpgradeCmd) ShortHelp() string {
+	return "Report config fields that break on the next porter major"
+}
+
+func (recv *ConfigCheckUpgradeCmd) LongHelp() string {
+	return `NAME
+    check-upgrade -- Report config fields that break on the next porter major
+
+SYNOPSIS
+    check-upgrade [-major <porter major>]
+
+DESCRIPTION
+    Find the deprecated fields set in .porter/config and print where each one
+    is and what to replace it with.
+
+    Fields that stop working in the target major or earlier are breaking and
+    make check-upgrade exit non-zero so it can run as a CI step. Fields removed
+    in a later major are listed as warnings.
+
+    Deprecated fields are also logged as warnings whenever a command reads
+    .porter/config.
+
+OPTIONS
+    -major
+        The porter major to check against. Defaults to the major after
+        porter_version.`
+}
+
+func (recv *ConfigCheckUpgradeCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *ConfigCheckUpgradeCmd) Execute(args []string) bool {
+	var major int
+	flagSet := flag.NewFlagSet("", flag.ExitOnError)
+	flagSet.IntVar(&major, "major", 0, "")
+	flagSet.Usage = func() {
+		fmt.Println(recv.LongHelp())
+	}
+	flagSet.Parse(args)
+
+	if major < 0 {
+		return false
+	}
+
+	if !checkUpgrade(major) {
+		os.Exit(1)
+	}
+	return true
+}
+
+func checkUpgrade(major int) (success bool) {
+	log := logger.CLI("cmd", "config-check-upgrade")
+
+	configBytes, err := ioutil.ReadFile(constants.ConfigPath)
+	if err != nil {
+		log.Error("Failed to read "+constants.ConfigPath, "Error", err)
+		return
+	}
+
+	if major == 0 {
+		config := &conf.Config{}
+		err = yaml.Unmarshal(configBytes, config)
+		if err != nil {
+			log.Error("Failed to decode config", "Error", err)
+			return
+		}
+
+		if config.PorterMajor() == 0 {
+			log.Error("porter_version isn't set. Pass -major")
+			return
+		}
+		major = config.PorterMajor() + 1
+	}
+
+	fields, err := conf.FindDeprecations(configBytes)
+	if err != nil {
+		log.Error("Failed to decode config", "Error", err)
+		return
+	}
+
+	var breaking, later []conf.DeprecatedField
+	for _, field := range fields {
+		if field.RemovedIn <= major {
+			breaking = append(breaking, field)
+		} else {
+			later = append(later, field)
+		}
+	}
+
+	if len(breaking) == 0 {
+		fmt.Printf("No fields break in v%d\n", major)
+	} else {
+		fmt.Printf("Fields that break in v%d\n", major)
+		printDeprecatedFields(breaking)
+	}
+
+	if len(later) > 0 {
+		fmt.Println("Deprecated fields removed in later majors")
+		printDeprecatedFields(later)
+	}
+
+	success = len(breaking) == 0
+	return
+}
+
+func printDeprecatedFields(fields []conf.DeprecatedField) {
+	for _, field := range fields {
+		fmt.Printf("  %s (removed in v%d)\n", field.Location, field.RemovedIn)
+		fmt.Printf("      %s\n", field.Replacement)
+	}
+}
@@ -0,0 +1,103 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/inconshreveable/log15"
+)
+
+// CI servers set one of these
+var ciEnvVars = []string{"CI", "GO_PIPELINE_NAME", "JENKINS_URL", "BUILD_ID"}
+
+// confirmEnvironment prints a banner before changing a production environment
+// and asks for the confirmation the environment requires. Nobody can answer
+// a prompt in CI so --yes is required there instead
+func confirmEnvironment(log log15.Logger, environment *conf.Environment, yes bool) (success bool) {
+
+	if environment.Production {
+		printProductionBanner(environment.Name)
+	}
+
+	if environment.Confirm == conf.Confirm_None {
+		success = true
+		return
+	}
+
+	if yes {
+		log.Warn("Confirmed with --yes", "Environment", environment.Name)
+		success = true
+		return
+	}
+
+	if !interactive() {
+		log.Error("The environment requires confirmation. Pass --yes to confirm it non-interactively",
+			"Environment", environment.Name)
+		return
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+
+	switch environment.Confirm {
+	case conf.Confirm_Yes:
+		fmt.Fprintf(os.Stderr, "Continue with environment %s? [y/N] ", environment.Name)
+		answer, _ := reader.ReadString('\n')
+		success = strings.ToLower(strings.TrimSpace(answer)) == "y"
+
+	case conf.Confirm_Name:
+		fmt.Fprintf(os.Stderr, "Type the environment name to continue: ")
+		answer, _ := reader.ReadString('\n')
+		success = strings.TrimSpace(answer) == environment.Name
+	}
+
+	if !success {
+		log.Error("Not confirmed", "Environment", environment.Name)
+	}
+	return
+}
+
+// interactive is true if someone at a terminal can answer a prompt
+func interactive() bool {
+	for _, envVar := range ciEnvVars {
+		if os.Getenv(envVar) != "" {
+			return false
+		}
+	}
+
+	stat, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+func printProductionBanner(environmentName string) {
+	line := fmt.Sprintf("  PRODUCTION  environment %s  ", environmentName)
+	border := strings.Repeat(" ", len(line))
+
+	stat, err := os.Stderr.Stat()
+	if err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		fmt.Fprintf(os.Stderr, "%s\n%s\n%s\n", strings.Repeat("*", len(line)), line, strings.Repeat("*", len(line)))
+		return
+	}
+
+	// bold white on red
+	for _, text := range []string{border, line, border} {
+		fmt.Fprintf(os.Stderr, "\x1b[1;37;41m%s\x1b[0m\n", text)
+	}
+}
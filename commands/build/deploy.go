@@ -0,0 +1,510 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	awscfn "github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/notify"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/adobe-platform/porter/tracing"
+	"github.com/adobe-platform/porter/util"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/inconshreveable/log15"
+	"github.com/phylake/go-cli"
+)
+
+type DeployCmd struct{}
+
+func (recv *DeployCmd) Name() string {
+	return "deploy"
+}
+
+func (recv *DeployCmd) ShortHelp() string {
+	return "Provision, promote, and prune an environment"
+}
+
+func (recv *DeployCmd) LongHelp() string {
+	return `NAME
+    deploy -- Provision, promote, and prune an environment
+
+SYNOPSIS
+    deploy -e <environment out of .porter/config> [-keep <stacks to keep>] [--resume] [--force-unlock] [--timeout <duration>] [--rollback] [--yes] [--strict-provenance]
+
+DESCRIPTION
+    Provision the packed service payload to the environment, check every
+    region is running it, then promote and prune. Run pack first.
+
+    The environment is locked in the state store for the whole deploy so two
+    builds can't deploy it at once.
+
+OPTIONS
+    -keep
+        The number of stacks prune keeps. See prune --help
+
+    --resume
+        Continue a deploy of the same service version and payload that didn't
+        finish, for example because the build box died. Each region's
+        progress is read from the state store (see porter status).
+
+        Regions whose stack is being created or is already created are
+        waited on instead of being provisioned again. Every other region is
+        provisioned after its failed stack, if any, is deleted. Uploads of the service payload and CloudFormation
+        template that already happened are skipped. The pre_provision and
+        post_provision hooks run again.
+
+        Without a recorded deploy to resume this is the same as deploy.
+
+    --force-unlock
+        Release the environment's lock before deploying. Use this when the
+        build holding the lock died without releasing it.
+
+    --timeout
+        How long the whole deploy has to finish, like 1h. When it runs out,
+        or on SIGINT, AWS calls and uploads in flight are canceled, the state
+        each region was left in is logged and recorded, and the lock is
+        released. Stacks being created are deleted. The deploy can be resumed
+        with --resume.
+
+    --rollback
+        When the timeout runs out or on SIGINT, also cancel stack updates and
+        instance refreshes that are in progress so CloudFormation rolls them
+        back.
+
+    --yes
+        Skip the environment's confirm prompt. Required in CI for an
+        environment with confirm set. See the environment's production and
+        confirm in .porter/config
+
+    --strict-provenance
+        Before a hot swap updates a stack, refuse to update it if its
+        template was last rendered for a different service or by a newer
+        porter. Without it those are warnings`
+}
+
+func (recv *DeployCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *DeployCmd) Execute(args []string) bool {
+
+	if len(args) > 0 {
+		var environment string
+		var keepCount int
+		var resume, forceUnlock, rollback, yes, strictProvenance bool
+		var timeout time.Duration
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&environment, "e", "", "")
+		flagSet.IntVar(&keepCount, "keep", 0, "")
+		flagSet.BoolVar(&resume, "resume", false, "")
+		flagSet.BoolVar(&forceUnlock, "force-unlock", false, "")
+		flagSet.DurationVar(&timeout, "timeout", 0, "")
+		flagSet.BoolVar(&rollback, "rollback", false, "")
+		flagSet.BoolVar(&yes, "yes", false, "")
+		flagSet.BoolVar(&strictProvenance, "strict-provenance", false, "")
+		flagSet.Usage = func() {
+			fmt.Println(recv.LongHelp())
+		}
+		flagSet.Parse(args)
+
+		if keepCount < 0 || timeout < 0 {
+			return false
+		}
+
+		if !deploy(environment, keepCount, resume, forceUnlock, timeout, rollback, yes, strictProvenance) {
+			os.Exit(1)
+		}
+		return true
+	}
+
+	return false
+}
+
+func deploy(env string, keepCount int, resume, forceUnlock bool,
+	timeout time.Duration, rollback, yes, strictProvenance bool) (success bool) {
+	log := logger.CLI("cmd", "deploy")
+
+	config, getConfigSuccess := conf.GetAlteredConfig(log)
+	if !getConfigSuccess {
+		return
+	}
+
+	environment, err := config.GetEnvironment(env)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	if !confirmEnvironment(log, environment, yes) {
+		return
+	}
+
+	unlock, lockSuccess := lockEnvironment(log, config, env, forceUnlock)
+	if !lockSuccess {
+		return
+	}
+	defer unlock()
+
+	startedAt := time.Now()
+	retriesAtStart := util.Retries()
+	defer func() {
+		sloSuccess := reportDeploySLO(log, config, environment, startedAt, retriesAtStart, success)
+		success = success && sloSuccess
+	}()
+
+	// provision deletes the payload. Keeping it means a deploy can be resumed
+	// without packing again
+	checksum, keepPayloadSuccess := keepPipelinePayload(log)
+	if !keepPayloadSuccess {
+		return
+	}
+
+	log = log.New("PayloadChecksum", checksum)
+
+	ctx, cancel := newDeployContext(log, timeout, rollback)
+	defer cancel()
+	ctx = provision.WithStrictProvenance(ctx, strictProvenance)
+
+	if resume {
+		success = resumeDeploy(ctx, log, config, env, checksum, keepCount)
+	} else {
+		_, success = deployPayload(ctx, log, config, env, checksum, keepCount)
+	}
+
+	if success {
+		log.Info("Deploy complete")
+	}
+	return
+}
+
+func resumeDeploy(ctx context.Context, log log15.Logger, config *conf.Config, env, checksum string, keepCount int) (success bool) {
+
+	defer flushHookResults(log, env)
+
+	environment, err := config.GetEnvironment(env)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	if environment.Hotswap || environment.InstanceRefresh != nil {
+		log.Warn("Hot swap and instance refresh deploys can't be resumed. Deploying from the start")
+		_, success = deployPayload(ctx, log, config, env, checksum, keepCount)
+		return
+	}
+
+	if len(environment.Stamps) > 0 {
+		log.Error("Environment has stamps. Resume one with -e <environment><stamp>",
+			"Environment", environment.Name)
+		return
+	}
+
+	err = environment.IsWithinBlackoutWindow()
+	if err != nil {
+		log.Error("Blackout window is active", "Error", err, "Environment", environment.Name)
+		return
+	}
+
+	if !provision.CheckDependencyHealth(ctx, log, environment) {
+		return
+	}
+
+	if !provision.CheckPermissions(ctx, log, config, environment) {
+		return
+	}
+
+	deployments, err := provision.GetStateStore(config).List(config.ServiceName, environment.Name)
+	if err != nil {
+		log.Error("State store List", "Error", err)
+		return
+	}
+
+	// a no-op if the deploy being resumed already ran them
+	if !runMigrations(ctx, log, config, environment) {
+		return
+	}
+
+	stack, createRegions, failedStacks := resumableStack(log, config, environment, deployments, checksum)
+
+	if len(createRegions) == len(environment.Regions) {
+		log.Info("No deploy to resume. Deploying from the start")
+		_, success = deployPayload(ctx, log, config, env, checksum, keepCount)
+		return
+	}
+
+	notify.Publish(log, config, environment, notify.Event{
+		Event:   constants.EventDeployStarted,
+		Message: "resumed",
+	})
+
+	// the stack name is reused so a region's failed stack must be gone first
+	if !deleteFailedStacks(log, environment, failedStacks) {
+		return
+	}
+
+	if !resumeProvision(ctx, log, config, environment, stack, createRegions) {
+		return
+	}
+
+	success = finishDeploy(log, environment, stack, checksum, keepCount)
+	return
+}
+
+// resumableStack finds the regions of the latest deploy of this service
+// version and payload that have a stack. The rest need to be provisioned.
+// failedStacks are the stacks of those regions that failed under the same
+// name, by region
+func resumableStack(log log15.Logger, config *conf.Config, environment *conf.Environment,
+	deployments []*provision_state.Deployment, checksum string) (stack *provision_state.Stack,
+	createRegions []string, failedStacks map[string]string) {
+
+	stack = &provision_state.Stack{
+		Environment: environment.Name,
+		Regions:     make(map[string]*provision_state.Region),
+	}
+	failedStacks = make(map[string]string)
+
+	resumable := make(map[string]*provision_state.Deployment)
+	var latest *provision_state.Deployment
+
+	for _, deployment := range deployments {
+		if deployment.ServiceVersion != config.ServiceVersion ||
+			deployment.PayloadChecksum != checksum ||
+			deployment.Hotswap {
+			continue
+		}
+
+		resumable[deployment.Region] = deployment
+
+		if deployment.StackName != "" &&
+			(latest == nil || deployment.UpdatedAt.After(latest.UpdatedAt)) {
+			latest = deployment
+		}
+	}
+
+	// every region's stack must have the same name
+	if latest != nil {
+		stack.Name = latest.StackName
+	}
+
+	for _, region := range environment.Regions {
+
+		deployment, exists := resumable[region.Name]
+		if exists && deployment.StackName == stack.Name && deployment.StackId != "" {
+
+			switch deployment.Status {
+			case provision_state.StatusStackCreating,
+				provision_state.StatusProvisioned,
+				provision_state.StatusPromoted:
+
+				log.Info("Resuming region",
+					"Region", region.Name,
+					"Status", deployment.Status,
+					"StackId", deployment.StackId)
+
+				stack.Regions[region.Name] = &provision_state.Region{
+					StackId: deployment.StackId,
+				}
+				continue
+			}
+
+			failedStacks[region.Name] = deployment.StackId
+		}
+
+		log.Info("Region will be provisioned", "Region", region.Name)
+		createRegions = append(createRegions, region.Name)
+	}
+
+	return
+}
+
+// deleteFailedStacks deletes the stacks of failed regions and waits for them to
+// be gone so the regions can be provisioned again under the same stack name
+func deleteFailedStacks(log log15.Logger, environment *conf.Environment, failedStacks map[string]string) (success bool) {
+
+	for regionName, stackId := range failedStacks {
+		log := log.New("Region", regionName, "StackId", stackId)
+
+		roleARN, err := environment.GetRoleARN(regionName)
+		if err != nil {
+			log.Error("GetRoleARN", "Error", err)
+			return
+		}
+
+		cfnRoleARN, err := environment.GetCFNRoleARN(regionName)
+		if err != nil {
+			log.Error("GetCFNRoleARN", "Error", err)
+			return
+		}
+
+		roleSession := aws_session.STS(regionName, roleARN, constants.StackCreationTimeout())
+		cfnClient := awscfn.New(roleSession)
+
+		// the resumed stack is granted the secrets key under the same name
+		log.Info("Deleting the failed stack before provisioning the region again")
+		if !provision.DeleteStack(log, roleSession, stackId, cfnRoleARN) {
+			return
+		}
+
+		err = cfnClient.WaitUntilStackDeleteComplete(&cloudformation.DescribeStacksInput{
+			StackName: aws.String(stackId),
+		})
+		if err != nil {
+			log.Error("WaitUntilStackDeleteComplete", "Error", err)
+			return
+		}
+	}
+
+	success = true
+	return
+}
+
+// resumeProvision is ProvisionStack for the regions that need it followed by
+// waiting on every region. Failed regions are left for the next resume
+func resumeProvision(ctx context.Context, log log15.Logger, config *conf.Config, environment *conf.Environment,
+	stack *provision_state.Stack, createRegions []string) (success bool) {
+
+	span := tracing.Start(nil, "provision").
+		SetAttribute("service.name", config.ServiceName).
+		SetAttribute("service.version", config.ServiceVersion).
+		SetAttribute("environment", environment.Name).
+		SetAttribute("resumed", "true")
+	tracing.SetRoot(span)
+
+	defer func() {
+		tracing.SetRoot(nil)
+		span.End(success)
+		tracing.Flush(log)
+	}()
+
+	defer runPostRollbackHook(log, environment.Name)
+
+	defer func() {
+
+		postHookSuccess := runHook(log, constants.HookPostProvision,
+			environment.Name, stack.Regions, success)
+
+		success = success && postHookSuccess
+	}()
+
+	if !runHook(log, constants.HookPreProvision, environment.Name, nil, true) {
+		return
+	}
+
+	if len(createRegions) > 0 {
+
+		err := util.CopyFile(constants.PipelinePayloadPath, constants.PayloadPath)
+		if err != nil {
+			log.Error("Failed to restore the service payload", "Error", err)
+			return
+		}
+
+		if !provision.ResumeStack(ctx, log, config, stack, createRegions) {
+			failure := "stack creation failed"
+			if reason := provision.CancelReason(ctx); reason != "" {
+				failure = "stack creation stopped: " + reason
+			}
+			recordStack(log, config, *stack, provision_state.StatusFailed, failure)
+			return
+		}
+
+		if aws_session.AuditPath() != "" {
+			log.Info("Audit mode. Not waiting for stacks that weren't created")
+			success = true
+			return
+		}
+	} else if !writeResumedTemplate(log, config, environment) {
+		return
+	}
+
+	type regionResult struct {
+		regionName string
+		success    bool
+	}
+
+	resultChan := make(chan regionResult)
+
+	for regionName, regionState := range stack.Regions {
+
+		go func(regionName string, regionState *provision_state.Region) {
+
+			resultChan <- regionResult{
+				regionName: regionName,
+				success:    provisionStackPoll(ctx, log, config, environment, regionName, regionState),
+			}
+
+		}(regionName, regionState)
+	}
+
+	failed := provision_state.Stack{
+		Name:        stack.Name,
+		Environment: stack.Environment,
+		Regions:     make(map[string]*provision_state.Region),
+	}
+
+	for i := 0; i < len(stack.Regions); i++ {
+		result := <-resultChan
+		if !result.success {
+			failed.Regions[result.regionName] = stack.Regions[result.regionName]
+		}
+	}
+
+	if len(failed.Regions) > 0 {
+		recordStack(log, config, failed, provision_state.StatusFailed, "stack creation failed")
+		log.Error("Some regions failed. Resume again to provision them")
+		return
+	}
+
+	success = writeProvisionOutput(log, config, *stack)
+	return
+}
+
+// writeResumedTemplate renders the template provisionStackPoll reads when no
+// region was provisioned by this process
+func writeResumedTemplate(log log15.Logger, config *conf.Config, environment *conf.Environment) (success bool) {
+
+	region := environment.Regions[0]
+
+	roleARN, err := environment.GetRoleARN(region.Name)
+	if err != nil {
+		log.Error("GetRoleARN", "Error", err)
+		return
+	}
+
+	roleSession := aws_session.STS(region.Name, roleARN, 0)
+
+	templateBytes, renderSuccess := provision.RenderTemplate(log, config, environment, region, roleSession)
+	if !renderSuccess {
+		return
+	}
+
+	err = ioutil.WriteFile(constants.CloudFormationTemplatePath, templateBytes, 0644)
+	if err != nil {
+		log.Error("Unable to write "+constants.CloudFormationTemplatePath, "Error", err)
+		return
+	}
+
+	success = true
+	return
+}
@@ -0,0 +1,115 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/inconshreveable/log15"
+)
+
+type rollbackKey struct{}
+
+// newDeployContext is canceled by SIGINT or after the timeout so a deploy can
+// stop its AWS calls, record what state it left each region in, and release
+// its lock. A second SIGINT exits immediately. rollback cancels in-progress
+// stack updates and instance refreshes when the context is done
+func newDeployContext(log log15.Logger, timeout time.Duration, rollback bool) (ctx context.Context, cancel func()) {
+	ctx = context.WithValue(context.Background(), rollbackKey{}, rollback)
+
+	var cancelTimeout, cancelSignal func()
+	if timeout > 0 {
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+	}
+	ctx, cancelSignal = context.WithCancel(ctx)
+
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, os.Interrupt)
+
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-sigChan:
+		case <-stopped:
+			return
+		}
+
+		log.Warn("Received SIGINT. Stopping the deploy. Press Ctrl+C again to exit immediately")
+		cancelSignal()
+
+		select {
+		case <-sigChan:
+			// http://tldp.org/LDP/abs/html/exitcodes.html
+			os.Exit(130)
+		case <-stopped:
+		}
+	}()
+
+	cancel = func() {
+		signal.Stop(sigChan)
+		close(stopped)
+		cancelSignal()
+		if cancelTimeout != nil {
+			cancelTimeout()
+		}
+	}
+	return
+}
+
+func rollbackOnCancel(ctx context.Context) bool {
+	rollback, _ := ctx.Value(rollbackKey{}).(bool)
+	return rollback
+}
+
+// sleepContext is false if the context is done first
+func sleepContext(ctx context.Context, duration time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(duration):
+		return true
+	}
+}
+
+// logStopped reports the state a region was left in when the deploy stopped
+func logStopped(log log15.Logger, ctx context.Context, stackId string, ctxKV ...interface{}) {
+	ctxKV = append(ctxKV, "Reason", provision.CancelReason(ctx))
+	if stackId != "" {
+		ctxKV = append(ctxKV, "StackId", stackId)
+	}
+	log.Error("Deploy stopped", ctxKV...)
+}
+
+// cancelStackUpdate rolls back an in-progress stack update. It uses a fresh
+// session because the deploy's context is already done
+func cancelStackUpdate(log log15.Logger, environment *conf.Environment, regionName, stackId string) {
+	roleSession, ok := refreshRoleSession(log, environment, regionName)
+	if !ok {
+		return
+	}
+
+	log.Warn("Cancelling the stack update", "StackId", stackId)
+
+	_, err := cloudformation.New(roleSession).CancelUpdateStack(&cloudformation.CancelUpdateStackInput{
+		StackName: aws.String(stackId),
+	})
+	if err != nil {
+		log.Error("cloudformation:CancelUpdateStack", "Error", err)
+	}
+}
@@ -0,0 +1,168 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"sync"
+	"time"
+
+	"github.com/adobe-platform/porter/aws/cloudwatch"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/inconshreveable/log15"
+)
+
+var (
+	// the stacks of the regions that rolled back during this process's
+	// provision
+	rolledBackRegions     = make(map[string]string)
+	rolledBackRegionsLock sync.Mutex
+
+	// the rolled back stacks post_rollback already ran for, by region
+	postRollbackRegions = make(map[string]string)
+)
+
+// recordRollback counts a region's rollback in the deploy metrics and for the
+// post_rollback hook
+func recordRollback(regionName, stackId string) {
+	rolledBackRegionsLock.Lock()
+	defer rolledBackRegionsLock.Unlock()
+
+	rolledBackRegions[regionName] = stackId
+}
+
+// runPostRollbackHook runs the post_rollback hooks for the regions that rolled
+// back since it last ran. Every provision path defers it. The deploy already
+// failed so the hooks can't fail it
+func runPostRollbackHook(log log15.Logger, environmentName string) {
+	rolledBackRegionsLock.Lock()
+	regions := make(map[string]*provision_state.Region)
+	for regionName, stackId := range rolledBackRegions {
+		if postRollbackRegions[regionName] == stackId {
+			continue
+		}
+		postRollbackRegions[regionName] = stackId
+
+		regions[regionName] = &provision_state.Region{
+			StackId: stackId,
+		}
+	}
+	rolledBackRegionsLock.Unlock()
+
+	if len(regions) > 0 {
+		runHook(log, constants.HookPostRollback, environmentName, regions, true)
+	}
+}
+
+// emitDeployMetrics publishes the provision's duration, payload size,
+// outcome, and rollbacks to CloudWatch in each of the environment's regions.
+// Metrics are informational so failing to publish them is only a warning
+func emitDeployMetrics(log log15.Logger, config *conf.Config, environment *conf.Environment,
+	startedAt time.Time, payloadSize int64, success bool) {
+
+	rolledBackRegionsLock.Lock()
+	rolledBack := rolledBackRegions
+	rolledBackRegions = make(map[string]string)
+	rolledBackRegionsLock.Unlock()
+
+	if environment.DeployMetrics == nil || !environment.DeployMetrics.Enabled {
+		return
+	}
+
+	namespace := environment.DeployMetrics.Namespace
+	if namespace == "" {
+		namespace = constants.DefaultDeployMetricsNamespace
+	}
+
+	dimensions := []cloudwatch.Dimension{
+		{Name: "ServiceName", Value: config.ServiceName},
+		{Name: "Environment", Value: environment.Name},
+	}
+
+	var succeeded, failed float64
+	if success {
+		succeeded = 1
+	} else {
+		failed = 1
+	}
+
+	var wg sync.WaitGroup
+
+	for _, region := range environment.Regions {
+
+		var rollbacks float64
+		if _, exists := rolledBack[region.Name]; exists {
+			rollbacks = 1
+		}
+
+		input := &cloudwatch.PutMetricDataInput{
+			Namespace: namespace,
+			MetricData: []cloudwatch.MetricDatum{
+				{
+					MetricName: "DeployDuration",
+					Dimensions: dimensions,
+					Value:      time.Since(startedAt).Seconds(),
+					Unit:       "Seconds",
+				},
+				{
+					MetricName: "PayloadSize",
+					Dimensions: dimensions,
+					Value:      float64(payloadSize),
+					Unit:       "Bytes",
+				},
+				{
+					MetricName: "DeploySuccess",
+					Dimensions: dimensions,
+					Value:      succeeded,
+					Unit:       "Count",
+				},
+				{
+					MetricName: "DeployFailure",
+					Dimensions: dimensions,
+					Value:      failed,
+					Unit:       "Count",
+				},
+				{
+					MetricName: "Rollback",
+					Dimensions: dimensions,
+					Value:      rollbacks,
+					Unit:       "Count",
+				},
+			},
+		}
+
+		wg.Add(1)
+		go func(regionName string, input *cloudwatch.PutMetricDataInput) {
+			defer wg.Done()
+
+			regionLog := log.New("Region", regionName)
+
+			roleARN, err := environment.GetRoleARN(regionName)
+			if err != nil {
+				regionLog.Warn("GetRoleARN", "Error", err)
+				return
+			}
+
+			roleSession := aws_session.STS(regionName, roleARN, 0)
+
+			regionLog.Info("cloudwatch:PutMetricData", "Namespace", input.Namespace)
+			_, err = cloudwatch.New(roleSession).PutMetricData(input)
+			if err != nil {
+				regionLog.Warn("cloudwatch:PutMetricData", "Error", err)
+			}
+		}(region.Name, input)
+	}
+
+	wg.Wait()
+}
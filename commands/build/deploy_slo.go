@@ -0,0 +1,207 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/util"
+	"github.com/inconshreveable/log15"
+)
+
+var (
+	// when the first instance of each region was healthy during this
+	// process's deploy
+	firstHealthyAt = make(map[string]time.Time)
+
+	// how long promote took during this process's deploy
+	swapDuration time.Duration
+
+	deploySLOLock sync.Mutex
+)
+
+type (
+	deploySLOReport struct {
+		Environment    string         `json:"environment"`
+		ServiceVersion string         `json:"service_version"`
+		DeploySuccess  bool           `json:"deploy_success"`
+		Breached       bool           `json:"breached"`
+		Objectives     []sloObjective `json:"objectives"`
+	}
+
+	// sloObjective is seconds except for the retry budget which is a count.
+	// Actual is nil if the deploy didn't get far enough to measure it
+	sloObjective struct {
+		Name     string   `json:"name"`
+		Target   float64  `json:"target"`
+		Actual   *float64 `json:"actual"`
+		Breached bool     `json:"breached"`
+	}
+)
+
+// recordFirstHealthy records when a region's first instance was healthy for
+// the deploy SLO report
+func recordFirstHealthy(regionName string, healthyAt time.Time) {
+	if healthyAt.IsZero() {
+		return
+	}
+
+	deploySLOLock.Lock()
+	defer deploySLOLock.Unlock()
+
+	if existing, exists := firstHealthyAt[regionName]; !exists || healthyAt.Before(existing) {
+		firstHealthyAt[regionName] = healthyAt
+	}
+}
+
+// recordSwap records how long promote took for the deploy SLO report
+func recordSwap(duration time.Duration) {
+	deploySLOLock.Lock()
+	defer deploySLOLock.Unlock()
+
+	swapDuration += duration
+}
+
+// reportDeploySLO prints and writes the deploy's measurements against the
+// environment's deploy_slo. It's unsuccessful only if an objective was
+// breached and the environment fails on breaches
+func reportDeploySLO(log log15.Logger, config *conf.Config, environment *conf.Environment,
+	startedAt time.Time, retriesAtStart int64, deploySuccess bool) (success bool) {
+
+	deploySLOLock.Lock()
+	healthyAt := firstHealthyAt
+	swapped := swapDuration
+	firstHealthyAt = make(map[string]time.Time)
+	swapDuration = 0
+	deploySLOLock.Unlock()
+
+	slo := environment.DeploySLO
+	if slo == nil {
+		success = true
+		return
+	}
+
+	report := deploySLOReport{
+		Environment:    environment.Name,
+		ServiceVersion: config.ServiceVersion,
+		DeploySuccess:  deploySuccess,
+		Objectives:     make([]sloObjective, 0),
+	}
+
+	measure := func(name string, target int, actual *float64) {
+		if target == 0 {
+			return
+		}
+
+		objective := sloObjective{
+			Name:   name,
+			Target: float64(target),
+			Actual: actual,
+		}
+		if actual != nil && *actual > objective.Target {
+			objective.Breached = true
+			report.Breached = true
+		}
+		report.Objectives = append(report.Objectives, objective)
+	}
+
+	totalTime := time.Since(startedAt).Seconds()
+	measure("total_time", slo.TotalTime, &totalTime)
+
+	var firstHealthy *float64
+	for _, at := range healthyAt {
+		seconds := at.Sub(startedAt).Seconds()
+		if firstHealthy == nil || seconds < *firstHealthy {
+			firstHealthy = &seconds
+		}
+	}
+	measure("first_healthy_instance", slo.FirstHealthyInstance, firstHealthy)
+
+	var swap *float64
+	if swapped > 0 {
+		seconds := swapped.Seconds()
+		swap = &seconds
+	}
+	measure("swap_duration", slo.SwapDuration, swap)
+
+	if slo.RetryBudget != nil {
+		retries := float64(util.Retries() - retriesAtStart)
+		objective := sloObjective{
+			Name:     "retry_budget",
+			Target:   float64(*slo.RetryBudget),
+			Actual:   &retries,
+			Breached: retries > float64(*slo.RetryBudget),
+		}
+		report.Breached = report.Breached || objective.Breached
+		report.Objectives = append(report.Objectives, objective)
+	}
+
+	printDeploySLOReport(report)
+
+	reportBytes, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Warn("json.MarshalIndent", "Error", err)
+	} else {
+		err = ioutil.WriteFile(constants.DeploySLOReportPath, reportBytes, 0644)
+		if err != nil {
+			log.Warn("Unable to write the deploy SLO report", "Path", constants.DeploySLOReportPath, "Error", err)
+		}
+	}
+
+	if report.Breached {
+		if slo.FailOnBreach {
+			log.Error("The deploy breached its SLO")
+			return
+		}
+		log.Warn("The deploy breached its SLO")
+	}
+
+	success = true
+	return
+}
+
+func printDeploySLOReport(report deploySLOReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "DEPLOY SLO %s %s\n", report.Environment, report.ServiceVersion)
+	fmt.Fprintln(w, "OBJECTIVE\tTARGET\tACTUAL\tRESULT")
+
+	for _, objective := range report.Objectives {
+		format := func(value float64) string {
+			if objective.Name == "retry_budget" {
+				return fmt.Sprintf("%.0f", value)
+			}
+			return time.Duration(value * float64(time.Second)).Round(time.Second).String()
+		}
+
+		actual := "-"
+		result := "not measured"
+		if objective.Actual != nil {
+			actual = format(*objective.Actual)
+			result = "ok"
+			if objective.Breached {
+				result = "BREACHED"
+			}
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", objective.Name, format(objective.Target), actual, result)
+	}
+}
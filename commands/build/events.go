@@ -0,0 +1,40 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"context"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/events"
+	"github.com/adobe-platform/porter/provision"
+)
+
+func stackEventHeader(config *conf.Config, environment *conf.Environment, regionName, stackId string) events.Header {
+	return events.NewHeader(config.ServiceName, config.ServiceVersion, environment.Name, regionName, stackId)
+}
+
+// emitStepFailed emits StepFailed for the region unless the step succeeded.
+// It's deferred by the steps that wait on a stack after it's requested
+func emitStepFailed(ctx context.Context, config *conf.Config, environment *conf.Environment,
+	regionName, stackId, step string, success bool) {
+
+	if success {
+		return
+	}
+
+	events.Emit(events.StepFailed{
+		Header: stackEventHeader(config, environment, regionName, stackId),
+		Step:   step,
+		Reason: provision.CancelReason(ctx),
+	})
+}
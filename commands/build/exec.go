@@ -0,0 +1,431 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"github.com/adobe-platform/porter/aws/autoscaling"
+	"github.com/adobe-platform/porter/aws/ec2"
+	"github.com/adobe-platform/porter/aws/ssm"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	autoscalinglib "github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/inconshreveable/log15"
+	"github.com/phylake/go-cli"
+)
+
+const (
+	execViaSSH = "ssh"
+	execViaSSM = "ssm"
+
+	// runs the session's command instead of opening a shell on the instance
+	interactiveCommandDocument = "AWS-StartInteractiveCommand"
+)
+
+type ExecCmd struct{}
+
+func (recv *ExecCmd) Name() string {
+	return "exec"
+}
+
+func (recv *ExecCmd) ShortHelp() string {
+	return "Run a command in a live container"
+}
+
+func (recv *ExecCmd) LongHelp() string {
+	return `NAME
+    exec -- Run a command in a live container
+
+SYNOPSIS
+    exec -e <environment> [-r <region>] [--instance <instance id>]
+         [--container <name>] [--via ssh|ssm] [-i <identity file>]
+         [--user <user>] [-- <command> ...]
+
+DESCRIPTION
+    Run a command, a shell by default, with docker exec in a container of the
+    environment's current stack.
+
+    The stack is the latest provisioned or promoted deploy of the region in
+    the state store. Its instances are the in service instances of its
+    autoscaling groups. Without --instance the one with the lowest id is used.
+
+    ssh connects to the instance's public IP, or its private IP if it has
+    none, with the key pair's identity file. ssm starts a Session Manager
+    session like porter session and needs the session-manager-plugin on the
+    PATH. Either way the user must be able to sudo docker.
+
+    Only EC2 environments are supported. Use ECS Exec for ecs.
+
+OPTIONS
+    -e
+        Environment from .porter/config
+
+    -r
+        The stack's region. Required when the environment has more than one
+        region
+
+    --instance
+        The instance id like i-0123456789abcdef0. Defaults to the stack's
+        instance with the lowest id
+
+    --container
+        The container's name in .porter/config. Defaults to the container with
+        inet topology or the region's first container
+
+    --via
+        ssh or ssm. Defaults to the environment's access
+
+    -i
+        Identity file passed to ssh
+
+    --user
+        User ssh connects as. Defaults to ` + constants.AmazonLinuxUser + `
+
+    <command>
+        The command run in the container. Defaults to sh`
+}
+
+func (recv *ExecCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *ExecCmd) Execute(args []string) bool {
+
+	if len(args) > 0 {
+		var env, region, instanceId, containerName, via, identityFile, user string
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&env, "e", "", "")
+		flagSet.StringVar(&region, "r", "", "")
+		flagSet.StringVar(&instanceId, "instance", "", "")
+		flagSet.StringVar(&containerName, "container", "", "")
+		flagSet.StringVar(&via, "via", "", "")
+		flagSet.StringVar(&identityFile, "i", "", "")
+		flagSet.StringVar(&user, "user", constants.AmazonLinuxUser, "")
+		flagSet.Usage = func() {
+			fmt.Println(recv.LongHelp())
+		}
+		flagSet.Parse(args)
+
+		if env == "" {
+			return false
+		}
+
+		switch via {
+		case "", execViaSSH, execViaSSM:
+		default:
+			fmt.Printf("Invalid --via %s\n", via)
+			return false
+		}
+
+		command := flagSet.Args()
+		if len(command) == 0 {
+			command = []string{"sh"}
+		}
+
+		target := execTarget{
+			instanceId:    instanceId,
+			containerName: containerName,
+			via:           via,
+			identityFile:  identityFile,
+			user:          user,
+		}
+
+		if !execInContainer(env, region, target, command) {
+			os.Exit(1)
+		}
+		return true
+	}
+
+	return false
+}
+
+type execTarget struct {
+	instanceId    string
+	containerName string
+	via           string
+	identityFile  string
+	user          string
+}
+
+func execInContainer(env, region string, target execTarget, command []string) (success bool) {
+	log := logger.CLI("cmd", "exec")
+
+	config, getConfigSuccess := conf.GetConfig(log, true)
+	if !getConfigSuccess {
+		return
+	}
+
+	environment, err := config.GetEnvironment(env)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	if environment.Compute == conf.Compute_ECS {
+		log.Error("exec doesn't support ecs. Use ECS Exec")
+		return
+	}
+
+	region, ok := defaultRegion(log, environment, region)
+	if !ok {
+		return
+	}
+	log = log.New("Region", region)
+
+	regionConfig, err := environment.GetRegion(region)
+	if err != nil {
+		log.Error("GetRegion", "Error", err)
+		return
+	}
+
+	container := primaryContainer(regionConfig, target.containerName)
+	if container == nil {
+		log.Error("No container named " + target.containerName)
+		return
+	}
+
+	if target.via == "" {
+		target.via = execViaSSH
+		if environment.Access == conf.Access_SSM {
+			target.via = execViaSSM
+		}
+	}
+
+	stackId, ok := currentStackId(log, config, environment, region)
+	if !ok {
+		return
+	}
+	log = log.New("StackId", stackId)
+
+	roleSession, ok := refreshRoleSession(log, environment, region)
+	if !ok {
+		return
+	}
+
+	instanceIds, ok := inServiceInstanceIds(log, roleSession, stackId)
+	if !ok {
+		return
+	}
+
+	if target.instanceId == "" {
+		if len(instanceIds) == 0 {
+			log.Error("The stack has no instances in service")
+			return
+		}
+		target.instanceId = instanceIds[0]
+	} else {
+		found := false
+		for _, instanceId := range instanceIds {
+			if instanceId == target.instanceId {
+				found = true
+				break
+			}
+		}
+		if !found {
+			log.Error("The instance isn't in service in the stack", "InstanceId", target.instanceId)
+			return
+		}
+	}
+
+	log = log.New("InstanceId", target.instanceId, "Container", container.Name, "Via", target.via)
+	log.Info("Running in container", "Command", strings.Join(command, " "))
+
+	remoteCommand := dockerExecCommand(container.Name, command)
+
+	if target.via == execViaSSM {
+		success = runSession(log, ssm.New(roleSession), region, &ssm.StartSessionInput{
+			Target:       target.instanceId,
+			DocumentName: interactiveCommandDocument,
+			Parameters:   map[string][]string{"command": {remoteCommand}},
+		})
+		return
+	}
+
+	success = runSSH(log, roleSession, target, remoteCommand)
+	return
+}
+
+// primaryContainer is the named container or the one most likely to be
+// debugged if the name is empty
+func primaryContainer(region *conf.Region, name string) *conf.Container {
+	if name != "" {
+		for _, container := range region.Containers {
+			if container.Name == name {
+				return container
+			}
+		}
+		return nil
+	}
+
+	for _, container := range region.Containers {
+		if container.Topology == conf.Topology_Inet {
+			return container
+		}
+	}
+
+	if len(region.Containers) > 0 {
+		return region.Containers[0]
+	}
+	return nil
+}
+
+// currentStackId is the stack of the region's latest provisioned or promoted
+// deploy
+func currentStackId(log log15.Logger, config *conf.Config, environment *conf.Environment,
+	region string) (stackId string, success bool) {
+
+	deployments, err := provision.GetStateStore(config).List(config.ServiceName, environment.Name)
+	if err != nil {
+		log.Error("State store List", "Error", err)
+		return
+	}
+
+	for _, deployment := range deployments {
+		if deployment.Region != region {
+			continue
+		}
+
+		switch deployment.Status {
+		case provision_state.StatusProvisioned, provision_state.StatusPromoted:
+			stackId = deployment.StackId
+			success = true
+			return
+		default:
+			log.Error("The region's latest deploy isn't provisioned", "Status", deployment.Status)
+			return
+		}
+	}
+
+	log.Error("The region has no deploy in the state store")
+	return
+}
+
+// inServiceInstanceIds is the in service instances of the stack's autoscaling
+// groups sorted by id
+func inServiceInstanceIds(log log15.Logger, roleSession *session.Session, stackId string) ([]string, bool) {
+
+	var queueUrl string
+	var asgNames []string
+	if !getQueueUrlAndAsgNames(log, roleSession, stackId, &queueUrl, &asgNames) {
+		return nil, false
+	}
+
+	instanceIds := make([]string, 0)
+	if len(asgNames) == 0 {
+		return instanceIds, true
+	}
+
+	log.Info("autoscaling:DescribeAutoScalingGroups")
+	groupsOutput, err := autoscaling.New(roleSession).DescribeAutoScalingGroups(&autoscalinglib.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: aws.StringSlice(asgNames),
+	})
+	if err != nil {
+		log.Error("autoscaling:DescribeAutoScalingGroups", "Error", err)
+		return nil, false
+	}
+
+	for _, group := range groupsOutput.AutoScalingGroups {
+		for _, instance := range group.Instances {
+			if aws.StringValue(instance.LifecycleState) == autoscalinglib.LifecycleStateInService {
+				instanceIds = append(instanceIds, aws.StringValue(instance.InstanceId))
+			}
+		}
+	}
+
+	sort.Strings(instanceIds)
+	return instanceIds, true
+}
+
+func runSSH(log log15.Logger, roleSession *session.Session, target execTarget,
+	remoteCommand string) (success bool) {
+
+	sshPath, err := exec.LookPath("ssh")
+	if err != nil {
+		log.Error("Install ssh", "Error", err)
+		return
+	}
+
+	log.Info("ec2:DescribeInstances")
+	reservations, err := ec2.DescribeInstances(ec2.New(roleSession), nil, target.instanceId)
+	if err != nil {
+		log.Error("ec2:DescribeInstances", "Error", err)
+		return
+	}
+
+	var host string
+	for _, reservation := range reservations {
+		for _, instance := range reservation.Instances {
+			host = aws.StringValue(instance.PublicIpAddress)
+			if host == "" {
+				host = aws.StringValue(instance.PrivateIpAddress)
+			}
+		}
+	}
+	if host == "" {
+		log.Error("The instance has no IP")
+		return
+	}
+
+	sshArgs := []string{"-t"}
+	if target.identityFile != "" {
+		sshArgs = append(sshArgs, "-i", target.identityFile)
+	}
+	sshArgs = append(sshArgs, target.user+"@"+host, remoteCommand)
+
+	// ssh owns the terminal until the command exits. Ctrl+C is sent to the
+	// container instead of stopping porter
+	signal.Ignore(os.Interrupt)
+	defer signal.Reset(os.Interrupt)
+
+	log.Info("ssh", "Host", host)
+	cmd := exec.Command(sshPath, sshArgs...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+	if err != nil {
+		log.Error("ssh", "Error", err)
+		return
+	}
+
+	success = true
+	return
+}
+
+// dockerExecCommand runs command in the newest container with the name on an
+// instance
+func dockerExecCommand(containerName string, command []string) string {
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = shellQuote(arg)
+	}
+
+	return fmt.Sprintf("sudo docker exec -it \"$(sudo docker ps -lq --filter %s)\" %s",
+		shellQuote("label="+constants.ContainerLabel+"="+containerName), strings.Join(quoted, " "))
+}
+
+func shellQuote(arg string) string {
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
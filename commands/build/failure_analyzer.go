@@ -0,0 +1,171 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/inconshreveable/log15"
+)
+
+const (
+	// how many instances to print console output for
+	maxAnalyzedInstances = 3
+
+	// how many trailing lines of console output to print per instance
+	consoleOutputTailLines = 100
+)
+
+// analyzeStackFailure prints diagnostics for a stack whose wait condition
+// failed so a user doesn't have to SSH into an instance that has likely
+// already been terminated by the rollback.
+//
+// The console output contains the cloud-init and cfn-init output of the
+// instance which is usually where the reason a host didn't signal shows up
+func analyzeStackFailure(log log15.Logger, roleSession *session.Session, stackId string) {
+
+	cfnClient := cfnlib.New(roleSession)
+
+	eventsOutput, err := cfnClient.DescribeStackEvents(&cfnlib.DescribeStackEventsInput{
+		StackName: aws.String(stackId),
+	})
+	if err != nil {
+		log.Error("cloudformation:DescribeStackEvents", "Error", err)
+		return
+	}
+
+	waitConditionFailed := false
+	for _, event := range eventsOutput.StackEvents {
+		if event.ResourceType == nil || event.ResourceStatus == nil {
+			continue
+		}
+
+		if *event.ResourceType == cfn.CloudFormation_WaitCondition &&
+			*event.ResourceStatus == cfn.CREATE_FAILED {
+
+			waitConditionFailed = true
+			log.Error("Wait condition failed",
+				"LogicalResourceId", aws.StringValue(event.LogicalResourceId),
+				"ResourceStatusReason", aws.StringValue(event.ResourceStatusReason))
+			break
+		}
+	}
+
+	if !waitConditionFailed {
+		return
+	}
+
+	ec2Client := ec2.New(roleSession)
+
+	// instances that were terminated by the rollback are still described for a
+	// while after they're gone
+	instancesOutput, err := ec2Client.DescribeInstances(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("tag:aws:cloudformation:stack-id"),
+				Values: []*string{aws.String(stackId)},
+			},
+		},
+	})
+	if err != nil {
+		log.Error("ec2:DescribeInstances", "Error", err)
+		return
+	}
+
+	instanceIds := make([]string, 0)
+	for _, reservation := range instancesOutput.Reservations {
+		for _, instance := range reservation.Instances {
+			if instance.InstanceId != nil {
+				instanceIds = append(instanceIds, *instance.InstanceId)
+			}
+		}
+	}
+
+	if len(instanceIds) == 0 {
+		log.Warn("No instances found for failed stack")
+		return
+	}
+
+	if len(instanceIds) > maxAnalyzedInstances {
+		log.Info("Limiting console output", "Instances", len(instanceIds), "Printed", maxAnalyzedInstances)
+		instanceIds = instanceIds[:maxAnalyzedInstances]
+	}
+
+	for _, instanceId := range instanceIds {
+		printConsoleOutput(log, ec2Client, instanceId)
+	}
+}
+
+// analyzeHookFailures prints the CloudFormation hooks that failed the stack
+// and the rules they say were violated. A hook failing a resource only shows
+// up in the stack's events as the resource failing with a generic reason
+func analyzeHookFailures(log log15.Logger, roleSession *session.Session, stackId string) {
+
+	failures, err := cloudformation.DescribeHookFailures(cfnlib.New(roleSession), stackId)
+	if err != nil {
+		log.Error("cloudformation:DescribeStackEvents", "Error", err)
+		return
+	}
+
+	for _, event := range failures {
+		log.Error("CloudFormation hook failed",
+			"LogicalResourceId", aws.StringValue(event.LogicalResourceId),
+			"ResourceType", aws.StringValue(event.ResourceType),
+			"HookType", aws.StringValue(event.HookType),
+			"HookInvocationPoint", aws.StringValue(event.HookInvocationPoint),
+			"Rules", strings.Join(event.Rules(), ", "),
+			"HookStatusReason", aws.StringValue(event.HookStatusReason))
+	}
+}
+
+func printConsoleOutput(log log15.Logger, ec2Client *ec2.EC2, instanceId string) {
+	log = log.New("InstanceId", instanceId)
+
+	output, err := ec2Client.GetConsoleOutput(&ec2.GetConsoleOutputInput{
+		InstanceId: aws.String(instanceId),
+	})
+	if err != nil {
+		log.Error("ec2:GetConsoleOutput", "Error", err)
+		return
+	}
+
+	if output.Output == nil {
+		// console output is only available a few minutes after boot
+		log.Warn("No console output available")
+		return
+	}
+
+	consoleBytes, err := base64.StdEncoding.DecodeString(*output.Output)
+	if err != nil {
+		log.Error("base64 DecodeString", "Error", err)
+		return
+	}
+
+	lines := strings.Split(strings.TrimRight(string(consoleBytes), "\n"), "\n")
+	if len(lines) > consoleOutputTailLines {
+		lines = lines[len(lines)-consoleOutputTailLines:]
+	}
+
+	log.Error("Console output of instance that failed to signal", "Lines", len(lines))
+	fmt.Fprintf(os.Stderr, "----- BEGIN console output %s -----\n", instanceId)
+	fmt.Fprintln(os.Stderr, strings.Join(lines, "\n"))
+	fmt.Fprintf(os.Stderr, "----- END console output %s -----\n", instanceId)
+}
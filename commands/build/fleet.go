@@ -0,0 +1,342 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/adobe-platform/porter/aws/autoscaling"
+	"github.com/adobe-platform/porter/command_queue"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/adobe-platform/porter/secrets"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	autoscalinglib "github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inconshreveable/log15"
+	"github.com/phylake/go-cli"
+)
+
+// the vendored SDK doesn't define this error code
+const nonExistentQueueCode = "AWS.SimpleQueueService.NonExistentQueue"
+
+type (
+	FleetSendCmd struct{}
+
+	// commandArgs collects repeated -arg key=value flags
+	commandArgs map[string]string
+)
+
+func (recv commandArgs) String() string {
+	pairs := make([]string, 0)
+	for key, value := range recv {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (recv commandArgs) Set(pair string) error {
+	keyValue := strings.SplitN(pair, "=", 2)
+	if len(keyValue) != 2 || keyValue[0] == "" {
+		return fmt.Errorf("expected key=value but got %s", pair)
+	}
+
+	recv[keyValue[0]] = keyValue[1]
+	return nil
+}
+
+func (recv *FleetSendCmd) Name() string {
+	return "send"
+}
+
+func (recv *FleetSendCmd) ShortHelp() string {
+	return "Send a command to the instances of an environment"
+}
+
+func (recv *FleetSendCmd) LongHelp() string {
+	return `NAME
+    send -- Send a command to the instances of an environment
+
+SYNOPSIS
+    send -e <environment> -c <command> [-r <region>] [-instance <instance id>] [-arg <key>=<value>]... [--yes]
+
+DESCRIPTION
+    Send a signed command to porterd on the InService instances of the
+    environment's current stacks. Each instance's porterd creates a command
+    queue of its own that it polls. The environment must have command_queue
+    enabled.
+
+    Commands are signed with a key derived from the stack's secrets key so
+    porterd runs only commands sent by someone who can deploy the stack.
+    Commands that aren't received within ` + constants.CommandMaxAge.String() + ` are discarded.
+
+COMMANDS
+    ` + constants.CommandRefreshSecrets + `
+        Refresh the stack's secrets now instead of waiting for the cron job
+        that refreshes them every 5 minutes.
+
+    ` + constants.CommandDrain + `
+        Deregister the instance from its load balancers and stop the service's
+        containers. -arg timeout=<seconds> is how long containers have to stop.
+        It defaults to ` + fmt.Sprint(constants.CommandDrainTimeout) + `.
+
+    ` + constants.CommandLogLevel + `
+        Change porterd's log level. -arg level=debug or -arg level=info
+
+OPTIONS
+    -e
+        Environment from .porter/config
+
+    -c
+        The command to send
+
+    -r
+        Only send the command to this region
+
+    -instance
+        Only send the command to this instance
+
+    -arg
+        A command argument. Repeat it for more than one
+
+    --yes
+        Skip the environment's confirm prompt. See porter build deploy --help`
+}
+
+func (recv *FleetSendCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *FleetSendCmd) Execute(args []string) bool {
+
+	if len(args) > 0 {
+		var env, command, region, instanceId string
+		var yes bool
+		commandArgs := make(commandArgs)
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&env, "e", "", "")
+		flagSet.StringVar(&command, "c", "", "")
+		flagSet.StringVar(&region, "r", "", "")
+		flagSet.StringVar(&instanceId, "instance", "", "")
+		flagSet.Var(commandArgs, "arg", "")
+		flagSet.BoolVar(&yes, "yes", false, "")
+		flagSet.Usage = func() {
+			fmt.Println(recv.LongHelp())
+		}
+		flagSet.Parse(args)
+
+		switch command {
+		case constants.CommandRefreshSecrets, constants.CommandDrain, constants.CommandLogLevel:
+		default:
+			return false
+		}
+
+		if env == "" {
+			return false
+		}
+
+		if !fleetSend(env, command, region, instanceId, commandArgs, yes) {
+			os.Exit(1)
+		}
+		return true
+	}
+
+	return false
+}
+
+func fleetSend(env, command, region, instanceId string, args map[string]string, yes bool) (success bool) {
+	log := logger.CLI("cmd", "fleet-send", "Command", command)
+
+	config, getConfigSuccess := conf.GetConfig(log, true)
+	if !getConfigSuccess {
+		return
+	}
+
+	environment, err := config.GetEnvironment(env)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	if !environment.CommandQueue {
+		log.Error("The environment doesn't have command_queue enabled", "Environment", environment.Name)
+		return
+	}
+
+	if !confirmEnvironment(log, environment, yes) {
+		return
+	}
+
+	deployments, err := provision.GetStateStore(config).List(config.ServiceName, environment.Name)
+	if err != nil {
+		log.Error("State store List", "Error", err)
+		return
+	}
+
+	sent := 0
+	for _, deployment := range deployments {
+
+		if region != "" && deployment.Region != region {
+			continue
+		}
+
+		regionLog := log.New("Region", deployment.Region, "StackId", deployment.StackId)
+
+		switch deployment.Status {
+		case provision_state.StatusProvisioned, provision_state.StatusPromoted:
+		default:
+			regionLog.Warn("Skipping region whose latest deploy isn't provisioned", "Status", deployment.Status)
+			continue
+		}
+
+		roleSession, ok := refreshRoleSession(regionLog, environment, deployment.Region)
+		if !ok {
+			return
+		}
+
+		regionSent, ok := sendRegionCommand(regionLog, roleSession, config.ServiceName, environment.Name,
+			deployment.StackId, command, instanceId, args)
+		if !ok {
+			return
+		}
+		sent += regionSent
+	}
+
+	if sent == 0 {
+		log.Error("No instance was sent the command")
+		return
+	}
+
+	log.Info("Sent command", "Instances", sent)
+	success = true
+	return
+}
+
+// sendRegionCommand sends the command to the command queues of the InService
+// instances of the stack, or only instanceId if it's set
+func sendRegionCommand(log log15.Logger, roleSession *session.Session, serviceName, environmentName,
+	stackId, command, instanceId string, args map[string]string) (sent int, success bool) {
+
+	cfnClient := cloudformation.New(roleSession)
+
+	log.Info("cloudformation:DescribeStacks")
+	describeStacksOutput, err := cfnClient.DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(stackId),
+	})
+	if err != nil {
+		log.Error("cloudformation:DescribeStacks", "Error", err)
+		return
+	}
+	if len(describeStacksOutput.Stacks) != 1 {
+		log.Error("len(describeStacksOutput.Stacks != 1)")
+		return
+	}
+
+	secretsKey, ok := secrets.StackKey(log, roleSession, describeStacksOutput.Stacks[0])
+	if !ok {
+		return
+	}
+	signingKey := command_queue.SigningKey(secretsKey)
+
+	var signalQueueUrl string
+	var asgNames []string
+
+	if !getQueueUrlAndAsgNames(log, roleSession, stackId, &signalQueueUrl, &asgNames) {
+		return
+	}
+
+	asgClient := autoscaling.New(roleSession)
+	sqsClient := sqs.New(roleSession)
+
+	for _, asgName := range asgNames {
+
+		log.Info("autoscaling:DescribeAutoScalingGroups")
+		groupsOutput, err := asgClient.DescribeAutoScalingGroups(&autoscalinglib.DescribeAutoScalingGroupsInput{
+			AutoScalingGroupNames: []*string{aws.String(asgName)},
+		})
+		if err != nil {
+			log.Error("autoscaling:DescribeAutoScalingGroups", "Error", err, "PhysicalId", asgName)
+			return
+		}
+
+		for _, group := range groupsOutput.AutoScalingGroups {
+			for _, instance := range group.Instances {
+
+				if aws.StringValue(instance.LifecycleState) != autoscalinglib.LifecycleStateInService {
+					continue
+				}
+
+				target := aws.StringValue(instance.InstanceId)
+				if instanceId != "" && target != instanceId {
+					continue
+				}
+
+				queueName := command_queue.QueueName(serviceName, environmentName, target)
+				queueUrlOutput, err := sqsClient.GetQueueUrl(&sqs.GetQueueUrlInput{
+					QueueName: aws.String(queueName),
+				})
+				if err != nil {
+					// instances of a stack deployed before command_queue was
+					// enabled, or still booting, have no queue yet
+					if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == nonExistentQueueCode {
+						log.Warn("The instance has no command queue", "InstanceId", target, "QueueName", queueName)
+						continue
+					}
+					log.Error("sqs:GetQueueUrl", "Error", err, "QueueName", queueName)
+					return
+				}
+
+				cmd, err := command_queue.New(command, target, args)
+				if err != nil {
+					log.Error("command_queue.New", "Error", err)
+					return
+				}
+
+				err = cmd.Sign(signingKey)
+				if err != nil {
+					log.Error("Sign", "Error", err)
+					return
+				}
+
+				body, err := cmd.Marshal()
+				if err != nil {
+					log.Error("Marshal", "Error", err)
+					return
+				}
+
+				_, err = sqsClient.SendMessage(&sqs.SendMessageInput{
+					QueueUrl:    queueUrlOutput.QueueUrl,
+					MessageBody: aws.String(body),
+				})
+				if err != nil {
+					log.Error("sqs:SendMessage", "Error", err, "InstanceId", target)
+					return
+				}
+
+				log.Info("Sent command", "InstanceId", target, "CommandId", cmd.Id)
+				sent++
+			}
+		}
+	}
+
+	success = true
+	return
+}
@@ -0,0 +1,198 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/adobe-platform/porter/aws/ssm"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/fleet_config"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/phylake/go-cli"
+)
+
+type FleetSetConfigCmd struct{}
+
+func (recv *FleetSetConfigCmd) Name() string {
+	return "set-config"
+}
+
+func (recv *FleetSetConfigCmd) ShortHelp() string {
+	return "Change runtime config on the instances of an environment"
+}
+
+func (recv *FleetSetConfigCmd) LongHelp() string {
+	return `NAME
+    set-config -- Change runtime config on the instances of an environment
+
+SYNOPSIS
+    set-config -e <environment> [-r <region>] [--yes] <key>=<value>...
+
+DESCRIPTION
+    Set small runtime values like an app's log level on every host of the
+    environment without a deploy. An empty value like <key>= removes the key.
+
+    Values are stored in the SSM parameter
+    /porter/<service name>/<environment>/runtime-config in each region so
+    they outlive deploys. porterd reads the parameter every
+    ` + constants.RuntimeConfigPollInterval.String() + ` and containers read the latest values as a JSON object
+    from porterd:
+
+        curl "http://$PORTERD_TCP_ADDR:$PORTERD_TCP_PORT` + constants.RuntimeConfigPath + `"
+
+    All values together must fit in ` + fmt.Sprint(constants.RuntimeConfigMaxSize) + ` bytes of JSON.
+
+OPTIONS
+    -e
+        Environment from .porter/config
+
+    -r
+        Only change this region
+
+    --yes
+        Skip the environment's confirm prompt. See porter build deploy --help`
+}
+
+func (recv *FleetSetConfigCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *FleetSetConfigCmd) Execute(args []string) bool {
+
+	if len(args) > 0 {
+		var env, region string
+		var yes bool
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&env, "e", "", "")
+		flagSet.StringVar(&region, "r", "", "")
+		flagSet.BoolVar(&yes, "yes", false, "")
+		flagSet.Usage = func() {
+			fmt.Println(recv.LongHelp())
+		}
+		flagSet.Parse(args)
+
+		if env == "" || flagSet.NArg() == 0 {
+			return false
+		}
+
+		if !fleetSetConfig(env, region, flagSet.Args(), yes) {
+			os.Exit(1)
+		}
+		return true
+	}
+
+	return false
+}
+
+func fleetSetConfig(env, region string, pairs []string, yes bool) (success bool) {
+	log := logger.CLI("cmd", "fleet-set-config")
+
+	// fail before any region is changed
+	if err := make(fleet_config.Values).Apply(pairs); err != nil {
+		log.Error("Invalid runtime config", "Error", err)
+		return
+	}
+
+	config, getConfigSuccess := conf.GetConfig(log, true)
+	if !getConfigSuccess {
+		return
+	}
+
+	environment, err := config.GetEnvironment(env)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	if !confirmEnvironment(log, environment, yes) {
+		return
+	}
+
+	name := fleet_config.ParameterName(config.ServiceName, environment.Name)
+	changed := 0
+
+	for _, envRegion := range environment.Regions {
+
+		if region != "" && envRegion.Name != region {
+			continue
+		}
+
+		regionLog := log.New("Region", envRegion.Name, "Name", name)
+
+		roleSession, ok := refreshRoleSession(regionLog, environment, envRegion.Name)
+		if !ok {
+			return
+		}
+		client := ssm.New(roleSession)
+
+		// read-modify-write so keys set by someone else are kept
+		var current string
+		regionLog.Info("ssm:GetParameter")
+		output, err := client.GetParameter(&ssm.GetParameterInput{Name: name})
+		if err != nil {
+			if awsErr, ok := err.(awserr.Error); !ok || awsErr.Code() != ssm.ErrCodeParameterNotFound {
+				regionLog.Error("ssm:GetParameter", "Error", err)
+				return
+			}
+		} else {
+			current = output.Parameter.Value
+		}
+
+		values, err := fleet_config.Parse(current)
+		if err != nil {
+			regionLog.Error("The runtime config parameter is malformed", "Error", err)
+			return
+		}
+
+		err = values.Apply(pairs)
+		if err != nil {
+			regionLog.Error("Invalid runtime config", "Error", err)
+			return
+		}
+
+		value, err := values.Marshal()
+		if err != nil {
+			regionLog.Error("Marshal", "Error", err)
+			return
+		}
+
+		regionLog.Info("ssm:PutParameter")
+		putOutput, err := client.PutParameter(&ssm.PutParameterInput{
+			Name:        name,
+			Description: "porter fleet set-config",
+			Type:        ssm.ParameterTypeString,
+			Value:       value,
+			Overwrite:   true,
+		})
+		if err != nil {
+			regionLog.Error("ssm:PutParameter", "Error", err)
+			return
+		}
+
+		regionLog.Info("Changed runtime config", "Version", putOutput.Version, "Keys", values.Keys())
+		changed++
+	}
+
+	if changed == 0 {
+		log.Error("No region was changed")
+		return
+	}
+
+	log.Info("Instances pick up the change within " + constants.RuntimeConfigPollInterval.String())
+	success = true
+	return
+}
@@ -15,13 +15,31 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"sort"
+	"sync"
 
+	"github.com/adobe-platform/porter/conf"
 	"github.com/adobe-platform/porter/constants"
 	"github.com/adobe-platform/porter/hook"
 	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/inconshreveable/log15"
 	"github.com/phylake/go-cli"
 )
 
+// the most hook results kept on a deployment in the state store
+const maxHookResults = 50
+
+var (
+	// results of hooks that ran before a region had a stack, like
+	// pre_provision, by environment and region. They're recorded with the
+	// region's next results or by flushHookResults. Hooks that ran without an
+	// environment, like pre_pack, are under "/"
+	pendingHookResults     = make(map[string][]provision_state.HookResult)
+	pendingHookResultsLock sync.Mutex
+)
+
 type HookCmd struct{}
 
 func (recv *HookCmd) Name() string {
@@ -77,6 +95,8 @@ func (recv *HookCmd) Execute(args []string) bool {
 			constants.HookPostPromote,
 			constants.HookPrePrune,
 			constants.HookPostPrune,
+			constants.HookPostRollback,
+			constants.HookMigrate,
 			constants.HookEC2Bootstrap:
 			log.Warn(fmt.Sprintf("The hook %s is reserved because it is called automatically", hookName))
 			log.Warn("Please remove the call to this hook. It will still be called by porter")
@@ -97,3 +117,130 @@ func (recv *HookCmd) Execute(args []string) bool {
 func (recv *HookCmd) SubCommands() []cli.Command {
 	return nil
 }
+
+// runHook runs an environment's hooks and records their results on each
+// region's deployment in the state store
+func runHook(log log15.Logger, hookName, environment string,
+	provisionedRegions map[string]*provision_state.Region, commandSuccess bool) bool {
+
+	results, success := hook.ExecuteWithResults(log, hookName, environment,
+		provisionedRegions, commandSuccess)
+
+	recordHookResults(log, environment, provisionedRegions, results)
+	return success
+}
+
+func recordHookResults(log log15.Logger, environment string,
+	provisionedRegions map[string]*provision_state.Region, results []provision_state.HookResult) {
+
+	if len(results) == 0 {
+		return
+	}
+
+	config, getConfigSuccess := conf.GetConfig(log, false)
+	if !getConfigSuccess {
+		return
+	}
+
+	regionResults := make(map[string][]provision_state.HookResult)
+	for _, result := range results {
+		regionResults[result.Region] = append(regionResults[result.Region], result)
+	}
+
+	pendingHookResultsLock.Lock()
+	defer pendingHookResultsLock.Unlock()
+
+	store := provision.GetStateStore(config)
+
+	for regionName, results := range regionResults {
+		regionLog := log.New("Region", regionName)
+		pendingKey := environment + "/" + regionName
+
+		results = append(pendingHookResults[pendingKey], results...)
+
+		var stackId string
+		if regionState, exists := provisionedRegions[regionName]; exists {
+			stackId = regionState.StackId
+		}
+
+		var deployment *provision_state.Deployment
+		if stackId != "" {
+			var err error
+			deployment, err = store.Get(config.ServiceName, environment, regionName)
+			if err != nil {
+				regionLog.Warn("Failed to read deployment", "Error", err)
+			}
+		}
+
+		if deployment == nil || deployment.StackId != stackId {
+			pendingHookResults[pendingKey] = results
+			continue
+		}
+		delete(pendingHookResults, pendingKey)
+
+		appendHookResults(regionLog, store, deployment, results)
+	}
+}
+
+// flushHookResults records the results still pending when a deploy of the
+// environment finishes on each region's latest deployment. Results of hooks
+// that ran without an environment, like pre_pack, are recorded on every
+// region. A region without a deployment drops its results
+func flushHookResults(log log15.Logger, environment string) {
+	pendingHookResultsLock.Lock()
+	defer pendingHookResultsLock.Unlock()
+
+	if len(pendingHookResults) == 0 {
+		return
+	}
+
+	config, getConfigSuccess := conf.GetConfig(log, false)
+	if !getConfigSuccess {
+		return
+	}
+
+	env, err := config.GetEnvironment(environment)
+	if err != nil {
+		log.Warn("GetEnvironment", "Error", err)
+		return
+	}
+
+	store := provision.GetStateStore(config)
+	shared := pendingHookResults["/"]
+
+	for _, region := range env.Regions {
+		regionLog := log.New("Region", region.Name)
+		pendingKey := environment + "/" + region.Name
+
+		results := append(append([]provision_state.HookResult{}, shared...), pendingHookResults[pendingKey]...)
+		delete(pendingHookResults, pendingKey)
+		if len(results) == 0 {
+			continue
+		}
+
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].Time.Before(results[j].Time)
+		})
+
+		deployment, err := store.Get(config.ServiceName, environment, region.Name)
+		if err != nil || deployment == nil {
+			regionLog.Warn("Dropping hook results of a region without a deployment", "Count", len(results), "Error", err)
+			continue
+		}
+
+		appendHookResults(regionLog, store, deployment, results)
+	}
+
+	delete(pendingHookResults, "/")
+}
+
+func appendHookResults(log log15.Logger, store provision_state.Store,
+	deployment *provision_state.Deployment, results []provision_state.HookResult) {
+
+	deployment.Hooks = append(deployment.Hooks, results...)
+	if len(deployment.Hooks) > maxHookResults {
+		deployment.Hooks = deployment.Hooks[len(deployment.Hooks)-maxHookResults:]
+	}
+
+	provision.RecordDeployment(log, store, deployment)
+}
@@ -0,0 +1,206 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adobe-platform/porter/aws/autoscaling"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	autoscalinglib "github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/inconshreveable/log15"
+)
+
+// how many of an ASG's latest scaling activities are checked
+const interlockScalingActivities = 20
+
+// checkHotswapInterlock refuses to hot swap while anything else is changing
+// the stack's instances. Hot swapping reloads every instance at once so
+// overlapping it with another hot swap, a scale out or in, or an instance
+// refresh can leave no instance serving traffic
+func checkHotswapInterlock(log log15.Logger, config *conf.Config,
+	environment *conf.Environment, stack provision_state.Stack) (success bool) {
+
+	held, err := provision.GetStateStore(config).GetLock(config.ServiceName, environment.Name)
+	if err != nil {
+		log.Error("State store GetLock", "Error", err)
+		return
+	}
+
+	if held != nil && !holdsLock(held) {
+		log.Error("Another deploy of the environment holds its lock",
+			"Environment", environment.Name,
+			"Owner", held.Owner,
+			"Host", held.Host,
+			"Command", held.Command,
+			"AcquiredAt", held.AcquiredAt.Format(time.RFC3339))
+		return
+	}
+
+	type regionResult struct {
+		regionName string
+		inFlight   []string
+		success    bool
+	}
+
+	resultChan := make(chan regionResult)
+
+	for regionName, regionState := range stack.Regions {
+
+		go func(regionName string, regionState *provision_state.Region) {
+
+			regionLog := log.New("Region", regionName)
+			result := regionResult{regionName: regionName}
+
+			roleSession, ok := refreshRoleSession(regionLog, environment, regionName)
+			if ok {
+				result.inFlight, result.success = regionInFlight(regionLog, roleSession, regionState.StackId)
+			}
+
+			resultChan <- result
+
+		}(regionName, regionState)
+	}
+
+	success = true
+	for i := 0; i < len(stack.Regions); i++ {
+		result := <-resultChan
+
+		if !result.success {
+			success = false
+			continue
+		}
+
+		for _, inFlight := range result.inFlight {
+			success = false
+			log.Error("Activity in progress", "Region", result.regionName, "Activity", inFlight)
+		}
+	}
+
+	if !success {
+		log.Error("Refusing to hot swap while instances are changing. Try again once the activity has finished")
+	}
+	return
+}
+
+// regionInFlight describes everything changing the instances of the stack's
+// ASGs and their ELBs
+func regionInFlight(log log15.Logger, roleSession *session.Session,
+	stackId string) (inFlight []string, success bool) {
+
+	var queueUrl string
+	var asgNames []string
+
+	if !getQueueUrlAndAsgNames(log, roleSession, stackId, &queueUrl, &asgNames) {
+		return
+	}
+
+	asgClient := autoscaling.New(roleSession)
+	elbClient := elb.New(roleSession)
+
+	inFlight = make([]string, 0)
+
+	for _, asgName := range asgNames {
+
+		asgLog := log.New("PhysicalId", asgName)
+
+		log.Info("autoscaling:DescribeAutoScalingGroups")
+		groupsOutput, err := asgClient.DescribeAutoScalingGroups(&autoscalinglib.DescribeAutoScalingGroupsInput{
+			AutoScalingGroupNames: []*string{aws.String(asgName)},
+		})
+		if err != nil {
+			asgLog.Error("autoscaling:DescribeAutoScalingGroups", "Error", err)
+			return
+		}
+
+		elbNames := make([]*string, 0)
+		for _, group := range groupsOutput.AutoScalingGroups {
+			for _, instance := range group.Instances {
+
+				switch aws.StringValue(instance.LifecycleState) {
+				case autoscalinglib.LifecycleStateInService, autoscalinglib.LifecycleStateStandby:
+				default:
+					inFlight = append(inFlight, fmt.Sprintf("%s instance %s is %s",
+						asgName, aws.StringValue(instance.InstanceId), aws.StringValue(instance.LifecycleState)))
+				}
+			}
+
+			elbNames = append(elbNames, group.LoadBalancerNames...)
+		}
+
+		log.Info("autoscaling:DescribeScalingActivities")
+		activitiesOutput, err := asgClient.DescribeScalingActivities(&autoscalinglib.DescribeScalingActivitiesInput{
+			AutoScalingGroupName: aws.String(asgName),
+			MaxRecords:           aws.Int64(interlockScalingActivities),
+		})
+		if err != nil {
+			asgLog.Error("autoscaling:DescribeScalingActivities", "Error", err)
+			return
+		}
+
+		for _, activity := range activitiesOutput.Activities {
+
+			switch aws.StringValue(activity.StatusCode) {
+			case autoscalinglib.ScalingActivityStatusCodeSuccessful,
+				autoscalinglib.ScalingActivityStatusCodeFailed,
+				autoscalinglib.ScalingActivityStatusCodeCancelled:
+			default:
+				inFlight = append(inFlight, fmt.Sprintf("%s scaling activity %s: %s",
+					asgName, aws.StringValue(activity.StatusCode), aws.StringValue(activity.Description)))
+			}
+		}
+
+		log.Info("autoscaling:DescribeInstanceRefreshes")
+		instanceRefresh, err := autoscaling.ActiveInstanceRefresh(asgClient, asgName)
+		if err != nil {
+			asgLog.Error("autoscaling:DescribeInstanceRefreshes", "Error", err)
+			return
+		}
+
+		if instanceRefresh != nil {
+			inFlight = append(inFlight, fmt.Sprintf("%s instance refresh %s is %s",
+				asgName, aws.StringValue(instanceRefresh.InstanceRefreshId), aws.StringValue(instanceRefresh.Status)))
+		}
+
+		for _, elbName := range elbNames {
+
+			log.Info("elb:DescribeInstanceHealth")
+			healthOutput, err := elbClient.DescribeInstanceHealth(&elb.DescribeInstanceHealthInput{
+				LoadBalancerName: elbName,
+			})
+			if err != nil {
+				asgLog.Error("elb:DescribeInstanceHealth", "Error", err, "LoadBalancerName", aws.StringValue(elbName))
+				return
+			}
+
+			// registration and deregistration say "in progress"
+			for _, instanceState := range healthOutput.InstanceStates {
+				description := aws.StringValue(instanceState.Description)
+
+				if strings.Contains(description, "in progress") {
+					inFlight = append(inFlight, fmt.Sprintf("%s instance %s: %s",
+						aws.StringValue(elbName), aws.StringValue(instanceState.InstanceId), description))
+				}
+			}
+		}
+	}
+
+	success = true
+	return
+}
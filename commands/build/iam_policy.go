@@ -0,0 +1,218 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/iam_policy"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/phylake/go-cli"
+)
+
+type IAMPolicyCmd struct{}
+
+func (recv *IAMPolicyCmd) Name() string {
+	return "iam-policy"
+}
+
+func (recv *IAMPolicyCmd) ShortHelp() string {
+	return "Generate least-privilege IAM policies for an environment"
+}
+
+func (recv *IAMPolicyCmd) LongHelp() string {
+	return `NAME
+    iam-policy -- Generate least-privilege IAM policies for an environment
+
+SYNOPSIS
+    iam-policy --environment <environment out of .porter/config> [-o <directory>]
+
+DESCRIPTION
+    Render the CloudFormation template provision would deploy to each region
+    of the environment and print the IAM policy documents the environment
+    needs instead of granting porter admin-level access.
+
+    deployer
+        For the environment's role_arn. The calls porter makes itself for
+        the features the environment uses, scoped to the service's stacks,
+        buckets, keys, and repositories where IAM allows it, and the calls
+        CloudFormation makes to create the template's resources
+
+    cloudformation
+        Only with cfn_role_arn. The calls CloudFormation makes to create the
+        template's resources move from the deployer to the service role and
+        the deployer can pass the role
+
+    instance_role
+        The inline policies of the role the template generates for instances.
+        porter creates it. Review it, don't create it
+
+    Resource types porter doesn't know the calls for are listed in
+    unmapped_resource_types. Add their calls to the deployer or cloudformation
+    policy by hand.
+
+    Run after porter build pack to use the packed config. iam-policy always
+    runs in read-only mode so it can be run with read-only credentials.
+
+OPTIONS
+    -e, --environment
+        Environment from .porter/config
+
+    -o
+        Write deployer.json, cloudformation.json, and instance_role.json to
+        the directory instead of printing the documents`
+}
+
+func (recv *IAMPolicyCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *IAMPolicyCmd) Execute(args []string) bool {
+
+	if len(args) > 0 {
+		var environment, outputDir string
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&environment, "e", "", "")
+		flagSet.StringVar(&environment, "environment", "", "")
+		flagSet.StringVar(&outputDir, "o", "", "")
+		flagSet.Usage = func() {
+			fmt.Println(recv.LongHelp())
+		}
+		flagSet.Parse(args)
+
+		if environment == "" {
+			return false
+		}
+
+		if !generateIAMPolicies(environment, outputDir) {
+			os.Exit(1)
+		}
+		return true
+	}
+
+	return false
+}
+
+func generateIAMPolicies(env, outputDir string) (success bool) {
+	log := logger.CLI("cmd", "iam-policy")
+
+	aws_session.EnableReadOnly()
+
+	var (
+		config           *conf.Config
+		getConfigSuccess bool
+	)
+
+	if _, err := os.Stat(constants.AlteredConfigPath); err == nil {
+		config, getConfigSuccess = conf.GetAlteredConfig(log)
+	} else {
+		config, getConfigSuccess = conf.GetConfig(log, true)
+	}
+	if !getConfigSuccess {
+		return
+	}
+
+	environment, err := config.GetEnvironment(env)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	templates := make(map[string]iam_policy.Template)
+
+	for _, region := range environment.Regions {
+		regionLog := log.New("Region", region.Name)
+
+		roleARN, err := environment.GetRoleARN(region.Name)
+		if err != nil {
+			regionLog.Error("GetRoleARN", "Error", err)
+			return
+		}
+
+		roleSession := aws_session.STS(region.Name, roleARN, 0)
+
+		templateBytes, renderSuccess := provision.RenderTemplate(regionLog, config, environment, region, roleSession)
+		if !renderSuccess {
+			return
+		}
+
+		templates[region.Name], err = iam_policy.ParseTemplate(templateBytes)
+		if err != nil {
+			regionLog.Error("iam_policy.ParseTemplate", "Error", err)
+			return
+		}
+	}
+
+	policies, err := iam_policy.Generate(config, environment, templates)
+	if err != nil {
+		log.Error("iam_policy.Generate", "Error", err)
+		return
+	}
+
+	for _, resourceType := range policies.UnmappedResourceTypes {
+		log.Warn("Add the calls CloudFormation makes for this resource type by hand", "Type", resourceType)
+	}
+
+	if outputDir == "" {
+		policiesBytes, err := json.MarshalIndent(policies, "", "  ")
+		if err != nil {
+			log.Error("json.MarshalIndent", "Error", err)
+			return
+		}
+
+		fmt.Println(string(policiesBytes))
+		success = true
+		return
+	}
+
+	documents := map[string]interface{}{
+		"deployer.json":      policies.Deployer,
+		"instance_role.json": policies.InstanceRole,
+	}
+	if policies.CloudFormation != nil {
+		documents["cloudformation.json"] = policies.CloudFormation
+	}
+
+	err = os.MkdirAll(outputDir, 0755)
+	if err != nil {
+		log.Error("os.MkdirAll", "Error", err)
+		return
+	}
+
+	for fileName, document := range documents {
+		documentBytes, err := json.MarshalIndent(document, "", "  ")
+		if err != nil {
+			log.Error("json.MarshalIndent", "Error", err)
+			return
+		}
+
+		filePath := filepath.Join(outputDir, fileName)
+		err = ioutil.WriteFile(filePath, documentBytes, 0644)
+		if err != nil {
+			log.Error("ioutil.WriteFile", "Path", filePath, "Error", err)
+			return
+		}
+		log.Info("Wrote policy", "Path", filePath)
+	}
+
+	success = true
+	return
+}
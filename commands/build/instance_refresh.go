@@ -0,0 +1,380 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"context"
+	"time"
+
+	"github.com/adobe-platform/porter/aws/autoscaling"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/events"
+	"github.com/adobe-platform/porter/notify"
+	"github.com/adobe-platform/porter/promote"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	autoscalinglib "github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/inconshreveable/log15"
+)
+
+type launchTemplateVersion struct {
+	version string
+}
+
+// RefreshStack updates the launch template of an existing stack and replaces
+// its instances with an instance refresh.
+//
+// If a refresh fails the stack is updated back to the template and parameters
+// it had before and its instances are refreshed again. The previous stack
+// metadata is what cfn-init installs the previous service payload from
+func RefreshStack(ctx context.Context, log log15.Logger, config *conf.Config,
+	environment *conf.Environment, hotswapStructs []hotswapStruct) (success bool) {
+
+	stack, ok := inPlaceStack(log, environment, hotswapStructs)
+	if !ok {
+		return
+	}
+
+	defer func() {
+
+		log.Debug("defer post-hook execute")
+
+		postHookSuccess := runHook(log, constants.HookPostHotswap,
+			environment.Name, stack.Regions, success)
+
+		success = success && postHookSuccess
+	}()
+
+	if !runHook(log, constants.HookPreHotswap, environment.Name, nil, true) {
+		return
+	}
+
+	// the refresh replaces instances itself. The group replacing or
+	// rebalancing them too can fail the refresh
+	resumeProcesses, ok := suspendDeployProcesses(log, environment, stack)
+	defer resumeProcesses()
+	if !ok {
+		return
+	}
+
+	snapshots := make(map[string]provision.StackSnapshot)
+	for regionName, regionState := range stack.Regions {
+		log := log.New("Region", regionName)
+
+		roleSession, ok := refreshRoleSession(log, environment, regionName)
+		if !ok {
+			return
+		}
+
+		snapshot, ok := provision.SnapshotStack(log, roleSession, regionState.StackId)
+		if !ok {
+			return
+		}
+		snapshots[regionName] = snapshot
+	}
+
+	if !provision.UpdateStack(ctx, log, config, stack) {
+		return
+	}
+
+	successChan := make(chan bool)
+
+	for regionName, regionState := range stack.Regions {
+
+		go func(regionName string, regionState *provision_state.Region) {
+
+			successChan <- refreshRegion(ctx, log.New("Region", regionName), config, environment,
+				regionName, regionState, snapshots[regionName])
+
+		}(regionName, regionState)
+	}
+
+	success = true
+
+	for i := 0; i < len(stack.Regions); i++ {
+		regionSuccess := <-successChan
+		success = success && regionSuccess
+	}
+
+	if success {
+		success = writeProvisionOutput(log, config, stack)
+	}
+
+	if success {
+		log.Info("Instance refresh complete")
+	} else {
+		log.Info("Instance refresh failed")
+	}
+
+	return
+}
+
+func refreshRegion(ctx context.Context, log log15.Logger, config *conf.Config, environment *conf.Environment, regionName string,
+	regionState *provision_state.Region, previous provision.StackSnapshot) (success bool) {
+
+	defer func() {
+		emitStepFailed(ctx, config, environment, regionName, regionState.StackId, "instance refresh", success)
+	}()
+
+	var (
+		queueUrl string
+		asgNames []string
+	)
+
+	roleSession, ok := refreshRoleSession(log, environment, regionName)
+	if !ok {
+		return
+	}
+
+	cfnClient := cloudformation.New(aws_session.WithContext(ctx, roleSession))
+
+	log.Info("Waiting for the stack update to complete")
+	err := cfnClient.WaitUntilStackUpdateComplete(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(regionState.StackId),
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			logStopped(log, ctx, regionState.StackId, "Step", "stack update")
+			if rollbackOnCancel(ctx) {
+				cancelStackUpdate(log, environment, regionName, regionState.StackId)
+			}
+			return
+		}
+		log.Error("WaitUntilStackUpdateComplete", "Error", err)
+		return
+	}
+
+	current, ok := getLaunchTemplateVersion(log, roleSession, regionState.StackId)
+	if !ok {
+		return
+	}
+	if current.version == "" {
+		log.Error("The stack doesn't output its launch template version")
+		return
+	}
+
+	if !getQueueUrlAndAsgNames(log, roleSession, regionState.StackId, &queueUrl, &asgNames) {
+		return
+	}
+
+	if len(asgNames) != 1 {
+		log.Error("instance_refresh requires a stack with one autoscaling group", "Count", len(asgNames))
+		return
+	}
+	asgName := asgNames[0]
+
+	asgClient := autoscaling.New(roleSession)
+	log = log.New("AutoScalingGroupName", asgName)
+
+	if runInstanceRefresh(ctx, log.New("LaunchTemplateVersion", current.version), asgClient, asgName,
+		environment.InstanceRefresh) {
+
+		success = provision.EnsureMonitoringStack(log, roleSession, config, environment, regionName, regionState.StackId) &&
+			syncInstanceDNS(log, config, environment, regionName, roleSession)
+		if success {
+			events.Emit(events.StackUpdated{
+				Header:  stackEventHeader(config, environment, regionName, regionState.StackId),
+				StackId: regionState.StackId,
+			})
+		}
+		return
+	}
+
+	// a stopped deploy doesn't start another instance refresh
+	if ctx.Err() != nil {
+		return
+	}
+
+	log.Warn("Rolling back the stack to its previous template and parameters")
+
+	if !provision.RestoreStack(ctx, log, config, environment, regionName, roleSession, previous) {
+		log.Error("Rollback failed")
+		return
+	}
+
+	// the restore updated the launch template again so the version the group
+	// is refreshed to is a new one with the previous configuration
+	restored, ok := getLaunchTemplateVersion(log, roleSession, regionState.StackId)
+	if !ok {
+		return
+	}
+
+	if runInstanceRefresh(ctx, log.New("LaunchTemplateVersion", restored.version), asgClient, asgName,
+		environment.InstanceRefresh) {
+
+		log.Warn("Rolled back. Provision again to deploy the new version")
+		recordRollback(regionName, regionState.StackId)
+		notify.Publish(log, config, environment, notify.Event{
+			Event:   constants.EventRolledBack,
+			Region:  regionName,
+			StackId: regionState.StackId,
+			Message: "instance refresh failed",
+		})
+		events.Emit(events.RolledBack{
+			Header:  stackEventHeader(config, environment, regionName, regionState.StackId),
+			StackId: regionState.StackId,
+			Reason:  "instance refresh failed",
+		})
+		syncInstanceDNS(log, config, environment, regionName, roleSession)
+	} else {
+		log.Error("Rollback failed")
+	}
+
+	return
+}
+
+// syncInstanceDNS replaces the records of instances the refresh terminated
+// with the records of their replacements when dns targets instances. porterd
+// on each replacement registers it too but not before its first health check
+func syncInstanceDNS(log log15.Logger, config *conf.Config, environment *conf.Environment,
+	regionName string, roleSession *session.Session) (success bool) {
+
+	region, err := environment.GetRegion(regionName)
+	if err != nil {
+		log.Error("GetRegion", "Error", err)
+		return
+	}
+
+	if !region.DNSToInstances() {
+		success = true
+		return
+	}
+
+	success = promote.SyncInstances(log, roleSession, config.ServiceName, environment.Name, region)
+	return
+}
+
+// runInstanceRefresh replaces the group's instances with ones of the launch
+// template version the stack set on the group
+func runInstanceRefresh(ctx context.Context, log log15.Logger, asgClient *autoscalinglib.AutoScaling, asgName string,
+	refresh *conf.InstanceRefresh) (success bool) {
+
+	instanceRefreshId, err := autoscaling.StartInstanceRefresh(asgClient, asgName,
+		*refresh.MinHealthyPercentage, *refresh.InstanceWarmup)
+	if err != nil {
+		log.Error("autoscaling:StartInstanceRefresh", "Error", err)
+		return
+	}
+
+	log = log.New("InstanceRefreshId", instanceRefreshId)
+	log.Info("Started instance refresh")
+
+	timeout := time.After(constants.InstanceRefreshTimeout)
+
+	for {
+		select {
+		case <-timeout:
+			log.Error("Timed out waiting for the instance refresh")
+
+			err = autoscaling.CancelInstanceRefresh(asgClient, asgName)
+			if err != nil {
+				log.Error("autoscaling:CancelInstanceRefresh", "Error", err)
+			}
+			return
+		case <-ctx.Done():
+			logStopped(log, ctx, "", "Step", "instance refresh")
+
+			if rollbackOnCancel(ctx) {
+				log.Warn("Cancelling the instance refresh")
+
+				err = autoscaling.CancelInstanceRefresh(asgClient, asgName)
+				if err != nil {
+					log.Error("autoscaling:CancelInstanceRefresh", "Error", err)
+				}
+			}
+			return
+		case <-time.After(sleepDuration):
+		}
+
+		instanceRefresh, err := autoscaling.DescribeInstanceRefresh(asgClient, asgName, instanceRefreshId)
+		if err != nil {
+			log.Error("autoscaling:DescribeInstanceRefreshes", "Error", err)
+			continue
+		}
+
+		status := *instanceRefresh.Status
+
+		switch status {
+		case autoscaling.InstanceRefreshSuccessful:
+			success = true
+			return
+
+		case autoscaling.InstanceRefreshPending,
+			autoscaling.InstanceRefreshInProgress:
+
+			var percentComplete int64
+			if instanceRefresh.PercentageComplete != nil {
+				percentComplete = *instanceRefresh.PercentageComplete
+			}
+			log.Info("Instance refresh progress", "Status", status, "PercentageComplete", percentComplete)
+
+		case autoscaling.InstanceRefreshCancelling:
+			log.Warn("Instance refresh is being cancelled")
+
+		default:
+			var reason string
+			if instanceRefresh.StatusReason != nil {
+				reason = *instanceRefresh.StatusReason
+			}
+			log.Error("Instance refresh did not succeed", "Status", status, "StatusReason", reason)
+			return
+		}
+	}
+}
+
+func refreshRoleSession(log log15.Logger, environment *conf.Environment, regionName string) (*session.Session, bool) {
+	roleARN, err := environment.GetRoleARN(regionName)
+	if err != nil {
+		log.Error("GetRoleARN", "Error", err)
+		return nil, false
+	}
+
+	return aws_session.STS(regionName, roleARN, 0), true
+}
+
+// getLaunchTemplateVersion reads the launch template outputs of a stack. The
+// version is empty if the stack was provisioned without them
+func getLaunchTemplateVersion(log log15.Logger, roleSession *session.Session,
+	stackId string) (ltVersion launchTemplateVersion, success bool) {
+
+	cfnClient := cloudformation.New(roleSession)
+
+	output, err := cfnClient.DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(stackId),
+	})
+	if err != nil {
+		log.Error("cloudformation:DescribeStacks", "Error", err)
+		return
+	}
+	if len(output.Stacks) != 1 {
+		log.Error("len(describeStacksOutput.Stacks != 1)")
+		return
+	}
+
+	for _, stackOutput := range output.Stacks[0].Outputs {
+		if stackOutput.OutputKey == nil || stackOutput.OutputValue == nil {
+			continue
+		}
+
+		if *stackOutput.OutputKey == constants.OutputLaunchTemplateVersion {
+			ltVersion.version = *stackOutput.OutputValue
+		}
+	}
+
+	success = true
+	return
+}
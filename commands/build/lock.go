@@ -0,0 +1,134 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"sync"
+	"time"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/inconshreveable/log15"
+)
+
+var (
+	// the deploy locks this process holds by environment
+	heldLocks     = make(map[string]string)
+	heldLocksLock sync.Mutex
+)
+
+// lockEnvironment acquires the environment's deploy lock in the state store
+// and then a deploy_concurrency slot if there's a limit. unlock must be called
+// when the deploy is done whether or not it succeeded. forceUnlock releases a
+// lock left behind by a deploy that died first
+func lockEnvironment(log log15.Logger, config *conf.Config, env string,
+	forceUnlock bool) (unlock func(), success bool) {
+
+	environment, err := config.GetEnvironment(env)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	store := provision.GetStateStore(config)
+
+	if forceUnlock {
+		held, err := store.GetLock(config.ServiceName, environment.Name)
+		if err != nil {
+			log.Error("State store GetLock", "Error", err)
+			return
+		}
+
+		if held != nil {
+			log.Warn("Forcing the deploy lock open",
+				"Environment", environment.Name,
+				"Owner", held.Owner,
+				"Host", held.Host,
+				"AcquiredAt", held.AcquiredAt.Format(time.RFC3339))
+
+			err = store.Unlock(held)
+			if err != nil {
+				log.Error("State store Unlock", "Error", err)
+				return
+			}
+		}
+
+		if !forceUnlockMigration(log, store, config, environment) {
+			return
+		}
+	}
+
+	lock := provision.NewLock(config, environment.Name)
+
+	held, err := store.Lock(lock)
+	if err != nil {
+		log.Error("State store Lock", "Error", err)
+		return
+	}
+
+	if held != nil {
+		log.Error("Another deploy of the environment is running. If it died run again with --force-unlock",
+			"Environment", environment.Name,
+			"Owner", held.Owner,
+			"Host", held.Host,
+			"Command", held.Command,
+			"GitSHA", held.GitSHA,
+			"ServiceVersion", held.ServiceVersion,
+			"AcquiredAt", held.AcquiredAt.Format(time.RFC3339))
+		return
+	}
+
+	log.Info("Acquired deploy lock", "Environment", environment.Name)
+
+	releaseSlots, slotsSuccess := acquireDeploySlots(log, config, environment, lock)
+	if !slotsSuccess {
+		if err := store.Unlock(lock); err != nil {
+			log.Warn("Failed to release the deploy lock. Release it with --force-unlock",
+				"Environment", environment.Name,
+				"Error", err)
+		}
+		return
+	}
+
+	heldLocksLock.Lock()
+	heldLocks[environment.Name] = lock.Id
+	heldLocksLock.Unlock()
+
+	unlock = func() {
+		releaseSlots()
+
+		heldLocksLock.Lock()
+		delete(heldLocks, environment.Name)
+		heldLocksLock.Unlock()
+
+		err := store.Unlock(lock)
+		if err != nil {
+			log.Warn("Failed to release the deploy lock. Release it with --force-unlock",
+				"Environment", environment.Name,
+				"Error", err)
+			return
+		}
+
+		log.Info("Released deploy lock", "Environment", environment.Name)
+	}
+	success = true
+	return
+}
+
+// holdsLock is true if this process acquired the lock
+func holdsLock(lock *provision_state.Lock) bool {
+	heldLocksLock.Lock()
+	defer heldLocksLock.Unlock()
+
+	return heldLocks[lock.Environment] == lock.Id
+}
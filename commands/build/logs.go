@@ -0,0 +1,435 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adobe-platform/porter/aws/logs"
+	"github.com/adobe-platform/porter/aws/ssm"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/inconshreveable/log15"
+	"github.com/phylake/go-cli"
+)
+
+const (
+	// how often --follow polls for new lines
+	logsPollInterval = 2 * time.Second
+
+	// lines each instance returns per poll without CloudWatch Logs.
+	// GetCommandInvocation truncates output past 24,000 characters
+	ssmLogsTail = 200
+
+	// containers log to this file through rsyslog without CloudWatch Logs
+	hostLogFile = "/var/log/porter.log"
+)
+
+type (
+	LogsCmd struct{}
+
+	logLine struct {
+		time       time.Time
+		instanceId string
+		container  string
+		message    string
+	}
+)
+
+func (recv *LogsCmd) Name() string {
+	return "logs"
+}
+
+func (recv *LogsCmd) ShortHelp() string {
+	return "Tail container logs across the instances of a stack"
+}
+
+func (recv *LogsCmd) LongHelp() string {
+	return `NAME
+    logs -- Tail container logs across the instances of a stack
+
+SYNOPSIS
+    logs -e <environment> [-r <region>] [--container <name>] [--since <duration>]
+         [-f]
+
+DESCRIPTION
+    Print the container logs of every instance of the environment's current
+    stack interleaved by time. Each line is prefixed with its instance and
+    container.
+
+    The stack is the latest provisioned or promoted deploy of the region in
+    the state store. With logging containers enabled lines are read from the
+    stack's container log group. Otherwise they're read from each in service
+    instance's ` + hostLogFile + ` with an SSM Run Command, which needs the SSM
+    agent registered like access ssm does, and only the last ` + fmt.Sprint(ssmLogsTail) + ` lines
+    of each instance are printed per poll. Read-only mode only allows
+    reading the container log group.
+
+OPTIONS
+    -e, --environment
+        Environment from .porter/config
+
+    -r, --region
+        The stack's region. Required when the environment has more than one
+        region
+
+    --container
+        Only print the logs of the container with this name in .porter/config
+
+    --since
+        How far back to start like 10m or 2h. Defaults to 10m
+
+    -f, --follow
+        Keep printing new lines until interrupted`
+}
+
+func (recv *LogsCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *LogsCmd) Execute(args []string) bool {
+
+	if len(args) > 0 {
+		var env, region, containerName string
+		var since time.Duration
+		var follow bool
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&env, "e", "", "")
+		flagSet.StringVar(&env, "environment", "", "")
+		flagSet.StringVar(&region, "r", "", "")
+		flagSet.StringVar(&region, "region", "", "")
+		flagSet.StringVar(&containerName, "container", "", "")
+		flagSet.DurationVar(&since, "since", 10*time.Minute, "")
+		flagSet.BoolVar(&follow, "f", false, "")
+		flagSet.BoolVar(&follow, "follow", false, "")
+		flagSet.Usage = func() {
+			fmt.Println(recv.LongHelp())
+		}
+		flagSet.Parse(args)
+
+		if env == "" {
+			return false
+		}
+
+		if !tailLogs(env, region, containerName, time.Now().Add(-since), follow) {
+			os.Exit(1)
+		}
+		return true
+	}
+
+	return false
+}
+
+func tailLogs(env, region, containerName string, since time.Time, follow bool) (success bool) {
+	log := logger.CLI("cmd", "logs")
+
+	config, getConfigSuccess := conf.GetConfig(log, true)
+	if !getConfigSuccess {
+		return
+	}
+
+	environment, err := config.GetEnvironment(env)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	if environment.Compute == conf.Compute_ECS {
+		log.Error("logs doesn't support ecs. Tasks log to the stack's ECS log group")
+		return
+	}
+
+	region, ok := defaultRegion(log, environment, region)
+	if !ok {
+		return
+	}
+	log = log.New("Region", region)
+
+	stackId, ok := currentStackId(log, config, environment, region)
+	if !ok {
+		return
+	}
+	log = log.New("StackId", stackId)
+
+	roleSession, ok := refreshRoleSession(log, environment, region)
+	if !ok {
+		return
+	}
+
+	var poll func(since time.Time) ([]logLine, bool)
+
+	if environment.Logging != nil && environment.Logging.ShipsContainers() {
+		log.Info("cloudformation:DescribeStackResource")
+		output, err := cloudformation.New(roleSession).DescribeStackResource(&cloudformation.DescribeStackResourceInput{
+			StackName:         aws.String(stackId),
+			LogicalResourceId: aws.String(constants.ContainerLogGroup),
+		})
+		if err != nil {
+			log.Error("cloudformation:DescribeStackResource", "Error", err)
+			return
+		}
+		logGroup := aws.StringValue(output.StackResourceDetail.PhysicalResourceId)
+
+		poll = func(since time.Time) ([]logLine, bool) {
+			return cloudWatchLogLines(log, roleSession, logGroup, containerName, since)
+		}
+	} else {
+		if aws_session.IsReadOnly() {
+			log.Error("Reading each instance's " + hostLogFile + " needs ssm:SendCommand which read-only mode doesn't allow. Enable logging containers to read logs from CloudWatch Logs instead")
+			return
+		}
+
+		log.Info("Logging containers isn't enabled. Reading each instance's " + hostLogFile)
+
+		poll = func(since time.Time) ([]logLine, bool) {
+			instanceIds, ok := inServiceInstanceIds(log, roleSession, stackId)
+			if !ok {
+				return nil, false
+			}
+			return ssmLogLines(log, roleSession, instanceIds, containerName, since)
+		}
+	}
+
+	// lines at the last printed time are printed again by the next poll
+	printed := make(map[logLine]struct{})
+
+	for {
+		lines, ok := poll(since)
+		if !ok {
+			return
+		}
+
+		sort.SliceStable(lines, func(i, j int) bool {
+			return lines[i].time.Before(lines[j].time)
+		})
+
+		for _, line := range lines {
+			if _, exists := printed[line]; exists {
+				continue
+			}
+
+			if line.time.After(since) {
+				since = line.time
+				printed = make(map[logLine]struct{})
+			}
+			printed[line] = struct{}{}
+
+			fmt.Printf("%s %s %s | %s\n", line.time.Format(time.RFC3339),
+				line.instanceId, line.container, line.message)
+		}
+
+		if !follow {
+			break
+		}
+		time.Sleep(logsPollInterval)
+	}
+
+	success = true
+	return
+}
+
+func cloudWatchLogLines(log log15.Logger, roleSession *session.Session, logGroup,
+	containerName string, since time.Time) ([]logLine, bool) {
+
+	client := logs.New(roleSession)
+
+	input := &logs.FilterLogEventsInput{
+		LogGroupName: logGroup,
+		StartTime:    since.UnixNano() / int64(time.Millisecond),
+	}
+	if containerName != "" {
+		input.LogStreamNamePrefix = containerName + "/"
+	}
+
+	lines := make([]logLine, 0)
+	for {
+		output, err := client.FilterLogEvents(input)
+		if err != nil {
+			log.Error("logs:FilterLogEvents", "Error", err)
+			return nil, false
+		}
+
+		for _, event := range output.Events {
+			container, instanceId := parseLogStreamName(event.LogStreamName)
+
+			lines = append(lines, logLine{
+				time:       time.Unix(0, event.Timestamp*int64(time.Millisecond)),
+				instanceId: instanceId,
+				container:  container,
+				message:    strings.TrimRight(event.Message, "\n"),
+			})
+		}
+
+		if output.NextToken == "" {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+
+	return lines, true
+}
+
+// parseLogStreamName splits streams named <container>/<instance id>/<container
+// id>. Streams of hosts deployed before instance ids were added are named
+// <image>/<container id>
+func parseLogStreamName(streamName string) (container, instanceId string) {
+	parts := strings.Split(streamName, "/")
+	if len(parts) == 3 && strings.HasPrefix(parts[1], "i-") {
+		return parts[0], parts[1]
+	}
+
+	return strings.Join(parts[:len(parts)-1], "/"), "-"
+}
+
+func ssmLogLines(log log15.Logger, roleSession *session.Session, instanceIds []string,
+	containerName string, since time.Time) ([]logLine, bool) {
+
+	lines := make([]logLine, 0)
+	if len(instanceIds) == 0 {
+		log.Warn("The stack has no instances in service")
+		return lines, true
+	}
+
+	client := ssm.New(roleSession)
+
+	log.Debug("ssm:SendCommand")
+	sendOutput, err := client.SendCommand(&ssm.SendCommandInput{
+		InstanceIds:  instanceIds,
+		DocumentName: "AWS-RunShellScript",
+		Comment:      "porter logs",
+		Parameters: map[string][]string{
+			"commands": {hostLogsScript(containerName, since)},
+		},
+	})
+	if err != nil {
+		log.Error("ssm:SendCommand", "Error", err)
+		return nil, false
+	}
+	commandId := sendOutput.Command.CommandId
+
+	for _, instanceId := range instanceIds {
+		output, ok := waitForCommand(log.New("InstanceId", instanceId), client, commandId, instanceId)
+		if !ok {
+			continue
+		}
+
+		lines = append(lines, parseHostLogs(instanceId, output)...)
+	}
+
+	return lines, true
+}
+
+func waitForCommand(log log15.Logger, client *ssm.SSM, commandId, instanceId string) (string, bool) {
+	input := &ssm.GetCommandInvocationInput{
+		CommandId:  commandId,
+		InstanceId: instanceId,
+	}
+
+	for i := 0; i < 30; i++ {
+		time.Sleep(time.Second)
+
+		// the invocation doesn't exist for a moment after SendCommand
+		output, err := client.GetCommandInvocation(input)
+		if err != nil {
+			log.Debug("ssm:GetCommandInvocation", "Error", err)
+			continue
+		}
+
+		switch output.Status {
+		case "Pending", "InProgress", "Delayed":
+			continue
+		case "Success":
+			return output.StandardOutputContent, true
+		default:
+			log.Warn("Command failed", "Status", output.Status, "Stderr", output.StandardErrorContent)
+			return "", false
+		}
+	}
+
+	log.Warn("Timed out waiting for the command")
+	return "", false
+}
+
+// hostLogsScript prints the service's containers like
+//
+//	#container <container id> <container name>
+//
+// followed by the lines rsyslog wrote for them after since
+func hostLogsScript(containerName string, since time.Time) string {
+	filter := "label=" + constants.ContainerLabel
+	if containerName != "" {
+		filter += "=" + containerName
+	}
+
+	return fmt.Sprintf(`set -o pipefail
+docker ps --filter %s --format '#container {{.ID}} {{.Label "%s"}}'
+ids=$(docker ps -q --filter %s | paste -sd'|' -)
+[ -n "$ids" ] || exit 0
+awk -v since=%s '$1 > since' %s | grep -E "$ids" | tail -n %d || true`,
+		shellQuote(filter), constants.ContainerLabel, shellQuote(filter),
+		shellQuote(since.UTC().Format("2006-01-02T15:04:05.000000")), hostLogFile, ssmLogsTail)
+}
+
+// parseHostLogs reads the output of hostLogsScript. rsyslog lines look like
+//
+//	2016-09-01T12:00:00.123456+00:00 ip-10-0-0-1 docker/0123456789ab[1234]: message
+func parseHostLogs(instanceId, output string) []logLine {
+	containers := make(map[string]string)
+	lines := make([]logLine, 0)
+
+	for _, text := range strings.Split(output, "\n") {
+		if strings.HasPrefix(text, "#container ") {
+			fields := strings.Fields(text)
+			if len(fields) == 3 {
+				containers[fields[1]] = fields[2]
+			}
+			continue
+		}
+
+		fields := strings.SplitN(text, " ", 4)
+		if len(fields) != 4 {
+			continue
+		}
+
+		lineTime, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			continue
+		}
+
+		container := "-"
+		for id, name := range containers {
+			if strings.Contains(fields[2], id) {
+				container = name
+				break
+			}
+		}
+
+		lines = append(lines, logLine{
+			time:       lineTime,
+			instanceId: instanceId,
+			container:  container,
+			message:    fields[3],
+		})
+	}
+
+	return lines
+}
@@ -0,0 +1,160 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"context"
+	"time"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/inconshreveable/log15"
+)
+
+// how often a deploy waiting on another deploy's migration checks its lock
+const migrateLockPoll = 10 * time.Second
+
+// migrationLockEnvironments are the names of the migration lock and of the
+// marker recording the last service version migrated. Stamps of an
+// environment share its database so they share its migrations
+func migrationLockEnvironments(environment *conf.Environment) (lockEnv, markerEnv string) {
+	envName := environment.Name
+	if environment.StampOf != "" {
+		envName = environment.StampOf
+	}
+
+	return envName + "#migrate", envName + "#migrated"
+}
+
+// runMigrations runs the migrate hooks once per service version of the
+// environment, not once per region. Whichever deploy gets the migration lock
+// in the state store runs them and the rest wait for it to finish. A failed
+// migration fails the deploy
+func runMigrations(ctx context.Context, log log15.Logger, config *conf.Config,
+	environment *conf.Environment) (success bool) {
+
+	if len(config.Hooks[constants.HookMigrate]) == 0 {
+		success = true
+		return
+	}
+
+	lockEnv, markerEnv := migrationLockEnvironments(environment)
+	store := provision.GetStateStore(config)
+
+	lock := provision.NewLock(config, lockEnv)
+	for {
+		held, err := store.Lock(lock)
+		if err != nil {
+			log.Error("State store Lock", "Error", err)
+			return
+		}
+
+		if held == nil {
+			break
+		}
+
+		log.Info("Waiting for another deploy's migration. If it died run deploy again with --force-unlock",
+			"Owner", held.Owner,
+			"Host", held.Host,
+			"ServiceVersion", held.ServiceVersion,
+			"AcquiredAt", held.AcquiredAt.Format(time.RFC3339))
+
+		if !sleepContext(ctx, migrateLockPoll) {
+			log.Error("Stopped waiting for the migration lock", "Reason", provision.CancelReason(ctx))
+			return
+		}
+	}
+
+	defer func() {
+		err := store.Unlock(lock)
+		if err != nil {
+			log.Warn("Failed to release the migration lock. Release it with --force-unlock", "Error", err)
+		}
+	}()
+
+	marker, err := store.GetLock(config.ServiceName, markerEnv)
+	if err != nil {
+		log.Error("State store GetLock", "Error", err)
+		return
+	}
+
+	if marker != nil && marker.ServiceVersion == config.ServiceVersion {
+		log.Info("Migrations already ran for this service version",
+			"Host", marker.Host,
+			"MigratedAt", marker.AcquiredAt.Format(time.RFC3339))
+		success = true
+		return
+	}
+
+	// one region's credentials are enough to reach the database
+	regionName := environment.Regions[0].Name
+	regions := map[string]*provision_state.Region{
+		regionName: {},
+	}
+
+	log.Info("Running migrations", "Region", regionName)
+	if !runHook(log, constants.HookMigrate, environment.Name, regions, true) {
+		log.Error("Migrations failed. Stopping the deploy")
+		return
+	}
+
+	// the marker is a lock that's never released. It's replaced by the next
+	// service version's
+	if marker != nil {
+		err = store.Unlock(marker)
+		if err != nil {
+			log.Warn("Failed to replace the migration marker", "Error", err)
+		}
+	}
+
+	held, err := store.Lock(provision.NewLock(config, markerEnv))
+	if err != nil || held != nil {
+		log.Warn("Failed to record the migration. The next deploy of this service version will run it again",
+			"Error", err)
+	}
+
+	log.Info("Migrations complete")
+	success = true
+	return
+}
+
+// forceUnlockMigration releases a migration lock left behind by a deploy that
+// died while migrating
+func forceUnlockMigration(log log15.Logger, store provision_state.Store, config *conf.Config,
+	environment *conf.Environment) (success bool) {
+
+	lockEnv, _ := migrationLockEnvironments(environment)
+
+	held, err := store.GetLock(config.ServiceName, lockEnv)
+	if err != nil {
+		log.Error("State store GetLock", "Error", err)
+		return
+	}
+
+	if held != nil {
+		log.Warn("Forcing the migration lock open",
+			"Owner", held.Owner,
+			"Host", held.Host,
+			"AcquiredAt", held.AcquiredAt.Format(time.RFC3339))
+
+		err = store.Unlock(held)
+		if err != nil {
+			log.Error("State store Unlock", "Error", err)
+			return
+		}
+	}
+
+	success = true
+	return
+}
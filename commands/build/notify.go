@@ -12,15 +12,18 @@
 package build
 
 import (
+	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
+	"text/template"
 
 	"github.com/adobe-platform/porter/conf"
 	"github.com/adobe-platform/porter/logger"
+	"github.com/inconshreveable/log15"
 
 	"github.com/phylake/go-cli"
 )
@@ -30,6 +33,29 @@ type (
 	SlackBody struct {
 		Text string `json:"text"`
 	}
+
+	// notification is what message templates are executed with
+	notification struct {
+		Phase          string
+		Success        bool
+		ServiceName    string
+		ServiceVersion string
+		Environment    string
+
+		PipelineName    string
+		PipelineCounter string
+		StageName       string
+		StageCounter    string
+		JobName         string
+
+		PipelineUrl string
+		BuildUrl    string
+		StageUrl    string
+		JobUrl      string
+
+		// Default is the message porter posts without a template
+		Default string
+	}
 )
 
 func (recv *NotifyCmd) Name() string {
@@ -45,13 +71,22 @@ func (recv *NotifyCmd) LongHelp() string {
     notify -- CI Slack notifications
 
 SYNOPSIS
-    notify -go-ci -phase <pack | provision | promote> -success=<t|f>
+    notify -go-ci -phase <pack | provision | promote> -success=<t|f> [-e <environment>]
 
 DESCRIPTION
     Post message to a configured incoming webhook.
     https://api.slack.com/incoming-webhooks
 
-    Currently GO CI is the only supported CI system.`
+    Currently GO CI is the only supported CI system.
+
+    The message is the slack success_template or failure_template if one is
+    configured. With -e the environment's notifications templates are used
+    instead. Templates are Go templates with these fields
+
+        .Phase .Success .ServiceName .ServiceVersion .Environment
+        .PipelineName .PipelineCounter .StageName .StageCounter .JobName
+        .PipelineUrl .BuildUrl .StageUrl .JobUrl
+        .Default (the message porter posts without a template)`
 }
 
 func (recv *NotifyCmd) SubCommands() []cli.Command {
@@ -62,11 +97,12 @@ func (recv *NotifyCmd) Execute(args []string) bool {
 	log := logger.CLI("cmd", "notify")
 
 	if len(args) > 1 && args[0] == "-go-ci" {
-		var buildPhase, webhookURL string
+		var buildPhase, environmentName, webhookURL string
 		var phaseSuccess bool
 
 		flagSet := flag.NewFlagSet("", flag.ContinueOnError)
 		flagSet.StringVar(&buildPhase, "phase", "", "")
+		flagSet.StringVar(&environmentName, "e", "", "")
 		flagSet.BoolVar(&phaseSuccess, "success", false, "")
 		flagSet.Usage = func() {
 			fmt.Println(recv.LongHelp())
@@ -110,7 +146,12 @@ func (recv *NotifyCmd) Execute(args []string) bool {
 			return true
 		}
 
-		slackPost(webhookURL, goCIMessage(buildPhase, phaseSuccess))
+		n := goCINotification(buildPhase, phaseSuccess)
+		n.ServiceName = config.ServiceName
+		n.ServiceVersion = config.ServiceVersion
+		n.Environment = environmentName
+
+		slackPost(webhookURL, notificationMessage(log, config, n))
 		return true
 	}
 
@@ -144,45 +185,103 @@ func slackPost(slackURL string, message string) {
 
 }
 
-func goCIMessage(buildPhase string, phaseSuccess bool) string {
+// notificationMessage executes the most specific message template. A template
+// that fails to execute falls back to the default message so a notification is
+// still posted
+func notificationMessage(log log15.Logger, config *conf.Config, n notification) string {
+
+	successTemplate := config.Slack.SuccessTemplate
+	failureTemplate := config.Slack.FailureTemplate
+
+	if n.Environment != "" {
+		environment, err := config.GetEnvironment(n.Environment)
+		if err != nil {
+			log.Warn("GetEnvironment", "Error", err)
+		} else if environment.Notifications != nil {
+			if environment.Notifications.SuccessTemplate != "" {
+				successTemplate = environment.Notifications.SuccessTemplate
+			}
+			if environment.Notifications.FailureTemplate != "" {
+				failureTemplate = environment.Notifications.FailureTemplate
+			}
+		}
+	}
+
+	text := failureTemplate
+	if n.Success {
+		text = successTemplate
+	}
+
+	if text == "" {
+		return n.Default
+	}
+
+	tmpl, err := template.New("").Parse(text)
+	if err != nil {
+		log.Warn("template.Parse", "Error", err)
+		return n.Default
+	}
+
+	var message bytes.Buffer
+	err = tmpl.Execute(&message, n)
+	if err != nil {
+		log.Warn("template.Execute", "Error", err)
+		return n.Default
+	}
+
+	return message.String()
+}
+
+func goCINotification(buildPhase string, phaseSuccess bool) notification {
+
+	n := notification{
+		Phase:   buildPhase,
+		Success: phaseSuccess,
+
+		PipelineName:    os.Getenv("GO_PIPELINE_NAME"),
+		PipelineCounter: os.Getenv("GO_PIPELINE_COUNTER"),
+		StageName:       os.Getenv("GO_STAGE_NAME"),
+		StageCounter:    os.Getenv("GO_STAGE_COUNTER"),
+		JobName:         os.Getenv("GO_JOB_NAME"),
+	}
 
-	pipelineUrl := fmt.Sprintf("%s/%s/%s",
+	n.PipelineUrl = fmt.Sprintf("%s/%s/%s",
 		os.Getenv("GO_NOTIFICATION_URL"),
 		"tab/pipeline/history",
-		os.Getenv("GO_PIPELINE_NAME"))
+		n.PipelineName)
 
-	buildUrl := fmt.Sprintf("%s/%s/%s/%s", os.Getenv("GO_NOTIFICATION_URL"),
+	n.BuildUrl = fmt.Sprintf("%s/%s/%s/%s", os.Getenv("GO_NOTIFICATION_URL"),
 		"pipelines/value_stream_map",
-		os.Getenv("GO_PIPELINE_NAME"),
-		os.Getenv("GO_PIPELINE_COUNTER"))
+		n.PipelineName,
+		n.PipelineCounter)
 
-	stageUrl := fmt.Sprintf("%s/%s/%s/%s/%s/%s", os.Getenv("GO_NOTIFICATION_URL"),
+	n.StageUrl = fmt.Sprintf("%s/%s/%s/%s/%s/%s", os.Getenv("GO_NOTIFICATION_URL"),
 		"pipelines",
-		os.Getenv("GO_PIPELINE_NAME"),
-		os.Getenv("GO_PIPELINE_COUNTER"),
-		os.Getenv("GO_STAGE_NAME"),
-		os.Getenv("GO_STAGE_COUNTER"))
+		n.PipelineName,
+		n.PipelineCounter,
+		n.StageName,
+		n.StageCounter)
 
-	jobUrl := fmt.Sprintf("%s/%s/%s/%s/%s/%s/%s%s",
+	n.JobUrl = fmt.Sprintf("%s/%s/%s/%s/%s/%s/%s%s",
 		os.Getenv("GO_NOTIFICATION_URL"),
 		"tab/build/detail",
-		os.Getenv("GO_PIPELINE_NAME"),
-		os.Getenv("GO_PIPELINE_COUNTER"),
-		os.Getenv("GO_STAGE_NAME"),
-		os.Getenv("GO_STAGE_COUNTER"),
-		os.Getenv("GO_JOB_NAME"),
+		n.PipelineName,
+		n.PipelineCounter,
+		n.StageName,
+		n.StageCounter,
+		n.JobName,
 		"#tab-console")
 
 	msg := fmt.Sprintf("<%s|%s> >> <%s|%s> >> <%s|%s/%s> >> <%s|%s>",
-		pipelineUrl,
-		os.Getenv("GO_PIPELINE_NAME"),
-		buildUrl,
-		os.Getenv("GO_PIPELINE_COUNTER"),
-		stageUrl,
-		os.Getenv("GO_STAGE_NAME"),
-		os.Getenv("GO_STAGE_COUNTER"),
-		jobUrl,
-		os.Getenv("GO_JOB_NAME"))
+		n.PipelineUrl,
+		n.PipelineName,
+		n.BuildUrl,
+		n.PipelineCounter,
+		n.StageUrl,
+		n.StageName,
+		n.StageCounter,
+		n.JobUrl,
+		n.JobName)
 
 	if phaseSuccess {
 		msg = msg + " passed"
@@ -190,5 +289,6 @@ func goCIMessage(buildPhase string, phaseSuccess bool) string {
 		msg = "*FAILED:* " + msg
 	}
 
-	return msg
+	n.Default = msg
+	return n
 }
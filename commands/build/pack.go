@@ -16,9 +16,9 @@ import (
 
 	"github.com/adobe-platform/porter/conf"
 	"github.com/adobe-platform/porter/constants"
-	"github.com/adobe-platform/porter/hook"
 	"github.com/adobe-platform/porter/logger"
 	"github.com/adobe-platform/porter/provision"
+	"github.com/inconshreveable/log15"
 
 	"github.com/phylake/go-cli"
 )
@@ -45,28 +45,35 @@ func (recv *PackCmd) Execute(args []string) bool {
 
 	log := logger.CLI("cmd", "pack")
 
-	commandSuccess := hook.Execute(log, constants.HookPrePack, "", nil, true)
+	if _, success := pack(log); !success {
+		os.Exit(1)
+	}
+
+	log.Info("Packaged service", "FilePath", constants.PayloadPath)
+
+	return true
+}
+
+// pack runs the pack hooks around creating the service payload. config is the
+// one the payload was packed with
+func pack(log log15.Logger) (config *conf.Config, success bool) {
 
-	if commandSuccess {
-		config, success := conf.GetConfig(log, true)
+	// the results are recorded if this process goes on to deploy
+	success = runHook(log, constants.HookPrePack, "", nil, true)
+
+	if success {
+		config, success = conf.GetConfig(log, true)
 		if !success {
-			os.Exit(1)
+			return
 		}
 
 		if os.Getenv(constants.EnvConfig) != "" {
 			config.Print()
 		}
 
-		commandSuccess = provision.Package(log, config)
-	}
-
-	commandSuccess = hook.Execute(log, constants.HookPostPack, "", nil, commandSuccess)
-
-	if !commandSuccess {
-		os.Exit(1)
+		success = provision.Package(log, config)
 	}
 
-	log.Info("Packaged service", "FilePath", constants.PayloadPath)
-
-	return true
+	success = runHook(log, constants.HookPostPack, "", nil, success)
+	return
 }
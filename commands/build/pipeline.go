@@ -0,0 +1,478 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/adobe-platform/porter/util"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/inconshreveable/log15"
+	"github.com/phylake/go-cli"
+)
+
+type (
+	PipelineRunCmd struct{}
+
+	// pipelineStageState is what the gates of the next stage check
+	pipelineStageState struct {
+		environment string
+		regions     map[string]*provision_state.Region
+		deployedAt  time.Time
+	}
+)
+
+func (recv *PipelineRunCmd) Name() string {
+	return "run"
+}
+
+func (recv *PipelineRunCmd) ShortHelp() string {
+	return "Deploy a service payload through the pipeline"
+}
+
+func (recv *PipelineRunCmd) LongHelp() string {
+	return `NAME
+    run -- Deploy a service payload through the pipeline
+
+SYNOPSIS
+    run [-from <environment>] [-approve <environment,...>] [-keep <stacks to keep>] [--force-unlock]
+
+DESCRIPTION
+    Provision, promote, and prune each environment in the pipeline section of
+    .porter/config in order. Run pack first.
+
+    Every stage deploys the same service payload. Its checksum is computed
+    once and each stage's stacks are checked for it before moving on so the
+    last stage provably runs what the earlier stages ran.
+
+    A stage's gates are checked before it's deployed. If a gate fails the
+    pipeline stops and can be resumed with -from.
+
+    Each stage is locked in the state store while it's deployed.
+
+OPTIONS
+    -from
+        Start at this stage. The previous stage's deployed stack must be
+        running the same service payload.
+
+    -approve
+        A comma separated list of stages with an approval gate that may be
+        deployed.
+
+    -keep
+        The number of stacks prune keeps in each stage. See prune --help
+
+    --force-unlock
+        Release each stage's lock before deploying it. Use this when the build
+        holding the locks died without releasing them.`
+}
+
+func (recv *PipelineRunCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *PipelineRunCmd) Execute(args []string) bool {
+
+	if len(args) == 1 && args[0] == "--help" {
+		return false
+	}
+
+	var from, approve string
+	var keepCount int
+	var forceUnlock bool
+
+	flagSet := flag.NewFlagSet("", flag.ContinueOnError)
+	flagSet.StringVar(&from, "from", "", "")
+	flagSet.StringVar(&approve, "approve", "", "")
+	flagSet.IntVar(&keepCount, "keep", 0, "")
+	flagSet.BoolVar(&forceUnlock, "force-unlock", false, "")
+	flagSet.Parse(args)
+
+	if keepCount < 0 {
+		return false
+	}
+
+	approved := make(map[string]struct{})
+	for _, environment := range strings.Split(approve, ",") {
+		if environment != "" {
+			approved[environment] = struct{}{}
+		}
+	}
+
+	if !runPipeline(from, approved, keepCount, forceUnlock) {
+		os.Exit(1)
+	}
+
+	return true
+}
+
+func runPipeline(from string, approved map[string]struct{}, keepCount int, forceUnlock bool) (success bool) {
+	log := logger.CLI("cmd", "pipeline-run")
+
+	config, getConfigSuccess := conf.GetAlteredConfig(log)
+	if !getConfigSuccess {
+		return
+	}
+
+	if len(config.Pipeline) == 0 {
+		log.Error("No pipeline defined in .porter/config")
+		return
+	}
+
+	startIndex := 0
+	if from != "" {
+		startIndex = -1
+		for i, stage := range config.Pipeline {
+			if stage.Environment == from {
+				startIndex = i
+				break
+			}
+		}
+
+		if startIndex == -1 {
+			log.Error("The environment isn't a pipeline stage", "Environment", from)
+			return
+		}
+	}
+
+	checksum, keepPayloadSuccess := keepPipelinePayload(log)
+	if !keepPayloadSuccess {
+		return
+	}
+
+	log = log.New("PayloadChecksum", checksum)
+
+	ctx, cancel := newDeployContext(log, 0, false)
+	defer cancel()
+
+	var previous *pipelineStageState
+	if startIndex > 0 {
+
+		var previousSuccess bool
+		previous, previousSuccess = deployedStageState(log, config,
+			config.Pipeline[startIndex-1].Environment, checksum)
+		if !previousSuccess {
+			return
+		}
+	}
+
+	for _, stage := range config.Pipeline[startIndex:] {
+
+		stageLog := log.New("Environment", stage.Environment)
+
+		if previous != nil {
+			for _, gate := range stage.Gates {
+				if !checkPipelineGate(ctx, stageLog, gate, stage, previous, approved) {
+					stageLog.Error("Pipeline stopped. Resume with -from " + stage.Environment)
+					return
+				}
+			}
+		}
+
+		var stageSuccess bool
+		previous, stageSuccess = runPipelineStage(ctx, stageLog, config, stage, checksum, keepCount, forceUnlock)
+		if !stageSuccess {
+			return
+		}
+	}
+
+	log.Info("Pipeline complete")
+	success = true
+	return
+}
+
+// keepPipelinePayload copies the service payload out of the way of provision,
+// which deletes it, and returns its checksum
+func keepPipelinePayload(log log15.Logger) (checksum string, success bool) {
+
+	if _, err := os.Stat(constants.PayloadPath); err == nil {
+
+		err = util.CopyFile(constants.PayloadPath, constants.PipelinePayloadPath)
+		if err != nil {
+			log.Error("Failed to copy the service payload", "Error", err)
+			return
+		}
+	}
+
+	payloadBytes, err := ioutil.ReadFile(constants.PipelinePayloadPath)
+	if err != nil {
+		log.Error("Service payload not found. Run pack first", "Error", err)
+		return
+	}
+
+	checksumArray := sha256.Sum256(payloadBytes)
+	checksum = hex.EncodeToString(checksumArray[:])
+
+	success = true
+	return
+}
+
+func checkPipelineGate(ctx context.Context, log log15.Logger, gate *conf.PipelineGate, stage *conf.PipelineStage,
+	previous *pipelineStageState, approved map[string]struct{}) (success bool) {
+
+	switch {
+	case gate.Hook != "":
+
+		log.Info("Running gate hook", "HookName", gate.Hook, "GateEnvironment", previous.environment)
+		success = runHook(log, gate.Hook, previous.environment, previous.regions, true)
+
+	case gate.SoakTime > 0:
+
+		soakEnd := previous.deployedAt.Add(time.Duration(gate.SoakTime) * time.Second)
+		if wait := soakEnd.Sub(time.Now()); wait > 0 {
+			log.Info("Waiting for the previous stage to soak",
+				"GateEnvironment", previous.environment,
+				"SoakEnd", soakEnd.Format(time.UnixDate))
+			if !sleepContext(ctx, wait) {
+				log.Error("Pipeline stopped while soaking", "Reason", provision.CancelReason(ctx))
+				return
+			}
+		}
+		success = true
+
+	case gate.Approval:
+
+		if _, success = approved[stage.Environment]; !success {
+			log.Error("The stage requires approval. Pass -approve " + stage.Environment)
+		}
+	}
+
+	return
+}
+
+func runPipelineStage(ctx context.Context, log log15.Logger, config *conf.Config, stage *conf.PipelineStage,
+	checksum string, keepCount int, forceUnlock bool) (state *pipelineStageState, success bool) {
+
+	unlock, lockSuccess := lockEnvironment(log, config, stage.Environment, forceUnlock)
+	if !lockSuccess {
+		return
+	}
+	defer unlock()
+
+	log.Info("Deploying pipeline stage")
+
+	stack, deploySuccess := deployPayload(ctx, log, config, stage.Environment, checksum, keepCount)
+	if !deploySuccess {
+		return
+	}
+
+	state = &pipelineStageState{
+		environment: stack.Environment,
+		regions:     stack.Regions,
+		deployedAt:  time.Now(),
+	}
+	success = true
+	return
+}
+
+// deployPayload provisions the kept service payload to an environment, checks
+// every region is running it, then promotes and prunes
+func deployPayload(ctx context.Context, log log15.Logger, config *conf.Config, env, checksum string,
+	keepCount int) (stack *provision_state.Stack, success bool) {
+
+	defer flushHookResults(log, env)
+
+	environment, err := config.GetEnvironment(env)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	err = util.CopyFile(constants.PipelinePayloadPath, constants.PayloadPath)
+	if err != nil {
+		log.Error("Failed to restore the service payload", "Error", err)
+		return
+	}
+
+	if !ProvisionOrHotswapStack(ctx, env) {
+		return
+	}
+
+	stackBytes, err := ioutil.ReadFile(constants.ProvisionOutputPath)
+	if err != nil {
+		log.Error("Unable to read provision output file", "Error", err)
+		return
+	}
+
+	stack = &provision_state.Stack{}
+	err = json.Unmarshal(stackBytes, stack)
+	if err != nil {
+		log.Error("json unmarshal error on provision output", "Error", err)
+		return
+	}
+
+	success = finishDeploy(log, environment, stack, checksum, keepCount)
+	return
+}
+
+// finishDeploy checks every region of a provisioned stack is running the
+// payload, then promotes and prunes
+func finishDeploy(log log15.Logger, environment *conf.Environment, stack *provision_state.Stack,
+	checksum string, keepCount int) (success bool) {
+
+	for regionName, regionState := range stack.Regions {
+
+		cfnStack, describeSuccess := describePipelineStack(log, environment, regionName, regionState.StackId)
+		if !describeSuccess {
+			return
+		}
+
+		if !verifyPayloadChecksum(log.New("Region", regionName), cfnStack, checksum) {
+			return
+		}
+	}
+
+	if !stack.Hotswap {
+		if !doPromote(log, stack, "", "") {
+			return
+		}
+	}
+
+	if !doPrune(log, stack, keepCount, "") {
+		return
+	}
+
+	success = true
+	return
+}
+
+// deployedStageState checks that a stage deployed by an earlier run of the
+// pipeline is running the payload before resuming after it
+func deployedStageState(log log15.Logger, config *conf.Config, env,
+	checksum string) (state *pipelineStageState, success bool) {
+
+	environment, err := config.GetEnvironment(env)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	stackName, err := provision.GetStackName(config.ServiceName, environment.Name, false)
+	if err != nil {
+		log.Error("provision.GetStackName", "Error", err)
+		return
+	}
+
+	state = &pipelineStageState{
+		environment: environment.Name,
+		regions:     make(map[string]*provision_state.Region),
+	}
+
+	for _, region := range environment.Regions {
+
+		log := log.New("Environment", environment.Name, "Region", region.Name)
+
+		roleARN, err := environment.GetRoleARN(region.Name)
+		if err != nil {
+			log.Error("GetRoleARN", "Error", err)
+			return
+		}
+
+		roleSession := aws_session.STS(region.Name, roleARN, 0)
+
+		stack, findDeployedStackSuccess := findDeployedStack(log, region, roleSession, stackName)
+		if !findDeployedStackSuccess {
+			return
+		}
+
+		if stack == nil {
+			log.Error("The previous stage isn't deployed")
+			return
+		}
+
+		if !verifyPayloadChecksum(log, stack, checksum) {
+			return
+		}
+
+		deployedAt := *stack.CreationTime
+		if stack.LastUpdatedTime != nil {
+			deployedAt = *stack.LastUpdatedTime
+		}
+		if deployedAt.After(state.deployedAt) {
+			state.deployedAt = deployedAt
+		}
+
+		state.regions[region.Name] = &provision_state.Region{
+			StackId: *stack.StackId,
+		}
+	}
+
+	success = true
+	return
+}
+
+func describePipelineStack(log log15.Logger, environment *conf.Environment,
+	regionName, stackId string) (stack *cloudformation.Stack, success bool) {
+
+	roleARN, err := environment.GetRoleARN(regionName)
+	if err != nil {
+		log.Error("GetRoleARN", "Error", err)
+		return
+	}
+
+	cfnClient := cloudformation.New(aws_session.STS(regionName, roleARN, 0))
+
+	describeStacksOutput, err := cfnClient.DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(stackId),
+	})
+	if err != nil {
+		log.Error("cloudformation:DescribeStacks", "Error", err)
+		return
+	}
+
+	if len(describeStacksOutput.Stacks) != 1 {
+		log.Error("len(describeStacksOutput.Stacks != 1)")
+		return
+	}
+
+	stack = describeStacksOutput.Stacks[0]
+	success = true
+	return
+}
+
+// verifyPayloadChecksum checks the tag provision puts on the stack
+func verifyPayloadChecksum(log log15.Logger, stack *cloudformation.Stack, checksum string) (success bool) {
+
+	for _, tag := range stack.Tags {
+		if tag.Key == nil || *tag.Key != constants.PorterPayloadChecksumTag {
+			continue
+		}
+
+		if tag.Value == nil || *tag.Value != checksum {
+			log.Error("The stack isn't running the pipeline's service payload",
+				"StackId", *stack.StackId,
+				"StackPayloadChecksum", aws.StringValue(tag.Value))
+			return
+		}
+
+		success = true
+		return
+	}
+
+	log.Error("The stack has no payload checksum tag", "StackId", *stack.StackId)
+	return
+}
@@ -16,11 +16,12 @@ import (
 	"flag"
 	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/adobe-platform/porter/conf"
 	"github.com/adobe-platform/porter/constants"
-	"github.com/adobe-platform/porter/hook"
 	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/notify"
 	"github.com/adobe-platform/porter/promote"
 	"github.com/adobe-platform/porter/provision_state"
 	"github.com/inconshreveable/log15"
@@ -43,15 +44,36 @@ func (recv *PromoteCmd) LongHelp() string {
 
 SYNOPSIS
     promote [-provision-output <provision output file>]
+            [-e <environment out of .porter/config>]
+            [--allow-skew <justification>]
+            [--yes]
 
 DESCRIPTION
     Promote newly provisioned instances and remove old instances from the
     configured elb
 
+    Every region must be running the same service payload built by the same
+    version of porter. Promotion of mixed versions is refused unless
+    --allow-skew is passed
+
 OPTIONS
     -provision-output
     	The path to a provision output file. This is only used for testing.
-    	DO NOT provide this if calling from a build machine.`
+    	DO NOT provide this if calling from a build machine.
+
+    -e
+    	Promote the environment's latest deploy recorded in the state store
+    	instead of the output of provision on this machine. Every region must
+    	be provisioned. With a state_store in .porter/config this promotes a
+    	deploy provisioned on a different machine.
+
+    --allow-skew
+    	Promote even if regions are running different versions. The
+    	justification is logged and recorded as the porter-skew-justification
+    	tag on each promoted ELB so it must be at most 255 characters.
+
+    --yes
+    	Skip the environment's confirm prompt. See deploy --help`
 }
 
 func (recv *PromoteCmd) SubCommands() []cli.Command {
@@ -59,7 +81,8 @@ func (recv *PromoteCmd) SubCommands() []cli.Command {
 }
 
 func (recv *PromoteCmd) Execute(args []string) bool {
-	var provisionOutputPath, elbType string
+	var provisionOutputPath, environment, elbType, skewJustification string
+	var yes bool
 
 	if len(args) == 1 && args[0] == "--help" {
 		return false
@@ -67,7 +90,10 @@ func (recv *PromoteCmd) Execute(args []string) bool {
 
 	flagSet := flag.NewFlagSet("", flag.ContinueOnError)
 	flagSet.StringVar(&provisionOutputPath, "provision-output", "", "")
+	flagSet.StringVar(&environment, "e", "", "")
 	flagSet.StringVar(&elbType, "elb", "", "")
+	flagSet.StringVar(&skewJustification, "allow-skew", "", "")
+	flagSet.BoolVar(&yes, "yes", false, "")
 	flagSet.Parse(args)
 
 	if provisionOutputPath == "" {
@@ -76,17 +102,39 @@ func (recv *PromoteCmd) Execute(args []string) bool {
 
 	log := logger.CLI("cmd", "promote")
 
-	stackBytes, err := ioutil.ReadFile(provisionOutputPath)
-	if err != nil {
-		log.Error("Unable to read provision output file", "Error", err)
+	if len(skewJustification) > 255 {
+		log.Error("--allow-skew justification must be at most 255 characters")
 		os.Exit(1)
 	}
 
-	stack := &provision_state.Stack{}
-	err = json.Unmarshal(stackBytes, stack)
-	if err != nil {
-		log.Error("json unmarshal error on provision output", "Error", err)
-		os.Exit(1)
+	var stack *provision_state.Stack
+
+	if environment != "" {
+
+		config, getConfigSuccess := getPromoteConfig(log)
+		if !getConfigSuccess {
+			os.Exit(1)
+		}
+
+		var recordedStackSuccess bool
+		stack, recordedStackSuccess = recordedStack(log, config, environment)
+		if !recordedStackSuccess {
+			os.Exit(1)
+		}
+	} else {
+
+		stackBytes, err := ioutil.ReadFile(provisionOutputPath)
+		if err != nil {
+			log.Error("Unable to read provision output file", "Error", err)
+			os.Exit(1)
+		}
+
+		stack = &provision_state.Stack{}
+		err = json.Unmarshal(stackBytes, stack)
+		if err != nil {
+			log.Error("json unmarshal error on provision output", "Error", err)
+			os.Exit(1)
+		}
 	}
 
 	if stack.Hotswap {
@@ -94,7 +142,11 @@ func (recv *PromoteCmd) Execute(args []string) bool {
 		return true
 	}
 
-	if !doPromote(log, stack, elbType) {
+	if !confirmPromote(log, stack, yes) {
+		os.Exit(1)
+	}
+
+	if !doPromote(log, stack, elbType, skewJustification) {
 		os.Exit(1)
 	}
 
@@ -102,25 +154,67 @@ func (recv *PromoteCmd) Execute(args []string) bool {
 	return true
 }
 
-func doPromote(log log15.Logger, stack *provision_state.Stack, elbType string) (success bool) {
+func doPromote(log log15.Logger, stack *provision_state.Stack, elbType, skewJustification string) (success bool) {
 
 	defer func() {
 
-		postHookSuccess := hook.Execute(log, constants.HookPostPromote,
+		postHookSuccess := runHook(log, constants.HookPostPromote,
 			stack.Environment, stack.Regions, success)
 
 		success = success && postHookSuccess
 	}()
 
-	if !hook.Execute(log, constants.HookPrePromote, stack.Environment, stack.Regions, true) {
+	if !runHook(log, constants.HookPrePromote, stack.Environment, stack.Regions, true) {
 		return
 	}
 
-	config, getConfigSuccess := conf.GetAlteredConfig(log)
+	config, getConfigSuccess := getPromoteConfig(log)
 	if !getConfigSuccess {
 		return
 	}
 
-	success = promote.Promote(log, config, stack, elbType)
+	promoteStartedAt := time.Now()
+	success = promote.Promote(log, config, stack, elbType, skewJustification)
+	if success {
+		recordSwap(time.Since(promoteStartedAt))
+
+		recordStack(log, config, *stack, provision_state.StatusPromoted, "")
+
+		if environment, err := config.GetEnvironment(stack.Environment); err == nil {
+			notify.Publish(log, config, environment, notify.Event{
+				Event: constants.EventPromoted,
+			})
+		}
+	}
 	return
 }
+
+// confirmPromote asks for the confirmation of the promoted stack's
+// environment
+func confirmPromote(log log15.Logger, stack *provision_state.Stack, yes bool) (success bool) {
+
+	config, getConfigSuccess := getPromoteConfig(log)
+	if !getConfigSuccess {
+		return
+	}
+
+	environment, err := config.GetEnvironment(stack.Environment)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	success = confirmEnvironment(log, environment, yes)
+	return
+}
+
+// getPromoteConfig is the config from pack. A machine that didn't run pack
+// can promote a recorded deploy with .porter/config
+func getPromoteConfig(log log15.Logger) (*conf.Config, bool) {
+	if _, err := os.Stat(constants.AlteredConfigPath); err != nil {
+		log.Warn("No packed config. Using .porter/config", "Path", constants.AlteredConfigPath)
+		return conf.GetConfig(log, true)
+	}
+
+	return conf.GetAlteredConfig(log)
+}
@@ -0,0 +1,145 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/phylake/go-cli"
+)
+
+type PromoteVersionCmd struct{}
+
+func (recv *PromoteVersionCmd) Name() string {
+	return "promote"
+}
+
+func (recv *PromoteVersionCmd) ShortHelp() string {
+	return "Deploy the exact artifact of a version from one environment to another"
+}
+
+func (recv *PromoteVersionCmd) LongHelp() string {
+	return `NAME
+    promote -- Deploy the exact artifact of a version from one environment to another
+
+SYNOPSIS
+    promote --from <environment> --to <environment> --version <service version> [-keep <stacks to keep>] [--force-unlock] [--timeout <duration>] [--rollback] [--yes]
+
+DESCRIPTION
+    Find the service payload the version was promoted with in the --from
+    environment in the state store, download it from where it was uploaded,
+    and check it against the recorded checksum. Then deploy it to the --to
+    environment like porter deploy.
+
+    Nothing is packed. The --to environment runs a bit-identical payload and
+    its templates are rendered from the config the payload was packed with so
+    only the values of the --to environment differ. The checkout doesn't need
+    to be the commit the version was built from. Only the state_store and the
+    --from environment are read from .porter/config.
+
+    Every promoted region of the version must have the same payload.
+
+OPTIONS
+    --from
+        The environment the version was deployed to
+
+    --to
+        The environment to deploy the version to. It comes from the config
+        the payload was packed with
+
+    --version
+        The service version to deploy
+
+    -keep
+        The number of stacks prune keeps. See prune --help
+
+    --force-unlock
+        Release the --to environment's lock before deploying. Use this when
+        the build holding the lock died without releasing it.
+
+    --timeout
+        How long the whole deploy has to finish. See deploy --help
+
+    --rollback
+        Roll back in-progress stack updates and instance refreshes when the
+        deploy stops. See deploy --help
+
+    --yes
+        Skip the --to environment's confirm prompt. See deploy --help`
+}
+
+func (recv *PromoteVersionCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *PromoteVersionCmd) Execute(args []string) bool {
+
+	if len(args) > 0 {
+		var from, to, version string
+		var keepCount int
+		var forceUnlock, rollback, yes bool
+		var timeout time.Duration
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&from, "from", "", "")
+		flagSet.StringVar(&to, "to", "", "")
+		flagSet.StringVar(&version, "version", "", "")
+		flagSet.IntVar(&keepCount, "keep", 0, "")
+		flagSet.BoolVar(&forceUnlock, "force-unlock", false, "")
+		flagSet.DurationVar(&timeout, "timeout", 0, "")
+		flagSet.BoolVar(&rollback, "rollback", false, "")
+		flagSet.BoolVar(&yes, "yes", false, "")
+		flagSet.Usage = func() {
+			fmt.Println(recv.LongHelp())
+		}
+		flagSet.Parse(args)
+
+		if from == "" || to == "" || version == "" || keepCount < 0 || timeout < 0 {
+			return false
+		}
+
+		log := logger.CLI("cmd", "promote-version")
+
+		if from == to {
+			log.Error("--from and --to must be different environments")
+			os.Exit(1)
+		}
+
+		config, success := conf.GetConfig(log, true)
+		if !success {
+			os.Exit(1)
+		}
+
+		checksum, success := provision.FetchDeployedArtifact(log, config, from, version)
+		if !success {
+			os.Exit(1)
+		}
+
+		log.Info("Promoting deployed artifact",
+			"From", from,
+			"To", to,
+			"ServiceVersion", version,
+			"PayloadChecksum", checksum)
+
+		if !deploy(to, keepCount, false, forceUnlock, timeout, rollback, yes, false) {
+			os.Exit(1)
+		}
+		return true
+	}
+
+	return false
+}
@@ -12,6 +12,7 @@
 package build
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -23,10 +24,12 @@ import (
 	"github.com/adobe-platform/porter/cfn"
 	"github.com/adobe-platform/porter/conf"
 	"github.com/adobe-platform/porter/constants"
-	"github.com/adobe-platform/porter/hook"
+	"github.com/adobe-platform/porter/events"
 	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/notify"
 	"github.com/adobe-platform/porter/provision"
 	"github.com/adobe-platform/porter/provision_state"
+	"github.com/adobe-platform/porter/tracing"
 	"github.com/adobe-platform/porter/util"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -65,13 +68,42 @@ func (recv *ProvisionStackCmd) LongHelp() string {
     provision -- Provision a new stack
 
 SYNOPSIS
-    provision -e <environment out of .porter/config>
+    provision -e <environment out of .porter/config> [--force-unlock] [--timeout <duration>] [--rollback] [--yes] [--strict-provenance]
 
 DESCRIPTION
     Provision a new stack for a given environment.
 
     This command is similar to create-stack but it works with multiple regions
-    and should be run from a build box.`
+    and should be run from a build box.
+
+    The environment is locked in the state store while it's provisioned so
+    two builds can't provision it at once.
+
+OPTIONS
+    --force-unlock
+        Release the environment's lock before provisioning. Use this when the
+        build holding the lock died without releasing it.
+
+    --timeout
+        How long the whole provision has to finish across every region, like
+        45m. When it runs out, or on SIGINT, AWS calls and uploads in flight
+        are canceled in every region and the state each region was left in
+        is logged and recorded. Stacks being created are deleted.
+
+    --rollback
+        When the timeout runs out or on SIGINT, also cancel stack updates and
+        instance refreshes that are in progress so CloudFormation rolls them
+        back.
+
+    --yes
+        Skip the environment's confirm prompt. Required in CI for an
+        environment with confirm set. See the environment's production and
+        confirm in .porter/config
+
+    --strict-provenance
+        Before a hot swap updates a stack, refuse to update it if its
+        template was last rendered for a different service or by a newer
+        porter. Without it those are warnings`
 }
 
 func (recv *ProvisionStackCmd) SubCommands() []cli.Command {
@@ -82,14 +114,25 @@ func (recv *ProvisionStackCmd) Execute(args []string) bool {
 
 	if len(args) > 0 {
 		var environment string
+		var forceUnlock, rollback, yes, strictProvenance bool
+		var timeout time.Duration
 		flagSet := flag.NewFlagSet("", flag.ExitOnError)
 		flagSet.StringVar(&environment, "e", "", "")
+		flagSet.BoolVar(&forceUnlock, "force-unlock", false, "")
+		flagSet.DurationVar(&timeout, "timeout", 0, "")
+		flagSet.BoolVar(&rollback, "rollback", false, "")
+		flagSet.BoolVar(&yes, "yes", false, "")
+		flagSet.BoolVar(&strictProvenance, "strict-provenance", false, "")
 		flagSet.Usage = func() {
 			fmt.Println(recv.LongHelp())
 		}
 		flagSet.Parse(args)
 
-		if !ProvisionOrHotswapStack(environment) {
+		if timeout < 0 {
+			return false
+		}
+
+		if !lockedProvision(environment, forceUnlock, timeout, rollback, yes, strictProvenance) {
 			os.Exit(1)
 		}
 		return true
@@ -98,7 +141,42 @@ func (recv *ProvisionStackCmd) Execute(args []string) bool {
 	return false
 }
 
-func ProvisionOrHotswapStack(env string) (success bool) {
+// lockedProvision holds the environment's deploy lock around
+// ProvisionOrHotswapStack
+func lockedProvision(env string, forceUnlock bool, timeout time.Duration, rollback, yes, strictProvenance bool) (success bool) {
+	log := logger.CLI("cmd", "provision")
+
+	config, getConfigSuccess := conf.GetAlteredConfig(log)
+	if !getConfigSuccess {
+		return
+	}
+
+	environment, err := config.GetEnvironment(env)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	if !confirmEnvironment(log, environment, yes) {
+		return
+	}
+
+	ctx, cancel := newDeployContext(log, timeout, rollback)
+	defer cancel()
+	ctx = provision.WithStrictProvenance(ctx, strictProvenance)
+
+	unlock, lockSuccess := lockEnvironment(log, config, env, forceUnlock)
+	if !lockSuccess {
+		return
+	}
+	defer unlock()
+	defer flushHookResults(log, env)
+
+	success = ProvisionOrHotswapStack(ctx, env)
+	return
+}
+
+func ProvisionOrHotswapStack(ctx context.Context, env string) (success bool) {
 	log := logger.CLI("cmd", "provision")
 
 	config, success := conf.GetAlteredConfig(log)
@@ -112,21 +190,72 @@ func ProvisionOrHotswapStack(env string) (success bool) {
 		return
 	}
 
+	if len(environment.Stamps) > 0 {
+		log.Error("Environment has stamps. Deploy them with porter stamp deploy or provision one with -e <environment><stamp>",
+			"Environment", environment.Name)
+		return
+	}
+
 	err = environment.IsWithinBlackoutWindow()
 	if err != nil {
 		log.Error("Blackout window is active", "Error", err, "Environment", environment.Name)
 		return
 	}
 
-	_, err = os.Stat(constants.PayloadPath)
+	if !provision.CheckDependencyHealth(ctx, log, environment) {
+		return
+	}
+
+	if !provision.CheckPermissions(ctx, log, config, environment) {
+		return
+	}
+
+	payloadInfo, err := os.Stat(constants.PayloadPath)
 	if err != nil {
 		log.Error("Service payload not found", "ServicePayloadPath", constants.PayloadPath, "Error", err)
 		return
 	}
 
-	if environment.Hotswap {
+	startedAt := time.Now()
+	defer func() {
+		emitDeployMetrics(log, config, environment, startedAt, payloadInfo.Size(), success)
+	}()
+
+	defer runPostRollbackHook(log, environment.Name)
 
-		log.Info("Hot swap enabled")
+	notify.Publish(log, config, environment, notify.Event{
+		Event: constants.EventDeployStarted,
+	})
+
+	span := tracing.Start(nil, "provision").
+		SetAttribute("service.name", config.ServiceName).
+		SetAttribute("service.version", config.ServiceVersion).
+		SetAttribute("environment", environment.Name)
+	tracing.SetRoot(span)
+
+	defer func() {
+		tracing.SetRoot(nil)
+		span.End(success)
+		tracing.Flush(log)
+	}()
+
+	defer func() {
+		if reason := provision.CancelReason(ctx); reason != "" {
+			log.Error("Provision stopped", "Reason", reason, "Environment", environment.Name)
+		}
+	}()
+
+	if !runMigrations(ctx, log, config, environment) {
+		return
+	}
+
+	if environment.Hotswap || environment.InstanceRefresh != nil {
+
+		if environment.InstanceRefresh != nil {
+			log.Info("Instance refresh enabled")
+		} else {
+			log.Info("Hot swap enabled")
+		}
 
 		hotswapStructs := make([]hotswapStruct, 0)
 		hotswapChan := make(chan hotswapStruct)
@@ -202,15 +331,17 @@ func ProvisionOrHotswapStack(env string) (success bool) {
 			}
 		}
 
-		if shouldHotswap {
-			success = HotswapStack(log, config, environment, hotswapStructs)
+		if shouldHotswap && environment.InstanceRefresh != nil {
+			success = RefreshStack(ctx, log, config, environment, hotswapStructs)
+		} else if shouldHotswap {
+			success = HotswapStack(ctx, log, config, environment, hotswapStructs)
 		} else {
-			success = ProvisionStack(log, config, environment)
+			success = ProvisionStack(ctx, log, config, environment)
 		}
 
 	} else {
 
-		success = ProvisionStack(log, config, environment)
+		success = ProvisionStack(ctx, log, config, environment)
 	}
 
 	return
@@ -355,57 +486,40 @@ elbLoop:
 	return
 }
 
-func HotswapStack(log log15.Logger, config *conf.Config,
+func HotswapStack(ctx context.Context, log log15.Logger, config *conf.Config,
 	environment *conf.Environment, hotswapStructs []hotswapStruct) (success bool) {
 
-	var stackName string
-	stackRegions := make(map[string]*provision_state.Region)
-
-	for _, hotswapStruct := range hotswapStructs {
-		if stackName == "" {
-			stackName = hotswapStruct.stackName
-		}
-
-		log.Debug("hotswapStruct",
-			"shouldHotswap", hotswapStruct.shouldHotswap,
-			"stackId", hotswapStruct.stackId,
-			"stackName", hotswapStruct.stackName,
-			"region", hotswapStruct.region,
-		)
-
-		if stackName != hotswapStruct.stackName {
-			log.Error("invariant violation: mismatching stack names",
-				"current", stackName, "next", hotswapStruct.stackName)
-			return
-		}
-
-		stackRegions[hotswapStruct.region] = &provision_state.Region{
-			StackId: hotswapStruct.stackId,
-		}
+	stack, ok := inPlaceStack(log, environment, hotswapStructs)
+	if !ok {
+		return
 	}
 
-	stack := provision_state.Stack{
-		Environment: environment.Name,
-		Hotswap:     true,
-		Name:        stackName,
-		Regions:     stackRegions,
+	if !checkHotswapInterlock(log, config, environment, stack) {
+		return
 	}
 
 	defer func() {
 
 		log.Debug("defer post-hook execute")
 
-		postHookSuccess := hook.Execute(log, constants.HookPostHotswap,
+		postHookSuccess := runHook(log, constants.HookPostHotswap,
 			environment.Name, stack.Regions, success)
 
 		success = success && postHookSuccess
 	}()
 
-	if !hook.Execute(log, constants.HookPreHotswap, environment.Name, nil, true) {
+	if !runHook(log, constants.HookPreHotswap, environment.Name, nil, true) {
+		return
+	}
+
+	// instances the group replaces mid-swap never report and fail the swap
+	resumeProcesses, ok := suspendDeployProcesses(log, environment, stack)
+	defer resumeProcesses()
+	if !ok {
 		return
 	}
 
-	if !provision.UpdateStack(log, config, stack) {
+	if !provision.UpdateStack(ctx, log, config, stack) {
 		return
 	}
 
@@ -415,7 +529,7 @@ func HotswapStack(log log15.Logger, config *conf.Config,
 
 		go func(environment *conf.Environment, regionName string, regionState *provision_state.Region) {
 
-			successChan <- hotswapStackPoll(log, environment, regionName, regionState)
+			successChan <- hotswapStackPoll(ctx, log, config, environment, regionName, regionState)
 
 		}(environment, regionName, regionState)
 	}
@@ -428,7 +542,7 @@ func HotswapStack(log log15.Logger, config *conf.Config,
 	}
 
 	if success {
-		success = writeProvisionOutput(log, stack)
+		success = writeProvisionOutput(log, config, stack)
 	}
 
 	if success {
@@ -440,16 +554,65 @@ func HotswapStack(log log15.Logger, config *conf.Config,
 	return
 }
 
-func hotswapStackPoll(log log15.Logger, environment *conf.Environment,
+// inPlaceStack is the state of the stack that's updated by a hot swap or an
+// instance refresh
+func inPlaceStack(log log15.Logger, environment *conf.Environment,
+	hotswapStructs []hotswapStruct) (stack provision_state.Stack, success bool) {
+
+	var stackName string
+	stackRegions := make(map[string]*provision_state.Region)
+
+	for _, hotswapStruct := range hotswapStructs {
+		if stackName == "" {
+			stackName = hotswapStruct.stackName
+		}
+
+		log.Debug("hotswapStruct",
+			"shouldHotswap", hotswapStruct.shouldHotswap,
+			"stackId", hotswapStruct.stackId,
+			"stackName", hotswapStruct.stackName,
+			"region", hotswapStruct.region,
+		)
+
+		if stackName != hotswapStruct.stackName {
+			log.Error("invariant violation: mismatching stack names",
+				"current", stackName, "next", hotswapStruct.stackName)
+			return
+		}
+
+		stackRegions[hotswapStruct.region] = &provision_state.Region{
+			StackId: hotswapStruct.stackId,
+		}
+	}
+
+	// Hotswap means there's nothing to promote
+	stack = provision_state.Stack{
+		Environment: environment.Name,
+		Hotswap:     true,
+		Name:        stackName,
+		Regions:     stackRegions,
+	}
+
+	success = true
+	return
+}
+
+func hotswapStackPoll(ctx context.Context, log log15.Logger, config *conf.Config, environment *conf.Environment,
 	regionName string, regionState *provision_state.Region) (success bool) {
 
 	log.Info("Polling for hotswap completion")
 
+	span := tracing.Start(tracing.Root(), "wait for hot swap").SetAttribute("region", regionName)
+	defer func() {
+		span.End(success)
+		emitStepFailed(ctx, config, environment, regionName, regionState.StackId, "wait for hot swap", success)
+	}()
+
 	var (
 		receiveMessageOutput *sqs.ReceiveMessageOutput
 
 		queueUrl string
-		asgName  string
+		asgNames []string
 		asgSize  int
 	)
 
@@ -459,15 +622,21 @@ func hotswapStackPoll(log log15.Logger, environment *conf.Environment,
 		return
 	}
 
-	roleSession := aws_session.STS(regionName, roleARN, 0)
+	roleSession := aws_session.WithContext(ctx, aws_session.STS(regionName, roleARN, 0))
 	sqsClient := sqs.New(roleSession)
 
-	if !getQueueUrlAndAsgName(log, roleSession, regionState.StackId, &queueUrl, &asgName) {
+	if !getQueueUrlAndAsgNames(log, roleSession, regionState.StackId, &queueUrl, &asgNames) {
 		return
 	}
 
-	if !getAsgSize(log, roleSession, asgName, &asgSize) {
-		return
+	// every instance group's instances hot swap
+	for _, asgName := range asgNames {
+		var groupSize int
+
+		if !getAsgSize(log, roleSession, asgName, &groupSize) {
+			return
+		}
+		asgSize += groupSize
 	}
 
 	// from cloudformation:UpdateStack there are a few timings that inform this
@@ -483,6 +652,14 @@ func hotswapStackPoll(log log15.Logger, environment *conf.Environment,
 	loopCount := 0
 	for asgSize != receiveSuccess {
 
+		if ctx.Err() != nil {
+			logStopped(log, ctx, regionState.StackId, "Instances", asgSize, "ReportedSuccess", receiveSuccess)
+			if rollbackOnCancel(ctx) {
+				cancelStackUpdate(log, environment, regionName, regionState.StackId)
+			}
+			return
+		}
+
 		if loopCount == 30 {
 			log.Error("Never received messages from all EC2 instances")
 			return
@@ -498,6 +675,10 @@ func hotswapStackPoll(log log15.Logger, environment *conf.Environment,
 		if !util.SuccessRetryer(7, retryMsg, func() bool {
 			receiveMessageOutput, err = sqsClient.ReceiveMessage(receiveMessageInput)
 			if err != nil {
+				// the loop reports where the hot swap stopped
+				if ctx.Err() != nil {
+					return true
+				}
 				log.Error("sqs:ReceiveMessage", "Error", err)
 				return false
 			}
@@ -506,10 +687,17 @@ func hotswapStackPoll(log log15.Logger, environment *conf.Environment,
 			return
 		}
 
+		if ctx.Err() != nil {
+			continue
+		}
+
 		for _, message := range receiveMessageOutput.Messages {
 
 			if message.Body != nil && *message.Body == "success" {
 				log.Info("Received success")
+				if receiveSuccess == 0 {
+					recordFirstHealthy(regionName, time.Now())
+				}
 				receiveSuccess++
 			} else {
 				log.Error("A EC2 instance reported an error during hot swap")
@@ -523,19 +711,35 @@ func hotswapStackPoll(log log15.Logger, environment *conf.Environment,
 
 	log.Info("All EC2 instances in this region reported hot swap success")
 
+	// monitoring may have changed with the deploy
+	if !provision.EnsureMonitoringStack(log, roleSession, config, environment, regionName, regionState.StackId) {
+		return
+	}
+
+	notify.Publish(log, config, environment, notify.Event{
+		Event:   constants.EventHealthCheckPassed,
+		Region:  regionName,
+		StackId: regionState.StackId,
+		Message: "hot swap",
+	})
+	events.Emit(events.StackUpdated{
+		Header:  stackEventHeader(config, environment, regionName, regionState.StackId),
+		StackId: regionState.StackId,
+	})
+
 	success = true
 	return
 }
 
-func getQueueUrlAndAsgName(log log15.Logger, roleSession *session.Session,
-	stackId string, queueUrl, asgName *string) (success bool) {
+func getQueueUrlAndAsgNames(log log15.Logger, roleSession *session.Session,
+	stackId string, queueUrl *string, asgNames *[]string) (success bool) {
 
 	var (
 		describeStackResourcesOutput *cloudformation.DescribeStackResourcesOutput
 		err                          error
 	)
 
-	log.Debug("getQueueUrlAndAsgName", "stackId", stackId)
+	log.Debug("getQueueUrlAndAsgNames", "stackId", stackId)
 
 	cfnClient := cloudformation.New(roleSession)
 
@@ -543,7 +747,7 @@ func getQueueUrlAndAsgName(log log15.Logger, roleSession *session.Session,
 		StackName: aws.String(stackId),
 	}
 
-	log.Info(fmt.Sprintf("Getting ASG logical name and %s URL", constants.SignalQueue))
+	log.Info(fmt.Sprintf("Getting ASG names and %s URL", constants.SignalQueue))
 	log.Info("cloudformation:DescribeStackResources")
 	retryMsg := func(i int) { log.Warn("cloudformation:DescribeStackResources retrying", "Count", i) }
 	if !util.SuccessRetryer(7, retryMsg, func() bool {
@@ -554,11 +758,9 @@ func getQueueUrlAndAsgName(log log15.Logger, roleSession *session.Session,
 			return false
 		}
 
-		for _, stackResource := range describeStackResourcesOutput.StackResources {
+		*asgNames = make([]string, 0)
 
-			if *queueUrl != "" && *asgName != "" {
-				break
-			}
+		for _, stackResource := range describeStackResourcesOutput.StackResources {
 
 			switch *stackResource.ResourceType {
 
@@ -568,7 +770,7 @@ func getQueueUrlAndAsgName(log log15.Logger, roleSession *session.Session,
 				}
 
 			case cfn.AutoScaling_AutoScalingGroup:
-				*asgName = *stackResource.PhysicalResourceId
+				*asgNames = append(*asgNames, *stackResource.PhysicalResourceId)
 			}
 		}
 
@@ -578,7 +780,7 @@ func getQueueUrlAndAsgName(log log15.Logger, roleSession *session.Session,
 		return
 	}
 
-	log.Debug("getQueueUrlAndAsgName", "queueUrl", *queueUrl, "asgName", *asgName)
+	log.Debug("getQueueUrlAndAsgNames", "queueUrl", *queueUrl, "asgNames", *asgNames)
 
 	success = true
 	return
@@ -630,7 +832,7 @@ func getAsgSize(log log15.Logger, roleSession *session.Session, asgName string,
 	return
 }
 
-func ProvisionStack(log log15.Logger, config *conf.Config, environment *conf.Environment) (success bool) {
+func ProvisionStack(ctx context.Context, log log15.Logger, config *conf.Config, environment *conf.Environment) (success bool) {
 
 	stack := &provision_state.Stack{
 		Environment: environment.Name,
@@ -640,17 +842,23 @@ func ProvisionStack(log log15.Logger, config *conf.Config, environment *conf.Env
 
 		log.Debug("defer post-hook execute")
 
-		postHookSuccess := hook.Execute(log, constants.HookPostProvision,
+		postHookSuccess := runHook(log, constants.HookPostProvision,
 			environment.Name, stack.Regions, success)
 
 		success = success && postHookSuccess
 	}()
 
-	if !hook.Execute(log, constants.HookPreProvision, environment.Name, nil, true) {
+	if !runHook(log, constants.HookPreProvision, environment.Name, nil, true) {
+		return
+	}
+
+	if !provision.CreateStack(ctx, log, config, stack) {
 		return
 	}
 
-	if !provision.CreateStack(log, config, stack) {
+	if aws_session.AuditPath() != "" {
+		log.Info("Audit mode. Not waiting for stacks that weren't created")
+		success = true
 		return
 	}
 
@@ -660,7 +868,7 @@ func ProvisionStack(log log15.Logger, config *conf.Config, environment *conf.Env
 
 		go func(environment *conf.Environment, regionName string, regionState *provision_state.Region) {
 
-			successChan <- provisionStackPoll(log, environment, regionName, regionState)
+			successChan <- provisionStackPoll(ctx, log, config, environment, regionName, regionState)
 
 		}(environment, regionName, regionState)
 	}
@@ -674,10 +882,16 @@ func ProvisionStack(log log15.Logger, config *conf.Config, environment *conf.Env
 
 	if success {
 
-		success = writeProvisionOutput(log, *stack)
+		success = writeProvisionOutput(log, config, *stack)
 
 	} else {
 
+		failure := "stack creation failed"
+		if reason := provision.CancelReason(ctx); reason != "" {
+			failure = "stack creation stopped: " + reason
+		}
+		recordStack(log, config, *stack, provision_state.StatusFailed, failure)
+
 		if len(stack.Regions) > 0 {
 			log.Warn("Some regions failed to create. Deleting the successful ones")
 
@@ -688,15 +902,14 @@ func ProvisionStack(log log15.Logger, config *conf.Config, environment *conf.Env
 					continue
 				}
 
-				roleSession := aws_session.STS(regionName, roleARN, 0)
-				cfnClient := cloudformation.New(roleSession)
-
-				log.Info("cloudformation:DeleteStack", "StackId", regionState.StackId)
-				deleteStackInput := &cloudformation.DeleteStackInput{
-					StackName: aws.String(regionState.StackId),
+				cfnRoleARN, err := environment.GetCFNRoleARN(regionName)
+				if err != nil {
+					log.Error("GetCFNRoleARN", "Error", err)
+					continue
 				}
 
-				cfnClient.DeleteStack(deleteStackInput)
+				roleSession := aws_session.STS(regionName, roleARN, 0)
+				provision.DeleteStack(log.New("Region", regionName), roleSession, regionState.StackId, cfnRoleARN)
 			}
 		}
 	}
@@ -704,10 +917,11 @@ func ProvisionStack(log log15.Logger, config *conf.Config, environment *conf.Env
 	return
 }
 
-func provisionStackPoll(log log15.Logger, environment *conf.Environment,
+func provisionStackPoll(ctx context.Context, log log15.Logger, config *conf.Config, environment *conf.Environment,
 	regionName string, regionState *provision_state.Region) (success bool) {
 
 	var (
+		stackStatus                 string
 		stackProvisioned            bool
 		elbLogicalId                string
 		describeStackResourceOutput *cloudformation.DescribeStackResourceOutput
@@ -715,6 +929,12 @@ func provisionStackPoll(log log15.Logger, environment *conf.Environment,
 
 	log = log.New("Region", regionName)
 
+	span := tracing.Start(tracing.Root(), "wait for stack").SetAttribute("region", regionName)
+	defer func() {
+		span.End(success)
+		emitStepFailed(ctx, config, environment, regionName, regionState.StackId, "wait for stack", success)
+	}()
+
 	region, err := environment.GetRegion(regionName)
 	if err != nil {
 		log.Error("GetRegion", "Error", err)
@@ -728,7 +948,30 @@ func provisionStackPoll(log log15.Logger, environment *conf.Environment,
 	}
 
 	roleSession := aws_session.STS(region.Name, roleARN, constants.StackCreationTimeout())
-	cfnClient := cloudformation.New(roleSession)
+	cfnClient := cloudformation.New(aws_session.WithContext(ctx, roleSession))
+
+	// ECS services don't have instances bootstrapped by porter
+	if environment.Compute != conf.Compute_ECS {
+		stopProgressWatch := watchBootstrapProgress(log, roleSession, regionName, regionState.StackId)
+		defer func() {
+			stopProgressWatch(!stackProvisioned)
+		}()
+	}
+
+	// instances the groups replace or rebalance while they're being created
+	// don't signal the stack. Failed stacks are deleted so there's nothing to
+	// resume
+	var stackFailed bool
+	seenGroups := make(map[string]struct{})
+	suspendedProcesses := make(map[string][]string)
+	if environment.Compute != conf.Compute_ECS {
+		defer func() {
+			if !stackFailed && len(suspendedProcesses) > 0 &&
+				!provision.ResumeProcesses(log, roleSession, suspendedProcesses) {
+				log.Error("Run porter asg resume to resume the processes")
+			}
+		}()
+	}
 
 	n := int(constants.StackCreationTimeout().Seconds() / sleepDuration.Seconds())
 
@@ -741,6 +984,10 @@ stackEventPoll:
 
 		describeStackOutput, err := cfnClient.DescribeStacks(describeStacksInput)
 		if err != nil {
+			if ctx.Err() != nil {
+				logStopped(log, ctx, regionState.StackId, "StackStatus", stackStatus)
+				return
+			}
 			log.Error("cloudformation:DescribeStack", "Error", err)
 			return
 		}
@@ -749,24 +996,77 @@ stackEventPoll:
 			return
 		}
 
-		log.Info("Stack status", "StackStatus", *describeStackOutput.Stacks[0].StackStatus)
+		stackStatus = *describeStackOutput.Stacks[0].StackStatus
+		log.Info("Stack status", "StackStatus", stackStatus)
 
 		switch *describeStackOutput.Stacks[0].StackStatus {
 		case cfn.CREATE_COMPLETE:
 			stackProvisioned = true
+			notify.Publish(log, config, environment, notify.Event{
+				Event:   constants.EventStackCreated,
+				Region:  regionName,
+				StackId: regionState.StackId,
+			})
+			events.Emit(events.StackCreated{
+				Header:  stackEventHeader(config, environment, regionName, regionState.StackId),
+				StackId: regionState.StackId,
+			})
 			break stackEventPoll
 		case cfn.CREATE_FAILED:
+			stackFailed = true
 			log.Error("Stack creation failed")
+			recordRollback(regionName, regionState.StackId)
+			notify.Publish(log, config, environment, notify.Event{
+				Event:   constants.EventRolledBack,
+				Region:  regionName,
+				StackId: regionState.StackId,
+				Message: "stack creation failed",
+			})
+			events.Emit(events.RolledBack{
+				Header:  stackEventHeader(config, environment, regionName, regionState.StackId),
+				StackId: regionState.StackId,
+				Reason:  "stack creation failed",
+			})
+			analyzeHookFailures(log, roleSession, regionState.StackId)
+			if environment.Compute != conf.Compute_ECS {
+				analyzeStackFailure(log, roleSession, regionState.StackId)
+			}
 			return
 		case cfn.DELETE_IN_PROGRESS:
+			stackFailed = true
 			log.Error("Stack is being deleted")
 			return
 		case cfn.ROLLBACK_IN_PROGRESS:
+			stackFailed = true
 			log.Error("Stack is rolling back")
+			recordRollback(regionName, regionState.StackId)
+			notify.Publish(log, config, environment, notify.Event{
+				Event:   constants.EventRolledBack,
+				Region:  regionName,
+				StackId: regionState.StackId,
+				Message: "stack creation failed",
+			})
+			events.Emit(events.RolledBack{
+				Header:  stackEventHeader(config, environment, regionName, regionState.StackId),
+				StackId: regionState.StackId,
+				Reason:  "stack creation failed",
+			})
+			analyzeHookFailures(log, roleSession, regionState.StackId)
+			if environment.Compute != conf.Compute_ECS {
+				analyzeStackFailure(log, roleSession, regionState.StackId)
+			}
 			return
 		}
 
-		time.Sleep(sleepDuration)
+		if environment.Compute != conf.Compute_ECS &&
+			!suspendNewDeployProcesses(log, roleSession, regionState.StackId, seenGroups, suspendedProcesses) {
+			return
+		}
+
+		if !sleepContext(ctx, sleepDuration) {
+			logStopped(log, ctx, regionState.StackId, "StackStatus", stackStatus)
+			return
+		}
 	}
 
 	if !stackProvisioned {
@@ -790,7 +1090,11 @@ stackEventPoll:
 
 	cfnTemplate.ParseResources()
 
-	if region.PrimaryTopology() == conf.Topology_Inet {
+	// ECS services are promoted into the environment's ALB by their target
+	// group and dns that targets instances has no ELB at all
+	if region.PrimaryTopology() == conf.Topology_Inet &&
+		environment.Compute != conf.Compute_ECS &&
+		!region.DNSToInstances() {
 
 		elbLogicalId, err = cfnTemplate.GetResourceName(cfn.ElasticLoadBalancing_LoadBalancer)
 		if err != nil {
@@ -822,11 +1126,15 @@ stackEventPoll:
 			*describeStackResourceOutput.StackResourceDetail.PhysicalResourceId
 	}
 
+	if !provision.EnsureMonitoringStack(log, roleSession, config, environment, regionName, regionState.StackId) {
+		return
+	}
+
 	success = true
 	return
 }
 
-func writeProvisionOutput(log log15.Logger, stack provision_state.Stack) (success bool) {
+func writeProvisionOutput(log log15.Logger, config *conf.Config, stack provision_state.Stack) (success bool) {
 
 	provisionBytes, err := json.Marshal(stack)
 	if err != nil {
@@ -841,6 +1149,8 @@ func writeProvisionOutput(log log15.Logger, stack provision_state.Stack) (succes
 		return
 	}
 
+	recordStack(log, config, stack, provision_state.StatusProvisioned, "")
+
 	success = true
 	return
 }
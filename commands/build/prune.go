@@ -19,7 +19,6 @@ import (
 
 	"github.com/adobe-platform/porter/conf"
 	"github.com/adobe-platform/porter/constants"
-	"github.com/adobe-platform/porter/hook"
 	"github.com/adobe-platform/porter/logger"
 	"github.com/adobe-platform/porter/provision_state"
 	"github.com/adobe-platform/porter/prune"
@@ -42,12 +41,19 @@ func (recv *PruneCmd) LongHelp() string {
     prune -- Delete extra CloudFormation stacks
 
 SYNOPSIS
-    prune [--keep <stacks to keep>]
+    prune [--keep <stacks to keep>] [--yes]
 
 DESCRIPTION
     Delete extra CloudFormation stacks. Instances attached to the configured
     ELB are not candidates for deletion.
 
+    Load balancers, target groups, alarms, and log groups left behind by the
+    service's deleted stacks are found by their CloudFormation tags and
+    deleted. Stacks in DELETE_FAILED are deleted again keeping the resources
+    that failed to delete so a later prune can delete them. The DNS records
+    and health checks of dns target instances or stack are deleted once the
+    stack they point at is gone.
+
 OPTIONS
     --keep
         The number of stacks to keep with the status CREATE_COMPLETE,
@@ -58,7 +64,10 @@ OPTIONS
         configured ELB will be kept.
 
         Eligible stacks will be sorted by creation time with the oldest being
-        deleted first.`
+        deleted first.
+
+    --yes
+        Skip the environment's confirm prompt. See porter build deploy --help`
 }
 
 func (recv *PruneCmd) SubCommands() []cli.Command {
@@ -73,6 +82,7 @@ func (recv *PruneCmd) Execute(args []string) bool {
 
 	var elbTag string
 	var keepCount int
+	var yes bool
 
 	if len(args) > 0 {
 
@@ -80,6 +90,7 @@ func (recv *PruneCmd) Execute(args []string) bool {
 
 		flagSet.IntVar(&keepCount, "keep", 0, "")
 		flagSet.StringVar(&elbTag, "elb", "", "")
+		flagSet.BoolVar(&yes, "yes", false, "")
 		flagSet.Parse(args)
 
 		if keepCount < 0 {
@@ -102,6 +113,10 @@ func (recv *PruneCmd) Execute(args []string) bool {
 		os.Exit(1)
 	}
 
+	if !confirmPrune(log, stack, yes) {
+		os.Exit(1)
+	}
+
 	if !doPrune(log, stack, keepCount, elbTag) {
 		os.Exit(1)
 	}
@@ -110,11 +125,29 @@ func (recv *PruneCmd) Execute(args []string) bool {
 	return true
 }
 
+// confirmPrune asks for the confirmation of the pruned stack's environment
+func confirmPrune(log log15.Logger, stack *provision_state.Stack, yes bool) (success bool) {
+
+	config, getConfigSuccess := conf.GetAlteredConfig(log)
+	if !getConfigSuccess {
+		return
+	}
+
+	environment, err := config.GetEnvironment(stack.Environment)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	success = confirmEnvironment(log, environment, yes)
+	return
+}
+
 func doPrune(log log15.Logger, stack *provision_state.Stack, keepCount int, elbTag string) (success bool) {
 
 	defer func() {
 
-		postHookSuccess := hook.Execute(log, constants.HookPostPrune,
+		postHookSuccess := runHook(log, constants.HookPostPrune,
 			stack.Environment, stack.Regions, success)
 
 		success = success && postHookSuccess
@@ -131,7 +164,7 @@ func doPrune(log log15.Logger, stack *provision_state.Stack, keepCount int, elbT
 		return
 	}
 
-	if !hook.Execute(log, constants.HookPrePrune, stack.Environment, stack.Regions, true) {
+	if !runHook(log, constants.HookPrePrune, stack.Environment, stack.Regions, true) {
 		return
 	}
 
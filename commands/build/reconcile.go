@@ -0,0 +1,344 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/inconshreveable/log15"
+	"github.com/phylake/go-cli"
+)
+
+type ReconcileCmd struct{}
+
+func (recv *ReconcileCmd) Name() string {
+	return "reconcile"
+}
+
+func (recv *ReconcileCmd) ShortHelp() string {
+	return "Deploy a git ref if the environment isn't already running it"
+}
+
+func (recv *ReconcileCmd) LongHelp() string {
+	return `NAME
+    reconcile -- Deploy a git ref if the environment isn't already running it
+
+SYNOPSIS
+    reconcile -e <environment out of .porter/config> --ref <git ref>
+              [-keep <stacks to keep>] [--timeout <duration>] [--yes]
+              [--dry-run]
+
+DESCRIPTION
+    Compare what the git ref would deploy with what each region of the
+    environment is running and deploy the ref only if they differ. It's meant
+    to run on a schedule so an environment follows a branch or tag without a
+    build pushing to it.
+
+    The ref is resolved to a commit in the current repository and checked out
+    into a temporary git worktree so the current checkout isn't touched.
+    Fetch first for the ref to include new commits.
+
+    A region is in sync when its latest deploy in the state store is
+    provisioned or promoted, its service version is the commit, and the
+    template rendered from the commit's .porter/config for the deployed
+    service payload matches the stack's template.
+
+    When every region is in sync a no-op report is printed and nothing is
+    built. Otherwise the commit is packed and deployed like porter build pack
+    followed by porter deploy, which locks the environment, promotes, and
+    prunes.
+
+OPTIONS
+    -e
+        Environment from .porter/config
+
+    --ref
+        A branch, tag, or commit like origin/main
+
+    -keep
+        The number of stacks prune keeps. See prune --help
+
+    --timeout
+        How long the deploy has to finish. See deploy --help
+
+    --yes
+        Skip the environment's confirm prompt. Required for an environment
+        with confirm set
+
+    --dry-run
+        Print the report without deploying`
+}
+
+func (recv *ReconcileCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *ReconcileCmd) Execute(args []string) bool {
+
+	if len(args) > 0 {
+		var environment, ref string
+		var keepCount int
+		var timeout time.Duration
+		var yes, dryRun bool
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&environment, "e", "", "")
+		flagSet.StringVar(&ref, "ref", "", "")
+		flagSet.IntVar(&keepCount, "keep", 0, "")
+		flagSet.DurationVar(&timeout, "timeout", 0, "")
+		flagSet.BoolVar(&yes, "yes", false, "")
+		flagSet.BoolVar(&dryRun, "dry-run", false, "")
+		flagSet.Usage = func() {
+			fmt.Println(recv.LongHelp())
+		}
+		flagSet.Parse(args)
+
+		if environment == "" || ref == "" || keepCount < 0 || timeout < 0 {
+			return false
+		}
+
+		if !reconcile(environment, ref, keepCount, timeout, yes, dryRun) {
+			os.Exit(1)
+		}
+		return true
+	}
+
+	return false
+}
+
+// regionDiff is why a region isn't running the commit. It's empty if it is
+type regionDiff struct {
+	region string
+	reason string
+}
+
+func reconcile(env, ref string, keepCount int, timeout time.Duration, yes, dryRun bool) (success bool) {
+	log := logger.CLI("cmd", "reconcile")
+
+	commit, err := gitOutput("", "rev-parse", "--verify", ref+"^{commit}")
+	if err != nil {
+		log.Error("git rev-parse", "Ref", ref, "Error", err)
+		return
+	}
+	log = log.New("Ref", ref, "Commit", commit)
+
+	worktree, err := ioutil.TempDir("", "porter-reconcile-")
+	if err != nil {
+		log.Error("ioutil.TempDir", "Error", err)
+		return
+	}
+	defer os.RemoveAll(worktree)
+
+	_, err = gitOutput("", "worktree", "add", "--detach", worktree, commit)
+	if err != nil {
+		log.Error("git worktree add", "Error", err)
+		return
+	}
+	defer func() {
+		_, err := gitOutput("", "worktree", "remove", "--force", worktree)
+		if err != nil {
+			log.Warn("git worktree remove", "Path", worktree, "Error", err)
+		}
+	}()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		log.Error("os.Getwd", "Error", err)
+		return
+	}
+
+	// pack and deploy read and write relative to the working directory
+	err = os.Chdir(worktree)
+	if err != nil {
+		log.Error("os.Chdir", "Path", worktree, "Error", err)
+		return
+	}
+	defer os.Chdir(wd)
+
+	config, getConfigSuccess := conf.GetConfig(log, true)
+	if !getConfigSuccess {
+		return
+	}
+
+	environment, err := config.GetEnvironment(env)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	// pack sets the service version the same way
+	config.ServiceVersion, err = gitOutput("", "rev-parse", "--short", "HEAD")
+	if err != nil {
+		log.Error("git rev-parse", "Error", err)
+		return
+	}
+
+	diffs, diffSuccess := diffEnvironment(log, config, environment)
+	if !diffSuccess {
+		return
+	}
+
+	fmt.Printf("%s at %s (%s)\n", environment.Name, ref, config.ServiceVersion)
+	for _, diff := range diffs {
+		if diff.reason == "" {
+			fmt.Printf("  %s  in sync\n", diff.region)
+		} else {
+			fmt.Printf("  %s  %s\n", diff.region, diff.reason)
+		}
+	}
+
+	if inSync(diffs) {
+		fmt.Println("No-op. Every region is running the commit")
+		success = true
+		return
+	}
+
+	if dryRun {
+		success = true
+		return
+	}
+
+	log.Info("Deploying the commit")
+
+	if _, packSuccess := pack(log); !packSuccess {
+		return
+	}
+
+	success = deploy(env, keepCount, false, false, timeout, false, yes, false)
+	return
+}
+
+func inSync(diffs []regionDiff) bool {
+	for _, diff := range diffs {
+		if diff.reason != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// diffEnvironment says why each region isn't running config's service
+// version and template
+func diffEnvironment(log log15.Logger, config *conf.Config,
+	environment *conf.Environment) (diffs []regionDiff, success bool) {
+
+	store := provision.GetStateStore(config)
+
+	for _, region := range environment.Regions {
+		regionLog := log.New("Region", region.Name)
+
+		deployment, err := store.Get(config.ServiceName, environment.Name, region.Name)
+		if err != nil {
+			regionLog.Error("State store Get", "Error", err)
+			return
+		}
+
+		reason, diffSuccess := diffRegion(regionLog, config, environment, region, deployment)
+		if !diffSuccess {
+			return
+		}
+
+		diffs = append(diffs, regionDiff{
+			region: region.Name,
+			reason: reason,
+		})
+	}
+
+	success = true
+	return
+}
+
+func diffRegion(log log15.Logger, config *conf.Config, environment *conf.Environment,
+	region *conf.Region, deployment *provision_state.Deployment) (reason string, success bool) {
+
+	if deployment == nil {
+		reason = "never deployed"
+		success = true
+		return
+	}
+
+	switch deployment.Status {
+	case provision_state.StatusProvisioned, provision_state.StatusPromoted:
+	default:
+		reason = "latest deploy is " + deployment.Status
+		success = true
+		return
+	}
+
+	if deployment.ServiceVersion != config.ServiceVersion {
+		reason = fmt.Sprintf("running %s", deployment.ServiceVersion)
+		success = true
+		return
+	}
+
+	roleSession, ok := refreshRoleSession(log, environment, region.Name)
+	if !ok {
+		return
+	}
+
+	// the same service payload renders the same template unless
+	// .porter/config or porter changed
+	templateBytes, renderSuccess := provision.RenderPayloadTemplate(log, config, environment, region,
+		roleSession, deployment.PayloadChecksum)
+	if !renderSuccess {
+		return
+	}
+
+	getTemplateOutput, err := cloudformation.New(roleSession).GetTemplate(&cloudformation.GetTemplateInput{
+		StackName: &deployment.StackId,
+	})
+	if err != nil {
+		log.Error("cloudformation:GetTemplate", "StackId", deployment.StackId, "Error", err)
+		return
+	}
+
+	var liveTemplate []byte
+	if getTemplateOutput.TemplateBody != nil {
+		liveTemplate = []byte(*getTemplateOutput.TemplateBody)
+	}
+
+	changes, err := cfn.DiffTemplates(liveTemplate, templateBytes)
+	if err != nil {
+		log.Error("cfn.DiffTemplates", "Error", err)
+		return
+	}
+
+	if len(changes) > 0 {
+		for _, change := range changes {
+			log.Info("Template change", "Change", change.String())
+		}
+		reason = fmt.Sprintf("%d template changes", len(changes))
+	}
+
+	success = true
+	return
+}
+
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr
+
+	output, err := cmd.Output()
+	return strings.TrimSpace(string(output)), err
+}
@@ -0,0 +1,254 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	awsutil "github.com/adobe-platform/porter/aws/util"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/adobe-platform/porter/secrets"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/inconshreveable/log15"
+	"github.com/phylake/go-cli"
+)
+
+type SecretsDiffCmd struct{}
+
+func (recv *SecretsDiffCmd) Name() string {
+	return "diff"
+}
+
+func (recv *SecretsDiffCmd) ShortHelp() string {
+	return "Compare local secrets with the deployed secrets"
+}
+
+func (recv *SecretsDiffCmd) LongHelp() string {
+	return `NAME
+    diff -- Compare local secrets with the deployed secrets
+
+SYNOPSIS
+    diff -e <environment out of .porter/config>
+
+DESCRIPTION
+    Resolve secrets the way provision does and compare them with the secrets
+    of the deployed stack in each region.
+
+    The deployed stack is the one attached to the region's ELB or, without an
+    ELB, the most recently created stack.
+
+    Only the names of added, removed, and changed secrets are printed. Values
+    are compared by checksum and never printed or logged.
+
+    diff always runs in read-only mode so it can be run with read-only
+    credentials.`
+}
+
+func (recv *SecretsDiffCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *SecretsDiffCmd) Execute(args []string) bool {
+
+	if len(args) > 0 {
+		var environment string
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&environment, "e", "", "")
+		flagSet.Usage = func() {
+			fmt.Println(recv.LongHelp())
+		}
+		flagSet.Parse(args)
+
+		if !diffSecrets(environment) {
+			os.Exit(1)
+		}
+		return true
+	}
+
+	return false
+}
+
+func diffSecrets(env string) (success bool) {
+	log := logger.CLI("cmd", "secrets-diff")
+
+	aws_session.EnableReadOnly()
+
+	config, getConfigSuccess := conf.GetConfig(log, true)
+	if !getConfigSuccess {
+		return
+	}
+
+	environment, err := config.GetEnvironment(env)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	stackName, err := provision.GetStackName(config.ServiceName, environment.Name, false)
+	if err != nil {
+		log.Error("provision.GetStackName", "Error", err)
+		return
+	}
+
+	for _, region := range environment.Regions {
+		if !diffRegionSecrets(log, config, environment, region, stackName) {
+			return
+		}
+	}
+
+	success = true
+	return
+}
+
+func diffRegionSecrets(log log15.Logger, config *conf.Config, environment *conf.Environment,
+	region *conf.Region, stackName string) (success bool) {
+
+	log = log.New("Region", region.Name)
+
+	roleARN, err := environment.GetRoleARN(region.Name)
+	if err != nil {
+		log.Error("GetRoleARN", "Error", err)
+		return
+	}
+
+	roleSession := aws_session.STS(region.Name, roleARN, 0)
+
+	resolved, resolveSecretsSuccess := provision.ResolveSecrets(log, config, environment, region, roleSession)
+	if !resolveSecretsSuccess {
+		return
+	}
+
+	stack, findDeployedStackSuccess := findDeployedStack(log, region, roleSession, stackName)
+	if !findDeployedStackSuccess {
+		return
+	}
+
+	var deployed secrets.Payload
+	if stack == nil {
+		log.Warn("No deployed stack. All secrets are new")
+	} else {
+		log.Info("Comparing with deployed stack", "StackId", *stack.StackId)
+
+		var downloadSuccess bool
+		deployed, downloadSuccess = secrets.DownloadStack(log, roleSession, region.S3Bucket, stack)
+		if !downloadSuccess {
+			return
+		}
+	}
+
+	diff := secrets.DiffPayloads(deployed, resolved)
+
+	fmt.Printf("%s %s\n", environment.Name, region.Name)
+	if diff.Empty() {
+		fmt.Println("  no changes")
+	}
+	for _, name := range diff.Added {
+		fmt.Println("  + " + name)
+	}
+	for _, name := range diff.Removed {
+		fmt.Println("  - " + name)
+	}
+	for _, name := range diff.Changed {
+		fmt.Println("  ~ " + name)
+	}
+
+	success = true
+	return
+}
+
+// findDeployedStack returns the stack whose secrets are in use. stack is nil
+// if the service hasn't been deployed to the region
+func findDeployedStack(log log15.Logger, region *conf.Region, roleSession *session.Session,
+	stackName string) (stack *cloudformation.Stack, success bool) {
+
+	cfnClient := cloudformation.New(roleSession)
+
+	if len(region.ELBs) > 0 {
+
+		// promote tags the ELB with the stack it points at
+		describeTagsOutput, err := elb.New(roleSession).DescribeTags(&elb.DescribeTagsInput{
+			LoadBalancerNames: []*string{aws.String(region.ELBs[0].Name)},
+		})
+		if err != nil {
+			log.Error("elb:DescribeTags", "Error", err)
+			return
+		}
+
+		for _, tagDescription := range describeTagsOutput.TagDescriptions {
+			for _, tag := range tagDescription.Tags {
+				if tag.Key == nil || *tag.Key != constants.PorterStackIdTag {
+					continue
+				}
+
+				describeStacksOutput, err := cfnClient.DescribeStacks(&cloudformation.DescribeStacksInput{
+					StackName: tag.Value,
+				})
+				if err != nil {
+					log.Error("cloudformation:DescribeStacks", "Error", err)
+					return
+				}
+
+				if len(describeStacksOutput.Stacks) != 1 {
+					log.Error("len(describeStacksOutput.Stacks != 1)")
+					return
+				}
+
+				stack = describeStacksOutput.Stacks[0]
+				success = true
+				return
+			}
+		}
+
+		log.Info("No stack attached to ELB", "LoadBalancerName", region.ELBs[0].Name)
+	}
+
+	stacks := make([]*cloudformation.Stack, 0)
+
+	err := cfnClient.DescribeStacksPages(&cloudformation.DescribeStacksInput{},
+		func(page *cloudformation.DescribeStacksOutput, lastPage bool) bool {
+			for _, stack := range page.Stacks {
+				if !strings.HasPrefix(*stack.StackName, stackName) {
+					continue
+				}
+
+				switch *stack.StackStatus {
+				case cloudformation.StackStatusCreateComplete,
+					cloudformation.StackStatusUpdateComplete:
+					stacks = append(stacks, stack)
+				}
+			}
+			return true
+		})
+	if err != nil {
+		log.Error("cloudformation:DescribeStacks", "Error", err)
+		return
+	}
+
+	if len(stacks) > 0 {
+		sort.Sort(sort.Reverse(awsutil.ByDate(stacks)))
+		stack = stacks[0]
+	}
+
+	success = true
+	return
+}
@@ -0,0 +1,210 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+
+	"github.com/adobe-platform/porter/aws/ssm"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/inconshreveable/log15"
+	"github.com/phylake/go-cli"
+)
+
+// the AWS CLI starts sessions with the same plugin
+const sessionManagerPlugin = "session-manager-plugin"
+
+type SessionCmd struct{}
+
+func (recv *SessionCmd) Name() string {
+	return "session"
+}
+
+func (recv *SessionCmd) ShortHelp() string {
+	return "Open a shell on an instance with Session Manager"
+}
+
+func (recv *SessionCmd) LongHelp() string {
+	return `NAME
+    session -- Open a shell on an instance with Session Manager
+
+SYNOPSIS
+    session -e <environment> [-r <region>] --instance <instance id>
+
+DESCRIPTION
+    Start an SSM Session Manager session on an instance of an environment with
+    access set to ssm. Instances of those environments have no key pair and
+    their role lets the SSM agent register them so no ssh key is needed.
+
+    The session is started with the environment's role so access is granted
+    the same way deploys are. The session-manager-plugin the AWS CLI uses
+    must be on the PATH. See
+    https://docs.aws.amazon.com/systems-manager/latest/userguide/session-manager-working-with-install-plugin.html
+
+OPTIONS
+    -e
+        Environment from .porter/config
+
+    -r
+        The instance's region. Required when the environment has more than
+        one region
+
+    --instance
+        The instance id like i-0123456789abcdef0`
+}
+
+func (recv *SessionCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *SessionCmd) Execute(args []string) bool {
+
+	if len(args) > 0 {
+		var env, region, instanceId string
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&env, "e", "", "")
+		flagSet.StringVar(&region, "r", "", "")
+		flagSet.StringVar(&instanceId, "instance", "", "")
+		flagSet.Usage = func() {
+			fmt.Println(recv.LongHelp())
+		}
+		flagSet.Parse(args)
+
+		if env == "" || instanceId == "" {
+			return false
+		}
+
+		if !startSession(env, region, instanceId) {
+			os.Exit(1)
+		}
+		return true
+	}
+
+	return false
+}
+
+func startSession(env, region, instanceId string) (success bool) {
+	log := logger.CLI("cmd", "session", "InstanceId", instanceId)
+
+	config, getConfigSuccess := conf.GetConfig(log, true)
+	if !getConfigSuccess {
+		return
+	}
+
+	environment, err := config.GetEnvironment(env)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	if environment.Access != conf.Access_SSM {
+		log.Warn("The environment's access isn't ssm. The instance may not be registered with Session Manager",
+			"Access", environment.Access)
+	}
+
+	region, ok := defaultRegion(log, environment, region)
+	if !ok {
+		return
+	}
+
+	log = log.New("Region", region)
+
+	roleSession, ok := refreshRoleSession(log, environment, region)
+	if !ok {
+		return
+	}
+
+	success = runSession(log, ssm.New(roleSession), region, &ssm.StartSessionInput{Target: instanceId})
+	return
+}
+
+// defaultRegion is the environment's only region if region is empty
+func defaultRegion(log log15.Logger, environment *conf.Environment, region string) (string, bool) {
+	if region == "" {
+		if len(environment.Regions) != 1 {
+			log.Error("The environment has more than one region. Pass -r <region>")
+			return "", false
+		}
+		region = environment.Regions[0].Name
+	}
+
+	if _, err := environment.GetRegion(region); err != nil {
+		log.Error("GetRegion", "Error", err)
+		return "", false
+	}
+
+	return region, true
+}
+
+// runSession starts a Session Manager session and hands the terminal to the
+// session-manager-plugin until the session ends
+func runSession(log log15.Logger, client *ssm.SSM, region string, input *ssm.StartSessionInput) (success bool) {
+
+	pluginPath, err := exec.LookPath(sessionManagerPlugin)
+	if err != nil {
+		log.Error("Install the session-manager-plugin", "Error", err)
+		return
+	}
+
+	log.Info("ssm:StartSession")
+	output, err := client.StartSession(input)
+	if err != nil {
+		log.Error("ssm:StartSession", "Error", err)
+		return
+	}
+
+	defer func() {
+		log.Info("ssm:TerminateSession", "SessionId", output.SessionId)
+		_, err := client.TerminateSession(&ssm.TerminateSessionInput{SessionId: output.SessionId})
+		if err != nil {
+			log.Warn("ssm:TerminateSession", "Error", err)
+		}
+	}()
+
+	outputBytes, err := json.Marshal(output)
+	if err != nil {
+		log.Error("json.Marshal", "Error", err)
+		return
+	}
+
+	inputBytes, err := json.Marshal(input)
+	if err != nil {
+		log.Error("json.Marshal", "Error", err)
+		return
+	}
+
+	// the plugin owns the terminal until the session ends. Ctrl+C is sent to
+	// the instance instead of stopping porter
+	signal.Ignore(os.Interrupt)
+	defer signal.Reset(os.Interrupt)
+
+	cmd := exec.Command(pluginPath, string(outputBytes), region, "StartSession", "",
+		string(inputBytes), client.Endpoint)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+	if err != nil {
+		log.Error(sessionManagerPlugin, "Error", err)
+		return
+	}
+
+	success = true
+	return
+}
@@ -0,0 +1,326 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/inconshreveable/log15"
+	"github.com/phylake/go-cli"
+)
+
+type (
+	StampDeployCmd struct{}
+	StampStatusCmd struct{}
+)
+
+func (recv *StampDeployCmd) Name() string {
+	return "deploy"
+}
+
+func (recv *StampDeployCmd) ShortHelp() string {
+	return "Deploy a service payload to every stamp of an environment"
+}
+
+func (recv *StampDeployCmd) LongHelp() string {
+	return `NAME
+    deploy -- Deploy a service payload to every stamp of an environment
+
+SYNOPSIS
+    deploy -e <environment out of .porter/config> [-keep <stacks to keep>] [--force-unlock] [--yes]
+
+DESCRIPTION
+    Provision, promote, and prune each stamp of the environment in the order
+    they're defined. Run pack first.
+
+    Each stamp is deployed as the environment <environment><stamp> so its
+    stacks are separate from every other stamp's. All stamps deploy the same
+    service payload and each stamp's stacks are checked for it.
+
+    A failed stamp doesn't stop the others. A summary is printed at the end
+    and deploy exits non-zero if any stamp failed. A single stamp can be
+    redeployed with porter build provision -e <environment><stamp>.
+
+    Each stamp is locked in the state store while it's deployed.
+
+OPTIONS
+    -keep
+        The number of stacks prune keeps for each stamp. See prune --help
+
+    --force-unlock
+        Release each stamp's lock before deploying it. Use this when the build
+        holding the locks died without releasing them.
+
+    --yes
+        Skip the environment's confirm prompt. It's asked once for all of
+        the environment's stamps. See deploy --help`
+}
+
+func (recv *StampDeployCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *StampDeployCmd) Execute(args []string) bool {
+
+	if len(args) > 0 {
+		var environment string
+		var keepCount int
+		var forceUnlock, yes bool
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&environment, "e", "", "")
+		flagSet.IntVar(&keepCount, "keep", 0, "")
+		flagSet.BoolVar(&forceUnlock, "force-unlock", false, "")
+		flagSet.BoolVar(&yes, "yes", false, "")
+		flagSet.Usage = func() {
+			fmt.Println(recv.LongHelp())
+		}
+		flagSet.Parse(args)
+
+		if keepCount < 0 {
+			return false
+		}
+
+		if !deployStamps(environment, keepCount, forceUnlock, yes) {
+			os.Exit(1)
+		}
+		return true
+	}
+
+	return false
+}
+
+func deployStamps(env string, keepCount int, forceUnlock, yes bool) (success bool) {
+	log := logger.CLI("cmd", "stamp-deploy")
+
+	config, getConfigSuccess := conf.GetAlteredConfig(log)
+	if !getConfigSuccess {
+		return
+	}
+
+	environment, err := config.GetEnvironment(env)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	if len(environment.Stamps) == 0 {
+		log.Error("The environment has no stamps", "Environment", environment.Name)
+		return
+	}
+
+	if !confirmEnvironment(log, environment, yes) {
+		return
+	}
+
+	checksum, keepPayloadSuccess := keepPipelinePayload(log)
+	if !keepPayloadSuccess {
+		return
+	}
+
+	log = log.New("PayloadChecksum", checksum)
+
+	ctx, cancel := newDeployContext(log, 0, false)
+	defer cancel()
+
+	failed := make([]string, 0)
+	for _, stamp := range environment.Stamps {
+
+		// stamps after a SIGINT aren't started
+		if ctx.Err() != nil {
+			failed = append(failed, stamp.Name)
+			continue
+		}
+
+		stampEnvironment := environment.Name + stamp.Name
+		stampLog := log.New("Stamp", stamp.Name, "Environment", stampEnvironment)
+		stampLog.Info("Deploying stamp")
+
+		if !deployStamp(ctx, stampLog, config, stampEnvironment, checksum, keepCount, forceUnlock) {
+			stampLog.Error("Stamp failed to deploy")
+			failed = append(failed, stamp.Name)
+		}
+	}
+
+	fmt.Printf("%s stamps\n", environment.Name)
+	for _, stamp := range environment.Stamps {
+		result := "deployed"
+		for _, name := range failed {
+			if name == stamp.Name {
+				result = "FAILED"
+			}
+		}
+		fmt.Printf("  %-20s %s\n", stamp.Name, result)
+	}
+
+	if len(failed) > 0 {
+		log.Error("Stamps failed to deploy", "Stamps", failed)
+		return
+	}
+
+	success = true
+	return
+}
+
+// deployStamp holds the stamp's deploy lock around deployPayload
+func deployStamp(ctx context.Context, log log15.Logger, config *conf.Config, stampEnvironment, checksum string,
+	keepCount int, forceUnlock bool) (success bool) {
+
+	unlock, lockSuccess := lockEnvironment(log, config, stampEnvironment, forceUnlock)
+	if !lockSuccess {
+		return
+	}
+	defer unlock()
+
+	_, success = deployPayload(ctx, log, config, stampEnvironment, checksum, keepCount)
+	return
+}
+
+func (recv *StampStatusCmd) Name() string {
+	return "status"
+}
+
+func (recv *StampStatusCmd) ShortHelp() string {
+	return "Show the deployed stack of every stamp of an environment"
+}
+
+func (recv *StampStatusCmd) LongHelp() string {
+	return `NAME
+    status -- Show the deployed stack of every stamp of an environment
+
+SYNOPSIS
+    status -e <environment out of .porter/config>
+
+DESCRIPTION
+    Print the deployed stack of each stamp in each region with its status,
+    service version, and service payload checksum. Stamps running a different
+    payload than the others are easy to spot.
+
+    The deployed stack is the one attached to the stamp's ELB or, without an
+    ELB, the most recently created stack.
+
+    status always runs in read-only mode so it can be run with read-only
+    credentials.`
+}
+
+func (recv *StampStatusCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *StampStatusCmd) Execute(args []string) bool {
+
+	if len(args) > 0 {
+		var environment string
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&environment, "e", "", "")
+		flagSet.Usage = func() {
+			fmt.Println(recv.LongHelp())
+		}
+		flagSet.Parse(args)
+
+		if !stampStatus(environment) {
+			os.Exit(1)
+		}
+		return true
+	}
+
+	return false
+}
+
+func stampStatus(env string) (success bool) {
+	log := logger.CLI("cmd", "stamp-status")
+
+	aws_session.EnableReadOnly()
+
+	config, getConfigSuccess := conf.GetConfig(log, true)
+	if !getConfigSuccess {
+		return
+	}
+
+	environment, err := config.GetEnvironment(env)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	if len(environment.Stamps) == 0 {
+		log.Error("The environment has no stamps", "Environment", environment.Name)
+		return
+	}
+
+	for _, stamp := range environment.Stamps {
+
+		stampEnvironment, err := environment.StampEnvironment(stamp)
+		if err != nil {
+			log.Error("StampEnvironment", "Stamp", stamp.Name, "Error", err)
+			return
+		}
+
+		stackName, err := provision.GetStackName(config.ServiceName, stampEnvironment.Name, false)
+		if err != nil {
+			log.Error("provision.GetStackName", "Error", err)
+			return
+		}
+
+		fmt.Printf("%s (%s)\n", stamp.Name, stampEnvironment.Name)
+
+		for _, region := range stampEnvironment.Regions {
+
+			regionLog := log.New("Stamp", stamp.Name, "Region", region.Name)
+
+			roleARN, err := stampEnvironment.GetRoleARN(region.Name)
+			if err != nil {
+				regionLog.Error("GetRoleARN", "Error", err)
+				return
+			}
+
+			roleSession := aws_session.STS(region.Name, roleARN, 0)
+
+			stack, findDeployedStackSuccess := findDeployedStack(regionLog, region, roleSession, stackName)
+			if !findDeployedStackSuccess {
+				return
+			}
+
+			if stack == nil {
+				fmt.Printf("  %-15s not deployed\n", region.Name)
+				continue
+			}
+
+			var serviceVersion, payloadChecksum string
+			for _, tag := range stack.Tags {
+				if tag.Key == nil || tag.Value == nil {
+					continue
+				}
+
+				switch *tag.Key {
+				case constants.PorterServiceVersionTag:
+					serviceVersion = *tag.Value
+				case constants.PorterPayloadChecksumTag:
+					payloadChecksum = *tag.Value
+				}
+			}
+
+			fmt.Printf("  %-15s %s %s version=%s payload=%s\n", region.Name,
+				*stack.StackName, *stack.StackStatus, serviceVersion, payloadChecksum)
+		}
+	}
+
+	success = true
+	return
+}
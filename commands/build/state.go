@@ -0,0 +1,574 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/inconshreveable/log15"
+	"github.com/phylake/go-cli"
+)
+
+type (
+	StateShowCmd   struct{}
+	StateRepairCmd struct{}
+
+	// stateIssue is a difference between the provision state and what's
+	// actually in AWS. Issues without a repair have a suggestion instead
+	stateIssue struct {
+		region     string
+		problem    string
+		suggestion string
+		repairHelp string
+		repair     func(log15.Logger) bool
+	}
+)
+
+func (recv *StateShowCmd) Name() string {
+	return "show"
+}
+
+func (recv *StateShowCmd) ShortHelp() string {
+	return "Compare the provision state with AWS"
+}
+
+func (recv *StateShowCmd) LongHelp() string {
+	return `NAME
+    show -- Compare the provision state with AWS
+
+SYNOPSIS
+    show [-provision-output <provision output file>]
+
+DESCRIPTION
+    Print the stack in each region of the provision state written by provision
+    and compare it with CloudFormation and the environment's ELBs.
+
+    Exits non-zero if the provision state is inconsistent with AWS, such as
+    a stack that was deleted after it was provisioned. Inconsistencies with a
+    repair are fixed by porter state repair.
+
+    show always runs in read-only mode so it can be run with read-only
+    credentials.
+
+OPTIONS
+    -provision-output
+        The path to a provision output file. Defaults to the one written by
+        provision.`
+}
+
+func (recv *StateShowCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *StateShowCmd) Execute(args []string) bool {
+
+	if len(args) == 1 && args[0] == "--help" {
+		return false
+	}
+
+	var provisionOutputPath string
+
+	flagSet := flag.NewFlagSet("", flag.ContinueOnError)
+	flagSet.StringVar(&provisionOutputPath, "provision-output", constants.ProvisionOutputPath, "")
+	flagSet.Parse(args)
+
+	if !showState(provisionOutputPath) {
+		os.Exit(1)
+	}
+
+	return true
+}
+
+func (recv *StateRepairCmd) Name() string {
+	return "repair"
+}
+
+func (recv *StateRepairCmd) ShortHelp() string {
+	return "Repair an inconsistent provision state"
+}
+
+func (recv *StateRepairCmd) LongHelp() string {
+	return `NAME
+    repair -- Repair an inconsistent provision state
+
+SYNOPSIS
+    repair [-provision-output <provision output file>] [-y]
+
+DESCRIPTION
+    Compare the provision state with AWS like porter state show and offer a
+    repair for each inconsistency. Every repair is confirmed before it's
+    applied.
+
+    Repairs either remove a region from the provision state so promote and
+    prune leave it alone, or delete a stack that failed to create and was
+    never promoted. Inconsistencies porter can't repair are printed with a
+    suggested next step.
+
+    The provision state is deleted if no regions are left in it.
+
+OPTIONS
+    -provision-output
+        The path to a provision output file. Defaults to the one written by
+        provision.
+
+    -y
+        Apply every repair without asking.`
+}
+
+func (recv *StateRepairCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *StateRepairCmd) Execute(args []string) bool {
+
+	if len(args) == 1 && args[0] == "--help" {
+		return false
+	}
+
+	var provisionOutputPath string
+	var yes bool
+
+	flagSet := flag.NewFlagSet("", flag.ContinueOnError)
+	flagSet.StringVar(&provisionOutputPath, "provision-output", constants.ProvisionOutputPath, "")
+	flagSet.BoolVar(&yes, "y", false, "")
+	flagSet.Parse(args)
+
+	if !repairState(provisionOutputPath, yes) {
+		os.Exit(1)
+	}
+
+	return true
+}
+
+func showState(provisionOutputPath string) (success bool) {
+	log := logger.CLI("cmd", "state-show")
+
+	aws_session.EnableReadOnly()
+
+	_, issues, inspectSuccess := inspectState(log, provisionOutputPath)
+	if !inspectSuccess {
+		return
+	}
+
+	if len(issues) > 0 {
+		log.Error("The provision state is inconsistent with AWS", "Issues", len(issues))
+		return
+	}
+
+	success = true
+	return
+}
+
+func repairState(provisionOutputPath string, yes bool) (success bool) {
+	log := logger.CLI("cmd", "state-repair")
+
+	stack, issues, inspectSuccess := inspectState(log, provisionOutputPath)
+	if !inspectSuccess {
+		return
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	var repaired, unrepaired int
+
+	for _, issue := range issues {
+
+		if issue.repair == nil {
+			unrepaired++
+			continue
+		}
+
+		if !yes {
+			fmt.Printf("%s: %s? [y/N] ", issue.region, issue.repairHelp)
+			answer, _ := reader.ReadString('\n')
+			if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+				unrepaired++
+				continue
+			}
+		}
+
+		if !issue.repair(log.New("Region", issue.region)) {
+			return
+		}
+		repaired++
+	}
+
+	if repaired > 0 && !writeState(log, provisionOutputPath, stack) {
+		return
+	}
+
+	if unrepaired > 0 {
+		log.Error("Inconsistencies remain", "Repaired", repaired, "Unrepaired", unrepaired)
+		return
+	}
+
+	log.Info("The provision state is consistent with AWS", "Repaired", repaired)
+	success = true
+	return
+}
+
+// writeState saves a repaired provision state. An empty one is deleted since
+// there's nothing left for promote or prune to act on
+func writeState(log log15.Logger, provisionOutputPath string, stack *provision_state.Stack) (success bool) {
+
+	if len(stack.Regions) == 0 {
+		log.Info("No regions left. Deleting the provision state")
+
+		err := os.Remove(provisionOutputPath)
+		if err != nil {
+			log.Error("os.Remove", "Path", provisionOutputPath, "Error", err)
+			return
+		}
+
+		success = true
+		return
+	}
+
+	stackBytes, err := json.Marshal(stack)
+	if err != nil {
+		log.Error("json.Marshal", "Error", err)
+		return
+	}
+
+	err = ioutil.WriteFile(provisionOutputPath, stackBytes, 0644)
+	if err != nil {
+		log.Error("Unable to write provision output", "Error", err)
+		return
+	}
+
+	success = true
+	return
+}
+
+// inspectState prints the provision state alongside AWS and returns every
+// inconsistency between them
+func inspectState(log log15.Logger, provisionOutputPath string) (stack *provision_state.Stack,
+	issues []*stateIssue, success bool) {
+
+	stackBytes, err := ioutil.ReadFile(provisionOutputPath)
+	if err != nil {
+		log.Error("Unable to read provision output file. Run provision first", "Error", err)
+		return
+	}
+
+	stack = &provision_state.Stack{}
+	err = json.Unmarshal(stackBytes, stack)
+	if err != nil {
+		log.Error("json unmarshal error on provision output", "Error", err)
+		return
+	}
+
+	config, getConfigSuccess := conf.GetAlteredConfig(log)
+	if !getConfigSuccess {
+		return
+	}
+
+	environment, err := config.GetEnvironment(stack.Environment)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	fmt.Printf("%s %s hotswap=%t\n", stack.Name, stack.Environment, stack.Hotswap)
+
+	regionNames := make([]string, 0, len(stack.Regions))
+	for regionName := range stack.Regions {
+		regionNames = append(regionNames, regionName)
+	}
+	sort.Strings(regionNames)
+
+	for _, regionName := range regionNames {
+
+		regionIssues, regionSuccess := inspectStateRegion(log.New("Region", regionName),
+			environment, stack, regionName)
+		if !regionSuccess {
+			return
+		}
+
+		issues = append(issues, regionIssues...)
+	}
+
+	for _, region := range environment.Regions {
+		if _, exists := stack.Regions[region.Name]; exists {
+			continue
+		}
+
+		issue := &stateIssue{
+			region:     region.Name,
+			problem:    "the region is in the environment but not in the provision state",
+			suggestion: "provision the environment again",
+		}
+		printStateIssue(issue)
+		issues = append(issues, issue)
+	}
+
+	success = true
+	return
+}
+
+func inspectStateRegion(log log15.Logger, environment *conf.Environment,
+	stack *provision_state.Stack, regionName string) (issues []*stateIssue, success bool) {
+
+	regionState := stack.Regions[regionName]
+
+	fmt.Printf("%s\n  stack %s\n", regionName, regionState.StackId)
+
+	removeRegion := func(log15.Logger) bool {
+		delete(stack.Regions, regionName)
+		return true
+	}
+
+	report := func(issue *stateIssue) {
+		issue.region = regionName
+		printStateIssue(issue)
+		issues = append(issues, issue)
+	}
+
+	region, err := environment.GetRegion(regionName)
+	if err != nil {
+		report(&stateIssue{
+			problem:    "the region isn't in the environment anymore",
+			repairHelp: "remove the region from the provision state",
+			repair:     removeRegion,
+		})
+		success = true
+		return
+	}
+
+	roleARN, err := environment.GetRoleARN(regionName)
+	if err != nil {
+		log.Error("GetRoleARN", "Error", err)
+		return
+	}
+
+	cfnRoleARN, err := environment.GetCFNRoleARN(regionName)
+	if err != nil {
+		log.Error("GetCFNRoleARN", "Error", err)
+		return
+	}
+
+	roleSession := aws_session.STS(regionName, roleARN, 0)
+	cfnClient := cloudformation.New(roleSession)
+
+	cfnStack, exists, describeSuccess := describeStateStack(log, cfnClient, regionState.StackId)
+	if !describeSuccess {
+		return
+	}
+
+	if !exists {
+		fmt.Println("  status DOES_NOT_EXIST")
+		report(&stateIssue{
+			problem:    "the stack doesn't exist",
+			repairHelp: "remove the region from the provision state",
+			repair:     removeRegion,
+		})
+		success = true
+		return
+	}
+
+	status := *cfnStack.StackStatus
+	fmt.Println("  status " + status)
+
+	promotedStackId, promotedSuccess := promotedStateStackId(log, roleSession, region)
+	if !promotedSuccess {
+		return
+	}
+
+	promoted := promotedStackId != "" && promotedStackId == regionState.StackId
+	if len(region.ELBs) > 0 {
+		fmt.Printf("  promoted %t\n", promoted)
+	}
+
+	switch status {
+	case cloudformation.StackStatusDeleteComplete:
+
+		report(&stateIssue{
+			problem:    "the stack was deleted",
+			repairHelp: "remove the region from the provision state",
+			repair:     removeRegion,
+		})
+		success = true
+		return
+
+	case cloudformation.StackStatusCreateFailed,
+		cloudformation.StackStatusRollbackComplete,
+		cloudformation.StackStatusRollbackFailed:
+
+		if promoted {
+			report(&stateIssue{
+				problem:    "the stack failed but the ELB is tagged with it",
+				suggestion: "provision and promote a new stack",
+			})
+			break
+		}
+
+		report(&stateIssue{
+			problem:    "the stack failed to create",
+			repairHelp: "delete the stack and remove the region from the provision state",
+			repair: func(log log15.Logger) bool {
+				if !provision.DeleteStack(log, roleSession, regionState.StackId, cfnRoleARN) {
+					return false
+				}
+				return removeRegion(log)
+			},
+		})
+
+	case cloudformation.StackStatusDeleteFailed:
+
+		report(&stateIssue{
+			problem:    "the stack failed to delete",
+			suggestion: "delete the resources it retained and delete the stack again",
+		})
+
+	case cloudformation.StackStatusUpdateRollbackFailed:
+
+		report(&stateIssue{
+			problem:    "the stack failed to roll back an update",
+			suggestion: "continue the update rollback in CloudFormation",
+		})
+
+	default:
+
+		if strings.HasSuffix(status, "_IN_PROGRESS") {
+			report(&stateIssue{
+				problem:    "the stack is still changing",
+				suggestion: "wait for it to finish and run this again",
+			})
+		}
+	}
+
+	if promotedStackId != "" && !promoted {
+		_, promotedExists, describeSuccess := describeStateStack(log, cfnClient, promotedStackId)
+		if !describeSuccess {
+			return
+		}
+
+		if promotedExists {
+			fmt.Println("  ELB is tagged with " + promotedStackId)
+		} else {
+			report(&stateIssue{
+				problem:    "the ELB is tagged with a stack that doesn't exist",
+				suggestion: "promote the provisioned stack",
+			})
+		}
+	}
+
+	if regionState.ProvisionedELBName != "" {
+
+		_, err := elb.New(roleSession).DescribeLoadBalancers(&elb.DescribeLoadBalancersInput{
+			LoadBalancerNames: []*string{aws.String(regionState.ProvisionedELBName)},
+		})
+		if err != nil {
+			if awsErr, ok := err.(awserr.Error); !ok || awsErr.Code() != "LoadBalancerNotFound" {
+				log.Error("elb:DescribeLoadBalancers", "Error", err)
+				return
+			}
+
+			report(&stateIssue{
+				problem:    "the provisioned ELB " + regionState.ProvisionedELBName + " doesn't exist",
+				repairHelp: "forget the provisioned ELB",
+				repair: func(log15.Logger) bool {
+					regionState.ProvisionedELBName = ""
+					return true
+				},
+			})
+		}
+	}
+
+	success = true
+	return
+}
+
+// describeStateStack describes a stack by id. Stacks that no longer exist
+// aren't an error
+func describeStateStack(log log15.Logger, cfnClient *cloudformation.CloudFormation,
+	stackId string) (stack *cloudformation.Stack, exists, success bool) {
+
+	describeStacksOutput, err := cfnClient.DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(stackId),
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			success = true
+			return
+		}
+
+		log.Error("cloudformation:DescribeStacks", "Error", err)
+		return
+	}
+
+	if len(describeStacksOutput.Stacks) != 1 {
+		log.Error("len(describeStacksOutput.Stacks != 1)")
+		return
+	}
+
+	stack = describeStacksOutput.Stacks[0]
+	exists = true
+	success = true
+	return
+}
+
+// promotedStateStackId returns the stack id promote tagged the region's ELB
+// with. It's empty if the region has no ELB or nothing has been promoted
+func promotedStateStackId(log log15.Logger, roleSession *session.Session,
+	region *conf.Region) (stackId string, success bool) {
+
+	if len(region.ELBs) == 0 {
+		success = true
+		return
+	}
+
+	describeTagsOutput, err := elb.New(roleSession).DescribeTags(&elb.DescribeTagsInput{
+		LoadBalancerNames: []*string{aws.String(region.ELBs[0].Name)},
+	})
+	if err != nil {
+		log.Error("elb:DescribeTags", "Error", err)
+		return
+	}
+
+	for _, tagDescription := range describeTagsOutput.TagDescriptions {
+		for _, tag := range tagDescription.Tags {
+			if tag.Key != nil && *tag.Key == constants.PorterStackIdTag {
+				stackId = aws.StringValue(tag.Value)
+			}
+		}
+	}
+
+	success = true
+	return
+}
+
+func printStateIssue(issue *stateIssue) {
+	fmt.Printf("  ! %s: %s\n", issue.region, issue.problem)
+	if issue.repair != nil {
+		fmt.Println("    repair: " + issue.repairHelp)
+	} else {
+		fmt.Println("    suggestion: " + issue.suggestion)
+	}
+}
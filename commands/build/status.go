@@ -0,0 +1,248 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/inconshreveable/log15"
+	"github.com/phylake/go-cli"
+)
+
+type StatusCmd struct{}
+
+func (recv *StatusCmd) Name() string {
+	return "status"
+}
+
+func (recv *StatusCmd) ShortHelp() string {
+	return "Report the health of an environment's latest deploy"
+}
+
+func (recv *StatusCmd) LongHelp() string {
+	return `NAME
+    status -- Report the health of an environment's latest deploy
+
+SYNOPSIS
+    status [-e <environment out of .porter/config>] [--json]
+
+DESCRIPTION
+    Report the latest deploy of each region as recorded in the state store: its
+    status, stack, service version, and service payload checksum. For stacks
+    that exist the report adds
+
+        the stack's CloudFormation status
+        the health of the instances behind the stack's ELBs and target groups,
+        and the region's ELB once the stack is promoted
+        the modified and deleted resources found by the stack's latest drift
+        detection
+        the stack's most recent events
+
+    Drift is only as recent as the last time drift detection was run on the
+    stack, e.g. with aws cloudformation detect-stack-drift. A stack it was
+    never run on is NOT_CHECKED.
+
+    Without -e every environment in .porter/config is reported.
+
+    Without a state_store in .porter/config only deploys run from this machine
+    are known.
+
+    A region goes through these statuses
+
+        payload_uploaded    the service payload is in S3
+        secrets_uploaded    the encrypted secrets are in S3
+        template_uploaded   the CloudFormation template is in S3
+        stack_creating      CloudFormation is creating or updating the stack
+        provisioned         the stack is complete and ready to promote
+        promoted            the stack is receiving traffic
+        failed              see the error
+
+    status always runs in read-only mode so it can be run with read-only
+    credentials.
+
+OPTIONS
+    -e
+        Environment from .porter/config
+
+    --json
+        Print the report as JSON instead of a table`
+}
+
+func (recv *StatusCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *StatusCmd) Execute(args []string) bool {
+
+	if len(args) > 0 {
+		var environment string
+		var asJSON bool
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&environment, "e", "", "")
+		flagSet.BoolVar(&asJSON, "json", false, "")
+		flagSet.Usage = func() {
+			fmt.Println(recv.LongHelp())
+		}
+		flagSet.Parse(args)
+
+		if !deployStatus(environment, asJSON) {
+			os.Exit(1)
+		}
+		return true
+	}
+
+	return false
+}
+
+func deployStatus(env string, asJSON bool) (success bool) {
+	log := logger.CLI("cmd", "status")
+
+	aws_session.EnableReadOnly()
+
+	config, getConfigSuccess := conf.GetConfig(log, true)
+	if !getConfigSuccess {
+		return
+	}
+
+	environments := config.Environments
+	if env != "" {
+		environment, err := config.GetEnvironment(env)
+		if err != nil {
+			log.Error("GetEnvironment", "Error", err)
+			return
+		}
+		environments = []*conf.Environment{environment}
+	}
+
+	reports := make([]*regionStatus, 0)
+
+	for _, environment := range environments {
+		deployments, err := provision.GetStateStore(config).List(config.ServiceName, environment.Name)
+		if err != nil {
+			log.Error("State store List", "Error", err)
+			return
+		}
+
+		for _, deployment := range deployments {
+			reports = append(reports, getRegionStatus(log, environment, deployment))
+		}
+	}
+
+	if asJSON {
+		reportBytes, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			log.Error("json.Marshal", "Error", err)
+			return
+		}
+		fmt.Println(string(reportBytes))
+
+		success = true
+		return
+	}
+
+	if len(reports) == 0 {
+		fmt.Println("No recorded deploys")
+		success = true
+		return
+	}
+
+	printStatusTable(os.Stdout, reports)
+
+	success = true
+	return
+}
+
+// recordStack updates the deployment of each of the stack's regions in the
+// state store
+func recordStack(log log15.Logger, config *conf.Config, stack provision_state.Stack,
+	status, errorMessage string) {
+
+	store := provision.GetStateStore(config)
+
+	for regionName, regionState := range stack.Regions {
+
+		regionLog := log.New("Region", regionName)
+
+		deployment, err := store.Get(config.ServiceName, stack.Environment, regionName)
+		if err != nil {
+			regionLog.Warn("Failed to read deployment", "Error", err)
+			continue
+		}
+
+		if deployment == nil {
+			deployment = &provision_state.Deployment{
+				ServiceName:    config.ServiceName,
+				Environment:    stack.Environment,
+				Region:         regionName,
+				ServiceVersion: config.ServiceVersion,
+			}
+		}
+
+		deployment.Status = status
+		deployment.Error = errorMessage
+		deployment.StackName = stack.Name
+		deployment.StackId = regionState.StackId
+		deployment.Hotswap = stack.Hotswap
+		deployment.ProvisionedELBName = regionState.ProvisionedELBName
+
+		provision.RecordDeployment(regionLog, store, deployment)
+	}
+}
+
+// recordedStack rebuilds the provision output of the environment's latest
+// deploy from the state store so it can be promoted from another machine
+func recordedStack(log log15.Logger, config *conf.Config, env string) (stack *provision_state.Stack, success bool) {
+
+	environment, err := config.GetEnvironment(env)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	deployments, err := provision.GetStateStore(config).List(config.ServiceName, environment.Name)
+	if err != nil {
+		log.Error("State store List", "Error", err)
+		return
+	}
+
+	if len(deployments) != len(environment.Regions) {
+		log.Error("Not every region has a recorded deploy",
+			"Environment", environment.Name,
+			"Regions", len(environment.Regions),
+			"Deployments", len(deployments))
+		return
+	}
+
+	for _, deployment := range deployments {
+		switch deployment.Status {
+		case provision_state.StatusProvisioned, provision_state.StatusPromoted:
+		default:
+			log.Error("The region's latest deploy isn't provisioned",
+				"Region", deployment.Region,
+				"Status", deployment.Status,
+				"Error", deployment.Error)
+			return
+		}
+	}
+
+	stack = provision_state.StackOf(deployments)
+	success = true
+	return
+}
@@ -0,0 +1,378 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/aws/elb"
+	"github.com/adobe-platform/porter/aws/elbv2"
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/inconshreveable/log15"
+)
+
+const (
+	// stack events printed per region
+	statusEventCount = 5
+
+	loadBalancerTypeELB         = "elb"
+	loadBalancerTypeTargetGroup = "target_group"
+)
+
+type (
+	regionStatus struct {
+		Environment     string    `json:"environment"`
+		Region          string    `json:"region"`
+		Status          string    `json:"status"`
+		Error           string    `json:"error,omitempty"`
+		UpdatedAt       time.Time `json:"updated_at"`
+		ServiceVersion  string    `json:"service_version"`
+		PayloadChecksum string    `json:"payload_checksum"`
+		StackName       string    `json:"stack_name"`
+		StackId         string    `json:"stack_id"`
+		ImageId         string    `json:"image_id,omitempty"`
+
+		// the rest is read from AWS and empty if it couldn't be
+		StackStatus   string               `json:"stack_status,omitempty"`
+		LoadBalancers []loadBalancerHealth `json:"load_balancers,omitempty"`
+		Drift         *stackDrift          `json:"drift,omitempty"`
+		Events        []stackEvent         `json:"events,omitempty"`
+	}
+
+	loadBalancerHealth struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+
+		// number of instances or targets in each state
+		States map[string]int `json:"states"`
+	}
+
+	stackDrift struct {
+		Status    string            `json:"status"`
+		CheckedAt *time.Time        `json:"checked_at,omitempty"`
+		Resources []driftedResource `json:"resources,omitempty"`
+	}
+
+	driftedResource struct {
+		LogicalId string `json:"logical_id"`
+		Type      string `json:"type"`
+		Status    string `json:"status"`
+	}
+
+	stackEvent struct {
+		Time      time.Time `json:"time"`
+		LogicalId string    `json:"logical_id"`
+		Status    string    `json:"status"`
+		Reason    string    `json:"reason,omitempty"`
+	}
+)
+
+// getRegionStatus adds what AWS knows about the deployment's stack to what the
+// state store knows. AWS errors are logged and leave their part of the report
+// empty so one region can't hide the others
+func getRegionStatus(log log15.Logger, environment *conf.Environment,
+	deployment *provision_state.Deployment) *regionStatus {
+
+	report := &regionStatus{
+		Environment:     deployment.Environment,
+		Region:          deployment.Region,
+		Status:          deployment.Status,
+		Error:           deployment.Error,
+		UpdatedAt:       deployment.UpdatedAt,
+		ServiceVersion:  deployment.ServiceVersion,
+		PayloadChecksum: deployment.PayloadChecksum,
+		StackName:       deployment.StackName,
+		StackId:         deployment.StackId,
+		ImageId:         deployment.ImageId,
+	}
+
+	if deployment.StackId == "" {
+		return report
+	}
+
+	log = log.New("Environment", deployment.Environment, "Region", deployment.Region,
+		"StackId", deployment.StackId)
+
+	roleSession, ok := refreshRoleSession(log, environment, deployment.Region)
+	if !ok {
+		return report
+	}
+
+	cfnClient := cloudformation.New(roleSession)
+
+	stacksOutput, err := cfnClient.DescribeStacks(&cfnlib.DescribeStacksInput{
+		StackName: aws.String(deployment.StackId),
+	})
+	if err != nil {
+		log.Warn("cloudformation:DescribeStacks", "Error", err)
+		return report
+	}
+	if len(stacksOutput.Stacks) == 1 {
+		report.StackStatus = aws.StringValue(stacksOutput.Stacks[0].StackStatus)
+	}
+
+	if report.StackStatus == cfnlib.StackStatusDeleteComplete {
+		return report
+	}
+
+	report.LoadBalancers = getLoadBalancerHealth(log, roleSession, environment, deployment)
+	report.Drift = getStackDrift(log, cfnClient, deployment.StackId)
+	report.Events = getStackEvents(log, cfnClient, deployment.StackId)
+
+	return report
+}
+
+// getLoadBalancerHealth counts the states of the instances behind the stack's
+// ELBs and target groups. Once the stack is promoted the region's ELB is
+// included
+func getLoadBalancerHealth(log log15.Logger, roleSession *session.Session,
+	environment *conf.Environment, deployment *provision_state.Deployment) []loadBalancerHealth {
+
+	health := make([]loadBalancerHealth, 0)
+
+	resourcesOutput, err := cloudformation.New(roleSession).DescribeStackResources(&cfnlib.DescribeStackResourcesInput{
+		StackName: aws.String(deployment.StackId),
+	})
+	if err != nil {
+		log.Warn("cloudformation:DescribeStackResources", "Error", err)
+		return health
+	}
+
+	elbNames := make([]string, 0)
+	targetGroupArns := make([]string, 0)
+
+	for _, resource := range resourcesOutput.StackResources {
+		physicalId := aws.StringValue(resource.PhysicalResourceId)
+		if physicalId == "" {
+			continue
+		}
+
+		switch aws.StringValue(resource.ResourceType) {
+		case cfn.ElasticLoadBalancing_LoadBalancer:
+			elbNames = append(elbNames, physicalId)
+		case cfn.ElasticLoadBalancingV2_TargetGroup:
+			targetGroupArns = append(targetGroupArns, physicalId)
+		}
+	}
+
+	if deployment.Status == provision_state.StatusPromoted {
+		if region, err := environment.GetRegion(deployment.Region); err == nil && region.ELB != "" {
+			elbNames = append(elbNames, region.ELB)
+		}
+	}
+
+	elbClient := elb.New(roleSession)
+	for _, elbName := range elbNames {
+		instanceStates, err := elb.DescribeInstanceHealth(elbClient, elbName)
+		if err != nil {
+			log.Warn("elasticloadbalancing:DescribeInstanceHealth", "LoadBalancerName", elbName, "Error", err)
+			continue
+		}
+
+		lbHealth := loadBalancerHealth{
+			Name:   elbName,
+			Type:   loadBalancerTypeELB,
+			States: make(map[string]int),
+		}
+		for _, instanceState := range instanceStates {
+			lbHealth.States[aws.StringValue(instanceState.State)]++
+		}
+		health = append(health, lbHealth)
+	}
+
+	elbv2Client := elbv2.New(roleSession)
+	for _, targetGroupArn := range targetGroupArns {
+		output, err := elbv2Client.DescribeTargetHealth(&elbv2.DescribeTargetHealthInput{
+			TargetGroupArn: targetGroupArn,
+		})
+		if err != nil {
+			log.Warn("elasticloadbalancing:DescribeTargetHealth", "TargetGroupArn", targetGroupArn, "Error", err)
+			continue
+		}
+
+		lbHealth := loadBalancerHealth{
+			Name:   targetGroupArn,
+			Type:   loadBalancerTypeTargetGroup,
+			States: make(map[string]int),
+		}
+		for _, description := range output.TargetHealthDescriptions {
+			if description.TargetHealth != nil {
+				lbHealth.States[aws.StringValue(description.TargetHealth.State)]++
+			}
+		}
+		health = append(health, lbHealth)
+	}
+
+	return health
+}
+
+func getStackDrift(log log15.Logger, cfnClient *cfnlib.CloudFormation, stackId string) *stackDrift {
+
+	info, drifts, err := cloudformation.DescribeStackDrift(cfnClient, stackId)
+	if err != nil {
+		log.Warn("cloudformation:DescribeStackResourceDrifts", "Error", err)
+		return nil
+	}
+
+	drift := &stackDrift{
+		Status:    aws.StringValue(info.StackDriftStatus),
+		CheckedAt: info.LastCheckTimestamp,
+	}
+	for _, resourceDrift := range drifts {
+		drift.Resources = append(drift.Resources, driftedResource{
+			LogicalId: aws.StringValue(resourceDrift.LogicalResourceId),
+			Type:      aws.StringValue(resourceDrift.ResourceType),
+			Status:    aws.StringValue(resourceDrift.StackResourceDriftStatus),
+		})
+	}
+
+	return drift
+}
+
+// getStackEvents is the stack's most recent events, newest first
+func getStackEvents(log log15.Logger, cfnClient *cfnlib.CloudFormation, stackId string) []stackEvent {
+
+	output, err := cfnClient.DescribeStackEvents(&cfnlib.DescribeStackEventsInput{
+		StackName: aws.String(stackId),
+	})
+	if err != nil {
+		log.Warn("cloudformation:DescribeStackEvents", "Error", err)
+		return nil
+	}
+
+	events := make([]stackEvent, 0, statusEventCount)
+	for _, event := range output.StackEvents {
+		if len(events) == statusEventCount {
+			break
+		}
+
+		events = append(events, stackEvent{
+			Time:      aws.TimeValue(event.Timestamp),
+			LogicalId: aws.StringValue(event.LogicalResourceId),
+			Status:    aws.StringValue(event.ResourceStatus),
+			Reason:    aws.StringValue(event.ResourceStatusReason),
+		})
+	}
+
+	return events
+}
+
+// printStatusTable prints a row per region followed by each region's errors,
+// drifted resources, and recent events
+func printStatusTable(w io.Writer, reports []*regionStatus) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "ENVIRONMENT\tREGION\tSTATUS\tSTACK\tSTACK STATUS\tVERSION\tCHECKSUM\tHEALTH\tDRIFT")
+	for _, report := range reports {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			report.Environment,
+			report.Region,
+			report.Status,
+			orDash(report.StackName),
+			orDash(report.StackStatus),
+			orDash(report.ServiceVersion),
+			orDash(shortChecksum(report.PayloadChecksum)),
+			orDash(formatHealth(report.LoadBalancers)),
+			orDash(formatDrift(report.Drift)))
+	}
+	tw.Flush()
+
+	for _, report := range reports {
+		if report.Error == "" && len(report.Events) == 0 &&
+			(report.Drift == nil || len(report.Drift.Resources) == 0) {
+			continue
+		}
+
+		fmt.Fprintf(w, "\n%s %s\n", report.Environment, report.Region)
+		if report.Error != "" {
+			fmt.Fprintf(w, "  error  %s\n", report.Error)
+		}
+
+		tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+		if report.Drift != nil {
+			for _, resource := range report.Drift.Resources {
+				fmt.Fprintf(tw, "  drift\t%s\t%s\t%s\n", resource.LogicalId, resource.Type, resource.Status)
+			}
+		}
+
+		for _, event := range report.Events {
+			fmt.Fprintf(tw, "  event\t%s\t%s\t%s\t%s\n", event.Time.Format(time.RFC3339),
+				event.LogicalId, event.Status, event.Reason)
+		}
+		tw.Flush()
+	}
+}
+
+// formatHealth is like elb-name InService=3 OutOfService=1
+func formatHealth(loadBalancers []loadBalancerHealth) string {
+	parts := make([]string, 0, len(loadBalancers))
+
+	for _, lbHealth := range loadBalancers {
+		name := lbHealth.Name
+		// target group ARNs end in targetgroup/<name>/<id>
+		if lbHealth.Type == loadBalancerTypeTargetGroup {
+			if fields := strings.Split(name, "/"); len(fields) >= 2 {
+				name = fields[len(fields)-2]
+			}
+		}
+
+		states := make([]string, 0, len(lbHealth.States))
+		for state, count := range lbHealth.States {
+			states = append(states, fmt.Sprintf("%s=%d", state, count))
+		}
+		sort.Strings(states)
+
+		if len(states) == 0 {
+			states = append(states, "no instances")
+		}
+
+		parts = append(parts, name+" "+strings.Join(states, " "))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func formatDrift(drift *stackDrift) string {
+	if drift == nil {
+		return ""
+	}
+	if len(drift.Resources) > 0 {
+		return fmt.Sprintf("%s (%d)", drift.Status, len(drift.Resources))
+	}
+	return drift.Status
+}
+
+func shortChecksum(checksum string) string {
+	if len(checksum) > 12 {
+		return checksum[:12]
+	}
+	return checksum
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,192 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/inconshreveable/log15"
+	"github.com/phylake/go-cli"
+)
+
+type TemplateDiffCmd struct{}
+
+func (recv *TemplateDiffCmd) Name() string {
+	return "diff"
+}
+
+func (recv *TemplateDiffCmd) ShortHelp() string {
+	return "Compare the template about to be deployed with the live template"
+}
+
+func (recv *TemplateDiffCmd) LongHelp() string {
+	return `NAME
+    diff -- Compare the template about to be deployed with the live template
+
+SYNOPSIS
+    diff -e <environment out of .porter/config>
+
+DESCRIPTION
+    Generate the CloudFormation template provision would deploy to each region
+    of the environment and print a structural diff against the template of the
+    deployed stack.
+
+    The deployed stack is the one attached to the region's ELB or, without an
+    ELB, the most recently created stack.
+
+    Run after porter build pack to use the packed config and service payload.
+    Without them the template is generated from .porter/config and the service
+    payload key is a placeholder.
+
+    Each line is a path into the template
+
+        + Resources.Queue                                   added
+        - Resources.Topic                                   removed
+        ~ Resources.ASG.Properties.MaxSize: "2" -> "4"      changed
+
+    diff always runs in read-only mode so it can be run with read-only
+    credentials.`
+}
+
+func (recv *TemplateDiffCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *TemplateDiffCmd) Execute(args []string) bool {
+
+	if len(args) > 0 {
+		var environment string
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&environment, "e", "", "")
+		flagSet.Usage = func() {
+			fmt.Println(recv.LongHelp())
+		}
+		flagSet.Parse(args)
+
+		if !diffTemplates(environment) {
+			os.Exit(1)
+		}
+		return true
+	}
+
+	return false
+}
+
+func diffTemplates(env string) (success bool) {
+	log := logger.CLI("cmd", "template-diff")
+
+	aws_session.EnableReadOnly()
+
+	var (
+		config           *conf.Config
+		getConfigSuccess bool
+	)
+
+	if _, err := os.Stat(constants.AlteredConfigPath); err == nil {
+		config, getConfigSuccess = conf.GetAlteredConfig(log)
+	} else {
+		config, getConfigSuccess = conf.GetConfig(log, true)
+	}
+	if !getConfigSuccess {
+		return
+	}
+
+	environment, err := config.GetEnvironment(env)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	stackName, err := provision.GetStackName(config.ServiceName, environment.Name, false)
+	if err != nil {
+		log.Error("provision.GetStackName", "Error", err)
+		return
+	}
+
+	for _, region := range environment.Regions {
+		if !diffRegionTemplates(log, config, environment, region, stackName) {
+			return
+		}
+	}
+
+	success = true
+	return
+}
+
+func diffRegionTemplates(log log15.Logger, config *conf.Config, environment *conf.Environment,
+	region *conf.Region, stackName string) (success bool) {
+
+	log = log.New("Region", region.Name)
+
+	roleARN, err := environment.GetRoleARN(region.Name)
+	if err != nil {
+		log.Error("GetRoleARN", "Error", err)
+		return
+	}
+
+	roleSession := aws_session.STS(region.Name, roleARN, 0)
+
+	templateBytes, renderSuccess := provision.RenderTemplate(log, config, environment, region, roleSession)
+	if !renderSuccess {
+		return
+	}
+
+	stack, findDeployedStackSuccess := findDeployedStack(log, region, roleSession, stackName)
+	if !findDeployedStackSuccess {
+		return
+	}
+
+	var liveTemplate []byte
+	if stack == nil {
+		log.Warn("No deployed stack. The whole template is new")
+	} else {
+		log.Info("Comparing with deployed stack", "StackId", *stack.StackId)
+
+		getTemplateOutput, err := cloudformation.New(roleSession).GetTemplate(&cloudformation.GetTemplateInput{
+			StackName: stack.StackId,
+		})
+		if err != nil {
+			log.Error("cloudformation:GetTemplate", "Error", err)
+			return
+		}
+
+		if getTemplateOutput.TemplateBody != nil {
+			liveTemplate = []byte(*getTemplateOutput.TemplateBody)
+		}
+	}
+
+	changes, err := cfn.DiffTemplates(liveTemplate, templateBytes)
+	if err != nil {
+		log.Error("cfn.DiffTemplates", "Error", err)
+		return
+	}
+
+	fmt.Printf("%s %s\n", environment.Name, region.Name)
+	if len(changes) == 0 {
+		fmt.Println("  no changes")
+	}
+	for _, change := range changes {
+		fmt.Println("  " + change.String())
+	}
+
+	success = true
+	return
+}
@@ -0,0 +1,172 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package build
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/testkit"
+	"github.com/phylake/go-cli"
+)
+
+type TestkitCmd struct{}
+
+func (recv *TestkitCmd) Name() string {
+	return "testkit"
+}
+
+func (recv *TestkitCmd) ShortHelp() string {
+	return "Deploy a test service into a sandbox account and tear it down"
+}
+
+func (recv *TestkitCmd) LongHelp() string {
+	return `NAME
+    testkit -- Deploy a test service into a sandbox account and tear it down
+
+SYNOPSIS
+    testkit --role-arn <arn> --region <region> --azs <az,...> --s3-bucket <bucket>
+            [--vpc-id <vpc> --subnet-ids <subnet,...>] [--porter-version <version>]
+            [--timeout <duration>] [--keep] [--json]
+
+DESCRIPTION
+    Validate a porter release before services upgrade to it. testkit generates
+    a minimal service with its own .porter/config, packs and provisions it with
+    this porter binary, and asserts
+
+        the stack was created
+        the instances behind the stack's ELB are InService
+        the service answers its health check through the ELB
+
+    Then every stack whose name starts with the service's name is deleted
+    along with the objects provision uploaded to the bucket. The service name
+    is unique to the run so nothing else in the account is touched. Still,
+    use an account nothing else runs in.
+
+    The exit code is non-zero if an assertion failed or the teardown did.
+
+OPTIONS
+    --role-arn
+        The role porter assumes in the sandbox account. It needs the
+        permissions of porter bootstrap iam
+
+    --region
+        The region to deploy to
+
+    --azs
+        Comma-separated availability zones
+
+    --s3-bucket
+        The bucket provision uploads to
+
+    --vpc-id
+        The VPC to deploy to. Without it the service runs in the default VPC
+
+    --subnet-ids
+        Comma-separated subnets of the VPC, one per availability zone in the
+        same order
+
+    --porter-version
+        The porter_version of the generated .porter/config which is the porter
+        the service's instances download. Defaults to this porter's version
+
+    --timeout
+        How long to wait for the service to become healthy. Defaults to 45m
+
+    --keep
+        Leave the stacks, S3 objects, and generated project behind to debug a
+        failure
+
+    --json
+        Print the report as JSON`
+}
+
+func (recv *TestkitCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *TestkitCmd) Execute(args []string) bool {
+
+	if len(args) > 0 {
+		var sandbox testkit.Sandbox
+		var azs, subnetIds string
+		var asJSON bool
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&sandbox.RoleARN, "role-arn", "", "")
+		flagSet.StringVar(&sandbox.Region, "region", "", "")
+		flagSet.StringVar(&azs, "azs", "", "")
+		flagSet.StringVar(&sandbox.S3Bucket, "s3-bucket", "", "")
+		flagSet.StringVar(&sandbox.VpcId, "vpc-id", "", "")
+		flagSet.StringVar(&subnetIds, "subnet-ids", "", "")
+		flagSet.StringVar(&sandbox.PorterVersion, "porter-version", "", "")
+		flagSet.DurationVar(&sandbox.Timeout, "timeout", testkit.DefaultTimeout, "")
+		flagSet.BoolVar(&sandbox.Keep, "keep", false, "")
+		flagSet.BoolVar(&asJSON, "json", false, "")
+		flagSet.Usage = func() {
+			fmt.Println(recv.LongHelp())
+		}
+		flagSet.Parse(args)
+
+		if sandbox.RoleARN == "" || sandbox.Region == "" || azs == "" || sandbox.S3Bucket == "" {
+			return false
+		}
+
+		sandbox.AZs = strings.Split(azs, ",")
+		if subnetIds != "" {
+			sandbox.SubnetIds = strings.Split(subnetIds, ",")
+		}
+
+		if !runTestkit(sandbox, asJSON) {
+			os.Exit(1)
+		}
+		return true
+	}
+
+	return false
+}
+
+func runTestkit(sandbox testkit.Sandbox, asJSON bool) bool {
+	log := logger.CLI("cmd", "testkit")
+
+	startedAt := time.Now()
+	report, success := testkit.Run(log, sandbox)
+
+	if asJSON {
+		reportBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Error("json.Marshal", "Error", err)
+			return false
+		}
+		fmt.Println(string(reportBytes))
+		return success
+	}
+
+	for _, assertion := range report.Assertions {
+		if assertion.Passed {
+			fmt.Println("PASS", assertion.Name)
+		} else {
+			fmt.Println("FAIL", assertion.Name, assertion.Error)
+		}
+	}
+
+	if !sandbox.Keep {
+		fmt.Println("torn down", report.TornDown)
+	}
+	fmt.Println("took", time.Since(startedAt).Round(time.Second))
+
+	return success
+}
@@ -29,7 +29,14 @@ import (
 const porterDescription = `Usage: porter COMMAND [OPTIONS]
 
 porter is a platform built on AWS APIs to enable continuous delivery of docker
-containers to EC2 instances across AWS regions.`
+containers to EC2 instances across AWS regions.
+
+Pass --read-only to any command or set READ_ONLY=1 to make any AWS call that
+could change something a hard error.
+
+Pass --audit <file> to any command or set AUDIT_PLAN=<file> to write every AWS
+call to a call plan. Calls that could change something are recorded but not
+sent.`
 
 func GetRootCommand() cli.Command {
 	return &cmd.Root{
@@ -62,11 +69,13 @@ These commands log to STDOUT and primarily run from files/cloud-init.yaml`,
 				SubCommandList: []cli.Command{
 					&host.HAProxyCmd{},
 					&host.RsyslogCmd{},
+					&host.AwslogsCmd{},
 					&host.DockerCmd{},
 					&host.DaemonCmd{},
 					&host.SecretsCmd{},
 					&host.SvcPayloadCmd{},
 					&host.SignalCmd{},
+					&host.PreflightCmd{},
 				},
 			},
 			&cmd.Default{
@@ -91,6 +100,99 @@ These commands log to STDOUT and primarily run from files/cloud-init.yaml`,
 					},
 				},
 			},
+			&build.DeployCmd{},
+			&build.PromoteVersionCmd{},
+			&build.StatusCmd{},
+			&build.SessionCmd{},
+			&build.ExecCmd{},
+			&build.LogsCmd{},
+			&build.ReconcileCmd{},
+			&build.IAMPolicyCmd{},
+			&build.BakeCmd{},
+			&build.AgentCmd{},
+			&build.TestkitCmd{},
+			&cmd.Default{
+				NameStr:      "pipeline",
+				ShortHelpStr: "Promotion pipeline commands",
+				LongHelpStr:  `Commands that deploy a service through the pipeline defined in .porter/config.`,
+				SubCommandList: []cli.Command{
+					&build.PipelineRunCmd{},
+				},
+			},
+			&cmd.Default{
+				NameStr:      "artifact",
+				ShortHelpStr: "Build once, deploy anywhere commands",
+				LongHelpStr: `Commands that build a service payload into an artifact and deploy that exact
+artifact to any environment or account.`,
+				SubCommandList: []cli.Command{
+					&build.ArtifactBuildCmd{},
+					&build.ArtifactDeployCmd{},
+				},
+			},
+			&cmd.Default{
+				NameStr:      "fleet",
+				ShortHelpStr: "Host fleet commands",
+				LongHelpStr: `Commands that reach porterd on the instances of an environment's stacks
+through their command queue or runtime config.`,
+				SubCommandList: []cli.Command{
+					&build.FleetSendCmd{},
+					&build.FleetSetConfigCmd{},
+				},
+			},
+			&cmd.Default{
+				NameStr:      "asg",
+				ShortHelpStr: "Autoscaling group commands",
+				LongHelpStr: `Commands that control the autoscaling groups of an environment's stacks. Hot
+swaps suspend AZRebalance and ReplaceUnhealthy for their duration.`,
+				SubCommandList: []cli.Command{
+					&build.AsgSuspendCmd{},
+					&build.AsgResumeCmd{},
+				},
+			},
+			&cmd.Default{
+				NameStr:      "stamp",
+				ShortHelpStr: "Stamp deployment commands",
+				LongHelpStr: `Commands that deploy and inspect the stamps of an environment. Each stamp is a
+copy of the environment with its own parameters and stacks.`,
+				SubCommandList: []cli.Command{
+					&build.StampDeployCmd{},
+					&build.StampStatusCmd{},
+				},
+			},
+			&cmd.Default{
+				NameStr:      "secrets",
+				ShortHelpStr: "Secrets commands",
+				LongHelpStr:  `Commands that inspect a service's secrets without printing their values.`,
+				SubCommandList: []cli.Command{
+					&build.SecretsDiffCmd{},
+				},
+			},
+			&cmd.Default{
+				NameStr:      "template",
+				ShortHelpStr: "CloudFormation template commands",
+				LongHelpStr:  `Commands that show what infrastructure changes a deploy implies.`,
+				SubCommandList: []cli.Command{
+					&build.TemplateDiffCmd{},
+				},
+			},
+			&cmd.Default{
+				NameStr:      "config",
+				ShortHelpStr: "Config commands",
+				LongHelpStr:  `Commands that check .porter/config.`,
+				SubCommandList: []cli.Command{
+					&build.ConfigCheckUpgradeCmd{},
+				},
+			},
+			&cmd.Default{
+				NameStr:      "state",
+				ShortHelpStr: "Provision state commands",
+				LongHelpStr: `Commands that compare the provision state written by provision with AWS and
+repair it.`,
+				SubCommandList: []cli.Command{
+					&build.StateShowCmd{},
+					&build.StateRepairCmd{},
+				},
+			},
 			&cmd.Default{
 				NameStr:      "help",
 				ShortHelpStr: "General help",
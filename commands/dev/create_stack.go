@@ -12,6 +12,7 @@
 package dev
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -182,7 +183,7 @@ func CreateStack(environmentStr string, keepCount int, block bool) {
 		Environment: environmentStr,
 	}
 
-	if !provision.CreateStack(log, config, stack) {
+	if !provision.CreateStack(context.Background(), log, config, stack) {
 		log.Error("Create stack failed")
 		os.Exit(1)
 	}
@@ -213,6 +214,12 @@ func CreateStack(environmentStr string, keepCount int, block bool) {
 		return
 	}
 
+	cfnRoleARN, err := environment.GetCFNRoleARN(regionName)
+	if err != nil {
+		log.Error("GetCFNRoleARN", "Error", err)
+		return
+	}
+
 	roleSession := aws_session.STS(regionName, roleARN, constants.StackCreationTimeout())
 	cfnClient := cloudformation.New(roleSession)
 	ec2Client := ec2.New(roleSession)
@@ -223,7 +230,7 @@ func CreateStack(environmentStr string, keepCount int, block bool) {
 	go func() {
 		<-sigChan
 		log.Warn("Received SIGINT. Deleting stack", "StackId", stackId)
-		cloudformation.DeleteStack(cfnClient, stackId)
+		provision.DeleteStack(log, roleSession, stackId, cfnRoleARN)
 
 		// http://tldp.org/LDP/abs/html/exitcodes.html
 		os.Exit(130)
@@ -12,6 +12,7 @@
 package dev
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -119,7 +120,7 @@ func UpdateStack(environmentStr string) {
 		os.Exit(1)
 	}
 
-	if success := provision.UpdateStack(log, config, stack); !success {
+	if success := provision.UpdateStack(context.Background(), log, config, stack); !success {
 		log.Error("Update stack failed")
 		os.Exit(1)
 	}
@@ -0,0 +1,190 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package host
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/phylake/go-cli"
+)
+
+const awslogsConfigTemplate = `[general]
+state_file = /var/lib/awslogs/agent-state
+{{ range $file := .Files }}
+[{{ $file }}]
+file = {{ $file }}
+log_group_name = {{ $.LogGroup }}
+log_stream_name = {instance_id}{{ $file }}
+initial_position = start_of_file
+{{ end -}}
+`
+
+const awslogsCliConfigTemplate = `[plugins]
+cwlogs = cwlogs
+[default]
+region = {{ .Region }}
+`
+
+type (
+	AwslogsCmd struct{}
+
+	awslogsConfigContext struct {
+		Region   string
+		LogGroup string
+		Files    []string
+	}
+
+	// hostFiles collects repeated -f flags
+	hostFiles []string
+)
+
+func (recv *hostFiles) String() string {
+	return strings.Join(*recv, ",")
+}
+
+func (recv *hostFiles) Set(file string) error {
+	*recv = append(*recv, file)
+	return nil
+}
+
+func (recv *AwslogsCmd) Name() string {
+	return "awslogs"
+}
+
+func (recv *AwslogsCmd) ShortHelp() string {
+	return "Ship host log files to CloudWatch Logs"
+}
+
+func (recv *AwslogsCmd) LongHelp() string {
+	return fmt.Sprintf(`NAME
+    awslogs -- Ship host log files to CloudWatch Logs
+
+SYNOPSIS
+    awslogs --init -r <region> -f <file> [-f <file>...]
+
+DESCRIPTION
+    awslogs installs the CloudWatch Logs agent and configures it with %s
+    and %s to ship each file to the log group in $%s.
+
+    Each file is its own log stream named by the instance id and file path.
+
+OPTIONS
+    -r  AWS region
+
+    -f  Absolute path of a file to ship. Repeat for more files`,
+		constants.AwslogsConfigPath, constants.AwslogsCliConfigPath, constants.EnvHostLogGroup)
+}
+
+func (recv *AwslogsCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *AwslogsCmd) Execute(args []string) bool {
+	if len(args) > 1 && args[0] == "--init" {
+
+		var files hostFiles
+		context := awslogsConfigContext{
+			LogGroup: os.Getenv(constants.EnvHostLogGroup),
+		}
+
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&context.Region, "r", "", "")
+		flagSet.Var(&files, "f", "")
+		flagSet.Usage = func() {
+			fmt.Println(recv.LongHelp())
+		}
+		flagSet.Parse(args[1:])
+
+		context.Files = files
+		if context.Region == "" || len(context.Files) == 0 {
+			return false
+		}
+
+		initAwslogs(context)
+		return true
+	}
+
+	return false
+}
+
+func initAwslogs(context awslogsConfigContext) {
+	log := logger.Host("cmd", "awslogs")
+
+	if context.LogGroup == "" {
+		log.Error(constants.EnvHostLogGroup + " is not set")
+		os.Exit(1)
+	}
+
+	log.Info("installing awslogs")
+	err := exec.Command("yum", "install", "-y", "awslogs").Run()
+	if err != nil {
+		log.Error("yum install awslogs", "Error", err)
+		os.Exit(1)
+	}
+
+	for path, configTemplate := range map[string]string{
+		constants.AwslogsConfigPath:    awslogsConfigTemplate,
+		constants.AwslogsCliConfigPath: awslogsCliConfigTemplate,
+	} {
+		log.Info("writing configuration at " + path)
+
+		tmpl, err := template.New("").Parse(configTemplate)
+		if err != nil {
+			log.Error("template parsing failed", "Error", err)
+			os.Exit(1)
+		}
+
+		var config bytes.Buffer
+
+		err = tmpl.Execute(&config, context)
+		if err != nil {
+			log.Error("template execution failed", "Error", err)
+			os.Exit(1)
+		}
+
+		err = ioutil.WriteFile(path, config.Bytes(), constants.AwslogsConfigPerms)
+		if err != nil {
+			log.Error("WriteFile", "Path", path, "Error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Amazon Linux 2's awslogs package names its unit awslogsd
+	awslogsService := "awslogs"
+	enableCommand := exec.Command("chkconfig", "awslogs", "on")
+	if usesSystemd() {
+		awslogsService = "awslogsd"
+		enableCommand = exec.Command("systemctl", "enable", "awslogsd")
+	}
+
+	err = enableCommand.Run()
+	if err != nil {
+		log.Error("enable "+awslogsService, "Error", err)
+		os.Exit(1)
+	}
+
+	log.Info("restarting awslogs with new config")
+	err = serviceCommand("restart", awslogsService).Run()
+	if err != nil {
+		log.Error("restart "+awslogsService, "Error", err)
+		os.Exit(1)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"os"
 	"os/exec"
 	"strconv"
+	"strings"
 	"text/template"
 	"time"
 
@@ -61,7 +62,37 @@ OPTIONS
 		Write out the init script so porterd can be managed by PID 1
 
 	--run
-		In the init script, run the daemon`
+		In the init script, run the daemon
+
+	-spot-drain
+		Seconds containers are given to stop after a spot interruption
+		notice. 0 disables the interruption watcher
+
+	-disk-metrics
+		Publish the root volume's used percent to CloudWatch every minute
+
+	-pressure-memory, -pressure-cpu
+		Percent of the last 10 seconds some task stalled on memory or cpu
+		past which the lowest priority sidecar is restarted or shed. 0
+		disables the threshold
+
+	-pressure-action
+		restart or shed
+
+	-pressure-cooldown
+		Seconds to wait after relieving pressure before doing it again
+
+	-disk-gc-high, -disk-gc-low
+		Root volume used percent at which old service payloads and unused
+		images are removed, and the percent to get back under. 0 disables it
+
+	-command-queue
+		Create the instance's command queue and run the commands porter
+		fleet send puts on it
+
+	-dns-name, -hosted-zone
+		The record set the instance is registered in while its stack is
+		promoted when dns targets instances`
 }
 
 func (recv *DaemonCmd) SubCommands() []cli.Command {
@@ -80,6 +111,17 @@ func (recv *DaemonCmd) Execute(args []string) bool {
 				healthCheckMethod string
 				healthCheckPath   string
 				elbs              string
+				spotDrainTimeout  int
+				diskMetrics       bool
+				pressureMemory    float64
+				pressureCPU       float64
+				pressureAction    string
+				pressureCooldown  int
+				diskGCHigh        float64
+				diskGCLow         float64
+				commandQueue      bool
+				dnsName           string
+				hostedZoneName    string
 			)
 
 			flagSet := flag.NewFlagSet("", flag.ExitOnError)
@@ -88,6 +130,17 @@ func (recv *DaemonCmd) Execute(args []string) bool {
 			flagSet.StringVar(&healthCheckMethod, "hm", "", "")
 			flagSet.StringVar(&healthCheckPath, "hp", "", "")
 			flagSet.StringVar(&elbs, "elbs", "", "")
+			flagSet.IntVar(&spotDrainTimeout, "spot-drain", 0, "")
+			flagSet.BoolVar(&diskMetrics, "disk-metrics", false, "")
+			flagSet.Float64Var(&pressureMemory, "pressure-memory", 0, "")
+			flagSet.Float64Var(&pressureCPU, "pressure-cpu", 0, "")
+			flagSet.StringVar(&pressureAction, "pressure-action", "", "")
+			flagSet.IntVar(&pressureCooldown, "pressure-cooldown", 0, "")
+			flagSet.Float64Var(&diskGCHigh, "disk-gc-high", 0, "")
+			flagSet.Float64Var(&diskGCLow, "disk-gc-low", 0, "")
+			flagSet.BoolVar(&commandQueue, "command-queue", false, "")
+			flagSet.StringVar(&dnsName, "dns-name", "", "")
+			flagSet.StringVar(&hostedZoneName, "hosted-zone", "", "")
 			flagSet.Usage = func() {
 				fmt.Println(recv.LongHelp())
 			}
@@ -100,6 +153,17 @@ func (recv *DaemonCmd) Execute(args []string) bool {
 				HealthCheckMethod: strconv.Quote(healthCheckMethod),
 				HealthCheckPath:   strconv.Quote(healthCheckPath),
 				Elbs:              elbs,
+				SpotDrainTimeout:  spotDrainTimeout,
+				DiskMetrics:       diskMetrics,
+				PressureMemory:    pressureMemory,
+				PressureCPU:       pressureCPU,
+				PressureAction:    pressureAction,
+				PressureCooldown:  pressureCooldown,
+				DiskGCHigh:        diskGCHigh,
+				DiskGCLow:         diskGCLow,
+				CommandQueue:      commandQueue,
+				DNSName:           dnsName,
+				HostedZoneName:    hostedZoneName,
 			}
 
 			installDaemon(context)
@@ -112,6 +176,17 @@ func (recv *DaemonCmd) Execute(args []string) bool {
 			flagSet.StringVar(&flags.ServiceName, "sn", "", "")
 			flagSet.StringVar(&flags.HealthCheckMethod, "hm", "", "")
 			flagSet.StringVar(&flags.HealthCheckPath, "hp", "", "")
+			flagSet.IntVar(&flags.SpotDrainTimeout, "spot-drain", 0, "")
+			flagSet.BoolVar(&flags.DiskMetrics, "disk-metrics", false, "")
+			flagSet.Float64Var(&flags.PressureMemory, "pressure-memory", 0, "")
+			flagSet.Float64Var(&flags.PressureCPU, "pressure-cpu", 0, "")
+			flagSet.StringVar(&flags.PressureAction, "pressure-action", "", "")
+			flagSet.IntVar(&flags.PressureCooldown, "pressure-cooldown", 0, "")
+			flagSet.Float64Var(&flags.DiskGCHigh, "disk-gc-high", 0, "")
+			flagSet.Float64Var(&flags.DiskGCLow, "disk-gc-low", 0, "")
+			flagSet.BoolVar(&flags.CommandQueue, "command-queue", false, "")
+			flagSet.StringVar(&flags.DNSName, "dns-name", "", "")
+			flagSet.StringVar(&flags.HostedZoneName, "hosted-zone", "", "")
 			flagSet.Parse(args[1:])
 
 			if flags.Environment == "" ||
@@ -134,6 +209,17 @@ type initConfigContext struct {
 	HealthCheckPath   string
 	Elbs              string
 	AwsStackId        string
+	SpotDrainTimeout  int
+	DiskMetrics       bool
+	PressureMemory    float64
+	PressureCPU       float64
+	PressureAction    string
+	PressureCooldown  int
+	DiskGCHigh        float64
+	DiskGCLow         float64
+	CommandQueue      bool
+	DNSName           string
+	HostedZoneName    string
 }
 
 const porterdInitConfigTemplate = `description "porterd"
@@ -145,16 +231,54 @@ stop on runlevel [!2345]
 env ELBS={{ .Elbs }}
 env AWS_STACKID={{ .AwsStackId }}
 respawn
-exec /usr/bin/porter host daemon --run -e {{ .Environment }} -sn {{ .ServiceName }} -hm {{ .HealthCheckMethod }} -hp {{ .HealthCheckPath }}
+exec {{ template "run" . }}
 `
 
+// Amazon Linux 2 and 2023 replaced upstart with systemd
+const porterdUnitTemplate = `[Unit]
+Description=porterd
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Environment=ELBS={{ .Elbs }}
+Environment=AWS_STACKID={{ .AwsStackId }}
+Restart=always
+ExecStart={{ template "run" . }}
+
+[Install]
+WantedBy=multi-user.target
+`
+
+const porterdRunTemplate = `{{ define "run" }}/usr/bin/porter host daemon --run -e {{ .Environment }} -sn {{ .ServiceName }} -hm {{ .HealthCheckMethod }} -hp {{ .HealthCheckPath }} -spot-drain {{ .SpotDrainTimeout }} -disk-metrics={{ .DiskMetrics }} -pressure-memory={{ .PressureMemory }} -pressure-cpu={{ .PressureCPU }} -pressure-action={{ .PressureAction }} -pressure-cooldown={{ .PressureCooldown }} -disk-gc-high={{ .DiskGCHigh }} -disk-gc-low={{ .DiskGCLow }} -command-queue={{ .CommandQueue }} -dns-name={{ .DNSName }} -hosted-zone={{ .HostedZoneName }}{{ end }}`
+
 func installDaemon(context initConfigContext) {
 	log := logger.Host("cmd", "daemon")
 	var err error
 
-	log.Info("installing porterd init script at " + constants.PorterDaemonInitPath)
+	initPath := constants.PorterDaemonInitPath
+	initTemplate := porterdInitConfigTemplate
+	initCommands := [][]string{
+		{"initctl", "reload-configuration"},
+		{"initctl", "start", "porterd"},
+	}
 
-	tmpl, err := template.New("").Parse(porterdInitConfigTemplate)
+	// Amazon Linux 1 is the only image porter runs on that boots with upstart
+	if usesSystemd() {
+		initPath = constants.PorterDaemonUnitPath
+		initTemplate = porterdUnitTemplate
+		initCommands = [][]string{
+			{"systemctl", "daemon-reload"},
+			{"systemctl", "enable", "--now", "porterd"},
+		}
+	}
+
+	log.Info("installing porterd init script at " + initPath)
+
+	tmpl, err := template.New("").Parse(porterdRunTemplate)
+	if err == nil {
+		_, err = tmpl.Parse(initTemplate)
+	}
 	if err != nil {
 		log.Error("template parsing failed", "Error", err)
 		os.Exit(1)
@@ -168,22 +292,18 @@ func installDaemon(context initConfigContext) {
 		os.Exit(1)
 	}
 
-	err = ioutil.WriteFile(constants.PorterDaemonInitPath, porterdInitConfig.Bytes(), constants.PorterDaemonInitPerms)
+	err = ioutil.WriteFile(initPath, porterdInitConfig.Bytes(), constants.PorterDaemonInitPerms)
 	if err != nil {
-		log.Error("WriteFile", "Path", constants.PorterDaemonInitPath, "Error", err)
+		log.Error("WriteFile", "Path", initPath, "Error", err)
 		os.Exit(1)
 	}
 
-	err = exec.Command("initctl", "reload-configuration").Run()
-	if err != nil {
-		log.Error("initctl reload-configuration", "Error", err)
-		os.Exit(1)
-	}
-
-	err = exec.Command("initctl", "start", "porterd").Run()
-	if err != nil {
-		log.Error("initctl start porterd", "Error", err)
-		os.Exit(1)
+	for _, command := range initCommands {
+		err = exec.Command(command[0], command[1:]...).Run()
+		if err != nil {
+			log.Error(strings.Join(command, " "), "Error", err)
+			os.Exit(1)
+		}
 	}
 
 	firstTime := true
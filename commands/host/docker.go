@@ -12,19 +12,24 @@
 package host
 
 import (
-	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
 	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/adobe-platform/porter/aws/ec2metadata"
+	"github.com/adobe-platform/porter/aws/ecr"
+	"github.com/adobe-platform/porter/aws_session"
 	"github.com/adobe-platform/porter/conf"
 	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/docker/engine"
 	dockerutil "github.com/adobe-platform/porter/docker/util"
 	"github.com/adobe-platform/porter/logger"
 	"github.com/adobe-platform/porter/secrets"
@@ -49,8 +54,8 @@ func (recv *DockerCmd) LongHelp() string {
     docker -- Docker container orchestration
 
 SYNOPSIS
-    docker --start -e <environment> -r <region>
-    docker --clean
+    docker --start -e <environment> -r <region> [-g <instance group>]
+    docker --clean -e <environment> -r <region> [-g <instance group>]
     docker --ip
 
 DESCRIPTION
@@ -68,6 +73,8 @@ OPTIONS
 
     -r  AWS region
 
+    -g  Only start the containers of this instance group
+
     --clean
         Cleanup containers not found in the config. This command removes
         old containers and images with the equivalent of
@@ -76,7 +83,8 @@ OPTIONS
             docker rmi <image id>
         This is important in terms of resource utilization that the containers
         are no longer running and the disk space the images occupy is released
-        for long-running services that typically only do a hotswap
+        for long-running services that typically only do a hotswap.
+        With -g containers of other instance groups are also cleaned up
 
     --ip
         print the docker interface's IPv4 address to STDOUT`
@@ -94,31 +102,33 @@ func (recv *DockerCmd) Execute(args []string) bool {
 				return false
 			}
 
-			var environment, region string
+			var environment, region, instanceGroup string
 			flagSet := flag.NewFlagSet("", flag.ExitOnError)
 			flagSet.StringVar(&environment, "e", "", "")
 			flagSet.StringVar(&region, "r", "", "")
+			flagSet.StringVar(&instanceGroup, "g", "", "")
 			flagSet.Usage = func() {
 				fmt.Println(recv.LongHelp())
 			}
 			flagSet.Parse(args[1:])
 
-			startContainers(environment, region)
+			startContainers(environment, region, instanceGroup)
 		case "--clean":
 			if len(args) == 1 {
 				return false
 			}
 
-			var environment, region string
+			var environment, region, instanceGroup string
 			flagSet := flag.NewFlagSet("", flag.ExitOnError)
 			flagSet.StringVar(&environment, "e", "", "")
 			flagSet.StringVar(&region, "r", "", "")
+			flagSet.StringVar(&instanceGroup, "g", "", "")
 			flagSet.Usage = func() {
 				fmt.Println(recv.LongHelp())
 			}
 			flagSet.Parse(args[1:])
 
-			cleanContainers(environment, region)
+			cleanContainers(environment, region, instanceGroup)
 		case "--ip":
 			printIPv4()
 		default:
@@ -130,10 +140,9 @@ func (recv *DockerCmd) Execute(args []string) bool {
 	return false
 }
 
-func startContainers(environmentStr, regionStr string) {
+func startContainers(environmentStr, regionStr, instanceGroupStr string) {
 	var (
 		err          error
-		stdoutBuf    bytes.Buffer
 		haproxyStdin HAPStdin
 	)
 
@@ -155,12 +164,19 @@ func startContainers(environmentStr, regionStr string) {
 		log.Crit("GetRegion", "Error", err)
 		os.Exit(1)
 	}
+	region = region.ForInstanceGroup(instanceGroupStr)
 
 	log.Info("starting docker containers")
 
 	dockerIPv4 := dockerIfaceIPv4(log)
 
-	if !prepareNetwork(log) {
+	dockerClient, err := engine.New()
+	if err != nil {
+		log.Crit("engine.New", "Error", err)
+		os.Exit(1)
+	}
+
+	if !prepareNetwork(log, dockerClient) {
 		os.Exit(1)
 	}
 
@@ -172,112 +188,232 @@ func startContainers(environmentStr, regionStr string) {
 	if secretsPayload.DockerPullUsername != "" && secretsPayload.DockerPullPassword != "" {
 		log.Info("docker login")
 
-		loginCmd := exec.Command("docker", "login",
-			"-u", secretsPayload.DockerPullUsername,
-			"-p", secretsPayload.DockerPullPassword,
-			secretsPayload.DockerRegistry)
-
-		loginCmd.Stderr = os.Stderr
-		err := loginCmd.Run()
+		err := dockerClient.Login(engine.AuthConfig{
+			Username:      secretsPayload.DockerPullUsername,
+			Password:      secretsPayload.DockerPullPassword,
+			ServerAddress: secretsPayload.DockerRegistry,
+		})
 		if err != nil {
 			log.Error("docker login", "Error", err)
 			os.Exit(1)
 		}
 	}
 
-	for _, container := range region.Containers {
+	if config.ECR != nil {
+		log.Info("docker login to ECR")
 
-		runArgs := []string{
-			"run",
+		// the token from pack has expired by the time a host scales out. The
+		// instance role gets a new one
+		username, password, serverAddress, err := ecr.New(aws_session.Get(region.Name)).Login()
+		if err != nil {
+			log.Error("ecr:GetAuthorizationToken", "Error", err)
+			os.Exit(1)
+		}
 
-			// daemonize
-			"-d",
+		err = dockerClient.Login(engine.AuthConfig{
+			Username:      username,
+			Password:      password,
+			ServerAddress: serverAddress,
+		})
+		if err != nil {
+			log.Error("docker login", "Error", err)
+			os.Exit(1)
+		}
+	}
 
-			// log driver with defaults since facility override doesn't work
-			"--log-driver=syslog",
+	// Read in additional variables written during bootstrap
+	envFileBytes, err := ioutil.ReadFile(constants.EnvFile)
+	if err != nil {
+		log.Crit("ReadFile", "Path", constants.EnvFile, "Error", err)
+		os.Exit(1)
+	}
 
-			// try to keep the container alive
-			// CIS Docker Benchmark 1.11.0 5.14
-			"--restart=on-failure:5",
+	for _, container := range region.Containers {
 
-			// CIS Docker Benchmark 1.11.0 5.25
-			"--security-opt=no-new-privileges",
+		podEnv := append(dockerutil.ParseEnvFile(string(envFileBytes)),
+			// who and where am i?
+			"PORTER_ENVIRONMENT="+environment.Name,
+			"AWS_REGION="+region.Name,
+			constants.EnvDeploymentId+"="+os.Getenv(constants.EnvDeploymentId),
+			constants.EnvStackColor+"="+os.Getenv(constants.EnvStackColor),
 
-			// set ulimit for container
-			// TODO calculate this
-			"--ulimit", "nofile=200000",
+			// rsyslog
+			"RSYSLOG_TCP_ADDR="+dockerIPv4,
+			"RSYSLOG_TCP_PORT=514",
+			"RSYSLOG_UDP_ADDR="+dockerIPv4,
+			"RSYSLOG_UDP_PORT=514",
 
-			"--net", "porter",
+			// porterd
+			"PORTERD_TCP_ADDR="+dockerIPv4,
+			"PORTERD_TCP_PORT="+constants.PorterDaemonBindPort,
+		)
+
+		// dependency outputs exported by the bootstrap and hot swap scripts
+		for _, dependency := range environment.Dependencies {
+			for _, output := range dependency.Outputs {
+				podEnv = append(podEnv, output.EnvVar+"="+os.Getenv(output.EnvVar))
+			}
+		}
 
-			// Read in additional variables written during bootstrap
-			"--env-file", constants.EnvFile,
+		env := append([]string{}, podEnv...)
+		for key, value := range container.Environment {
+			env = append(env, key+"="+value)
+		}
 
-			// who and where am i?
-			"-e", "PORTER_ENVIRONMENT=" + environment.Name,
-			"-e", "AWS_REGION=" + region.Name,
+		containerConfig := engine.ContainerConfig{
+			Image: container.Name,
+			Cmd:   container.Command,
+
+			Env: env,
+
+			// for log shippers and metrics agents that tag by container label
+			Labels: map[string]string{
+				constants.PorterDeploymentIdTag: os.Getenv(constants.EnvDeploymentId),
+				constants.PorterStackColorTag:   os.Getenv(constants.EnvStackColor),
+				constants.ContainerLabel:        container.OriginalName,
+			},
+
+			HostConfig: engine.HostConfig{
+				// log driver with defaults since facility override doesn't work
+				LogConfig: engine.LogConfig{Type: "syslog"},
+
+				// try to keep the container alive
+				// CIS Docker Benchmark 1.11.0 5.14
+				RestartPolicy: engine.RestartPolicy{
+					Name:              "on-failure",
+					MaximumRetryCount: 5,
+				},
+
+				// CIS Docker Benchmark 1.11.0 5.25
+				SecurityOpt: []string{"no-new-privileges"},
+
+				// set ulimit for container
+				// TODO calculate this
+				Ulimits: []engine.Ulimit{
+					{Name: "nofile", Soft: 200000, Hard: 200000},
+				},
+
+				NetworkMode: "porter",
+			},
+		}
 
-			// rsyslog
-			"-e", "RSYSLOG_TCP_ADDR=" + dockerIPv4,
-			"-e", "RSYSLOG_TCP_PORT=514",
-			"-e", "RSYSLOG_UDP_ADDR=" + dockerIPv4,
-			"-e", "RSYSLOG_UDP_PORT=514",
+		if container.Memory > 0 {
+			containerConfig.HostConfig.Memory = int64(container.Memory) << 20
+			containerConfig.HostConfig.MemorySwap = containerConfig.HostConfig.Memory
+		}
 
-			// porterd
-			"-e", "PORTERD_TCP_ADDR=" + dockerIPv4,
-			"-e", "PORTERD_TCP_PORT=" + constants.PorterDaemonBindPort,
+		if logGroup := os.Getenv(constants.EnvContainerLogGroup); logGroup != "" {
+			instanceId, err := ec2metadata.InstanceId()
+			if err != nil {
+				log.Crit("instance-id", "Error", err)
+				os.Exit(1)
+			}
+
+			// porter logs prefixes lines with the container and instance
+			// from the stream name
+			containerConfig.HostConfig.LogConfig = engine.LogConfig{
+				Type: "awslogs",
+				Config: map[string]string{
+					"awslogs-group":  logGroup,
+					"awslogs-region": region.Name,
+					"tag":            container.OriginalName + "/" + instanceId + "/{{.ID}}",
+				},
+			}
+		}
+
+		if container.LogRouter != nil {
+			logConfig, logRouterSuccess := prepareLogRouter(log, container)
+			if !logRouterSuccess {
+				os.Exit(1)
+			}
+			containerConfig.HostConfig.LogConfig = logConfig
 		}
 
 		if container.Topology == conf.Topology_Inet {
 			// publish to an ephemeral port
-			runArgs = append(runArgs, "-P")
+			containerConfig.HostConfig.PublishAllPorts = true
 		}
 
 		if container.ReadOnly == nil || *container.ReadOnly == true {
 			// CIS Docker Benchmark 1.11.0 5.12
-			runArgs = append(runArgs, "--read-only")
+			containerConfig.HostConfig.ReadonlyRootfs = true
 		}
 
 		// TODO revisit --cap-drop=ALL with override https://docs.docker.com/engine/reference/run/#runtime-privilege-and-linux-capabilities
 		if container.Uid == nil {
-			runArgs = append(runArgs, "-u", constants.ContainerUserUid)
+			containerConfig.User = constants.ContainerUserUid
 		} else {
-			runArgs = append(runArgs, "-u", strconv.Itoa(*container.Uid))
+			containerConfig.User = strconv.Itoa(*container.Uid)
 		}
 
-		runArgs = append(runArgs, getSecretEnvVars(log, container, secretsPayload)...)
-
-		runArgs = append(runArgs, container.Name)
-
-		if container.Topology == conf.Topology_Inet {
-
-			cmd := exec.Command("docker", runArgs...)
-			cmd.Stdout = &stdoutBuf
-			err = cmd.Run()
-			if err != nil {
-				log.Crit("docker run", "Error", err)
+		if container.SecretsMount == nil {
+			containerConfig.Env = append(containerConfig.Env, getSecretEnvVars(log, container, secretsPayload)...)
+		} else {
+			secretsDir, _, writeSuccess := writeSecretFiles(log, container, secretsPayload)
+			if !writeSuccess {
 				os.Exit(1)
 			}
+			containerConfig.HostConfig.Binds = append(containerConfig.HostConfig.Binds,
+				secretsDir+":"+container.SecretsMount.Path+":ro")
+		}
 
-			containerId := strings.TrimSpace(stdoutBuf.String())
-			if containerId == "" {
-				log.Crit("missing container id")
-				os.Exit(1)
+		if !preparePodVolumes(log, container) {
+			os.Exit(1)
+		}
+		containerConfig.HostConfig.Binds = append(containerConfig.HostConfig.Binds,
+			podVolumeBinds(container, container.Volumes)...)
+
+		// cfn-init mounted the file system while the instance booted
+		if efs := region.EFS; efs != nil {
+			bind := constants.EFSMountPath + ":" + efs.ContainerPath
+			if efs.ReadOnly {
+				bind += ":ro"
 			}
-			stdoutBuf.Reset()
+			containerConfig.HostConfig.Binds = append(containerConfig.HostConfig.Binds, bind)
+		}
 
-			hostPort, hostPortsuccess := getInetHostPort(log, container.InetPort, containerId)
+		// images pushed for more than one architecture have a digest each
+		container.UseArchitecture(conf.HostArchitecture())
+
+		if container.ImageDigest != "" && !pullImageDigest(log, dockerClient, container) {
+			os.Exit(1)
+		}
+
+		containerId, err := dockerClient.ContainerCreate(containerConfig, engine.PrintProgress(os.Stderr))
+		if err != nil {
+			log.Crit("docker create", "Error", err)
+			os.Exit(1)
+		}
+
+		err = dockerClient.ContainerStart(containerId)
+		if err != nil {
+			log.Crit("docker start", "ContainerId", containerId, "Error", err)
+			os.Exit(1)
+		}
+
+		if container.LogRouter != nil && !startLogRouter(log, dockerClient, container, containerId, podEnv) {
+			os.Exit(1)
+		}
+
+		if !startSidecars(log, dockerClient, container, containerId, podEnv) {
+			os.Exit(1)
+		}
+
+		if container.Topology == conf.Topology_Inet {
+
+			hostPort, hostPortsuccess := getInetHostPort(log, dockerClient, container.InetPort, containerId)
 			if !hostPortsuccess {
 				os.Exit(1)
 			}
 
 			cmdComplete := make(chan struct{})
-			go func(cmd *exec.Cmd) {
+			go func() {
 				err := exec.Command("which", "porter_docker_post_run").Run()
 				if err == nil {
 					exec.Command("porter_docker_post_run", strconv.Itoa(int(hostPort))).Run()
 				}
 				cmdComplete <- struct{}{}
-			}(cmd)
+			}()
 
 			select {
 			case <-cmdComplete:
@@ -291,17 +427,29 @@ func startContainers(environmentStr, regionStr string) {
 				HostPort:          hostPort,
 			}
 
-			haproxyStdin.Containers = append(haproxyStdin.Containers, hapContainer)
-		} else {
+			for _, route := range container.Routes {
 
-			err = exec.Command("docker", runArgs...).Run()
-			if err != nil {
-				log.Crit("docker run", "Error", err)
-				os.Exit(1)
+				routeHostPort, routeHostPortSuccess := getInetHostPort(log, dockerClient, route.Port, containerId)
+				if !routeHostPortSuccess {
+					os.Exit(1)
+				}
+
+				hapRoute := HAPRoute{
+					PathPattern: route.PathPattern,
+					HostHeader:  route.HostHeader,
+					HostPort:    routeHostPort,
+				}
+
+				hapContainer.Routes = append(hapContainer.Routes, hapRoute)
 			}
+
+			haproxyStdin.Containers = append(haproxyStdin.Containers, hapContainer)
 		}
 	}
 
+	// the ELB terminates HTTPS so only HAProxy can redirect HTTP
+	haproxyStdin.RedirectHTTP = region.TLS != nil && region.TLS.RedirectHTTP
+
 	stdoutBytes, err := json.Marshal(haproxyStdin)
 	if err != nil {
 		log.Error("json.Marshal", "Error", err)
@@ -315,33 +463,24 @@ func startContainers(environmentStr, regionStr string) {
 	}
 }
 
-func prepareNetwork(log log15.Logger) (success bool) {
-	var stdoutBuf bytes.Buffer
+func prepareNetwork(log log15.Logger, dockerClient *engine.Client) (success bool) {
 
-	cmd := exec.Command("docker", "network", "ls")
-	cmd.Stdout = &stdoutBuf
-	err := cmd.Run()
+	networks, err := dockerClient.NetworkList()
 	if err != nil {
 		log.Crit("docker network ls", "Error", err)
 		return
 	}
 
-	networks, err := dockerutil.NetworkNameToId(&stdoutBuf)
-	if err != nil {
-		log.Error("NetworkNameToId", "Error", err)
-		return
-	}
-
 	foundNetwork := false
-	for networkName := range networks {
-		if networkName == "porter" {
+	for _, network := range networks {
+		if network.Name == "porter" {
 			foundNetwork = true
 			break
 		}
 	}
 
 	if !foundNetwork {
-		err = exec.Command("docker", "network", "create", "porter").Run()
+		err = dockerClient.NetworkCreate("porter")
 		if err != nil {
 			log.Crit("docker network create porter", "Error", err)
 			return
@@ -352,26 +491,17 @@ func prepareNetwork(log log15.Logger) (success bool) {
 	return
 }
 
-func getInetHostPort(log log15.Logger, inetContainerPort int, containerId string) (hostPort uint16, success bool) {
-
-	var stdoutBuf bytes.Buffer
+func getInetHostPort(log log15.Logger, dockerClient *engine.Client, inetContainerPort int, containerId string) (hostPort uint16, success bool) {
 
 	//
 	// Get port mappings for container id
 	//
-	inspectFilter := "{{ range $containerPort, $host := .NetworkSettings.Ports }}{{ println $containerPort (index $host 0).HostPort }}{{ end }}"
-	cmd := exec.Command("docker", "inspect", "-f", inspectFilter, containerId)
-	cmd.Stdout = &stdoutBuf
-	err := cmd.Run()
+	portMappings, err := getPortMappings(dockerClient, containerId)
 	if err != nil {
 		log.Crit("docker inspect", "Error", err)
 		return
 	}
 
-	// portMappings should look like this []string{"1234/tcp 56789"}
-	portMappings := strings.Split(strings.TrimSpace(stdoutBuf.String()), "\n")
-	stdoutBuf.Reset()
-
 	if len(portMappings) == 0 {
 		log.Crit("No port mappings found. Does the Dockerfile EXPOSE any ports?")
 		return
@@ -423,7 +553,7 @@ func getInetHostPort(log log15.Logger, inetContainerPort int, containerId string
 	return
 }
 
-func cleanContainers(environmentStr, regionStr string) {
+func cleanContainers(environmentStr, regionStr, instanceGroupStr string) {
 	var err error
 
 	log := logger.Host("cmd", "docker")
@@ -444,6 +574,7 @@ func cleanContainers(environmentStr, regionStr string) {
 		log.Error("GetRegion", "Error", err)
 		os.Exit(1)
 	}
+	region = region.ForInstanceGroup(instanceGroupStr)
 
 	log.Info("cleaning up docker containers")
 
@@ -453,25 +584,37 @@ func cleanContainers(environmentStr, regionStr string) {
 		activeContainers[container.Name] = nil
 	}
 
-	psOutput, err := exec.Command("docker", "ps", "-q").Output()
+	dockerClient, err := engine.New()
+	if err != nil {
+		log.Crit("engine.New", "Error", err)
+		os.Exit(1)
+	}
+
+	containers, err := dockerClient.ContainerList(nil)
 	if err != nil {
 		log.Crit("docker ps", "Error", err)
 		os.Exit(1)
 	}
 
-	anyError := false
+	anyError := !cleanSidecars(log, dockerClient, containers, activeContainers)
 
-	containerIds := strings.Split(strings.TrimSpace(string(psOutput)), "\n")
-	for _, containerId := range containerIds {
+	for _, runningContainer := range containers {
 
-		inspectOutput, err := exec.Command("docker", "inspect", "-f", "{{ .Config.Image }}", containerId).Output()
+		// cleaned up with their container above
+		if _, isSidecar := runningContainer.Labels[constants.PodLabel]; isSidecar {
+			continue
+		}
+
+		containerId := runningContainer.Id
+
+		inspectOutput, err := dockerClient.ContainerInspect(containerId)
 		if err != nil {
 			anyError = true
 			log.Error("docker inspect", "ContainerId", containerId, "Error", err)
 			continue
 		}
 
-		imageName := strings.TrimSpace(string(inspectOutput))
+		imageName := inspectOutput.Config.Image
 
 		imageNameParts := strings.Split(imageName, ":")
 		log.Debug("cleanContainers", "imageNameParts", imageNameParts)
@@ -493,11 +636,18 @@ func cleanContainers(environmentStr, regionStr string) {
 			continue
 		}
 
-		// leaving this here in case i need it again
-		// drainConnections(log, containerId)
+		// haproxy already sends new connections to the swapped in containers.
+		// The old ones finish what they have in flight before they're stopped
+		if environment.Drain != nil {
+			preDeregistration(log, environment, region, runningContainer)
+
+			deadline := time.Now().Add(time.Duration(environment.DeregistrationDelay()) * time.Second)
+			drainConnections(log, dockerClient, containerId, deadline)
+		}
 
 		log.Info("docker stop " + containerId)
-		err = exec.Command("docker", "stop", containerId).Run()
+		// 10 seconds is the docker stop default
+		err = dockerClient.ContainerStop(containerId, 10)
 		if err != nil {
 			anyError = true
 			log.Error("docker stop", "ContainerId", containerId, "Error", err)
@@ -505,15 +655,29 @@ func cleanContainers(environmentStr, regionStr string) {
 		}
 
 		log.Info("docker rm " + containerId)
-		err = exec.Command("docker", "rm", containerId).Run()
+		err = dockerClient.ContainerRemove(containerId)
 		if err != nil {
 			anyError = true
 			log.Error("docker rm", "ContainerId", containerId, "Error", err)
 			continue
 		}
 
+		secretsDir := containerSecretsDir(imageName)
+		err = os.RemoveAll(secretsDir)
+		if err != nil {
+			anyError = true
+			log.Error("os.RemoveAll", "Path", secretsDir, "Error", err)
+		}
+
+		volumesDir := podVolumesDir(imageName)
+		err = os.RemoveAll(volumesDir)
+		if err != nil {
+			anyError = true
+			log.Error("os.RemoveAll", "Path", volumesDir, "Error", err)
+		}
+
 		log.Info("docker rmi " + imageName)
-		err = exec.Command("docker", "rmi", imageName).Run()
+		err = dockerClient.ImageRemove(imageName)
 		if err != nil {
 			anyError = true
 			log.Error("docker rmi", "ImageName", imageName, "Error", err)
@@ -528,20 +692,50 @@ func cleanContainers(environmentStr, regionStr string) {
 	}
 }
 
-func drainConnections(log log15.Logger, containerId string) (success bool) {
-	var err error
+// preDeregistration runs the drain pre_deregistration command in an inet
+// container that's being swapped out. A failure is logged rather than
+// stopping the cleanup
+func preDeregistration(log log15.Logger, environment *conf.Environment, region *conf.Region,
+	container engine.Container) {
+
+	command := environment.Drain.PreDeregistration
+	if len(command) == 0 {
+		return
+	}
+
+	name := container.Labels[constants.ContainerLabel]
+	inet := false
+	for _, regionContainer := range region.Containers {
+		if regionContainer.Name == name && regionContainer.Topology == conf.Topology_Inet {
+			inet = true
+		}
+	}
+	if !inet {
+		return
+	}
+
+	log = log.New("ContainerId", container.Id)
+	log.Info("Running pre_deregistration")
+
+	output, err := exec.Command("docker", append([]string{"exec", container.Id}, command...)...).CombinedOutput()
+	if err != nil {
+		log.Warn("pre_deregistration failed", "Error", err, "Output", string(output))
+	}
+}
+
+// drainConnections waits for the container's published ports to have no
+// connections until the deadline
+func drainConnections(log log15.Logger, dockerClient *engine.Client, containerId string,
+	deadline time.Time) (success bool) {
 
 	log = log.New("ContainerId", containerId)
 
-	inspectFilter := "{{ range $containerPort, $host := .NetworkSettings.Ports }}{{ println $containerPort (index $host 0).HostPort }}{{ end }}"
-	inspectOut, err := exec.Command("docker", "inspect", "-f", inspectFilter, containerId).Output()
+	portMappings, err := getPortMappings(dockerClient, containerId)
 	if err != nil {
 		log.Crit("docker inspect", "Error", err)
 		return
 	}
 
-	// portMappings should look like this []string{"1234/tcp 56789"}
-	portMappings := strings.Split(strings.TrimSpace(string(inspectOut)), "\n")
 	log.Debug("drainConnections", "portMappings", portMappings)
 
 	if len(portMappings) == 0 {
@@ -575,6 +769,11 @@ func drainConnections(log log15.Logger, containerId string) (success bool) {
 				break
 			}
 
+			if time.Now().After(deadline) {
+				log.Warn("Stopping the container with connections open", "Connections", connectionCount)
+				return
+			}
+
 			time.Sleep(1 * time.Second)
 		}
 	}
@@ -583,6 +782,27 @@ func drainConnections(log log15.Logger, containerId string) (success bool) {
 	return
 }
 
+// getPortMappings returns the published ports of a container sorted by
+// container port like this []string{"1234/tcp 56789"}
+func getPortMappings(dockerClient *engine.Client, containerId string) ([]string, error) {
+
+	container, err := dockerClient.ContainerInspect(containerId)
+	if err != nil {
+		return nil, err
+	}
+
+	portMappings := make([]string, 0)
+	for containerPort, bindings := range container.NetworkSettings.Ports {
+		if len(bindings) == 0 {
+			continue
+		}
+		portMappings = append(portMappings, containerPort+" "+bindings[0].HostPort)
+	}
+	sort.Strings(portMappings)
+
+	return portMappings, nil
+}
+
 func printIPv4() {
 	log := logger.Host("cmd", "docker")
 	fmt.Fprint(os.Stdout, dockerIfaceIPv4(log))
@@ -623,20 +843,46 @@ func dockerIfaceIPv4(log log15.Logger) string {
 	return ""
 }
 
+// pullImageDigest pulls the image pack pushed and tags it with the name the
+// rest of porter knows it by. Tags can be moved after pack but digests can't
+func pullImageDigest(log log15.Logger, dockerClient *engine.Client,
+	container *conf.Container) (success bool) {
+
+	reference := container.ImageReference()
+
+	log = log.New("ImageDigest", container.ImageDigest)
+
+	log.Info("docker pull", "Image", reference)
+	err := dockerClient.ImagePull(reference, engine.PrintProgress(os.Stderr))
+	if err != nil {
+		log.Crit("docker pull", "Image", reference, "Error", err)
+		return
+	}
+
+	err = dockerClient.ImageTag(reference, container.Name)
+	if err != nil {
+		log.Crit("docker tag", "ImageTag", container.Name, "Error", err)
+		return
+	}
+
+	success = true
+	return
+}
+
 func getSecretEnvVars(log log15.Logger, container *conf.Container, secretsPayload secrets.Payload) []string {
 
-	runArgs := make([]string, 0)
+	env := make([]string, 0)
 
 	if containerSecrets, exists := secretsPayload.ContainerSecrets[container.Name]; exists {
 
 		kvps := strings.Split(string(containerSecrets), "\n")
 
 		for _, kvp := range kvps {
-			runArgs = append(runArgs, "-e", kvp)
+			env = append(env, kvp)
 
 			log.Debug("injecting secret", "Key", strings.Split(kvp, "=")[0])
 		}
 	}
 
-	return runArgs
+	return env
 }
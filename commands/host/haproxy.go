@@ -43,17 +43,33 @@ type (
 		StatsPassword   string
 		StatsUri        string
 		IpBlacklistPath string
+		Routes          []haProxyRoute
+	}
+
+	haProxyRoute struct {
+		Name      string
+		PathRegex string
+		HostRegex string
+		HostPort  uint16
 	}
 
 	HAPStdin struct {
-		Containers []HAPContainer `json:"containers"`
+		Containers   []HAPContainer `json:"containers"`
+		RedirectHTTP bool           `json:"redirectHttp,omitempty"`
 	}
 
 	HAPContainer struct {
-		Id                string `json:"id"`
-		HealthCheckMethod string `json:"healthCheckMethod"`
-		HealthCheckPath   string `json:"healthCheckPath"`
-		HostPort          uint16 `json:"hostPort"`
+		Id                string     `json:"id"`
+		HealthCheckMethod string     `json:"healthCheckMethod"`
+		HealthCheckPath   string     `json:"healthCheckPath"`
+		HostPort          uint16     `json:"hostPort"`
+		Routes            []HAPRoute `json:"routes,omitempty"`
+	}
+
+	HAPRoute struct {
+		PathPattern string `json:"pathPattern,omitempty"`
+		HostHeader  string `json:"hostHeader,omitempty"`
+		HostPort    uint16 `json:"hostPort"`
 	}
 
 	hostSignal struct {
@@ -96,10 +112,23 @@ DESCRIPTION
           "id": "abc123",
           "healthCheckMethod": "GET",
           "healthCheckPath": "/health",
-          "hostPort": 12345
+          "hostPort": 12345,
+          "routes": [
+            {
+              "pathPattern": "/api/*",
+              "hostHeader": "api.example.com",
+              "hostPort": 23456
+            }
+          ]
         }
       ]
-    }`
+    }
+
+    Routes are optional. A request matching a route's path pattern and host
+    header is sent to the route's host port instead of the container's.
+
+    If "redirectHttp" is true requests the ELB received over HTTP are
+    redirected to HTTPS.`
 }
 
 func (recv *HAProxyCmd) SubCommands() []cli.Command {
@@ -150,6 +179,7 @@ func (recv *HAProxyCmd) Execute(args []string) bool {
 			StatsPassword:   constants.HAProxyStatsPassword,
 			StatsUri:        constants.HAProxyStatsUri,
 			IpBlacklistPath: ipBlacklistPath,
+			Routes:          haProxyRoutes(stdinStruct),
 		}
 
 		if !hotswap(log, context) {
@@ -183,6 +213,61 @@ func hotswap(log log15.Logger, context haProxyConfigContext) (success bool) {
 	return
 }
 
+// haProxyRoutes flattens container routes in the order they were given which
+// is the same order the ALB listener rules are prioritized
+func haProxyRoutes(stdin HAPStdin) []haProxyRoute {
+	routes := make([]haProxyRoute, 0)
+
+	for _, container := range stdin.Containers {
+		for _, route := range container.Routes {
+
+			hapRoute := haProxyRoute{
+				Name:     fmt.Sprintf("route-%d", len(routes)),
+				HostPort: route.HostPort,
+			}
+
+			if route.PathPattern != "" {
+				hapRoute.PathRegex = "^" + wildcardRegex(route.PathPattern) + "$"
+			}
+
+			if route.HostHeader != "" {
+				hapRoute.HostRegex = "^" + wildcardRegex(route.HostHeader) + "(:[0-9]+)?$"
+			}
+
+			routes = append(routes, hapRoute)
+		}
+	}
+
+	return routes
+}
+
+// wildcardRegex converts an ALB rule pattern where * matches 0 or more
+// characters and ? matches exactly 1 character into a regex.
+//
+// HAProxy treats backslashes in its config as escapes so literal characters
+// are wrapped in a character class instead of escaped
+func wildcardRegex(pattern string) string {
+	var buf bytes.Buffer
+
+	for _, r := range pattern {
+		switch {
+		case r == '*':
+			buf.WriteString(".*")
+		case r == '?':
+			buf.WriteString(".")
+		case r >= 'a' && r <= 'z',
+			r >= 'A' && r <= 'Z',
+			r >= '0' && r <= '9',
+			r == '-', r == '_', r == '/', r == ':', r == '@', r == '~':
+			buf.WriteRune(r)
+		default:
+			buf.WriteString("[" + string(r) + "]")
+		}
+	}
+
+	return buf.String()
+}
+
 func writeNewConfig(log log15.Logger, context haProxyConfigContext) (success bool) {
 
 	log.Info("writing new config")
@@ -223,9 +308,9 @@ func reloadHaproxy(log log15.Logger) (success bool) {
 	log.Info("reloading config")
 
 	t0 := time.Now()
-	err = exec.Command("service", "haproxy", "reload").Run()
+	err = serviceCommand("reload", "haproxy").Run()
 	if err != nil {
-		log.Error("service haproxy reload", "Error", err)
+		log.Error("reload haproxy", "Error", err)
 		return
 	}
 
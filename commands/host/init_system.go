@@ -0,0 +1,36 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package host
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/adobe-platform/porter/constants"
+)
+
+// usesSystemd is true on Amazon Linux 2 and 2023. Amazon Linux 1 boots with
+// upstart and manages services with SysV init scripts
+func usesSystemd() bool {
+	_, err := os.Stat(constants.SystemdRuntimePath)
+	return err == nil
+}
+
+// serviceCommand runs action on a service with systemctl where systemd is
+// PID 1 and the SysV service command otherwise
+func serviceCommand(action, name string) *exec.Cmd {
+	if usesSystemd() {
+		return exec.Command("systemctl", action, name)
+	}
+
+	return exec.Command("service", name, action)
+}
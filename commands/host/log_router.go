@@ -0,0 +1,146 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package host
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/docker/engine"
+	"github.com/adobe-platform/porter/log_router"
+	"github.com/inconshreveable/log15"
+)
+
+// A container with a log_router logs to Fluent Bit with docker's fluentd log
+// driver. The driver runs in the docker daemon so it can't reach the pod's
+// network namespace. Instead the router listens on a unix socket in a
+// directory shared with the host
+
+func logRouterDir(container *conf.Container) string {
+	return path.Join(podVolumesDir(container.Name), constants.LogRouterName)
+}
+
+// prepareLogRouter writes the router's config and returns the log config that
+// sends the container's logs to it. The driver connects asynchronously because
+// the router joins the container's network namespace so it starts second
+func prepareLogRouter(log log15.Logger, container *conf.Container) (logConfig engine.LogConfig, success bool) {
+
+	uid, _ := strconv.Atoi(constants.ContainerUserUid)
+	if container.Uid != nil {
+		uid = *container.Uid
+	}
+
+	configDir := logRouterDir(container)
+
+	err := os.MkdirAll(configDir, 0755)
+	if err != nil {
+		log.Crit("os.MkdirAll", "Path", configDir, "Error", err)
+		return
+	}
+
+	err = os.Chown(configDir, uid, uid)
+	if err != nil {
+		log.Crit("os.Chown", "Path", configDir, "Error", err)
+		return
+	}
+
+	files := map[string]string{
+		log_router.ConfigFile:  log_router.Config(container.LogRouter, constants.LogRouterConfigDir),
+		log_router.ParsersFile: log_router.Parsers(container.LogRouter),
+	}
+	for fileName, contents := range files {
+		filePath := path.Join(configDir, fileName)
+
+		err = ioutil.WriteFile(filePath, []byte(contents), 0644)
+		if err != nil {
+			log.Crit("WriteFile", "Path", filePath, "Error", err)
+			return
+		}
+	}
+
+	logConfig = engine.LogConfig{
+		Type: "fluentd",
+		Config: map[string]string{
+			"fluentd-address":       "unix://" + path.Join(configDir, log_router.SocketFile),
+			"fluentd-async-connect": "true",
+			"tag":                   container.Name,
+		},
+	}
+	success = true
+	return
+}
+
+// startLogRouter starts Fluent Bit in the container's network namespace so
+// outputs leave the host like the container's own traffic. Output options can
+// reference the container's environment like ${TOKEN}
+func startLogRouter(log log15.Logger, dockerClient *engine.Client, container *conf.Container,
+	containerId string, podEnv []string) (success bool) {
+
+	routerLog := log.New("Sidecar", constants.LogRouterName)
+
+	uid := constants.ContainerUserUid
+	if container.Uid != nil {
+		uid = strconv.Itoa(*container.Uid)
+	}
+
+	env := append([]string{}, podEnv...)
+	for key, value := range container.Environment {
+		env = append(env, key+"="+value)
+	}
+
+	routerConfig := engine.ContainerConfig{
+		Image: container.LogRouter.Image,
+		User:  uid,
+		Env:   env,
+		Cmd: []string{
+			"/fluent-bit/bin/fluent-bit",
+			"-c", path.Join(constants.LogRouterConfigDir, log_router.ConfigFile),
+		},
+		Labels: map[string]string{
+			constants.PodLabel:              container.Name,
+			constants.PorterDeploymentIdTag: os.Getenv(constants.EnvDeploymentId),
+			constants.PorterStackColorTag:   os.Getenv(constants.EnvStackColor),
+		},
+		HostConfig: engine.HostConfig{
+			Binds:          []string{logRouterDir(container) + ":" + constants.LogRouterConfigDir},
+			NetworkMode:    "container:" + containerId,
+			ReadonlyRootfs: true,
+			SecurityOpt:    []string{"no-new-privileges"},
+			LogConfig:      engine.LogConfig{Type: "syslog"},
+			RestartPolicy: engine.RestartPolicy{
+				Name:              "on-failure",
+				MaximumRetryCount: 5,
+			},
+		},
+	}
+
+	routerId, err := dockerClient.ContainerCreate(routerConfig, engine.PrintProgress(os.Stderr))
+	if err != nil {
+		routerLog.Crit("docker create", "Image", container.LogRouter.Image, "Error", err)
+		return
+	}
+
+	err = dockerClient.ContainerStart(routerId)
+	if err != nil {
+		routerLog.Crit("docker start", "ContainerId", routerId, "Error", err)
+		return
+	}
+
+	routerLog.Info("Started log router", "ContainerId", routerId)
+
+	success = waitForHealthySidecar(log, dockerClient, container, constants.LogRouterName, routerId)
+	return
+}
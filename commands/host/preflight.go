@@ -0,0 +1,332 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package host
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adobe-platform/porter/bootstrap_progress"
+	"github.com/adobe-platform/porter/daemon/wait_handle"
+	"github.com/adobe-platform/porter/docker/engine"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/inconshreveable/log15"
+	"github.com/phylake/go-cli"
+)
+
+const (
+	caBundlePath = "/etc/pki/tls/certs/ca-bundle.crt"
+
+	// the clock is usually still stepping when the instance boots
+	clockSyncTimeout = 2 * time.Minute
+	maxClockOffset   = 1.0 // seconds
+
+	minFreeDiskBytes = 1 << 30
+)
+
+type PreflightCmd struct{}
+
+func (recv *PreflightCmd) Name() string {
+	return "preflight"
+}
+
+func (recv *PreflightCmd) ShortHelp() string {
+	return "Check the host is fit to run the service"
+}
+
+func (recv *PreflightCmd) LongHelp() string {
+	return fmt.Sprintf(`NAME
+    preflight -- Check the host is fit to run the service
+
+SYNOPSIS
+    preflight -r <region>
+
+DESCRIPTION
+    preflight runs during bootstrap before the service is installed. It checks
+
+    - the clock is synchronized by chrony (or ntpd) within %.0f second of NTP
+      time
+    - %s has unexpired certificates and AWS endpoints verify with
+      the system's certificate authorities
+    - / and docker's root directory have at least %d MiB free
+    - the docker daemon responds
+
+    If any check fails the reasons are reported to the deployer as the
+    preflight-failed milestone and the stack's wait condition is signaled with
+    FAILURE so the stack rolls back with the reasons in its events instead of
+    timing out.
+
+OPTIONS
+    -r  AWS region`, maxClockOffset, caBundlePath, minFreeDiskBytes>>20)
+}
+
+func (recv *PreflightCmd) SubCommands() []cli.Command {
+	return nil
+}
+
+func (recv *PreflightCmd) Execute(args []string) bool {
+	var region string
+	flagSet := flag.NewFlagSet("", flag.ExitOnError)
+	flagSet.StringVar(&region, "r", "", "")
+	flagSet.Usage = func() {
+		fmt.Println(recv.LongHelp())
+	}
+	flagSet.Parse(args)
+
+	if region == "" {
+		return false
+	}
+
+	preflight(region)
+	return true
+}
+
+func preflight(region string) {
+	log := logger.Host("cmd", "preflight")
+
+	reasons := make([]string, 0)
+
+	diskPaths := []string{"/"}
+
+	dockerRootDir, reason := preflightDocker(log)
+	if reason != "" {
+		reasons = append(reasons, reason)
+	} else if dockerRootDir != "/" {
+		diskPaths = append(diskPaths, dockerRootDir)
+	}
+
+	if reason = preflightClock(log); reason != "" {
+		reasons = append(reasons, reason)
+	}
+
+	if reason = preflightCertificates(log, region); reason != "" {
+		reasons = append(reasons, reason)
+	}
+
+	for _, diskPath := range diskPaths {
+		if reason = preflightDisk(diskPath); reason != "" {
+			reasons = append(reasons, reason)
+		}
+	}
+
+	if len(reasons) == 0 {
+		log.Info("Preflight passed")
+		return
+	}
+
+	for _, reason := range reasons {
+		log.Crit("Preflight failed", "Reason", reason)
+	}
+
+	reason = strings.Join(reasons, "; ")
+
+	signalProgress(bootstrap_progress.PreflightFailed, reason, region)
+	wait_handle.Fail(reason)
+	os.Exit(1)
+}
+
+// preflightDocker returns docker's root directory
+func preflightDocker(log log15.Logger) (rootDir, reason string) {
+
+	dockerClient, err := engine.New()
+	if err != nil {
+		reason = "docker client: " + err.Error()
+		return
+	}
+
+	err = dockerClient.Ping()
+	if err != nil {
+		reason = "docker daemon isn't responding: " + err.Error()
+		return
+	}
+
+	info, err := dockerClient.Info()
+	if err != nil {
+		reason = "docker info: " + err.Error()
+		return
+	}
+
+	log.Info("docker daemon is healthy", "ServerVersion", info.ServerVersion)
+	rootDir = info.DockerRootDir
+	return
+}
+
+// preflightClock waits for the clock to be synchronized. chrony is preferred
+// with ntpd as a fallback for older AMIs
+func preflightClock(log log15.Logger) (reason string) {
+
+	deadline := time.Now().Add(clockSyncTimeout)
+
+	for {
+		var synced bool
+
+		if _, err := exec.LookPath("chronyc"); err == nil {
+			synced, reason = chronySynced()
+		} else if _, err := exec.LookPath("ntpstat"); err == nil {
+			synced, reason = ntpSynced()
+		} else {
+			reason = "neither chronyc nor ntpstat is installed"
+			return
+		}
+
+		if synced {
+			log.Info("clock is synchronized")
+			return
+		}
+
+		if time.Now().After(deadline) {
+			reason = fmt.Sprintf("clock not synchronized after %s: %s", clockSyncTimeout, reason)
+			return
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// chronySynced parses chronyc tracking
+//
+//	System time     : 0.000012345 seconds fast of NTP time
+//	Leap status     : Normal
+func chronySynced() (synced bool, reason string) {
+
+	output, err := exec.Command("chronyc", "tracking").Output()
+	if err != nil {
+		reason = "chronyc tracking: " + err.Error()
+		return
+	}
+
+	var leapStatus string
+	offset := math.Inf(1)
+
+	for _, line := range strings.Split(string(output), "\n") {
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		value := strings.TrimSpace(parts[1])
+
+		switch strings.TrimSpace(parts[0]) {
+		case "Leap status":
+			leapStatus = value
+		case "System time":
+			fields := strings.Fields(value)
+			if len(fields) > 0 {
+				if seconds, err := strconv.ParseFloat(fields[0], 64); err == nil {
+					offset = seconds
+				}
+			}
+		}
+	}
+
+	if leapStatus != "Normal" {
+		reason = "chrony leap status is " + strconv.Quote(leapStatus)
+		return
+	}
+
+	if offset > maxClockOffset {
+		reason = fmt.Sprintf("clock is %g seconds from NTP time", offset)
+		return
+	}
+
+	synced = true
+	return
+}
+
+func ntpSynced() (synced bool, reason string) {
+
+	err := exec.Command("ntpstat").Run()
+	if err != nil {
+		reason = "ntpstat: " + err.Error()
+		return
+	}
+
+	synced = true
+	return
+}
+
+// preflightCertificates checks the system's certificate authorities. An empty
+// or entirely expired bundle or a clock that's off makes every TLS connection
+// to AWS fail
+func preflightCertificates(log log15.Logger, region string) (reason string) {
+
+	bundle, err := ioutil.ReadFile(caBundlePath)
+	if err != nil {
+		reason = "reading CA bundle: " + err.Error()
+		return
+	}
+
+	now := time.Now()
+	var total, expired int
+
+	for block, rest := pem.Decode(bundle); block != nil; block, rest = pem.Decode(rest) {
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+
+		total++
+		if now.After(cert.NotAfter) {
+			expired++
+		}
+	}
+
+	if total == expired {
+		reason = fmt.Sprintf("%s has no unexpired certificates (%d expired)", caBundlePath, expired)
+		return
+	}
+
+	if expired > 0 {
+		log.Warn("CA bundle has expired certificates", "Expired", expired, "Total", total)
+	}
+
+	endpoint := "sqs." + region + ".amazonaws.com:443"
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", endpoint, nil)
+	if err != nil {
+		reason = "TLS to " + endpoint + ": " + err.Error()
+		return
+	}
+	conn.Close()
+
+	log.Info("certificate authorities are valid", "Certificates", total)
+	return
+}
+
+func preflightDisk(diskPath string) (reason string) {
+
+	free, err := freeDiskBytes(diskPath)
+	if err != nil {
+		reason = "statfs " + diskPath + ": " + err.Error()
+		return
+	}
+
+	if free < minFreeDiskBytes {
+		reason = fmt.Sprintf("%s has %d MiB free, need %d MiB", diskPath, free>>20, minFreeDiskBytes>>20)
+		return
+	}
+
+	return
+}
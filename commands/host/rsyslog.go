@@ -14,7 +14,6 @@ package host
 import (
 	"fmt"
 	"io/ioutil"
-	"os/exec"
 
 	"github.com/adobe-platform/porter/constants"
 	"github.com/adobe-platform/porter/files"
@@ -81,7 +80,7 @@ func initRsyslog() {
 	}
 
 	log.Info("restarting rsyslog with new config")
-	err = exec.Command("service", "rsyslog", "restart").Run()
+	err = serviceCommand("restart", "rsyslog").Run()
 	if err != nil {
 		log.Error("failed to restart rsyslog", "Error", err)
 		return
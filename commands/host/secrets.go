@@ -39,9 +39,16 @@ func (recv *SecretsCmd) LongHelp() string {
 SYNOPSIS
     secrets --get -e <environment> -r <region>
 
+    secrets --refresh -e <environment> -r <region>
+
 DESCRIPTION
     secrets gets any secrets provided to porter and prints them on STDOUT.
 
+    --refresh downloads secrets again and rewrites them for running containers
+    that have a secrets_mount. Files are replaced atomically and the .version
+    file in the mount is rewritten last. Containers with a reload_signal are
+    sent that signal if their secrets changed.
+
     This command needs the latest porter config that exists on the host
 
 OPTIONS
@@ -57,7 +64,7 @@ func (recv *SecretsCmd) SubCommands() []cli.Command {
 func (recv *SecretsCmd) Execute(args []string) bool {
 	if len(args) > 0 {
 		switch args[0] {
-		case "--get":
+		case "--get", "--refresh":
 
 			var environmentFlag, regionFlag string
 			flagSet := flag.NewFlagSet("", flag.ExitOnError)
@@ -87,6 +94,13 @@ func (recv *SecretsCmd) Execute(args []string) bool {
 				os.Exit(1)
 			}
 
+			if args[0] == "--refresh" {
+				if !refreshSecrets(log, region) {
+					os.Exit(1)
+				}
+				return true
+			}
+
 			secretsPayload, downloadSuccess := secrets.Download(log, region)
 			if !downloadSuccess {
 				os.Exit(1)
@@ -0,0 +1,268 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package host
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/docker/engine"
+	"github.com/adobe-platform/porter/secrets"
+	"github.com/inconshreveable/log15"
+)
+
+// The contract with containers that use secrets_mount:
+//
+//  1. every secret is a file named after its key in the mount path
+//  2. files are replaced atomically with a rename so a reader never sees a
+//     partially written secret
+//  3. the version file is written after all secrets and contains a checksum of
+//     them. Containers can watch it to learn that secrets changed
+//  4. if reload_signal is configured it's sent to the container after the
+//     version file is written
+const secretsVersionFile = ".version"
+
+// writeSecretFiles writes each of the container's secrets to a file named
+// after the secret's key. The files live on a tmpfs mounted during bootstrap
+// so they never touch disk
+func writeSecretFiles(log log15.Logger, container *conf.Container, secretsPayload secrets.Payload) (secretsDir string, changed bool, success bool) {
+
+	secretsDir = containerSecretsDir(container.Name)
+
+	log = log.New("SecretsDir", secretsDir)
+
+	mode, err := strconv.ParseUint(container.SecretsMount.Mode, 8, 32)
+	if err != nil {
+		log.Crit("strconv.ParseUint", "Mode", container.SecretsMount.Mode, "Error", err)
+		return
+	}
+
+	var uid int
+	if container.SecretsMount.Uid != nil {
+		uid = *container.SecretsMount.Uid
+	} else if container.Uid != nil {
+		uid = *container.Uid
+	} else {
+		uid, _ = strconv.Atoi(constants.ContainerUserUid)
+	}
+
+	gid := uid
+	if container.SecretsMount.Gid != nil {
+		gid = *container.SecretsMount.Gid
+	}
+
+	containerSecrets := secretsPayload.ContainerSecrets[container.Name]
+
+	checksumArray := sha256.Sum256([]byte(containerSecrets))
+	version := hex.EncodeToString(checksumArray[:])
+
+	versionPath := path.Join(secretsDir, secretsVersionFile)
+	if versionBytes, err := ioutil.ReadFile(versionPath); err == nil && string(versionBytes) == version {
+		log.Debug("secrets are unchanged", "Version", version)
+		success = true
+		return
+	}
+
+	err = os.MkdirAll(secretsDir, 0500)
+	if err != nil {
+		log.Crit("os.MkdirAll", "Error", err)
+		return
+	}
+
+	err = os.Chown(secretsDir, uid, gid)
+	if err != nil {
+		log.Crit("os.Chown", "Error", err)
+		return
+	}
+
+	keys := make(map[string]interface{})
+	keys[secretsVersionFile] = nil
+
+	if containerSecrets != "" {
+
+		kvps := strings.Split(containerSecrets, "\n")
+
+		for _, kvp := range kvps {
+			kvpParts := strings.SplitN(kvp, "=", 2)
+			if len(kvpParts) != 2 || kvpParts[0] == "" {
+				continue
+			}
+
+			if !validSecretFileName(kvpParts[0]) {
+				log.Crit("secret keys with a secrets_mount can't contain / or start with .", "Key", kvpParts[0])
+				return
+			}
+
+			if !writeSecretFile(log, secretsDir, kvpParts[0], kvpParts[1], os.FileMode(mode), uid, gid) {
+				return
+			}
+			keys[kvpParts[0]] = nil
+
+			log.Debug("mounting secret", "Key", kvpParts[0])
+		}
+	}
+
+	// remove secrets that were rotated out
+	infos, err := ioutil.ReadDir(secretsDir)
+	if err != nil {
+		log.Crit("ioutil.ReadDir", "Error", err)
+		return
+	}
+	for _, info := range infos {
+		if _, exists := keys[info.Name()]; !exists {
+			err = os.Remove(path.Join(secretsDir, info.Name()))
+			if err != nil {
+				log.Crit("os.Remove", "Key", info.Name(), "Error", err)
+				return
+			}
+		}
+	}
+
+	if !writeSecretFile(log, secretsDir, secretsVersionFile, version, 0444, uid, gid) {
+		return
+	}
+
+	changed = true
+	success = true
+	return
+}
+
+// validSecretFileName is true if the key names a file directly in the mount
+// path. Keys can't climb out of it or replace the version file and temp files
+func validSecretFileName(key string) bool {
+	return key != "" &&
+		!strings.HasPrefix(key, ".") &&
+		!strings.ContainsAny(key, "/\\\x00") &&
+		path.Clean(key) == key
+}
+
+func writeSecretFile(log log15.Logger, secretsDir, key, value string, mode os.FileMode, uid, gid int) (success bool) {
+
+	filePath := path.Join(secretsDir, key)
+	tmpPath := path.Join(secretsDir, "."+key+".tmp")
+
+	err := ioutil.WriteFile(tmpPath, []byte(value), mode)
+	if err != nil {
+		log.Crit("ioutil.WriteFile", "Key", key, "Error", err)
+		return
+	}
+
+	err = os.Chown(tmpPath, uid, gid)
+	if err != nil {
+		log.Crit("os.Chown", "Key", key, "Error", err)
+		return
+	}
+
+	err = os.Rename(tmpPath, filePath)
+	if err != nil {
+		log.Crit("os.Rename", "Key", key, "Error", err)
+		return
+	}
+
+	success = true
+	return
+}
+
+// refreshSecrets rewrites the secrets of containers with a secrets_mount and
+// signals the ones whose secrets changed
+func refreshSecrets(log log15.Logger, region *conf.Region) (success bool) {
+
+	anySecretsMount := false
+	for _, container := range region.Containers {
+		if container.SecretsMount != nil {
+			anySecretsMount = true
+			break
+		}
+	}
+
+	if !anySecretsMount {
+		log.Debug("no containers have a secrets_mount")
+		success = true
+		return
+	}
+
+	secretsPayload, downloadSuccess := secrets.Download(log, region)
+	if !downloadSuccess {
+		return
+	}
+
+	for _, container := range region.Containers {
+
+		if container.SecretsMount == nil {
+			continue
+		}
+
+		log := log.New("Container", container.Name)
+
+		// secrets are written when the container starts. there's nothing to
+		// refresh if it hasn't
+		if _, err := os.Stat(containerSecretsDir(container.Name)); err != nil {
+			log.Debug("secrets dir doesn't exist")
+			continue
+		}
+
+		_, changed, writeSuccess := writeSecretFiles(log, container, secretsPayload)
+		if !writeSuccess {
+			return
+		}
+
+		if !changed {
+			continue
+		}
+
+		log.Info("secrets changed")
+
+		if container.SecretsMount.ReloadSignal == "" {
+			continue
+		}
+
+		dockerClient, err := engine.New()
+		if err != nil {
+			log.Error("engine.New", "Error", err)
+			return
+		}
+
+		containers, err := dockerClient.ContainerList(map[string][]string{
+			"ancestor": {container.Name},
+		})
+		if err != nil {
+			log.Error("docker ps", "Error", err)
+			return
+		}
+
+		for _, runningContainer := range containers {
+
+			log.Info("docker kill", "Signal", container.SecretsMount.ReloadSignal, "ContainerId", runningContainer.Id)
+			err = dockerClient.ContainerKill(runningContainer.Id, container.SecretsMount.ReloadSignal)
+			if err != nil {
+				log.Error("docker kill", "ContainerId", runningContainer.Id, "Error", err)
+				return
+			}
+		}
+	}
+
+	success = true
+	return
+}
+
+// secret files are written to a directory named after the image tag
+func containerSecretsDir(imageName string) string {
+	imageNameParts := strings.Split(imageName, ":")
+	return path.Join(constants.ContainerSecretsPath, imageNameParts[len(imageNameParts)-1])
+}
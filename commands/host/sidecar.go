@@ -0,0 +1,270 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package host
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/docker/engine"
+	"github.com/inconshreveable/log15"
+)
+
+// A container and its sidecars form a pod. The container owns the network
+// namespace because its ports are the ones published to HAProxy so it's
+// started first. Sidecars join it in dependency order and the container isn't
+// given to HAProxy until every sidecar with a health check is healthy
+
+func podVolumesDir(imageName string) string {
+	imageNameParts := strings.Split(imageName, ":")
+	return path.Join(constants.ContainerVolumesPath, imageNameParts[len(imageNameParts)-1])
+}
+
+// preparePodVolumes creates a directory for every volume in the pod owned by
+// the container's user
+func preparePodVolumes(log log15.Logger, container *conf.Container) (success bool) {
+
+	uid, _ := strconv.Atoi(constants.ContainerUserUid)
+	if container.Uid != nil {
+		uid = *container.Uid
+	}
+
+	for _, volumeName := range container.PodVolumeNames() {
+
+		volumeDir := path.Join(podVolumesDir(container.Name), volumeName)
+
+		err := os.MkdirAll(volumeDir, 0755)
+		if err != nil {
+			log.Crit("os.MkdirAll", "Path", volumeDir, "Error", err)
+			return
+		}
+
+		err = os.Chown(volumeDir, uid, uid)
+		if err != nil {
+			log.Crit("os.Chown", "Path", volumeDir, "Error", err)
+			return
+		}
+	}
+
+	success = true
+	return
+}
+
+func podVolumeBinds(container *conf.Container, volumes []*conf.Volume) []string {
+	binds := make([]string, 0, len(volumes))
+
+	for _, volume := range volumes {
+		bind := path.Join(podVolumesDir(container.Name), volume.Name) + ":" + volume.Path
+		if volume.ReadOnly {
+			bind += ":ro"
+		}
+		binds = append(binds, bind)
+	}
+
+	return binds
+}
+
+// startSidecars starts the container's sidecars in its network namespace and
+// waits for them to be healthy
+func startSidecars(log log15.Logger, dockerClient *engine.Client, container *conf.Container,
+	containerId string, podEnv []string) (success bool) {
+
+	sidecars, err := container.SidecarStartOrder()
+	if err != nil {
+		log.Crit("SidecarStartOrder", "Error", err)
+		return
+	}
+
+	sidecarIds := make(map[string]string)
+
+	for _, sidecar := range sidecars {
+
+		sidecarLog := log.New("Sidecar", sidecar.Name)
+
+		for _, dependency := range sidecar.DependsOn {
+			if !waitForHealthySidecar(log, dockerClient, container, dependency, sidecarIds[dependency]) {
+				return
+			}
+		}
+
+		uid := constants.ContainerUserUid
+		if sidecar.Uid != nil {
+			uid = strconv.Itoa(*sidecar.Uid)
+		} else if container.Uid != nil {
+			uid = strconv.Itoa(*container.Uid)
+		}
+
+		env := append([]string{}, podEnv...)
+		for key, value := range sidecar.Environment {
+			env = append(env, key+"="+value)
+		}
+
+		sidecarConfig := engine.ContainerConfig{
+			Image: sidecar.Image,
+			User:  uid,
+			Env:   env,
+			Cmd:   sidecar.Command,
+			Labels: map[string]string{
+				constants.PodLabel:              container.Name,
+				constants.SidecarPriorityLabel:  strconv.Itoa(sidecar.Priority),
+				constants.PorterDeploymentIdTag: os.Getenv(constants.EnvDeploymentId),
+				constants.PorterStackColorTag:   os.Getenv(constants.EnvStackColor),
+			},
+			HostConfig: engine.HostConfig{
+				Binds:          podVolumeBinds(container, sidecar.Volumes),
+				NetworkMode:    "container:" + containerId,
+				ReadonlyRootfs: sidecar.ReadOnly == nil || *sidecar.ReadOnly,
+				SecurityOpt:    []string{"no-new-privileges"},
+				LogConfig:      engine.LogConfig{Type: "syslog"},
+				RestartPolicy: engine.RestartPolicy{
+					Name:              "on-failure",
+					MaximumRetryCount: 5,
+				},
+			},
+		}
+
+		if sidecar.Memory > 0 {
+			sidecarConfig.HostConfig.Memory = int64(sidecar.Memory) << 20
+			sidecarConfig.HostConfig.MemorySwap = sidecarConfig.HostConfig.Memory
+		}
+
+		if sidecar.HealthCheck != nil {
+			sidecarConfig.Healthcheck = &engine.HealthConfig{
+				Test:     append([]string{"CMD"}, sidecar.HealthCheck.Command...),
+				Interval: int64(time.Duration(sidecar.HealthCheck.Interval) * time.Second),
+				Timeout:  int64(time.Duration(sidecar.HealthCheck.Timeout) * time.Second),
+				Retries:  sidecar.HealthCheck.Retries,
+			}
+		}
+
+		sidecarId, err := dockerClient.ContainerCreate(sidecarConfig, engine.PrintProgress(os.Stderr))
+		if err != nil {
+			sidecarLog.Crit("docker create", "Image", sidecar.Image, "Error", err)
+			return
+		}
+
+		err = dockerClient.ContainerStart(sidecarId)
+		if err != nil {
+			sidecarLog.Crit("docker start", "ContainerId", sidecarId, "Error", err)
+			return
+		}
+
+		sidecarLog.Info("Started sidecar", "ContainerId", sidecarId)
+		sidecarIds[sidecar.Name] = sidecarId
+	}
+
+	for _, sidecar := range sidecars {
+		if !waitForHealthySidecar(log, dockerClient, container, sidecar.Name, sidecarIds[sidecar.Name]) {
+			return
+		}
+	}
+
+	success = true
+	return
+}
+
+// waitForHealthySidecar waits until docker reports the sidecar healthy. A
+// sidecar without a health check only has to be running
+func waitForHealthySidecar(log log15.Logger, dockerClient *engine.Client,
+	container *conf.Container, sidecarName, sidecarId string) (success bool) {
+
+	var healthCheck *conf.SidecarHealthCheck
+	for _, sidecar := range container.Sidecars {
+		if sidecar.Name == sidecarName {
+			healthCheck = sidecar.HealthCheck
+		}
+	}
+
+	log = log.New("Sidecar", sidecarName, "ContainerId", sidecarId)
+
+	// enough time for every retry to time out
+	timeout := 10 * time.Second
+	if healthCheck != nil {
+		timeout += time.Duration((healthCheck.Interval+healthCheck.Timeout)*(healthCheck.Retries+1)) * time.Second
+	}
+
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(1 * time.Second) {
+
+		inspectOutput, err := dockerClient.ContainerInspect(sidecarId)
+		if err != nil {
+			log.Crit("docker inspect", "Error", err)
+			return
+		}
+
+		if !inspectOutput.State.Running {
+			continue
+		}
+
+		if healthCheck == nil || inspectOutput.State.Health == nil {
+			success = true
+			return
+		}
+
+		switch inspectOutput.State.Health.Status {
+		case "healthy":
+			log.Info("Sidecar is healthy")
+			success = true
+			return
+		case "unhealthy":
+			log.Crit("Sidecar is unhealthy")
+			return
+		}
+	}
+
+	log.Crit("Timed out waiting for sidecar", "Timeout", timeout)
+	return
+}
+
+// cleanSidecars stops and removes the sidecars of containers that aren't
+// active. They're removed before their containers because they share their
+// network namespace
+func cleanSidecars(log log15.Logger, dockerClient *engine.Client,
+	containers []engine.Container, activeContainers map[string]interface{}) (success bool) {
+
+	success = true
+
+	for _, runningContainer := range containers {
+
+		podImageName, isSidecar := runningContainer.Labels[constants.PodLabel]
+		if !isSidecar {
+			continue
+		}
+
+		if _, exists := activeContainers[podImageName]; exists {
+			continue
+		}
+
+		containerId := runningContainer.Id
+
+		log.Info("docker stop "+containerId, "Pod", podImageName)
+		err := dockerClient.ContainerStop(containerId, 10)
+		if err != nil {
+			success = false
+			log.Error("docker stop", "ContainerId", containerId, "Error", err)
+			continue
+		}
+
+		log.Info("docker rm " + containerId)
+		err = dockerClient.ContainerRemove(containerId)
+		if err != nil {
+			success = false
+			log.Error("docker rm", "ContainerId", containerId, "Error", err)
+		}
+	}
+
+	return
+}
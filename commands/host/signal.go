@@ -14,9 +14,13 @@ package host
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"time"
 
+	"github.com/adobe-platform/porter/aws/ec2metadata"
 	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/bootstrap_progress"
 	"github.com/adobe-platform/porter/logger"
 	"github.com/adobe-platform/porter/util"
 	"github.com/aws/aws-sdk-go/aws"
@@ -40,6 +44,7 @@ func (recv *SignalCmd) LongHelp() string {
 
 SYNOPSIS
     signal --hotswap-complete -r <region>
+    signal --progress <milestone> -r <region>
 
 DESCRIPTION
     signal communicates EC2 host signals to other components
@@ -48,6 +53,10 @@ OPTIONS
     --hotswap-complete
         Signal that a hot swap occurred
 
+    --progress
+        Report a bootstrap milestone to the deployer. This never fails so it
+        can't fail a bootstrap
+
     -r  AWS region`
 }
 
@@ -72,6 +81,20 @@ func (recv *SignalCmd) Execute(args []string) bool {
 			flagSet.Parse(args[1:])
 
 			signalQueue(region)
+		case "--progress":
+			if len(args) < 2 {
+				return false
+			}
+
+			var region string
+			flagSet := flag.NewFlagSet("", flag.ExitOnError)
+			flagSet.StringVar(&region, "r", "", "")
+			flagSet.Usage = func() {
+				fmt.Println(recv.LongHelp())
+			}
+			flagSet.Parse(args[2:])
+
+			signalProgress(args[1], "", region)
 		default:
 			return false
 		}
@@ -108,3 +131,40 @@ func signalQueue(regionStr string) {
 
 	log.Info("signaled hotswap complete")
 }
+
+func signalProgress(milestone, reason, regionStr string) {
+
+	log := logger.Host("cmd", "signal", "Milestone", milestone)
+
+	queueUrl := os.Getenv("PROGRESS_QUEUE_URL")
+	if queueUrl == "" {
+		log.Warn("PROGRESS_QUEUE_URL isn't set")
+		return
+	}
+
+	instanceIdResp, err := ec2metadata.Get("/instance-id")
+	if err != nil {
+		log.Warn("instance-id", "Error", err)
+		return
+	}
+	defer instanceIdResp.Body.Close()
+
+	instanceId, err := ioutil.ReadAll(instanceIdResp.Body)
+	if err != nil {
+		log.Warn("ioutil.ReadAll", "Error", err)
+		return
+	}
+
+	sqsClient := sqs.New(aws_session.Get(regionStr))
+
+	message := bootstrap_progress.Message{
+		InstanceId: string(instanceId),
+		Milestone:  milestone,
+		Time:       time.Now(),
+		Reason:     reason,
+	}
+
+	if bootstrap_progress.Send(log, sqsClient, queueUrl, message) {
+		log.Info("signaled bootstrap progress")
+	}
+}
@@ -15,20 +15,26 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
 
 	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/bootstrap_progress"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/daemon/wait_handle"
 	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/provision_state"
 	"github.com/adobe-platform/porter/util"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/inconshreveable/log15"
 	"github.com/phylake/go-cli"
 )
 
@@ -47,18 +53,35 @@ func (recv *SvcPayloadCmd) LongHelp() string {
     svc-payload -- download/verify service payload
 
 SYNOPSIS
-    svc-payload --get -b <bucket> -k <key> -s <sum> -l <path> -r <region>
+    svc-payload --get -b <bucket> -k <key> -s <sum> [-mk <key>] -l <path> -r <region>
+    svc-payload --get -u <url> -s <sum> [-mu <url>] -l <path> -r <region>
 
 DESCRIPTION
     svc-payload downloads and verifies the integrity of the service payload
 
+    The payload must match the SHA256 provision computed when it uploaded it. A
+    mismatched download is removed and retried. If it never matches the host
+    reports payload-invalid and signals the wait condition with FAILURE
+
+    With a deployment manifest the payload must also be the one provision
+    recorded for this host's stack. Otherwise the host reports payload-invalid
+    and signals the wait condition with FAILURE before anything is downloaded
+    so containers are never started from the wrong build
+
 OPTIONS
     -b  S3 Bucket
 
     -k  S3 Key
 
+    -u  URL to download from instead of S3 when the artifact store isn't S3
+
     -s  SHA256 to verify
 
+    -mk S3 key in the bucket of the stack's deployment manifest
+
+    -mu URL of the stack's deployment manifest when the artifact store isn't
+        S3
+
     -l  Location on the filesystem to download to
 
     -r  AWS region`
@@ -76,11 +99,15 @@ func (recv *SvcPayloadCmd) Execute(args []string) bool {
 			log := logger.Host("cmd", "svc-payload")
 
 			var err error
-			var bucketFlag, locationFlag, keyFlag, sumFlag, regionFlag string
+			var bucketFlag, locationFlag, keyFlag, sumFlag, regionFlag, urlFlag string
+			var manifestKeyFlag, manifestUrlFlag string
 			flagSet := flag.NewFlagSet("", flag.ExitOnError)
 			flagSet.StringVar(&bucketFlag, "b", "", "")
 			flagSet.StringVar(&keyFlag, "k", "", "")
+			flagSet.StringVar(&urlFlag, "u", "", "")
 			flagSet.StringVar(&sumFlag, "s", "", "")
+			flagSet.StringVar(&manifestKeyFlag, "mk", "", "")
+			flagSet.StringVar(&manifestUrlFlag, "mu", "", "")
 			flagSet.StringVar(&regionFlag, "r", "", "")
 			flagSet.StringVar(&locationFlag, "l", "", "")
 			flagSet.Usage = func() {
@@ -89,7 +116,8 @@ func (recv *SvcPayloadCmd) Execute(args []string) bool {
 			flagSet.Parse(args[1:])
 
 			if len(sumFlag) != 64 {
-				return false
+				log.Crit("-s must be a hex encoded SHA256", "Checksum", sumFlag)
+				os.Exit(1)
 			}
 
 			expectedChecksum, err := hex.DecodeString(sumFlag)
@@ -98,11 +126,39 @@ func (recv *SvcPayloadCmd) Execute(args []string) bool {
 				os.Exit(1)
 			}
 
-			exec.Command("mkdir", "-p", filepath.Dir(locationFlag)).Run()
+			if manifestKeyFlag != "" || manifestUrlFlag != "" {
 
-			if _, err = os.Stat(locationFlag); err == nil {
-				log.Info("service payload exists")
-				os.Exit(0)
+				reason := verifyDeploymentManifest(log, bucketFlag, manifestKeyFlag, manifestUrlFlag,
+					keyFlag, sumFlag, regionFlag)
+				if reason != "" {
+					log.Crit("Refusing to install the service payload", "Reason", reason)
+					signalProgress(bootstrap_progress.PayloadInvalid, reason, regionFlag)
+					wait_handle.Fail(reason)
+					os.Exit(1)
+				}
+			}
+
+			err = os.MkdirAll(filepath.Dir(locationFlag), 0755)
+			if err != nil {
+				log.Crit("os.MkdirAll", "Error", err)
+				os.Exit(1)
+			}
+
+			// a payload left by an earlier attempt is only trusted if it's
+			// the one provision uploaded
+			if payloadFile, err := os.Open(locationFlag); err == nil {
+				actualChecksum, err := fileChecksum(payloadFile)
+				payloadFile.Close()
+
+				if err == nil && bytes.Equal(actualChecksum, expectedChecksum) {
+					log.Info("service payload exists")
+					os.Exit(0)
+				}
+
+				log.Warn("Existing service payload doesn't match. Downloading it again",
+					"Expected", sumFlag,
+					"Actual", hex.EncodeToString(actualChecksum),
+					"Error", err)
 			}
 
 			log.Info("downloading/verifying service payload")
@@ -115,7 +171,7 @@ func (recv *SvcPayloadCmd) Execute(args []string) bool {
 				Key:    aws.String(keyFlag),
 			}
 
-			var payloadFile *os.File
+			var mismatch string
 
 			retryMsg := func(i int) { log.Warn("Service payload download retrying", "Count", i) }
 			if !util.SuccessRetryer(7, retryMsg, func() bool {
@@ -124,7 +180,7 @@ func (recv *SvcPayloadCmd) Execute(args []string) bool {
 				// content in this file
 				//
 				// create it every time
-				payloadFile, err = os.Create(locationFlag)
+				payloadFile, err := os.Create(locationFlag)
 
 				// an error here is likely permissions related and not worth
 				// retrying
@@ -132,50 +188,159 @@ func (recv *SvcPayloadCmd) Execute(args []string) bool {
 					log.Crit("os.Create", "Error", err)
 					os.Exit(1)
 				}
+				defer payloadFile.Close()
 
-				_, err = s3Client.Download(payloadFile, getObjectInput)
+				if urlFlag != "" {
+					err = downloadURL(urlFlag, payloadFile)
+				} else {
+					_, err = s3Client.Download(payloadFile, getObjectInput)
+				}
 				if err != nil {
+					log.Error("Service payload download", "Error", err)
+					return false
+				}
 
-					payloadFile.Close()
+				actualChecksum, err := fileChecksum(payloadFile)
+				if err != nil {
+					log.Error("Service payload checksum", "Error", err)
+					return false
+				}
 
-					log.Error("S3 download", "Error", err)
+				// an overwritten or stale object is retried in case it's
+				// S3 eventual consistency. The file is removed so a later
+				// run can't mistake it for the verified payload
+				if !bytes.Equal(actualChecksum, expectedChecksum) {
+					mismatch = fmt.Sprintf("service payload checksum %s doesn't match %s",
+						hex.EncodeToString(actualChecksum), sumFlag)
+					log.Error("Checksums don't match",
+						"Expected", sumFlag,
+						"Actual", hex.EncodeToString(actualChecksum))
+					os.Remove(locationFlag)
 					return false
 				}
 
+				mismatch = ""
 				return true
 			}) {
 				log.Crit("Failed to download service payload")
-				os.Exit(1)
-			}
-			defer payloadFile.Close()
 
-			_, err = payloadFile.Seek(0, 0)
-			if err != nil {
-				log.Crit("file.Seek", "Error", err)
+				if mismatch != "" {
+					signalProgress(bootstrap_progress.PayloadInvalid, mismatch, regionFlag)
+					wait_handle.Fail(mismatch)
+				}
 				os.Exit(1)
 			}
 
-			payloadBytes, err := ioutil.ReadAll(payloadFile)
-			if err != nil {
-				log.Crit("ioutil.ReadAll", "Error", err)
-				os.Exit(1)
-			}
+		default:
+			return false
+		}
+		return true
+	}
 
-			actualChecksumArray := sha256.Sum256(payloadBytes)
-			actualChecksum := actualChecksumArray[:]
+	return false
+}
 
-			if !bytes.Equal(actualChecksum, expectedChecksum) {
-				log.Crit("Checksums don't match",
-					"Expected", sumFlag,
-					"Actual", hex.EncodeToString(actualChecksum))
-				os.Exit(1)
+// verifyDeploymentManifest returns why the payload isn't the one provision
+// recorded for this host's stack, or an empty string if it is. The stack name
+// is the one in the stack's parameters
+func verifyDeploymentManifest(log log15.Logger, bucket, manifestKey, manifestUrl,
+	payloadKey, checksum, region string) (reason string) {
+
+	var manifestBytes []byte
+
+	retryMsg := func(i int) { log.Warn("Deployment manifest download retrying", "Count", i) }
+	if !util.SuccessRetryer(7, retryMsg, func() bool {
+
+		var buf bytes.Buffer
+		var err error
+
+		if manifestUrl != "" {
+			err = downloadURL(manifestUrl, &buf)
+		} else {
+			var getObjectOutput *s3.GetObjectOutput
+			getObjectOutput, err = s3.New(aws_session.Get(region)).GetObject(&s3.GetObjectInput{
+				Bucket: aws.String(bucket),
+				Key:    aws.String(manifestKey),
+			})
+			if err == nil {
+				_, err = io.Copy(&buf, getObjectOutput.Body)
+				getObjectOutput.Body.Close()
 			}
-
-		default:
+		}
+		if err != nil {
+			log.Error("Deployment manifest download", "Error", err)
 			return false
 		}
+
+		manifestBytes = buf.Bytes()
 		return true
+	}) {
+		reason = "the deployment manifest couldn't be downloaded"
+		return
 	}
 
-	return false
+	manifest := &provision_state.DeploymentManifest{}
+	err := json.Unmarshal(manifestBytes, manifest)
+	if err != nil {
+		reason = fmt.Sprintf("the deployment manifest is invalid: %s", err)
+		return
+	}
+
+	// hosts given a URL don't know the key it maps to
+	if manifestUrl != "" {
+		payloadKey = ""
+	}
+
+	err = manifest.Verify(os.Getenv(constants.EnvDeploymentId), payloadKey, checksum)
+	if err != nil {
+		reason = err.Error()
+		return
+	}
+
+	log.Info("Service payload matches the deployment manifest",
+		"StackName", manifest.StackName,
+		"ServiceVersion", manifest.ServiceVersion)
+	return
+}
+
+// fileChecksum is the SHA256 of a file from its beginning
+func fileChecksum(file *os.File) ([]byte, error) {
+	_, err := file.Seek(0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
+
+// downloadURL downloads the payload from an artifact store that isn't S3
+func downloadURL(url string, w io.Writer) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	// asking for gzip stops the payload, which is stored with
+	// Content-Encoding: gzip, from being decompressed in transit so its
+	// checksum matches
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", url, res.Status)
+	}
+
+	_, err = io.Copy(w, res.Body)
+	return err
 }
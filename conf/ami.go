@@ -0,0 +1,143 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/adobe-platform/porter/constants"
+)
+
+var amiOwnerRegex = regexp.MustCompile(`^([0-9]{12}|self|amazon|aws-marketplace)$`)
+
+func (recv *AMI) setDefaults() {
+	if recv.SSMParameter == "" && !recv.Baked && len(recv.Owners) == 0 {
+		recv.Owners = []string{"self"}
+	}
+}
+
+func (recv *AMI) print(indent string) {
+	fmt.Println(indent+".AMI.SSMParameter", recv.SSMParameter)
+	fmt.Println(indent+".AMI.Owners", recv.Owners)
+	fmt.Println(indent+".AMI.Name", recv.Name)
+
+	var tags []string
+	for key, value := range recv.Tags {
+		tags = append(tags, key+"="+value)
+	}
+	sort.Strings(tags)
+	fmt.Println(indent+".AMI.Tags", tags)
+
+	fmt.Println(indent+".AMI.Baked", recv.Baked)
+	fmt.Println(indent+".AMI.Pin", recv.Pin)
+}
+
+// ValidateAMI checks the ami block resolves to exactly one kind of lookup and
+// that every instance it's used for has the same architecture
+func (recv *Environment) ValidateAMI() error {
+	ami := recv.AMI
+	if ami == nil {
+		return nil
+	}
+
+	if recv.Compute == Compute_ECS {
+		return errors.New("ami isn't supported with compute: ecs")
+	}
+
+	filtered := ami.Name != "" || len(ami.Tags) > 0
+
+	if ami.Baked {
+		if ami.SSMParameter != "" || filtered || len(ami.Owners) > 0 {
+			return errors.New("ami baked can't be defined with ssm_parameter, owners, name, or tags")
+		}
+
+		if recv.Bake == nil {
+			return errors.New("ami baked needs a bake block")
+		}
+	} else if ami.SSMParameter != "" && filtered {
+		return errors.New("ami ssm_parameter can't be defined with name or tags")
+	}
+
+	if ami.SSMParameter == "" && !filtered && !ami.Baked {
+		return errors.New("ami needs an ssm_parameter, baked, or a name or tags to filter images by")
+	}
+
+	if ami.SSMParameter != "" {
+		if !strings.HasPrefix(ami.SSMParameter, "/") {
+			return errors.New("ami ssm_parameter must be a path like /aws/service/ami-amazon-linux-latest/al2023-ami-kernel-default-x86_64")
+		}
+
+		if len(ami.Owners) > 0 {
+			return errors.New("ami owners can't be defined with ssm_parameter")
+		}
+	}
+
+	for _, owner := range ami.Owners {
+		if !amiOwnerRegex.MatchString(owner) {
+			return errors.New("ami has an invalid owner " + owner + ". Valid values are an account id, self, amazon, or aws-marketplace")
+		}
+	}
+
+	// one image id is used for every instance in a region
+	for _, region := range recv.Regions {
+		if len(recv.RegionArchitectures(region)) > 1 {
+			return fmt.Errorf("ami requires every instance in region %s to have the same architecture", region.Name)
+		}
+	}
+
+	return nil
+}
+
+// ValidateBake checks the builder instance can make an image every instance
+// of a region can launch
+func (recv *Environment) ValidateBake() error {
+	bake := recv.Bake
+	if bake == nil {
+		return nil
+	}
+
+	if recv.Compute == Compute_ECS {
+		return errors.New("bake isn't supported with compute: ecs")
+	}
+
+	if bake.Timeout < 0 {
+		return errors.New("bake timeout must be positive")
+	}
+
+	if bake.InstanceType != "" {
+		if _, exists := constants.AwsInstanceTypes[bake.InstanceType]; !exists {
+			return errors.New("Invalid bake instance_type " + bake.InstanceType)
+		}
+	}
+
+	for _, region := range recv.Regions {
+		architectures := recv.RegionArchitectures(region)
+		if len(architectures) > 1 {
+			return fmt.Errorf("bake requires every instance in region %s to have the same architecture", region.Name)
+		}
+
+		if bake.InstanceType != "" && InstanceArchitecture(bake.InstanceType) != architectures[0] {
+			return fmt.Errorf("bake instance_type %s isn't %s like the instances in region %s",
+				bake.InstanceType, architectures[0], region.Name)
+		}
+
+		if bake.Images && region.S3Bucket == "" {
+			return fmt.Errorf("bake images needs an s3_bucket in region %s to stage the service payload", region.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"runtime"
+	"sort"
+
+	"github.com/adobe-platform/porter/constants"
+)
+
+// Architectures of instances and images as docker names them
+const (
+	Architecture_AMD64 = "amd64"
+	Architecture_ARM64 = "arm64"
+)
+
+// Graviton families have a g after their generation like t4g, m6gd, and c7gn.
+// a1 was the first
+var arm64InstanceTypeRegex = regexp.MustCompile(`^([a-z]+[0-9]+[a-z]*g[a-z]*|a1)\.`)
+
+// InstanceArchitecture is the CPU architecture of an instance type
+func InstanceArchitecture(instanceType string) string {
+	if arm64InstanceTypeRegex.MatchString(instanceType) {
+		return Architecture_ARM64
+	}
+	return Architecture_AMD64
+}
+
+// HostArchitecture is the architecture of the instance the porter binary is
+// running on. The x86 binary is 32-bit
+func HostArchitecture() string {
+	if runtime.GOARCH == "arm64" {
+		return Architecture_ARM64
+	}
+	return Architecture_AMD64
+}
+
+// ImageFileSuffix is what's between an image's name and .docker in the
+// service payload. x86 images keep the name they've always had
+func ImageFileSuffix(architecture string) string {
+	if architecture == Architecture_AMD64 {
+		return ""
+	}
+	return "." + architecture
+}
+
+// GetInstanceType is the region's instance_type or the environment's if the
+// region doesn't have one
+func (recv *Environment) GetInstanceType(regionName string) (string, error) {
+	region, err := recv.GetRegion(regionName)
+	if err != nil {
+		return "", err
+	}
+
+	if region.InstanceType != "" {
+		return region.InstanceType, nil
+	}
+
+	return recv.InstanceType, nil
+}
+
+// RegionArchitectures are the architectures of the region's instances in
+// sorted order
+func (recv *Environment) RegionArchitectures(region *Region) []string {
+	instanceTypes := make([]string, 0)
+	if len(recv.InstanceGroups) == 0 {
+		if region.InstanceType != "" {
+			instanceTypes = append(instanceTypes, region.InstanceType)
+		} else {
+			instanceTypes = append(instanceTypes, recv.InstanceType)
+		}
+	}
+	for _, group := range recv.InstanceGroups {
+		instanceTypes = append(instanceTypes, group.InstanceType)
+	}
+
+	return instanceArchitectures(instanceTypes)
+}
+
+// Architectures are every architecture the images are built for
+func (recv *Config) Architectures() []string {
+	seen := make(map[string]struct{})
+	architectures := make([]string, 0)
+
+	for _, environment := range recv.Environments {
+		for _, region := range environment.Regions {
+			for _, architecture := range environment.RegionArchitectures(region) {
+				if _, exists := seen[architecture]; !exists {
+					seen[architecture] = struct{}{}
+					architectures = append(architectures, architecture)
+				}
+			}
+		}
+	}
+
+	sort.Strings(architectures)
+	return architectures
+}
+
+func instanceArchitectures(instanceTypes []string) []string {
+	seen := make(map[string]struct{})
+	architectures := make([]string, 0)
+
+	for _, instanceType := range instanceTypes {
+		architecture := InstanceArchitecture(instanceType)
+		if _, exists := seen[architecture]; !exists {
+			seen[architecture] = struct{}{}
+			architectures = append(architectures, architecture)
+		}
+	}
+
+	sort.Strings(architectures)
+	return architectures
+}
+
+// HasArchitecture is true if the image was built for the architecture.
+// Payloads from before architectures were recorded are x86
+func (recv *Container) HasArchitecture(architecture string) bool {
+	if len(recv.Architectures) == 0 {
+		return architecture == Architecture_AMD64
+	}
+
+	for _, builtFor := range recv.Architectures {
+		if builtFor == architecture {
+			return true
+		}
+	}
+	return false
+}
+
+// UseArchitecture points ImageDigest at the image pushed for the
+// architecture. It's unchanged for images pushed for one architecture
+func (recv *Container) UseArchitecture(architecture string) {
+	if digest, exists := recv.ImageDigests[architecture]; exists {
+		recv.ImageDigest = digest
+	}
+}
+
+func (recv *Environment) ValidateArchitectures() error {
+	for _, region := range recv.Regions {
+		if region.InstanceType == "" {
+			continue
+		}
+
+		if _, exists := constants.AwsInstanceTypes[region.InstanceType]; !exists {
+			return errors.New("Invalid instance_type for region " + region.Name)
+		}
+
+		if len(recv.InstanceGroups) > 0 {
+			return errors.New("instance_type can't be defined in region " + region.Name +
+				" with instance_groups. Define it on the instance groups")
+		}
+
+		if recv.Compute == Compute_ECS {
+			return errors.New("region instance_type isn't supported with compute: ecs")
+		}
+	}
+
+	if recv.MixedInstances == nil {
+		return nil
+	}
+
+	// a launch template has one AMI
+	for _, region := range recv.Regions {
+		architectures := recv.RegionArchitectures(region)
+		if len(architectures) > 1 {
+			return fmt.Errorf("mixed_instances requires every instance in region %s to have the same architecture", region.Name)
+		}
+
+		for _, instanceType := range recv.MixedInstances.InstanceTypes {
+			if InstanceArchitecture(instanceType) != architectures[0] {
+				return fmt.Errorf("mixed_instances instance_type %s isn't %s like the instances in region %s",
+					instanceType, architectures[0], region.Name)
+			}
+		}
+	}
+
+	return nil
+}
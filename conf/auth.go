@@ -0,0 +1,66 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adobe-platform/porter/aws/rolesanywhere"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/inconshreveable/log15"
+)
+
+// useAuth points every AWS session at the credentials of the auth section.
+// certificate and private_key can reference environment variables so CI can
+// put them wherever its secrets go
+func (recv *Config) useAuth(log log15.Logger) (success bool) {
+	if recv.Auth == nil || recv.Auth.RolesAnywhere == nil {
+		success = true
+		return
+	}
+	rolesAnywhere := recv.Auth.RolesAnywhere
+
+	provider, err := rolesanywhere.NewProvider(
+		os.ExpandEnv(rolesAnywhere.Certificate),
+		os.ExpandEnv(rolesAnywhere.PrivateKey))
+	if err != nil {
+		log.Error("Failed to read the auth roles_anywhere certificate", "Error", err)
+		return
+	}
+
+	provider.TrustAnchorARN = rolesAnywhere.TrustAnchorARN
+	provider.ProfileARN = rolesAnywhere.ProfileARN
+	provider.RoleARN = rolesAnywhere.RoleARN
+	provider.ExpiryWindow = 5 * time.Minute
+
+	provider.Region = rolesAnywhere.Region
+	if provider.Region == "" {
+		if arnParts := strings.Split(rolesAnywhere.TrustAnchorARN, ":"); len(arnParts) > 3 {
+			provider.Region = arnParts[3]
+		}
+	}
+
+	sessionDuration := rolesAnywhere.SessionDuration
+	if sessionDuration == 0 {
+		sessionDuration = constants.RolesAnywhereDefaultSessionDuration
+	}
+	provider.Duration = time.Duration(sessionDuration) * time.Second
+
+	aws_session.UseCredentials(provider)
+
+	log.Debug("Using IAM Roles Anywhere credentials", "RoleARN", rolesAnywhere.RoleARN)
+	success = true
+	return
+}
@@ -0,0 +1,48 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import (
+	"time"
+
+	"github.com/adobe-platform/porter/aws_session"
+)
+
+// useAWSRetry makes every AWS session retry the way aws_retry says. Fields
+// that aren't set keep porter's defaults
+func (recv *Config) useAWSRetry() {
+	if recv.AWSRetry == nil {
+		return
+	}
+
+	retryer := aws_session.NewRetryer()
+
+	if recv.AWSRetry.MaxAttempts > 0 {
+		retryer.MaxAttempts = recv.AWSRetry.MaxAttempts
+	}
+
+	if recv.AWSRetry.BaseDelayMs > 0 {
+		retryer.BaseDelay = time.Duration(recv.AWSRetry.BaseDelayMs) * time.Millisecond
+	}
+
+	if recv.AWSRetry.MaxDelayMs > 0 {
+		retryer.MaxDelay = time.Duration(recv.AWSRetry.MaxDelayMs) * time.Millisecond
+	}
+
+	if recv.AWSRetry.Adaptive != nil {
+		retryer.Adaptive = *recv.AWSRetry.Adaptive
+	}
+
+	retryer.OperationMaxAttempts = recv.AWSRetry.Operations
+
+	aws_session.UseRetryer(retryer)
+}
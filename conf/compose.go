@@ -0,0 +1,499 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// A compose file is translated into containers for every region that doesn't
+// define its own.
+//
+// Services with a build section are built by pack like any other container.
+// Porter always builds from the repository root so the build context must be
+// the directory .porter is in.
+//
+// Services with only an image become sidecars of the built services that
+// depend on them since they're started on the same hosts and share the
+// container's network namespace.
+type (
+	composeFile struct {
+		Services map[string]*composeService `yaml:"services"`
+	}
+
+	composeService struct {
+		Build       *composeBuild       `yaml:"build"`
+		Image       string              `yaml:"image"`
+		Command     composeCommand      `yaml:"command"`
+		Environment composeEnvironment  `yaml:"environment"`
+		Ports       []composePort       `yaml:"ports"`
+		Volumes     []composeVolume     `yaml:"volumes"`
+		HealthCheck *composeHealthCheck `yaml:"healthcheck"`
+		DependsOn   composeDependsOn    `yaml:"depends_on"`
+		User        string              `yaml:"user"`
+		ReadOnly    *bool               `yaml:"read_only"`
+	}
+
+	composeBuild struct {
+		Context    string `yaml:"context"`
+		Dockerfile string `yaml:"dockerfile"`
+		Target     string `yaml:"target"`
+	}
+
+	composeHealthCheck struct {
+		Test     composeCommand `yaml:"test"`
+		Interval string         `yaml:"interval"`
+		Timeout  string         `yaml:"timeout"`
+		Retries  int            `yaml:"retries"`
+		Disable  bool           `yaml:"disable"`
+	}
+
+	// composeCommand is either a string or a list
+	composeCommand struct {
+		shell bool
+		args  []string
+	}
+
+	// composeEnvironment is either a map or a list of KEY=VALUE
+	composeEnvironment map[string]string
+
+	// composeDependsOn is either a list of services or a map of services to
+	// conditions
+	composeDependsOn []string
+
+	// composePort is either [[ip:]host:]container[/protocol] or the long
+	// syntax. Only the container port matters
+	composePort struct {
+		target int
+	}
+
+	// composeVolume is either source:target[:mode] or the long syntax
+	composeVolume struct {
+		source   string
+		target   string
+		readOnly bool
+	}
+)
+
+func (recv *composeBuild) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var context string
+	if err := unmarshal(&context); err == nil {
+		recv.Context = context
+		return nil
+	}
+
+	type plain composeBuild
+	return unmarshal((*plain)(recv))
+}
+
+func (recv *composeCommand) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var command string
+	if err := unmarshal(&command); err == nil {
+		recv.shell = true
+		recv.args = []string{command}
+		return nil
+	}
+
+	return unmarshal(&recv.args)
+}
+
+func (recv *composeEnvironment) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*recv = make(composeEnvironment)
+
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		for _, kvp := range list {
+			parts := strings.SplitN(kvp, "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("environment variable %s has no value. Values aren't taken from the build box", kvp)
+			}
+			(*recv)[parts[0]] = parts[1]
+		}
+		return nil
+	}
+
+	var vars map[string]interface{}
+	if err := unmarshal(&vars); err != nil {
+		return err
+	}
+
+	for key, value := range vars {
+		if value == nil {
+			return fmt.Errorf("environment variable %s has no value. Values aren't taken from the build box", key)
+		}
+		(*recv)[key] = fmt.Sprint(value)
+	}
+	return nil
+}
+
+func (recv *composeDependsOn) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*recv = list
+		return nil
+	}
+
+	var conditions map[string]interface{}
+	if err := unmarshal(&conditions); err != nil {
+		return err
+	}
+
+	for service := range conditions {
+		*recv = append(*recv, service)
+	}
+	sort.Strings(*recv)
+	return nil
+}
+
+func (recv *composePort) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var long struct {
+		Target int `yaml:"target"`
+	}
+	if err := unmarshal(&long); err == nil {
+		recv.target = long.Target
+		return nil
+	}
+
+	var short string
+	if err := unmarshal(&short); err != nil {
+		return err
+	}
+
+	short = strings.SplitN(short, "/", 2)[0]
+	short = short[strings.LastIndex(short, ":")+1:]
+
+	target, err := strconv.Atoi(short)
+	if err != nil {
+		return fmt.Errorf("unsupported port %s. Port ranges aren't supported", short)
+	}
+
+	recv.target = target
+	return nil
+}
+
+func (recv *composeVolume) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var long struct {
+		Type     string `yaml:"type"`
+		Source   string `yaml:"source"`
+		Target   string `yaml:"target"`
+		ReadOnly bool   `yaml:"read_only"`
+	}
+	if err := unmarshal(&long); err == nil {
+		if long.Type != "" && long.Type != "volume" {
+			return fmt.Errorf("unsupported volume type %s. Only named volumes are supported", long.Type)
+		}
+		recv.source = long.Source
+		recv.target = long.Target
+		recv.readOnly = long.ReadOnly
+		return nil
+	}
+
+	var short string
+	if err := unmarshal(&short); err != nil {
+		return err
+	}
+
+	parts := strings.Split(short, ":")
+	if len(parts) < 2 {
+		return fmt.Errorf("volume %s has no name. Only named volumes are supported", short)
+	}
+
+	recv.source = parts[0]
+	recv.target = parts[1]
+	recv.readOnly = len(parts) > 2 && parts[2] == "ro"
+	return nil
+}
+
+// applyComposeFile gives every region without containers the containers in
+// the compose file
+func (recv *Config) applyComposeFile(log log15.Logger) error {
+
+	composeBytes, err := ioutil.ReadFile(recv.ComposeFile)
+	if err != nil {
+		return err
+	}
+
+	compose := &composeFile{}
+	err = yaml.Unmarshal(composeBytes, compose)
+	if err != nil {
+		return err
+	}
+
+	if len(compose.Services) == 0 {
+		return fmt.Errorf("%s has no services", recv.ComposeFile)
+	}
+
+	compose.warnIgnored(log)
+
+	for _, env := range recv.Environments {
+		for _, region := range env.Regions {
+
+			if len(region.Containers) > 0 {
+				continue
+			}
+
+			// each region gets its own containers because defaults and pack
+			// change them per region
+			region.Containers, err = compose.containers()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (recv *composeFile) containers() ([]*Container, error) {
+
+	serviceNames := make([]string, 0, len(recv.Services))
+	for serviceName := range recv.Services {
+		serviceNames = append(serviceNames, serviceName)
+	}
+	sort.Strings(serviceNames)
+
+	containers := make([]*Container, 0)
+	sidecars := make(map[string]*Sidecar)
+
+	for _, serviceName := range serviceNames {
+		service := recv.Services[serviceName]
+
+		uid, err := service.uid(serviceName)
+		if err != nil {
+			return nil, err
+		}
+
+		volumes := make([]*Volume, 0, len(service.Volumes))
+		for _, volume := range service.Volumes {
+			if volume.source == "" || strings.ContainsAny(volume.source[:1], "./~") {
+				return nil, fmt.Errorf("service %s mounts %s. Only named volumes are supported",
+					serviceName, volume.source)
+			}
+
+			volumes = append(volumes, &Volume{
+				Name:     volume.source,
+				Path:     volume.target,
+				ReadOnly: volume.readOnly,
+			})
+		}
+
+		if service.Build == nil {
+
+			if service.Image == "" {
+				return nil, fmt.Errorf("service %s has neither a build nor an image", serviceName)
+			}
+
+			sidecar := &Sidecar{
+				Name:        serviceName,
+				Image:       service.Image,
+				Command:     service.Command.argv(),
+				Environment: service.Environment,
+				DependsOn:   service.DependsOn,
+				Uid:         uid,
+				ReadOnly:    service.ReadOnly,
+				Volumes:     volumes,
+			}
+
+			sidecar.HealthCheck, err = service.HealthCheck.sidecarHealthCheck(serviceName)
+			if err != nil {
+				return nil, err
+			}
+
+			sidecars[serviceName] = sidecar
+			continue
+		}
+
+		if service.Build.Context != "" && path.Clean(service.Build.Context) != "." {
+			return nil, fmt.Errorf("service %s builds from %s. Porter builds from the repository root",
+				serviceName, service.Build.Context)
+		}
+
+		container := &Container{
+			Name:        serviceName,
+			Dockerfile:  service.Build.Dockerfile,
+			BuildTarget: service.Build.Target,
+			Uid:         uid,
+			ReadOnly:    service.ReadOnly,
+			Volumes:     volumes,
+			Environment: service.Environment,
+			Command:     service.Command.argv(),
+		}
+
+		switch len(service.Ports) {
+		case 0:
+		case 1:
+			container.Topology = Topology_Inet
+			container.InetPort = service.Ports[0].target
+		default:
+			return nil, fmt.Errorf("service %s exposes more than one port", serviceName)
+		}
+
+		containers = append(containers, container)
+	}
+
+	for _, sidecar := range sidecars {
+		for _, dependency := range sidecar.DependsOn {
+			if _, exists := sidecars[dependency]; !exists {
+				return nil, fmt.Errorf("service %s depends on %s. Services with just an image can only depend on each other",
+					sidecar.Name, dependency)
+			}
+		}
+	}
+
+	attached := make(map[string]interface{})
+
+	for _, container := range containers {
+		for _, dependency := range recv.Services[container.Name].DependsOn {
+			if _, exists := sidecars[dependency]; !exists {
+				return nil, fmt.Errorf("service %s depends on %s. Built services can only depend on services with just an image",
+					container.Name, dependency)
+			}
+
+			attachComposeSidecar(container, sidecars, dependency, attached)
+		}
+	}
+
+	for sidecarName := range sidecars {
+		if _, exists := attached[sidecarName]; !exists {
+			return nil, fmt.Errorf("no built service depends on service %s", sidecarName)
+		}
+	}
+
+	return containers, nil
+}
+
+// warnIgnored warns about the compose keys of built services that have no
+// equivalent
+func (recv *composeFile) warnIgnored(log log15.Logger) {
+	serviceNames := make([]string, 0, len(recv.Services))
+	for serviceName := range recv.Services {
+		serviceNames = append(serviceNames, serviceName)
+	}
+	sort.Strings(serviceNames)
+
+	for _, serviceName := range serviceNames {
+		service := recv.Services[serviceName]
+		if service.Build == nil || service.HealthCheck == nil || service.HealthCheck.Disable {
+			continue
+		}
+
+		log.Warn("The healthcheck of a built service is ignored. Containers are health checked over HTTP with health_check",
+			"Service", serviceName)
+	}
+}
+
+// attachComposeSidecar adds a sidecar and the sidecars it depends on to the
+// container
+func attachComposeSidecar(container *Container, sidecars map[string]*Sidecar,
+	sidecarName string, attached map[string]interface{}) {
+
+	for _, existing := range container.Sidecars {
+		if existing.Name == sidecarName {
+			return
+		}
+	}
+
+	// containers sharing a sidecar each get their own copy
+	sidecarCopy := *sidecars[sidecarName]
+	container.Sidecars = append(container.Sidecars, &sidecarCopy)
+	attached[sidecarName] = nil
+
+	for _, dependency := range sidecarCopy.DependsOn {
+		attachComposeSidecar(container, sidecars, dependency, attached)
+	}
+}
+
+func (recv *composeService) uid(serviceName string) (*int, error) {
+	if recv.User == "" {
+		return nil, nil
+	}
+
+	uid, err := strconv.Atoi(strings.SplitN(recv.User, ":", 2)[0])
+	if err != nil {
+		return nil, fmt.Errorf("service %s has user %s. Only numeric uids are supported", serviceName, recv.User)
+	}
+
+	return &uid, nil
+}
+
+// argv splits a string command on whitespace like compose does for commands
+// without quoting
+func (recv composeCommand) argv() []string {
+	if recv.shell {
+		return strings.Fields(recv.args[0])
+	}
+	return recv.args
+}
+
+// sidecarHealthCheck translates a compose health check. Built services are
+// health checked over HTTP with health_check instead
+func (recv *composeHealthCheck) sidecarHealthCheck(serviceName string) (*SidecarHealthCheck, error) {
+	if recv == nil || recv.Disable {
+		return nil, nil
+	}
+
+	healthCheck := &SidecarHealthCheck{
+		Retries: recv.Retries,
+	}
+
+	test := recv.Test.args
+	switch {
+	case recv.Test.shell:
+		healthCheck.Command = append([]string{"sh", "-c"}, test...)
+	case len(test) == 0 || test[0] == "NONE":
+		return nil, nil
+	case test[0] == "CMD":
+		healthCheck.Command = test[1:]
+	case test[0] == "CMD-SHELL":
+		healthCheck.Command = append([]string{"sh", "-c"}, test[1:]...)
+	default:
+		return nil, fmt.Errorf("the healthcheck test on service %s must start with CMD or CMD-SHELL", serviceName)
+	}
+
+	var err error
+
+	healthCheck.Interval, err = composeSeconds(recv.Interval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid healthcheck interval on service %s", serviceName)
+	}
+
+	healthCheck.Timeout, err = composeSeconds(recv.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid healthcheck timeout on service %s", serviceName)
+	}
+
+	return healthCheck, nil
+}
+
+// composeSeconds rounds a compose duration like 1m30s up to seconds. Zero
+// leaves the default in place
+func composeSeconds(duration string) (int, error) {
+	if duration == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return 0, err
+	}
+
+	return int((d + time.Second - 1) / time.Second), nil
+}
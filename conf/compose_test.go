@@ -0,0 +1,154 @@
+package conf_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/inconshreveable/log15"
+)
+
+var _ = Describe("compose_file", func() {
+
+	const porterConfig = `
+service_name: svc
+compose_file: docker-compose.yml
+environments:
+- name: prod
+  regions:
+  - name: us-west-2
+`
+
+	var (
+		workingDir string
+		projectDir string
+		warnings   []string
+		log        log15.Logger
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		workingDir, err = os.Getwd()
+		Expect(err).ToNot(HaveOccurred())
+
+		projectDir, err = ioutil.TempDir("", "porter-compose")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(os.MkdirAll(filepath.Join(projectDir, filepath.Dir(constants.ConfigPath)), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(projectDir, constants.ConfigPath), []byte(porterConfig), 0644)).To(Succeed())
+		Expect(os.Chdir(projectDir)).To(Succeed())
+
+		warnings = nil
+		log = log15.New()
+		log.SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+			if r.Lvl == log15.LvlWarn {
+				warnings = append(warnings, r.Msg)
+			}
+			return nil
+		}))
+	})
+
+	AfterEach(func() {
+		Expect(os.Chdir(workingDir)).To(Succeed())
+		Expect(os.RemoveAll(projectDir)).To(Succeed())
+	})
+
+	// the containers of the only region after the compose file is applied
+	containers := func(compose string) []*conf.Container {
+		Expect(ioutil.WriteFile(filepath.Join(projectDir, "docker-compose.yml"), []byte(compose), 0644)).To(Succeed())
+
+		config, success := conf.GetConfig(log, false)
+		Expect(success).To(BeTrue())
+
+		return config.Environments[0].Regions[0].Containers
+	}
+
+	It("maps the command of built services and sidecars", func() {
+		containers := containers(`
+services:
+  app:
+    build: .
+    command: ./server --port 8080
+    ports:
+    - "8080:8080"
+    depends_on:
+    - cache
+  cache:
+    image: redis:5
+    command: ["redis-server", "--save", ""]
+`)
+
+		Expect(containers).To(HaveLen(1))
+		Expect(containers[0].Command).To(Equal([]string{"./server", "--port", "8080"}))
+		Expect(containers[0].Sidecars).To(HaveLen(1))
+		Expect(containers[0].Sidecars[0].Command).To(Equal([]string{"redis-server", "--save", ""}))
+	})
+
+	It("keeps the image's command when there's none", func() {
+		containers := containers(`
+services:
+  app:
+    build: .
+`)
+
+		Expect(containers[0].Command).To(BeNil())
+	})
+
+	It("maps the healthcheck of sidecars", func() {
+		containers := containers(`
+services:
+  app:
+    build: .
+    depends_on:
+    - cache
+  cache:
+    image: redis:5
+    healthcheck:
+      test: ["CMD", "redis-cli", "ping"]
+      interval: 1m30s
+      timeout: 5s
+      retries: 2
+`)
+
+		Expect(containers[0].Sidecars[0].HealthCheck).To(Equal(&conf.SidecarHealthCheck{
+			Command:  []string{"redis-cli", "ping"},
+			Interval: 90,
+			Timeout:  5,
+			Retries:  2,
+		}))
+		Expect(warnings).To(BeEmpty())
+	})
+
+	It("warns that the healthcheck of a built service is ignored", func() {
+		containers := containers(`
+services:
+  app:
+    build: .
+    ports:
+    - "8080:8080"
+    healthcheck:
+      test: ["CMD", "curl", "-f", "http://localhost:8080/ready"]
+`)
+
+		Expect(containers[0].HealthCheck).To(Equal(&conf.HealthCheck{Method: "GET", Path: "/health"}))
+		Expect(warnings).To(ConsistOf(ContainSubstring("healthcheck of a built service is ignored")))
+	})
+
+	It("doesn't warn about a disabled healthcheck", func() {
+		containers(`
+services:
+  app:
+    build: .
+    healthcheck:
+      disable: true
+`)
+
+		Expect(warnings).To(BeEmpty())
+	})
+})
@@ -0,0 +1,135 @@
+package conf_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/conf"
+)
+
+var _ = Describe("ValidateCompute", func() {
+
+	// a valid compute: ecs environment for each entry to change
+	ecsEnvironment := func() *conf.Environment {
+		return &conf.Environment{
+			Name:    "prod",
+			Compute: conf.Compute_ECS,
+			ECS: &conf.ECS{
+				LaunchType: conf.LaunchType_Fargate,
+				Cpu:        256,
+				Memory:     512,
+			},
+			Regions: []*conf.Region{
+				{
+					Name:  "us-west-2",
+					VpcId: "vpc-1",
+					Containers: []*conf.Container{
+						{
+							Name:     "web",
+							Topology: conf.Topology_Inet,
+							InetPort: 8080,
+						},
+					},
+				},
+			},
+		}
+	}
+
+	DescribeTable("compute: ecs",
+		func(mutate func(*conf.Environment), registryDeployment bool, errorMatcher OmegaMatcher) {
+			environment := ecsEnvironment()
+			mutate(environment)
+
+			Expect(environment.ValidateCompute(registryDeployment)).To(errorMatcher)
+		},
+
+		Entry("accepts a minimal environment",
+			func(env *conf.Environment) {},
+			true, Succeed()),
+
+		Entry("requires a registry",
+			func(env *conf.Environment) {},
+			false, MatchError(ContainSubstring("requires ecr"))),
+
+		Entry("rejects an unknown compute",
+			func(env *conf.Environment) { env.Compute = "lambda" },
+			true, MatchError(ContainSubstring("Invalid compute"))),
+
+		Entry("rejects an unknown launch_type",
+			func(env *conf.Environment) { env.ECS.LaunchType = "EXTERNAL" },
+			true, MatchError(ContainSubstring("Invalid ecs launch_type"))),
+
+		Entry("requires a cluster with launch_type EC2",
+			func(env *conf.Environment) { env.ECS.LaunchType = conf.LaunchType_EC2 },
+			true, MatchError(ContainSubstring("cluster is required"))),
+
+		Entry("accepts src_env_file",
+			func(env *conf.Environment) {
+				env.Regions[0].Containers[0].SrcEnvFile = &conf.SrcEnvFile{ExecName: "get-secrets"}
+			},
+			true, Succeed()),
+
+		Entry("accepts secrets_mount",
+			func(env *conf.Environment) {
+				env.Regions[0].Containers[0].SrcEnvFile = &conf.SrcEnvFile{ExecName: "get-secrets"}
+				env.Regions[0].Containers[0].SecretsMount = &conf.SecretsMount{Path: "/run/secrets", Mode: "0400"}
+			},
+			true, Succeed()),
+
+		Entry("rejects secrets_mount reload_signal",
+			func(env *conf.Environment) {
+				env.Regions[0].Containers[0].SecretsMount = &conf.SecretsMount{
+					Path:         "/run/secrets",
+					Mode:         "0400",
+					ReloadSignal: "SIGHUP",
+				}
+			},
+			true, MatchError(ContainSubstring("reload_signal"))),
+
+		Entry("accepts assign_public_ip with launch_type FARGATE",
+			func(env *conf.Environment) { env.ECS.AssignPublicIp = true },
+			true, Succeed()),
+
+		Entry("rejects assign_public_ip with launch_type EC2",
+			func(env *conf.Environment) {
+				env.ECS.LaunchType = conf.LaunchType_EC2
+				env.ECS.Cluster = "shared"
+				env.ECS.AssignPublicIp = true
+			},
+			true, MatchError(ContainSubstring("assign_public_ip"))),
+
+		Entry("rejects hot_swap",
+			func(env *conf.Environment) { env.Hotswap = true },
+			true, MatchError(ContainSubstring("hot_swap"))),
+
+		Entry("requires a vpc",
+			func(env *conf.Environment) { env.Regions[0].VpcId = "" },
+			true, MatchError(ContainSubstring("requires a vpc_id"))),
+
+		Entry("requires inet_port on inet containers",
+			func(env *conf.Environment) { env.Regions[0].Containers[0].InetPort = 0 },
+			true, MatchError(ContainSubstring("requires inet_port"))),
+
+		Entry("rejects routes",
+			func(env *conf.Environment) {
+				env.Regions[0].Containers[0].Routes = []*conf.Route{{}}
+			},
+			true, MatchError(ContainSubstring("Routes aren't supported"))),
+
+		Entry("allows one inet container",
+			func(env *conf.Environment) {
+				env.Regions[0].Containers = append(env.Regions[0].Containers, &conf.Container{
+					Name:     "api",
+					Topology: conf.Topology_Inet,
+					InetPort: 8081,
+				})
+			},
+			true, MatchError(ContainSubstring("one inet container"))),
+	)
+
+	It("accepts every compute: ec2 environment", func() {
+		environment := &conf.Environment{Compute: conf.Compute_EC2, Hotswap: true}
+		Expect(environment.ValidateCompute(false)).To(Succeed())
+	})
+})
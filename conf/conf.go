@@ -21,6 +21,8 @@ import (
 	"io/ioutil"
 	"os"
 	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/adobe-platform/porter/constants"
 	"github.com/adobe-platform/porter/stdin"
@@ -32,6 +34,78 @@ const (
 	Topology_Inet   = "inet"
 	Topology_Worker = "worker"
 	Topology_Cron   = "cron"
+
+	Compute_EC2 = "ec2"
+	Compute_ECS = "ecs"
+
+	SSH_Enabled  = "enabled"
+	SSH_Disabled = "disabled"
+	SSH_SSM      = "ssm"
+
+	Access_SSH = "ssh"
+	Access_SSM = "ssm"
+
+	PermissionPreflight_Enforce = "enforce"
+	PermissionPreflight_Warn    = "warn"
+	PermissionPreflight_Off     = "off"
+
+	PressureAction_Restart = "restart"
+	PressureAction_Shed    = "shed"
+
+	// docker refuses smaller memory limits
+	MinContainerMemory = 6
+
+	Confirm_None = "none"
+	Confirm_Yes  = "yes"
+	Confirm_Name = "name"
+
+	LaunchType_EC2     = "EC2"
+	LaunchType_Fargate = "FARGATE"
+
+	OutputType_String = "string"
+	OutputType_Number = "number"
+	OutputType_List   = "list"
+	OutputType_ARN    = "arn"
+	OutputType_URL    = "url"
+
+	SpotMode_Pure  = "pure"
+	SpotMode_Mixed = "mixed"
+
+	RoutingPolicy_Simple      = "simple"
+	RoutingPolicy_Weighted    = "weighted"
+	RoutingPolicy_Latency     = "latency"
+	RoutingPolicy_Geolocation = "geolocation"
+
+	DNSTarget_ELB       = "elb"
+	DNSTarget_Instances = "instances"
+	DNSTarget_Stack     = "stack"
+
+	SwapPolicy_Weighted = "weighted"
+	SwapPolicy_Failover = "failover"
+
+	PredictiveMetric_CPU        = "cpu"
+	PredictiveMetric_NetworkIn  = "network_in"
+	PredictiveMetric_NetworkOut = "network_out"
+
+	PredictiveMode_ForecastOnly     = "forecast_only"
+	PredictiveMode_ForecastAndScale = "forecast_and_scale"
+
+	MaxCapacityBreach_HonorMax    = "honor_max"
+	MaxCapacityBreach_IncreaseMax = "increase_max"
+
+	AlarmMetric_HTTP5xx        = "http_5xx"
+	AlarmMetric_UnhealthyHosts = "unhealthy_hosts"
+	AlarmMetric_CPU            = "cpu"
+	AlarmMetric_Disk           = "disk"
+
+	LogParserFormat_JSON   = "json"
+	LogParserFormat_Regex  = "regex"
+	LogParserFormat_Logfmt = "logfmt"
+	LogParserFormat_LTSV   = "ltsv"
+
+	ArtifactStore_S3   = "s3"
+	ArtifactStore_GCS  = "gcs"
+	ArtifactStore_HTTP = "http"
 )
 
 // NOTE: It's important to keep a reserved character so that if any of these
@@ -47,6 +121,30 @@ var (
 	porterVersionRegex   = regexp.MustCompile(`^v\d+\.\d+\.\d+$`)
 	vpcIdRegex           = regexp.MustCompile(`^vpc-(\d|\w){8}$`)
 	subnetIdRegex        = regexp.MustCompile(`^subnet-(\d|\w){8}$`)
+	fileModeRegex        = regexp.MustCompile(`^0?[0-7]{3}$`)
+	reloadSignalRegex    = regexp.MustCompile(`^SIG(HUP|USR1|USR2)$`)
+	routePathRegex       = regexp.MustCompile(`^/[-a-zA-Z0-9_.$/~@:+&*?]{0,127}$`)
+	routeHostRegex       = regexp.MustCompile(`^[-a-zA-Z0-9.*?]{1,128}$`)
+	countryCodeRegex     = regexp.MustCompile(`^([A-Z]{2}|\*)$`)
+	subdivisionCodeRegex = regexp.MustCompile(`^[A-Z0-9]{1,3}$`)
+	instanceGroupRegex   = regexp.MustCompile(`^[0-9a-zA-Z]+$`)
+	scheduledActionRegex = regexp.MustCompile(`^[0-9a-zA-Z]{1,64}$`)
+	ecrRepositoryRegex   = regexp.MustCompile(`^([a-z0-9]+([._-][a-z0-9]+)*/)*[a-z0-9]+([._-][a-z0-9]+)*$`)
+	volumeNameRegex      = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.]*$`)
+	envVarNameRegex      = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	dynamoDBTableRegex   = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,255}$`)
+	sqsQueueNameRegex    = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,75}(\.fifo)?$`)
+	kmsKeyIdRegex        = regexp.MustCompile(`^(arn:aws:kms:[a-z0-9-]+:\d+:(key|alias)/[-a-zA-Z0-9/_]+|alias/[-a-zA-Z0-9/_]+|[-a-f0-9]{36})$`)
+	snsTopicARNRegex     = regexp.MustCompile(`^arn:aws[-a-z]*:sns:[a-z0-9-]+:\d{12}:[a-zA-Z0-9_-]{1,256}$`)
+	s3GuardRulesRegex    = regexp.MustCompile(`^s3://[a-z0-9][-a-z0-9.]{1,61}[a-z0-9]/.+$`)
+	metricNamespaceRegex = regexp.MustCompile(`^[-a-zA-Z0-9._/#: ]{1,255}$`)
+	trustAnchorARNRegex  = regexp.MustCompile(`^arn:aws[-a-z]*:rolesanywhere:[a-z0-9-]+:\d{12}:trust-anchor/[-a-zA-Z0-9]+$`)
+	awsOperationRegex    = regexp.MustCompile(`^([a-z0-9-]+:)?[A-Z][a-zA-Z0-9]+$`)
+	rolesProfileARNRegex = regexp.MustCompile(`^arn:aws[-a-z]*:rolesanywhere:[a-z0-9-]+:\d{12}:profile/[-a-zA-Z0-9]+$`)
+	gcsBucketRegex       = regexp.MustCompile(`^[a-z0-9][-a-z0-9_.]{1,61}[a-z0-9]$`)
+	logParserNameRegex   = regexp.MustCompile(`^[a-zA-Z0-9_]{1,64}$`)
+	logPluginRegex       = regexp.MustCompile(`^[a-zA-Z0-9_.]{1,64}$`)
+	sysctlKeyRegex       = regexp.MustCompile(`^[a-z0-9_-]+(\.[a-zA-Z0-9_-]+)+$`)
 
 	// https://github.com/docker/docker/blob/v1.11.2/utils/names.go#L6
 	// minus '-' which is reserved
@@ -59,22 +157,249 @@ type (
 		ServiceName    string `yaml:"service_name"`
 		ServiceVersion string
 		PorterVersion  string            `yaml:"porter_version"`
+		ECR            *ECR              `yaml:"ecr"`
 		Environments   []*Environment    `yaml:"environments"`
 		Slack          Slack             `yaml:"slack"`
 		Hooks          map[string][]Hook `yaml:"hooks"`
+		Pipeline       []*PipelineStage  `yaml:"pipeline"`
+		StateStore     *StateStore       `yaml:"state_store"`
+		ComposeFile    string            `yaml:"compose_file"`
+		Auth           *Auth             `yaml:"auth"`
+		AWSRetry       *AWSRetry         `yaml:"aws_retry"`
+
+		PayloadCompression *PayloadCompression `yaml:"payload_compression"`
+		ArtifactStore      *ArtifactStore      `yaml:"artifact_store"`
+		DeployConcurrency  *DeployConcurrency  `yaml:"deploy_concurrency"`
+		SecretsPayload     *SecretsPayload     `yaml:"secrets_payload"`
+	}
+
+	// SecretsPayload limits the secrets provision uploads so a payload hosts
+	// can't use fails the provision instead
+	SecretsPayload struct {
+		// MaxSize is the most bytes the compressed payload can be
+		MaxSize int `yaml:"max_size"`
+
+		// AllowBinary names the containers whose secrets can be binary
+		AllowBinary []string `yaml:"allow_binary"`
+
+		// AllowBinaryHost lets secrets_exec_name output be binary
+		AllowBinaryHost bool `yaml:"allow_binary_host"`
+	}
+
+	// DeployConcurrency limits how many deploys run at once in each account
+	// and region. Every service configured with the same table shares the
+	// limit. Deploys over it wait in line. Times are in seconds
+	DeployConcurrency struct {
+		DynamoDBTable string `yaml:"dynamodb_table"`
+		Region        string `yaml:"region"`
+		RoleARN       string `yaml:"role_arn"`
+		Limit         int    `yaml:"limit"`
+		MaxWait       int    `yaml:"max_wait"`
+	}
+
+	// ArtifactStore is where provision uploads the service payload and
+	// CloudFormation templates. Without it they go to each region's s3_bucket
+	ArtifactStore struct {
+		// Type is s3, gcs, or http
+		Type string `yaml:"type"`
+
+		// Bucket is the GCS bucket
+		Bucket string `yaml:"bucket"`
+
+		// BaseURL is the http artifact server. Artifacts are PUT to and
+		// downloaded from BaseURL/<key>
+		BaseURL string `yaml:"base_url"`
+
+		// TokenEnv names the environment variable holding the bearer token
+		// uploads are authorized with
+		TokenEnv string `yaml:"token_env"`
+	}
+
+	// PayloadCompression is how pack gzips the service payload
+	PayloadCompression struct {
+		// Level is a gzip level from 0 (none) to 9 (best)
+		Level *int `yaml:"level"`
+
+		// Threads compress the payload in parallel. It defaults to the
+		// number of CPUs
+		Threads int `yaml:"threads"`
+	}
+
+	// AWSRetry is how AWS calls that are throttled or fail transiently are
+	// retried
+	AWSRetry struct {
+		MaxAttempts int            `yaml:"max_attempts"`
+		BaseDelayMs int            `yaml:"base_delay_ms"`
+		MaxDelayMs  int            `yaml:"max_delay_ms"`
+		Adaptive    *bool          `yaml:"adaptive"`
+		Operations  map[string]int `yaml:"operations"`
+	}
+
+	// Auth is how porter gets AWS credentials on a build box. Without it
+	// porter uses the default credential chain
+	Auth struct {
+		RolesAnywhere *RolesAnywhere `yaml:"roles_anywhere"`
+	}
+
+	// RolesAnywhere exchanges an X.509 certificate for a role's credentials
+	// so runners without an instance profile or OIDC can deploy
+	RolesAnywhere struct {
+		Certificate     string `yaml:"certificate"`
+		PrivateKey      string `yaml:"private_key"`
+		TrustAnchorARN  string `yaml:"trust_anchor_arn"`
+		ProfileARN      string `yaml:"profile_arn"`
+		RoleARN         string `yaml:"role_arn"`
+		Region          string `yaml:"region"`
+		SessionDuration int    `yaml:"session_duration"`
+	}
+
+	// StateStore is where provision, promote, and porter status record and
+	// read deployments. Without it deployments are only recorded on the
+	// machine that ran them
+	StateStore struct {
+		DynamoDBTable string `yaml:"dynamodb_table"`
+		Region        string `yaml:"region"`
+		RoleARN       string `yaml:"role_arn"`
+	}
+
+	// PipelineStage is an environment in the promotion path run by
+	// porter pipeline run. Its gates must pass before it's deployed
+	PipelineStage struct {
+		Environment string          `yaml:"environment"`
+		Gates       []*PipelineGate `yaml:"gates"`
+	}
+
+	// PipelineGate checks the previous stage. Exactly one field is set
+	PipelineGate struct {
+		// Hook is a custom hook run against the previous stage's environment
+		Hook string `yaml:"hook"`
+
+		// SoakTime is the number of seconds the previous stage must run
+		SoakTime int `yaml:"soak_time"`
+
+		// Approval requires the stage be approved on the command line
+		Approval bool `yaml:"approval"`
+	}
+
+	// ECR pushes the service's images to an ECR repository in each region
+	// instead of shipping them in the service payload
+	ECR struct {
+		Repository    string `yaml:"repository"`
+		MaxImageCount int    `yaml:"max_image_count"`
 	}
 
 	Container struct {
 		Name            string `yaml:"name"`
 		OriginalName    string
-		Topology        string       `yaml:"topology"`
-		InetPort        int          `yaml:"inet_port"`
-		Uid             *int         `yaml:"uid"`
-		ReadOnly        *bool        `yaml:"read_only"`
-		Dockerfile      string       `yaml:"dockerfile"`
-		DockerfileBuild string       `yaml:"dockerfile_build"`
-		HealthCheck     *HealthCheck `yaml:"health_check"`
-		SrcEnvFile      *SrcEnvFile  `yaml:"src_env_file"`
+		ImageDigest     string
+		Topology        string            `yaml:"topology"`
+		InetPort        int               `yaml:"inet_port"`
+		Uid             *int              `yaml:"uid"`
+		ReadOnly        *bool             `yaml:"read_only"`
+		Dockerfile      string            `yaml:"dockerfile"`
+		DockerfileBuild string            `yaml:"dockerfile_build"`
+		BuildTarget     string            `yaml:"build_target"`
+		HealthCheck     *HealthCheck      `yaml:"health_check"`
+		SrcEnvFile      *SrcEnvFile       `yaml:"src_env_file"`
+		SecretsMount    *SecretsMount     `yaml:"secrets_mount"`
+		Routes          []*Route          `yaml:"routes"`
+		InstanceGroup   string            `yaml:"instance_group"`
+		Volumes         []*Volume         `yaml:"volumes"`
+		Sidecars        []*Sidecar        `yaml:"sidecars"`
+		LogRouter       *LogRouter        `yaml:"log_router"`
+		Environment     map[string]string `yaml:"environment"`
+
+		// Command replaces the image's CMD
+		Command []string `yaml:"command"`
+
+		// Memory is the container's hard limit in MiB. 0 is unlimited
+		Memory int `yaml:"memory"`
+
+		// Set by pack. The architectures the image was built for and the
+		// digest of each when it was pushed for more than one
+		Architectures []string
+		ImageDigests  map[string]string
+	}
+
+	// LogRouter runs Fluent Bit next to its container and sends the
+	// container's stdout/stderr through it so parsers and outputs are part of
+	// the config rather than a separate log pipeline
+	LogRouter struct {
+		Image   string       `yaml:"image"`
+		Parsers []*LogParser `yaml:"parsers"`
+		Outputs []*LogOutput `yaml:"outputs"`
+	}
+
+	// LogParser is a Fluent Bit parser applied to each log line
+	LogParser struct {
+		Name       string `yaml:"name"`
+		Format     string `yaml:"format"`
+		Regex      string `yaml:"regex"`
+		TimeKey    string `yaml:"time_key"`
+		TimeFormat string `yaml:"time_format"`
+	}
+
+	// LogOutput is a Fluent Bit output plugin and its options
+	LogOutput struct {
+		Plugin  string            `yaml:"plugin"`
+		Match   string            `yaml:"match"`
+		Options map[string]string `yaml:"options"`
+	}
+
+	// Sidecar runs next to its container on every host in the container's
+	// network namespace so they reach each other on localhost
+	Sidecar struct {
+		Name        string              `yaml:"name"`
+		Image       string              `yaml:"image"`
+		Command     []string            `yaml:"command"`
+		Environment map[string]string   `yaml:"environment"`
+		DependsOn   []string            `yaml:"depends_on"`
+		Uid         *int                `yaml:"uid"`
+		ReadOnly    *bool               `yaml:"read_only"`
+		Volumes     []*Volume           `yaml:"volumes"`
+		HealthCheck *SidecarHealthCheck `yaml:"health_check"`
+
+		// Memory is the sidecar's hard limit in MiB. 0 is unlimited
+		Memory int `yaml:"memory"`
+
+		// Priority orders sidecars when porterd relieves pressure. The lowest
+		// is restarted or shed first
+		Priority int `yaml:"priority"`
+	}
+
+	// SidecarHealthCheck is a command run inside the sidecar. Times are in
+	// seconds
+	SidecarHealthCheck struct {
+		Command  []string `yaml:"command"`
+		Interval int      `yaml:"interval"`
+		Timeout  int      `yaml:"timeout"`
+		Retries  int      `yaml:"retries"`
+	}
+
+	// Volume is a directory shared by a container and its sidecars. Volumes
+	// with the same name are the same directory
+	Volume struct {
+		Name     string `yaml:"name"`
+		Path     string `yaml:"path"`
+		ReadOnly bool   `yaml:"read_only"`
+	}
+
+	// Route sends requests matching a path pattern and/or host header to a
+	// port the container exposes
+	Route struct {
+		Port        int    `yaml:"port"`
+		PathPattern string `yaml:"path_pattern"`
+		HostHeader  string `yaml:"host_header"`
+	}
+
+	// SecretsMount delivers container secrets as files on a tmpfs instead of
+	// environment variables
+	SecretsMount struct {
+		Path         string `yaml:"path"`
+		Uid          *int   `yaml:"uid"`
+		Gid          *int   `yaml:"gid"`
+		Mode         string `yaml:"mode"`
+		ReloadSignal string `yaml:"reload_signal"`
 	}
 
 	SrcEnvFile struct {
@@ -91,14 +416,319 @@ type (
 	}
 
 	Environment struct {
-		Name                string           `yaml:"name"`
-		StackDefinitionPath string           `yaml:"stack_definition_path"`
-		RoleARN             string           `yaml:"role_arn"`
-		Hotswap             bool             `yaml:"hot_swap"`
-		InstanceCount       uint             `yaml:"instance_count"`
-		InstanceType        string           `yaml:"instance_type"`
-		BlackoutWindows     []BlackoutWindow `yaml:"blackout_windows"`
-		Regions             []*Region        `yaml:"regions"`
+		Name                string             `yaml:"name"`
+		Preset              string             `yaml:"preset"`
+		StackDefinitionPath string             `yaml:"stack_definition_path"`
+		RoleARN             string             `yaml:"role_arn"`
+		CFNRoleARN          string             `yaml:"cfn_role_arn"`
+		Hotswap             bool               `yaml:"hot_swap"`
+		InstanceRefresh     *InstanceRefresh   `yaml:"instance_refresh"`
+		InstanceCount       uint               `yaml:"instance_count"`
+		InstanceType        string             `yaml:"instance_type"`
+		InstanceGroups      []*InstanceGroup   `yaml:"instance_groups"`
+		UpdatePolicy        *UpdatePolicy      `yaml:"update_policy"`
+		CreationPolicy      *CreationPolicy    `yaml:"creation_policy"`
+		MixedInstances      *MixedInstances    `yaml:"mixed_instances"`
+		Spot                *Spot              `yaml:"spot"`
+		Scaling             *Scaling           `yaml:"scaling"`
+		Monitoring          *Monitoring        `yaml:"monitoring"`
+		WAF                 *WAF               `yaml:"waf"`
+		Logging             *Logging           `yaml:"logging"`
+		Hardening           *Hardening         `yaml:"hardening"`
+		Access              string             `yaml:"access"`
+		PermissionPreflight string             `yaml:"permission_preflight"`
+		Pressure            *Pressure          `yaml:"pressure"`
+		DiskGC              *DiskGC            `yaml:"disk_gc"`
+		MetadataOptions     *MetadataOptions   `yaml:"metadata_options"`
+		Storage             *Storage           `yaml:"storage"`
+		AMI                 *AMI               `yaml:"ami"`
+		Bake                *Bake              `yaml:"bake"`
+		Drain               *Drain             `yaml:"drain"`
+		TemplateRules       *TemplateRules     `yaml:"template_rules"`
+		Notifications       *Notifications     `yaml:"notifications"`
+		DeployMetrics       *DeployMetrics     `yaml:"deploy_metrics"`
+		DeploySLO           *DeploySLO         `yaml:"deploy_slo"`
+		CommandQueue        bool               `yaml:"command_queue"`
+		Production          bool               `yaml:"production"`
+		Confirm             string             `yaml:"confirm"`
+		Stamps              []*Stamp           `yaml:"stamps"`
+		Compute             string             `yaml:"compute"`
+		ECS                 *ECS               `yaml:"ecs"`
+		BlackoutWindows     []BlackoutWindow   `yaml:"blackout_windows"`
+		Dependencies        []*Dependency      `yaml:"dependencies"`
+		DependencyChecks    []*DependencyCheck `yaml:"dependency_checks"`
+		Regions             []*Region          `yaml:"regions"`
+
+		// set on the environment of a stamp. See GetEnvironment
+		StampName string `yaml:"-"`
+		StampOf   string `yaml:"-"`
+	}
+
+	// InstanceGroup is an autoscaling group in the environment's stack that
+	// runs the containers assigned to it with instance_group
+	InstanceGroup struct {
+		Name          string `yaml:"name"`
+		InstanceType  string `yaml:"instance_type"`
+		InstanceCount uint   `yaml:"instance_count"`
+	}
+
+	// InstanceRefresh updates an existing stack's launch template in place and
+	// replaces instances with an autoscaling instance refresh
+	InstanceRefresh struct {
+		MinHealthyPercentage *int `yaml:"min_healthy_percentage"`
+		InstanceWarmup       *int `yaml:"instance_warmup"`
+	}
+
+	// UpdatePolicy controls how CloudFormation replaces the instances of an
+	// autoscaling group when a stack update changes its launch template
+	UpdatePolicy struct {
+		RollingUpdate   *RollingUpdate `yaml:"rolling_update"`
+		ReplacingUpdate bool           `yaml:"replacing_update"`
+	}
+
+	RollingUpdate struct {
+		MaxBatchSize          int `yaml:"max_batch_size"`
+		MinInstancesInService int `yaml:"min_instances_in_service"`
+		PauseTime             int `yaml:"pause_time"`
+	}
+
+	// CreationPolicy controls how many instances must signal the stack's
+	// WaitCondition and how long CloudFormation waits for them
+	CreationPolicy struct {
+		SignalCount uint `yaml:"signal_count"`
+		Timeout     int  `yaml:"timeout"`
+	}
+
+	// MixedInstances configures the MixedInstancesPolicy of the autoscaling
+	// group to use multiple instance types and spot instances
+	MixedInstances struct {
+		InstanceTypes                       []string `yaml:"instance_types"`
+		OnDemandBaseCapacity                int      `yaml:"on_demand_base_capacity"`
+		OnDemandPercentageAboveBaseCapacity *int     `yaml:"on_demand_percentage_above_base_capacity"`
+		OnDemandAllocationStrategy          string   `yaml:"on_demand_allocation_strategy"`
+		SpotAllocationStrategy              string   `yaml:"spot_allocation_strategy"`
+		SpotMaxPrice                        string   `yaml:"spot_max_price"`
+	}
+
+	// Spot runs instances on Spot capacity and drains them when EC2 sends an
+	// interruption notice
+	Spot struct {
+		Mode         string `yaml:"mode"`
+		DrainTimeout int    `yaml:"drain_timeout"`
+	}
+
+	// Scaling adds target tracking policies, scheduled actions, and a
+	// predictive scaling policy to the autoscaling group. A region's scaling
+	// replaces the environment's
+	Scaling struct {
+		MaxSize                    uint               `yaml:"max_size"`
+		TargetCPU                  float64            `yaml:"target_cpu"`
+		TargetALBRequestsPerTarget float64            `yaml:"target_alb_requests_per_target"`
+		ScheduledActions           []*ScheduledAction `yaml:"scheduled_actions"`
+		Predictive                 *PredictiveScaling `yaml:"predictive"`
+	}
+
+	// ScheduledAction changes the size of the autoscaling group on a cron
+	// schedule
+	ScheduledAction struct {
+		Name            string `yaml:"name"`
+		Recurrence      string `yaml:"recurrence"`
+		TimeZone        string `yaml:"time_zone"`
+		MinSize         *uint  `yaml:"min_size"`
+		MaxSize         *uint  `yaml:"max_size"`
+		DesiredCapacity *uint  `yaml:"desired_capacity"`
+	}
+
+	// PredictiveScaling forecasts load from a metric's history and scales
+	// ahead of it
+	PredictiveScaling struct {
+		Metric                    string  `yaml:"metric"`
+		TargetValue               float64 `yaml:"target_value"`
+		Mode                      string  `yaml:"mode"`
+		SchedulingBufferTime      int     `yaml:"scheduling_buffer_time"`
+		MaxCapacityBreachBehavior string  `yaml:"max_capacity_breach_behavior"`
+		MaxCapacityBuffer         *int    `yaml:"max_capacity_buffer"`
+	}
+
+	// Monitoring adds CloudWatch alarms and a dashboard to each region's
+	// stack. A region's monitoring replaces the environment's
+	Monitoring struct {
+		SNSTopicARN string   `yaml:"sns_topic_arn"`
+		Dashboard   *bool    `yaml:"dashboard"`
+		Alarms      []*Alarm `yaml:"alarms"`
+	}
+
+	// WAF is the WAFv2 web ACL associated with the provisioned ALB. It's
+	// either an existing web_acl_arn or a baseline web ACL of
+	// managed_rule_groups in the stack. A region's waf replaces the
+	// environment's
+	WAF struct {
+		WebACLARN         string   `yaml:"web_acl_arn"`
+		ManagedRuleGroups []string `yaml:"managed_rule_groups"`
+	}
+
+	// Alarm notifies the ops topic when a metric is past its threshold for
+	// evaluation_periods minutes in a row
+	Alarm struct {
+		Metric            string  `yaml:"metric"`
+		Threshold         float64 `yaml:"threshold"`
+		EvaluationPeriods int     `yaml:"evaluation_periods"`
+	}
+
+	// Logging ships container stdout/stderr and host log files to CloudWatch
+	// Logs groups the stack creates
+	Logging struct {
+		RetentionDays int      `yaml:"retention_days"`
+		Containers    *bool    `yaml:"containers"`
+		HostFiles     []string `yaml:"host_files"`
+	}
+
+	// Hardening locks down instances while they boot
+	Hardening struct {
+		SecurityUpdates bool              `yaml:"security_updates"`
+		SSH             string            `yaml:"ssh"`
+		Fail2ban        bool              `yaml:"fail2ban"`
+		Sysctl          map[string]string `yaml:"sysctl"`
+	}
+
+	// Pressure has porterd watch the host's pressure stall information and
+	// restart or shed the lowest priority sidecar when memory or cpu pressure
+	// is past its threshold, before the whole instance is unhealthy.
+	// Thresholds are the percent of the last 10 seconds some task stalled
+	Pressure struct {
+		Memory   float64 `yaml:"memory"`
+		CPU      float64 `yaml:"cpu"`
+		Action   string  `yaml:"action"`
+		Cooldown int     `yaml:"cooldown"`
+	}
+
+	// DiskGC has porterd remove old service payloads and unused images once
+	// the root volume's used percent reaches HighWatermark until it's back
+	// under LowWatermark
+	DiskGC struct {
+		HighWatermark float64 `yaml:"high_watermark"`
+		LowWatermark  float64 `yaml:"low_watermark"`
+	}
+
+	// MetadataOptions configures the instance metadata service of the
+	// launch template
+	MetadataOptions struct {
+		HttpTokens              string `yaml:"http_tokens"`
+		HttpPutResponseHopLimit int    `yaml:"http_put_response_hop_limit"`
+	}
+
+	// Storage is the EBS volumes of the launch template. Data volumes are
+	// formatted and mounted while instances boot
+	Storage struct {
+		Encrypted   bool          `yaml:"encrypted"`
+		KmsKeyId    string        `yaml:"kms_key_id"`
+		RootVolume  *EBSVolume    `yaml:"root_volume"`
+		DataVolumes []*DataVolume `yaml:"data_volumes"`
+	}
+
+	// EBSVolume is the size in GiB and performance of a volume. Iops and
+	// Throughput are only used by the volume types that take them
+	EBSVolume struct {
+		Device     string `yaml:"device"`
+		Size       int    `yaml:"size"`
+		Type       string `yaml:"type"`
+		Iops       int    `yaml:"iops"`
+		Throughput int    `yaml:"throughput"`
+	}
+
+	// DataVolume is an EBS volume mounted at MountPath
+	DataVolume struct {
+		EBSVolume  `yaml:",inline"`
+		MountPath  string `yaml:"mount_path"`
+		FileSystem string `yaml:"file_system"`
+	}
+
+	// AMI is resolved to an image id when a region is provisioned instead of
+	// using the Amazon Linux AMI built into porter. It's either an SSM
+	// parameter or the newest image that matches Owners, Name, and Tags
+	AMI struct {
+		SSMParameter string            `yaml:"ssm_parameter"`
+		Owners       []string          `yaml:"owners"`
+		Name         string            `yaml:"name"`
+		Tags         map[string]string `yaml:"tags"`
+
+		// Baked is the newest image porter bake made for the environment
+		Baked bool `yaml:"baked"`
+
+		// Pin reuses the image the region's last deployment resolved
+		Pin bool `yaml:"pin"`
+	}
+
+	// Bake is how porter bake builds the environment's AMI. Timeout is in
+	// minutes
+	Bake struct {
+		InstanceType string `yaml:"instance_type"`
+		Images       bool   `yaml:"images"`
+		Timeout      int    `yaml:"timeout"`
+	}
+
+	// Drain takes instances and containers out of service gracefully when
+	// they're swapped. DeregistrationDelay is in seconds
+	Drain struct {
+		DeregistrationDelay int      `yaml:"deregistration_delay"`
+		PreDeregistration   []string `yaml:"pre_deregistration"`
+	}
+
+	// Stamp is a tenant of a single-tenant-per-stack service. Each stamp is
+	// deployed as its own environment named after the environment and stamp
+	Stamp struct {
+		Name           string            `yaml:"name"`
+		InstanceCount  uint              `yaml:"instance_count"`
+		InstanceType   string            `yaml:"instance_type"`
+		HostedZoneName string            `yaml:"hosted_zone_name"`
+		ELBs           []*ELB            `yaml:"elbs"`
+		Parameters     map[string]string `yaml:"parameters"`
+	}
+
+	// TemplateRules are checked against the generated CloudFormation template
+	// before it's uploaded
+	TemplateRules struct {
+		RequiredTags           []string `yaml:"required_tags"`
+		ForbiddenInstanceTypes []string `yaml:"forbidden_instance_types"`
+		GuardRules             []string `yaml:"guard_rules"`
+	}
+
+	// Dependency is an upstream porter service whose stack outputs this
+	// service consumes
+	Dependency struct {
+		ServiceName string             `yaml:"service_name"`
+		Environment string             `yaml:"environment"`
+		Outputs     []DependencyOutput `yaml:"outputs"`
+	}
+
+	DependencyOutput struct {
+		Name string `yaml:"name"`
+		Type string `yaml:"type"`
+
+		// EnvVar is the variable containers get the output's value in
+		EnvVar string `yaml:"env_var"`
+	}
+
+	// DependencyCheck is an upstream dependency that must be healthy before a
+	// deploy starts. Exactly one of URL, TCP, and SQSQueue is set
+	DependencyCheck struct {
+		Name     string `yaml:"name"`
+		URL      string `yaml:"url"`
+		TCP      string `yaml:"tcp"`
+		SQSQueue string `yaml:"sqs_queue"`
+		Timeout  int    `yaml:"timeout"`
+	}
+
+	// ECS configures the ECS provisioning backend used with compute: ecs
+	ECS struct {
+		Cluster    string `yaml:"cluster"`
+		LaunchType string `yaml:"launch_type"`
+		Cpu        int    `yaml:"cpu"`
+		Memory     int    `yaml:"memory"`
+
+		// AssignPublicIp gives FARGATE tasks a public IP so they can pull
+		// images from subnets without a NAT gateway
+		AssignPublicIp bool `yaml:"assign_public_ip"`
 	}
 
 	BlackoutWindow struct {
@@ -110,19 +740,81 @@ type (
 		Name                string             `yaml:"name"`
 		StackDefinitionPath string             `yaml:"stack_definition_path"`
 		VpcId               string             `yaml:"vpc_id"`
+		VpcTags             map[string]string  `yaml:"vpc_tags"`
+		SubnetTags          map[string]string  `yaml:"subnet_tags"`
 		AZs                 []AvailabilityZone `yaml:"azs"`
 		ELBs                []*ELB             `yaml:"elbs"`
 		ELB                 string             `yaml:"elb"`
 		RoleARN             string             `yaml:"role_arn"`
+		CFNRoleARN          string             `yaml:"cfn_role_arn"`
+		InstanceType        string             `yaml:"instance_type"`
 		AutoScalingGroup    *AutoScalingGroup  `yaml:"auto_scaling_group"`
+		Security            *Security          `yaml:"security"`
+		EFS                 *EFS               `yaml:"efs"`
 		SSLCertARN          string             `yaml:"ssl_cert_arn"`
+		TLS                 *TLS               `yaml:"tls"`
 		HostedZoneName      string             `yaml:"hosted_zone_name"`
+		DNS                 *DNS               `yaml:"dns"`
 		KeyPairName         string             `yaml:"key_pair_name"`
 		S3Bucket            string             `yaml:"s3_bucket"`
 		SSEKMSKeyId         *string            `yaml:"sse_kms_key_id"`
+		SSEBucketKey        *bool              `yaml:"sse_bucket_key"`
+		SecretsKMSKeyId     string             `yaml:"secrets_kms_key_id"`
+		Scaling             *Scaling           `yaml:"scaling"`
+		Monitoring          *Monitoring        `yaml:"monitoring"`
+		WAF                 *WAF               `yaml:"waf"`
+		DependencyChecks    []*DependencyCheck `yaml:"dependency_checks"`
 		Containers          []*Container       `yaml:"containers"`
 	}
 
+	// EFS is a file system every instance in the region mounts and shares
+	// with its containers at ContainerPath. porter creates it with a mount
+	// target in each of the region's subnets unless FileSystemId refers to
+	// one and SecurityGroupId is its mount targets' security group
+	EFS struct {
+		FileSystemId    string `yaml:"file_system_id"`
+		SecurityGroupId string `yaml:"security_group_id"`
+		Encrypted       *bool  `yaml:"encrypted"`
+		KmsKeyId        string `yaml:"kms_key_id"`
+		PerformanceMode string `yaml:"performance_mode"`
+		ThroughputMode  string `yaml:"throughput_mode"`
+		ContainerPath   string `yaml:"container_path"`
+		ReadOnly        bool   `yaml:"read_only"`
+	}
+
+	// DNS is a record in hosted_zone_name that promote points at the
+	// destination ELB. Each region owns one record in the record set
+	//
+	// With target instances there's no ELB. Promote points the record set at
+	// the provisioned instances instead, one health checked record each
+	//
+	// With target stack promote moves the record from the promoted stack's
+	// load balancer to the provisioned stack's as configured by swap
+	DNS struct {
+		Name                 string       `yaml:"name"`
+		Target               string       `yaml:"target"`
+		RoutingPolicy        string       `yaml:"routing_policy"`
+		Weight               *int         `yaml:"weight"`
+		Geolocation          *Geolocation `yaml:"geolocation"`
+		EvaluateTargetHealth bool         `yaml:"evaluate_target_health"`
+		Swap                 *DNSSwap     `yaml:"swap"`
+	}
+
+	// DNSSwap is how promote moves dns target stack to the provisioned stack.
+	// Durations are seconds
+	DNSSwap struct {
+		Policy   string `yaml:"policy"`
+		TTL      int    `yaml:"ttl"`
+		Steps    []int  `yaml:"steps"`
+		Interval int    `yaml:"interval"`
+	}
+
+	Geolocation struct {
+		ContinentCode   string `yaml:"continent_code"`
+		CountryCode     string `yaml:"country_code"`
+		SubdivisionCode string `yaml:"subdivision_code"`
+	}
+
 	AutoScalingGroup struct {
 		SecurityGroupEgress []SecurityGroupEgress `yaml:"security_group_egress"`
 		SecretsExecName     string                `yaml:"secrets_exec_name"`
@@ -137,6 +829,46 @@ type (
 		ToPort                     int    `yaml:"to_port" json:"ToPort"`
 	}
 
+	// TLS is the certificate the provisioned load balancers terminate HTTPS
+	// with. It's either an existing certificate_arn or one requested from ACM
+	// for domain_name and validated through hosted_zone_id
+	TLS struct {
+		CertificateARN          string   `yaml:"certificate_arn"`
+		DomainName              string   `yaml:"domain_name"`
+		SubjectAlternativeNames []string `yaml:"subject_alternative_names"`
+		HostedZoneId            string   `yaml:"hosted_zone_id"`
+		SecurityPolicy          string   `yaml:"security_policy"`
+		RedirectHTTP            bool     `yaml:"redirect_http"`
+	}
+
+	// Security is the traffic the service's instances allow. Every rule
+	// names its source or destination symbolically and provision resolves it
+	Security struct {
+		Ingress []*SecurityRule `yaml:"ingress"`
+		Egress  []*SecurityRule `yaml:"egress"`
+	}
+
+	// SecurityRule allows traffic from (ingress) or to (egress) exactly one
+	// of another porter service, a prefix list, a CIDR, or the ELB
+	SecurityRule struct {
+		Name string `yaml:"name"`
+
+		// Service is another porter service in the same region. Environment
+		// defaults to the one being deployed
+		Service     string `yaml:"service"`
+		Environment string `yaml:"environment"`
+
+		PrefixList string `yaml:"prefix_list"`
+		CidrIp     string `yaml:"cidr_ip"`
+
+		// ELB is the ELBs traffic to the instances comes through. Ingress only
+		ELB bool `yaml:"elb"`
+
+		IpProtocol string `yaml:"ip_protocol"`
+		FromPort   int    `yaml:"from_port"`
+		ToPort     int    `yaml:"to_port"`
+	}
+
 	AvailabilityZone struct {
 		Name     string `yaml:"name"`
 		SubnetID string `yaml:"subnet_id"`
@@ -149,6 +881,21 @@ type (
 		Environment  map[string]string `yaml:"environment"`
 		Concurrent   bool              `yaml:"concurrent"`
 		RunCondition string            `yaml:"run_condition"`
+
+		// Timeout in seconds kills the hook's container if it's still
+		// running. 0 never does
+		Timeout int `yaml:"timeout"`
+
+		// RunsOn remote runs Command in Image on a CodeBuild build in each
+		// region instead of building and running a container on this host
+		RunsOn  string `yaml:"runs_on"`
+		Image   string `yaml:"image"`
+		Command string `yaml:"command"`
+
+		// Secrets of a remote hook are environment variables the build reads
+		// from an SSM parameter name or a Secrets Manager secret ARN so their
+		// values aren't in the build's configuration
+		Secrets map[string]string `yaml:"secrets"`
 	}
 
 	Slack struct {
@@ -158,6 +905,40 @@ type (
 		ProvisionFailureHook string `yaml:"provision_failure_webhook_url"`
 		PromoteSuccessHook   string `yaml:"promote_success_webhook_url"`
 		PromoteFailureHook   string `yaml:"promote_failure_webhook_url"`
+
+		// Go templates of porter build notify's messages. An environment's
+		// notifications override these
+		SuccessTemplate string `yaml:"success_template"`
+		FailureTemplate string `yaml:"failure_template"`
+	}
+
+	// Notifications customizes the messages porter build notify posts for an
+	// environment and where its lifecycle events are published
+	Notifications struct {
+		SuccessTemplate string `yaml:"success_template"`
+		FailureTemplate string `yaml:"failure_template"`
+
+		Webhooks    []string `yaml:"webhooks"`
+		SNSTopicARN string   `yaml:"sns_topic_arn"`
+		RoleARN     string   `yaml:"role_arn"`
+		Events      []string `yaml:"events"`
+	}
+
+	// DeployMetrics publishes CloudWatch metrics about each provision of an
+	// environment to each of its regions
+	DeployMetrics struct {
+		Enabled   bool   `yaml:"enabled"`
+		Namespace string `yaml:"namespace"`
+	}
+
+	// DeploySLO is how fast a deploy of the environment should be. Durations
+	// are seconds and zero isn't checked
+	DeploySLO struct {
+		TotalTime            int  `yaml:"total_time"`
+		FirstHealthyInstance int  `yaml:"first_healthy_instance"`
+		SwapDuration         int  `yaml:"swap_duration"`
+		RetryBudget          *int `yaml:"retry_budget"`
+		FailOnBreach         bool `yaml:"fail_on_breach"`
 	}
 
 	ELB struct {
@@ -172,12 +953,54 @@ func (recv *Config) GetEnvironment(envName string) (*Environment, error) {
 			return env, nil
 		}
 	}
+
+	for _, env := range recv.Environments {
+		for _, stamp := range env.Stamps {
+			if env.Name+stamp.Name == envName {
+				return env.StampEnvironment(stamp)
+			}
+		}
+	}
+
 	return nil, fmt.Errorf("Environment %s doesn't exist in the config", envName)
 }
 
+// RegistryDeployment is true when images are pulled from a registry rather
+// than loaded from the service payload
+func (recv *Config) RegistryDeployment() bool {
+	return recv.ECR != nil || os.Getenv(constants.EnvDockerRegistry) != ""
+}
+
+// ImageReference is the image pinned to the digest pack pushed. It's the
+// image name if there's no digest
+func (recv *Container) ImageReference() string {
+	if recv.ImageDigest == "" {
+		return recv.Name
+	}
+
+	repo := recv.Name
+	if colon := strings.LastIndex(repo, ":"); colon > strings.LastIndex(repo, "/") {
+		repo = repo[:colon]
+	}
+
+	return repo + "@" + recv.ImageDigest
+}
+
 // Convention over configuration
 func (recv *Config) SetDefaults() {
 
+	if recv.ECR != nil {
+
+		// repository names are lowercase
+		if recv.ECR.Repository == "" {
+			recv.ECR.Repository = strings.ToLower(recv.ServiceName)
+		}
+
+		if recv.ECR.MaxImageCount == 0 {
+			recv.ECR.MaxImageCount = 100
+		}
+	}
+
 	for _, hooks := range recv.Hooks {
 
 		for i := 0; i < len(hooks); i++ {
@@ -185,10 +1008,16 @@ func (recv *Config) SetDefaults() {
 			if hooks[i].RunCondition == "" {
 				hooks[i].RunCondition = constants.HRC_Pass
 			}
+
+			if hooks[i].RunsOn == "" {
+				hooks[i].RunsOn = constants.HRO_Local
+			}
 		}
 	}
 
 	for _, env := range recv.Environments {
+		env.applyPreset()
+
 		if env.InstanceCount == 0 {
 			env.InstanceCount = 1
 		}
@@ -197,6 +1026,215 @@ func (recv *Config) SetDefaults() {
 			env.InstanceType = "m3.medium"
 		}
 
+		for _, group := range env.InstanceGroups {
+
+			if group.InstanceCount == 0 {
+				group.InstanceCount = env.InstanceCount
+			}
+
+			if group.InstanceType == "" {
+				group.InstanceType = env.InstanceType
+			}
+		}
+
+		if env.UpdatePolicy != nil && env.UpdatePolicy.RollingUpdate != nil &&
+			env.UpdatePolicy.RollingUpdate.MaxBatchSize == 0 {
+
+			env.UpdatePolicy.RollingUpdate.MaxBatchSize = 1
+		}
+
+		if env.CreationPolicy != nil && env.CreationPolicy.SignalCount == 0 {
+			env.CreationPolicy.SignalCount = env.TotalInstanceCount()
+		}
+
+		if env.Spot != nil {
+
+			if env.Spot.Mode == "" {
+				env.Spot.Mode = SpotMode_Pure
+			}
+
+			if env.Spot.DrainTimeout == 0 {
+				env.Spot.DrainTimeout = 90
+			}
+
+			// Spot capacity is requested through the MixedInstancesPolicy
+			if env.MixedInstances == nil {
+				env.MixedInstances = &MixedInstances{}
+			}
+
+			if env.Spot.Mode == SpotMode_Pure &&
+				env.MixedInstances.OnDemandPercentageAboveBaseCapacity == nil {
+
+				onDemandPercentage := 0
+				env.MixedInstances.OnDemandPercentageAboveBaseCapacity = &onDemandPercentage
+			}
+		}
+
+		if env.MixedInstances != nil {
+
+			if len(env.MixedInstances.InstanceTypes) == 0 {
+				env.MixedInstances.InstanceTypes = []string{env.InstanceType}
+			}
+
+			if env.MixedInstances.OnDemandPercentageAboveBaseCapacity == nil {
+				onDemandPercentage := 100
+				env.MixedInstances.OnDemandPercentageAboveBaseCapacity = &onDemandPercentage
+			}
+
+			if env.MixedInstances.OnDemandAllocationStrategy == "" {
+				env.MixedInstances.OnDemandAllocationStrategy = "prioritized"
+			}
+
+			if env.MixedInstances.SpotAllocationStrategy == "" {
+				env.MixedInstances.SpotAllocationStrategy = "capacity-optimized"
+			}
+		}
+
+		if env.InstanceRefresh != nil {
+
+			if env.InstanceRefresh.MinHealthyPercentage == nil {
+				minHealthyPercentage := 90
+				env.InstanceRefresh.MinHealthyPercentage = &minHealthyPercentage
+			}
+
+			if env.InstanceRefresh.InstanceWarmup == nil {
+				instanceWarmup := 300
+				env.InstanceRefresh.InstanceWarmup = &instanceWarmup
+			}
+		}
+
+		if env.Scaling != nil {
+			env.Scaling.setDefaults()
+		}
+
+		if env.Monitoring != nil {
+			env.Monitoring.setDefaults()
+		}
+
+		if env.WAF != nil {
+			env.WAF.setDefaults()
+		}
+
+		if env.Logging != nil {
+			env.Logging.setDefaults()
+		}
+
+		if env.Hardening != nil && env.Hardening.SSH == "" {
+			env.Hardening.SSH = SSH_Enabled
+		}
+
+		if env.Pressure != nil {
+
+			if env.Pressure.Action == "" {
+				env.Pressure.Action = PressureAction_Restart
+			}
+
+			if env.Pressure.Cooldown == 0 {
+				env.Pressure.Cooldown = 60
+			}
+		}
+
+		if env.DiskGC != nil {
+
+			if env.DiskGC.HighWatermark == 0 {
+				env.DiskGC.HighWatermark = 85
+			}
+
+			if env.DiskGC.LowWatermark == 0 {
+				env.DiskGC.LowWatermark = 70
+			}
+		}
+
+		if env.MetadataOptions != nil {
+
+			if env.MetadataOptions.HttpTokens == "" {
+				env.MetadataOptions.HttpTokens = "required"
+			}
+
+			// containers are a hop behind the docker bridge
+			if env.MetadataOptions.HttpPutResponseHopLimit == 0 {
+				env.MetadataOptions.HttpPutResponseHopLimit = 2
+			}
+		}
+
+		if env.Storage != nil {
+			env.Storage.setDefaults()
+		}
+
+		if env.AMI != nil {
+			env.AMI.setDefaults()
+		}
+
+		if env.Bake != nil && env.Bake.Timeout == 0 {
+			env.Bake.Timeout = 30
+		}
+
+		if env.Drain != nil {
+			env.Drain.setDefaults()
+		}
+
+		for _, dependency := range env.Dependencies {
+
+			if dependency.Environment == "" {
+				dependency.Environment = env.Name
+			}
+
+			for i := range dependency.Outputs {
+				if dependency.Outputs[i].Type == "" {
+					dependency.Outputs[i].Type = OutputType_String
+				}
+
+				if dependency.Outputs[i].EnvVar == "" {
+					dependency.Outputs[i].EnvVar = dependency.defaultEnvVar(dependency.Outputs[i].Name)
+				}
+			}
+		}
+
+		for _, check := range env.DependencyChecks {
+			if check.Timeout == 0 {
+				check.Timeout = 5
+			}
+		}
+
+		if env.Compute == "" {
+			env.Compute = Compute_EC2
+		}
+
+		if env.Access == "" {
+			env.Access = Access_SSH
+		}
+
+		if env.PermissionPreflight == "" {
+			env.PermissionPreflight = PermissionPreflight_Warn
+		}
+
+		if env.Confirm == "" {
+			if env.Production {
+				env.Confirm = Confirm_Name
+			} else {
+				env.Confirm = Confirm_None
+			}
+		}
+
+		if env.Compute == Compute_ECS {
+
+			if env.ECS == nil {
+				env.ECS = &ECS{}
+			}
+
+			if env.ECS.LaunchType == "" {
+				env.ECS.LaunchType = LaunchType_EC2
+			}
+
+			if env.ECS.Cpu == 0 {
+				env.ECS.Cpu = 256
+			}
+
+			if env.ECS.Memory == 0 {
+				env.ECS.Memory = 512
+			}
+		}
+
 		for _, region := range env.Regions {
 
 			if region.ELB != "" {
@@ -208,6 +1246,55 @@ func (recv *Config) SetDefaults() {
 				})
 			}
 
+			if region.DNS != nil {
+				if region.DNS.Target == "" {
+					region.DNS.Target = DNSTarget_ELB
+				}
+				if region.DNS.RoutingPolicy == "" {
+					region.DNS.RoutingPolicy = RoutingPolicy_Simple
+				}
+				if region.DNS.RoutingPolicy == RoutingPolicy_Weighted && region.DNS.Weight == nil {
+					weight := 1
+					region.DNS.Weight = &weight
+				}
+				if region.DNS.Target == DNSTarget_Stack {
+					if region.DNS.Swap == nil {
+						region.DNS.Swap = &DNSSwap{}
+					}
+					region.DNS.Swap.setDefaults()
+				}
+			}
+
+			if region.Scaling != nil {
+				region.Scaling.setDefaults()
+			}
+
+			if region.Monitoring != nil {
+				region.Monitoring.setDefaults()
+			}
+
+			if region.WAF != nil {
+				region.WAF.setDefaults()
+			}
+
+			if region.Security != nil {
+				region.Security.setDefaults(env.Name)
+			}
+
+			if region.EFS != nil {
+				region.EFS.setDefaults()
+			}
+
+			if region.TLS != nil {
+				region.TLS.setDefaults()
+			}
+
+			for _, check := range region.DependencyChecks {
+				if check.Timeout == 0 {
+					check.Timeout = 5
+				}
+			}
+
 			if len(region.Containers) == 0 {
 				defaultContainer := &Container{}
 				region.Containers = append(region.Containers, defaultContainer)
@@ -222,10 +1309,44 @@ func (recv *Config) SetDefaults() {
 					container.DockerfileBuild = "Dockerfile.build"
 				}
 
+				if container.Topology == "" {
+					container.Topology = env.presetTopology()
+				}
+
+				if container.SecretsMount != nil {
+
+					if container.SecretsMount.Path == "" {
+						container.SecretsMount.Path = "/run/secrets"
+					}
+					if container.SecretsMount.Mode == "" {
+						container.SecretsMount.Mode = "0400"
+					}
+				}
+
+				if container.LogRouter != nil {
+					container.LogRouter.setDefaults()
+				}
+
+				for _, sidecar := range container.Sidecars {
+
+					if sidecar.HealthCheck == nil {
+						continue
+					}
+					if sidecar.HealthCheck.Interval == 0 {
+						sidecar.HealthCheck.Interval = 10
+					}
+					if sidecar.HealthCheck.Timeout == 0 {
+						sidecar.HealthCheck.Timeout = 5
+					}
+					if sidecar.HealthCheck.Retries == 0 {
+						sidecar.HealthCheck.Retries = 3
+					}
+				}
+
 				if container.Topology == Topology_Inet {
 
 					if container.HealthCheck == nil {
-						container.HealthCheck = &HealthCheck{}
+						container.HealthCheck = env.presetHealthCheck()
 					}
 					if container.HealthCheck.Method == "" {
 						container.HealthCheck.Method = "GET"
@@ -254,26 +1375,341 @@ func (recv *Config) Print() {
 	fmt.Println("service_name", recv.ServiceName)
 	fmt.Println("porter_version", recv.PorterVersion)
 
+	if recv.ECR != nil {
+		fmt.Println(".ECR.Repository", recv.ECR.Repository)
+		fmt.Println(".ECR.MaxImageCount", recv.ECR.MaxImageCount)
+	}
+
+	if recv.StateStore != nil {
+		fmt.Println(".StateStore.DynamoDBTable", recv.StateStore.DynamoDBTable)
+		fmt.Println(".StateStore.Region", recv.StateStore.Region)
+		fmt.Println(".StateStore.RoleARN", recv.StateStore.RoleARN)
+	}
+
+	if recv.Auth != nil && recv.Auth.RolesAnywhere != nil {
+		fmt.Println(".Auth.RolesAnywhere.Certificate", recv.Auth.RolesAnywhere.Certificate)
+		fmt.Println(".Auth.RolesAnywhere.PrivateKey", recv.Auth.RolesAnywhere.PrivateKey)
+		fmt.Println(".Auth.RolesAnywhere.TrustAnchorARN", recv.Auth.RolesAnywhere.TrustAnchorARN)
+		fmt.Println(".Auth.RolesAnywhere.ProfileARN", recv.Auth.RolesAnywhere.ProfileARN)
+		fmt.Println(".Auth.RolesAnywhere.RoleARN", recv.Auth.RolesAnywhere.RoleARN)
+		fmt.Println(".Auth.RolesAnywhere.Region", recv.Auth.RolesAnywhere.Region)
+		fmt.Println(".Auth.RolesAnywhere.SessionDuration", recv.Auth.RolesAnywhere.SessionDuration)
+	}
+
+	if recv.PayloadCompression != nil {
+		if recv.PayloadCompression.Level != nil {
+			fmt.Println(".PayloadCompression.Level", *recv.PayloadCompression.Level)
+		}
+		fmt.Println(".PayloadCompression.Threads", recv.PayloadCompression.Threads)
+	}
+
+	if recv.SecretsPayload != nil {
+		fmt.Println(".SecretsPayload.MaxSize", recv.SecretsPayload.MaxSize)
+		fmt.Println(".SecretsPayload.AllowBinary", recv.SecretsPayload.AllowBinary)
+		fmt.Println(".SecretsPayload.AllowBinaryHost", recv.SecretsPayload.AllowBinaryHost)
+	}
+
+	if recv.DeployConcurrency != nil {
+		fmt.Println(".DeployConcurrency.DynamoDBTable", recv.DeployConcurrency.DynamoDBTable)
+		fmt.Println(".DeployConcurrency.Region", recv.DeployConcurrency.Region)
+		fmt.Println(".DeployConcurrency.RoleARN", recv.DeployConcurrency.RoleARN)
+		fmt.Println(".DeployConcurrency.Limit", recv.DeployConcurrency.Limit)
+		fmt.Println(".DeployConcurrency.MaxWait", recv.DeployConcurrency.MaxWait)
+	}
+
+	if recv.ArtifactStore != nil {
+		fmt.Println(".ArtifactStore.Type", recv.ArtifactStore.Type)
+		fmt.Println(".ArtifactStore.Bucket", recv.ArtifactStore.Bucket)
+		fmt.Println(".ArtifactStore.BaseURL", recv.ArtifactStore.BaseURL)
+		fmt.Println(".ArtifactStore.TokenEnv", recv.ArtifactStore.TokenEnv)
+	}
+
+	if recv.AWSRetry != nil {
+		fmt.Println(".AWSRetry.MaxAttempts", recv.AWSRetry.MaxAttempts)
+		fmt.Println(".AWSRetry.BaseDelayMs", recv.AWSRetry.BaseDelayMs)
+		fmt.Println(".AWSRetry.MaxDelayMs", recv.AWSRetry.MaxDelayMs)
+		if recv.AWSRetry.Adaptive != nil {
+			fmt.Println(".AWSRetry.Adaptive", *recv.AWSRetry.Adaptive)
+		}
+		fmt.Println(".AWSRetry.Operations")
+		for operation, attempts := range recv.AWSRetry.Operations {
+			fmt.Println("  "+operation, attempts)
+		}
+	}
+
+	fmt.Println(".Slack.SuccessTemplate", recv.Slack.SuccessTemplate)
+	fmt.Println(".Slack.FailureTemplate", recv.Slack.FailureTemplate)
+
 	fmt.Println(".Hooks")
 	for hookName, hookVal := range recv.Hooks {
 		printHooks(hookName, hookVal)
 	}
 
+	fmt.Println("compose_file", recv.ComposeFile)
+
+	fmt.Println(".Pipeline")
+	for _, stage := range recv.Pipeline {
+		fmt.Println("- .Environment", stage.Environment)
+		fmt.Println("  .Gates")
+		for _, gate := range stage.Gates {
+			fmt.Println("  - .Hook", gate.Hook)
+			fmt.Println("    .SoakTime", gate.SoakTime)
+			fmt.Println("    .Approval", gate.Approval)
+		}
+	}
+
 	fmt.Println(".Environments")
 	for _, environment := range recv.Environments {
 		fmt.Println("- .Name", environment.Name)
+		fmt.Println("  .Preset", environment.Preset)
 		fmt.Println("  .StackDefinitionPath", environment.StackDefinitionPath)
 		fmt.Println("  .RoleARN", environment.RoleARN)
+		if environment.CFNRoleARN != "" {
+			fmt.Println("  .CFNRoleARN", environment.CFNRoleARN)
+		}
 		fmt.Println("  .InstanceCount", environment.InstanceCount)
 		fmt.Println("  .InstanceType", environment.InstanceType)
+		fmt.Println("  .InstanceGroups")
+		for _, group := range environment.InstanceGroups {
+			fmt.Println("  - .Name", group.Name)
+			fmt.Println("    .InstanceType", group.InstanceType)
+			fmt.Println("    .InstanceCount", group.InstanceCount)
+		}
+		if environment.UpdatePolicy != nil {
+			if environment.UpdatePolicy.RollingUpdate != nil {
+				fmt.Println("  .UpdatePolicy.RollingUpdate.MaxBatchSize", environment.UpdatePolicy.RollingUpdate.MaxBatchSize)
+				fmt.Println("  .UpdatePolicy.RollingUpdate.MinInstancesInService", environment.UpdatePolicy.RollingUpdate.MinInstancesInService)
+				fmt.Println("  .UpdatePolicy.RollingUpdate.PauseTime", environment.UpdatePolicy.RollingUpdate.PauseTime)
+			}
+			fmt.Println("  .UpdatePolicy.ReplacingUpdate", environment.UpdatePolicy.ReplacingUpdate)
+		}
+
+		if environment.CreationPolicy != nil {
+			fmt.Println("  .CreationPolicy.SignalCount", environment.CreationPolicy.SignalCount)
+			fmt.Println("  .CreationPolicy.Timeout", environment.CreationPolicy.Timeout)
+		}
+
+		if environment.MixedInstances != nil {
+			fmt.Println("  .MixedInstances.InstanceTypes", environment.MixedInstances.InstanceTypes)
+			fmt.Println("  .MixedInstances.OnDemandBaseCapacity", environment.MixedInstances.OnDemandBaseCapacity)
+			fmt.Println("  .MixedInstances.OnDemandPercentageAboveBaseCapacity", *environment.MixedInstances.OnDemandPercentageAboveBaseCapacity)
+			fmt.Println("  .MixedInstances.OnDemandAllocationStrategy", environment.MixedInstances.OnDemandAllocationStrategy)
+			fmt.Println("  .MixedInstances.SpotAllocationStrategy", environment.MixedInstances.SpotAllocationStrategy)
+			fmt.Println("  .MixedInstances.SpotMaxPrice", environment.MixedInstances.SpotMaxPrice)
+		}
+
+		if environment.InstanceRefresh != nil {
+			fmt.Println("  .InstanceRefresh.MinHealthyPercentage", *environment.InstanceRefresh.MinHealthyPercentage)
+			fmt.Println("  .InstanceRefresh.InstanceWarmup", *environment.InstanceRefresh.InstanceWarmup)
+		}
+
+		if environment.Spot != nil {
+			fmt.Println("  .Spot.Mode", environment.Spot.Mode)
+			fmt.Println("  .Spot.DrainTimeout", environment.Spot.DrainTimeout)
+		}
+
+		if environment.Scaling != nil {
+			environment.Scaling.print("  ")
+		}
+
+		if environment.Monitoring != nil {
+			environment.Monitoring.print("  ")
+		}
+
+		if environment.WAF != nil {
+			environment.WAF.print("  ")
+		}
+
+		if environment.Logging != nil {
+			environment.Logging.print("  ")
+		}
+
+		if environment.Hardening != nil {
+			sysctlKeys := make([]string, 0)
+			for key := range environment.Hardening.Sysctl {
+				sysctlKeys = append(sysctlKeys, key)
+			}
+			sort.Strings(sysctlKeys)
+
+			fmt.Println("  .Hardening.SecurityUpdates", environment.Hardening.SecurityUpdates)
+			fmt.Println("  .Hardening.SSH", environment.Hardening.SSH)
+			fmt.Println("  .Hardening.Fail2ban", environment.Hardening.Fail2ban)
+			fmt.Println("  .Hardening.Sysctl", sysctlKeys)
+		}
+
+		fmt.Println("  .Dependencies")
+		for _, dependency := range environment.Dependencies {
+			fmt.Println("  - .ServiceName", dependency.ServiceName)
+			fmt.Println("    .Environment", dependency.Environment)
+			fmt.Println("    .Outputs")
+			for _, output := range dependency.Outputs {
+				fmt.Println("    - .Name", output.Name)
+				fmt.Println("      .Type", output.Type)
+				fmt.Println("      .EnvVar", output.EnvVar)
+			}
+		}
+
+		fmt.Println("  .DependencyChecks")
+		printDependencyChecks("  ", environment.DependencyChecks)
+
+		if environment.MetadataOptions != nil {
+			fmt.Println("  .MetadataOptions.HttpTokens", environment.MetadataOptions.HttpTokens)
+			fmt.Println("  .MetadataOptions.HttpPutResponseHopLimit", environment.MetadataOptions.HttpPutResponseHopLimit)
+		}
+		if environment.AMI != nil {
+			environment.AMI.print("  ")
+		}
+		if environment.Bake != nil {
+			fmt.Println("  .Bake.InstanceType", environment.Bake.InstanceType)
+			fmt.Println("  .Bake.Images", environment.Bake.Images)
+			fmt.Println("  .Bake.Timeout", environment.Bake.Timeout)
+		}
+		if environment.Drain != nil {
+			environment.Drain.print("  ")
+		}
+		if environment.Storage != nil {
+			environment.Storage.print("  ")
+		}
+		if environment.Notifications != nil {
+			fmt.Println("  .Notifications.SuccessTemplate", environment.Notifications.SuccessTemplate)
+			fmt.Println("  .Notifications.FailureTemplate", environment.Notifications.FailureTemplate)
+			fmt.Println("  .Notifications.Webhooks", len(environment.Notifications.Webhooks))
+			fmt.Println("  .Notifications.SNSTopicARN", environment.Notifications.SNSTopicARN)
+			fmt.Println("  .Notifications.RoleARN", environment.Notifications.RoleARN)
+			fmt.Println("  .Notifications.Events", environment.Notifications.Events)
+		}
+		fmt.Println("  .CommandQueue", environment.CommandQueue)
+		fmt.Println("  .Production", environment.Production)
+		fmt.Println("  .Confirm", environment.Confirm)
+		fmt.Println("  .Access", environment.Access)
+		fmt.Println("  .PermissionPreflight", environment.PermissionPreflight)
+		if environment.Pressure != nil {
+			fmt.Println("  .Pressure.Memory", environment.Pressure.Memory)
+			fmt.Println("  .Pressure.CPU", environment.Pressure.CPU)
+			fmt.Println("  .Pressure.Action", environment.Pressure.Action)
+			fmt.Println("  .Pressure.Cooldown", environment.Pressure.Cooldown)
+		}
+		if environment.DiskGC != nil {
+			fmt.Println("  .DiskGC.HighWatermark", environment.DiskGC.HighWatermark)
+			fmt.Println("  .DiskGC.LowWatermark", environment.DiskGC.LowWatermark)
+		}
+		if environment.DeployMetrics != nil {
+			fmt.Println("  .DeployMetrics.Enabled", environment.DeployMetrics.Enabled)
+			fmt.Println("  .DeployMetrics.Namespace", environment.DeployMetrics.Namespace)
+		}
+		if environment.DeploySLO != nil {
+			fmt.Println("  .DeploySLO.TotalTime", environment.DeploySLO.TotalTime)
+			fmt.Println("  .DeploySLO.FirstHealthyInstance", environment.DeploySLO.FirstHealthyInstance)
+			fmt.Println("  .DeploySLO.SwapDuration", environment.DeploySLO.SwapDuration)
+			if environment.DeploySLO.RetryBudget != nil {
+				fmt.Println("  .DeploySLO.RetryBudget", *environment.DeploySLO.RetryBudget)
+			}
+			fmt.Println("  .DeploySLO.FailOnBreach", environment.DeploySLO.FailOnBreach)
+		}
+		fmt.Println("  .Stamps")
+		for _, stamp := range environment.Stamps {
+			fmt.Println("  - .Name", stamp.Name)
+			fmt.Println("    .InstanceCount", stamp.InstanceCount)
+			fmt.Println("    .InstanceType", stamp.InstanceType)
+			fmt.Println("    .HostedZoneName", stamp.HostedZoneName)
+			for _, elb := range stamp.ELBs {
+				fmt.Println("    - .ELBTag", elb.ELBTag)
+				fmt.Println("      .Name", elb.Name)
+			}
+			parameterNames := make([]string, 0, len(stamp.Parameters))
+			for name := range stamp.Parameters {
+				parameterNames = append(parameterNames, name)
+			}
+			sort.Strings(parameterNames)
+			fmt.Println("    .Parameters", parameterNames)
+		}
+		if environment.TemplateRules != nil {
+			fmt.Println("  .TemplateRules.RequiredTags", environment.TemplateRules.RequiredTags)
+			fmt.Println("  .TemplateRules.ForbiddenInstanceTypes", environment.TemplateRules.ForbiddenInstanceTypes)
+			fmt.Println("  .TemplateRules.GuardRules", environment.TemplateRules.GuardRules)
+		}
+		fmt.Println("  .Compute", environment.Compute)
+		if environment.ECS != nil {
+			fmt.Println("  .ECS.Cluster", environment.ECS.Cluster)
+			fmt.Println("  .ECS.LaunchType", environment.ECS.LaunchType)
+			fmt.Println("  .ECS.Cpu", environment.ECS.Cpu)
+			fmt.Println("  .ECS.Memory", environment.ECS.Memory)
+			fmt.Println("  .ECS.AssignPublicIp", environment.ECS.AssignPublicIp)
+		}
 
 		fmt.Println("  .Regions")
 		for _, region := range environment.Regions {
 			fmt.Println("  - .Name", region.Name)
 			fmt.Println("    .VpcId", region.VpcId)
+			if len(region.VpcTags) > 0 {
+				fmt.Println("    .VpcTags", region.VpcTags)
+			}
+			if len(region.SubnetTags) > 0 {
+				fmt.Println("    .SubnetTags", region.SubnetTags)
+			}
 			fmt.Println("    .RoleARN", region.RoleARN)
+			if region.CFNRoleARN != "" {
+				fmt.Println("    .CFNRoleARN", region.CFNRoleARN)
+			}
+			if region.InstanceType != "" {
+				fmt.Println("    .InstanceType", region.InstanceType)
+			}
 			fmt.Println("    .KeyPairName", region.KeyPairName)
 			fmt.Println("    .S3Bucket", region.S3Bucket)
+			if region.SSEKMSKeyId != nil {
+				fmt.Println("    .SSEKMSKeyId", *region.SSEKMSKeyId)
+				fmt.Println("    .SSEBucketKey", region.BucketKeyEnabled())
+			}
+			fmt.Println("    .SecretsKMSKeyId", region.SecretsKMSKeyId)
+			fmt.Println("    .HostedZoneName", region.HostedZoneName)
+
+			if region.Scaling != nil {
+				region.Scaling.print("    ")
+			}
+
+			if region.Monitoring != nil {
+				region.Monitoring.print("    ")
+			}
+
+			if region.WAF != nil {
+				region.WAF.print("    ")
+			}
+
+			if region.Security != nil {
+				region.Security.print("    ")
+			}
+
+			if region.EFS != nil {
+				region.EFS.print("    ")
+			}
+
+			if region.TLS != nil {
+				region.TLS.print("    ")
+			}
+
+			fmt.Println("    .DependencyChecks")
+			printDependencyChecks("    ", region.DependencyChecks)
+
+			if region.DNS != nil {
+				fmt.Println("    .DNS.Name", region.DNS.Name)
+				fmt.Println("    .DNS.Target", region.DNS.Target)
+				fmt.Println("    .DNS.RoutingPolicy", region.DNS.RoutingPolicy)
+				if region.DNS.Weight != nil {
+					fmt.Println("    .DNS.Weight", *region.DNS.Weight)
+				}
+				if region.DNS.Geolocation != nil {
+					fmt.Println("    .DNS.Geolocation.ContinentCode", region.DNS.Geolocation.ContinentCode)
+					fmt.Println("    .DNS.Geolocation.CountryCode", region.DNS.Geolocation.CountryCode)
+					fmt.Println("    .DNS.Geolocation.SubdivisionCode", region.DNS.Geolocation.SubdivisionCode)
+				}
+				fmt.Println("    .DNS.EvaluateTargetHealth", region.DNS.EvaluateTargetHealth)
+				if region.DNS.Swap != nil {
+					fmt.Println("    .DNS.Swap.Policy", region.DNS.Swap.Policy)
+					fmt.Println("    .DNS.Swap.TTL", region.DNS.Swap.TTL)
+					fmt.Println("    .DNS.Swap.Steps", region.DNS.Swap.Steps)
+					fmt.Println("    .DNS.Swap.Interval", region.DNS.Swap.Interval)
+				}
+			}
 
 			fmt.Println("      .AZs")
 			for _, az := range region.AZs {
@@ -293,6 +1729,7 @@ func (recv *Config) Print() {
 			for _, container := range region.Containers {
 				fmt.Println("      - .Name", container.Name)
 				fmt.Println("        .InetPort", container.InetPort)
+				fmt.Println("        .InstanceGroup", container.InstanceGroup)
 
 				if container.Topology == Topology_Inet {
 					fmt.Println("        .HealthCheck.Method", container.HealthCheck.Method)
@@ -308,6 +1745,41 @@ func (recv *Config) Print() {
 					fmt.Println("        .SrcEnvFile.ExecName", container.SrcEnvFile.ExecName)
 					fmt.Println("        .SrcEnvFile.ExecArgs", container.SrcEnvFile.ExecArgs)
 				}
+
+				if container.SecretsMount != nil {
+					fmt.Println("        .SecretsMount.Path", container.SecretsMount.Path)
+					fmt.Println("        .SecretsMount.Mode", container.SecretsMount.Mode)
+					fmt.Println("        .SecretsMount.ReloadSignal", container.SecretsMount.ReloadSignal)
+				}
+
+				environmentKeys := make([]string, 0, len(container.Environment))
+				for key := range container.Environment {
+					environmentKeys = append(environmentKeys, key)
+				}
+				sort.Strings(environmentKeys)
+				fmt.Println("        .Environment", environmentKeys)
+				fmt.Println("        .Command", container.Command)
+
+				for _, volume := range container.Volumes {
+					fmt.Println("        .Volumes.Name", volume.Name)
+					fmt.Println("        .Volumes.Path", volume.Path)
+				}
+
+				for _, sidecar := range container.Sidecars {
+					fmt.Println("        .Sidecars.Name", sidecar.Name)
+					fmt.Println("        .Sidecars.Image", sidecar.Image)
+					fmt.Println("        .Sidecars.DependsOn", sidecar.DependsOn)
+				}
+
+				if container.LogRouter != nil {
+					container.LogRouter.print("        ")
+				}
+
+				for _, route := range container.Routes {
+					fmt.Println("        .Routes.Port", route.Port)
+					fmt.Println("        .Routes.PathPattern", route.PathPattern)
+					fmt.Println("        .Routes.HostHeader", route.HostHeader)
+				}
 			}
 		}
 	}
@@ -319,6 +1791,14 @@ func printHooks(name string, hooks []Hook) {
 		fmt.Println("  - .Repo", hook.Repo)
 		fmt.Println("    .Ref", hook.Ref)
 		fmt.Println("    .Dockerfile", hook.Dockerfile)
+		if hook.Timeout > 0 {
+			fmt.Println("    .Timeout", hook.Timeout)
+		}
+		if hook.RunsOn == constants.HRO_Remote {
+			fmt.Println("    .RunsOn", hook.RunsOn)
+			fmt.Println("    .Image", hook.Image)
+			fmt.Println("    .Command", hook.Command)
+		}
 		fmt.Println("    .Environment")
 		if hook.Environment != nil {
 			for envKey, envValue := range hook.Environment {
@@ -352,6 +1832,16 @@ func GetConfig(log log15.Logger, validate bool) (config *Config, success bool) {
 		return
 	}
 
+	warnDeprecations(log, configBytes)
+
+	if config.ComposeFile != "" {
+		err = config.applyComposeFile(log)
+		if err != nil {
+			log.Error("Failed to translate "+config.ComposeFile, "Error", err)
+			return
+		}
+	}
+
 	config.SetDefaults()
 
 	if validate {
@@ -363,6 +1853,11 @@ func GetConfig(log log15.Logger, validate bool) (config *Config, success bool) {
 		}
 	}
 
+	if !config.useAuth(log) {
+		return
+	}
+	config.useAWSRetry()
+
 	success = true
 	return
 }
@@ -394,7 +1889,17 @@ func GetAlteredConfig(log log15.Logger) (*Config, bool) {
 		return nil, false
 	}
 
-	return parseConfig(log, configBytes)
+	config, success := parseConfig(log, configBytes)
+	if !success {
+		return nil, false
+	}
+
+	if !config.useAuth(log) {
+		return nil, false
+	}
+	config.useAWSRetry()
+
+	return config, true
 }
 
 func parseConfig(log log15.Logger, configBytes []byte) (config *Config, success bool) {
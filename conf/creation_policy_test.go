@@ -0,0 +1,59 @@
+package conf_test
+
+import (
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+)
+
+var _ = Describe("ValidateCreationPolicy", func() {
+
+	DescribeTable("timeout",
+		func(stackCreationTimeout string, timeout int, errorMatcher OmegaMatcher) {
+			os.Setenv(constants.EnvStackCreation, stackCreationTimeout)
+			defer os.Unsetenv(constants.EnvStackCreation)
+
+			environment := &conf.Environment{
+				InstanceCount: 2,
+				CreationPolicy: &conf.CreationPolicy{
+					SignalCount: 2,
+					Timeout:     timeout,
+				},
+			}
+
+			Expect(environment.ValidateCreationPolicy()).To(errorMatcher)
+		},
+
+		Entry("accepts the default stack creation timeout",
+			"", 1200, Succeed()),
+
+		Entry("rejects more than the default stack creation timeout",
+			"", 1201, MatchError(ContainSubstring("stack creation timeout 1200"))),
+
+		Entry("accepts a raised stack creation timeout",
+			"45m", 2700, Succeed()),
+
+		Entry("rejects more than a raised stack creation timeout",
+			"45m", 2701, MatchError(ContainSubstring("stack creation timeout 2700"))),
+
+		Entry("rejects more than the most a stack creation timeout is raised to",
+			"2h", 3601, MatchError(ContainSubstring("stack creation timeout 3600"))),
+
+		Entry("rejects a negative timeout",
+			"", -1, MatchError(ContainSubstring("between 0"))),
+	)
+
+	It("rejects a signal_count greater than the instance count", func() {
+		environment := &conf.Environment{
+			InstanceCount:  2,
+			CreationPolicy: &conf.CreationPolicy{SignalCount: 3},
+		}
+
+		Expect(environment.ValidateCreationPolicy()).To(MatchError(ContainSubstring("signal_count")))
+	})
+})
@@ -0,0 +1,58 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	envVarRegex          = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	nonAlphanumericRegex = regexp.MustCompile(`[^a-zA-Z0-9]`)
+)
+
+// ParameterName is the template parameter whose value is the output of the
+// upstream stack. Templates in stack_definition_path can Ref it
+func (recv *Dependency) ParameterName(output DependencyOutput) string {
+	return "Dependency" +
+		nonAlphanumericRegex.ReplaceAllString(recv.ServiceName, "") +
+		nonAlphanumericRegex.ReplaceAllString(output.Name, "")
+}
+
+// defaultEnvVar is the service name and output in upper snake case so the
+// output TableArn of user-store is USER_STORE_TABLE_ARN
+func (recv *Dependency) defaultEnvVar(outputName string) string {
+	return strings.ToUpper(nonAlphanumericRegex.ReplaceAllString(recv.ServiceName, "_")) +
+		"_" + upperSnakeCase(outputName)
+}
+
+func upperSnakeCase(name string) string {
+	runes := []rune(nonAlphanumericRegex.ReplaceAllString(name, "_"))
+
+	var snake []rune
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && runes[i-1] != '_' {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+
+			// DNSName is DNS_NAME
+			if prevLower || nextLower {
+				snake = append(snake, '_')
+			}
+		}
+		snake = append(snake, unicode.ToUpper(r))
+	}
+
+	return string(snake)
+}
@@ -0,0 +1,24 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import "fmt"
+
+func printDependencyChecks(indent string, checks []*DependencyCheck) {
+	for _, check := range checks {
+		fmt.Println(indent+"- .Name", check.Name)
+		fmt.Println(indent+"  .URL", check.URL)
+		fmt.Println(indent+"  .TCP", check.TCP)
+		fmt.Println(indent+"  .SQSQueue", check.SQSQueue)
+		fmt.Println(indent+"  .Timeout", check.Timeout)
+	}
+}
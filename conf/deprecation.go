@@ -0,0 +1,150 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type (
+	// Deprecation marks a config field that will stop working in a future
+	// porter major
+	Deprecation struct {
+		// Path is the field's path in the YAML. * matches every item of a list
+		// or every key of a map
+		Path string
+
+		// Replacement tells the user what to change the field to
+		Replacement string
+
+		// RemovedIn is the porter major the field breaks in
+		RemovedIn int
+	}
+
+	// DeprecatedField is a deprecated field found in a config
+	DeprecatedField struct {
+		Deprecation
+
+		// Location is the field's path with list items named by their name
+		// key, like environments[prod].regions[us-west-2].elb
+		Location string
+	}
+)
+
+// Deprecations is every deprecated field. Fields are matched against the raw
+// YAML so they're reported even after they're removed from Config
+var Deprecations = []Deprecation{
+	{
+		Path:        "environments.*.regions.*.elbs",
+		Replacement: "set elb to the ELB's name instead",
+		RemovedIn:   4,
+	},
+}
+
+// FindDeprecations lists the deprecated fields set in a config file's bytes
+func FindDeprecations(configBytes []byte) (fields []DeprecatedField, err error) {
+	var raw interface{}
+
+	err = yaml.Unmarshal(configBytes, &raw)
+	if err != nil {
+		return
+	}
+
+	for _, deprecation := range Deprecations {
+		for _, location := range findPath(raw, strings.Split(deprecation.Path, "."), "") {
+			fields = append(fields, DeprecatedField{
+				Deprecation: deprecation,
+				Location:    location,
+			})
+		}
+	}
+
+	sort.SliceStable(fields, func(i, j int) bool {
+		return fields[i].Location < fields[j].Location
+	})
+	return
+}
+
+func findPath(node interface{}, path []string, location string) (locations []string) {
+	if len(path) == 0 {
+		return []string{location}
+	}
+
+	switch typed := node.(type) {
+	case map[interface{}]interface{}:
+
+		for key, value := range typed {
+			keyStr := fmt.Sprint(key)
+			if path[0] != "*" && path[0] != keyStr {
+				continue
+			}
+
+			childLocation := keyStr
+			if location != "" {
+				childLocation = location + "." + keyStr
+			}
+			locations = append(locations, findPath(value, path[1:], childLocation)...)
+		}
+
+	case []interface{}:
+
+		if path[0] != "*" {
+			return
+		}
+
+		for i, item := range typed {
+			locations = append(locations, findPath(item, path[1:], location+"["+itemName(item, i)+"]")...)
+		}
+	}
+
+	return
+}
+
+// itemName is a list item's name key or its index
+func itemName(item interface{}, index int) string {
+	if itemMap, ok := item.(map[interface{}]interface{}); ok {
+		if name, ok := itemMap["name"].(string); ok && name != "" {
+			return name
+		}
+	}
+	return strconv.Itoa(index)
+}
+
+// PorterMajor is the major of porter_version or 0 if it isn't set
+func (recv *Config) PorterMajor() int {
+	if !porterVersionRegex.MatchString(recv.PorterVersion) {
+		return 0
+	}
+
+	major, _ := strconv.Atoi(strings.SplitN(strings.TrimPrefix(recv.PorterVersion, "v"), ".", 2)[0])
+	return major
+}
+
+func warnDeprecations(log log15.Logger, configBytes []byte) {
+	fields, err := FindDeprecations(configBytes)
+	if err != nil {
+		return
+	}
+
+	for _, field := range fields {
+		log.Warn("Deprecated config field. Run porter config check-upgrade",
+			"Field", field.Location,
+			"RemovedIn", fmt.Sprintf("v%d", field.RemovedIn),
+			"Replacement", field.Replacement)
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import (
+	"errors"
+	"fmt"
+)
+
+func (recv *DNSSwap) setDefaults() {
+	if recv.Policy == "" {
+		recv.Policy = SwapPolicy_Weighted
+	}
+
+	if recv.TTL == 0 {
+		recv.TTL = 60
+	}
+
+	if recv.Policy == SwapPolicy_Weighted && len(recv.Steps) == 0 {
+		recv.Steps = []int{10, 50, 100}
+	}
+
+	// resolvers have to see a step before it can be verified
+	if recv.Interval == 0 {
+		recv.Interval = 2 * recv.TTL
+	}
+}
+
+func (recv *DNSSwap) validate() error {
+	switch recv.Policy {
+	case SwapPolicy_Weighted:
+	case SwapPolicy_Failover:
+		if len(recv.Steps) > 0 {
+			return fmt.Errorf("steps can't be used with policy %s", SwapPolicy_Failover)
+		}
+	default:
+		return fmt.Errorf("has an invalid policy. Valid values are [%s, %s]",
+			SwapPolicy_Weighted, SwapPolicy_Failover)
+	}
+
+	if recv.TTL < 1 || recv.TTL > 86400 {
+		return errors.New("ttl must be between 1 and 86400")
+	}
+
+	if recv.Interval < recv.TTL {
+		return errors.New("interval can't be less than the ttl")
+	}
+
+	previous := 0
+	for _, step := range recv.Steps {
+		if step <= previous || step > 100 {
+			return errors.New("steps must increase from 1 to 100")
+		}
+		previous = step
+	}
+
+	if len(recv.Steps) > 0 && previous != 100 {
+		return errors.New("steps must end at 100")
+	}
+
+	return nil
+}
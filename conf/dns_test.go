@@ -0,0 +1,119 @@
+package conf_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/conf"
+)
+
+var _ = Describe("ValidateDNS", func() {
+
+	DescribeTable("regions sharing a record",
+		func(west, east *conf.DNS, errorMatcher OmegaMatcher) {
+			environment := &conf.Environment{
+				Regions: []*conf.Region{
+					{Name: "us-west-2", DNS: west},
+					{Name: "us-east-1", DNS: east},
+				},
+			}
+
+			Expect(environment.ValidateDNS()).To(errorMatcher)
+		},
+
+		Entry("accepts the same latency record",
+			&conf.DNS{Name: "api.example.com", Target: conf.DNSTarget_ELB, RoutingPolicy: conf.RoutingPolicy_Latency},
+			&conf.DNS{Name: "api.example.com", Target: conf.DNSTarget_ELB, RoutingPolicy: conf.RoutingPolicy_Latency},
+			Succeed()),
+
+		Entry("rejects different targets with and without an ending period",
+			&conf.DNS{Name: "api.example.com", Target: conf.DNSTarget_ELB, RoutingPolicy: conf.RoutingPolicy_Latency},
+			&conf.DNS{Name: "api.example.com.", Target: conf.DNSTarget_Stack, RoutingPolicy: conf.RoutingPolicy_Latency},
+			MatchError(ContainSubstring("Every region must use the same target"))),
+
+		Entry("rejects different routing policies with and without an ending period",
+			&conf.DNS{Name: "api.example.com.", Target: conf.DNSTarget_ELB, RoutingPolicy: conf.RoutingPolicy_Latency},
+			&conf.DNS{Name: "api.example.com", Target: conf.DNSTarget_ELB, RoutingPolicy: conf.RoutingPolicy_Weighted},
+			MatchError(ContainSubstring("Every region must use the same routing_policy"))),
+
+		Entry("rejects a simple record in two regions with and without an ending period",
+			&conf.DNS{Name: "api.example.com", Target: conf.DNSTarget_ELB, RoutingPolicy: conf.RoutingPolicy_Simple},
+			&conf.DNS{Name: "api.example.com.", Target: conf.DNSTarget_ELB, RoutingPolicy: conf.RoutingPolicy_Simple},
+			MatchError(ContainSubstring("can only be defined in one region"))),
+
+		Entry("accepts simple records of different names",
+			&conf.DNS{Name: "west.example.com", Target: conf.DNSTarget_ELB, RoutingPolicy: conf.RoutingPolicy_Simple},
+			&conf.DNS{Name: "east.example.com", Target: conf.DNSTarget_ELB, RoutingPolicy: conf.RoutingPolicy_Simple},
+			Succeed()),
+	)
+
+	DescribeTable("dns target stack",
+		func(name, hostedZoneName string, errorMatcher OmegaMatcher) {
+			region := &conf.Region{
+				Name:           "us-west-2",
+				HostedZoneName: hostedZoneName,
+				Containers: []*conf.Container{
+					{Name: "web", Topology: conf.Topology_Inet},
+				},
+				DNS: &conf.DNS{
+					Name:          name,
+					Target:        conf.DNSTarget_Stack,
+					RoutingPolicy: conf.RoutingPolicy_Simple,
+					Swap:          &conf.DNSSwap{Policy: conf.SwapPolicy_Failover, TTL: 60, Interval: 60},
+				},
+			}
+
+			Expect(region.ValidateDNS()).To(errorMatcher)
+		},
+
+		Entry("accepts a subdomain",
+			"api.example.com", "example.com.", Succeed()),
+
+		Entry("rejects the apex",
+			"example.com.", "example.com.", MatchError(ContainSubstring("apex"))),
+
+		Entry("rejects the apex of a hosted_zone_name without an ending period",
+			"example.com", "example.com", MatchError(ContainSubstring("apex"))),
+	)
+
+	DescribeTable("dns target instances",
+		func(security *conf.Security, errorMatcher OmegaMatcher) {
+			region := &conf.Region{
+				Name:           "us-west-2",
+				HostedZoneName: "example.com.",
+				Containers: []*conf.Container{
+					{Name: "web", Topology: conf.Topology_Inet},
+				},
+				DNS: &conf.DNS{
+					Name:          "api.example.com",
+					Target:        conf.DNSTarget_Instances,
+					RoutingPolicy: conf.RoutingPolicy_Simple,
+				},
+				Security: security,
+			}
+
+			Expect(region.ValidateDNS()).To(errorMatcher)
+		},
+
+		Entry("accepts ingress from a CIDR",
+			&conf.Security{Ingress: []*conf.SecurityRule{
+				{Name: "vpc", CidrIp: "10.0.0.0/16", IpProtocol: "tcp", FromPort: 80, ToPort: 80},
+			}},
+			Succeed()),
+
+		Entry("rejects no security block",
+			nil,
+			MatchError(ContainSubstring("requires security ingress"))),
+
+		Entry("rejects no ingress",
+			&conf.Security{},
+			MatchError(ContainSubstring("requires security ingress"))),
+
+		Entry("rejects elb ingress",
+			&conf.Security{Ingress: []*conf.SecurityRule{
+				{Name: "lb", ELB: true, IpProtocol: "tcp", FromPort: 80, ToPort: 80},
+			}},
+			MatchError(ContainSubstring("elb ingress rule lb"))),
+	)
+})
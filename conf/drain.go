@@ -0,0 +1,63 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/adobe-platform/porter/constants"
+)
+
+func (recv *Drain) setDefaults() {
+	if recv.DeregistrationDelay == 0 {
+		recv.DeregistrationDelay = constants.DefaultDeregistrationDelay
+	}
+}
+
+func (recv *Drain) print(indent string) {
+	fmt.Println(indent+".Drain.DeregistrationDelay", recv.DeregistrationDelay)
+	fmt.Println(indent+".Drain.PreDeregistration", recv.PreDeregistration)
+}
+
+// DeregistrationDelay is the seconds load balancers let in-flight requests
+// finish after an instance is deregistered
+func (recv *Environment) DeregistrationDelay() int {
+	if recv.Drain == nil {
+		return constants.DefaultDeregistrationDelay
+	}
+	return recv.Drain.DeregistrationDelay
+}
+
+// ValidateDrain checks the delay is one load balancers accept and that
+// swapped out instances can be reached to run pre_deregistration
+func (recv *Environment) ValidateDrain() error {
+	drain := recv.Drain
+	if drain == nil {
+		return nil
+	}
+
+	if recv.Compute == Compute_ECS {
+		return errors.New("drain isn't supported with compute: ecs")
+	}
+
+	if drain.DeregistrationDelay < 1 || drain.DeregistrationDelay > constants.MaxDeregistrationDelay {
+		return fmt.Errorf("drain deregistration_delay must be between 1 and %d", constants.MaxDeregistrationDelay)
+	}
+
+	// promote and prune run it with an SSM Run Command
+	if len(drain.PreDeregistration) > 0 && recv.Access != Access_SSM {
+		return fmt.Errorf("drain pre_deregistration needs access: %s", Access_SSM)
+	}
+
+	return nil
+}
@@ -0,0 +1,21 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import "fmt"
+
+// ECSLoadBalancerStackName is the stack that holds the application load
+// balancer of an inet service with compute: ecs. It outlives the provisioned
+// stacks so the service keeps one endpoint that promote points at a stack
+func ECSLoadBalancerStackName(serviceName, envName string) string {
+	return fmt.Sprintf("porter-alb-%s-%s", serviceName, envName)
+}
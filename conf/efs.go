@@ -0,0 +1,141 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+)
+
+const (
+	EFSPerformanceMode_GeneralPurpose = "generalPurpose"
+	EFSPerformanceMode_MaxIO          = "maxIO"
+
+	EFSThroughputMode_Bursting = "bursting"
+	EFSThroughputMode_Elastic  = "elastic"
+)
+
+var (
+	fileSystemIdRegex    = regexp.MustCompile(`^fs-[0-9a-f]{8,17}$`)
+	securityGroupIdRegex = regexp.MustCompile(`^sg-[0-9a-f]{8,17}$`)
+)
+
+// FileSystemStackName is the stack that holds the region's efs and the
+// security groups that let instances reach it. Provisioned stacks import
+// its exports so the file system and what's on it outlive them
+func FileSystemStackName(serviceName, envName string) string {
+	return fmt.Sprintf("porter-efs-%s-%s", serviceName, envName)
+}
+
+// CreatesFileSystem is true when porter creates the file system rather than
+// referring to one
+func (recv *EFS) CreatesFileSystem() bool {
+	return recv.FileSystemId == ""
+}
+
+func (recv *EFS) setDefaults() {
+	if recv.CreatesFileSystem() {
+		if recv.Encrypted == nil {
+			encrypted := true
+			recv.Encrypted = &encrypted
+		}
+
+		if recv.PerformanceMode == "" {
+			recv.PerformanceMode = EFSPerformanceMode_GeneralPurpose
+		}
+
+		if recv.ThroughputMode == "" {
+			recv.ThroughputMode = EFSThroughputMode_Bursting
+		}
+	}
+
+	if recv.ContainerPath == "" {
+		recv.ContainerPath = "/mnt/efs"
+	}
+}
+
+func (recv *EFS) print(indent string) {
+	fmt.Println(indent+".EFS.FileSystemId", recv.FileSystemId)
+	fmt.Println(indent+".EFS.SecurityGroupId", recv.SecurityGroupId)
+	if recv.Encrypted != nil {
+		fmt.Println(indent+".EFS.Encrypted", *recv.Encrypted)
+	}
+	fmt.Println(indent+".EFS.KmsKeyId", recv.KmsKeyId)
+	fmt.Println(indent+".EFS.PerformanceMode", recv.PerformanceMode)
+	fmt.Println(indent+".EFS.ThroughputMode", recv.ThroughputMode)
+	fmt.Println(indent+".EFS.ContainerPath", recv.ContainerPath)
+	fmt.Println(indent+".EFS.ReadOnly", recv.ReadOnly)
+}
+
+func (recv *EFS) validate(region *Region) error {
+	if !region.HasVpc() {
+		return errors.New("requires vpc_id or vpc_tags")
+	}
+
+	if !path.IsAbs(recv.ContainerPath) || path.Clean(recv.ContainerPath) != recv.ContainerPath ||
+		recv.ContainerPath == "/" {
+		return errors.New("has an invalid container_path " + recv.ContainerPath)
+	}
+
+	if !recv.CreatesFileSystem() {
+		if !fileSystemIdRegex.MatchString(recv.FileSystemId) {
+			return errors.New("has an invalid file_system_id " + recv.FileSystemId)
+		}
+
+		if !securityGroupIdRegex.MatchString(recv.SecurityGroupId) {
+			return errors.New("file_system_id needs the security_group_id of its mount targets")
+		}
+
+		// these are the referenced file system's
+		if recv.Encrypted != nil || recv.KmsKeyId != "" || recv.PerformanceMode != "" || recv.ThroughputMode != "" {
+			return errors.New("file_system_id can't be defined with encrypted, kms_key_id, performance_mode, or throughput_mode")
+		}
+
+		return nil
+	}
+
+	if recv.SecurityGroupId != "" {
+		return errors.New("security_group_id requires file_system_id")
+	}
+
+	if recv.KmsKeyId != "" {
+		if !*recv.Encrypted {
+			return errors.New("kms_key_id requires encrypted: true")
+		}
+
+		if !kmsKeyIdRegex.MatchString(recv.KmsKeyId) {
+			return errors.New("has an invalid kms_key_id " + recv.KmsKeyId)
+		}
+	}
+
+	switch recv.PerformanceMode {
+	case EFSPerformanceMode_GeneralPurpose, EFSPerformanceMode_MaxIO:
+	default:
+		return fmt.Errorf("has an invalid performance_mode. Valid values are [%s, %s]",
+			EFSPerformanceMode_GeneralPurpose, EFSPerformanceMode_MaxIO)
+	}
+
+	switch recv.ThroughputMode {
+	case EFSThroughputMode_Bursting, EFSThroughputMode_Elastic:
+	default:
+		return fmt.Errorf("has an invalid throughput_mode. Valid values are [%s, %s]",
+			EFSThroughputMode_Bursting, EFSThroughputMode_Elastic)
+	}
+
+	if recv.PerformanceMode == EFSPerformanceMode_MaxIO && recv.ThroughputMode == EFSThroughputMode_Elastic {
+		return errors.New("throughput_mode elastic requires performance_mode " + EFSPerformanceMode_GeneralPurpose)
+	}
+
+	return nil
+}
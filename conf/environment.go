@@ -47,6 +47,29 @@ func (recv *Environment) GetRegion(regionName string) (*Region, error) {
 	return nil, fmt.Errorf("Region %s missing in environment %s", regionName, recv.Name)
 }
 
+func (recv *Environment) GetInstanceGroup(name string) (*InstanceGroup, error) {
+	for _, group := range recv.InstanceGroups {
+		if group.Name == name {
+			return group, nil
+		}
+	}
+	return nil, fmt.Errorf("Instance group %s missing in environment %s", name, recv.Name)
+}
+
+// TotalInstanceCount is the number of instances across all of the stack's
+// autoscaling groups
+func (recv *Environment) TotalInstanceCount() uint {
+	if len(recv.InstanceGroups) == 0 {
+		return recv.InstanceCount
+	}
+
+	var count uint
+	for _, group := range recv.InstanceGroups {
+		count += group.InstanceCount
+	}
+	return count
+}
+
 func (recv *Environment) GetRoleARN(regionName string) (string, error) {
 	region, err := recv.GetRegion(regionName)
 	if err != nil {
@@ -64,6 +87,22 @@ func (recv *Environment) GetRoleARN(regionName string) (string, error) {
 	return recv.RoleARN, nil
 }
 
+// GetCFNRoleARN is the CloudFormation service role stacks in the region are
+// created, updated, and deleted with. It's empty if CloudFormation uses the
+// caller's credentials
+func (recv *Environment) GetCFNRoleARN(regionName string) (string, error) {
+	region, err := recv.GetRegion(regionName)
+	if err != nil {
+		return "", err
+	}
+
+	if region.CFNRoleARN != "" {
+		return region.CFNRoleARN, nil
+	}
+
+	return recv.CFNRoleARN, nil
+}
+
 func (recv *Environment) GetStackDefinitionPath(regionName string) (string, error) {
 	region, err := recv.GetRegion(regionName)
 	if err != nil {
@@ -102,3 +141,48 @@ func (recv *Environment) IsWithinBlackoutWindow() error {
 
 	return nil
 }
+
+// GetScaling is the region's scaling or the environment's if the region
+// doesn't have its own
+func (recv *Environment) GetScaling(regionName string) (*Scaling, error) {
+	region, err := recv.GetRegion(regionName)
+	if err != nil {
+		return nil, err
+	}
+
+	if region.Scaling != nil {
+		return region.Scaling, nil
+	}
+
+	return recv.Scaling, nil
+}
+
+// GetWAF is the region's waf or the environment's if the region doesn't have
+// its own
+func (recv *Environment) GetWAF(regionName string) (*WAF, error) {
+	region, err := recv.GetRegion(regionName)
+	if err != nil {
+		return nil, err
+	}
+
+	if region.WAF != nil {
+		return region.WAF, nil
+	}
+
+	return recv.WAF, nil
+}
+
+// GetMonitoring is the region's monitoring or the environment's if the region
+// doesn't have its own
+func (recv *Environment) GetMonitoring(regionName string) (*Monitoring, error) {
+	region, err := recv.GetRegion(regionName)
+	if err != nil {
+		return nil, err
+	}
+
+	if region.Monitoring != nil {
+		return region.Monitoring, nil
+	}
+
+	return recv.Monitoring, nil
+}
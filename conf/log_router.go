@@ -0,0 +1,53 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/adobe-platform/porter/constants"
+)
+
+func (recv *LogRouter) setDefaults() {
+	if recv.Image == "" {
+		recv.Image = constants.LogRouterImage
+	}
+
+	for _, output := range recv.Outputs {
+		if output.Match == "" {
+			output.Match = "*"
+		}
+	}
+}
+
+func (recv *LogRouter) print(indent string) {
+	fmt.Println(indent+".LogRouter.Image", recv.Image)
+
+	for _, parser := range recv.Parsers {
+		fmt.Println(indent+".LogRouter.Parsers.Name", parser.Name)
+		fmt.Println(indent+".LogRouter.Parsers.Format", parser.Format)
+	}
+
+	for _, output := range recv.Outputs {
+		// option values are often credentials
+		var optionKeys []string
+		for key := range output.Options {
+			optionKeys = append(optionKeys, key)
+		}
+		sort.Strings(optionKeys)
+
+		fmt.Println(indent+".LogRouter.Outputs.Plugin", output.Plugin)
+		fmt.Println(indent+".LogRouter.Outputs.Match", output.Match)
+		fmt.Println(indent+".LogRouter.Outputs.Options", optionKeys)
+	}
+}
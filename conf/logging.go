@@ -0,0 +1,47 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import "fmt"
+
+// LogRetentionDays are the retention periods CloudWatch Logs accepts
+var LogRetentionDays = []int{
+	1, 3, 5, 7, 14, 30, 60, 90, 120, 150, 180, 365, 400, 545, 731, 1827, 3653,
+}
+
+func (recv *Logging) setDefaults() {
+	if recv.RetentionDays == 0 {
+		recv.RetentionDays = 14
+	}
+
+	if recv.Containers == nil {
+		containers := true
+		recv.Containers = &containers
+	}
+}
+
+// ShipsContainers is true if container stdout/stderr go to CloudWatch Logs
+func (recv *Logging) ShipsContainers() bool {
+	return recv.Containers == nil || *recv.Containers
+}
+
+func (recv *Logging) print(indent string) {
+	fmt.Println(indent+".Logging.RetentionDays", recv.RetentionDays)
+	if recv.Containers != nil {
+		fmt.Println(indent+".Logging.Containers", *recv.Containers)
+	}
+
+	fmt.Println(indent + ".Logging.HostFiles")
+	for _, file := range recv.HostFiles {
+		fmt.Println(indent+"- ", file)
+	}
+}
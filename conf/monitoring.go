@@ -0,0 +1,82 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import "fmt"
+
+// MonitoringStackName is the stack that holds a region's alarms, dashboard,
+// and the topic alarms notify. It outlives the provisioned stacks so teams
+// subscribe to the topic once
+func MonitoringStackName(serviceName, envName string) string {
+	return fmt.Sprintf("porter-monitoring-%s-%s", serviceName, envName)
+}
+
+// the alarms monitoring creates when it doesn't list any and the threshold of
+// each when an alarm doesn't set one
+var defaultAlarmThresholds = map[string]float64{
+	AlarmMetric_HTTP5xx:        10,
+	AlarmMetric_UnhealthyHosts: 1,
+	AlarmMetric_CPU:            80,
+	AlarmMetric_Disk:           85,
+}
+
+func (recv *Monitoring) setDefaults() {
+	if recv.Dashboard == nil {
+		dashboard := true
+		recv.Dashboard = &dashboard
+	}
+
+	if recv.Alarms == nil {
+		for _, metric := range []string{
+			AlarmMetric_HTTP5xx,
+			AlarmMetric_UnhealthyHosts,
+			AlarmMetric_CPU,
+			AlarmMetric_Disk,
+		} {
+			recv.Alarms = append(recv.Alarms, &Alarm{Metric: metric})
+		}
+	}
+
+	for _, alarm := range recv.Alarms {
+		if alarm.Threshold == 0 {
+			alarm.Threshold = defaultAlarmThresholds[alarm.Metric]
+		}
+
+		if alarm.EvaluationPeriods == 0 {
+			alarm.EvaluationPeriods = 5
+		}
+	}
+}
+
+// HasAlarm is true if monitoring creates an alarm on the metric
+func (recv *Monitoring) HasAlarm(metric string) bool {
+	for _, alarm := range recv.Alarms {
+		if alarm.Metric == metric {
+			return true
+		}
+	}
+	return false
+}
+
+func (recv *Monitoring) print(indent string) {
+	fmt.Println(indent+".Monitoring.SNSTopicARN", recv.SNSTopicARN)
+	if recv.Dashboard != nil {
+		fmt.Println(indent+".Monitoring.Dashboard", *recv.Dashboard)
+	}
+
+	fmt.Println(indent + ".Monitoring.Alarms")
+	for _, alarm := range recv.Alarms {
+		fmt.Println(indent+"- .Metric", alarm.Metric)
+		fmt.Println(indent+"  .Threshold", alarm.Threshold)
+		fmt.Println(indent+"  .EvaluationPeriods", alarm.EvaluationPeriods)
+	}
+}
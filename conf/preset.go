@@ -0,0 +1,170 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+const (
+	Preset_WebService  = "web-service"
+	Preset_Worker      = "worker"
+	Preset_InternalAPI = "internal-api"
+)
+
+// preset is a curated set of defaults for a common kind of service. Every
+// field only applies when the environment leaves it unset
+type preset struct {
+	topology            string
+	instanceCount       uint
+	rollingUpdate       bool
+	scaling             presetScaling
+	healthCheck         *HealthCheck
+	alarms              []string
+	securityGroupEgress []SecurityGroupEgress
+}
+
+// presetScaling tracks cpu between instance_count and a multiple of it so an
+// overridden instance_count keeps the preset's room to scale
+type presetScaling struct {
+	maxSizeFactor uint
+	targetCPU     float64
+}
+
+var (
+	// package repositories, the docker registry, and AWS APIs
+	publicEgress = []SecurityGroupEgress{
+		{CidrIp: "0.0.0.0/0", IpProtocol: "tcp", FromPort: 80, ToPort: 80},
+		{CidrIp: "0.0.0.0/0", IpProtocol: "tcp", FromPort: 443, ToPort: 443},
+	}
+
+	// the load balancer's view of the service and the instances'
+	loadBalancedAlarms = []string{
+		AlarmMetric_HTTP5xx,
+		AlarmMetric_UnhealthyHosts,
+		AlarmMetric_CPU,
+		AlarmMetric_Disk,
+	}
+
+	presets = map[string]preset{
+		Preset_WebService: {
+			topology:            Topology_Inet,
+			instanceCount:       2,
+			rollingUpdate:       true,
+			scaling:             presetScaling{maxSizeFactor: 5, targetCPU: 50},
+			healthCheck:         &HealthCheck{Method: "GET", Path: "/health"},
+			alarms:              loadBalancedAlarms,
+			securityGroupEgress: publicEgress,
+		},
+		Preset_Worker: {
+			topology:            Topology_Worker,
+			instanceCount:       1,
+			scaling:             presetScaling{maxSizeFactor: 4, targetCPU: 80},
+			alarms:              []string{AlarmMetric_CPU, AlarmMetric_Disk},
+			securityGroupEgress: publicEgress,
+		},
+		Preset_InternalAPI: {
+			topology:      Topology_Inet,
+			instanceCount: 2,
+			rollingUpdate: true,
+			scaling:       presetScaling{maxSizeFactor: 2, targetCPU: 70},
+			healthCheck:   &HealthCheck{Method: "GET", Path: "/health"},
+			alarms:        loadBalancedAlarms,
+			securityGroupEgress: append([]SecurityGroupEgress{
+				{CidrIp: "10.0.0.0/8", IpProtocol: "tcp", FromPort: 0, ToPort: 65535},
+			}, publicEgress...),
+		},
+	}
+)
+
+// applyPreset fills in the environment level fields of the environment's
+// preset. It runs before the rest of SetDefaults so the usual defaults are
+// derived from the preset's values
+func (recv *Environment) applyPreset() {
+	p, exists := presets[recv.Preset]
+	if !exists {
+		return
+	}
+
+	if recv.InstanceCount == 0 {
+		recv.InstanceCount = p.instanceCount
+	}
+
+	// the rest configures the autoscaling group which ECS doesn't have
+	if recv.Compute == Compute_ECS {
+		return
+	}
+
+	if p.rollingUpdate && recv.UpdatePolicy == nil && recv.InstanceRefresh == nil {
+
+		// keep an instance serving traffic unless the count was overridden to
+		// a single instance
+		minInstancesInService := 0
+		if recv.InstanceCount > 1 {
+			minInstancesInService = 1
+		}
+
+		recv.UpdatePolicy = &UpdatePolicy{
+			RollingUpdate: &RollingUpdate{
+				MaxBatchSize:          1,
+				MinInstancesInService: minInstancesInService,
+			},
+		}
+	}
+
+	// a region's scaling replaces the environment's so it replaces the
+	// preset's too. Instance groups don't scale
+	if p.scaling.maxSizeFactor > 0 && recv.Scaling == nil && len(recv.InstanceGroups) == 0 {
+		recv.Scaling = &Scaling{
+			MaxSize:   recv.InstanceCount * p.scaling.maxSizeFactor,
+			TargetCPU: p.scaling.targetCPU,
+		}
+	}
+
+	// alarms get their thresholds from the monitoring defaults
+	if recv.Monitoring == nil && len(p.alarms) > 0 {
+		recv.Monitoring = &Monitoring{}
+		for _, metric := range p.alarms {
+			recv.Monitoring.Alarms = append(recv.Monitoring.Alarms, &Alarm{Metric: metric})
+		}
+	}
+
+	for _, region := range recv.Regions {
+
+		// security egress replaces the preset's
+		if region.Security != nil && len(region.Security.Egress) > 0 {
+			continue
+		}
+
+		if region.AutoScalingGroup == nil {
+			region.AutoScalingGroup = &AutoScalingGroup{}
+		}
+
+		if region.AutoScalingGroup.SecurityGroupEgress == nil {
+			region.AutoScalingGroup.SecurityGroupEgress = make([]SecurityGroupEgress, len(p.securityGroupEgress))
+			copy(region.AutoScalingGroup.SecurityGroupEgress, p.securityGroupEgress)
+		}
+	}
+}
+
+// presetTopology is the topology of containers that don't define one
+func (recv *Environment) presetTopology() string {
+	return presets[recv.Preset].topology
+}
+
+// presetHealthCheck is the health check of inet containers that don't define
+// one
+func (recv *Environment) presetHealthCheck() *HealthCheck {
+	healthCheck := presets[recv.Preset].healthCheck
+	if healthCheck == nil {
+		return &HealthCheck{}
+	}
+
+	copied := *healthCheck
+	return &copied
+}
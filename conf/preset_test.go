@@ -0,0 +1,162 @@
+package conf_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/conf"
+)
+
+var _ = Describe("preset", func() {
+
+	// an environment of the preset with one container in one region after
+	// SetDefaults
+	expand := func(preset string, mutate func(*conf.Environment)) *conf.Environment {
+		environment := &conf.Environment{
+			Name:   "prod",
+			Preset: preset,
+			Regions: []*conf.Region{
+				{
+					Name: "us-west-2",
+					Containers: []*conf.Container{
+						{Name: "primary"},
+					},
+				},
+			},
+		}
+		mutate(environment)
+
+		config := &conf.Config{
+			ServiceName:  "svc",
+			Environments: []*conf.Environment{environment},
+		}
+		config.SetDefaults()
+
+		return environment
+	}
+
+	alarmMetrics := func(environment *conf.Environment) []string {
+		metrics := make([]string, 0)
+		for _, alarm := range environment.Monitoring.Alarms {
+			metrics = append(metrics, alarm.Metric)
+		}
+		return metrics
+	}
+
+	DescribeTable("expands",
+		func(preset, topology string, instanceCount uint, rollingUpdate bool, scaling *conf.Scaling,
+			healthCheck *conf.HealthCheck, alarms []string) {
+
+			environment := expand(preset, func(*conf.Environment) {})
+			region := environment.Regions[0]
+			container := region.Containers[0]
+
+			Expect(container.Topology).To(Equal(topology))
+			Expect(environment.InstanceCount).To(Equal(instanceCount))
+			Expect(environment.UpdatePolicy != nil).To(Equal(rollingUpdate))
+			Expect(environment.Scaling).To(Equal(scaling))
+			Expect(container.HealthCheck).To(Equal(healthCheck))
+			Expect(alarmMetrics(environment)).To(Equal(alarms))
+			Expect(region.AutoScalingGroup.SecurityGroupEgress).ToNot(BeEmpty())
+
+			// the stack creation timeout bounds the WaitCondition
+			Expect(environment.CreationPolicy).To(BeNil())
+			Expect(environment.ValidateCreationPolicy()).To(Succeed())
+			Expect(environment.ValidateMonitoring()).To(Succeed())
+			Expect(environment.ValidateScaling()).To(Succeed())
+		},
+
+		Entry(conf.Preset_WebService,
+			conf.Preset_WebService, conf.Topology_Inet, uint(2), true,
+			&conf.Scaling{MaxSize: 10, TargetCPU: 50},
+			&conf.HealthCheck{Method: "GET", Path: "/health"},
+			[]string{conf.AlarmMetric_HTTP5xx, conf.AlarmMetric_UnhealthyHosts, conf.AlarmMetric_CPU, conf.AlarmMetric_Disk}),
+
+		Entry(conf.Preset_InternalAPI,
+			conf.Preset_InternalAPI, conf.Topology_Inet, uint(2), true,
+			&conf.Scaling{MaxSize: 4, TargetCPU: 70},
+			&conf.HealthCheck{Method: "GET", Path: "/health"},
+			[]string{conf.AlarmMetric_HTTP5xx, conf.AlarmMetric_UnhealthyHosts, conf.AlarmMetric_CPU, conf.AlarmMetric_Disk}),
+
+		Entry(conf.Preset_Worker,
+			conf.Preset_Worker, conf.Topology_Worker, uint(1), false,
+			&conf.Scaling{MaxSize: 4, TargetCPU: 80},
+			(*conf.HealthCheck)(nil),
+			[]string{conf.AlarmMetric_CPU, conf.AlarmMetric_Disk}),
+	)
+
+	It("sets the alarms' default thresholds", func() {
+		environment := expand(conf.Preset_WebService, func(*conf.Environment) {})
+
+		for _, alarm := range environment.Monitoring.Alarms {
+			Expect(alarm.Threshold).To(BeNumerically(">", 0))
+			Expect(alarm.EvaluationPeriods).To(Equal(5))
+		}
+	})
+
+	It("keeps fields the environment defines", func() {
+		environment := expand(conf.Preset_WebService, func(env *conf.Environment) {
+			env.InstanceCount = 1
+			env.Monitoring = &conf.Monitoring{
+				Alarms: []*conf.Alarm{{Metric: conf.AlarmMetric_CPU}},
+			}
+			env.Regions[0].Containers[0].HealthCheck = &conf.HealthCheck{Path: "/ping"}
+		})
+		container := environment.Regions[0].Containers[0]
+
+		Expect(environment.InstanceCount).To(Equal(uint(1)))
+		Expect(environment.UpdatePolicy.RollingUpdate.MinInstancesInService).To(Equal(0))
+		Expect(alarmMetrics(environment)).To(Equal([]string{conf.AlarmMetric_CPU}))
+		Expect(container.HealthCheck).To(Equal(&conf.HealthCheck{Method: "GET", Path: "/ping"}))
+	})
+
+	It("scales max_size with an overridden instance_count", func() {
+		environment := expand(conf.Preset_WebService, func(env *conf.Environment) {
+			env.InstanceCount = 4
+		})
+
+		Expect(environment.Scaling).To(Equal(&conf.Scaling{MaxSize: 20, TargetCPU: 50}))
+		Expect(environment.ValidateScaling()).To(Succeed())
+	})
+
+	It("keeps the environment's scaling", func() {
+		scaling := &conf.Scaling{MaxSize: 3}
+		environment := expand(conf.Preset_WebService, func(env *conf.Environment) {
+			env.Scaling = scaling
+		})
+
+		Expect(environment.Scaling).To(BeIdenticalTo(scaling))
+		Expect(environment.Scaling.TargetCPU).To(BeZero())
+	})
+
+	It("doesn't scale instance groups", func() {
+		environment := expand(conf.Preset_Worker, func(env *conf.Environment) {
+			env.InstanceGroups = []*conf.InstanceGroup{{Name: "primary"}}
+		})
+
+		Expect(environment.Scaling).To(BeNil())
+	})
+
+	It("doesn't share the health check between containers", func() {
+		environment := expand(conf.Preset_WebService, func(env *conf.Environment) {
+			env.Regions[0].Containers = append(env.Regions[0].Containers, &conf.Container{Name: "secondary"})
+		})
+		containers := environment.Regions[0].Containers
+
+		containers[0].HealthCheck.Path = "/changed"
+		Expect(containers[1].HealthCheck.Path).To(Equal("/health"))
+	})
+
+	It("only applies topology, health_check, and instance_count with compute: ecs", func() {
+		environment := expand(conf.Preset_WebService, func(env *conf.Environment) {
+			env.Compute = conf.Compute_ECS
+		})
+
+		Expect(environment.InstanceCount).To(Equal(uint(2)))
+		Expect(environment.UpdatePolicy).To(BeNil())
+		Expect(environment.Scaling).To(BeNil())
+		Expect(environment.Monitoring).To(BeNil())
+		Expect(environment.Regions[0].Containers[0].HealthCheck).ToNot(BeNil())
+	})
+})
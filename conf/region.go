@@ -11,6 +11,67 @@
  */
 package conf
 
+import "sort"
+
+// NetworkFinder looks up what vpc_tags and subnet_tags select
+type NetworkFinder interface {
+	FindVpc(tags map[string]string) (vpcId string, err error)
+	FindSubnets(vpcId string, tags map[string]string, azNames []string) (subnets map[string]string, err error)
+}
+
+// HasVpc is true if instances run in a VPC, whether it's named by vpc_id or
+// found by vpc_tags
+func (recv *Region) HasVpc() bool {
+	return recv.VpcId != "" || len(recv.VpcTags) > 0
+}
+
+// DiscoverNetwork sets VpcId and the AZs' subnets from vpc_tags and
+// subnet_tags so a config can be used in accounts whose VPCs have different
+// ids. With subnet_tags and no azs every AZ with a tagged subnet is used
+//
+// Discovery happens at deploy time. Call it on a copy of the region
+func (recv *Region) DiscoverNetwork(finder NetworkFinder) error {
+	if len(recv.VpcTags) > 0 {
+		vpcId, err := finder.FindVpc(recv.VpcTags)
+		if err != nil {
+			return err
+		}
+		recv.VpcId = vpcId
+	}
+
+	if len(recv.SubnetTags) == 0 {
+		return nil
+	}
+
+	var azNames []string
+	for _, az := range recv.AZs {
+		azNames = append(azNames, az.Name)
+	}
+
+	subnets, err := finder.FindSubnets(recv.VpcId, recv.SubnetTags, azNames)
+	if err != nil {
+		return err
+	}
+
+	if len(azNames) == 0 {
+		for azName := range subnets {
+			azNames = append(azNames, azName)
+		}
+		sort.Strings(azNames)
+	}
+
+	azs := make([]AvailabilityZone, 0, len(azNames))
+	for _, azName := range azNames {
+		azs = append(azs, AvailabilityZone{
+			Name:     azName,
+			SubnetID: subnets[azName],
+		})
+	}
+	recv.AZs = azs
+
+	return nil
+}
+
 // inet is a superset of worker which are almost identical to cron
 func (recv *Region) PrimaryTopology() (dominant string) {
 	for _, container := range recv.Containers {
@@ -26,6 +87,42 @@ func (recv *Region) PrimaryTopology() (dominant string) {
 	return
 }
 
+// HasRoutes is true if any container defines path or host based routing
+func (recv *Region) HasRoutes() bool {
+	for _, container := range recv.Containers {
+		if len(container.Routes) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// BucketKeyEnabled is true if SSE-KMS uploads should use an S3 bucket key.
+// It's on unless sse_bucket_key is false
+func (recv *Region) BucketKeyEnabled() bool {
+	if recv.SSEKMSKeyId == nil {
+		return false
+	}
+	return recv.SSEBucketKey == nil || *recv.SSEBucketKey
+}
+
+// DNSToInstances is true if promote points dns at instances rather than an
+// ELB. The region has no load balancer at all
+func (recv *Region) DNSToInstances() bool {
+	return recv.DNS != nil && recv.DNS.Target == DNSTarget_Instances
+}
+
+// HasHTTPS is true if the provisioned load balancers have an HTTPS listener
+func (recv *Region) HasHTTPS() bool {
+	return recv.SSLCertARN != "" || recv.TLS != nil
+}
+
+// DNSToStacks is true if promote points dns at the provisioned stack's own
+// load balancer rather than promoting into an ELB
+func (recv *Region) DNSToStacks() bool {
+	return recv.DNS != nil && recv.DNS.Target == DNSTarget_Stack
+}
+
 func (recv *Region) HealthCheckMethod() string {
 	for _, container := range recv.Containers {
 		if container.Topology == Topology_Inet {
@@ -43,3 +140,22 @@ func (recv *Region) HealthCheckPath() string {
 	}
 	return ""
 }
+
+// ForInstanceGroup is a copy of the region with only the containers that run in
+// the named instance group. An empty name is every container
+func (recv *Region) ForInstanceGroup(name string) *Region {
+	if name == "" {
+		return recv
+	}
+
+	region := *recv
+	region.Containers = make([]*Container, 0)
+
+	for _, container := range recv.Containers {
+		if container.InstanceGroup == name {
+			region.Containers = append(region.Containers, container)
+		}
+	}
+
+	return &region
+}
@@ -0,0 +1,62 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import "fmt"
+
+func (recv *Scaling) setDefaults() {
+	predictive := recv.Predictive
+	if predictive == nil {
+		return
+	}
+
+	if predictive.Mode == "" {
+		predictive.Mode = PredictiveMode_ForecastOnly
+	}
+
+	if predictive.MaxCapacityBreachBehavior == "" {
+		predictive.MaxCapacityBreachBehavior = MaxCapacityBreach_HonorMax
+	}
+}
+
+func (recv *Scaling) print(indent string) {
+	fmt.Println(indent+".Scaling.MaxSize", recv.MaxSize)
+	fmt.Println(indent+".Scaling.TargetCPU", recv.TargetCPU)
+	fmt.Println(indent+".Scaling.TargetALBRequestsPerTarget", recv.TargetALBRequestsPerTarget)
+
+	fmt.Println(indent + ".Scaling.ScheduledActions")
+	for _, action := range recv.ScheduledActions {
+		fmt.Println(indent+"- .Name", action.Name)
+		fmt.Println(indent+"  .Recurrence", action.Recurrence)
+		fmt.Println(indent+"  .TimeZone", action.TimeZone)
+		if action.MinSize != nil {
+			fmt.Println(indent+"  .MinSize", *action.MinSize)
+		}
+		if action.MaxSize != nil {
+			fmt.Println(indent+"  .MaxSize", *action.MaxSize)
+		}
+		if action.DesiredCapacity != nil {
+			fmt.Println(indent+"  .DesiredCapacity", *action.DesiredCapacity)
+		}
+	}
+
+	if recv.Predictive != nil {
+		fmt.Println(indent+".Scaling.Predictive.Metric", recv.Predictive.Metric)
+		fmt.Println(indent+".Scaling.Predictive.TargetValue", recv.Predictive.TargetValue)
+		fmt.Println(indent+".Scaling.Predictive.Mode", recv.Predictive.Mode)
+		fmt.Println(indent+".Scaling.Predictive.SchedulingBufferTime", recv.Predictive.SchedulingBufferTime)
+		fmt.Println(indent+".Scaling.Predictive.MaxCapacityBreachBehavior", recv.Predictive.MaxCapacityBreachBehavior)
+		if recv.Predictive.MaxCapacityBuffer != nil {
+			fmt.Println(indent+".Scaling.Predictive.MaxCapacityBuffer", *recv.Predictive.MaxCapacityBuffer)
+		}
+	}
+}
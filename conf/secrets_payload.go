@@ -0,0 +1,60 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import (
+	"errors"
+
+	"github.com/adobe-platform/porter/constants"
+)
+
+// SecretsMaxSize is the most bytes the compressed secrets payload can be
+func (recv *Config) SecretsMaxSize() int {
+	if recv.SecretsPayload == nil || recv.SecretsPayload.MaxSize == 0 {
+		return constants.DefaultSecretsPayloadMaxSize
+	}
+	return recv.SecretsPayload.MaxSize
+}
+
+// ValidateSecretsPayload checks allow_binary only names containers so a typo
+// doesn't go unnoticed until binary secrets are rejected
+func (recv *Config) ValidateSecretsPayload() error {
+	secretsPayload := recv.SecretsPayload
+	if secretsPayload == nil {
+		return nil
+	}
+
+	if secretsPayload.MaxSize < 0 {
+		return errors.New("secrets_payload max_size can't be negative")
+	}
+
+	containerNames := make(map[string]interface{})
+	for _, environment := range recv.Environments {
+		for _, region := range environment.Regions {
+			for _, container := range region.Containers {
+				name := container.OriginalName
+				if name == "" {
+					name = container.Name
+				}
+				containerNames[name] = nil
+			}
+		}
+	}
+
+	for _, name := range secretsPayload.AllowBinary {
+		if _, exists := containerNames[name]; !exists {
+			return errors.New("secrets_payload allow_binary has " + name + " which isn't a container")
+		}
+	}
+
+	return nil
+}
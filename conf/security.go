@@ -0,0 +1,183 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+)
+
+var prefixListRegex = regexp.MustCompile(`^pl-[0-9a-f]+$`)
+
+// SecurityGroupStackName is the stack that holds the security group every
+// instance of a service with a security block is a member of. Provisioned
+// stacks come and go with every deployment but this one is created once so
+// other services' rules can keep referring to it through its export of the
+// same name
+func SecurityGroupStackName(serviceName, envName string) string {
+	return fmt.Sprintf("porter-sg-%s-%s", serviceName, envName)
+}
+
+func (recv *Security) setDefaults(envName string) {
+	for _, rules := range [][]*SecurityRule{recv.Ingress, recv.Egress} {
+		for _, rule := range rules {
+			if rule.Service != "" && rule.Environment == "" {
+				rule.Environment = envName
+			}
+
+			if rule.IpProtocol == "" {
+				rule.IpProtocol = "tcp"
+			}
+
+			if rule.ToPort == 0 {
+				rule.ToPort = rule.FromPort
+			}
+		}
+	}
+}
+
+func (recv *Security) print(indent string) {
+	fmt.Println(indent + ".Security.Ingress")
+	for _, rule := range recv.Ingress {
+		rule.print(indent)
+	}
+
+	fmt.Println(indent + ".Security.Egress")
+	for _, rule := range recv.Egress {
+		rule.print(indent)
+	}
+}
+
+func (recv *SecurityRule) print(indent string) {
+	fmt.Println(indent+"- .Name", recv.Name)
+	fmt.Println(indent+"  .Peer", recv.Peer())
+	fmt.Println(indent+"  .IpProtocol", recv.IpProtocol)
+	fmt.Println(indent+"  .FromPort", recv.FromPort)
+	fmt.Println(indent+"  .ToPort", recv.ToPort)
+}
+
+// Peer describes the rule's source or destination for logs
+func (recv *SecurityRule) Peer() string {
+	switch {
+	case recv.Service != "":
+		return "service " + recv.Service + " " + recv.Environment
+	case recv.PrefixList != "":
+		return "prefix list " + recv.PrefixList
+	case recv.CidrIp != "":
+		return "cidr " + recv.CidrIp
+	case recv.ELB:
+		return "elb"
+	}
+	return ""
+}
+
+func (recv *Security) validate(region *Region) error {
+	if !region.HasVpc() {
+		return errors.New("security requires vpc_id or vpc_tags")
+	}
+
+	if len(recv.Egress) > 0 && region.AutoScalingGroup != nil &&
+		len(region.AutoScalingGroup.SecurityGroupEgress) > 0 {
+		return errors.New("security egress and auto_scaling_group security_group_egress can't both be defined")
+	}
+
+	names := make(map[string]struct{})
+
+	for _, rules := range []struct {
+		key   string
+		rules []*SecurityRule
+	}{
+		{"ingress", recv.Ingress},
+		{"egress", recv.Egress},
+	} {
+		for _, rule := range rules.rules {
+			if rule.Name == "" {
+				return fmt.Errorf("Empty or missing security %s rule name", rules.key)
+			}
+
+			if _, exists := names[rule.Name]; exists {
+				return fmt.Errorf("Duplicate security rule %s", rule.Name)
+			}
+			names[rule.Name] = struct{}{}
+
+			err := rule.validate(rules.key, region)
+			if err != nil {
+				return fmt.Errorf("security %s rule %s %s", rules.key, rule.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (recv *SecurityRule) validate(key string, region *Region) error {
+	peers := 0
+	for _, defined := range []bool{recv.Service != "", recv.PrefixList != "", recv.CidrIp != "", recv.ELB} {
+		if defined {
+			peers++
+		}
+	}
+	if peers != 1 {
+		return errors.New("needs exactly one of service, prefix_list, cidr_ip, or elb")
+	}
+
+	if recv.Environment != "" && recv.Service == "" {
+		return errors.New("defines environment without service")
+	}
+
+	if recv.Environment != "" && !environmentNameRegex.MatchString(recv.Environment) {
+		return errors.New("has an invalid environment " + recv.Environment)
+	}
+
+	if recv.PrefixList != "" && !prefixListRegex.MatchString(recv.PrefixList) {
+		return errors.New("has an invalid prefix_list " + recv.PrefixList)
+	}
+
+	if recv.CidrIp != "" {
+		if _, _, err := net.ParseCIDR(recv.CidrIp); err != nil {
+			return errors.New("has an invalid cidr_ip " + recv.CidrIp)
+		}
+	}
+
+	if recv.ELB {
+		if key != "ingress" {
+			return errors.New("can't use elb. It's ingress only")
+		}
+
+		if region.PrimaryTopology() != Topology_Inet || region.DNSToInstances() {
+			return errors.New("uses elb but the region has no ELB")
+		}
+	}
+
+	switch recv.IpProtocol {
+	case "-1":
+		// every protocol on every port
+		return nil
+	case "tcp", "udp", "icmp":
+	default:
+		return errors.New("has an invalid ip_protocol. Valid values are [tcp, udp, icmp, -1]")
+	}
+
+	if recv.IpProtocol != "icmp" {
+		if recv.FromPort < 1 || recv.ToPort > 65535 {
+			return errors.New("needs from_port and to_port between 1 and 65535")
+		}
+
+		if recv.ToPort < recv.FromPort {
+			return errors.New("has a to_port less than its from_port")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SidecarStartOrder returns the sidecars with every sidecar after the ones it
+// depends on. Sidecars that don't depend on each other keep their config order
+func (recv *Container) SidecarStartOrder() ([]*Sidecar, error) {
+
+	started := make(map[string]bool)
+	order := make([]*Sidecar, 0, len(recv.Sidecars))
+
+	for len(order) < len(recv.Sidecars) {
+
+		progress := false
+
+		for _, sidecar := range recv.Sidecars {
+			if started[sidecar.Name] {
+				continue
+			}
+
+			ready := true
+			for _, dependency := range sidecar.DependsOn {
+				if !started[dependency] {
+					ready = false
+					break
+				}
+			}
+
+			if ready {
+				started[sidecar.Name] = true
+				order = append(order, sidecar)
+				progress = true
+			}
+		}
+
+		if !progress {
+			blocked := make([]string, 0)
+			for _, sidecar := range recv.Sidecars {
+				if !started[sidecar.Name] {
+					blocked = append(blocked, sidecar.Name)
+				}
+			}
+
+			return nil, fmt.Errorf("Sidecars on container %s have a dependency cycle [%s]",
+				recv.Name, strings.Join(blocked, ", "))
+		}
+	}
+
+	return order, nil
+}
+
+// PodVolumeNames returns the names of the volumes used by the container or any
+// of its sidecars
+func (recv *Container) PodVolumeNames() []string {
+
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+
+	add := func(volumes []*Volume) {
+		for _, volume := range volumes {
+			if !seen[volume.Name] {
+				seen[volume.Name] = true
+				names = append(names, volume.Name)
+			}
+		}
+	}
+
+	add(recv.Volumes)
+	for _, sidecar := range recv.Sidecars {
+		add(sidecar.Volumes)
+	}
+
+	return names
+}
@@ -0,0 +1,183 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import (
+	"fmt"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// StampEnvironment is the environment a stamp is deployed as. It's a copy of
+// the stamped environment with the stamp's parameters applied. Its name is the
+// environment's name followed by the stamp's so its stacks, ELB tags, and
+// provision state are kept apart from every other stamp's
+func (recv *Environment) StampEnvironment(stamp *Stamp) (*Environment, error) {
+
+	// deep copy
+	environmentBytes, err := yaml.Marshal(recv)
+	if err != nil {
+		return nil, err
+	}
+
+	environment := &Environment{}
+	err = yaml.Unmarshal(environmentBytes, environment)
+	if err != nil {
+		return nil, err
+	}
+
+	environment.Name = recv.Name + stamp.Name
+	environment.Stamps = nil
+	environment.StampName = stamp.Name
+	environment.StampOf = recv.Name
+
+	if stamp.InstanceCount > 0 {
+		environment.InstanceCount = stamp.InstanceCount
+		for _, group := range environment.InstanceGroups {
+			group.InstanceCount = stamp.InstanceCount
+		}
+	}
+
+	if stamp.InstanceType != "" {
+
+		// mixed_instances defaults to the environment's instance type
+		mixed := environment.MixedInstances
+		if mixed != nil && len(mixed.InstanceTypes) == 1 && mixed.InstanceTypes[0] == environment.InstanceType {
+			mixed.InstanceTypes = []string{stamp.InstanceType}
+		}
+
+		environment.InstanceType = stamp.InstanceType
+		for _, group := range environment.InstanceGroups {
+			group.InstanceType = stamp.InstanceType
+		}
+	}
+
+	for _, region := range environment.Regions {
+
+		if stamp.HostedZoneName != "" {
+			region.HostedZoneName = stamp.HostedZoneName
+		}
+
+		// ELBs can't be shared between stamps. ValidateStamps requires every
+		// stamp to bring its own if the environment uses them
+		if len(stamp.ELBs) > 0 {
+			region.ELB = ""
+			region.ELBs = stamp.ELBs
+		}
+
+		for _, container := range region.Containers {
+
+			if container.Environment == nil {
+				container.Environment = make(map[string]string)
+			}
+
+			container.Environment["PORTER_STAMP"] = stamp.Name
+			for name, value := range stamp.Parameters {
+				container.Environment[name] = value
+			}
+		}
+	}
+
+	return environment, nil
+}
+
+func (recv *Config) ValidateStamps() error {
+
+	environmentNames := make(map[string]interface{})
+	for _, environment := range recv.Environments {
+		environmentNames[environment.Name] = nil
+	}
+
+	for _, environment := range recv.Environments {
+
+		elbNames := make(map[string]string)
+
+		for _, stamp := range environment.Stamps {
+
+			if !environmentNameRegex.MatchString(stamp.Name) {
+				return fmt.Errorf("Error in environment [%s] invalid stamp name %q", environment.Name, stamp.Name)
+			}
+
+			stampEnvironmentName := environment.Name + stamp.Name
+			if _, exists := environmentNames[stampEnvironmentName]; exists {
+				return fmt.Errorf("Error in environment [%s] stamp %s is deployed as environment %s which already exists",
+					environment.Name, stamp.Name, stampEnvironmentName)
+			}
+			environmentNames[stampEnvironmentName] = nil
+
+			err := validateStampELBs(environment, stamp)
+			if err != nil {
+				return err
+			}
+
+			for _, elb := range stamp.ELBs {
+				if other, exists := elbNames[elb.Name]; exists && other != stamp.Name {
+					return fmt.Errorf("Error in environment [%s] stamps %s and %s share elb %s",
+						environment.Name, other, stamp.Name, elb.Name)
+				}
+				elbNames[elb.Name] = stamp.Name
+			}
+
+			for name := range stamp.Parameters {
+				if !envVarNameRegex.MatchString(name) {
+					return fmt.Errorf("Error in environment [%s] stamp %s has an invalid parameter name %q",
+						environment.Name, stamp.Name, name)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateStampELBs(environment *Environment, stamp *Stamp) error {
+
+	tags := make(map[string]interface{})
+	for _, region := range environment.Regions {
+		for _, elb := range region.ELBs {
+			tags[elb.ELBTag] = nil
+		}
+	}
+
+	if len(tags) == 0 {
+		if len(stamp.ELBs) > 0 {
+			return fmt.Errorf("Error in environment [%s] stamp %s has elbs but the environment's regions have none",
+				environment.Name, stamp.Name)
+		}
+		return nil
+	}
+
+	if len(stamp.ELBs) == 0 {
+		return fmt.Errorf("Error in environment [%s] stamp %s needs its own elbs. Stamps can't share the regions' ELBs",
+			environment.Name, stamp.Name)
+	}
+
+	stampTags := make(map[string]interface{})
+	for _, elb := range stamp.ELBs {
+		if elb.Name == "" {
+			return fmt.Errorf("Error in environment [%s] stamp %s has an elb without a name",
+				environment.Name, stamp.Name)
+		}
+		if _, exists := tags[elb.ELBTag]; !exists {
+			return fmt.Errorf("Error in environment [%s] stamp %s elb %s has tag %q which no region's elb has",
+				environment.Name, stamp.Name, elb.Name, elb.ELBTag)
+		}
+		stampTags[elb.ELBTag] = nil
+	}
+
+	if len(stampTags) != len(tags) {
+		return fmt.Errorf("Error in environment [%s] stamp %s needs an elb for every elb tag in the environment's regions",
+			environment.Name, stamp.Name)
+	}
+
+	return nil
+}
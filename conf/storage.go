@@ -0,0 +1,211 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/adobe-platform/porter/constants"
+)
+
+// the root device of the Amazon Linux AMI
+const rootDeviceName = "/dev/xvda"
+
+var dataVolumeDeviceRegex = regexp.MustCompile(`^/dev/(sd|xvd)[b-z]$`)
+
+func (recv *Storage) setDefaults() {
+	if recv.RootVolume != nil {
+		if recv.RootVolume.Device == "" {
+			recv.RootVolume.Device = rootDeviceName
+		}
+
+		if recv.RootVolume.Type == "" {
+			recv.RootVolume.Type = "gp3"
+		}
+	}
+
+	for i, volume := range recv.DataVolumes {
+		// sdf is the first device the EC2 docs recommend for EBS volumes
+		if volume.Device == "" {
+			volume.Device = fmt.Sprintf("/dev/sd%c", 'f'+i)
+		}
+
+		if volume.Type == "" {
+			volume.Type = "gp3"
+		}
+
+		// pod volumes live on the first data volume
+		if volume.MountPath == "" && i == 0 {
+			volume.MountPath = constants.ContainerVolumesPath
+		}
+
+		if volume.FileSystem == "" {
+			volume.FileSystem = "ext4"
+		}
+	}
+}
+
+func (recv *Storage) print(indent string) {
+	fmt.Println(indent+".Storage.Encrypted", recv.Encrypted)
+	fmt.Println(indent+".Storage.KmsKeyId", recv.KmsKeyId)
+	if recv.RootVolume != nil {
+		fmt.Println(indent + ".Storage.RootVolume")
+		recv.RootVolume.print(indent)
+	}
+
+	fmt.Println(indent + ".Storage.DataVolumes")
+	for _, volume := range recv.DataVolumes {
+		volume.print(indent)
+		fmt.Println(indent+"  .MountPath", volume.MountPath)
+		fmt.Println(indent+"  .FileSystem", volume.FileSystem)
+	}
+}
+
+func (recv *EBSVolume) print(indent string) {
+	fmt.Println(indent+"- .Device", recv.Device)
+	fmt.Println(indent+"  .Size", recv.Size)
+	fmt.Println(indent+"  .Type", recv.Type)
+	fmt.Println(indent+"  .Iops", recv.Iops)
+	fmt.Println(indent+"  .Throughput", recv.Throughput)
+}
+
+func (recv *Environment) ValidateStorage() error {
+	storage := recv.Storage
+	if storage == nil {
+		return nil
+	}
+
+	if storage.KmsKeyId != "" {
+		if !storage.Encrypted {
+			return errors.New("storage kms_key_id requires encrypted: true")
+		}
+
+		if !kmsKeyIdRegex.MatchString(storage.KmsKeyId) {
+			return errors.New("storage has an invalid kms_key_id " + storage.KmsKeyId)
+		}
+	}
+
+	if storage.RootVolume != nil {
+		if !strings.HasPrefix(storage.RootVolume.Device, "/dev/") {
+			return errors.New("storage root_volume has an invalid device " + storage.RootVolume.Device)
+		}
+
+		// HDD volumes can't be boot volumes
+		switch storage.RootVolume.Type {
+		case "st1", "sc1":
+			return errors.New("storage root_volume can't be " + storage.RootVolume.Type)
+		}
+
+		// 0 keeps the AMI's size
+		err := storage.RootVolume.validate(0)
+		if err != nil {
+			return fmt.Errorf("storage root_volume %s", err)
+		}
+	}
+
+	devices := map[string]struct{}{rootDeviceName: {}}
+	if storage.RootVolume != nil {
+		devices[storage.RootVolume.Device] = struct{}{}
+	}
+	mountPaths := make(map[string]struct{})
+
+	for _, volume := range storage.DataVolumes {
+		if !dataVolumeDeviceRegex.MatchString(volume.Device) {
+			return errors.New("storage data_volumes has an invalid device " + volume.Device +
+				". Use /dev/sd[b-z] or /dev/xvd[b-z]")
+		}
+
+		if _, exists := devices[volume.Device]; exists {
+			return errors.New("storage data_volumes has a duplicate device " + volume.Device)
+		}
+		devices[volume.Device] = struct{}{}
+
+		err := volume.validate(1)
+		if err != nil {
+			return fmt.Errorf("storage data_volumes %s %s", volume.Device, err)
+		}
+
+		if volume.MountPath == "" {
+			return fmt.Errorf("storage data_volumes %s needs a mount_path", volume.Device)
+		}
+
+		if !path.IsAbs(volume.MountPath) || path.Clean(volume.MountPath) != volume.MountPath ||
+			volume.MountPath == "/" {
+			return fmt.Errorf("storage data_volumes %s has an invalid mount_path %s", volume.Device, volume.MountPath)
+		}
+
+		if _, exists := mountPaths[volume.MountPath]; exists {
+			return errors.New("storage data_volumes has a duplicate mount_path " + volume.MountPath)
+		}
+		mountPaths[volume.MountPath] = struct{}{}
+
+		switch volume.FileSystem {
+		case "ext4", "xfs":
+		default:
+			return fmt.Errorf("storage data_volumes %s has an invalid file_system. Valid values are [ext4, xfs]", volume.Device)
+		}
+	}
+
+	return nil
+}
+
+// validate checks the size and performance of a volume. minSize is the
+// smallest size that can be defined
+func (recv *EBSVolume) validate(minSize int) error {
+	if recv.Size < minSize || recv.Size > 16384 {
+		return fmt.Errorf("size must be between %d and 16384", minSize)
+	}
+
+	switch recv.Type {
+	case "gp3":
+		if recv.Iops != 0 && (recv.Iops < 3000 || recv.Iops > 16000) {
+			return errors.New("iops must be between 3000 and 16000 for gp3")
+		}
+
+		if recv.Throughput != 0 && (recv.Throughput < 125 || recv.Throughput > 1000) {
+			return errors.New("throughput must be between 125 and 1000 for gp3")
+		}
+		return nil
+
+	case "io1", "io2":
+		if recv.Iops < 100 || recv.Iops > 64000 {
+			return fmt.Errorf("iops must be between 100 and 64000 for %s", recv.Type)
+		}
+
+	case "gp2", "standard":
+		if recv.Iops != 0 {
+			return fmt.Errorf("can't define iops for %s", recv.Type)
+		}
+
+	case "st1", "sc1":
+		if recv.Size != 0 && recv.Size < 125 {
+			return fmt.Errorf("size must be at least 125 for %s", recv.Type)
+		}
+
+		if recv.Iops != 0 {
+			return fmt.Errorf("can't define iops for %s", recv.Type)
+		}
+
+	default:
+		return errors.New("has an invalid type. Valid values are [gp3, gp2, io1, io2, st1, sc1, standard]")
+	}
+
+	if recv.Throughput != 0 {
+		return fmt.Errorf("can't define throughput for %s. It's gp3 only", recv.Type)
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// DefaultSecurityPolicy is the TLS negotiation policy of the HTTPS listeners
+// unless tls defines security_policy
+const DefaultSecurityPolicy = "ELBSecurityPolicy-TLS-1-2-2017-01"
+
+var (
+	certificateARNRegex = regexp.MustCompile(`^arn:aws[-a-z]*:(acm:[a-z0-9-]+:\d{12}:certificate|iam::\d{12}:server-certificate)/.+$`)
+	domainNameRegex     = regexp.MustCompile(`^(\*\.)?([a-zA-Z0-9-]+\.)+[a-zA-Z]{2,}$`)
+	hostedZoneIdRegex   = regexp.MustCompile(`^Z[A-Z0-9]{1,31}$`)
+	securityPolicyRegex = regexp.MustCompile(`^ELBSecurityPolicy-[-a-zA-Z0-9]+$`)
+)
+
+// CertificateStackName is the stack that holds the certificate requested for
+// a region's tls domain_name. It outlives the provisioned stacks so the
+// certificate is only requested and validated once
+func CertificateStackName(serviceName, envName string) string {
+	return fmt.Sprintf("porter-tls-%s-%s", serviceName, envName)
+}
+
+// RequestsCertificate is true if porter requests the certificate from ACM
+func (recv *TLS) RequestsCertificate() bool {
+	return recv.DomainName != ""
+}
+
+func (recv *TLS) setDefaults() {
+	if recv.SecurityPolicy == "" {
+		recv.SecurityPolicy = DefaultSecurityPolicy
+	}
+}
+
+func (recv *TLS) print(indent string) {
+	fmt.Println(indent+".TLS.CertificateARN", recv.CertificateARN)
+	fmt.Println(indent+".TLS.DomainName", recv.DomainName)
+	fmt.Println(indent+".TLS.SubjectAlternativeNames", recv.SubjectAlternativeNames)
+	fmt.Println(indent+".TLS.HostedZoneId", recv.HostedZoneId)
+	fmt.Println(indent+".TLS.SecurityPolicy", recv.SecurityPolicy)
+	fmt.Println(indent+".TLS.RedirectHTTP", recv.RedirectHTTP)
+}
+
+func (recv *TLS) validate(region *Region) error {
+	if region.SSLCertARN != "" {
+		return errors.New("tls and ssl_cert_arn can't both be defined")
+	}
+
+	if region.PrimaryTopology() != Topology_Inet {
+		return errors.New("tls requires an inet container")
+	}
+
+	if (recv.CertificateARN == "") == (recv.DomainName == "") {
+		return errors.New("tls needs exactly one of certificate_arn or domain_name")
+	}
+
+	if recv.CertificateARN != "" && !certificateARNRegex.MatchString(recv.CertificateARN) {
+		return errors.New("Invalid tls certificate_arn " + recv.CertificateARN)
+	}
+
+	if !securityPolicyRegex.MatchString(recv.SecurityPolicy) {
+		return errors.New("Invalid tls security_policy " + recv.SecurityPolicy)
+	}
+
+	if !recv.RequestsCertificate() {
+		if len(recv.SubjectAlternativeNames) > 0 || recv.HostedZoneId != "" {
+			return errors.New("tls subject_alternative_names and hosted_zone_id require domain_name")
+		}
+		return nil
+	}
+
+	for _, domainName := range append([]string{recv.DomainName}, recv.SubjectAlternativeNames...) {
+		if !domainNameRegex.MatchString(domainName) {
+			return errors.New("Invalid tls domain name " + domainName)
+		}
+	}
+
+	// ACM's validation records are created in the zone
+	if !hostedZoneIdRegex.MatchString(recv.HostedZoneId) {
+		return errors.New("tls domain_name requires a valid hosted_zone_id")
+	}
+
+	return nil
+}
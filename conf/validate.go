@@ -14,10 +14,18 @@ package conf
 import (
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path"
+	"regexp"
 	"strings"
+	"text/template"
+	"time"
 
+	"github.com/adobe-platform/porter/command_queue"
 	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/util"
 )
 
 func (recv *Config) Validate() (err error) {
@@ -32,16 +40,66 @@ func (recv *Config) Validate() (err error) {
 		return
 	}
 
+	err = recv.ValidateStateStore()
+	if err != nil {
+		return
+	}
+
+	err = recv.ValidateAuth()
+	if err != nil {
+		return
+	}
+
+	err = recv.ValidateAWSRetry()
+	if err != nil {
+		return
+	}
+
+	err = recv.ValidatePayloadCompression()
+	if err != nil {
+		return
+	}
+
+	err = recv.ValidateArtifactStore()
+	if err != nil {
+		return
+	}
+
+	err = recv.ValidateDeployConcurrency()
+	if err != nil {
+		return
+	}
+
+	err = recv.ValidateSecretsPayload()
+	if err != nil {
+		return
+	}
+
 	err = recv.ValidateHooks()
 	if err != nil {
 		return
 	}
 
+	err = validateNotificationTemplates("slack", recv.Slack.SuccessTemplate, recv.Slack.FailureTemplate)
+	if err != nil {
+		return
+	}
+
 	err = recv.ValidateEnvironments()
 	if err != nil {
 		return
 	}
 
+	err = recv.ValidateStamps()
+	if err != nil {
+		return
+	}
+
+	err = recv.ValidatePipeline()
+	if err != nil {
+		return
+	}
+
 	return
 }
 
@@ -87,6 +145,181 @@ func (recv *Config) ValidateRegistryConfig() error {
 			constants.EnvDockerPushPassword, constants.EnvDockerPushUsername)
 	}
 
+	if recv.ECR != nil {
+
+		if dockerRegistry != "" {
+			return fmt.Errorf("ecr and %s are mutually exclusive", constants.EnvDockerRegistry)
+		}
+
+		if len(recv.ECR.Repository) < 2 || len(recv.ECR.Repository) > 256 ||
+			!ecrRepositoryRegex.MatchString(recv.ECR.Repository) {
+			return errors.New("Invalid ecr repository")
+		}
+
+		if recv.ECR.MaxImageCount < 1 || recv.ECR.MaxImageCount > 1000 {
+			return errors.New("ecr max_image_count must be between 1 and 1000")
+		}
+	}
+
+	return nil
+}
+
+func (recv *Config) ValidateStateStore() error {
+	if recv.StateStore == nil {
+		return nil
+	}
+
+	if !dynamoDBTableRegex.MatchString(recv.StateStore.DynamoDBTable) {
+		return errors.New("Invalid state_store dynamodb_table")
+	}
+
+	if recv.StateStore.Region == "" {
+		return errors.New("state_store region is required")
+	}
+
+	if recv.StateStore.RoleARN != "" && !roleARNRegex.MatchString(recv.StateStore.RoleARN) {
+		return errors.New("Invalid state_store role_arn")
+	}
+
+	return nil
+}
+
+func (recv *Config) ValidateDeployConcurrency() error {
+	concurrency := recv.DeployConcurrency
+	if concurrency == nil {
+		return nil
+	}
+
+	if !dynamoDBTableRegex.MatchString(concurrency.DynamoDBTable) {
+		return errors.New("Invalid deploy_concurrency dynamodb_table")
+	}
+
+	if concurrency.Region == "" {
+		return errors.New("deploy_concurrency region is required")
+	}
+
+	if concurrency.RoleARN != "" && !roleARNRegex.MatchString(concurrency.RoleARN) {
+		return errors.New("Invalid deploy_concurrency role_arn")
+	}
+
+	if concurrency.Limit < 1 {
+		return errors.New("deploy_concurrency limit must be at least 1")
+	}
+
+	if concurrency.MaxWait < 0 {
+		return errors.New("deploy_concurrency max_wait can't be negative")
+	}
+
+	return nil
+}
+
+func (recv *Config) ValidateAuth() error {
+	if recv.Auth == nil || recv.Auth.RolesAnywhere == nil {
+		return nil
+	}
+	rolesAnywhere := recv.Auth.RolesAnywhere
+
+	if rolesAnywhere.Certificate == "" || rolesAnywhere.PrivateKey == "" {
+		return errors.New("auth roles_anywhere certificate and private_key are required")
+	}
+
+	if !trustAnchorARNRegex.MatchString(rolesAnywhere.TrustAnchorARN) {
+		return errors.New("Invalid auth roles_anywhere trust_anchor_arn")
+	}
+
+	if !rolesProfileARNRegex.MatchString(rolesAnywhere.ProfileARN) {
+		return errors.New("Invalid auth roles_anywhere profile_arn")
+	}
+
+	if !roleARNRegex.MatchString(rolesAnywhere.RoleARN) {
+		return errors.New("Invalid auth roles_anywhere role_arn")
+	}
+
+	if rolesAnywhere.Region != "" &&
+		rolesAnywhere.Region != strings.Split(rolesAnywhere.TrustAnchorARN, ":")[3] {
+		return errors.New("auth roles_anywhere region must be the region of the trust_anchor_arn")
+	}
+
+	if rolesAnywhere.SessionDuration != 0 &&
+		(rolesAnywhere.SessionDuration < constants.RolesAnywhereMinSessionDuration ||
+			rolesAnywhere.SessionDuration > constants.RolesAnywhereMaxSessionDuration) {
+		return fmt.Errorf("auth roles_anywhere session_duration must be between %d and %d",
+			constants.RolesAnywhereMinSessionDuration, constants.RolesAnywhereMaxSessionDuration)
+	}
+
+	return nil
+}
+
+func (recv *Config) ValidateAWSRetry() error {
+	if recv.AWSRetry == nil {
+		return nil
+	}
+
+	if recv.AWSRetry.MaxAttempts < 0 {
+		return errors.New("aws_retry max_attempts can't be negative")
+	}
+
+	if recv.AWSRetry.BaseDelayMs < 0 || recv.AWSRetry.MaxDelayMs < 0 {
+		return errors.New("aws_retry delays can't be negative")
+	}
+
+	if recv.AWSRetry.MaxDelayMs != 0 && recv.AWSRetry.MaxDelayMs < recv.AWSRetry.BaseDelayMs {
+		return errors.New("aws_retry max_delay_ms must be at least base_delay_ms")
+	}
+
+	for operation, attempts := range recv.AWSRetry.Operations {
+		if !awsOperationRegex.MatchString(operation) {
+			return fmt.Errorf("Invalid aws_retry operation %s. Use an operation like CreateStack or s3:HeadObject", operation)
+		}
+
+		if attempts < 1 {
+			return fmt.Errorf("aws_retry operation %s needs at least 1 attempt", operation)
+		}
+	}
+
+	return nil
+}
+
+func (recv *Config) ValidatePayloadCompression() error {
+	if recv.PayloadCompression == nil {
+		return nil
+	}
+
+	if level := recv.PayloadCompression.Level; level != nil && (*level < 0 || *level > 9) {
+		return errors.New("payload_compression level must be between 0 and 9")
+	}
+
+	if recv.PayloadCompression.Threads < 0 {
+		return errors.New("payload_compression threads can't be negative")
+	}
+
+	return nil
+}
+
+func (recv *Config) ValidateArtifactStore() error {
+	if recv.ArtifactStore == nil {
+		return nil
+	}
+
+	switch recv.ArtifactStore.Type {
+	case ArtifactStore_S3:
+	case ArtifactStore_GCS:
+		if !gcsBucketRegex.MatchString(recv.ArtifactStore.Bucket) {
+			return errors.New("artifact_store bucket is an invalid GCS bucket name")
+		}
+	case ArtifactStore_HTTP:
+		baseURL, err := url.Parse(recv.ArtifactStore.BaseURL)
+		if err != nil || (baseURL.Scheme != "http" && baseURL.Scheme != "https") || baseURL.Host == "" {
+			return errors.New("artifact_store base_url must be an http or https URL")
+		}
+	default:
+		return errors.New("artifact_store type must be one of s3, gcs, or http")
+	}
+
+	if recv.ArtifactStore.TokenEnv != "" && !envVarNameRegex.MatchString(recv.ArtifactStore.TokenEnv) {
+		return errors.New("artifact_store token_env is an invalid environment variable name")
+	}
+
 	return nil
 }
 
@@ -133,6 +366,57 @@ func (recv *Config) ValidateHooks() (err error) {
 					hook.RunCondition, name)
 			}
 
+			if hook.Timeout < 0 {
+				return fmt.Errorf("A %s hook has a negative timeout", name)
+			}
+
+			switch hook.RunsOn {
+			case constants.HRO_Local:
+				if hook.Image != "" || hook.Command != "" {
+					return fmt.Errorf("A %s hook has an image or command but doesn't run on %s", name, constants.HRO_Remote)
+				}
+
+				if len(hook.Secrets) > 0 {
+					return fmt.Errorf("A %s hook has secrets but doesn't run on %s", name, constants.HRO_Remote)
+				}
+			case constants.HRO_Remote:
+				// pack hooks don't run for an environment and ec2_bootstrap's
+				// output is captured from its container
+				switch name {
+				case constants.HookPrePack,
+					constants.HookPostPack,
+					constants.HookEC2Bootstrap:
+					return fmt.Errorf("A %s hook can't run on %s", name, constants.HRO_Remote)
+				}
+
+				if hook.Image == "" || hook.Command == "" {
+					return fmt.Errorf("A %s hook that runs on %s needs an image and a command", name, constants.HRO_Remote)
+				}
+
+				if hook.Repo != "" || hook.Dockerfile != "" {
+					return fmt.Errorf("A %s hook that runs on %s can't have a repo or dockerfile", name, constants.HRO_Remote)
+				}
+
+				// CodeBuild timeouts are whole minutes from 5 to 480
+				if hook.Timeout > 480*60 {
+					return fmt.Errorf("A %s hook that runs on %s has a timeout over 8 hours", name, constants.HRO_Remote)
+				}
+
+				for key, source := range hook.Secrets {
+					if key == "" || source == "" {
+						return fmt.Errorf("A %s hook has a secret without a name or an SSM parameter or Secrets Manager ARN", name)
+					}
+
+					if _, exists := hook.Environment[key]; exists {
+						return fmt.Errorf("A %s hook has %s in both environment and secrets", name, key)
+					}
+				}
+
+				continue
+			default:
+				return fmt.Errorf("Invalid runs_on [%s] on a %s hook", hook.RunsOn, name)
+			}
+
 			if hook.Repo == "" {
 
 				if hook.Dockerfile == "" {
@@ -150,6 +434,58 @@ func (recv *Config) ValidateHooks() (err error) {
 	return nil
 }
 
+func (recv *Config) ValidatePipeline() error {
+	seen := make(map[string]struct{})
+
+	for i, stage := range recv.Pipeline {
+
+		if _, err := recv.GetEnvironment(stage.Environment); err != nil {
+			return fmt.Errorf("pipeline stage %d: %s", i, err)
+		}
+
+		if _, exists := seen[stage.Environment]; exists {
+			return fmt.Errorf("The environment %s appears in the pipeline more than once",
+				stage.Environment)
+		}
+		seen[stage.Environment] = struct{}{}
+
+		// gates check the previous stage so the first one has nothing to check
+		if i == 0 && len(stage.Gates) > 0 {
+			return errors.New("The first pipeline stage can't have gates")
+		}
+
+		for _, gate := range stage.Gates {
+
+			var gateCount int
+
+			if gate.Hook != "" {
+				gateCount++
+
+				if _, exists := recv.Hooks[gate.Hook]; !exists {
+					return fmt.Errorf("The pipeline gate hook %s isn't defined in hooks", gate.Hook)
+				}
+			}
+
+			if gate.SoakTime < 0 {
+				return fmt.Errorf("Invalid pipeline gate soak_time %d", gate.SoakTime)
+			} else if gate.SoakTime > 0 {
+				gateCount++
+			}
+
+			if gate.Approval {
+				gateCount++
+			}
+
+			if gateCount != 1 {
+				return fmt.Errorf("A pipeline gate on %s must set exactly one of hook, soak_time, or approval",
+					stage.Environment)
+			}
+		}
+	}
+
+	return nil
+}
+
 func (recv *Config) ValidateEnvironments() error {
 	if len(recv.Environments) == 0 {
 		return errors.New("No environments defined")
@@ -171,6 +507,10 @@ func (recv *Config) ValidateEnvironments() error {
 			}
 		}
 
+		if environment.CFNRoleARN != "" && !roleARNRegex.MatchString(environment.CFNRoleARN) {
+			return errors.New("Invalid cfn_role_arn for environment " + environment.Name)
+		}
+
 		for _, region := range environment.Regions {
 			err := ValidateRegion(region, validateRegionRoleArn)
 			if err != nil {
@@ -185,99 +525,1857 @@ func (recv *Config) ValidateEnvironments() error {
 		if !environmentNameRegex.MatchString(environment.Name) {
 			return errors.New("Invalid name for environment [" + environment.Name + "]. Valid characters are [0-9a-zA-Z]")
 		}
-	}
 
-	return nil
-}
+		err := environment.ValidatePreset()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
 
-func ValidateRegion(region *Region, validateRoleArn bool) error {
+		err = environment.ValidateMixedInstances()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
 
-	err := region.ValidateContainers()
-	if err != nil {
-		return err
-	}
+		err = environment.ValidateInstanceGroups()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
 
-	if _, exists := constants.AwsRegions[region.Name]; !exists {
-		return errors.New("Invalid region name " + region.Name)
-	}
+		err = environment.ValidateUpdatePolicy()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
 
-	if validateRoleArn && !roleARNRegex.MatchString(region.RoleARN) {
-		return errors.New("Invalid role_arn for region " + region.Name)
-	}
+		err = environment.ValidateCreationPolicy()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
 
-	// TODO validate characters
-	if region.HostedZoneName != "" {
-		// normalize with ending period
-		region.HostedZoneName = strings.TrimRight(region.HostedZoneName, ".") + "."
-	}
+		err = environment.ValidateInstanceRefresh()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
 
-	// TODO validate the bucket prefix is one that S3 allows
-	if region.S3Bucket == "" {
-		return errors.New("Empty or missing s3_bucket")
-	}
+		err = environment.ValidateSpot()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
 
-	if len(region.AZs) == 0 {
-		return errors.New("Missing availability zone for region " + region.Name)
-	}
+		err = environment.ValidateScaling()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
 
-	definedVPC := false
-	if region.VpcId != "" {
-		definedVPC = true
-		if !vpcIdRegex.MatchString(region.VpcId) {
-			return errors.New("Invalid vpc_id for region " + region.Name)
+		err = environment.ValidateMonitoring()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
 		}
-	}
 
-	for _, az := range region.AZs {
-		if az.Name == "" {
-			return errors.New("Empty AZ name for region " + region.Name)
+		err = environment.ValidateWAF()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
 		}
 
-		if definedVPC {
-			if !subnetIdRegex.MatchString(az.SubnetID) {
-				return errors.New("Invalid subnet_id for region " + region.Name)
-			}
-		} else {
-			if az.SubnetID != "" {
-				return errors.New("Defined subnet_id but no vpc_id for region " + region.Name)
-			}
+		switch environment.Confirm {
+		case Confirm_None, Confirm_Yes, Confirm_Name:
+		default:
+			return fmt.Errorf("Invalid confirm %s in environment [%s]. Valid values are [%s, %s, %s]",
+				environment.Confirm, environment.Name, Confirm_None, Confirm_Yes, Confirm_Name)
 		}
-	}
 
-	return nil
-}
+		err = environment.ValidateLogging()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
 
-func (recv *Region) ValidateContainers() error {
+		err = environment.ValidateHardening()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
 
-	containerCount := len(recv.Containers)
-	if containerCount == 0 {
+		err = environment.ValidateAccess()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
 
-		return errors.New("No containers are defined. Was SetDefaults() run?")
-	}
+		err = environment.ValidatePermissionPreflight()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
 
-	var healthCheckMethod string
-	var healthCheckPath string
+		err = environment.ValidatePressure()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
 
-	containerNames := make(map[string]interface{})
-	for _, container := range recv.Containers {
+		err = environment.ValidateDiskGC()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
 
-		if container.SrcEnvFile != nil {
+		err = environment.ValidateCommandQueue(recv.ServiceName)
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
 
-			if container.SrcEnvFile.S3Bucket != "" ||
-				container.SrcEnvFile.S3Key != "" {
+		err = environment.ValidateMetadataOptions()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
 
-				if container.SrcEnvFile.S3Bucket == "" {
-					return errors.New("src_env_file missing s3_bucket")
-				}
+		err = environment.ValidateStorage()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
 
-				if container.SrcEnvFile.S3Key == "" {
-					return errors.New("src_env_file missing s3_key")
-				}
+		err = environment.ValidateArchitectures()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
 
-			} else if container.SrcEnvFile.ExecName == "" {
+		err = environment.ValidateAMI()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
 
-				return errors.New("src_env_file missing exec_name")
-			}
+		err = environment.ValidateBake()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
+
+		err = environment.ValidateDrain()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
+
+		err = environment.ValidateTemplateRules()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
+
+		if environment.Notifications != nil {
+			err = validateNotificationTemplates("notifications",
+				environment.Notifications.SuccessTemplate, environment.Notifications.FailureTemplate)
+			if err != nil {
+				return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+			}
+
+			err = environment.ValidateNotifications()
+			if err != nil {
+				return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+			}
+		}
+
+		if environment.DeployMetrics != nil {
+			err = environment.ValidateDeployMetrics()
+			if err != nil {
+				return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+			}
+		}
+
+		if environment.DeploySLO != nil {
+			err = environment.ValidateDeploySLO()
+			if err != nil {
+				return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+			}
+		}
+
+		err = environment.ValidateDependencies()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
+
+		err = environment.ValidateDependencyChecks()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
+
+		err = environment.ValidateCompute(recv.RegistryDeployment())
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
+
+		err = environment.ValidateDNS()
+		if err != nil {
+			return errors.New("Error in environment [" + environment.Name + "] " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (recv *Environment) ValidatePreset() error {
+	if recv.Preset == "" {
+		return nil
+	}
+
+	if _, exists := presets[recv.Preset]; !exists {
+		return fmt.Errorf("Invalid preset. Valid values are [%s, %s, %s]",
+			Preset_WebService, Preset_Worker, Preset_InternalAPI)
+	}
+
+	return nil
+}
+
+func (recv *Environment) ValidateMixedInstances() error {
+	mixed := recv.MixedInstances
+	if mixed == nil {
+		return nil
+	}
+
+	for _, instanceType := range mixed.InstanceTypes {
+		if _, exists := constants.AwsInstanceTypes[instanceType]; !exists {
+			return errors.New("Invalid mixed_instances instance_type " + instanceType)
+		}
+	}
+
+	if mixed.OnDemandBaseCapacity < 0 {
+		return errors.New("Invalid mixed_instances on_demand_base_capacity")
+	}
+
+	if *mixed.OnDemandPercentageAboveBaseCapacity < 0 ||
+		*mixed.OnDemandPercentageAboveBaseCapacity > 100 {
+		return errors.New("mixed_instances on_demand_percentage_above_base_capacity must be between 0 and 100")
+	}
+
+	switch mixed.OnDemandAllocationStrategy {
+	case "prioritized", "lowest-price":
+	default:
+		return errors.New("Invalid mixed_instances on_demand_allocation_strategy. Valid values are [prioritized, lowest-price]")
+	}
+
+	switch mixed.SpotAllocationStrategy {
+	case "capacity-optimized", "capacity-optimized-prioritized", "lowest-price":
+	default:
+		return errors.New("Invalid mixed_instances spot_allocation_strategy. Valid values are [capacity-optimized, capacity-optimized-prioritized, lowest-price]")
+	}
+
+	return nil
+}
+
+// ValidateInstanceGroups checks that every container runs in exactly one
+// declared instance group and that every group runs at least one container
+func (recv *Environment) ValidateInstanceGroups() error {
+	if len(recv.InstanceGroups) == 0 {
+
+		for _, region := range recv.Regions {
+			for _, container := range region.Containers {
+				if container.InstanceGroup != "" {
+					return fmt.Errorf("Container %s has an instance_group but no instance_groups are defined", container.Name)
+				}
+			}
+		}
+
+		return nil
+	}
+
+	// these configure the one launch template and autoscaling group that
+	// instance groups replace
+	if recv.InstanceRefresh != nil {
+		return errors.New("instance_refresh isn't supported with instance_groups")
+	}
+
+	if recv.MixedInstances != nil {
+		return errors.New("mixed_instances isn't supported with instance_groups")
+	}
+
+	if recv.Spot != nil {
+		return errors.New("spot isn't supported with instance_groups")
+	}
+
+	groupNames := make(map[string]interface{})
+	for _, group := range recv.InstanceGroups {
+
+		if !instanceGroupRegex.MatchString(group.Name) {
+			return errors.New("Invalid instance_groups name [" + group.Name + "]. Valid characters are [0-9a-zA-Z]")
+		}
+
+		if _, exists := groupNames[group.Name]; exists {
+			return errors.New("Duplicate instance_groups name " + group.Name)
+		}
+		groupNames[group.Name] = nil
+
+		if _, exists := constants.AwsInstanceTypes[group.InstanceType]; !exists {
+			return errors.New("Invalid instance_type for instance group " + group.Name)
+		}
+	}
+
+	for _, region := range recv.Regions {
+
+		groupContainers := make(map[string]int)
+		inetGroup := ""
+
+		for _, container := range region.Containers {
+
+			if container.InstanceGroup == "" {
+				return fmt.Errorf("Container %s is missing an instance_group in region %s", container.Name, region.Name)
+			}
+
+			if _, exists := groupNames[container.InstanceGroup]; !exists {
+				return fmt.Errorf("Container %s has an undefined instance_group %s", container.Name, container.InstanceGroup)
+			}
+			groupContainers[container.InstanceGroup]++
+
+			// the provisioned ELB and routes send traffic to a single group
+			if container.Topology == Topology_Inet {
+				if inetGroup == "" {
+					inetGroup = container.InstanceGroup
+				} else if inetGroup != container.InstanceGroup {
+					return errors.New("All inet containers must be in the same instance_group in region " + region.Name)
+				}
+			}
+		}
+
+		for _, group := range recv.InstanceGroups {
+			if groupContainers[group.Name] == 0 {
+				return fmt.Errorf("Instance group %s has no containers in region %s", group.Name, region.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (recv *Environment) ValidateUpdatePolicy() error {
+	policy := recv.UpdatePolicy
+	if policy == nil {
+		return nil
+	}
+
+	if policy.RollingUpdate == nil && !policy.ReplacingUpdate {
+		return errors.New("update_policy must define rolling_update or replacing_update")
+	}
+
+	if policy.RollingUpdate != nil && policy.ReplacingUpdate {
+		return errors.New("update_policy rolling_update and replacing_update are mutually exclusive")
+	}
+
+	if recv.InstanceRefresh != nil {
+		return errors.New("update_policy and instance_refresh both replace instances on update. Choose one")
+	}
+
+	rolling := policy.RollingUpdate
+	if rolling == nil {
+		return nil
+	}
+
+	if rolling.MaxBatchSize < 1 {
+		return errors.New("update_policy rolling_update max_batch_size must be at least 1")
+	}
+
+	if rolling.MinInstancesInService < 0 || uint(rolling.MinInstancesInService) >= recv.InstanceCount {
+		return errors.New("update_policy rolling_update min_instances_in_service must be at least 0 and less than instance_count")
+	}
+
+	// CloudFormation caps PauseTime at PT1H
+	if rolling.PauseTime < 0 || rolling.PauseTime > 3600 {
+		return errors.New("update_policy rolling_update pause_time must be between 0 and 3600")
+	}
+
+	return nil
+}
+
+func (recv *Environment) ValidateCreationPolicy() error {
+	policy := recv.CreationPolicy
+	if policy == nil {
+		return nil
+	}
+
+	if policy.SignalCount > recv.TotalInstanceCount() {
+		return errors.New("creation_policy signal_count can't be greater than the instance count")
+	}
+
+	// the stack times out before a longer WaitCondition would
+	maxTimeout := int(constants.StackCreationTimeout().Seconds())
+	if policy.Timeout < 0 || policy.Timeout > maxTimeout {
+		return fmt.Errorf("creation_policy timeout must be between 0 and the stack creation timeout %d. %s can raise it to 3600",
+			maxTimeout, constants.EnvStackCreation)
+	}
+
+	return nil
+}
+
+func (recv *Environment) ValidateInstanceRefresh() error {
+	refresh := recv.InstanceRefresh
+	if refresh == nil {
+		return nil
+	}
+
+	if recv.Hotswap {
+		return errors.New("hot_swap and instance_refresh both update stacks in place. Choose one")
+	}
+
+	if *refresh.MinHealthyPercentage < 0 || *refresh.MinHealthyPercentage > 100 {
+		return errors.New("instance_refresh min_healthy_percentage must be between 0 and 100")
+	}
+
+	if *refresh.InstanceWarmup < 0 {
+		return errors.New("instance_refresh instance_warmup can't be negative")
+	}
+
+	return nil
+}
+
+func (recv *Environment) ValidateSpot() error {
+	spot := recv.Spot
+	if spot == nil {
+		return nil
+	}
+
+	mixed := recv.MixedInstances
+
+	switch spot.Mode {
+	case SpotMode_Pure:
+		if mixed.OnDemandBaseCapacity != 0 || *mixed.OnDemandPercentageAboveBaseCapacity != 0 {
+			return errors.New("spot mode pure doesn't allow on-demand capacity in mixed_instances. Use mode mixed")
+		}
+	case SpotMode_Mixed:
+		if *mixed.OnDemandPercentageAboveBaseCapacity == 100 {
+			return errors.New("spot mode mixed requires mixed_instances on_demand_percentage_above_base_capacity below 100")
+		}
+	default:
+		return fmt.Errorf("Invalid spot mode. Valid values are [%s, %s]",
+			SpotMode_Pure, SpotMode_Mixed)
+	}
+
+	// EC2 gives 2 minutes notice. Leave time to leave the load balancer
+	if spot.DrainTimeout < 1 || spot.DrainTimeout > constants.SpotMaxDrainTimeout {
+		return fmt.Errorf("spot drain_timeout must be between 1 and %d", constants.SpotMaxDrainTimeout)
+	}
+
+	return nil
+}
+
+// ValidateScaling checks the environment's scaling and each region's. Scheduled
+// actions in the same time zone can't run at the same minute because the
+// autoscaling group would end up with whichever ran last
+func (recv *Environment) ValidateScaling() error {
+	for _, region := range recv.Regions {
+		scaling, err := recv.GetScaling(region.Name)
+		if err != nil {
+			return err
+		}
+
+		// the ALB only exists in inet regions with container routes
+		if scaling != nil && scaling.TargetALBRequestsPerTarget != 0 &&
+			(region.PrimaryTopology() != Topology_Inet || !region.HasRoutes()) {
+			return fmt.Errorf("scaling target_alb_requests_per_target requires container routes in %s", region.Name)
+		}
+	}
+
+	scalings := []*Scaling{recv.Scaling}
+	for _, region := range recv.Regions {
+		scalings = append(scalings, region.Scaling)
+	}
+
+	for _, scaling := range scalings {
+		if scaling == nil {
+			continue
+		}
+
+		if recv.Compute == Compute_ECS {
+			return errors.New("scaling isn't supported with compute ecs")
+		}
+
+		if len(recv.InstanceGroups) > 0 {
+			return errors.New("scaling isn't supported with instance_groups")
+		}
+
+		if scaling.MaxSize != 0 && scaling.MaxSize < recv.InstanceCount {
+			return fmt.Errorf("scaling max_size must be at least instance_count %d", recv.InstanceCount)
+		}
+
+		if scaling.TargetCPU < 0 || scaling.TargetCPU > 100 {
+			return errors.New("scaling target_cpu must be between 0 and 100")
+		}
+
+		if scaling.TargetALBRequestsPerTarget < 0 {
+			return errors.New("scaling target_alb_requests_per_target must be greater than 0")
+		}
+
+		if (scaling.TargetCPU != 0 || scaling.TargetALBRequestsPerTarget != 0) && scaling.MaxSize <= recv.InstanceCount {
+			return fmt.Errorf("scaling target tracking requires a max_size greater than instance_count %d", recv.InstanceCount)
+		}
+
+		err := scaling.validateScheduledActions()
+		if err != nil {
+			return err
+		}
+
+		err = scaling.validatePredictive()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (recv *Scaling) validateScheduledActions() error {
+	names := make(map[string]struct{})
+	schedules := make([]*util.CronSchedule, len(recv.ScheduledActions))
+
+	for i, action := range recv.ScheduledActions {
+
+		if !scheduledActionRegex.MatchString(action.Name) {
+			return fmt.Errorf("Invalid scheduled action name [%s]. Valid characters are [0-9a-zA-Z]", action.Name)
+		}
+
+		if _, exists := names[action.Name]; exists {
+			return fmt.Errorf("Duplicate scheduled action %s", action.Name)
+		}
+		names[action.Name] = struct{}{}
+
+		var err error
+		schedules[i], err = util.ParseCron(action.Recurrence)
+		if err != nil {
+			return fmt.Errorf("Invalid recurrence for scheduled action %s: %s", action.Name, err)
+		}
+
+		if action.TimeZone != "" {
+			if _, err = time.LoadLocation(action.TimeZone); err != nil {
+				return fmt.Errorf("Invalid time_zone for scheduled action %s", action.Name)
+			}
+		}
+
+		if action.MinSize == nil && action.MaxSize == nil && action.DesiredCapacity == nil {
+			return fmt.Errorf("Scheduled action %s must set min_size, max_size, or desired_capacity", action.Name)
+		}
+
+		if action.MinSize != nil && action.MaxSize != nil && *action.MinSize > *action.MaxSize {
+			return fmt.Errorf("Scheduled action %s min_size is greater than max_size", action.Name)
+		}
+
+		if action.DesiredCapacity != nil {
+			if (action.MinSize != nil && *action.DesiredCapacity < *action.MinSize) ||
+				(action.MaxSize != nil && *action.DesiredCapacity > *action.MaxSize) {
+				return fmt.Errorf("Scheduled action %s desired_capacity must be between min_size and max_size", action.Name)
+			}
+		}
+	}
+
+	for i, action := range recv.ScheduledActions {
+		for j := i + 1; j < len(recv.ScheduledActions); j++ {
+			other := recv.ScheduledActions[j]
+
+			// times in different zones can't be compared without knowing
+			// the dates daylight saving time starts and ends
+			if scheduleTimeZone(action) != scheduleTimeZone(other) {
+				continue
+			}
+
+			if schedules[i].Overlaps(schedules[j]) {
+				return fmt.Errorf("Scheduled actions %s and %s overlap", action.Name, other.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func scheduleTimeZone(action *ScheduledAction) string {
+	if action.TimeZone == "" {
+		return "UTC"
+	}
+	return action.TimeZone
+}
+
+func (recv *Scaling) validatePredictive() error {
+	predictive := recv.Predictive
+	if predictive == nil {
+		return nil
+	}
+
+	switch predictive.Metric {
+	case PredictiveMetric_CPU, PredictiveMetric_NetworkIn, PredictiveMetric_NetworkOut:
+	default:
+		return fmt.Errorf("Invalid scaling predictive metric. Valid values are [%s, %s, %s]",
+			PredictiveMetric_CPU, PredictiveMetric_NetworkIn, PredictiveMetric_NetworkOut)
+	}
+
+	if predictive.TargetValue <= 0 {
+		return errors.New("scaling predictive target_value must be greater than 0")
+	}
+
+	switch predictive.Mode {
+	case PredictiveMode_ForecastOnly, PredictiveMode_ForecastAndScale:
+	default:
+		return fmt.Errorf("Invalid scaling predictive mode. Valid values are [%s, %s]",
+			PredictiveMode_ForecastOnly, PredictiveMode_ForecastAndScale)
+	}
+
+	if predictive.SchedulingBufferTime < 0 || predictive.SchedulingBufferTime > 3600 {
+		return errors.New("scaling predictive scheduling_buffer_time must be between 0 and 3600")
+	}
+
+	switch predictive.MaxCapacityBreachBehavior {
+	case MaxCapacityBreach_HonorMax:
+		if predictive.MaxCapacityBuffer != nil {
+			return fmt.Errorf("scaling predictive max_capacity_buffer requires max_capacity_breach_behavior %s",
+				MaxCapacityBreach_IncreaseMax)
+		}
+	case MaxCapacityBreach_IncreaseMax:
+		if predictive.MaxCapacityBuffer != nil &&
+			(*predictive.MaxCapacityBuffer < 0 || *predictive.MaxCapacityBuffer > 100) {
+			return errors.New("scaling predictive max_capacity_buffer must be between 0 and 100")
+		}
+	default:
+		return fmt.Errorf("Invalid scaling predictive max_capacity_breach_behavior. Valid values are [%s, %s]",
+			MaxCapacityBreach_HonorMax, MaxCapacityBreach_IncreaseMax)
+	}
+
+	return nil
+}
+
+// ValidateMonitoring checks the environment's monitoring and each region's.
+// Alarms can only notify a topic in their own region
+func (recv *Environment) ValidateMonitoring() error {
+	for _, region := range recv.Regions {
+		monitoring, err := recv.GetMonitoring(region.Name)
+		if err != nil {
+			return err
+		}
+		if monitoring == nil {
+			continue
+		}
+
+		if recv.Compute == Compute_ECS {
+			return errors.New("monitoring isn't supported with compute ecs")
+		}
+
+		if monitoring.SNSTopicARN == "" {
+			continue
+		}
+
+		if !snsTopicARNRegex.MatchString(monitoring.SNSTopicARN) {
+			return fmt.Errorf("Invalid monitoring sns_topic_arn %s", monitoring.SNSTopicARN)
+		}
+
+		if strings.Split(monitoring.SNSTopicARN, ":")[3] != region.Name {
+			return fmt.Errorf("monitoring sns_topic_arn must be in region %s", region.Name)
+		}
+	}
+
+	monitorings := []*Monitoring{recv.Monitoring}
+	for _, region := range recv.Regions {
+		monitorings = append(monitorings, region.Monitoring)
+	}
+
+	for _, monitoring := range monitorings {
+		if monitoring == nil {
+			continue
+		}
+
+		metrics := make(map[string]struct{})
+		for _, alarm := range monitoring.Alarms {
+
+			switch alarm.Metric {
+			case AlarmMetric_HTTP5xx, AlarmMetric_UnhealthyHosts:
+			case AlarmMetric_CPU, AlarmMetric_Disk:
+				if alarm.Threshold > 100 {
+					return fmt.Errorf("monitoring alarm %s threshold is a percent and must be at most 100", alarm.Metric)
+				}
+			default:
+				return fmt.Errorf("Invalid monitoring alarm metric. Valid values are [%s, %s, %s, %s]",
+					AlarmMetric_HTTP5xx, AlarmMetric_UnhealthyHosts, AlarmMetric_CPU, AlarmMetric_Disk)
+			}
+
+			if _, exists := metrics[alarm.Metric]; exists {
+				return fmt.Errorf("Duplicate monitoring alarm %s", alarm.Metric)
+			}
+			metrics[alarm.Metric] = struct{}{}
+
+			if alarm.Threshold <= 0 {
+				return fmt.Errorf("monitoring alarm %s threshold must be greater than 0", alarm.Metric)
+			}
+
+			if alarm.EvaluationPeriods < 1 || alarm.EvaluationPeriods > 60 {
+				return fmt.Errorf("monitoring alarm %s evaluation_periods must be between 1 and 60", alarm.Metric)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateLogging checks the log group retention is one CloudWatch Logs
+// accepts and that host files are absolute paths. ECS tasks already log to the
+// stack's ECS log group so only its retention applies
+func (recv *Environment) ValidateLogging() error {
+	if recv.Logging == nil {
+		return nil
+	}
+
+	validRetention := false
+	for _, days := range LogRetentionDays {
+		if recv.Logging.RetentionDays == days {
+			validRetention = true
+			break
+		}
+	}
+	if !validRetention {
+		return fmt.Errorf("Invalid logging retention_days %d. Valid values are %v",
+			recv.Logging.RetentionDays, LogRetentionDays)
+	}
+
+	if recv.Compute == Compute_ECS && len(recv.Logging.HostFiles) > 0 {
+		return errors.New("logging host_files isn't supported with compute ecs")
+	}
+
+	files := make(map[string]struct{})
+	for _, file := range recv.Logging.HostFiles {
+		if !path.IsAbs(file) {
+			return fmt.Errorf("logging host_files %s must be an absolute path", file)
+		}
+
+		if _, exists := files[file]; exists {
+			return fmt.Errorf("Duplicate logging host_files %s", file)
+		}
+		files[file] = struct{}{}
+	}
+
+	return nil
+}
+
+// ValidateDependencyChecks checks the environment's dependency checks and each
+// region's. A region's checks run along with the environment's so their names
+// can't collide
+func (recv *Environment) ValidateDependencyChecks() error {
+	err := validateDependencyChecks(recv.DependencyChecks, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, region := range recv.Regions {
+		err = validateDependencyChecks(region.DependencyChecks, recv.DependencyChecks)
+		if err != nil {
+			return fmt.Errorf("region %s %s", region.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func validateDependencyChecks(checks, inherited []*DependencyCheck) error {
+	names := make(map[string]struct{})
+	for _, check := range inherited {
+		names[check.Name] = struct{}{}
+	}
+
+	for _, check := range checks {
+		if check.Name == "" {
+			return errors.New("dependency_checks name is required")
+		}
+
+		if _, exists := names[check.Name]; exists {
+			return fmt.Errorf("Duplicate dependency check %s", check.Name)
+		}
+		names[check.Name] = struct{}{}
+
+		kinds := 0
+		for _, target := range []string{check.URL, check.TCP, check.SQSQueue} {
+			if target != "" {
+				kinds++
+			}
+		}
+		if kinds != 1 {
+			return fmt.Errorf("Dependency check %s must set exactly one of url, tcp, and sqs_queue", check.Name)
+		}
+
+		if check.URL != "" {
+			checkURL, err := url.Parse(check.URL)
+			if err != nil || (checkURL.Scheme != "http" && checkURL.Scheme != "https") || checkURL.Host == "" {
+				return fmt.Errorf("Dependency check %s url must be an http or https URL", check.Name)
+			}
+		}
+
+		if check.TCP != "" {
+			host, port, err := net.SplitHostPort(check.TCP)
+			if err != nil || host == "" || port == "" {
+				return fmt.Errorf("Dependency check %s tcp must be host:port", check.Name)
+			}
+		}
+
+		if check.SQSQueue != "" && !sqsQueueNameRegex.MatchString(check.SQSQueue) {
+			return fmt.Errorf("Invalid sqs_queue for dependency check %s", check.Name)
+		}
+
+		if check.Timeout < 1 || check.Timeout > 60 {
+			return fmt.Errorf("Dependency check %s timeout must be between 1 and 60 seconds", check.Name)
+		}
+	}
+
+	return nil
+}
+
+// ValidateHardening checks the ssh mode and sysctl settings. fail2ban watches
+// sshd so it needs ssh enabled
+func (recv *Environment) ValidateHardening() error {
+	hardening := recv.Hardening
+	if hardening == nil {
+		return nil
+	}
+
+	if recv.Compute == Compute_ECS {
+		return errors.New("hardening isn't supported with compute ecs")
+	}
+
+	switch hardening.SSH {
+	case SSH_Enabled, SSH_Disabled, SSH_SSM:
+	default:
+		return fmt.Errorf("Invalid hardening ssh %s. Valid values are [%s, %s, %s]",
+			hardening.SSH, SSH_Enabled, SSH_Disabled, SSH_SSM)
+	}
+
+	if hardening.Fail2ban && hardening.SSH != SSH_Enabled {
+		return fmt.Errorf("hardening fail2ban requires ssh %s", SSH_Enabled)
+	}
+
+	for key, value := range hardening.Sysctl {
+		if !sysctlKeyRegex.MatchString(key) {
+			return fmt.Errorf("Invalid hardening sysctl key %s", key)
+		}
+
+		if value == "" || strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("hardening sysctl %s must have a single line value", key)
+		}
+	}
+
+	return nil
+}
+
+// ValidateAccess checks how operators reach instances. Session Manager
+// replaces key pairs so regions can't name one
+func (recv *Environment) ValidateAccess() error {
+	switch recv.Access {
+	case Access_SSH:
+		return nil
+	case Access_SSM:
+	default:
+		return fmt.Errorf("Invalid access %s. Valid values are [%s, %s]",
+			recv.Access, Access_SSH, Access_SSM)
+	}
+
+	if recv.Compute == Compute_ECS {
+		return fmt.Errorf("access %s isn't supported with compute ecs", Access_SSM)
+	}
+
+	for _, region := range recv.Regions {
+		if region.KeyPairName != "" {
+			return fmt.Errorf("region %s has a key_pair_name but access is %s", region.Name, Access_SSM)
+		}
+	}
+
+	return nil
+}
+
+// ValidatePermissionPreflight checks what a deploy does when the deployer's
+// policies don't allow what it needs
+func (recv *Environment) ValidatePermissionPreflight() error {
+	switch recv.PermissionPreflight {
+	case PermissionPreflight_Enforce, PermissionPreflight_Warn, PermissionPreflight_Off:
+		return nil
+	default:
+		return fmt.Errorf("invalid permission_preflight %s. Use %s, %s, or %s", recv.PermissionPreflight,
+			PermissionPreflight_Enforce, PermissionPreflight_Warn, PermissionPreflight_Off)
+	}
+}
+
+// ValidatePressure checks the thresholds are percents and at least one is set
+func (recv *Environment) ValidatePressure() error {
+	pressure := recv.Pressure
+	if pressure == nil {
+		return nil
+	}
+
+	if recv.Compute == Compute_ECS {
+		return errors.New("pressure isn't supported with compute ecs")
+	}
+
+	if pressure.Memory < 0 || pressure.Memory > 100 || pressure.CPU < 0 || pressure.CPU > 100 {
+		return errors.New("pressure memory and cpu must be between 0 and 100")
+	}
+
+	if pressure.Memory == 0 && pressure.CPU == 0 {
+		return errors.New("pressure needs a memory or cpu threshold")
+	}
+
+	switch pressure.Action {
+	case PressureAction_Restart, PressureAction_Shed:
+	default:
+		return fmt.Errorf("Invalid pressure action %s. Valid values are [%s, %s]",
+			pressure.Action, PressureAction_Restart, PressureAction_Shed)
+	}
+
+	if pressure.Cooldown < 1 {
+		return errors.New("pressure cooldown must be positive")
+	}
+
+	return nil
+}
+
+// ValidateDiskGC checks the watermarks are percents with room between them
+func (recv *Environment) ValidateDiskGC() error {
+	diskGC := recv.DiskGC
+	if diskGC == nil {
+		return nil
+	}
+
+	if recv.Compute == Compute_ECS {
+		return errors.New("disk_gc isn't supported with compute ecs")
+	}
+
+	if diskGC.HighWatermark <= 0 || diskGC.HighWatermark > 100 ||
+		diskGC.LowWatermark <= 0 || diskGC.LowWatermark > 100 {
+		return errors.New("disk_gc high_watermark and low_watermark must be between 0 and 100")
+	}
+
+	if diskGC.LowWatermark >= diskGC.HighWatermark {
+		return errors.New("disk_gc low_watermark must be less than high_watermark")
+	}
+
+	return nil
+}
+
+// SQS queue names are at most 80 characters
+const commandQueueNameMax = 80
+
+// ValidateCommandQueue checks the queue porterd creates for an instance can be
+// named after the service, environment and the instance's 19 character id
+func (recv *Environment) ValidateCommandQueue(serviceName string) error {
+	if !recv.CommandQueue {
+		return nil
+	}
+
+	queueName := command_queue.QueueName(serviceName, recv.Name, "i-0123456789abcdef0")
+	if len(queueName) > commandQueueNameMax {
+		return fmt.Errorf("command_queue needs service_name and the environment's name to be at most %d characters together",
+			commandQueueNameMax-len(queueName)+len(serviceName)+len(recv.Name))
+	}
+
+	return nil
+}
+
+func (recv *Environment) ValidateMetadataOptions() error {
+	options := recv.MetadataOptions
+	if options == nil {
+		return nil
+	}
+
+	switch options.HttpTokens {
+	case "optional", "required":
+	default:
+		return errors.New("Invalid metadata_options http_tokens. Valid values are [optional, required]")
+	}
+
+	if options.HttpPutResponseHopLimit < 1 || options.HttpPutResponseHopLimit > 64 {
+		return errors.New("metadata_options http_put_response_hop_limit must be between 1 and 64")
+	}
+
+	return nil
+}
+
+func (recv *Environment) ValidateTemplateRules() error {
+	rules := recv.TemplateRules
+	if rules == nil {
+		return nil
+	}
+
+	for _, key := range rules.RequiredTags {
+		if key == "" || len(key) > 128 {
+			return errors.New("template_rules required_tags must be between 1 and 128 characters")
+		}
+
+		if strings.HasPrefix(key, "aws:") {
+			return fmt.Errorf("template_rules required_tags can't require %s. The aws: prefix is reserved", key)
+		}
+	}
+
+	for _, pattern := range rules.ForbiddenInstanceTypes {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return fmt.Errorf("Invalid template_rules forbidden_instance_types pattern %q", pattern)
+		}
+	}
+
+	for _, source := range rules.GuardRules {
+		switch {
+		case strings.HasPrefix(source, "s3://"):
+			if !s3GuardRulesRegex.MatchString(source) {
+				return fmt.Errorf("template_rules guard_rules %s must be s3://<bucket>/<key>", source)
+			}
+		case strings.HasPrefix(source, "https://"):
+		case strings.Contains(source, "://"):
+			return fmt.Errorf("template_rules guard_rules %s must be a path, an s3:// location, or an https:// URL", source)
+		case source == "":
+			return errors.New("template_rules guard_rules can't be empty")
+		}
+	}
+
+	return nil
+}
+
+func (recv *Environment) ValidateNotifications() error {
+	notifications := recv.Notifications
+
+	for _, webhook := range notifications.Webhooks {
+		webhookURL, err := url.Parse(webhook)
+		if err != nil || webhookURL.Host == "" ||
+			(webhookURL.Scheme != "https" && webhookURL.Scheme != "http") {
+			return errors.New("notifications webhooks must be http or https URLs")
+		}
+	}
+
+	if notifications.SNSTopicARN != "" && !snsTopicARNRegex.MatchString(notifications.SNSTopicARN) {
+		return fmt.Errorf("Invalid notifications sns_topic_arn %s", notifications.SNSTopicARN)
+	}
+
+	if notifications.RoleARN != "" {
+		if notifications.SNSTopicARN == "" {
+			return errors.New("notifications role_arn is only used with sns_topic_arn")
+		}
+
+		if !roleARNRegex.MatchString(notifications.RoleARN) {
+			return fmt.Errorf("Invalid notifications role_arn %s", notifications.RoleARN)
+		}
+	}
+
+	for _, event := range notifications.Events {
+		switch event {
+		case constants.EventDeployStarted,
+			constants.EventPayloadUploaded,
+			constants.EventStackCreated,
+			constants.EventHealthCheckPassed,
+			constants.EventPromoted,
+			constants.EventRolledBack:
+		default:
+			return fmt.Errorf("Invalid notifications event %s", event)
+		}
+	}
+
+	return nil
+}
+
+func (recv *Environment) ValidateDeployMetrics() error {
+	namespace := recv.DeployMetrics.Namespace
+	if namespace == "" {
+		return nil
+	}
+
+	if !metricNamespaceRegex.MatchString(namespace) || strings.HasPrefix(namespace, "AWS/") {
+		return fmt.Errorf("Invalid deploy_metrics namespace %s", namespace)
+	}
+
+	return nil
+}
+
+func (recv *Environment) ValidateDeploySLO() error {
+	slo := recv.DeploySLO
+
+	if slo.TotalTime < 0 || slo.FirstHealthyInstance < 0 || slo.SwapDuration < 0 {
+		return errors.New("deploy_slo durations can't be negative")
+	}
+
+	if slo.RetryBudget != nil && *slo.RetryBudget < 0 {
+		return errors.New("deploy_slo retry_budget can't be negative")
+	}
+
+	return nil
+}
+
+func validateNotificationTemplates(key, successTemplate, failureTemplate string) error {
+
+	_, err := template.New("").Parse(successTemplate)
+	if err != nil {
+		return fmt.Errorf("Invalid %s success_template: %s", key, err)
+	}
+
+	_, err = template.New("").Parse(failureTemplate)
+	if err != nil {
+		return fmt.Errorf("Invalid %s failure_template: %s", key, err)
+	}
+
+	return nil
+}
+
+func (recv *Environment) ValidateDependencies() error {
+
+	envVars := make(map[string]struct{})
+	parameterNames := make(map[string]struct{})
+
+	for _, dependency := range recv.Dependencies {
+
+		if !serviceNameRegex.MatchString(dependency.ServiceName) {
+			return errors.New("Invalid dependency service_name " + dependency.ServiceName)
+		}
+
+		if !environmentNameRegex.MatchString(dependency.Environment) {
+			return fmt.Errorf("Invalid environment for dependency %s", dependency.ServiceName)
+		}
+
+		if len(dependency.Outputs) == 0 {
+			return fmt.Errorf("Dependency %s doesn't declare any outputs", dependency.ServiceName)
+		}
+
+		for _, output := range dependency.Outputs {
+
+			if output.Name == "" {
+				return fmt.Errorf("Empty output name for dependency %s", dependency.ServiceName)
+			}
+
+			switch output.Type {
+			case OutputType_String, OutputType_Number, OutputType_List,
+				OutputType_ARN, OutputType_URL:
+			default:
+				return fmt.Errorf("Invalid type for output %s of dependency %s. Valid values are [%s, %s, %s, %s, %s]",
+					output.Name, dependency.ServiceName,
+					OutputType_String, OutputType_Number, OutputType_List,
+					OutputType_ARN, OutputType_URL)
+			}
+
+			if !envVarRegex.MatchString(output.EnvVar) {
+				return fmt.Errorf("Invalid env_var %s for output %s of dependency %s",
+					output.EnvVar, output.Name, dependency.ServiceName)
+			}
+
+			if _, exists := envVars[output.EnvVar]; exists {
+				return fmt.Errorf("Duplicate env_var %s for output %s of dependency %s",
+					output.EnvVar, output.Name, dependency.ServiceName)
+			}
+			envVars[output.EnvVar] = struct{}{}
+
+			parameterName := dependency.ParameterName(output)
+			if _, exists := parameterNames[parameterName]; exists {
+				return fmt.Errorf("Output %s of dependency %s has the same parameter name %s as another",
+					output.Name, dependency.ServiceName, parameterName)
+			}
+			parameterNames[parameterName] = struct{}{}
+		}
+	}
+
+	return nil
+}
+
+func (recv *Environment) ValidateCompute(registryDeployment bool) error {
+
+	switch recv.Compute {
+	case Compute_EC2:
+		return nil
+	case Compute_ECS:
+		// validated below
+	default:
+		return fmt.Errorf("Invalid compute. Valid values are [%s, %s]",
+			Compute_EC2, Compute_ECS)
+	}
+
+	if recv.Hotswap {
+		return errors.New("hot_swap isn't supported with compute: ecs")
+	}
+
+	if recv.Spot != nil {
+		return errors.New("spot isn't supported with compute: ecs")
+	}
+
+	if recv.InstanceRefresh != nil {
+		return errors.New("instance_refresh isn't supported with compute: ecs")
+	}
+
+	if recv.UpdatePolicy != nil {
+		return errors.New("update_policy isn't supported with compute: ecs")
+	}
+
+	if recv.CreationPolicy != nil {
+		return errors.New("creation_policy isn't supported with compute: ecs")
+	}
+
+	if recv.MetadataOptions != nil {
+		return errors.New("metadata_options isn't supported with compute: ecs")
+	}
+
+	if recv.Storage != nil {
+		return errors.New("storage isn't supported with compute: ecs")
+	}
+
+	for _, region := range recv.Regions {
+		if region.EFS != nil {
+			return errors.New("efs isn't supported with compute: ecs")
+		}
+	}
+
+	if len(recv.InstanceGroups) > 0 {
+		return errors.New("instance_groups isn't supported with compute: ecs")
+	}
+
+	if recv.CommandQueue {
+		return errors.New("command_queue isn't supported with compute: ecs")
+	}
+
+	// ECS pulls images. It can't load them from the service payload
+	if !registryDeployment {
+		return fmt.Errorf("compute: ecs requires ecr or %s", constants.EnvDockerRegistry)
+	}
+
+	switch recv.ECS.LaunchType {
+	case LaunchType_EC2, LaunchType_Fargate:
+	default:
+		return fmt.Errorf("Invalid ecs launch_type. Valid values are [%s, %s]",
+			LaunchType_EC2, LaunchType_Fargate)
+	}
+
+	if recv.ECS.LaunchType == LaunchType_EC2 && recv.ECS.Cluster == "" {
+		return errors.New("ecs cluster is required with launch_type " + LaunchType_EC2)
+	}
+
+	// only tasks on Fargate get their own public IP
+	if recv.ECS.LaunchType == LaunchType_EC2 && recv.ECS.AssignPublicIp {
+		return errors.New("ecs assign_public_ip requires launch_type " + LaunchType_Fargate)
+	}
+
+	for _, region := range recv.Regions {
+
+		if !region.HasVpc() {
+			return errors.New("compute: ecs requires a vpc_id for region " + region.Name)
+		}
+
+		if region.DNS != nil {
+			return errors.New("dns isn't supported with compute: ecs in region " + region.Name)
+		}
+
+		if region.Security != nil {
+			return errors.New("security isn't supported with compute: ecs in region " + region.Name)
+		}
+
+		inetContainers := 0
+
+		for _, container := range region.Containers {
+
+			// tasks get new secrets when they're replaced, never while
+			// they run
+			if container.SecretsMount != nil && container.SecretsMount.ReloadSignal != "" {
+				return fmt.Errorf("secrets_mount reload_signal isn't supported with compute: ecs. Found on container %s", container.Name)
+			}
+
+			if len(container.Routes) > 0 {
+				return fmt.Errorf("Routes aren't supported with compute: ecs. Found on container %s", container.Name)
+			}
+
+			if container.Topology == Topology_Inet {
+				inetContainers++
+
+				if container.InetPort == 0 {
+					return fmt.Errorf("compute: ecs requires inet_port on container %s", container.Name)
+				}
+			}
+		}
+
+		if inetContainers > 1 {
+			return errors.New("compute: ecs supports one inet container in region " + region.Name)
+		}
+	}
+
+	return nil
+}
+
+// ValidateDNS checks that regions sharing a record name agree on how Route53
+// chooses between them
+func (recv *Environment) ValidateDNS() error {
+
+	policies := make(map[string]string)
+	targets := make(map[string]string)
+	simpleRecords := make(map[string]bool)
+	locations := make(map[string]string)
+
+	for _, region := range recv.Regions {
+		dns := region.DNS
+		if dns == nil {
+			continue
+		}
+
+		// names may not be normalized with an ending period yet
+		name := strings.TrimSuffix(dns.Name, ".")
+
+		if target, exists := targets[name]; exists && target != dns.Target {
+			return fmt.Errorf("dns %s uses target %s and %s. Every region must use the same target",
+				dns.Name, target, dns.Target)
+		}
+		targets[name] = dns.Target
+
+		if dns.Target == DNSTarget_Instances {
+			if recv.Compute == Compute_ECS {
+				return fmt.Errorf("dns target %s isn't supported with compute %s", DNSTarget_Instances, Compute_ECS)
+			}
+
+			// every instance in the stack gets a record
+			if len(recv.InstanceGroups) > 0 {
+				return fmt.Errorf("dns target %s can't be used with instance_groups", DNSTarget_Instances)
+			}
+
+			// records are multivalue answers across regions so there's no
+			// policy to agree on
+			continue
+		}
+
+		if policy, exists := policies[name]; exists && policy != dns.RoutingPolicy {
+			return fmt.Errorf("dns %s uses routing_policy %s and %s. Every region must use the same routing_policy",
+				dns.Name, policy, dns.RoutingPolicy)
+		}
+		policies[name] = dns.RoutingPolicy
+
+		switch dns.RoutingPolicy {
+		case RoutingPolicy_Simple:
+			if simpleRecords[name] {
+				return fmt.Errorf("dns %s with routing_policy %s can only be defined in one region",
+					dns.Name, RoutingPolicy_Simple)
+			}
+			simpleRecords[name] = true
+
+		case RoutingPolicy_Geolocation:
+			geo := dns.Geolocation
+			location := name + "|" + geo.ContinentCode + "|" + geo.CountryCode + "|" + geo.SubdivisionCode
+			if otherRegion, exists := locations[location]; exists {
+				return fmt.Errorf("dns %s has the same geolocation in %s and %s",
+					dns.Name, otherRegion, region.Name)
+			}
+			locations[location] = region.Name
+		}
+	}
+
+	return nil
+}
+
+func (recv *Region) ValidateDNS() error {
+	dns := recv.DNS
+	if dns == nil {
+		return nil
+	}
+
+	if recv.HostedZoneName == "" {
+		return errors.New("dns requires hosted_zone_name for region " + recv.Name)
+	}
+
+	if recv.PrimaryTopology() != Topology_Inet {
+		return errors.New("dns requires an inet container for region " + recv.Name)
+	}
+
+	if dns.Name == "" {
+		return errors.New("Empty or missing dns name for region " + recv.Name)
+	}
+
+	// normalize with ending period
+	dns.Name = strings.TrimRight(dns.Name, ".") + "."
+	hostedZoneName := strings.TrimRight(recv.HostedZoneName, ".") + "."
+	if dns.Name != hostedZoneName && !strings.HasSuffix(dns.Name, "."+hostedZoneName) {
+		return fmt.Errorf("dns name %s isn't in hosted_zone_name %s", dns.Name, recv.HostedZoneName)
+	}
+
+	switch dns.Target {
+	case DNSTarget_ELB:
+	case DNSTarget_Instances:
+		if dns.RoutingPolicy != RoutingPolicy_Simple {
+			return fmt.Errorf("dns target %s requires routing_policy %s for region %s",
+				DNSTarget_Instances, RoutingPolicy_Simple, recv.Name)
+		}
+
+		if len(recv.ELBs) > 0 {
+			return fmt.Errorf("dns target %s can't be used with elb for region %s",
+				DNSTarget_Instances, recv.Name)
+		}
+
+		// without an ELB there's nowhere to terminate TLS
+		if recv.HasHTTPS() {
+			return fmt.Errorf("dns target %s can't be used with ssl_cert_arn or tls for region %s",
+				DNSTarget_Instances, recv.Name)
+		}
+
+		if recv.HasRoutes() {
+			return fmt.Errorf("dns target %s can't be used with container routes for region %s",
+				DNSTarget_Instances, recv.Name)
+		}
+
+		// clients reach the instances through the security block's ingress
+		// rather than the internet
+		if recv.Security == nil || len(recv.Security.Ingress) == 0 {
+			return fmt.Errorf("dns target %s requires security ingress from its clients for region %s",
+				DNSTarget_Instances, recv.Name)
+		}
+
+		for _, rule := range recv.Security.Ingress {
+			if rule.ELB {
+				return fmt.Errorf("dns target %s can't be used with the elb ingress rule %s for region %s",
+					DNSTarget_Instances, rule.Name, recv.Name)
+			}
+		}
+	case DNSTarget_Stack:
+		// the stack's set identifier distinguishes the records of a swap
+		if dns.RoutingPolicy != RoutingPolicy_Simple {
+			return fmt.Errorf("dns target %s requires routing_policy %s for region %s",
+				DNSTarget_Stack, RoutingPolicy_Simple, recv.Name)
+		}
+
+		if len(recv.ELBs) > 0 {
+			return fmt.Errorf("dns target %s can't be used with elb for region %s",
+				DNSTarget_Stack, recv.Name)
+		}
+
+		// records are CNAMEs so the ttl is porter's to set
+		if dns.Name == hostedZoneName {
+			return fmt.Errorf("dns target %s can't be the hosted_zone_name apex for region %s",
+				DNSTarget_Stack, recv.Name)
+		}
+
+		if err := dns.Swap.validate(); err != nil {
+			return fmt.Errorf("dns swap %s for region %s", err, recv.Name)
+		}
+	default:
+		return fmt.Errorf("Invalid dns target for region %s. Valid values are [%s, %s, %s]",
+			recv.Name, DNSTarget_ELB, DNSTarget_Instances, DNSTarget_Stack)
+	}
+
+	if dns.Swap != nil && dns.Target != DNSTarget_Stack {
+		return fmt.Errorf("dns swap requires target %s for region %s", DNSTarget_Stack, recv.Name)
+	}
+
+	switch dns.RoutingPolicy {
+	case RoutingPolicy_Simple, RoutingPolicy_Latency:
+	case RoutingPolicy_Weighted:
+		if *dns.Weight < 0 || *dns.Weight > 255 {
+			return errors.New("dns weight must be between 0 and 255 for region " + recv.Name)
+		}
+	case RoutingPolicy_Geolocation:
+		if dns.Geolocation == nil {
+			return errors.New("dns routing_policy geolocation requires geolocation for region " + recv.Name)
+		}
+	default:
+		return fmt.Errorf("Invalid dns routing_policy for region %s. Valid values are [%s, %s, %s, %s]",
+			recv.Name, RoutingPolicy_Simple, RoutingPolicy_Weighted,
+			RoutingPolicy_Latency, RoutingPolicy_Geolocation)
+	}
+
+	if dns.Weight != nil && dns.RoutingPolicy != RoutingPolicy_Weighted {
+		return errors.New("dns weight requires routing_policy weighted for region " + recv.Name)
+	}
+
+	if dns.Geolocation == nil {
+		return nil
+	}
+
+	if dns.RoutingPolicy != RoutingPolicy_Geolocation {
+		return errors.New("dns geolocation requires routing_policy geolocation for region " + recv.Name)
+	}
+
+	geo := dns.Geolocation
+	if geo.ContinentCode != "" {
+
+		if geo.CountryCode != "" || geo.SubdivisionCode != "" {
+			return errors.New("dns geolocation continent_code can't be combined with country_code or subdivision_code for region " + recv.Name)
+		}
+
+		switch geo.ContinentCode {
+		case "AF", "AN", "AS", "EU", "NA", "OC", "SA":
+		default:
+			return errors.New("Invalid dns geolocation continent_code for region " + recv.Name)
+		}
+
+		return nil
+	}
+
+	if !countryCodeRegex.MatchString(geo.CountryCode) {
+		return errors.New("dns geolocation requires continent_code or a valid country_code for region " + recv.Name)
+	}
+
+	if geo.SubdivisionCode != "" {
+		if geo.CountryCode != "US" {
+			return errors.New("dns geolocation subdivision_code requires country_code US for region " + recv.Name)
+		}
+
+		if !subdivisionCodeRegex.MatchString(geo.SubdivisionCode) {
+			return errors.New("Invalid dns geolocation subdivision_code for region " + recv.Name)
+		}
+	}
+
+	return nil
+}
+
+func ValidateRegion(region *Region, validateRoleArn bool) error {
+
+	err := region.ValidateContainers()
+	if err != nil {
+		return err
+	}
+
+	if _, exists := constants.AwsRegions[region.Name]; !exists {
+		return errors.New("Invalid region name " + region.Name)
+	}
+
+	if validateRoleArn && !roleARNRegex.MatchString(region.RoleARN) {
+		return errors.New("Invalid role_arn for region " + region.Name)
+	}
+
+	if region.CFNRoleARN != "" && !roleARNRegex.MatchString(region.CFNRoleARN) {
+		return errors.New("Invalid cfn_role_arn for region " + region.Name)
+	}
+
+	// TODO validate characters
+	if region.HostedZoneName != "" {
+		// normalize with ending period
+		region.HostedZoneName = strings.TrimRight(region.HostedZoneName, ".") + "."
+	}
+
+	err = region.ValidateDNS()
+	if err != nil {
+		return err
+	}
+
+	// TODO validate the bucket prefix is one that S3 allows
+	if region.S3Bucket == "" {
+		return errors.New("Empty or missing s3_bucket")
+	}
+
+	if region.SSEKMSKeyId != nil && !kmsKeyIdRegex.MatchString(*region.SSEKMSKeyId) {
+		return errors.New("Invalid sse_kms_key_id for region " + region.Name)
+	}
+
+	if region.SSEBucketKey != nil && region.SSEKMSKeyId == nil {
+		return errors.New("sse_bucket_key requires sse_kms_key_id for region " + region.Name)
+	}
+
+	if region.SecretsKMSKeyId != "" && !kmsKeyIdRegex.MatchString(region.SecretsKMSKeyId) {
+		return errors.New("Invalid secrets_kms_key_id for region " + region.Name)
+	}
+
+	discoverSubnets := len(region.SubnetTags) > 0
+
+	if len(region.AZs) == 0 && !discoverSubnets {
+		return errors.New("Missing availability zone for region " + region.Name)
+	}
+
+	if region.HasRoutes() && !region.HasVpc() {
+		return errors.New("Container routes require a vpc_id for region " + region.Name)
+	}
+
+	if region.VpcId != "" {
+		if !vpcIdRegex.MatchString(region.VpcId) {
+			return errors.New("Invalid vpc_id for region " + region.Name)
+		}
+
+		if len(region.VpcTags) > 0 {
+			return errors.New("vpc_id and vpc_tags can't both be defined for region " + region.Name)
+		}
+	}
+
+	for _, tags := range []map[string]string{region.VpcTags, region.SubnetTags} {
+		for key, value := range tags {
+			if key == "" || value == "" {
+				return errors.New("Tag selectors need a key and value for region " + region.Name)
+			}
+		}
+	}
+
+	if discoverSubnets && !region.HasVpc() {
+		return errors.New("subnet_tags require vpc_id or vpc_tags for region " + region.Name)
+	}
+
+	for _, az := range region.AZs {
+		if az.Name == "" {
+			return errors.New("Empty AZ name for region " + region.Name)
+		}
+
+		if discoverSubnets {
+			if az.SubnetID != "" {
+				return errors.New("Defined subnet_id and subnet_tags for region " + region.Name)
+			}
+		} else if region.HasVpc() {
+			if !subnetIdRegex.MatchString(az.SubnetID) {
+				return errors.New("Invalid subnet_id for region " + region.Name)
+			}
+		} else {
+			if az.SubnetID != "" {
+				return errors.New("Defined subnet_id but no vpc_id for region " + region.Name)
+			}
+		}
+	}
+
+	if region.Security != nil {
+		err = region.Security.validate(region)
+		if err != nil {
+			return fmt.Errorf("%s for region %s", err, region.Name)
+		}
+	}
+
+	if region.EFS != nil {
+		err = region.EFS.validate(region)
+		if err != nil {
+			return fmt.Errorf("efs %s for region %s", err, region.Name)
+		}
+	}
+
+	if region.TLS != nil {
+		err = region.TLS.validate(region)
+		if err != nil {
+			return fmt.Errorf("%s for region %s", err, region.Name)
+		}
+	}
+
+	return nil
+}
+
+// ValidateLogRouter checks each parser has a format Fluent Bit knows and the
+// router has somewhere to send logs
+func (recv *Container) ValidateLogRouter() error {
+	if recv.LogRouter == nil {
+		return nil
+	}
+
+	if len(recv.LogRouter.Outputs) == 0 {
+		return fmt.Errorf("The log_router on container %s has no outputs", recv.Name)
+	}
+
+	parserNames := make(map[string]interface{})
+	for _, parser := range recv.LogRouter.Parsers {
+
+		if !logParserNameRegex.MatchString(parser.Name) {
+			return fmt.Errorf("Invalid log_router parser name %s on container %s", parser.Name, recv.Name)
+		}
+
+		if _, exists := parserNames[parser.Name]; exists {
+			return fmt.Errorf("Duplicate log_router parser %s on container %s", parser.Name, recv.Name)
+		}
+		parserNames[parser.Name] = nil
+
+		switch parser.Format {
+		case LogParserFormat_Regex:
+			if parser.Regex == "" {
+				return fmt.Errorf("log_router parser %s on container %s has format regex but no regex",
+					parser.Name, recv.Name)
+			}
+
+			_, err := regexp.Compile(parser.Regex)
+			if err != nil {
+				return fmt.Errorf("Invalid regex on log_router parser %s. %s", parser.Name, err)
+			}
+		case LogParserFormat_JSON, LogParserFormat_Logfmt, LogParserFormat_LTSV:
+			if parser.Regex != "" {
+				return fmt.Errorf("log_router parser %s on container %s only takes a regex with format regex",
+					parser.Name, recv.Name)
+			}
+		default:
+			return fmt.Errorf("Invalid log_router parser format %s. Valid values are [%s, %s, %s, %s]",
+				parser.Format, LogParserFormat_JSON, LogParserFormat_Regex, LogParserFormat_Logfmt, LogParserFormat_LTSV)
+		}
+	}
+
+	for _, output := range recv.LogRouter.Outputs {
+
+		if !logPluginRegex.MatchString(output.Plugin) {
+			return fmt.Errorf("Invalid log_router output plugin %s on container %s", output.Plugin, recv.Name)
+		}
+
+		for key, value := range output.Options {
+			if !logPluginRegex.MatchString(key) {
+				return fmt.Errorf("Invalid log_router output option %s on container %s", key, recv.Name)
+			}
+
+			if strings.ContainsAny(value, "\r\n") {
+				return fmt.Errorf("log_router output option %s on container %s must be a single line", key, recv.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (recv *Container) ValidateSidecars() error {
+
+	err := validateVolumes(recv.Name, recv.Volumes)
+	if err != nil {
+		return err
+	}
+
+	sidecarNames := make(map[string]interface{})
+	for _, sidecar := range recv.Sidecars {
+
+		if !containerNameRegex.MatchString(sidecar.Name) {
+			return fmt.Errorf("Invalid sidecar name %s on container %s", sidecar.Name, recv.Name)
+		}
+
+		if _, exists := sidecarNames[sidecar.Name]; exists {
+			return fmt.Errorf("Duplicate sidecar %s on container %s", sidecar.Name, recv.Name)
+		}
+		sidecarNames[sidecar.Name] = nil
+
+		if sidecar.Image == "" {
+			return fmt.Errorf("Sidecar %s on container %s has no image", sidecar.Name, recv.Name)
+		}
+
+		if sidecar.Uid != nil && *sidecar.Uid < 0 {
+			return fmt.Errorf("Invalid uid on sidecar %s", sidecar.Name)
+		}
+
+		if sidecar.Memory != 0 && sidecar.Memory < MinContainerMemory {
+			return fmt.Errorf("memory on sidecar %s must be at least %d MiB", sidecar.Name, MinContainerMemory)
+		}
+
+		err = validateVolumes(sidecar.Name, sidecar.Volumes)
+		if err != nil {
+			return err
+		}
+
+		if sidecar.HealthCheck != nil {
+
+			if len(sidecar.HealthCheck.Command) == 0 {
+				return fmt.Errorf("The health_check on sidecar %s has no command", sidecar.Name)
+			}
+
+			if sidecar.HealthCheck.Interval < 1 ||
+				sidecar.HealthCheck.Timeout < 1 ||
+				sidecar.HealthCheck.Retries < 1 {
+				return fmt.Errorf("The health_check interval, timeout, and retries on sidecar %s must be positive",
+					sidecar.Name)
+			}
+		}
+	}
+
+	for _, sidecar := range recv.Sidecars {
+		for _, dependency := range sidecar.DependsOn {
+
+			if dependency == sidecar.Name {
+				return fmt.Errorf("Sidecar %s depends on itself", sidecar.Name)
+			}
+
+			if _, exists := sidecarNames[dependency]; !exists {
+				return fmt.Errorf("Sidecar %s depends on %s which isn't a sidecar of container %s",
+					sidecar.Name, dependency, recv.Name)
+			}
+		}
+	}
+
+	_, err = recv.SidecarStartOrder()
+	return err
+}
+
+func validateVolumes(owner string, volumes []*Volume) error {
+
+	paths := make(map[string]interface{})
+	for _, volume := range volumes {
+
+		if !volumeNameRegex.MatchString(volume.Name) {
+			return fmt.Errorf("Invalid volume name %s on %s", volume.Name, owner)
+		}
+
+		if !path.IsAbs(volume.Path) {
+			return fmt.Errorf("The path of volume %s on %s must be absolute", volume.Name, owner)
+		}
+
+		if _, exists := paths[volume.Path]; exists {
+			return fmt.Errorf("Two volumes on %s are mounted at %s", owner, volume.Path)
+		}
+		paths[volume.Path] = nil
+	}
+
+	return nil
+}
+
+func (recv *Region) ValidateContainers() error {
+
+	containerCount := len(recv.Containers)
+	if containerCount == 0 {
+
+		return errors.New("No containers are defined. Was SetDefaults() run?")
+	}
+
+	var healthCheckMethod string
+	var healthCheckPath string
+	var routeCount int
+
+	containerNames := make(map[string]interface{})
+	for _, container := range recv.Containers {
+
+		if container.SrcEnvFile != nil {
+
+			if container.SrcEnvFile.S3Bucket != "" ||
+				container.SrcEnvFile.S3Key != "" {
+
+				if container.SrcEnvFile.S3Bucket == "" {
+					return errors.New("src_env_file missing s3_bucket")
+				}
+
+				if container.SrcEnvFile.S3Key == "" {
+					return errors.New("src_env_file missing s3_key")
+				}
+
+			} else if container.SrcEnvFile.ExecName == "" {
+
+				return errors.New("src_env_file missing exec_name")
+			}
+		}
+
+		if container.SecretsMount != nil {
+
+			if !path.IsAbs(container.SecretsMount.Path) {
+				return fmt.Errorf("secrets_mount path must be absolute on container %s", container.Name)
+			}
+
+			if !fileModeRegex.MatchString(container.SecretsMount.Mode) {
+				return fmt.Errorf("Invalid secrets_mount mode %s on container %s", container.SecretsMount.Mode, container.Name)
+			}
+
+			if container.SecretsMount.ReloadSignal != "" &&
+				!reloadSignalRegex.MatchString(container.SecretsMount.ReloadSignal) {
+				return fmt.Errorf("Invalid secrets_mount reload_signal %s on container %s. Valid values are [SIGHUP, SIGUSR1, SIGUSR2]",
+					container.SecretsMount.ReloadSignal, container.Name)
+			}
+
+			if container.SecretsMount.Uid != nil && *container.SecretsMount.Uid < 0 {
+				return fmt.Errorf("Invalid secrets_mount uid on container %s", container.Name)
+			}
+
+			if container.SecretsMount.Gid != nil && *container.SecretsMount.Gid < 0 {
+				return fmt.Errorf("Invalid secrets_mount gid on container %s", container.Name)
+			}
+		}
+
+		for _, route := range container.Routes {
+
+			if container.Topology != Topology_Inet {
+				return fmt.Errorf("Routes are only valid on inet containers. Found on container %s", container.Name)
+			}
+
+			if route.Port < 1 || route.Port > 65535 {
+				return fmt.Errorf("Invalid route port %d on container %s", route.Port, container.Name)
+			}
+
+			if route.PathPattern == "" && route.HostHeader == "" {
+				return fmt.Errorf("A route on container %s has neither a path_pattern nor a host_header", container.Name)
+			}
+
+			if route.PathPattern != "" && !routePathRegex.MatchString(route.PathPattern) {
+				return fmt.Errorf("Invalid route path_pattern %s on container %s", route.PathPattern, container.Name)
+			}
+
+			if route.HostHeader != "" && !routeHostRegex.MatchString(route.HostHeader) {
+				return fmt.Errorf("Invalid route host_header %s on container %s", route.HostHeader, container.Name)
+			}
+
+			routeCount++
+		}
+
+		if container.Memory != 0 && container.Memory < MinContainerMemory {
+			return fmt.Errorf("memory on container %s must be at least %d MiB", container.Name, MinContainerMemory)
+		}
+
+		err := container.ValidateSidecars()
+		if err != nil {
+			return err
+		}
+
+		err = container.ValidateLogRouter()
+		if err != nil {
+			return err
+		}
+
+		for key := range container.Environment {
+			if !envVarNameRegex.MatchString(key) {
+				return fmt.Errorf("Invalid environment variable %s on container %s", key, container.Name)
+			}
 		}
 
 		if containerCount > 1 && !containerNameRegex.MatchString(container.Name) {
@@ -324,5 +2422,10 @@ func (recv *Region) ValidateContainers() error {
 		}*/
 	}
 
+	// ALB listeners allow 100 rules
+	if routeCount > constants.MaxContainerRoutes {
+		return fmt.Errorf("Too many routes. The maximum is %d", constants.MaxContainerRoutes)
+	}
+
 	return nil
 }
@@ -0,0 +1,104 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+var (
+	webACLARNRegex        = regexp.MustCompile(`^arn:aws[-a-z]*:wafv2:([a-z0-9-]*):\d{12}:(regional|global)/webacl/[-_a-zA-Z0-9]+/[-a-f0-9]+$`)
+	managedRuleGroupRegex = regexp.MustCompile(`^AWSManagedRules[a-zA-Z0-9]+$`)
+)
+
+func (recv *WAF) setDefaults() {
+	if recv.WebACLARN == "" && len(recv.ManagedRuleGroups) == 0 {
+		recv.ManagedRuleGroups = []string{
+			"AWSManagedRulesCommonRuleSet",
+			"AWSManagedRulesKnownBadInputsRuleSet",
+			"AWSManagedRulesAmazonIpReputationList",
+		}
+	}
+}
+
+func (recv *WAF) print(indent string) {
+	fmt.Println(indent+".WAF.WebACLARN", recv.WebACLARN)
+	fmt.Println(indent+".WAF.ManagedRuleGroups", recv.ManagedRuleGroups)
+}
+
+// ValidateWAF checks each region's waf. An ALB can only be associated with a
+// regional web ACL in its own region
+func (recv *Environment) ValidateWAF() error {
+	for _, region := range recv.Regions {
+		waf, err := recv.GetWAF(region.Name)
+		if err != nil {
+			return err
+		}
+		if waf == nil {
+			continue
+		}
+
+		if region.PrimaryTopology() != Topology_Inet {
+			return errors.New("waf requires an inet container in region " + region.Name)
+		}
+
+		// the classic ELB can't be associated with a web ACL
+		if !region.HasRoutes() && recv.Compute != Compute_ECS {
+			return errors.New("waf requires an ALB. Define container routes or use compute: ecs in region " + region.Name)
+		}
+
+		err = waf.validate(region)
+		if err != nil {
+			return fmt.Errorf("waf %s in region %s", err, region.Name)
+		}
+	}
+
+	return nil
+}
+
+func (recv *WAF) validate(region *Region) error {
+	if recv.WebACLARN == "" {
+		seen := make(map[string]struct{})
+		for _, group := range recv.ManagedRuleGroups {
+			if !managedRuleGroupRegex.MatchString(group) {
+				return errors.New("has an invalid managed_rule_groups name " + group)
+			}
+
+			if _, exists := seen[group]; exists {
+				return errors.New("has a duplicate managed_rule_groups name " + group)
+			}
+			seen[group] = struct{}{}
+		}
+		return nil
+	}
+
+	if len(recv.ManagedRuleGroups) > 0 {
+		return errors.New("web_acl_arn and managed_rule_groups can't both be defined")
+	}
+
+	matches := webACLARNRegex.FindStringSubmatch(recv.WebACLARN)
+	if matches == nil {
+		return errors.New("has an invalid web_acl_arn " + recv.WebACLARN)
+	}
+
+	if matches[2] != "regional" {
+		return errors.New("web_acl_arn has CloudFront scope. An ALB needs a regional web ACL")
+	}
+
+	if matches[1] != region.Name {
+		return errors.New("web_acl_arn is in region " + matches[1])
+	}
+
+	return nil
+}
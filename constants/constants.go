@@ -24,11 +24,27 @@ const (
 	ConfigPath                 = ".porter/config"
 	PayloadWorkingDir          = TempDir + "/payload"
 	PayloadPath                = TempDir + "/payload.tar.gz"
+	PipelinePayloadPath        = TempDir + "/pipeline_payload.tar.gz"
 	PackOutputPath             = TempDir + "/pack_output.json"
 	ProvisionOutputPath        = TempDir + "/provision_state.json"
+	StateStoreDir              = TempDir + "/state"
+	GuardRulesDir              = TempDir + "/guard_rules"
 	CreateStackOutputPath      = TempDir + "/create_stack_output.json"
 	CloudFormationTemplatePath = TempDir + "/CloudFormationTemplate.json"
+	DeploySLOReportPath        = TempDir + "/deploy_slo.json"
 	EnvFile                    = "/dockerfile.env"
+	ContainerSecretsPath       = "/var/run/porter-secrets"
+	ContainerVolumesPath       = "/var/lib/porter-volumes"
+	EFSMountPath               = "/mnt/porter-efs"
+
+	// Label on sidecar containers with the image name of their container
+	PodLabel = "porter.pod"
+
+	// Label on service containers with their name in .porter/config
+	ContainerLabel = "porter.container"
+
+	// Label on sidecar containers with their priority. See conf.Sidecar
+	SidecarPriorityLabel = "porter.priority"
 
 	// Debug/config
 	EnvConfig                    = "DEBUG_CONFIG"
@@ -38,6 +54,13 @@ const (
 	EnvStackCreation             = "STACK_CREATION_TIMEOUT"
 	EnvStackCreationPollInterval = "STACK_CREATION_POLL_INTERVAL"
 	EnvDevMode                   = "DEV_MODE"
+	EnvReadOnly                  = "READ_ONLY"
+	EnvAuditPlan                 = "AUDIT_PLAN"
+
+	// OpenTelemetry tracing of deploys. Only OTLP/HTTP with JSON is supported
+	EnvOtelEndpoint       = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	EnvOtelTracesEndpoint = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	EnvOtelHeaders        = "OTEL_EXPORTER_OTLP_HEADERS"
 
 	// Registry-based deployment
 	EnvDockerRegistry         = "DOCKER_REGISTRY"
@@ -48,6 +71,18 @@ const (
 	EnvDockerPushUsername     = "DOCKER_PUSH_USERNAME"
 	EnvDockerPushPassword     = "DOCKER_PUSH_PASSWORD"
 
+	// Set on hosts and containers so logs and metrics from the old and new
+	// stacks can be told apart while both are running
+	EnvDeploymentId = "PORTER_DEPLOYMENT_ID"
+	EnvStackColor   = "PORTER_STACK_COLOR"
+
+	// The CloudWatch Logs groups hosts ship container and host logs to
+	EnvContainerLogGroup = "PORTER_CONTAINER_LOG_GROUP"
+	EnvHostLogGroup      = "PORTER_HOST_LOG_GROUP"
+
+	// The GCS artifact store's access token without token_env
+	EnvGCSAccessToken = "GOOGLE_OAUTH_ACCESS_TOKEN"
+
 	HookPrePack       = "pre_pack"
 	HookPostPack      = "post_pack"
 	HookPreProvision  = "pre_provision"
@@ -58,12 +93,25 @@ const (
 	HookPostPrune     = "post_prune"
 	HookPreHotswap    = "pre_hotswap"
 	HookPostHotswap   = "post_hotswap"
+	HookPostRollback  = "post_rollback"
+	HookMigrate       = "migrate"
 	HookEC2Bootstrap  = "ec2_bootstrap"
 
+	// Lifecycle events published to an environment's notifications
+	EventDeployStarted     = "deploy_started"
+	EventPayloadUploaded   = "payload_uploaded"
+	EventStackCreated      = "stack_created"
+	EventHealthCheckPassed = "health_check_passed"
+	EventPromoted          = "promoted"
+	EventRolledBack        = "rolled_back"
+
 	HRC_Pass   = "pass"
 	HRC_Fail   = "fail"
 	HRC_Always = "always"
 
+	HRO_Local  = "local"
+	HRO_Remote = "remote"
+
 	// The relative path from the service payload to the serialized *conf.Config
 	ServicePayloadConfigPath = "config.yaml"
 
@@ -71,8 +119,52 @@ const (
 	AlteredConfigPath     = TempDir + "/" + ServicePayloadConfigPath
 	PackPayloadConfigPath = PayloadWorkingDir + "/" + ServicePayloadConfigPath
 
-	EC2MetadataURL  = "http://169.254.169.254/latest/meta-data"
-	AmazonLinuxUser = "ec2-user"
+	// CloudWatch namespace of deploy_metrics without a namespace
+	DefaultDeployMetricsNamespace = "Porter/Deploys"
+
+	// porterd publishes the root volume's usage here every DiskMetricsInterval
+	// when the environment has monitoring
+	HostMetricsNamespace  = "Porter/Host"
+	DiskUsedPercentMetric = "DiskUsedPercent"
+	DiskMetricsInterval   = time.Minute
+
+	// porterd checks the service on the instance's private IP this often when
+	// dns targets instances and publishes 1 if it's healthy or 0 if it isn't.
+	// The alarm each instance's Route53 health check follows is on it
+	InstanceHealthyMetric   = "InstanceHealthy"
+	DNSRegistrationInterval = time.Minute
+
+	// porterd reads the host's pressure stall information this often when the
+	// environment has pressure
+	PressureInterval = 10 * time.Second
+
+	// Service payloads are downloaded here on hosts
+	HostPayloadDir = "/porter"
+
+	// porterd checks the root volume against the disk_gc watermarks this
+	// often and publishes what it reclaimed to HostMetricsNamespace. Payloads
+	// younger than DiskGCPayloadGrace may belong to a hot swap in progress
+	DiskGCInterval           = time.Minute
+	DiskGCPayloadGrace       = 10 * time.Minute
+	DiskReclaimedBytesMetric = "DiskReclaimedBytes"
+
+	// rolesanywhere:CreateSession durationSeconds bounds in seconds
+	RolesAnywhereMinSessionDuration     = 900
+	RolesAnywhereMaxSessionDuration     = 43200
+	RolesAnywhereDefaultSessionDuration = 3600
+
+	// AWS calls without aws_retry
+	AWSRetryMaxAttempts = 5
+	AWSRetryBaseDelay   = 100 * time.Millisecond
+	AWSRetryMaxDelay    = 20 * time.Second
+
+	// Files of an artifact written by porter artifact build
+	ArtifactManifestFile = "manifest.json"
+	ArtifactPayloadFile  = "payload.tar.gz"
+
+	EC2MetadataURL      = "http://169.254.169.254/latest/meta-data"
+	EC2MetadataTokenURL = "http://169.254.169.254/latest/api/token"
+	AmazonLinuxUser     = "ec2-user"
 
 	HAProxyConfigPath      = "/etc/haproxy/haproxy.cfg"
 	HAProxyConfigPerms     = 0644
@@ -84,23 +176,59 @@ const (
 
 	PorterDaemonInitPath   = "/etc/init/porterd.conf"
 	PorterDaemonInitPerms  = 0644
+	PorterDaemonUnitPath   = "/etc/systemd/system/porterd.service"
+	SystemdRuntimePath     = "/run/systemd/system"
 	PorterDaemonBindPort   = "3001"
 	PorterDaemonHealthPath = "/health"
 
+	// porterd's host agent only listens on the loopback interface so a
+	// container can't restart another. porter agent reaches it with SSM
+	PorterAgentBindAddr     = "127.0.0.1:3002"
+	PorterAgentHealthPath   = "/agent/health"
+	PorterAgentVersionsPath = "/agent/versions"
+	PorterAgentRestartPath  = "/agent/containers/:name/restart"
+	PorterAgentPayloadPath  = "/agent/payload/pull"
+
 	RsyslogConfigPath       = "/etc/rsyslog.conf"
 	RsyslogPorterConfigPath = "/etc/rsyslog.d/21-porter.conf"
 	RsyslogConfigPerms      = 0644
 
+	AwslogsConfigPath    = "/etc/awslogs/awslogs.conf"
+	AwslogsCliConfigPath = "/etc/awslogs/awscli.conf"
+	AwslogsConfigPerms   = 0644
+
+	// The Fluent Bit container log_router runs next to a container. Its name
+	// has a '-' so it can't collide with a sidecar's
+	LogRouterName      = "log-router"
+	LogRouterImage     = "public.ecr.aws/aws-observability/aws-for-fluent-bit:stable"
+	LogRouterConfigDir = "/tmp/porter-log-router"
+
+	// With compute: ecs a container's secrets_mount is written by a container
+	// of this image that runs before it. Its name has a '-' like the log
+	// router's
+	ECSSecretsMountName  = "porter-secrets"
+	ECSSecretsMountImage = "public.ecr.aws/docker/library/busybox:stable"
+
 	// Porter tags used to follow the AWS colon-delimited convention but this
 	// doesn't work well in Datadog because everything is flattened under the
 	// top-level key. Use hyphen-delimited keys for tags we care about so
 	// they're properly parsed by Datadog
 	AwsCfnLogicalIdTag                    = "aws:cloudformation:logical-id"
 	AwsCfnStackIdTag                      = "aws:cloudformation:stack-id"
+	AwsCfnStackNameTag                    = "aws:cloudformation:stack-name"
 	PorterWaitConditionHandleLogicalIdTag = "porter:aws:cloudformation:waitconditionhandle:logical-id"
 	PorterEnvironmentTag                  = "porter-config-environment"
 	PorterServiceNameTag                  = "porter-service-name"
 	PorterVersion                         = "porter-version"
+	PorterServiceVersionTag               = "porter-service-version"
+	PorterPayloadChecksumTag              = "porter-payload-checksum"
+	PorterSkewJustificationTag            = "porter-skew-justification"
+	PorterStampTag                        = "porter-stamp"
+	PorterStampOfTag                      = "porter-stamp-of"
+	PorterDeploymentIdTag                 = "porter-deployment-id"
+	PorterStackColorTag                   = "porter-stack-color"
+	PorterSecretsKeyArnTag                = "porter-secrets-key-arn"
+	PorterBakedFromTag                    = "porter-baked-from"
 
 	// This is different than AwsCfnStackIdTag. Porter tags the elb into which a
 	// stack is promoted. This is different than the use of AwsCfnStackIdTag
@@ -118,8 +246,34 @@ const (
 	ParameterStackName   = "PorterStackName"
 	ParameterSecretsKey  = "PorterSecretsKey"
 	ParameterSecretsLoc  = "PorterSecretsLoc"
+	ParameterStackColor  = "PorterStackColor"
 	MappingRegionToAMI   = "RegionToAMI"
 
+	// With compute: ecs each container's secrets are passed in a NoEcho
+	// parameter named with this prefix and the container's index. A
+	// parameter's value is at most 4096 bytes
+	ParameterECSSecrets    = "PorterECSSecrets"
+	ParameterValueMaxBytes = 4096
+
+	// The Amazon Linux 2 AMI of arm64 instances. Amazon Linux 1 is x86 only
+	ParameterImageIdArm64 = "PorterImageIdArm64"
+	ImageIdArm64SSMPath   = "/aws/service/ami-amazon-linux-latest/amzn2-ami-hvm-arm64-gp2"
+
+	// Stack outputs instance refresh uses to target (and roll back to) a
+	// launch template version
+	OutputLaunchTemplateId      = "PorterLaunchTemplateId"
+	OutputLaunchTemplateVersion = "PorterLaunchTemplateVersion"
+
+	// Stack outputs downstream services can consume as dependencies. Each is
+	// only set when the stack has what it refers to
+	OutputDNSName         = "PorterDNSName"
+	OutputELBDNSName      = "PorterELBDNSName"
+	OutputSecurityGroupId = "PorterSecurityGroupId"
+
+	// OutputStackDNSName is the DNS name of the stack's own load balancer
+	// that promote points dns target stack at
+	OutputStackDNSName = "PorterStackDNSName"
+
 	HC_HealthyThreshold   = 3
 	HC_Interval           = 5
 	HC_Timeout            = HC_Interval - 2
@@ -133,17 +287,89 @@ const (
 	// associated with a AWS::AutoScaling::LaunchConfiguration
 	MetadataAsLc = "as-lc-sg"
 
+	// A key in resource metadata naming the instance group a
+	// AWS::AutoScaling::LaunchConfiguration or
+	// AWS::AutoScaling::AutoScalingGroup belongs to
+	MetadataInstanceGroup = "porter-instance-group"
+
+	// A key in template metadata recording the service and porter version
+	// that last rendered the template
+	MetadataPorter = "Porter"
+
 	ElbSgLogicalName = "InetToElb"
 
+	// SecurityRulesLogicalName holds the ingress rules of a region's security
+	// block
+	SecurityRulesLogicalName = "SecurityRules"
+
+	// The application load balancer created when containers define routes.
+	// Each listener allows at most 100 rules
+	RouteALBLogicalName = "RouteALB"
+	MaxContainerRoutes  = 100
+
+	// EC2 gives 2 minutes notice before reclaiming a spot instance. The
+	// drain has to fit in that after the instance leaves its load balancers
+	SpotInterruptionPollInterval = 5 * time.Second
+	SpotDeregistrationDelay      = 15 * time.Second
+	SpotMaxDrainTimeout          = 100
+
+	// bytes of the compressed secrets payload provision uploads without a
+	// secrets_payload max_size
+	DefaultSecretsPayloadMaxSize = 1024 * 1024
+
+	// seconds load balancers let in-flight requests finish after an instance
+	// is deregistered. The default is the classic ELB's connection draining
+	// timeout porter always set
+	DefaultDeregistrationDelay = 300
+	MaxDeregistrationDelay     = 3600
+
+	// how long past the deregistration delay porter waits for a load balancer
+	// to report that draining finished
+	DeregistrationGrace = 30 * time.Second
+
 	// http://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/cfn-hup.html#cfn-hup-config-file
 	CfnHupPollIntervalMinutes = 1
 
 	InfrastructureTTL = 24 * time.Hour
 
+	// How long an instance refresh may take to replace every instance
+	InstanceRefreshTimeout = 2 * time.Hour
+
+	// How long a deploy waits for a new stack's IAM role to grant it the
+	// secrets data key
+	InstanceRoleTimeout = 15 * time.Minute
+	InstanceRolePoll    = 5 * time.Second
+
 	DstELBSecurityGroup = "DestinationELBToInstance"
 	SignalQueue         = "PorterSignalQueue"
+	ProgressQueue       = "PorterProgressQueue"
+	OpsTopic            = "PorterOpsTopic"
+	ContainerLogGroup   = "PorterContainerLogGroup"
+	HostLogGroup        = "PorterHostLogGroup"
+
+	// Commands porterd takes from its instance's command queue. Commands
+	// older than CommandMaxAge are discarded so a command can't be replayed
+	// later
+	CommandRefreshSecrets = "refresh_secrets"
+	CommandDrain          = "drain"
+	CommandLogLevel       = "log_level"
+	CommandMaxAge         = 10 * time.Minute
+	CommandDrainTimeout   = 30
+	CommandsHandledPath   = "/var/lib/porter/commands_handled.json"
+
+	// porterd reads the runtime config porter fleet set-config writes this
+	// often. Values are stored in a standard SSM parameter which holds at most
+	// 4KB
+	RuntimeConfigPollInterval = 10 * time.Second
+	RuntimeConfigMaxSize      = 4096
+	RuntimeConfigPath         = "/runtime-config"
 
 	ContainerUserUid = "1001"
+
+	// Autoscaling processes that replace instances on their own. A hot swap
+	// suspends them so the group doesn't churn instances mid-swap
+	ProcessAZRebalance      = "AZRebalance"
+	ProcessReplaceUnhealthy = "ReplaceUnhealthy"
 )
 
 var (
@@ -236,5 +462,68 @@ func init() {
 		"d2.2xlarge": nil,
 		"d2.4xlarge": nil,
 		"d2.8xlarge": nil,
+
+		// Graviton (arm64)
+		"t4g.nano":    nil,
+		"t4g.micro":   nil,
+		"t4g.small":   nil,
+		"t4g.medium":  nil,
+		"t4g.large":   nil,
+		"t4g.xlarge":  nil,
+		"t4g.2xlarge": nil,
+
+		"m6g.medium":   nil,
+		"m6g.large":    nil,
+		"m6g.xlarge":   nil,
+		"m6g.2xlarge":  nil,
+		"m6g.4xlarge":  nil,
+		"m6g.8xlarge":  nil,
+		"m6g.12xlarge": nil,
+		"m6g.16xlarge": nil,
+
+		"c6g.medium":   nil,
+		"c6g.large":    nil,
+		"c6g.xlarge":   nil,
+		"c6g.2xlarge":  nil,
+		"c6g.4xlarge":  nil,
+		"c6g.8xlarge":  nil,
+		"c6g.12xlarge": nil,
+		"c6g.16xlarge": nil,
+
+		"r6g.medium":   nil,
+		"r6g.large":    nil,
+		"r6g.xlarge":   nil,
+		"r6g.2xlarge":  nil,
+		"r6g.4xlarge":  nil,
+		"r6g.8xlarge":  nil,
+		"r6g.12xlarge": nil,
+		"r6g.16xlarge": nil,
+
+		"m7g.medium":   nil,
+		"m7g.large":    nil,
+		"m7g.xlarge":   nil,
+		"m7g.2xlarge":  nil,
+		"m7g.4xlarge":  nil,
+		"m7g.8xlarge":  nil,
+		"m7g.12xlarge": nil,
+		"m7g.16xlarge": nil,
+
+		"c7g.medium":   nil,
+		"c7g.large":    nil,
+		"c7g.xlarge":   nil,
+		"c7g.2xlarge":  nil,
+		"c7g.4xlarge":  nil,
+		"c7g.8xlarge":  nil,
+		"c7g.12xlarge": nil,
+		"c7g.16xlarge": nil,
+
+		"r7g.medium":   nil,
+		"r7g.large":    nil,
+		"r7g.xlarge":   nil,
+		"r7g.2xlarge":  nil,
+		"r7g.4xlarge":  nil,
+		"r7g.8xlarge":  nil,
+		"r7g.12xlarge": nil,
+		"r7g.16xlarge": nil,
 	}
 }
@@ -0,0 +1,233 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package agent
+
+import (
+	"errors"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/docker/engine"
+	"github.com/inconshreveable/log15"
+)
+
+// downloads the service payload and secrets like the host did while it booted
+const getPayloadPath = "/usr/bin/porter_get_secrets"
+
+// seconds a container is given to stop when it's restarted. It's less than
+// porterd's request timeout so the restart finishes before the response
+const RestartTimeout = 5
+
+var (
+	ErrNoContainer   = errors.New("no running container has that name")
+	ErrPullInProcess = errors.New("a payload pull is in process")
+)
+
+type (
+	// Container is a service container on the host
+	Container struct {
+		Name    string `json:"name"`
+		Id      string `json:"id"`
+		Image   string `json:"image"`
+		ImageId string `json:"image_id"`
+		State   string `json:"state"`
+
+		// starting, healthy, or unhealthy. Empty if the image has no
+		// HEALTHCHECK
+		Health string `json:"health,omitempty"`
+	}
+
+	Health struct {
+		Healthy    bool        `json:"healthy"`
+		Containers []Container `json:"containers"`
+		LastPull   *Pull       `json:"last_pull,omitempty"`
+	}
+
+	Versions struct {
+		Porter     string      `json:"porter"`
+		Docker     string      `json:"docker"`
+		Containers []Container `json:"containers"`
+	}
+
+	// Pull is a payload pull started with PullPayload
+	Pull struct {
+		StartedAt  time.Time  `json:"started_at"`
+		FinishedAt *time.Time `json:"finished_at,omitempty"`
+		Error      string     `json:"error,omitempty"`
+	}
+)
+
+var (
+	pullLock sync.Mutex
+	lastPull *Pull
+)
+
+// GetHealth reports the state of the host's service containers
+func GetHealth(dockerClient *engine.Client) (health Health, err error) {
+	health.Containers, err = containers(dockerClient, true)
+	if err != nil {
+		return
+	}
+
+	health.Healthy = Healthy(health.Containers)
+
+	pullLock.Lock()
+	if lastPull != nil {
+		pull := *lastPull
+		health.LastPull = &pull
+	}
+	pullLock.Unlock()
+
+	return
+}
+
+// GetVersions reports the versions of porter, docker, and the images of the
+// host's service containers
+func GetVersions(dockerClient *engine.Client) (versions Versions, err error) {
+	info, err := dockerClient.Info()
+	if err != nil {
+		return
+	}
+
+	versions.Porter = constants.Version
+	versions.Docker = info.ServerVersion
+	versions.Containers, err = containers(dockerClient, false)
+	return
+}
+
+// Healthy is true if there are containers and all of them are running and
+// not failing their HEALTHCHECK
+func Healthy(containers []Container) bool {
+	if len(containers) == 0 {
+		return false
+	}
+
+	for _, container := range containers {
+		if container.State != "running" {
+			return false
+		}
+
+		switch container.Health {
+		case "", "healthy":
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// Restart restarts the running containers with the name in .porter/config
+func Restart(log log15.Logger, dockerClient *engine.Client, name string) error {
+	list, err := dockerClient.ContainerList(map[string][]string{
+		"label":  {constants.ContainerLabel + "=" + name},
+		"status": {"running"},
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(list) == 0 {
+		return ErrNoContainer
+	}
+
+	for _, container := range list {
+		log.Info("Restarting container", "ContainerId", container.Id)
+
+		err = dockerClient.ContainerRestart(container.Id, RestartTimeout)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PullPayload downloads the service payload and secrets again in the
+// background. Its outcome is reported by GetHealth
+func PullPayload(log log15.Logger) error {
+	pullLock.Lock()
+	defer pullLock.Unlock()
+
+	if lastPull != nil && lastPull.FinishedAt == nil {
+		return ErrPullInProcess
+	}
+
+	pull := &Pull{StartedAt: time.Now()}
+	lastPull = pull
+
+	go func() {
+		log.Info("Pulling the service payload")
+
+		output, err := exec.Command(getPayloadPath).CombinedOutput()
+
+		pullLock.Lock()
+		defer pullLock.Unlock()
+
+		finishedAt := time.Now()
+		pull.FinishedAt = &finishedAt
+
+		if err != nil {
+			log.Error(getPayloadPath, "Error", err, "Output", string(output))
+			pull.Error = err.Error()
+			return
+		}
+
+		log.Info("Pulled the service payload")
+	}()
+
+	return nil
+}
+
+// containers lists the host's service containers sorted by name. Inspecting
+// them reads their health
+func containers(dockerClient *engine.Client, inspect bool) ([]Container, error) {
+	list, err := dockerClient.ContainerList(map[string][]string{
+		"label": {constants.ContainerLabel},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	containers := make([]Container, 0, len(list))
+	for _, item := range list {
+		container := Container{
+			Name:    item.Labels[constants.ContainerLabel],
+			Id:      item.Id,
+			Image:   item.Image,
+			ImageId: item.ImageID,
+			State:   item.State,
+		}
+
+		if inspect {
+			containerJSON, err := dockerClient.ContainerInspect(item.Id)
+			if err != nil {
+				return nil, err
+			}
+
+			if containerJSON.State.Health != nil {
+				container.Health = containerJSON.State.Health.Status
+			}
+		}
+
+		containers = append(containers, container)
+	}
+
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].Name < containers[j].Name
+	})
+
+	return containers, nil
+}
@@ -0,0 +1,39 @@
+package agent_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/daemon/agent"
+)
+
+var _ = Describe("Agent", func() {
+
+	It("is healthy when every container is running and passing its healthcheck", func() {
+		Expect(agent.Healthy([]agent.Container{
+			{Name: "web", State: "running", Health: "healthy"},
+			{Name: "worker", State: "running"},
+		})).To(BeTrue())
+	})
+
+	It("is unhealthy when a container isn't running", func() {
+		Expect(agent.Healthy([]agent.Container{
+			{Name: "web", State: "running"},
+			{Name: "worker", State: "exited"},
+		})).To(BeFalse())
+	})
+
+	It("is unhealthy when a container is starting or failing its healthcheck", func() {
+		Expect(agent.Healthy([]agent.Container{
+			{Name: "web", State: "running", Health: "starting"},
+		})).To(BeFalse())
+
+		Expect(agent.Healthy([]agent.Container{
+			{Name: "web", State: "running", Health: "unhealthy"},
+		})).To(BeFalse())
+	})
+
+	It("is unhealthy without containers", func() {
+		Expect(agent.Healthy(nil)).To(BeFalse())
+	})
+})
@@ -0,0 +1,121 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	. "github.com/adobe-platform/porter/daemon/http"
+
+	"github.com/adobe-platform/porter/daemon/agent"
+	"github.com/adobe-platform/porter/daemon/middleware"
+	"github.com/adobe-platform/porter/docker/engine"
+	"github.com/inconshreveable/log15"
+	"golang.org/x/net/context"
+)
+
+func AgentHealthHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	log := middleware.GetRequestLog(ctx)
+
+	dockerClient, err := engine.New()
+	if err != nil {
+		log.Error("engine.New", "Error", err)
+		S500(w)
+		return
+	}
+
+	health, err := agent.GetHealth(dockerClient)
+	if err != nil {
+		log.Error("agent.GetHealth", "Error", err)
+		S500(w)
+		return
+	}
+
+	status := http.StatusOK
+	if !health.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(log, w, status, health)
+}
+
+func AgentVersionsHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	log := middleware.GetRequestLog(ctx)
+
+	dockerClient, err := engine.New()
+	if err != nil {
+		log.Error("engine.New", "Error", err)
+		S500(w)
+		return
+	}
+
+	versions, err := agent.GetVersions(dockerClient)
+	if err != nil {
+		log.Error("agent.GetVersions", "Error", err)
+		S500(w)
+		return
+	}
+
+	writeJSON(log, w, http.StatusOK, versions)
+}
+
+func AgentRestartHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	log := middleware.GetRequestLog(ctx)
+
+	name := middleware.GetParams(ctx).ByName("name")
+	log = log.New("Container", name)
+
+	dockerClient, err := engine.New()
+	if err != nil {
+		log.Error("engine.New", "Error", err)
+		S500(w)
+		return
+	}
+
+	err = agent.Restart(log, dockerClient, name)
+	if err == agent.ErrNoContainer {
+		S404(w)
+		return
+	} else if err != nil {
+		log.Error("agent.Restart", "Error", err)
+		S500(w)
+		return
+	}
+}
+
+// AgentPayloadHandler responds before the pull is done. GET
+// constants.PorterAgentHealthPath reports its outcome
+func AgentPayloadHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	log := middleware.GetRequestLog(ctx)
+
+	err := agent.PullPayload(log)
+	if err == agent.ErrPullInProcess {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Error("agent.PullPayload", "Error", err)
+		S500(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func writeJSON(log log15.Logger, w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Error("json.NewEncoder(w).Encode", "Error", err)
+	}
+}
@@ -45,6 +45,11 @@ func NewRouter() *httprouter.Router {
 	createRoute(router.GET, "/aws/ec2/tags", EC2TagsHandler, middlewares...)
 	createRoute(router.GET, "/aws/region", RegionHandler, middlewares...)
 
+	//
+	// Runtime config from porter fleet set-config
+	//
+	createRoute(router.GET, constants.RuntimeConfigPath, RuntimeConfigHandler, middlewares...)
+
 	//
 	// Introspection and profiling
 	//
@@ -56,6 +61,23 @@ func NewRouter() *httprouter.Router {
 	return router
 }
 
+// NewAgentRouter is the host agent's API. It changes the host so it isn't
+// served to containers
+func NewAgentRouter() *httprouter.Router {
+	router := httprouter.New()
+
+	middlewares := []func(middleware.Handle) middleware.Handle{
+		middleware.VersionHeader,
+	}
+
+	createRoute(router.GET, constants.PorterAgentHealthPath, AgentHealthHandler, middlewares...)
+	createRoute(router.GET, constants.PorterAgentVersionsPath, AgentVersionsHandler, middlewares...)
+	createRoute(router.POST, constants.PorterAgentRestartPath, AgentRestartHandler, middlewares...)
+	createRoute(router.POST, constants.PorterAgentPayloadPath, AgentPayloadHandler, middlewares...)
+
+	return router
+}
+
 func createRoute(method func(path string, handle httprouter.Handle),
 	path string,
 	handler middleware.Handle,
@@ -17,7 +17,14 @@ import (
 	"github.com/adobe-platform/porter/constants"
 	"github.com/adobe-platform/porter/daemon/api"
 	"github.com/adobe-platform/porter/daemon/config"
+	"github.com/adobe-platform/porter/daemon/disk_gc"
+	"github.com/adobe-platform/porter/daemon/disk_metrics"
+	"github.com/adobe-platform/porter/daemon/dns_registration"
 	"github.com/adobe-platform/porter/daemon/elb_registration"
+	"github.com/adobe-platform/porter/daemon/pressure"
+	"github.com/adobe-platform/porter/daemon/remote_command"
+	"github.com/adobe-platform/porter/daemon/runtime_config"
+	"github.com/adobe-platform/porter/daemon/spot_interruption"
 	"github.com/adobe-platform/porter/daemon/wait_handle"
 	"github.com/adobe-platform/porter/logger"
 )
@@ -27,9 +34,23 @@ func Run() {
 
 	go wait_handle.Call()
 	go elb_registration.Call()
+	go spot_interruption.Call()
+	go disk_metrics.Call()
+	go disk_gc.Call()
+	go pressure.Call()
+	go remote_command.Call()
+	go runtime_config.Call()
+	go dns_registration.Call()
 
 	log := logger.Daemon()
 
+	go func() {
+		log.Info("porterd agent listening on " + constants.PorterAgentBindAddr)
+		if err := http.ListenAndServe(constants.PorterAgentBindAddr, api.NewAgentRouter()); err != nil {
+			log.Error("Failed to start the agent", "Error", err)
+		}
+	}()
+
 	router := api.NewRouter()
 
 	log.Info("porterd listing on port " + constants.PorterDaemonBindPort)
@@ -0,0 +1,126 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package disk_gc
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adobe-platform/porter/docker/engine"
+)
+
+const (
+	KindPayload = "payload"
+	KindImage   = "image"
+
+	untaggedImage = "<none>:<none>"
+)
+
+// Candidate is a payload or image that can be removed to reclaim disk
+type Candidate struct {
+	Kind string
+
+	// Refs are removed in order. A payload's path or an image's tags. An
+	// untagged image's id
+	Refs []string
+
+	// bytes
+	Size int64
+
+	// when the payload was downloaded or the image was built
+	Time time.Time
+}
+
+// PayloadCandidates is every service payload in dir except the newest which
+// the host's containers were started from. busy is true if the newest is
+// younger than grace because a hot swap may still be loading it
+func PayloadCandidates(dir string, now time.Time, grace time.Duration) (candidates []Candidate, busy bool, err error) {
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	candidates = make([]Candidate, 0)
+	var newest *Candidate
+
+	for _, fileInfo := range fileInfos {
+		if fileInfo.IsDir() || !strings.HasSuffix(fileInfo.Name(), ".tar.gz") {
+			continue
+		}
+
+		candidate := Candidate{
+			Kind: KindPayload,
+			Refs: []string{filepath.Join(dir, fileInfo.Name())},
+			Size: fileInfo.Size(),
+			Time: fileInfo.ModTime(),
+		}
+
+		if newest == nil {
+			newest = &candidate
+			continue
+		}
+
+		if candidate.Time.After(newest.Time) {
+			candidate, *newest = *newest, candidate
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	busy = newest != nil && now.Sub(newest.Time) < grace
+	return
+}
+
+// ImageCandidates is every image no running container uses. Images used by
+// stopped containers are also returned but docker refuses to remove them
+func ImageCandidates(images []engine.Image, containers []engine.Container) []Candidate {
+	inUse := make(map[string]struct{})
+	for _, container := range containers {
+		inUse[container.ImageID] = struct{}{}
+	}
+
+	candidates := make([]Candidate, 0)
+	for _, image := range images {
+		if _, exists := inUse[image.Id]; exists {
+			continue
+		}
+
+		refs := make([]string, 0)
+		for _, tag := range image.RepoTags {
+			if tag != untaggedImage {
+				refs = append(refs, tag)
+			}
+		}
+		if len(refs) == 0 {
+			refs = append(refs, image.Id)
+		}
+
+		candidates = append(candidates, Candidate{
+			Kind: KindImage,
+			Refs: refs,
+			Size: image.Size,
+			Time: time.Unix(image.Created, 0),
+		})
+	}
+
+	return candidates
+}
+
+// OldestFirst sorts candidates so the ones least likely to be needed again
+// are removed first
+func OldestFirst(candidates []Candidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Time.Before(candidates[j].Time)
+	})
+}
@@ -0,0 +1,189 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package disk_gc
+
+import (
+	"os"
+	"time"
+
+	"github.com/adobe-platform/porter/aws/cloudwatch"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/daemon/disk_metrics"
+	"github.com/adobe-platform/porter/daemon/flags"
+	"github.com/adobe-platform/porter/daemon/identity"
+	"github.com/adobe-platform/porter/docker/engine"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/inconshreveable/log15"
+)
+
+// Call removes old service payloads and unused images, oldest first, once the
+// root volume's used percent reaches the high watermark until it's under the
+// low watermark.
+//
+// Hosts that hot swap for months otherwise fill their disk with payloads and
+// images of versions that will never run again and the next hot swap fails
+// part way. With monitoring the bytes reclaimed are published to CloudWatch
+func Call() {
+	if flags.DiskGCHigh == 0 {
+		return
+	}
+
+	log := logger.Daemon("AWS_STACKID", os.Getenv("AWS_STACKID"))
+
+	log.Info("Watching disk watermarks", "High", flags.DiskGCHigh, "Low", flags.DiskGCLow)
+
+	publish := func(reclaimed int64) {}
+	if flags.DiskMetrics {
+		publish = publisher(log)
+	}
+
+	for {
+		time.Sleep(constants.DiskGCInterval)
+
+		percent, err := disk_metrics.UsedPercent("/")
+		if err != nil {
+			log.Warn("statfs", "Error", err)
+			continue
+		}
+
+		if percent < flags.DiskGCHigh {
+			continue
+		}
+
+		reclaimed := collect(log.New("UsedPercent", percent))
+		if reclaimed > 0 {
+			publish(reclaimed)
+		}
+	}
+}
+
+// collect removes candidates until the root volume is under the low
+// watermark. It's the bytes reclaimed
+func collect(log log15.Logger) (reclaimed int64) {
+	log.Warn("Root volume is past the high watermark. Reclaiming disk")
+
+	payloads, busy, err := PayloadCandidates(constants.HostPayloadDir, time.Now(), constants.DiskGCPayloadGrace)
+	if err != nil {
+		log.Error("ReadDir", "Path", constants.HostPayloadDir, "Error", err)
+		return
+	}
+	if busy {
+		log.Info("Not reclaiming disk while a hot swap may be loading a payload")
+		return
+	}
+
+	dockerClient, err := engine.New()
+	if err != nil {
+		log.Error("engine.New", "Error", err)
+		return
+	}
+
+	images, err := dockerClient.ImageList()
+	if err != nil {
+		log.Error("docker images", "Error", err)
+		return
+	}
+
+	containers, err := dockerClient.ContainerList(nil)
+	if err != nil {
+		log.Error("docker ps", "Error", err)
+		return
+	}
+
+	candidates := append(payloads, ImageCandidates(images, containers)...)
+	OldestFirst(candidates)
+
+	for _, candidate := range candidates {
+
+		percent, err := disk_metrics.UsedPercent("/")
+		if err == nil && percent < flags.DiskGCLow {
+			break
+		}
+
+		if remove(log.New("Kind", candidate.Kind, "Refs", candidate.Refs), dockerClient, candidate) {
+			reclaimed += candidate.Size
+		}
+	}
+
+	percent, _ := disk_metrics.UsedPercent("/")
+	if percent < flags.DiskGCLow {
+		log.Info("Reclaimed disk", "Bytes", reclaimed, "UsedPercentAfter", percent)
+	} else {
+		log.Warn("Nothing left to reclaim but the root volume is still past the low watermark",
+			"Bytes", reclaimed, "UsedPercentAfter", percent)
+	}
+	return
+}
+
+func remove(log log15.Logger, dockerClient *engine.Client, candidate Candidate) (success bool) {
+	for _, ref := range candidate.Refs {
+
+		var err error
+		if candidate.Kind == KindPayload {
+			err = os.Remove(ref)
+		} else {
+			err = dockerClient.ImageRemove(ref)
+		}
+
+		if err != nil {
+			if engine.IsConflict(err) {
+				log.Debug("Image is used by a stopped container")
+			} else {
+				log.Warn("Failed to remove", "Ref", ref, "Error", err)
+			}
+			return
+		}
+	}
+
+	log.Info("Removed", "Bytes", candidate.Size)
+	success = true
+	return
+}
+
+// publisher publishes reclaimed bytes with the instance's autoscaling group
+// as the dimension like disk_metrics
+func publisher(log log15.Logger) func(int64) {
+	noop := func(int64) {}
+
+	ii, err := identity.Get(log)
+	if err != nil {
+		return noop
+	}
+
+	autoScalingGroup := ii.Tags[disk_metrics.AutoScalingGroupTag]
+	if autoScalingGroup == "" {
+		log.Warn("Not publishing reclaimed disk. The instance has no " + disk_metrics.AutoScalingGroupTag + " tag")
+		return noop
+	}
+
+	client := cloudwatch.New(aws_session.Get(ii.AwsCreds.Region))
+
+	return func(reclaimed int64) {
+		_, err := client.PutMetricData(&cloudwatch.PutMetricDataInput{
+			Namespace: constants.HostMetricsNamespace,
+			MetricData: []cloudwatch.MetricDatum{
+				{
+					MetricName: constants.DiskReclaimedBytesMetric,
+					Dimensions: []cloudwatch.Dimension{
+						{Name: "AutoScalingGroupName", Value: autoScalingGroup},
+					},
+					Value: float64(reclaimed),
+					Unit:  "Bytes",
+				},
+			},
+		})
+		if err != nil {
+			log.Warn("cloudwatch:PutMetricData", "Error", err)
+		}
+	}
+}
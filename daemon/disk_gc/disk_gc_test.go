@@ -0,0 +1,87 @@
+package disk_gc_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adobe-platform/porter/daemon/disk_gc"
+	"github.com/adobe-platform/porter/docker/engine"
+)
+
+var _ = Describe("Disk GC", func() {
+
+	var (
+		dir string
+		now time.Time
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "disk_gc")
+		Expect(err).To(BeNil())
+
+		now = time.Now()
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	payload := func(name string, age time.Duration) string {
+		path := filepath.Join(dir, name)
+		Expect(ioutil.WriteFile(path, []byte("payload"), 0644)).To(Succeed())
+		Expect(os.Chtimes(path, now.Add(-age), now.Add(-age))).To(Succeed())
+		return path
+	}
+
+	It("keeps the newest payload", func() {
+		oldest := payload("1.tar.gz", 3*time.Hour)
+		payload("3.tar.gz", time.Hour)
+		older := payload("2.tar.gz", 2*time.Hour)
+		payload("notes.txt", 4*time.Hour)
+
+		candidates, busy, err := disk_gc.PayloadCandidates(dir, now, 10*time.Minute)
+		Expect(err).To(BeNil())
+		Expect(busy).To(BeFalse())
+
+		disk_gc.OldestFirst(candidates)
+		Expect(candidates).To(HaveLen(2))
+		Expect(candidates[0].Refs).To(Equal([]string{oldest}))
+		Expect(candidates[1].Refs).To(Equal([]string{older}))
+		Expect(candidates[0].Size).To(Equal(int64(len("payload"))))
+	})
+
+	It("is busy while the newest payload is within the grace period", func() {
+		payload("1.tar.gz", time.Hour)
+		payload("2.tar.gz", time.Minute)
+
+		candidates, busy, err := disk_gc.PayloadCandidates(dir, now, 10*time.Minute)
+		Expect(err).To(BeNil())
+		Expect(busy).To(BeTrue())
+		Expect(candidates).To(HaveLen(1))
+	})
+
+	It("skips images of running containers and removes untagged images by id", func() {
+		images := []engine.Image{
+			{Id: "sha256:running", RepoTags: []string{"s3/s3:porter-2-2-app"}, Created: 200},
+			{Id: "sha256:old", RepoTags: []string{"s3/s3:porter-1-1-app", "app:latest"}, Created: 100, Size: 10},
+			{Id: "sha256:dangling", RepoTags: []string{"<none>:<none>"}, Created: 50, Size: 5},
+		}
+		containers := []engine.Container{
+			{Id: "c1", ImageID: "sha256:running"},
+		}
+
+		candidates := disk_gc.ImageCandidates(images, containers)
+		disk_gc.OldestFirst(candidates)
+
+		Expect(candidates).To(HaveLen(2))
+		Expect(candidates[0].Refs).To(Equal([]string{"sha256:dangling"}))
+		Expect(candidates[1].Refs).To(Equal([]string{"s3/s3:porter-1-1-app", "app:latest"}))
+		Expect(candidates[1].Kind).To(Equal(disk_gc.KindImage))
+	})
+})
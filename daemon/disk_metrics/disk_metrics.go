@@ -0,0 +1,80 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package disk_metrics
+
+import (
+	"os"
+	"time"
+
+	"github.com/adobe-platform/porter/aws/cloudwatch"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/daemon/flags"
+	"github.com/adobe-platform/porter/daemon/identity"
+	"github.com/adobe-platform/porter/logger"
+)
+
+// AutoScalingGroupTag is the tag EC2 autoscaling puts on each instance it
+// launches
+const AutoScalingGroupTag = "aws:autoscaling:groupName"
+
+// Call publishes the root volume's used percent every DiskMetricsInterval.
+//
+// The metric's dimension is the instance's autoscaling group so the stack's
+// disk alarm sees the fullest instance of the group
+func Call() {
+	if !flags.DiskMetrics {
+		return
+	}
+
+	log := logger.Daemon("AWS_STACKID", os.Getenv("AWS_STACKID"))
+
+	ii, err := identity.Get(log)
+	if err != nil {
+		return
+	}
+
+	autoScalingGroup := ii.Tags[AutoScalingGroupTag]
+	if autoScalingGroup == "" {
+		log.Warn("Not publishing disk metrics. The instance has no " + AutoScalingGroupTag + " tag")
+		return
+	}
+
+	client := cloudwatch.New(aws_session.Get(ii.AwsCreds.Region))
+
+	for {
+		time.Sleep(constants.DiskMetricsInterval)
+
+		percent, err := UsedPercent("/")
+		if err != nil {
+			log.Warn("statfs", "Error", err)
+			continue
+		}
+
+		_, err = client.PutMetricData(&cloudwatch.PutMetricDataInput{
+			Namespace: constants.HostMetricsNamespace,
+			MetricData: []cloudwatch.MetricDatum{
+				{
+					MetricName: constants.DiskUsedPercentMetric,
+					Dimensions: []cloudwatch.Dimension{
+						{Name: "AutoScalingGroupName", Value: autoScalingGroup},
+					},
+					Value: percent,
+					Unit:  "Percent",
+				},
+			},
+		})
+		if err != nil {
+			log.Warn("cloudwatch:PutMetricData", "Error", err)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package dns_registration
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/adobe-platform/porter/aws/cloudwatch"
+	"github.com/adobe-platform/porter/aws/ec2metadata"
+	"github.com/adobe-platform/porter/aws/route53"
+	"github.com/adobe-platform/porter/aws/ssm"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/daemon/flags"
+	"github.com/adobe-platform/porter/daemon/identity"
+	"github.com/adobe-platform/porter/instance_dns"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/inconshreveable/log15"
+)
+
+// Call keeps the instance in the record set while its stack is the one
+// promoted when dns targets instances. This is how instances the autoscaling
+// group launches after promote get a record.
+//
+// Every DNSRegistrationInterval the service is checked on the instance's
+// private IP and the result is published for the alarm the record's health
+// check follows. The record is removed when porterd is stopped as the
+// instance shuts down
+func Call() {
+	if flags.DNSName == "" {
+		return
+	}
+
+	stackId := os.Getenv("AWS_STACKID")
+	log := logger.Daemon("AWS_STACKID", stackId, "DNSName", flags.DNSName)
+
+	ii, err := identity.Get(log)
+	if err != nil {
+		return
+	}
+
+	privateIp, err := getPrivateIp()
+	if err != nil {
+		log.Error("GET /local-ipv4", "Error", err)
+		return
+	}
+
+	instance := instance_dns.Instance{
+		Region:    ii.AwsCreds.Region,
+		Id:        ii.Instance.InstanceID,
+		PrivateIp: privateIp,
+	}
+
+	awsSession := aws_session.Get(ii.AwsCreds.Region)
+	cwClient := cloudwatch.New(awsSession)
+	r53Client := route53.New(awsSession)
+	ssmClient := ssm.New(awsSession)
+
+	var hostedZoneId string
+	for {
+		hostedZoneId, err = instance_dns.HostedZoneId(r53Client, flags.HostedZoneName)
+		if err == nil {
+			break
+		}
+
+		log.Warn("route53:ListHostedZonesByName", "HostedZoneName", flags.HostedZoneName, "Error", err)
+		time.Sleep(constants.DNSRegistrationInterval)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+
+	healthURL := fmt.Sprintf("http://%s:%d%s", privateIp, constants.InetBindPorts[0], flags.HealthCheckPath)
+	healthCheckClient := &http.Client{
+		Timeout: constants.HC_Timeout * time.Second,
+	}
+
+	ticker := time.NewTicker(constants.DNSRegistrationInterval)
+	for {
+		publishHealth(log, cwClient, instance.Id, checkHealth(log, healthCheckClient, healthURL))
+
+		if promoted, ok := isPromoted(log, ssmClient, stackId); ok {
+			if promoted {
+				err = instance_dns.Register(cwClient, r53Client, hostedZoneId, flags.DNSName, instance)
+			} else {
+				err = instance_dns.DeregisterInstance(cwClient, r53Client, hostedZoneId, flags.DNSName, instance)
+			}
+			if err != nil {
+				log.Warn("Updating the instance's record failed", "Promoted", promoted, "Error", err)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case sig := <-stop:
+			log.Info("Removing the instance's record", "Signal", sig)
+
+			err = instance_dns.DeregisterInstance(cwClient, r53Client, hostedZoneId, flags.DNSName, instance)
+			if err != nil {
+				log.Error("Removing the instance's record failed", "Error", err)
+			}
+			os.Exit(0)
+		}
+	}
+}
+
+func getPrivateIp() (string, error) {
+	resp, err := ec2metadata.Get("/local-ipv4")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status code %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(body)), nil
+}
+
+// checkHealth is the service's health on the address DNS points at
+func checkHealth(log log15.Logger, client *http.Client, healthURL string) bool {
+	// assume a worker or cron primary topology
+	if flags.HealthCheckMethod == "" && flags.HealthCheckPath == "" {
+		return true
+	}
+
+	req, err := http.NewRequest(flags.HealthCheckMethod, healthURL, nil)
+	if err != nil {
+		log.Warn("http.NewRequest", "Error", err)
+		return false
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Warn(flags.HealthCheckMethod+" "+healthURL, "Error", err)
+		return false
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Warn(flags.HealthCheckMethod+" "+healthURL, "StatusCode", resp.StatusCode)
+		return false
+	}
+
+	return true
+}
+
+func publishHealth(log log15.Logger, client *cloudwatch.CloudWatch, instanceId string, healthy bool) {
+	var value float64
+	if healthy {
+		value = 1
+	}
+
+	_, err := client.PutMetricData(&cloudwatch.PutMetricDataInput{
+		Namespace: constants.HostMetricsNamespace,
+		MetricData: []cloudwatch.MetricDatum{
+			{
+				MetricName: constants.InstanceHealthyMetric,
+				Dimensions: []cloudwatch.Dimension{
+					{Name: "InstanceId", Value: instanceId},
+				},
+				Value: value,
+				Unit:  "Count",
+			},
+		},
+	})
+	if err != nil {
+		log.Warn("cloudwatch:PutMetricData", "Error", err)
+	}
+}
+
+// isPromoted is true if the promoted stack the DNS stack wrote is this
+// instance's stack. ok is false if that can't be known right now
+func isPromoted(log log15.Logger, client *ssm.SSM, stackId string) (promoted, ok bool) {
+	output, err := client.GetParameter(&ssm.GetParameterInput{
+		Name: instance_dns.ParameterName(flags.ServiceName, flags.Environment),
+	})
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == ssm.ErrCodeParameterNotFound {
+			return false, true
+		}
+
+		log.Warn("ssm:GetParameter", "Error", err)
+		return false, false
+	}
+
+	return output.Parameter.Value == stackId, true
+}
@@ -16,4 +16,31 @@ var (
 	ServiceName       string
 	HealthCheckMethod string
 	HealthCheckPath   string
+
+	// Seconds containers are given to stop after a spot interruption notice.
+	// 0 means the instance isn't spot
+	SpotDrainTimeout int
+
+	// Publish the root volume's usage to CloudWatch
+	DiskMetrics bool
+
+	// Restart or shed sidecars past these pressure thresholds. 0 disables a
+	// threshold
+	PressureMemory   float64
+	PressureCPU      float64
+	PressureAction   string
+	PressureCooldown int
+
+	// Reclaim disk once the root volume's used percent reaches DiskGCHigh
+	// until it's under DiskGCLow. 0 disables it
+	DiskGCHigh float64
+	DiskGCLow  float64
+
+	// Create the instance's command queue and run the commands on it
+	CommandQueue bool
+
+	// Register the instance in this record set while its stack is promoted.
+	// Empty unless dns targets instances
+	DNSName        string
+	HostedZoneName string
 )
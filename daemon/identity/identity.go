@@ -13,11 +13,10 @@ package identity
 
 import (
 	"io/ioutil"
-	"net/http"
 	"sync"
 
+	"github.com/adobe-platform/porter/aws/ec2metadata"
 	"github.com/adobe-platform/porter/aws_session"
-	"github.com/adobe-platform/porter/constants"
 	"github.com/adobe-platform/porter/daemon/flags"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
@@ -73,14 +72,14 @@ func populateInstanceIdentity(log log15.Logger) error {
 	log = log.New("Method", "identity.Get")
 
 	//Get instance id
-	instanceIdResp, err := http.Get(constants.EC2MetadataURL + "/instance-id")
+	instanceIdResp, err := ec2metadata.Get("/instance-id")
 	if err != nil {
 		log.Error("Error on instanceIdResp", "Error", err)
 		return err
 	}
 
 	//Get AWS Region
-	awsRegionResp, err := http.Get(constants.EC2MetadataURL + "/placement/availability-zone")
+	awsRegionResp, err := ec2metadata.Get("/placement/availability-zone")
 	if err != nil {
 		log.Error("Error on awsRegionResp", "Error", err)
 		return err
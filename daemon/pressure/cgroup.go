@@ -0,0 +1,65 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package pressure
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// CgroupVersion is 2 on hosts with the unified hierarchy like newer AMIs and 1
+// otherwise
+func CgroupVersion() int {
+	if _, err := os.Stat(path.Join(cgroupRoot, "cgroup.controllers")); err == nil {
+		return 2
+	}
+	return 1
+}
+
+// memoryUsagePaths are where docker puts a container's memory usage with the
+// cgroupfs and systemd cgroup drivers
+func memoryUsagePaths(version int, containerId string) []string {
+	if version == 2 {
+		return []string{
+			path.Join(cgroupRoot, "system.slice", "docker-"+containerId+".scope", "memory.current"),
+			path.Join(cgroupRoot, "docker", containerId, "memory.current"),
+		}
+	}
+
+	return []string{
+		path.Join(cgroupRoot, "memory", "docker", containerId, "memory.usage_in_bytes"),
+		path.Join(cgroupRoot, "memory", "system.slice", "docker-"+containerId+".scope", "memory.usage_in_bytes"),
+	}
+}
+
+// memoryUsage is the container's memory usage in bytes. It's 0 if it can't be
+// read
+func memoryUsage(version int, containerId string) int64 {
+	for _, usagePath := range memoryUsagePaths(version, containerId) {
+		contents, err := ioutil.ReadFile(usagePath)
+		if err != nil {
+			continue
+		}
+
+		usage, err := strconv.ParseInt(strings.TrimSpace(string(contents)), 10, 64)
+		if err == nil {
+			return usage
+		}
+	}
+
+	return 0
+}
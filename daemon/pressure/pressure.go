@@ -0,0 +1,180 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package pressure
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/daemon/flags"
+	"github.com/adobe-platform/porter/docker/engine"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/inconshreveable/log15"
+)
+
+// seconds a sidecar is given to stop
+const stopTimeout = 10
+
+// Sidecar is a running sidecar that can be restarted or shed
+type Sidecar struct {
+	Id       string
+	Pod      string
+	Priority int
+
+	// bytes. 0 if the cgroup couldn't be read
+	MemoryUsage int64
+}
+
+// Call restarts or sheds the lowest priority sidecar whenever the host's
+// memory or cpu pressure is past its threshold. Only sidecars are touched so
+// the service's own containers keep serving while pressure is relieved.
+//
+// Pressure is read from the host's pressure stall information which needs a
+// 4.20 or newer kernel. Memory usage, used to break ties between sidecars of
+// the same priority, is read from cgroup v1 or v2
+func Call() {
+	if flags.PressureMemory == 0 && flags.PressureCPU == 0 {
+		return
+	}
+
+	log := logger.Daemon("AWS_STACKID", os.Getenv("AWS_STACKID"))
+
+	if _, err := os.Stat(memoryPSIPath); err != nil {
+		log.Warn("Not relieving pressure. The kernel has no pressure stall information", "Error", err)
+		return
+	}
+
+	cgroupVersion := CgroupVersion()
+
+	log.Info("Watching for pressure",
+		"Memory", flags.PressureMemory,
+		"CPU", flags.PressureCPU,
+		"Action", flags.PressureAction,
+		"CgroupVersion", cgroupVersion)
+
+	cooldown := time.Duration(flags.PressureCooldown) * time.Second
+	var lastRelieved time.Time
+
+	for {
+		time.Sleep(constants.PressureInterval)
+
+		if time.Since(lastRelieved) < cooldown {
+			continue
+		}
+
+		resource, avg10 := pastThreshold(log)
+		if resource == "" {
+			continue
+		}
+
+		if relieve(log.New("Resource", resource, "Avg10", avg10), cgroupVersion) {
+			lastRelieved = time.Now()
+		}
+	}
+}
+
+// pastThreshold is the resource whose pressure is past its threshold. It's
+// empty if neither is
+func pastThreshold(log log15.Logger) (resource string, avg10 float64) {
+	if flags.PressureMemory > 0 {
+		psi, err := readPSI(memoryPSIPath)
+		if err != nil {
+			log.Warn("Read memory pressure", "Error", err)
+		} else if psi.SomeAvg10 >= flags.PressureMemory {
+			return "memory", psi.SomeAvg10
+		}
+	}
+
+	if flags.PressureCPU > 0 {
+		psi, err := readPSI(cpuPSIPath)
+		if err != nil {
+			log.Warn("Read cpu pressure", "Error", err)
+		} else if psi.SomeAvg10 >= flags.PressureCPU {
+			return "cpu", psi.SomeAvg10
+		}
+	}
+
+	return
+}
+
+// relieve restarts or stops the lowest priority sidecar
+func relieve(log log15.Logger, cgroupVersion int) (success bool) {
+	dockerClient, err := engine.New()
+	if err != nil {
+		log.Error("engine.New", "Error", err)
+		return
+	}
+
+	containers, err := dockerClient.ContainerList(map[string][]string{
+		"label": {constants.PodLabel},
+	})
+	if err != nil {
+		log.Error("docker ps", "Error", err)
+		return
+	}
+
+	sidecars := make([]Sidecar, 0, len(containers))
+	for _, container := range containers {
+		priority, _ := strconv.Atoi(container.Labels[constants.SidecarPriorityLabel])
+
+		sidecars = append(sidecars, Sidecar{
+			Id:          container.Id,
+			Pod:         container.Labels[constants.PodLabel],
+			Priority:    priority,
+			MemoryUsage: memoryUsage(cgroupVersion, container.Id),
+		})
+	}
+
+	sidecar := LowestPriority(sidecars)
+	if sidecar == nil {
+		log.Warn("Pressure is past its threshold but there's no sidecar to relieve it")
+		return
+	}
+
+	log = log.New("ContainerId", sidecar.Id, "Pod", sidecar.Pod, "Priority", sidecar.Priority)
+
+	if flags.PressureAction == conf.PressureAction_Shed {
+		log.Warn("Shedding sidecar to relieve pressure")
+		err = dockerClient.ContainerStop(sidecar.Id, stopTimeout)
+	} else {
+		log.Warn("Restarting sidecar to relieve pressure")
+		err = dockerClient.ContainerRestart(sidecar.Id, stopTimeout)
+	}
+	if err != nil {
+		log.Error("Failed to relieve pressure", "Error", err)
+		return
+	}
+
+	success = true
+	return
+}
+
+// LowestPriority is the sidecar to restart or shed first. Of the sidecars with
+// the lowest priority it's the one using the most memory
+func LowestPriority(sidecars []Sidecar) *Sidecar {
+	var lowest *Sidecar
+
+	for i := range sidecars {
+		sidecar := &sidecars[i]
+
+		if lowest == nil ||
+			sidecar.Priority < lowest.Priority ||
+			(sidecar.Priority == lowest.Priority && sidecar.MemoryUsage > lowest.MemoryUsage) {
+			lowest = sidecar
+		}
+	}
+
+	return lowest
+}
@@ -0,0 +1,48 @@
+package pressure_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/daemon/pressure"
+)
+
+var _ = Describe("Pressure", func() {
+
+	It("parses pressure stall information", func() {
+		psi, err := pressure.ParsePSI(`some avg10=12.50 avg60=3.10 avg300=0.80 total=123456
+full avg10=4.25 avg60=1.00 avg300=0.20 total=23456
+`)
+		Expect(err).To(BeNil())
+		Expect(psi.SomeAvg10).To(Equal(12.5))
+		Expect(psi.FullAvg10).To(Equal(4.25))
+	})
+
+	It("parses cpu pressure without a full line", func() {
+		psi, err := pressure.ParsePSI("some avg10=0.00 avg60=0.00 avg300=0.00 total=0\n")
+		Expect(err).To(BeNil())
+		Expect(psi.SomeAvg10).To(Equal(0.0))
+	})
+
+	It("rejects malformed pressure stall information", func() {
+		_, err := pressure.ParsePSI("full avg10=1.00\n")
+		Expect(err).NotTo(BeNil())
+
+		_, err = pressure.ParsePSI("some avg60=1.00\n")
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("picks the lowest priority sidecar using the most memory", func() {
+		sidecar := pressure.LowestPriority([]pressure.Sidecar{
+			{Id: "a", Priority: 10, MemoryUsage: 900},
+			{Id: "b", Priority: 0, MemoryUsage: 100},
+			{Id: "c", Priority: 0, MemoryUsage: 500},
+		})
+		Expect(sidecar).NotTo(BeNil())
+		Expect(sidecar.Id).To(Equal("c"))
+	})
+
+	It("picks nothing without sidecars", func() {
+		Expect(pressure.LowestPriority(nil)).To(BeNil())
+	})
+})
@@ -0,0 +1,88 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package pressure
+
+import (
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// pressure stall information needs a 4.20 or newer kernel
+const (
+	memoryPSIPath = "/proc/pressure/memory"
+	cpuPSIPath    = "/proc/pressure/cpu"
+)
+
+// PSI is the percent of the last 10 seconds some task, or every task, was
+// stalled on a resource. cpu has no full line on older kernels
+type PSI struct {
+	SomeAvg10 float64
+	FullAvg10 float64
+}
+
+// ParsePSI reads a file like /proc/pressure/memory
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func ParsePSI(contents string) (psi PSI, err error) {
+	foundSome := false
+
+	for _, line := range strings.Split(strings.TrimSpace(contents), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var avg10 float64
+		found := false
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "avg10=") {
+				continue
+			}
+
+			avg10, err = strconv.ParseFloat(strings.TrimPrefix(field, "avg10="), 64)
+			if err != nil {
+				return
+			}
+			found = true
+		}
+
+		if !found {
+			err = errors.New("no avg10 in " + line)
+			return
+		}
+
+		switch fields[0] {
+		case "some":
+			psi.SomeAvg10 = avg10
+			foundSome = true
+		case "full":
+			psi.FullAvg10 = avg10
+		}
+	}
+
+	if !foundSome {
+		err = errors.New("no some line")
+	}
+	return
+}
+
+func readPSI(path string) (PSI, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return PSI{}, err
+	}
+
+	return ParsePSI(string(contents))
+}
@@ -0,0 +1,238 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package remote_command
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/command_queue"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/daemon/flags"
+	"github.com/adobe-platform/porter/daemon/identity"
+	"github.com/adobe-platform/porter/daemon/spot_interruption"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/secrets"
+	"github.com/adobe-platform/porter/util"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inconshreveable/log15"
+)
+
+const refreshSecretsPath = "/usr/bin/porter_refresh_secrets"
+
+type poller struct {
+	log        log15.Logger
+	region     string
+	instanceId string
+	queueUrl   string
+	sqsClient  *sqs.SQS
+
+	signingKey []byte
+
+	// SQS delivers at least once
+	handled *command_queue.Handled
+}
+
+// Call creates the instance's command queue and polls it for the commands
+// porter fleet send sends this instance. Environments without command_queue
+// don't have command queues and nothing is polled
+func Call() {
+	if !flags.CommandQueue {
+		return
+	}
+
+	log := logger.Daemon("AWS_STACKID", os.Getenv("AWS_STACKID"))
+
+	ii, err := identity.Get(log)
+	if err != nil {
+		return
+	}
+
+	handled, err := command_queue.LoadHandled(constants.CommandsHandledPath)
+	if err != nil {
+		log.Error("LoadHandled", "Path", constants.CommandsHandledPath, "Error", err)
+		return
+	}
+
+	region := ii.AwsCreds.Region
+	sqsClient := sqs.New(aws_session.Get(region))
+	queueName := command_queue.QueueName(flags.ServiceName, flags.Environment, ii.Instance.InstanceID)
+
+	var queueUrl string
+
+	// CreateQueue returns the existing queue when porterd restarts
+	retryMsg := func(i int) { log.Warn("CreateQueue retrying", "Count", i) }
+	if !util.SuccessRetryer(7, retryMsg, func() bool {
+
+		output, err := sqsClient.CreateQueue(&sqs.CreateQueueInput{
+			QueueName: aws.String(queueName),
+			Attributes: map[string]*string{
+				sqs.QueueAttributeNameMaximumMessageSize:     aws.String("4096"),
+				sqs.QueueAttributeNameMessageRetentionPeriod: aws.String(strconv.Itoa(int(constants.CommandMaxAge.Seconds()))),
+			},
+		})
+		if err != nil {
+			log.Error("CreateQueue", "QueueName", queueName, "Error", err)
+			return false
+		}
+
+		queueUrl = aws.StringValue(output.QueueUrl)
+		return true
+	}) {
+		log.Error("Failed to create the command queue")
+		return
+	}
+
+	log.Info("Polling the command queue", "QueueUrl", queueUrl)
+
+	recv := &poller{
+		log:        log,
+		region:     region,
+		instanceId: ii.Instance.InstanceID,
+		queueUrl:   queueUrl,
+		sqsClient:  sqsClient,
+		handled:    handled,
+	}
+
+	for {
+		recv.poll()
+	}
+}
+
+func (recv *poller) poll() {
+	output, err := recv.sqsClient.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(recv.queueUrl),
+		MaxNumberOfMessages: aws.Int64(10),
+		WaitTimeSeconds:     aws.Int64(20),
+	})
+	if err != nil {
+		recv.log.Error("ReceiveMessage", "Error", err)
+		time.Sleep(5 * time.Second)
+		return
+	}
+
+	for _, message := range output.Messages {
+		recv.receive(message)
+		recv.deleteMessage(message)
+	}
+}
+
+// receive runs the command. Only this instance polls its queue so every
+// message is deleted once it's received
+func (recv *poller) receive(message *sqs.Message) {
+	command, err := command_queue.Unmarshal(aws.StringValue(message.Body))
+	if err != nil {
+		recv.log.Warn("Discarding malformed command", "Error", err)
+		return
+	}
+
+	log := recv.log.New("CommandId", command.Id, "Command", command.Name)
+
+	if time.Since(command.IssuedAt) > constants.CommandMaxAge {
+		log.Info("Discarding expired command")
+		return
+	}
+
+	if command.InstanceId != recv.instanceId {
+		log.Warn("Discarding command for another instance", "InstanceId", command.InstanceId)
+		return
+	}
+
+	if recv.handled.Contains(command.Id) {
+		return
+	}
+
+	if !recv.verify(log, command) {
+		return
+	}
+
+	// the command is saved before it runs so it runs at most once even if
+	// porterd restarts before the message is deleted
+	err = recv.handled.Add(command.Id, time.Now())
+	if err != nil {
+		log.Error("Failed to save the command as handled", "Error", err)
+		return
+	}
+
+	log.Info("Running command", "Args", command.Args)
+
+	switch command.Name {
+	case constants.CommandRefreshSecrets:
+
+		output, err := exec.Command(refreshSecretsPath).CombinedOutput()
+		if err != nil {
+			log.Error(refreshSecretsPath, "Error", err, "Output", string(output))
+			return
+		}
+
+	case constants.CommandDrain:
+
+		drainTimeout := constants.CommandDrainTimeout
+		if timeout, err := strconv.Atoi(command.Args["timeout"]); err == nil {
+			drainTimeout = timeout
+		}
+
+		spot_interruption.Drain(log, drainTimeout)
+
+	case constants.CommandLogLevel:
+
+		logger.SetDebug(command.Args["level"] == "debug")
+
+	default:
+
+		log.Warn("Unknown command")
+		return
+	}
+
+	log.Info("Command finished")
+}
+
+// verify checks the command's signature. A hot swap changes the stack's
+// secrets key so the key is read again before a command is rejected
+func (recv *poller) verify(log log15.Logger, command *command_queue.Command) bool {
+
+	for attempt := 0; attempt < 2; attempt++ {
+
+		if recv.signingKey == nil || attempt > 0 {
+			secretsKey, success := secrets.HostStackKey(log, recv.region)
+			if !success {
+				return false
+			}
+			recv.signingKey = command_queue.SigningKey(secretsKey)
+		}
+
+		err := command.Verify(recv.signingKey, time.Now())
+		if err == nil {
+			return true
+		}
+
+		if attempt > 0 {
+			log.Error("Rejecting command", "Error", err)
+		}
+	}
+
+	return false
+}
+
+func (recv *poller) deleteMessage(message *sqs.Message) {
+	_, err := recv.sqsClient.DeleteMessage(&sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(recv.queueUrl),
+		ReceiptHandle: message.ReceiptHandle,
+	})
+	if err != nil {
+		recv.log.Warn("DeleteMessage", "Error", err)
+	}
+}
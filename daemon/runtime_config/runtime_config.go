@@ -0,0 +1,85 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package runtime_config
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/adobe-platform/porter/aws/ssm"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/daemon/flags"
+	"github.com/adobe-platform/porter/daemon/identity"
+	"github.com/adobe-platform/porter/fleet_config"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+var (
+	values     = make(fleet_config.Values)
+	valuesLock sync.RWMutex
+)
+
+// Call watches the environment's runtime config parameter that porter fleet
+// set-config writes. Containers read the latest values from porterd
+func Call() {
+	log := logger.Daemon("AWS_STACKID", os.Getenv("AWS_STACKID"))
+
+	ii, err := identity.Get(log)
+	if err != nil {
+		return
+	}
+
+	name := fleet_config.ParameterName(flags.ServiceName, flags.Environment)
+	log = log.New("Name", name)
+
+	client := ssm.New(aws_session.Get(ii.AwsCreds.Region))
+
+	var version int64
+	for {
+		output, err := client.GetParameter(&ssm.GetParameterInput{Name: name})
+		if err != nil {
+			if awsErr, ok := err.(awserr.Error); !ok || awsErr.Code() != ssm.ErrCodeParameterNotFound {
+				log.Warn("ssm:GetParameter", "Error", err)
+			}
+		} else if output.Parameter.Version != version {
+
+			latest, err := fleet_config.Parse(output.Parameter.Value)
+			if err != nil {
+				log.Warn("Ignoring malformed runtime config", "Error", err)
+			} else {
+				log.Info("Runtime config changed", "Version", output.Parameter.Version, "Keys", latest.Keys())
+
+				valuesLock.Lock()
+				values = latest
+				valuesLock.Unlock()
+			}
+			version = output.Parameter.Version
+		}
+
+		time.Sleep(constants.RuntimeConfigPollInterval)
+	}
+}
+
+// Get is a copy of the latest values
+func Get() fleet_config.Values {
+	valuesLock.RLock()
+	defer valuesLock.RUnlock()
+
+	copied := make(fleet_config.Values, len(values))
+	for key, value := range values {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,162 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package spot_interruption
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adobe-platform/porter/aws/ec2metadata"
+	"github.com/adobe-platform/porter/aws/elb"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/daemon/flags"
+	"github.com/adobe-platform/porter/daemon/identity"
+	"github.com/adobe-platform/porter/docker/engine"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/util"
+	"github.com/aws/aws-sdk-go/aws"
+	elblib "github.com/aws/aws-sdk-go/service/elb"
+	"github.com/inconshreveable/log15"
+)
+
+// Call watches for a spot interruption notice and drains the instance once
+// one arrives.
+//
+// The instance-action document is 404 until EC2 schedules the instance to be
+// reclaimed 2 minutes later. The instance first leaves every ELB so no new
+// connections arrive, then containers are given the drain timeout to finish
+// in-flight work before they're stopped.
+func Call() {
+	if flags.SpotDrainTimeout == 0 {
+		return
+	}
+
+	log := logger.Daemon("AWS_STACKID", os.Getenv("AWS_STACKID"))
+
+	log.Info("Watching for spot interruption notices")
+
+	for {
+		time.Sleep(constants.SpotInterruptionPollInterval)
+
+		resp, err := ec2metadata.Get("/spot/instance-action")
+		if err != nil {
+			log.Warn("GET /spot/instance-action", "Error", err)
+			continue
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusOK {
+			break
+		}
+	}
+
+	log.Warn("Spot interruption notice received. Draining")
+
+	Drain(log, flags.SpotDrainTimeout)
+}
+
+// Drain takes the instance out of every ELB, waits for in-flight requests to
+// move on, then gives containers drainTimeout seconds to stop
+func Drain(log log15.Logger, drainTimeout int) {
+	deregisterInstance(log)
+
+	time.Sleep(constants.SpotDeregistrationDelay)
+
+	stopContainers(log, drainTimeout)
+}
+
+func deregisterInstance(log log15.Logger) {
+	elbCSV := os.Getenv("ELBS")
+	if elbCSV == "" {
+		return
+	}
+
+	ii, err := identity.Get(log)
+	if err != nil {
+		return
+	}
+
+	instances := []*elblib.Instance{
+		{
+			InstanceId: aws.String(ii.Instance.InstanceID),
+		},
+	}
+
+	elbClient := elb.New(aws_session.Get(ii.AwsCreds.Region))
+
+	for _, elbName := range strings.Split(elbCSV, ",") {
+		log := log.New("LoadBalancerName", elbName)
+
+		log.Info("DeregisterInstancesFromLoadBalancer", "InstanceId", ii.Instance.InstanceID)
+
+		retryMsg := func(i int) { log.Warn("elb.DeregisterInstancesFromLoadBalancer retrying", "Count", i) }
+		if !util.SuccessRetryer(3, retryMsg, func() bool {
+
+			_, err = elb.DeregisterInstancesFromLoadBalancer(elbClient, instances, elbName)
+			if err != nil {
+				log.Error("DeregisterInstancesFromLoadBalancer", "Error", err)
+				return false
+			}
+
+			return true
+		}) {
+			log.Error("Instance deregistration failed")
+		}
+	}
+}
+
+func stopContainers(log log15.Logger, drainTimeout int) {
+	dockerClient, err := engine.New()
+	if err != nil {
+		log.Error("engine.New", "Error", err)
+		return
+	}
+
+	containers, err := dockerClient.ContainerList(nil)
+	if err != nil {
+		log.Error("docker ps", "Error", err)
+		return
+	}
+
+	if len(containers) == 0 {
+		log.Info("No containers to stop")
+		return
+	}
+
+	log.Info("Stopping containers",
+		"Count", len(containers),
+		"DrainTimeout", drainTimeout)
+
+	var wg sync.WaitGroup
+
+	// docker stop stops its arguments concurrently
+	for _, container := range containers {
+		wg.Add(1)
+
+		go func(containerId string) {
+			defer wg.Done()
+
+			err := dockerClient.ContainerStop(containerId, drainTimeout)
+			if err != nil {
+				log.Error("docker stop", "ContainerId", containerId, "Error", err)
+			}
+		}(container.Id)
+	}
+
+	wg.Wait()
+
+	log.Info("Containers stopped")
+}
@@ -31,6 +31,7 @@ import (
 	"github.com/adobe-platform/porter/util"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/inconshreveable/log15"
 )
 
 type (
@@ -59,11 +60,6 @@ func Call() {
 		"AWS_STACKID", os.Getenv("AWS_STACKID"),
 	)
 
-	var (
-		describeStackResourceOutput *cloudformation.DescribeStackResourceOutput
-		err                         error
-	)
-
 	// Poll service health check until healthy and then call wait handle on its
 	// behalf.
 	//
@@ -127,6 +123,30 @@ func Call() {
 		}
 	}
 
+	signal(log, "SUCCESS", "Configuration Complete", "Service has successfully started")
+}
+
+// Fail signals the wait condition that the host can't run the service. The
+// stack rolls back immediately with reason in its events instead of waiting
+// out the wait condition's timeout
+func Fail(reason string) {
+	log := logger.Host(
+		"package", "wait_handle",
+		"AWS_STACKID", os.Getenv("AWS_STACKID"),
+	)
+
+	// CloudFormation truncates reasons in stack events
+	if len(reason) > 255 {
+		reason = reason[:252] + "..."
+	}
+
+	signal(log, "FAILURE", reason, "Host bootstrap failed")
+}
+
+func signal(log log15.Logger, status, reason, data string) {
+
+	var describeStackResourceOutput *cloudformation.DescribeStackResourceOutput
+
 	ii, err := identity.Get(log)
 	if err != nil {
 		// identity.Get logs errors
@@ -161,10 +181,10 @@ func Call() {
 	waitHandleURL := *describeStackResourceOutput.StackResourceDetail.PhysicalResourceId
 
 	reqData := &waitConditionReq{
-		Status:   "SUCCESS",
-		Reason:   "Configuration Complete",
+		Status:   status,
+		Reason:   reason,
 		UniqueID: ii.Instance.InstanceID,
-		Data:     "Service has successfully started",
+		Data:     data,
 	}
 
 	j, err := json.Marshal(reqData)
@@ -0,0 +1,178 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package engine
+
+import (
+	"archive/tar"
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BuildContext tars dir the way docker build does. Paths matched by the
+// .dockerignore in dir are skipped except for the Dockerfile and .dockerignore
+// which the daemon always needs
+func BuildContext(dir, dockerfile string) (io.ReadCloser, error) {
+	patterns, err := readDockerignore(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	keep := map[string]bool{
+		".dockerignore": true,
+		filepath.ToSlash(filepath.Clean(dockerfile)): true,
+	}
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		pw.CloseWithError(writeTar(dir, patterns, keep, pw))
+	}()
+
+	return pr, nil
+}
+
+func readDockerignore(dir string) ([]string, error) {
+	file, err := os.Open(filepath.Join(dir, ".dockerignore"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns []string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		pattern := strings.TrimSpace(scanner.Text())
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+
+		exception := strings.HasPrefix(pattern, "!")
+		pattern = filepath.ToSlash(filepath.Clean(strings.TrimPrefix(pattern, "!")))
+		pattern = strings.TrimPrefix(pattern, "/")
+
+		if exception {
+			pattern = "!" + pattern
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, scanner.Err()
+}
+
+// excluded applies the patterns in order so a later !pattern can re-include a
+// path. A pattern that matches a directory matches everything under it
+func excluded(relPath string, patterns []string) bool {
+	var exclude bool
+
+	for _, pattern := range patterns {
+		exception := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+
+		if matchesPathOrParent(pattern, relPath) {
+			exclude = !exception
+		}
+	}
+
+	return exclude
+}
+
+func matchesPathOrParent(pattern, relPath string) bool {
+	for p := relPath; p != "." && p != "/"; p = filepath.ToSlash(filepath.Dir(p)) {
+		if matched, _ := filepath.Match(pattern, p); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func writeTar(dir string, patterns []string, keep map[string]bool, w io.Writer) error {
+	tw := tar.NewWriter(w)
+
+	hasExceptions := false
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			hasExceptions = true
+		}
+	}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		if relPath == "." {
+			return nil
+		}
+
+		if !keep[relPath] && excluded(relPath, patterns) {
+			// an exception could re-include something below this directory
+			if info.IsDir() && !hasExceptions {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err = os.Readlink(path)
+			if err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+
+		header.Name = relPath
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		err = tw.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
@@ -0,0 +1,365 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+
+// Package engine is a minimal client for the Docker Engine API. It covers the
+// operations porter needs so that porter doesn't depend on the output format
+// of the docker CLI
+package engine
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// The oldest API version supported by current Docker releases. Older
+	// daemons are spoken to in their own version
+	apiVersion = "1.24"
+
+	// The API version that builds for a platform other than the daemon's
+	platformAPIVersion = "1.38"
+
+	defaultHost = "unix:///var/run/docker.sock"
+)
+
+type (
+	Client struct {
+		httpClient *http.Client
+		scheme     string
+		host       string
+		version    string
+
+		// The daemon's own API version. It's empty if it couldn't be read
+		daemonVersion string
+
+		// Auth is sent with push and pull. Login sets it
+		Auth *AuthConfig
+	}
+
+	AuthConfig struct {
+		Username      string `json:"username"`
+		Password      string `json:"password"`
+		ServerAddress string `json:"serveraddress"`
+	}
+)
+
+// New returns a client for the daemon the docker CLI would use. It honors
+// DOCKER_HOST, DOCKER_TLS_VERIFY, and DOCKER_CERT_PATH
+func New() (*Client, error) {
+	dockerHost := os.Getenv("DOCKER_HOST")
+	if dockerHost == "" {
+		dockerHost = defaultHost
+	}
+
+	hostURL, err := url.Parse(dockerHost)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{}
+	client := &Client{
+		httpClient: &http.Client{Transport: transport},
+		version:    apiVersion,
+	}
+
+	switch hostURL.Scheme {
+	case "unix":
+		socketPath := hostURL.Path
+		transport.Dial = func(network, addr string) (net.Conn, error) {
+			return net.DialTimeout("unix", socketPath, 30*time.Second)
+		}
+		transport.DisableCompression = true
+
+		client.scheme = "http"
+		client.host = "docker"
+
+	case "tcp":
+		client.scheme = "http"
+		client.host = hostURL.Host
+
+		if os.Getenv("DOCKER_TLS_VERIFY") != "" {
+			tlsConfig, err := tlsConfigFromEnv()
+			if err != nil {
+				return nil, err
+			}
+
+			transport.TLSClientConfig = tlsConfig
+			client.scheme = "https"
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported DOCKER_HOST %s", dockerHost)
+	}
+
+	client.negotiateVersion()
+
+	return client, nil
+}
+
+// negotiateVersion downgrades to the daemon's API version if it's older than
+// apiVersion. Errors are ignored because they'll surface on the next request
+func (recv *Client) negotiateVersion() {
+	reqURL := url.URL{
+		Scheme: recv.scheme,
+		Host:   recv.host,
+		Path:   "/version",
+	}
+
+	resp, err := recv.httpClient.Get(reqURL.String())
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	var version struct {
+		ApiVersion string
+	}
+
+	if resp.StatusCode != http.StatusOK ||
+		json.NewDecoder(resp.Body).Decode(&version) != nil ||
+		version.ApiVersion == "" {
+		return
+	}
+
+	recv.daemonVersion = version.ApiVersion
+
+	if versionLess(version.ApiVersion, recv.version) {
+		recv.version = version.ApiVersion
+	}
+}
+
+func versionLess(a, b string) bool {
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		aInt, _ := strconv.Atoi(aParts[i])
+		bInt, _ := strconv.Atoi(bParts[i])
+
+		if aInt != bInt {
+			return aInt < bInt
+		}
+	}
+
+	return len(aParts) < len(bParts)
+}
+
+func tlsConfigFromEnv() (*tls.Config, error) {
+	certPath := os.Getenv("DOCKER_CERT_PATH")
+	if certPath == "" {
+		certPath = filepath.Join(os.Getenv("HOME"), ".docker")
+	}
+
+	cert, err := tls.LoadX509KeyPair(
+		filepath.Join(certPath, "cert.pem"),
+		filepath.Join(certPath, "key.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	caBytes, err := ioutil.ReadFile(filepath.Join(certPath, "ca.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caBytes) {
+		return nil, errors.New("couldn't parse " + filepath.Join(certPath, "ca.pem"))
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      caPool,
+	}, nil
+}
+
+// Ping checks that the daemon is reachable
+func (recv *Client) Ping() error {
+	resp, err := recv.do("GET", "/_ping", nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Info is the subset of system info porter uses
+type Info struct {
+	ServerVersion string
+	DockerRootDir string
+}
+
+func (recv *Client) Info() (*Info, error) {
+	info := new(Info)
+
+	err := recv.doJSON("GET", "/info", nil, nil, info)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// Login validates credentials with a registry and sends them with later
+// pushes and pulls
+func (recv *Client) Login(auth AuthConfig) error {
+	resp, err := recv.do("POST", "/auth", nil, auth, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	recv.Auth = &auth
+	return nil
+}
+
+func (recv *Client) registryAuthHeader() (http.Header, error) {
+	header := http.Header{}
+
+	auth := AuthConfig{}
+	if recv.Auth != nil {
+		auth = *recv.Auth
+	}
+
+	authBytes, err := json.Marshal(auth)
+	if err != nil {
+		return nil, err
+	}
+
+	header.Set("X-Registry-Auth", base64.URLEncoding.EncodeToString(authBytes))
+	return header, nil
+}
+
+// registryConfigHeader lets a build pull base images with the credentials from
+// Login
+func (recv *Client) registryConfigHeader() (http.Header, error) {
+	header := http.Header{}
+
+	if recv.Auth == nil {
+		return header, nil
+	}
+
+	configs := map[string]AuthConfig{
+		recv.Auth.ServerAddress: *recv.Auth,
+	}
+
+	configBytes, err := json.Marshal(configs)
+	if err != nil {
+		return nil, err
+	}
+
+	header.Set("X-Registry-Config", base64.URLEncoding.EncodeToString(configBytes))
+	return header, nil
+}
+
+// do sends a request and returns the response if the status is 2xx. body is
+// JSON encoded unless it's an io.Reader. The caller closes the response body
+func (recv *Client) do(method, path string, query url.Values, body interface{}, header http.Header) (*http.Response, error) {
+	return recv.doVersion(recv.version, method, path, query, body, header)
+}
+
+// doVersion is do in an API version other than the negotiated one for
+// requests that need a newer daemon
+func (recv *Client) doVersion(version, method, path string, query url.Values, body interface{}, header http.Header) (*http.Response, error) {
+	var bodyReader io.Reader
+
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		bodyReader = b
+	default:
+		bodyBytes, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		bodyReader = bytes.NewReader(bodyBytes)
+
+		if header == nil {
+			header = http.Header{}
+		}
+		header.Set("Content-Type", "application/json")
+	}
+
+	reqURL := url.URL{
+		Scheme:   recv.scheme,
+		Host:     recv.host,
+		Path:     "/v" + version + path,
+		RawQuery: query.Encode(),
+	}
+
+	req, err := http.NewRequest(method, reqURL.String(), bodyReader)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	resp, err := recv.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, newError(resp)
+	}
+
+	return resp, nil
+}
+
+func (recv *Client) doJSON(method, path string, query url.Values, body, output interface{}) error {
+	resp, err := recv.do(method, path, query, body, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if output == nil {
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+		return err
+	}
+
+	return json.NewDecoder(resp.Body).Decode(output)
+}
+
+func splitImageTag(name string) (repo, tag string) {
+	// the API takes a digest in place of a tag
+	if at := strings.Index(name, "@"); at != -1 {
+		return name[:at], name[at+1:]
+	}
+
+	// a registry can specify port so : can divide host:port as well as
+	// repo:tag
+	colon := strings.LastIndex(name, ":")
+	if colon == -1 || colon < strings.LastIndex(name, "/") {
+		return name, "latest"
+	}
+	return name[:colon], name[colon+1:]
+}
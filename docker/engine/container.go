@@ -0,0 +1,340 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package engine
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// ContainerConfig is the body of a container create request
+	ContainerConfig struct {
+		Image       string
+		User        string            `json:",omitempty"`
+		Env         []string          `json:",omitempty"`
+		Cmd         []string          `json:",omitempty"`
+		Labels      map[string]string `json:",omitempty"`
+		Healthcheck *HealthConfig     `json:",omitempty"`
+		HostConfig  HostConfig
+	}
+
+	// HealthConfig is the equivalent of a Dockerfile HEALTHCHECK. Durations
+	// are in nanoseconds
+	HealthConfig struct {
+		Test     []string
+		Interval int64 `json:",omitempty"`
+		Timeout  int64 `json:",omitempty"`
+		Retries  int   `json:",omitempty"`
+	}
+
+	HostConfig struct {
+		Binds           []string      `json:",omitempty"`
+		NetworkMode     string        `json:",omitempty"`
+		PublishAllPorts bool          `json:",omitempty"`
+		ReadonlyRootfs  bool          `json:",omitempty"`
+		SecurityOpt     []string      `json:",omitempty"`
+		RestartPolicy   RestartPolicy `json:",omitempty"`
+		LogConfig       LogConfig     `json:",omitempty"`
+		Ulimits         []Ulimit      `json:",omitempty"`
+
+		// Memory is a hard limit in bytes. MemorySwap is memory plus swap so
+		// setting it to Memory disables swap
+		Memory     int64 `json:",omitempty"`
+		MemorySwap int64 `json:",omitempty"`
+	}
+
+	RestartPolicy struct {
+		Name              string `json:",omitempty"`
+		MaximumRetryCount int    `json:",omitempty"`
+	}
+
+	LogConfig struct {
+		Type   string            `json:",omitempty"`
+		Config map[string]string `json:",omitempty"`
+	}
+
+	Ulimit struct {
+		Name string
+		Soft int64
+		Hard int64
+	}
+
+	// Container is an entry in a container list
+	Container struct {
+		Id      string
+		Image   string
+		ImageID string
+		State   string
+		Labels  map[string]string
+	}
+
+	ContainerJSON struct {
+		Id     string
+		Config struct {
+			Image string
+		}
+		State struct {
+			Running bool
+			Health  *struct {
+				// starting, healthy, or unhealthy
+				Status string
+			}
+		}
+		NetworkSettings struct {
+			Ports map[string][]PortBinding
+		}
+	}
+
+	PortBinding struct {
+		HostIp   string
+		HostPort string
+	}
+)
+
+// ContainerCreate creates a container and returns its id. If the image isn't
+// present it's pulled first like docker run does
+func (recv *Client) ContainerCreate(config ContainerConfig, progress ProgressFunc) (string, error) {
+	var output struct {
+		Id string
+	}
+
+	err := recv.doJSON("POST", "/containers/create", nil, config, &output)
+	if IsNotFound(err) {
+
+		err = recv.ImagePull(config.Image, progress)
+		if err != nil {
+			return "", err
+		}
+
+		err = recv.doJSON("POST", "/containers/create", nil, config, &output)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if output.Id == "" {
+		return "", errors.New("container create didn't return an id")
+	}
+
+	return output.Id, nil
+}
+
+func (recv *Client) ContainerStart(id string) error {
+	err := recv.doJSON("POST", "/containers/"+id+"/start", nil, nil, nil)
+	if IsNotModified(err) {
+		return nil
+	}
+	return err
+}
+
+// ContainerStop sends SIGTERM and then SIGKILL after timeout seconds
+func (recv *Client) ContainerStop(id string, timeout int) error {
+	query := url.Values{}
+	query.Set("t", strconv.Itoa(timeout))
+
+	err := recv.doJSON("POST", "/containers/"+id+"/stop", query, nil, nil)
+	if IsNotModified(err) {
+		return nil
+	}
+	return err
+}
+
+// ContainerRestart stops the container like ContainerStop and starts it again
+func (recv *Client) ContainerRestart(id string, timeout int) error {
+	query := url.Values{}
+	query.Set("t", strconv.Itoa(timeout))
+
+	return recv.doJSON("POST", "/containers/"+id+"/restart", query, nil, nil)
+}
+
+func (recv *Client) ContainerKill(id, signal string) error {
+	query := url.Values{}
+	query.Set("signal", signal)
+
+	return recv.doJSON("POST", "/containers/"+id+"/kill", query, nil, nil)
+}
+
+func (recv *Client) ContainerRemove(id string) error {
+	return recv.doJSON("DELETE", "/containers/"+id, nil, nil, nil)
+}
+
+// ContainerWait blocks until the container stops and returns its exit code
+func (recv *Client) ContainerWait(id string) (int, error) {
+	var output struct {
+		StatusCode int
+	}
+
+	err := recv.doJSON("POST", "/containers/"+id+"/wait", nil, nil, &output)
+	if err != nil {
+		return 0, err
+	}
+
+	return output.StatusCode, nil
+}
+
+// ContainerList lists running containers. filters are the same as
+// docker ps --filter
+func (recv *Client) ContainerList(filters map[string][]string) ([]Container, error) {
+	query := url.Values{}
+
+	if len(filters) > 0 {
+		filterBytes, err := json.Marshal(filters)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("filters", string(filterBytes))
+	}
+
+	var containers []Container
+
+	err := recv.doJSON("GET", "/containers/json", query, nil, &containers)
+	if err != nil {
+		return nil, err
+	}
+
+	return containers, nil
+}
+
+func (recv *Client) ContainerInspect(id string) (*ContainerJSON, error) {
+	container := &ContainerJSON{}
+
+	err := recv.doJSON("GET", "/containers/"+id+"/json", nil, nil, container)
+	if err != nil {
+		return nil, err
+	}
+
+	return container, nil
+}
+
+// ContainerLogs follows the container's output until it stops
+func (recv *Client) ContainerLogs(id string, stdout, stderr io.Writer) error {
+	query := url.Values{}
+	query.Set("follow", "1")
+	query.Set("stdout", "1")
+	query.Set("stderr", "1")
+
+	resp, err := recv.do("GET", "/containers/"+id+"/logs", query, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return demux(resp.Body, stdout, stderr)
+}
+
+// Run is the equivalent of docker run --rm. It creates and starts a container,
+// copies its output until it stops, and removes it. A non-zero exit is an
+// *ExitError
+func (recv *Client) Run(config ContainerConfig, stdout, stderr io.Writer) error {
+	return recv.RunWithTimeout(config, 0, stdout, stderr)
+}
+
+// RunWithTimeout is Run that kills the container if it's still running after
+// timeout, which is a *TimeoutError. A timeout of 0 never kills it
+func (recv *Client) RunWithTimeout(config ContainerConfig, timeout time.Duration,
+	stdout, stderr io.Writer) (err error) {
+
+	id, err := recv.ContainerCreate(config, nil)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		removeErr := recv.ContainerRemove(id)
+		if err == nil {
+			err = removeErr
+		}
+	}()
+
+	err = recv.ContainerStart(id)
+	if err != nil {
+		return
+	}
+
+	var timedOut int32
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			atomic.StoreInt32(&timedOut, 1)
+			recv.ContainerKill(id, "SIGKILL")
+		})
+		defer timer.Stop()
+	}
+
+	err = recv.ContainerLogs(id, stdout, stderr)
+	if err != nil {
+		return
+	}
+
+	exitCode, err := recv.ContainerWait(id)
+	if err != nil {
+		return
+	}
+
+	if atomic.LoadInt32(&timedOut) == 1 {
+		err = &TimeoutError{ContainerId: id, Timeout: timeout}
+		return
+	}
+
+	if exitCode != 0 {
+		err = &ExitError{ContainerId: id, ExitCode: exitCode}
+	}
+	return
+}
+
+// demux splits the multiplexed stream of a container without a TTY. Each
+// frame has an 8 byte header: the stream type, 3 bytes of padding, and the
+// big endian frame size
+func demux(r io.Reader, stdout, stderr io.Writer) error {
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+
+	header := make([]byte, 8)
+
+	for {
+		_, err := io.ReadFull(r, header)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer
+		switch header[0] {
+		case 0, 1:
+			w = stdout
+		case 2:
+			w = stderr
+		default:
+			return errors.New("unexpected stream type in container output")
+		}
+
+		frameSize := int64(binary.BigEndian.Uint32(header[4:]))
+
+		_, err = io.CopyN(w, r, frameSize)
+		if err != nil {
+			return err
+		}
+	}
+}
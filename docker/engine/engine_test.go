@@ -0,0 +1,390 @@
+package engine_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adobe-platform/porter/docker/engine"
+)
+
+var _ = Describe("Docker Engine API client", func() {
+
+	var (
+		server *httptest.Server
+		mux    *http.ServeMux
+		client *engine.Client
+	)
+
+	BeforeEach(func() {
+		mux = http.NewServeMux()
+		server = httptest.NewServer(mux)
+
+		os.Setenv("DOCKER_HOST", strings.Replace(server.URL, "http://", "tcp://", 1))
+
+		var err error
+		client, err = engine.New()
+		Expect(err).To(BeNil())
+	})
+
+	It("speaks the API version of older daemons", func() {
+		server.Close()
+
+		mux = http.NewServeMux()
+		mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, `{"ApiVersion":"1.23"}`)
+		})
+		mux.HandleFunc("/v1.23/_ping", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "OK")
+		})
+		server = httptest.NewServer(mux)
+		os.Setenv("DOCKER_HOST", strings.Replace(server.URL, "http://", "tcp://", 1))
+
+		client, err := engine.New()
+		Expect(err).To(BeNil())
+		Expect(client.Ping()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.Unsetenv("DOCKER_HOST")
+	})
+
+	It("returns typed errors for non-2xx responses", func() {
+		mux.HandleFunc("/v1.24/containers/abc/json", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"message":"No such container: abc"}`)
+		})
+
+		_, err := client.ContainerInspect("abc")
+		Expect(engine.IsNotFound(err)).To(BeTrue())
+		Expect(err.(*engine.Error).Message).To(Equal("No such container: abc"))
+	})
+
+	It("lists images and reports images in use as conflicts", func() {
+		mux.HandleFunc("/v1.24/images/json", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, `[{"Id":"sha256:abc","RepoTags":["s3/s3:porter-1-2-app"],"Created":1500000000,"Size":1024}]`)
+		})
+		mux.HandleFunc("/v1.24/images/sha256:abc", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Method).To(Equal("DELETE"))
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, `{"message":"image is being used by stopped container 123"}`)
+		})
+
+		images, err := client.ImageList()
+		Expect(err).To(BeNil())
+		Expect(images).To(Equal([]engine.Image{
+			{Id: "sha256:abc", RepoTags: []string{"s3/s3:porter-1-2-app"}, Created: 1500000000, Size: 1024},
+		}))
+
+		err = client.ImageRemove("sha256:abc")
+		Expect(engine.IsConflict(err)).To(BeTrue())
+		Expect(engine.IsNotFound(err)).To(BeFalse())
+	})
+
+	It("builds a stage of a multi-stage Dockerfile", func() {
+		mux.HandleFunc("/v1.24/build", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Query().Get("target")).To(Equal("release"))
+			io.WriteString(w, `{"stream":"Successfully built 123\n"}`)
+		})
+
+		err := client.ImageBuild(bytes.NewReader(nil), engine.BuildOptions{
+			Tags:   []string{"image:tag"},
+			Target: "release",
+		}, nil)
+		Expect(err).To(BeNil())
+	})
+
+	It("builds for a platform in the API version that supports it", func() {
+		mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, `{"ApiVersion":"1.41"}`)
+		})
+		mux.HandleFunc("/v1.38/build", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Query().Get("platform")).To(Equal("linux/arm64"))
+			io.WriteString(w, `{"stream":"Successfully built 123\n"}`)
+		})
+		mux.HandleFunc("/v1.24/images/image:tag/json", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, `{"Id":"sha256:123","Architecture":"arm64","Os":"linux"}`)
+		})
+
+		client, err := engine.New()
+		Expect(err).To(BeNil())
+
+		err = client.ImageBuild(bytes.NewReader(nil), engine.BuildOptions{
+			Tags:     []string{"image:tag"},
+			Platform: "linux/arm64",
+		}, nil)
+		Expect(err).To(BeNil())
+
+		image, err := client.ImageInspect("image:tag")
+		Expect(err).To(BeNil())
+		Expect(image.Architecture).To(Equal("arm64"))
+	})
+
+	It("refuses to build for a platform on daemons that don't support it", func() {
+		err := client.ImageBuild(bytes.NewReader(nil), engine.BuildOptions{
+			Platform: "linux/arm64",
+		}, nil)
+		Expect(err).ToNot(BeNil())
+	})
+
+	It("tags an image for another registry", func() {
+		mux.HandleFunc("/v1.24/images/s3/s3:porter-abc/tag", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Method).To(Equal("POST"))
+			Expect(r.URL.Query().Get("repo")).To(Equal("123.dkr.ecr.us-west-2.amazonaws.com/svc"))
+			Expect(r.URL.Query().Get("tag")).To(Equal("porter-abc"))
+			w.WriteHeader(http.StatusCreated)
+		})
+
+		err := client.ImageTag("s3/s3:porter-abc", "123.dkr.ecr.us-west-2.amazonaws.com/svc:porter-abc")
+		Expect(err).To(BeNil())
+	})
+
+	It("reads the daemon's root directory", func() {
+		mux.HandleFunc("/v1.24/info", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, `{"ServerVersion":"1.12.6","DockerRootDir":"/var/lib/docker","Containers":3}`)
+		})
+
+		info, err := client.Info()
+		Expect(err).To(BeNil())
+		Expect(info.ServerVersion).To(Equal("1.12.6"))
+		Expect(info.DockerRootDir).To(Equal("/var/lib/docker"))
+	})
+
+	It("returns the digest of a pushed image", func() {
+		mux.HandleFunc("/v1.24/images/registry:5000/repo/push", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Query().Get("tag")).To(Equal("tag"))
+			io.WriteString(w, `{"status":"Pushed","id":"abc"}`)
+			io.WriteString(w, `{"status":"tag: digest: sha256:123 size: 528"}`)
+			io.WriteString(w, `{"progressDetail":{},"aux":{"Tag":"tag","Digest":"sha256:123","Size":528}}`)
+		})
+
+		var output bytes.Buffer
+		digest, err := client.ImagePush("registry:5000/repo:tag", engine.PrintProgress(&output))
+		Expect(err).To(BeNil())
+		Expect(digest).To(Equal("sha256:123"))
+		Expect(output.String()).To(Equal("abc: Pushed\ntag: digest: sha256:123 size: 528\n"))
+	})
+
+	It("pulls an image by digest", func() {
+		mux.HandleFunc("/v1.24/images/create", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Query().Get("fromImage")).To(Equal("registry:5000/repo"))
+			Expect(r.URL.Query().Get("tag")).To(Equal("sha256:123"))
+			io.WriteString(w, `{"status":"Downloaded newer image"}`)
+		})
+
+		err := client.ImagePull("registry:5000/repo@sha256:123", nil)
+		Expect(err).To(BeNil())
+	})
+
+	It("surfaces errors reported in a progress stream", func() {
+		mux.HandleFunc("/v1.24/build", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Query()["t"]).To(Equal([]string{"image:tag"}))
+			io.WriteString(w, `{"stream":"Step 1 : FROM scratch\n"}`)
+			io.WriteString(w, `{"errorDetail":{"message":"bad things"},"error":"bad things"}`)
+		})
+
+		var output bytes.Buffer
+		err := client.ImageBuild(strings.NewReader(""), engine.BuildOptions{
+			Tags: []string{"image:tag"},
+		}, engine.PrintProgress(&output))
+
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("bad things"))
+		Expect(output.String()).To(Equal("Step 1 : FROM scratch\n"))
+	})
+
+	It("pulls a missing image when creating a container", func() {
+		creates := 0
+		mux.HandleFunc("/v1.24/containers/create", func(w http.ResponseWriter, r *http.Request) {
+			creates++
+			if creates == 1 {
+				w.WriteHeader(http.StatusNotFound)
+				io.WriteString(w, `{"message":"No such image: registry:5000/repo:tag"}`)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"Id":"abc"}`)
+		})
+		mux.HandleFunc("/v1.24/images/create", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Query().Get("fromImage")).To(Equal("registry:5000/repo"))
+			Expect(r.URL.Query().Get("tag")).To(Equal("tag"))
+			Expect(r.Header.Get("X-Registry-Auth")).ToNot(BeEmpty())
+			io.WriteString(w, `{"status":"Downloaded newer image"}`)
+		})
+
+		id, err := client.ContainerCreate(engine.ContainerConfig{
+			Image: "registry:5000/repo:tag",
+		}, nil)
+		Expect(err).To(BeNil())
+		Expect(id).To(Equal("abc"))
+	})
+
+	It("creates a sidecar in another container's network namespace", func() {
+		mux.HandleFunc("/v1.24/containers/create", func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]interface{}
+			Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+
+			Expect(body["Labels"]).To(Equal(map[string]interface{}{"porter.pod": "s3/s3:porter-abc"}))
+			Expect(body["Healthcheck"]).To(Equal(map[string]interface{}{
+				"Test":     []interface{}{"CMD", "true"},
+				"Interval": float64(10000000000),
+				"Retries":  float64(3),
+			}))
+			Expect(body["HostConfig"].(map[string]interface{})["NetworkMode"]).To(Equal("container:abc"))
+
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"Id":"def"}`)
+		})
+		mux.HandleFunc("/v1.24/containers/def/json", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, `{"Id":"def","State":{"Running":true,"Health":{"Status":"healthy"}}}`)
+		})
+
+		id, err := client.ContainerCreate(engine.ContainerConfig{
+			Image:  "envoy:latest",
+			Labels: map[string]string{"porter.pod": "s3/s3:porter-abc"},
+			Healthcheck: &engine.HealthConfig{
+				Test:     []string{"CMD", "true"},
+				Interval: 10000000000,
+				Retries:  3,
+			},
+			HostConfig: engine.HostConfig{NetworkMode: "container:abc"},
+		}, nil)
+		Expect(err).To(BeNil())
+		Expect(id).To(Equal("def"))
+
+		inspectOutput, err := client.ContainerInspect(id)
+		Expect(err).To(BeNil())
+		Expect(inspectOutput.State.Running).To(BeTrue())
+		Expect(inspectOutput.State.Health.Status).To(Equal("healthy"))
+	})
+
+	It("runs a container and demultiplexes its output", func() {
+		frame := func(stream byte, payload string) []byte {
+			header := make([]byte, 8)
+			header[0] = stream
+			binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+			return append(header, payload...)
+		}
+
+		mux.HandleFunc("/v1.24/containers/create", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"Id":"abc"}`)
+		})
+		mux.HandleFunc("/v1.24/containers/abc/start", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+		mux.HandleFunc("/v1.24/containers/abc/logs", func(w http.ResponseWriter, r *http.Request) {
+			w.Write(frame(1, "out"))
+			w.Write(frame(2, "err"))
+		})
+		mux.HandleFunc("/v1.24/containers/abc/wait", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, `{"StatusCode":3}`)
+		})
+		removed := false
+		mux.HandleFunc("/v1.24/containers/abc", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Method).To(Equal("DELETE"))
+			removed = true
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+		var stdout, stderr bytes.Buffer
+		err := client.Run(engine.ContainerConfig{Image: "image"}, &stdout, &stderr)
+
+		Expect(err).To(BeAssignableToTypeOf(&engine.ExitError{}))
+		Expect(err.(*engine.ExitError).ExitCode).To(Equal(3))
+		Expect(stdout.String()).To(Equal("out"))
+		Expect(stderr.String()).To(Equal("err"))
+		Expect(removed).To(BeTrue())
+	})
+
+	It("kills a container that runs past its timeout", func() {
+		killed := make(chan struct{})
+
+		mux.HandleFunc("/v1.24/containers/create", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"Id":"abc"}`)
+		})
+		mux.HandleFunc("/v1.24/containers/abc/start", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+		mux.HandleFunc("/v1.24/containers/abc/kill", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Query().Get("signal")).To(Equal("SIGKILL"))
+			close(killed)
+			w.WriteHeader(http.StatusNoContent)
+		})
+		mux.HandleFunc("/v1.24/containers/abc/logs", func(w http.ResponseWriter, r *http.Request) {
+			<-killed
+		})
+		mux.HandleFunc("/v1.24/containers/abc/wait", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, `{"StatusCode":137}`)
+		})
+		mux.HandleFunc("/v1.24/containers/abc", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+		err := client.RunWithTimeout(engine.ContainerConfig{Image: "image"}, 10*time.Millisecond, nil, nil)
+
+		Expect(err).To(BeAssignableToTypeOf(&engine.TimeoutError{}))
+		Expect(err.(*engine.TimeoutError).Timeout).To(Equal(10 * time.Millisecond))
+	})
+
+	It("honors .dockerignore in the build context", func() {
+		dir, err := ioutil.TempDir("", "porter-build-context")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+
+		files := map[string]string{
+			".dockerignore":    "*.log\nvendor\n!vendor/keep\nDockerfile\n",
+			"Dockerfile":       "FROM scratch",
+			"main.go":          "package main",
+			"debug.log":        "",
+			"vendor/drop":      "",
+			"vendor/keep":      "",
+			"src/nested.log":   "",
+			"src/included.txt": "",
+		}
+		for name, contents := range files {
+			Expect(os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)).To(Succeed())
+		}
+
+		buildContext, err := engine.BuildContext(dir, "Dockerfile")
+		Expect(err).To(BeNil())
+		defer buildContext.Close()
+
+		var names []string
+		tr := tar.NewReader(buildContext)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).To(BeNil())
+			names = append(names, header.Name)
+		}
+
+		Expect(names).To(ConsistOf(
+			".dockerignore",
+			"Dockerfile",
+			"main.go",
+			"src/",
+			"src/nested.log",
+			"src/included.txt",
+			"vendor/keep",
+		))
+	})
+
+})
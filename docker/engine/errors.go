@@ -0,0 +1,104 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type (
+	// Error is a non-2xx response from the Docker Engine API
+	Error struct {
+		StatusCode int
+		Message    string
+	}
+
+	// StreamError is an error the daemon reported in a progress stream after
+	// it had already responded 200
+	StreamError struct {
+		Code    int
+		Message string
+	}
+
+	// ExitError is a container that exited non-zero
+	ExitError struct {
+		ContainerId string
+		ExitCode    int
+	}
+
+	// TimeoutError is a container that was killed for running too long
+	TimeoutError struct {
+		ContainerId string
+		Timeout     time.Duration
+	}
+)
+
+func newError(resp *http.Response) *Error {
+	apiErr := &Error{StatusCode: resp.StatusCode}
+
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+		return apiErr
+	}
+
+	var body struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(bodyBytes, &body) == nil && body.Message != "" {
+		apiErr.Message = body.Message
+	} else {
+		apiErr.Message = strings.TrimSpace(string(bodyBytes))
+	}
+
+	return apiErr
+}
+
+func (recv *Error) Error() string {
+	return fmt.Sprintf("Error response from daemon (%d): %s", recv.StatusCode, recv.Message)
+}
+
+func (recv *StreamError) Error() string {
+	return recv.Message
+}
+
+func (recv *ExitError) Error() string {
+	return fmt.Sprintf("container %s exited %d", recv.ContainerId, recv.ExitCode)
+}
+
+func (recv *TimeoutError) Error() string {
+	return fmt.Sprintf("container %s killed after %s", recv.ContainerId, recv.Timeout)
+}
+
+// IsConflict is true if an image can't be removed because a container, even a
+// stopped one, uses it
+func IsConflict(err error) bool {
+	apiErr, ok := err.(*Error)
+	return ok && apiErr.StatusCode == http.StatusConflict
+}
+
+// IsNotFound is true if the image, container, or network doesn't exist
+func IsNotFound(err error) bool {
+	apiErr, ok := err.(*Error)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// IsNotModified is true if a container was already in the requested state
+func IsNotModified(err error) bool {
+	apiErr, ok := err.(*Error)
+	return ok && apiErr.StatusCode == http.StatusNotModified
+}
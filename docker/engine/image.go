@@ -0,0 +1,204 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+)
+
+// Image is an entry of docker images. Created is unix seconds and Size is
+// bytes
+type Image struct {
+	Id       string
+	RepoTags []string
+	Created  int64
+	Size     int64
+}
+
+// ImageInspect is the subset of docker image inspect porter reads
+type ImageInspect struct {
+	Id           string
+	Architecture string
+	Os           string
+}
+
+type BuildOptions struct {
+	// Tags to apply to the image
+	Tags []string
+
+	// Dockerfile is the path of the Dockerfile within the build context
+	Dockerfile string
+
+	// Target is the stage of a multi-stage Dockerfile to build. The last stage
+	// is built if it's empty
+	Target string
+
+	// Platform is the os/arch like linux/arm64 to build for. The daemon's
+	// platform is built for if it's empty
+	Platform string
+}
+
+// ImageBuild builds an image from a tar build context
+func (recv *Client) ImageBuild(buildContext io.Reader, options BuildOptions, progress ProgressFunc) error {
+	query := url.Values{}
+	for _, tag := range options.Tags {
+		query.Add("t", tag)
+	}
+	if options.Dockerfile != "" {
+		query.Set("dockerfile", options.Dockerfile)
+	}
+	if options.Target != "" {
+		query.Set("target", options.Target)
+	}
+	// remove intermediate containers like docker build does
+	query.Set("rm", "1")
+
+	version := recv.version
+	if options.Platform != "" {
+		if recv.daemonVersion == "" || versionLess(recv.daemonVersion, platformAPIVersion) {
+			return fmt.Errorf("building for %s needs Docker API %s or newer", options.Platform, platformAPIVersion)
+		}
+		query.Set("platform", options.Platform)
+		version = platformAPIVersion
+	}
+
+	header, err := recv.registryConfigHeader()
+	if err != nil {
+		return err
+	}
+	header.Set("Content-Type", "application/x-tar")
+
+	resp, err := recv.doVersion(version, "POST", "/build", query, buildContext, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return readMessages(resp.Body, progress)
+}
+
+// ImageSave writes a tar of the image in the format docker load reads
+func (recv *Client) ImageSave(name string, w io.Writer) error {
+	query := url.Values{}
+	query.Set("names", name)
+
+	resp, err := recv.do("GET", "/images/get", query, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// ImageTag adds the tag newName to the image
+func (recv *Client) ImageTag(name, newName string) error {
+	repo, tag := splitImageTag(newName)
+
+	query := url.Values{}
+	query.Set("repo", repo)
+	query.Set("tag", tag)
+
+	resp, err := recv.do("POST", "/images/"+name+"/tag", query, nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// ImagePush pushes the image to its registry with the credentials from Login
+// and returns the digest the registry reported. The digest is empty for
+// registries that don't report one
+func (recv *Client) ImagePush(name string, progress ProgressFunc) (digest string, err error) {
+	repo, tag := splitImageTag(name)
+
+	query := url.Values{}
+	query.Set("tag", tag)
+
+	header, err := recv.registryAuthHeader()
+	if err != nil {
+		return
+	}
+
+	resp, err := recv.do("POST", "/images/"+repo+"/push", query, nil, header)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	err = readMessages(resp.Body, func(msg Message) {
+		var pushResult struct {
+			Digest string
+		}
+
+		if msg.Aux != nil && json.Unmarshal(*msg.Aux, &pushResult) == nil {
+			digest = pushResult.Digest
+		}
+
+		if progress != nil {
+			progress(msg)
+		}
+	})
+	return
+}
+
+// ImagePull pulls the image from its registry with the credentials from Login.
+// name can reference the image by digest like repo@sha256:...
+func (recv *Client) ImagePull(name string, progress ProgressFunc) error {
+	repo, tag := splitImageTag(name)
+
+	query := url.Values{}
+	query.Set("fromImage", repo)
+	query.Set("tag", tag)
+
+	header, err := recv.registryAuthHeader()
+	if err != nil {
+		return err
+	}
+
+	resp, err := recv.do("POST", "/images/create", query, nil, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return readMessages(resp.Body, progress)
+}
+
+// ImageList lists the top level images like docker images
+func (recv *Client) ImageList() ([]Image, error) {
+	var images []Image
+
+	err := recv.doJSON("GET", "/images/json", nil, nil, &images)
+	if err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
+
+// ImageInspect returns low-level information about the image
+func (recv *Client) ImageInspect(name string) (ImageInspect, error) {
+	var image ImageInspect
+
+	err := recv.doJSON("GET", "/images/"+name+"/json", nil, nil, &image)
+	return image, err
+}
+
+// ImageRemove untags the image and removes it if no other tags reference it
+func (recv *Client) ImageRemove(name string) error {
+	return recv.doJSON("DELETE", "/images/"+name, nil, nil, nil)
+}
@@ -0,0 +1,37 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package engine
+
+type Network struct {
+	Id   string
+	Name string
+}
+
+func (recv *Client) NetworkList() ([]Network, error) {
+	var networks []Network
+
+	err := recv.doJSON("GET", "/networks", nil, nil, &networks)
+	if err != nil {
+		return nil, err
+	}
+
+	return networks, nil
+}
+
+func (recv *Client) NetworkCreate(name string) error {
+	body := map[string]interface{}{
+		"Name":           name,
+		"CheckDuplicate": true,
+	}
+
+	return recv.doJSON("POST", "/networks/create", nil, body, nil)
+}
@@ -0,0 +1,84 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type (
+	// Message is one object in the JSON stream returned by build, push, and
+	// pull
+	Message struct {
+		Stream      string           `json:"stream"`
+		Status      string           `json:"status"`
+		Progress    string           `json:"progress"`
+		ID          string           `json:"id"`
+		Error       string           `json:"error"`
+		ErrorDetail *StreamError     `json:"errorDetail"`
+		Aux         *json.RawMessage `json:"aux"`
+	}
+
+	// ProgressFunc receives each Message as it arrives
+	ProgressFunc func(Message)
+)
+
+// PrintProgress writes messages the way the docker CLI does without a TTY
+func PrintProgress(w io.Writer) ProgressFunc {
+	return func(msg Message) {
+		switch {
+		case msg.Stream != "":
+			fmt.Fprint(w, msg.Stream)
+		case msg.Status != "":
+			line := msg.Status
+			if msg.ID != "" {
+				line = msg.ID + ": " + line
+			}
+			if msg.Progress != "" {
+				line += " " + msg.Progress
+			}
+			fmt.Fprintln(w, strings.TrimSpace(line))
+		}
+	}
+}
+
+// readMessages passes each message to progress until the stream ends or
+// reports an error
+func readMessages(r io.Reader, progress ProgressFunc) error {
+	decoder := json.NewDecoder(r)
+
+	for {
+		var msg Message
+
+		err := decoder.Decode(&msg)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if msg.ErrorDetail != nil && msg.ErrorDetail.Message != "" {
+			return msg.ErrorDetail
+		}
+		if msg.Error != "" {
+			return &StreamError{Message: msg.Error}
+		}
+
+		if progress != nil {
+			progress(msg)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package util
 import (
 	"bufio"
 	"io"
+	"os"
 	"regexp"
 	"strings"
 )
@@ -21,6 +22,25 @@ func CleanEnvFile(contents string) string {
 	return strings.Join(cleanedLines, "\n")
 }
 
+// ParseEnvFile reads an env file the way docker run --env-file does. A line
+// with only a key takes its value from the environment
+func ParseEnvFile(contents string) []string {
+	env := []string{}
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.Contains(line, "=") {
+			env = append(env, line)
+		} else if value, exists := os.LookupEnv(strings.TrimSpace(line)); exists {
+			env = append(env, strings.TrimSpace(line)+"="+value)
+		}
+	}
+	return env
+}
+
 func NetworkNameToId(input io.Reader) (map[string]string, error) {
 	output := make(map[string]string)
 	scanner := bufio.NewScanner(input)
@@ -4,6 +4,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"os"
 	"strings"
 
 	"github.com/adobe-platform/porter/docker/util"
@@ -43,6 +44,27 @@ hy-phen=foo`
 		})
 	})
 
+	Context("ParseEnvFile", func() {
+		It("Skips comments and blank lines", func() {
+			inString := `FOO=bar
+
+# comment
+BAZ=qux=quux`
+
+			Expect(util.ParseEnvFile(inString)).To(Equal([]string{"FOO=bar", "BAZ=qux=quux"}))
+		})
+
+		It("Takes bare keys from the environment", func() {
+			os.Setenv("PORTER_PARSE_ENV_FILE_TEST", "value")
+			defer os.Unsetenv("PORTER_PARSE_ENV_FILE_TEST")
+
+			inString := `PORTER_PARSE_ENV_FILE_TEST
+PORTER_PARSE_ENV_FILE_TEST_UNSET`
+
+			Expect(util.ParseEnvFile(inString)).To(Equal([]string{"PORTER_PARSE_ENV_FILE_TEST=value"}))
+		})
+	})
+
 	Context("NetworkNameToId", func() {
 		It("Produces a network name to id mapping", func() {
 			// output of `docker network ls`
@@ -0,0 +1,240 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+
+// Package events is how Go programs embedding porter follow a deploy.
+// Provision, hot swap, instance refresh, promote, and prune emit a typed event
+// for each step of each region and every subscriber receives it.
+//
+// This package is stable. Events and fields are only added, never renamed or
+// removed, so subscribers can type switch on them
+//
+//	unsubscribe := events.Subscribe(events.SubscriberFunc(func(event events.Event) {
+//		switch e := event.(type) {
+//		case events.StackRequested:
+//			fmt.Println(e.Region, e.StackId)
+//		case events.StepFailed:
+//			fmt.Println(e.Region, e.Step, e.Reason)
+//		}
+//	}))
+//	defer unsubscribe()
+package events
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the events. Event.Name returns one of them
+const (
+	NamePayloadUploaded  = "payload_uploaded"
+	NameSecretsUploaded  = "secrets_uploaded"
+	NameManifestUploaded = "manifest_uploaded"
+	NameTemplateUploaded = "template_uploaded"
+	NameStackRequested   = "stack_requested"
+	NameStackCreated     = "stack_created"
+	NameStackUpdated     = "stack_updated"
+	NameRolledBack       = "rolled_back"
+	NamePromoted         = "promoted"
+	NamePruned           = "pruned"
+	NameStepFailed       = "step_failed"
+)
+
+type (
+	// Event is one step of a deploy
+	Event interface {
+		// Name is one of the Name constants
+		Name() string
+
+		// EventHeader says which deploy and region the event is about
+		EventHeader() Header
+	}
+
+	// Header is embedded in every event
+	Header struct {
+		ServiceName    string
+		ServiceVersion string
+		Environment    string
+		Region         string
+
+		// StackName is the same in every region of a deploy
+		StackName string
+
+		Time time.Time
+	}
+
+	// PayloadUploaded is emitted once the service payload is in the region's
+	// artifact store. It's also emitted when the payload was already there
+	PayloadUploaded struct {
+		Header
+		PayloadKey      string
+		PayloadChecksum string
+	}
+
+	// SecretsUploaded is emitted once the region's secrets are uploaded
+	SecretsUploaded struct {
+		Header
+		SecretsLocation string
+	}
+
+	// ManifestUploaded is emitted once the deployment manifest hosts verify
+	// the payload against is uploaded
+	ManifestUploaded struct {
+		Header
+		ManifestKey string
+	}
+
+	// TemplateUploaded is emitted once the rendered CloudFormation template is
+	// in the region's artifact store
+	TemplateUploaded struct {
+		Header
+		TemplateKey string
+	}
+
+	// StackRequested is emitted once CloudFormation accepts the CreateStack
+	// or, for a hot swap, UpdateStack call. The stack is still being created
+	// or updated
+	StackRequested struct {
+		Header
+		StackId string
+		Update  bool
+	}
+
+	// StackCreated is emitted once the region's stack is CREATE_COMPLETE
+	StackCreated struct {
+		Header
+		StackId string
+	}
+
+	// StackUpdated is emitted once a hot swap or instance refresh of the
+	// region's stack is complete
+	StackUpdated struct {
+		Header
+		StackId string
+	}
+
+	// RolledBack is emitted when the region's stack failed to create or an
+	// instance refresh was rolled back. StepFailed follows it
+	RolledBack struct {
+		Header
+		StackId string
+		Reason  string
+	}
+
+	// Promoted is emitted once the region's stack receives the service's
+	// traffic. Regions with nothing to promote emit it too
+	Promoted struct {
+		Header
+		StackId string
+	}
+
+	// Pruned is emitted once CloudFormation accepts the DeleteStack call of
+	// one of the region's old stacks. ServiceVersion is empty
+	Pruned struct {
+		Header
+		StackId string
+	}
+
+	// StepFailed is emitted when a region's deploy stops. No more events are
+	// emitted for the region. Reason is why the deploy was stopped and is
+	// empty if it failed on its own
+	StepFailed struct {
+		Header
+		Step   string
+		Reason string
+	}
+
+	// Subscriber receives every event emitted after it subscribes. Regions
+	// deploy in parallel so Handle must be safe to call concurrently. It
+	// blocks the deploy so it should return quickly
+	Subscriber interface {
+		Handle(Event)
+	}
+
+	// SubscriberFunc adapts a function to a Subscriber
+	SubscriberFunc func(Event)
+)
+
+var (
+	subscribersLock sync.RWMutex
+	subscribers     = make(map[int]Subscriber)
+	nextId          int
+)
+
+func (recv Header) EventHeader() Header { return recv }
+
+func (recv PayloadUploaded) Name() string  { return NamePayloadUploaded }
+func (recv SecretsUploaded) Name() string  { return NameSecretsUploaded }
+func (recv ManifestUploaded) Name() string { return NameManifestUploaded }
+func (recv TemplateUploaded) Name() string { return NameTemplateUploaded }
+func (recv StackRequested) Name() string   { return NameStackRequested }
+func (recv StackCreated) Name() string     { return NameStackCreated }
+func (recv StackUpdated) Name() string     { return NameStackUpdated }
+func (recv RolledBack) Name() string       { return NameRolledBack }
+func (recv Promoted) Name() string         { return NamePromoted }
+func (recv Pruned) Name() string           { return NamePruned }
+func (recv StepFailed) Name() string       { return NameStepFailed }
+
+func (recv SubscriberFunc) Handle(event Event) {
+	recv(event)
+}
+
+// NewHeader is the header of an event about a stack that already exists. The
+// stack's name is read from its id
+func NewHeader(serviceName, serviceVersion, environment, region, stackId string) Header {
+	// arn:aws:cloudformation:<region>:<account>:stack/<name>/<guid>
+	stackName := stackId
+	if parts := strings.Split(stackId, "/"); len(parts) == 3 {
+		stackName = parts[1]
+	}
+
+	return Header{
+		ServiceName:    serviceName,
+		ServiceVersion: serviceVersion,
+		Environment:    environment,
+		Region:         region,
+		StackName:      stackName,
+		Time:           time.Now().UTC(),
+	}
+}
+
+// Subscribe adds a subscriber. Calling unsubscribe removes it
+func Subscribe(subscriber Subscriber) (unsubscribe func()) {
+	subscribersLock.Lock()
+	defer subscribersLock.Unlock()
+
+	id := nextId
+	nextId++
+	subscribers[id] = subscriber
+
+	return func() {
+		subscribersLock.Lock()
+		defer subscribersLock.Unlock()
+
+		delete(subscribers, id)
+	}
+}
+
+// Emit sends the event to every subscriber. It does nothing without any
+func Emit(event Event) {
+	// copied so a subscriber can unsubscribe while handling an event
+	subscribersLock.RLock()
+	handlers := make([]Subscriber, 0, len(subscribers))
+	for _, subscriber := range subscribers {
+		handlers = append(handlers, subscriber)
+	}
+	subscribersLock.RUnlock()
+
+	for _, subscriber := range handlers {
+		subscriber.Handle(event)
+	}
+}
@@ -0,0 +1,56 @@
+package events_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/events"
+)
+
+var _ = Describe("Events", func() {
+
+	It("sends events to subscribers until they unsubscribe", func() {
+		var received []events.Event
+		unsubscribe := events.Subscribe(events.SubscriberFunc(func(event events.Event) {
+			received = append(received, event)
+		}))
+
+		events.Emit(events.StackRequested{
+			Header:  events.Header{Region: "us-west-2"},
+			StackId: "stack-id",
+		})
+		unsubscribe()
+		events.Emit(events.StepFailed{Step: "create stack"})
+
+		Expect(received).To(HaveLen(1))
+		Expect(received[0].Name()).To(Equal(events.NameStackRequested))
+		Expect(received[0].EventHeader().Region).To(Equal("us-west-2"))
+
+		stackRequested, ok := received[0].(events.StackRequested)
+		Expect(ok).To(BeTrue())
+		Expect(stackRequested.StackId).To(Equal("stack-id"))
+	})
+
+	It("lets a subscriber unsubscribe while handling an event", func() {
+		count := 0
+		var unsubscribe func()
+		unsubscribe = events.Subscribe(events.SubscriberFunc(func(event events.Event) {
+			count++
+			unsubscribe()
+		}))
+
+		events.Emit(events.PayloadUploaded{})
+		events.Emit(events.PayloadUploaded{})
+
+		Expect(count).To(Equal(1))
+	})
+
+	It("reads the stack name from the stack id", func() {
+		header := events.NewHeader("svc", "1.0.0", "prod", "us-west-2",
+			"arn:aws:cloudformation:us-west-2:123456789012:stack/svc-prod-1/7b6b4d20-1234")
+
+		Expect(header.StackName).To(Equal("svc-prod-1"))
+		Expect(header.Region).To(Equal("us-west-2"))
+		Expect(header.Time.IsZero()).To(BeFalse())
+	})
+})
@@ -0,0 +1,99 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package fleet_config
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/adobe-platform/porter/constants"
+)
+
+var keyRegex = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// Values are small runtime settings like an app's log level that porter fleet
+// set-config changes on every host of an environment without a deploy
+type Values map[string]string
+
+// ParameterName is the SSM parameter holding an environment's values in each
+// region. It isn't part of a stack so values outlive deploys
+func ParameterName(serviceName, environment string) string {
+	return fmt.Sprintf("/porter/%s/%s/runtime-config", serviceName, environment)
+}
+
+// Parse reads a parameter's value. An empty value has no keys
+func Parse(value string) (Values, error) {
+	values := make(Values)
+	if value == "" {
+		return values, nil
+	}
+
+	err := json.Unmarshal([]byte(value), &values)
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// Apply sets each key=value pair. A pair with an empty value like key= removes
+// the key
+func (recv Values) Apply(pairs []string) error {
+	for _, pair := range pairs {
+		keyValue := strings.SplitN(pair, "=", 2)
+		if len(keyValue) != 2 {
+			return fmt.Errorf("expected key=value but got %s", pair)
+		}
+
+		key, value := keyValue[0], keyValue[1]
+		if !keyRegex.MatchString(key) {
+			return fmt.Errorf("Invalid key [%s]. Valid characters are [0-9a-zA-Z_.-]", key)
+		}
+
+		if value == "" {
+			delete(recv, key)
+		} else {
+			recv[key] = value
+		}
+	}
+
+	return nil
+}
+
+// Marshal is the parameter's value. It fails if the values don't fit in a
+// parameter
+func (recv Values) Marshal() (string, error) {
+	bs, err := json.Marshal(recv)
+	if err != nil {
+		return "", err
+	}
+
+	if len(bs) > constants.RuntimeConfigMaxSize {
+		return "", fmt.Errorf("runtime config is %d bytes which is more than the %d a parameter holds",
+			len(bs), constants.RuntimeConfigMaxSize)
+	}
+
+	return string(bs), nil
+}
+
+// Keys are the value's keys in order
+func (recv Values) Keys() []string {
+	keys := make([]string, 0, len(recv))
+	for key := range recv {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
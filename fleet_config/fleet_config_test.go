@@ -0,0 +1,52 @@
+package fleet_config_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/fleet_config"
+)
+
+var _ = Describe("Fleet config", func() {
+
+	It("names the parameter after the service and environment", func() {
+		Expect(fleet_config.ParameterName("svc", "prod")).To(Equal("/porter/svc/prod/runtime-config"))
+	})
+
+	It("parses an empty parameter as no values", func() {
+		values, err := fleet_config.Parse("")
+		Expect(err).To(BeNil())
+		Expect(values).To(BeEmpty())
+	})
+
+	It("sets and removes keys", func() {
+		values, err := fleet_config.Parse(`{"log_level":"info","feature.x":"on"}`)
+		Expect(err).To(BeNil())
+
+		Expect(values.Apply([]string{"log_level=debug", "feature.x=", "limit=a=b"})).To(Succeed())
+		Expect(values).To(Equal(fleet_config.Values{
+			"log_level": "debug",
+			"limit":     "a=b",
+		}))
+		Expect(values.Keys()).To(Equal([]string{"limit", "log_level"}))
+
+		value, err := values.Marshal()
+		Expect(err).To(BeNil())
+		Expect(value).To(Equal(`{"limit":"a=b","log_level":"debug"}`))
+	})
+
+	It("rejects pairs without a valid key", func() {
+		values := make(fleet_config.Values)
+		Expect(values.Apply([]string{"log_level"})).NotTo(Succeed())
+		Expect(values.Apply([]string{"=debug"})).NotTo(Succeed())
+		Expect(values.Apply([]string{"log level=debug"})).NotTo(Succeed())
+	})
+
+	It("refuses values that don't fit in a parameter", func() {
+		values := fleet_config.Values{"big": strings.Repeat("x", 4096)}
+		_, err := values.Marshal()
+		Expect(err).NotTo(BeNil())
+	})
+})
@@ -13,32 +13,78 @@ package hook
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/adobe-platform/porter/aws/elb"
 	"github.com/adobe-platform/porter/aws_session"
 	"github.com/adobe-platform/porter/conf"
 	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/docker/engine"
 	"github.com/adobe-platform/porter/logger"
 	"github.com/adobe-platform/porter/provision_state"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/inconshreveable/log15"
 )
 
+// The environment every hook container gets. Hooks run for an environment
+// also get the region's AWS credentials
+const (
+	EnvServiceName    = "PORTER_SERVICE_NAME"
+	EnvServiceVersion = "PORTER_SERVICE_VERSION"
+	EnvHook           = "PORTER_HOOK"
+	EnvHookResult     = "PORTER_HOOK_RESULT"
+
+	// set when the service payload is on disk
+	EnvPayloadChecksum = "PORTER_PAYLOAD_CHECKSUM"
+
+	// set for hooks run for an environment
+	EnvEnvironment = "PORTER_ENVIRONMENT"
+	EnvRegion      = "AWS_REGION"
+	EnvELBNames    = "PORTER_ELB_NAMES"
+
+	// set once the region has a stack
+	EnvStackId            = "AWS_CLOUDFORMATION_STACKID"
+	EnvProvisionedELBName = "PORTER_PROVISIONED_ELB_NAME"
+	EnvProvisionedELBDNS  = "AWS_ELASTICLOADBALANCING_LOADBALANCER_DNS"
+)
+
+// hookResultDir is where the directory holding $PORTER_HOOK_RESULT is mounted
+const hookResultDir = "/porter_hook"
+
 type (
 	regionHookRunner struct {
 		runOutput *chan bytes.Buffer
 
 		serviceName string
 		hookName    string
+		regionName  string
+		workingDir  string
+
+		// set for hooks run for an environment. Remote hooks run with them
+		roleARN     string
+		roleSession *session.Session
+		region      *conf.Region
 
 		commandSuccess bool
+
+		results *hookResults
+	}
+
+	hookResults struct {
+		lock    sync.Mutex
+		results []provision_state.HookResult
 	}
 
 	hookLinkedList struct {
@@ -69,8 +115,32 @@ func ExecuteWithRunCapture(log log15.Logger,
 	provisionedRegions map[string]*provision_state.Region,
 	commandSuccess bool, runOutput *chan bytes.Buffer) (success bool) {
 
+	_, success = execute(log, hookName, environment, provisionedRegions, commandSuccess, runOutput)
+	return
+}
+
+// ExecuteWithResults is Execute that also returns the result of every hook
+// that ran
+func ExecuteWithResults(log log15.Logger,
+	hookName, environment string,
+	provisionedRegions map[string]*provision_state.Region,
+	commandSuccess bool) ([]provision_state.HookResult, bool) {
+
+	return execute(log, hookName, environment, provisionedRegions, commandSuccess, nil)
+}
+
+func execute(log log15.Logger,
+	hookName, environment string,
+	provisionedRegions map[string]*provision_state.Region,
+	commandSuccess bool, runOutput *chan bytes.Buffer) (results []provision_state.HookResult, success bool) {
+
 	var err error
 
+	collected := &hookResults{}
+	defer func() {
+		results = collected.results
+	}()
+
 	log = log.New("HookName", hookName)
 	log.Info("Hook BEGIN")
 	defer log.Info("Hook END")
@@ -95,9 +165,11 @@ func ExecuteWithRunCapture(log log15.Logger,
 		return
 	}
 
+	payloadChecksum := localPayloadChecksum(log)
+
 	if environment == "" {
 
-		runArgs := runArgsFactory(log, config, workingDir)
+		runConfig := runConfigFactory(log, config, workingDir, hookName, payloadChecksum)
 
 		hookRunner := &regionHookRunner{
 
@@ -105,11 +177,14 @@ func ExecuteWithRunCapture(log log15.Logger,
 
 			serviceName: config.ServiceName,
 			hookName:    hookName,
+			workingDir:  workingDir,
 
 			commandSuccess: commandSuccess,
+
+			results: collected,
 		}
 
-		success = hookRunner.runConfigHooks(log, os.Stdout, configHooks, runArgs)
+		success = hookRunner.runConfigHooks(log, os.Stdout, configHooks, runConfig)
 
 	} else {
 
@@ -166,27 +241,41 @@ func ExecuteWithRunCapture(log log15.Logger,
 				log.Warn("Couldn't get AWS credential values. Hooks calling AWS APIs will fail")
 			}
 
-			runArgs := runArgsFactory(log, config, workingDir)
+			var elbNames []string
+			region, err := env.GetRegion(regionName)
+			if err == nil {
+				for _, rELB := range region.ELBs {
+					elbNames = append(elbNames, rELB.Name)
+				}
+			}
 
-			runArgs = append(runArgs,
-				"-e", "PORTER_ENVIRONMENT="+environment,
-				"-e", "AWS_REGION="+regionName,
+			runConfig := runConfigFactory(log, config, workingDir, hookName, payloadChecksum)
+
+			runConfig = withEnv(runConfig,
+				EnvEnvironment+"="+environment,
+				EnvRegion+"="+regionName,
+				EnvELBNames+"="+strings.Join(elbNames, ","),
 				// AWS_DEFAULT_REGION is also needed for AWS SDKs
-				"-e", "AWS_DEFAULT_REGION="+regionName,
-				"-e", "AWS_ACCESS_KEY_ID="+credValue.AccessKeyID,
-				"-e", "AWS_SECRET_ACCESS_KEY="+credValue.SecretAccessKey,
-				"-e", "AWS_SESSION_TOKEN="+credValue.SessionToken,
-				"-e", "AWS_SECURITY_TOKEN="+credValue.SessionToken,
+				"AWS_DEFAULT_REGION="+regionName,
+				"AWS_ACCESS_KEY_ID="+credValue.AccessKeyID,
+				"AWS_SECRET_ACCESS_KEY="+credValue.SecretAccessKey,
+				"AWS_SESSION_TOKEN="+credValue.SessionToken,
+				"AWS_SECURITY_TOKEN="+credValue.SessionToken,
 			)
 
 			if elbDNS != "" {
-				runArgs = append(runArgs,
-					"-e", "AWS_ELASTICLOADBALANCING_LOADBALANCER_DNS="+elbDNS)
+				runConfig = withEnv(runConfig,
+					EnvProvisionedELBDNS+"="+elbDNS)
+			}
+
+			if regionState.ProvisionedELBName != "" {
+				runConfig = withEnv(runConfig,
+					EnvProvisionedELBName+"="+regionState.ProvisionedELBName)
 			}
 
 			if regionState.StackId != "" {
-				runArgs = append(runArgs,
-					"-e", "AWS_CLOUDFORMATION_STACKID="+regionState.StackId)
+				runConfig = withEnv(runConfig,
+					EnvStackId+"="+regionState.StackId)
 			}
 
 			hookRunner := &regionHookRunner{
@@ -194,26 +283,34 @@ func ExecuteWithRunCapture(log log15.Logger,
 
 				serviceName: config.ServiceName,
 				hookName:    hookName,
+				regionName:  regionName,
+				workingDir:  workingDir,
+
+				roleARN:     roleARN,
+				roleSession: roleSession,
+				region:      region,
 
 				commandSuccess: commandSuccess,
+
+				results: collected,
 			}
 
 			go func(runner *regionHookRunner, log log15.Logger,
-				hooks []conf.Hook, runArgs []string) {
+				hooks []conf.Hook, runConfig engine.ContainerConfig) {
 
 				log = log.New()
 
 				var regionLogOutput bytes.Buffer
 				logger.SetHandler(log, &regionLogOutput)
 
-				hooksResult := runner.runConfigHooks(log, &regionLogOutput, hooks, runArgs)
+				hooksResult := runner.runConfigHooks(log, &regionLogOutput, hooks, runConfig)
 
 				regionLogMutex.Lock()
 				regionLogOutput.WriteTo(os.Stdout)
 				regionLogMutex.Unlock()
 
 				successChan <- hooksResult
-			}(hookRunner, log, configHooks, runArgs)
+			}(hookRunner, log, configHooks, runConfig)
 		}
 
 		success = true
@@ -229,23 +326,32 @@ func ExecuteWithRunCapture(log log15.Logger,
 	return
 }
 
-func runArgsFactory(log log15.Logger, config *conf.Config, workingDir string) []string {
-	runArgs := []string{
-		"run",
-		"--rm",
-		"-v", fmt.Sprintf("%s:%s", workingDir, "/repo_root"),
-		"-e", "PORTER_SERVICE_NAME=" + config.ServiceName,
-		"-e", "DOCKER_ENV_FILE=" + constants.EnvFile,
-		"-e", "HAPROXY_STATS_USERNAME=" + constants.HAProxyStatsUsername,
-		"-e", "HAPROXY_STATS_PASSWORD=" + constants.HAProxyStatsPassword,
-		"-e", "HAPROXY_STATS_URL=" + constants.HAProxyStatsUrl,
+func runConfigFactory(log log15.Logger, config *conf.Config, workingDir,
+	hookName, payloadChecksum string) engine.ContainerConfig {
+
+	runConfig := engine.ContainerConfig{
+		Env: []string{
+			EnvServiceName + "=" + config.ServiceName,
+			EnvHook + "=" + hookName,
+			"DOCKER_ENV_FILE=" + constants.EnvFile,
+			"HAPROXY_STATS_USERNAME=" + constants.HAProxyStatsUsername,
+			"HAPROXY_STATS_PASSWORD=" + constants.HAProxyStatsPassword,
+			"HAPROXY_STATS_URL=" + constants.HAProxyStatsUrl,
+		},
+		HostConfig: engine.HostConfig{
+			Binds: []string{fmt.Sprintf("%s:%s", workingDir, "/repo_root")},
+		},
 	}
 
 	revParseOutput, err := exec.Command("git", "rev-parse", "--short", "HEAD").Output()
 	if err == nil {
 		sha1 := strings.TrimSpace(string(revParseOutput))
 
-		runArgs = append(runArgs, "-e", "PORTER_SERVICE_VERSION="+sha1)
+		runConfig = withEnv(runConfig, EnvServiceVersion+"="+sha1)
+	}
+
+	if payloadChecksum != "" {
+		runConfig = withEnv(runConfig, EnvPayloadChecksum+"="+payloadChecksum)
 	}
 
 	var warnedDeprecation bool
@@ -256,16 +362,48 @@ func runArgsFactory(log log15.Logger, config *conf.Config, workingDir string) []
 				log.Warn("Hook environments configured with PORTER_ is deprecated. In future releases and this will be an error http://bit.ly/2ar6fcQ")
 			}
 			log.Debug("Deprecated environment", "Env", kvp)
-			runArgs = append(runArgs, "-e", strings.TrimPrefix(kvp, "PORTER_"))
+			runConfig = withEnv(runConfig, strings.TrimPrefix(kvp, "PORTER_"))
+		}
+	}
+
+	return runConfig
+}
+
+// localPayloadChecksum is the checksum of the service payload pack wrote or
+// deploy kept. It's empty if neither is on disk
+func localPayloadChecksum(log log15.Logger) string {
+	for _, payloadPath := range []string{constants.PayloadPath, constants.PipelinePayloadPath} {
+		file, err := os.Open(payloadPath)
+		if err != nil {
+			continue
+		}
+		defer file.Close()
+
+		hash := sha256.New()
+		_, err = io.Copy(hash, file)
+		if err != nil {
+			log.Warn("Failed to read the service payload", "Path", payloadPath, "Error", err)
+			return ""
 		}
+
+		return hex.EncodeToString(hash.Sum(nil))
 	}
 
-	return runArgs
+	return ""
+}
+
+// withEnv copies the environment so hooks running concurrently never share
+// the backing array of runConfig.Env
+func withEnv(runConfig engine.ContainerConfig, kvps ...string) engine.ContainerConfig {
+	env := make([]string, 0, len(runConfig.Env)+len(kvps))
+	env = append(env, runConfig.Env...)
+	runConfig.Env = append(env, kvps...)
+	return runConfig
 }
 
 func (recv *regionHookRunner) runConfigHooks(log log15.Logger,
 	regionLogOutput io.Writer, hooks []conf.Hook,
-	runArgs []string) (success bool) {
+	runConfig engine.ContainerConfig) (success bool) {
 
 	successChan := make(chan bool)
 	var (
@@ -279,12 +417,12 @@ func (recv *regionHookRunner) runConfigHooks(log log15.Logger,
 	)
 
 	// Only retained lexical scope is successChan, everything else is copied
-	goGadgetHook := func(log log15.Logger, hookIndex int, hook conf.Hook, runArgs []string) {
+	goGadgetHook := func(log log15.Logger, hookIndex int, hook conf.Hook, runConfig engine.ContainerConfig) {
 
 		var hookLogOutput bytes.Buffer
 		logger.SetHandler(log, &hookLogOutput)
 
-		hookResult := recv.runConfigHook(log, &hookLogOutput, hookIndex, hook, runArgs)
+		hookResult := recv.runConfigHook(log, &hookLogOutput, hookIndex, hook, runConfig)
 
 		hookLogMutex.Lock()
 		hookLogOutput.WriteTo(regionLogOutput)
@@ -345,7 +483,7 @@ func (recv *regionHookRunner) runConfigHooks(log log15.Logger,
 		)
 
 		log.Debug("go go gadget hook")
-		go goGadgetHook(log, node.hookIndex, node.hook, runArgs)
+		go goGadgetHook(log, node.hookIndex, node.hook, runConfig)
 
 		// block anytime we're not running consecutive concurrent hooks
 		if node.next == nil || !node.next.hook.Concurrent {
@@ -369,7 +507,7 @@ func (recv *regionHookRunner) runConfigHooks(log log15.Logger,
 
 func (recv *regionHookRunner) runConfigHook(log log15.Logger,
 	hookLogOutput io.Writer, hookIndex int, hook conf.Hook,
-	runArgs []string) (success bool) {
+	runConfig engine.ContainerConfig) (success bool) {
 
 	log.Debug("runConfigHook() BEGIN")
 	defer log.Debug("runConfigHook() END")
@@ -378,10 +516,14 @@ func (recv *regionHookRunner) runConfigHook(log log15.Logger,
 		if envValue == "" {
 			envValue = os.Getenv(envKey)
 		}
-		runArgs = append(runArgs, "-e", envKey+"="+envValue)
+		runConfig = withEnv(runConfig, envKey+"="+envValue)
 		log.Debug("Configured environment", "Key", envKey, "Value", envValue)
 	}
 
+	if hook.RunsOn == constants.HRO_Remote {
+		return recv.runRemoteHook(log, hookLogOutput, hookIndex, hook, runConfig)
+	}
+
 	dockerFilePath := hook.Dockerfile
 	hookCounter := atomic.AddUint32(globalCounter, 1)
 
@@ -390,7 +532,7 @@ func (recv *regionHookRunner) runConfigHook(log log15.Logger,
 		repoDir := fmt.Sprintf("%s_clone_%d_%d", recv.hookName, hookIndex, hookCounter)
 		repoDir = path.Join(constants.TempDir, repoDir)
 
-		defer exec.Command("rm", "-fr", repoDir).Run()
+		defer os.RemoveAll(repoDir)
 
 		log.Info("git clone",
 			"Repo", hook.Repo,
@@ -424,7 +566,64 @@ func (recv *regionHookRunner) runConfigHook(log log15.Logger,
 	imageName := fmt.Sprintf("%s-%s-%d-%d",
 		recv.serviceName, recv.hookName, hookIndex, hookCounter)
 
-	if !recv.buildAndRun(log, hookLogOutput, imageName, dockerFilePath, runArgs) {
+	// the container may not run as root
+	resultDir := path.Join(recv.workingDir, constants.TempDir,
+		fmt.Sprintf("%s_result_%d_%d", recv.hookName, hookIndex, hookCounter))
+	err := os.MkdirAll(resultDir, 0777)
+	if err == nil {
+		err = os.Chmod(resultDir, 0777)
+	}
+	if err != nil {
+		log.Error("Failed to create the hook result directory", "Path", resultDir, "Error", err)
+		return
+	}
+	defer os.RemoveAll(resultDir)
+
+	runConfig = withEnv(runConfig, EnvHookResult+"="+path.Join(hookResultDir, "result.json"))
+	binds := make([]string, 0, len(runConfig.HostConfig.Binds)+1)
+	binds = append(binds, runConfig.HostConfig.Binds...)
+	runConfig.HostConfig.Binds = append(binds, resultDir+":"+hookResultDir)
+
+	result := provision_state.HookResult{
+		Hook:      recv.hookName,
+		HookIndex: hookIndex,
+		Region:    recv.regionName,
+		Status:    provision_state.HookResultFail,
+	}
+	defer func() {
+		result.Time = time.Now().UTC()
+		recv.results.add(result)
+	}()
+
+	timeout := time.Duration(hook.Timeout) * time.Second
+	if !recv.buildAndRun(log, hookLogOutput, imageName, dockerFilePath, runConfig, timeout) {
+		result.Message = "the hook exited with an error"
+		return
+	}
+
+	reported, err := readHookResult(path.Join(resultDir, "result.json"))
+	if err != nil {
+		log.Error("Invalid hook result", "Error", err)
+		result.Message = "invalid " + EnvHookResult + ": " + err.Error()
+		return
+	}
+
+	success = applyHookResult(log, &result, reported)
+	return
+}
+
+// applyHookResult copies what the hook reported onto its result. A hook that
+// exited successfully without reporting passed
+func applyHookResult(log log15.Logger, result, reported *provision_state.HookResult) (success bool) {
+	result.Status = provision_state.HookResultPass
+	if reported != nil {
+		result.Status = reported.Status
+		result.Message = reported.Message
+		result.Details = reported.Details
+	}
+
+	if result.Status == provision_state.HookResultFail {
+		log.Error("The hook reported failure", "Message", result.Message)
 		return
 	}
 
@@ -432,9 +631,46 @@ func (recv *regionHookRunner) runConfigHook(log log15.Logger,
 	return
 }
 
+// readHookResult reads what a hook wrote to $PORTER_HOOK_RESULT. It's nil if
+// the hook didn't write it
+func readHookResult(resultPath string) (*provision_state.HookResult, error) {
+	resultBytes, err := ioutil.ReadFile(resultPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseHookResult(resultBytes)
+}
+
+func parseHookResult(resultBytes []byte) (*provision_state.HookResult, error) {
+	result := &provision_state.HookResult{}
+	err := json.Unmarshal(resultBytes, result)
+	if err != nil {
+		return nil, err
+	}
+
+	switch result.Status {
+	case provision_state.HookResultPass, provision_state.HookResultFail:
+	default:
+		return nil, fmt.Errorf("status must be %s or %s", provision_state.HookResultPass, provision_state.HookResultFail)
+	}
+
+	return result, nil
+}
+
+func (recv *hookResults) add(result provision_state.HookResult) {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	recv.results = append(recv.results, result)
+}
+
 func (recv *regionHookRunner) buildAndRun(log log15.Logger,
 	hookLogOutput io.Writer, imageName, dockerFilePath string,
-	runArgs []string) (success bool) {
+	runConfig engine.ContainerConfig, timeout time.Duration) (success bool) {
 
 	log = log.New("Dockerfile", dockerFilePath, "ImageName", imageName)
 
@@ -456,17 +692,15 @@ func (recv *regionHookRunner) buildAndRun(log log15.Logger,
 	log.Info("If you experience problems talk to the author of this Dockerfile")
 	log.Info("You can read more about deployment hooks here http://bit.ly/2dKBwd0")
 
-	dockerBuildCmd := exec.Command("docker", "build",
-		"-t", imageName,
-		"-f", dockerFilePath,
-		path.Dir(dockerFilePath),
-	)
-	dockerBuildCmd.Stdout = hookLogOutput
-	dockerBuildCmd.Stderr = hookLogOutput
+	dockerClient, err := engine.New()
+	if err != nil {
+		log.Error("engine.New", "Error", err)
+		return
+	}
 
 	fmt.Fprintln(hookLogOutput, "Building deployment hook START")
 	fmt.Fprintln(hookLogOutput, "==============================")
-	err := dockerBuildCmd.Run()
+	err = buildHookImage(dockerClient, hookLogOutput, imageName, dockerFilePath)
 	fmt.Fprintln(hookLogOutput, "============================")
 	fmt.Fprintln(hookLogOutput, "Building deployment hook END")
 
@@ -479,20 +713,21 @@ func (recv *regionHookRunner) buildAndRun(log log15.Logger,
 		return
 	}
 
-	runArgs = append(runArgs, imageName)
-
-	log.Debug("docker run", "Args", runArgs)
+	runConfig.Image = imageName
 
-	runCmd := exec.Command("docker", runArgs...)
-	runCmd.Stdout = io.MultiWriter(hookLogOutput, &runOutput)
-	runCmd.Stderr = hookLogOutput
+	log.Debug("docker run", "Env", runConfig.Env, "Binds", runConfig.HostConfig.Binds)
 
 	fmt.Fprintln(hookLogOutput, "Running deployment hook START")
 	fmt.Fprintln(hookLogOutput, "=============================")
-	err = runCmd.Run()
+	err = dockerClient.RunWithTimeout(runConfig, timeout, io.MultiWriter(hookLogOutput, &runOutput), hookLogOutput)
 	fmt.Fprintln(hookLogOutput, "===========================")
 	fmt.Fprintln(hookLogOutput, "Running deployment hook END")
 
+	if _, ok := err.(*engine.TimeoutError); ok {
+		log.Error("The hook ran past its timeout and was killed", "Timeout", timeout.String())
+		return
+	}
+
 	if err != nil {
 		log.Error("docker run", "Error", err)
 		fmt.Fprintln(hookLogOutput, "This is not a problem with porter but with the Dockerfile porter tried to run")
@@ -507,3 +742,19 @@ func (recv *regionHookRunner) buildAndRun(log log15.Logger,
 	success = true
 	return
 }
+
+// buildHookImage builds the Dockerfile with its directory as the build context
+func buildHookImage(dockerClient *engine.Client, hookLogOutput io.Writer,
+	imageName, dockerFilePath string) error {
+
+	buildContext, err := engine.BuildContext(path.Dir(dockerFilePath), path.Base(dockerFilePath))
+	if err != nil {
+		return err
+	}
+	defer buildContext.Close()
+
+	return dockerClient.ImageBuild(buildContext, engine.BuildOptions{
+		Tags:       []string{imageName},
+		Dockerfile: path.Base(dockerFilePath),
+	}, engine.PrintProgress(hookLogOutput))
+}
@@ -0,0 +1,405 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package hook
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/adobe-platform/porter/aws/codebuild"
+	"github.com/adobe-platform/porter/aws/ec2"
+	"github.com/adobe-platform/porter/aws/logs"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/docker/engine"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	ec2lib "github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/inconshreveable/log15"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// how often a remote hook's build and logs are polled
+	remoteHookPoll = 5 * time.Second
+
+	// where a remote hook writes $PORTER_HOOK_RESULT. porter can't read files
+	// off the build so the result is echoed to the log after a marker
+	remoteHookResultPath   = "/tmp/porter_hook_result.json"
+	remoteHookResultMarker = EnvHookResult + "="
+)
+
+type buildspec struct {
+	Version float64                   `yaml:"version"`
+	Phases  map[string]buildspecPhase `yaml:"phases"`
+}
+
+type buildspecPhase struct {
+	Commands []string `yaml:"commands"`
+}
+
+// remoteHookProjectName is the CodeBuild project remote hooks run on. porter
+// creates it in each region the first time it's needed
+func remoteHookProjectName(serviceName string) string {
+	return "porter-hook-" + serviceName
+}
+
+// runRemoteHook runs the hook's command in its image on a CodeBuild build in
+// the region with the environment's role. The build's log is streamed to
+// hookLogOutput
+func (recv *regionHookRunner) runRemoteHook(log log15.Logger,
+	hookLogOutput io.Writer, hookIndex int, hook conf.Hook,
+	runConfig engine.ContainerConfig) (success bool) {
+
+	log = log.New("Image", hook.Image)
+
+	result := provision_state.HookResult{
+		Hook:      recv.hookName,
+		HookIndex: hookIndex,
+		Region:    recv.regionName,
+		Status:    provision_state.HookResultFail,
+	}
+	defer func() {
+		result.Time = time.Now().UTC()
+		recv.results.add(result)
+	}()
+
+	if recv.roleSession == nil {
+		log.Error("Remote hooks only run for an environment. Run it with -e")
+		result.Message = "remote hooks only run for an environment"
+		return
+	}
+
+	reported, buildSuccess := recv.runBuild(log, hookLogOutput, hook, runConfig)
+	if !buildSuccess {
+		result.Message = "the hook exited with an error"
+		return
+	}
+
+	success = applyHookResult(log, &result, reported)
+	return
+}
+
+func (recv *regionHookRunner) runBuild(log log15.Logger, hookLogOutput io.Writer,
+	hook conf.Hook, runConfig engine.ContainerConfig) (reported *provision_state.HookResult, success bool) {
+
+	client := codebuild.New(recv.roleSession)
+	projectName := remoteHookProjectName(recv.serviceName)
+
+	// images outside CodeBuild's are pulled with the service role so private
+	// ECR repositories work
+	pullCredentials := codebuild.ImagePullCredentialsServiceRole
+	if strings.HasPrefix(hook.Image, "aws/codebuild/") {
+		pullCredentials = codebuild.ImagePullCredentialsCodeBuild
+	}
+
+	spec, err := remoteHookBuildspec(hook.Command)
+	if err != nil {
+		log.Error("yaml.Marshal", "Error", err)
+		return
+	}
+
+	log.Info("Ensuring the CodeBuild project", "ProjectName", projectName)
+	err = client.EnsureProject(&codebuild.CreateProjectInput{
+		Name: projectName,
+		Source: codebuild.ProjectSource{
+			Type:      codebuild.SourceTypeNoSource,
+			Buildspec: spec,
+		},
+		Artifacts: codebuild.ProjectArtifacts{
+			Type: codebuild.ArtifactsTypeNoArtifacts,
+		},
+		Environment: codebuild.ProjectEnvironment{
+			Type:                     codebuild.EnvironmentTypeLinux,
+			Image:                    hook.Image,
+			ComputeType:              codebuild.ComputeTypeSmall,
+			ImagePullCredentialsType: pullCredentials,
+		},
+		ServiceRole: recv.roleARN,
+	})
+	if err != nil {
+		log.Error("codebuild:CreateProject", "ProjectName", projectName, "Error", err)
+		return
+	}
+
+	vpcConfig, vpcSuccess := recv.remoteHookVpcConfig(log)
+	if !vpcSuccess {
+		return
+	}
+
+	startInput := &codebuild.StartBuildInput{
+		ProjectName:                      projectName,
+		BuildspecOverride:                spec,
+		ImageOverride:                    hook.Image,
+		ImagePullCredentialsTypeOverride: pullCredentials,
+		ServiceRoleOverride:              recv.roleARN,
+		EnvironmentVariablesOverride:     remoteHookEnv(runConfig.Env, hook.Secrets),
+		VpcConfigOverride:                vpcConfig,
+	}
+
+	if hook.Timeout > 0 {
+		// CodeBuild times out in whole minutes and no sooner than 5
+		minutes := (hook.Timeout + 59) / 60
+		if minutes < 5 {
+			minutes = 5
+		}
+		startInput.TimeoutInMinutesOverride = minutes
+	}
+
+	startOutput, err := client.StartBuild(startInput)
+	if err != nil {
+		log.Error("codebuild:StartBuild", "ProjectName", projectName, "Error", err)
+		return
+	}
+
+	buildId := startOutput.Build.Id
+	log = log.New("BuildId", buildId)
+	log.Info("Started a remote hook build")
+
+	fmt.Fprintln(hookLogOutput, "Running remote deployment hook START")
+	fmt.Fprintln(hookLogOutput, "====================================")
+
+	tail := &buildLogTail{
+		client: logs.New(recv.roleSession),
+		seen:   make(map[string]struct{}),
+	}
+
+	var build codebuild.Build
+	for {
+		build, err = client.GetBuild(buildId)
+		if err != nil {
+			log.Error("codebuild:BatchGetBuilds", "Error", err)
+			return
+		}
+
+		err = tail.read(build.Logs, hookLogOutput)
+		if err != nil {
+			log.Warn("logs:FilterLogEvents", "Error", err)
+		}
+
+		if build.BuildComplete {
+			break
+		}
+
+		time.Sleep(remoteHookPoll)
+	}
+
+	// the last of the log trails the build's completion
+	time.Sleep(remoteHookPoll)
+	err = tail.read(build.Logs, hookLogOutput)
+	if err != nil {
+		log.Warn("logs:FilterLogEvents", "Error", err)
+	}
+
+	fmt.Fprintln(hookLogOutput, "==================================")
+	fmt.Fprintln(hookLogOutput, "Running remote deployment hook END")
+
+	if build.BuildStatus != codebuild.BuildStatusSucceeded {
+		log.Error("The remote hook build didn't succeed", "BuildStatus", build.BuildStatus,
+			"CurrentPhase", build.CurrentPhase)
+		return
+	}
+
+	if tail.result != "" {
+		reported, err = parseHookResult([]byte(tail.result))
+		if err != nil {
+			log.Error("Invalid hook result", "Error", err)
+			return
+		}
+	}
+
+	success = true
+	return
+}
+
+// remoteHookBuildspec runs the command and then echoes $PORTER_HOOK_RESULT
+// if the command wrote it
+func remoteHookBuildspec(command string) (string, error) {
+	echoResult := fmt.Sprintf(`if [ -f "$%s" ]; then echo "%s$(tr -d '\n' < "$%s")"; fi`,
+		EnvHookResult, remoteHookResultMarker, EnvHookResult)
+
+	specBytes, err := yaml.Marshal(buildspec{
+		Version: 0.2,
+		Phases: map[string]buildspecPhase{
+			"build": {
+				Commands: []string{command},
+			},
+			"post_build": {
+				Commands: []string{echoResult},
+			},
+		},
+	})
+	return string(specBytes), err
+}
+
+// remoteHookEnv is the hook's environment without the AWS credentials. The
+// build has the service role's own. Secrets are references CodeBuild resolves
+// when the build starts so the values aren't in the build's configuration
+func remoteHookEnv(env []string, secrets map[string]string) []codebuild.EnvironmentVariable {
+	vars := make([]codebuild.EnvironmentVariable, 0, len(env)+len(secrets))
+
+	for name, source := range secrets {
+		varType := codebuild.EnvironmentVariableTypeParameterStore
+		if strings.HasPrefix(source, "arn:aws:secretsmanager:") {
+			varType = codebuild.EnvironmentVariableTypeSecretsManager
+		}
+
+		vars = append(vars, codebuild.EnvironmentVariable{
+			Name:  name,
+			Value: source,
+			Type:  varType,
+		})
+	}
+
+	for _, kvp := range env {
+		kv := strings.SplitN(kvp, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		switch kv[0] {
+		case "AWS_ACCESS_KEY_ID",
+			"AWS_SECRET_ACCESS_KEY",
+			"AWS_SESSION_TOKEN",
+			"AWS_SECURITY_TOKEN",
+			EnvHookResult:
+			continue
+		}
+
+		vars = append(vars, codebuild.EnvironmentVariable{
+			Name:  kv[0],
+			Value: kv[1],
+			Type:  codebuild.EnvironmentVariableTypePlaintext,
+		})
+	}
+
+	return append(vars, codebuild.EnvironmentVariable{
+		Name:  EnvHookResult,
+		Value: remoteHookResultPath,
+		Type:  codebuild.EnvironmentVariableTypePlaintext,
+	})
+}
+
+// remoteHookVpcConfig runs the build in the region's VPC so hooks reach what
+// the service does. It's nil if the region has no vpc_id
+func (recv *regionHookRunner) remoteHookVpcConfig(log log15.Logger) (vpcConfig *codebuild.VpcConfig, success bool) {
+	if recv.region == nil || !recv.region.HasVpc() {
+		success = true
+		return
+	}
+
+	ec2Client := ec2lib.New(recv.roleSession)
+
+	// vpc_tags and subnet_tags are resolved like provision does
+	region := *recv.region
+	err := region.DiscoverNetwork(ec2.NetworkFinder{Client: ec2Client})
+	if err != nil {
+		log.Error("Network discovery", "Error", err)
+		return
+	}
+
+	var subnets []string
+	for _, az := range region.AZs {
+		if az.SubnetID != "" {
+			subnets = append(subnets, az.SubnetID)
+		}
+	}
+
+	output, err := ec2Client.DescribeSecurityGroups(&ec2lib.DescribeSecurityGroupsInput{
+		Filters: []*ec2lib.Filter{
+			{
+				Name:   aws.String("vpc-id"),
+				Values: []*string{aws.String(region.VpcId)},
+			},
+			{
+				Name:   aws.String("group-name"),
+				Values: []*string{aws.String("default")},
+			},
+		},
+	})
+	if err != nil {
+		log.Error("ec2:DescribeSecurityGroups", "VpcId", region.VpcId, "Error", err)
+		return
+	}
+
+	if len(output.SecurityGroups) != 1 {
+		log.Error("The VPC has no default security group", "VpcId", region.VpcId)
+		return
+	}
+
+	vpcConfig = &codebuild.VpcConfig{
+		VpcId:            region.VpcId,
+		Subnets:          subnets,
+		SecurityGroupIds: []string{aws.StringValue(output.SecurityGroups[0].GroupId)},
+	}
+	success = true
+	return
+}
+
+// buildLogTail copies new events of a build's log stream and keeps the hook
+// result the build echoed
+type buildLogTail struct {
+	client    *logs.Logs
+	startTime int64
+	seen      map[string]struct{}
+	result    string
+}
+
+func (recv *buildLogTail) read(location *codebuild.LogsLocation, w io.Writer) error {
+	// the stream doesn't exist until the build is provisioned
+	if location == nil || location.GroupName == "" || location.StreamName == "" {
+		return nil
+	}
+
+	input := &logs.FilterLogEventsInput{
+		LogGroupName:        location.GroupName,
+		LogStreamNamePrefix: location.StreamName,
+		StartTime:           recv.startTime,
+	}
+
+	for {
+		output, err := recv.client.FilterLogEvents(input)
+		if err != nil {
+			if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == logs.ErrCodeResourceNotFound {
+				return nil
+			}
+			return err
+		}
+
+		for _, event := range output.Events {
+			if _, exists := recv.seen[event.EventId]; exists {
+				continue
+			}
+			recv.seen[event.EventId] = struct{}{}
+
+			// events at the same millisecond can arrive on the next read
+			if event.Timestamp > recv.startTime {
+				recv.startTime = event.Timestamp
+			}
+
+			message := strings.TrimRight(event.Message, "\r\n")
+			if strings.HasPrefix(message, remoteHookResultMarker) {
+				recv.result = strings.TrimPrefix(message, remoteHookResultMarker)
+				continue
+			}
+
+			fmt.Fprintln(w, message)
+		}
+
+		if output.NextToken == "" {
+			return nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
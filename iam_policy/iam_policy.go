@@ -0,0 +1,621 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package iam_policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/command_queue"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/promote"
+)
+
+const policyVersion = "2012-10-17"
+
+type (
+	// Document is an IAM policy document. Statements are Statement or, for
+	// the instance role, the statements of the rendered template as they are
+	Document struct {
+		Version   string        `json:"Version"`
+		Statement []interface{} `json:"Statement"`
+	}
+
+	Statement struct {
+		Sid      string   `json:"Sid,omitempty"`
+		Effect   string   `json:"Effect"`
+		Action   []string `json:"Action"`
+		Resource []string `json:"Resource"`
+	}
+
+	// Policies are the policy documents an environment needs
+	Policies struct {
+		// Deployer is for the environment's role_arn
+		Deployer Document `json:"deployer"`
+
+		// CloudFormation is for the environment's cfn_role_arn. Without one
+		// the deployer has these actions
+		CloudFormation *Document `json:"cloudformation,omitempty"`
+
+		// InstanceRole is the inline policies of the role the template
+		// generates for instances
+		InstanceRole Document `json:"instance_role"`
+
+		// ManagedPolicyARNs are attached to the instance role by the template
+		ManagedPolicyARNs []string `json:"instance_role_managed_policy_arns,omitempty"`
+
+		// UnmappedResourceTypes are in the template but porter doesn't know
+		// the actions they need. Add them to the cloudformation statements
+		UnmappedResourceTypes []string `json:"unmapped_resource_types,omitempty"`
+	}
+
+	// Template is what a rendered template needs
+	Template struct {
+		// Actions CloudFormation calls to create, update, and delete the
+		// template's resources
+		Actions []string
+
+		// UnmappedResourceTypes have no known actions
+		UnmappedResourceTypes []string
+
+		// InstanceRoleStatements are the statements of the inline policies of
+		// roles trusting ec2.amazonaws.com
+		InstanceRoleStatements []interface{}
+
+		ManagedPolicyARNs []string
+	}
+)
+
+func NewDocument() Document {
+	return Document{
+		Version:   policyVersion,
+		Statement: make([]interface{}, 0),
+	}
+}
+
+// Allow adds a statement unless there are no actions
+func (recv *Document) Allow(sid string, actions []string, resources ...string) {
+	if len(actions) == 0 {
+		return
+	}
+
+	resources = sortedUnique(resources)
+	if len(resources) == 0 {
+		resources = []string{"*"}
+	}
+
+	recv.Statement = append(recv.Statement, Statement{
+		Sid:      sid,
+		Effect:   "Allow",
+		Action:   sortedUnique(actions),
+		Resource: resources,
+	})
+}
+
+// ParseTemplate finds the actions a rendered template needs and the policies
+// of its instance role
+func ParseTemplate(templateBytes []byte) (template Template, err error) {
+	var parsed struct {
+		Resources map[string]struct {
+			Type       string                 `json:"Type"`
+			Properties map[string]interface{} `json:"Properties"`
+		} `json:"Resources"`
+	}
+
+	err = json.Unmarshal(templateBytes, &parsed)
+	if err != nil {
+		return
+	}
+
+	var actions, unmapped []string
+
+	for _, resource := range parsed.Resources {
+		resourceActions, mapped := resourceActions[resource.Type]
+		if !mapped {
+			unmapped = append(unmapped, resource.Type)
+			continue
+		}
+		actions = append(actions, resourceActions...)
+
+		if resource.Type != cfn.IAM_Role || !trustsEC2(resource.Properties) {
+			continue
+		}
+
+		policies, _ := resource.Properties["Policies"].([]interface{})
+		for _, policyRaw := range policies {
+			policy, _ := policyRaw.(map[string]interface{})
+			document, _ := policy["PolicyDocument"].(map[string]interface{})
+			statements, _ := document["Statement"].([]interface{})
+
+			template.InstanceRoleStatements = append(template.InstanceRoleStatements, statements...)
+		}
+
+		managedPolicyARNs, _ := resource.Properties["ManagedPolicyArns"].([]interface{})
+		for _, arn := range managedPolicyARNs {
+			if arnStr, ok := arn.(string); ok {
+				template.ManagedPolicyARNs = append(template.ManagedPolicyARNs, arnStr)
+			}
+		}
+	}
+
+	template.Actions = sortedUnique(actions)
+	template.UnmappedResourceTypes = sortedUnique(unmapped)
+	template.ManagedPolicyARNs = sortedUnique(template.ManagedPolicyARNs)
+	return
+}
+
+// trustsEC2 is true for a role instances assume
+func trustsEC2(properties map[string]interface{}) bool {
+	trustBytes, err := json.Marshal(properties["AssumeRolePolicyDocument"])
+	if err != nil {
+		return false
+	}
+
+	return strings.Contains(string(trustBytes), `"ec2.amazonaws.com"`)
+}
+
+// Generate builds the policies an environment needs from its config and the
+// template rendered for each region
+func Generate(config *conf.Config, environment *conf.Environment,
+	templates map[string]Template) (policies Policies, err error) {
+
+	policies.Deployer = NewDocument()
+	policies.InstanceRole = NewDocument()
+
+	var templateActions, unmapped, managedPolicyARNs, cfnRoleARNs []string
+	seenStatements := make(map[string]struct{})
+
+	for _, region := range environment.Regions {
+		template, exists := templates[region.Name]
+		if !exists {
+			err = fmt.Errorf("no template for region %s", region.Name)
+			return
+		}
+
+		templateActions = append(templateActions, template.Actions...)
+		unmapped = append(unmapped, template.UnmappedResourceTypes...)
+		managedPolicyARNs = append(managedPolicyARNs, template.ManagedPolicyARNs...)
+
+		// regions render the same statements unless they refer to something
+		// regional
+		for _, statement := range template.InstanceRoleStatements {
+			statementBytes, _ := json.Marshal(statement)
+			if _, seen := seenStatements[string(statementBytes)]; seen {
+				continue
+			}
+			seenStatements[string(statementBytes)] = struct{}{}
+
+			policies.InstanceRole.Statement = append(policies.InstanceRole.Statement, statement)
+		}
+
+		var cfnRoleARN string
+		cfnRoleARN, err = environment.GetCFNRoleARN(region.Name)
+		if err != nil {
+			return
+		}
+		if cfnRoleARN != "" {
+			cfnRoleARNs = append(cfnRoleARNs, cfnRoleARN)
+		}
+
+		if region.DNS != nil {
+			// the DNS stack is created with the region's credentials too
+			templateActions = append(templateActions, resourceActions[cfn.Route53_RecordSet]...)
+
+			// stack swaps can be health checked
+			if region.DNSToStacks() {
+				templateActions = append(templateActions, resourceActions[cfn.Route53_HealthCheck]...)
+			}
+
+			// instance records are outside the stack. It holds the promoted
+			// stack that porterd reads
+			if region.DNSToInstances() {
+				templateActions = append(templateActions, resourceActions[cfn.SSM_Parameter]...)
+			}
+		}
+
+		if region.TLS != nil && region.TLS.RequestsCertificate() {
+			// so is the certificate stack
+			templateActions = append(templateActions, resourceActions[cfn.CertificateManager_Certificate]...)
+		}
+
+		if environment.Compute == conf.Compute_ECS && region.PrimaryTopology() == conf.Topology_Inet {
+			// and the ECS load balancer stack
+			for _, resourceType := range []string{
+				cfn.EC2_SecurityGroup,
+				cfn.ElasticLoadBalancingV2_Listener,
+				cfn.ElasticLoadBalancingV2_LoadBalancer,
+			} {
+				templateActions = append(templateActions, resourceActions[resourceType]...)
+			}
+
+			if waf, _ := environment.GetWAF(region.Name); waf != nil {
+				templateActions = append(templateActions, resourceActions[cfn.WAFv2_WebACLAssociation]...)
+				if waf.WebACLARN == "" {
+					templateActions = append(templateActions, resourceActions[cfn.WAFv2_WebACL]...)
+				}
+			}
+		}
+
+		if monitoring, _ := environment.GetMonitoring(region.Name); monitoring != nil {
+			// and the monitoring stack
+			for _, resourceType := range []string{
+				cfn.CloudWatch_Alarm,
+				cfn.CloudWatch_Dashboard,
+				cfn.SNS_Topic,
+			} {
+				templateActions = append(templateActions, resourceActions[resourceType]...)
+			}
+		}
+
+		if region.EFS != nil {
+			// and the file system stack
+			for _, resourceType := range []string{
+				cfn.EC2_SecurityGroup,
+				cfn.EC2_SecurityGroupIngress,
+				cfn.EFS_FileSystem,
+				cfn.EFS_MountTarget,
+			} {
+				templateActions = append(templateActions, resourceActions[resourceType]...)
+			}
+		}
+
+		addDeployerStatements(&policies.Deployer, config, environment, region)
+	}
+
+	if len(cfnRoleARNs) == 0 {
+		policies.Deployer.Allow("StackResources", templateActions)
+	} else {
+		if len(cfnRoleARNs) != len(environment.Regions) {
+			// regions without a service role create their resources with the
+			// deployer's credentials
+			policies.Deployer.Allow("StackResources", templateActions)
+		}
+
+		cfnDocument := NewDocument()
+		cfnDocument.Allow("StackResources", templateActions)
+		policies.CloudFormation = &cfnDocument
+
+		policies.Deployer.Allow("PassCloudFormationRole", []string{"iam:PassRole"}, cfnRoleARNs...)
+	}
+
+	policies.ManagedPolicyARNs = sortedUnique(managedPolicyARNs)
+	policies.UnmappedResourceTypes = sortedUnique(unmapped)
+	return
+}
+
+// addDeployerStatements adds the calls porter makes itself in a region
+func addDeployerStatements(document *Document, config *conf.Config, environment *conf.Environment,
+	region *conf.Region) {
+
+	sidSuffix := sidRegion(region.Name)
+	sid := func(name string) string {
+		return name + sidSuffix
+	}
+
+	// describe calls can't be scoped to a resource
+	describeActions := []string{
+		"autoscaling:DescribeAutoScalingGroups",
+		"autoscaling:DescribeScalingActivities",
+		"cloudformation:DescribeStacks",
+		"cloudformation:ValidateTemplate",
+		"ec2:DescribeAccountAttributes",
+		"ec2:DescribeAvailabilityZones",
+		"ec2:DescribeInstances",
+		"ec2:DescribeSecurityGroups",
+		"ec2:DescribeSubnets",
+		"ec2:DescribeVpcs",
+		"ec2:GetConsoleOutput",
+		"elasticloadbalancing:DescribeInstanceHealth",
+		"elasticloadbalancing:DescribeLoadBalancers",
+		"elasticloadbalancing:DescribeTags",
+		"elasticloadbalancing:DescribeTargetHealth",
+		"iam:GetRole",
+		"tag:GetResources",
+	}
+	document.Allow(sid("Describe"), describeActions)
+
+	// stack names start with the service and environment and end with the
+	// user who deployed them
+	stackPrefix := config.ServiceName + "-" + environment.Name + "-"
+	document.Allow(sid("ServiceStacks"), []string{
+		"cloudformation:CreateStack",
+		"cloudformation:DeleteStack",
+		"cloudformation:DescribeStackEvents",
+		"cloudformation:DescribeStackResource",
+		"cloudformation:DescribeStackResourceDrifts",
+		"cloudformation:DescribeStackResources",
+		"cloudformation:GetTemplate",
+		"cloudformation:UpdateStack",
+	}, stackARN(region.Name, stackPrefix+"*"))
+
+	// prune deletes what's orphaned by stacks deleted with resources retained
+	document.Allow(sid("Prune"), []string{
+		"cloudwatch:DeleteAlarms",
+		"elasticloadbalancing:DeleteLoadBalancer",
+		"elasticloadbalancing:DeleteTargetGroup",
+		"logs:DeleteLogGroup",
+	})
+
+	if len(region.ELBs) > 0 || region.ELB != "" {
+		document.Allow(sid("Promote"), []string{
+			"elasticloadbalancing:DeregisterInstancesFromLoadBalancer",
+			"elasticloadbalancing:RegisterInstancesWithLoadBalancer",
+		})
+	}
+
+	if region.DNS != nil {
+		document.Allow(sid("DNSStack"), []string{
+			"cloudformation:CreateStack",
+			"cloudformation:DescribeStacks",
+			"cloudformation:UpdateStack",
+		}, stackARN(region.Name, promote.DNSStackName(config.ServiceName, environment.Name)))
+	}
+
+	if region.DNSToInstances() {
+		// promote, instance refresh, and prune register and remove instance
+		// records
+		document.Allow(sid("InstanceDNS"), []string{
+			"cloudwatch:DeleteAlarms",
+			"cloudwatch:PutMetricAlarm",
+			"route53:ChangeResourceRecordSets",
+			"route53:CreateHealthCheck",
+			"route53:DeleteHealthCheck",
+			"route53:ListHostedZonesByName",
+			"route53:ListResourceRecordSets",
+		})
+	}
+
+	if region.TLS != nil && region.TLS.RequestsCertificate() {
+		document.Allow(sid("CertificateStack"), []string{
+			"cloudformation:CreateStack",
+			"cloudformation:DescribeStacks",
+			"cloudformation:UpdateStack",
+		}, stackARN(region.Name, conf.CertificateStackName(config.ServiceName, environment.Name)))
+	}
+
+	if environment.Compute == conf.Compute_ECS && region.PrimaryTopology() == conf.Topology_Inet {
+		// promote changes the stack's parameters
+		document.Allow(sid("ECSLoadBalancerStack"), []string{
+			"cloudformation:CreateStack",
+			"cloudformation:DescribeStacks",
+			"cloudformation:UpdateStack",
+		}, stackARN(region.Name, conf.ECSLoadBalancerStackName(config.ServiceName, environment.Name)))
+	}
+
+	if region.Security != nil {
+		document.Allow(sid("SecurityGroupStack"), []string{
+			"cloudformation:CreateStack",
+			"cloudformation:DescribeStacks",
+		}, stackARN(region.Name, conf.SecurityGroupStackName(config.ServiceName, environment.Name)))
+	}
+
+	if monitoring, _ := environment.GetMonitoring(region.Name); monitoring != nil {
+		document.Allow(sid("MonitoringStack"), []string{
+			"cloudformation:CreateStack",
+			"cloudformation:DescribeStacks",
+			"cloudformation:UpdateStack",
+		}, stackARN(region.Name, conf.MonitoringStackName(config.ServiceName, environment.Name)))
+	}
+
+	if region.EFS != nil {
+		document.Allow(sid("FileSystemStack"), []string{
+			"cloudformation:CreateStack",
+			"cloudformation:DescribeStacks",
+			"cloudformation:UpdateStack",
+		}, stackARN(region.Name, conf.FileSystemStackName(config.ServiceName, environment.Name)))
+	}
+
+	if region.S3Bucket != "" {
+		document.Allow(sid("ServicePayload"), []string{
+			"s3:GetObject",
+			"s3:ListBucket",
+			"s3:PutObject",
+		}, "arn:aws:s3:::"+region.S3Bucket, "arn:aws:s3:::"+region.S3Bucket+"/*")
+	}
+
+	if region.SSEKMSKeyId != nil && *region.SSEKMSKeyId != "" {
+		document.Allow(sid("ServicePayloadKey"), []string{
+			"kms:Decrypt",
+			"kms:GenerateDataKey",
+		}, kmsKeyARN(region.Name, *region.SSEKMSKeyId))
+	}
+
+	if region.SecretsKMSKeyId != "" {
+		document.Allow(sid("Secrets"), []string{
+			"kms:CreateGrant",
+			"kms:DescribeKey",
+			"kms:Encrypt",
+			"kms:GenerateDataKey",
+			"kms:GetKeyPolicy",
+			"kms:ListGrants",
+			"kms:RevokeGrant",
+		}, kmsKeyARN(region.Name, region.SecretsKMSKeyId))
+	}
+
+	// hot swap reads queues the stack created
+	if environment.Hotswap {
+		document.Allow(sid("StackQueues"), []string{
+			"sqs:DeleteMessage",
+			"sqs:GetQueueAttributes",
+			"sqs:GetQueueUrl",
+			"sqs:ReceiveMessage",
+		}, fmt.Sprintf("arn:aws:sqs:%s:*:%s*", region.Name, stackPrefix))
+	}
+
+	// fleet send sends to the queues porterd creates for its instance and
+	// prune deletes those of terminated instances
+	if environment.CommandQueue {
+		document.Allow(sid("CommandQueues"), []string{
+			"sqs:DeleteQueue",
+			"sqs:GetQueueUrl",
+			"sqs:SendMessage",
+		}, fmt.Sprintf("arn:aws:sqs:%s:*:%s*", region.Name,
+			command_queue.QueueNamePrefix(config.ServiceName, environment.Name)))
+		document.Allow(sid("ListCommandQueues"), []string{"sqs:ListQueues"})
+	}
+
+	if environment.InstanceRefresh != nil {
+		document.Allow(sid("InstanceRefresh"), []string{
+			"autoscaling:CancelInstanceRefresh",
+			"autoscaling:DescribeInstanceRefreshes",
+			"autoscaling:StartInstanceRefresh",
+			"ec2:CreateLaunchTemplateVersion",
+			"ec2:DescribeLaunchTemplateVersions",
+			"iam:PassRole",
+		})
+	}
+
+	if ami := environment.AMI; ami != nil {
+		document.Allow(sid("AMI"), []string{"ec2:DescribeImages"})
+
+		// public parameters like /aws/service/... have no account
+		if ami.SSMParameter != "" {
+			document.Allow(sid("AMIParameter"), []string{"ssm:GetParameter"},
+				fmt.Sprintf("arn:aws:ssm:%s:*:parameter%s", region.Name, ami.SSMParameter))
+		}
+	}
+
+	// promote sets the destination ELB's connection draining timeout and
+	// prune drains a stack's load balancers before deleting it
+	if environment.Drain != nil {
+		document.Allow(sid("Drain"), []string{
+			"cloudformation:DescribeStackResources",
+			"elasticloadbalancing:DeregisterInstancesFromLoadBalancer",
+			"elasticloadbalancing:DeregisterTargets",
+			"elasticloadbalancing:ModifyLoadBalancerAttributes",
+		})
+	}
+
+	// porter bake launches a builder instance and makes an image of it
+	if environment.Bake != nil {
+		document.Allow(sid("Bake"), []string{
+			"ec2:CreateImage",
+			"ec2:CreateTags",
+			"ec2:DescribeImages",
+			"ec2:DescribeInstances",
+			"ec2:GetConsoleOutput",
+			"ec2:RunInstances",
+			"ec2:TerminateInstances",
+		})
+
+		architectures := environment.RegionArchitectures(region)
+		if len(architectures) == 1 && architectures[0] == conf.Architecture_ARM64 &&
+			(environment.AMI == nil || environment.AMI.Baked) {
+
+			document.Allow(sid("BakeParameter"), []string{"ssm:GetParameter"},
+				fmt.Sprintf("arn:aws:ssm:%s:*:parameter%s", region.Name, constants.ImageIdArm64SSMPath))
+		}
+	}
+
+	if environment.DeployMetrics != nil && environment.DeployMetrics.Enabled {
+		document.Allow(sid("DeployMetrics"), []string{"cloudwatch:PutMetricData"})
+	}
+
+	if environment.Access == conf.Access_SSM {
+		document.Allow(sid("Sessions"), []string{
+			"ssm:GetCommandInvocation",
+			"ssm:SendCommand",
+			"ssm:StartSession",
+			"ssm:TerminateSession",
+		})
+	}
+
+	if environment.PermissionPreflight != conf.PermissionPreflight_Off {
+		// the preflight simulates the deployer's own policies
+		roleARN, _ := environment.GetRoleARN(region.Name)
+		document.Allow(sid("PermissionPreflight"), []string{"iam:SimulatePrincipalPolicy"}, roleARN)
+	}
+
+	if config.ECR != nil {
+		document.Allow(sid("ECRLogin"), []string{"ecr:GetAuthorizationToken"})
+		document.Allow(sid("ECR"), []string{
+			"ecr:BatchCheckLayerAvailability",
+			"ecr:CompleteLayerUpload",
+			"ecr:CreateRepository",
+			"ecr:DescribeRepositories",
+			"ecr:InitiateLayerUpload",
+			"ecr:PutImage",
+			"ecr:PutLifecyclePolicy",
+			"ecr:UploadLayerPart",
+		}, fmt.Sprintf("arn:aws:ecr:%s:*:repository/%s", region.Name, config.ECR.Repository))
+	}
+
+	if hasRemoteHooks(config) {
+		projectName := "porter-hook-" + config.ServiceName
+
+		document.Allow(sid("RemoteHooks"), []string{
+			"codebuild:BatchGetBuilds",
+			"codebuild:BatchGetProjects",
+			"codebuild:CreateProject",
+			"codebuild:StartBuild",
+		}, fmt.Sprintf("arn:aws:codebuild:%s:*:project/%s", region.Name, projectName))
+
+		document.Allow(sid("RemoteHookLogs"), []string{
+			"logs:FilterLogEvents",
+		}, fmt.Sprintf("arn:aws:logs:%s:*:log-group:/aws/codebuild/%s:*", region.Name, projectName))
+
+		// builds run as the deployer
+		roleARN, _ := environment.GetRoleARN(region.Name)
+		document.Allow(sid("PassRemoteHookRole"), []string{"iam:PassRole"}, roleARN)
+	}
+}
+
+func hasRemoteHooks(config *conf.Config) bool {
+	for _, hooks := range config.Hooks {
+		for _, hook := range hooks {
+			if hook.RunsOn == constants.HRO_Remote {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func stackARN(regionName, stackName string) string {
+	return fmt.Sprintf("arn:aws:cloudformation:%s:*:stack/%s/*", regionName, stackName)
+}
+
+// kmsKeyARN is the key's ARN in any account
+func kmsKeyARN(regionName, keyId string) string {
+	return concreteKMSKeyARN(regionName, "*", keyId)
+}
+
+// sidRegion turns us-west-2 into UsWest2. Sids are alphanumeric
+func sidRegion(regionName string) string {
+	var sid string
+	for _, part := range strings.Split(regionName, "-") {
+		if part != "" {
+			sid += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return sid
+}
+
+func sortedUnique(values []string) []string {
+	set := make(map[string]struct{})
+	for _, value := range values {
+		if value != "" {
+			set[value] = struct{}{}
+		}
+	}
+
+	unique := make([]string, 0, len(set))
+	for value := range set {
+		unique = append(unique, value)
+	}
+	sort.Strings(unique)
+	return unique
+}
@@ -0,0 +1,295 @@
+package iam_policy_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/iam_policy"
+)
+
+const renderedTemplate = `{
+  "Resources": {
+    "ASG": {"Type": "AWS::AutoScaling::AutoScalingGroup"},
+    "Queue": {"Type": "AWS::SQS::Queue"},
+    "Widget": {"Type": "AWS::Widget::Thing"},
+    "InstanceRole": {
+      "Type": "AWS::IAM::Role",
+      "Properties": {
+        "AssumeRolePolicyDocument": {
+          "Statement": [{"Effect": "Allow", "Principal": {"Service": ["ec2.amazonaws.com"]}, "Action": ["sts:AssumeRole"]}]
+        },
+        "ManagedPolicyArns": ["arn:aws:iam::aws:policy/AmazonSSMManagedInstanceCore"],
+        "Policies": [
+          {
+            "PolicyName": "porter",
+            "PolicyDocument": {
+              "Statement": [{"Sid": "1", "Effect": "Allow", "Action": ["s3:GetObject"], "Resource": ["arn:aws:s3:::bucket/*"]}]
+            }
+          }
+        ]
+      }
+    },
+    "TaskRole": {
+      "Type": "AWS::IAM::Role",
+      "Properties": {
+        "AssumeRolePolicyDocument": {
+          "Statement": [{"Effect": "Allow", "Principal": {"Service": ["ecs-tasks.amazonaws.com"]}, "Action": ["sts:AssumeRole"]}]
+        },
+        "Policies": [
+          {
+            "PolicyName": "task",
+            "PolicyDocument": {
+              "Statement": [{"Effect": "Allow", "Action": ["dynamodb:GetItem"], "Resource": "*"}]
+            }
+          }
+        ]
+      }
+    }
+  }
+}`
+
+func statementSids(document iam_policy.Document) []string {
+	var sids []string
+	for _, statement := range document.Statement {
+		sids = append(sids, statement.(iam_policy.Statement).Sid)
+	}
+	return sids
+}
+
+func statement(document iam_policy.Document, sid string) iam_policy.Statement {
+	for _, statementRaw := range document.Statement {
+		if s := statementRaw.(iam_policy.Statement); s.Sid == sid {
+			return s
+		}
+	}
+	Fail("no statement " + sid)
+	return iam_policy.Statement{}
+}
+
+var _ = Describe("IAM policy", func() {
+
+	var (
+		template    iam_policy.Template
+		config      *conf.Config
+		environment *conf.Environment
+	)
+
+	BeforeEach(func() {
+		var err error
+		template, err = iam_policy.ParseTemplate([]byte(renderedTemplate))
+		Expect(err).To(BeNil())
+
+		environment = &conf.Environment{
+			Name:    "stage",
+			RoleARN: "arn:aws:iam::123456789012:role/deployer",
+			Regions: []*conf.Region{
+				{
+					Name:     "us-west-2",
+					S3Bucket: "payloads",
+				},
+			},
+		}
+
+		config = &conf.Config{
+			ServiceName:  "svc",
+			Environments: []*conf.Environment{environment},
+		}
+	})
+
+	It("finds the actions the template's resources need", func() {
+		Expect(template.Actions).To(ContainElement("autoscaling:CreateAutoScalingGroup"))
+		Expect(template.Actions).To(ContainElement("sqs:CreateQueue"))
+		Expect(template.Actions).To(ContainElement("iam:CreateRole"))
+		Expect(template.UnmappedResourceTypes).To(Equal([]string{"AWS::Widget::Thing"}))
+	})
+
+	It("only takes the policies of roles instances assume", func() {
+		Expect(template.InstanceRoleStatements).To(HaveLen(1))
+		Expect(template.ManagedPolicyARNs).To(Equal([]string{"arn:aws:iam::aws:policy/AmazonSSMManagedInstanceCore"}))
+	})
+
+	It("scopes the deployer to the service's stacks and bucket", func() {
+		policies, err := iam_policy.Generate(config, environment, map[string]iam_policy.Template{
+			"us-west-2": template,
+		})
+		Expect(err).To(BeNil())
+
+		Expect(statement(policies.Deployer, "ServiceStacksUsWest2").Resource).To(Equal([]string{
+			"arn:aws:cloudformation:us-west-2:*:stack/svc-stage-*/*",
+		}))
+		Expect(statement(policies.Deployer, "ServicePayloadUsWest2").Resource).To(Equal([]string{
+			"arn:aws:s3:::payloads",
+			"arn:aws:s3:::payloads/*",
+		}))
+		Expect(statement(policies.Deployer, "StackResources").Action).To(Equal(template.Actions))
+
+		Expect(statementSids(policies.Deployer)).NotTo(ContainElement("ECRUsWest2"))
+		Expect(statementSids(policies.Deployer)).NotTo(ContainElement("RemoteHooksUsWest2"))
+		Expect(policies.CloudFormation).To(BeNil())
+		Expect(policies.InstanceRole.Statement).To(HaveLen(1))
+		Expect(policies.UnmappedResourceTypes).To(Equal([]string{"AWS::Widget::Thing"}))
+	})
+
+	It("moves the template's actions to the CloudFormation service role", func() {
+		environment.CFNRoleARN = "arn:aws:iam::123456789012:role/cfn"
+
+		policies, err := iam_policy.Generate(config, environment, map[string]iam_policy.Template{
+			"us-west-2": template,
+		})
+		Expect(err).To(BeNil())
+
+		Expect(statementSids(policies.Deployer)).NotTo(ContainElement("StackResources"))
+		Expect(statement(policies.Deployer, "PassCloudFormationRole").Resource).To(Equal([]string{
+			"arn:aws:iam::123456789012:role/cfn",
+		}))
+		Expect(policies.CloudFormation).NotTo(BeNil())
+		Expect(statement(*policies.CloudFormation, "StackResources").Action).To(Equal(template.Actions))
+	})
+
+	It("adds the calls of configured features", func() {
+		config.ECR = &conf.ECR{Repository: "svc"}
+		config.Hooks = map[string][]conf.Hook{
+			constants.HookPreProvision: {
+				{RunsOn: constants.HRO_Remote, Image: "alpine", Command: "true"},
+			},
+		}
+
+		policies, err := iam_policy.Generate(config, environment, map[string]iam_policy.Template{
+			"us-west-2": template,
+		})
+		Expect(err).To(BeNil())
+
+		Expect(statement(policies.Deployer, "ECRUsWest2").Resource).To(Equal([]string{
+			"arn:aws:ecr:us-west-2:*:repository/svc",
+		}))
+		Expect(statement(policies.Deployer, "RemoteHooksUsWest2").Resource).To(Equal([]string{
+			"arn:aws:codebuild:us-west-2:*:project/porter-hook-svc",
+		}))
+		Expect(statement(policies.Deployer, "PassRemoteHookRoleUsWest2").Resource).To(Equal([]string{
+			"arn:aws:iam::123456789012:role/deployer",
+		}))
+	})
+
+	It("lets the deployer send to the environment's command queues", func() {
+		environment.CommandQueue = true
+
+		policies, err := iam_policy.Generate(config, environment, map[string]iam_policy.Template{
+			"us-west-2": template,
+		})
+		Expect(err).To(BeNil())
+
+		Expect(statement(policies.Deployer, "CommandQueuesUsWest2").Action).To(ContainElement("sqs:SendMessage"))
+		Expect(statement(policies.Deployer, "CommandQueuesUsWest2").Resource).To(Equal([]string{
+			"arn:aws:sqs:us-west-2:*:svc-stage-cmd-*",
+		}))
+		Expect(statementSids(policies.Deployer)).NotTo(ContainElement("StackQueuesUsWest2"))
+	})
+
+	It("lets the deployer create the service's security group stack", func() {
+		environment.Regions[0].Security = &conf.Security{}
+
+		policies, err := iam_policy.Generate(config, environment, map[string]iam_policy.Template{
+			"us-west-2": template,
+		})
+		Expect(err).To(BeNil())
+
+		Expect(statement(policies.Deployer, "SecurityGroupStackUsWest2").Resource).To(Equal([]string{
+			"arn:aws:cloudformation:us-west-2:*:stack/porter-sg-svc-stage/*",
+		}))
+	})
+
+	It("lets the deployer request the tls certificate", func() {
+		environment.Regions[0].TLS = &conf.TLS{
+			DomainName:   "api.example.com",
+			HostedZoneId: "Z1234567890ABC",
+		}
+
+		policies, err := iam_policy.Generate(config, environment, map[string]iam_policy.Template{
+			"us-west-2": template,
+		})
+		Expect(err).To(BeNil())
+
+		Expect(statement(policies.Deployer, "CertificateStackUsWest2").Resource).To(Equal([]string{
+			"arn:aws:cloudformation:us-west-2:*:stack/porter-tls-svc-stage/*",
+		}))
+		Expect(statement(policies.Deployer, "StackResources").Action).To(ContainElement("acm:RequestCertificate"))
+	})
+
+	It("lets the deployer create and promote the ECS load balancer stack", func() {
+		environment.Compute = conf.Compute_ECS
+		environment.Regions[0].Containers = []*conf.Container{
+			{Topology: conf.Topology_Inet},
+		}
+
+		policies, err := iam_policy.Generate(config, environment, map[string]iam_policy.Template{
+			"us-west-2": template,
+		})
+		Expect(err).To(BeNil())
+
+		Expect(statement(policies.Deployer, "ECSLoadBalancerStackUsWest2").Resource).To(Equal([]string{
+			"arn:aws:cloudformation:us-west-2:*:stack/porter-alb-svc-stage/*",
+		}))
+		Expect(statement(policies.Deployer, "StackResources").Action).To(ContainElement("elasticloadbalancing:CreateListener"))
+	})
+
+	It("lets the deployer create the file system stack", func() {
+		environment.Regions[0].EFS = &conf.EFS{}
+
+		policies, err := iam_policy.Generate(config, environment, map[string]iam_policy.Template{
+			"us-west-2": template,
+		})
+		Expect(err).To(BeNil())
+
+		Expect(statement(policies.Deployer, "FileSystemStackUsWest2").Resource).To(Equal([]string{
+			"arn:aws:cloudformation:us-west-2:*:stack/porter-efs-svc-stage/*",
+		}))
+		Expect(statement(policies.Deployer, "StackResources").Action).To(ContainElement("elasticfilesystem:CreateMountTarget"))
+	})
+
+	It("lets the deployer resolve the ami", func() {
+		environment.AMI = &conf.AMI{
+			SSMParameter: "/aws/service/ami-amazon-linux-latest/al2023-ami-kernel-default-x86_64",
+		}
+
+		policies, err := iam_policy.Generate(config, environment, map[string]iam_policy.Template{
+			"us-west-2": template,
+		})
+		Expect(err).To(BeNil())
+
+		Expect(statement(policies.Deployer, "AMIUsWest2").Action).To(Equal([]string{"ec2:DescribeImages"}))
+		Expect(statement(policies.Deployer, "AMIParameterUsWest2").Resource).To(Equal([]string{
+			"arn:aws:ssm:us-west-2:*:parameter/aws/service/ami-amazon-linux-latest/al2023-ami-kernel-default-x86_64",
+		}))
+	})
+
+	It("lets the deployer bake an AMI", func() {
+		environment.Bake = &conf.Bake{}
+
+		policies, err := iam_policy.Generate(config, environment, map[string]iam_policy.Template{
+			"us-west-2": template,
+		})
+		Expect(err).To(BeNil())
+
+		Expect(statement(policies.Deployer, "BakeUsWest2").Action).To(ContainElement("ec2:CreateImage"))
+		Expect(statement(policies.Deployer, "BakeUsWest2").Action).To(ContainElement("ec2:TerminateInstances"))
+	})
+
+	It("lets the deployer drain load balancers", func() {
+		environment.Drain = &conf.Drain{DeregistrationDelay: 60}
+
+		policies, err := iam_policy.Generate(config, environment, map[string]iam_policy.Template{
+			"us-west-2": template,
+		})
+		Expect(err).To(BeNil())
+
+		Expect(statement(policies.Deployer, "DrainUsWest2").Action).To(ContainElement("elasticloadbalancing:DeregisterTargets"))
+		Expect(statement(policies.Deployer, "DrainUsWest2").Action).To(ContainElement("elasticloadbalancing:ModifyLoadBalancerAttributes"))
+	})
+
+	It("needs a template for every region", func() {
+		_, err := iam_policy.Generate(config, environment, map[string]iam_policy.Template{})
+		Expect(err).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,196 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package iam_policy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+const evalDecisionAllowed = "allowed"
+
+type (
+	// Permission is an action on a resource a deploy needs
+	Permission struct {
+		Action   string
+		Resource string
+	}
+
+	// DeniedPermission is a Permission the simulation didn't allow. Decision
+	// is implicitDeny or explicitDeny
+	DeniedPermission struct {
+		Permission
+		Decision string
+	}
+)
+
+// AccountId is the account of an ARN
+func AccountId(arn string) (string, error) {
+	parts := strings.Split(arn, ":")
+	if len(parts) < 6 || parts[4] == "" {
+		return "", fmt.Errorf("%s isn't an ARN with an account", arn)
+	}
+	return parts[4], nil
+}
+
+// RequiredPermissions are the permissions a provision of the service version
+// into the region needs up front. Resources are the ones the deploy is about
+// to touch so policies scoped to them are checked too
+//
+// stackName is the stack about to be created
+func RequiredPermissions(config *conf.Config, environment *conf.Environment, region *conf.Region,
+	stackName, accountId string) (permissions []Permission, err error) {
+
+	add := func(resource string, actions ...string) {
+		for _, action := range actions {
+			permissions = append(permissions, Permission{action, resource})
+		}
+	}
+
+	add(fmt.Sprintf("arn:aws:cloudformation:%s:%s:stack/%s/*", region.Name, accountId, stackName),
+		"cloudformation:CreateStack",
+		"cloudformation:DescribeStackEvents",
+		"cloudformation:DescribeStacks",
+		"cloudformation:UpdateStack")
+
+	if region.S3Bucket != "" && (config.ArtifactStore == nil || config.ArtifactStore.Type == conf.ArtifactStore_S3) {
+		keySuffix := fmt.Sprintf("%s/%s/%s/", config.ServiceName, environment.Name, config.ServiceVersion)
+
+		add("arn:aws:s3:::"+region.S3Bucket, "s3:ListBucket")
+		add("arn:aws:s3:::"+region.S3Bucket+"/porter-deployment/"+keySuffix+"preflight.tar",
+			"s3:GetObject",
+			"s3:PutObject")
+		add("arn:aws:s3:::"+region.S3Bucket+"/porter-template/"+keySuffix+"preflight.json",
+			"s3:PutObject")
+
+		if region.SSEKMSKeyId != nil && *region.SSEKMSKeyId != "" {
+			add(concreteKMSKeyARN(region.Name, accountId, *region.SSEKMSKeyId),
+				"kms:GenerateDataKey")
+		}
+	}
+
+	if region.SecretsKMSKeyId != "" {
+		add(concreteKMSKeyARN(region.Name, accountId, region.SecretsKMSKeyId),
+			"kms:Encrypt",
+			"kms:GenerateDataKey")
+	}
+
+	var cfnRoleARN string
+	cfnRoleARN, err = environment.GetCFNRoleARN(region.Name)
+	if err != nil {
+		return
+	}
+
+	if cfnRoleARN != "" {
+		add(cfnRoleARN, "iam:PassRole")
+	} else {
+		// without a service role the stack's resources are created with the
+		// deployer's credentials. The instance role is named after the stack
+		add(fmt.Sprintf("arn:aws:iam::%s:role/%s-*", accountId, stackName),
+			"iam:CreateRole",
+			"iam:PassRole",
+			"iam:PutRolePolicy")
+		add(fmt.Sprintf("arn:aws:iam::%s:instance-profile/%s-*", accountId, stackName),
+			"iam:AddRoleToInstanceProfile",
+			"iam:CreateInstanceProfile")
+		add("*",
+			"autoscaling:CreateAutoScalingGroup",
+			"ec2:CreateLaunchTemplate",
+			"ec2:CreateSecurityGroup",
+			"ec2:RunInstances")
+	}
+
+	if config.ECR != nil {
+		add(fmt.Sprintf("arn:aws:ecr:%s:%s:repository/%s", region.Name, accountId, config.ECR.Repository),
+			"ecr:InitiateLayerUpload",
+			"ecr:PutImage")
+	}
+
+	if hasRemoteHooks(config) {
+		add(fmt.Sprintf("arn:aws:codebuild:%s:%s:project/porter-hook-%s", region.Name, accountId, config.ServiceName),
+			"codebuild:StartBuild")
+
+		roleARN, _ := environment.GetRoleARN(region.Name)
+		add(roleARN, "iam:PassRole")
+	}
+
+	return
+}
+
+// concreteKMSKeyARN is the key's ARN. An alias resolves to a key policies
+// can't be checked against without looking it up so any key in the account
+// is checked instead
+func concreteKMSKeyARN(regionName, accountId, keyId string) string {
+	switch {
+	case strings.HasPrefix(keyId, "arn:") && !strings.Contains(keyId, ":alias/"):
+		return keyId
+	case strings.HasPrefix(keyId, "alias/") || strings.Contains(keyId, ":alias/"):
+		return fmt.Sprintf("arn:aws:kms:%s:%s:key/*", regionName, accountId)
+	default:
+		return fmt.Sprintf("arn:aws:kms:%s:%s:key/%s", regionName, accountId, keyId)
+	}
+}
+
+// Simulate evaluates the principal's policies for every permission with
+// iam:SimulatePrincipalPolicy and returns the ones that aren't allowed.
+// Resource policies like bucket and key policies aren't evaluated
+func Simulate(client *iam.IAM, principalARN string, permissions []Permission) (denied []DeniedPermission, err error) {
+
+	// one simulation per resource evaluates all of its actions
+	var resources []string
+	actionsByResource := make(map[string][]string)
+	for _, permission := range permissions {
+		if _, exists := actionsByResource[permission.Resource]; !exists {
+			resources = append(resources, permission.Resource)
+		}
+		actionsByResource[permission.Resource] = append(actionsByResource[permission.Resource], permission.Action)
+	}
+
+	for _, resource := range resources {
+		input := &iam.SimulatePrincipalPolicyInput{
+			PolicySourceArn: aws.String(principalARN),
+			ActionNames:     aws.StringSlice(sortedUnique(actionsByResource[resource])),
+			ResourceArns:    []*string{aws.String(resource)},
+		}
+
+		for {
+			var output *iam.SimulatePolicyResponse
+			output, err = client.SimulatePrincipalPolicy(input)
+			if err != nil {
+				return
+			}
+
+			for _, result := range output.EvaluationResults {
+				decision := aws.StringValue(result.EvalDecision)
+				if decision == evalDecisionAllowed {
+					continue
+				}
+
+				denied = append(denied, DeniedPermission{
+					Permission: Permission{aws.StringValue(result.EvalActionName), resource},
+					Decision:   decision,
+				})
+			}
+
+			if !aws.BoolValue(output.IsTruncated) {
+				break
+			}
+			input.Marker = output.Marker
+		}
+	}
+
+	return
+}
@@ -0,0 +1,172 @@
+package iam_policy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/iam_policy"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+var _ = Describe("Permission preflight", func() {
+
+	var (
+		config      *conf.Config
+		environment *conf.Environment
+		region      *conf.Region
+	)
+
+	BeforeEach(func() {
+		region = &conf.Region{
+			Name:            "us-west-2",
+			S3Bucket:        "payloads",
+			SSEKMSKeyId:     aws.String("alias/payloads"),
+			SecretsKMSKeyId: "1234abcd-12ab-34cd-56ef-1234567890ab",
+		}
+
+		environment = &conf.Environment{
+			Name:       "stage",
+			RoleARN:    "arn:aws:iam::123456789012:role/deployer",
+			CFNRoleARN: "arn:aws:iam::123456789012:role/cfn",
+			Regions:    []*conf.Region{region},
+		}
+
+		config = &conf.Config{
+			ServiceName:    "svc",
+			ServiceVersion: "abc123",
+			Environments:   []*conf.Environment{environment},
+		}
+	})
+
+	It("gets the account out of an ARN", func() {
+		accountId, err := iam_policy.AccountId("arn:aws:iam::123456789012:role/deployer")
+		Expect(err).To(BeNil())
+		Expect(accountId).To(Equal("123456789012"))
+
+		_, err = iam_policy.AccountId("deployer")
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("needs the deploy's bucket, keys, stack, and service role", func() {
+		permissions, err := iam_policy.RequiredPermissions(config, environment, region,
+			"svc-stage-me-1", "123456789012")
+		Expect(err).To(BeNil())
+
+		Expect(permissions).To(ContainElement(iam_policy.Permission{
+			Action:   "s3:PutObject",
+			Resource: "arn:aws:s3:::payloads/porter-deployment/svc/stage/abc123/preflight.tar",
+		}))
+		Expect(permissions).To(ContainElement(iam_policy.Permission{
+			Action:   "cloudformation:CreateStack",
+			Resource: "arn:aws:cloudformation:us-west-2:123456789012:stack/svc-stage-me-1/*",
+		}))
+		Expect(permissions).To(ContainElement(iam_policy.Permission{
+			Action:   "iam:PassRole",
+			Resource: "arn:aws:iam::123456789012:role/cfn",
+		}))
+		Expect(permissions).To(ContainElement(iam_policy.Permission{
+			Action:   "kms:GenerateDataKey",
+			Resource: "arn:aws:kms:us-west-2:123456789012:key/*",
+		}))
+		Expect(permissions).To(ContainElement(iam_policy.Permission{
+			Action:   "kms:Encrypt",
+			Resource: "arn:aws:kms:us-west-2:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab",
+		}))
+		Expect(permissions).NotTo(ContainElement(iam_policy.Permission{
+			Action:   "iam:CreateRole",
+			Resource: "arn:aws:iam::123456789012:role/svc-stage-me-1-*",
+		}))
+	})
+
+	It("needs to create the stack's resources without a service role", func() {
+		environment.CFNRoleARN = ""
+
+		permissions, err := iam_policy.RequiredPermissions(config, environment, region,
+			"svc-stage-me-1", "123456789012")
+		Expect(err).To(BeNil())
+
+		Expect(permissions).To(ContainElement(iam_policy.Permission{
+			Action:   "iam:PassRole",
+			Resource: "arn:aws:iam::123456789012:role/svc-stage-me-1-*",
+		}))
+		Expect(permissions).To(ContainElement(iam_policy.Permission{
+			Action:   "ec2:RunInstances",
+			Resource: "*",
+		}))
+	})
+
+	Describe("Simulate", func() {
+
+		var (
+			server *httptest.Server
+			forms  []url.Values
+		)
+
+		BeforeEach(func() {
+			forms = nil
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.ParseForm()).To(Succeed())
+				forms = append(forms, r.PostForm)
+
+				if r.PostForm.Get("ResourceArns.member.1") == "arn:aws:s3:::payloads" {
+					w.Write([]byte(`<SimulatePrincipalPolicyResponse><SimulatePrincipalPolicyResult>
+						<EvaluationResults>
+							<member><EvalActionName>s3:ListBucket</EvalActionName><EvalDecision>allowed</EvalDecision></member>
+						</EvaluationResults>
+						<IsTruncated>false</IsTruncated>
+					</SimulatePrincipalPolicyResult></SimulatePrincipalPolicyResponse>`))
+					return
+				}
+
+				w.Write([]byte(`<SimulatePrincipalPolicyResponse><SimulatePrincipalPolicyResult>
+					<EvaluationResults>
+						<member><EvalActionName>iam:PassRole</EvalActionName><EvalDecision>implicitDeny</EvalDecision></member>
+					</EvaluationResults>
+					<IsTruncated>false</IsTruncated>
+				</SimulatePrincipalPolicyResult></SimulatePrincipalPolicyResponse>`))
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("returns what isn't allowed", func() {
+			client := iam.New(session.New(&aws.Config{
+				Region:      aws.String("us-east-1"),
+				Endpoint:    aws.String(server.URL),
+				Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+				MaxRetries:  aws.Int(0),
+			}))
+
+			denied, err := iam_policy.Simulate(client, "arn:aws:iam::123456789012:role/deployer", []iam_policy.Permission{
+				{Action: "s3:ListBucket", Resource: "arn:aws:s3:::payloads"},
+				{Action: "iam:PassRole", Resource: "arn:aws:iam::123456789012:role/cfn"},
+			})
+			Expect(err).To(BeNil())
+
+			Expect(forms).To(HaveLen(2))
+			Expect(forms[0].Get("Action")).To(Equal("SimulatePrincipalPolicy"))
+			Expect(forms[0].Get("PolicySourceArn")).To(Equal("arn:aws:iam::123456789012:role/deployer"))
+			Expect(forms[0].Get("ActionNames.member.1")).To(Equal("s3:ListBucket"))
+
+			Expect(denied).To(Equal([]iam_policy.DeniedPermission{
+				{
+					Permission: iam_policy.Permission{
+						Action:   "iam:PassRole",
+						Resource: "arn:aws:iam::123456789012:role/cfn",
+					},
+					Decision: "implicitDeny",
+				},
+			}))
+		})
+	})
+})
@@ -0,0 +1,378 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package iam_policy
+
+import "github.com/adobe-platform/porter/cfn"
+
+// resourceActions are the actions CloudFormation calls with the caller's
+// credentials, or the stack's service role, to create, update, and delete a
+// resource of each type. A type with no actions needs none. A type that's
+// missing is reported so its actions can be added by hand
+var resourceActions = map[string][]string{
+	cfn.AutoScaling_AutoScalingGroup: {
+		"autoscaling:CreateAutoScalingGroup",
+		"autoscaling:CreateOrUpdateTags",
+		"autoscaling:DeleteAutoScalingGroup",
+		"autoscaling:DeleteTags",
+		"autoscaling:DescribeAutoScalingGroups",
+		"autoscaling:DescribeScalingActivities",
+		"autoscaling:ResumeProcesses",
+		"autoscaling:SuspendProcesses",
+		"autoscaling:UpdateAutoScalingGroup",
+		"ec2:CreateTags",
+		"ec2:RunInstances",
+		"iam:PassRole",
+	},
+	cfn.AutoScaling_LaunchConfiguration: {
+		"autoscaling:CreateLaunchConfiguration",
+		"autoscaling:DeleteLaunchConfiguration",
+		"autoscaling:DescribeLaunchConfigurations",
+		"ec2:DescribeImages",
+		"ec2:DescribeSecurityGroups",
+		"iam:PassRole",
+	},
+	cfn.AutoScaling_LifecycleHook: {
+		"autoscaling:DeleteLifecycleHook",
+		"autoscaling:DescribeLifecycleHooks",
+		"autoscaling:PutLifecycleHook",
+		"iam:PassRole",
+	},
+	cfn.AutoScaling_ScalingPolicy: {
+		"autoscaling:DeletePolicy",
+		"autoscaling:DescribePolicies",
+		"autoscaling:PutScalingPolicy",
+	},
+	cfn.AutoScaling_ScheduledAction: {
+		"autoscaling:DeleteScheduledAction",
+		"autoscaling:DescribeScheduledActions",
+		"autoscaling:PutScheduledUpdateGroupAction",
+	},
+	cfn.CertificateManager_Certificate: {
+		"acm:AddTagsToCertificate",
+		"acm:DeleteCertificate",
+		"acm:DescribeCertificate",
+		"acm:RequestCertificate",
+		"route53:ChangeResourceRecordSets",
+		"route53:GetChange",
+		"route53:ListResourceRecordSets",
+	},
+	cfn.CloudFormation_WaitCondition:       {},
+	cfn.CloudFormation_WaitConditionHandle: {},
+	cfn.CloudWatch_Alarm: {
+		"cloudwatch:DeleteAlarms",
+		"cloudwatch:DescribeAlarms",
+		"cloudwatch:PutMetricAlarm",
+	},
+	cfn.CloudWatch_Dashboard: {
+		"cloudwatch:DeleteDashboards",
+		"cloudwatch:GetDashboard",
+		"cloudwatch:PutDashboard",
+	},
+	cfn.DynamoDB_Table: {
+		"dynamodb:CreateTable",
+		"dynamodb:DeleteTable",
+		"dynamodb:DescribeTable",
+		"dynamodb:DescribeTimeToLive",
+		"dynamodb:TagResource",
+		"dynamodb:UpdateTable",
+		"dynamodb:UpdateTimeToLive",
+	},
+	cfn.EC2_Instance: {
+		"ec2:CreateTags",
+		"ec2:DescribeInstances",
+		"ec2:ModifyInstanceAttribute",
+		"ec2:RunInstances",
+		"ec2:TerminateInstances",
+		"iam:PassRole",
+	},
+	cfn.EC2_LaunchTemplate: {
+		"ec2:CreateLaunchTemplate",
+		"ec2:CreateLaunchTemplateVersion",
+		"ec2:DeleteLaunchTemplate",
+		"ec2:DescribeLaunchTemplateVersions",
+		"ec2:DescribeLaunchTemplates",
+		"ec2:ModifyLaunchTemplate",
+		"iam:PassRole",
+	},
+	cfn.EC2_SecurityGroup: {
+		"ec2:AuthorizeSecurityGroupEgress",
+		"ec2:AuthorizeSecurityGroupIngress",
+		"ec2:CreateSecurityGroup",
+		"ec2:CreateTags",
+		"ec2:DeleteSecurityGroup",
+		"ec2:DescribeSecurityGroups",
+		"ec2:RevokeSecurityGroupEgress",
+		"ec2:RevokeSecurityGroupIngress",
+	},
+	cfn.EC2_SecurityGroupEgress: {
+		"ec2:AuthorizeSecurityGroupEgress",
+		"ec2:DescribeSecurityGroups",
+		"ec2:RevokeSecurityGroupEgress",
+	},
+	cfn.EC2_SecurityGroupIngress: {
+		"ec2:AuthorizeSecurityGroupIngress",
+		"ec2:DescribeSecurityGroups",
+		"ec2:RevokeSecurityGroupIngress",
+	},
+	cfn.EC2_Volume: {
+		"ec2:CreateTags",
+		"ec2:CreateVolume",
+		"ec2:DeleteVolume",
+		"ec2:DescribeVolumes",
+		"ec2:ModifyVolume",
+	},
+	cfn.EC2_VolumeAttachment: {
+		"ec2:AttachVolume",
+		"ec2:DescribeVolumes",
+		"ec2:DetachVolume",
+	},
+	cfn.ECS_Cluster: {
+		"ecs:CreateCluster",
+		"ecs:DeleteCluster",
+		"ecs:DescribeClusters",
+		"ecs:TagResource",
+	},
+	cfn.ECS_Service: {
+		"ecs:CreateService",
+		"ecs:DeleteService",
+		"ecs:DescribeServices",
+		"ecs:UpdateService",
+		"iam:PassRole",
+	},
+	cfn.ECS_TaskDefinition: {
+		"ecs:DeregisterTaskDefinition",
+		"ecs:DescribeTaskDefinition",
+		"ecs:RegisterTaskDefinition",
+		"iam:PassRole",
+	},
+	cfn.EFS_FileSystem: {
+		"elasticfilesystem:CreateFileSystem",
+		"elasticfilesystem:DeleteFileSystem",
+		"elasticfilesystem:DescribeFileSystems",
+		"elasticfilesystem:TagResource",
+		"elasticfilesystem:UpdateFileSystem",
+	},
+	cfn.EFS_MountTarget: {
+		"ec2:CreateNetworkInterface",
+		"ec2:DeleteNetworkInterface",
+		"ec2:DescribeNetworkInterfaces",
+		"elasticfilesystem:CreateMountTarget",
+		"elasticfilesystem:DeleteMountTarget",
+		"elasticfilesystem:DescribeMountTargets",
+	},
+	cfn.ElasticLoadBalancing_LoadBalancer: {
+		"elasticloadbalancing:AddTags",
+		"elasticloadbalancing:ApplySecurityGroupsToLoadBalancer",
+		"elasticloadbalancing:AttachLoadBalancerToSubnets",
+		"elasticloadbalancing:ConfigureHealthCheck",
+		"elasticloadbalancing:CreateLoadBalancer",
+		"elasticloadbalancing:CreateLoadBalancerListeners",
+		"elasticloadbalancing:CreateLoadBalancerPolicy",
+		"elasticloadbalancing:DeleteLoadBalancer",
+		"elasticloadbalancing:DeleteLoadBalancerListeners",
+		"elasticloadbalancing:DescribeLoadBalancerAttributes",
+		"elasticloadbalancing:DescribeLoadBalancers",
+		"elasticloadbalancing:DetachLoadBalancerFromSubnets",
+		"elasticloadbalancing:ModifyLoadBalancerAttributes",
+		"elasticloadbalancing:RemoveTags",
+		"elasticloadbalancing:SetLoadBalancerPoliciesOfListener",
+	},
+	cfn.ElasticLoadBalancingV2_Listener: {
+		"elasticloadbalancing:CreateListener",
+		"elasticloadbalancing:DeleteListener",
+		"elasticloadbalancing:DescribeListeners",
+		"elasticloadbalancing:ModifyListener",
+	},
+	cfn.ElasticLoadBalancingV2_ListenerRule: {
+		"elasticloadbalancing:CreateRule",
+		"elasticloadbalancing:DeleteRule",
+		"elasticloadbalancing:DescribeRules",
+		"elasticloadbalancing:ModifyRule",
+	},
+	cfn.ElasticLoadBalancingV2_LoadBalancer: {
+		"elasticloadbalancing:AddTags",
+		"elasticloadbalancing:CreateLoadBalancer",
+		"elasticloadbalancing:DeleteLoadBalancer",
+		"elasticloadbalancing:DescribeLoadBalancerAttributes",
+		"elasticloadbalancing:DescribeLoadBalancers",
+		"elasticloadbalancing:ModifyLoadBalancerAttributes",
+		"elasticloadbalancing:RemoveTags",
+		"elasticloadbalancing:SetSecurityGroups",
+		"elasticloadbalancing:SetSubnets",
+	},
+	cfn.ElasticLoadBalancingV2_TargetGroup: {
+		"elasticloadbalancing:AddTags",
+		"elasticloadbalancing:CreateTargetGroup",
+		"elasticloadbalancing:DeleteTargetGroup",
+		"elasticloadbalancing:DescribeTargetGroupAttributes",
+		"elasticloadbalancing:DescribeTargetGroups",
+		"elasticloadbalancing:ModifyTargetGroup",
+		"elasticloadbalancing:ModifyTargetGroupAttributes",
+		"elasticloadbalancing:RemoveTags",
+	},
+	cfn.IAM_InstanceProfile: {
+		"iam:AddRoleToInstanceProfile",
+		"iam:CreateInstanceProfile",
+		"iam:DeleteInstanceProfile",
+		"iam:GetInstanceProfile",
+		"iam:PassRole",
+		"iam:RemoveRoleFromInstanceProfile",
+	},
+	cfn.IAM_ManagedPolicy: {
+		"iam:AttachRolePolicy",
+		"iam:CreatePolicy",
+		"iam:CreatePolicyVersion",
+		"iam:DeletePolicy",
+		"iam:DeletePolicyVersion",
+		"iam:DetachRolePolicy",
+		"iam:GetPolicy",
+		"iam:ListPolicyVersions",
+	},
+	cfn.IAM_Policy: {
+		"iam:DeleteRolePolicy",
+		"iam:GetRolePolicy",
+		"iam:PutRolePolicy",
+	},
+	cfn.IAM_Role: {
+		"iam:AttachRolePolicy",
+		"iam:CreateRole",
+		"iam:DeleteRole",
+		"iam:DeleteRolePolicy",
+		"iam:DetachRolePolicy",
+		"iam:GetRole",
+		"iam:GetRolePolicy",
+		"iam:PutRolePolicy",
+		"iam:TagRole",
+		"iam:UpdateAssumeRolePolicy",
+	},
+	cfn.KMS_Key: {
+		"kms:CreateKey",
+		"kms:DescribeKey",
+		"kms:EnableKeyRotation",
+		"kms:PutKeyPolicy",
+		"kms:ScheduleKeyDeletion",
+		"kms:TagResource",
+	},
+	cfn.Lambda_Function: {
+		"iam:PassRole",
+		"lambda:CreateFunction",
+		"lambda:DeleteFunction",
+		"lambda:GetFunction",
+		"lambda:GetFunctionConfiguration",
+		"lambda:UpdateFunctionCode",
+		"lambda:UpdateFunctionConfiguration",
+	},
+	cfn.Lambda_Permission: {
+		"lambda:AddPermission",
+		"lambda:RemovePermission",
+	},
+	cfn.Logs_LogGroup: {
+		"logs:CreateLogGroup",
+		"logs:DeleteLogGroup",
+		"logs:DeleteRetentionPolicy",
+		"logs:DescribeLogGroups",
+		"logs:PutRetentionPolicy",
+	},
+	cfn.Logs_MetricFilter: {
+		"logs:DeleteMetricFilter",
+		"logs:DescribeMetricFilters",
+		"logs:PutMetricFilter",
+	},
+	cfn.Route53_HealthCheck: {
+		"route53:ChangeTagsForResource",
+		"route53:CreateHealthCheck",
+		"route53:DeleteHealthCheck",
+		"route53:GetHealthCheck",
+		"route53:UpdateHealthCheck",
+	},
+	cfn.Route53_RecordSet: {
+		"route53:ChangeResourceRecordSets",
+		"route53:GetChange",
+		"route53:GetHostedZone",
+		"route53:ListHostedZones",
+		"route53:ListResourceRecordSets",
+	},
+	cfn.Route53_RecordSetGroup: {
+		"route53:ChangeResourceRecordSets",
+		"route53:GetChange",
+		"route53:GetHostedZone",
+		"route53:ListHostedZones",
+		"route53:ListResourceRecordSets",
+	},
+	cfn.S3_Bucket: {
+		"s3:CreateBucket",
+		"s3:DeleteBucket",
+		"s3:GetBucketLocation",
+		"s3:PutBucketTagging",
+		"s3:PutBucketVersioning",
+		"s3:PutEncryptionConfiguration",
+		"s3:PutLifecycleConfiguration",
+	},
+	cfn.S3_BucketPolicy: {
+		"s3:DeleteBucketPolicy",
+		"s3:GetBucketPolicy",
+		"s3:PutBucketPolicy",
+	},
+	cfn.SecretsManager_Secret: {
+		"secretsmanager:CreateSecret",
+		"secretsmanager:DeleteSecret",
+		"secretsmanager:DescribeSecret",
+		"secretsmanager:PutSecretValue",
+		"secretsmanager:TagResource",
+		"secretsmanager:UpdateSecret",
+	},
+	cfn.SNS_Topic: {
+		"sns:CreateTopic",
+		"sns:DeleteTopic",
+		"sns:GetTopicAttributes",
+		"sns:ListSubscriptionsByTopic",
+		"sns:SetTopicAttributes",
+		"sns:Subscribe",
+		"sns:Unsubscribe",
+	},
+	cfn.SNS_TopicPolicy: {
+		"sns:GetTopicAttributes",
+		"sns:SetTopicAttributes",
+	},
+	cfn.SQS_Queue: {
+		"sqs:CreateQueue",
+		"sqs:DeleteQueue",
+		"sqs:GetQueueAttributes",
+		"sqs:GetQueueUrl",
+		"sqs:SetQueueAttributes",
+	},
+	cfn.SQS_QueuePolicy: {
+		"sqs:GetQueueAttributes",
+		"sqs:SetQueueAttributes",
+	},
+	cfn.SSM_Parameter: {
+		"ssm:AddTagsToResource",
+		"ssm:DeleteParameter",
+		"ssm:GetParameters",
+		"ssm:PutParameter",
+	},
+	cfn.WAFv2_WebACL: {
+		"wafv2:CreateWebACL",
+		"wafv2:DeleteWebACL",
+		"wafv2:GetWebACL",
+		"wafv2:ListTagsForResource",
+		"wafv2:TagResource",
+		"wafv2:UntagResource",
+		"wafv2:UpdateWebACL",
+	},
+	cfn.WAFv2_WebACLAssociation: {
+		"elasticloadbalancing:SetWebAcl",
+		"wafv2:AssociateWebACL",
+		"wafv2:DisassociateWebACL",
+		"wafv2:GetWebACLForResource",
+	},
+}
@@ -0,0 +1,286 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package instance_dns
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adobe-platform/porter/aws/cloudwatch"
+	"github.com/adobe-platform/porter/aws/route53"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// When dns targets instances every instance of the promoted stack has a record
+// in the multivalue record set of dns name. Records aren't part of a stack
+// because the autoscaling group launches and terminates instances after
+// promote. porterd registers its own instance while its stack is the one
+// promoted and promote registers the instances running when it promotes.
+//
+// Each record is health checked through a CloudWatch alarm on the health
+// porterd publishes from the instance so the service doesn't have to be
+// reachable by Route53's health checkers
+
+const recordTTL = 60
+
+// Instance is a record in the record set
+type Instance struct {
+	Region    string
+	Id        string
+	PrivateIp string
+}
+
+// ParameterName is the SSM parameter the DNS stack writes the promoted stack's
+// id to in each region
+func ParameterName(serviceName, environment string) string {
+	return fmt.Sprintf("/porter/%s/%s/promoted-stack", serviceName, environment)
+}
+
+// AlarmName is the alarm the instance's health check follows
+func AlarmName(instanceId string) string {
+	return "porter-dns-" + instanceId
+}
+
+// InstanceId is the instance a record points at
+func InstanceId(record route53.ResourceRecordSet) string {
+	return record.SetIdentifier[strings.Index(record.SetIdentifier, "/")+1:]
+}
+
+// every region adds records to the same record set
+func setIdentifier(region, instanceId string) string {
+	return region + "/" + instanceId
+}
+
+func fqdn(name string) string {
+	return strings.TrimRight(name, ".") + "."
+}
+
+// HostedZoneId is the id of a hosted zone without the /hostedzone/ prefix
+func HostedZoneId(client *route53.Route53, hostedZoneName string) (string, error) {
+	hostedZoneName = fqdn(hostedZoneName)
+
+	output, err := client.ListHostedZonesByName(&route53.ListHostedZonesByNameInput{
+		DNSName:  aws.String(hostedZoneName),
+		MaxItems: aws.String("1"),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(output.HostedZones) == 0 || !strings.EqualFold(output.HostedZones[0].Name, hostedZoneName) {
+		return "", fmt.Errorf("hosted zone %s doesn't exist", hostedZoneName)
+	}
+
+	return strings.TrimPrefix(output.HostedZones[0].Id, "/hostedzone/"), nil
+}
+
+// RegionRecords are the region's records in the record set of name
+func RegionRecords(client *route53.Route53, hostedZoneId, name, region string) ([]route53.ResourceRecordSet, error) {
+	name = fqdn(name)
+	records := make([]route53.ResourceRecordSet, 0)
+
+	input := &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    hostedZoneId,
+		StartRecordName: aws.String(name),
+		StartRecordType: aws.String("A"),
+	}
+
+	for {
+		output, err := client.ListResourceRecordSets(input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range output.ResourceRecordSets {
+			// records are sorted by name and type
+			if !strings.EqualFold(record.Name, name) || record.Type != "A" {
+				return records, nil
+			}
+
+			if strings.HasPrefix(record.SetIdentifier, region+"/") {
+				records = append(records, record)
+			}
+		}
+
+		if !output.IsTruncated {
+			return records, nil
+		}
+
+		input.StartRecordName = aws.String(output.NextRecordName)
+		input.StartRecordType = aws.String(output.NextRecordType)
+		input.StartRecordIdentifier = aws.String(output.NextRecordIdentifier)
+	}
+}
+
+// Register upserts the instance's record with a new health check. It does
+// nothing if the instance already has a health checked record of its IP
+func Register(cwClient *cloudwatch.CloudWatch, r53Client *route53.Route53,
+	hostedZoneId, name string, instance Instance) error {
+
+	existing, err := findRecord(r53Client, hostedZoneId, name, instance)
+	if err != nil {
+		return err
+	}
+
+	if existing != nil && existing.HealthCheckId != "" &&
+		len(existing.ResourceRecords) == 1 && existing.ResourceRecords[0].Value == instance.PrivateIp {
+		return nil
+	}
+
+	_, err = cwClient.PutMetricAlarm(&cloudwatch.PutMetricAlarmInput{
+		AlarmName:        AlarmName(instance.Id),
+		AlarmDescription: "porter health of " + instance.Id + " in " + name,
+		Namespace:        constants.HostMetricsNamespace,
+		MetricName:       constants.InstanceHealthyMetric,
+		Dimensions: []cloudwatch.Dimension{
+			{Name: "InstanceId", Value: instance.Id},
+		},
+		Statistic:          "Minimum",
+		Period:             int(constants.DNSRegistrationInterval.Seconds()),
+		EvaluationPeriods:  constants.HC_UnhealthyThreshold,
+		Threshold:          1,
+		ComparisonOperator: "LessThanThreshold",
+
+		// an instance that stopped publishing is gone or porterd is down
+		TreatMissingData: "breaching",
+	})
+	if err != nil {
+		return err
+	}
+
+	healthCheck, err := r53Client.CreateHealthCheck(&route53.CreateHealthCheckInput{
+		// the reference of a deleted health check can't be used again
+		CallerReference: fmt.Sprintf("%s-%d", instance.Id, time.Now().UnixNano()),
+		HealthCheckConfig: route53.HealthCheckConfig{
+			Type: route53.HealthCheckTypeCloudWatchMetric,
+			AlarmIdentifier: &route53.AlarmIdentifier{
+				Region: instance.Region,
+				Name:   AlarmName(instance.Id),
+			},
+			InsufficientDataHealthStatus: route53.InsufficientDataUnhealthy,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	healthCheckId := healthCheck.HealthCheck.Id
+
+	err = changeRecord(r53Client, hostedZoneId, route53.ChangeActionUpsert, route53.ResourceRecordSet{
+		Name:             fqdn(name),
+		Type:             "A",
+		SetIdentifier:    setIdentifier(instance.Region, instance.Id),
+		MultiValueAnswer: true,
+		TTL:              recordTTL,
+		ResourceRecords:  []route53.ResourceRecord{{Value: instance.PrivateIp}},
+		HealthCheckId:    healthCheckId,
+	})
+	if err != nil {
+		deleteHealthCheck(r53Client, healthCheckId)
+		return err
+	}
+
+	if existing != nil && existing.HealthCheckId != "" {
+		return deleteHealthCheck(r53Client, existing.HealthCheckId)
+	}
+	return nil
+}
+
+// Deregister deletes a record, its health check, and the alarm the health
+// check follows
+func Deregister(cwClient *cloudwatch.CloudWatch, r53Client *route53.Route53,
+	hostedZoneId string, record route53.ResourceRecordSet) error {
+
+	err := changeRecord(r53Client, hostedZoneId, route53.ChangeActionDelete, record)
+	if err != nil {
+		return err
+	}
+
+	if record.HealthCheckId != "" {
+		err = deleteHealthCheck(r53Client, record.HealthCheckId)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = cwClient.DeleteAlarms(&cloudwatch.DeleteAlarmsInput{
+		AlarmNames: []string{AlarmName(InstanceId(record))},
+	})
+	return err
+}
+
+// DeregisterInstance deregisters the instance's record if it has one
+func DeregisterInstance(cwClient *cloudwatch.CloudWatch, r53Client *route53.Route53,
+	hostedZoneId, name string, instance Instance) error {
+
+	record, err := findRecord(r53Client, hostedZoneId, name, instance)
+	if err != nil || record == nil {
+		return err
+	}
+
+	return Deregister(cwClient, r53Client, hostedZoneId, *record)
+}
+
+func findRecord(client *route53.Route53, hostedZoneId, name string,
+	instance Instance) (*route53.ResourceRecordSet, error) {
+
+	identifier := setIdentifier(instance.Region, instance.Id)
+
+	output, err := client.ListResourceRecordSets(&route53.ListResourceRecordSetsInput{
+		HostedZoneId:          hostedZoneId,
+		StartRecordName:       aws.String(fqdn(name)),
+		StartRecordType:       aws.String("A"),
+		StartRecordIdentifier: aws.String(identifier),
+		MaxItems:              aws.String("1"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range output.ResourceRecordSets {
+		if strings.EqualFold(record.Name, fqdn(name)) && record.Type == "A" && record.SetIdentifier == identifier {
+			return &record, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func changeRecord(client *route53.Route53, hostedZoneId, action string, record route53.ResourceRecordSet) error {
+	_, err := client.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: hostedZoneId,
+		ChangeBatch: route53.ChangeBatch{
+			Comment: "porter instance record",
+			Changes: []route53.Change{
+				{Action: action, ResourceRecordSet: record},
+			},
+		},
+	})
+	return err
+}
+
+func deleteHealthCheck(client *route53.Route53, healthCheckId string) error {
+	if healthCheckId == "" {
+		return errors.New("no health check id")
+	}
+
+	_, err := client.DeleteHealthCheck(&route53.DeleteHealthCheckInput{
+		HealthCheckId: healthCheckId,
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == route53.ErrCodeNoSuchHealthCheck {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,154 @@
+package instance_dns_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/aws/cloudwatch"
+	"github.com/adobe-platform/porter/aws/route53"
+	"github.com/adobe-platform/porter/instance_dns"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+var _ = Describe("instance_dns", func() {
+
+	const existingRecord = `<ListResourceRecordSetsResponse><ResourceRecordSets>
+<ResourceRecordSet><Name>svc.example.com.</Name><Type>A</Type><SetIdentifier>us-west-2/i-1</SetIdentifier><MultiValueAnswer>true</MultiValueAnswer><TTL>60</TTL><ResourceRecords><ResourceRecord><Value>10.0.0.1</Value></ResourceRecord></ResourceRecords><HealthCheckId>hc-old</HealthCheckId></ResourceRecordSet>
+</ResourceRecordSets><IsTruncated>false</IsTruncated></ListResourceRecordSetsResponse>`
+
+	var (
+		server     *httptest.Server
+		recordSets string
+		calls      []string
+		bodies     []string
+		cwClient   *cloudwatch.CloudWatch
+		r53Client  *route53.Route53
+		instance   instance_dns.Instance
+	)
+
+	BeforeEach(func() {
+		calls = nil
+		bodies = nil
+		recordSets = `<ListResourceRecordSetsResponse><ResourceRecordSets></ResourceRecordSets><IsTruncated>false</IsTruncated></ListResourceRecordSetsResponse>`
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			Expect(err).To(BeNil())
+
+			switch {
+			case r.URL.Path == "/":
+				values, err := url.ParseQuery(string(body))
+				Expect(err).To(BeNil())
+				calls = append(calls, values.Get("Action"))
+				w.Write([]byte(`<Response></Response>`))
+			case r.Method == "GET" && r.URL.Path == "/2013-04-01/hostedzone/Z123/rrset":
+				calls = append(calls, "ListResourceRecordSets")
+				w.Write([]byte(recordSets))
+			case r.Method == "POST" && r.URL.Path == "/2013-04-01/healthcheck":
+				calls = append(calls, "CreateHealthCheck")
+				w.Write([]byte(`<CreateHealthCheckResponse><HealthCheck><Id>hc-new</Id></HealthCheck></CreateHealthCheckResponse>`))
+			case r.Method == "POST" && r.URL.Path == "/2013-04-01/hostedzone/Z123/rrset":
+				calls = append(calls, "ChangeResourceRecordSets")
+				w.Write([]byte(`<ChangeResourceRecordSetsResponse><ChangeInfo><Id>c</Id></ChangeInfo></ChangeResourceRecordSetsResponse>`))
+			case r.Method == "DELETE":
+				calls = append(calls, "DeleteHealthCheck "+r.URL.Path)
+				w.Write([]byte(`<DeleteHealthCheckResponse></DeleteHealthCheckResponse>`))
+			default:
+				Fail("unexpected request " + r.Method + " " + r.URL.Path)
+			}
+			bodies = append(bodies, string(body))
+		}))
+
+		sess := session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		})
+		cwClient = cloudwatch.New(sess)
+		r53Client = route53.New(sess)
+
+		instance = instance_dns.Instance{
+			Region:    "us-west-2",
+			Id:        "i-1",
+			PrivateIp: "10.0.0.1",
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("registers an instance with a health check on its alarm", func() {
+		Expect(instance_dns.Register(cwClient, r53Client, "Z123", "svc.example.com", instance)).To(Succeed())
+
+		Expect(calls).To(Equal([]string{
+			"ListResourceRecordSets",
+			"PutMetricAlarm",
+			"CreateHealthCheck",
+			"ChangeResourceRecordSets",
+		}))
+		Expect(bodies[1]).To(ContainSubstring("AlarmName=porter-dns-i-1"))
+		Expect(bodies[2]).To(ContainSubstring("<Name>porter-dns-i-1</Name>"))
+		Expect(bodies[3]).To(ContainSubstring("<SetIdentifier>us-west-2/i-1</SetIdentifier>"))
+		Expect(bodies[3]).To(ContainSubstring("<Value>10.0.0.1</Value>"))
+		Expect(bodies[3]).To(ContainSubstring("<HealthCheckId>hc-new</HealthCheckId>"))
+	})
+
+	It("leaves a health checked record of the same IP alone", func() {
+		recordSets = existingRecord
+
+		Expect(instance_dns.Register(cwClient, r53Client, "Z123", "svc.example.com", instance)).To(Succeed())
+
+		Expect(calls).To(Equal([]string{"ListResourceRecordSets"}))
+	})
+
+	It("replaces the health check of a record with another IP", func() {
+		recordSets = existingRecord
+		instance.PrivateIp = "10.0.0.2"
+
+		Expect(instance_dns.Register(cwClient, r53Client, "Z123", "svc.example.com", instance)).To(Succeed())
+
+		Expect(calls).To(Equal([]string{
+			"ListResourceRecordSets",
+			"PutMetricAlarm",
+			"CreateHealthCheck",
+			"ChangeResourceRecordSets",
+			"DeleteHealthCheck /2013-04-01/healthcheck/hc-old",
+		}))
+	})
+
+	It("deregisters the record, its health check, and its alarm", func() {
+		recordSets = existingRecord
+
+		Expect(instance_dns.DeregisterInstance(cwClient, r53Client, "Z123", "svc.example.com", instance)).To(Succeed())
+
+		Expect(calls).To(Equal([]string{
+			"ListResourceRecordSets",
+			"ChangeResourceRecordSets",
+			"DeleteHealthCheck /2013-04-01/healthcheck/hc-old",
+			"DeleteAlarms",
+		}))
+		Expect(bodies[1]).To(ContainSubstring("<Action>DELETE</Action>"))
+	})
+
+	It("lists only the region's records", func() {
+		recordSets = `<ListResourceRecordSetsResponse><ResourceRecordSets>
+<ResourceRecordSet><Name>svc.example.com.</Name><Type>A</Type><SetIdentifier>us-east-1/i-2</SetIdentifier></ResourceRecordSet>
+<ResourceRecordSet><Name>svc.example.com.</Name><Type>A</Type><SetIdentifier>us-west-2/i-1</SetIdentifier></ResourceRecordSet>
+<ResourceRecordSet><Name>svc.example.com.</Name><Type>AAAA</Type><SetIdentifier>us-west-2/i-1</SetIdentifier></ResourceRecordSet>
+</ResourceRecordSets><IsTruncated>false</IsTruncated></ListResourceRecordSetsResponse>`
+
+		records, err := instance_dns.RegionRecords(r53Client, "Z123", "svc.example.com", "us-west-2")
+		Expect(err).To(BeNil())
+		Expect(records).To(HaveLen(1))
+		Expect(instance_dns.InstanceId(records[0])).To(Equal("i-1"))
+	})
+})
@@ -0,0 +1,113 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package log_router
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/adobe-platform/porter/conf"
+)
+
+// The files the router reads from its config directory and the socket the
+// docker fluentd log driver writes to on EC2 hosts
+const (
+	ConfigFile  = "fluent-bit.conf"
+	ParsersFile = "parsers.conf"
+	SocketFile  = "fluent.sock"
+)
+
+// Parsers renders a [PARSER] section for each of the router's parsers
+func Parsers(router *conf.LogRouter) string {
+	var buf bytes.Buffer
+
+	for _, parser := range router.Parsers {
+		buf.WriteString("[PARSER]\n")
+		writeKey(&buf, "Name", parser.Name)
+		writeKey(&buf, "Format", parser.Format)
+		if parser.Regex != "" {
+			writeKey(&buf, "Regex", parser.Regex)
+		}
+		if parser.TimeKey != "" {
+			writeKey(&buf, "Time_Key", parser.TimeKey)
+		}
+		if parser.TimeFormat != "" {
+			writeKey(&buf, "Time_Format", parser.TimeFormat)
+		}
+		buf.WriteString("\n")
+	}
+
+	return buf.String()
+}
+
+// Pipeline renders the filter that tries each parser on a container's log
+// line and the outputs. configDir is where the router finds ParsersFile.
+// It has no input because FireLens adds its own
+func Pipeline(router *conf.LogRouter, configDir string) string {
+	var buf bytes.Buffer
+
+	if len(router.Parsers) > 0 {
+		buf.WriteString("[SERVICE]\n")
+		writeKey(&buf, "Parsers_File", path.Join(configDir, ParsersFile))
+		buf.WriteString("\n")
+
+		buf.WriteString("[FILTER]\n")
+		writeKey(&buf, "Name", "parser")
+		writeKey(&buf, "Match", "*")
+		writeKey(&buf, "Key_Name", "log")
+		writeKey(&buf, "Reserve_Data", "On")
+		for _, parser := range router.Parsers {
+			writeKey(&buf, "Parser", parser.Name)
+		}
+		buf.WriteString("\n")
+	}
+
+	for _, output := range router.Outputs {
+		buf.WriteString("[OUTPUT]\n")
+		writeKey(&buf, "Name", output.Plugin)
+		writeKey(&buf, "Match", output.Match)
+
+		var keys []string
+		for key := range output.Options {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			writeKey(&buf, key, output.Options[key])
+		}
+		buf.WriteString("\n")
+	}
+
+	return buf.String()
+}
+
+// Config is the whole config of a router on an EC2 host. Containers log to it
+// with the docker fluentd log driver on a unix socket in configDir
+func Config(router *conf.LogRouter, configDir string) string {
+	var buf bytes.Buffer
+
+	buf.WriteString("[INPUT]\n")
+	writeKey(&buf, "Name", "forward")
+	writeKey(&buf, "Unix_Path", path.Join(configDir, SocketFile))
+	buf.WriteString("\n")
+
+	buf.WriteString(Pipeline(router, configDir))
+
+	return buf.String()
+}
+
+func writeKey(buf *bytes.Buffer, key, value string) {
+	fmt.Fprintf(buf, "    %s %s\n", key, value)
+}
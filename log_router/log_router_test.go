@@ -0,0 +1,89 @@
+package log_router_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/log_router"
+)
+
+var _ = Describe("Log router", func() {
+
+	router := &conf.LogRouter{
+		Parsers: []*conf.LogParser{
+			{Name: "app", Format: "json", TimeKey: "ts", TimeFormat: "%Y-%m-%dT%H:%M:%S"},
+			{Name: "nginx", Format: "regex", Regex: `^(?<remote>[^ ]*) (?<code>\d+)$`},
+		},
+		Outputs: []*conf.LogOutput{
+			{
+				Plugin: "splunk",
+				Match:  "*",
+				Options: map[string]string{
+					"Host":         "splunk.example.com",
+					"Splunk_Token": "${SPLUNK_TOKEN}",
+				},
+			},
+		},
+	}
+
+	It("renders parsers", func() {
+		Expect(log_router.Parsers(router)).To(Equal(`[PARSER]
+    Name app
+    Format json
+    Time_Key ts
+    Time_Format %Y-%m-%dT%H:%M:%S
+
+[PARSER]
+    Name nginx
+    Format regex
+    Regex ^(?<remote>[^ ]*) (?<code>\d+)$
+
+`))
+	})
+
+	It("applies every parser before the outputs", func() {
+		Expect(log_router.Pipeline(router, "/etc/router")).To(Equal(`[SERVICE]
+    Parsers_File /etc/router/parsers.conf
+
+[FILTER]
+    Name parser
+    Match *
+    Key_Name log
+    Reserve_Data On
+    Parser app
+    Parser nginx
+
+[OUTPUT]
+    Name splunk
+    Match *
+    Host splunk.example.com
+    Splunk_Token ${SPLUNK_TOKEN}
+
+`))
+	})
+
+	It("skips the parser filter without parsers", func() {
+		Expect(log_router.Pipeline(&conf.LogRouter{
+			Outputs: []*conf.LogOutput{{Plugin: "stdout", Match: "*"}},
+		}, "/etc/router")).To(Equal(`[OUTPUT]
+    Name stdout
+    Match *
+
+`))
+	})
+
+	It("listens on a unix socket on hosts", func() {
+		Expect(log_router.Config(&conf.LogRouter{
+			Outputs: []*conf.LogOutput{{Plugin: "stdout", Match: "*"}},
+		}, "/etc/router")).To(Equal(`[INPUT]
+    Name forward
+    Unix_Path /etc/router/fluent.sock
+
+[OUTPUT]
+    Name stdout
+    Match *
+
+`))
+	})
+})
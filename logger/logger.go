@@ -13,10 +13,9 @@ package logger
 
 import (
 	"io"
-	"log/syslog"
 	"os"
-	"os/exec"
-	"strings"
+	"runtime"
+	"sync/atomic"
 
 	"github.com/adobe-platform/porter/constants"
 	"github.com/inconshreveable/log15"
@@ -26,9 +25,15 @@ import (
 var cliLog = log15.New("porter_version", constants.Version)
 var hostLog = log15.New("porter_version", constants.Version)
 
+// 1 if debug logs are written. porterd changes it at runtime
+var debug int32
+
 func init() {
-	out, err := exec.Command("uname").Output()
-	if err == nil && strings.TrimSpace(string(out)) == "Linux" {
+	if os.Getenv(constants.EnvLogDebug) != "" {
+		debug = 1
+	}
+
+	if runtime.GOOS == "linux" {
 		initHostLog()
 	}
 
@@ -47,16 +52,6 @@ func init() {
 	}
 }
 
-func initHostLog() {
-
-	writer, err := syslog.Dial("udp", "localhost:514", syslog.LOG_DAEMON|syslog.LOG_INFO, constants.ProgramName)
-	if err != nil {
-		panic(err)
-	}
-
-	SetHandlerWithFormat(hostLog, writer, log15.LogfmtFormat())
-}
-
 func getLogFmt() (logFmt log15.Format) {
 	if os.Getenv(constants.EnvLogColor) == "" {
 		logFmt = log15.LogfmtFormat()
@@ -104,15 +99,26 @@ func SetHandlerWithFormat(log log15.Logger, writer io.Writer, logFmt log15.Forma
 	}, stackHandler)
 
 	infoHandler := log15.StreamHandler(writer, logFmt)
-	if os.Getenv(constants.EnvLogDebug) == "" {
-		infoHandler = log15.FilterHandler(func(r *log15.Record) bool {
-			return r.Lvl == log15.LvlInfo
-		}, infoHandler)
-	} else {
-		infoHandler = log15.FilterHandler(func(r *log15.Record) bool {
+	infoHandler = log15.FilterHandler(func(r *log15.Record) bool {
+		if Debug() {
 			return r.Lvl >= log15.LvlInfo
-		}, infoHandler)
-	}
+		}
+		return r.Lvl == log15.LvlInfo
+	}, infoHandler)
 
 	log.SetHandler(log15.MultiHandler(stackHandler, infoHandler))
 }
+
+// SetDebug turns debug logs on or off for every logger
+func SetDebug(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&debug, value)
+}
+
+// Debug is true if debug logs are written
+func Debug() bool {
+	return atomic.LoadInt32(&debug) == 1
+}
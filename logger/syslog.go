@@ -0,0 +1,32 @@
+//go:build !windows
+// +build !windows
+
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package logger
+
+import (
+	"log/syslog"
+
+	"github.com/adobe-platform/porter/constants"
+	"github.com/inconshreveable/log15"
+)
+
+func initHostLog() {
+
+	writer, err := syslog.Dial("udp", "localhost:514", syslog.LOG_DAEMON|syslog.LOG_INFO, constants.ProgramName)
+	if err != nil {
+		panic(err)
+	}
+
+	SetHandlerWithFormat(hostLog, writer, log15.LogfmtFormat())
+}
@@ -14,8 +14,11 @@ package main
 import (
 	"flag"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/adobe-platform/porter/aws_session"
 	"github.com/adobe-platform/porter/commands"
 	"github.com/phylake/go-cli"
 )
@@ -26,8 +29,25 @@ func main() {
 		Timeout: 20 * time.Minute,
 	}
 
+	// --read-only and --audit are accepted anywhere so they can be added to
+	// any command
+	args := make([]string, 0, len(os.Args))
+	for i := 0; i < len(os.Args); i++ {
+		switch arg := os.Args[i]; {
+		case arg == "--read-only":
+			aws_session.EnableReadOnly()
+		case arg == "--audit" && i+1 < len(os.Args):
+			i++
+			aws_session.EnableAudit(os.Args[i])
+		case strings.HasPrefix(arg, "--audit="):
+			aws_session.EnableAudit(strings.TrimPrefix(arg, "--audit="))
+		default:
+			args = append(args, arg)
+		}
+	}
+
 	var err error
-	cliDriver := cli.New(flag.ExitOnError)
+	cliDriver := cli.NewWithEnv(flag.ExitOnError, args, nil)
 
 	if err = cliDriver.RegisterRoot(commands.GetRootCommand()); err != nil {
 		panic(err)
@@ -0,0 +1,236 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/adobe-platform/porter/aws/sns"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/inconshreveable/log15"
+)
+
+// SNS rejects longer subjects
+const snsSubjectMax = 100
+
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+type (
+	// Event is a step of a deploy. Events about one region set Region
+	Event struct {
+		Event          string    `json:"event"`
+		ServiceName    string    `json:"service_name"`
+		ServiceVersion string    `json:"service_version"`
+		Environment    string    `json:"environment"`
+		Region         string    `json:"region,omitempty"`
+		StackId        string    `json:"stack_id,omitempty"`
+		Message        string    `json:"message,omitempty"`
+		Time           time.Time `json:"time"`
+	}
+
+	// webhookBody is Slack's incoming webhook format which most chat tools
+	// accept
+	webhookBody struct {
+		Text string `json:"text"`
+	}
+
+	// templateData are the fields of the environment's success_template and
+	// failure_template. They're named like porter build notify's so one
+	// template works for both
+	templateData struct {
+		Phase          string
+		Success        bool
+		ServiceName    string
+		ServiceVersion string
+		Environment    string
+		Region         string
+		StackId        string
+		Message        string
+
+		// Default is the message porter posts without a template
+		Default string
+	}
+)
+
+// Text is the event as one line
+func (recv Event) Text() string {
+	text := fmt.Sprintf("%s %s %s in %s", recv.ServiceName, recv.ServiceVersion,
+		strings.Replace(recv.Event, "_", " ", -1), recv.Environment)
+
+	if recv.Region != "" {
+		text += " " + recv.Region
+	}
+
+	if recv.Message != "" {
+		text += ": " + recv.Message
+	}
+
+	return text
+}
+
+// Publish sends the event to the environment's webhooks and SNS topic.
+// Notifications are informational so failing to send one is only a warning
+func Publish(log log15.Logger, config *conf.Config, environment *conf.Environment, event Event) {
+	notifications := environment.Notifications
+	if notifications == nil ||
+		(len(notifications.Webhooks) == 0 && notifications.SNSTopicARN == "") {
+		return
+	}
+
+	if len(notifications.Events) > 0 {
+		subscribed := false
+		for _, name := range notifications.Events {
+			if name == event.Event {
+				subscribed = true
+				break
+			}
+		}
+
+		if !subscribed {
+			return
+		}
+	}
+
+	event.ServiceName = config.ServiceName
+	event.ServiceVersion = config.ServiceVersion
+	event.Environment = environment.Name
+	event.Time = time.Now().UTC()
+
+	log = log.New("Event", event.Event)
+
+	// webhooks aren't AWS calls so audit mode can't record them
+	if aws_session.AuditPath() != "" {
+		log.Info("Audit mode. Not publishing event")
+		return
+	}
+
+	text := eventMessage(log, notifications, event)
+
+	for i, webhook := range notifications.Webhooks {
+		postWebhook(log.New("Webhook", i), webhook, text)
+	}
+
+	if notifications.SNSTopicARN != "" {
+		publishSNS(log, notifications, event)
+	}
+}
+
+// eventMessage executes the environment's success_template, or its
+// failure_template for a rollback. A template that fails to execute falls back
+// to the event's text so the event is still posted
+func eventMessage(log log15.Logger, notifications *conf.Notifications, event Event) string {
+	success := event.Event != constants.EventRolledBack
+
+	text := notifications.FailureTemplate
+	if success {
+		text = notifications.SuccessTemplate
+	}
+
+	if text == "" {
+		return event.Text()
+	}
+
+	tmpl, err := template.New("").Parse(text)
+	if err != nil {
+		log.Warn("template.Parse", "Error", err)
+		return event.Text()
+	}
+
+	var message bytes.Buffer
+	err = tmpl.Execute(&message, templateData{
+		Phase:          event.Event,
+		Success:        success,
+		ServiceName:    event.ServiceName,
+		ServiceVersion: event.ServiceVersion,
+		Environment:    event.Environment,
+		Region:         event.Region,
+		StackId:        event.StackId,
+		Message:        event.Message,
+		Default:        event.Text(),
+	})
+	if err != nil {
+		log.Warn("template.Execute", "Error", err)
+		return event.Text()
+	}
+
+	return message.String()
+}
+
+func postWebhook(log log15.Logger, webhook string, text string) {
+	bodyBytes, err := json.Marshal(webhookBody{
+		Text: text,
+	})
+	if err != nil {
+		log.Warn("Webhook json.Marshal", "Error", err)
+		return
+	}
+
+	resp, err := webhookClient.Post(webhook, "application/json", bytes.NewReader(bodyBytes))
+	if err != nil {
+		// the URL often has a secret in it so it isn't logged
+		log.Warn("Failed to post event to webhook")
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		log.Warn("Failed to post event to webhook", "StatusCode", resp.StatusCode)
+		return
+	}
+
+	log.Debug("Posted event to webhook")
+}
+
+func publishSNS(log log15.Logger, notifications *conf.Notifications, event Event) {
+	log = log.New("TopicArn", notifications.SNSTopicARN)
+
+	messageBytes, err := json.Marshal(event)
+	if err != nil {
+		log.Warn("SNS json.Marshal", "Error", err)
+		return
+	}
+
+	subject := event.Text()
+	if len(subject) > snsSubjectMax {
+		subject = subject[:snsSubjectMax]
+	}
+
+	// arn:aws:sns:<region>:<account>:<name>
+	region := strings.Split(notifications.SNSTopicARN, ":")[3]
+
+	snsSession := aws_session.Get(region)
+	if notifications.RoleARN != "" {
+		snsSession = aws_session.STS(region, notifications.RoleARN, 0)
+	}
+
+	_, err = sns.New(snsSession).Publish(&sns.PublishInput{
+		TopicArn: notifications.SNSTopicARN,
+		Subject:  subject,
+		Message:  string(messageBytes),
+	})
+	if err != nil {
+		log.Warn("sns:Publish", "Error", err)
+		return
+	}
+
+	log.Debug("Published event to SNS")
+}
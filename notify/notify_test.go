@@ -0,0 +1,115 @@
+package notify_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/notify"
+)
+
+var _ = Describe("Notify", func() {
+
+	var (
+		server      *httptest.Server
+		posted      []map[string]string
+		config      *conf.Config
+		environment *conf.Environment
+	)
+
+	BeforeEach(func() {
+		posted = nil
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+
+			var body map[string]string
+			Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+			posted = append(posted, body)
+		}))
+
+		config = &conf.Config{
+			ServiceName:    "svc",
+			ServiceVersion: "1.0.0",
+		}
+
+		environment = &conf.Environment{
+			Name: "prod",
+			Notifications: &conf.Notifications{
+				Webhooks: []string{server.URL},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("posts Slack compatible JSON to webhooks", func() {
+		notify.Publish(logger.CLI(), config, environment, notify.Event{
+			Event:  constants.EventStackCreated,
+			Region: "us-west-2",
+		})
+
+		Expect(posted).To(Equal([]map[string]string{
+			{"text": "svc 1.0.0 stack created in prod us-west-2"},
+		}))
+	})
+
+	It("only publishes the events the environment subscribed to", func() {
+		environment.Notifications.Events = []string{constants.EventPromoted, constants.EventRolledBack}
+
+		notify.Publish(logger.CLI(), config, environment, notify.Event{
+			Event: constants.EventDeployStarted,
+		})
+		Expect(posted).To(BeEmpty())
+
+		notify.Publish(logger.CLI(), config, environment, notify.Event{
+			Event:   constants.EventRolledBack,
+			Region:  "us-east-1",
+			Message: "stack creation failed",
+		})
+		Expect(posted).To(Equal([]map[string]string{
+			{"text": "svc 1.0.0 rolled back in prod us-east-1: stack creation failed"},
+		}))
+	})
+
+	It("renders success_template and failure_template", func() {
+		environment.Notifications.SuccessTemplate = "{{.Phase}} {{.ServiceName}} in {{.Region}}"
+		environment.Notifications.FailureTemplate = "FAILED {{.Default}}"
+
+		notify.Publish(logger.CLI(), config, environment, notify.Event{
+			Event:  constants.EventPromoted,
+			Region: "us-west-2",
+		})
+		notify.Publish(logger.CLI(), config, environment, notify.Event{
+			Event:   constants.EventRolledBack,
+			Region:  "us-east-1",
+			Message: "stack creation failed",
+		})
+
+		Expect(posted).To(Equal([]map[string]string{
+			{"text": "promoted svc in us-west-2"},
+			{"text": "FAILED svc 1.0.0 rolled back in prod us-east-1: stack creation failed"},
+		}))
+	})
+
+	It("posts the default text when the template fails to execute", func() {
+		environment.Notifications.SuccessTemplate = "{{.Missing}}"
+
+		notify.Publish(logger.CLI(), config, environment, notify.Event{
+			Event:  constants.EventStackCreated,
+			Region: "us-west-2",
+		})
+
+		Expect(posted).To(Equal([]map[string]string{
+			{"text": "svc 1.0.0 stack created in prod us-west-2"},
+		}))
+	})
+})
@@ -0,0 +1,225 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package pgzip
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+const (
+	// DefaultBlockSize is how much input each goroutine compresses
+	DefaultBlockSize = 1 << 20
+
+	// the most a deflate back-reference can reach
+	dictionarySize = 32 << 10
+)
+
+var gzipHeader = []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 255}
+
+type (
+	// Writer compresses blocks of its input concurrently like pigz. Each
+	// block is primed with the end of the block before it and the blocks are
+	// joined into one gzip member so the output is an ordinary gzip file that
+	// compresses almost as well as single-threaded gzip
+	//
+	// https://zlib.net/pigz/pigz.pdf
+	Writer struct {
+		w         io.Writer
+		level     int
+		blockSize int
+
+		block      []byte
+		dictionary []byte
+		crc        uint32
+		size       uint32
+
+		// compressed blocks in the order they were read
+		pending   chan chan []byte
+		semaphore chan struct{}
+		done      chan struct{}
+
+		errLock sync.Mutex
+		err     error
+
+		wroteHeader bool
+		closed      bool
+	}
+)
+
+// NewWriter compresses at a compress/flate level with up to concurrency
+// blocks at once
+func NewWriter(w io.Writer, level, concurrency int) (*Writer, error) {
+	if level < flate.DefaultCompression || level > flate.BestCompression {
+		return nil, errors.New("gzip level must be between -1 and 9")
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	recv := &Writer{
+		w:         w,
+		level:     level,
+		blockSize: DefaultBlockSize,
+		pending:   make(chan chan []byte, concurrency),
+		semaphore: make(chan struct{}, concurrency),
+		done:      make(chan struct{}),
+	}
+
+	go recv.writeBlocks()
+
+	return recv, nil
+}
+
+func (recv *Writer) Write(p []byte) (n int, err error) {
+	if recv.closed {
+		return 0, errors.New("pgzip: write after close")
+	}
+
+	if err = recv.error(); err != nil {
+		return
+	}
+
+	recv.crc = crc32.Update(recv.crc, crc32.IEEETable, p)
+	recv.size += uint32(len(p))
+
+	for len(p) > 0 {
+		take := recv.blockSize - len(recv.block)
+		if take > len(p) {
+			take = len(p)
+		}
+
+		recv.block = append(recv.block, p[:take]...)
+		p = p[take:]
+		n += take
+
+		if len(recv.block) == recv.blockSize {
+			recv.compressBlock(false)
+		}
+	}
+
+	return
+}
+
+// Close compresses what's left and writes the gzip trailer. It doesn't close
+// the underlying writer
+func (recv *Writer) Close() error {
+	if recv.closed {
+		return recv.error()
+	}
+	recv.closed = true
+
+	recv.compressBlock(true)
+	close(recv.pending)
+	<-recv.done
+
+	if err := recv.error(); err != nil {
+		return err
+	}
+
+	trailer := make([]byte, 8)
+	binary.LittleEndian.PutUint32(trailer[:4], recv.crc)
+	binary.LittleEndian.PutUint32(trailer[4:], recv.size)
+
+	_, err := recv.w.Write(trailer)
+	return err
+}
+
+func (recv *Writer) compressBlock(last bool) {
+	block := recv.block
+	dictionary := recv.dictionary
+
+	if len(block) >= dictionarySize {
+		recv.dictionary = append([]byte(nil), block[len(block)-dictionarySize:]...)
+	} else {
+		recv.dictionary = append(dictionary, block...)
+		if len(recv.dictionary) > dictionarySize {
+			recv.dictionary = recv.dictionary[len(recv.dictionary)-dictionarySize:]
+		}
+	}
+	recv.block = make([]byte, 0, recv.blockSize)
+
+	compressed := make(chan []byte, 1)
+	recv.pending <- compressed
+	recv.semaphore <- struct{}{}
+
+	go func() {
+		defer func() { <-recv.semaphore }()
+
+		var buf bytes.Buffer
+		flateWriter, err := flate.NewWriterDict(&buf, recv.level, dictionary)
+		if err == nil {
+			_, err = flateWriter.Write(block)
+		}
+
+		// only the last block is final. Flush ends the others on a byte
+		// boundary so the next block's deflate data can follow
+		if err == nil {
+			if last {
+				err = flateWriter.Close()
+			} else {
+				err = flateWriter.Flush()
+			}
+		}
+
+		if err != nil {
+			recv.setError(err)
+		}
+		compressed <- buf.Bytes()
+	}()
+}
+
+func (recv *Writer) writeBlocks() {
+	defer close(recv.done)
+
+	for compressed := range recv.pending {
+		blockBytes := <-compressed
+
+		if recv.error() != nil {
+			continue
+		}
+
+		if !recv.wroteHeader {
+			recv.wroteHeader = true
+			if _, err := recv.w.Write(gzipHeader); err != nil {
+				recv.setError(err)
+				continue
+			}
+		}
+
+		if _, err := recv.w.Write(blockBytes); err != nil {
+			recv.setError(err)
+		}
+	}
+}
+
+func (recv *Writer) error() error {
+	recv.errLock.Lock()
+	defer recv.errLock.Unlock()
+
+	return recv.err
+}
+
+func (recv *Writer) setError(err error) {
+	recv.errLock.Lock()
+	defer recv.errLock.Unlock()
+
+	if recv.err == nil {
+		recv.err = err
+	}
+}
@@ -0,0 +1,97 @@
+package pgzip_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/pgzip"
+)
+
+// compressible input that isn't all the same byte
+func payload(size int) []byte {
+	random := rand.New(rand.NewSource(int64(size)))
+
+	var buf bytes.Buffer
+	for buf.Len() < size {
+		fmt.Fprintf(&buf, "line %d of the payload %d\n", buf.Len(), random.Intn(100))
+	}
+	return buf.Bytes()[:size]
+}
+
+func roundTrip(input []byte, level, concurrency int) []byte {
+	var compressed bytes.Buffer
+
+	writer, err := pgzip.NewWriter(&compressed, level, concurrency)
+	Expect(err).To(BeNil())
+
+	// uneven writes cross block boundaries
+	for offset := 0; offset < len(input); offset += 70001 {
+		end := offset + 70001
+		if end > len(input) {
+			end = len(input)
+		}
+		_, err = writer.Write(input[offset:end])
+		Expect(err).To(BeNil())
+	}
+	Expect(writer.Close()).To(BeNil())
+
+	reader, err := gzip.NewReader(&compressed)
+	Expect(err).To(BeNil())
+
+	// one member like gzip would write
+	reader.Multistream(false)
+
+	output, err := ioutil.ReadAll(reader)
+	Expect(err).To(BeNil())
+
+	_, err = reader.Read(make([]byte, 1))
+	Expect(err).ToNot(BeNil())
+
+	return output
+}
+
+var _ = Describe("Parallel gzip", func() {
+
+	It("writes gzip that decompresses to the input", func() {
+		for _, size := range []int{0, 1, pgzip.DefaultBlockSize, 3*pgzip.DefaultBlockSize + 12345} {
+			input := payload(size)
+			Expect(bytes.Equal(roundTrip(input, gzip.DefaultCompression, 4), input)).To(BeTrue(), fmt.Sprint(size))
+		}
+	})
+
+	It("supports every level", func() {
+		input := payload(2*pgzip.DefaultBlockSize + 1)
+
+		for level := gzip.DefaultCompression; level <= gzip.BestCompression; level++ {
+			Expect(bytes.Equal(roundTrip(input, level, 3), input)).To(BeTrue(), fmt.Sprint(level))
+		}
+	})
+
+	It("compresses about as well as single-threaded gzip", func() {
+		input := payload(4 * pgzip.DefaultBlockSize)
+
+		var parallel, single bytes.Buffer
+
+		writer, err := pgzip.NewWriter(&parallel, gzip.DefaultCompression, 8)
+		Expect(err).To(BeNil())
+		writer.Write(input)
+		Expect(writer.Close()).To(BeNil())
+
+		gzipWriter := gzip.NewWriter(&single)
+		gzipWriter.Write(input)
+		gzipWriter.Close()
+
+		Expect(parallel.Len()).To(BeNumerically("<", single.Len()*101/100))
+	})
+
+	It("rejects invalid levels", func() {
+		_, err := pgzip.NewWriter(ioutil.Discard, 10, 1)
+		Expect(err).ToNot(BeNil())
+	})
+})
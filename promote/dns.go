@@ -0,0 +1,181 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package promote
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/aws/elb"
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/inconshreveable/log15"
+)
+
+const dnsRecordSetLogicalName = "DNSRecordSet"
+
+// promoteDNS points this region's record in the record set at the ELB that
+// was just promoted into.
+//
+// Route53 has no client in this build so the record lives in a small stack
+// per service, environment, and region. Provisioned stacks come and go with
+// every deployment but this one is only ever updated which is what keeps the
+// record set whole while regions are promoted independently.
+func promoteDNS(log log15.Logger, roleSession *session.Session, serviceName, envName string,
+	region *conf.Region, elbName, cfnRoleARN string) (success bool) {
+
+	stackName := DNSStackName(serviceName, envName)
+	log = log.New("DNSName", region.DNS.Name, "StackName", stackName)
+
+	elbClient := elb.New(roleSession)
+
+	lbs, err := elb.DescribeLoadBalancers(elbClient, elbName)
+	if err != nil {
+		log.Error("DescribeLoadBalancers", "LoadBalancerName", elbName, "Error", err)
+		return
+	}
+	if len(lbs) != 1 || lbs[0].DNSName == nil || lbs[0].CanonicalHostedZoneNameID == nil {
+		log.Error("DescribeLoadBalancers didn't return the ELB", "LoadBalancerName", elbName)
+		return
+	}
+
+	template := cfn.NewTemplate()
+	template.Description = "porter managed DNS for " + serviceName + " " + envName
+	template.SetResource(dnsRecordSetLogicalName,
+		dnsRecordSet(region, *lbs[0].DNSName, *lbs[0].CanonicalHostedZoneNameID))
+
+	success = updateDNSStack(log, cloudformation.New(roleSession), stackName, template, cfnRoleARN)
+	return
+}
+
+// DNSStackName is the stack that holds a service's promoted DNS records in a
+// region
+func DNSStackName(serviceName, envName string) string {
+	return fmt.Sprintf("porter-dns-%s-%s", serviceName, envName)
+}
+
+// updateDNSStack creates the DNS stack the first time a region is promoted and
+// updates it every time after
+func updateDNSStack(log log15.Logger, cfnClient *cfnlib.CloudFormation,
+	stackName string, template *cfn.Template, cfnRoleARN string) (success bool) {
+
+	templateBytes, err := json.Marshal(template)
+	if err != nil {
+		log.Error("json.Marshal", "Error", err)
+		return
+	}
+	templateBody := string(templateBytes)
+
+	describeInput := &cfnlib.DescribeStacksInput{
+		StackName: aws.String(stackName),
+	}
+
+	_, err = cloudformation.DescribeStack(cfnClient, stackName)
+	if err != nil {
+		if !strings.Contains(err.Error(), "does not exist") {
+			log.Error("DescribeStack", "Error", err)
+			return
+		}
+
+		log.Info("Creating DNS stack")
+		_, err = cloudformation.CreateStackWithBody(cfnClient, stackName, templateBody, cfnRoleARN)
+		if err == cloudformation.ErrAudited {
+			success = true
+			return
+		}
+		if err != nil {
+			log.Error("CreateStack", "Error", err)
+			return
+		}
+
+		err = cfnClient.WaitUntilStackCreateComplete(describeInput)
+		if err != nil {
+			log.Error("WaitUntilStackCreateComplete", "Error", err)
+			return
+		}
+
+		success = true
+		return
+	}
+
+	log.Info("Updating DNS stack")
+	err = cloudformation.UpdateStackWithBody(cfnClient, stackName, templateBody, cfnRoleARN)
+	if err != nil {
+		if strings.Contains(err.Error(), "No updates are to be performed") {
+			log.Info("DNS record is current")
+			success = true
+			return
+		}
+
+		log.Error("UpdateStack", "Error", err)
+		return
+	}
+
+	err = cfnClient.WaitUntilStackUpdateComplete(describeInput)
+	if err != nil {
+		log.Error("WaitUntilStackUpdateComplete", "Error", err)
+		return
+	}
+
+	success = true
+	return
+}
+
+func dnsRecordSet(region *conf.Region, elbDNSName, elbHostedZoneId string) map[string]interface{} {
+	dns := region.DNS
+
+	properties := map[string]interface{}{
+		"Type":           "A",
+		"HostedZoneName": region.HostedZoneName,
+		"Name":           dns.Name,
+		"AliasTarget": map[string]interface{}{
+			"DNSName":              elbDNSName,
+			"HostedZoneId":         elbHostedZoneId,
+			"EvaluateTargetHealth": dns.EvaluateTargetHealth,
+		},
+	}
+
+	// Every policy but simple has one record per region distinguished by
+	// SetIdentifier
+	if dns.RoutingPolicy != conf.RoutingPolicy_Simple {
+		properties["SetIdentifier"] = region.Name
+	}
+
+	switch dns.RoutingPolicy {
+	case conf.RoutingPolicy_Weighted:
+		properties["Weight"] = *dns.Weight
+	case conf.RoutingPolicy_Latency:
+		properties["Region"] = region.Name
+	case conf.RoutingPolicy_Geolocation:
+		geoLocation := make(map[string]interface{})
+		if dns.Geolocation.ContinentCode != "" {
+			geoLocation["ContinentCode"] = dns.Geolocation.ContinentCode
+		}
+		if dns.Geolocation.CountryCode != "" {
+			geoLocation["CountryCode"] = dns.Geolocation.CountryCode
+		}
+		if dns.Geolocation.SubdivisionCode != "" {
+			geoLocation["SubdivisionCode"] = dns.Geolocation.SubdivisionCode
+		}
+		properties["GeoLocation"] = geoLocation
+	}
+
+	return map[string]interface{}{
+		"Type":       cfn.Route53_RecordSet,
+		"Properties": properties,
+	}
+}
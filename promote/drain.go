@@ -0,0 +1,326 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package promote
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/aws/elb"
+	"github.com/adobe-platform/porter/aws/elbv2"
+	"github.com/adobe-platform/porter/aws/ssm"
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+	elblib "github.com/aws/aws-sdk-go/service/elb"
+	"github.com/inconshreveable/log15"
+)
+
+// the state of a target group's target until its deregistration delay passes
+// or its connections close
+const targetStateDraining = "draining"
+
+// drainTimeout is how long porter waits for load balancers to finish draining
+func drainTimeout(environment *conf.Environment) time.Duration {
+	return time.Duration(environment.DeregistrationDelay())*time.Second + constants.DeregistrationGrace
+}
+
+// DrainStack takes a stack that's about to be deleted out of its load
+// balancers and waits for their in-flight requests to finish. The drain
+// pre_deregistration command runs on its instances first.
+//
+// It's only done for environments with drain. Without it deleting the stack
+// drains the instances as it terminates them
+func DrainStack(log log15.Logger, roleSession *session.Session, environment *conf.Environment,
+	region *conf.Region, stackId string) (success bool) {
+
+	if environment.Drain == nil {
+		success = true
+		return
+	}
+
+	log = log.New("StackId", stackId)
+
+	instances, err := describeStackInstances(roleSession, stackId)
+	if err != nil {
+		log.Error("DescribeInstances", "Error", err)
+		return
+	}
+
+	instanceIds := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		instanceIds = append(instanceIds, instance.id)
+	}
+
+	if len(instanceIds) == 0 {
+		success = true
+		return
+	}
+
+	PreDeregister(log, roleSession, environment, region, instanceIds)
+
+	log.Info("cloudformation:DescribeStackResources")
+	resourcesOutput, err := cloudformation.New(roleSession).DescribeStackResources(&cfnlib.DescribeStackResourcesInput{
+		StackName: aws.String(stackId),
+	})
+	if err != nil {
+		log.Error("cloudformation:DescribeStackResources", "Error", err)
+		return
+	}
+
+	timeout := drainTimeout(environment)
+	elbClient := elb.New(roleSession)
+	elbv2Client := elbv2.New(roleSession)
+
+	for _, resource := range resourcesOutput.StackResources {
+		physicalId := aws.StringValue(resource.PhysicalResourceId)
+		if physicalId == "" {
+			continue
+		}
+
+		switch aws.StringValue(resource.ResourceType) {
+		case cfn.ElasticLoadBalancing_LoadBalancer:
+
+			elbInstances := make([]*elblib.Instance, 0, len(instanceIds))
+			for _, instanceId := range instanceIds {
+				elbInstances = append(elbInstances, &elblib.Instance{InstanceId: aws.String(instanceId)})
+			}
+
+			deregisterInstances(log, elbClient, physicalId, elbInstances)
+			if !waitForDeregistration(log, elbClient, physicalId, instanceIds, timeout) {
+				return
+			}
+
+		case cfn.ElasticLoadBalancingV2_TargetGroup:
+
+			if !drainTargetGroup(log.New("TargetGroupArn", physicalId), elbv2Client, physicalId, timeout) {
+				return
+			}
+		}
+	}
+
+	success = true
+	return
+}
+
+// PreDeregister runs the drain pre_deregistration command in the inet
+// containers of instances that are about to leave their load balancers. A
+// failure is logged rather than stopping the swap because the instances are
+// leaving either way
+func PreDeregister(log log15.Logger, roleSession *session.Session, environment *conf.Environment,
+	region *conf.Region, instanceIds []string) {
+
+	if environment.Drain == nil || len(environment.Drain.PreDeregistration) == 0 || len(instanceIds) == 0 {
+		return
+	}
+
+	client := ssm.New(roleSession)
+
+	log.Info("Running pre_deregistration", "InstanceIds", instanceIds)
+	sendOutput, err := client.SendCommand(&ssm.SendCommandInput{
+		InstanceIds:  instanceIds,
+		DocumentName: "AWS-RunShellScript",
+		Comment:      "porter pre_deregistration",
+		Parameters: map[string][]string{
+			"commands": {preDeregistrationScript(region, environment.Drain.PreDeregistration)},
+		},
+	})
+	if err != nil {
+		log.Warn("ssm:SendCommand", "Error", err)
+		return
+	}
+
+	// the command can take as long as load balancers would drain the
+	// instance
+	deadline := time.Now().Add(time.Duration(environment.DeregistrationDelay()) * time.Second)
+
+	for _, instanceId := range instanceIds {
+		waitForPreDeregistration(log.New("InstanceId", instanceId), client,
+			sendOutput.Command.CommandId, instanceId, deadline)
+	}
+}
+
+func waitForPreDeregistration(log log15.Logger, client *ssm.SSM, commandId, instanceId string, deadline time.Time) {
+	input := &ssm.GetCommandInvocationInput{
+		CommandId:  commandId,
+		InstanceId: instanceId,
+	}
+
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+
+		// the invocation doesn't exist for a moment after SendCommand
+		output, err := client.GetCommandInvocation(input)
+		if err != nil {
+			log.Debug("ssm:GetCommandInvocation", "Error", err)
+			continue
+		}
+
+		switch output.Status {
+		case "Pending", "InProgress", "Delayed":
+			continue
+		case "Success":
+			log.Info("pre_deregistration finished")
+			return
+		default:
+			log.Warn("pre_deregistration failed", "Status", output.Status, "Stderr", output.StandardErrorContent)
+			return
+		}
+	}
+
+	log.Warn("Timed out waiting for pre_deregistration")
+}
+
+// preDeregistrationScript runs the command with docker exec in every inet
+// container on the host
+func preDeregistrationScript(region *conf.Region, command []string) string {
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = shellQuote(arg)
+	}
+
+	lines := []string{"set -e"}
+	for _, container := range region.Containers {
+		if container.Topology != conf.Topology_Inet {
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf(`for id in $(docker ps -q --filter %s); do docker exec "$id" %s; done`,
+			shellQuote("label="+constants.ContainerLabel+"="+container.Name), strings.Join(quoted, " ")))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func shellQuote(arg string) string {
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+// waitForDeregistration waits for a classic ELB to stop reporting the
+// instances. It reports them InService until connection draining finished
+func waitForDeregistration(log log15.Logger, elbClient *elblib.ELB, elbName string,
+	instanceIds []string, timeout time.Duration) bool {
+
+	log = log.New("LoadBalancerName", elbName)
+	log.Info("Waiting for connection draining", "Timeout", timeout)
+
+	deregistered := make(map[string]struct{})
+	for _, instanceId := range instanceIds {
+		deregistered[instanceId] = struct{}{}
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		instanceStates, err := elb.DescribeInstanceHealth(elbClient, elbName)
+		if err != nil {
+			log.Error("DescribeInstanceHealth", "Error", err)
+			return false
+		}
+
+		draining := 0
+		for _, instanceState := range instanceStates {
+			if instanceState == nil || instanceState.InstanceId == nil {
+				continue
+			}
+
+			if _, exists := deregistered[*instanceState.InstanceId]; exists {
+				draining++
+			}
+		}
+
+		if draining == 0 {
+			log.Info("Connection draining finished")
+			return true
+		}
+
+		if time.Now().After(deadline) {
+			log.Error("Timed out waiting for connection draining", "Draining", draining)
+			return false
+		}
+
+		log.Info("Connection draining", "Draining", draining)
+		time.Sleep(sleepDuration)
+	}
+}
+
+// drainTargetGroup deregisters every target of the target group and waits
+// for them to leave the draining state
+func drainTargetGroup(log log15.Logger, client *elbv2.ELBV2, targetGroupArn string, timeout time.Duration) bool {
+
+	output, err := client.DescribeTargetHealth(&elbv2.DescribeTargetHealthInput{
+		TargetGroupArn: targetGroupArn,
+	})
+	if err != nil {
+		log.Error("elasticloadbalancing:DescribeTargetHealth", "Error", err)
+		return false
+	}
+
+	targets := make([]*elbv2.TargetDescription, 0)
+	for _, description := range output.TargetHealthDescriptions {
+		if description.Target != nil {
+			targets = append(targets, description.Target)
+		}
+	}
+
+	if len(targets) == 0 {
+		return true
+	}
+
+	log.Info("elasticloadbalancing:DeregisterTargets", "Targets", len(targets))
+	_, err = client.DeregisterTargets(&elbv2.DeregisterTargetsInput{
+		TargetGroupArn: targetGroupArn,
+		Targets:        targets,
+	})
+	if err != nil {
+		log.Error("elasticloadbalancing:DeregisterTargets", "Error", err)
+		return false
+	}
+
+	log.Info("Waiting for targets to drain", "Timeout", timeout)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		output, err = client.DescribeTargetHealth(&elbv2.DescribeTargetHealthInput{
+			TargetGroupArn: targetGroupArn,
+		})
+		if err != nil {
+			log.Error("elasticloadbalancing:DescribeTargetHealth", "Error", err)
+			return false
+		}
+
+		draining := 0
+		for _, description := range output.TargetHealthDescriptions {
+			if description.TargetHealth != nil &&
+				aws.StringValue(description.TargetHealth.State) == targetStateDraining {
+				draining++
+			}
+		}
+
+		if draining == 0 {
+			log.Info("Targets finished draining")
+			return true
+		}
+
+		if time.Now().After(deadline) {
+			log.Error("Timed out waiting for targets to drain", "Draining", draining)
+			return false
+		}
+
+		log.Info("Targets draining", "Draining", draining)
+		time.Sleep(sleepDuration)
+	}
+}
@@ -0,0 +1,165 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package promote
+
+import (
+	"strings"
+	"time"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/aws/elbv2"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/inconshreveable/log15"
+)
+
+const (
+	// The listeners of the ECS load balancer stack forward to the target
+	// group in ECSTargetGroupParameter. ECSStackIdParameter is the stack it
+	// belongs to which the stack outputs as PromotedStackIdOutput. Both are
+	// ECSNotPromoted until a stack is promoted and the listeners respond 503
+	ECSTargetGroupParameter = "PromotedTargetGroupArn"
+	ECSStackIdParameter     = "PromotedStackId"
+	ECSNotPromoted          = "none"
+
+	// ECSListenerOutput is the listener provisioned stacks add a rule to so
+	// their target group is associated with the load balancer before their
+	// service registers tasks in it
+	ECSListenerOutput = "Listener"
+
+	// ECSSecurityGroupOutput is the load balancer's security group that
+	// tasks allow traffic from
+	ECSSecurityGroupOutput = "SecurityGroup"
+
+	// ECSTargetGroupLogicalName is the target group of a provisioned stack
+	ECSTargetGroupLogicalName = "ECSTargetGroup"
+)
+
+// promoteECS points the listeners of the environment's ECS load balancer at
+// the target group of the provisioned stack once its tasks are healthy.
+//
+// The listeners are in conf.ECSLoadBalancerStackName so the stack's parameters
+// are changed instead of the listeners. Updating the stack later doesn't undo
+// the promotion
+func promoteECS(log log15.Logger, roleSession *session.Session, serviceName, envName,
+	stackId, cfnRoleARN string) (success bool) {
+
+	stackName := conf.ECSLoadBalancerStackName(serviceName, envName)
+	log = log.New("StackName", stackName)
+
+	cfnClient := cloudformation.New(roleSession)
+
+	targetGroupArn, err := cloudformation.DescribeStackResource(cfnClient, stackId, ECSTargetGroupLogicalName)
+	if err != nil {
+		log.Error("DescribeStackResource", "LogicalResourceId", ECSTargetGroupLogicalName, "Error", err)
+		return
+	}
+	log = log.New("TargetGroupArn", targetGroupArn)
+
+	log.Info("Waiting for the provisioned stack's tasks to be healthy")
+	if !waitForHealthyTargets(log, elbv2.New(roleSession), targetGroupArn) {
+		log.Error("Tasks never became healthy in the provisioned target group")
+		return
+	}
+
+	log.Info("Pointing the load balancer's listeners at the provisioned stack")
+	err = cloudformation.UpdateStackParameters(cfnClient, stackName, []*cfnlib.Parameter{
+		{
+			ParameterKey:   aws.String(ECSTargetGroupParameter),
+			ParameterValue: aws.String(targetGroupArn),
+		},
+		{
+			ParameterKey:   aws.String(ECSStackIdParameter),
+			ParameterValue: aws.String(stackId),
+		},
+	}, cfnRoleARN)
+	if err != nil {
+		if strings.Contains(err.Error(), "No updates are to be performed") {
+			log.Info("The stack is already promoted")
+			success = true
+			return
+		}
+
+		log.Error("UpdateStack", "Error", err)
+		return
+	}
+
+	err = cfnClient.WaitUntilStackUpdateComplete(&cfnlib.DescribeStacksInput{
+		StackName: aws.String(stackName),
+	})
+	if err != nil {
+		log.Error("WaitUntilStackUpdateComplete", "Error", err)
+		return
+	}
+
+	success = true
+	return
+}
+
+// ECSPromotedStackId is the stack the ECS load balancer's listeners forward
+// to. It's empty if no stack was promoted
+func ECSPromotedStackId(roleSession *session.Session, serviceName, envName string) (string, error) {
+	outputs, err := describeStackOutputs(cloudformation.New(roleSession),
+		conf.ECSLoadBalancerStackName(serviceName, envName))
+	if err != nil {
+		return "", err
+	}
+
+	stackId := outputs[PromotedStackIdOutput]
+	if stackId == ECSNotPromoted {
+		stackId = ""
+	}
+	return stackId, nil
+}
+
+// waitForHealthyTargets waits until every target of the target group that
+// isn't draining is healthy
+func waitForHealthyTargets(log log15.Logger, client *elbv2.ELBV2, targetGroupArn string) bool {
+
+	deadline := time.Now().Add(pollDuration)
+	for time.Now().Before(deadline) {
+
+		output, err := client.DescribeTargetHealth(&elbv2.DescribeTargetHealthInput{
+			TargetGroupArn: targetGroupArn,
+		})
+		if err != nil {
+			log.Error("elasticloadbalancing:DescribeTargetHealth", "Error", err)
+			return false
+		}
+
+		healthy, pending := 0, 0
+		for _, description := range output.TargetHealthDescriptions {
+			if description.TargetHealth == nil {
+				continue
+			}
+
+			switch aws.StringValue(description.TargetHealth.State) {
+			case "healthy":
+				healthy++
+			case "draining":
+			default:
+				pending++
+			}
+		}
+
+		if healthy > 0 && pending == 0 {
+			return true
+		}
+
+		log.Info("Targets aren't healthy yet", "Healthy", healthy, "NotHealthy", pending)
+		time.Sleep(sleepDuration)
+	}
+
+	return false
+}
@@ -0,0 +1,269 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package promote
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/aws/cloudwatch"
+	"github.com/adobe-platform/porter/aws/ec2"
+	"github.com/adobe-platform/porter/aws/route53"
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/instance_dns"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/inconshreveable/log15"
+)
+
+const (
+	// PromotedStackIdOutput is the output of the DNS stack that holds the id
+	// of the stack whose instances are in DNS
+	PromotedStackIdOutput = "PromotedStackId"
+
+	promotedStackParameterLogicalName = "PromotedStackParameter"
+)
+
+var nonAlphanumericRegex = regexp.MustCompile(`[^a-zA-Z0-9]`)
+
+type dnsInstance struct {
+	id        string
+	privateIp string
+}
+
+// promoteInstances points this region's records in the record set at the
+// instances of the provisioned stack.
+//
+// The autoscaling group replaces instances after promote so records aren't in
+// the DNS stack. It holds the promoted stack's id in an SSM parameter that
+// porterd reads to register or deregister its own instance. The instances
+// running now are registered here so DNS doesn't wait on porterd
+func promoteInstances(log log15.Logger, roleSession *session.Session, serviceName, envName string,
+	region *conf.Region, stackId, cfnRoleARN string) (success bool) {
+
+	stackName := DNSStackName(serviceName, envName)
+	log = log.New("DNSName", region.DNS.Name, "StackName", stackName)
+
+	instances, err := describeStackInstances(roleSession, stackId)
+	if err != nil {
+		log.Error("DescribeInstances", "StackId", stackId, "Error", err)
+		return
+	}
+	if len(instances) == 0 {
+		log.Error("The provisioned stack has no running instances", "StackId", stackId)
+		return
+	}
+
+	if !syncInstances(log, roleSession, region, instances, false) {
+		return
+	}
+
+	template := cfn.NewTemplate()
+	template.Description = "porter managed DNS for " + serviceName + " " + envName
+	template.SetResource(promotedStackParameterLogicalName, map[string]interface{}{
+		"Type": cfn.SSM_Parameter,
+		"Properties": map[string]interface{}{
+			"Name":  instance_dns.ParameterName(serviceName, envName),
+			"Type":  "String",
+			"Value": stackId,
+		},
+	})
+	template.Outputs = map[string]interface{}{
+		PromotedStackIdOutput: map[string]interface{}{
+			"Value": stackId,
+		},
+	}
+
+	if !updateDNSStack(log, cloudformation.New(roleSession), stackName, template, cfnRoleARN) {
+		return
+	}
+
+	success = syncInstances(log, roleSession, region, instances, true)
+	return
+}
+
+// SyncInstances makes this region's records the running instances of the
+// promoted stack. Instance refresh and rollback replace instances of a stack
+// that stays promoted and prune deletes stacks whose instances may still have
+// records. The records of every instance are removed once the promoted stack
+// is gone
+func SyncInstances(log log15.Logger, roleSession *session.Session, serviceName, envName string,
+	region *conf.Region) (success bool) {
+
+	log = log.New("DNSName", region.DNS.Name)
+
+	stackId, err := PromotedStackId(roleSession, serviceName, envName)
+	if err != nil {
+		log.Error("PromotedStackId", "Error", err)
+		return
+	}
+
+	instances := make([]dnsInstance, 0)
+	if stackId != "" {
+		instances, err = describeStackInstances(roleSession, stackId)
+		if err != nil {
+			log.Error("DescribeInstances", "StackId", stackId, "Error", err)
+			return
+		}
+	}
+
+	success = syncInstances(log, roleSession, region, instances, true)
+	return
+}
+
+// syncInstances registers each instance and with sweep removes the region's
+// records of every other instance
+func syncInstances(log log15.Logger, roleSession *session.Session, region *conf.Region,
+	instances []dnsInstance, sweep bool) (success bool) {
+
+	cwClient := cloudwatch.New(roleSession)
+	r53Client := route53.New(roleSession)
+
+	hostedZoneId, err := instance_dns.HostedZoneId(r53Client, region.HostedZoneName)
+	if err != nil {
+		log.Error("ListHostedZonesByName", "HostedZoneName", region.HostedZoneName, "Error", err)
+		return
+	}
+
+	registered := make(map[string]interface{})
+	for _, instance := range instances {
+		err = instance_dns.Register(cwClient, r53Client, hostedZoneId, region.DNS.Name, instance_dns.Instance{
+			Region:    region.Name,
+			Id:        instance.id,
+			PrivateIp: instance.privateIp,
+		})
+		if err != nil {
+			log.Error("Register instance record", "InstanceId", instance.id, "Error", err)
+			return
+		}
+
+		log.Info("Instance record", "InstanceId", instance.id, "IP", instance.privateIp)
+		registered[instance.id] = nil
+	}
+
+	if !sweep {
+		success = true
+		return
+	}
+
+	records, err := instance_dns.RegionRecords(r53Client, hostedZoneId, region.DNS.Name, region.Name)
+	if err != nil {
+		log.Error("ListResourceRecordSets", "Error", err)
+		return
+	}
+
+	for _, record := range records {
+		instanceId := instance_dns.InstanceId(record)
+		if _, exists := registered[instanceId]; exists {
+			continue
+		}
+
+		log.Info("Removing the record of an instance that isn't promoted", "InstanceId", instanceId)
+		err = instance_dns.Deregister(cwClient, r53Client, hostedZoneId, record)
+		if err != nil {
+			log.Error("Deregister instance record", "InstanceId", instanceId, "Error", err)
+			return
+		}
+	}
+
+	success = true
+	return
+}
+
+// describeStackInstances is the running instances of a stack sorted by id so
+// the DNS template doesn't change if the instances don't
+func describeStackInstances(roleSession *session.Session, stackId string) ([]dnsInstance, error) {
+	filters := map[string][]string{
+		"tag:" + constants.AwsCfnStackIdTag: {stackId},
+		"instance-state-name":               {"running"},
+	}
+
+	reservations, err := ec2.DescribeInstances(ec2.New(roleSession), filters)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]dnsInstance, 0)
+	for _, reservation := range reservations {
+		if reservation == nil {
+			continue
+		}
+
+		for _, instance := range reservation.Instances {
+			if instance == nil || instance.InstanceId == nil || instance.PrivateIpAddress == nil {
+				continue
+			}
+
+			instances = append(instances, dnsInstance{
+				id:        *instance.InstanceId,
+				privateIp: *instance.PrivateIpAddress,
+			})
+		}
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].id < instances[j].id
+	})
+
+	return instances, nil
+}
+
+// PromotedStackId is the stack that's in DNS. It's empty if the region was
+// never promoted
+func PromotedStackId(roleSession *session.Session, serviceName, envName string) (string, error) {
+	stackName := DNSStackName(serviceName, envName)
+
+	outputs, err := describeStackOutputs(cloudformation.New(roleSession), stackName)
+	if err != nil || outputs == nil {
+		return "", err
+	}
+
+	stackId, exists := outputs[PromotedStackIdOutput]
+	if !exists {
+		return "", fmt.Errorf("%s has no %s output", stackName, PromotedStackIdOutput)
+	}
+
+	return stackId, nil
+}
+
+// describeStackOutputs is the outputs of a stack by key. It's nil if the stack
+// doesn't exist
+func describeStackOutputs(cfnClient *cfnlib.CloudFormation, stackName string) (map[string]string, error) {
+	output, err := cloudformation.DescribeStack(cfnClient, stackName)
+	if err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	outputs := make(map[string]string)
+	for _, stack := range output.Stacks {
+		if stack == nil {
+			continue
+		}
+
+		for _, output := range stack.Outputs {
+			if output != nil && output.OutputKey != nil {
+				outputs[*output.OutputKey] = aws.StringValue(output.OutputValue)
+			}
+		}
+	}
+
+	return outputs, nil
+}
@@ -18,6 +18,8 @@ import (
 	"github.com/adobe-platform/porter/aws_session"
 	"github.com/adobe-platform/porter/conf"
 	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/events"
+	"github.com/adobe-platform/porter/notify"
 	"github.com/adobe-platform/porter/provision_state"
 	"github.com/aws/aws-sdk-go/aws"
 	elblib "github.com/aws/aws-sdk-go/service/elb"
@@ -29,7 +31,30 @@ const (
 	pollDuration  = 10 * time.Minute
 )
 
-func Promote(log log15.Logger, config *conf.Config, stack *provision_state.Stack, elb string) (success bool) {
+// Promote each region of the stack into its ELB.
+//
+// Promotion is refused if regions were provisioned from different artifacts
+// unless skewJustification explains why. The justification is recorded as an
+// ELB tag next to the promoted stack id.
+func Promote(log log15.Logger, config *conf.Config, stack *provision_state.Stack,
+	elb string, skewJustification string) (success bool) {
+
+	skewed, skewSuccess := checkSkew(log, config, stack)
+	if !skewSuccess {
+		return
+	}
+
+	if skewed {
+		if skewJustification == "" {
+			log.Error("Refusing to promote mixed versions across regions. Pass --allow-skew with a justification to override")
+			return
+		}
+
+		log.Warn("Promoting mixed versions across regions", "Justification", skewJustification)
+	} else {
+		// don't leave a justification from a previous promotion on the ELB
+		skewJustification = ""
+	}
 
 	successChan := make(chan bool)
 
@@ -38,7 +63,7 @@ func Promote(log log15.Logger, config *conf.Config, stack *provision_state.Stack
 		go func(regionName string, regionState *provision_state.Region) {
 
 			successChan <- promoteService(log, stack.Environment, regionName,
-				regionState, config, elb)
+				regionState, config, elb, skewJustification)
 
 		}(regionName, regionState)
 	}
@@ -55,10 +80,26 @@ func Promote(log log15.Logger, config *conf.Config, stack *provision_state.Stack
 }
 
 func promoteService(log log15.Logger, env, regionName string,
-	regionState *provision_state.Region, config *conf.Config, elbTag string) (success bool) {
+	regionState *provision_state.Region, config *conf.Config, elbTag string,
+	skewJustification string) (success bool) {
 
 	log = log.New("Region", regionName)
 
+	defer func() {
+		header := events.NewHeader(config.ServiceName, config.ServiceVersion, env, regionName, regionState.StackId)
+		if success {
+			events.Emit(events.Promoted{
+				Header:  header,
+				StackId: regionState.StackId,
+			})
+		} else {
+			events.Emit(events.StepFailed{
+				Header: header,
+				Step:   "promote",
+			})
+		}
+	}()
+
 	environment, err := config.GetEnvironment(env)
 	if err != nil {
 		log.Error("GetEnvironment", "Error", err)
@@ -83,8 +124,57 @@ func promoteService(log log15.Logger, env, regionName string,
 	}
 
 	roleSession := aws_session.STS(region.Name, roleARN, 1*time.Hour)
+
+	cfnRoleARN, err := environment.GetCFNRoleARN(region.Name)
+	if err != nil {
+		log.Error("GetCFNRoleARN", "Error", err)
+		return
+	}
+
+	if environment.Compute == conf.Compute_ECS {
+		if skewJustification != "" {
+			log.Warn("There's no classic ELB to record the skew justification on", "Justification", skewJustification)
+		}
+
+		success = promoteECS(log, roleSession, config.ServiceName,
+			environment.Name, regionState.StackId, cfnRoleARN)
+		return
+	}
+
+	if region.DNSToInstances() {
+		if skewJustification != "" {
+			log.Warn("There's no ELB to record the skew justification on", "Justification", skewJustification)
+		}
+
+		success = promoteInstances(log, roleSession, config.ServiceName,
+			environment.Name, region, regionState.StackId, cfnRoleARN)
+		return
+	}
+
 	elbClient := elb.New(roleSession)
 
+	if region.DNSToStacks() {
+		if skewJustification != "" {
+			log.Warn("There's no destination ELB to record the skew justification on", "Justification", skewJustification)
+		}
+
+		log.Info("Waiting for newly provisioned instances to be InService", "LoadBalancerName", regionState.ProvisionedELBName)
+		if ok := waitForInServiceInstances(log, elbClient, regionState.ProvisionedELBName, nil); !ok {
+			log.Error("Instances never became InService in the newly provisioned ELB", "LoadBalancerName", regionState.ProvisionedELBName)
+			return
+		}
+
+		notify.Publish(log, config, environment, notify.Event{
+			Event:   constants.EventHealthCheckPassed,
+			Region:  regionName,
+			StackId: regionState.StackId,
+		})
+
+		success = promoteStack(log, roleSession, config.ServiceName,
+			environment.Name, region, regionState, cfnRoleARN)
+		return
+	}
+
 	destinationELB, err := environment.GetELBForRegion(region.Name, elbTag)
 	if err != nil || destinationELB == "" {
 		log.Error("Unable to find the ELB", "Environment", environment.Name)
@@ -93,6 +183,15 @@ func promoteService(log log15.Logger, env, regionName string,
 	log.Info("Destination ELB", "LoadBalancerName", destinationELB)
 	log.Info("Source ELB", "LoadBalancerName", regionState.ProvisionedELBName)
 
+	// the destination ELB isn't part of a stack so its connection draining
+	// timeout is set here
+	if environment.Drain != nil {
+		err = elb.SetConnectionDraining(elbClient, destinationELB, environment.DeregistrationDelay())
+		if err != nil {
+			log.Warn("elasticloadbalancing:ModifyLoadBalancerAttributes", "LoadBalancerName", destinationELB, "Error", err)
+		}
+	}
+
 	oldInstanceStates, err := elb.DescribeInstanceHealth(elbClient, destinationELB)
 	if err != nil {
 		log.Error("DescribeInstanceHealth", "LoadBalancerName", destinationELB, "Error", err)
@@ -141,6 +240,12 @@ func promoteService(log log15.Logger, env, regionName string,
 		return
 	}
 
+	notify.Publish(log, config, environment, notify.Event{
+		Event:   constants.EventHealthCheckPassed,
+		Region:  regionName,
+		StackId: regionState.StackId,
+	})
+
 	newInstanceIds := make([]string, len(newInstanceStates))
 	for i := 0; i < len(newInstanceStates); i++ {
 		newInstanceIds[i] = *newInstanceStates[i].InstanceId
@@ -162,7 +267,13 @@ func promoteService(log log15.Logger, env, regionName string,
 		return
 	}
 
+	oldInstanceIds := make([]string, 0, len(oldInstances))
+	for _, instance := range oldInstances {
+		oldInstanceIds = append(oldInstanceIds, *instance.InstanceId)
+	}
+
 	if len(oldInstances) > 0 {
+		PreDeregister(log, roleSession, environment, region, oldInstanceIds)
 		deregisterInstances(log, elbClient, destinationELB, oldInstances)
 	} else {
 		log.Warn("Nothing to remove from ELB", "LoadBalancerName", destinationELB)
@@ -171,12 +282,25 @@ func promoteService(log log15.Logger, env, regionName string,
 	elbTags := make(map[string]string)
 	elbTags[constants.PorterStackIdTag] = regionState.StackId
 	elbTags[constants.PorterVersion] = constants.Version
+	elbTags[constants.PorterSkewJustificationTag] = skewJustification
 	err = elb.AddTags(elbClient, destinationELB, elbTags)
 	if err != nil {
 		log.Warn("elb.AddTags", "Error", err)
 		log.Warn("Instance autoregistration will be broken")
 	}
 
+	if region.DNS != nil && !promoteDNS(log, roleSession, config.ServiceName,
+		environment.Name, region, destinationELB, cfnRoleARN) {
+		return
+	}
+
+	// prune deletes the previous stack once promotion succeeded so in-flight
+	// requests have to finish first
+	if environment.Drain != nil && len(oldInstanceIds) > 0 &&
+		!waitForDeregistration(log, elbClient, destinationELB, oldInstanceIds, drainTimeout(environment)) {
+		return
+	}
+
 	success = true
 	return
 
@@ -0,0 +1,132 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package promote
+
+import (
+	"time"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/inconshreveable/log15"
+)
+
+// The stack tags that must agree across regions before promotion
+var artifactTags = []string{
+	constants.PorterVersion,
+	constants.PorterServiceVersionTag,
+	constants.PorterPayloadChecksumTag,
+}
+
+type regionArtifacts struct {
+	regionName string
+	tags       map[string]string
+	success    bool
+}
+
+// checkSkew reports whether every region's provisioned stack was built from
+// the same service payload by the same version of porter
+func checkSkew(log log15.Logger, config *conf.Config, stack *provision_state.Stack) (skewed bool, success bool) {
+
+	if len(stack.Regions) < 2 {
+		success = true
+		return
+	}
+
+	environment, err := config.GetEnvironment(stack.Environment)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	artifactsChan := make(chan regionArtifacts)
+
+	for regionName, regionState := range stack.Regions {
+
+		go func(regionName string, regionState *provision_state.Region) {
+
+			artifactsChan <- describeArtifacts(log.New("Region", regionName),
+				environment, regionName, regionState)
+
+		}(regionName, regionState)
+	}
+
+	var first *regionArtifacts
+	success = true
+
+	for i := 0; i < len(stack.Regions); i++ {
+		artifacts := <-artifactsChan
+		if !artifacts.success {
+			success = false
+			continue
+		}
+
+		if first == nil {
+			first = &artifacts
+			continue
+		}
+
+		for _, key := range artifactTags {
+			if artifacts.tags[key] != first.tags[key] {
+				log.Warn("Regions are running different artifacts",
+					"Tag", key,
+					first.regionName, first.tags[key],
+					artifacts.regionName, artifacts.tags[key])
+				skewed = true
+			}
+		}
+	}
+
+	return
+}
+
+func describeArtifacts(log log15.Logger, environment *conf.Environment,
+	regionName string, regionState *provision_state.Region) (artifacts regionArtifacts) {
+
+	artifacts.regionName = regionName
+	artifacts.tags = make(map[string]string)
+
+	roleARN, err := environment.GetRoleARN(regionName)
+	if err != nil {
+		log.Error("GetRoleARN", "Error", err)
+		return
+	}
+
+	roleSession := aws_session.STS(regionName, roleARN, 1*time.Hour)
+	cfnClient := cloudformation.New(roleSession)
+
+	output, err := cloudformation.DescribeStack(cfnClient, regionState.StackId)
+	if err != nil {
+		log.Error("DescribeStack", "StackId", regionState.StackId, "Error", err)
+		return
+	}
+	if len(output.Stacks) != 1 {
+		log.Error("DescribeStack didn't return the stack", "StackId", regionState.StackId)
+		return
+	}
+
+	for _, tag := range output.Stacks[0].Tags {
+		if tag != nil && tag.Key != nil && tag.Value != nil {
+			artifacts.tags[*tag.Key] = *tag.Value
+		}
+	}
+
+	if artifacts.tags[constants.PorterPayloadChecksumTag] == "" {
+		log.Warn("Stack isn't tagged with its artifacts. It was provisioned by an older porter",
+			"StackId", regionState.StackId)
+	}
+
+	artifacts.success = true
+	return
+}
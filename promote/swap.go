@@ -0,0 +1,288 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package promote
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/aws/elb"
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	elblib "github.com/aws/aws-sdk-go/service/elb"
+	"github.com/inconshreveable/log15"
+)
+
+// PromotedDNSNameOutput is the output of the DNS stack that holds the load
+// balancer of the stack that's in DNS
+const PromotedDNSNameOutput = "PromotedDNSName"
+
+// swapTarget is a stack's load balancer in DNS
+type swapTarget struct {
+	stackId string
+	dnsName string
+}
+
+// setIdentifier is the stack's name which is unique among the service's
+// stacks
+func (recv swapTarget) setIdentifier() string {
+	// arn:aws:cloudformation:region:account:stack/name/id
+	parts := strings.Split(recv.stackId, "/")
+	if len(parts) == 3 {
+		return parts[1]
+	}
+	return recv.stackId
+}
+
+// swapRecord is one record of a step. weight is only used by the weighted
+// policy and primary by failover
+type swapRecord struct {
+	target  swapTarget
+	weight  int
+	primary bool
+}
+
+// promoteStack moves this region's record from the load balancer of the
+// stack that's in DNS to the provisioned stack's.
+//
+// Each step updates the DNS stack and then watches the provisioned stack's
+// instances for the swap interval. If any leave service the record is put
+// back on the previous stack and promotion fails. The previous stack is
+// only out of DNS after the last step so prune keeps it until then
+func promoteStack(log log15.Logger, roleSession *session.Session, serviceName, envName string,
+	region *conf.Region, regionState *provision_state.Region, cfnRoleARN string) (success bool) {
+
+	stackName := DNSStackName(serviceName, envName)
+	log = log.New("DNSName", region.DNS.Name, "StackName", stackName)
+
+	swap := region.DNS.Swap
+	cfnClient := cloudformation.New(roleSession)
+	elbClient := elb.New(roleSession)
+
+	stackOutputs, err := describeStackOutputs(cfnClient, regionState.StackId)
+	if err != nil {
+		log.Error("DescribeStack", "StackId", regionState.StackId, "Error", err)
+		return
+	}
+
+	next := swapTarget{
+		stackId: regionState.StackId,
+		dnsName: stackOutputs[constants.OutputStackDNSName],
+	}
+	if next.dnsName == "" {
+		log.Error("The provisioned stack has no load balancer output. Provision it again",
+			"StackId", regionState.StackId,
+			"Output", constants.OutputStackDNSName)
+		return
+	}
+
+	dnsOutputs, err := describeStackOutputs(cfnClient, stackName)
+	if err != nil {
+		log.Error("DescribeStack", "Error", err)
+		return
+	}
+
+	previous := swapTarget{
+		stackId: dnsOutputs[PromotedStackIdOutput],
+		dnsName: dnsOutputs[PromotedDNSNameOutput],
+	}
+
+	var steps [][]swapRecord
+	switch {
+	case previous.dnsName == "" || previous.stackId == next.stackId:
+		log.Info("No other stack is in DNS. Pointing it at the provisioned stack")
+		steps = append(steps, []swapRecord{{target: next, weight: 100, primary: true}})
+
+	case swap.Policy == conf.SwapPolicy_Failover:
+		steps = append(steps,
+			[]swapRecord{
+				{target: next, weight: 100, primary: true},
+				{target: previous},
+			},
+			[]swapRecord{{target: next, weight: 100, primary: true}},
+		)
+
+	default:
+		for _, weight := range swap.Steps {
+			step := []swapRecord{{target: next, weight: weight, primary: true}}
+			if weight < 100 {
+				step = append(step, swapRecord{target: previous, weight: 100 - weight})
+			}
+			steps = append(steps, step)
+		}
+	}
+
+	interval := time.Duration(swap.Interval) * time.Second
+
+	for i, step := range steps {
+		// the previous stack is what's in DNS until the last step
+		promoted := previous
+		if i == len(steps)-1 {
+			promoted = next
+		}
+
+		log.Info("Swap step",
+			"Step", i+1,
+			"Steps", len(steps),
+			"Policy", swap.Policy,
+			"Weight", step[0].weight)
+
+		if !updateDNSStack(log, cfnClient, stackName,
+			swapTemplate(region, serviceName, envName, promoted, step), cfnRoleARN) {
+			return
+		}
+
+		log.Info("Verifying the swap step", "Interval", interval)
+		if verifySwap(log, elbClient, regionState.ProvisionedELBName, interval) {
+			continue
+		}
+
+		if previous.dnsName == "" || previous.stackId == next.stackId {
+			log.Error("The provisioned stack failed verification and there's no stack to roll back to")
+			return
+		}
+
+		log.Error("The provisioned stack failed verification. Rolling DNS back", "StackId", previous.stackId)
+		rollback := []swapRecord{{target: previous, weight: 100, primary: true}}
+		if !updateDNSStack(log, cfnClient, stackName,
+			swapTemplate(region, serviceName, envName, previous, rollback), cfnRoleARN) {
+			log.Crit("Rolling DNS back failed")
+		}
+		return
+	}
+
+	success = true
+	return
+}
+
+// swapTemplate is the DNS stack for a step. Records of a stack keep the same
+// logical id in every step so changing its weight or role is an update
+// rather than a replacement
+func swapTemplate(region *conf.Region, serviceName, envName string,
+	promoted swapTarget, records []swapRecord) *cfn.Template {
+
+	swap := region.DNS.Swap
+
+	template := cfn.NewTemplate()
+	template.Description = "porter managed DNS for " + serviceName + " " + envName
+	template.Outputs = map[string]interface{}{
+		PromotedStackIdOutput: map[string]interface{}{
+			"Value": promoted.stackId,
+		},
+		PromotedDNSNameOutput: map[string]interface{}{
+			"Value": promoted.dnsName,
+		},
+	}
+
+	for _, record := range records {
+		logicalId := nonAlphanumericRegex.ReplaceAllString(record.target.setIdentifier(), "")
+
+		// CNAMEs because an alias record's TTL is the load balancer's
+		properties := map[string]interface{}{
+			"Type":            "CNAME",
+			"HostedZoneName":  region.HostedZoneName,
+			"Name":            region.DNS.Name,
+			"SetIdentifier":   record.target.setIdentifier(),
+			"TTL":             strconv.Itoa(swap.TTL),
+			"ResourceRecords": []string{record.target.dnsName},
+		}
+
+		switch swap.Policy {
+		case conf.SwapPolicy_Failover:
+			if record.primary {
+				healthCheckLogicalId := "HealthCheck" + logicalId
+				template.SetResource(healthCheckLogicalId, swapHealthCheck(region, record.target))
+
+				properties["Failover"] = "PRIMARY"
+				properties["HealthCheckId"] = map[string]interface{}{"Ref": healthCheckLogicalId}
+			} else {
+				properties["Failover"] = "SECONDARY"
+			}
+		default:
+			properties["Weight"] = record.weight
+		}
+
+		template.SetResource("Record"+logicalId, map[string]interface{}{
+			"Type":       cfn.Route53_RecordSet,
+			"Properties": properties,
+		})
+	}
+
+	return template
+}
+
+// swapHealthCheck is what Route53 fails over on. It checks the stack's load
+// balancer the same way the load balancer checks instances
+func swapHealthCheck(region *conf.Region, target swapTarget) map[string]interface{} {
+	return map[string]interface{}{
+		"Type": cfn.Route53_HealthCheck,
+		"Properties": map[string]interface{}{
+			"HealthCheckConfig": map[string]interface{}{
+				"Type":                     "HTTP",
+				"FullyQualifiedDomainName": target.dnsName,
+				"Port":                     80,
+				"ResourcePath":             region.HealthCheckPath(),
+				"RequestInterval":          10, // Route53 only allows 10 or 30
+				"FailureThreshold":         constants.HC_UnhealthyThreshold,
+			},
+			"HealthCheckTags": []interface{}{
+				map[string]interface{}{"Key": "Name", "Value": target.setIdentifier()},
+			},
+		},
+	}
+}
+
+// verifySwap watches the provisioned stack's instances for the interval. A
+// step fails if any of them leave service
+func verifySwap(log log15.Logger, elbClient *elblib.ELB, elbName string, interval time.Duration) bool {
+	log = log.New("LoadBalancerName", elbName)
+
+	deadline := time.Now().Add(interval)
+	for {
+		instanceStates, err := elb.DescribeInstanceHealth(elbClient, elbName)
+		if err != nil {
+			log.Error("DescribeInstanceHealth", "Error", err)
+			return false
+		}
+
+		if len(instanceStates) == 0 {
+			log.Error("The load balancer has no instances")
+			return false
+		}
+
+		for _, instanceState := range instanceStates {
+			if instanceState == nil || instanceState.State == nil {
+				continue
+			}
+
+			if *instanceState.State != elb.InService {
+				log.Error("Instance left service",
+					"InstanceId", aws.StringValue(instanceState.InstanceId),
+					"InstanceState", *instanceState.State)
+				return false
+			}
+		}
+
+		if !time.Now().Before(deadline) {
+			log.Info("All ELB instances stayed InService")
+			return true
+		}
+
+		time.Sleep(sleepDuration)
+	}
+}
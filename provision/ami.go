@@ -0,0 +1,134 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"github.com/adobe-platform/porter/aws/ec2"
+	"github.com/adobe-platform/porter/aws/ssm"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/inconshreveable/log15"
+)
+
+// resolveImageId turns the environment's ami block into the image the
+// region's instances launch and records it with the deployment. A pinned ami
+// reuses the image of the region's last deployment if it has one
+func (recv *stackCreator) resolveImageId() (success bool) {
+	ami := recv.environment.AMI
+	if ami == nil {
+		success = true
+		return
+	}
+
+	log := recv.log
+
+	var image ec2.Image
+
+	if ami.Pin && recv.previousImageId != "" {
+		log.Info("Using the pinned AMI", "ImageId", recv.previousImageId)
+
+		var err error
+		finder := ec2.ImageFinder{Client: ec2.New(recv.roleSession)}
+		image, err = finder.Describe(recv.previousImageId)
+		if err != nil {
+			log.Error("DescribeImages", "ImageId", recv.previousImageId, "Error", err)
+			return
+		}
+	} else {
+		var found bool
+		image, found = findImage(log, recv.roleSession, recv.config.ServiceName, recv.environment.Name, ami)
+		if !found {
+			return
+		}
+	}
+
+	// validation made sure the region's instances have one architecture
+	architectures := recv.environment.RegionArchitectures(&recv.region)
+	if imageArchitecture(image.Architecture) != architectures[0] {
+		log.Error("The AMI's architecture isn't the architecture of the region's instances",
+			"ImageId", image.ImageId,
+			"ImageArchitecture", image.Architecture,
+			"Architecture", architectures[0])
+		return
+	}
+
+	log.Info("Resolved the AMI", "ImageId", image.ImageId, "Name", image.Name)
+
+	recv.imageId = image.ImageId
+	recv.deployment.ImageId = image.ImageId
+
+	success = true
+	return
+}
+
+// findImage looks up the image an ami block refers to
+func findImage(log log15.Logger, roleSession *session.Session, serviceName, envName string,
+	ami *conf.AMI) (image ec2.Image, success bool) {
+
+	finder := ec2.ImageFinder{Client: ec2.New(roleSession)}
+
+	var err error
+
+	switch {
+	case ami.SSMParameter != "":
+		log = log.New("SSMParameter", ami.SSMParameter)
+
+		image, success = imageOfParameter(log, roleSession, ami.SSMParameter)
+		return
+
+	case ami.Baked:
+		image, err = finder.FindLatest([]string{"self"}, "", bakedImageTags(serviceName, envName))
+		if err != nil {
+			log.Error("No AMI was baked for the environment. Run porter bake", "Error", err)
+			return
+		}
+
+	default:
+		image, err = finder.FindLatest(ami.Owners, ami.Name, ami.Tags)
+		if err != nil {
+			log.Error("DescribeImages", "Owners", ami.Owners, "Name", ami.Name, "Error", err)
+			return
+		}
+	}
+
+	success = true
+	return
+}
+
+// imageOfParameter describes the image whose id is the SSM parameter's value
+func imageOfParameter(log log15.Logger, roleSession *session.Session, name string) (image ec2.Image, success bool) {
+	output, err := ssm.New(roleSession).GetParameter(&ssm.GetParameterInput{
+		Name: name,
+	})
+	if err != nil {
+		log.Error("ssm:GetParameter", "Error", err)
+		return
+	}
+
+	finder := ec2.ImageFinder{Client: ec2.New(roleSession)}
+	image, err = finder.Describe(output.Parameter.Value)
+	if err != nil {
+		log.Error("DescribeImages", "ImageId", output.Parameter.Value, "Error", err)
+		return
+	}
+
+	success = true
+	return
+}
+
+// imageArchitecture is the docker name of EC2's name for an architecture
+func imageArchitecture(ec2Architecture string) string {
+	if ec2Architecture == "x86_64" {
+		return conf.Architecture_AMD64
+	}
+	return ec2Architecture
+}
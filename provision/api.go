@@ -12,14 +12,17 @@
 package provision
 
 import (
+	"context"
 	"sync"
 	"time"
 
+	"github.com/adobe-platform/porter/artifact_store"
 	"github.com/adobe-platform/porter/aws/cloudformation"
 	"github.com/adobe-platform/porter/aws_session"
 	"github.com/adobe-platform/porter/conf"
 	"github.com/adobe-platform/porter/constants"
 	"github.com/adobe-platform/porter/provision_state"
+	"github.com/adobe-platform/porter/tracing"
 	"github.com/aws/aws-sdk-go/aws"
 	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/inconshreveable/log15"
@@ -31,11 +34,23 @@ type (
 		Region      string
 		SecretsKey  string
 		SecretsLoc  string
+
+		// SecretParameters are NoEcho parameters by name
+		SecretParameters map[string]string
+
 		TemplateUrl string
+		// TemplateBody is set instead of TemplateUrl when the artifact store
+		// isn't S3
+		TemplateBody string
+		Tags         []*cfnlib.Tag
+
+		// CFNRoleARN is the service role CloudFormation uses if it isn't
+		// empty
+		CFNRoleARN string
 	}
 )
 
-func CreateStack(log log15.Logger, config *conf.Config, stack *provision_state.Stack) bool {
+func CreateStack(ctx context.Context, log log15.Logger, config *conf.Config, stack *provision_state.Stack) bool {
 
 	var err error
 
@@ -45,6 +60,24 @@ func CreateStack(log log15.Logger, config *conf.Config, stack *provision_state.S
 		return false
 	}
 
+	return createStackInRegions(ctx, log, config, stack, nil)
+}
+
+// ResumeStack creates the stack in the regions a resumed deploy hasn't created
+// it in yet. The stack keeps its name so every region's stack has the same one
+func ResumeStack(ctx context.Context, log log15.Logger, config *conf.Config, stack *provision_state.Stack, regionNames []string) bool {
+
+	regions := make(map[string]bool)
+	for _, regionName := range regionNames {
+		regions[regionName] = true
+	}
+
+	return createStackInRegions(ctx, log, config, stack, regions)
+}
+
+func createStackInRegions(ctx context.Context, log log15.Logger, config *conf.Config, stack *provision_state.Stack,
+	regions map[string]bool) bool {
+
 	var fLock sync.RWMutex
 
 	cfnAPI := func(client *cfnlib.CloudFormation, input CfnApiInput) (stackId string, success bool) {
@@ -66,7 +99,20 @@ func CreateStack(log log15.Logger, config *conf.Config, stack *provision_state.S
 			},
 		}
 
-		stackId, err := cloudformation.CreateStack(client, stack.Name, input.TemplateUrl, parameters)
+		for name, value := range input.SecretParameters {
+			parameters = append(parameters, &cfnlib.Parameter{
+				ParameterKey:   aws.String(name),
+				ParameterValue: aws.String(value),
+			})
+		}
+
+		stackId, err := cloudformation.CreateStack(client, stack.Name, input.TemplateUrl, input.TemplateBody, parameters, input.Tags,
+			input.CFNRoleARN)
+		if err == cloudformation.ErrAudited {
+			// an empty stack id stops the region without failing it
+			success = true
+			return
+		}
 		if err != nil {
 			log.Error("CreateStack API call failed", "Error", err)
 			return
@@ -75,10 +121,10 @@ func CreateStack(log log15.Logger, config *conf.Config, stack *provision_state.S
 		return
 	}
 
-	return createUpdateStack(log, stack, config, cfnAPI)
+	return createUpdateStack(ctx, log, stack, config, cfnAPI, regions)
 }
 
-func UpdateStack(log log15.Logger, config *conf.Config, stack provision_state.Stack) bool {
+func UpdateStack(ctx context.Context, log log15.Logger, config *conf.Config, stack provision_state.Stack) bool {
 
 	var fLock sync.RWMutex
 
@@ -109,7 +155,19 @@ func UpdateStack(log log15.Logger, config *conf.Config, stack provision_state.St
 			},
 		}
 
-		err := cloudformation.UpdateStack(client, regionOutput.StackId, input.TemplateUrl, parameters)
+		for name, value := range input.SecretParameters {
+			parameters = append(parameters, &cfnlib.Parameter{
+				ParameterKey:   aws.String(name),
+				ParameterValue: aws.String(value),
+			})
+		}
+
+		if !checkTemplateProvenance(ctx, log.New("Region", input.Region), client, regionOutput.StackId, config.ServiceName) {
+			return
+		}
+
+		err := cloudformation.UpdateStack(client, regionOutput.StackId, input.TemplateUrl, input.TemplateBody, parameters, input.Tags,
+			input.CFNRoleARN)
 		if err != nil {
 			log.Error("UpdateStack API call failed", "Error", err)
 			return
@@ -120,14 +178,16 @@ func UpdateStack(log log15.Logger, config *conf.Config, stack provision_state.St
 		return
 	}
 
-	return createUpdateStack(log, &stack, config, cfnAPI)
+	return createUpdateStack(ctx, log, &stack, config, cfnAPI, nil)
 }
 
 func createUpdateStack(
+	ctx context.Context,
 	log log15.Logger,
 	stack *provision_state.Stack,
 	config *conf.Config,
-	cfnAPI func(*cfnlib.CloudFormation, CfnApiInput) (string, bool)) (success bool) {
+	cfnAPI func(*cfnlib.CloudFormation, CfnApiInput) (string, bool),
+	regions map[string]bool) (success bool) {
 
 	environment, err := config.GetEnvironment(stack.Environment)
 	if err != nil {
@@ -140,29 +200,76 @@ func createUpdateStack(
 	}
 
 	successChan := make(chan bool)
+	regionCount := 0
+
+	stateStore := GetStateStore(config)
 
 	for _, region := range environment.Regions {
 
+		// nil means every region
+		if regions != nil && !regions[region.Name] {
+			continue
+		}
+		regionCount++
+
 		roleARN, err := environment.GetRoleARN(region.Name)
 		if err != nil {
 			log.Error("GetRoleARN", "Error", err)
 			return
 		}
 
-		roleSession := aws_session.STS(region.Name, roleARN, 1*time.Hour)
+		roleSession := aws_session.WithContext(ctx, aws_session.STS(region.Name, roleARN, 1*time.Hour))
+
+		artifactStore, err := artifact_store.New(config, region, roleSession)
+		if err != nil {
+			log.Error("artifact_store.New", "Region", region.Name, "Error", err)
+			return
+		}
+
+		// the previous deployment is read before this one overwrites it
+		previous, err := stateStore.Get(config.ServiceName, environment.Name, region.Name)
+		if err != nil {
+			log.Warn("State store Get", "Region", region.Name, "Error", err)
+		}
+		stackColor := provision_state.NextStackColor(previous, stack.Name)
+
+		// carried over so a deploy that fails before resolving the AMI
+		// doesn't lose the pinned one
+		var previousImageId string
+		if previous != nil && environment.AMI != nil {
+			previousImageId = previous.ImageId
+		}
 
 		recv := &stackCreator{
+			ctx: ctx,
 			log: log.New("Region", region.Name),
 
 			config:      *config,
 			environment: *environment,
 			region:      *region,
 
-			roleSession: roleSession,
+			previousImageId: previousImageId,
+
+			roleSession:   roleSession,
+			artifactStore: artifactStore,
+
+			stateStore: stateStore,
+			deployment: &provision_state.Deployment{
+				ServiceName:    config.ServiceName,
+				Environment:    environment.Name,
+				Region:         region.Name,
+				ServiceVersion: config.ServiceVersion,
+				StackName:      stack.Name,
+				StackColor:     stackColor,
+				Hotswap:        stack.Hotswap,
+				ImageId:        previousImageId,
+			},
 
 			cfnAPI: cfnAPI,
 
 			templateTransforms: make(map[string][]MapResource),
+
+			span: tracing.Start(tracing.Root(), "provision region").SetAttribute("region", region.Name),
 		}
 
 		var regionState *provision_state.Region
@@ -182,7 +289,7 @@ func createUpdateStack(
 
 	success = true
 
-	for i := 0; i < len(environment.Regions); i++ {
+	for i := 0; i < regionCount; i++ {
 		regionSuccess := <-successChan
 		success = success && regionSuccess
 	}
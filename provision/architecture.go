@@ -0,0 +1,73 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"strings"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+)
+
+// instanceType is the instance type of the resource's instance group. It's
+// the region's or environment's without instance groups
+func (recv *stackCreator) instanceType(resource map[string]interface{}) (string, error) {
+	group, err := recv.instanceGroup(resource)
+	if err != nil {
+		return "", err
+	}
+	if group != nil {
+		return group.InstanceType, nil
+	}
+
+	return recv.environment.GetInstanceType(recv.region.Name)
+}
+
+// architecture is the architecture of the instances of the resource's
+// instance group
+func (recv *stackCreator) architecture(resource map[string]interface{}) (string, error) {
+	instanceType, err := recv.instanceType(resource)
+	if err != nil {
+		return "", err
+	}
+
+	return conf.InstanceArchitecture(instanceType), nil
+}
+
+// porterBinaryUrl is the linux build of porter for the architecture. The
+// arm64 build is released next to the x86 one
+func porterBinaryUrl(architecture string) string {
+	if architecture == conf.Architecture_ARM64 {
+		return strings.Replace(constants.BinaryUrl, "porter_linux386", "porter_linuxarm64", 1)
+	}
+	return constants.BinaryUrl
+}
+
+// verifyArchitectures checks the payload has an image of every container for
+// every architecture of the region's instances. Otherwise instances fail to
+// start containers long after the stack is created
+func (recv *stackCreator) verifyArchitectures() (success bool) {
+	for _, architecture := range recv.environment.RegionArchitectures(&recv.region) {
+		for _, container := range recv.region.Containers {
+			if !container.HasArchitecture(architecture) {
+				recv.log.Error("The service payload has no image for the architecture of the region's instances. Build it again",
+					"Container", container.OriginalName,
+					"Architecture", architecture,
+					"Architectures", container.Architectures)
+				return
+			}
+		}
+	}
+
+	success = true
+	return
+}
@@ -0,0 +1,201 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/inconshreveable/log15"
+)
+
+// ArtifactManifest describes a packed service payload and the config it was
+// packed with. The files are relative to the manifest so an artifact can be
+// moved as a directory between build boxes, accounts, and CI stages
+type ArtifactManifest struct {
+	ServiceName     string    `json:"service_name"`
+	ServiceVersion  string    `json:"service_version"`
+	PorterVersion   string    `json:"porter_version"`
+	Payload         string    `json:"payload"`
+	PayloadChecksum string    `json:"payload_checksum"`
+	Config          string    `json:"config"`
+	ConfigChecksum  string    `json:"config_checksum"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// ReadArtifactManifest parses the manifest at manifestPath
+func ReadArtifactManifest(manifestPath string) (*ArtifactManifest, error) {
+	manifestBytes, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &ArtifactManifest{}
+	err = json.Unmarshal(manifestBytes, manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	if manifest.Payload == "" || manifest.Config == "" {
+		return nil, fmt.Errorf("%s is missing its payload or config", manifestPath)
+	}
+
+	return manifest, nil
+}
+
+// Verify checks the artifact's files in dir are the ones it was built with
+func (recv *ArtifactManifest) Verify(dir string) error {
+	err := verifyArtifactFile(filepath.Join(dir, recv.Payload), recv.PayloadChecksum)
+	if err != nil {
+		return err
+	}
+
+	return verifyArtifactFile(filepath.Join(dir, recv.Config), recv.ConfigChecksum)
+}
+
+func verifyArtifactFile(path, checksum string) error {
+	actual, err := fileChecksum(path)
+	if err != nil {
+		return err
+	}
+
+	if actual != checksum {
+		return fmt.Errorf("%s has checksum %s. The manifest expects %s", path, actual, checksum)
+	}
+
+	return nil
+}
+
+func fileChecksum(path string) (string, error) {
+	fileBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	checksumArray := sha256.Sum256(fileBytes)
+	return hex.EncodeToString(checksumArray[:]), nil
+}
+
+// WriteArtifact copies the packed service payload and config into dir and
+// writes a manifest describing them
+func WriteArtifact(log log15.Logger, config *conf.Config, dir string) (manifestPath string, success bool) {
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		log.Error("os.MkdirAll", "Path", dir, "Error", err)
+		return
+	}
+
+	manifest := &ArtifactManifest{
+		ServiceName:    config.ServiceName,
+		ServiceVersion: config.ServiceVersion,
+		PorterVersion:  constants.Version,
+		Payload:        constants.ArtifactPayloadFile,
+		Config:         constants.ServicePayloadConfigPath,
+		CreatedAt:      time.Now().UTC(),
+	}
+
+	var copySuccess bool
+
+	manifest.PayloadChecksum, copySuccess = copyArtifactFile(log, constants.PayloadPath, filepath.Join(dir, manifest.Payload))
+	if !copySuccess {
+		return
+	}
+
+	manifest.ConfigChecksum, copySuccess = copyArtifactFile(log, constants.AlteredConfigPath, filepath.Join(dir, manifest.Config))
+	if !copySuccess {
+		return
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		log.Error("json.MarshalIndent", "Error", err)
+		return
+	}
+
+	manifestPath = filepath.Join(dir, constants.ArtifactManifestFile)
+	err = ioutil.WriteFile(manifestPath, manifestBytes, 0644)
+	if err != nil {
+		log.Error("WriteFile", "Path", manifestPath, "Error", err)
+		return
+	}
+
+	success = true
+	return
+}
+
+// RestoreArtifact verifies the artifact and puts its service payload and
+// config where pack would have so the artifact can be deployed
+func RestoreArtifact(log log15.Logger, manifestPath string) (manifest *ArtifactManifest, success bool) {
+
+	manifest, err := ReadArtifactManifest(manifestPath)
+	if err != nil {
+		log.Error("ReadArtifactManifest", "Path", manifestPath, "Error", err)
+		return
+	}
+
+	if manifest.PorterVersion != constants.Version {
+		log.Error("The artifact was built by a different version of porter",
+			"ArtifactPorterVersion", manifest.PorterVersion,
+			"PorterVersion", constants.Version)
+		return
+	}
+
+	dir := filepath.Dir(manifestPath)
+
+	err = manifest.Verify(dir)
+	if err != nil {
+		log.Error("The artifact doesn't match its manifest", "Error", err)
+		return
+	}
+
+	err = os.MkdirAll(constants.TempDir, 0755)
+	if err != nil {
+		log.Error("os.MkdirAll", "Path", constants.TempDir, "Error", err)
+		return
+	}
+
+	if _, success = copyArtifactFile(log, filepath.Join(dir, manifest.Payload), constants.PayloadPath); !success {
+		return
+	}
+
+	_, success = copyArtifactFile(log, filepath.Join(dir, manifest.Config), constants.AlteredConfigPath)
+	return
+}
+
+func copyArtifactFile(log log15.Logger, src, dst string) (checksum string, success bool) {
+
+	fileBytes, err := ioutil.ReadFile(src)
+	if err != nil {
+		log.Error("ReadFile", "Path", src, "Error", err)
+		return
+	}
+
+	err = ioutil.WriteFile(dst, fileBytes, 0644)
+	if err != nil {
+		log.Error("WriteFile", "Path", dst, "Error", err)
+		return
+	}
+
+	checksumArray := sha256.Sum256(fileBytes)
+	checksum = hex.EncodeToString(checksumArray[:])
+	success = true
+	return
+}
@@ -0,0 +1,94 @@
+package provision_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/adobe-platform/porter/provision"
+)
+
+var _ = Describe("Artifact manifest", func() {
+
+	var (
+		dir          string
+		manifestPath string
+		manifest     provision.ArtifactManifest
+	)
+
+	checksum := func(contents string) string {
+		checksumArray := sha256.Sum256([]byte(contents))
+		return hex.EncodeToString(checksumArray[:])
+	}
+
+	writeManifest := func() {
+		manifestBytes, err := json.Marshal(manifest)
+		Expect(err).To(BeNil())
+		Expect(ioutil.WriteFile(manifestPath, manifestBytes, 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "porter-artifact")
+		Expect(err).To(BeNil())
+
+		manifestPath = filepath.Join(dir, "manifest.json")
+
+		Expect(ioutil.WriteFile(filepath.Join(dir, "payload.tar.gz"), []byte("payload"), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "config.yaml"), []byte("service_name: svc"), 0644)).To(Succeed())
+
+		manifest = provision.ArtifactManifest{
+			ServiceName:     "svc",
+			ServiceVersion:  "abc1234",
+			Payload:         "payload.tar.gz",
+			PayloadChecksum: checksum("payload"),
+			Config:          "config.yaml",
+			ConfigChecksum:  checksum("service_name: svc"),
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("reads and verifies an artifact", func() {
+		writeManifest()
+
+		read, err := provision.ReadArtifactManifest(manifestPath)
+		Expect(err).To(BeNil())
+		Expect(read.ServiceVersion).To(Equal("abc1234"))
+		Expect(read.Verify(dir)).To(Succeed())
+	})
+
+	It("rejects a manifest without a payload", func() {
+		manifest.Payload = ""
+		writeManifest()
+
+		_, err := provision.ReadArtifactManifest(manifestPath)
+		Expect(err).ToNot(BeNil())
+	})
+
+	It("rejects a payload that changed", func() {
+		writeManifest()
+		Expect(ioutil.WriteFile(filepath.Join(dir, "payload.tar.gz"), []byte("rebuilt"), 0644)).To(Succeed())
+
+		read, err := provision.ReadArtifactManifest(manifestPath)
+		Expect(err).To(BeNil())
+		Expect(read.Verify(dir)).ToNot(Succeed())
+	})
+
+	It("rejects a config that changed", func() {
+		writeManifest()
+		Expect(ioutil.WriteFile(filepath.Join(dir, "config.yaml"), []byte("service_name: other"), 0644)).To(Succeed())
+
+		read, err := provision.ReadArtifactManifest(manifestPath)
+		Expect(err).To(BeNil())
+		Expect(read.Verify(dir)).ToNot(Succeed())
+	})
+})
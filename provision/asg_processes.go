@@ -0,0 +1,112 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"github.com/adobe-platform/porter/constants"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/inconshreveable/log15"
+)
+
+// DeployProcesses are suspended while a deploy swaps instances in place.
+// Either one can terminate an instance the swap is waiting on
+var DeployProcesses = []string{
+	constants.ProcessAZRebalance,
+	constants.ProcessReplaceUnhealthy,
+}
+
+// SuspendProcesses suspends the processes of each autoscaling group that
+// aren't already suspended. suspended is what this call suspended, by group,
+// so resuming it leaves processes someone else suspended alone
+func SuspendProcesses(log log15.Logger, roleSession *session.Session,
+	asgNames []string, processes []string) (suspended map[string][]string, success bool) {
+
+	asgClient := autoscaling.New(roleSession)
+	suspended = make(map[string][]string)
+
+	for _, asgName := range asgNames {
+		log := log.New("AutoScalingGroupName", asgName)
+
+		log.Info("autoscaling:DescribeAutoScalingGroups")
+		output, err := asgClient.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+			AutoScalingGroupNames: []*string{aws.String(asgName)},
+		})
+		if err != nil {
+			log.Error("autoscaling:DescribeAutoScalingGroups", "Error", err)
+			return
+		}
+		if len(output.AutoScalingGroups) != 1 {
+			log.Error("len(output.AutoScalingGroups) != 1")
+			return
+		}
+
+		alreadySuspended := make(map[string]struct{})
+		for _, process := range output.AutoScalingGroups[0].SuspendedProcesses {
+			alreadySuspended[aws.StringValue(process.ProcessName)] = struct{}{}
+		}
+
+		toSuspend := make([]string, 0)
+		for _, process := range processes {
+			if _, exists := alreadySuspended[process]; exists {
+				log.Info("Process is already suspended", "Process", process)
+				continue
+			}
+			toSuspend = append(toSuspend, process)
+		}
+
+		if len(toSuspend) == 0 {
+			continue
+		}
+
+		log.Info("autoscaling:SuspendProcesses", "Processes", toSuspend)
+		_, err = asgClient.SuspendProcesses(&autoscaling.ScalingProcessQuery{
+			AutoScalingGroupName: aws.String(asgName),
+			ScalingProcesses:     aws.StringSlice(toSuspend),
+		})
+		if err != nil {
+			log.Error("autoscaling:SuspendProcesses", "Error", err)
+			return
+		}
+
+		suspended[asgName] = toSuspend
+	}
+
+	success = true
+	return
+}
+
+// ResumeProcesses resumes the processes of each autoscaling group. Every group
+// is attempted even if one fails
+func ResumeProcesses(log log15.Logger, roleSession *session.Session,
+	processes map[string][]string) (success bool) {
+
+	asgClient := autoscaling.New(roleSession)
+	success = true
+
+	for asgName, groupProcesses := range processes {
+		log := log.New("AutoScalingGroupName", asgName)
+
+		log.Info("autoscaling:ResumeProcesses", "Processes", groupProcesses)
+		_, err := asgClient.ResumeProcesses(&autoscaling.ScalingProcessQuery{
+			AutoScalingGroupName: aws.String(asgName),
+			ScalingProcesses:     aws.StringSlice(groupProcesses),
+		})
+		if err != nil {
+			log.Error("autoscaling:ResumeProcesses", "Error", err)
+			success = false
+		}
+	}
+
+	return
+}
@@ -0,0 +1,408 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/adobe-platform/porter/artifact_store"
+	"github.com/adobe-platform/porter/aws/ec2"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/cfn_template"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/files"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	ec2lib "github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/inconshreveable/log15"
+)
+
+// what files.PorterBake writes to the console
+const (
+	bakeSucceeded = "porter bake SUCCEEDED"
+	bakeFailed    = "porter bake FAILED"
+)
+
+var bakePollInterval = 15 * time.Second
+
+type bakeContext struct {
+	LatestPackages  bool
+	PorterBinaryUrl string
+
+	// a presigned URL of the service payload. Images aren't baked without it
+	PayloadUrl      string
+	ImageNames      []string
+	ImageFileSuffix string
+}
+
+// Bake makes an AMI in each of the environment's regions with the packages
+// and porter binary instances install while they boot. With bake images the
+// service's images are loaded from the service payload pack created too.
+//
+// An ami block with baked: true launches the newest one
+func Bake(log log15.Logger, config *conf.Config, environment *conf.Environment) (success bool) {
+	if environment.Bake == nil {
+		log.Error("The environment has no bake block", "Environment", environment.Name)
+		return
+	}
+
+	var payloadBytes []byte
+	if environment.Bake.Images {
+		var err error
+		payloadBytes, err = ioutil.ReadFile(constants.PayloadPath)
+		if err != nil {
+			log.Error("bake images needs the service payload. Run porter build pack first",
+				"Path", constants.PayloadPath, "Error", err)
+			return
+		}
+	}
+
+	successChan := make(chan bool)
+
+	for _, region := range environment.Regions {
+
+		go func(region conf.Region) {
+
+			successChan <- bakeRegion(log.New("Region", region.Name), config, environment, region, payloadBytes)
+
+		}(*region)
+	}
+
+	success = true
+
+	for i := 0; i < len(environment.Regions); i++ {
+		regionSuccess := <-successChan
+		success = success && regionSuccess
+	}
+
+	return
+}
+
+func bakeRegion(log log15.Logger, config *conf.Config, environment *conf.Environment,
+	region conf.Region, payloadBytes []byte) (success bool) {
+
+	bake := environment.Bake
+
+	roleARN, err := environment.GetRoleARN(region.Name)
+	if err != nil {
+		log.Error("GetRoleARN", "Error", err)
+		return
+	}
+
+	roleSession := aws_session.STS(region.Name, roleARN, 0)
+	client := ec2.New(roleSession)
+
+	if len(region.VpcTags) > 0 || len(region.SubnetTags) > 0 {
+		err = region.DiscoverNetwork(ec2.NetworkFinder{Client: client})
+		if err != nil {
+			log.Error("Network discovery", "Error", err)
+			return
+		}
+	}
+
+	// validation made sure the region's instances have one architecture
+	architecture := environment.RegionArchitectures(&region)[0]
+
+	instanceType := bake.InstanceType
+	if instanceType == "" && len(environment.InstanceGroups) > 0 {
+		instanceType = environment.InstanceGroups[0].InstanceType
+	}
+	if instanceType == "" {
+		instanceType, err = environment.GetInstanceType(region.Name)
+		if err != nil {
+			log.Error("GetInstanceType", "Error", err)
+			return
+		}
+	}
+
+	sourceImage, found := bakeSourceImage(log, roleSession, config, environment, region.Name, architecture)
+	if !found {
+		return
+	}
+
+	log = log.New("SourceImageId", sourceImage.ImageId)
+
+	context := bakeContext{
+		LatestPackages:  architecture == conf.Architecture_ARM64 || environment.AMI != nil,
+		PorterBinaryUrl: porterBinaryUrl(architecture),
+		ImageFileSuffix: conf.ImageFileSuffix(architecture),
+	}
+
+	timeout := time.Duration(bake.Timeout) * time.Minute
+
+	if bake.Images {
+		context.PayloadUrl, found = stageBakePayload(log, roleSession, config, environment, region, payloadBytes, timeout)
+		if !found {
+			return
+		}
+
+		seen := make(map[string]struct{})
+		for _, container := range region.Containers {
+			if _, exists := seen[container.Name]; !exists {
+				seen[container.Name] = struct{}{}
+				context.ImageNames = append(context.ImageNames, container.Name)
+			}
+		}
+	}
+
+	tmpl, err := template.New("").Parse(files.PorterBake)
+	if err != nil {
+		log.Error("template.Parse", "Error", err)
+		return
+	}
+
+	var userData bytes.Buffer
+	err = tmpl.Execute(&userData, context)
+	if err != nil {
+		log.Error("template.Execute", "Error", err)
+		return
+	}
+
+	runInput := &ec2lib.RunInstancesInput{
+		ImageId:                           aws.String(sourceImage.ImageId),
+		InstanceType:                      aws.String(instanceType),
+		MinCount:                          aws.Int64(1),
+		MaxCount:                          aws.Int64(1),
+		UserData:                          aws.String(base64.StdEncoding.EncodeToString(userData.Bytes())),
+		InstanceInitiatedShutdownBehavior: aws.String("stop"),
+	}
+
+	// the VPC's default security group allows the egress the script needs
+	if len(region.AZs) > 0 && region.AZs[0].SubnetID != "" {
+		runInput.SubnetId = aws.String(region.AZs[0].SubnetID)
+	}
+
+	reservation, err := client.RunInstances(runInput)
+	if err != nil {
+		log.Error("ec2:RunInstances", "Error", err)
+		return
+	}
+
+	instanceId := aws.StringValue(reservation.Instances[0].InstanceId)
+	log = log.New("InstanceId", instanceId)
+
+	defer func() {
+		_, err := client.TerminateInstances(&ec2lib.TerminateInstancesInput{
+			InstanceIds: []*string{aws.String(instanceId)},
+		})
+		if err != nil {
+			log.Error("Terminate the builder instance by hand", "Error", err)
+		}
+	}()
+
+	err = ec2.NameResource(client, instanceId, fmt.Sprintf("porter-bake-%s-%s", config.ServiceName, environment.Name))
+	if err != nil {
+		log.Warn("ec2:CreateTags", "Error", err)
+	}
+
+	log.Info("Waiting for the builder instance to stop", "Timeout", timeout)
+	if !waitForBake(log, client, instanceId, timeout) {
+		return
+	}
+
+	imageName := fmt.Sprintf("porter-%s-%s-%d", config.ServiceName, environment.Name, time.Now().Unix())
+
+	createImageOutput, err := client.CreateImage(&ec2lib.CreateImageInput{
+		InstanceId:  aws.String(instanceId),
+		Name:        aws.String(imageName),
+		Description: aws.String("porter bake of " + config.ServiceName + " " + environment.Name),
+	})
+	if err != nil {
+		log.Error("ec2:CreateImage", "Error", err)
+		return
+	}
+
+	imageId := aws.StringValue(createImageOutput.ImageId)
+	log = log.New("ImageId", imageId)
+
+	tags := bakedImageTags(config.ServiceName, environment.Name)
+	tags[constants.PorterBakedFromTag] = sourceImage.ImageId
+	tags[constants.PorterVersion] = constants.Version
+	if bake.Images {
+		tags[constants.PorterServiceVersionTag] = config.ServiceVersion
+	}
+
+	var ec2Tags []*ec2lib.Tag
+	for key, value := range tags {
+		ec2Tags = append(ec2Tags, &ec2lib.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(value),
+		})
+	}
+
+	// tagged right away so a failed wait doesn't leave an image porter can't
+	// find. An image that isn't available isn't found either
+	_, err = client.CreateTags(&ec2lib.CreateTagsInput{
+		Resources: []*string{aws.String(imageId)},
+		Tags:      ec2Tags,
+	})
+	if err != nil {
+		log.Error("ec2:CreateTags", "Error", err)
+		return
+	}
+
+	log.Info("Waiting for the AMI to be available")
+	err = client.WaitUntilImageAvailable(&ec2lib.DescribeImagesInput{
+		ImageIds: []*string{aws.String(imageId)},
+	})
+	if err != nil {
+		log.Error("WaitUntilImageAvailable", "Error", err)
+		return
+	}
+
+	log.Info("Baked the AMI", "Name", imageName)
+
+	success = true
+	return
+}
+
+// bakeSourceImage is the image instances would launch without a baked AMI
+func bakeSourceImage(log log15.Logger, roleSession *session.Session, config *conf.Config,
+	environment *conf.Environment, regionName, architecture string) (image ec2.Image, success bool) {
+
+	if ami := environment.AMI; ami != nil && !ami.Baked {
+		image, success = findImage(log, roleSession, config.ServiceName, environment.Name, ami)
+		return
+	}
+
+	if architecture == conf.Architecture_ARM64 {
+		image, success = imageOfParameter(log, roleSession, constants.ImageIdArm64SSMPath)
+		return
+	}
+
+	mapping, _ := cfn_template.RegionToAmazonLinuxAMI()[regionName].(map[string]interface{})
+	imageId, _ := mapping["Key"].(string)
+	if imageId == "" {
+		log.Error("porter has no Amazon Linux AMI for the region. Define an ami block")
+		return
+	}
+
+	finder := ec2.ImageFinder{Client: ec2.New(roleSession)}
+	image, err := finder.Describe(imageId)
+	if err != nil {
+		log.Error("DescribeImages", "ImageId", imageId, "Error", err)
+		return
+	}
+
+	success = true
+	return
+}
+
+// stageBakePayload uploads the service payload to the region's bucket and
+// returns a URL the builder instance can download it from without an
+// instance profile
+func stageBakePayload(log log15.Logger, roleSession *session.Session, config *conf.Config,
+	environment *conf.Environment, region conf.Region, payloadBytes []byte,
+	expiry time.Duration) (payloadUrl string, success bool) {
+
+	checksumArray := sha256.Sum256(payloadBytes)
+	key := fmt.Sprintf("porter-bake/%s/%s/%s.tar", config.ServiceName, environment.Name,
+		hex.EncodeToString(checksumArray[:]))
+
+	store := &artifact_store.S3{
+		Session:     roleSession,
+		Bucket:      region.S3Bucket,
+		SSEKMSKeyId: region.SSEKMSKeyId,
+		BucketKey:   region.BucketKeyEnabled(),
+	}
+
+	log.Info("Uploading service payload", "S3key", key)
+	err := store.Put(artifact_store.Object{
+		Key:             key,
+		Body:            payloadBytes,
+		ContentType:     "application/x-tar",
+		ContentEncoding: "gzip",
+		Infrequent:      true,
+	})
+	if err != nil {
+		log.Error("Upload failure", "Error", err)
+		return
+	}
+
+	req, _ := s3.New(roleSession).GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(region.S3Bucket),
+		Key:    aws.String(key),
+	})
+	payloadUrl, err = req.Presign(expiry)
+	if err != nil {
+		log.Error("Presign", "Error", err)
+		return
+	}
+
+	success = true
+	return
+}
+
+// waitForBake waits for files.PorterBake to stop the instance. It fails fast
+// if the script reports a failure on the console
+func waitForBake(log log15.Logger, client *ec2lib.EC2, instanceId string, timeout time.Duration) (success bool) {
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(bakePollInterval)
+
+		reservations, err := ec2.DescribeInstances(client, nil, instanceId)
+		if err != nil {
+			log.Warn("DescribeInstances", "Error", err)
+			continue
+		}
+
+		if len(reservations) == 1 && len(reservations[0].Instances) == 1 {
+			instance := reservations[0].Instances[0]
+			if instance.State != nil {
+				switch aws.StringValue(instance.State.Name) {
+				case ec2lib.InstanceStateNameStopped:
+					success = true
+					return
+				case ec2lib.InstanceStateNameTerminated, ec2lib.InstanceStateNameShuttingDown:
+					log.Error("The builder instance was terminated")
+					return
+				}
+			}
+		}
+
+		consoleOutput, err := client.GetConsoleOutput(&ec2lib.GetConsoleOutputInput{
+			InstanceId: aws.String(instanceId),
+		})
+		if err != nil || consoleOutput.Output == nil {
+			continue
+		}
+
+		output, err := base64.StdEncoding.DecodeString(*consoleOutput.Output)
+		if err == nil && strings.Contains(string(output), bakeFailed) {
+			log.Error("The bake script failed. Its output is in the instance's console output")
+			return
+		}
+	}
+
+	log.Error("Timed out waiting for the builder instance to stop")
+	return
+}
+
+// bakedImageTags are the tags porter bake puts on an environment's AMIs and
+// baked: true looks them up by
+func bakedImageTags(serviceName, envName string) map[string]string {
+	return map[string]string{
+		constants.PorterServiceNameTag: serviceName,
+		constants.PorterEnvironmentTag: envName,
+	}
+}
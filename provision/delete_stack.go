@@ -0,0 +1,91 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/aws/kms"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/secrets"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/inconshreveable/log15"
+)
+
+// DeleteStack deletes a service stack and revokes the KMS grants that let its
+// hosts decrypt its secrets data keys. Every command that deletes a service
+// stack uses it so a deleted stack's grants don't outlive it
+func DeleteStack(log log15.Logger, roleSession *session.Session, stackId, cfnRoleARN string) (success bool) {
+	return DeleteStackRetaining(log, roleSession, stackId, nil, cfnRoleARN)
+}
+
+// DeleteStackRetaining is DeleteStack for a stack that failed to delete. The
+// resources in retainResources are left behind
+func DeleteStackRetaining(log log15.Logger, roleSession *session.Session, stackId string,
+	retainResources []*string, cfnRoleARN string) (success bool) {
+
+	log = log.New("StackId", stackId)
+	cfnClient := cloudformation.New(roleSession)
+
+	// read before the stack is deleted
+	output, err := cfnClient.DescribeStacks(&cfnlib.DescribeStacksInput{
+		StackName: aws.String(stackId),
+	})
+	if err != nil {
+		log.Error("cloudformation:DescribeStacks", "Error", err)
+		return
+	}
+	if len(output.Stacks) != 1 {
+		log.Error("cloudformation:DescribeStacks unexpected output")
+		return
+	}
+	stack := output.Stacks[0]
+
+	log.Info("cloudformation:DeleteStack", "RetainResources", aws.StringValueSlice(retainResources))
+	err = cloudformation.DeleteStackRetaining(cfnClient, stackId, retainResources, cfnRoleARN)
+	if err != nil {
+		log.Error("cloudformation:DeleteStack", "Error", err)
+		return
+	}
+
+	success = revokeSecretsGrants(log, roleSession, stack)
+	return
+}
+
+// revokeSecretsGrants revokes the KMS grants that let the stack's hosts
+// decrypt its secrets data keys. The key is read from the stack's tag since
+// secrets_kms_key_id may have changed since it was deployed
+func revokeSecretsGrants(log log15.Logger, roleSession *session.Session, stack *cfnlib.Stack) (success bool) {
+
+	var keyArn string
+	for _, tag := range stack.Tags {
+		if aws.StringValue(tag.Key) == constants.PorterSecretsKeyArnTag {
+			keyArn = aws.StringValue(tag.Value)
+		}
+	}
+
+	if keyArn == "" {
+		success = true
+		return
+	}
+
+	revoked, err := secrets.RevokeGrants(kms.New(roleSession), keyArn, *stack.StackName)
+	if err != nil {
+		log.Error("Revoke secrets grants", "KeyArn", keyArn, "Error", err)
+		return
+	}
+
+	log.Info("Revoked secrets grants", "KeyArn", keyArn, "Count", revoked)
+	success = true
+	return
+}
@@ -0,0 +1,265 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// verifyDependencies checks that the newest stack of every upstream service
+// in this region has the outputs this service consumes and that each has the
+// declared type. The values are kept for ensureDependencyParameters
+func (recv *stackCreator) verifyDependencies() (success bool) {
+
+	if len(recv.environment.Dependencies) == 0 {
+		success = true
+		return
+	}
+
+	client := cloudformation.New(recv.roleSession)
+	dependencyOutputs := make(map[string]string)
+
+	for _, dependency := range recv.environment.Dependencies {
+		log := recv.log.New("Dependency", dependency.ServiceName,
+			"DependencyEnvironment", dependency.Environment)
+
+		stack, err := findUpstreamStack(client, dependency)
+		if err != nil {
+			log.Error("DescribeStacks", "Error", err)
+			return
+		}
+		if stack == nil {
+			log.Error("Dependency error: no stack found for the upstream service. It must be provisioned by porter in this region first")
+			return
+		}
+		log = log.New("StackName", *stack.StackName)
+
+		outputs := make(map[string]string)
+		for _, output := range stack.Outputs {
+			if output != nil && output.OutputKey != nil && output.OutputValue != nil {
+				outputs[*output.OutputKey] = *output.OutputValue
+			}
+		}
+
+		dependencySuccess := true
+		for _, declared := range dependency.Outputs {
+
+			value, exists := outputs[declared.Name]
+			if !exists {
+				log.Error("Dependency error: upstream stack is missing an output", "Output", declared.Name)
+				dependencySuccess = false
+				continue
+			}
+
+			if !outputMatchesType(value, declared.Type) {
+				log.Error("Dependency error: upstream output doesn't match the declared type",
+					"Output", declared.Name,
+					"Type", declared.Type,
+					"Value", value)
+				dependencySuccess = false
+				continue
+			}
+
+			dependencyOutputs[dependency.ParameterName(declared)] = value
+		}
+
+		if !dependencySuccess {
+			return
+		}
+
+		log.Info("Dependency verified")
+	}
+
+	recv.dependencyOutputs = dependencyOutputs
+	success = true
+	return
+}
+
+// ensureDependencyParameters adds a parameter for every dependency output
+// whose only allowed value is the one verifyDependencies found. Hosts and
+// containers get it in the output's env_var
+func (recv *stackCreator) ensureDependencyParameters(template *cfn.Template) (success bool) {
+
+	if len(recv.environment.Dependencies) == 0 {
+		success = true
+		return
+	}
+
+	// rendering a template without provisioning it doesn't verify first
+	if recv.dependencyOutputs == nil && !recv.verifyDependencies() {
+		return
+	}
+
+	for _, dependency := range recv.environment.Dependencies {
+		for _, output := range dependency.Outputs {
+			parameterName := dependency.ParameterName(output)
+			value := recv.dependencyOutputs[parameterName]
+
+			template.Parameters[parameterName] = cfn.ParameterInput{
+				Description:   fmt.Sprintf("Output %s of %s %s", output.Name, dependency.ServiceName, dependency.Environment),
+				Type:          "String",
+				AllowedValues: []string{value},
+				Default:       value,
+			}
+		}
+	}
+
+	success = true
+	return
+}
+
+// ensureDownstreamOutputs adds the outputs downstream services most often
+// consume as dependencies. They're the same in every stack of the region so
+// it doesn't matter that a dependency's newest stack may not be promoted
+func (recv *stackCreator) ensureDownstreamOutputs(template *cfn.Template) (success bool) {
+
+	outputs, success := recv.templateOutputs(template)
+	if !success {
+		return
+	}
+
+	if recv.region.DNS != nil {
+		outputs[constants.OutputDNSName] = map[string]interface{}{
+			"Value": strings.TrimRight(recv.region.DNS.Name, "."),
+		}
+	}
+
+	if recv.destinationELBDNSName != "" {
+		outputs[constants.OutputELBDNSName] = map[string]interface{}{
+			"Value": recv.destinationELBDNSName,
+		}
+	}
+
+	if recv.region.DNSToStacks() {
+		lbLogicalId := constants.RouteALBLogicalName
+		if !recv.region.HasRoutes() {
+			var err error
+			lbLogicalId, err = template.GetResourceName(cfn.ElasticLoadBalancing_LoadBalancer)
+			if err != nil {
+				recv.log.Error("GetResourceName", "Error", err)
+				success = false
+				return
+			}
+		}
+
+		outputs[constants.OutputStackDNSName] = map[string]interface{}{
+			"Value": map[string]interface{}{
+				"Fn::GetAtt": []string{lbLogicalId, "DNSName"},
+			},
+		}
+	}
+
+	if recv.region.Security != nil {
+		outputs[constants.OutputSecurityGroupId] = map[string]interface{}{
+			"Value": map[string]interface{}{
+				"Fn::ImportValue": conf.SecurityGroupStackName(recv.config.ServiceName, recv.environment.Name),
+			},
+		}
+	}
+
+	// CloudFormation rejects empty Outputs
+	if len(outputs) > 0 {
+		template.Outputs = outputs
+	}
+	return
+}
+
+// dependencyEnv is the env_var of every dependency output and the parameter
+// that holds its value
+func (recv *stackCreator) dependencyEnv() map[string]string {
+	env := make(map[string]string)
+	for _, dependency := range recv.environment.Dependencies {
+		for _, output := range dependency.Outputs {
+			env[output.EnvVar] = dependency.ParameterName(output)
+		}
+	}
+	return env
+}
+
+// findUpstreamStack returns the most recently created stack for the
+// dependency that's in a usable state
+func findUpstreamStack(client *cfnlib.CloudFormation, dependency *conf.Dependency) (upstream *cfnlib.Stack, err error) {
+
+	err = client.DescribeStacksPages(&cfnlib.DescribeStacksInput{}, func(page *cfnlib.DescribeStacksOutput, lastPage bool) bool {
+
+		for _, stack := range page.Stacks {
+			if stack == nil || stack.StackStatus == nil || stack.CreationTime == nil {
+				continue
+			}
+
+			switch *stack.StackStatus {
+			case cfnlib.StackStatusCreateComplete, cfnlib.StackStatusUpdateComplete,
+				cfnlib.StackStatusUpdateRollbackComplete:
+			default:
+				continue
+			}
+
+			tags := make(map[string]string)
+			for _, tag := range stack.Tags {
+				if tag != nil && tag.Key != nil && tag.Value != nil {
+					tags[*tag.Key] = *tag.Value
+				}
+			}
+
+			if tags[constants.PorterServiceNameTag] != dependency.ServiceName ||
+				tags[constants.PorterEnvironmentTag] != dependency.Environment {
+				continue
+			}
+
+			if upstream == nil || stack.CreationTime.After(*upstream.CreationTime) {
+				upstream = stack
+			}
+		}
+
+		return true
+	})
+
+	return
+}
+
+func outputMatchesType(value, outputType string) bool {
+	switch outputType {
+	case conf.OutputType_String:
+		return true
+
+	case conf.OutputType_Number:
+		_, err := strconv.ParseFloat(value, 64)
+		return err == nil
+
+	case conf.OutputType_List:
+		for _, item := range strings.Split(value, ",") {
+			if strings.TrimSpace(item) == "" {
+				return false
+			}
+		}
+		return true
+
+	case conf.OutputType_ARN:
+		// arn:partition:service:region:account-id:resource
+		return strings.HasPrefix(value, "arn:") && len(strings.SplitN(value, ":", 6)) == 6
+
+	case conf.OutputType_URL:
+		parsed, err := url.Parse(value)
+		return err == nil && parsed.Scheme != "" && parsed.Host != ""
+	}
+
+	panic(fmt.Errorf("invariant violation: unvalidated output type %s", outputType))
+}
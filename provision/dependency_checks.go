@@ -0,0 +1,182 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inconshreveable/log15"
+)
+
+type dependencyCheckResult struct {
+	check  *conf.DependencyCheck
+	region string
+	err    error
+}
+
+// CheckDependencyHealth runs the environment's dependency_checks before a
+// deploy starts so a dependency that's down stops it right away instead of
+// failing the wait condition once hosts try to use it. Every check runs and
+// every failure is logged
+//
+// The environment's url and tcp checks run once. Its sqs_queue checks run in
+// every region. A region's checks only run in that region
+func CheckDependencyHealth(ctx context.Context, log log15.Logger, environment *conf.Environment) (success bool) {
+
+	var (
+		wg      sync.WaitGroup
+		lock    sync.Mutex
+		results []dependencyCheckResult
+	)
+
+	run := func(check *conf.DependencyCheck, region string, roleSession *session.Session) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := RunDependencyCheck(ctx, check, roleSession)
+
+			lock.Lock()
+			results = append(results, dependencyCheckResult{check, region, err})
+			lock.Unlock()
+		}()
+	}
+
+	for _, check := range environment.DependencyChecks {
+		if check.SQSQueue == "" {
+			run(check, "", nil)
+		}
+	}
+
+	for _, region := range environment.Regions {
+
+		var regionChecks []*conf.DependencyCheck
+		for _, check := range environment.DependencyChecks {
+			if check.SQSQueue != "" {
+				regionChecks = append(regionChecks, check)
+			}
+		}
+		regionChecks = append(regionChecks, region.DependencyChecks...)
+
+		if len(regionChecks) == 0 {
+			continue
+		}
+
+		roleARN, err := environment.GetRoleARN(region.Name)
+		if err != nil {
+			log.Error("GetRoleARN", "Error", err)
+			wg.Wait()
+			return
+		}
+
+		roleSession := aws_session.STS(region.Name, roleARN, 0)
+
+		for _, check := range regionChecks {
+			run(check, region.Name, roleSession)
+		}
+	}
+
+	wg.Wait()
+
+	if len(results) == 0 {
+		success = true
+		return
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].region != results[j].region {
+			return results[i].region < results[j].region
+		}
+		return results[i].check.Name < results[j].check.Name
+	})
+
+	failures := 0
+	for _, result := range results {
+		checkLog := log.New("Dependency", result.check.Name)
+		if result.region != "" {
+			checkLog = checkLog.New("Region", result.region)
+		}
+
+		if result.err != nil {
+			failures++
+			checkLog.Error("Dependency is down", "Error", result.err)
+			continue
+		}
+
+		checkLog.Info("Dependency is healthy")
+	}
+
+	if failures > 0 {
+		log.Error("Aborting the deploy before anything is provisioned",
+			"UnhealthyDependencies", failures,
+			"Environment", environment.Name)
+		return
+	}
+
+	success = true
+	return
+}
+
+// RunDependencyCheck checks a single dependency. roleSession is only used by
+// sqs_queue checks
+func RunDependencyCheck(ctx context.Context, check *conf.DependencyCheck, roleSession *session.Session) error {
+	timeout := time.Duration(check.Timeout) * time.Second
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch {
+	case check.URL != "":
+		req, err := http.NewRequestWithContext(ctx, "GET", check.URL, nil)
+		if err != nil {
+			return err
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+
+		if res.StatusCode/100 != 2 {
+			return fmt.Errorf("GET %s returned %s", check.URL, res.Status)
+		}
+		return nil
+
+	case check.TCP != "":
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", check.TCP)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+
+	case check.SQSQueue != "":
+		_, err := sqs.New(aws_session.WithContext(ctx, roleSession)).GetQueueUrl(&sqs.GetQueueUrlInput{
+			QueueName: aws.String(check.SQSQueue),
+		})
+		return err
+	}
+
+	return fmt.Errorf("dependency check %s has nothing to check", check.Name)
+}
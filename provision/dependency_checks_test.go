@@ -0,0 +1,74 @@
+package provision_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/provision"
+)
+
+var _ = Describe("Dependency checks", func() {
+
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/health" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("passes a url that returns 2xx", func() {
+		err := provision.RunDependencyCheck(context.Background(), &conf.DependencyCheck{
+			Name:    "api",
+			URL:     server.URL + "/health",
+			Timeout: 5,
+		}, nil)
+		Expect(err).To(BeNil())
+	})
+
+	It("fails a url that doesn't return 2xx", func() {
+		err := provision.RunDependencyCheck(context.Background(), &conf.DependencyCheck{
+			Name:    "api",
+			URL:     server.URL + "/down",
+			Timeout: 5,
+		}, nil)
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("503"))
+	})
+
+	It("checks tcp endpoints accept connections", func() {
+		address := strings.TrimPrefix(server.URL, "http://")
+
+		err := provision.RunDependencyCheck(context.Background(), &conf.DependencyCheck{
+			Name:    "db",
+			TCP:     address,
+			Timeout: 5,
+		}, nil)
+		Expect(err).To(BeNil())
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		closedAddress := listener.Addr().String()
+		listener.Close()
+
+		err = provision.RunDependencyCheck(context.Background(), &conf.DependencyCheck{
+			Name:    "db",
+			TCP:     closedAddress,
+			Timeout: 5,
+		}, nil)
+		Expect(err).ToNot(BeNil())
+	})
+})
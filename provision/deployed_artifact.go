@@ -0,0 +1,231 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/adobe-platform/porter/artifact_store"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/inconshreveable/log15"
+)
+
+// DeployedPayload finds the service payload a version was deployed to an
+// environment with. Every promoted region of the version must have been
+// deployed with the same payload. The deployments are the ones that recorded
+// where the payload was uploaded
+func DeployedPayload(deployments []*provision_state.Deployment, version string) (checksum string, sources []*provision_state.Deployment, err error) {
+
+	for _, deployment := range deployments {
+		if deployment.ServiceVersion != version ||
+			deployment.Status != provision_state.StatusPromoted ||
+			deployment.PayloadChecksum == "" {
+			continue
+		}
+
+		if checksum == "" {
+			checksum = deployment.PayloadChecksum
+		} else if deployment.PayloadChecksum != checksum {
+			err = fmt.Errorf("version %s was deployed with payload %s and %s", version, checksum, deployment.PayloadChecksum)
+			return
+		}
+
+		if deployment.PayloadKey != "" {
+			sources = append(sources, deployment)
+		}
+	}
+
+	if checksum == "" {
+		err = fmt.Errorf("version %s isn't promoted in any region", version)
+		return
+	}
+
+	if len(sources) == 0 {
+		err = fmt.Errorf("no region recorded where the payload of version %s was uploaded", version)
+	}
+	return
+}
+
+// FetchDeployedArtifact puts the exact service payload, and the config it was
+// packed with, that a version was deployed to the environment from with where
+// pack would have. Nothing is rebuilt so deploying it to another environment
+// only renders that environment's values
+func FetchDeployedArtifact(log log15.Logger, config *conf.Config, from, version string) (checksum string, success bool) {
+
+	environment, err := config.GetEnvironment(from)
+	if err != nil {
+		log.Error("GetEnvironment", "Error", err)
+		return
+	}
+
+	deployments, err := GetStateStore(config).List(config.ServiceName, environment.Name)
+	if err != nil {
+		log.Error("State store List", "Error", err)
+		return
+	}
+
+	checksum, sources, err := DeployedPayload(deployments, version)
+	if err != nil {
+		log.Error("No deployed payload to promote", "Environment", environment.Name, "Error", err)
+		return
+	}
+
+	log = log.New("PayloadChecksum", checksum)
+
+	err = os.MkdirAll(constants.TempDir, 0755)
+	if err != nil {
+		log.Error("os.MkdirAll", "Path", constants.TempDir, "Error", err)
+		return
+	}
+
+	// any region's copy will do
+	downloaded := false
+	for _, source := range sources {
+		regionLog := log.New("Region", source.Region, "S3key", source.PayloadKey)
+
+		region, err := environment.GetRegion(source.Region)
+		if err != nil {
+			regionLog.Warn("Region is no longer in the environment", "Error", err)
+			continue
+		}
+
+		roleARN, err := environment.GetRoleARN(region.Name)
+		if err != nil {
+			regionLog.Warn("GetRoleARN", "Error", err)
+			continue
+		}
+
+		store, err := artifact_store.New(config, region, aws_session.STS(region.Name, roleARN, 0))
+		if err != nil {
+			regionLog.Warn("artifact_store.New", "Error", err)
+			continue
+		}
+
+		regionLog.Info("Downloading the deployed service payload")
+
+		err = downloadPayload(store, source.PayloadKey, checksum)
+		if err != nil {
+			regionLog.Warn("Failed to download the deployed service payload", "Error", err)
+			continue
+		}
+
+		downloaded = true
+		break
+	}
+
+	if !downloaded {
+		log.Error("The deployed service payload couldn't be downloaded from any region")
+		return
+	}
+
+	packedConfigBytes, err := payloadConfig(constants.PayloadPath)
+	if err != nil {
+		log.Error("Failed to read the config packed in the service payload", "Error", err)
+		return
+	}
+
+	err = ioutil.WriteFile(constants.AlteredConfigPath, packedConfigBytes, 0644)
+	if err != nil {
+		log.Error("WriteFile", "Path", constants.AlteredConfigPath, "Error", err)
+		return
+	}
+
+	packedConfig, getConfigSuccess := conf.GetAlteredConfig(log)
+	if !getConfigSuccess {
+		return
+	}
+
+	if packedConfig.ServiceVersion != version {
+		log.Error("The service payload was packed from a different version",
+			"PackedServiceVersion", packedConfig.ServiceVersion,
+			"ServiceVersion", version)
+		return
+	}
+
+	success = true
+	return
+}
+
+// downloadPayload writes key to the payload path if its checksum matches
+func downloadPayload(store artifact_store.Store, key, checksum string) error {
+	reader, err := store.Get(key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	payloadFile, err := os.Create(constants.PayloadPath)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(payloadFile, hash), reader)
+	if closeErr := payloadFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(constants.PayloadPath)
+		return err
+	}
+
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if actual != checksum {
+		os.Remove(constants.PayloadPath)
+		return fmt.Errorf("downloaded payload has checksum %s", actual)
+	}
+
+	return nil
+}
+
+// payloadConfig reads the config pack put in the root of the service payload
+func payloadConfig(payloadPath string) ([]byte, error) {
+	payloadFile, err := os.Open(payloadPath)
+	if err != nil {
+		return nil, err
+	}
+	defer payloadFile.Close()
+
+	gzipReader, err := gzip.NewReader(payloadFile)
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if path.Clean(header.Name) == constants.ServicePayloadConfigPath {
+			return ioutil.ReadAll(tarReader)
+		}
+	}
+
+	return nil, fmt.Errorf("%s isn't in the service payload", constants.ServicePayloadConfigPath)
+}
@@ -0,0 +1,50 @@
+package provision_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/provision"
+	"github.com/adobe-platform/porter/provision_state"
+)
+
+var _ = Describe("Deployed payload", func() {
+
+	deployment := func(region, version, status, checksum, key string) *provision_state.Deployment {
+		return &provision_state.Deployment{
+			Region:          region,
+			ServiceVersion:  version,
+			Status:          status,
+			PayloadChecksum: checksum,
+			PayloadKey:      key,
+		}
+	}
+
+	It("finds the payload the version was promoted with", func() {
+		checksum, sources, err := provision.DeployedPayload([]*provision_state.Deployment{
+			deployment("us-east-1", "1.0.0", provision_state.StatusPromoted, "abc", "svc/abc.tar"),
+			deployment("us-west-2", "1.0.0", provision_state.StatusPromoted, "abc", ""),
+			deployment("eu-west-1", "1.0.1", provision_state.StatusPromoted, "def", "svc/def.tar"),
+		}, "1.0.0")
+		Expect(err).To(BeNil())
+		Expect(checksum).To(Equal("abc"))
+		Expect(sources).To(HaveLen(1))
+		Expect(sources[0].Region).To(Equal("us-east-1"))
+	})
+
+	It("ignores regions that weren't promoted", func() {
+		_, _, err := provision.DeployedPayload([]*provision_state.Deployment{
+			deployment("us-east-1", "1.0.0", provision_state.StatusProvisioned, "abc", "svc/abc.tar"),
+			deployment("us-west-2", "1.0.0", provision_state.StatusFailed, "abc", "svc/abc.tar"),
+		}, "1.0.0")
+		Expect(err).ToNot(BeNil())
+	})
+
+	It("refuses a version deployed with different payloads", func() {
+		_, _, err := provision.DeployedPayload([]*provision_state.Deployment{
+			deployment("us-east-1", "1.0.0", provision_state.StatusPromoted, "abc", "svc/abc.tar"),
+			deployment("us-west-2", "1.0.0", provision_state.StatusPromoted, "def", "svc/def.tar"),
+		}, "1.0.0")
+		Expect(err).ToNot(BeNil())
+	})
+})
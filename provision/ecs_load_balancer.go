@@ -0,0 +1,293 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/cfn_template"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/promote"
+	"github.com/aws/aws-sdk-go/aws"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+const (
+	ecsLoadBalancerLogicalName  = "ECSLoadBalancer"
+	ecsHTTPListenerLogicalName  = "ECSHTTPListener"
+	ecsHTTPSListenerLogicalName = "ECSHTTPSListener"
+	ecsPromotedCondition        = "Promoted"
+)
+
+// ensureECSLoadBalancerStack creates the environment's
+// conf.ECSLoadBalancerStackName the first time an inet service is deployed
+// with compute: ecs and updates its listeners and certificate after. The
+// stack promoted into it is kept.
+//
+// Every provisioned stack's target group is behind this one load balancer so
+// the service keeps its endpoint across deploys. Its listeners respond 503
+// until the first stack is promoted
+func (recv *stackCreator) ensureECSLoadBalancerStack() (success bool) {
+	if recv.environment.Compute != conf.Compute_ECS ||
+		recv.region.PrimaryTopology() != conf.Topology_Inet {
+		success = true
+		return
+	}
+
+	stackName := conf.ECSLoadBalancerStackName(recv.config.ServiceName, recv.environment.Name)
+	log := recv.log.New("StackName", stackName)
+
+	template, ok := recv.ecsLoadBalancerTemplate()
+	if !ok {
+		return
+	}
+
+	templateBytes, err := json.Marshal(template)
+	if err != nil {
+		log.Error("json.Marshal", "Error", err)
+		return
+	}
+
+	cfnRoleARN, err := recv.environment.GetCFNRoleARN(recv.region.Name)
+	if err != nil {
+		log.Error("GetCFNRoleARN", "Error", err)
+		return
+	}
+
+	client := cloudformation.New(recv.roleSession)
+	describeInput := &cfnlib.DescribeStacksInput{
+		StackName: aws.String(stackName),
+	}
+
+	outputs, exists, err := describeECSLoadBalancerStack(client, stackName)
+	switch {
+	case err != nil:
+		log.Error("DescribeStack", "Error", err)
+		return
+
+	case !exists:
+		log.Info("Creating the load balancer stack")
+		_, err = cloudformation.CreateStackWithBody(client, stackName, string(templateBytes), cfnRoleARN)
+		if err == cloudformation.ErrAudited {
+			success = true
+			return
+		}
+		if err != nil {
+			log.Error("CreateStack", "Error", err)
+			return
+		}
+
+		err = client.WaitUntilStackCreateComplete(describeInput)
+		if err != nil {
+			log.Error("WaitUntilStackCreateComplete", "Error", err)
+			return
+		}
+
+	default:
+		// the parameters are what promote changes
+		err = cloudformation.UpdateStack(client, stackName, "", string(templateBytes), []*cfnlib.Parameter{
+			{
+				ParameterKey:     aws.String(promote.ECSTargetGroupParameter),
+				UsePreviousValue: aws.Bool(true),
+			},
+			{
+				ParameterKey:     aws.String(promote.ECSStackIdParameter),
+				UsePreviousValue: aws.Bool(true),
+			},
+		}, nil, cfnRoleARN)
+		if err != nil && !strings.Contains(err.Error(), "No updates are to be performed") {
+			log.Error("UpdateStack", "Error", err)
+			return
+		}
+
+		if err == nil {
+			log.Info("Updating the load balancer stack")
+			err = client.WaitUntilStackUpdateComplete(describeInput)
+			if err != nil {
+				log.Error("WaitUntilStackUpdateComplete", "Error", err)
+				return
+			}
+		}
+	}
+
+	if !exists || err == nil {
+		outputs, _, err = describeECSLoadBalancerStack(client, stackName)
+		if err != nil {
+			log.Error("DescribeStack", "Error", err)
+			return
+		}
+	}
+
+	recv.ecsListenerArn = outputs[promote.ECSListenerOutput]
+	recv.ecsLoadBalancerSG = outputs[promote.ECSSecurityGroupOutput]
+	if recv.ecsListenerArn == "" || recv.ecsLoadBalancerSG == "" {
+		log.Error("The load balancer stack is missing outputs",
+			"Listener", recv.ecsListenerArn, "SecurityGroup", recv.ecsLoadBalancerSG)
+		return
+	}
+
+	success = true
+	return
+}
+
+// ecsLoadBalancerTemplate is the load balancer, its security group, and its
+// listeners. The listeners forward to promote.ECSTargetGroupParameter once a
+// stack is promoted. With redirect_http the HTTP listener only redirects
+func (recv *stackCreator) ecsLoadBalancerTemplate() (*cfn.Template, bool) {
+	template := cfn.NewTemplate()
+	template.Description = "porter managed load balancer for " + recv.config.ServiceName + " " + recv.environment.Name
+
+	for _, parameter := range []string{promote.ECSTargetGroupParameter, promote.ECSStackIdParameter} {
+		template.Parameters[parameter] = cfn.ParameterInput{
+			Type:    "String",
+			Default: promote.ECSNotPromoted,
+		}
+	}
+
+	template.Conditions[ecsPromotedCondition] = map[string]interface{}{
+		"Fn::Not": []interface{}{
+			map[string]interface{}{
+				"Fn::Equals": []interface{}{
+					map[string]interface{}{"Ref": promote.ECSTargetGroupParameter},
+					promote.ECSNotPromoted,
+				},
+			},
+		},
+	}
+
+	promotedActions := map[string]interface{}{
+		"Fn::If": []interface{}{
+			ecsPromotedCondition,
+			[]interface{}{
+				map[string]interface{}{
+					"Type":           "forward",
+					"TargetGroupArn": map[string]interface{}{"Ref": promote.ECSTargetGroupParameter},
+				},
+			},
+			[]interface{}{
+				map[string]interface{}{
+					"Type": "fixed-response",
+					"FixedResponseConfig": map[string]interface{}{
+						"StatusCode":  "503",
+						"ContentType": "text/plain",
+						"MessageBody": "No stack has been promoted",
+					},
+				},
+			},
+		},
+	}
+
+	securityGroup := cfn_template.InetToELB(true, recv.region.HasHTTPS())
+	securityGroup["Properties"].(map[string]interface{})["VpcId"] = recv.region.VpcId
+	template.SetResource(constants.ElbSgLogicalName, securityGroup)
+
+	template.SetResource(ecsLoadBalancerLogicalName, map[string]interface{}{
+		"Type": cfn.ElasticLoadBalancingV2_LoadBalancer,
+		"Properties": map[string]interface{}{
+			"Scheme":  "internet-facing",
+			"Subnets": recv.ecsSubnets(),
+			"SecurityGroups": []interface{}{
+				map[string]interface{}{"Ref": constants.ElbSgLogicalName},
+			},
+		},
+	})
+
+	var httpActions interface{} = promotedActions
+	if recv.redirectHTTP() {
+		httpActions = recv.httpListenerActions("")
+	}
+
+	template.SetResource(ecsHTTPListenerLogicalName, map[string]interface{}{
+		"Type": cfn.ElasticLoadBalancingV2_Listener,
+		"Properties": map[string]interface{}{
+			"LoadBalancerArn": map[string]interface{}{"Ref": ecsLoadBalancerLogicalName},
+			"Port":            80,
+			"Protocol":        "HTTP",
+			"DefaultActions":  httpActions,
+		},
+	})
+
+	listener := ecsHTTPListenerLogicalName
+	if recv.region.HasHTTPS() {
+		properties := map[string]interface{}{
+			"LoadBalancerArn": map[string]interface{}{"Ref": ecsLoadBalancerLogicalName},
+			"Port":            443,
+			"Protocol":        "HTTPS",
+			"Certificates": []interface{}{
+				map[string]interface{}{"CertificateArn": recv.sslCertificateARN()},
+			},
+			"DefaultActions": promotedActions,
+		}
+		recv.setSslPolicy(properties)
+
+		template.SetResource(ecsHTTPSListenerLogicalName, map[string]interface{}{
+			"Type":       cfn.ElasticLoadBalancingV2_Listener,
+			"Properties": properties,
+		})
+		listener = ecsHTTPSListenerLogicalName
+	}
+
+	if !recv.associateWAF(template, ecsLoadBalancerLogicalName) {
+		return nil, false
+	}
+
+	template.Outputs = map[string]interface{}{
+		promote.ECSListenerOutput: map[string]interface{}{
+			"Value": map[string]interface{}{"Ref": listener},
+		},
+		promote.ECSSecurityGroupOutput: map[string]interface{}{
+			"Value": map[string]interface{}{
+				"Fn::GetAtt": []string{constants.ElbSgLogicalName, "GroupId"},
+			},
+		},
+		promote.PromotedStackIdOutput: map[string]interface{}{
+			"Value": map[string]interface{}{"Ref": promote.ECSStackIdParameter},
+		},
+		"DNSName": map[string]interface{}{
+			"Value": map[string]interface{}{
+				"Fn::GetAtt": []string{ecsLoadBalancerLogicalName, "DNSName"},
+			},
+		},
+	}
+
+	return template, true
+}
+
+// describeECSLoadBalancerStack is the stack's outputs by key
+func describeECSLoadBalancerStack(client *cfnlib.CloudFormation, stackName string) (outputs map[string]string, exists bool, err error) {
+	output, err := cloudformation.DescribeStack(client, stackName)
+	if err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			err = nil
+		}
+		return
+	}
+
+	exists = true
+	outputs = make(map[string]string)
+	for _, stack := range output.Stacks {
+		if stack == nil {
+			continue
+		}
+
+		for _, output := range stack.Outputs {
+			if output != nil && output.OutputKey != nil {
+				outputs[*output.OutputKey] = aws.StringValue(output.OutputValue)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,244 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/aws/aws-sdk-go/aws"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+const (
+	fileSystemLogicalName               = "FileSystem"
+	fileSystemClientSecurityGroup       = "ClientSecurityGroup"
+	fileSystemMountTargetSecurityGroup  = "MountTargetSecurityGroup"
+	fileSystemMountTargetIngress        = "MountTargetIngress"
+	fileSystemIdOutput                  = "FileSystemId"
+	fileSystemClientSecurityGroupOutput = "ClientSecurityGroupId"
+	fileSystemMountTargetOutput         = "MountTargetSecurityGroupId"
+
+	nfsPort = 2049
+)
+
+// fileSystemImport is the value of one of the FileSystemStackName's exports
+func (recv *stackCreator) fileSystemImport(output string) map[string]interface{} {
+	return map[string]interface{}{
+		"Fn::ImportValue": conf.FileSystemStackName(recv.config.ServiceName, recv.environment.Name) + "-" + output,
+	}
+}
+
+// ensureFileSystemStack creates the region's FileSystemStackName the first
+// time the service is deployed with efs and updates it when the region's
+// subnets change
+//
+// The file system is retained if it's ever replaced or the stack is deleted
+// so what's on it isn't lost
+func (recv *stackCreator) ensureFileSystemStack() (success bool) {
+	efs := recv.region.EFS
+	if efs == nil {
+		success = true
+		return
+	}
+
+	stackName := conf.FileSystemStackName(recv.config.ServiceName, recv.environment.Name)
+	log := recv.log.New("StackName", stackName)
+
+	client := cloudformation.New(recv.roleSession)
+
+	template := cfn.NewTemplate()
+	template.Description = "porter managed file system for " + recv.config.ServiceName + " " + recv.environment.Name
+
+	// membership only like the service security group
+	template.SetResource(fileSystemClientSecurityGroup, map[string]interface{}{
+		"Type": cfn.EC2_SecurityGroup,
+		"Properties": map[string]interface{}{
+			"GroupDescription": "Clients of the file system of " + recv.config.ServiceName + " " + recv.environment.Name,
+			"VpcId":            recv.region.VpcId,
+			"SecurityGroupEgress": []interface{}{
+				map[string]interface{}{
+					"IpProtocol": "-1",
+					"CidrIp":     "127.0.0.1/32",
+				},
+			},
+		},
+	})
+
+	var fileSystemId, mountTargetSecurityGroupId interface{}
+
+	if efs.CreatesFileSystem() {
+		fileSystemProperties := map[string]interface{}{
+			"Encrypted":       *efs.Encrypted,
+			"PerformanceMode": efs.PerformanceMode,
+			"ThroughputMode":  efs.ThroughputMode,
+			"FileSystemTags": []interface{}{
+				map[string]interface{}{"Key": "Name", "Value": stackName},
+			},
+		}
+		if efs.KmsKeyId != "" {
+			fileSystemProperties["KmsKeyId"] = efs.KmsKeyId
+		}
+
+		template.SetResource(fileSystemLogicalName, map[string]interface{}{
+			"Type":                cfn.EFS_FileSystem,
+			"DeletionPolicy":      "Retain",
+			"UpdateReplacePolicy": "Retain",
+			"Properties":          fileSystemProperties,
+		})
+
+		template.SetResource(fileSystemMountTargetSecurityGroup, map[string]interface{}{
+			"Type": cfn.EC2_SecurityGroup,
+			"Properties": map[string]interface{}{
+				"GroupDescription": "Mount targets of the file system of " + recv.config.ServiceName + " " + recv.environment.Name,
+				"VpcId":            recv.region.VpcId,
+				"SecurityGroupIngress": []interface{}{
+					map[string]interface{}{
+						"IpProtocol":            "tcp",
+						"FromPort":              nfsPort,
+						"ToPort":                nfsPort,
+						"SourceSecurityGroupId": map[string]interface{}{"Ref": fileSystemClientSecurityGroup},
+					},
+				},
+			},
+		})
+
+		for _, az := range recv.region.AZs {
+			template.SetResource("MountTarget"+strings.Replace(az.Name, "-", "", -1), map[string]interface{}{
+				"Type": cfn.EFS_MountTarget,
+				"Properties": map[string]interface{}{
+					"FileSystemId":   map[string]interface{}{"Ref": fileSystemLogicalName},
+					"SubnetId":       az.SubnetID,
+					"SecurityGroups": []interface{}{map[string]interface{}{"Ref": fileSystemMountTargetSecurityGroup}},
+				},
+			})
+		}
+
+		fileSystemId = map[string]interface{}{"Ref": fileSystemLogicalName}
+		mountTargetSecurityGroupId = map[string]interface{}{"Ref": fileSystemMountTargetSecurityGroup}
+	} else {
+		template.SetResource(fileSystemMountTargetIngress, map[string]interface{}{
+			"Type": cfn.EC2_SecurityGroupIngress,
+			"Properties": map[string]interface{}{
+				"GroupId":               efs.SecurityGroupId,
+				"Description":           "NFS from " + recv.config.ServiceName + " " + recv.environment.Name,
+				"IpProtocol":            "tcp",
+				"FromPort":              nfsPort,
+				"ToPort":                nfsPort,
+				"SourceSecurityGroupId": map[string]interface{}{"Ref": fileSystemClientSecurityGroup},
+			},
+		})
+
+		fileSystemId = efs.FileSystemId
+		mountTargetSecurityGroupId = efs.SecurityGroupId
+	}
+
+	outputs := make(map[string]interface{})
+	for output, value := range map[string]interface{}{
+		fileSystemIdOutput:                  fileSystemId,
+		fileSystemClientSecurityGroupOutput: map[string]interface{}{"Ref": fileSystemClientSecurityGroup},
+		fileSystemMountTargetOutput:         mountTargetSecurityGroupId,
+	} {
+		outputs[output] = map[string]interface{}{
+			"Value": value,
+			"Export": map[string]interface{}{
+				"Name": stackName + "-" + output,
+			},
+		}
+	}
+	template.Outputs = outputs
+
+	templateBytes, err := json.Marshal(template)
+	if err != nil {
+		log.Error("json.Marshal", "Error", err)
+		return
+	}
+
+	cfnRoleARN, err := recv.environment.GetCFNRoleARN(recv.region.Name)
+	if err != nil {
+		log.Error("GetCFNRoleARN", "Error", err)
+		return
+	}
+
+	describeInput := &cfnlib.DescribeStacksInput{
+		StackName: aws.String(stackName),
+	}
+
+	_, err = cloudformation.DescribeStack(client, stackName)
+	switch {
+	case err != nil && !strings.Contains(err.Error(), "does not exist"):
+		log.Error("DescribeStack", "Error", err)
+		return
+
+	case err != nil:
+		log.Info("Creating the file system stack")
+		_, err = cloudformation.CreateStackWithBody(client, stackName, string(templateBytes), cfnRoleARN)
+		if err == cloudformation.ErrAudited {
+			success = true
+			return
+		}
+		if err != nil {
+			log.Error("CreateStack", "Error", err)
+			return
+		}
+
+		err = client.WaitUntilStackCreateComplete(describeInput)
+		if err != nil {
+			log.Error("WaitUntilStackCreateComplete", "Error", err)
+			return
+		}
+
+	default:
+		err = cloudformation.UpdateStackWithBody(client, stackName, string(templateBytes), cfnRoleARN)
+		if err != nil && !strings.Contains(err.Error(), "No updates are to be performed") {
+			log.Error("UpdateStack", "Error", err)
+			return
+		}
+
+		if err == nil {
+			log.Info("Updating the file system stack")
+			err = client.WaitUntilStackUpdateComplete(describeInput)
+			if err != nil {
+				log.Error("WaitUntilStackUpdateComplete", "Error", err)
+				return
+			}
+		}
+	}
+
+	success = true
+	return
+}
+
+// addFileSystemSecurityGroup makes the instances clients of the region's
+// file system
+func addFileSystemSecurityGroup(recv *stackCreator, template *cfn.Template, resource map[string]interface{}) bool {
+	if recv.region.EFS == nil {
+		return true
+	}
+
+	props, ok := resource["Properties"].(map[string]interface{})
+	if !ok {
+		recv.log.Error("Missing Properties on resource")
+		return false
+	}
+
+	securityGroups, ok := props["SecurityGroups"].([]interface{})
+	if !ok {
+		securityGroups = make([]interface{}, 0)
+	}
+
+	props["SecurityGroups"] = append(securityGroups, recv.fileSystemImport(fileSystemClientSecurityGroupOutput))
+	return true
+}
@@ -0,0 +1,201 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/adobe-platform/porter/aws/kms"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+type (
+	keyPolicy struct {
+		Statement stringOrList `json:"Statement"`
+	}
+
+	keyPolicyStatement struct {
+		Effect    string          `json:"Effect"`
+		Principal json.RawMessage `json:"Principal"`
+		Action    stringOrList    `json:"Action"`
+	}
+
+	// stringOrList is an IAM policy element that may be a single value or a
+	// list of them
+	stringOrList []json.RawMessage
+)
+
+func (recv *stringOrList) UnmarshalJSON(data []byte) error {
+	var list []json.RawMessage
+	if err := json.Unmarshal(data, &list); err == nil {
+		*recv = list
+		return nil
+	}
+	*recv = []json.RawMessage{data}
+	return nil
+}
+
+func (recv stringOrList) strings() (values []string) {
+	for _, raw := range recv {
+		var value string
+		if json.Unmarshal(raw, &value) == nil {
+			values = append(values, value)
+		}
+	}
+	return
+}
+
+// verifyEncryptionKey checks that sse_kms_key_id is a key hosts can use to
+// decrypt the service payload and secrets before anything is uploaded with it.
+// Failures to read the key because the deployment role can't are only warnings
+func (recv *stackCreator) verifyEncryptionKey() (success bool) {
+
+	if recv.region.SSEKMSKeyId == nil {
+		success = true
+		return
+	}
+
+	keyId := *recv.region.SSEKMSKeyId
+	log := recv.log.New("SSEKMSKeyId", keyId)
+
+	client := kms.New(recv.roleSession)
+
+	describeKeyOutput, err := client.DescribeKey(&kms.DescribeKeyInput{KeyId: keyId})
+	if err != nil {
+		if isAccessDenied(err) {
+			log.Warn("kms:DescribeKey is needed to verify sse_kms_key_id", "Error", err)
+			success = true
+			return
+		}
+		log.Error("DescribeKey", "Error", err)
+		return
+	}
+
+	metadata := describeKeyOutput.KeyMetadata
+	if metadata.KeyState != kms.KeyState_Enabled {
+		log.Error("sse_kms_key_id isn't enabled", "KeyState", metadata.KeyState)
+		return
+	}
+	if metadata.KeyUsage != kms.KeyUsage_EncryptDecrypt {
+		log.Error("sse_kms_key_id isn't an encryption key", "KeyUsage", metadata.KeyUsage)
+		return
+	}
+	// KeySpec is empty for keys described before KMS added it
+	if metadata.KeySpec != "" && metadata.KeySpec != kms.KeySpec_SymmetricDefault {
+		log.Error("S3 only supports symmetric keys", "KeySpec", metadata.KeySpec)
+		return
+	}
+
+	roleARN, err := recv.environment.GetRoleARN(recv.region.Name)
+	if err != nil {
+		log.Error("GetRoleARN", "Error", err)
+		return
+	}
+
+	arnParts := strings.Split(roleARN, ":")
+	if len(arnParts) < 5 {
+		log.Error("Invalid role_arn", "RoleARN", roleARN)
+		return
+	}
+	accountId := arnParts[4]
+
+	getKeyPolicyOutput, err := client.GetKeyPolicy(&kms.GetKeyPolicyInput{
+		KeyId:      metadata.KeyId,
+		PolicyName: kms.DefaultKeyPolicyName,
+	})
+	if err != nil {
+		if isAccessDenied(err) {
+			log.Warn("kms:GetKeyPolicy is needed to verify hosts can decrypt with sse_kms_key_id", "Error", err)
+			success = true
+			return
+		}
+		log.Error("GetKeyPolicy", "Error", err)
+		return
+	}
+
+	allowed, err := KeyPolicyAllowsDecrypt(getKeyPolicyOutput.Policy, accountId)
+	if err != nil {
+		log.Error("Key policy", "Error", err)
+		return
+	}
+	if !allowed {
+		log.Error("The key policy of sse_kms_key_id doesn't allow kms:Decrypt by the account's IAM policies so the instance role can't read the service payload",
+			"Account", accountId)
+		return
+	}
+
+	success = true
+	return
+}
+
+// KeyPolicyAllowsDecrypt is true if a key policy delegates kms:Decrypt to IAM
+// policies in the account. The instance role's policy grants the rest
+func KeyPolicyAllowsDecrypt(policyJSON, accountId string) (bool, error) {
+	var policy keyPolicy
+	if err := json.Unmarshal([]byte(policyJSON), &policy); err != nil {
+		return false, fmt.Errorf("invalid key policy: %s", err)
+	}
+
+	for _, rawStatement := range policy.Statement {
+		var statement keyPolicyStatement
+		if err := json.Unmarshal(rawStatement, &statement); err != nil {
+			return false, fmt.Errorf("invalid key policy statement: %s", err)
+		}
+
+		if statement.Effect != "Allow" {
+			continue
+		}
+
+		if !principalsMatch(statement.Principal, accountId) {
+			continue
+		}
+
+		for _, action := range statement.Action.strings() {
+			switch action {
+			case "*", "kms:*", "kms:Decrypt":
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// principalsMatch is true for "*", {"AWS": "*"}, or the account in either form
+func principalsMatch(rawPrincipal json.RawMessage, accountId string) bool {
+	var wildcard string
+	if json.Unmarshal(rawPrincipal, &wildcard) == nil {
+		return wildcard == "*"
+	}
+
+	var principal struct {
+		AWS stringOrList `json:"AWS"`
+	}
+	if json.Unmarshal(rawPrincipal, &principal) != nil {
+		return false
+	}
+
+	for _, value := range principal.AWS.strings() {
+		// any partition's arn:<partition>:iam::<account>:root
+		if value == "*" || value == accountId || strings.HasSuffix(value, ":iam::"+accountId+":root") {
+			return true
+		}
+	}
+	return false
+}
+
+func isAccessDenied(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && (awsErr.Code() == "AccessDeniedException" || awsErr.Code() == "AccessDenied")
+}
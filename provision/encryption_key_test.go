@@ -0,0 +1,54 @@
+package provision_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/provision"
+)
+
+var _ = Describe("Key policy", func() {
+
+	It("allows decrypt delegated to the account root", func() {
+		allowed, err := provision.KeyPolicyAllowsDecrypt(`{
+			"Version": "2012-10-17",
+			"Statement": [{
+				"Effect": "Allow",
+				"Principal": {"AWS": "arn:aws:iam::123456789012:root"},
+				"Action": "kms:*",
+				"Resource": "*"
+			}]
+		}`, "123456789012")
+		Expect(err).To(BeNil())
+		Expect(allowed).To(BeTrue())
+	})
+
+	It("accepts single statements and lists of principals and actions", func() {
+		allowed, err := provision.KeyPolicyAllowsDecrypt(`{
+			"Statement": {
+				"Effect": "Allow",
+				"Principal": {"AWS": ["arn:aws:iam::999999999999:root", "123456789012"]},
+				"Action": ["kms:Encrypt", "kms:Decrypt"]
+			}
+		}`, "123456789012")
+		Expect(err).To(BeNil())
+		Expect(allowed).To(BeTrue())
+	})
+
+	It("rejects other accounts, denies, and other actions", func() {
+		allowed, err := provision.KeyPolicyAllowsDecrypt(`{
+			"Statement": [
+				{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::999999999999:root"}, "Action": "kms:*"},
+				{"Effect": "Deny", "Principal": "*", "Action": "kms:Decrypt"},
+				{"Effect": "Allow", "Principal": {"AWS": "123456789012"}, "Action": "kms:Encrypt"}
+			]
+		}`, "123456789012")
+		Expect(err).To(BeNil())
+		Expect(allowed).To(BeFalse())
+	})
+
+	It("errors on invalid policies", func() {
+		_, err := provision.KeyPolicyAllowsDecrypt(`not json`, "123456789012")
+		Expect(err).NotTo(BeNil())
+	})
+})
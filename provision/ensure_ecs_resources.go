@@ -0,0 +1,656 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"fmt"
+	"hash/crc32"
+	"path"
+	"sort"
+	"strconv"
+
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/log_router"
+	"github.com/adobe-platform/porter/promote"
+)
+
+const (
+	ecsClusterLogicalName         = "ECSCluster"
+	ecsLogGroupLogicalName        = "ECSLogGroup"
+	ecsExecutionRoleLogicalName   = "ECSTaskExecutionRole"
+	ecsTaskRoleLogicalName        = "ECSTaskRole"
+	ecsTaskDefinitionLogicalName  = "ECSTaskDefinition"
+	ecsSecurityGroupLogicalName   = "ECSServiceSecurityGroup"
+	ecsTargetGroupLogicalName     = promote.ECSTargetGroupLogicalName
+	ecsListenerRuleLogicalName    = "ECSListenerRule"
+	ecsServiceLogicalName         = "ECSService"
+	ecsTaskExecutionRolePolicyArn = "arn:aws:iam::aws:policy/service-role/AmazonECSTaskExecutionRolePolicy"
+
+	// the log router writes its config from these before starting
+	ecsLogRouterConfigEnv  = "PORTER_LOG_ROUTER_CONFIG"
+	ecsLogRouterParsersEnv = "PORTER_LOG_ROUTER_PARSERS"
+
+	// requests with this header set to a stack's name reach that stack's
+	// tasks through the load balancer whether or not it's promoted
+	ecsStackHeader = "X-Porter-Stack"
+
+	// listener rule priorities are 1 to 50000
+	ecsListenerRulePriorities = 50000
+)
+
+// ensureECSResources replaces the EC2 resource set (ASG, launch config, ELB,
+// wait condition) with an ECS cluster, task definition, service and, for inet
+// topologies, a target group on the environment's ECS load balancer.
+//
+// The service payload and secrets are uploaded exactly as they are for EC2
+func (recv *stackCreator) ensureECSResources(template *cfn.Template) (success bool) {
+
+	success = recv.ensureECSCluster(template)
+	if !success {
+		return
+	}
+
+	success = recv.ensureECSLogGroup(template)
+	if !success {
+		return
+	}
+
+	success = recv.ensureECSSecrets(template)
+	if !success {
+		return
+	}
+
+	success = recv.ensureECSRoles(template)
+	if !success {
+		return
+	}
+
+	success = recv.ensureECSTaskDefinition(template)
+	if !success {
+		return
+	}
+
+	if recv.region.PrimaryTopology() == conf.Topology_Inet {
+
+		success = recv.ensureECSTargetGroup(template)
+		if !success {
+			return
+		}
+	}
+
+	success = recv.ensureECSService(template)
+	return
+}
+
+func (recv *stackCreator) ensureECSCluster(template *cfn.Template) bool {
+	if recv.environment.ECS.Cluster != "" {
+		return true
+	}
+
+	if exists := template.ResourceExists(cfn.ECS_Cluster); exists {
+		return true
+	}
+
+	resource := map[string]interface{}{
+		"Type": cfn.ECS_Cluster,
+	}
+	template.SetResource(ecsClusterLogicalName, resource)
+
+	return true
+}
+
+func (recv *stackCreator) ensureECSLogGroup(template *cfn.Template) bool {
+
+	retentionDays := 14
+	if recv.environment.Logging != nil {
+		retentionDays = recv.environment.Logging.RetentionDays
+	}
+
+	resource := map[string]interface{}{
+		"Type": cfn.Logs_LogGroup,
+		"Properties": map[string]interface{}{
+			"RetentionInDays": retentionDays,
+		},
+	}
+	template.SetResource(ecsLogGroupLogicalName, resource)
+
+	return true
+}
+
+func (recv *stackCreator) ensureECSRoles(template *cfn.Template) bool {
+
+	assumeRolePolicyDocument := map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []interface{}{
+			map[string]interface{}{
+				"Effect": "Allow",
+				"Principal": map[string]interface{}{
+					"Service": []string{"ecs-tasks.amazonaws.com"},
+				},
+				"Action": []string{
+					"sts:AssumeRole",
+				},
+			},
+		},
+	}
+
+	executionRoleProperties := map[string]interface{}{
+		"Path":                     "/",
+		"AssumeRolePolicyDocument": assumeRolePolicyDocument,
+		"ManagedPolicyArns":        []string{ecsTaskExecutionRolePolicyArn},
+	}
+
+	if policies := recv.ecsSecretsPolicy(); policies != nil {
+		executionRoleProperties["Policies"] = policies
+	}
+
+	// used by the ECS agent to pull images, read secrets, and write logs
+	template.SetResource(ecsExecutionRoleLogicalName, map[string]interface{}{
+		"Type":       cfn.IAM_Role,
+		"Properties": executionRoleProperties,
+	})
+
+	// assumed by the containers. Services add policies to it with a custom
+	// stack definition
+	if _, exists := template.Resources[ecsTaskRoleLogicalName]; !exists {
+		template.SetResource(ecsTaskRoleLogicalName, map[string]interface{}{
+			"Type": cfn.IAM_Role,
+			"Properties": map[string]interface{}{
+				"Path":                     "/",
+				"AssumeRolePolicyDocument": assumeRolePolicyDocument,
+			},
+		})
+	}
+
+	return true
+}
+
+func (recv *stackCreator) ensureECSTaskDefinition(template *cfn.Template) bool {
+
+	containerDefinitions := make([]interface{}, 0)
+	volumes := make([]interface{}, 0)
+
+	for i, container := range recv.region.Containers {
+
+		uid := constants.ContainerUserUid
+		if container.Uid != nil {
+			uid = strconv.Itoa(*container.Uid)
+		}
+
+		containerDefinition := map[string]interface{}{
+			"Name":                   recv.ecsContainerName(container),
+			"Image":                  container.ImageReference(),
+			"Essential":              true,
+			"User":                   uid,
+			"ReadonlyRootFilesystem": container.ReadOnly == nil || *container.ReadOnly,
+			"Environment":            recv.ecsEnvironment(container.Environment),
+			"LogConfiguration": map[string]interface{}{
+				"LogDriver": "awslogs",
+				"Options": map[string]interface{}{
+					"awslogs-group":         map[string]interface{}{"Ref": ecsLogGroupLogicalName},
+					"awslogs-region":        recv.region.Name,
+					"awslogs-stream-prefix": recv.ecsContainerName(container),
+				},
+			},
+		}
+
+		if len(container.Command) > 0 {
+			containerDefinition["Command"] = container.Command
+		}
+
+		if container.Memory > 0 {
+			containerDefinition["Memory"] = container.Memory
+		}
+
+		if container.Topology == conf.Topology_Inet {
+			containerDefinition["PortMappings"] = []interface{}{
+				map[string]interface{}{
+					"ContainerPort": container.InetPort,
+					"Protocol":      "tcp",
+				},
+			}
+		}
+
+		for _, volumeName := range container.PodVolumeNames() {
+			volumes = append(volumes, map[string]interface{}{
+				"Name": recv.ecsVolumeName(container, volumeName),
+			})
+		}
+
+		mountPoints := recv.ecsMountPoints(container, container.Volumes)
+
+		sidecarDefinitions, dependsOn := recv.ecsSidecarDefinitions(container)
+
+		if keys := recv.ecsSecretKeys(container); len(keys) > 0 {
+			if container.SecretsMount == nil {
+				containerDefinition["Secrets"] = recv.ecsContainerSecrets(i, keys)
+			} else {
+				volumes = append(volumes, map[string]interface{}{
+					"Name": recv.ecsVolumeName(container, constants.ECSSecretsMountName),
+				})
+
+				mountPoints = append(mountPoints, map[string]interface{}{
+					"SourceVolume":  recv.ecsVolumeName(container, constants.ECSSecretsMountName),
+					"ContainerPath": container.SecretsMount.Path,
+					"ReadOnly":      true,
+				})
+
+				sidecarDefinitions = append(sidecarDefinitions, recv.ecsSecretsMountDefinition(container, i, keys))
+				dependsOn = append(dependsOn, map[string]interface{}{
+					"ContainerName": recv.ecsSidecarName(container, constants.ECSSecretsMountName),
+					"Condition":     "SUCCESS",
+				})
+			}
+		}
+
+		if len(mountPoints) > 0 {
+			containerDefinition["MountPoints"] = mountPoints
+		}
+
+		if container.LogRouter != nil {
+			containerDefinition["LogConfiguration"] = map[string]interface{}{
+				"LogDriver": "awsfirelens",
+			}
+
+			sidecarDefinitions = append(sidecarDefinitions, recv.ecsLogRouterDefinition(container))
+			dependsOn = append(dependsOn, map[string]interface{}{
+				"ContainerName": recv.ecsSidecarName(container, constants.LogRouterName),
+				"Condition":     "START",
+			})
+		}
+
+		if len(dependsOn) > 0 {
+			containerDefinition["DependsOn"] = dependsOn
+		}
+
+		containerDefinitions = append(containerDefinitions, containerDefinition)
+		containerDefinitions = append(containerDefinitions, sidecarDefinitions...)
+	}
+
+	resource := map[string]interface{}{
+		"Type": cfn.ECS_TaskDefinition,
+		"Properties": map[string]interface{}{
+			"Family":                  map[string]interface{}{"Ref": constants.ParameterStackName},
+			"NetworkMode":             "awsvpc",
+			"RequiresCompatibilities": []string{recv.environment.ECS.LaunchType},
+			"Cpu":                     strconv.Itoa(recv.environment.ECS.Cpu),
+			"Memory":                  strconv.Itoa(recv.environment.ECS.Memory),
+			"ExecutionRoleArn": map[string]interface{}{
+				"Fn::GetAtt": []string{ecsExecutionRoleLogicalName, "Arn"},
+			},
+			"TaskRoleArn": map[string]interface{}{
+				"Fn::GetAtt": []string{ecsTaskRoleLogicalName, "Arn"},
+			},
+			"ContainerDefinitions": containerDefinitions,
+			"Volumes":              volumes,
+		},
+	}
+	template.SetResource(ecsTaskDefinitionLogicalName, resource)
+
+	return true
+}
+
+// ensureECSTargetGroup creates the stack's target group and a rule on the
+// environment's ECS load balancer that forwards requests with ecsStackHeader
+// to it. The rule associates the target group with the load balancer so the
+// service can register tasks in it. Promote points the listeners at it
+func (recv *stackCreator) ensureECSTargetGroup(template *cfn.Template) bool {
+
+	var inetContainer *conf.Container
+	for _, container := range recv.region.Containers {
+		if container.Topology == conf.Topology_Inet {
+			inetContainer = container
+			break
+		}
+	}
+
+	template.SetResource(ecsTargetGroupLogicalName, map[string]interface{}{
+		"Type": cfn.ElasticLoadBalancingV2_TargetGroup,
+		"Properties": map[string]interface{}{
+			"VpcId":                      recv.region.VpcId,
+			"TargetType":                 "ip",
+			"Port":                       inetContainer.InetPort,
+			"Protocol":                   "HTTP",
+			"HealthCheckPath":            inetContainer.HealthCheck.Path,
+			"HealthCheckIntervalSeconds": constants.HC_Interval,
+			"HealthCheckTimeoutSeconds":  constants.HC_Timeout,
+			"HealthyThresholdCount":      constants.HC_HealthyThreshold,
+			"UnhealthyThresholdCount":    constants.HC_UnhealthyThreshold,
+		},
+	})
+
+	template.SetResource(ecsListenerRuleLogicalName, map[string]interface{}{
+		"Type": cfn.ElasticLoadBalancingV2_ListenerRule,
+		"Properties": map[string]interface{}{
+			"ListenerArn": recv.ecsListenerArn,
+			"Priority":    ecsListenerRulePriority(recv.deployment.StackName),
+			"Conditions": []interface{}{
+				map[string]interface{}{
+					"Field": "http-header",
+					"HttpHeaderConfig": map[string]interface{}{
+						"HttpHeaderName": ecsStackHeader,
+						"Values":         []string{recv.deployment.StackName},
+					},
+				},
+			},
+			"Actions": routeForwardActions(ecsTargetGroupLogicalName),
+		},
+	})
+
+	// tasks have their own ENI so only the load balancer can reach them
+	template.SetResource(ecsSecurityGroupLogicalName, map[string]interface{}{
+		"Type": cfn.EC2_SecurityGroup,
+		"Properties": map[string]interface{}{
+			"GroupDescription": "Enable communication from the environment's ALB",
+			"SecurityGroupIngress": []interface{}{
+				map[string]interface{}{
+					"IpProtocol":            "tcp",
+					"FromPort":              inetContainer.InetPort,
+					"ToPort":                inetContainer.InetPort,
+					"SourceSecurityGroupId": recv.ecsLoadBalancerSG,
+				},
+			},
+		},
+	})
+
+	return true
+}
+
+// ecsListenerRulePriority spreads stacks over the listener's priorities. Stack
+// names end with when they were created so the stacks that are alive at once
+// don't collide
+func ecsListenerRulePriority(stackName string) int {
+	return int(crc32.ChecksumIEEE([]byte(stackName))%ecsListenerRulePriorities) + 1
+}
+
+func (recv *stackCreator) ensureECSService(template *cfn.Template) bool {
+
+	var cluster interface{} = recv.environment.ECS.Cluster
+	if recv.environment.ECS.Cluster == "" {
+		clusterLogicalName, err := template.GetResourceName(cfn.ECS_Cluster)
+		if err != nil {
+			recv.log.Error("template.GetResourceName", "Error", err)
+			return false
+		}
+		cluster = map[string]interface{}{"Ref": clusterLogicalName}
+	}
+
+	awsvpcConfiguration := map[string]interface{}{
+		"Subnets": recv.ecsSubnets(),
+	}
+
+	if recv.environment.ECS.LaunchType == conf.LaunchType_Fargate {
+		if recv.environment.ECS.AssignPublicIp {
+			awsvpcConfiguration["AssignPublicIp"] = "ENABLED"
+		} else {
+			awsvpcConfiguration["AssignPublicIp"] = "DISABLED"
+		}
+	}
+
+	props := map[string]interface{}{
+		"Cluster":        cluster,
+		"LaunchType":     recv.environment.ECS.LaunchType,
+		"DesiredCount":   recv.environment.InstanceCount,
+		"TaskDefinition": map[string]interface{}{"Ref": ecsTaskDefinitionLogicalName},
+		"NetworkConfiguration": map[string]interface{}{
+			"AwsvpcConfiguration": awsvpcConfiguration,
+		},
+	}
+
+	resource := map[string]interface{}{
+		"Type":       cfn.ECS_Service,
+		"Properties": props,
+	}
+
+	if recv.region.PrimaryTopology() == conf.Topology_Inet {
+
+		awsvpcConfiguration["SecurityGroups"] = []interface{}{
+			map[string]interface{}{"Ref": ecsSecurityGroupLogicalName},
+		}
+
+		for _, container := range recv.region.Containers {
+			if container.Topology == conf.Topology_Inet {
+				props["LoadBalancers"] = []interface{}{
+					map[string]interface{}{
+						"ContainerName":  recv.ecsContainerName(container),
+						"ContainerPort":  container.InetPort,
+						"TargetGroupArn": map[string]interface{}{"Ref": ecsTargetGroupLogicalName},
+					},
+				}
+				break
+			}
+		}
+
+		// the target group must be associated with a load balancer before
+		// the service can register tasks in it
+		resource["DependsOn"] = []string{ecsListenerRuleLogicalName}
+	}
+
+	template.SetResource(ecsServiceLogicalName, resource)
+
+	return true
+}
+
+func (recv *stackCreator) ecsSubnets() []string {
+	subnets := make([]string, 0)
+	for _, az := range recv.region.AZs {
+		subnets = append(subnets, az.SubnetID)
+	}
+	return subnets
+}
+
+// ecsSidecarDefinitions returns the container definitions of the container's
+// sidecars and the dependencies of the container on them. A task's containers
+// share a network namespace so unlike on EC2 the container can start last
+func (recv *stackCreator) ecsSidecarDefinitions(container *conf.Container) (definitions []interface{}, dependsOn []interface{}) {
+
+	definitions = make([]interface{}, 0)
+	dependsOn = make([]interface{}, 0)
+
+	dependency := func(sidecarName string) interface{} {
+		condition := "START"
+		for _, sidecar := range container.Sidecars {
+			if sidecar.Name == sidecarName && sidecar.HealthCheck != nil {
+				condition = "HEALTHY"
+			}
+		}
+
+		return map[string]interface{}{
+			"ContainerName": recv.ecsSidecarName(container, sidecarName),
+			"Condition":     condition,
+		}
+	}
+
+	for _, sidecar := range container.Sidecars {
+
+		uid := constants.ContainerUserUid
+		if sidecar.Uid != nil {
+			uid = strconv.Itoa(*sidecar.Uid)
+		} else if container.Uid != nil {
+			uid = strconv.Itoa(*container.Uid)
+		}
+
+		definition := map[string]interface{}{
+			"Name":                   recv.ecsSidecarName(container, sidecar.Name),
+			"Image":                  sidecar.Image,
+			"Essential":              true,
+			"User":                   uid,
+			"ReadonlyRootFilesystem": sidecar.ReadOnly == nil || *sidecar.ReadOnly,
+			"Environment":            recv.ecsEnvironment(sidecar.Environment),
+			"LogConfiguration": map[string]interface{}{
+				"LogDriver": "awslogs",
+				"Options": map[string]interface{}{
+					"awslogs-group":         map[string]interface{}{"Ref": ecsLogGroupLogicalName},
+					"awslogs-region":        recv.region.Name,
+					"awslogs-stream-prefix": recv.ecsSidecarName(container, sidecar.Name),
+				},
+			},
+		}
+
+		if sidecar.Memory > 0 {
+			definition["Memory"] = sidecar.Memory
+		}
+
+		if len(sidecar.Command) > 0 {
+			definition["Command"] = sidecar.Command
+		}
+
+		if len(sidecar.Volumes) > 0 {
+			definition["MountPoints"] = recv.ecsMountPoints(container, sidecar.Volumes)
+		}
+
+		if sidecar.HealthCheck != nil {
+			definition["HealthCheck"] = map[string]interface{}{
+				"Command":  append([]string{"CMD"}, sidecar.HealthCheck.Command...),
+				"Interval": sidecar.HealthCheck.Interval,
+				"Timeout":  sidecar.HealthCheck.Timeout,
+				"Retries":  sidecar.HealthCheck.Retries,
+			}
+		}
+
+		if len(sidecar.DependsOn) > 0 {
+			sidecarDependsOn := make([]interface{}, 0)
+			for _, sidecarName := range sidecar.DependsOn {
+				sidecarDependsOn = append(sidecarDependsOn, dependency(sidecarName))
+			}
+			definition["DependsOn"] = sidecarDependsOn
+		}
+
+		definitions = append(definitions, definition)
+		dependsOn = append(dependsOn, dependency(sidecar.Name))
+	}
+
+	return
+}
+
+// ecsLogRouterDefinition is the FireLens container the container's logs are
+// routed through. FireLens writes the main config so the router writes the
+// parsers and outputs it includes from its environment before starting.
+// Output options can reference the container's environment like ${TOKEN}
+func (recv *stackCreator) ecsLogRouterDefinition(container *conf.Container) interface{} {
+
+	vars := map[string]string{
+		ecsLogRouterConfigEnv:  log_router.Pipeline(container.LogRouter, constants.LogRouterConfigDir),
+		ecsLogRouterParsersEnv: log_router.Parsers(container.LogRouter),
+	}
+	for key, value := range container.Environment {
+		vars[key] = value
+	}
+
+	configPath := path.Join(constants.LogRouterConfigDir, log_router.ConfigFile)
+	parsersPath := path.Join(constants.LogRouterConfigDir, log_router.ParsersFile)
+
+	return map[string]interface{}{
+		"Name":      recv.ecsSidecarName(container, constants.LogRouterName),
+		"Image":     container.LogRouter.Image,
+		"Essential": true,
+		// FireLens needs the router to run as root
+		"User":        "0",
+		"Environment": recv.ecsEnvironment(vars),
+		"EntryPoint":  []string{"/bin/sh", "-c"},
+		"Command": []string{
+			fmt.Sprintf(`mkdir -p %s && printf '%%s' "$%s" > %s && printf '%%s' "$%s" > %s && exec /entrypoint.sh`,
+				constants.LogRouterConfigDir,
+				ecsLogRouterConfigEnv, configPath,
+				ecsLogRouterParsersEnv, parsersPath),
+		},
+		"FirelensConfiguration": map[string]interface{}{
+			"Type": "fluentbit",
+			"Options": map[string]interface{}{
+				"config-file-type":        "file",
+				"config-file-value":       configPath,
+				"enable-ecs-log-metadata": "true",
+			},
+		},
+		"LogConfiguration": map[string]interface{}{
+			"LogDriver": "awslogs",
+			"Options": map[string]interface{}{
+				"awslogs-group":         map[string]interface{}{"Ref": ecsLogGroupLogicalName},
+				"awslogs-region":        recv.region.Name,
+				"awslogs-stream-prefix": recv.ecsSidecarName(container, constants.LogRouterName),
+			},
+		},
+	}
+}
+
+// ecsEnvironment is porter's variables followed by the configured ones in a
+// stable order so the task definition only changes when they do
+func (recv *stackCreator) ecsEnvironment(vars map[string]string) []interface{} {
+	environment := []interface{}{
+		map[string]interface{}{"Name": "PORTER_ENVIRONMENT", "Value": recv.environment.Name},
+		map[string]interface{}{"Name": "AWS_REGION", "Value": recv.region.Name},
+		map[string]interface{}{"Name": constants.EnvDeploymentId, "Value": recv.deployment.StackName},
+		map[string]interface{}{"Name": constants.EnvStackColor, "Value": recv.deployment.StackColor},
+	}
+
+	dependencyEnv := recv.dependencyEnv()
+	envVars := make([]string, 0, len(dependencyEnv))
+	for envVar := range dependencyEnv {
+		envVars = append(envVars, envVar)
+	}
+	sort.Strings(envVars)
+
+	for _, envVar := range envVars {
+		environment = append(environment, map[string]interface{}{
+			"Name":  envVar,
+			"Value": map[string]interface{}{"Ref": dependencyEnv[envVar]},
+		})
+	}
+
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		environment = append(environment,
+			map[string]interface{}{"Name": key, "Value": vars[key]})
+	}
+
+	return environment
+}
+
+func (recv *stackCreator) ecsMountPoints(container *conf.Container, volumes []*conf.Volume) []interface{} {
+	mountPoints := make([]interface{}, 0)
+
+	for _, volume := range volumes {
+		mountPoints = append(mountPoints, map[string]interface{}{
+			"SourceVolume":  recv.ecsVolumeName(container, volume.Name),
+			"ContainerPath": volume.Path,
+			"ReadOnly":      volume.ReadOnly,
+		})
+	}
+
+	return mountPoints
+}
+
+// sidecar and volume names are only unique within a container but ECS needs
+// them unique within the task
+func (recv *stackCreator) ecsSidecarName(container *conf.Container, sidecarName string) string {
+	return recv.ecsContainerName(container) + "-" + sidecarName
+}
+
+func (recv *stackCreator) ecsVolumeName(container *conf.Container, volumeName string) string {
+	return recv.ecsContainerName(container) + "-" + volumeName
+}
+
+// ecsContainerName is the name in the task definition which can't be the
+// image name porter assigns during pack
+func (recv *stackCreator) ecsContainerName(container *conf.Container) string {
+	if container.OriginalName != "" {
+		return container.OriginalName
+	}
+	return recv.config.ServiceName
+}
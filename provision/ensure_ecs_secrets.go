@@ -0,0 +1,263 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+)
+
+const (
+	// where the secrets_mount container writes the files it shares with the
+	// container
+	ecsSecretsMountDir = "/porter-secrets"
+
+	// written last with a checksum of the secrets like hosts do
+	ecsSecretsVersionFile = ".version"
+)
+
+// ECS injects secrets as environment variables so keys must be valid names
+var ecsSecretKeyRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ECS tasks can't decrypt the secrets payload hosts download. Instead each
+// container's src_env_file is a Secrets Manager secret of the stack whose
+// value is a NoEcho parameter so it's never in the template. The task
+// definition references each key of the secret
+func (recv *stackCreator) ensureECSSecrets(template *cfn.Template) bool {
+
+	for i, container := range recv.region.Containers {
+
+		keys := recv.ecsSecretKeys(container)
+		if len(keys) == 0 {
+			continue
+		}
+
+		template.Parameters[ecsSecretsParameterName(i)] = cfn.ParameterInput{
+			Description: "Secrets of container " + recv.ecsContainerName(container),
+			Type:        "String",
+			NoEcho:      true,
+		}
+
+		template.SetResource(ecsSecretsLogicalName(i), map[string]interface{}{
+			"Type": cfn.SecretsManager_Secret,
+			"Properties": map[string]interface{}{
+				"Description": "porter src_env_file of container " + recv.ecsContainerName(container),
+				"SecretString": map[string]interface{}{
+					"Ref": ecsSecretsParameterName(i),
+				},
+			},
+		})
+	}
+
+	return true
+}
+
+// ecsSecretsParameters are the values of the NoEcho parameters
+// ensureECSSecrets adds to the template
+func (recv *stackCreator) ecsSecretsParameters() (parameters map[string]string, success bool) {
+
+	parameters = make(map[string]string)
+
+	for i, container := range recv.region.Containers {
+
+		secrets := parseEnvFile(recv.ecsSecrets[container.Name])
+		if len(secrets) == 0 {
+			continue
+		}
+
+		for key := range secrets {
+			if !ecsSecretKeyRegex.MatchString(key) {
+				recv.log.Error("Secret keys must be environment variable names with compute: ecs",
+					"Container", container.OriginalName, "Key", key)
+				return
+			}
+		}
+
+		secretsBytes, err := json.Marshal(secrets)
+		if err != nil {
+			recv.log.Error("json.Marshal", "Error", err)
+			return
+		}
+
+		if len(secretsBytes) > constants.ParameterValueMaxBytes {
+			recv.log.Error("A container's secrets can't be more than a stack parameter holds with compute: ecs",
+				"Container", container.OriginalName,
+				"Bytes", len(secretsBytes),
+				"MaxBytes", constants.ParameterValueMaxBytes)
+			return
+		}
+
+		parameters[ecsSecretsParameterName(i)] = string(secretsBytes)
+	}
+
+	success = true
+	return
+}
+
+// ecsContainerSecrets are the container definition secrets of each key of the
+// container's secret
+func (recv *stackCreator) ecsContainerSecrets(index int, keys []string) []interface{} {
+	containerSecrets := make([]interface{}, 0, len(keys))
+
+	for _, key := range keys {
+		containerSecrets = append(containerSecrets, map[string]interface{}{
+			"Name": key,
+			"ValueFrom": map[string]interface{}{
+				"Fn::Join": []interface{}{"", []interface{}{
+					map[string]interface{}{"Ref": ecsSecretsLogicalName(index)},
+					":" + key + "::",
+				}},
+			},
+		})
+	}
+
+	return containerSecrets
+}
+
+// ecsSecretsMountDefinition writes the container's secrets as files the way
+// hosts do for secrets_mount. It runs to completion before the container
+// starts and shares the files through a task volume
+func (recv *stackCreator) ecsSecretsMountDefinition(container *conf.Container, index int, keys []string) interface{} {
+
+	uid := constants.ContainerUserUid
+	if container.SecretsMount.Uid != nil {
+		uid = strconv.Itoa(*container.SecretsMount.Uid)
+	} else if container.Uid != nil {
+		uid = strconv.Itoa(*container.Uid)
+	}
+
+	gid := uid
+	if container.SecretsMount.Gid != nil {
+		gid = strconv.Itoa(*container.SecretsMount.Gid)
+	}
+
+	checksumArray := sha256.Sum256([]byte(recv.ecsSecrets[container.Name]))
+	version := hex.EncodeToString(checksumArray[:])
+
+	commands := make([]string, 0)
+	for _, key := range keys {
+		commands = append(commands, fmt.Sprintf(`printf '%%s' "$%s" > %s`, key, path.Join(ecsSecretsMountDir, key)))
+	}
+	commands = append(commands,
+		fmt.Sprintf("chmod %s %s/*", container.SecretsMount.Mode, ecsSecretsMountDir),
+		fmt.Sprintf("printf '%%s' %s > %s", version, path.Join(ecsSecretsMountDir, ecsSecretsVersionFile)),
+		fmt.Sprintf("chmod 0444 %s", path.Join(ecsSecretsMountDir, ecsSecretsVersionFile)),
+		fmt.Sprintf("chown -R %s:%s %s", uid, gid, ecsSecretsMountDir),
+	)
+
+	name := recv.ecsSidecarName(container, constants.ECSSecretsMountName)
+
+	return map[string]interface{}{
+		"Name":       name,
+		"Image":      constants.ECSSecretsMountImage,
+		"Essential":  false,
+		"User":       "0",
+		"Secrets":    recv.ecsContainerSecrets(index, keys),
+		"EntryPoint": []string{"/bin/sh", "-c"},
+		"Command":    []string{"set -e && " + strings.Join(commands, " && ")},
+		"MountPoints": []interface{}{
+			map[string]interface{}{
+				"SourceVolume":  recv.ecsVolumeName(container, constants.ECSSecretsMountName),
+				"ContainerPath": ecsSecretsMountDir,
+				"ReadOnly":      false,
+			},
+		},
+		"LogConfiguration": map[string]interface{}{
+			"LogDriver": "awslogs",
+			"Options": map[string]interface{}{
+				"awslogs-group":         map[string]interface{}{"Ref": ecsLogGroupLogicalName},
+				"awslogs-region":        recv.region.Name,
+				"awslogs-stream-prefix": name,
+			},
+		},
+	}
+}
+
+// ecsSecretsPolicy lets the ECS agent read the stack's secrets
+func (recv *stackCreator) ecsSecretsPolicy() []interface{} {
+	secretArns := make([]interface{}, 0)
+
+	for i, container := range recv.region.Containers {
+		if len(recv.ecsSecretKeys(container)) > 0 {
+			secretArns = append(secretArns, map[string]interface{}{
+				"Ref": ecsSecretsLogicalName(i),
+			})
+		}
+	}
+
+	if len(secretArns) == 0 {
+		return nil
+	}
+
+	return []interface{}{
+		map[string]interface{}{
+			"PolicyName": "ReadContainerSecrets",
+			"PolicyDocument": map[string]interface{}{
+				"Version": "2012-10-17",
+				"Statement": []interface{}{
+					map[string]interface{}{
+						"Effect":   "Allow",
+						"Action":   []string{"secretsmanager:GetSecretValue"},
+						"Resource": secretArns,
+					},
+				},
+			},
+		},
+	}
+}
+
+// ecsSecretKeys are the sorted keys of the container's secrets
+func (recv *stackCreator) ecsSecretKeys(container *conf.Container) []string {
+	secrets := parseEnvFile(recv.ecsSecrets[container.Name])
+
+	keys := make([]string, 0, len(secrets))
+	for key := range secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// parseEnvFile reads the KEY=VALUE lines of a cleaned env file
+func parseEnvFile(envFile string) map[string]string {
+	vars := make(map[string]string)
+
+	for _, kvp := range strings.Split(envFile, "\n") {
+		kvpParts := strings.SplitN(kvp, "=", 2)
+		if len(kvpParts) != 2 || kvpParts[0] == "" {
+			continue
+		}
+		vars[kvpParts[0]] = kvpParts[1]
+	}
+
+	return vars
+}
+
+func ecsSecretsParameterName(index int) string {
+	return constants.ParameterECSSecrets + strconv.Itoa(index)
+}
+
+func ecsSecretsLogicalName(index int) string {
+	return "ECSContainerSecrets" + strconv.Itoa(index)
+}
@@ -0,0 +1,60 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+)
+
+// ensureLogging adds the log groups hosts ship container and host logs to.
+// ECS tasks log to the ECS log group instead
+func (recv *stackCreator) ensureLogging(template *cfn.Template) bool {
+	logging := recv.environment.Logging
+	if logging == nil || recv.environment.Compute == conf.Compute_ECS {
+		return true
+	}
+
+	if logging.ShipsContainers() {
+		template.SetResource(constants.ContainerLogGroup, logGroup(logging))
+	}
+
+	if len(logging.HostFiles) > 0 {
+		template.SetResource(constants.HostLogGroup, logGroup(logging))
+	}
+
+	return true
+}
+
+// logGroupNames are the logical names of the log groups ensureLogging added
+func logGroupNames(template *cfn.Template) (names []string) {
+	for _, name := range []string{constants.ContainerLogGroup, constants.HostLogGroup} {
+		if _, exists := template.Resources[name]; exists {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+// log groups outlive the stack so the logs of a pruned or rolled back stack
+// are kept for the group's retention
+func logGroup(logging *conf.Logging) map[string]interface{} {
+	return map[string]interface{}{
+		"Type":                cfn.Logs_LogGroup,
+		"DeletionPolicy":      "Retain",
+		"UpdateReplacePolicy": "Retain",
+		"Properties": map[string]interface{}{
+			"RetentionInDays": logging.RetentionDays,
+		},
+	}
+}
@@ -0,0 +1,338 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/inconshreveable/log15"
+)
+
+// monitoredGroup is an autoscaling group of the stack the alarms watch
+type monitoredGroup struct {
+	logicalId string
+	name      string
+}
+
+// EnsureMonitoringStack points the region's alarms and dashboard at the
+// autoscaling groups and routes ALB of the stack that was just provisioned,
+// creating the region's MonitoringStackName the first time.
+//
+// The topic and dashboard are retained if they're ever replaced or the stack
+// is deleted so subscriptions and the dashboard's history aren't lost. Load
+// balancer alarms watch the ELBs instances are promoted into because that's
+// where traffic arrives. Regions without a load balancer skip them
+func EnsureMonitoringStack(log log15.Logger, roleSession *session.Session, config *conf.Config,
+	environment *conf.Environment, regionName, stackId string) (success bool) {
+
+	region, err := environment.GetRegion(regionName)
+	if err != nil {
+		log.Error("GetRegion", "Error", err)
+		return
+	}
+
+	monitoring, err := environment.GetMonitoring(regionName)
+	if err != nil {
+		log.Error("GetMonitoring", "Error", err)
+		return
+	}
+	if monitoring == nil {
+		success = true
+		return
+	}
+
+	stackName := conf.MonitoringStackName(config.ServiceName, environment.Name)
+	log = log.New("StackName", stackName)
+
+	client := cloudformation.New(roleSession)
+
+	autoScalingGroups, routeALB, err := monitoredResources(client, stackId)
+	if err != nil {
+		log.Error("DescribeStackResources", "StackId", stackId, "Error", err)
+		return
+	}
+
+	template := cfn.NewTemplate()
+	template.Description = "porter managed monitoring for " + config.ServiceName + " " + environment.Name
+
+	var topic interface{}
+	if monitoring.SNSTopicARN == "" {
+		template.SetResource(constants.OpsTopic, map[string]interface{}{
+			"Type":                cfn.SNS_Topic,
+			"DeletionPolicy":      "Retain",
+			"UpdateReplacePolicy": "Retain",
+		})
+		topic = map[string]interface{}{"Ref": constants.OpsTopic}
+	} else {
+		topic = monitoring.SNSTopicARN
+	}
+
+	for _, alarm := range monitoring.Alarms {
+		switch alarm.Metric {
+		case conf.AlarmMetric_HTTP5xx:
+			for i, elb := range region.ELBs {
+				template.SetResource(fmt.Sprintf("HTTP5xxAlarm%d", i+1),
+					metricAlarm(alarm, topic, "AWS/ELB", "HTTPCode_Backend_5XX", "Sum",
+						"LoadBalancerName", elb.Name))
+			}
+
+			if routeALB != "" {
+				template.SetResource(constants.RouteALBLogicalName+"HTTP5xxAlarm",
+					metricAlarm(alarm, topic, "AWS/ApplicationELB", "HTTPCode_Target_5XX_Count", "Sum",
+						"LoadBalancer", routeALB))
+			}
+
+		case conf.AlarmMetric_UnhealthyHosts:
+			for i, elb := range region.ELBs {
+				template.SetResource(fmt.Sprintf("UnhealthyHostsAlarm%d", i+1),
+					metricAlarm(alarm, topic, "AWS/ELB", "UnHealthyHostCount", "Maximum",
+						"LoadBalancerName", elb.Name))
+			}
+
+		case conf.AlarmMetric_CPU:
+			for _, autoScalingGroup := range autoScalingGroups {
+				template.SetResource(autoScalingGroup.logicalId+"CPUAlarm",
+					metricAlarm(alarm, topic, "AWS/EC2", "CPUUtilization", "Average",
+						"AutoScalingGroupName", autoScalingGroup.name))
+			}
+
+		case conf.AlarmMetric_Disk:
+			for _, autoScalingGroup := range autoScalingGroups {
+				template.SetResource(autoScalingGroup.logicalId+"DiskAlarm",
+					metricAlarm(alarm, topic, constants.HostMetricsNamespace, constants.DiskUsedPercentMetric, "Maximum",
+						"AutoScalingGroupName", autoScalingGroup.name))
+			}
+		}
+	}
+
+	if *monitoring.Dashboard {
+		body, err := dashboardBody(region, autoScalingGroups, routeALB)
+		if err != nil {
+			log.Error("json.Marshal", "Error", err)
+			return
+		}
+
+		template.SetResource("Dashboard", map[string]interface{}{
+			"Type":                cfn.CloudWatch_Dashboard,
+			"DeletionPolicy":      "Retain",
+			"UpdateReplacePolicy": "Retain",
+			"Properties": map[string]interface{}{
+				// dashboards are global
+				"DashboardName": map[string]interface{}{"Fn::Sub": "${AWS::StackName}-${AWS::Region}"},
+				"DashboardBody": map[string]interface{}{"Fn::Sub": body},
+			},
+		})
+	}
+
+	templateBytes, err := json.Marshal(template)
+	if err != nil {
+		log.Error("json.Marshal", "Error", err)
+		return
+	}
+
+	cfnRoleARN, err := environment.GetCFNRoleARN(regionName)
+	if err != nil {
+		log.Error("GetCFNRoleARN", "Error", err)
+		return
+	}
+
+	describeInput := &cfnlib.DescribeStacksInput{
+		StackName: aws.String(stackName),
+	}
+
+	_, err = cloudformation.DescribeStack(client, stackName)
+	switch {
+	case err != nil && !strings.Contains(err.Error(), "does not exist"):
+		log.Error("DescribeStack", "Error", err)
+		return
+
+	case err != nil:
+		log.Info("Creating the monitoring stack")
+		_, err = cloudformation.CreateStackWithBody(client, stackName, string(templateBytes), cfnRoleARN)
+		if err == cloudformation.ErrAudited {
+			success = true
+			return
+		}
+		if err != nil {
+			log.Error("CreateStack", "Error", err)
+			return
+		}
+
+		err = client.WaitUntilStackCreateComplete(describeInput)
+		if err != nil {
+			log.Error("WaitUntilStackCreateComplete", "Error", err)
+			return
+		}
+
+	default:
+		err = cloudformation.UpdateStackWithBody(client, stackName, string(templateBytes), cfnRoleARN)
+		if err != nil && !strings.Contains(err.Error(), "No updates are to be performed") {
+			log.Error("UpdateStack", "Error", err)
+			return
+		}
+
+		if err == nil {
+			log.Info("Pointing the monitoring stack at the provisioned stack", "StackId", stackId)
+			err = client.WaitUntilStackUpdateComplete(describeInput)
+			if err != nil {
+				log.Error("WaitUntilStackUpdateComplete", "Error", err)
+				return
+			}
+		}
+	}
+
+	success = true
+	return
+}
+
+// monitoredResources are the stack's autoscaling groups sorted by logical id
+// and the full name of its routes ALB which is empty if it has none
+func monitoredResources(client *cfnlib.CloudFormation, stackId string) ([]monitoredGroup, string, error) {
+	output, err := client.DescribeStackResources(&cfnlib.DescribeStackResourcesInput{
+		StackName: aws.String(stackId),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var (
+		autoScalingGroups []monitoredGroup
+		routeALB          string
+	)
+
+	for _, resource := range output.StackResources {
+		if resource == nil || resource.PhysicalResourceId == nil {
+			continue
+		}
+
+		switch {
+		case aws.StringValue(resource.ResourceType) == cfn.AutoScaling_AutoScalingGroup:
+			autoScalingGroups = append(autoScalingGroups, monitoredGroup{
+				logicalId: aws.StringValue(resource.LogicalResourceId),
+				name:      *resource.PhysicalResourceId,
+			})
+
+		case aws.StringValue(resource.LogicalResourceId) == constants.RouteALBLogicalName:
+			// the ARN ends with loadbalancer/app/<name>/<id> and the metric's
+			// dimension is app/<name>/<id>
+			arn := *resource.PhysicalResourceId
+			if i := strings.Index(arn, ":loadbalancer/"); i != -1 {
+				routeALB = arn[i+len(":loadbalancer/"):]
+			}
+		}
+	}
+
+	sort.Slice(autoScalingGroups, func(i, j int) bool {
+		return autoScalingGroups[i].logicalId < autoScalingGroups[j].logicalId
+	})
+
+	return autoScalingGroups, routeALB, nil
+}
+
+// metricAlarm notifies the topic when the metric reaches the alarm's threshold
+// and again when it recovers. Missing data is treated as healthy so a quiet
+// service or one still booting doesn't alarm
+func metricAlarm(alarm *conf.Alarm, topic interface{},
+	namespace, metricName, statistic, dimensionName string, dimensionValue interface{}) map[string]interface{} {
+
+	return map[string]interface{}{
+		"Type": cfn.CloudWatch_Alarm,
+		"Properties": map[string]interface{}{
+			"AlarmDescription": map[string]interface{}{
+				"Fn::Sub": fmt.Sprintf("${AWS::StackName} %s", alarm.Metric),
+			},
+			"Namespace":  namespace,
+			"MetricName": metricName,
+			"Dimensions": []interface{}{
+				map[string]interface{}{
+					"Name":  dimensionName,
+					"Value": dimensionValue,
+				},
+			},
+			"Statistic":          statistic,
+			"Period":             60,
+			"EvaluationPeriods":  alarm.EvaluationPeriods,
+			"Threshold":          alarm.Threshold,
+			"ComparisonOperator": "GreaterThanOrEqualToThreshold",
+			"TreatMissingData":   "notBreaching",
+			"AlarmActions":       []interface{}{topic},
+			"OKActions":          []interface{}{topic},
+		},
+	}
+}
+
+// dashboardBody is the dashboard's JSON for Fn::Sub which fills in the
+// region
+func dashboardBody(region *conf.Region, autoScalingGroups []monitoredGroup, routeALB string) (string, error) {
+	var cpu, disk, requests, errors5xx, latency []interface{}
+
+	for _, autoScalingGroup := range autoScalingGroups {
+		cpu = append(cpu, []string{"AWS/EC2", "CPUUtilization",
+			"AutoScalingGroupName", autoScalingGroup.name})
+		disk = append(disk, []string{constants.HostMetricsNamespace, constants.DiskUsedPercentMetric,
+			"AutoScalingGroupName", autoScalingGroup.name})
+	}
+
+	for _, elb := range region.ELBs {
+		requests = append(requests, []string{"AWS/ELB", "RequestCount", "LoadBalancerName", elb.Name})
+		errors5xx = append(errors5xx, []string{"AWS/ELB", "HTTPCode_Backend_5XX", "LoadBalancerName", elb.Name})
+		latency = append(latency, []string{"AWS/ELB", "Latency", "LoadBalancerName", elb.Name})
+	}
+
+	if routeALB != "" {
+		requests = append(requests, []string{"AWS/ApplicationELB", "RequestCount", "LoadBalancer", routeALB})
+		errors5xx = append(errors5xx, []string{"AWS/ApplicationELB", "HTTPCode_Target_5XX_Count", "LoadBalancer", routeALB})
+		latency = append(latency, []string{"AWS/ApplicationELB", "TargetResponseTime", "LoadBalancer", routeALB})
+	}
+
+	widgets := make([]interface{}, 0)
+	addWidget := func(title, stat string, metrics []interface{}) {
+		if len(metrics) == 0 {
+			return
+		}
+
+		// 2 widgets per row on a 24 column grid
+		widgets = append(widgets, map[string]interface{}{
+			"type":   "metric",
+			"x":      (len(widgets) % 2) * 12,
+			"y":      (len(widgets) / 2) * 6,
+			"width":  12,
+			"height": 6,
+			"properties": map[string]interface{}{
+				"title":   title,
+				"region":  "${AWS::Region}",
+				"stat":    stat,
+				"period":  60,
+				"metrics": metrics,
+			},
+		})
+	}
+
+	addWidget("CPU utilization", "Average", cpu)
+	addWidget("Disk used percent", "Maximum", disk)
+	addWidget("Requests", "Sum", requests)
+	addWidget("5xx responses", "Sum", errors5xx)
+	addWidget("Latency", "Average", latency)
+
+	body, err := json.Marshal(map[string]interface{}{"widgets": widgets})
+	return string(body), err
+}
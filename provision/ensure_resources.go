@@ -12,6 +12,9 @@
 package provision
 
 import (
+	"fmt"
+	"strconv"
+
 	"github.com/adobe-platform/porter/cfn"
 	"github.com/adobe-platform/porter/cfn_template"
 	"github.com/adobe-platform/porter/conf"
@@ -26,6 +29,11 @@ func (recv *stackCreator) ensureResources(template *cfn.Template) (success bool)
 		return
 	}
 
+	if recv.environment.Compute == conf.Compute_ECS {
+		success = recv.ensureECSResources(template)
+		return
+	}
+
 	success = recv.ensureMappings(template)
 	if !success {
 		return
@@ -36,6 +44,11 @@ func (recv *stackCreator) ensureResources(template *cfn.Template) (success bool)
 		return
 	}
 
+	success = recv.ensureProgressQueue(template)
+	if !success {
+		return
+	}
+
 	success = recv.ensureIAMRole(template)
 	if !success {
 		return
@@ -56,6 +69,11 @@ func (recv *stackCreator) ensureResources(template *cfn.Template) (success bool)
 		return
 	}
 
+	success = recv.ensureScaling(template)
+	if !success {
+		return
+	}
+
 	// overloaded to include metadata which is why it applies
 	// to all topologies
 	success = recv.ensureWaitConditionHandle(template)
@@ -70,6 +88,12 @@ func (recv *stackCreator) ensureResources(template *cfn.Template) (success bool)
 
 	switch recv.region.PrimaryTopology() {
 	case conf.Topology_Inet:
+		if recv.region.DNSToInstances() {
+			// promote points dns at the instances. There's no ELB and
+			// clients reach the instances through the security block
+			break
+		}
+
 		success = recv.ensureELB(template)
 		if !success {
 			return
@@ -94,8 +118,15 @@ func (recv *stackCreator) ensureResources(template *cfn.Template) (success bool)
 		if !success {
 			return
 		}
+
+		success = recv.ensureRouteALB(template)
+		if !success {
+			return
+		}
 	}
 
+	// after the ELB resources which elb rules refer to
+	success = recv.ensureSecurity(template)
 	return
 }
 
@@ -123,6 +154,13 @@ func (recv *stackCreator) ensureParameters(template *cfn.Template) bool {
 		Type:        "String",
 	}
 
+	template.Parameters[constants.ParameterStackColor] = cfn.ParameterInput{
+		Description:   "Porter stack color",
+		Type:          "String",
+		AllowedValues: []string{recv.deployment.StackColor},
+		Default:       recv.deployment.StackColor,
+	}
+
 	template.Parameters[constants.ParameterSecretsKey] = cfn.ParameterInput{
 		Description: "Symmetric key for secrets",
 		Type:        "String",
@@ -133,7 +171,19 @@ func (recv *stackCreator) ensureParameters(template *cfn.Template) bool {
 		Type:        "String",
 	}
 
-	return true
+	// Amazon Linux 1 is x86 only so arm64 instances run Amazon Linux 2
+	// unless the ami block says otherwise
+	for _, architecture := range recv.environment.RegionArchitectures(&recv.region) {
+		if architecture == conf.Architecture_ARM64 && recv.environment.AMI == nil {
+			template.Parameters[constants.ParameterImageIdArm64] = cfn.ParameterInput{
+				Description: "Amazon Linux 2 arm64 AMI",
+				Type:        "AWS::SSM::Parameter::Value<AWS::EC2::Image::Id>",
+				Default:     constants.ImageIdArm64SSMPath,
+			}
+		}
+	}
+
+	return recv.ensureDependencyParameters(template)
 }
 
 func (recv *stackCreator) ensureMappings(template *cfn.Template) bool {
@@ -160,8 +210,26 @@ func (recv *stackCreator) ensureSignalQueue(template *cfn.Template) bool {
 	return true
 }
 
+// Instances report bootstrap milestones on this queue while the deployer polls
+// stack creation
+func (recv *stackCreator) ensureProgressQueue(template *cfn.Template) bool {
+	resource := map[string]interface{}{
+		"Type": cfn.SQS_Queue,
+		"Properties": map[string]interface{}{
+			"MaximumMessageSize":     1024,
+			"MessageRetentionPeriod": 300,
+		},
+	}
+
+	template.SetResource(constants.ProgressQueue, resource)
+
+	return true
+}
+
 func (recv *stackCreator) ensureIAMRole(template *cfn.Template) bool {
 	if exists := template.ResourceExists(cfn.IAM_Role); exists {
+		// setRoleAndPath fails if there's more than one
+		recv.instanceRole, _ = template.GetResourceName(cfn.IAM_Role)
 		return true
 	}
 
@@ -169,6 +237,7 @@ func (recv *stackCreator) ensureIAMRole(template *cfn.Template) bool {
 		"Type": cfn.IAM_Role,
 	}
 	template.SetResource("IAMRole", resource)
+	recv.instanceRole = "IAMRole"
 
 	return true
 }
@@ -200,27 +269,42 @@ func (recv *stackCreator) ensureELB(template *cfn.Template) bool {
 }
 
 func (recv *stackCreator) ensureAutoScalingLaunchConfig(template *cfn.Template) bool {
-	if exists := template.ResourceExists(cfn.AutoScaling_LaunchConfiguration); exists {
-		return true
-	}
-
-	resource := map[string]interface{}{
-		"Type": cfn.AutoScaling_LaunchConfiguration,
-	}
-	template.SetResource("AutoScalingLaunchConfiguration", resource)
-
-	return true
+	return recv.ensureInstanceGroupResource(template,
+		cfn.AutoScaling_LaunchConfiguration, "AutoScalingLaunchConfiguration")
 }
 
 func (recv *stackCreator) ensureAutoScalingGroup(template *cfn.Template) bool {
-	if exists := template.ResourceExists(cfn.AutoScaling_AutoScalingGroup); exists {
+	return recv.ensureInstanceGroupResource(template,
+		cfn.AutoScaling_AutoScalingGroup, "AutoScalingGroup")
+}
+
+// ensureInstanceGroupResource creates one resource per instance group, or a
+// single resource if there are none, tagged with the group it belongs to
+func (recv *stackCreator) ensureInstanceGroupResource(template *cfn.Template, resourceType, logicalName string) bool {
+	if exists := template.ResourceExists(resourceType); exists {
+
+		if len(recv.environment.InstanceGroups) > 0 {
+			recv.log.Error("instance_groups can't be used with a stack definition that defines a " + resourceType)
+			return false
+		}
 		return true
 	}
 
-	resource := map[string]interface{}{
-		"Type": cfn.AutoScaling_AutoScalingGroup,
+	if len(recv.environment.InstanceGroups) == 0 {
+		template.SetResource(logicalName, map[string]interface{}{
+			"Type": resourceType,
+		})
+		return true
+	}
+
+	for _, group := range recv.environment.InstanceGroups {
+		template.SetResource(logicalName+group.Name, map[string]interface{}{
+			"Type": resourceType,
+			"Metadata": map[string]interface{}{
+				constants.MetadataInstanceGroup: group.Name,
+			},
+		})
 	}
-	template.SetResource("AutoScalingGroup", resource)
 
 	return true
 }
@@ -295,7 +379,7 @@ func (recv *stackCreator) ensureDNSResources(template *cfn.Template) bool {
 func (recv *stackCreator) ensureInetToELBSG(template *cfn.Template) bool {
 
 	vpc := recv.region.VpcId != ""
-	https := recv.region.SSLCertARN != ""
+	https := recv.region.HasHTTPS()
 	resource := cfn_template.InetToELB(vpc, https)
 
 	template.SetResource(constants.ElbSgLogicalName, resource)
@@ -312,7 +396,7 @@ func (recv *stackCreator) ensureProvisionedELBToInstanceSG(template *cfn.Templat
 	}
 
 	vpc := recv.region.VpcId != ""
-	https := recv.region.SSLCertARN != ""
+	https := recv.region.HasHTTPS()
 	resource := cfn_template.ELBToInstance(vpc, https, elbLogicalId,
 		constants.ElbSgLogicalName)
 
@@ -362,6 +446,10 @@ func (recv *stackCreator) ensureDestinationELBSecurityGroup(template *cfn.Templa
 			return
 		}
 
+		if recv.destinationELBDNSName == "" && elbDescription.DNSName != nil {
+			recv.destinationELBDNSName = *elbDescription.DNSName
+		}
+
 		if elbDescription.SourceSecurityGroup == nil {
 			log.Error("elbDescription.SourceSecurityGroup == nil")
 			return
@@ -419,3 +507,156 @@ func (recv *stackCreator) ensureDestinationELBSecurityGroup(template *cfn.Templa
 	success = true
 	return
 }
+
+// ensureRouteALB creates an application load balancer with a listener rule and
+// target group for every container route. Targets are the instances' HAProxy
+// which applies the same rules to pick a container port
+func (recv *stackCreator) ensureRouteALB(template *cfn.Template) bool {
+	if !recv.region.HasRoutes() {
+		return true
+	}
+
+	subnets := make([]string, 0)
+	for _, az := range recv.region.AZs {
+		subnets = append(subnets, az.SubnetID)
+	}
+
+	template.SetResource(constants.RouteALBLogicalName, map[string]interface{}{
+		"Type": cfn.ElasticLoadBalancingV2_LoadBalancer,
+		"Properties": map[string]interface{}{
+			"Scheme":  "internet-facing",
+			"Subnets": subnets,
+			"SecurityGroups": []interface{}{
+				map[string]interface{}{"Ref": constants.ElbSgLogicalName},
+			},
+		},
+	})
+
+	defaultTargetGroup := constants.RouteALBLogicalName + "DefaultTargetGroup"
+	template.SetResource(defaultTargetGroup,
+		recv.routeTargetGroup(recv.region.HealthCheckPath()))
+
+	// routes are only ruled on the listeners that forward
+	var listeners []string
+
+	httpListener := constants.RouteALBLogicalName + "HTTPListener"
+	if !recv.redirectHTTP() {
+		listeners = append(listeners, httpListener)
+	}
+
+	template.SetResource(httpListener, map[string]interface{}{
+		"Type": cfn.ElasticLoadBalancingV2_Listener,
+		"Properties": map[string]interface{}{
+			"LoadBalancerArn": map[string]interface{}{"Ref": constants.RouteALBLogicalName},
+			"Port":            80,
+			"Protocol":        "HTTP",
+			"DefaultActions":  recv.httpListenerActions(defaultTargetGroup),
+		},
+	})
+
+	if recv.region.HasHTTPS() {
+		httpsListener := constants.RouteALBLogicalName + "HTTPSListener"
+		listeners = append(listeners, httpsListener)
+
+		properties := map[string]interface{}{
+			"LoadBalancerArn": map[string]interface{}{"Ref": constants.RouteALBLogicalName},
+			"Port":            443,
+			"Protocol":        "HTTPS",
+			"Certificates": []interface{}{
+				map[string]interface{}{"CertificateArn": recv.sslCertificateARN()},
+			},
+			"DefaultActions": routeForwardActions(defaultTargetGroup),
+		}
+		recv.setSslPolicy(properties)
+
+		template.SetResource(httpsListener, map[string]interface{}{
+			"Type":       cfn.ElasticLoadBalancingV2_Listener,
+			"Properties": properties,
+		})
+	}
+
+	// rules are evaluated in the order they're declared in .porter/config
+	priority := 0
+	for _, container := range recv.region.Containers {
+		for _, route := range container.Routes {
+			priority++
+
+			targetGroup := fmt.Sprintf("%sTargetGroup%d", constants.RouteALBLogicalName, priority)
+			template.SetResource(targetGroup, recv.routeTargetGroup(container.HealthCheck.Path))
+
+			conditions := make([]interface{}, 0)
+			if route.PathPattern != "" {
+				conditions = append(conditions, map[string]interface{}{
+					"Field":  "path-pattern",
+					"Values": []string{route.PathPattern},
+				})
+			}
+			if route.HostHeader != "" {
+				conditions = append(conditions, map[string]interface{}{
+					"Field":  "host-header",
+					"Values": []string{route.HostHeader},
+				})
+			}
+
+			for _, listener := range listeners {
+				template.SetResource(fmt.Sprintf("%sRule%d", listener, priority), map[string]interface{}{
+					"Type": cfn.ElasticLoadBalancingV2_ListenerRule,
+					"Properties": map[string]interface{}{
+						"ListenerArn": map[string]interface{}{"Ref": listener},
+						"Priority":    priority,
+						"Conditions":  conditions,
+						"Actions":     routeForwardActions(targetGroup),
+					},
+				})
+			}
+		}
+	}
+
+	return true
+}
+
+func (recv *stackCreator) routeTargetGroup(healthCheckPath string) map[string]interface{} {
+	properties := map[string]interface{}{
+		"VpcId":                      recv.region.VpcId,
+		"Port":                       constants.InetBindPorts[0],
+		"Protocol":                   "HTTP",
+		"HealthCheckPath":            healthCheckPath,
+		"HealthCheckIntervalSeconds": constants.HC_Interval,
+		"HealthCheckTimeoutSeconds":  constants.HC_Timeout,
+		"HealthyThresholdCount":      constants.HC_HealthyThreshold,
+		"UnhealthyThresholdCount":    constants.HC_UnhealthyThreshold,
+	}
+
+	// the default deregistration delay is the same as the classic ELB's
+	if recv.environment.Drain != nil {
+		properties["TargetGroupAttributes"] = []interface{}{
+			map[string]interface{}{
+				"Key":   "deregistration_delay.timeout_seconds",
+				"Value": strconv.Itoa(recv.environment.DeregistrationDelay()),
+			},
+		}
+	}
+
+	return map[string]interface{}{
+		"Type":       cfn.ElasticLoadBalancingV2_TargetGroup,
+		"Properties": properties,
+	}
+}
+
+// routeForwardingListener is the listener the route target groups are
+// attached to by default
+func (recv *stackCreator) routeForwardingListener() string {
+	if recv.redirectHTTP() {
+		return constants.RouteALBLogicalName + "HTTPSListener"
+	}
+	return constants.RouteALBLogicalName + "HTTPListener"
+}
+
+func routeForwardActions(targetGroup string) []interface{} {
+	return []interface{}{
+		map[string]interface{}{
+			"Type":           "forward",
+			"TargetGroupArn": map[string]interface{}{"Ref": targetGroup},
+		},
+	}
+}
@@ -0,0 +1,191 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"fmt"
+
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+)
+
+var predefinedMetricPairs = map[string]string{
+	conf.PredictiveMetric_CPU:        "ASGCPUUtilization",
+	conf.PredictiveMetric_NetworkIn:  "ASGNetworkIn",
+	conf.PredictiveMetric_NetworkOut: "ASGNetworkOut",
+}
+
+var predictiveModes = map[string]string{
+	conf.PredictiveMode_ForecastOnly:     "ForecastOnly",
+	conf.PredictiveMode_ForecastAndScale: "ForecastAndScale",
+}
+
+var maxCapacityBreachBehaviors = map[string]string{
+	conf.MaxCapacityBreach_HonorMax:    "HonorMaxCapacity",
+	conf.MaxCapacityBreach_IncreaseMax: "IncreaseMaxCapacity",
+}
+
+// ensureScaling adds the region's target tracking policies, scheduled actions,
+// and predictive scaling policy to the autoscaling group. Validation already
+// refused scaling with instance groups so there's a single group
+func (recv *stackCreator) ensureScaling(template *cfn.Template) bool {
+	scaling, err := recv.environment.GetScaling(recv.region.Name)
+	if err != nil {
+		recv.log.Error("GetScaling", "Error", err)
+		return false
+	}
+	if scaling == nil {
+		return true
+	}
+
+	autoScalingGroup, err := template.GetResourceName(cfn.AutoScaling_AutoScalingGroup)
+	if err != nil {
+		recv.log.Error("template.GetResourceName", "Error", err)
+		return false
+	}
+
+	if scaling.TargetCPU > 0 {
+		template.SetResource("TargetCPUScalingPolicy",
+			targetTrackingPolicy(autoScalingGroup, scaling.TargetCPU, map[string]interface{}{
+				"PredefinedMetricType": "ASGAverageCPUUtilization",
+			}))
+	}
+
+	if scaling.TargetALBRequestsPerTarget > 0 {
+		// every target group has the same instances so the group scales out
+		// when any route is busy and scales in only when all of them are quiet
+		for i, targetGroup := range recv.routeTargetGroupNames() {
+			policy := targetTrackingPolicy(autoScalingGroup, scaling.TargetALBRequestsPerTarget, map[string]interface{}{
+				"PredefinedMetricType": "ALBRequestCountPerTarget",
+				"ResourceLabel": map[string]interface{}{
+					"Fn::Join": []interface{}{
+						"/",
+						[]interface{}{
+							map[string]interface{}{
+								"Fn::GetAtt": []string{constants.RouteALBLogicalName, "LoadBalancerFullName"},
+							},
+							map[string]interface{}{
+								"Fn::GetAtt": []string{targetGroup, "TargetGroupFullName"},
+							},
+						},
+					},
+				},
+			})
+
+			// the resource label is only valid once the target group is
+			// attached to the load balancer
+			listener := recv.routeForwardingListener()
+			if i == 0 {
+				policy["DependsOn"] = []string{listener}
+			} else {
+				policy["DependsOn"] = []string{fmt.Sprintf("%sRule%d", listener, i)}
+			}
+
+			template.SetResource(fmt.Sprintf("TargetRequestsScalingPolicy%d", i), policy)
+		}
+	}
+
+	for _, action := range scaling.ScheduledActions {
+		props := map[string]interface{}{
+			"AutoScalingGroupName": map[string]interface{}{"Ref": autoScalingGroup},
+			"Recurrence":           action.Recurrence,
+		}
+
+		if action.TimeZone != "" {
+			props["TimeZone"] = action.TimeZone
+		}
+
+		if action.MinSize != nil {
+			props["MinSize"] = *action.MinSize
+		}
+
+		if action.MaxSize != nil {
+			props["MaxSize"] = *action.MaxSize
+		}
+
+		if action.DesiredCapacity != nil {
+			props["DesiredCapacity"] = *action.DesiredCapacity
+		}
+
+		template.SetResource("ScheduledAction"+action.Name, map[string]interface{}{
+			"Type":       cfn.AutoScaling_ScheduledAction,
+			"Properties": props,
+		})
+	}
+
+	if predictive := scaling.Predictive; predictive != nil {
+		config := map[string]interface{}{
+			"MetricSpecifications": []interface{}{
+				map[string]interface{}{
+					"TargetValue": predictive.TargetValue,
+					"PredefinedMetricPairSpecification": map[string]interface{}{
+						"PredefinedMetricType": predefinedMetricPairs[predictive.Metric],
+					},
+				},
+			},
+			"Mode":                      predictiveModes[predictive.Mode],
+			"MaxCapacityBreachBehavior": maxCapacityBreachBehaviors[predictive.MaxCapacityBreachBehavior],
+		}
+
+		if predictive.SchedulingBufferTime > 0 {
+			config["SchedulingBufferTime"] = predictive.SchedulingBufferTime
+		}
+
+		if predictive.MaxCapacityBuffer != nil {
+			config["MaxCapacityBuffer"] = *predictive.MaxCapacityBuffer
+		}
+
+		template.SetResource("PredictiveScalingPolicy", map[string]interface{}{
+			"Type": cfn.AutoScaling_ScalingPolicy,
+			"Properties": map[string]interface{}{
+				"AutoScalingGroupName":           map[string]interface{}{"Ref": autoScalingGroup},
+				"PolicyType":                     "PredictiveScaling",
+				"PredictiveScalingConfiguration": config,
+			},
+		})
+	}
+
+	return true
+}
+
+// targetTrackingPolicy keeps the metric at the target value. The policy creates
+// and owns the CloudWatch alarms that drive it
+func targetTrackingPolicy(autoScalingGroup string, targetValue float64, metric map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"Type": cfn.AutoScaling_ScalingPolicy,
+		"Properties": map[string]interface{}{
+			"AutoScalingGroupName": map[string]interface{}{"Ref": autoScalingGroup},
+			"PolicyType":           "TargetTrackingScaling",
+			"TargetTrackingConfiguration": map[string]interface{}{
+				"TargetValue":                   targetValue,
+				"PredefinedMetricSpecification": metric,
+			},
+		},
+	}
+}
+
+// routeTargetGroupNames are the logical names ensureRouteALB gives the default
+// target group and each route's, in order
+func (recv *stackCreator) routeTargetGroupNames() []string {
+	names := []string{constants.RouteALBLogicalName + "DefaultTargetGroup"}
+
+	priority := 0
+	for _, container := range recv.region.Containers {
+		for range container.Routes {
+			priority++
+			names = append(names, fmt.Sprintf("%sTargetGroup%d", constants.RouteALBLogicalName, priority))
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,110 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+)
+
+const (
+	wafWebACLLogicalName            = "WAFWebACL"
+	wafWebACLAssociationLogicalName = "WAFWebACLAssociation"
+)
+
+// ensureWAF associates the region's web ACL with the provisioned ALB. The
+// ECS load balancer isn't provisioned with the stack so
+// ensureECSLoadBalancerStack associates it
+func (recv *stackCreator) ensureWAF(template *cfn.Template) bool {
+	if recv.environment.Compute == conf.Compute_ECS {
+		return true
+	}
+
+	return recv.associateWAF(template, constants.RouteALBLogicalName)
+}
+
+// associateWAF associates the region's web ACL with the template's alb.
+// Without a web_acl_arn the template gets a baseline web ACL that allows what
+// none of the managed rule groups block
+func (recv *stackCreator) associateWAF(template *cfn.Template, alb string) bool {
+	waf, err := recv.environment.GetWAF(recv.region.Name)
+	if err != nil {
+		recv.log.Error("GetWAF", "Error", err)
+		return false
+	}
+	if waf == nil {
+		return true
+	}
+
+	if !template.ResourceExists(cfn.ElasticLoadBalancingV2_LoadBalancer) {
+		recv.log.Error("waf requires an ALB but the template has none")
+		return false
+	}
+
+	var webACL interface{} = waf.WebACLARN
+	if waf.WebACLARN == "" {
+		rules := make([]interface{}, 0)
+		for i, group := range waf.ManagedRuleGroups {
+			rules = append(rules, map[string]interface{}{
+				"Name":     group,
+				"Priority": i,
+				"OverrideAction": map[string]interface{}{
+					"None": map[string]interface{}{},
+				},
+				"Statement": map[string]interface{}{
+					"ManagedRuleGroupStatement": map[string]interface{}{
+						"VendorName": "AWS",
+						"Name":       group,
+					},
+				},
+				"VisibilityConfig": wafVisibilityConfig(group),
+			})
+		}
+
+		template.SetResource(wafWebACLLogicalName, map[string]interface{}{
+			"Type": cfn.WAFv2_WebACL,
+			"Properties": map[string]interface{}{
+				"Scope": "REGIONAL",
+				"DefaultAction": map[string]interface{}{
+					"Allow": map[string]interface{}{},
+				},
+				"Rules":            rules,
+				"VisibilityConfig": wafVisibilityConfig(recv.config.ServiceName),
+			},
+		})
+
+		webACL = map[string]interface{}{
+			"Fn::GetAtt": []string{wafWebACLLogicalName, "Arn"},
+		}
+	}
+
+	template.SetResource(wafWebACLAssociationLogicalName, map[string]interface{}{
+		"Type": cfn.WAFv2_WebACLAssociation,
+		"Properties": map[string]interface{}{
+			"ResourceArn": map[string]interface{}{"Ref": alb},
+			"WebACLArn":   webACL,
+		},
+	})
+
+	return true
+}
+
+// wafVisibilityConfig publishes metrics and samples requests so blocked
+// requests can be investigated
+func wafVisibilityConfig(metricName string) map[string]interface{} {
+	return map[string]interface{}{
+		"CloudWatchMetricsEnabled": true,
+		"SampledRequestsEnabled":   true,
+		"MetricName":               metricName,
+	}
+}
@@ -0,0 +1,213 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/adobe-platform/porter/constants"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const guardBinary = "cfn-guard"
+
+var (
+	// cfn-guard's summary lists each rule as "<rule> PASS|FAIL|SKIP"
+	guardFailedRuleRegex = regexp.MustCompile(`^\s*([A-Za-z0-9_-]+)\s+FAIL\s*$`)
+
+	// rule sets are downloaded once per process even though every region
+	// checks its template
+	guardRulesLock  sync.Mutex
+	guardRulesPaths = make(map[string]string)
+)
+
+// GuardRuleFailures are the rules cfn-guard's output says failed
+func GuardRuleFailures(output string) []string {
+	rules := make([]string, 0)
+
+	for _, line := range strings.Split(output, "\n") {
+		if matches := guardFailedRuleRegex.FindStringSubmatch(line); matches != nil {
+			rules = append(rules, matches[1])
+		}
+	}
+
+	return rules
+}
+
+// checkGuardRules runs cfn-guard with the environment's guard_rules against
+// the template so policy a CloudFormation Guard hook would enforce fails now
+// instead of as a failed hook in the middle of stack creation
+func (recv *stackCreator) checkGuardRules(templateBytes []byte) (success bool) {
+
+	rules := recv.environment.TemplateRules
+	if rules == nil || len(rules.GuardRules) == 0 {
+		success = true
+		return
+	}
+
+	if _, err := exec.LookPath(guardBinary); err != nil {
+		recv.log.Error(guardBinary+" isn't installed. It's needed to check template_rules guard_rules",
+			"Install", "https://github.com/aws-cloudformation/cloudformation-guard")
+		return
+	}
+
+	dataFile, err := ioutil.TempFile(constants.TempDir, "guard-data-")
+	if err != nil {
+		recv.log.Error("ioutil.TempFile", "Error", err)
+		return
+	}
+	defer os.Remove(dataFile.Name())
+
+	_, err = dataFile.Write(templateBytes)
+	dataFile.Close()
+	if err != nil {
+		recv.log.Error("Write template", "Error", err)
+		return
+	}
+
+	failed := false
+	for _, source := range rules.GuardRules {
+
+		log := recv.log.New("GuardRules", source)
+
+		rulesPath, fetchSuccess := recv.fetchGuardRules(source)
+		if !fetchSuccess {
+			return
+		}
+
+		output, err := exec.Command(guardBinary, "validate",
+			"--rules", rulesPath,
+			"--data", dataFile.Name(),
+			"--show-summary", "fail").CombinedOutput()
+		if err == nil {
+			continue
+		}
+
+		if _, ok := err.(*exec.ExitError); !ok {
+			log.Error(guardBinary, "Error", err)
+			return
+		}
+
+		failed = true
+
+		violated := GuardRuleFailures(string(output))
+		log.Error("Template violates guard rules",
+			"Rules", strings.Join(violated, ", "),
+			"Path", constants.CloudFormationTemplatePath)
+		fmt.Fprintf(os.Stderr, "----- BEGIN %s output %s -----\n", guardBinary, source)
+		fmt.Fprintln(os.Stderr, strings.TrimRight(string(output), "\n"))
+		fmt.Fprintf(os.Stderr, "----- END %s output %s -----\n", guardBinary, source)
+	}
+
+	if failed {
+		recv.log.Error("Fix the stack definition or template_rules of the environment",
+			"Environment", recv.environment.Name)
+		return
+	}
+
+	success = true
+	return
+}
+
+// fetchGuardRules returns a local path to the rule set. s3:// and https://
+// rule sets are downloaded into GuardRulesDir
+func (recv *stackCreator) fetchGuardRules(source string) (rulesPath string, success bool) {
+
+	switch {
+	case strings.HasPrefix(source, "s3://"), strings.HasPrefix(source, "https://"):
+	default:
+		rulesPath = source
+		success = true
+		return
+	}
+
+	guardRulesLock.Lock()
+	defer guardRulesLock.Unlock()
+
+	if cached, exists := guardRulesPaths[source]; exists {
+		rulesPath = cached
+		success = true
+		return
+	}
+
+	log := recv.log.New("GuardRules", source)
+
+	err := os.MkdirAll(constants.GuardRulesDir, 0755)
+	if err != nil {
+		log.Error("os.MkdirAll", "Error", err)
+		return
+	}
+
+	sourceHash := sha256.Sum256([]byte(source))
+	rulesPath = filepath.Join(constants.GuardRulesDir, hex.EncodeToString(sourceHash[:])+".guard")
+
+	var body io.ReadCloser
+
+	if strings.HasPrefix(source, "s3://") {
+		bucketKey := strings.SplitN(strings.TrimPrefix(source, "s3://"), "/", 2)
+
+		log.Info("Downloading guard rules")
+		getObjectOutput, err := s3.New(recv.roleSession).GetObject(&s3.GetObjectInput{
+			Bucket: aws.String(bucketKey[0]),
+			Key:    aws.String(bucketKey[1]),
+		})
+		if err != nil {
+			log.Error("GetObject", "Error", err)
+			return
+		}
+		body = getObjectOutput.Body
+	} else {
+
+		log.Info("Downloading guard rules")
+		response, err := http.Get(source)
+		if err != nil {
+			log.Error("http.Get", "Error", err)
+			return
+		}
+
+		if response.StatusCode != http.StatusOK {
+			response.Body.Close()
+			log.Error("Unexpected response downloading guard rules", "StatusCode", response.StatusCode)
+			return
+		}
+		body = response.Body
+	}
+	defer body.Close()
+
+	rulesBytes, err := ioutil.ReadAll(body)
+	if err != nil {
+		log.Error("ioutil.ReadAll", "Error", err)
+		return
+	}
+
+	err = ioutil.WriteFile(rulesPath, rulesBytes, 0644)
+	if err != nil {
+		log.Error("ioutil.WriteFile", "Error", err)
+		return
+	}
+
+	guardRulesPaths[source] = rulesPath
+	success = true
+	return
+}
@@ -0,0 +1,65 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"fmt"
+
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+)
+
+// instanceGroupName is the instance group a launch configuration or
+// autoscaling group was created for. It's empty when the environment doesn't
+// define instance_groups
+func instanceGroupName(resource map[string]interface{}) string {
+	if metadata, ok := resource["Metadata"].(map[string]interface{}); ok {
+		if name, ok := metadata[constants.MetadataInstanceGroup].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// instanceGroup is the config of the resource's instance group or nil
+func (recv *stackCreator) instanceGroup(resource map[string]interface{}) (*conf.InstanceGroup, error) {
+	name := instanceGroupName(resource)
+	if name == "" {
+		return nil, nil
+	}
+
+	return recv.environment.GetInstanceGroup(name)
+}
+
+// instanceGroupRegion is the region with only the containers that run on the
+// instances the resource creates
+func (recv *stackCreator) instanceGroupRegion(resource map[string]interface{}) *conf.Region {
+	return recv.region.ForInstanceGroup(instanceGroupName(resource))
+}
+
+// launchConfigurationName is the logical name of the launch configuration in
+// the same instance group as the resource
+func launchConfigurationName(template *cfn.Template, resource map[string]interface{}) (string, error) {
+	name := instanceGroupName(resource)
+	if name == "" {
+		return template.GetResourceName(cfn.AutoScaling_LaunchConfiguration)
+	}
+
+	for logicalName, lcRaw := range template.GetResourcesByType(cfn.AutoScaling_LaunchConfiguration) {
+		if lc, ok := lcRaw.(map[string]interface{}); ok && instanceGroupName(lc) == name {
+			return logicalName, nil
+		}
+	}
+
+	return "", fmt.Errorf("No %s for instance group %s", cfn.AutoScaling_LaunchConfiguration, name)
+}
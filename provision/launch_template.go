@@ -0,0 +1,270 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/constants"
+)
+
+// replaceLaunchConfiguration converts the fully mapped
+// AWS::AutoScaling::LaunchConfiguration into an AWS::EC2::LaunchTemplate.
+//
+// The logical id doesn't change because UserData, cfn-init, and cfn-hup all
+// refer to the metadata on it
+func (recv *stackCreator) replaceLaunchConfiguration(template *cfn.Template) (success bool) {
+
+	logicalNames, exists := template.GetResourceNames(cfn.AutoScaling_LaunchConfiguration)
+	if !exists {
+		success = true
+		return
+	}
+
+	if len(logicalNames) != 1 && len(recv.environment.InstanceGroups) == 0 {
+		recv.log.Error("More than one resource of type " + cfn.AutoScaling_LaunchConfiguration)
+		return
+	}
+
+	// RemoveResource modifies the slice we're given
+	logicalNames = append([]string{}, logicalNames...)
+
+	for _, logicalName := range logicalNames {
+		if !recv.replaceInstanceGroupLaunchConfiguration(template, logicalName) {
+			return
+		}
+	}
+
+	// instance_refresh is the only consumer and it requires a single launch
+	// template
+	if len(logicalNames) == 1 && !recv.setLaunchTemplateOutputs(template, logicalNames[0]) {
+		return
+	}
+
+	success = true
+	return
+}
+
+// replaceInstanceGroupLaunchConfiguration converts one launch configuration
+// and points the autoscaling groups of the same instance group at it
+func (recv *stackCreator) replaceInstanceGroupLaunchConfiguration(template *cfn.Template, logicalName string) (success bool) {
+
+	launchConfiguration, ok := template.Resources[logicalName].(map[string]interface{})
+	if !ok {
+		recv.log.Error("Invalid " + cfn.AutoScaling_LaunchConfiguration)
+		return
+	}
+
+	lcProps, ok := launchConfiguration["Properties"].(map[string]interface{})
+	if !ok {
+		lcProps = make(map[string]interface{})
+	}
+
+	launchTemplateData := make(map[string]interface{})
+
+	for key, value := range lcProps {
+		switch key {
+		case "ImageId", "InstanceType", "KeyName", "UserData", "EbsOptimized",
+			"BlockDeviceMappings", "MetadataOptions":
+			launchTemplateData[key] = value
+
+		case "IamInstanceProfile":
+			launchTemplateData[key] = map[string]interface{}{
+				"Name": value,
+			}
+
+		case "InstanceMonitoring":
+			launchTemplateData["Monitoring"] = map[string]interface{}{
+				"Enabled": value,
+			}
+
+		case "PlacementTenancy":
+			launchTemplateData["Placement"] = map[string]interface{}{
+				"Tenancy": value,
+			}
+
+		case "SpotPrice":
+			launchTemplateData["InstanceMarketOptions"] = map[string]interface{}{
+				"MarketType": "spot",
+				"SpotOptions": map[string]interface{}{
+					"MaxPrice": value,
+				},
+			}
+
+		case "SecurityGroups", "AssociatePublicIpAddress":
+			// handled below
+
+		default:
+			recv.log.Warn("Dropping launch configuration property with no launch template equivalent", "Property", key)
+		}
+	}
+
+	if securityGroups, exists := lcProps["SecurityGroups"]; exists {
+
+		if associatePublicIpAddress, exists := lcProps["AssociatePublicIpAddress"]; exists {
+
+			// security groups move to the network interface when it's defined
+			launchTemplateData["NetworkInterfaces"] = []interface{}{
+				map[string]interface{}{
+					"DeviceIndex":              0,
+					"AssociatePublicIpAddress": associatePublicIpAddress,
+					"Groups":                   securityGroups,
+				},
+			}
+		} else if recv.region.VpcId != "" {
+			launchTemplateData["SecurityGroupIds"] = securityGroups
+		} else {
+			launchTemplateData["SecurityGroups"] = securityGroups
+		}
+	}
+
+	if options := recv.environment.MetadataOptions; options != nil {
+		launchTemplateData["MetadataOptions"] = map[string]interface{}{
+			"HttpEndpoint":            "enabled",
+			"HttpTokens":              options.HttpTokens,
+			"HttpPutResponseHopLimit": options.HttpPutResponseHopLimit,
+		}
+	}
+
+	if recv.environment.Storage != nil {
+		launchTemplateData["BlockDeviceMappings"] = recv.blockDeviceMappings()
+	}
+
+	if recv.environment.MixedInstances != nil {
+		// the mixed instances policy decides which instances are spot
+		delete(launchTemplateData, "InstanceMarketOptions")
+	}
+
+	launchTemplate := map[string]interface{}{
+		"Type": cfn.EC2_LaunchTemplate,
+		"Properties": map[string]interface{}{
+			"LaunchTemplateData": launchTemplateData,
+		},
+	}
+
+	for _, key := range []string{"Metadata", "DependsOn", "Condition"} {
+		if value, exists := launchConfiguration[key]; exists {
+			launchTemplate[key] = value
+		}
+	}
+
+	template.RemoveResource(logicalName)
+	template.SetResource(logicalName, launchTemplate)
+
+	for _, asgRaw := range template.GetResourcesByType(cfn.AutoScaling_AutoScalingGroup) {
+
+		asg, ok := asgRaw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if instanceGroupName(asg) != instanceGroupName(launchConfiguration) {
+			continue
+		}
+
+		asgProps, ok := asg["Properties"].(map[string]interface{})
+		if !ok {
+			asgProps = make(map[string]interface{})
+			asg["Properties"] = asgProps
+		}
+
+		delete(asgProps, "LaunchConfigurationName")
+		recv.setLaunchTemplate(asgProps, logicalName)
+	}
+
+	success = true
+	return
+}
+
+// templateOutputs is the template's outputs porter can add to. The stack
+// definition may already have some. Set them back on the template after
+// adding to them
+func (recv *stackCreator) templateOutputs(template *cfn.Template) (outputs map[string]interface{}, success bool) {
+
+	switch existing := template.Outputs.(type) {
+	case nil:
+		outputs = make(map[string]interface{})
+	case map[string]interface{}:
+		outputs = existing
+	default:
+		recv.log.Error("Invalid Outputs in the stack definition")
+		return
+	}
+
+	success = true
+	return
+}
+
+func (recv *stackCreator) setLaunchTemplateOutputs(template *cfn.Template, launchTemplateLogicalName string) bool {
+
+	outputs, success := recv.templateOutputs(template)
+	if !success {
+		return false
+	}
+
+	outputs[constants.OutputLaunchTemplateId] = map[string]interface{}{
+		"Value": map[string]interface{}{
+			"Ref": launchTemplateLogicalName,
+		},
+	}
+	outputs[constants.OutputLaunchTemplateVersion] = map[string]interface{}{
+		"Value": map[string]interface{}{
+			"Fn::GetAtt": []string{launchTemplateLogicalName, "LatestVersionNumber"},
+		},
+	}
+
+	template.Outputs = outputs
+	return true
+}
+
+func (recv *stackCreator) setLaunchTemplate(asgProps map[string]interface{}, launchTemplateLogicalName string) {
+
+	launchTemplateSpecification := map[string]interface{}{
+		"LaunchTemplateId": map[string]interface{}{
+			"Ref": launchTemplateLogicalName,
+		},
+		"Version": map[string]interface{}{
+			"Fn::GetAtt": []string{launchTemplateLogicalName, "LatestVersionNumber"},
+		},
+	}
+
+	mixed := recv.environment.MixedInstances
+	if mixed == nil {
+		asgProps["LaunchTemplate"] = launchTemplateSpecification
+		return
+	}
+
+	overrides := make([]interface{}, 0)
+	for _, instanceType := range mixed.InstanceTypes {
+		overrides = append(overrides, map[string]interface{}{
+			"InstanceType": instanceType,
+		})
+	}
+
+	instancesDistribution := map[string]interface{}{
+		"OnDemandAllocationStrategy":          mixed.OnDemandAllocationStrategy,
+		"OnDemandBaseCapacity":                mixed.OnDemandBaseCapacity,
+		"OnDemandPercentageAboveBaseCapacity": *mixed.OnDemandPercentageAboveBaseCapacity,
+		"SpotAllocationStrategy":              mixed.SpotAllocationStrategy,
+	}
+
+	if mixed.SpotMaxPrice != "" {
+		instancesDistribution["SpotMaxPrice"] = mixed.SpotMaxPrice
+	}
+
+	asgProps["MixedInstancesPolicy"] = map[string]interface{}{
+		"LaunchTemplate": map[string]interface{}{
+			"LaunchTemplateSpecification": launchTemplateSpecification,
+			"Overrides":                   overrides,
+		},
+		"InstancesDistribution": instancesDistribution,
+	}
+}
@@ -21,12 +21,19 @@ import (
 
 	"github.com/adobe-platform/porter/cfn"
 	"github.com/adobe-platform/porter/cfn_template"
+	"github.com/adobe-platform/porter/command_queue"
 	"github.com/adobe-platform/porter/conf"
 	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/fleet_config"
 	"github.com/adobe-platform/porter/hook"
+	"github.com/adobe-platform/porter/instance_dns"
 	"github.com/adobe-platform/porter/provision_state"
+	"github.com/adobe-platform/porter/secrets"
 )
 
+// lets the SSM agent register the instance with Session Manager
+const ssmManagedInstanceCorePolicyArn = "arn:aws:iam::aws:policy/AmazonSSMManagedInstanceCore"
+
 // MapResource is a function that operates on the input resource
 type MapResource func(*stackCreator, *cfn.Template, map[string]interface{}) bool
 
@@ -34,10 +41,17 @@ func (recv *stackCreator) mapResources(template *cfn.Template) (success bool) {
 
 	ops := make(map[string][]MapResource)
 
-	switch recv.region.PrimaryTopology() {
-	case conf.Topology_Inet:
+	switch {
+	case recv.environment.Compute == conf.Compute_ECS:
+		ops[cfn.EC2_SecurityGroup] = []MapResource{
+			setVpcId,
+		}
+
+	case recv.region.PrimaryTopology() == conf.Topology_Inet:
 		ops[cfn.AutoScaling_LaunchConfiguration] = []MapResource{
 			addASGSecurityGroups,
+			addServiceSecurityGroup,
+			addFileSystemSecurityGroup,
 			setInstanceType,
 			setKeyName,
 			setIamInstanceProfile,
@@ -45,13 +59,15 @@ func (recv *stackCreator) mapResources(template *cfn.Template) (success bool) {
 			setAutoScalingLaunchConfigurationMetadata,
 			setUserData,
 			overwriteASGSecurityGroupEgress,
+			setSecurityEgress,
 		}
 		ops[cfn.AutoScaling_AutoScalingGroup] = []MapResource{
 			addAutoScaleGroupTags,
 			setPoolSize,
 			setAutoScalingGroupMultiAZ,
-			setLaunchConfigurationName,
+			setUpdatePolicy,
 			setLoadBalancerNames,
+			setTargetGroupARNs,
 		}
 		ops[cfn.ElasticLoadBalancing_LoadBalancer] = []MapResource{
 			addELBSecurityGroups,
@@ -78,21 +94,25 @@ func (recv *stackCreator) mapResources(template *cfn.Template) (success bool) {
 			addInlinePolicies,
 		}
 
-	case conf.Topology_Worker, conf.Topology_Cron:
+	case recv.region.PrimaryTopology() == conf.Topology_Worker,
+		recv.region.PrimaryTopology() == conf.Topology_Cron:
 		ops[cfn.AutoScaling_LaunchConfiguration] = []MapResource{
 			addASGSecurityGroups,
+			addServiceSecurityGroup,
+			addFileSystemSecurityGroup,
 			setInstanceType,
 			setKeyName,
 			setIamInstanceProfile,
 			setImageId,
 			setAutoScalingLaunchConfigurationMetadata,
 			setUserData,
+			setSecurityEgress,
 		}
 		ops[cfn.AutoScaling_AutoScalingGroup] = []MapResource{
 			addAutoScaleGroupTags,
 			setPoolSize,
 			setAutoScalingGroupMultiAZ,
-			setLaunchConfigurationName,
+			setUpdatePolicy,
 		}
 		ops[cfn.EC2_SecurityGroup] = []MapResource{
 			setVpcId,
@@ -115,6 +135,12 @@ func (recv *stackCreator) mapResources(template *cfn.Template) (success bool) {
 		ops[key] = append(ops[key], value...)
 	}
 
+	for resourceType, fns := range RegisteredTransforms() {
+		for _, fn := range fns {
+			ops[resourceType] = append(ops[resourceType], wrapTransform(fn))
+		}
+	}
+
 	for _, resourceRaw := range template.Resources {
 
 		if resource, ok := resourceRaw.(map[string]interface{}); ok {
@@ -204,7 +230,57 @@ func addTaggedSecurityGroups(recv *stackCreator, template *cfn.Template, resourc
 	return true
 }
 
+// addServiceSecurityGroup makes the instances members of the service's
+// security group that other services' security rules refer to
+func addServiceSecurityGroup(recv *stackCreator, template *cfn.Template, resource map[string]interface{}) bool {
+	if recv.region.Security == nil {
+		return true
+	}
+
+	props, ok := resource["Properties"].(map[string]interface{})
+	if !ok {
+		recv.log.Error("Missing Properties on resource")
+		return false
+	}
+
+	securityGroups, ok := props["SecurityGroups"].([]interface{})
+	if !ok {
+		securityGroups = make([]interface{}, 0)
+	}
+
+	props["SecurityGroups"] = append(securityGroups, map[string]interface{}{
+		"Fn::ImportValue": conf.SecurityGroupStackName(recv.config.ServiceName, recv.environment.Name),
+	})
+	return true
+}
+
 func overwriteASGSecurityGroupEgress(recv *stackCreator, template *cfn.Template, resource map[string]interface{}) bool {
+	if recv.region.AutoScalingGroup == nil {
+		return true
+	}
+
+	securityGroupEgress := make([]interface{}, 0)
+	for _, configEgress := range recv.region.AutoScalingGroup.SecurityGroupEgress {
+
+		securityGroupEgress = append(securityGroupEgress, configEgress)
+	}
+
+	return overwriteSecurityGroupEgress(recv, template, resource, securityGroupEgress)
+}
+
+// setSecurityEgress sets the egress rules of the security block on every
+// security group of the instances. Egress is the union of every group's so
+// one group's default allow all would allow everything
+func setSecurityEgress(recv *stackCreator, template *cfn.Template, resource map[string]interface{}) bool {
+	if recv.region.Security == nil || len(recv.region.Security.Egress) == 0 {
+		return true
+	}
+
+	return overwriteSecurityGroupEgress(recv, template, resource, recv.securityEgress())
+}
+
+func overwriteSecurityGroupEgress(recv *stackCreator, template *cfn.Template, resource map[string]interface{},
+	securityGroupEgress []interface{}) bool {
 	var (
 		props map[string]interface{}
 		ok    bool
@@ -212,10 +288,6 @@ func overwriteASGSecurityGroupEgress(recv *stackCreator, template *cfn.Template,
 		securityGroups []interface{}
 	)
 
-	if recv.region.AutoScalingGroup == nil {
-		return true
-	}
-
 	if props, ok = resource["Properties"].(map[string]interface{}); !ok {
 		recv.log.Error("Missing Properties on resource")
 		return false
@@ -237,14 +309,6 @@ func overwriteASGSecurityGroupEgress(recv *stackCreator, template *cfn.Template,
 			return false
 		}
 
-		delete(props, "SecurityGroupEgress")
-		securityGroupEgress := make([]interface{}, 0)
-
-		for _, configEgress := range recv.region.AutoScalingGroup.SecurityGroupEgress {
-
-			securityGroupEgress = append(securityGroupEgress, configEgress)
-		}
-
 		props["SecurityGroupEgress"] = securityGroupEgress
 		return true
 	}
@@ -255,6 +319,12 @@ func overwriteASGSecurityGroupEgress(recv *stackCreator, template *cfn.Template,
 
 		if securityGroupMsi, ok := securityGroupRaw.(map[string]interface{}); ok {
 
+			if _, ok := securityGroupMsi["Fn::ImportValue"]; ok {
+
+				// the service's security group allows no egress
+				continue
+			}
+
 			if ref, ok := securityGroupMsi["Ref"].(string); ok {
 
 				if sgRef, exists := logicalNameToSecurityGroup[ref].(map[string]interface{}); exists {
@@ -347,66 +417,82 @@ func setAutoScalingGroupMultiAZ(recv *stackCreator, template *cfn.Template, reso
 	return true
 }
 
-func setLaunchConfigurationName(recv *stackCreator, template *cfn.Template, resource map[string]interface{}) (success bool) {
+func setLoadBalancerNames(recv *stackCreator, template *cfn.Template, resource map[string]interface{}) (success bool) {
 	var (
 		props map[string]interface{}
 		ok    bool
+
+		loadBalancerNames []interface{}
 	)
 
+	// only the instance group running inet containers receives traffic
+	if recv.instanceGroupRegion(resource).PrimaryTopology() != conf.Topology_Inet ||
+		recv.region.DNSToInstances() {
+		success = true
+		return
+	}
+
 	if props, ok = resource["Properties"].(map[string]interface{}); !ok {
 		props = make(map[string]interface{})
 		resource["Properties"] = props
 	}
 
-	if _, exists := props["LaunchConfigurationName"]; !exists {
+	if loadBalancerNames, ok = props["LoadBalancerNames"].([]interface{}); !ok {
+		loadBalancerNames = make([]interface{}, 0)
+	}
 
-		launchConfigurationName, err := template.GetResourceName(cfn.AutoScaling_LaunchConfiguration)
-		if err != nil {
-			recv.log.Error("template.GetResourceName", "Error", err)
-			return
-		}
+	loadBalancerLogicalName, err := template.GetResourceName(cfn.ElasticLoadBalancing_LoadBalancer)
+	if err != nil {
+		recv.log.Error("template.GetResourceName", "Error", err)
+		return
+	}
 
-		props["LaunchConfigurationName"] = map[string]interface{}{
-			"Ref": launchConfigurationName,
-		}
+	loadBalancerName := map[string]interface{}{
+		"Ref": loadBalancerLogicalName,
 	}
+	loadBalancerNames = append(loadBalancerNames, loadBalancerName)
+
+	props["LoadBalancerNames"] = loadBalancerNames
 
 	success = true
 	return
 }
 
-func setLoadBalancerNames(recv *stackCreator, template *cfn.Template, resource map[string]interface{}) (success bool) {
+func setTargetGroupARNs(recv *stackCreator, template *cfn.Template, resource map[string]interface{}) bool {
 	var (
 		props map[string]interface{}
 		ok    bool
 
-		loadBalancerNames []interface{}
+		targetGroupARNs []interface{}
 	)
 
-	if props, ok = resource["Properties"].(map[string]interface{}); !ok {
-		props = make(map[string]interface{})
-		resource["Properties"] = props
+	targetGroupLogicalNames, exists := template.GetResourceNames(cfn.ElasticLoadBalancingV2_TargetGroup)
+	if !exists {
+		return true
 	}
 
-	if loadBalancerNames, ok = props["LoadBalancerNames"].([]interface{}); !ok {
-		loadBalancerNames = make([]interface{}, 0)
+	if recv.instanceGroupRegion(resource).PrimaryTopology() != conf.Topology_Inet {
+		return true
 	}
 
-	loadBalancerLogicalName, err := template.GetResourceName(cfn.ElasticLoadBalancing_LoadBalancer)
-	if err != nil {
-		recv.log.Error("template.GetResourceName", "Error", err)
-		return
+	if props, ok = resource["Properties"].(map[string]interface{}); !ok {
+		props = make(map[string]interface{})
+		resource["Properties"] = props
 	}
 
-	loadBalancerName := map[string]interface{}{
-		"Ref": loadBalancerLogicalName,
+	if targetGroupARNs, ok = props["TargetGroupARNs"].([]interface{}); !ok {
+		targetGroupARNs = make([]interface{}, 0)
 	}
-	loadBalancerNames = append(loadBalancerNames, loadBalancerName)
 
-	props["LoadBalancerNames"] = loadBalancerNames
+	for _, logicalName := range targetGroupLogicalNames {
+		targetGroupARN := map[string]interface{}{
+			"Ref": logicalName,
+		}
+		targetGroupARNs = append(targetGroupARNs, targetGroupARN)
+	}
 
-	success = true
-	return
+	props["TargetGroupARNs"] = targetGroupARNs
+	return true
 }
 
 func setKeyName(recv *stackCreator, template *cfn.Template, resource map[string]interface{}) bool {
@@ -420,6 +506,11 @@ func setKeyName(recv *stackCreator, template *cfn.Template, resource map[string]
 		resource["Properties"] = props
 	}
 
+	// Session Manager replaces key pairs
+	if recv.environment.Access == conf.Access_SSM {
+		return true
+	}
+
 	if _, exists := props["KeyName"]; !exists && recv.region.KeyPairName != "" {
 		props["KeyName"] = recv.region.KeyPairName
 	}
@@ -437,13 +528,22 @@ func setUserData(recv *stackCreator, template *cfn.Template, resource map[string
 		resource["Properties"] = props
 	}
 
-	autoScalingLaunchConfiguration, err := template.GetResourceName(cfn.AutoScaling_LaunchConfiguration)
+	autoScalingLaunchConfiguration, err := launchConfigurationName(template, resource)
 	if err != nil {
-		recv.log.Error("template.GetResourceName", "Error", err)
+		recv.log.Error("launchConfigurationName", "Error", err)
 		return
 	}
 
-	userData, err := cfn_template.UserData(autoScalingLaunchConfiguration)
+	architecture, err := recv.architecture(resource)
+	if err != nil {
+		recv.log.Error("architecture", "Error", err)
+		return
+	}
+
+	// arm64 instances run Amazon Linux 2
+	latestPackages := architecture == conf.Architecture_ARM64 || recv.environment.AMI != nil
+
+	userData, err := cfn_template.UserData(autoScalingLaunchConfiguration, recv.hardening(), latestPackages)
 	if err != nil {
 		recv.log.Error("cfn_template.UserData", "Error", err)
 		return
@@ -455,11 +555,41 @@ func setUserData(recv *stackCreator, template *cfn.Template, resource map[string
 	return
 }
 
+// hardening is how the environment's instances are locked down while they boot
+func (recv *stackCreator) hardening() (hardening cfn_template.Hardening) {
+	hardening.SSMAgent = recv.environment.Access == conf.Access_SSM
+
+	config := recv.environment.Hardening
+	if config == nil {
+		return
+	}
+
+	hardening.SecurityUpdates = config.SecurityUpdates
+	hardening.DisableSSH = config.SSH != conf.SSH_Enabled
+	hardening.SSMAgent = hardening.SSMAgent || config.SSH == conf.SSH_SSM
+	hardening.Fail2ban = config.Fail2ban
+	hardening.Sysctl = config.Sysctl
+	return
+}
+
 func setAutoScalingLaunchConfigurationMetadata(recv *stackCreator, template *cfn.Template, resource map[string]interface{}) (success bool) {
 
+	// the containers and load balancers of this launch configuration's
+	// instance group
+	region := recv.instanceGroupRegion(resource)
+	instanceGroup := instanceGroupName(resource)
+
+	architecture, err := recv.architecture(resource)
+	if err != nil {
+		recv.log.Error("architecture", "Error", err)
+		return
+	}
+
 	elbNames := make([]string, 0)
-	for _, elb := range recv.region.ELBs {
-		elbNames = append(elbNames, elb.Name)
+	if instanceGroup == "" || region.PrimaryTopology() == conf.Topology_Inet {
+		for _, elb := range region.ELBs {
+			elbNames = append(elbNames, elb.Name)
+		}
 	}
 	elbCSV := strings.Join(elbNames, ",")
 
@@ -500,6 +630,8 @@ loop:
 		Region:        recv.region.Name,
 		EnvFile:       constants.EnvFile,
 
+		ContainerSecretsPath: constants.ContainerSecretsPath,
+
 		ServiceName:    recv.config.ServiceName,
 		ServiceVersion: recv.config.ServiceVersion,
 
@@ -509,16 +641,25 @@ loop:
 
 		ServicePayloadBucket:     recv.region.S3Bucket,
 		ServicePayloadKey:        recv.servicePayloadKey,
+		ServicePayloadUrl:        recv.servicePayloadUrl(),
 		ServicePayloadConfigPath: constants.ServicePayloadConfigPath,
-		ServicePayloadHostPath:   fmt.Sprintf("/porter/%d.tar.gz", time.Now().UnixNano()),
+		ServicePayloadHostPath:   fmt.Sprintf("%s/%d.tar.gz", constants.HostPayloadDir, time.Now().UnixNano()),
 		ServicePayloadChecksum:   recv.servicePayloadChecksum,
 
-		RegistryDeployment: os.Getenv(constants.EnvDockerRegistry) != "",
+		DeploymentManifestKey: recv.deploymentManifestKey(),
+		DeploymentManifestUrl: recv.deploymentManifestUrl(),
+
+		RegistryDeployment: recv.config.RegistryDeployment(),
+
+		InetHealthCheckMethod: strconv.Quote(region.HealthCheckMethod()),
+		InetHealthCheckPath:   strconv.Quote(region.HealthCheckPath()),
+
+		InstanceGroup: instanceGroup,
 
-		InetHealthCheckMethod: strconv.Quote(recv.region.HealthCheckMethod()),
-		InetHealthCheckPath:   strconv.Quote(recv.region.HealthCheckPath()),
+		PorterBinaryUrl: porterBinaryUrl(architecture),
+		ImageFileSuffix: conf.ImageFileSuffix(architecture),
 
-		PorterBinaryUrl: constants.BinaryUrl,
+		DependencyEnv: recv.dependencyEnv(),
 
 		DevMode:  os.Getenv(constants.EnvDevMode) != "",
 		LogDebug: os.Getenv(constants.EnvLogDebug) != "",
@@ -526,17 +667,54 @@ loop:
 		ContainerUserUid: constants.ContainerUserUid,
 	}
 
+	cfnInitContext.InstanceRefresh = recv.environment.InstanceRefresh != nil
+
+	if recv.environment.Spot != nil {
+		cfnInitContext.SpotDrainTimeout = recv.environment.Spot.DrainTimeout
+	}
+
+	if monitoring, err := recv.environment.GetMonitoring(recv.region.Name); err == nil && monitoring != nil {
+		cfnInitContext.DiskMetrics = true
+	}
+
+	if pressure := recv.environment.Pressure; pressure != nil {
+		cfnInitContext.PressureMemory = pressure.Memory
+		cfnInitContext.PressureCPU = pressure.CPU
+		cfnInitContext.PressureAction = pressure.Action
+		cfnInitContext.PressureCooldown = pressure.Cooldown
+	}
+
+	if diskGC := recv.environment.DiskGC; diskGC != nil {
+		cfnInitContext.DiskGCHigh = diskGC.HighWatermark
+		cfnInitContext.DiskGCLow = diskGC.LowWatermark
+	}
+
+	cfnInitContext.CommandQueue = recv.environment.CommandQueue
+
+	if recv.region.DNSToInstances() {
+		cfnInitContext.DNSName = recv.region.DNS.Name
+		cfnInitContext.HostedZoneName = recv.region.HostedZoneName
+	}
+
+	cfnInitContext.Hardening = recv.hardening()
+	cfnInitContext.Storage = recv.storage()
+
+	if logging := recv.environment.Logging; logging != nil {
+		cfnInitContext.ContainerLogs = logging.ShipsContainers()
+		cfnInitContext.HostLogFiles = logging.HostFiles
+	}
+
 	if os.Getenv(constants.EnvDockerInsecureRegistry) != "" {
 		cfnInitContext.InsecureRegistry = os.Getenv(constants.EnvDockerRegistry)
 	}
 
-	for _, container := range recv.region.Containers {
+	for _, container := range region.Containers {
 		cfnInitContext.ImageNames = append(cfnInitContext.ImageNames, container.Name)
 	}
 
-	autoScalingLaunchConfiguration, err := template.GetResourceName(cfn.AutoScaling_LaunchConfiguration)
+	autoScalingLaunchConfiguration, err := launchConfigurationName(template, resource)
 	if err != nil {
-		recv.log.Error("template.GetResourceName", "Error", err)
+		recv.log.Error("launchConfigurationName", "Error", err)
 		return
 	}
 
@@ -600,7 +778,23 @@ func setImageId(recv *stackCreator, template *cfn.Template, resource map[string]
 
 	if _, exists := props["ImageId"]; !exists {
 
-		props["ImageId"] = cfn_template.ImageIdInMap(constants.MappingRegionToAMI)
+		// resolved from the ami block
+		if recv.imageId != "" {
+			props["ImageId"] = recv.imageId
+			return true
+		}
+
+		architecture, err := recv.architecture(resource)
+		if err != nil {
+			recv.log.Error("architecture", "Error", err)
+			return false
+		}
+
+		if architecture == conf.Architecture_ARM64 {
+			props["ImageId"] = map[string]interface{}{"Ref": constants.ParameterImageIdArm64}
+		} else {
+			props["ImageId"] = cfn_template.ImageIdInMap(constants.MappingRegionToAMI)
+		}
 	}
 	return true
 }
@@ -616,12 +810,29 @@ func setPoolSize(recv *stackCreator, template *cfn.Template, resource map[string
 		resource["Properties"] = props
 	}
 
+	instanceCount := recv.environment.InstanceCount
+
+	group, err := recv.instanceGroup(resource)
+	if err != nil {
+		recv.log.Error("instanceGroup", "Error", err)
+		return false
+	}
+	if group != nil {
+		instanceCount = group.InstanceCount
+	}
+
 	if _, exists := props["MinSize"]; !exists {
-		props["MinSize"] = recv.environment.InstanceCount
+		props["MinSize"] = instanceCount
 	}
 
 	if _, exists := props["MaxSize"]; !exists {
-		props["MaxSize"] = recv.environment.InstanceCount
+		props["MaxSize"] = instanceCount
+
+		// room for scheduled and predictive scaling to grow into
+		if scaling, err := recv.environment.GetScaling(recv.region.Name); err == nil &&
+			scaling != nil && scaling.MaxSize > instanceCount {
+			props["MaxSize"] = scaling.MaxSize
+		}
 	}
 	return true
 }
@@ -638,7 +849,41 @@ func setCount(recv *stackCreator, template *cfn.Template, resource map[string]in
 	}
 
 	if _, exists := props["Count"]; !exists {
-		props["Count"] = recv.environment.InstanceCount
+		if recv.environment.CreationPolicy != nil {
+			props["Count"] = recv.environment.CreationPolicy.SignalCount
+		} else {
+			props["Count"] = recv.environment.TotalInstanceCount()
+		}
+	}
+	return true
+}
+
+// Instances signal porter's WaitCondition rather than the autoscaling group so
+// a rolling update can't wait on resource signals
+func setUpdatePolicy(recv *stackCreator, template *cfn.Template, resource map[string]interface{}) bool {
+	policy := recv.environment.UpdatePolicy
+	if policy == nil {
+		return true
+	}
+
+	if _, exists := resource["UpdatePolicy"]; exists {
+		return true
+	}
+
+	if policy.ReplacingUpdate {
+		resource["UpdatePolicy"] = map[string]interface{}{
+			"AutoScalingReplacingUpdate": map[string]interface{}{
+				"WillReplace": true,
+			},
+		}
+	} else {
+		resource["UpdatePolicy"] = map[string]interface{}{
+			"AutoScalingRollingUpdate": map[string]interface{}{
+				"MaxBatchSize":          policy.RollingUpdate.MaxBatchSize,
+				"MinInstancesInService": policy.RollingUpdate.MinInstancesInService,
+				"PauseTime":             fmt.Sprintf("PT%dS", policy.RollingUpdate.PauseTime),
+			},
+		}
 	}
 	return true
 }
@@ -647,16 +892,26 @@ func setCount(recv *stackCreator, template *cfn.Template, resource map[string]in
 // it's created and the ASG is the last thing to be created so we want the
 // timeout countdown to start as soon as all the other resources in the stack
 // have been created
+//
+// With instance groups it DependsOn every ASG and counts signals from all of
+// their instances
 func setDependsOnAutoScalingGroup(recv *stackCreator, template *cfn.Template, resource map[string]interface{}) (success bool) {
 	if _, exists := resource["DependsOn"]; !exists {
 
-		autoScalingGroup, err := template.GetResourceName(cfn.AutoScaling_AutoScalingGroup)
-		if err != nil {
-			recv.log.Error("template.GetResourceName", "Error", err)
-			return
-		}
+		if len(recv.environment.InstanceGroups) > 0 {
 
-		resource["DependsOn"] = autoScalingGroup
+			autoScalingGroups, _ := template.GetResourceNames(cfn.AutoScaling_AutoScalingGroup)
+			resource["DependsOn"] = autoScalingGroups
+		} else {
+
+			autoScalingGroup, err := template.GetResourceName(cfn.AutoScaling_AutoScalingGroup)
+			if err != nil {
+				recv.log.Error("template.GetResourceName", "Error", err)
+				return
+			}
+
+			resource["DependsOn"] = autoScalingGroup
+		}
 	}
 
 	success = true
@@ -674,8 +929,14 @@ func setInstanceType(recv *stackCreator, template *cfn.Template, resource map[st
 		resource["Properties"] = props
 	}
 
+	instanceType, err := recv.instanceType(resource)
+	if err != nil {
+		recv.log.Error("instanceType", "Error", err)
+		return false
+	}
+
 	if _, exists := props["InstanceType"]; !exists {
-		props["InstanceType"] = recv.environment.InstanceType
+		props["InstanceType"] = instanceType
 	}
 	return true
 }
@@ -765,11 +1026,11 @@ func addAutoScaleGroupTags(recv *stackCreator, template *cfn.Template, resource
 
 func addHTTPSListener(recv *stackCreator, template *cfn.Template, resource map[string]interface{}) bool {
 
-	if recv.region.SSLCertARN == "" {
+	if !recv.region.HasHTTPS() {
 		return true
 	}
 
-	recv.log.Info("ssl_cert_arn defined. Adding HTTPS listener to AWS::ElasticLoadBalancing::LoadBalancer")
+	recv.log.Info("HTTPS certificate defined. Adding HTTPS listener to AWS::ElasticLoadBalancing::LoadBalancer")
 
 	var (
 		props map[string]interface{}
@@ -802,10 +1063,28 @@ func addHTTPSListener(recv *stackCreator, template *cfn.Template, resource map[s
 		"LoadBalancerPort": "443",
 		"InstancePort":     strconv.Itoa(int(constants.InetBindPorts[1])),
 		"Protocol":         "HTTPS",
-		"SSLCertificateId": recv.region.SSLCertARN,
+		"SSLCertificateId": recv.sslCertificateARN(),
 	}
 	listeners = append(listeners, httpsListener)
 
+	// a classic ELB references a predefined security policy through a policy
+	// of its own
+	if recv.region.TLS != nil {
+		httpsListener["PolicyNames"] = []string{sslNegotiationPolicyName}
+
+		policies, _ := props["Policies"].([]interface{})
+		props["Policies"] = append(policies, map[string]interface{}{
+			"PolicyName": sslNegotiationPolicyName,
+			"PolicyType": "SSLNegotiationPolicyType",
+			"Attributes": []interface{}{
+				map[string]interface{}{
+					"Name":  "Reference-Security-Policy",
+					"Value": recv.region.TLS.SecurityPolicy,
+				},
+			},
+		})
+	}
+
 	props["Listeners"] = listeners
 	return true
 }
@@ -861,7 +1140,11 @@ func setTimeout(recv *stackCreator, template *cfn.Template, resource map[string]
 	}
 
 	if _, exists := props["Timeout"]; !exists {
-		props["Timeout"] = constants.StackCreationTimeout().Seconds()
+		if recv.environment.CreationPolicy != nil && recv.environment.CreationPolicy.Timeout > 0 {
+			props["Timeout"] = recv.environment.CreationPolicy.Timeout
+		} else {
+			props["Timeout"] = constants.StackCreationTimeout().Seconds()
+		}
 	}
 	return true
 }
@@ -897,7 +1180,7 @@ func setConnectionDrainingPolicy(recv *stackCreator, template *cfn.Template, res
 	if _, exists := props["ConnectionDrainingPolicy"]; !exists {
 		props["ConnectionDrainingPolicy"] = map[string]interface{}{
 			"Enabled": true,
-			"Timeout": 300,
+			"Timeout": recv.environment.DeregistrationDelay(),
 		}
 	}
 	return true
@@ -1079,9 +1362,7 @@ func addInlinePolicies(recv *stackCreator, template *cfn.Template, resource map[
 						"ec2:DescribeTags",
 						"elasticloadbalancing:DescribeTags",
 						"elasticloadbalancing:RegisterInstancesWithLoadBalancer",
-
-						// decrypt .env-file
-						"kms:Decrypt",
+						"elasticloadbalancing:DeregisterInstancesFromLoadBalancer",
 					},
 					"Resource": "*",
 				},
@@ -1111,13 +1392,21 @@ func addInlinePolicies(recv *stackCreator, template *cfn.Template, resource map[
 					"Sid":    "4",
 					"Effect": "Allow",
 					"Action": []string{
-						// hotswap signal
+						// hotswap signal and bootstrap progress
 						"sqs:SendMessage",
 					},
-					"Resource": map[string][]string{
-						"Fn::GetAtt": {
-							constants.SignalQueue,
-							"Arn",
+					"Resource": []interface{}{
+						map[string][]string{
+							"Fn::GetAtt": {
+								constants.SignalQueue,
+								"Arn",
+							},
+						},
+						map[string][]string{
+							"Fn::GetAtt": {
+								constants.ProgressQueue,
+								"Arn",
+							},
 						},
 					},
 				},
@@ -1125,8 +1414,207 @@ func addInlinePolicies(recv *stackCreator, template *cfn.Template, resource map[
 		},
 	}
 
+	if recv.config.ECR != nil {
+		policyDocument := porterPolicy["PolicyDocument"].(map[string]interface{})
+		policyDocument["Statement"] = append(policyDocument["Statement"].([]interface{}),
+			map[string]interface{}{
+				"Sid":    "5",
+				"Effect": "Allow",
+				"Action": []string{
+					// pull images from the region's ECR repository
+					"ecr:BatchCheckLayerAvailability",
+					"ecr:BatchGetImage",
+					"ecr:GetAuthorizationToken",
+					"ecr:GetDownloadUrlForLayer",
+				},
+				"Resource": "*",
+			})
+	}
+
+	if recv.environment.CommandQueue {
+		policyDocument := porterPolicy["PolicyDocument"].(map[string]interface{})
+		policyDocument["Statement"] = append(policyDocument["Statement"].([]interface{}),
+			map[string]interface{}{
+				"Sid":    "6",
+				"Effect": "Allow",
+				"Action": []string{
+					// porterd creates its instance's command queue and takes
+					// commands from it
+					"sqs:CreateQueue",
+					"sqs:DeleteMessage",
+					"sqs:GetQueueUrl",
+					"sqs:ReceiveMessage",
+				},
+				"Resource": map[string]string{
+					"Fn::Sub": "arn:aws:sqs:${AWS::Region}:${AWS::AccountId}:" +
+						command_queue.QueueNamePrefix(recv.config.ServiceName, recv.environment.Name) + "*",
+				},
+			})
+	}
+
+	policyDocument := porterPolicy["PolicyDocument"].(map[string]interface{})
+	policyDocument["Statement"] = append(policyDocument["Statement"].([]interface{}),
+		map[string]interface{}{
+			"Sid":    "7",
+			"Effect": "Allow",
+			"Action": []string{
+				// porterd reads porter fleet set-config's values
+				"ssm:GetParameter",
+			},
+			"Resource": map[string]string{
+				"Fn::Sub": "arn:aws:ssm:${AWS::Region}:${AWS::AccountId}:parameter" +
+					fleet_config.ParameterName(recv.config.ServiceName, recv.environment.Name),
+			},
+		})
+
+	if monitoring, err := recv.environment.GetMonitoring(recv.region.Name); (err == nil && monitoring != nil) ||
+		recv.region.DNSToInstances() {
+		policyDocument["Statement"] = append(policyDocument["Statement"].([]interface{}),
+			map[string]interface{}{
+				"Sid":    "8",
+				"Effect": "Allow",
+				"Action": []string{
+					// porterd publishes disk usage and the health instance
+					// records follow
+					"cloudwatch:PutMetricData",
+				},
+				"Resource": "*",
+				"Condition": map[string]interface{}{
+					"StringEquals": map[string]string{
+						"cloudwatch:namespace": constants.HostMetricsNamespace,
+					},
+				},
+			})
+	}
+
+	if logGroups := logGroupNames(template); len(logGroups) > 0 {
+		var logGroupArns []interface{}
+		for _, logGroup := range logGroups {
+			logGroupArns = append(logGroupArns, map[string][]string{
+				"Fn::GetAtt": {logGroup, "Arn"},
+			})
+		}
+
+		policyDocument["Statement"] = append(policyDocument["Statement"].([]interface{}),
+			map[string]interface{}{
+				"Sid":    "9",
+				"Effect": "Allow",
+				"Action": []string{
+					// the docker awslogs driver and the awslogs agent
+					"logs:CreateLogStream",
+					"logs:DescribeLogStreams",
+					"logs:PutLogEvents",
+				},
+				"Resource": logGroupArns,
+			})
+	}
+
+	if hardening := recv.environment.Hardening; hardening != nil && hardening.SSH == conf.SSH_SSM {
+		policyDocument["Statement"] = append(policyDocument["Statement"].([]interface{}),
+			map[string]interface{}{
+				"Sid":    "10",
+				"Effect": "Allow",
+				"Action": []string{
+					// Session Manager replaces ssh
+					"ec2messages:AcknowledgeMessage",
+					"ec2messages:DeleteMessage",
+					"ec2messages:FailMessage",
+					"ec2messages:GetEndpoint",
+					"ec2messages:GetMessages",
+					"ec2messages:SendReply",
+					"ssm:UpdateInstanceInformation",
+					"ssmmessages:CreateControlChannel",
+					"ssmmessages:CreateDataChannel",
+					"ssmmessages:OpenControlChannel",
+					"ssmmessages:OpenDataChannel",
+				},
+				"Resource": "*",
+			})
+	}
+
+	decryptStatement := map[string]interface{}{
+		"Sid":    "11",
+		"Effect": "Allow",
+		"Action": []string{
+			// decrypt .env-file
+			"kms:Decrypt",
+		},
+		"Resource": "*",
+	}
+	if recv.region.SecretsKMSKeyId != "" {
+		// secrets data keys are only decrypted through the grant each deploy
+		// creates for its stack
+		decryptStatement["Condition"] = map[string]interface{}{
+			"Null": map[string]string{
+				"kms:EncryptionContext:" + secrets.EncryptionContextChecksum: "true",
+			},
+		}
+	}
+	policyDocument["Statement"] = append(policyDocument["Statement"].([]interface{}), decryptStatement)
+
+	if recv.region.DNSToInstances() {
+		// porterd registers the instance in DNS while its stack is promoted
+		policyDocument["Statement"] = append(policyDocument["Statement"].([]interface{}),
+			map[string]interface{}{
+				"Sid":    "12",
+				"Effect": "Allow",
+				"Action": []string{
+					"route53:ChangeResourceRecordSets",
+					"route53:ListResourceRecordSets",
+				},
+				"Resource": "arn:aws:route53:::hostedzone/*",
+				"Condition": map[string]interface{}{
+					"ForAllValues:StringEquals": map[string][]string{
+						"route53:ChangeResourceRecordSetsNormalizedRecordNames": {
+							strings.ToLower(strings.TrimRight(recv.region.DNS.Name, ".")),
+						},
+					},
+				},
+			},
+			map[string]interface{}{
+				"Sid":    "13",
+				"Effect": "Allow",
+				"Action": []string{
+					"route53:CreateHealthCheck",
+					"route53:DeleteHealthCheck",
+					"route53:ListHostedZonesByName",
+				},
+				"Resource": "*",
+			},
+			map[string]interface{}{
+				"Sid":    "14",
+				"Effect": "Allow",
+				"Action": []string{
+					// the alarm the record's health check follows
+					"cloudwatch:DeleteAlarms",
+					"cloudwatch:PutMetricAlarm",
+				},
+				"Resource": map[string]string{
+					"Fn::Sub": "arn:aws:cloudwatch:${AWS::Region}:${AWS::AccountId}:alarm:" +
+						instance_dns.AlarmName("*"),
+				},
+			},
+			map[string]interface{}{
+				"Sid":    "15",
+				"Effect": "Allow",
+				"Action": []string{
+					// the promoted stack
+					"ssm:GetParameter",
+				},
+				"Resource": map[string]string{
+					"Fn::Sub": "arn:aws:ssm:${AWS::Region}:${AWS::AccountId}:parameter" +
+						instance_dns.ParameterName(recv.config.ServiceName, recv.environment.Name),
+				},
+			})
+	}
+
 	policies = append(policies, porterPolicy)
 	props["Policies"] = policies
 
+	if recv.environment.Access == conf.Access_SSM {
+		managedPolicyArns, _ := props["ManagedPolicyArns"].([]interface{})
+		props["ManagedPolicyArns"] = append(managedPolicyArns, ssmManagedInstanceCorePolicyArn)
+	}
+
 	return true
 }
@@ -12,21 +12,27 @@
 package provision
 
 import (
+	"compress/gzip"
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
-	yaml "gopkg.in/yaml.v2"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/adobe-platform/porter/conf"
 	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/docker/engine"
+	"github.com/adobe-platform/porter/pgzip"
+	"github.com/adobe-platform/porter/util"
 	"github.com/inconshreveable/log15"
+	yaml "gopkg.in/yaml.v2"
 )
 
 var dockerSaveLock sync.Mutex
@@ -35,12 +41,16 @@ var dockerSaveLock sync.Mutex
 func Package(log log15.Logger, config *conf.Config) (success bool) {
 
 	// clean up old artifacts before building
-	exec.Command("rm", "-rf", constants.PayloadWorkingDir).Run()
+	os.RemoveAll(constants.PayloadWorkingDir)
 
 	// clean up artifacts after building
-	defer exec.Command("rm", "-rf", constants.PayloadWorkingDir).Run()
+	defer os.RemoveAll(constants.PayloadWorkingDir)
 
-	exec.Command("mkdir", "-p", constants.PayloadWorkingDir).Run()
+	err := os.MkdirAll(constants.PayloadWorkingDir, 0755)
+	if err != nil {
+		log.Error("os.MkdirAll", "Path", constants.PayloadWorkingDir, "Error", err)
+		return
+	}
 
 	revParseOutput, err := exec.Command("git", "rev-parse", "--short", "HEAD").Output()
 	if err != nil {
@@ -56,16 +66,20 @@ func Package(log log15.Logger, config *conf.Config) (success bool) {
 	dockerPushUsername := os.Getenv(constants.EnvDockerPushUsername)
 	dockerPushPassword := os.Getenv(constants.EnvDockerPushPassword)
 
+	dockerClient, err := engine.New()
+	if err != nil {
+		log.Error("engine.New", "Error", err)
+		return
+	}
+
 	if dockerRegistry != "" && dockerPushUsername != "" && dockerPushPassword != "" {
 
 		log.Info("docker login")
-		loginCmd := exec.Command("docker", "login",
-			"-u", dockerPushUsername,
-			"-p", dockerPushPassword,
-			dockerRegistry)
-		loginCmd.Stdout = os.Stdout
-		loginCmd.Stderr = os.Stderr
-		err := loginCmd.Run()
+		err := dockerClient.Login(engine.AuthConfig{
+			Username:      dockerPushUsername,
+			Password:      dockerPushPassword,
+			ServerAddress: dockerRegistry,
+		})
 		if err != nil {
 			log.Error("docker login", "Error", err)
 			return
@@ -100,7 +114,7 @@ func Package(log log15.Logger, config *conf.Config) (success bool) {
 
 				// a unique container is the combination of its name and
 				// Dockerfiles used to build it
-				uid := container.Name + container.Dockerfile + container.DockerfileBuild
+				uid := container.Name + container.Dockerfile + container.DockerfileBuild + container.BuildTarget
 
 				if _, exists := uniqueContainers[uid]; !exists {
 
@@ -110,14 +124,17 @@ func Package(log log15.Logger, config *conf.Config) (success bool) {
 		}
 	}
 
+	architectures := config.Architectures()
+	log.Info("Building images", "Architectures", architectures)
+
 	successChan := make(chan bool)
 
 	for _, container := range uniqueContainers {
 
 		go func(container *conf.Container) {
 
-			successChan <- buildContainer(log, container.Name,
-				container.Dockerfile, container.DockerfileBuild)
+			successChan <- buildContainer(log, dockerClient, container,
+				architectures, config.ECR != nil)
 
 		}(container)
 	}
@@ -129,6 +146,28 @@ func Package(log log15.Logger, config *conf.Config) (success bool) {
 		}
 	}
 
+	// containers that share an image share the digests it was pushed with
+	builtContainers := make(map[string]*conf.Container)
+	for _, container := range uniqueContainers {
+		builtContainers[container.Name] = container
+	}
+
+	for _, environment := range config.Environments {
+		for _, region := range environment.Regions {
+			for _, container := range region.Containers {
+				built := builtContainers[container.Name]
+				container.Architectures = built.Architectures
+				container.ImageDigests = built.ImageDigests
+				container.ImageDigest = built.ImageDigest
+			}
+		}
+	}
+
+	// the config now points at each region's copy of the images
+	if config.ECR != nil && !pushToECR(log, config) {
+		return
+	}
+
 	if !copyPathBasedFiles(log, config) {
 		return
 	}
@@ -154,132 +193,287 @@ func Package(log log15.Logger, config *conf.Config) (success bool) {
 
 	log.Info(fmt.Sprintf("creating service payload at %s", constants.PayloadPath))
 
-	tarCmd := exec.Command("tar", "-C", constants.PayloadWorkingDir, "-czf", constants.PayloadPath, ".")
-	tarCmd.Stdout = os.Stdout
-	tarCmd.Stderr = os.Stderr
-	err = tarCmd.Run()
+	if !compressPayload(log, config) {
+		return
+	}
+
+	success = true
+	return
+}
+
+// compressPayload tars the payload working directory and gzips it with as
+// many threads as payload_compression allows. Hosts only extract gzip so the
+// algorithm isn't configurable
+func compressPayload(log log15.Logger, config *conf.Config) (success bool) {
+	level := gzip.DefaultCompression
+	threads := runtime.NumCPU()
+
+	if config.PayloadCompression != nil {
+		if config.PayloadCompression.Level != nil {
+			level = *config.PayloadCompression.Level
+		}
+
+		if config.PayloadCompression.Threads > 0 {
+			threads = config.PayloadCompression.Threads
+		}
+	}
+
+	payloadFile, err := os.Create(constants.PayloadPath)
+	if err != nil {
+		log.Error("os.Create", "Path", constants.PayloadPath, "Error", err)
+		return
+	}
+	defer payloadFile.Close()
+
+	gzipWriter, err := pgzip.NewWriter(payloadFile, level, threads)
+	if err != nil {
+		log.Error("pgzip.NewWriter", "Error", err)
+		return
+	}
+
+	started := time.Now()
+
+	err = util.TarDir(constants.PayloadWorkingDir, gzipWriter)
 	if err != nil {
 		log.Error("tar", "Error", err)
 		return
 	}
 
+	err = gzipWriter.Close()
+	if err != nil {
+		log.Error("gzip", "Error", err)
+		return
+	}
+
+	log.Info("Compressed service payload",
+		"Level", level,
+		"Threads", threads,
+		"Duration", time.Since(started).String())
+
 	success = true
 	return
 }
 
-func buildContainer(log log15.Logger, containerName, dockerfile, dockerfileBuild string) (success bool) {
+// buildContainer builds the container's image for every architecture the
+// service's instances run on. An image for one architecture is built for
+// the daemon's platform like it always has been
+func buildContainer(log log15.Logger, dockerClient *engine.Client,
+	container *conf.Container, architectures []string, ecr bool) (success bool) {
 
+	containerName := container.Name
 	log = log.New("ImageTag", containerName)
 
-	imagePath := fmt.Sprintf("%s/%s.docker", constants.PayloadWorkingDir, containerName)
-
-	_, err := os.Stat(dockerfile)
+	_, err := os.Stat(container.Dockerfile)
 	if err != nil {
 		log.Error("Dockerfile stat", "Error", err)
 		return
 	}
 
+	dockerRegistry := os.Getenv(constants.EnvDockerRegistry)
+
+	imageDigests := make(map[string]string)
+
+	for _, architecture := range architectures {
+
+		imageName := architectureImageName(containerName, architecture)
+		log := log
+
+		platform := ""
+		if len(architectures) > 1 || architecture != conf.Architecture_AMD64 {
+			platform = "linux/" + architecture
+			log = log.New("Platform", platform)
+		}
+
+		// images saved to the payload are built one at a time under the
+		// container's name because that's the name hosts load them with
+		if dockerRegistry == "" && !ecr {
+			imageName = containerName
+		}
+
+		if !buildImage(log, dockerClient, container, imageName, platform) {
+			return
+		}
+
+		if platform != "" {
+			image, err := dockerClient.ImageInspect(imageName)
+			if err != nil {
+				log.Error("docker image inspect", "Error", err)
+				return
+			}
+
+			if image.Architecture != architecture {
+				log.Error("The daemon built the image for another architecture",
+					"Architecture", image.Architecture)
+				return
+			}
+		}
+
+		// pushed to each region's repository once every image is built
+		if ecr {
+			continue
+		}
+
+		if dockerRegistry == "" {
+			imagePath := fmt.Sprintf("%s/%s%s.docker", constants.PayloadWorkingDir,
+				containerName, conf.ImageFileSuffix(architecture))
+
+			if !saveImage(log, dockerClient, imageName, imagePath) {
+				return
+			}
+		} else {
+
+			log.Info("docker push")
+
+			digest, err := dockerClient.ImagePush(imageName, engine.PrintProgress(os.Stdout))
+			if err != nil {
+				log.Error("docker push", "Error", err)
+				return
+			}
+
+			log.Info("docker push complete", "ImageDigest", digest)
+			imageDigests[architecture] = digest
+		}
+	}
+
+	container.Architectures = architectures
+	if len(architectures) > 1 {
+		container.ImageDigests = imageDigests
+	}
+	container.ImageDigest = defaultImageDigest(architectures, imageDigests)
+
+	success = true
+	return
+}
+
+// buildImage builds the container's image with the tag imageName
+func buildImage(log log15.Logger, dockerClient *engine.Client,
+	container *conf.Container, imageName, platform string) (success bool) {
+
+	dockerfile := container.Dockerfile
+	dockerfileBuild := container.DockerfileBuild
+
 	haveBuilder := true
-	_, err = os.Stat(dockerfileBuild)
+	_, err := os.Stat(dockerfileBuild)
 	if err != nil {
 		haveBuilder = false
 	}
 
 	if haveBuilder {
-		var err error
 
-		buildBuilderCmd := exec.Command("docker", "build", "-t", containerName+"-builder", "-f", dockerfileBuild, ".")
-		buildBuilderCmd.Stdout = os.Stdout
-		buildBuilderCmd.Stderr = os.Stderr
-		err = buildBuilderCmd.Run()
+		builderContext, err := engine.BuildContext(".", dockerfileBuild)
 		if err != nil {
-			log.Error("build Dockerfile.build", "Error", err)
+			log.Error("build context", "Error", err)
 			return
 		}
 
-		runCmd := exec.Command("docker", "run", "--rm", containerName+"-builder")
-
-		runCmdStdoutPipe, err := runCmd.StdoutPipe()
+		// the builder runs here so it's built for the daemon's platform
+		err = dockerClient.ImageBuild(builderContext, engine.BuildOptions{
+			Tags:       []string{imageName + "-builder"},
+			Dockerfile: dockerfileBuild,
+		}, engine.PrintProgress(os.Stdout))
+		builderContext.Close()
 		if err != nil {
-			log.Error("couldn't create StdoutPipe", "Error", err)
+			log.Error("build Dockerfile.build", "Error", err)
 			return
 		}
 
-		buildCmd := exec.Command("docker", "build",
-			"-t", containerName,
-			"-f", dockerfile,
-			"-")
-		buildCmd.Stdin = runCmdStdoutPipe
-		buildCmd.Stdout = os.Stdout
-		buildCmd.Stderr = os.Stderr
+		// the builder writes the build context of the image to stdout
+		buildContext, builderStdout := io.Pipe()
+
+		go func() {
+			builderStdout.CloseWithError(dockerClient.Run(engine.ContainerConfig{
+				Image: imageName + "-builder",
+			}, builderStdout, os.Stderr))
+		}()
+
+		err = dockerClient.ImageBuild(buildContext, engine.BuildOptions{
+			Tags:       []string{imageName},
+			Dockerfile: dockerfile,
+			Target:     container.BuildTarget,
+			Platform:   platform,
+		}, engine.PrintProgress(os.Stdout))
+
+		// unblock the builder if the build stopped reading its output
+		buildContext.CloseWithError(err)
 
-		err = runCmd.Start()
 		if err != nil {
-			log.Error("docker run", "Error", err)
+			log.Error("build Dockerfile", "Error", err)
 			return
 		}
+	} else {
 
-		err = buildCmd.Start()
+		buildContext, err := engine.BuildContext(".", dockerfile)
 		if err != nil {
-			log.Error("build Dockerfile", "Error", err)
+			log.Error("build context", "Error", err)
 			return
 		}
 
-		runCmd.Wait()
-		buildCmd.Wait()
-	} else {
-		buildCmd := exec.Command("docker", "build",
-			"-t", containerName,
-			"-f", dockerfile,
-			".")
-		buildCmd.Stdout = os.Stdout
-		buildCmd.Stderr = os.Stderr
-		err := buildCmd.Run()
+		err = dockerClient.ImageBuild(buildContext, engine.BuildOptions{
+			Tags:       []string{imageName},
+			Dockerfile: dockerfile,
+			Target:     container.BuildTarget,
+			Platform:   platform,
+		}, engine.PrintProgress(os.Stdout))
+		buildContext.Close()
 		if err != nil {
 			log.Error("build Dockerfile", "Error", err)
 			return
 		}
 	}
 
-	dockerRegistry := os.Getenv(constants.EnvDockerRegistry)
-
-	if dockerRegistry == "" {
-		log.Info("saving docker image to " + imagePath)
-
-		exec.Command("mkdir", "-p", path.Dir(imagePath)).Run()
+	success = true
+	return
+}
 
-		// concurrent docker saves give this
-		// Error response from daemon: open /var/lib/docker/devicemapper/mnt/0faf0a543943f7c709a018aacb339edbd85e307fd59d2a0f873af93ef25bf243/rootfs/etc/ssl/certs/ca-certificates.crt: no such file or directory
-		dockerSaveLock.Lock()
-		defer dockerSaveLock.Unlock()
+// saveImage writes the image to the service payload
+func saveImage(log log15.Logger, dockerClient *engine.Client, imageName, imagePath string) (success bool) {
+	log.Info("saving docker image to " + imagePath)
 
-		saveCmd := exec.Command("docker", "save", "-o", imagePath, containerName)
-		saveCmd.Stdout = os.Stdout
-		saveCmd.Stderr = os.Stderr
-		err = saveCmd.Run()
-		if err != nil {
-			log.Error("docker save", "Error", err)
-			return
-		}
+	os.MkdirAll(path.Dir(imagePath), 0755)
 
-	} else {
+	// concurrent docker saves give this
+	// Error response from daemon: open /var/lib/docker/devicemapper/mnt/0faf0a543943f7c709a018aacb339edbd85e307fd59d2a0f873af93ef25bf243/rootfs/etc/ssl/certs/ca-certificates.crt: no such file or directory
+	dockerSaveLock.Lock()
+	defer dockerSaveLock.Unlock()
 
-		log.Info("docker push")
+	imageFile, err := os.Create(imagePath)
+	if err != nil {
+		log.Error("os.Create", "Path", imagePath, "Error", err)
+		return
+	}
+	defer imageFile.Close()
 
-		pushCmd := exec.Command("docker", "push", containerName)
-		pushCmd.Stdout = os.Stdout
-		pushCmd.Stderr = os.Stderr
-		err := pushCmd.Run()
-		if err != nil {
-			log.Error("docker push", "Error", err)
-			return
-		}
+	err = dockerClient.ImageSave(imageName, imageFile)
+	if err != nil {
+		log.Error("docker save", "Error", err)
+		return
 	}
 
 	success = true
 	return
 }
 
+// architectureImageName is the local tag of the container's image for an
+// architecture. x86 images keep the container's name
+func architectureImageName(containerName, architecture string) string {
+	if architecture == conf.Architecture_AMD64 {
+		return containerName
+	}
+	return containerName + "-" + architecture
+}
+
+// defaultImageDigest is the digest hosts pull when they don't look up their
+// own architecture's. It's x86's or the only architecture's
+func defaultImageDigest(architectures []string, imageDigests map[string]string) string {
+	if digest, exists := imageDigests[conf.Architecture_AMD64]; exists {
+		return digest
+	}
+	if len(architectures) > 0 {
+		return imageDigests[architectures[0]]
+	}
+	return ""
+}
+
 // Ensure the files that are specified with paths in the config are part of the
 // temp directory which is passed between the pack and provision stages in GoCD.
 // If we fetched materials in every stage then the referenced files would always
@@ -0,0 +1,213 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/adobe-platform/porter/aws/ecr"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/docker/engine"
+	"github.com/inconshreveable/log15"
+)
+
+// Untagged images are left behind when a tag moves. Only porter's own tags
+// count toward max_image_count so images pushed by other tools are kept
+const ecrLifecyclePolicy = `{
+  "rules": [
+    {
+      "rulePriority": 1,
+      "description": "Expire untagged images",
+      "selection": {
+        "tagStatus": "untagged",
+        "countType": "sinceImagePushed",
+        "countUnit": "days",
+        "countNumber": 1
+      },
+      "action": {"type": "expire"}
+    },
+    {
+      "rulePriority": 2,
+      "description": "Keep the most recent porter images",
+      "selection": {
+        "tagStatus": "tagged",
+        "tagPrefixList": ["porter-"],
+        "countType": "imageCountMoreThan",
+        "countNumber": %d
+      },
+      "action": {"type": "expire"}
+    }
+  ]
+}`
+
+// ECR repositories belong to the account of the role that provisions the
+// region so that's where its images go
+type ecrDestination struct {
+	region  string
+	roleARN string
+}
+
+type ecrImage struct {
+	name    string
+	digest  string
+	digests map[string]string
+}
+
+// pushToECR pushes the images built by pack to every region's repository and
+// points the containers in the config at them
+func pushToECR(log log15.Logger, config *conf.Config) (success bool) {
+
+	destinations := make(map[ecrDestination][]*conf.Container)
+
+	for _, environment := range config.Environments {
+		for _, region := range environment.Regions {
+
+			roleARN, err := environment.GetRoleARN(region.Name)
+			if err != nil {
+				log.Error("GetRoleARN", "Error", err)
+				return
+			}
+
+			destination := ecrDestination{
+				region:  region.Name,
+				roleARN: roleARN,
+			}
+			destinations[destination] = append(destinations[destination], region.Containers...)
+		}
+	}
+
+	successChan := make(chan bool)
+
+	for destination, containers := range destinations {
+
+		go func(destination ecrDestination, containers []*conf.Container) {
+
+			successChan <- pushRegionToECR(log.New("Region", destination.region),
+				config.ECR, destination, containers)
+
+		}(destination, containers)
+	}
+
+	success = true
+
+	for i := 0; i < len(destinations); i++ {
+		regionSuccess := <-successChan
+		success = success && regionSuccess
+	}
+
+	return
+}
+
+func pushRegionToECR(log log15.Logger, ecrConfig *conf.ECR, destination ecrDestination,
+	containers []*conf.Container) (success bool) {
+
+	ecrClient := ecr.New(aws_session.STS(destination.region, destination.roleARN, 0))
+
+	repository, err := ecrClient.EnsureRepository(ecrConfig.Repository)
+	if err != nil {
+		log.Error("EnsureRepository", "Repository", ecrConfig.Repository, "Error", err)
+		return
+	}
+
+	log = log.New("RepositoryUri", repository.RepositoryUri)
+
+	_, err = ecrClient.PutLifecyclePolicy(&ecr.PutLifecyclePolicyInput{
+		RepositoryName:      repository.RepositoryName,
+		LifecyclePolicyText: fmt.Sprintf(ecrLifecyclePolicy, ecrConfig.MaxImageCount),
+	})
+	if err != nil {
+		log.Error("ecr:PutLifecyclePolicy", "Error", err)
+		return
+	}
+
+	username, password, serverAddress, err := ecrClient.Login()
+	if err != nil {
+		log.Error("ecr:GetAuthorizationToken", "Error", err)
+		return
+	}
+
+	// a client sends one set of registry credentials so each region gets its
+	// own
+	dockerClient, err := engine.New()
+	if err != nil {
+		log.Error("engine.New", "Error", err)
+		return
+	}
+
+	log.Info("docker login")
+	err = dockerClient.Login(engine.AuthConfig{
+		Username:      username,
+		Password:      password,
+		ServerAddress: serverAddress,
+	})
+	if err != nil {
+		log.Error("docker login", "Error", err)
+		return
+	}
+
+	pushed := make(map[string]ecrImage)
+
+	for _, container := range containers {
+
+		image, exists := pushed[container.Name]
+		if !exists {
+
+			architectures := container.Architectures
+			if len(architectures) == 0 {
+				architectures = []string{conf.Architecture_AMD64}
+			}
+
+			digests := make(map[string]string)
+
+			for _, architecture := range architectures {
+
+				// keep the tag pack created. It has the service version and
+				// the container name in it
+				localName := architectureImageName(container.Name, architecture)
+				remoteName := repository.RepositoryUri + localName[strings.LastIndex(localName, ":"):]
+
+				err = dockerClient.ImageTag(localName, remoteName)
+				if err != nil {
+					log.Error("docker tag", "ImageTag", remoteName, "Error", err)
+					return
+				}
+
+				log.Info("docker push", "ImageTag", remoteName)
+				digest, err := dockerClient.ImagePush(remoteName, engine.PrintProgress(os.Stdout))
+				if err != nil {
+					log.Error("docker push", "ImageTag", remoteName, "Error", err)
+					return
+				}
+				digests[architecture] = digest
+			}
+
+			image = ecrImage{
+				name:   repository.RepositoryUri + container.Name[strings.LastIndex(container.Name, ":"):],
+				digest: defaultImageDigest(architectures, digests),
+			}
+			if len(architectures) > 1 {
+				image.digests = digests
+			}
+			pushed[container.Name] = image
+		}
+
+		container.Name = image.name
+		container.ImageDigest = image.digest
+		container.ImageDigests = image.digests
+	}
+
+	success = true
+	return
+}
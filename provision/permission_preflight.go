@@ -0,0 +1,152 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/iam_policy"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/inconshreveable/log15"
+)
+
+type permissionPreflightResult struct {
+	region  string
+	denied  []iam_policy.DeniedPermission
+	skipped bool
+	err     error
+}
+
+// CheckPermissions simulates the deployer's policies for what a deploy needs
+// in each region before anything is uploaded or provisioned. Every missing
+// permission in every region is logged at once instead of the deploy failing
+// midway on the first 403
+//
+// Only the role's own policies are simulated. A bucket or key policy that
+// grants access is invisible to it which is why permission_preflight
+// defaults to warn and enforce is opt-in
+func CheckPermissions(ctx context.Context, log log15.Logger, config *conf.Config,
+	environment *conf.Environment) (success bool) {
+
+	if environment.PermissionPreflight == conf.PermissionPreflight_Off {
+		success = true
+		return
+	}
+
+	stackName, err := GetStackName(config.ServiceName, environment.Name, true)
+	if err != nil {
+		log.Error("GetStackName", "Error", err)
+		return
+	}
+
+	var (
+		wg      sync.WaitGroup
+		lock    sync.Mutex
+		results []permissionPreflightResult
+	)
+
+	for _, region := range environment.Regions {
+
+		roleARN, err := environment.GetRoleARN(region.Name)
+		if err != nil {
+			log.Error("GetRoleARN", "Error", err)
+			wg.Wait()
+			return
+		}
+
+		accountId, err := iam_policy.AccountId(roleARN)
+		if err != nil {
+			log.Error("iam_policy.AccountId", "Error", err)
+			wg.Wait()
+			return
+		}
+
+		permissions, err := iam_policy.RequiredPermissions(config, environment, region, stackName, accountId)
+		if err != nil {
+			log.Error("iam_policy.RequiredPermissions", "Error", err)
+			wg.Wait()
+			return
+		}
+
+		roleSession := aws_session.WithContext(ctx, aws_session.STS(region.Name, roleARN, 0))
+
+		wg.Add(1)
+		go func(regionName, roleARN string) {
+			defer wg.Done()
+
+			result := permissionPreflightResult{region: regionName}
+			result.denied, result.err = iam_policy.Simulate(iam.New(roleSession), roleARN, permissions)
+
+			if awsErr, ok := result.err.(awserr.Error); ok && awsErr.Code() == "AccessDenied" {
+				result.skipped = true
+				result.err = nil
+			}
+
+			lock.Lock()
+			results = append(results, result)
+			lock.Unlock()
+		}(region.Name, roleARN)
+	}
+
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].region < results[j].region
+	})
+
+	denied := 0
+	for _, result := range results {
+		regionLog := log.New("Region", result.region)
+
+		if result.skipped {
+			regionLog.Warn("Skipping the permission preflight. Allow the deploy role iam:SimulatePrincipalPolicy on itself to run it")
+			continue
+		}
+
+		if result.err != nil {
+			regionLog.Error("iam:SimulatePrincipalPolicy", "Error", result.err)
+			return
+		}
+
+		for _, permission := range result.denied {
+			denied++
+			regionLog.Error("Missing permission",
+				"Action", permission.Action,
+				"Resource", permission.Resource,
+				"Decision", permission.Decision)
+		}
+	}
+
+	if denied == 0 {
+		log.Info("The deploy role has the permissions the deploy needs")
+		success = true
+		return
+	}
+
+	if environment.PermissionPreflight == conf.PermissionPreflight_Warn {
+		log.Warn("The deploy role may be missing permissions. A bucket or key policy can still allow them",
+			"MissingPermissions", denied,
+			"Environment", environment.Name)
+		success = true
+		return
+	}
+
+	log.Error("Aborting the deploy before anything is provisioned. Generate the policy the role needs with porter iam-policy",
+		"MissingPermissions", denied,
+		"Environment", environment.Name)
+	return
+}
@@ -0,0 +1,300 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/aws/aws-sdk-go/aws"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+const (
+	serviceSecurityGroupLogicalName = "ServiceSecurityGroup"
+	serviceSecurityGroupOutput      = "ServiceSecurityGroupId"
+)
+
+// ensureSecurity adds a security group with the ingress rules of the region's
+// security block. Egress rules are set on every security group of the
+// instances by setSecurityEgress
+//
+// A service peer is the security group of the other service's
+// SecurityGroupStackName which is imported so its rules keep working across
+// both services' deployments
+func (recv *stackCreator) ensureSecurity(template *cfn.Template) (success bool) {
+	security := recv.region.Security
+	if security == nil {
+		success = true
+		return
+	}
+
+	if !recv.verifySecurityPeers() {
+		return
+	}
+
+	ingress := make([]interface{}, 0)
+	for _, rule := range security.Ingress {
+
+		if !rule.ELB {
+			ingress = append(ingress, securityRule(rule, "Source"))
+			continue
+		}
+
+		// traffic comes from the provisioned ELB before promotion and the
+		// destination ELBs after
+		for _, source := range elbSecurityGroups(template) {
+			cfnRule := securityRule(rule, "Source")
+			cfnRule["SourceSecurityGroupId"] = source
+			ingress = append(ingress, cfnRule)
+		}
+	}
+
+	template.SetResource(constants.SecurityRulesLogicalName, map[string]interface{}{
+		"Type": cfn.EC2_SecurityGroup,
+		"Properties": map[string]interface{}{
+			"GroupDescription":     "Ingress from the security block",
+			"SecurityGroupIngress": ingress,
+		},
+		"Metadata": map[string]interface{}{
+			constants.MetadataAsLc: true,
+		},
+	})
+
+	success = true
+	return
+}
+
+// securityEgress is the egress rules of the region's security block and NFS
+// to the region's file system
+func (recv *stackCreator) securityEgress() []interface{} {
+	egress := make([]interface{}, 0)
+	for _, rule := range recv.region.Security.Egress {
+		egress = append(egress, securityRule(rule, "Destination"))
+	}
+
+	if recv.region.EFS != nil {
+		egress = append(egress, map[string]interface{}{
+			"Description":                "efs",
+			"IpProtocol":                 "tcp",
+			"FromPort":                   nfsPort,
+			"ToPort":                     nfsPort,
+			"DestinationSecurityGroupId": recv.fileSystemImport(fileSystemMountTargetOutput),
+		})
+	}
+	return egress
+}
+
+// securityRule is the AWS::EC2::SecurityGroup rule for a config rule. peer
+// is Source for ingress and Destination for egress
+func securityRule(rule *conf.SecurityRule, peer string) map[string]interface{} {
+	cfnRule := map[string]interface{}{
+		"Description": rule.Name,
+		"IpProtocol":  rule.IpProtocol,
+	}
+
+	if rule.IpProtocol != "-1" {
+		cfnRule["FromPort"] = rule.FromPort
+		cfnRule["ToPort"] = rule.ToPort
+	}
+
+	switch {
+	case rule.Service != "":
+		cfnRule[peer+"SecurityGroupId"] = map[string]interface{}{
+			"Fn::ImportValue": conf.SecurityGroupStackName(rule.Service, rule.Environment),
+		}
+	case rule.PrefixList != "":
+		cfnRule[peer+"PrefixListId"] = rule.PrefixList
+	case strings.Contains(rule.CidrIp, ":"):
+		cfnRule["CidrIpv6"] = rule.CidrIp
+	case rule.CidrIp != "":
+		cfnRule["CidrIp"] = rule.CidrIp
+	}
+
+	return cfnRule
+}
+
+// elbSecurityGroups are the security groups of the provisioned ELB and the
+// ELBs the stack is promoted into
+func elbSecurityGroups(template *cfn.Template) []interface{} {
+	sources := []interface{}{
+		map[string]interface{}{"Ref": constants.ElbSgLogicalName},
+	}
+
+	seen := make(map[string]struct{})
+
+	resource, ok := template.Resources[constants.DstELBSecurityGroup].(map[string]interface{})
+	if !ok {
+		return sources
+	}
+
+	props, ok := resource["Properties"].(map[string]interface{})
+	if !ok {
+		return sources
+	}
+
+	ingressRules, ok := props["SecurityGroupIngress"].([]interface{})
+	if !ok {
+		return sources
+	}
+
+	for _, ingressRuleRaw := range ingressRules {
+		if ingressRule, ok := ingressRuleRaw.(map[string]interface{}); ok {
+			if groupId, ok := ingressRule["SourceSecurityGroupId"].(string); ok {
+				if _, exists := seen[groupId]; !exists {
+					seen[groupId] = struct{}{}
+					sources = append(sources, groupId)
+				}
+			}
+		}
+	}
+
+	return sources
+}
+
+// verifySecurityPeers checks every service a rule refers to has its security
+// group stack in the region. Otherwise CloudFormation fails the stack on the
+// missing export after creating most of it
+func (recv *stackCreator) verifySecurityPeers() (success bool) {
+	client := cloudformation.New(recv.roleSession)
+	verified := make(map[string]struct{})
+	self := conf.SecurityGroupStackName(recv.config.ServiceName, recv.environment.Name)
+
+	var rules []*conf.SecurityRule
+	rules = append(rules, recv.region.Security.Ingress...)
+	rules = append(rules, recv.region.Security.Egress...)
+
+	for _, rule := range rules {
+		if rule.Service == "" {
+			continue
+		}
+
+		// created before the stack if it doesn't exist
+		stackName := conf.SecurityGroupStackName(rule.Service, rule.Environment)
+		if stackName == self {
+			continue
+		}
+
+		if _, exists := verified[stackName]; exists {
+			continue
+		}
+
+		_, err := cloudformation.DescribeStack(client, stackName)
+		if err != nil {
+			if strings.Contains(err.Error(), "does not exist") {
+				recv.log.Error("The service has no security group in this region. Deploy it with a security block first",
+					"Rule", rule.Name,
+					"Service", rule.Service,
+					"Environment", rule.Environment,
+					"StackName", stackName)
+			} else {
+				recv.log.Error("DescribeStack", "StackName", stackName, "Error", err)
+			}
+			return
+		}
+
+		verified[stackName] = struct{}{}
+	}
+
+	success = true
+	return
+}
+
+// ensureSecurityGroupStack creates the service's SecurityGroupStackName the
+// first time the service is deployed with a security block. It's never
+// updated or pruned
+//
+// The security group is membership only. It allows nothing so it doesn't
+// widen the egress the instances' other security groups allow
+func (recv *stackCreator) ensureSecurityGroupStack() (success bool) {
+	if recv.region.Security == nil {
+		success = true
+		return
+	}
+
+	stackName := conf.SecurityGroupStackName(recv.config.ServiceName, recv.environment.Name)
+	log := recv.log.New("StackName", stackName)
+
+	client := cloudformation.New(recv.roleSession)
+
+	_, err := cloudformation.DescribeStack(client, stackName)
+	if err == nil {
+		success = true
+		return
+	}
+	if !strings.Contains(err.Error(), "does not exist") {
+		log.Error("DescribeStack", "Error", err)
+		return
+	}
+
+	template := cfn.NewTemplate()
+	template.Description = "porter managed security group for " + recv.config.ServiceName + " " + recv.environment.Name
+	template.SetResource(serviceSecurityGroupLogicalName, map[string]interface{}{
+		"Type": cfn.EC2_SecurityGroup,
+		"Properties": map[string]interface{}{
+			"GroupDescription": "Instances of " + recv.config.ServiceName + " " + recv.environment.Name,
+			"VpcId":            recv.region.VpcId,
+			"SecurityGroupEgress": []interface{}{
+				map[string]interface{}{
+					"IpProtocol": "-1",
+					"CidrIp":     "127.0.0.1/32",
+				},
+			},
+		},
+	})
+	template.Outputs = map[string]interface{}{
+		serviceSecurityGroupOutput: map[string]interface{}{
+			"Value": map[string]interface{}{"Ref": serviceSecurityGroupLogicalName},
+			"Export": map[string]interface{}{
+				"Name": stackName,
+			},
+		},
+	}
+
+	templateBytes, err := json.Marshal(template)
+	if err != nil {
+		log.Error("json.Marshal", "Error", err)
+		return
+	}
+
+	cfnRoleARN, err := recv.environment.GetCFNRoleARN(recv.region.Name)
+	if err != nil {
+		log.Error("GetCFNRoleARN", "Error", err)
+		return
+	}
+
+	log.Info("Creating the service security group stack")
+	_, err = cloudformation.CreateStackWithBody(client, stackName, string(templateBytes), cfnRoleARN)
+	if err == cloudformation.ErrAudited {
+		success = true
+		return
+	}
+	if err != nil {
+		log.Error("CreateStack", "Error", err)
+		return
+	}
+
+	err = client.WaitUntilStackCreateComplete(&cfnlib.DescribeStacksInput{
+		StackName: aws.String(stackName),
+	})
+	if err != nil {
+		log.Error("WaitUntilStackCreateComplete", "Error", err)
+		return
+	}
+
+	success = true
+	return
+}
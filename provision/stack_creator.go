@@ -12,33 +12,37 @@
 package provision
 
 import (
-	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
-	"runtime"
-	"strings"
+	"time"
 
+	"github.com/adobe-platform/porter/artifact_store"
 	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/aws/ec2"
 	"github.com/adobe-platform/porter/cfn"
 	"github.com/adobe-platform/porter/conf"
 	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/events"
+	"github.com/adobe-platform/porter/notify"
 	"github.com/adobe-platform/porter/provision_state"
+	"github.com/adobe-platform/porter/tracing"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/inconshreveable/log15"
 )
 
 type (
 	// A struct for manipulating a Cloudformation stack in a single region
 	stackCreator struct {
+		// canceled by SIGINT or the deploy's timeout. roleSession's calls
+		// stop with it
+		ctx context.Context
 		log log15.Logger
 
 		config      conf.Config
@@ -51,48 +55,234 @@ type (
 		secretsKey      string
 		secretsLocation string
 
+		// the KMS key of the secrets data key. Empty without
+		// secrets_kms_key_id
+		secretsKeyArn string
+
+		// each container's src_env_file with compute: ecs. Tasks read them
+		// from the stack instead of the secrets payload
+		ecsSecrets map[string]string
+
+		// the logical id of the hosts' IAM role
+		instanceRole string
+
+		// the value of each dependency output by its parameter name. Set by
+		// verifyDependencies
+		dependencyOutputs map[string]string
+
+		// the DNS name of the first ELB the stack is promoted into
+		destinationELBDNSName string
+
+		// the certificate requested for tls domain_name. Set by
+		// resolveCertificate
+		certificateARN string
+
+		// the listener and security group of the environment's ECS load
+		// balancer. Set by ensureECSLoadBalancerStack
+		ecsListenerArn    string
+		ecsLoadBalancerSG string
+
+		// the AMI the instances launch. Set by resolveImageId with an ami
+		// block. previousImageId is what the region's last deployment
+		// resolved
+		imageId         string
+		previousImageId string
+
 		roleSession *session.Session
 
+		// the service payload and templates are uploaded here
+		artifactStore artifact_store.Store
+
+		// each step of a deploy is recorded here. See provision_state.Store
+		stateStore provision_state.Store
+		deployment *provision_state.Deployment
+
 		// Stack creation is mostly the same between CreateStack and UpdateStack
 		// The difference is in the API call to CloudFormation
 		cfnAPI func(*cfnlib.CloudFormation, CfnApiInput) (string, bool)
 
 		templateTransforms map[string][]MapResource
+
+		// the region's span. Each step of the region is a child of it
+		span *tracing.Span
 	}
 )
 
 const (
 	s3KeyOptTemplate = 1 << iota
 	s3KeyOptDeployment
+	s3KeyOptHistory
 )
 
-func (recv *stackCreator) createUpdateStackForRegion(regionState *provision_state.Region) bool {
+func (recv *stackCreator) createUpdateStackForRegion(regionState *provision_state.Region) (success bool) {
 
-	checksum, success := recv.uploadServicePayload()
-	if !success {
+	defer func() {
+		recv.span.End(success)
+	}()
+
+	if !recv.verifyDependencies() {
+		// verifyDependencies logs errors. all we care about is success
+		recv.recordFailure("verify dependencies")
+		return
+	}
+
+	if !recv.verifyEncryptionKey() {
+		// verifyEncryptionKey logs errors. all we care about is success
+		recv.recordFailure("verify encryption key")
+		return
+	}
+
+	if !recv.verifyArchitectures() {
+		// verifyArchitectures logs errors. all we care about is success
+		recv.recordFailure("verify architectures")
+		return
+	}
+
+	if !recv.resolveImageId() {
+		// resolveImageId logs errors. all we care about is success
+		recv.recordFailure("resolve AMI")
+		return
+	}
+
+	if !recv.ensureCertificateStack() {
+		// ensureCertificateStack logs errors. all we care about is success
+		recv.recordFailure("ensure certificate")
+		return
+	}
+
+	if !recv.ensureECSLoadBalancerStack() {
+		// ensureECSLoadBalancerStack logs errors. all we care about is success
+		recv.recordFailure("ensure ECS load balancer")
+		return
+	}
+
+	span := tracing.Start(recv.span, "upload service payload")
+	checksum, uploadSuccess := recv.uploadServicePayload()
+	span.End(uploadSuccess)
+	if !uploadSuccess {
 		// uploadServicePayload logs errors. all we care about is success
-		return false
+		recv.recordFailure("upload service payload")
+		return
 	}
 
-	if !recv.uploadSecrets(checksum) {
+	recv.deployment.PayloadChecksum = checksum
+	recv.deployment.PayloadKey = recv.servicePayloadKey
+	recv.recordStatus(provision_state.StatusPayloadUploaded)
+	events.Emit(events.PayloadUploaded{
+		Header:          recv.eventHeader(),
+		PayloadKey:      recv.servicePayloadKey,
+		PayloadChecksum: checksum,
+	})
+	notify.Publish(recv.log, &recv.config, &recv.environment, notify.Event{
+		Event:  constants.EventPayloadUploaded,
+		Region: recv.region.Name,
+	})
+
+	span = tracing.Start(recv.span, "upload secrets")
+	uploadSuccess = recv.uploadSecrets(checksum)
+	span.End(uploadSuccess)
+	if !uploadSuccess {
 		// uploadSecrets logs errors. all we care about is success
-		return false
+		recv.recordFailure("upload secrets")
+		return
 	}
 
-	stackId, success := recv.createStack()
-	if !success {
+	recv.deployment.SecretsLocation = recv.secretsLocation
+	recv.recordStatus(provision_state.StatusSecretsUploaded)
+	events.Emit(events.SecretsUploaded{
+		Header:          recv.eventHeader(),
+		SecretsLocation: recv.secretsLocation,
+	})
+
+	if !recv.uploadDeploymentManifest() {
+		// uploadDeploymentManifest logs errors. all we care about is success
+		recv.recordFailure("upload deployment manifest")
+		return
+	}
+
+	events.Emit(events.ManifestUploaded{
+		Header:      recv.eventHeader(),
+		ManifestKey: recv.deploymentManifestKey(),
+	})
+
+	stackId, createSuccess := recv.createStack()
+	if !createSuccess {
 		// createStack logs errors. all we care about is success
-		return false
+		recv.recordFailure("create stack")
+		return
+	}
+
+	if stackId == "" {
+		recv.log.Info("Audit mode. The stack wasn't created")
+		success = true
+		return
 	}
 
 	regionState.StackId = stackId
 
-	return true
+	if !recv.grantSecretsKey(stackId) {
+		// grantSecretsKey logs errors. all we care about is success
+		recv.recordFailure("grant secrets key")
+		return
+	}
+
+	recv.deployment.StackId = stackId
+	recv.recordStatus(provision_state.StatusStackCreating)
+	events.Emit(events.StackRequested{
+		Header:  recv.eventHeader(),
+		StackId: stackId,
+		Update:  recv.deployment.Hotswap,
+	})
+
+	success = true
+	return
+}
+
+func (recv *stackCreator) recordStatus(status string) {
+	if recv.stateStore == nil {
+		return
+	}
+
+	recv.deployment.Status = status
+	recv.deployment.Error = ""
+	RecordDeployment(recv.log, recv.stateStore, recv.deployment)
+}
+
+func (recv *stackCreator) recordFailure(step string) {
+	reason := CancelReason(recv.ctx)
+
+	events.Emit(events.StepFailed{
+		Header: recv.eventHeader(),
+		Step:   step,
+		Reason: reason,
+	})
+
+	if recv.stateStore == nil {
+		return
+	}
+
+	recv.deployment.Status = provision_state.StatusFailed
+	recv.deployment.Error = step + " failed"
+	if reason != "" {
+		recv.deployment.Error = step + " stopped: " + reason
+	}
+	RecordDeployment(recv.log, recv.stateStore, recv.deployment)
+}
+
+func (recv *stackCreator) eventHeader() events.Header {
+	return events.Header{
+		ServiceName:    recv.config.ServiceName,
+		ServiceVersion: recv.config.ServiceVersion,
+		Environment:    recv.environment.Name,
+		Region:         recv.region.Name,
+		StackName:      recv.deployment.StackName,
+		Time:           time.Now().UTC(),
+	}
 }
 
 func (recv *stackCreator) uploadServicePayload() (checksum string, success bool) {
 
-	defer exec.Command("rm", "-rf", constants.PayloadPath).Run()
+	defer os.Remove(constants.PayloadPath)
 
 	payloadBytes, err := ioutil.ReadFile(constants.PayloadPath)
 	if err != nil {
@@ -100,51 +290,69 @@ func (recv *stackCreator) uploadServicePayload() (checksum string, success bool)
 		return
 	}
 
-	s3Client := s3.New(recv.roleSession)
-
 	// TODO don't use a digest that requires everything to be in memory
 	checksumArray := sha256.Sum256(payloadBytes)
 	checksum = hex.EncodeToString(checksumArray[:])
-	recv.servicePayloadChecksum = checksum
-	recv.servicePayloadKey = fmt.Sprintf("%s/%s.tar", recv.s3KeyRoot(s3KeyOptDeployment), checksum)
+	recv.setServicePayloadChecksum(checksum)
 
-	headObjectInput := &s3.HeadObjectInput{
-		Bucket: aws.String(recv.region.S3Bucket),
-		Key:    aws.String(recv.servicePayloadKey),
+	exists, err := recv.artifactStore.Exists(recv.servicePayloadKey)
+	if err != nil {
+		recv.log.Error("Service payload exists check", "Error", err)
+		return
 	}
-
-	headObjectOutput, err := s3Client.HeadObject(headObjectInput)
-	if err == nil {
-		if headObjectOutput.ContentLength != nil && *headObjectOutput.ContentLength > 0 {
-			recv.log.Info("Service payload exists", "S3key", recv.servicePayloadKey)
-			success = true
-			return
-		}
-	} else if !strings.Contains(err.Error(), "404") {
-		recv.log.Error("HeadObject", "Error", err)
-		if strings.Contains(err.Error(), "403") {
-			recv.log.Error("s3:GetObject and s3:ListBucket are needed for this operation to work")
-		}
+	if exists {
+		recv.log.Info("Service payload exists", "S3key", recv.servicePayloadKey)
+		success = true
 		return
 	}
 
-	uploadInput := &s3manager.UploadInput{
-		Bucket:          aws.String(recv.region.S3Bucket),
-		Key:             aws.String(recv.servicePayloadKey),
-		Body:            bytes.NewReader(payloadBytes),
-		ContentType:     aws.String("application/x-tar"),
-		ContentEncoding: aws.String("gzip"),
-		StorageClass:    aws.String("STANDARD_IA"),
+	recv.log.Info("Uploading service payload", "S3key", recv.servicePayloadKey)
+
+	err = recv.artifactStore.Put(artifact_store.Object{
+		Key:             recv.servicePayloadKey,
+		Body:            payloadBytes,
+		ContentType:     "application/x-tar",
+		ContentEncoding: "gzip",
+		Infrequent:      true,
+	})
+	if err != nil {
+		recv.log.Error("Upload failure", "Error", err)
+		return
 	}
 
-	s3Manager := s3manager.NewUploader(recv.roleSession)
-	s3Manager.Concurrency = runtime.GOMAXPROCS(-1) // read, don't set, the value
+	success = true
+	return
+}
 
-	recv.log.Info("Uploading service payload",
-		"S3key", recv.servicePayloadKey,
-		"Concurrency", s3Manager.Concurrency)
+// uploadDeploymentManifest records the payload this stack is deployed with
+// where its hosts check it before starting containers. It's written on every
+// create and update so it follows the stack
+func (recv *stackCreator) uploadDeploymentManifest() (success bool) {
+
+	manifestBytes, err := json.Marshal(provision_state.DeploymentManifest{
+		ServiceName:     recv.config.ServiceName,
+		ServiceVersion:  recv.config.ServiceVersion,
+		Environment:     recv.environment.Name,
+		Region:          recv.region.Name,
+		StackName:       recv.deployment.StackName,
+		PayloadKey:      recv.servicePayloadKey,
+		PayloadChecksum: recv.servicePayloadChecksum,
+		CreatedAt:       time.Now().UTC(),
+		SecretsKeyArn:   recv.secretsKeyArn,
+	})
+	if err != nil {
+		recv.log.Error("json.Marshal", "Error", err)
+		return
+	}
+
+	manifestKey := recv.deploymentManifestKey()
+	recv.log.Info("Uploading deployment manifest", "S3key", manifestKey)
 
-	_, err = s3Manager.Upload(uploadInput)
+	err = recv.artifactStore.Put(artifact_store.Object{
+		Key:         manifestKey,
+		Body:        manifestBytes,
+		ContentType: "application/json",
+	})
 	if err != nil {
 		recv.log.Error("Upload failure", "Error", err)
 		return
@@ -154,11 +362,42 @@ func (recv *stackCreator) uploadServicePayload() (checksum string, success bool)
 	return
 }
 
+// deploymentManifestKey is under the deployment prefix so hosts can already
+// read it
+func (recv *stackCreator) deploymentManifestKey() string {
+	return fmt.Sprintf("%s/manifests/%s.json", recv.s3KeyRoot(s3KeyOptDeployment), recv.deployment.StackName)
+}
+
+// deploymentManifestUrl is where hosts download the deployment manifest from.
+// It's empty if they download it from the region's S3 bucket
+func (recv *stackCreator) deploymentManifestUrl() string {
+	if recv.artifactStore == nil {
+		return ""
+	}
+	return recv.artifactStore.URL(recv.deploymentManifestKey())
+}
+
+// servicePayloadUrl is where hosts download the service payload from. It's
+// empty if they download it from the region's S3 bucket
+func (recv *stackCreator) servicePayloadUrl() string {
+	if recv.artifactStore == nil {
+		return ""
+	}
+	return recv.artifactStore.URL(recv.servicePayloadKey)
+}
+
+func (recv *stackCreator) setServicePayloadChecksum(checksum string) {
+	recv.servicePayloadChecksum = checksum
+	recv.servicePayloadKey = fmt.Sprintf("%s/%s.tar", recv.s3KeyRoot(s3KeyOptDeployment), checksum)
+}
+
 func (recv *stackCreator) createStack() (stackId string, success bool) {
 
 	client := cloudformation.New(recv.roleSession)
 
+	span := tracing.Start(recv.span, "render template")
 	templateBytes, creationSuccess := recv.createTemplate()
+	span.End(creationSuccess)
 	if !creationSuccess {
 		return
 	}
@@ -170,53 +409,168 @@ func (recv *stackCreator) createStack() (stackId string, success bool) {
 		return
 	}
 
+	if len(templateBytes) <= validateTemplateBodyMax && !recv.validateTemplate(templateBytes, "") {
+		return
+	}
+
 	checksumArray := sha256.Sum256(templateBytes)
 	checksum := hex.EncodeToString(checksumArray[:])
 	templateS3Key := fmt.Sprintf("%s/%s", recv.s3KeyRoot(s3KeyOptTemplate), checksum)
 
-	uploadInput := &s3manager.UploadInput{
-		Bucket:      aws.String(recv.region.S3Bucket),
-		Key:         aws.String(templateS3Key),
-		Body:        bytes.NewReader(templateBytes),
-		ContentType: aws.String("application/json"),
+	// the key is the template's checksum so a resumed deploy can skip this
+	exists, err := recv.artifactStore.Exists(templateS3Key)
+	if err != nil {
+		recv.log.Error("CloudFormation template exists check", "Error", err)
+		return
 	}
+	if exists {
+		recv.log.Info("CloudFormation template exists", "S3key", templateS3Key)
+	} else {
 
-	if recv.region.SSEKMSKeyId != nil {
-		uploadInput.SSEKMSKeyId = recv.region.SSEKMSKeyId
-		uploadInput.ServerSideEncryption = aws.String("aws:kms")
-	}
+		recv.log.Info("Uploading CloudFormation template", "S3key", templateS3Key)
 
-	s3Manager := s3manager.NewUploader(recv.roleSession)
-	s3Manager.Concurrency = runtime.GOMAXPROCS(-1) // read, don't set, the value
+		err = recv.artifactStore.Put(artifact_store.Object{
+			Key:         templateS3Key,
+			Body:        templateBytes,
+			ContentType: "application/json",
+		})
+		if err != nil {
+			recv.log.Error("Upload failure", "Error", err)
+			return
+		}
+	}
 
-	recv.log.Info("Uploading CloudFormation template",
-		"S3bucket", recv.region.S3Bucket,
-		"S3key", templateS3Key,
-		"Concurrency", s3Manager.Concurrency)
+	recv.recordStatus(provision_state.StatusTemplateUploaded)
+	events.Emit(events.TemplateUploaded{
+		Header:      recv.eventHeader(),
+		TemplateKey: templateS3Key,
+	})
 
-	_, err = s3Manager.Upload(uploadInput)
+	cfnRoleARN, err := recv.environment.GetCFNRoleARN(recv.region.Name)
 	if err != nil {
-		recv.log.Error("Upload failure", "Error", err)
+		recv.log.Error("GetCFNRoleARN", "Error", err)
 		return
 	}
 
-	templateUrl := fmt.Sprintf("https://s3.amazonaws.com/%s/%s",
-		recv.region.S3Bucket, templateS3Key)
+	secretParameters, secretParametersSuccess := recv.ecsSecretsParameters()
+	if !secretParametersSuccess {
+		return
+	}
 
 	params := CfnApiInput{
-		Environment: recv.environment.Name,
-		Region:      recv.region.Name,
-		SecretsKey:  recv.secretsKey,
-		SecretsLoc:  recv.secretsLocation,
-		TemplateUrl: templateUrl,
+		Environment:      recv.environment.Name,
+		Region:           recv.region.Name,
+		SecretsKey:       recv.secretsKey,
+		SecretsLoc:       recv.secretsLocation,
+		SecretParameters: secretParameters,
+		Tags:             recv.stackTags(),
+		CFNRoleARN:       cfnRoleARN,
 	}
 
+	// CloudFormation only reads templates from S3. Templates kept elsewhere
+	// are passed inline
+	params.TemplateUrl = recv.artifactStore.TemplateURL(templateS3Key)
+	if params.TemplateUrl == "" {
+		if len(templateBytes) > validateTemplateBodyMax {
+			recv.log.Error("The template is too big to pass to CloudFormation inline. Use the s3 artifact_store",
+				"Bytes", len(templateBytes),
+				"MaxBytes", validateTemplateBodyMax)
+			return
+		}
+		params.TemplateBody = string(templateBytes)
+	} else if len(templateBytes) > validateTemplateBodyMax && !recv.validateTemplate(nil, params.TemplateUrl) {
+		return
+	}
+
+	if !recv.ensureSecurityGroupStack() {
+		return
+	}
+
+	if !recv.ensureFileSystemStack() {
+		return
+	}
+
+	apiName := "CreateStack"
+	if recv.deployment.Hotswap {
+		apiName = "UpdateStack"
+	}
+
+	span = tracing.Start(recv.span, apiName)
 	stackId, success = recv.cfnAPI(client, params)
+	span.End(success)
+	if success {
+		recv.recordTemplateHistory(templateBytes, stackId)
+	}
 	return
 }
 
+// stackTags identify what a region is running so promote can refuse to mix
+// versions across regions and downstream services can find this stack
+func (recv *stackCreator) stackTags() []*cfnlib.Tag {
+	tags := []*cfnlib.Tag{
+		{
+			Key:   aws.String(constants.PorterVersion),
+			Value: aws.String(constants.Version),
+		},
+		{
+			Key:   aws.String(constants.PorterServiceVersionTag),
+			Value: aws.String(recv.config.ServiceVersion),
+		},
+		{
+			Key:   aws.String(constants.PorterPayloadChecksumTag),
+			Value: aws.String(recv.servicePayloadChecksum),
+		},
+		{
+			Key:   aws.String(constants.PorterServiceNameTag),
+			Value: aws.String(recv.config.ServiceName),
+		},
+		{
+			Key:   aws.String(constants.PorterEnvironmentTag),
+			Value: aws.String(recv.environment.Name),
+		},
+		{
+			Key:   aws.String(constants.PorterDeploymentIdTag),
+			Value: aws.String(recv.deployment.StackName),
+		},
+		{
+			Key:   aws.String(constants.PorterStackColorTag),
+			Value: aws.String(recv.deployment.StackColor),
+		},
+	}
+
+	if recv.secretsKeyArn != "" {
+		tags = append(tags, &cfnlib.Tag{
+			Key:   aws.String(constants.PorterSecretsKeyArnTag),
+			Value: aws.String(recv.secretsKeyArn),
+		})
+	}
+
+	if recv.environment.StampName != "" {
+		tags = append(tags,
+			&cfnlib.Tag{
+				Key:   aws.String(constants.PorterStampTag),
+				Value: aws.String(recv.environment.StampName),
+			},
+			&cfnlib.Tag{
+				Key:   aws.String(constants.PorterStampOfTag),
+				Value: aws.String(recv.environment.StampOf),
+			},
+		)
+	}
+
+	return tags
+}
+
 func (recv *stackCreator) createTemplate() (templateBytes []byte, success bool) {
 
+	if !recv.discoverNetwork() {
+		return
+	}
+
+	if !recv.resolveCertificate() {
+		return
+	}
+
 	var err error
 	template := cfn.NewTemplate()
 
@@ -252,6 +606,10 @@ func (recv *stackCreator) createTemplate() (templateBytes []byte, success bool)
 		return
 	}
 
+	if !recv.checkTemplateRules(template) {
+		return
+	}
+
 	// serialize expanded template
 	templateBytes, err = json.Marshal(template)
 	if err != nil {
@@ -259,6 +617,34 @@ func (recv *stackCreator) createTemplate() (templateBytes []byte, success bool)
 		return
 	}
 
+	if !recv.checkGuardRules(templateBytes) {
+		return
+	}
+
+	success = true
+	return
+}
+
+// discoverNetwork resolves the region's vpc_tags and subnet_tags into the VPC
+// and subnets the template uses
+func (recv *stackCreator) discoverNetwork() (success bool) {
+	if len(recv.region.VpcTags) == 0 && len(recv.region.SubnetTags) == 0 {
+		success = true
+		return
+	}
+
+	err := recv.region.DiscoverNetwork(ec2.NetworkFinder{Client: ec2.New(recv.roleSession)})
+	if err != nil {
+		recv.log.Error("Network discovery", "Error", err)
+		return
+	}
+
+	var subnetIds []string
+	for _, az := range recv.region.AZs {
+		subnetIds = append(subnetIds, az.Name+"="+az.SubnetID)
+	}
+	recv.log.Info("Discovered the network", "VpcId", recv.region.VpcId, "Subnets", subnetIds)
+
 	success = true
 	return
 }
@@ -267,16 +653,44 @@ func (recv *stackCreator) mutateTemplate(template *cfn.Template) (success bool)
 
 	template.Description = fmt.Sprintf("%s (powered by porter %s)", recv.config.ServiceName, constants.Version)
 
+	if template.Metadata == nil {
+		template.Metadata = make(map[string]interface{})
+	}
+	template.Metadata[constants.MetadataPorter] = TemplateProvenance{
+		ServiceName:   recv.config.ServiceName,
+		PorterVersion: constants.Version,
+	}
+
 	success = recv.ensureResources(template)
 	if !success {
 		return
 	}
 
+	success = recv.ensureWAF(template)
+	if !success {
+		return
+	}
+
+	success = recv.ensureLogging(template)
+	if !success {
+		return
+	}
+
+	success = recv.ensureDownstreamOutputs(template)
+	if !success {
+		return
+	}
+
 	success = recv.mapResources(template)
 	if !success {
 		return
 	}
 
+	success = recv.replaceLaunchConfiguration(template)
+	if !success {
+		return
+	}
+
 	success = true
 	return
 }
@@ -287,6 +701,8 @@ func (recv *stackCreator) s3KeyRoot(prefixOpt int) string {
 		prefix = "porter-template"
 	} else if prefixOpt&s3KeyOptDeployment == s3KeyOptDeployment {
 		prefix = "porter-deployment"
+	} else if prefixOpt&s3KeyOptHistory == s3KeyOptHistory {
+		prefix = "porter-history"
 	} else {
 		panic(fmt.Errorf("invalid option %d", prefixOpt))
 	}
@@ -13,22 +13,25 @@ package provision
 
 import (
 	"bytes"
-	"encoding/gob"
-	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
-	"runtime"
+	"time"
 
+	"github.com/adobe-platform/porter/artifact_store"
+	"github.com/adobe-platform/porter/aws/kms"
 	"github.com/adobe-platform/porter/aws_session"
 	"github.com/adobe-platform/porter/conf"
 	"github.com/adobe-platform/porter/constants"
 	dockerutil "github.com/adobe-platform/porter/docker/util"
 	"github.com/adobe-platform/porter/secrets"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/inconshreveable/log15"
 )
 
 func (recv *stackCreator) getContainerSecrets() (containerSecrets map[string]string, success bool) {
@@ -186,28 +189,155 @@ func (recv *stackCreator) getHostSecrets() (hostSecrets []byte, success bool) {
 	return
 }
 
-func (recv *stackCreator) uploadSecrets(checksum string) (success bool) {
-	recv.log.Debug("uploadSecrets() BEGIN")
-	defer recv.log.Debug("uploadSecrets() END")
+// generateSecretsKey creates the key that encrypts this deployment's secrets
+// and sets the value of the secrets key stack parameter. With
+// secrets_kms_key_id it's a KMS data key and only its ciphertext leaves this
+// function
+func (recv *stackCreator) generateSecretsKey(checksum string) (symmetricKey []byte, success bool) {
+	var err error
 
-	containerToSecrets, getContainerSecretsSuccess := recv.getContainerSecrets()
-	if !getContainerSecretsSuccess {
+	if recv.region.SecretsKMSKeyId == "" {
+
+		symmetricKey, err = secrets.GenerateKey()
+		if err != nil {
+			recv.log.Crit("secrets.GenerateKey", "Error", err)
+			return
+		}
+		recv.secretsKey = secrets.EncodeKey(symmetricKey)
+
+		success = true
 		return
 	}
 
-	hostSecrets, getHostSecretsSuccess := recv.getHostSecrets()
-	if !getHostSecretsSuccess {
+	recv.log.Info("Generating secrets data key", "KeyId", recv.region.SecretsKMSKeyId)
+
+	symmetricKey, recv.secretsKey, recv.secretsKeyArn, err = secrets.GenerateDataKey(kms.New(recv.roleSession),
+		recv.region.SecretsKMSKeyId, checksum)
+	if err != nil {
+		recv.log.Crit("kms:GenerateDataKey", "Error", err)
+		return
+	}
+
+	success = true
+	return
+}
+
+// grantSecretsKey lets the stack's hosts decrypt this deployment's data key.
+// Their role isn't allowed to decrypt data keys on its own. The grant is
+// constrained to the service payload and DeleteStack revokes it
+func (recv *stackCreator) grantSecretsKey(stackId string) (success bool) {
+	if recv.secretsKeyArn == "" || recv.instanceRole == "" {
+		success = true
 		return
 	}
 
-	symmetricKey, err := secrets.GenerateKey()
+	log := recv.log.New("StackId", stackId, "LogicalId", recv.instanceRole)
+
+	role, waitSuccess := recv.waitForInstanceRole(log, stackId)
+	if !waitSuccess {
+		return
+	}
+	roleName := aws.StringValue(role.PhysicalResourceId)
+
+	log.Info("iam:GetRole", "RoleName", roleName)
+	getRoleOutput, err := iam.New(recv.roleSession).GetRole(&iam.GetRoleInput{
+		RoleName: aws.String(roleName),
+	})
 	if err != nil {
-		recv.log.Crit("secrets.GenerateKey", "Error", err)
+		log.Error("iam:GetRole", "Error", err)
+		return
+	}
+	roleArn := aws.StringValue(getRoleOutput.Role.Arn)
+
+	log.Info("Granting the stack's role the secrets data key", "KeyArn", recv.secretsKeyArn, "RoleArn", roleArn)
+
+	// named after the CloudFormation stack which keeps its name on hot swaps
+	grantId, err := secrets.CreateGrant(kms.New(recv.roleSession), recv.secretsKeyArn, roleArn,
+		aws.StringValue(role.StackName), recv.servicePayloadChecksum)
+	if err != nil {
+		log.Error("kms:CreateGrant", "Error", err)
+		return
+	}
+
+	log.Info("Created grant", "GrantId", grantId)
+	success = true
+	return
+}
+
+// waitForInstanceRole waits for CloudFormation to create the hosts' IAM role.
+// Instances can't launch before it exists so the grant is usable about as soon
+// as they boot
+func (recv *stackCreator) waitForInstanceRole(log log15.Logger, stackId string) (role *cfnlib.StackResourceDetail, success bool) {
+
+	client := cfnlib.New(recv.roleSession)
+	timeout := time.After(constants.InstanceRoleTimeout)
+
+	for {
+		// the resource doesn't exist until CloudFormation starts creating it
+		output, err := client.DescribeStackResource(&cfnlib.DescribeStackResourceInput{
+			StackName:         aws.String(stackId),
+			LogicalResourceId: aws.String(recv.instanceRole),
+		})
+		if err == nil {
+			role = output.StackResourceDetail
+			status := aws.StringValue(role.ResourceStatus)
+
+			switch status {
+			case cfnlib.ResourceStatusCreateComplete, cfnlib.ResourceStatusUpdateComplete:
+				success = true
+				return
+			case cfnlib.ResourceStatusCreateFailed, cfnlib.ResourceStatusUpdateFailed:
+				log.Error("The stack's IAM role wasn't created", "Status", status,
+					"Reason", aws.StringValue(role.ResourceStatusReason))
+				return
+			}
+		} else {
+			log.Debug("cloudformation:DescribeStackResource", "Error", err)
+		}
+
+		select {
+		case <-timeout:
+			log.Error("Timed out waiting for the stack's IAM role")
+			return
+		case <-recv.ctx.Done():
+			log.Error("Stopped waiting for the stack's IAM role", "Reason", CancelReason(recv.ctx))
+			return
+		case <-time.After(constants.InstanceRolePoll):
+		}
+	}
+}
+
+// ResolveSecrets gets the secrets that provisioning the environment's region
+// would upload without encrypting or uploading them
+func ResolveSecrets(log log15.Logger, config *conf.Config, environment *conf.Environment,
+	region *conf.Region, roleSession *session.Session) (secretPayload secrets.Payload, success bool) {
+
+	recv := &stackCreator{
+		log: log.New("Region", region.Name),
+
+		config:      *config,
+		environment: *environment,
+		region:      *region,
+
+		roleSession: roleSession,
+	}
+
+	return recv.resolveSecrets()
+}
+
+func (recv *stackCreator) resolveSecrets() (secretPayload secrets.Payload, success bool) {
+
+	containerToSecrets, getContainerSecretsSuccess := recv.getContainerSecrets()
+	if !getContainerSecretsSuccess {
 		return
 	}
-	recv.secretsKey = hex.EncodeToString(symmetricKey)
 
-	secretPayload := secrets.Payload{
+	hostSecrets, getHostSecretsSuccess := recv.getHostSecrets()
+	if !getHostSecretsSuccess {
+		return
+	}
+
+	secretPayload = secrets.Payload{
 		HostSecrets:        hostSecrets,
 		ContainerSecrets:   containerToSecrets,
 		DockerRegistry:     os.Getenv(constants.EnvDockerRegistry),
@@ -215,42 +345,81 @@ func (recv *stackCreator) uploadSecrets(checksum string) (success bool) {
 		DockerPullPassword: os.Getenv(constants.EnvDockerPullPassword),
 	}
 
-	var secretPayloadBuf bytes.Buffer
+	success = true
+	return
+}
 
-	err = gob.NewEncoder(&secretPayloadBuf).Encode(secretPayload)
-	if err != nil {
-		recv.log.Crit("gob.Marshal", "Error", err)
+func (recv *stackCreator) secretsLimits() secrets.Limits {
+	limits := secrets.Limits{
+		MaxSize: recv.config.SecretsMaxSize(),
+	}
+
+	if recv.config.SecretsPayload != nil {
+		limits.AllowBinary = recv.config.SecretsPayload.AllowBinary
+		limits.AllowBinaryHost = recv.config.SecretsPayload.AllowBinaryHost
+	}
+
+	return limits
+}
+
+func (recv *stackCreator) uploadSecrets(checksum string) (success bool) {
+	recv.log.Debug("uploadSecrets() BEGIN")
+	defer recv.log.Debug("uploadSecrets() END")
+
+	secretPayload, resolveSecretsSuccess := recv.resolveSecrets()
+	if !resolveSecretsSuccess {
+		return
+	}
+
+	if recv.environment.Compute == conf.Compute_ECS {
+		recv.ecsSecrets = secretPayload.ContainerSecrets
+	}
+
+	symmetricKey, generateSecretsKeySuccess := recv.generateSecretsKey(checksum)
+	if !generateSecretsKeySuccess {
 		return
 	}
 
-	recv.secretsLocation = fmt.Sprintf("%s/%s.secrets", recv.s3KeyRoot(s3KeyOptDeployment), checksum)
+	// the plaintext key isn't needed once the payload is encrypted
+	defer func() {
+		for i := range symmetricKey {
+			symmetricKey[i] = 0
+		}
+	}()
 
-	secretPayloadBytesEnc, err := secrets.Encrypt(secretPayloadBuf.Bytes(), symmetricKey)
+	// hosts only find out a payload is unusable while they boot
+	secretPayloadBytes, err := secrets.Pack(secretPayload, recv.secretsLimits())
 	if err != nil {
-		recv.log.Crit("Secrets encryption failed", "Error", err)
+		recv.log.Crit("secrets.Pack", "Error", err)
 		return
 	}
 
-	uploadInput := &s3manager.UploadInput{
-		Bucket: aws.String(recv.region.S3Bucket),
-		Key:    aws.String(recv.secretsLocation),
-		Body:   bytes.NewReader(secretPayloadBytesEnc),
-	}
+	recv.secretsLocation = secrets.Location(recv.s3KeyRoot(s3KeyOptDeployment), checksum)
 
-	if recv.region.SSEKMSKeyId != nil {
-		uploadInput.SSEKMSKeyId = recv.region.SSEKMSKeyId
-		uploadInput.ServerSideEncryption = aws.String("aws:kms")
+	// binding the checksum means hosts can't be handed secrets that were
+	// uploaded for a different service payload
+	secretPayloadBytesEnc, err := secrets.EncryptBound(secretPayloadBytes, symmetricKey, []byte(checksum))
+	if err != nil {
+		recv.log.Crit("Secrets encryption failed", "Error", err)
+		return
 	}
 
-	s3Manager := s3manager.NewUploader(recv.roleSession)
-	s3Manager.Concurrency = runtime.GOMAXPROCS(-1) // read, don't set, the value
+	// secrets always go to the region's bucket, whatever the artifact store
+	secretsStore := &artifact_store.S3{
+		Session:     recv.roleSession,
+		Bucket:      recv.region.S3Bucket,
+		SSEKMSKeyId: recv.region.SSEKMSKeyId,
+		BucketKey:   recv.region.BucketKeyEnabled(),
+	}
 
 	recv.log.Info("Uploading secrets",
 		"S3bucket", recv.region.S3Bucket,
-		"S3key", recv.secretsLocation,
-		"Concurrency", s3Manager.Concurrency)
+		"S3key", recv.secretsLocation)
 
-	_, err = s3Manager.Upload(uploadInput)
+	err = secretsStore.Put(artifact_store.Object{
+		Key:  recv.secretsLocation,
+		Body: secretPayloadBytesEnc,
+	})
 	if err != nil {
 		recv.log.Error("Upload", "Error", err)
 		return
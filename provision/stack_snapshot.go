@@ -0,0 +1,152 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/adobe-platform/porter/artifact_store"
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/inconshreveable/log15"
+)
+
+// StackSnapshot is what an update of a stack replaces. cfn-init on a new
+// instance reads the stack's current metadata so restoring the snapshot is
+// what brings the previous service payload back, not the launch template
+// version alone
+type StackSnapshot struct {
+	StackId      string
+	TemplateBody string
+	Parameters   []*cfnlib.Parameter
+	Tags         []*cfnlib.Tag
+}
+
+// SnapshotStack reads the template, parameters, and tags of a stack before
+// it's updated
+func SnapshotStack(log log15.Logger, roleSession *session.Session, stackId string) (snapshot StackSnapshot, success bool) {
+	cfnClient := cloudformation.New(roleSession)
+
+	describeStacksOutput, err := cfnClient.DescribeStacks(&cfnlib.DescribeStacksInput{
+		StackName: aws.String(stackId),
+	})
+	if err != nil {
+		log.Error("cloudformation:DescribeStacks", "Error", err)
+		return
+	}
+	if len(describeStacksOutput.Stacks) != 1 {
+		log.Error("len(describeStacksOutput.Stacks != 1)")
+		return
+	}
+
+	getTemplateOutput, err := cfnClient.GetTemplate(&cfnlib.GetTemplateInput{
+		StackName: aws.String(stackId),
+	})
+	if err != nil {
+		log.Error("cloudformation:GetTemplate", "Error", err)
+		return
+	}
+
+	snapshot = StackSnapshot{
+		StackId:      stackId,
+		TemplateBody: aws.StringValue(getTemplateOutput.TemplateBody),
+		Parameters:   describeStacksOutput.Stacks[0].Parameters,
+		Tags:         describeStacksOutput.Stacks[0].Tags,
+	}
+	success = true
+	return
+}
+
+// RestoreStack updates a stack back to a snapshot and waits for the update to
+// complete. A template too big to pass inline is uploaded to the region's
+// artifact store first
+func RestoreStack(ctx context.Context, log log15.Logger, config *conf.Config, environment *conf.Environment,
+	regionName string, roleSession *session.Session, snapshot StackSnapshot) (success bool) {
+
+	log = log.New("StackId", snapshot.StackId)
+
+	region, err := environment.GetRegion(regionName)
+	if err != nil {
+		log.Error("GetRegion", "Error", err)
+		return
+	}
+
+	cfnRoleARN, err := environment.GetCFNRoleARN(regionName)
+	if err != nil {
+		log.Error("GetCFNRoleARN", "Error", err)
+		return
+	}
+
+	var templateUrl string
+	if len(snapshot.TemplateBody) > validateTemplateBodyMax {
+		artifactStore, err := artifact_store.New(config, region, roleSession)
+		if err != nil {
+			log.Error("artifact_store.New", "Error", err)
+			return
+		}
+
+		checksumArray := sha256.Sum256([]byte(snapshot.TemplateBody))
+		templateKey := fmt.Sprintf("porter-template/%s/%s/rollback/%s",
+			config.ServiceName, environment.Name, hex.EncodeToString(checksumArray[:]))
+
+		templateUrl = artifactStore.TemplateURL(templateKey)
+		if templateUrl == "" {
+			log.Error("The previous template is too big to pass to CloudFormation inline. Use the s3 artifact_store",
+				"Bytes", len(snapshot.TemplateBody),
+				"MaxBytes", validateTemplateBodyMax)
+			return
+		}
+
+		err = artifactStore.Put(artifact_store.Object{
+			Key:         templateKey,
+			Body:        []byte(snapshot.TemplateBody),
+			ContentType: "application/json",
+		})
+		if err != nil {
+			log.Error("Upload failure", "Error", err)
+			return
+		}
+	}
+
+	cfnClient := cloudformation.New(aws_session.WithContext(ctx, roleSession))
+
+	log.Info("Restoring the stack's previous template and parameters")
+	err = cloudformation.UpdateStack(cfnClient, snapshot.StackId, templateUrl, snapshot.TemplateBody,
+		snapshot.Parameters, snapshot.Tags, cfnRoleARN)
+	if err != nil {
+		if strings.Contains(err.Error(), "No updates are to be performed") {
+			success = true
+			return
+		}
+		log.Error("cloudformation:UpdateStack", "Error", err)
+		return
+	}
+
+	err = cfnClient.WaitUntilStackUpdateComplete(&cfnlib.DescribeStacksInput{
+		StackName: aws.String(snapshot.StackId),
+	})
+	if err != nil {
+		log.Error("WaitUntilStackUpdateComplete", "Error", err)
+		return
+	}
+
+	success = true
+	return
+}
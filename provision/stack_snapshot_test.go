@@ -0,0 +1,99 @@
+package provision_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/inconshreveable/log15"
+)
+
+var _ = Describe("Stack snapshot", func() {
+
+	const previousTemplate = `{"Resources":{"InetLaunchConfiguration":{"Metadata":{"PorterPayload":"porter-deployment/svc/prod/v1/previous.tar"}}}}`
+
+	var (
+		server      *httptest.Server
+		forms       []url.Values
+		roleSession *session.Session
+	)
+
+	BeforeEach(func() {
+		forms = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.ParseForm()).To(Succeed())
+			forms = append(forms, r.PostForm)
+
+			switch r.PostForm.Get("Action") {
+			case "DescribeStacks":
+				w.Write([]byte(`<DescribeStacksResponse><DescribeStacksResult><Stacks><member>
+					<StackId>stack-id</StackId>
+					<StackName>svc-prod</StackName>
+					<StackStatus>UPDATE_COMPLETE</StackStatus>
+					<Parameters><member><ParameterKey>PorterSecretsLoc</ParameterKey><ParameterValue>previous-secrets</ParameterValue></member></Parameters>
+					<Tags><member><Key>porter-service-version</Key><Value>v1</Value></member></Tags>
+				</member></Stacks></DescribeStacksResult></DescribeStacksResponse>`))
+			case "GetTemplate":
+				w.Write([]byte(`<GetTemplateResponse><GetTemplateResult><TemplateBody>` + previousTemplate +
+					`</TemplateBody></GetTemplateResult></GetTemplateResponse>`))
+			case "UpdateStack":
+				w.Write([]byte(`<UpdateStackResponse><UpdateStackResult><StackId>stack-id</StackId></UpdateStackResult></UpdateStackResponse>`))
+			}
+		}))
+
+		roleSession = session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("restores the metadata and parameters new instances boot from", func() {
+		log := log15.New()
+		log.SetHandler(log15.DiscardHandler())
+
+		snapshot, ok := provision.SnapshotStack(log, roleSession, "stack-id")
+		Expect(ok).To(BeTrue())
+		Expect(snapshot.TemplateBody).To(Equal(previousTemplate))
+
+		environment := &conf.Environment{
+			Name:       "prod",
+			CFNRoleARN: "arn:aws:iam::123456789012:role/cfn",
+			Regions:    []*conf.Region{{Name: "us-west-2"}},
+		}
+		config := &conf.Config{
+			ServiceName:  "svc",
+			Environments: []*conf.Environment{environment},
+		}
+
+		forms = nil
+		Expect(provision.RestoreStack(context.Background(), log, config, environment, "us-west-2",
+			roleSession, snapshot)).To(BeTrue())
+
+		Expect(forms).To(HaveLen(2))
+		Expect(forms[0].Get("Action")).To(Equal("UpdateStack"))
+		Expect(forms[0].Get("StackName")).To(Equal("stack-id"))
+		Expect(forms[0].Get("TemplateBody")).To(Equal(previousTemplate))
+		Expect(forms[0].Get("Parameters.member.1.ParameterKey")).To(Equal("PorterSecretsLoc"))
+		Expect(forms[0].Get("Parameters.member.1.ParameterValue")).To(Equal("previous-secrets"))
+		Expect(forms[0].Get("Tags.member.1.Value")).To(Equal("v1"))
+		Expect(forms[0].Get("RoleARN")).To(Equal("arn:aws:iam::123456789012:role/cfn"))
+
+		// waits for the update to complete
+		Expect(forms[1].Get("Action")).To(Equal("DescribeStacks"))
+	})
+})
@@ -0,0 +1,89 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/inconshreveable/log15"
+)
+
+// GetStateStore returns the config's state_store or the local store if there
+// isn't one
+func GetStateStore(config *conf.Config) provision_state.Store {
+	if config.StateStore == nil {
+		return &provision_state.FileStore{
+			Dir: constants.StateStoreDir,
+		}
+	}
+
+	storeSession := aws_session.Get(config.StateStore.Region)
+	if config.StateStore.RoleARN != "" {
+		storeSession = aws_session.STS(config.StateStore.Region, config.StateStore.RoleARN, 0)
+	}
+
+	return provision_state.NewDynamoDBStore(storeSession, config.StateStore.DynamoDBTable)
+}
+
+// RecordDeployment puts a deployment in the store. The deploy itself doesn't
+// depend on the store so failing to record it is only a warning
+func RecordDeployment(log log15.Logger, store provision_state.Store, deployment *provision_state.Deployment) {
+	deployment.UpdatedAt = time.Now().UTC()
+
+	err := store.Put(deployment)
+	if err != nil {
+		log.Warn("Failed to record deployment", "Status", deployment.Status, "Error", err)
+		return
+	}
+
+	log.Debug("Recorded deployment", "Status", deployment.Status)
+}
+
+// NewLock describes who is deploying the environment from here so whoever is
+// blocked by the lock can tell if it's stale
+func NewLock(config *conf.Config, environment string) *provision_state.Lock {
+	host, _ := os.Hostname()
+
+	owner := os.Getenv("USER")
+	if currentUser, err := user.Current(); owner == "" && err == nil {
+		owner = currentUser.Username
+	}
+
+	// not every build box deploys from a git clone
+	var gitSHA string
+	if revParseOutput, err := exec.Command("git", "rev-parse", "HEAD").Output(); err == nil {
+		gitSHA = strings.TrimSpace(string(revParseOutput))
+	}
+
+	now := time.Now().UTC()
+
+	return &provision_state.Lock{
+		Id:             fmt.Sprintf("%s-%d-%d", host, os.Getpid(), now.UnixNano()),
+		ServiceName:    config.ServiceName,
+		Environment:    environment,
+		Owner:          owner,
+		Host:           host,
+		Command:        strings.Join(os.Args, " "),
+		GitSHA:         gitSHA,
+		ServiceVersion: config.ServiceVersion,
+		AcquiredAt:     now,
+	}
+}
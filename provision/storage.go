@@ -0,0 +1,92 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"github.com/adobe-platform/porter/cfn_template"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+)
+
+// blockDeviceMappings are the launch template's EBS volumes of the
+// environment's storage block. The root volume is only mapped when it's
+// configured so the AMI's is used otherwise
+func (recv *stackCreator) blockDeviceMappings() []interface{} {
+	storage := recv.environment.Storage
+
+	mappings := make([]interface{}, 0)
+
+	if storage.RootVolume != nil {
+		mappings = append(mappings, blockDeviceMapping(storage, storage.RootVolume))
+	}
+
+	for _, volume := range storage.DataVolumes {
+		mappings = append(mappings, blockDeviceMapping(storage, &volume.EBSVolume))
+	}
+
+	return mappings
+}
+
+func blockDeviceMapping(storage *conf.Storage, volume *conf.EBSVolume) map[string]interface{} {
+	ebs := map[string]interface{}{
+		"VolumeType":          volume.Type,
+		"DeleteOnTermination": true,
+	}
+
+	if volume.Size > 0 {
+		ebs["VolumeSize"] = volume.Size
+	}
+
+	if volume.Iops > 0 {
+		ebs["Iops"] = volume.Iops
+	}
+
+	if volume.Throughput > 0 {
+		ebs["Throughput"] = volume.Throughput
+	}
+
+	if storage.Encrypted {
+		ebs["Encrypted"] = true
+
+		// the account's default EBS key is used otherwise
+		if storage.KmsKeyId != "" {
+			ebs["KmsKeyId"] = storage.KmsKeyId
+		}
+	}
+
+	return map[string]interface{}{
+		"DeviceName": volume.Device,
+		"Ebs":        ebs,
+	}
+}
+
+// storage is the data volumes and file system the instances mount while they
+// boot
+func (recv *stackCreator) storage() (storage cfn_template.Storage) {
+	if recv.region.EFS != nil {
+		storage.FileSystemId = recv.fileSystemImport(fileSystemIdOutput)
+		storage.FileSystemOwner = constants.ContainerUserUid
+	}
+
+	if recv.environment.Storage == nil {
+		return
+	}
+
+	for _, volume := range recv.environment.Storage.DataVolumes {
+		storage.DataVolumes = append(storage.DataVolumes, cfn_template.DataVolume{
+			Device:     volume.Device,
+			MountPath:  volume.MountPath,
+			FileSystem: volume.FileSystem,
+		})
+	}
+	return
+}
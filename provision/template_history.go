@@ -0,0 +1,118 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/adobe-platform/porter/artifact_store"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/inconshreveable/log15"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// recordTemplateHistory keeps the template and the config it was generated
+// from for every stack created or updated under
+//
+//	porter-history/<service>/<environment>/<version>/<time>/
+//
+// The deploy already happened so failing to record it is only a warning
+func (recv *stackCreator) recordTemplateHistory(templateBytes []byte, stackId string) {
+
+	configBytes, err := yaml.Marshal(recv.config)
+	if err != nil {
+		recv.log.Warn("Template history yaml.Marshal", "Error", err)
+		return
+	}
+
+	keyRoot := fmt.Sprintf("%s/%s", recv.s3KeyRoot(s3KeyOptHistory), time.Now().UTC().Format("20060102T150405Z"))
+
+	for _, object := range []artifact_store.Object{
+		{Key: keyRoot + "/template.json", Body: templateBytes, ContentType: "application/json"},
+		{Key: keyRoot + "/config.yaml", Body: configBytes, ContentType: "application/x-yaml"},
+	} {
+		object.Metadata = map[string]string{"stack-id": stackId}
+
+		err = recv.artifactStore.Put(object)
+		if err != nil {
+			recv.log.Warn("Failed to record template history", "S3key", object.Key, "Error", err)
+			return
+		}
+	}
+
+	recv.log.Info("Recorded template history", "S3key", keyRoot)
+}
+
+// RenderTemplate creates the template provision would deploy to a region
+// without uploading anything. The service payload from porter build pack is
+// used if it exists. Otherwise its key in the template is a placeholder
+func RenderTemplate(log log15.Logger, config *conf.Config, environment *conf.Environment,
+	region *conf.Region, roleSession *session.Session) (templateBytes []byte, success bool) {
+
+	checksum := "SERVICE_PAYLOAD_CHECKSUM"
+
+	payloadBytes, err := ioutil.ReadFile(constants.PayloadPath)
+	if err == nil {
+		checksumArray := sha256.Sum256(payloadBytes)
+		checksum = hex.EncodeToString(checksumArray[:])
+	} else {
+		log.Warn("No service payload. Run porter build pack first to render its key", "Path", constants.PayloadPath)
+	}
+
+	return RenderPayloadTemplate(log, config, environment, region, roleSession, checksum)
+}
+
+// RenderPayloadTemplate is RenderTemplate for the service payload with the
+// checksum, such as the one already deployed
+func RenderPayloadTemplate(log log15.Logger, config *conf.Config, environment *conf.Environment,
+	region *conf.Region, roleSession *session.Session, checksum string) (templateBytes []byte, success bool) {
+
+	// rendered as an update of the region's latest stack so its color matches
+	deployment := &provision_state.Deployment{
+		StackColor: provision_state.StackColorBlue,
+	}
+
+	previous, err := GetStateStore(config).Get(config.ServiceName, environment.Name, region.Name)
+	if err != nil {
+		log.Warn("State store Get", "Error", err)
+	}
+	if previous != nil {
+		deployment.StackName = previous.StackName
+		deployment.StackColor = provision_state.NextStackColor(previous, previous.StackName)
+	}
+
+	recv := &stackCreator{
+		log: log,
+
+		config:      *config,
+		environment: *environment,
+		region:      *region,
+
+		roleSession: roleSession,
+
+		deployment: deployment,
+
+		templateTransforms: make(map[string][]MapResource),
+	}
+
+	recv.setServicePayloadChecksum(checksum)
+
+	templateBytes, success = recv.createTemplate()
+	return
+}
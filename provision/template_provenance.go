@@ -0,0 +1,181 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/adobe-platform/porter/constants"
+	"github.com/aws/aws-sdk-go/aws"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/inconshreveable/log15"
+)
+
+// TemplateProvenance is what rendered a template. It's kept in the template's
+// metadata so an update can check it's not about to clobber another service's
+// stack or undo a newer porter's template
+type TemplateProvenance struct {
+	ServiceName   string `json:"ServiceName"`
+	PorterVersion string `json:"PorterVersion"`
+}
+
+type strictProvenanceKey struct{}
+
+// templates rendered before provenance was kept in the metadata only have it
+// in the description
+var provenanceDescriptionRegex = regexp.MustCompile(`^(.+) \(powered by porter (.+)\)$`)
+
+// WithStrictProvenance makes UpdateStack refuse to update a stack whose
+// template provenance doesn't match instead of warning
+func WithStrictProvenance(ctx context.Context, strict bool) context.Context {
+	return context.WithValue(ctx, strictProvenanceKey{}, strict)
+}
+
+func strictProvenance(ctx context.Context) bool {
+	strict, _ := ctx.Value(strictProvenanceKey{}).(bool)
+	return strict
+}
+
+// ParseTemplateProvenance reads the provenance out of a deployed template. It's
+// nil if the template wasn't rendered by porter
+func ParseTemplateProvenance(templateBody []byte) (*TemplateProvenance, error) {
+	var template struct {
+		Description string
+		Metadata    map[string]json.RawMessage
+	}
+
+	err := json.Unmarshal(templateBody, &template)
+	if err != nil {
+		return nil, err
+	}
+
+	if rawProvenance, exists := template.Metadata[constants.MetadataPorter]; exists {
+		provenance := &TemplateProvenance{}
+		err = json.Unmarshal(rawProvenance, provenance)
+		if err != nil {
+			return nil, err
+		}
+		return provenance, nil
+	}
+
+	if matches := provenanceDescriptionRegex.FindStringSubmatch(template.Description); matches != nil {
+		return &TemplateProvenance{
+			ServiceName:   matches[1],
+			PorterVersion: matches[2],
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// ProvenanceMismatches describes why a stack deployed with the given
+// provenance shouldn't be updated by this service and porter version
+func ProvenanceMismatches(deployed TemplateProvenance, serviceName, porterVersion string) []string {
+	mismatches := make([]string, 0)
+
+	if deployed.ServiceName != serviceName {
+		mismatches = append(mismatches, fmt.Sprintf("the stack belongs to service %s, not %s",
+			deployed.ServiceName, serviceName))
+	}
+
+	if porterVersionLess(porterVersion, deployed.PorterVersion) {
+		mismatches = append(mismatches, fmt.Sprintf("the stack was last updated by porter %s which is newer than %s",
+			deployed.PorterVersion, porterVersion))
+	}
+
+	return mismatches
+}
+
+// porterVersionLess compares release versions like v4.2.0. Development builds
+// aren't ordered so they're never less
+func porterVersionLess(a, b string) bool {
+	aParts, aOk := parsePorterVersion(a)
+	bParts, bOk := parsePorterVersion(b)
+	if !aOk || !bOk {
+		return false
+	}
+
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		if aParts[i] != bParts[i] {
+			return aParts[i] < bParts[i]
+		}
+	}
+
+	return len(aParts) < len(bParts)
+}
+
+func parsePorterVersion(version string) (parts []int, ok bool) {
+	for _, part := range strings.Split(strings.TrimPrefix(version, "v"), ".") {
+		i, err := strconv.Atoi(part)
+		if err != nil {
+			return
+		}
+		parts = append(parts, i)
+	}
+
+	ok = true
+	return
+}
+
+// checkTemplateProvenance compares the deployed stack's provenance with this
+// deploy's before it's updated. Mismatches are warnings unless the context is
+// strict
+func checkTemplateProvenance(ctx context.Context, log log15.Logger, client *cfnlib.CloudFormation,
+	stackId, serviceName string) (success bool) {
+
+	getTemplateOutput, err := client.GetTemplate(&cfnlib.GetTemplateInput{
+		StackName: aws.String(stackId),
+	})
+	if err != nil {
+		log.Error("cloudformation:GetTemplate", "Error", err)
+		return
+	}
+
+	provenance, err := ParseTemplateProvenance([]byte(aws.StringValue(getTemplateOutput.TemplateBody)))
+	if err != nil {
+		log.Error("ParseTemplateProvenance", "Error", err)
+		return
+	}
+
+	if provenance == nil {
+		log.Warn("The deployed template has no porter provenance", "StackId", stackId)
+		success = !strictProvenance(ctx)
+		return
+	}
+
+	mismatches := ProvenanceMismatches(*provenance, serviceName, constants.Version)
+	if len(mismatches) == 0 {
+		success = true
+		return
+	}
+
+	for _, mismatch := range mismatches {
+		if strictProvenance(ctx) {
+			log.Error("Template provenance mismatch", "StackId", stackId, "Mismatch", mismatch)
+		} else {
+			log.Warn("Template provenance mismatch", "StackId", stackId, "Mismatch", mismatch)
+		}
+	}
+
+	if strictProvenance(ctx) {
+		log.Error("Refusing to update the stack. Run without --strict-provenance to update it anyway")
+		return
+	}
+
+	success = true
+	return
+}
@@ -0,0 +1,64 @@
+package provision_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/provision"
+)
+
+var _ = Describe("Template provenance", func() {
+
+	It("reads provenance from the template's metadata", func() {
+		provenance, err := provision.ParseTemplateProvenance([]byte(`{
+			"Description": "other (powered by porter v1.0.0)",
+			"Metadata": {"Porter": {"ServiceName": "svc", "PorterVersion": "v4.2.0"}}
+		}`))
+		Expect(err).To(BeNil())
+		Expect(*provenance).To(Equal(provision.TemplateProvenance{
+			ServiceName:   "svc",
+			PorterVersion: "v4.2.0",
+		}))
+	})
+
+	It("falls back to the template's description", func() {
+		provenance, err := provision.ParseTemplateProvenance([]byte(`{
+			"Description": "svc (powered by porter v3.1.0)"
+		}`))
+		Expect(err).To(BeNil())
+		Expect(provenance.ServiceName).To(Equal("svc"))
+		Expect(provenance.PorterVersion).To(Equal("v3.1.0"))
+	})
+
+	It("has no provenance for templates porter didn't render", func() {
+		provenance, err := provision.ParseTemplateProvenance([]byte(`{"Description": "hand made"}`))
+		Expect(err).To(BeNil())
+		Expect(provenance).To(BeNil())
+	})
+
+	It("flags a different service", func() {
+		mismatches := provision.ProvenanceMismatches(provision.TemplateProvenance{
+			ServiceName:   "other",
+			PorterVersion: "v4.2.0",
+		}, "svc", "v4.2.0")
+		Expect(mismatches).To(HaveLen(1))
+	})
+
+	It("flags a newer porter", func() {
+		deployed := provision.TemplateProvenance{
+			ServiceName:   "svc",
+			PorterVersion: "v4.10.0",
+		}
+		Expect(provision.ProvenanceMismatches(deployed, "svc", "v4.9.1")).To(HaveLen(1))
+		Expect(provision.ProvenanceMismatches(deployed, "svc", "v4.10.0")).To(BeEmpty())
+		Expect(provision.ProvenanceMismatches(deployed, "svc", "v5.0.0")).To(BeEmpty())
+	})
+
+	It("doesn't order development builds", func() {
+		deployed := provision.TemplateProvenance{
+			ServiceName:   "svc",
+			PorterVersion: "v4.2.0",
+		}
+		Expect(provision.ProvenanceMismatches(deployed, "svc", "vsomeone")).To(BeEmpty())
+	})
+})
@@ -0,0 +1,185 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// ValidateTemplate only accepts a TemplateBody this big. Larger templates are
+// validated by URL once they're uploaded
+const validateTemplateBodyMax = 51200
+
+// TemplateRuleViolations checks a template against an environment's
+// template_rules. Every violation is returned so they can be fixed at once
+func TemplateRuleViolations(rules *conf.TemplateRules, template *cfn.Template) []string {
+	violations := make([]string, 0)
+
+	if rules == nil {
+		return violations
+	}
+
+	logicalNames := make([]string, 0, len(template.Resources))
+	for logicalName := range template.Resources {
+		logicalNames = append(logicalNames, logicalName)
+	}
+	sort.Strings(logicalNames)
+
+	for _, logicalName := range logicalNames {
+
+		resource, ok := template.Resources[logicalName].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		resourceType, _ := resource["Type"].(string)
+		props, _ := resource["Properties"].(map[string]interface{})
+
+		// resources that can't be tagged don't declare Tags
+		if tags, ok := props["Tags"].([]interface{}); ok {
+			for _, key := range missingTags(rules.RequiredTags, tags) {
+				violations = append(violations,
+					fmt.Sprintf("%s (%s) is missing required tag %s", logicalName, resourceType, key))
+			}
+		}
+
+		for _, instanceType := range resourceInstanceTypes(resourceType, props) {
+			for _, pattern := range rules.ForbiddenInstanceTypes {
+				if matched, _ := path.Match(pattern, instanceType); matched {
+					violations = append(violations,
+						fmt.Sprintf("%s (%s) uses instance type %s which is forbidden by %s",
+							logicalName, resourceType, instanceType, pattern))
+				}
+			}
+		}
+	}
+
+	return violations
+}
+
+func missingTags(requiredTags []string, tags []interface{}) []string {
+	missing := make([]string, 0)
+
+	for _, requiredTag := range requiredTags {
+
+		found := false
+		for _, tag := range tags {
+			if msi, ok := tag.(map[string]interface{}); ok && msi["Key"] == requiredTag {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			missing = append(missing, requiredTag)
+		}
+	}
+
+	return missing
+}
+
+// resourceInstanceTypes returns the literal instance types a resource
+// launches. Intrinsic functions can't be resolved before the stack exists so
+// they're skipped
+func resourceInstanceTypes(resourceType string, props map[string]interface{}) []string {
+	instanceTypes := make([]string, 0)
+
+	switch resourceType {
+	case cfn.EC2_Instance, cfn.AutoScaling_LaunchConfiguration:
+
+		if instanceType, ok := props["InstanceType"].(string); ok {
+			instanceTypes = append(instanceTypes, instanceType)
+		}
+
+	case cfn.EC2_LaunchTemplate:
+
+		if data, ok := props["LaunchTemplateData"].(map[string]interface{}); ok {
+			if instanceType, ok := data["InstanceType"].(string); ok {
+				instanceTypes = append(instanceTypes, instanceType)
+			}
+		}
+
+	case cfn.AutoScaling_AutoScalingGroup:
+
+		mixed, _ := props["MixedInstancesPolicy"].(map[string]interface{})
+		launchTemplate, _ := mixed["LaunchTemplate"].(map[string]interface{})
+
+		if overrides, ok := launchTemplate["Overrides"].([]interface{}); ok {
+			for _, override := range overrides {
+				if msi, ok := override.(map[string]interface{}); ok {
+					if instanceType, ok := msi["InstanceType"].(string); ok {
+						instanceTypes = append(instanceTypes, instanceType)
+					}
+				}
+			}
+		}
+	}
+
+	return instanceTypes
+}
+
+func (recv *stackCreator) checkTemplateRules(template *cfn.Template) (success bool) {
+
+	violations := TemplateRuleViolations(recv.environment.TemplateRules, template)
+	if len(violations) == 0 {
+		success = true
+		return
+	}
+
+	for _, violation := range violations {
+		recv.log.Error("Template rule violation", "Violation", violation)
+	}
+	recv.log.Error("Fix the stack definition or template_rules of the environment",
+		"Environment", recv.environment.Name)
+	return
+}
+
+// validateTemplate calls cloudformation:ValidateTemplate so a malformed
+// template fails now instead of as CREATE_FAILED or UPDATE_ROLLBACK_COMPLETE
+// minutes later. Exactly one of templateBytes and templateUrl is used
+func (recv *stackCreator) validateTemplate(templateBytes []byte, templateUrl string) (success bool) {
+
+	input := &cfnlib.ValidateTemplateInput{}
+	if templateUrl == "" {
+		input.TemplateBody = aws.String(string(templateBytes))
+	} else {
+		input.TemplateURL = aws.String(templateUrl)
+	}
+
+	recv.log.Info("cloudformation:ValidateTemplate")
+	_, err := cloudformation.New(recv.roleSession).ValidateTemplate(input)
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "ValidationError" {
+			recv.log.Error("CloudFormation rejected the template",
+				"Reason", strings.TrimSpace(awsErr.Message()),
+				"Path", constants.CloudFormationTemplatePath)
+			return
+		}
+
+		recv.log.Error("cloudformation:ValidateTemplate", "Error", err)
+		return
+	}
+
+	success = true
+	return
+}
@@ -0,0 +1,89 @@
+package provision_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"encoding/json"
+
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/provision"
+)
+
+var _ = Describe("Template rules", func() {
+
+	var template *cfn.Template
+
+	BeforeEach(func() {
+		template = cfn.NewTemplate()
+		err := json.Unmarshal([]byte(`{
+			"Resources": {
+				"ASG": {
+					"Type": "AWS::AutoScaling::AutoScalingGroup",
+					"Properties": {
+						"Tags": [{"Key": "Owner", "Value": "team"}],
+						"MixedInstancesPolicy": {
+							"LaunchTemplate": {
+								"Overrides": [{"InstanceType": "m5.large"}, {"InstanceType": "t2.micro"}]
+							}
+						}
+					}
+				},
+				"LT": {
+					"Type": "AWS::EC2::LaunchTemplate",
+					"Properties": {
+						"LaunchTemplateData": {"InstanceType": {"Ref": "InstanceType"}}
+					}
+				},
+				"Bucket": {
+					"Type": "AWS::S3::Bucket",
+					"Properties": {"Tags": []}
+				},
+				"Handle": {
+					"Type": "AWS::CloudFormation::WaitConditionHandle"
+				}
+			}
+		}`), template)
+		Expect(err).To(BeNil())
+		template.ParseResources()
+	})
+
+	It("passes without rules", func() {
+		Expect(provision.TemplateRuleViolations(nil, template)).To(BeEmpty())
+	})
+
+	It("reports every violation", func() {
+		rules := &conf.TemplateRules{
+			RequiredTags:           []string{"Owner", "CostCenter"},
+			ForbiddenInstanceTypes: []string{"t2.*"},
+		}
+
+		Expect(provision.TemplateRuleViolations(rules, template)).To(Equal([]string{
+			"ASG (AWS::AutoScaling::AutoScalingGroup) is missing required tag CostCenter",
+			"ASG (AWS::AutoScaling::AutoScalingGroup) uses instance type t2.micro which is forbidden by t2.*",
+			"Bucket (AWS::S3::Bucket) is missing required tag Owner",
+			"Bucket (AWS::S3::Bucket) is missing required tag CostCenter",
+		}))
+	})
+})
+
+var _ = Describe("Guard rules", func() {
+
+	It("finds the rules cfn-guard failed", func() {
+		output := `template.json Status = FAIL
+FAILED rules
+S3_BUCKET_VERSIONING_ENABLED    FAIL
+required_tags    FAIL
+---
+SKIPPED rules
+ec2_no_public_ip    SKIP
+`
+		Expect(provision.GuardRuleFailures(output)).
+			To(Equal([]string{"S3_BUCKET_VERSIONING_ENABLED", "required_tags"}))
+	})
+
+	It("returns nothing when every rule passed", func() {
+		Expect(provision.GuardRuleFailures("template.json Status = PASS\n")).To(BeEmpty())
+	})
+})
@@ -0,0 +1,239 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/aws/aws-sdk-go/aws"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+const (
+	certificateLogicalName = "Certificate"
+	certificateOutput      = "CertificateArn"
+
+	sslNegotiationPolicyName = "PorterSSLNegotiationPolicy"
+)
+
+// sslCertificateARN is the certificate of the HTTPS listeners. It's empty if
+// the region has none
+func (recv *stackCreator) sslCertificateARN() string {
+	tls := recv.region.TLS
+	switch {
+	case tls == nil:
+		return recv.region.SSLCertARN
+	case tls.RequestsCertificate():
+		return recv.certificateARN
+	default:
+		return tls.CertificateARN
+	}
+}
+
+// ensureCertificateStack creates the region's CertificateStackName the first
+// time the service is deployed with a tls domain_name and updates it when
+// the names change. ACM's DNS validation records are created in the
+// hosted_zone_id so this waits for the certificate to be issued
+//
+// A replaced certificate is retained because the stacks that haven't been
+// pruned still use it
+func (recv *stackCreator) ensureCertificateStack() (success bool) {
+	tls := recv.region.TLS
+	if tls == nil || !tls.RequestsCertificate() {
+		success = true
+		return
+	}
+
+	stackName := conf.CertificateStackName(recv.config.ServiceName, recv.environment.Name)
+	log := recv.log.New("StackName", stackName, "DomainName", tls.DomainName)
+
+	client := cloudformation.New(recv.roleSession)
+
+	names := append([]string{tls.DomainName}, tls.SubjectAlternativeNames...)
+	validationOptions := make([]interface{}, 0)
+	for _, name := range names {
+		validationOptions = append(validationOptions, map[string]interface{}{
+			"DomainName":   name,
+			"HostedZoneId": tls.HostedZoneId,
+		})
+	}
+
+	properties := map[string]interface{}{
+		"DomainName":              tls.DomainName,
+		"ValidationMethod":        "DNS",
+		"DomainValidationOptions": validationOptions,
+	}
+	if len(tls.SubjectAlternativeNames) > 0 {
+		properties["SubjectAlternativeNames"] = tls.SubjectAlternativeNames
+	}
+
+	template := cfn.NewTemplate()
+	template.Description = "porter managed certificate for " + recv.config.ServiceName + " " + recv.environment.Name
+	template.SetResource(certificateLogicalName, map[string]interface{}{
+		"Type":                cfn.CertificateManager_Certificate,
+		"UpdateReplacePolicy": "Retain",
+		"Properties":          properties,
+	})
+	template.Outputs = map[string]interface{}{
+		certificateOutput: map[string]interface{}{
+			"Value": map[string]interface{}{"Ref": certificateLogicalName},
+		},
+	}
+
+	templateBytes, err := json.Marshal(template)
+	if err != nil {
+		log.Error("json.Marshal", "Error", err)
+		return
+	}
+
+	cfnRoleARN, err := recv.environment.GetCFNRoleARN(recv.region.Name)
+	if err != nil {
+		log.Error("GetCFNRoleARN", "Error", err)
+		return
+	}
+
+	describeInput := &cfnlib.DescribeStacksInput{
+		StackName: aws.String(stackName),
+	}
+
+	_, exists, err := describeCertificateStack(client, stackName)
+	switch {
+	case err != nil:
+		log.Error("DescribeStack", "Error", err)
+		return
+
+	case !exists:
+		log.Info("Requesting the certificate. This waits for ACM to validate it")
+		_, err = cloudformation.CreateStackWithBody(client, stackName, string(templateBytes), cfnRoleARN)
+		if err == cloudformation.ErrAudited {
+			success = true
+			return
+		}
+		if err != nil {
+			log.Error("CreateStack", "Error", err)
+			return
+		}
+
+		err = client.WaitUntilStackCreateComplete(describeInput)
+		if err != nil {
+			log.Error("WaitUntilStackCreateComplete", "Error", err)
+			return
+		}
+
+	default:
+		err = cloudformation.UpdateStackWithBody(client, stackName, string(templateBytes), cfnRoleARN)
+		if err != nil && !strings.Contains(err.Error(), "No updates are to be performed") {
+			log.Error("UpdateStack", "Error", err)
+			return
+		}
+
+		if err == nil {
+			log.Info("Requesting a certificate for the changed names. This waits for ACM to validate it")
+			err = client.WaitUntilStackUpdateComplete(describeInput)
+			if err != nil {
+				log.Error("WaitUntilStackUpdateComplete", "Error", err)
+				return
+			}
+		}
+	}
+
+	success = recv.resolveCertificate()
+	return
+}
+
+// resolveCertificate reads the ARN of the certificate requested for the tls
+// domain_name
+func (recv *stackCreator) resolveCertificate() (success bool) {
+	tls := recv.region.TLS
+	if tls == nil || !tls.RequestsCertificate() || recv.certificateARN != "" {
+		success = true
+		return
+	}
+
+	stackName := conf.CertificateStackName(recv.config.ServiceName, recv.environment.Name)
+
+	certificateARN, exists, err := describeCertificateStack(cloudformation.New(recv.roleSession), stackName)
+	if err != nil {
+		recv.log.Error("DescribeStack", "StackName", stackName, "Error", err)
+		return
+	}
+
+	if !exists || certificateARN == "" {
+		recv.log.Error("The certificate hasn't been requested yet. The first deploy with tls domain_name requests it",
+			"StackName", stackName)
+		return
+	}
+
+	recv.certificateARN = certificateARN
+	success = true
+	return
+}
+
+func describeCertificateStack(client *cfnlib.CloudFormation, stackName string) (certificateARN string, exists bool, err error) {
+	output, err := cloudformation.DescribeStack(client, stackName)
+	if err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			err = nil
+		}
+		return
+	}
+
+	exists = true
+	for _, stack := range output.Stacks {
+		if stack == nil {
+			continue
+		}
+
+		for _, output := range stack.Outputs {
+			if output != nil && aws.StringValue(output.OutputKey) == certificateOutput {
+				certificateARN = aws.StringValue(output.OutputValue)
+			}
+		}
+	}
+	return
+}
+
+// setSslPolicy sets the tls security_policy on an ALB's HTTPS listener.
+// Without tls the listener keeps the ALB's default
+func (recv *stackCreator) setSslPolicy(listenerProperties map[string]interface{}) {
+	if recv.region.TLS != nil {
+		listenerProperties["SslPolicy"] = recv.region.TLS.SecurityPolicy
+	}
+}
+
+// redirectHTTP is true if HTTP requests are redirected to HTTPS
+func (recv *stackCreator) redirectHTTP() bool {
+	return recv.region.TLS != nil && recv.region.TLS.RedirectHTTP
+}
+
+// httpListenerActions are the DefaultActions of an ALB's HTTP listener. They
+// forward to the target group unless HTTP is redirected to HTTPS
+func (recv *stackCreator) httpListenerActions(targetGroup string) []interface{} {
+	if !recv.redirectHTTP() {
+		return routeForwardActions(targetGroup)
+	}
+
+	return []interface{}{
+		map[string]interface{}{
+			"Type": "redirect",
+			"RedirectConfig": map[string]interface{}{
+				"Protocol":   "HTTPS",
+				"Port":       "443",
+				"StatusCode": "HTTP_301",
+			},
+		},
+	}
+}
@@ -0,0 +1,106 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision
+
+import (
+	"sync"
+
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/inconshreveable/log15"
+)
+
+type (
+	// TransformContext is the part of the stack being provisioned that a
+	// registered Transform can see
+	TransformContext struct {
+		Log log15.Logger
+
+		Config      conf.Config
+		Environment conf.Environment
+		Region      conf.Region
+	}
+
+	// Transform operates on the input resource like MapResource but can be
+	// written outside of this package
+	Transform func(TransformContext, *cfn.Template, map[string]interface{}) bool
+)
+
+var (
+	transformsLock sync.RWMutex
+	transforms     = make(map[string][]Transform)
+)
+
+// RegisterTransform adds a Transform that runs on every resource of the given
+// type after porter's own transforms
+func RegisterTransform(resourceType string, fn Transform) {
+	if !cfn.ValidType(resourceType) {
+		panic("invariant violation: unknown resource type " + resourceType)
+	}
+
+	transformsLock.Lock()
+	defer transformsLock.Unlock()
+
+	transforms[resourceType] = append(transforms[resourceType], fn)
+}
+
+// RegisteredTransforms returns a copy of the registered transforms keyed by
+// resource type
+func RegisteredTransforms() map[string][]Transform {
+	transformsLock.RLock()
+	defer transformsLock.RUnlock()
+
+	registered := make(map[string][]Transform)
+	for resourceType, fns := range transforms {
+		registered[resourceType] = append([]Transform{}, fns...)
+	}
+	return registered
+}
+
+// ApplyTransforms runs the transforms on every resource of the matching type
+// and stops at the first one that fails
+func ApplyTransforms(ctx TransformContext, template *cfn.Template, ops map[string][]Transform) (success bool) {
+
+	for _, resourceRaw := range template.Resources {
+
+		if resource, ok := resourceRaw.(map[string]interface{}); ok {
+
+			if resourceType, ok := resource["Type"].(string); ok {
+
+				for _, fn := range ops[resourceType] {
+					if !fn(ctx, template, resource) {
+						return
+					}
+				}
+			}
+		}
+	}
+
+	success = true
+	return
+}
+
+func (recv *stackCreator) transformContext() TransformContext {
+	return TransformContext{
+		Log: recv.log,
+
+		Config:      recv.config,
+		Environment: recv.environment,
+		Region:      recv.region,
+	}
+}
+
+func wrapTransform(fn Transform) MapResource {
+	return func(recv *stackCreator, template *cfn.Template, resource map[string]interface{}) bool {
+		return fn(recv.transformContext(), template, resource)
+	}
+}
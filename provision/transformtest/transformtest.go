@@ -0,0 +1,123 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+
+// Package transformtest runs transforms registered with
+// provision.RegisterTransform against fixture templates so they can be tested
+// without provisioning anything
+package transformtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/inconshreveable/log15"
+)
+
+// LoadTemplate reads a fixture template the same way porter reads a custom
+// stack definition
+func LoadTemplate(path string) (*cfn.Template, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	template := cfn.NewTemplate()
+
+	err = json.NewDecoder(file).Decode(template)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	template.ParseResources()
+
+	return template, nil
+}
+
+// NewContext builds the context a transform sees when porter provisions the
+// environment and region of config
+func NewContext(config *conf.Config, environmentName, regionName string) (ctx provision.TransformContext, err error) {
+	environment, err := config.GetEnvironment(environmentName)
+	if err != nil {
+		return
+	}
+
+	region, err := environment.GetRegion(regionName)
+	if err != nil {
+		return
+	}
+
+	ctx = provision.TransformContext{
+		Log: log15.New("Environment", environmentName, "Region", regionName),
+
+		Config:      *config,
+		Environment: *environment,
+		Region:      *region,
+	}
+	return
+}
+
+// Run loads a fixture template and applies every registered transform to it
+func Run(ctx provision.TransformContext, fixturePath string) (*cfn.Template, error) {
+	return RunTransforms(ctx, fixturePath, provision.RegisteredTransforms())
+}
+
+// RunTransforms loads a fixture template and applies only the given transforms
+// to it
+func RunTransforms(ctx provision.TransformContext, fixturePath string,
+	ops map[string][]provision.Transform) (*cfn.Template, error) {
+
+	template, err := LoadTemplate(fixturePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !provision.ApplyTransforms(ctx, template, ops) {
+		return nil, fmt.Errorf("a transform failed on %s", fixturePath)
+	}
+
+	return template, nil
+}
+
+// Resource returns the resource with the given logical name
+func Resource(template *cfn.Template, logicalName string) (map[string]interface{}, error) {
+	resource, ok := template.Resources[logicalName].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("resource %s doesn't exist", logicalName)
+	}
+	return resource, nil
+}
+
+// Property follows path through the Properties of a resource
+//
+// Property(resource, "HealthCheck", "Target") returns the value of
+// resource["Properties"]["HealthCheck"]["Target"]
+func Property(resource map[string]interface{}, path ...string) (interface{}, bool) {
+	var value interface{} = resource["Properties"]
+
+	for _, key := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		if value, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return value, value != nil
+}
@@ -0,0 +1,89 @@
+package transformtest_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/cfn"
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/adobe-platform/porter/provision/transformtest"
+)
+
+var _ = Describe("Transform test harness", func() {
+
+	config := &conf.Config{
+		ServiceName: "sample",
+		Environments: []*conf.Environment{
+			{
+				Name: "stage",
+				Regions: []*conf.Region{
+					{Name: "us-west-2"},
+				},
+			},
+		},
+	}
+
+	setHealthCheckTarget := func(ctx provision.TransformContext, template *cfn.Template, resource map[string]interface{}) bool {
+		properties := resource["Properties"].(map[string]interface{})
+		healthCheck := properties["HealthCheck"].(map[string]interface{})
+		healthCheck["Target"] = "HTTP:8080/" + ctx.Region.Name
+		return true
+	}
+
+	It("applies transforms to resources of the matching type", func() {
+		ctx, err := transformtest.NewContext(config, "stage", "us-west-2")
+		Expect(err).To(BeNil())
+
+		template, err := transformtest.RunTransforms(ctx, "testdata/elb.json",
+			map[string][]provision.Transform{
+				cfn.ElasticLoadBalancing_LoadBalancer: {setHealthCheckTarget},
+			})
+		Expect(err).To(BeNil())
+
+		elb, err := transformtest.Resource(template, "PublicLoadBalancer")
+		Expect(err).To(BeNil())
+
+		target, ok := transformtest.Property(elb, "HealthCheck", "Target")
+		Expect(ok).To(BeTrue())
+		Expect(target).To(Equal("HTTP:8080/us-west-2"))
+
+		sg, err := transformtest.Resource(template, "InstanceSecurityGroup")
+		Expect(err).To(BeNil())
+
+		_, ok = transformtest.Property(sg, "HealthCheck")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("fails when a transform fails", func() {
+		ctx, err := transformtest.NewContext(config, "stage", "us-west-2")
+		Expect(err).To(BeNil())
+
+		fail := func(provision.TransformContext, *cfn.Template, map[string]interface{}) bool {
+			return false
+		}
+
+		_, err = transformtest.RunTransforms(ctx, "testdata/elb.json",
+			map[string][]provision.Transform{
+				cfn.EC2_SecurityGroup: {fail},
+			})
+		Expect(err).ToNot(BeNil())
+	})
+
+	It("runs registered transforms", func() {
+		provision.RegisterTransform(cfn.ElasticLoadBalancing_LoadBalancer, setHealthCheckTarget)
+
+		ctx, err := transformtest.NewContext(config, "stage", "us-west-2")
+		Expect(err).To(BeNil())
+
+		template, err := transformtest.Run(ctx, "testdata/elb.json")
+		Expect(err).To(BeNil())
+
+		elb, err := transformtest.Resource(template, "PublicLoadBalancer")
+		Expect(err).To(BeNil())
+
+		target, _ := transformtest.Property(elb, "HealthCheck", "Target")
+		Expect(target).To(Equal("HTTP:8080/us-west-2"))
+	})
+
+})
@@ -14,7 +14,7 @@ package provision
 import (
 	"errors"
 	"fmt"
-	"os/exec"
+	"os/user"
 	"strings"
 	"time"
 )
@@ -25,11 +25,16 @@ func GetStackName(serviceName, environment string, addTimestamp bool) (stackName
 		return
 	}
 
-	whoAmIBytes, err := exec.Command("whoami").Output()
+	currentUser, err := user.Current()
 	if err != nil {
 		return
 	}
-	whoAmI := strings.TrimSpace(string(whoAmIBytes))
+
+	// Windows usernames are DOMAIN\user
+	whoAmI := currentUser.Username
+	if i := strings.LastIndex(whoAmI, `\`); i != -1 {
+		whoAmI = whoAmI[i+1:]
+	}
 
 	if addTimestamp {
 		epoch := time.Now().Unix()
@@ -0,0 +1,203 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision_state
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adobe-platform/porter/aws/dynamodb"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// the range key of an environment's lock item. Its hash key is different from
+// the environment's deployments so List doesn't return it
+const dynamoDBLockRangeKey = "lock"
+
+// Lock is held by whatever is deploying a service's environment so two
+// deploys can't create or update its stacks at the same time
+type Lock struct {
+	Id             string
+	ServiceName    string
+	Environment    string
+	Owner          string
+	Host           string
+	Command        string
+	GitSHA         string
+	ServiceVersion string
+	AcquiredAt     time.Time
+}
+
+func (recv *FileStore) lockPath(serviceName, environment string) string {
+	return filepath.Join(recv.Dir, serviceName, environment+".lock")
+}
+
+func (recv *FileStore) Lock(lock *Lock) (*Lock, error) {
+	path := recv.lockPath(lock.ServiceName, lock.Environment)
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	lockBytes, err := json.Marshal(lock)
+	if err != nil {
+		return nil, err
+	}
+
+	// O_EXCL makes creating the file the lock
+	lockFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		held, err := recv.GetLock(lock.ServiceName, lock.Environment)
+		if err != nil {
+			return nil, err
+		}
+		if held != nil {
+			return held, nil
+		}
+
+		// released in between
+		return recv.Lock(lock)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer lockFile.Close()
+
+	_, err = lockFile.Write(lockBytes)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (recv *FileStore) GetLock(serviceName, environment string) (*Lock, error) {
+	lockBytes, err := ioutil.ReadFile(recv.lockPath(serviceName, environment))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &Lock{}
+	err = json.Unmarshal(lockBytes, lock)
+	if err != nil {
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+func (recv *FileStore) Unlock(lock *Lock) error {
+	held, err := recv.GetLock(lock.ServiceName, lock.Environment)
+	if err != nil {
+		return err
+	}
+
+	if held == nil || held.Id != lock.Id {
+		return nil
+	}
+
+	err = os.Remove(recv.lockPath(lock.ServiceName, lock.Environment))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func dynamoDBLockKey(serviceName, environment string) dynamodb.Item {
+	key := dynamodb.Item{}
+	key.SetString("ServiceEnvironment", dynamoDBHashKey(serviceName, environment)+"#lock")
+	key.SetString("Region", dynamoDBLockRangeKey)
+	return key
+}
+
+func (recv *DynamoDBStore) Lock(lock *Lock) (*Lock, error) {
+	lockBytes, err := json.Marshal(lock)
+	if err != nil {
+		return nil, err
+	}
+
+	item := dynamoDBLockKey(lock.ServiceName, lock.Environment)
+	item.SetString("LockId", lock.Id)
+	item.SetString("Lock", string(lockBytes))
+
+	_, err = recv.Client.PutItem(&dynamodb.PutItemInput{
+		TableName:           recv.Table,
+		Item:                item,
+		ConditionExpression: "attribute_not_exists(ServiceEnvironment)",
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailed {
+		held, err := recv.GetLock(lock.ServiceName, lock.Environment)
+		if err != nil {
+			return nil, err
+		}
+		if held != nil {
+			return held, nil
+		}
+
+		// released in between
+		return recv.Lock(lock)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (recv *DynamoDBStore) GetLock(serviceName, environment string) (*Lock, error) {
+	output, err := recv.Client.GetItem(&dynamodb.GetItemInput{
+		TableName:      recv.Table,
+		Key:            dynamoDBLockKey(serviceName, environment),
+		ConsistentRead: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if output.Item == nil {
+		return nil, nil
+	}
+
+	lock := &Lock{}
+	err = json.Unmarshal([]byte(output.Item.String("Lock")), lock)
+	if err != nil {
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+func (recv *DynamoDBStore) Unlock(lock *Lock) error {
+	values := dynamodb.Item{}
+	values.SetString(":id", lock.Id)
+
+	_, err := recv.Client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:                 recv.Table,
+		Key:                       dynamoDBLockKey(lock.ServiceName, lock.Environment),
+		ConditionExpression:       "attribute_not_exists(LockId) OR LockId = :id",
+		ExpressionAttributeValues: values,
+	})
+
+	// someone else's lock is left alone
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailed {
+		return nil
+	}
+	return err
+}
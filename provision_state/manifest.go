@@ -0,0 +1,55 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision_state
+
+import (
+	"fmt"
+	"time"
+)
+
+// DeploymentManifest is what provision uploaded for a stack. Hosts check the
+// payload named in their user data against it before starting containers so
+// a stack whose parameters or launch configuration went stale can't run a
+// different build than the one deployed to it
+type DeploymentManifest struct {
+	ServiceName     string    `json:"service_name"`
+	ServiceVersion  string    `json:"service_version"`
+	Environment     string    `json:"environment"`
+	Region          string    `json:"region"`
+	StackName       string    `json:"stack_name"`
+	PayloadKey      string    `json:"payload_key"`
+	PayloadChecksum string    `json:"payload_checksum"`
+	CreatedAt       time.Time `json:"created_at"`
+
+	// the KMS key the deployment's secrets data key was generated under
+	SecretsKeyArn string `json:"secrets_key_arn,omitempty"`
+}
+
+// Verify checks a host is about to install the payload the manifest names.
+// stackName and key are only compared if they're known
+func (recv *DeploymentManifest) Verify(stackName, key, checksum string) error {
+	if stackName != "" && recv.StackName != stackName {
+		return fmt.Errorf("deployment manifest is for stack %s, not %s", recv.StackName, stackName)
+	}
+
+	if recv.PayloadChecksum != checksum {
+		return fmt.Errorf("service payload checksum %s doesn't match %s in the deployment manifest",
+			checksum, recv.PayloadChecksum)
+	}
+
+	if key != "" && recv.PayloadKey != key {
+		return fmt.Errorf("service payload key %s doesn't match %s in the deployment manifest",
+			key, recv.PayloadKey)
+	}
+
+	return nil
+}
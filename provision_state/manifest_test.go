@@ -0,0 +1,29 @@
+package provision_state_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/provision_state"
+)
+
+var _ = Describe("DeploymentManifest", func() {
+
+	manifest := &provision_state.DeploymentManifest{
+		StackName:       "svc-prod-1",
+		PayloadKey:      "porter-deployment/svc/prod/1.0.0/abc.tar",
+		PayloadChecksum: "abc",
+	}
+
+	It("accepts the payload it names", func() {
+		Expect(manifest.Verify("svc-prod-1", "porter-deployment/svc/prod/1.0.0/abc.tar", "abc")).To(Succeed())
+		Expect(manifest.Verify("svc-prod-1", "", "abc")).To(Succeed())
+		Expect(manifest.Verify("", "", "abc")).To(Succeed())
+	})
+
+	It("refuses a different payload or stack", func() {
+		Expect(manifest.Verify("svc-prod-1", "porter-deployment/svc/prod/1.0.0/abc.tar", "def")).ToNot(Succeed())
+		Expect(manifest.Verify("svc-prod-1", "porter-deployment/svc/prod/0.9.0/abc.tar", "abc")).ToNot(Succeed())
+		Expect(manifest.Verify("svc-prod-2", "porter-deployment/svc/prod/1.0.0/abc.tar", "abc")).ToNot(Succeed())
+	})
+})
@@ -13,6 +13,8 @@
 // This is here to avoid the import cycle provision -> hook -> provision
 package provision_state
 
+import "time"
+
 type (
 	Stack struct {
 		Name        string
@@ -25,4 +27,22 @@ type (
 		StackId            string
 		ProvisionedELBName string
 	}
+
+	// HookResult is the outcome of one hook container. Hooks can report it
+	// by writing JSON like {"status": "fail", "message": "..."} to the file
+	// in $PORTER_HOOK_RESULT
+	HookResult struct {
+		Hook      string            `json:"hook"`
+		HookIndex int               `json:"hook_index"`
+		Region    string            `json:"region,omitempty"`
+		Status    string            `json:"status"`
+		Message   string            `json:"message,omitempty"`
+		Details   map[string]string `json:"details,omitempty"`
+		Time      time.Time         `json:"time"`
+	}
+)
+
+const (
+	HookResultPass = "pass"
+	HookResultFail = "fail"
 )
@@ -0,0 +1,157 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision_state
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/adobe-platform/porter/aws/dynamodb"
+	"github.com/aws/aws-sdk-go/aws/client"
+)
+
+type (
+	// Semaphore limits how many deploys run at once in an account's region.
+	// Deploys wait in line for a slot in the order they asked for one
+	//
+	// The table has the string hash key Semaphore and the string range key
+	// Ticket. Tickets sort in the order they were created
+	Semaphore struct {
+		Client *dynamodb.DynamoDB
+		Table  string
+		Limit  int
+	}
+
+	// Ticket is a deploy's place in line for a semaphore. Tickets that aren't
+	// renewed before ExpiresAt belong to a deploy that died and are ignored
+	Ticket struct {
+		Id          string
+		Key         string
+		ServiceName string
+		Environment string
+		Host        string
+		CreatedAt   time.Time
+		ExpiresAt   time.Time
+	}
+)
+
+func NewSemaphore(p client.ConfigProvider, table string, limit int) *Semaphore {
+	return &Semaphore{
+		Client: dynamodb.New(p),
+		Table:  table,
+		Limit:  limit,
+	}
+}
+
+// SemaphoreKey is the semaphore shared by every deploy to an account's region
+func SemaphoreKey(accountId, region string) string {
+	return accountId + "/" + region
+}
+
+// rangeKey sorts tickets by creation time with the id breaking ties
+func (recv *Ticket) rangeKey() string {
+	return recv.CreatedAt.UTC().Format("20060102T150405.000000000Z") + "/" + recv.Id
+}
+
+func (recv *Semaphore) key(ticket *Ticket) dynamodb.Item {
+	key := dynamodb.Item{}
+	key.SetString("Semaphore", ticket.Key)
+	key.SetString("Ticket", ticket.rangeKey())
+	return key
+}
+
+// Put gets in line or renews a ticket that's already in line
+func (recv *Semaphore) Put(ticket *Ticket) error {
+	ticketBytes, err := json.Marshal(ticket)
+	if err != nil {
+		return err
+	}
+
+	item := recv.key(ticket)
+	item.SetString("Value", string(ticketBytes))
+
+	_, err = recv.Client.PutItem(&dynamodb.PutItemInput{
+		TableName: recv.Table,
+		Item:      item,
+	})
+	return err
+}
+
+// Release removes the ticket from the line whether or not it held a slot
+func (recv *Semaphore) Release(ticket *Ticket) error {
+	_, err := recv.Client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: recv.Table,
+		Key:       recv.key(ticket),
+	})
+	return err
+}
+
+// List returns every ticket in line for the semaphore including expired ones
+func (recv *Semaphore) List(semaphoreKey string) ([]*Ticket, error) {
+	values := dynamodb.Item{}
+	values.SetString(":key", semaphoreKey)
+
+	items, err := recv.Client.QueryAll(&dynamodb.QueryInput{
+		TableName:                 recv.Table,
+		KeyConditionExpression:    "Semaphore = :key",
+		ExpressionAttributeValues: values,
+		ConsistentRead:            true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tickets := make([]*Ticket, 0, len(items))
+	for _, item := range items {
+		ticket := &Ticket{}
+		err = json.Unmarshal([]byte(item.String("Value")), ticket)
+		if err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, ticket)
+	}
+
+	return tickets, nil
+}
+
+// Position is where a ticket is in line. 0 means it holds one of the limit's
+// slots and 1 is next in line. Expired tickets don't count and are returned so
+// they can be released. found is false if the ticket isn't in line
+func Position(tickets []*Ticket, id string, limit int, now time.Time) (position int, expired []*Ticket, found bool) {
+	live := make([]*Ticket, 0, len(tickets))
+	for _, ticket := range tickets {
+		if ticket.ExpiresAt.Before(now) {
+			expired = append(expired, ticket)
+			continue
+		}
+		live = append(live, ticket)
+	}
+
+	sort.Slice(live, func(i, j int) bool {
+		return live[i].rangeKey() < live[j].rangeKey()
+	})
+
+	for i, ticket := range live {
+		if ticket.Id != id {
+			continue
+		}
+
+		found = true
+		if i >= limit {
+			position = i - limit + 1
+		}
+		return
+	}
+
+	return
+}
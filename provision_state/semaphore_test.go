@@ -0,0 +1,57 @@
+package provision_state_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"time"
+
+	"github.com/adobe-platform/porter/provision_state"
+)
+
+var _ = Describe("Semaphore", func() {
+
+	var (
+		now     time.Time
+		tickets []*provision_state.Ticket
+	)
+
+	ticket := func(id string, createdAgo, expiresIn time.Duration) *provision_state.Ticket {
+		return &provision_state.Ticket{
+			Id:        id,
+			CreatedAt: now.Add(-createdAgo),
+			ExpiresAt: now.Add(expiresIn),
+		}
+	}
+
+	BeforeEach(func() {
+		now = time.Now()
+
+		// out of order to show position doesn't depend on the query order
+		tickets = []*provision_state.Ticket{
+			ticket("third", 1*time.Minute, time.Minute),
+			ticket("first", 3*time.Minute, time.Minute),
+			ticket("dead", 4*time.Minute, -time.Second),
+			ticket("second", 2*time.Minute, time.Minute),
+		}
+	})
+
+	It("gives the oldest tickets the slots", func() {
+		position, expired, found := provision_state.Position(tickets, "second", 2, now)
+		Expect(found).To(BeTrue())
+		Expect(position).To(Equal(0))
+		Expect(expired).To(HaveLen(1))
+		Expect(expired[0].Id).To(Equal("dead"))
+	})
+
+	It("puts the rest in line", func() {
+		position, _, found := provision_state.Position(tickets, "third", 1, now)
+		Expect(found).To(BeTrue())
+		Expect(position).To(Equal(2))
+	})
+
+	It("doesn't find expired tickets", func() {
+		_, _, found := provision_state.Position(tickets, "dead", 1, now)
+		Expect(found).To(BeFalse())
+	})
+})
@@ -0,0 +1,42 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision_state
+
+// A new stack runs alongside the promoted one until it's pruned. Each gets the
+// color the other doesn't have so logs and metrics from the two can be told
+// apart
+const (
+	StackColorBlue  = "blue"
+	StackColorGreen = "green"
+)
+
+// NextStackColor is the color of a stack given the region's previous
+// deployment. Updating the same stack keeps its color. A new stack takes the
+// opposite of a promoted stack's color or reuses the color of one that never
+// took traffic
+func NextStackColor(previous *Deployment, stackName string) string {
+	if previous == nil {
+		return StackColorBlue
+	}
+
+	if previous.StackName == stackName || previous.Status != StatusPromoted {
+		if previous.StackColor == "" {
+			return StackColorBlue
+		}
+		return previous.StackColor
+	}
+
+	if previous.StackColor == StackColorGreen {
+		return StackColorBlue
+	}
+	return StackColorGreen
+}
@@ -0,0 +1,54 @@
+package provision_state_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/provision_state"
+)
+
+var _ = Describe("NextStackColor", func() {
+
+	It("starts blue", func() {
+		Expect(provision_state.NextStackColor(nil, "svc-dev-2")).To(Equal(provision_state.StackColorBlue))
+	})
+
+	It("flips the color of the promoted stack", func() {
+		previous := &provision_state.Deployment{
+			StackName:  "svc-dev-1",
+			StackColor: provision_state.StackColorBlue,
+			Status:     provision_state.StatusPromoted,
+		}
+		Expect(provision_state.NextStackColor(previous, "svc-dev-2")).To(Equal(provision_state.StackColorGreen))
+
+		previous.StackColor = provision_state.StackColorGreen
+		Expect(provision_state.NextStackColor(previous, "svc-dev-2")).To(Equal(provision_state.StackColorBlue))
+	})
+
+	It("treats a promoted stack recorded without a color as blue", func() {
+		previous := &provision_state.Deployment{
+			StackName: "svc-dev-1",
+			Status:    provision_state.StatusPromoted,
+		}
+		Expect(provision_state.NextStackColor(previous, "svc-dev-2")).To(Equal(provision_state.StackColorGreen))
+	})
+
+	It("keeps the color of a stack being updated", func() {
+		previous := &provision_state.Deployment{
+			StackName:  "svc-dev-1",
+			StackColor: provision_state.StackColorGreen,
+			Status:     provision_state.StatusPromoted,
+			Hotswap:    true,
+		}
+		Expect(provision_state.NextStackColor(previous, "svc-dev-1")).To(Equal(provision_state.StackColorGreen))
+	})
+
+	It("reuses the color of a stack that never took traffic", func() {
+		previous := &provision_state.Deployment{
+			StackName:  "svc-dev-2",
+			StackColor: provision_state.StackColorGreen,
+			Status:     provision_state.StatusFailed,
+		}
+		Expect(provision_state.NextStackColor(previous, "svc-dev-3")).To(Equal(provision_state.StackColorGreen))
+	})
+})
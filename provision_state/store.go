@@ -0,0 +1,269 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package provision_state
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/adobe-platform/porter/aws/dynamodb"
+	"github.com/aws/aws-sdk-go/aws/client"
+)
+
+// Deploy statuses in the order a region goes through them
+const (
+	StatusPayloadUploaded  = "payload_uploaded"
+	StatusSecretsUploaded  = "secrets_uploaded"
+	StatusTemplateUploaded = "template_uploaded"
+	StatusStackCreating    = "stack_creating"
+	StatusProvisioned      = "provisioned"
+	StatusPromoted         = "promoted"
+	StatusFailed           = "failed"
+)
+
+type (
+	// Deployment is the latest deploy of a service's environment to a region
+	Deployment struct {
+		ServiceName        string
+		Environment        string
+		Region             string
+		Status             string
+		ServiceVersion     string
+		StackName          string
+		StackId            string
+		StackColor         string
+		Hotswap            bool
+		ProvisionedELBName string
+		PayloadChecksum    string
+		PayloadKey         string
+		SecretsLocation    string
+		Error              string
+		UpdatedAt          time.Time
+
+		// ImageId is the AMI an ami block resolved to. A pinned ami reuses it
+		ImageId string `json:",omitempty"`
+
+		// Hooks is the results of the hooks that ran for this deploy
+		Hooks []HookResult `json:",omitempty"`
+	}
+
+	// Store records deployments so a deploy can be inspected, resumed, or
+	// promoted from a different machine than the one that provisioned it
+	Store interface {
+		Put(deployment *Deployment) error
+
+		// Get returns nil if the region has never been deployed
+		Get(serviceName, environment, region string) (*Deployment, error)
+
+		// List returns the environment's deployments ordered by region
+		List(serviceName, environment string) ([]*Deployment, error)
+
+		// Lock acquires the environment's lock. If it's already held the
+		// holder's lock is returned instead
+		Lock(lock *Lock) (*Lock, error)
+
+		// GetLock returns nil if the environment isn't locked
+		GetLock(serviceName, environment string) (*Lock, error)
+
+		// Unlock releases the lock if it's still the one held
+		Unlock(lock *Lock) error
+	}
+
+	// FileStore keeps deployments on the local disk. It's the default and
+	// only knows about deploys run from this machine
+	FileStore struct {
+		Dir string
+	}
+
+	// DynamoDBStore keeps deployments in a table with the string hash key
+	// ServiceEnvironment and the string range key Region
+	DynamoDBStore struct {
+		Client *dynamodb.DynamoDB
+		Table  string
+	}
+)
+
+// StackOf turns an environment's deployments back into what provision writes
+// for promote and prune. Regions that didn't provision a stack are left out
+func StackOf(deployments []*Deployment) *Stack {
+	stack := &Stack{
+		Regions: make(map[string]*Region),
+	}
+
+	for _, deployment := range deployments {
+		if deployment.StackId == "" {
+			continue
+		}
+
+		stack.Name = deployment.StackName
+		stack.Environment = deployment.Environment
+		stack.Hotswap = deployment.Hotswap
+		stack.Regions[deployment.Region] = &Region{
+			StackId:            deployment.StackId,
+			ProvisionedELBName: deployment.ProvisionedELBName,
+		}
+	}
+
+	return stack
+}
+
+func (recv *FileStore) path(serviceName, environment, region string) string {
+	return filepath.Join(recv.Dir, serviceName, environment, region+".json")
+}
+
+func (recv *FileStore) Put(deployment *Deployment) error {
+	path := recv.path(deployment.ServiceName, deployment.Environment, deployment.Region)
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	deploymentBytes, err := json.Marshal(deployment)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, deploymentBytes, 0644)
+}
+
+func (recv *FileStore) Get(serviceName, environment, region string) (*Deployment, error) {
+	deploymentBytes, err := ioutil.ReadFile(recv.path(serviceName, environment, region))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	deployment := &Deployment{}
+	err = json.Unmarshal(deploymentBytes, deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	return deployment, nil
+}
+
+func (recv *FileStore) List(serviceName, environment string) ([]*Deployment, error) {
+	paths, err := filepath.Glob(recv.path(serviceName, environment, "*"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	deployments := make([]*Deployment, 0, len(paths))
+	for _, path := range paths {
+		region := filepath.Base(path)
+		region = region[:len(region)-len(".json")]
+
+		deployment, err := recv.Get(serviceName, environment, region)
+		if err != nil {
+			return nil, err
+		}
+		deployments = append(deployments, deployment)
+	}
+
+	return deployments, nil
+}
+
+// NewDynamoDBStore creates a store in the table. The table isn't created
+func NewDynamoDBStore(p client.ConfigProvider, table string) *DynamoDBStore {
+	return &DynamoDBStore{
+		Client: dynamodb.New(p),
+		Table:  table,
+	}
+}
+
+func dynamoDBHashKey(serviceName, environment string) string {
+	return serviceName + "/" + environment
+}
+
+func (recv *DynamoDBStore) Put(deployment *Deployment) error {
+	deploymentBytes, err := json.Marshal(deployment)
+	if err != nil {
+		return err
+	}
+
+	item := dynamodb.Item{}
+	item.SetString("ServiceEnvironment", dynamoDBHashKey(deployment.ServiceName, deployment.Environment))
+	item.SetString("Region", deployment.Region)
+	item.SetString("Status", deployment.Status)
+	item.SetString("Deployment", string(deploymentBytes))
+
+	_, err = recv.Client.PutItem(&dynamodb.PutItemInput{
+		TableName: recv.Table,
+		Item:      item,
+	})
+	return err
+}
+
+func (recv *DynamoDBStore) Get(serviceName, environment, region string) (*Deployment, error) {
+	key := dynamodb.Item{}
+	key.SetString("ServiceEnvironment", dynamoDBHashKey(serviceName, environment))
+	key.SetString("Region", region)
+
+	output, err := recv.Client.GetItem(&dynamodb.GetItemInput{
+		TableName:      recv.Table,
+		Key:            key,
+		ConsistentRead: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if output.Item == nil {
+		return nil, nil
+	}
+
+	return unmarshalDeploymentItem(output.Item)
+}
+
+func (recv *DynamoDBStore) List(serviceName, environment string) ([]*Deployment, error) {
+	values := dynamodb.Item{}
+	values.SetString(":key", dynamoDBHashKey(serviceName, environment))
+
+	items, err := recv.Client.QueryAll(&dynamodb.QueryInput{
+		TableName:                 recv.Table,
+		KeyConditionExpression:    "ServiceEnvironment = :key",
+		ExpressionAttributeValues: values,
+		ConsistentRead:            true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// items are ordered by the range key
+	deployments := make([]*Deployment, 0, len(items))
+	for _, item := range items {
+		deployment, err := unmarshalDeploymentItem(item)
+		if err != nil {
+			return nil, err
+		}
+		deployments = append(deployments, deployment)
+	}
+
+	return deployments, nil
+}
+
+func unmarshalDeploymentItem(item dynamodb.Item) (*Deployment, error) {
+	deployment := &Deployment{}
+	err := json.Unmarshal([]byte(item.String("Deployment")), deployment)
+	if err != nil {
+		return nil, err
+	}
+	return deployment, nil
+}
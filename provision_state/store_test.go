@@ -0,0 +1,122 @@
+package provision_state_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"io/ioutil"
+	"os"
+
+	"github.com/adobe-platform/porter/provision_state"
+)
+
+var _ = Describe("FileStore", func() {
+
+	var (
+		dir   string
+		store *provision_state.FileStore
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "porter-state")
+		Expect(err).To(BeNil())
+
+		store = &provision_state.FileStore{Dir: dir}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("returns nil for a region that was never deployed", func() {
+		deployment, err := store.Get("svc", "dev", "us-west-2")
+		Expect(err).To(BeNil())
+		Expect(deployment).To(BeNil())
+
+		deployments, err := store.List("svc", "dev")
+		Expect(err).To(BeNil())
+		Expect(deployments).To(BeEmpty())
+	})
+
+	It("keeps the results of a deployment's hooks", func() {
+		Expect(store.Put(&provision_state.Deployment{
+			ServiceName: "svc",
+			Environment: "dev",
+			Region:      "us-west-2",
+			Hooks: []provision_state.HookResult{
+				{
+					Hook:    "pre_promote",
+					Region:  "us-west-2",
+					Status:  provision_state.HookResultFail,
+					Message: "smoke tests failed",
+					Details: map[string]string{"failed": "3"},
+				},
+			},
+		})).To(Succeed())
+
+		deployment, err := store.Get("svc", "dev", "us-west-2")
+		Expect(err).To(BeNil())
+		Expect(deployment.Hooks).To(HaveLen(1))
+		Expect(deployment.Hooks[0].Status).To(Equal(provision_state.HookResultFail))
+		Expect(deployment.Hooks[0].Details).To(HaveKeyWithValue("failed", "3"))
+	})
+
+	It("lists the latest deployment of each region", func() {
+		for _, deployment := range []*provision_state.Deployment{
+			{ServiceName: "svc", Environment: "dev", Region: "us-west-2", Status: provision_state.StatusStackCreating},
+			{ServiceName: "svc", Environment: "dev", Region: "us-west-2", Status: provision_state.StatusProvisioned, StackName: "svc-dev", StackId: "west"},
+			{ServiceName: "svc", Environment: "dev", Region: "us-east-1", Status: provision_state.StatusProvisioned, StackName: "svc-dev", StackId: "east"},
+			{ServiceName: "svc", Environment: "prod", Region: "us-east-1", Status: provision_state.StatusFailed},
+		} {
+			Expect(store.Put(deployment)).To(Succeed())
+		}
+
+		deployments, err := store.List("svc", "dev")
+		Expect(err).To(BeNil())
+		Expect(deployments).To(HaveLen(2))
+		Expect(deployments[0].Region).To(Equal("us-east-1"))
+		Expect(deployments[1].Status).To(Equal(provision_state.StatusProvisioned))
+
+		stack := provision_state.StackOf(deployments)
+		Expect(stack.Name).To(Equal("svc-dev"))
+		Expect(stack.Environment).To(Equal("dev"))
+		Expect(stack.Regions).To(HaveLen(2))
+		Expect(stack.Regions["us-west-2"].StackId).To(Equal("west"))
+	})
+
+	It("lets one deploy at a time hold an environment's lock", func() {
+		first := &provision_state.Lock{Id: "first", ServiceName: "svc", Environment: "dev", Owner: "ci"}
+		second := &provision_state.Lock{Id: "second", ServiceName: "svc", Environment: "dev", Owner: "dev"}
+
+		held, err := store.Lock(first)
+		Expect(err).To(BeNil())
+		Expect(held).To(BeNil())
+
+		held, err = store.Lock(second)
+		Expect(err).To(BeNil())
+		Expect(held.Id).To(Equal("first"))
+		Expect(held.Owner).To(Equal("ci"))
+
+		// other environments aren't locked
+		held, err = store.Lock(&provision_state.Lock{Id: "prod", ServiceName: "svc", Environment: "prod"})
+		Expect(err).To(BeNil())
+		Expect(held).To(BeNil())
+
+		// only the holder releases the lock
+		Expect(store.Unlock(second)).To(Succeed())
+		held, err = store.GetLock("svc", "dev")
+		Expect(err).To(BeNil())
+		Expect(held.Id).To(Equal("first"))
+
+		Expect(store.Unlock(first)).To(Succeed())
+		held, err = store.Lock(second)
+		Expect(err).To(BeNil())
+		Expect(held).To(BeNil())
+
+		// the lock isn't a deployment
+		deployments, err := store.List("svc", "dev")
+		Expect(err).To(BeNil())
+		Expect(deployments).To(BeEmpty())
+	})
+})
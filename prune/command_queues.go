@@ -0,0 +1,105 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package prune
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/adobe-platform/porter/aws/ec2"
+	"github.com/adobe-platform/porter/command_queue"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	ec2lib "github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/inconshreveable/log15"
+)
+
+// DescribeInstances takes at most 200 filter values
+const describeInstancesBatch = 100
+
+// the queues of stacks the service's environment created start with the same
+// prefix but aren't named after an instance
+var instanceIdRegex = regexp.MustCompile(`^i-[0-9a-f]+$`)
+
+// pruneCommandQueues deletes the command queues of terminated instances.
+// porterd creates its instance's queue so CloudFormation doesn't delete it
+// with the stack
+func pruneCommandQueues(log log15.Logger, roleSession *session.Session, serviceName,
+	environmentName string) (success bool) {
+
+	sqsClient := sqs.New(roleSession)
+	queuePrefix := command_queue.QueueNamePrefix(serviceName, environmentName)
+
+	listQueuesOutput, err := sqsClient.ListQueues(&sqs.ListQueuesInput{
+		QueueNamePrefix: aws.String(queuePrefix),
+	})
+	if err != nil {
+		log.Error("sqs:ListQueues", "Error", err)
+		return
+	}
+
+	// the queue URL ends with its name
+	queueUrls := make(map[string]string)
+	instanceIds := make([]string, 0)
+	for _, queueUrl := range listQueuesOutput.QueueUrls {
+		queueName := aws.StringValue(queueUrl)[strings.LastIndex(aws.StringValue(queueUrl), "/")+1:]
+
+		instanceId := strings.TrimPrefix(queueName, queuePrefix)
+		if !instanceIdRegex.MatchString(instanceId) {
+			continue
+		}
+
+		queueUrls[instanceId] = aws.StringValue(queueUrl)
+		instanceIds = append(instanceIds, instanceId)
+	}
+
+	ec2Client := ec2.New(roleSession)
+	for start := 0; start < len(instanceIds); start += describeInstancesBatch {
+		end := start + describeInstancesBatch
+		if end > len(instanceIds) {
+			end = len(instanceIds)
+		}
+
+		reservations, err := ec2.DescribeInstances(ec2Client, map[string][]string{
+			"instance-id": instanceIds[start:end],
+		})
+		if err != nil {
+			log.Error("ec2:DescribeInstances", "Error", err)
+			return
+		}
+
+		for _, reservation := range reservations {
+			for _, instance := range reservation.Instances {
+				if aws.StringValue(instance.State.Name) != ec2lib.InstanceStateNameTerminated {
+					delete(queueUrls, aws.StringValue(instance.InstanceId))
+				}
+			}
+		}
+	}
+
+	// terminated instances drop out of DescribeInstances after a while
+	for instanceId, queueUrl := range queueUrls {
+		log.Info("Deleting command queue of a terminated instance", "InstanceId", instanceId)
+
+		_, err = sqsClient.DeleteQueue(&sqs.DeleteQueueInput{
+			QueueUrl: aws.String(queueUrl),
+		})
+		if err != nil {
+			log.Error("sqs:DeleteQueue", "QueueUrl", queueUrl, "Error", err)
+			return
+		}
+	}
+
+	success = true
+	return
+}
@@ -0,0 +1,294 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package prune
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/aws/cloudwatch"
+	"github.com/adobe-platform/porter/aws/elb"
+	"github.com/adobe-platform/porter/aws/elbv2"
+	"github.com/adobe-platform/porter/aws/logs"
+	"github.com/adobe-platform/porter/aws/tagging"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/promote"
+	"github.com/adobe-platform/porter/provision"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+	elblib "github.com/aws/aws-sdk-go/service/elb"
+	"github.com/inconshreveable/log15"
+)
+
+// Deleting a stack doesn't always delete everything it created. Resources with
+// a DeletionPolicy of Retain are left behind and a resource that fails to
+// delete leaves the stack in DELETE_FAILED.
+//
+// CloudFormation tags what it creates with the stack's tags and id so the
+// service's resources whose stack is gone are found by tag and deleted. Load
+// balancers are deleted before the target groups they forward to
+//
+// The log groups of logging are retained on purpose and expire their logs
+// instead
+var orphanResourceTypes = []string{
+	"elasticloadbalancing:loadbalancer",
+	"elasticloadbalancing:targetgroup",
+	"cloudwatch:alarm",
+	"logs:log-group",
+}
+
+var retainedLogicalIds = map[string]struct{}{
+	constants.ContainerLogGroup: {},
+	constants.HostLogGroup:      {},
+}
+
+// pruneOrphans deletes the resources of the service's deleted stacks. Stacks
+// that failed to delete are deleted again keeping the resources that failed
+// which are deleted by a later prune once the stack is gone.
+//
+// The resources are listed before the stacks. A stack created in between is
+// then live even though its resources weren't listed, where listing them
+// after would find resources of a stack that wasn't live yet
+func pruneOrphans(log log15.Logger, roleSession *session.Session, serviceName,
+	environmentName, stackName, cfnRoleARN string, dnsPerStack bool) (success bool) {
+
+	cfnClient := cloudformation.New(roleSession)
+
+	resources, err := tagging.New(roleSession).GetAllResources(&tagging.GetResourcesInput{
+		TagFilters: []tagging.TagFilter{
+			{Key: constants.PorterServiceNameTag, Values: []string{serviceName}},
+			{Key: constants.PorterEnvironmentTag, Values: []string{environmentName}},
+		},
+		ResourceTypeFilters: orphanResourceTypes,
+	})
+	if err != nil {
+		log.Error("tag:GetResources", "Error", err)
+		return
+	}
+
+	liveStacks := make(map[string]interface{})
+	deleteFailedStacks := make([]*cfnlib.Stack, 0)
+
+	err = cfnClient.DescribeStacksPages(&cfnlib.DescribeStacksInput{},
+		func(page *cfnlib.DescribeStacksOutput, lastPage bool) bool {
+			for _, stack := range page.Stacks {
+				if !strings.HasPrefix(*stack.StackName, stackName) {
+					continue
+				}
+
+				liveStacks[*stack.StackId] = nil
+
+				if *stack.StackStatus == cfnlib.StackStatusDeleteFailed {
+					deleteFailedStacks = append(deleteFailedStacks, stack)
+				}
+			}
+			return true
+		})
+	if err != nil {
+		log.Error("cloudformation:DescribeStacks", "Error", err)
+		return
+	}
+
+	for _, stack := range deleteFailedStacks {
+		if !retryDeleteStack(log, roleSession, cfnClient, stack, cfnRoleARN) {
+			return
+		}
+	}
+
+	if dnsPerStack && !pruneDNSStack(log, roleSession, serviceName, environmentName, liveStacks, cfnRoleARN) {
+		return
+	}
+
+	orphans := make([]string, 0)
+	for _, resource := range resources {
+
+		stackId := resource.Value(constants.AwsCfnStackIdTag)
+		if stackId == "" || !strings.HasPrefix(resource.Value(constants.AwsCfnStackNameTag), stackName) {
+			continue
+		}
+
+		if _, exists := liveStacks[stackId]; exists {
+			continue
+		}
+
+		if _, exists := retainedLogicalIds[resource.Value(constants.AwsCfnLogicalIdTag)]; exists {
+			continue
+		}
+
+		orphans = append(orphans, resource.ResourceARN)
+	}
+
+	sort.SliceStable(orphans, func(i, j int) bool {
+		return orphanDeleteOrder(orphans[i]) < orphanDeleteOrder(orphans[j])
+	})
+
+	for _, arn := range orphans {
+		if !deleteOrphan(log.New("ResourceARN", arn), roleSession, arn) {
+			return
+		}
+	}
+
+	success = true
+	return
+}
+
+// pruneDNSStack deletes the DNS stack whose records point at the instances or
+// load balancer of a stack that's gone. Route53 records can't be tagged so
+// they're found through the DNS stack's output naming the promoted stack
+func pruneDNSStack(log log15.Logger, roleSession *session.Session, serviceName,
+	environmentName string, liveStacks map[string]interface{}, cfnRoleARN string) (success bool) {
+
+	promotedStackId, err := promote.PromotedStackId(roleSession, serviceName, environmentName)
+	if err != nil {
+		log.Error("PromotedStackId", "Error", err)
+		return
+	}
+
+	if _, exists := liveStacks[promotedStackId]; promotedStackId == "" || exists {
+		success = true
+		return
+	}
+
+	dnsStackName := promote.DNSStackName(serviceName, environmentName)
+	log.Info("Deleting DNS stack of a deleted stack", "StackName", dnsStackName, "PromotedStackId", promotedStackId)
+
+	err = cloudformation.DeleteStack(cloudformation.New(roleSession), dnsStackName, cfnRoleARN)
+	if err != nil {
+		log.Error("cloudformation:DeleteStack", "StackName", dnsStackName, "Error", err)
+		return
+	}
+
+	success = true
+	return
+}
+
+func retryDeleteStack(log log15.Logger, roleSession *session.Session, cfnClient *cfnlib.CloudFormation,
+	stack *cfnlib.Stack, cfnRoleARN string) (success bool) {
+
+	describeStackResourcesOutput, err := cfnClient.DescribeStackResources(&cfnlib.DescribeStackResourcesInput{
+		StackName: stack.StackId,
+	})
+	if err != nil {
+		log.Error("cloudformation:DescribeStackResources", "StackId", *stack.StackId, "Error", err)
+		return
+	}
+
+	retainResources := make([]*string, 0)
+	for _, resource := range describeStackResourcesOutput.StackResources {
+		if *resource.ResourceStatus == cfnlib.ResourceStatusDeleteFailed {
+			retainResources = append(retainResources, resource.LogicalResourceId)
+		}
+	}
+
+	log.Info("Deleting stack that failed to delete", "StackId", *stack.StackId)
+	success = provision.DeleteStackRetaining(log, roleSession, *stack.StackId, retainResources, cfnRoleARN)
+	return
+}
+
+// orphanDeleteOrder is the index of the resource's type in orphanResourceTypes
+func orphanDeleteOrder(arn string) int {
+	service, resource := splitARN(arn)
+	for i, resourceType := range orphanResourceTypes {
+		if strings.HasPrefix(service+":"+resource, resourceType) {
+			return i
+		}
+	}
+	return len(orphanResourceTypes)
+}
+
+// splitARN returns the service and resource of
+// arn:partition:service:region:account:resource
+func splitARN(arn string) (service, resource string) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 {
+		return
+	}
+	return parts[2], parts[5]
+}
+
+// deleteOrphan deletes a resource by its ARN. A resource that's already gone
+// isn't an error since the tag index lags behind deletes
+func deleteOrphan(log log15.Logger, roleSession *session.Session, arn string) (success bool) {
+
+	var operation string
+	var err error
+
+	service, resource := splitARN(arn)
+
+	switch {
+	case service == "elasticloadbalancing" &&
+		(strings.HasPrefix(resource, "loadbalancer/app/") || strings.HasPrefix(resource, "loadbalancer/net/")):
+
+		operation = "elasticloadbalancing:DeleteLoadBalancer"
+		_, err = elbv2.New(roleSession).DeleteLoadBalancer(&elbv2.DeleteLoadBalancerInput{
+			LoadBalancerArn: arn,
+		})
+
+	case service == "elasticloadbalancing" && strings.HasPrefix(resource, "loadbalancer/"):
+
+		operation = "elasticloadbalancing:DeleteLoadBalancer"
+		_, err = elb.New(roleSession).DeleteLoadBalancer(&elblib.DeleteLoadBalancerInput{
+			LoadBalancerName: aws.String(strings.TrimPrefix(resource, "loadbalancer/")),
+		})
+
+	case service == "elasticloadbalancing" && strings.HasPrefix(resource, "targetgroup/"):
+
+		operation = "elasticloadbalancing:DeleteTargetGroup"
+		_, err = elbv2.New(roleSession).DeleteTargetGroup(&elbv2.DeleteTargetGroupInput{
+			TargetGroupArn: arn,
+		})
+
+	case service == "cloudwatch" && strings.HasPrefix(resource, "alarm:"):
+
+		operation = "cloudwatch:DeleteAlarms"
+		_, err = cloudwatch.New(roleSession).DeleteAlarms(&cloudwatch.DeleteAlarmsInput{
+			AlarmNames: []string{strings.TrimPrefix(resource, "alarm:")},
+		})
+
+	case service == "logs" && strings.HasPrefix(resource, "log-group:"):
+
+		operation = "logs:DeleteLogGroup"
+		_, err = logs.New(roleSession).DeleteLogGroup(&logs.DeleteLogGroupInput{
+			LogGroupName: strings.TrimSuffix(strings.TrimPrefix(resource, "log-group:"), ":*"),
+		})
+
+	default:
+		log.Warn("Not deleting resource of unknown type")
+		success = true
+		return
+	}
+
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok {
+			switch awsErr.Code() {
+			case elbv2.ErrCodeLoadBalancerNotFound,
+				elbv2.ErrCodeTargetGroupNotFound,
+				cloudwatch.ErrCodeResourceNotFound,
+				logs.ErrCodeResourceNotFound:
+
+				log.Info("Orphaned resource is already gone")
+				success = true
+				return
+			}
+		}
+
+		log.Error(operation, "Error", err)
+		return
+	}
+
+	log.Info("Deleted orphaned resource")
+	success = true
+	return
+}
@@ -25,6 +25,8 @@ import (
 	"github.com/adobe-platform/porter/aws_session"
 	"github.com/adobe-platform/porter/conf"
 	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/events"
+	"github.com/adobe-platform/porter/promote"
 	"github.com/adobe-platform/porter/provision"
 	"github.com/aws/aws-sdk-go/aws/session"
 	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
@@ -55,10 +57,10 @@ func Do(log log15.Logger, config *conf.Config, environment *conf.Environment,
 	for _, region := range environment.Regions {
 		switch region.PrimaryTopology() {
 		case conf.Topology_Inet:
-			go pruneStacks(log, region, environment,
+			go pruneStacks(log, region, config.ServiceName, environment,
 				stackName, keepCount, pruneStackChan, elbFilter, elbTag)
 		case conf.Topology_Worker:
-			go pruneStacks(log, region, environment,
+			go pruneStacks(log, region, config.ServiceName, environment,
 				stackName, keepCount+1, pruneStackChan, false, elbTag)
 		default:
 			log.Error("Unsupported topology")
@@ -83,7 +85,7 @@ func Do(log log15.Logger, config *conf.Config, environment *conf.Environment,
 	return
 }
 
-func pruneStacks(log log15.Logger, region *conf.Region,
+func pruneStacks(log log15.Logger, region *conf.Region, serviceName string,
 	environment *conf.Environment, stackName string, keepCount int,
 	pruneStackChan chan bool, elbFilter bool, elbTag string) {
 
@@ -98,6 +100,13 @@ func pruneStacks(log log15.Logger, region *conf.Region,
 	roleSession := aws_session.STS(region.Name, roleARN, constants.StackCreationTimeout())
 	cfnClient := cloudformation.New(roleSession)
 
+	cfnRoleARN, err := environment.GetCFNRoleARN(region.Name)
+	if err != nil {
+		log.Error("GetCFNRoleARN", "Error", err)
+		pruneStackChan <- false
+		return
+	}
+
 	//filter stacks based on StackName for a given service
 	stackList := make([]*cfnlib.Stack, 0)
 	var nextToken *string
@@ -144,7 +153,28 @@ func pruneStacks(log log15.Logger, region *conf.Region,
 
 	var pruneList []*cfnlib.Stack
 
-	if elbFilter {
+	if region.DNSToInstances() || region.DNSToStacks() {
+
+		var getListSuccess bool
+		pruneList, getListSuccess = getDNSPruneList(log, serviceName,
+			environment, stackList, roleSession)
+
+		if !getListSuccess {
+			pruneStackChan <- false
+			return
+		}
+	} else if environment.Compute == conf.Compute_ECS &&
+		region.PrimaryTopology() == conf.Topology_Inet {
+
+		var getListSuccess bool
+		pruneList, getListSuccess = getECSPruneList(log, serviceName,
+			environment, stackList, roleSession)
+
+		if !getListSuccess {
+			pruneStackChan <- false
+			return
+		}
+	} else if elbFilter {
 
 		var getListSuccess bool
 		pruneList, getListSuccess = getELBPruneList(log, environment,
@@ -165,18 +195,43 @@ func pruneStacks(log log15.Logger, region *conf.Region,
 	for i, stack := range pruneList {
 		if i >= keepCount {
 
-			log.Info("DeleteStack", "StackId", *stack.StackId)
-			err := cloudformation.DeleteStack(cfnClient, *stack.StackId)
-			if err != nil {
-				log.Error("DeleteStack", "StackId", *stack.StackId, "Error", err)
+			if !promote.DrainStack(log, roleSession, environment, region, *stack.StackId) {
+				pruneStackChan <- false
+				return
+			}
+
+			if !provision.DeleteStack(log, roleSession, *stack.StackId, cfnRoleARN) {
 				pruneStackChan <- false
 				return
 			}
+
+			events.Emit(events.Pruned{
+				Header:  events.NewHeader(serviceName, "", environment.Name, region.Name, *stack.StackId),
+				StackId: *stack.StackId,
+			})
 		} else {
 			log.Info("Keeping stack", "StackId", *stack.StackId)
 		}
 	}
 
+	if !pruneOrphans(log, roleSession, serviceName, environment.Name, stackName, cfnRoleARN,
+		region.DNSToInstances() || region.DNSToStacks()) {
+		pruneStackChan <- false
+		return
+	}
+
+	if environment.CommandQueue && !pruneCommandQueues(log, roleSession, serviceName, environment.Name) {
+		pruneStackChan <- false
+		return
+	}
+
+	// instances of deleted stacks may not have removed their own records
+	if region.DNSToInstances() &&
+		!promote.SyncInstances(log, roleSession, serviceName, environment.Name, region) {
+		pruneStackChan <- false
+		return
+	}
+
 	pruneStackChan <- true
 	return
 }
@@ -284,3 +339,59 @@ func getELBPruneList(log log15.Logger, environment *conf.Environment,
 	success = true
 	return
 }
+
+// getDNSPruneList is every stack except the one promote pointed DNS at
+func getDNSPruneList(log log15.Logger, serviceName string, environment *conf.Environment,
+	stackList []*cfnlib.Stack, roleSession *session.Session) (pruneList []*cfnlib.Stack, success bool) {
+
+	promotedStackId, err := promote.PromotedStackId(roleSession, serviceName, environment.Name)
+	if err != nil {
+		log.Error("PromotedStackId", "Error", err)
+		return
+	}
+	if promotedStackId == "" {
+		log.Error("No stack has been promoted into DNS")
+		return
+	}
+
+	log.Info("Found stack in DNS", "StackId", promotedStackId)
+
+	pruneList = make([]*cfnlib.Stack, 0)
+	for _, stack := range stackList {
+		if *stack.StackId != promotedStackId {
+			pruneList = append(pruneList, stack)
+		}
+	}
+
+	success = true
+	return
+}
+
+// getECSPruneList is every stack except the one promote pointed the
+// environment's ECS load balancer at. The load balancer is in its own stack
+// which doesn't share the service's stack prefix so it's never pruned
+func getECSPruneList(log log15.Logger, serviceName string, environment *conf.Environment,
+	stackList []*cfnlib.Stack, roleSession *session.Session) (pruneList []*cfnlib.Stack, success bool) {
+
+	promotedStackId, err := promote.ECSPromotedStackId(roleSession, serviceName, environment.Name)
+	if err != nil {
+		log.Error("ECSPromotedStackId", "Error", err)
+		return
+	}
+	if promotedStackId == "" {
+		log.Error("No stack has been promoted into the ECS load balancer")
+		return
+	}
+
+	log.Info("Found stack in the ECS load balancer", "StackId", promotedStackId)
+
+	pruneList = make([]*cfnlib.Stack, 0)
+	for _, stack := range stackList {
+		if *stack.StackId != promotedStackId {
+			pruneList = append(pruneList, stack)
+		}
+	}
+
+	success = true
+	return
+}
@@ -0,0 +1,111 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package secrets
+
+import (
+	"crypto/sha256"
+	"sort"
+	"strings"
+)
+
+const (
+	DiffNameHostSecrets        = "host secrets"
+	DiffNameDockerRegistry     = "docker registry"
+	DiffNameDockerPullUsername = "docker pull username"
+	DiffNameDockerPullPassword = "docker pull password"
+)
+
+// PayloadDiff names the secrets that differ between two payloads. It never
+// holds secret values so it's safe to log
+type PayloadDiff struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+func (recv PayloadDiff) Empty() bool {
+	return len(recv.Added) == 0 && len(recv.Removed) == 0 && len(recv.Changed) == 0
+}
+
+// DiffPayloads compares the secrets of a deployed payload with the secrets a
+// provision would upload.
+//
+// Container secrets are named container/KEY. Values are reduced to checksums
+// before they're compared
+func DiffPayloads(deployed, resolved Payload) (diff PayloadDiff) {
+	deployedSums := payloadChecksums(deployed)
+	resolvedSums := payloadChecksums(resolved)
+
+	for name, resolvedSum := range resolvedSums {
+		deployedSum, exists := deployedSums[name]
+		if !exists {
+			diff.Added = append(diff.Added, name)
+		} else if deployedSum != resolvedSum {
+			diff.Changed = append(diff.Changed, name)
+		}
+	}
+
+	for name := range deployedSums {
+		if _, exists := resolvedSums[name]; !exists {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return
+}
+
+func payloadChecksums(payload Payload) map[string][sha256.Size]byte {
+	sums := make(map[string][sha256.Size]byte)
+
+	if len(payload.HostSecrets) > 0 {
+		sums[DiffNameHostSecrets] = sha256.Sum256(payload.HostSecrets)
+	}
+
+	// the docker pull settings come from the environment of the build box.
+	// unset values aren't uploaded as secrets
+	for name, value := range map[string]string{
+		DiffNameDockerRegistry:     payload.DockerRegistry,
+		DiffNameDockerPullUsername: payload.DockerPullUsername,
+		DiffNameDockerPullPassword: payload.DockerPullPassword,
+	} {
+		if value != "" {
+			sums[name] = sha256.Sum256([]byte(value))
+		}
+	}
+
+	for containerName, envFile := range payload.ContainerSecrets {
+		containerName = originalContainerName(containerName)
+
+		for _, line := range strings.Split(envFile, "\n") {
+			kvp := strings.SplitN(line, "=", 2)
+			if len(kvp) != 2 {
+				continue
+			}
+
+			sums[containerName+"/"+kvp[0]] = sha256.Sum256([]byte(kvp[1]))
+		}
+	}
+
+	return sums
+}
+
+// originalContainerName strips what pack adds to a container's name. '-' is
+// reserved in container names so the original name follows the last one
+func originalContainerName(name string) string {
+	if i := strings.LastIndex(name, "-"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
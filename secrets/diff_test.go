@@ -0,0 +1,65 @@
+package secrets_test
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/secrets"
+)
+
+var _ = Describe("DiffPayloads", func() {
+
+	It("names added, removed, and changed secrets", func() {
+
+		deployed := secrets.Payload{
+			HostSecrets: []byte("host"),
+			ContainerSecrets: map[string]string{
+				"s3/s3:porter-1.0.0-1480000000-primary": "KEPT=a\nCHANGED=b\nREMOVED=c",
+			},
+			DockerPullPassword: "password",
+		}
+
+		resolved := secrets.Payload{
+			HostSecrets: []byte("host"),
+			ContainerSecrets: map[string]string{
+				"primary": "KEPT=a\nCHANGED=bb\nADDED=d",
+			},
+			DockerPullPassword: "new password",
+		}
+
+		diff := secrets.DiffPayloads(deployed, resolved)
+
+		Expect(diff.Added).To(Equal([]string{"primary/ADDED"}))
+		Expect(diff.Removed).To(Equal([]string{"primary/REMOVED"}))
+		Expect(diff.Changed).To(Equal([]string{secrets.DiffNameDockerPullPassword, "primary/CHANGED"}))
+		Expect(diff.Empty()).To(BeFalse())
+	})
+
+	It("is empty for the same secrets", func() {
+
+		payload := secrets.Payload{
+			HostSecrets:      []byte("host"),
+			ContainerSecrets: map[string]string{"primary": "KEY=value"},
+		}
+
+		Expect(secrets.DiffPayloads(payload, payload).Empty()).To(BeTrue())
+	})
+
+	It("never includes secret values", func() {
+
+		deployed := secrets.Payload{
+			ContainerSecrets: map[string]string{"primary": "KEY=deployed-value"},
+		}
+
+		resolved := secrets.Payload{
+			ContainerSecrets: map[string]string{"primary": "KEY=resolved-value"},
+		}
+
+		diff := fmt.Sprintf("%+v", secrets.DiffPayloads(deployed, resolved))
+
+		Expect(diff).NotTo(ContainSubstring("deployed-value"))
+		Expect(diff).NotTo(ContainSubstring("resolved-value"))
+	})
+})
@@ -12,17 +12,17 @@
 package secrets
 
 import (
-	"bytes"
-	"encoding/gob"
-	"encoding/hex"
 	"io/ioutil"
 	"os"
 
+	"github.com/adobe-platform/porter/aws/kms"
 	"github.com/adobe-platform/porter/aws_session"
 	"github.com/adobe-platform/porter/conf"
 	"github.com/adobe-platform/porter/constants"
 	"github.com/adobe-platform/porter/util"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/inconshreveable/log15"
@@ -33,15 +33,28 @@ func Download(log log15.Logger, region *conf.Region) (secretsPayload Payload, su
 	log.Debug("secrets.Download() BEGIN")
 	defer log.Debug("secrets.Download() END")
 
-	symmetricKey, secretsLocation, getSecretsKeySuccess := getSecretsKey(log, region.Name)
+	stack, describeStackSuccess := describeStack(log, region.Name)
+	if !describeStackSuccess {
+		return
+	}
+
+	return DownloadStack(log, aws_session.Get(region.Name), region.S3Bucket, stack)
+}
+
+// DownloadStack gets the secrets that were uploaded for a stack using its
+// secrets stack parameters
+func DownloadStack(log log15.Logger, regionSession *session.Session, s3Bucket string,
+	stack *cloudformation.Stack) (secretsPayload Payload, success bool) {
+
+	symmetricKey, secretsLocation, checksum, getSecretsKeySuccess := getSecretsKey(log, regionSession, stack)
 	if !getSecretsKeySuccess {
 		return
 	}
 
-	s3Client := s3.New(aws_session.Get(region.Name))
+	s3Client := s3.New(regionSession)
 
 	getObjectInput := &s3.GetObjectInput{
-		Bucket: aws.String(region.S3Bucket),
+		Bucket: aws.String(s3Bucket),
 		Key:    aws.String(secretsLocation),
 	}
 
@@ -58,17 +71,16 @@ func Download(log log15.Logger, region *conf.Region) (secretsPayload Payload, su
 		return
 	}
 
-	secretsPayloadBytes, err := Decrypt(secretsPayloadBytesEnc, symmetricKey)
+	// fails if the secrets weren't uploaded for this stack's service payload
+	secretsPayloadBytes, err := DecryptBound(secretsPayloadBytesEnc, symmetricKey, []byte(checksum))
 	if err != nil {
-		log.Crit("secrets.Decrypt", "Error", err)
+		log.Crit("secrets.DecryptBound", "Error", err)
 		return
 	}
 
-	secretsPayload = Payload{}
-
-	err = gob.NewDecoder(bytes.NewReader(secretsPayloadBytes)).Decode(&secretsPayload)
+	secretsPayload, err = Unpack(secretsPayloadBytes)
 	if err != nil {
-		log.Crit("gob.Decode", "Error", err)
+		log.Crit("secrets.Unpack", "Error", err)
 		return
 	}
 
@@ -76,10 +88,28 @@ func Download(log log15.Logger, region *conf.Region) (secretsPayload Payload, su
 	return
 }
 
-func getSecretsKey(log log15.Logger, region string) (symmetricKey []byte, secretsPayloadLoc string, success bool) {
+// StackKey is the symmetric key of the stack's secrets
+func StackKey(log log15.Logger, regionSession *session.Session,
+	stack *cloudformation.Stack) (symmetricKey []byte, success bool) {
 
-	log.Debug("getSecretsKey() BEGIN")
-	defer log.Debug("getSecretsKey() END")
+	symmetricKey, _, _, success = getSecretsKey(log, regionSession, stack)
+	return
+}
+
+// HostStackKey is the symmetric key of the secrets of the stack of the host
+// this is running on
+func HostStackKey(log log15.Logger, regionName string) (symmetricKey []byte, success bool) {
+
+	stack, describeStackSuccess := describeStack(log, regionName)
+	if !describeStackSuccess {
+		return
+	}
+
+	return StackKey(log, aws_session.Get(regionName), stack)
+}
+
+// describeStack describes the stack of the host this is running on
+func describeStack(log log15.Logger, region string) (stack *cloudformation.Stack, success bool) {
 
 	var (
 		describeStacksOutput *cloudformation.DescribeStacksOutput
@@ -114,21 +144,29 @@ func getSecretsKey(log log15.Logger, region string) (symmetricKey []byte, secret
 		return
 	}
 
-	stack := describeStacksOutput.Stacks[0]
+	stack = describeStacksOutput.Stacks[0]
+	success = true
+	return
+}
+
+func getSecretsKey(log log15.Logger, regionSession *session.Session,
+	stack *cloudformation.Stack) (symmetricKey []byte, secretsPayloadLoc, checksum string, success bool) {
+
+	log.Debug("getSecretsKey() BEGIN")
+	defer log.Debug("getSecretsKey() END")
+
+	var encodedKey string
+
 	for _, param := range stack.Parameters {
 		switch *param.ParameterKey {
 		case constants.ParameterSecretsKey:
-			symmetricKey, err = hex.DecodeString(*param.ParameterValue)
-			if err != nil {
-				log.Crit("hex.DecodeString", "Error", err)
-				return
-			}
+			encodedKey = *param.ParameterValue
 		case constants.ParameterSecretsLoc:
 			secretsPayloadLoc = *param.ParameterValue
 		}
 	}
 
-	if len(symmetricKey) == 0 {
+	if len(encodedKey) == 0 {
 		log.Crit("missing parameter key " + constants.ParameterSecretsKey)
 		return
 	}
@@ -138,6 +176,32 @@ func getSecretsKey(log log15.Logger, region string) (symmetricKey []byte, secret
 		return
 	}
 
+	checksum, err := ChecksumFromLocation(secretsPayloadLoc)
+	if err != nil {
+		log.Crit("ChecksumFromLocation", "Error", err)
+		return
+	}
+
+	kmsClient := func() *kms.KMS {
+		return kms.New(regionSession)
+	}
+
+	// a new stack's hosts can boot before the KMS grant that lets them decrypt
+	// the data key is usable. Other errors aren't worth waiting for
+	retryMsg := func(i int) { log.Warn("DecodeKey retrying", "Count", i) }
+	util.SuccessRetryer(7, retryMsg, func() bool {
+		symmetricKey, err = DecodeKey(kmsClient, encodedKey, checksum)
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "AccessDeniedException" {
+			log.Warn("kms:Decrypt isn't allowed yet", "Error", err)
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		log.Crit("DecodeKey", "Error", err)
+		return
+	}
+
 	success = true
 	return
 }
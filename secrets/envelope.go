@@ -0,0 +1,184 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package secrets
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/adobe-platform/porter/aws/kms"
+)
+
+// With envelope encryption the secrets key stack parameter holds the data key
+// encrypted under a KMS key instead of the data key itself
+const kmsKeyPrefix = "kms:"
+
+// EncryptionContextChecksum is the encryption context key data keys are bound
+// to their service payload with
+const EncryptionContextChecksum = "porter:payload-checksum"
+
+// EncodeKey is the value of the secrets key stack parameter for a symmetric
+// key generated with GenerateKey
+func EncodeKey(symmetricKey []byte) string {
+	return hex.EncodeToString(symmetricKey)
+}
+
+// GenerateDataKey creates a per-deployment data key under the KMS key. The
+// plaintext key encrypts the secrets payload and the encoded key is the value
+// of the secrets key stack parameter.
+//
+// The data key can only be decrypted for the service payload it was generated
+// for. keyArn is the KMS key's ARN even if kmsKeyId is an alias
+func GenerateDataKey(kmsClient *kms.KMS, kmsKeyId, checksum string) (symmetricKey []byte, encodedKey, keyArn string, err error) {
+
+	output, err := kmsClient.GenerateDataKey(&kms.GenerateDataKeyInput{
+		KeyId:             kmsKeyId,
+		KeySpec:           "AES_256",
+		EncryptionContext: encryptionContext(checksum),
+	})
+	if err != nil {
+		return
+	}
+
+	if len(output.Plaintext) != AesBytes {
+		err = errors.New("kms:GenerateDataKey returned an invalid data key")
+		return
+	}
+
+	symmetricKey = output.Plaintext
+	encodedKey = kmsKeyPrefix + base64.StdEncoding.EncodeToString(output.CiphertextBlob)
+	keyArn = output.KeyId
+	return
+}
+
+// CreateGrant allows the role to decrypt the data keys generated for the
+// service payload and nothing else. The grant is named after the stack so
+// RevokeGrants can find it
+func CreateGrant(kmsClient *kms.KMS, keyArn, roleArn, stackName, checksum string) (grantId string, err error) {
+
+	output, err := kmsClient.CreateGrant(&kms.CreateGrantInput{
+		KeyId:            keyArn,
+		GranteePrincipal: roleArn,
+		Operations:       []string{kms.GrantOperation_Decrypt},
+		Constraints: &kms.GrantConstraints{
+			EncryptionContextSubset: encryptionContext(checksum),
+		},
+		Name: stackName,
+	})
+	if err != nil {
+		return
+	}
+
+	grantId = output.GrantId
+	return
+}
+
+// RevokeGrants revokes every grant CreateGrant created for the stack. It's the
+// number of grants revoked
+func RevokeGrants(kmsClient *kms.KMS, keyArn, stackName string) (revoked int, err error) {
+
+	input := &kms.ListGrantsInput{
+		KeyId: keyArn,
+	}
+
+	grantIds := make([]string, 0)
+	for {
+		var output *kms.ListGrantsOutput
+		output, err = kmsClient.ListGrants(input)
+		if err != nil {
+			return
+		}
+
+		for _, grant := range output.Grants {
+			if grant.Name == stackName {
+				grantIds = append(grantIds, grant.GrantId)
+			}
+		}
+
+		if !output.Truncated {
+			break
+		}
+		input.Marker = output.NextMarker
+	}
+
+	// revoking while listing would shift the pages
+	for _, grantId := range grantIds {
+		_, err = kmsClient.RevokeGrant(&kms.RevokeGrantInput{
+			KeyId:   keyArn,
+			GrantId: grantId,
+		})
+		if err != nil {
+			return
+		}
+		revoked++
+	}
+	return
+}
+
+// DecodeKey turns the secrets key stack parameter back into a symmetric key,
+// calling kms:Decrypt if it's a data key. kmsClient is only used for data keys
+func DecodeKey(kmsClient func() *kms.KMS, encodedKey, checksum string) (symmetricKey []byte, err error) {
+
+	if !strings.HasPrefix(encodedKey, kmsKeyPrefix) {
+		symmetricKey, err = hex.DecodeString(encodedKey)
+		return
+	}
+
+	ciphertextBlob, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encodedKey, kmsKeyPrefix))
+	if err != nil {
+		return
+	}
+
+	// the KMS key id is part of the ciphertext which is why a rotated or
+	// replaced key doesn't need to be tracked here
+	output, err := kmsClient().Decrypt(&kms.DecryptInput{
+		CiphertextBlob:    ciphertextBlob,
+		EncryptionContext: encryptionContext(checksum),
+	})
+	if err != nil {
+		return
+	}
+
+	symmetricKey = output.Plaintext
+	return
+}
+
+// Location is where the secrets payload for a service payload is uploaded.
+// The checksum in the name is what binds the secrets to the service payload
+func Location(s3KeyRoot, checksum string) string {
+	return s3KeyRoot + "/" + checksum + ".secrets"
+}
+
+// ChecksumFromLocation is the service payload checksum the secrets at the
+// location were encrypted for
+func ChecksumFromLocation(location string) (checksum string, err error) {
+	name := path.Base(location)
+	if !strings.HasSuffix(name, ".secrets") {
+		err = errors.New("secrets location doesn't end in .secrets")
+		return
+	}
+
+	checksum = strings.TrimSuffix(name, ".secrets")
+	if checksum == "" {
+		err = errors.New("secrets location is missing the service payload checksum")
+	}
+	return
+}
+
+func encryptionContext(checksum string) map[string]string {
+	return map[string]string{
+		EncryptionContextChecksum: checksum,
+	}
+}
@@ -0,0 +1,219 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package secrets
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// packedMagic starts a packed payload. Payloads without it are a gob encoded
+// Payload from a porter that didn't pack them
+var packedMagic = []byte("porter-secrets-v2\n")
+
+type (
+	// Limits are what Pack checks before a payload is uploaded
+	Limits struct {
+		// MaxSize is the most bytes the packed payload can be
+		MaxSize int
+
+		// AllowBinary names the containers, as they're named in
+		// .porter/config, whose secrets can be binary
+		AllowBinary []string
+
+		// AllowBinaryHost lets host secrets be binary
+		AllowBinaryHost bool
+	}
+
+	// packedPayload is a Payload whose containers with the same secrets
+	// share one copy of them
+	packedPayload struct {
+		HostSecrets        []byte
+		EnvFiles           []string
+		ContainerEnvFiles  map[string]int
+		DockerRegistry     string
+		DockerPullUsername string
+		DockerPullPassword string
+	}
+
+	source struct {
+		name string
+		size int
+	}
+)
+
+// IsBinary is true if the secrets aren't UTF-8 text or have a NUL
+func IsBinary(data []byte) bool {
+	return !utf8.Valid(data) || bytes.IndexByte(data, 0) != -1
+}
+
+// Pack checks the payload's secrets against the limits and compresses it
+func Pack(payload Payload, limits Limits) ([]byte, error) {
+
+	if len(payload.HostSecrets) > 0 && !limits.AllowBinaryHost && IsBinary(payload.HostSecrets) {
+		return nil, fmt.Errorf("host secrets are binary. Allow them with secrets_payload allow_binary_host")
+	}
+
+	allowBinary := make(map[string]bool)
+	for _, name := range limits.AllowBinary {
+		allowBinary[name] = true
+	}
+
+	packed := packedPayload{
+		HostSecrets:        payload.HostSecrets,
+		ContainerEnvFiles:  make(map[string]int),
+		DockerRegistry:     payload.DockerRegistry,
+		DockerPullUsername: payload.DockerPullUsername,
+		DockerPullPassword: payload.DockerPullPassword,
+	}
+
+	// sorted so the same secrets pack the same way
+	containerNames := make([]string, 0, len(payload.ContainerSecrets))
+	for containerName := range payload.ContainerSecrets {
+		containerNames = append(containerNames, containerName)
+	}
+	sort.Strings(containerNames)
+
+	envFileIndex := make(map[string]int)
+
+	for _, containerName := range containerNames {
+		envFile := payload.ContainerSecrets[containerName]
+		originalName := originalContainerName(containerName)
+
+		if !allowBinary[originalName] && IsBinary([]byte(envFile)) {
+			return nil, fmt.Errorf("the secrets of container %s are binary. Allow them with secrets_payload allow_binary", originalName)
+		}
+
+		index, exists := envFileIndex[envFile]
+		if !exists {
+			index = len(packed.EnvFiles)
+			envFileIndex[envFile] = index
+			packed.EnvFiles = append(packed.EnvFiles, envFile)
+		}
+		packed.ContainerEnvFiles[containerName] = index
+	}
+
+	var buf bytes.Buffer
+	buf.Write(packedMagic)
+
+	zstdWriter, err := zstd.NewWriter(&buf, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+	if err != nil {
+		return nil, err
+	}
+
+	err = gob.NewEncoder(zstdWriter).Encode(packed)
+	if err != nil {
+		return nil, err
+	}
+
+	err = zstdWriter.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if limits.MaxSize > 0 && buf.Len() > limits.MaxSize {
+		return nil, fmt.Errorf("the secrets payload is %d bytes compressed which is over secrets_payload max_size %d. The largest secrets are %s",
+			buf.Len(), limits.MaxSize, largestSources(payload))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unpack reads a payload that Pack made or one that was gob encoded without
+// being packed
+func Unpack(data []byte) (payload Payload, err error) {
+
+	if !bytes.HasPrefix(data, packedMagic) {
+		err = gob.NewDecoder(bytes.NewReader(data)).Decode(&payload)
+		return
+	}
+
+	zstdReader, err := zstd.NewReader(nil)
+	if err != nil {
+		return
+	}
+	defer zstdReader.Close()
+
+	gobBytes, err := zstdReader.DecodeAll(data[len(packedMagic):], nil)
+	if err != nil {
+		return
+	}
+
+	packed := packedPayload{}
+	err = gob.NewDecoder(bytes.NewReader(gobBytes)).Decode(&packed)
+	if err != nil {
+		return
+	}
+
+	payload = Payload{
+		HostSecrets:        packed.HostSecrets,
+		ContainerSecrets:   make(map[string]string),
+		DockerRegistry:     packed.DockerRegistry,
+		DockerPullUsername: packed.DockerPullUsername,
+		DockerPullPassword: packed.DockerPullPassword,
+	}
+
+	for containerName, index := range packed.ContainerEnvFiles {
+		if index < 0 || index >= len(packed.EnvFiles) {
+			err = fmt.Errorf("container %s has no secrets in the payload", containerName)
+			return
+		}
+		payload.ContainerSecrets[containerName] = packed.EnvFiles[index]
+	}
+
+	return
+}
+
+// largestSources names where the payload's bytes come from, largest first,
+// without their values
+func largestSources(payload Payload) string {
+	sources := make([]source, 0)
+
+	if len(payload.HostSecrets) > 0 {
+		sources = append(sources, source{name: DiffNameHostSecrets, size: len(payload.HostSecrets)})
+	}
+
+	for containerName, envFile := range payload.ContainerSecrets {
+		sources = append(sources, source{
+			name: "container " + originalContainerName(containerName),
+			size: len(envFile),
+		})
+	}
+
+	sort.SliceStable(sources, func(i, j int) bool {
+		if sources[i].size == sources[j].size {
+			return sources[i].name < sources[j].name
+		}
+		return sources[i].size > sources[j].size
+	})
+
+	if len(sources) == 0 {
+		return "the docker pull settings"
+	}
+
+	if len(sources) > 3 {
+		sources = sources[:3]
+	}
+
+	described := make([]string, 0, len(sources))
+	for _, s := range sources {
+		described = append(described, fmt.Sprintf("%s (%d bytes)", s.name, s.size))
+	}
+
+	return strings.Join(described, ", ")
+}
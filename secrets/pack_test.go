@@ -0,0 +1,90 @@
+package secrets_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/secrets"
+)
+
+var _ = Describe("Pack", func() {
+
+	payload := secrets.Payload{
+		HostSecrets: []byte("host"),
+		ContainerSecrets: map[string]string{
+			"s3/s3:porter-1.0.0-1480000000-primary": "SHARED=a",
+			"s3/s3:porter-1.0.0-1480000000-worker":  "SHARED=a",
+			"s3/s3:porter-1.0.0-1480000000-cron":    "OTHER=b",
+		},
+		DockerPullPassword: "password",
+	}
+
+	It("unpacks what it packed", func() {
+		packed, err := secrets.Pack(payload, secrets.Limits{})
+		Expect(err).To(BeNil())
+
+		unpacked, err := secrets.Unpack(packed)
+		Expect(err).To(BeNil())
+		Expect(unpacked).To(Equal(payload))
+	})
+
+	It("stores the same secrets once", func() {
+		big := strings.Repeat("KEY=0123456789abcdef\n", 1000)
+
+		shared, err := secrets.Pack(secrets.Payload{
+			ContainerSecrets: map[string]string{"a-primary": big, "a-worker": big},
+		}, secrets.Limits{})
+		Expect(err).To(BeNil())
+
+		single, err := secrets.Pack(secrets.Payload{
+			ContainerSecrets: map[string]string{"a-primary": big},
+		}, secrets.Limits{})
+		Expect(err).To(BeNil())
+
+		Expect(len(shared) - len(single)).To(BeNumerically("<", 64))
+	})
+
+	It("unpacks payloads that weren't packed", func() {
+		var buf bytes.Buffer
+		Expect(gob.NewEncoder(&buf).Encode(payload)).To(Succeed())
+
+		unpacked, err := secrets.Unpack(buf.Bytes())
+		Expect(err).To(BeNil())
+		Expect(unpacked).To(Equal(payload))
+	})
+
+	It("rejects payloads over the max size and names the largest secrets", func() {
+		_, err := secrets.Pack(payload, secrets.Limits{MaxSize: 10})
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("max_size 10"))
+		Expect(err.Error()).To(ContainSubstring("container cron (7 bytes)"))
+		Expect(err.Error()).NotTo(ContainSubstring("OTHER=b"))
+	})
+
+	It("rejects binary secrets that aren't allowed", func() {
+		binary := secrets.Payload{
+			HostSecrets: []byte{0x00, 0xff},
+			ContainerSecrets: map[string]string{
+				"s3/s3:porter-1.0.0-1480000000-primary": "KEY=\xff\xfe",
+			},
+		}
+
+		_, err := secrets.Pack(binary, secrets.Limits{})
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("host secrets"))
+
+		_, err = secrets.Pack(binary, secrets.Limits{AllowBinaryHost: true})
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("container primary"))
+
+		_, err = secrets.Pack(binary, secrets.Limits{
+			AllowBinaryHost: true,
+			AllowBinary:     []string{"primary"},
+		})
+		Expect(err).To(BeNil())
+	})
+})
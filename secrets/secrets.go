@@ -24,6 +24,12 @@ func GenerateKey() (symmetricKey []byte, err error) {
 }
 
 func Encrypt(payload, symmetricKey []byte) (gcmPayload []byte, err error) {
+	return EncryptBound(payload, symmetricKey, nil)
+}
+
+// EncryptBound authenticates binding along with the payload without
+// encrypting it. DecryptBound fails unless it's given the same binding
+func EncryptBound(payload, symmetricKey, binding []byte) (gcmPayload []byte, err error) {
 
 	if len(symmetricKey) != AesBytes {
 		err = errors.New("invalid symmetric key")
@@ -46,11 +52,15 @@ func Encrypt(payload, symmetricKey []byte) (gcmPayload []byte, err error) {
 		return
 	}
 
-	gcmPayload = gcmCipher.Seal(nonce, nonce, payload, nil)
+	gcmPayload = gcmCipher.Seal(nonce, nonce, payload, binding)
 	return
 }
 
 func Decrypt(gcmPayload, symmetricKey []byte) (payload []byte, err error) {
+	return DecryptBound(gcmPayload, symmetricKey, nil)
+}
+
+func DecryptBound(gcmPayload, symmetricKey, binding []byte) (payload []byte, err error) {
 
 	if len(symmetricKey) != AesBytes {
 		err = errors.New("invalid symmetric key")
@@ -76,6 +86,6 @@ func Decrypt(gcmPayload, symmetricKey []byte) (payload []byte, err error) {
 	nonce := gcmPayload[:nonceSize]
 	encPayload := gcmPayload[nonceSize:]
 
-	payload, err = gcmCipher.Open(nil, nonce, encPayload, nil)
+	payload, err = gcmCipher.Open(nil, nonce, encPayload, binding)
 	return
 }
@@ -1,10 +1,18 @@
 package secrets_test
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"github.com/adobe-platform/porter/aws/kms"
 	"github.com/adobe-platform/porter/secrets"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
 )
 
 var _ = Describe("Secrets", func() {
@@ -24,4 +32,144 @@ var _ = Describe("Secrets", func() {
 		Expect(originalPayload).To(Equal(payload))
 	})
 
+	It("Decrypt fails with a different binding", func() {
+
+		symmetricKey, err := secrets.GenerateKey()
+		Expect(err).To(BeNil())
+
+		payload := []byte("Super secret message")
+		encPayload, err := secrets.EncryptBound(payload, symmetricKey, []byte("checksum"))
+		Expect(err).To(BeNil())
+
+		originalPayload, err := secrets.DecryptBound(encPayload, symmetricKey, []byte("checksum"))
+		Expect(err).To(BeNil())
+		Expect(originalPayload).To(Equal(payload))
+
+		_, err = secrets.DecryptBound(encPayload, symmetricKey, []byte("other checksum"))
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("ChecksumFromLocation reverses Location", func() {
+
+		location := secrets.Location("porter-deployment/svc/prod/1.0", "abc123")
+		Expect(location).To(Equal("porter-deployment/svc/prod/1.0/abc123.secrets"))
+
+		checksum, err := secrets.ChecksumFromLocation(location)
+		Expect(err).To(BeNil())
+		Expect(checksum).To(Equal("abc123"))
+
+		_, err = secrets.ChecksumFromLocation("porter-deployment/svc/prod/1.0/abc123.tar")
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("DecodeKey decodes a symmetric key without KMS", func() {
+
+		symmetricKey, err := secrets.GenerateKey()
+		Expect(err).To(BeNil())
+
+		noKMS := func() *kms.KMS {
+			Fail("KMS shouldn't be called")
+			return nil
+		}
+
+		decodedKey, err := secrets.DecodeKey(noKMS, secrets.EncodeKey(symmetricKey), "checksum")
+		Expect(err).To(BeNil())
+		Expect(decodedKey).To(Equal(symmetricKey))
+	})
+
+	It("DecodeKey decrypts a data key with the checksum as encryption context", func() {
+
+		dataKey := make([]byte, secrets.AesBytes)
+		dataKey[0] = 1
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var input struct {
+				CiphertextBlob    []byte
+				EncryptionContext map[string]string
+			}
+			Expect(json.NewDecoder(r.Body).Decode(&input)).To(Succeed())
+
+			switch r.Header.Get("X-Amz-Target") {
+			case "TrentService.GenerateDataKey":
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"KeyId":          "arn:aws:kms:us-west-2:123456789012:key/key",
+					"Plaintext":      dataKey,
+					"CiphertextBlob": []byte(input.EncryptionContext["porter:payload-checksum"]),
+				})
+			case "TrentService.Decrypt":
+				// a real key fails to decrypt with a different context
+				if string(input.CiphertextBlob) != input.EncryptionContext["porter:payload-checksum"] {
+					w.WriteHeader(400)
+					w.Write([]byte(`{"__type":"InvalidCiphertextException"}`))
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"KeyId":     "key",
+					"Plaintext": dataKey,
+				})
+			}
+		}))
+		defer server.Close()
+
+		kmsClient := kms.New(session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		}))
+		getKMSClient := func() *kms.KMS { return kmsClient }
+
+		symmetricKey, encodedKey, keyArn, err := secrets.GenerateDataKey(kmsClient, "alias/porter", "checksum")
+		Expect(err).To(BeNil())
+		Expect(symmetricKey).To(Equal(dataKey))
+		Expect(encodedKey).To(HavePrefix("kms:"))
+		Expect(keyArn).To(Equal("arn:aws:kms:us-west-2:123456789012:key/key"))
+
+		decodedKey, err := secrets.DecodeKey(getKMSClient, encodedKey, "checksum")
+		Expect(err).To(BeNil())
+		Expect(decodedKey).To(Equal(dataKey))
+
+		_, err = secrets.DecodeKey(getKMSClient, encodedKey, "other checksum")
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("RevokeGrants revokes every page's grants named after the stack", func() {
+
+		revoked := make([]string, 0)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var input struct {
+				KeyId   string
+				Marker  string
+				GrantId string
+			}
+			Expect(json.NewDecoder(r.Body).Decode(&input)).To(Succeed())
+			Expect(input.KeyId).To(Equal("arn"))
+
+			switch r.Header.Get("X-Amz-Target") {
+			case "TrentService.ListGrants":
+				if input.Marker == "" {
+					w.Write([]byte(`{"Grants":[{"GrantId":"1","Name":"stack"},{"GrantId":"2","Name":"other"}],"NextMarker":"2","Truncated":true}`))
+				} else {
+					w.Write([]byte(`{"Grants":[{"GrantId":"3","Name":"stack"}],"Truncated":false}`))
+				}
+			case "TrentService.RevokeGrant":
+				revoked = append(revoked, input.GrantId)
+			}
+		}))
+		defer server.Close()
+
+		kmsClient := kms.New(session.New(&aws.Config{
+			Region:      aws.String("us-west-2"),
+			Endpoint:    aws.String(server.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:  aws.Int(0),
+		}))
+
+		count, err := secrets.RevokeGrants(kmsClient, "arn", "stack")
+		Expect(err).To(BeNil())
+		Expect(count).To(Equal(2))
+		Expect(revoked).To(Equal([]string{"1", "3"}))
+	})
+
 })
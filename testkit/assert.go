@@ -0,0 +1,146 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package testkit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/adobe-platform/porter/aws/elb"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+	elblib "github.com/aws/aws-sdk-go/service/elb"
+	"github.com/inconshreveable/log15"
+)
+
+const pollInterval = 10 * time.Second
+
+// assertStack checks the stack finished, its instances are in service, and
+// the service answers through the stack's ELB
+func assertStack(log log15.Logger, roleSession *session.Session, sandbox Sandbox,
+	regionState *provision_state.Region, report *Report) {
+
+	log = log.New("StackId", regionState.StackId)
+
+	if !report.add("stack complete", stackComplete(roleSession, regionState.StackId)) {
+		return
+	}
+
+	if regionState.ProvisionedELBName == "" {
+		report.add("elb healthy", errors.New("the stack has no ELB"))
+		return
+	}
+
+	deadline := time.Now().Add(sandbox.Timeout)
+	elbClient := elb.New(roleSession)
+
+	if !report.add("elb healthy", elbHealthy(log, elbClient, regionState.ProvisionedELBName, deadline)) {
+		return
+	}
+
+	report.add("container responds", containerResponds(log, elbClient, regionState.ProvisionedELBName, deadline))
+}
+
+func stackComplete(roleSession *session.Session, stackId string) error {
+	output, err := cloudformation.New(roleSession).DescribeStacks(&cfnlib.DescribeStacksInput{
+		StackName: aws.String(stackId),
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(output.Stacks) != 1 {
+		return fmt.Errorf("expected 1 stack but found %d", len(output.Stacks))
+	}
+
+	switch status := aws.StringValue(output.Stacks[0].StackStatus); status {
+	case cfnlib.StackStatusCreateComplete, cfnlib.StackStatusUpdateComplete:
+		return nil
+	default:
+		return fmt.Errorf("the stack is %s", status)
+	}
+}
+
+// elbHealthy waits for every instance behind the ELB to be InService
+func elbHealthy(log log15.Logger, elbClient *elblib.ELB, elbName string, deadline time.Time) error {
+	log = log.New("LoadBalancerName", elbName)
+
+	for {
+		instanceStates, err := elb.DescribeInstanceHealth(elbClient, elbName)
+		if err != nil {
+			return err
+		}
+
+		inService := 0
+		for _, instanceState := range instanceStates {
+			if aws.StringValue(instanceState.State) == "InService" {
+				inService++
+			}
+		}
+
+		if len(instanceStates) > 0 && inService == len(instanceStates) {
+			log.Info("ELB is healthy", "InService", inService)
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%d of %d instances are InService", inService, len(instanceStates))
+		}
+
+		log.Info("Waiting for instances to be InService", "InService", inService, "Instances", len(instanceStates))
+		time.Sleep(pollInterval)
+	}
+}
+
+// containerResponds waits for a 200 from the service's health check through
+// the ELB
+func containerResponds(log log15.Logger, elbClient *elblib.ELB, elbName string, deadline time.Time) error {
+	descriptions, err := elb.DescribeLoadBalancers(elbClient, elbName)
+	if err != nil {
+		return err
+	}
+
+	if len(descriptions) != 1 {
+		return fmt.Errorf("expected 1 ELB but found %d", len(descriptions))
+	}
+
+	url := "http://" + aws.StringValue(descriptions[0].DNSName) + HealthPath
+	log = log.New("URL", url)
+
+	client := &http.Client{Timeout: pollInterval}
+
+	for {
+		// the ELB's DNS name can take a moment to resolve
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+
+			if resp.StatusCode == http.StatusOK {
+				log.Info("The service responded")
+				return nil
+			}
+			err = fmt.Errorf("GET %s returned %d", url, resp.StatusCode)
+		}
+
+		if time.Now().After(deadline) {
+			return err
+		}
+
+		log.Info("Waiting for the service to respond", "Error", err)
+		time.Sleep(pollInterval)
+	}
+}
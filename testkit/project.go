@@ -0,0 +1,164 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package testkit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/adobe-platform/porter/constants"
+)
+
+// HealthPath is served by the generated service with a 200
+const HealthPath = "/health"
+
+// the service is busybox's httpd serving a file at the health check path so
+// pack has nothing to compile
+const dockerfile = `FROM busybox:1.36
+
+RUN mkdir -p /www && echo ok > /www` + HealthPath + `
+
+EXPOSE 3000
+
+CMD ["httpd", "-f", "-p", "3000", "-h", "/www"]
+`
+
+var configTemplate = template.Must(template.New("config").Parse(`service_name: {{.ServiceName}}
+
+porter_version: {{.PorterVersion}}
+
+environments:
+- name: {{.Environment}}
+  role_arn: {{.RoleARN}}
+  regions:
+  - name: {{.Region}}
+    s3_bucket: {{.S3Bucket}}
+{{- if .VpcId}}
+    vpc_id: {{.VpcId}}
+{{- end}}
+    azs:
+{{- range .AZs}}
+    - name: {{.Name}}
+{{- if .SubnetId}}
+      subnet_id: {{.SubnetId}}
+{{- end}}
+{{- end}}
+    containers:
+    - name: primary
+      topology: inet
+      health_check:
+        method: GET
+        path: ` + HealthPath + `
+`))
+
+type (
+	configData struct {
+		ServiceName   string
+		PorterVersion string
+		Environment   string
+		RoleARN       string
+		Region        string
+		S3Bucket      string
+		VpcId         string
+		AZs           []azData
+	}
+
+	azData struct {
+		Name     string
+		SubnetId string
+	}
+)
+
+// Config is the .porter/config of the generated service
+func Config(serviceName string, sandbox Sandbox) ([]byte, error) {
+	if len(sandbox.AZs) == 0 {
+		return nil, errors.New("the sandbox needs at least one availability zone")
+	}
+
+	if sandbox.VpcId != "" && len(sandbox.SubnetIds) != len(sandbox.AZs) {
+		return nil, errors.New("a sandbox vpc needs one subnet per availability zone")
+	}
+
+	data := configData{
+		ServiceName:   serviceName,
+		PorterVersion: sandbox.PorterVersion,
+		Environment:   EnvironmentName,
+		RoleARN:       sandbox.RoleARN,
+		Region:        sandbox.Region,
+		S3Bucket:      sandbox.S3Bucket,
+		VpcId:         sandbox.VpcId,
+	}
+
+	for i, az := range sandbox.AZs {
+		azd := azData{Name: az}
+		if sandbox.VpcId != "" {
+			azd.SubnetId = sandbox.SubnetIds[i]
+		}
+		data.AZs = append(data.AZs, azd)
+	}
+
+	buf := new(bytes.Buffer)
+	err := configTemplate.Execute(buf, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// WriteProject writes the generated service into dir and commits it. pack
+// versions the service with the commit
+func WriteProject(dir, serviceName string, sandbox Sandbox) error {
+	configBytes, err := Config(serviceName, sandbox)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Join(dir, filepath.Dir(constants.ConfigPath)), 0755)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, constants.ConfigPath), configBytes, 0644)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte(dockerfile), 0644)
+	if err != nil {
+		return err
+	}
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=porter testkit", "-c", "user.email=testkit@localhost",
+			"commit", "-q", "-m", serviceName},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("git %s: %s %s", strings.Join(args, " "), err, output)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package testkit
+
+import (
+	"strings"
+
+	"github.com/adobe-platform/porter/aws/cloudformation"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	cfnlib "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/inconshreveable/log15"
+)
+
+// the S3 prefixes provision uploads a service's payloads and templates under
+var s3KeyPrefixes = []string{
+	"porter-template",
+	"porter-deployment",
+	"porter-history",
+}
+
+// teardown deletes every stack of the service, including ones a failed
+// provision left behind, and the objects provision uploaded. Every stack name
+// starts with the service name which is unique to the run
+func teardown(log log15.Logger, roleSession *session.Session, sandbox Sandbox, serviceName string) (success bool) {
+
+	log.Info("Tearing down the sandbox")
+
+	cfnClient := cloudformation.New(roleSession)
+
+	stackIds := make([]string, 0)
+	err := cfnClient.DescribeStacksPages(&cfnlib.DescribeStacksInput{},
+		func(page *cfnlib.DescribeStacksOutput, lastPage bool) bool {
+			for _, stack := range page.Stacks {
+				if strings.HasPrefix(aws.StringValue(stack.StackName), serviceName+"-") {
+					stackIds = append(stackIds, aws.StringValue(stack.StackId))
+				}
+			}
+			return true
+		})
+	if err != nil {
+		log.Error("cloudformation:DescribeStacks", "Error", err)
+		return
+	}
+
+	for _, stackId := range stackIds {
+		log.Info("DeleteStack", "StackId", stackId)
+		err = cloudformation.DeleteStack(cfnClient, stackId, "")
+		if err != nil {
+			log.Error("cloudformation:DeleteStack", "StackId", stackId, "Error", err)
+			return
+		}
+	}
+
+	for _, stackId := range stackIds {
+		err = cfnClient.WaitUntilStackDeleteComplete(&cfnlib.DescribeStacksInput{
+			StackName: aws.String(stackId),
+		})
+		if err != nil {
+			log.Error("WaitUntilStackDeleteComplete", "StackId", stackId, "Error", err)
+			return
+		}
+	}
+
+	if !deleteObjects(log, s3.New(roleSession), sandbox.S3Bucket, serviceName) {
+		return
+	}
+
+	log.Info("Tore down the sandbox", "Stacks", len(stackIds))
+	success = true
+	return
+}
+
+func deleteObjects(log log15.Logger, client *s3.S3, bucket, serviceName string) (success bool) {
+	log = log.New("Bucket", bucket)
+
+	for _, prefix := range s3KeyPrefixes {
+		prefix = prefix + "/" + serviceName + "/"
+
+		var deleteErr error
+		err := client.ListObjectsPages(&s3.ListObjectsInput{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(prefix),
+		}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
+			if len(page.Contents) == 0 {
+				return true
+			}
+
+			objects := make([]*s3.ObjectIdentifier, 0, len(page.Contents))
+			for _, object := range page.Contents {
+				objects = append(objects, &s3.ObjectIdentifier{Key: object.Key})
+			}
+
+			_, deleteErr = client.DeleteObjects(&s3.DeleteObjectsInput{
+				Bucket: aws.String(bucket),
+				Delete: &s3.Delete{Objects: objects},
+			})
+			return deleteErr == nil
+		})
+		if err == nil {
+			err = deleteErr
+		}
+		if err != nil {
+			log.Error("Failed to delete the service's objects", "Prefix", prefix, "Error", err)
+			return
+		}
+	}
+
+	success = true
+	return
+}
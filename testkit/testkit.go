@@ -0,0 +1,235 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+
+// Package testkit deploys a minimal porter service into a sandbox account,
+// checks it came up, and tears it down. It's used to validate a porter
+// release before services upgrade to it
+package testkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/adobe-platform/porter/aws_session"
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/provision_state"
+	"github.com/inconshreveable/log15"
+)
+
+// EnvironmentName is the environment of the generated .porter/config
+const EnvironmentName = "sandbox"
+
+const DefaultTimeout = 45 * time.Minute
+
+type (
+	// Sandbox is where the test service is deployed. The account behind
+	// RoleARN should be one nothing else runs in
+	Sandbox struct {
+		RoleARN  string
+		Region   string
+		AZs      []string
+		S3Bucket string
+
+		// optional. The service runs in the default VPC without it
+		VpcId     string
+		SubnetIds []string
+
+		// PorterVersion hosts download. Defaults to the running porter's
+		// version
+		PorterVersion string
+
+		// Porter is the binary that deploys the service. Defaults to the
+		// running executable
+		Porter string
+
+		// Keep leaves the stacks, S3 objects, and project directory behind
+		// to debug a failure
+		Keep bool
+
+		// Timeout bounds waiting for the service to become healthy
+		Timeout time.Duration
+	}
+
+	Report struct {
+		ServiceName string      `json:"service_name"`
+		Region      string      `json:"region"`
+		Dir         string      `json:"dir,omitempty"`
+		Assertions  []Assertion `json:"assertions"`
+		TornDown    bool        `json:"torn_down"`
+	}
+
+	Assertion struct {
+		Name   string `json:"name"`
+		Passed bool   `json:"passed"`
+		Error  string `json:"error,omitempty"`
+	}
+)
+
+// Passed is true if every assertion ran and passed
+func (recv *Report) Passed() bool {
+	if len(recv.Assertions) == 0 {
+		return false
+	}
+
+	for _, assertion := range recv.Assertions {
+		if !assertion.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+func (recv *Report) add(name string, err error) bool {
+	assertion := Assertion{
+		Name:   name,
+		Passed: err == nil,
+	}
+	if err != nil {
+		assertion.Error = err.Error()
+	}
+
+	recv.Assertions = append(recv.Assertions, assertion)
+	return assertion.Passed
+}
+
+func (recv *Sandbox) setDefaults() error {
+	if recv.PorterVersion == "" {
+		recv.PorterVersion = constants.Version
+	}
+
+	if recv.Porter == "" {
+		executable, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		recv.Porter = executable
+	}
+
+	if recv.Timeout == 0 {
+		recv.Timeout = DefaultTimeout
+	}
+
+	return nil
+}
+
+// Run packs and provisions a generated service with the porter binary, runs
+// the assertions against the stack it created, and tears down everything the
+// service created unless the sandbox is kept
+func Run(log log15.Logger, sandbox Sandbox) (report *Report, success bool) {
+
+	report = &Report{
+		ServiceName: ServiceName(time.Now()),
+		Region:      sandbox.Region,
+	}
+
+	log = log.New("ServiceName", report.ServiceName, "Region", sandbox.Region)
+
+	err := sandbox.setDefaults()
+	if err != nil {
+		log.Error("os.Executable", "Error", err)
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "porter-testkit")
+	if err != nil {
+		log.Error("ioutil.TempDir", "Error", err)
+		return
+	}
+
+	if sandbox.Keep {
+		report.Dir = dir
+		log.Info("Keeping the project", "Dir", dir)
+	} else {
+		defer os.RemoveAll(dir)
+	}
+
+	roleSession := aws_session.STS(sandbox.Region, sandbox.RoleARN, 0)
+
+	defer func() {
+		if sandbox.Keep {
+			log.Warn("Keeping the sandbox. Run again without --keep or delete the service's stacks to clean it up")
+			return
+		}
+
+		report.TornDown = teardown(log, roleSession, sandbox, report.ServiceName)
+		success = success && report.TornDown
+	}()
+
+	if !report.add("project generated", WriteProject(dir, report.ServiceName, sandbox)) {
+		return
+	}
+
+	if !report.add("pack", porter(log, dir, sandbox.Porter, "build", "pack")) {
+		return
+	}
+
+	if !report.add("provision", porter(log, dir, sandbox.Porter, "build", "provision", "-e", EnvironmentName)) {
+		return
+	}
+
+	stack, err := readProvisionOutput(dir)
+	if !report.add("provision output", err) {
+		return
+	}
+
+	regionState, exists := stack.Regions[sandbox.Region]
+	if !exists {
+		err = fmt.Errorf("provision output has no stack in %s", sandbox.Region)
+	}
+	if !report.add("stack created", err) {
+		return
+	}
+
+	assertStack(log, roleSession, sandbox, regionState, report)
+
+	success = report.Passed()
+	return
+}
+
+// ServiceName is unique to a run so nothing it creates is shared with
+// another run or service
+func ServiceName(now time.Time) string {
+	return fmt.Sprintf("porter-testkit-%d", now.Unix())
+}
+
+// porter runs the porter binary in the project directory with its output
+// going to this process's
+func porter(log log15.Logger, dir, porterPath string, args ...string) error {
+	log.Info("Running porter", "Args", args)
+
+	cmd := exec.Command(porterPath, args...)
+	cmd.Dir = dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+func readProvisionOutput(dir string) (*provision_state.Stack, error) {
+	stackBytes, err := ioutil.ReadFile(filepath.Join(dir, constants.ProvisionOutputPath))
+	if err != nil {
+		return nil, err
+	}
+
+	stack := &provision_state.Stack{}
+	err = json.Unmarshal(stackBytes, stack)
+	if err != nil {
+		return nil, err
+	}
+
+	return stack, nil
+}
@@ -0,0 +1,90 @@
+package testkit_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/conf"
+	"github.com/adobe-platform/porter/testkit"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var _ = Describe("Testkit", func() {
+
+	var sandbox testkit.Sandbox
+
+	BeforeEach(func() {
+		sandbox = testkit.Sandbox{
+			RoleARN:       "arn:aws:iam::123456789012:role/porter-deployment",
+			Region:        "us-west-2",
+			AZs:           []string{"us-west-2a", "us-west-2b"},
+			S3Bucket:      "sandbox-bucket",
+			PorterVersion: "v1.0.0",
+		}
+	})
+
+	It("names the service uniquely for the run", func() {
+		Expect(testkit.ServiceName(time.Unix(1700000000, 0))).To(Equal("porter-testkit-1700000000"))
+	})
+
+	It("generates a valid .porter/config", func() {
+		configBytes, err := testkit.Config("porter-testkit-1", sandbox)
+		Expect(err).To(BeNil())
+
+		config := &conf.Config{}
+		Expect(yaml.Unmarshal(configBytes, config)).To(Succeed())
+		config.SetDefaults()
+		Expect(config.Validate()).To(Succeed())
+
+		environment, err := config.GetEnvironment(testkit.EnvironmentName)
+		Expect(err).To(BeNil())
+		Expect(environment.Regions).To(HaveLen(1))
+		Expect(environment.Regions[0].AZs).To(HaveLen(2))
+	})
+
+	It("puts each subnet in its availability zone", func() {
+		sandbox.VpcId = "vpc-12345678"
+		sandbox.SubnetIds = []string{"subnet-11111111", "subnet-22222222"}
+
+		configBytes, err := testkit.Config("porter-testkit-1", sandbox)
+		Expect(err).To(BeNil())
+
+		config := &conf.Config{}
+		Expect(yaml.Unmarshal(configBytes, config)).To(Succeed())
+		config.SetDefaults()
+		Expect(config.Validate()).To(Succeed())
+
+		region := config.Environments[0].Regions[0]
+		Expect(region.VpcId).To(Equal("vpc-12345678"))
+		Expect(region.AZs[1].Name).To(Equal("us-west-2b"))
+		Expect(region.AZs[1].SubnetID).To(Equal("subnet-22222222"))
+	})
+
+	It("needs availability zones and a subnet for each", func() {
+		sandbox.AZs = nil
+		_, err := testkit.Config("porter-testkit-1", sandbox)
+		Expect(err).NotTo(BeNil())
+
+		sandbox.AZs = []string{"us-west-2a", "us-west-2b"}
+		sandbox.VpcId = "vpc-12345678"
+		sandbox.SubnetIds = []string{"subnet-11111111"}
+		_, err = testkit.Config("porter-testkit-1", sandbox)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("passes only if every assertion passed", func() {
+		report := &testkit.Report{}
+		Expect(report.Passed()).To(BeFalse())
+
+		report.Assertions = []testkit.Assertion{
+			{Name: "pack", Passed: true},
+			{Name: "provision", Passed: false, Error: "exit status 1"},
+		}
+		Expect(report.Passed()).To(BeFalse())
+
+		report.Assertions[1].Passed = true
+		Expect(report.Passed()).To(BeTrue())
+	})
+})
@@ -0,0 +1,304 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package tracing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adobe-platform/porter/constants"
+	"github.com/inconshreveable/log15"
+)
+
+// OTLP status codes
+const (
+	statusOk    = 1
+	statusError = 2
+)
+
+var (
+	exportClient = &http.Client{
+		Timeout: 10 * time.Second,
+	}
+
+	spansLock sync.Mutex
+	spans     []*Span
+	root      *Span
+)
+
+type (
+	// Span is an OpenTelemetry span. A nil Span is a no-op so callers don't
+	// check whether tracing is enabled
+	Span struct {
+		traceId      string
+		spanId       string
+		parentSpanId string
+		name         string
+		start        time.Time
+		end          time.Time
+		attributes   map[string]string
+		success      bool
+	}
+
+	// the OTLP/HTTP JSON encoding of an ExportTraceServiceRequest
+	exportRequest struct {
+		ResourceSpans []resourceSpans `json:"resourceSpans"`
+	}
+
+	resourceSpans struct {
+		Resource   resource     `json:"resource"`
+		ScopeSpans []scopeSpans `json:"scopeSpans"`
+	}
+
+	resource struct {
+		Attributes []keyValue `json:"attributes"`
+	}
+
+	scopeSpans struct {
+		Scope scope      `json:"scope"`
+		Spans []spanJSON `json:"spans"`
+	}
+
+	scope struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+
+	spanJSON struct {
+		TraceId           string     `json:"traceId"`
+		SpanId            string     `json:"spanId"`
+		ParentSpanId      string     `json:"parentSpanId,omitempty"`
+		Name              string     `json:"name"`
+		Kind              int        `json:"kind"`
+		StartTimeUnixNano string     `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+		Attributes        []keyValue `json:"attributes,omitempty"`
+		Status            status     `json:"status"`
+	}
+
+	keyValue struct {
+		Key   string   `json:"key"`
+		Value anyValue `json:"value"`
+	}
+
+	anyValue struct {
+		StringValue string `json:"stringValue"`
+	}
+
+	status struct {
+		Code int `json:"code"`
+	}
+)
+
+// Endpoint is where spans are exported. Tracing is off without one
+func Endpoint() string {
+	if endpoint := os.Getenv(constants.EnvOtelTracesEndpoint); endpoint != "" {
+		return endpoint
+	}
+
+	if endpoint := os.Getenv(constants.EnvOtelEndpoint); endpoint != "" {
+		return strings.TrimRight(endpoint, "/") + "/v1/traces"
+	}
+
+	return ""
+}
+
+// Start begins a span. A nil parent starts a new trace
+func Start(parent *Span, name string) *Span {
+	if Endpoint() == "" {
+		return nil
+	}
+
+	span := &Span{
+		spanId:     randomHex(8),
+		name:       name,
+		start:      time.Now(),
+		attributes: make(map[string]string),
+	}
+
+	if parent == nil {
+		span.traceId = randomHex(16)
+	} else {
+		span.traceId = parent.traceId
+		span.parentSpanId = parent.spanId
+	}
+
+	return span
+}
+
+// SetRoot makes span the parent of spans started where the deploy's span
+// isn't passed down
+func SetRoot(span *Span) {
+	spansLock.Lock()
+	defer spansLock.Unlock()
+
+	root = span
+}
+
+// Root is the span set by SetRoot
+func Root() *Span {
+	spansLock.Lock()
+	defer spansLock.Unlock()
+
+	return root
+}
+
+// SetAttribute adds a string attribute to the span
+func (recv *Span) SetAttribute(key, value string) *Span {
+	if recv == nil {
+		return nil
+	}
+
+	recv.attributes[key] = value
+	return recv
+}
+
+// End finishes the span and queues it for Flush
+func (recv *Span) End(success bool) {
+	if recv == nil {
+		return
+	}
+
+	recv.end = time.Now()
+	recv.success = success
+
+	spansLock.Lock()
+	defer spansLock.Unlock()
+
+	spans = append(spans, recv)
+}
+
+// Flush exports every ended span over OTLP/HTTP. Tracing is informational so
+// failing to export is only a warning
+func Flush(log log15.Logger) {
+	endpoint := Endpoint()
+	if endpoint == "" {
+		return
+	}
+
+	spansLock.Lock()
+	ended := spans
+	spans = nil
+	spansLock.Unlock()
+
+	if len(ended) == 0 {
+		return
+	}
+
+	bodyBytes, err := json.Marshal(newExportRequest(ended))
+	if err != nil {
+		log.Warn("Traces json.Marshal", "Error", err)
+		return
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(bodyBytes))
+	if err != nil {
+		log.Warn("Traces http.NewRequest", "Error", err)
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers() {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := exportClient.Do(req)
+	if err != nil {
+		log.Warn("Failed to export traces", "Error", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		log.Warn("Failed to export traces", "StatusCode", resp.StatusCode)
+		return
+	}
+
+	log.Debug("Exported traces", "Spans", len(ended))
+}
+
+func newExportRequest(ended []*Span) exportRequest {
+	resourceAttributes := []keyValue{
+		{Key: "service.name", Value: anyValue{StringValue: "porter"}},
+		{Key: "service.version", Value: anyValue{StringValue: constants.Version}},
+	}
+
+	spansJSON := make([]spanJSON, 0, len(ended))
+	for _, span := range ended {
+
+		attributes := make([]keyValue, 0, len(span.attributes))
+		for key, value := range span.attributes {
+			attributes = append(attributes, keyValue{Key: key, Value: anyValue{StringValue: value}})
+		}
+
+		spanStatus := status{Code: statusOk}
+		if !span.success {
+			spanStatus.Code = statusError
+		}
+
+		spansJSON = append(spansJSON, spanJSON{
+			TraceId:           span.traceId,
+			SpanId:            span.spanId,
+			ParentSpanId:      span.parentSpanId,
+			Name:              span.name,
+			Kind:              1, // SPAN_KIND_INTERNAL
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+			Attributes:        attributes,
+			Status:            spanStatus,
+		})
+	}
+
+	return exportRequest{
+		ResourceSpans: []resourceSpans{
+			{
+				Resource: resource{Attributes: resourceAttributes},
+				ScopeSpans: []scopeSpans{
+					{
+						Scope: scope{Name: "porter", Version: constants.Version},
+						Spans: spansJSON,
+					},
+				},
+			},
+		},
+	}
+}
+
+// headers parses OTEL_EXPORTER_OTLP_HEADERS which is key=value pairs
+// separated by commas
+func headers() map[string]string {
+	parsed := make(map[string]string)
+
+	for _, pair := range strings.Split(os.Getenv(constants.EnvOtelHeaders), ",") {
+		keyValue := strings.SplitN(pair, "=", 2)
+		if len(keyValue) != 2 {
+			continue
+		}
+		parsed[strings.TrimSpace(keyValue[0])] = strings.TrimSpace(keyValue[1])
+	}
+
+	return parsed
+}
+
+func randomHex(byteCount int) string {
+	randomBytes := make([]byte, byteCount)
+	rand.Read(randomBytes)
+	return hex.EncodeToString(randomBytes)
+}
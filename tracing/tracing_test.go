@@ -0,0 +1,121 @@
+package tracing_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/constants"
+	"github.com/adobe-platform/porter/logger"
+	"github.com/adobe-platform/porter/tracing"
+)
+
+var _ = Describe("Tracing", func() {
+
+	type exported struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceId      string `json:"traceId"`
+					SpanId       string `json:"spanId"`
+					ParentSpanId string `json:"parentSpanId"`
+					Name         string `json:"name"`
+					Attributes   []struct {
+						Key   string `json:"key"`
+						Value struct {
+							StringValue string `json:"stringValue"`
+						} `json:"value"`
+					} `json:"attributes"`
+					Status struct {
+						Code int `json:"code"`
+					} `json:"status"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+
+	var (
+		server   *httptest.Server
+		paths    []string
+		auth     []string
+		requests []exported
+	)
+
+	BeforeEach(func() {
+		paths = nil
+		auth = nil
+		requests = nil
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+
+			var body exported
+			Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+
+			paths = append(paths, r.URL.Path)
+			auth = append(auth, r.Header.Get("Authorization"))
+			requests = append(requests, body)
+		}))
+
+		os.Setenv(constants.EnvOtelEndpoint, server.URL+"/")
+		os.Setenv(constants.EnvOtelHeaders, "Authorization=Bearer token, X-Ignored")
+	})
+
+	AfterEach(func() {
+		os.Unsetenv(constants.EnvOtelEndpoint)
+		os.Unsetenv(constants.EnvOtelHeaders)
+		server.Close()
+	})
+
+	It("exports parent and child spans over OTLP/HTTP", func() {
+		root := tracing.Start(nil, "provision")
+		child := tracing.Start(root, "upload service payload").SetAttribute("region", "us-west-2")
+		child.End(false)
+		root.End(true)
+
+		tracing.Flush(logger.CLI())
+
+		Expect(paths).To(Equal([]string{"/v1/traces"}))
+		Expect(auth).To(Equal([]string{"Bearer token"}))
+
+		spans := requests[0].ResourceSpans[0].ScopeSpans[0].Spans
+		Expect(spans).To(HaveLen(2))
+
+		Expect(spans[0].Name).To(Equal("upload service payload"))
+		Expect(spans[0].TraceId).To(Equal(spans[1].TraceId))
+		Expect(spans[0].ParentSpanId).To(Equal(spans[1].SpanId))
+		Expect(spans[0].Attributes[0].Key).To(Equal("region"))
+		Expect(spans[0].Attributes[0].Value.StringValue).To(Equal("us-west-2"))
+		Expect(spans[0].Status.Code).To(Equal(2))
+
+		Expect(spans[1].ParentSpanId).To(BeEmpty())
+		Expect(spans[1].Status.Code).To(Equal(1))
+	})
+
+	It("prefers the traces endpoint", func() {
+		os.Setenv(constants.EnvOtelTracesEndpoint, server.URL+"/custom")
+		defer os.Unsetenv(constants.EnvOtelTracesEndpoint)
+
+		tracing.Start(nil, "provision").End(true)
+		tracing.Flush(logger.CLI())
+
+		Expect(paths).To(Equal([]string{"/custom"}))
+	})
+
+	It("does nothing without an endpoint", func() {
+		os.Unsetenv(constants.EnvOtelEndpoint)
+
+		span := tracing.Start(nil, "provision")
+		Expect(span).To(BeNil())
+
+		span.SetAttribute("region", "us-west-2")
+		span.End(true)
+		tracing.Flush(logger.CLI())
+
+		Expect(requests).To(BeEmpty())
+	})
+})
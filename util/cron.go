@@ -0,0 +1,182 @@
+/*
+ *  Copyright 2016 Adobe Systems Incorporated. All rights reserved.
+ *  This file is licensed to you under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License. You may obtain a copy
+ *  of the License at http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software distributed under
+ *  the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR REPRESENTATIONS
+ *  OF ANY KIND, either express or implied. See the License for the specific language
+ *  governing permissions and limitations under the License.
+ */
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a Unix cron expression like autoscaling scheduled actions
+// take: minute hour day-of-month month day-of-week
+type CronSchedule struct {
+	minutes     uint64
+	hours       uint64
+	daysOfMonth uint64
+	months      uint64
+	daysOfWeek  uint64
+
+	// cron runs on days matching either day field when both are restricted
+	daysOfMonthRestricted bool
+	daysOfWeekRestricted  bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day-of-month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{
+		"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC",
+	}},
+	// 7 is also Sunday
+	{name: "day-of-week", min: 0, max: 7, names: []string{
+		"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT",
+	}},
+}
+
+// ParseCron parses the 5 fields of a cron expression. Each field is *, a
+// value, a range, or a list of them, with an optional /step. Months and days
+// of the week can be named
+func ParseCron(expr string) (*CronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q must have %d fields", expr, len(cronFields))
+	}
+
+	var bits [5]uint64
+	for i, field := range fields {
+		var err error
+		bits[i], err = cronFields[i].parse(field)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// fold Sunday as 7 into 0
+	if bits[4]&(1<<7) != 0 {
+		bits[4] = bits[4]&^(1<<7) | 1
+	}
+
+	return &CronSchedule{
+		minutes:     bits[0],
+		hours:       bits[1],
+		daysOfMonth: bits[2],
+		months:      bits[3],
+		daysOfWeek:  bits[4],
+
+		daysOfMonthRestricted: !strings.HasPrefix(fields[2], "*"),
+		daysOfWeekRestricted:  !strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+func (recv cronField) parse(field string) (bits uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+
+		step := 1
+		if slash := strings.Index(part, "/"); slash != -1 {
+			step, err = strconv.Atoi(part[slash+1:])
+			if err != nil || step < 1 {
+				err = fmt.Errorf("invalid %s step in %q", recv.name, part)
+				return
+			}
+			part = part[:slash]
+		}
+
+		low, high := recv.min, recv.max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			if low, err = recv.value(bounds[0]); err != nil {
+				return
+			}
+			if high, err = recv.value(bounds[1]); err != nil {
+				return
+			}
+			if low > high {
+				err = fmt.Errorf("invalid %s range %q", recv.name, part)
+				return
+			}
+		default:
+			if low, err = recv.value(part); err != nil {
+				return
+			}
+			// a single value with a step runs to the end of the field
+			if step == 1 {
+				high = low
+			}
+		}
+
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return
+}
+
+func (recv cronField) value(s string) (int, error) {
+	for i, name := range recv.names {
+		if strings.EqualFold(s, name) {
+			return recv.min + i, nil
+		}
+	}
+
+	value, err := strconv.Atoi(s)
+	if err != nil || value < recv.min || value > recv.max {
+		return 0, fmt.Errorf("invalid %s %q", recv.name, s)
+	}
+	return value, nil
+}
+
+func (recv *CronSchedule) matchesDay(day time.Time) bool {
+	dayOfMonth := recv.daysOfMonth&(1<<uint(day.Day())) != 0
+	dayOfWeek := recv.daysOfWeek&(1<<uint(day.Weekday())) != 0
+
+	if recv.months&(1<<uint(day.Month())) == 0 {
+		return false
+	}
+
+	switch {
+	case recv.daysOfMonthRestricted && recv.daysOfWeekRestricted:
+		return dayOfMonth || dayOfWeek
+	case recv.daysOfMonthRestricted:
+		return dayOfMonth
+	case recv.daysOfWeekRestricted:
+		return dayOfWeek
+	}
+	return true
+}
+
+// Overlaps is true if both schedules run at the same minute on some day
+func (recv *CronSchedule) Overlaps(other *CronSchedule) bool {
+	if recv.minutes&other.minutes == 0 || recv.hours&other.hours == 0 {
+		return false
+	}
+
+	// the calendar repeats every 28 years between century years
+	day := time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := day.AddDate(28, 0, 0)
+	for ; day.Before(end); day = day.AddDate(0, 0, 1) {
+		if recv.matchesDay(day) && other.matchesDay(day) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package util_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/adobe-platform/porter/util"
+)
+
+var _ = Describe("Cron", func() {
+
+	overlaps := func(a, b string) bool {
+		scheduleA, err := util.ParseCron(a)
+		Expect(err).To(BeNil())
+		scheduleB, err := util.ParseCron(b)
+		Expect(err).To(BeNil())
+		return scheduleA.Overlaps(scheduleB)
+	}
+
+	It("parses values, ranges, lists, steps, and names", func() {
+		for _, expr := range []string{
+			"* * * * *",
+			"0 13 * * MON-FRI",
+			"*/15 0-6,18-23 1,15 jan-jun 0",
+			"30 2 * * 7",
+			"5/10 * * * *",
+		} {
+			_, err := util.ParseCron(expr)
+			Expect(err).To(BeNil(), expr)
+		}
+	})
+
+	It("rejects malformed expressions", func() {
+		for _, expr := range []string{
+			"* * * *",
+			"60 * * * *",
+			"* 24 * * *",
+			"* * 0 * *",
+			"* * * 13 *",
+			"* * * * 8",
+			"5-1 * * * *",
+			"*/0 * * * *",
+			"@daily",
+		} {
+			_, err := util.ParseCron(expr)
+			Expect(err).ToNot(BeNil(), expr)
+		}
+	})
+
+	It("finds schedules that run at the same minute", func() {
+		Expect(overlaps("0 13 * * MON-FRI", "0 13 * * 1")).To(BeTrue())
+		Expect(overlaps("*/15 * * * *", "30 8 * * *")).To(BeTrue())
+		Expect(overlaps("0 0 1 * *", "0 0 * * SUN")).To(BeTrue())
+		Expect(overlaps("0 0 29 2 *", "0 0 * * MON")).To(BeTrue())
+		Expect(overlaps("0 0 * * 7", "0 0 * * 0")).To(BeTrue())
+	})
+
+	It("doesn't flag schedules that never run together", func() {
+		Expect(overlaps("0 13 * * MON-FRI", "0 1 * * MON-FRI")).To(BeFalse())
+		Expect(overlaps("0 13 * * MON-FRI", "0 13 * * SAT,SUN")).To(BeFalse())
+		Expect(overlaps("0 0 31 * *", "0 0 * 2 *")).To(BeFalse())
+		Expect(overlaps("*/20 * * * *", "10 * * * *")).To(BeFalse())
+	})
+})
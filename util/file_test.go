@@ -0,0 +1,84 @@
+package util_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/adobe-platform/porter/util"
+)
+
+var _ = Describe("File ops", func() {
+
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "porter-util")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Context("CopyFile", func() {
+
+		It("Replaces the destination", func() {
+			src := filepath.Join(dir, "src")
+			dst := filepath.Join(dir, "dst")
+			Expect(ioutil.WriteFile(src, []byte("payload"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(dst, []byte("a longer old payload"), 0644)).To(Succeed())
+
+			Expect(util.CopyFile(src, dst)).To(Succeed())
+
+			copied, err := ioutil.ReadFile(dst)
+			Expect(err).To(BeNil())
+			Expect(string(copied)).To(Equal("payload"))
+		})
+
+		It("Fails on a missing source", func() {
+			err := util.CopyFile(filepath.Join(dir, "missing"), filepath.Join(dir, "dst"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+
+	Context("TarDir", func() {
+
+		It("Archives relative to the directory", func() {
+			Expect(os.MkdirAll(filepath.Join(dir, "images"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "images", "web.docker"), []byte("image"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "config.yaml"), []byte("config"), 0644)).To(Succeed())
+
+			var buf bytes.Buffer
+			Expect(util.TarDir(dir, &buf)).To(Succeed())
+
+			contents := make(map[string]string)
+			reader := tar.NewReader(&buf)
+			for {
+				header, err := reader.Next()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).To(BeNil())
+
+				body, err := ioutil.ReadAll(reader)
+				Expect(err).To(BeNil())
+				contents[header.Name] = string(body)
+			}
+
+			Expect(contents).To(Equal(map[string]string{
+				"./":                  "",
+				"./config.yaml":       "config",
+				"./images/":           "",
+				"./images/web.docker": "image",
+			}))
+		})
+	})
+})
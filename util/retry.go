@@ -2,9 +2,19 @@ package util
 
 import (
 	"math"
+	"sync/atomic"
 	"time"
 )
 
+// retries counts the retries of every retryer in this process
+var retries int64
+
+// Retries is how many times SuccessRetryer and ErrorRetryer have retried an
+// action in this process
+func Retries() int64 {
+	return atomic.LoadInt64(&retries)
+}
+
 // SuccessRetryer does exponential backoff of the action function which returns
 // a boolean
 //
@@ -26,6 +36,7 @@ func SuccessRetryer(count int, retryMsg func(int), action func() bool) (success
 		if i > 0 {
 			duration := time.Duration(math.Pow(2, float64(i)))
 			time.Sleep(duration * time.Second)
+			atomic.AddInt64(&retries, 1)
 			retryMsg(i)
 		}
 
@@ -50,6 +61,7 @@ func ErrorRetryer(count int, retryMsg func(int), action func() error) (err error
 		if i > 0 {
 			duration := time.Duration(math.Pow(2, float64(i)))
 			time.Sleep(duration * time.Second)
+			atomic.AddInt64(&retries, 1)
 			retryMsg(i)
 		}
 
@@ -33,6 +33,14 @@ var _ = Describe("Retryers", func() {
 			Expect(i).To(Equal(2))
 			Expect(success).To(BeFalse())
 		})
+
+		It("Counts retries", func() {
+			before := util.Retries()
+			util.SuccessRetryer(2, func(int) {}, func() bool {
+				return false
+			})
+			Expect(util.Retries() - before).To(Equal(int64(1)))
+		})
 	})
 
 	Context("ErrorRetryer", func() {